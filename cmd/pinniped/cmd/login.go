@@ -1,4 +1,4 @@
-// Copyright 2020-2023 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package cmd
@@ -46,3 +46,18 @@ func loadClusterInfo() *clientauthv1beta1.Cluster {
 	}
 	return cred.Spec.Cluster
 }
+
+// oidcLoginCacheKey is the key of the credential cache entries of "pinniped login oidc". It must not change, or else
+// the existing cache entries would no longer be found. It is also used by "pinniped logout" to remove the entries.
+type oidcLoginCacheKey struct {
+	Args        []string                   `json:"args"`
+	ClusterInfo *clientauthv1beta1.Cluster `json:"cluster"`
+}
+
+// staticLoginCacheKey is the key of the credential cache entries of "pinniped login static". Like oidcLoginCacheKey,
+// it must not change.
+type staticLoginCacheKey struct {
+	Args        []string                   `json:"args"`
+	Token       string                     `json:"token"`
+	ClusterInfo *clientauthv1beta1.Cluster `json:"cluster"`
+}
@@ -1,4 +1,4 @@
-// Copyright 2020-2023 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package cmd
@@ -39,6 +39,15 @@ const (
 	// which specifies "cli_password" when using an IDE plugin where there is no interactive CLI available. This allows
 	// the user to use one kubeconfig file for both flows.
 	upstreamIdentityProviderFlowEnvVarName = "PINNIPED_UPSTREAM_IDENTITY_PROVIDER_FLOW"
+
+	// The user may override the flow selection made by `--browser-flow` using an env var, for example to choose
+	// the "device_code" flow when logging in on a host reached by SSH, where no web browser can be opened.
+	browserFlowEnvVarName = "PINNIPED_BROWSER_FLOW"
+
+	// These are the values of `--browser-flow`, which choose how the CLI gets the result of a login which
+	// happens in a web browser.
+	browserFlowAuthcode   = "authcode"
+	browserFlowDeviceCode = "device_code"
 )
 
 //nolint:gochecknoinits
@@ -84,6 +93,7 @@ type oidcLoginFlags struct {
 	upstreamIdentityProviderName string
 	upstreamIdentityProviderType string
 	upstreamIdentityProviderFlow string
+	browserFlow                  string
 }
 
 func oidcLoginCommand(deps oidcLoginCommandDeps) *cobra.Command {
@@ -128,9 +138,11 @@ func oidcLoginCommand(deps oidcLoginCommandDeps) *cobra.Command {
 	cmd.Flags().StringVar(&flags.conciergeAPIGroupSuffix, "concierge-api-group-suffix", groupsuffix.PinnipedDefaultSuffix, "Concierge API group suffix")
 	cmd.Flags().StringVar(&flags.credentialCachePath, "credential-cache", filepath.Join(mustGetConfigDir(), "credentials.yaml"), "Path to cluster-specific credentials cache (\"\" disables the cache)")
 	cmd.Flags().StringVar(&flags.upstreamIdentityProviderName, "upstream-identity-provider-name", "", "The name of the upstream identity provider used during login with a Supervisor")
-	cmd.Flags().StringVar(&flags.upstreamIdentityProviderType, "upstream-identity-provider-type", idpdiscoveryv1alpha1.IDPTypeOIDC.String(), fmt.Sprintf("The type of the upstream identity provider used during login with a Supervisor (e.g. '%s', '%s', '%s')", idpdiscoveryv1alpha1.IDPTypeOIDC, idpdiscoveryv1alpha1.IDPTypeLDAP, idpdiscoveryv1alpha1.IDPTypeActiveDirectory))
+	cmd.Flags().StringVar(&flags.upstreamIdentityProviderType, "upstream-identity-provider-type", idpdiscoveryv1alpha1.IDPTypeOIDC.String(), fmt.Sprintf("The type of the upstream identity provider used during login with a Supervisor (e.g. '%s', '%s', '%s', '%s', '%s')", idpdiscoveryv1alpha1.IDPTypeOIDC, idpdiscoveryv1alpha1.IDPTypeLDAP, idpdiscoveryv1alpha1.IDPTypeActiveDirectory, idpdiscoveryv1alpha1.IDPTypeSAML, idpdiscoveryv1alpha1.IDPTypeGitHub))
 	cmd.Flags().StringVar(&flags.upstreamIdentityProviderFlow, "upstream-identity-provider-flow", "", fmt.Sprintf("The type of client flow to use with the upstream identity provider during login with a Supervisor (e.g. '%s', '%s')", idpdiscoveryv1alpha1.IDPFlowBrowserAuthcode, idpdiscoveryv1alpha1.IDPFlowCLIPassword))
 
+	cmd.Flags().StringVar(&flags.browserFlow, "browser-flow", browserFlowAuthcode, fmt.Sprintf("The type of flow to use when logging in using a web browser: '%s' opens a web browser and listens for a callback on localhost, '%s' prints a link and a code to use with a web browser on any device", browserFlowAuthcode, browserFlowDeviceCode))
+
 	// --skip-listen is mainly needed for testing. We'll leave it hidden until we have a non-testing use case.
 	mustMarkHidden(cmd, "skip-listen")
 	mustMarkHidden(cmd, "debug-session-cache")
@@ -192,6 +204,12 @@ func runOIDCLogin(cmd *cobra.Command, deps oidcLoginCommandDeps, flags oidcLogin
 	}
 	opts = append(opts, flowOpts...)
 
+	browserFlowOpts, err := browserFlowOptions(flags.browserFlow, len(flowOpts) > 0, deps)
+	if err != nil {
+		return err
+	}
+	opts = append(opts, browserFlowOpts...)
+
 	var concierge *conciergeclient.Client
 	if flags.conciergeEnabled {
 		var err error
@@ -224,10 +242,7 @@ func runOIDCLogin(cmd *cobra.Command, deps oidcLoginCommandDeps, flags oidcLogin
 		opts = append(opts, oidcclient.WithClient(client))
 	}
 	// Look up cached credentials based on a hash of all the CLI arguments and the cluster info.
-	cacheKey := struct {
-		Args        []string                   `json:"args"`
-		ClusterInfo *clientauthv1beta1.Cluster `json:"cluster"`
-	}{
+	cacheKey := oidcLoginCacheKey{
 		Args:        os.Args[1:],
 		ClusterInfo: loadClusterInfo(),
 	}
@@ -311,6 +326,15 @@ func flowOptions(
 				flowSource, requestedIDPType, requestedFlow,
 				strings.Join([]string{idpdiscoveryv1alpha1.IDPFlowCLIPassword.String(), idpdiscoveryv1alpha1.IDPFlowBrowserAuthcode.String()}, ", "))
 		}
+	case idpdiscoveryv1alpha1.IDPTypeSAML, idpdiscoveryv1alpha1.IDPTypeGitHub:
+		switch requestedFlow {
+		case idpdiscoveryv1alpha1.IDPFlowBrowserAuthcode, "":
+			return nil, nil // browser authcode flow is the default Option, so don't need to return an Option here
+		default:
+			return nil, fmt.Errorf(
+				"%s value not recognized for identity provider type %q: %s (supported values: %s)",
+				flowSource, requestedIDPType, requestedFlow, idpdiscoveryv1alpha1.IDPFlowBrowserAuthcode.String())
+		}
 	default:
 		// Surprisingly cobra does not support this kind of flag validation. See https://github.com/spf13/pflag/issues/236
 		return nil, fmt.Errorf(
@@ -320,11 +344,36 @@ func flowOptions(
 				idpdiscoveryv1alpha1.IDPTypeOIDC.String(),
 				idpdiscoveryv1alpha1.IDPTypeLDAP.String(),
 				idpdiscoveryv1alpha1.IDPTypeActiveDirectory.String(),
+				idpdiscoveryv1alpha1.IDPTypeSAML.String(),
+				idpdiscoveryv1alpha1.IDPTypeGitHub.String(),
 			}, ", "),
 		)
 	}
 }
 
+func browserFlowOptions(requestedBrowserFlow string, usingCLIFlow bool, deps oidcLoginCommandDeps) ([]oidcclient.Option, error) {
+	// If the env var is set to override the --browser-flow flag, then override it.
+	flowSource := "--browser-flow"
+	if flowOverride, hasFlowOverride := deps.lookupEnv(browserFlowEnvVarName); hasFlowOverride {
+		requestedBrowserFlow = flowOverride
+		flowSource = browserFlowEnvVarName
+	}
+
+	switch requestedBrowserFlow {
+	case browserFlowAuthcode, "":
+		return nil, nil // browser authcode flow is the default Option, so don't need to return an Option here
+	case browserFlowDeviceCode:
+		if usingCLIFlow {
+			return nil, fmt.Errorf("%s value %q cannot be used with the %q upstream identity provider flow",
+				flowSource, requestedBrowserFlow, idpdiscoveryv1alpha1.IDPFlowCLIPassword)
+		}
+		return []oidcclient.Option{oidcclient.WithDeviceAuthorizationGrant()}, nil
+	default:
+		return nil, fmt.Errorf("%s value not recognized: %s (supported values: %s)",
+			flowSource, requestedBrowserFlow, strings.Join([]string{browserFlowAuthcode, browserFlowDeviceCode}, ", "))
+	}
+}
+
 func makeClient(caBundlePaths []string, caBundleData []string) (*http.Client, error) {
 	pool := x509.NewCertPool()
 	for _, p := range caBundlePaths {
@@ -1,4 +1,4 @@
-// Copyright 2020-2023 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package cmd
@@ -136,11 +136,7 @@ func runStaticLogin(cmd *cobra.Command, deps staticLoginDeps, flags staticLoginP
 	cred := tokenCredential(&oidctypes.Token{IDToken: &oidctypes.IDToken{Token: token}})
 
 	// Look up cached credentials based on a hash of all the CLI arguments, the current token value, and the cluster info.
-	cacheKey := struct {
-		Args        []string                   `json:"args"`
-		Token       string                     `json:"token"`
-		ClusterInfo *clientauthv1beta1.Cluster `json:"cluster"`
-	}{
+	cacheKey := staticLoginCacheKey{
 		Args:        os.Args[1:],
 		Token:       token,
 		ClusterInfo: loadClusterInfo(),
@@ -0,0 +1,239 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/spf13/cobra"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	clientauthv1beta1 "k8s.io/client-go/pkg/apis/clientauthentication/v1beta1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+
+	"go.pinniped.dev/internal/execcredcache"
+	"go.pinniped.dev/internal/here"
+	"go.pinniped.dev/internal/plog"
+	"go.pinniped.dev/pkg/oidcclient"
+	"go.pinniped.dev/pkg/oidcclient/filesession"
+)
+
+//nolint:gochecknoinits
+func init() {
+	rootCmd.AddCommand(logoutCommand(logoutCommandRealDeps()))
+}
+
+type logoutCommandDeps struct {
+	lookupEnv func(string) (string, bool)
+	logout    func(string, string, ...oidcclient.Option) error
+}
+
+func logoutCommandRealDeps() logoutCommandDeps {
+	return logoutCommandDeps{
+		lookupEnv: os.LookupEnv,
+		logout:    oidcclient.Logout,
+	}
+}
+
+type logoutFlags struct {
+	kubeconfigPath            string
+	kubeconfigContextOverride string
+	allContexts               bool
+}
+
+func logoutCommand(deps logoutCommandDeps) *cobra.Command {
+	cmd := &cobra.Command{
+		Args:  cobra.NoArgs, // do not accept positional arguments for this command
+		Use:   "logout",
+		Short: "Log out of the current kubeconfig context",
+		Long: here.Doc(
+			`Log out of the current kubeconfig context
+
+			Removes the cached sessions and cluster credentials of a kubeconfig context which
+			uses "pinniped login oidc" or "pinniped login static". When the OIDC issuer
+			supports token revocation, the session is also ended on the issuer by revoking
+			its refresh token.`,
+		),
+		SilenceUsage: true, // do not print usage message when commands fail
+	}
+	flags := &logoutFlags{}
+
+	f := cmd.Flags()
+	f.StringVar(&flags.kubeconfigPath, "kubeconfig", os.Getenv("KUBECONFIG"), "Path to kubeconfig file")
+	f.StringVar(&flags.kubeconfigContextOverride, "kubeconfig-context", "", "Kubeconfig context name (default: current active context)")
+	f.BoolVar(&flags.allContexts, "all-contexts", false, "Log out of every kubeconfig context which uses a Pinniped login")
+
+	cmd.RunE = func(cmd *cobra.Command, _ []string) error { return runLogout(cmd, deps, flags) }
+	return cmd
+}
+
+func runLogout(cmd *cobra.Command, deps logoutCommandDeps, flags *logoutFlags) error {
+	if flags.allContexts && flags.kubeconfigContextOverride != "" {
+		return fmt.Errorf("--all-contexts and --kubeconfig-context cannot be used together")
+	}
+
+	kubeconfig, err := newClientConfig(flags.kubeconfigPath, "").RawConfig()
+	if err != nil {
+		return fmt.Errorf("could not load kubeconfig: %w", err)
+	}
+
+	if !flags.allContexts {
+		contextName := kubeconfig.CurrentContext
+		if flags.kubeconfigContextOverride != "" {
+			contextName = flags.kubeconfigContextOverride
+		}
+		if contextName == "" {
+			return fmt.Errorf("no current kubeconfig context, use --kubeconfig-context or --all-contexts")
+		}
+		loggedOut, err := logoutOfContext(cmd, deps, flags.kubeconfigPath, &kubeconfig, contextName)
+		if err != nil {
+			return err
+		}
+		if !loggedOut {
+			return fmt.Errorf("kubeconfig context %q does not use a Pinniped login", contextName)
+		}
+		return nil
+	}
+
+	contextNames := make([]string, 0, len(kubeconfig.Contexts))
+	for name := range kubeconfig.Contexts {
+		contextNames = append(contextNames, name)
+	}
+	sort.Strings(contextNames)
+
+	// Keep going after an error, so that one unreachable issuer does not prevent logging out of the other contexts.
+	var errs []error
+	for _, contextName := range contextNames {
+		if _, err := logoutOfContext(cmd, deps, flags.kubeconfigPath, &kubeconfig, contextName); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// logoutOfContext removes the cached data of a kubeconfig context by reconstructing the cache keys which were used by
+// the login command of the context. It returns false when the context does not use a Pinniped login command.
+func logoutOfContext(
+	cmd *cobra.Command,
+	deps logoutCommandDeps,
+	kubeconfigPath string,
+	kubeconfig *clientcmdapi.Config,
+	contextName string,
+) (bool, error) {
+	kubeContext, ok := kubeconfig.Contexts[contextName]
+	if !ok {
+		return false, fmt.Errorf("kubeconfig context %q does not exist", contextName)
+	}
+	authInfo, ok := kubeconfig.AuthInfos[kubeContext.AuthInfo]
+	if !ok || authInfo.Exec == nil || len(authInfo.Exec.Args) < 2 || authInfo.Exec.Args[0] != "login" {
+		return false, nil
+	}
+
+	var clusterInfo *clientauthv1beta1.Cluster
+	if authInfo.Exec.ProvideClusterInfo {
+		var err error
+		clusterInfo, err = execClusterInfo(newClientConfig(kubeconfigPath, contextName))
+		if err != nil {
+			return false, fmt.Errorf("could not get cluster info of kubeconfig context %q: %w", contextName, err)
+		}
+	}
+
+	// The login command was invoked by client-go with exactly these arguments, so parsing them with the same command
+	// gives the same flag values, including the defaults.
+	args := authInfo.Exec.Args
+	var err error
+	switch args[1] {
+	case "oidc":
+		err = logoutOfOIDCLogin(cmd, deps, args, clusterInfo)
+	case "static":
+		err = logoutOfStaticLogin(deps, args, clusterInfo)
+	default:
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("could not log out of kubeconfig context %q: %w", contextName, err)
+	}
+
+	_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Logged out of kubeconfig context %q.\n", contextName)
+	return true, nil
+}
+
+func logoutOfOIDCLogin(cmd *cobra.Command, deps logoutCommandDeps, args []string, clusterInfo *clientauthv1beta1.Cluster) error {
+	loginCmd := oidcLoginCommand(oidcLoginCommandRealDeps())
+	if err := loginCmd.ParseFlags(args[2:]); err != nil {
+		return fmt.Errorf("could not parse login arguments: %w", err)
+	}
+	loginFlags := loginCmd.Flags()
+	issuer, _ := loginFlags.GetString("issuer")
+	clientID, _ := loginFlags.GetString("client-id")
+	scopes, _ := loginFlags.GetStringSlice("scopes")
+	listenPort, _ := loginFlags.GetUint16("listen-port")
+	sessionCachePath, _ := loginFlags.GetString("session-cache")
+	caBundlePaths, _ := loginFlags.GetStringSlice("ca-bundle")
+	caBundleData, _ := loginFlags.GetStringSlice("ca-bundle-data")
+	credentialCachePath, _ := loginFlags.GetString("credential-cache")
+
+	// Remove the cluster credential first, since it would still allow access after the session is gone.
+	if credentialCachePath != "" {
+		execcredcache.New(credentialCachePath).Delete(oidcLoginCacheKey{Args: args, ClusterInfo: clusterInfo})
+	}
+
+	opts := []oidcclient.Option{
+		oidcclient.WithContext(cmd.Context()),
+		oidcclient.WithLogger(plog.Logr()), //nolint:staticcheck  // consistent with the login command
+		oidcclient.WithScopes(scopes),
+		oidcclient.WithSessionCache(filesession.New(sessionCachePath)),
+	}
+	if listenPort != 0 {
+		opts = append(opts, oidcclient.WithListenPort(listenPort))
+	}
+	if len(caBundlePaths) > 0 || len(caBundleData) > 0 {
+		client, err := makeClient(caBundlePaths, caBundleData)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, oidcclient.WithClient(client))
+	}
+	return deps.logout(issuer, clientID, opts...)
+}
+
+func logoutOfStaticLogin(deps logoutCommandDeps, args []string, clusterInfo *clientauthv1beta1.Cluster) error {
+	loginCmd := staticLoginCommand(staticLoginRealDeps())
+	if err := loginCmd.ParseFlags(args[2:]); err != nil {
+		return fmt.Errorf("could not parse login arguments: %w", err)
+	}
+	loginFlags := loginCmd.Flags()
+	token, _ := loginFlags.GetString("token")
+	tokenEnvName, _ := loginFlags.GetString("token-env")
+	credentialCachePath, _ := loginFlags.GetString("credential-cache")
+
+	if tokenEnvName != "" {
+		token, _ = deps.lookupEnv(tokenEnvName)
+	}
+	if credentialCachePath != "" {
+		execcredcache.New(credentialCachePath).Delete(staticLoginCacheKey{Args: args, Token: token, ClusterInfo: clusterInfo})
+	}
+	return nil
+}
+
+// execClusterInfo returns the cluster info which client-go gives to a credential plugin when the kubeconfig sets
+// provideClusterInfo, so that it can be used to find the plugin's credential cache entries.
+func execClusterInfo(clientConfig clientcmd.ClientConfig) (*clientauthv1beta1.Cluster, error) {
+	restConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	cluster, err := rest.ConfigToExecCluster(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	var result clientauthv1beta1.Cluster
+	if err := clientauthv1beta1.Convert_clientauthentication_Cluster_To_v1beta1_Cluster(cluster, &result, nil); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
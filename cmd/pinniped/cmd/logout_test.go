@@ -0,0 +1,237 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientauthv1beta1 "k8s.io/client-go/pkg/apis/clientauthentication/v1beta1"
+
+	"go.pinniped.dev/internal/certauthority"
+	"go.pinniped.dev/internal/execcredcache"
+	"go.pinniped.dev/internal/here"
+	"go.pinniped.dev/internal/testutil"
+	"go.pinniped.dev/pkg/oidcclient"
+)
+
+func TestLogoutCommand(t *testing.T) {
+	testCA, err := certauthority.New("Test CA", 1*time.Hour)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name              string
+		args              []string
+		logoutErr         error
+		wantError         bool
+		wantStdout        string
+		wantStderr        string
+		wantLogoutCalls   int
+		wantOIDCRemoved   bool
+		wantStaticRemoved bool
+	}{
+		{
+			name: "help flag passed",
+			args: []string{"--help"},
+			wantStdout: here.Doc(`
+				Log out of the current kubeconfig context
+
+				Removes the cached sessions and cluster credentials of a kubeconfig context which
+				uses "pinniped login oidc" or "pinniped login static". When the OIDC issuer
+				supports token revocation, the session is also ended on the issuer by revoking
+				its refresh token.
+
+				Usage:
+				  logout [flags]
+
+				Flags:
+				      --all-contexts                Log out of every kubeconfig context which uses a Pinniped login
+				  -h, --help                        help for logout
+				      --kubeconfig string           Path to kubeconfig file
+				      --kubeconfig-context string   Kubeconfig context name (default: current active context)
+			`),
+		},
+		{
+			name:            "current context uses an OIDC login",
+			wantStdout:      "Logged out of kubeconfig context \"oidc-context\".\n",
+			wantLogoutCalls: 1,
+			wantOIDCRemoved: true,
+		},
+		{
+			name:              "context override uses a static login",
+			args:              []string{"--kubeconfig-context", "static-context"},
+			wantStdout:        "Logged out of kubeconfig context \"static-context\".\n",
+			wantStaticRemoved: true,
+		},
+		{
+			name:       "context override does not use a Pinniped login",
+			args:       []string{"--kubeconfig-context", "other-context"},
+			wantError:  true,
+			wantStderr: "Error: kubeconfig context \"other-context\" does not use a Pinniped login\n",
+		},
+		{
+			name:       "context override does not exist",
+			args:       []string{"--kubeconfig-context", "missing-context"},
+			wantError:  true,
+			wantStderr: "Error: kubeconfig context \"missing-context\" does not exist\n",
+		},
+		{
+			name:       "context override and all contexts",
+			args:       []string{"--kubeconfig-context", "static-context", "--all-contexts"},
+			wantError:  true,
+			wantStderr: "Error: --all-contexts and --kubeconfig-context cannot be used together\n",
+		},
+		{
+			name: "all contexts",
+			args: []string{"--all-contexts"},
+			wantStdout: here.Doc(`
+				Logged out of kubeconfig context "oidc-context".
+				Logged out of kubeconfig context "static-context".
+			`),
+			wantLogoutCalls:   1,
+			wantOIDCRemoved:   true,
+			wantStaticRemoved: true,
+		},
+		{
+			name:              "all contexts with a logout error",
+			args:              []string{"--all-contexts"},
+			logoutErr:         fmt.Errorf("some logout error"),
+			wantError:         true,
+			wantStdout:        "Logged out of kubeconfig context \"static-context\".\n",
+			wantStderr:        "Error: could not log out of kubeconfig context \"oidc-context\": some logout error\n",
+			wantLogoutCalls:   1,
+			wantOIDCRemoved:   true,
+			wantStaticRemoved: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tmpdir := testutil.TempDir(t)
+			sessionCachePath := filepath.Join(tmpdir, "sessions.yaml")
+			credentialCachePath := filepath.Join(tmpdir, "credentials.yaml")
+			kubeconfigPath := filepath.Join(tmpdir, "kubeconfig.yaml")
+
+			oidcArgs := []string{
+				"login", "oidc",
+				"--issuer=https://test-issuer.example.com",
+				"--client-id=test-client-id",
+				"--scopes=openid,offline_access",
+				"--session-cache=" + sessionCachePath,
+				"--credential-cache=" + credentialCachePath,
+			}
+			staticArgs := []string{
+				"login", "static",
+				"--token=test-token",
+				"--credential-cache=" + credentialCachePath,
+			}
+			require.NoError(t, os.WriteFile(kubeconfigPath, []byte(here.Docf(`
+				apiVersion: v1
+				kind: Config
+				current-context: oidc-context
+				clusters:
+				- name: test-cluster
+				  cluster:
+				    server: https://test-cluster.example.com
+				    certificate-authority-data: %s
+				contexts:
+				- name: oidc-context
+				  context: {cluster: test-cluster, user: oidc-user}
+				- name: static-context
+				  context: {cluster: test-cluster, user: static-user}
+				- name: other-context
+				  context: {cluster: test-cluster, user: other-user}
+				users:
+				- name: oidc-user
+				  user:
+				    exec:
+				      apiVersion: client.authentication.k8s.io/v1beta1
+				      command: pinniped
+				      args: [%s]
+				      provideClusterInfo: true
+				      interactiveMode: IfAvailable
+				- name: static-user
+				  user:
+				    exec:
+				      apiVersion: client.authentication.k8s.io/v1beta1
+				      command: pinniped
+				      args: [%s]
+				      interactiveMode: IfAvailable
+				- name: other-user
+				  user:
+				    token: some-token
+			`,
+				base64.StdEncoding.EncodeToString(testCA.Bundle()),
+				quotedList(oidcArgs),
+				quotedList(staticArgs),
+			)), 0600))
+
+			// These are the keys that the login commands would have used when invoked by client-go.
+			oidcKey := oidcLoginCacheKey{
+				Args: oidcArgs,
+				ClusterInfo: &clientauthv1beta1.Cluster{
+					Server:                   "https://test-cluster.example.com",
+					CertificateAuthorityData: testCA.Bundle(),
+				},
+			}
+			staticKey := staticLoginCacheKey{Args: staticArgs, Token: "test-token"}
+			credCache := execcredcache.New(credentialCachePath)
+			cred := &clientauthv1beta1.ExecCredential{
+				Status: &clientauthv1beta1.ExecCredentialStatus{
+					Token:               "test-cluster-token",
+					ExpirationTimestamp: &metav1.Time{Time: time.Now().Add(time.Minute)},
+				},
+			}
+			credCache.Put(oidcKey, cred)
+			credCache.Put(staticKey, cred)
+
+			var logoutCalls int
+			cmd := logoutCommand(logoutCommandDeps{
+				lookupEnv: func(string) (string, bool) { return "", false },
+				logout: func(issuer string, clientID string, opts ...oidcclient.Option) error {
+					require.Equal(t, "https://test-issuer.example.com", issuer)
+					require.Equal(t, "test-client-id", clientID)
+					require.Len(t, opts, 4)
+					logoutCalls++
+					return tt.logoutErr
+				},
+			})
+			require.NotNil(t, cmd)
+
+			var stdout, stderr bytes.Buffer
+			cmd.SetOut(&stdout)
+			cmd.SetErr(&stderr)
+			cmd.SetArgs(append([]string{"--kubeconfig", kubeconfigPath}, tt.args...))
+			err := cmd.Execute()
+			if tt.wantError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tt.wantStdout, stdout.String(), "unexpected stdout")
+			require.Equal(t, tt.wantStderr, stderr.String(), "unexpected stderr")
+			require.Equal(t, tt.wantLogoutCalls, logoutCalls)
+			require.Equal(t, tt.wantOIDCRemoved, credCache.Get(oidcKey) == nil, "unexpected OIDC login credential cache entry")
+			require.Equal(t, tt.wantStaticRemoved, credCache.Get(staticKey) == nil, "unexpected static login credential cache entry")
+		})
+	}
+}
+
+func quotedList(items []string) string {
+	var buf bytes.Buffer
+	for i, item := range items {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		_, _ = fmt.Fprintf(&buf, "%q", item)
+	}
+	return buf.String()
+}
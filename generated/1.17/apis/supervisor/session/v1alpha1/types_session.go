@@ -0,0 +1,68 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Session describes a user's session with the Supervisor, which was started when the user logged in to a
+// FederationDomain using an OIDC client. Deleting a Session ends it by revoking all of its tokens, including
+// the tokens which the Supervisor holds for the user's upstream identity provider.
+// +genclient
+// +genclient:onlyVerbs=get,list,delete
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type Session struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"` // metadata.name is the session ID, which is also the correlationID of its audit events
+
+	// +optional
+	Status SessionStatus `json:"status"`
+}
+
+// Status of the Session.
+type SessionStatus struct {
+	// Username is the downstream username of the user, after identity transformations were applied.
+	Username string `json:"username"`
+
+	// UpstreamUsername is the username of the user in the upstream identity provider.
+	// +optional
+	UpstreamUsername string `json:"upstreamUsername,omitempty"`
+
+	// UpstreamIdentityProvider is the upstream identity provider which the user used to log in.
+	UpstreamIdentityProvider SessionUpstreamIdentityProvider `json:"upstreamIdentityProvider"`
+
+	// ClientID is the ID of the OIDC client which started the session.
+	ClientID string `json:"clientID"`
+
+	// GrantedScopes are the scopes which were granted to the OIDC client.
+	// +optional
+	GrantedScopes []string `json:"grantedScopes,omitempty"`
+
+	// ExpirationTimestamp is when the session will be garbage collected, unless it is deleted sooner.
+	// +optional
+	ExpirationTimestamp *metav1.Time `json:"expirationTimestamp,omitempty"`
+}
+
+// SessionUpstreamIdentityProvider identifies the upstream identity provider of a Session.
+type SessionUpstreamIdentityProvider struct {
+	// Name is the name of the identity provider resource.
+	Name string `json:"name"`
+
+	// Type is the type of the identity provider, e.g. "oidc", "ldap", or "activedirectory".
+	Type string `json:"type"`
+
+	// UID is the UID of the identity provider resource.
+	UID string `json:"uid"`
+}
+
+// SessionList is a list of Session objects.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type SessionList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	// Items is a list of Session.
+	Items []Session `json:"items"`
+}
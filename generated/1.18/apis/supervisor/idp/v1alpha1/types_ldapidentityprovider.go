@@ -149,10 +149,20 @@ type LDAPIdentityProviderGroupSearch struct {
 // Spec for configuring an LDAP identity provider.
 type LDAPIdentityProviderSpec struct {
 	// Host is the hostname of this LDAP identity provider, i.e., where to connect. For example: ldap.example.com:636.
-	// +kubebuilder:validation:MinLength=1
-	Host string `json:"host"`
+	// Either host or hosts must be specified.
+	// +optional
+	Host string `json:"host,omitempty"`
+
+	// Hosts is an ordered list of the hostnames of equivalent LDAP servers for this identity provider, e.g. replicas.
+	// For example: ldap2.example.com:636. When host is also specified, it is tried before these hosts. When a host
+	// fails to accept a connection, the next host is tried, and the failed host is skipped for a while before it is
+	// tried again. The first host identifies this identity provider in the subject of the users' downstream tokens,
+	// so it should not be changed after users have logged in.
+	// +optional
+	// +listType=atomic
+	Hosts []string `json:"hosts,omitempty"`
 
-	// TLS contains the connection settings for how to establish the connection to the Host.
+	// TLS contains the connection settings for how to establish the connection to the hosts.
 	TLS *TLSSpec `json:"tls,omitempty"`
 
 	// Bind contains the configuration for how to provide access credentials during an initial bind to the LDAP server
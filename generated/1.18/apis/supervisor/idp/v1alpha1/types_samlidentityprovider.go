@@ -0,0 +1,114 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type SAMLIdentityProviderPhase string
+
+const (
+	// SAMLPhasePending is the default phase for newly-created SAMLIdentityProvider resources.
+	SAMLPhasePending SAMLIdentityProviderPhase = "Pending"
+
+	// SAMLPhaseReady is the phase for a SAMLIdentityProvider resource in a healthy state.
+	SAMLPhaseReady SAMLIdentityProviderPhase = "Ready"
+
+	// SAMLPhaseError is the phase for a SAMLIdentityProvider in an unhealthy state.
+	SAMLPhaseError SAMLIdentityProviderPhase = "Error"
+)
+
+// SAMLIdentityProviderStatus is the status of a SAML identity provider.
+type SAMLIdentityProviderStatus struct {
+	// Phase summarizes the overall status of the SAMLIdentityProvider.
+	// +kubebuilder:default=Pending
+	// +kubebuilder:validation:Enum=Pending;Ready;Error
+	Phase SAMLIdentityProviderPhase `json:"phase,omitempty"`
+
+	// Represents the observations of an identity provider's current state.
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	Conditions []Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+// SAMLAttributes provides a mapping from the attributes of upstream SAML assertions into identities.
+type SAMLAttributes struct {
+	// Username provides the name of the SAML assertion attribute that will be used to determine the username of
+	// the user. The first value of the attribute will be used. When this setting is not configured, the value of
+	// the NameID from the subject of the assertion will be used as the username.
+	// +optional
+	Username string `json:"username,omitempty"`
+
+	// Groups provides the name of the SAML assertion attribute that will be used to determine the group memberships
+	// of the user. Each value of the attribute will be treated as the name of one group. When this setting is not
+	// configured, the user will be treated as a member of no groups.
+	// +optional
+	Groups string `json:"groups,omitempty"`
+}
+
+// SAMLIdentityProviderSpec is the spec for configuring a SAML identity provider.
+type SAMLIdentityProviderSpec struct {
+	// MetadataURL is the URL from which the SAML metadata of the identity provider will be downloaded, e.g.
+	// "https://adfs.example.com/FederationMetadata/2007-06/FederationMetadata.xml" for ADFS. The metadata
+	// provides the entity ID, the single sign-on service URL, and the signing certificates of the identity provider.
+	// Exactly one of metadataURL or metadata must be configured.
+	// +kubebuilder:validation:Pattern=`^https://`
+	// +optional
+	MetadataURL string `json:"metadataURL,omitempty"`
+
+	// Metadata is the SAML metadata XML document of the identity provider. This may be used instead of metadataURL
+	// when the identity provider does not publish its metadata at a URL which is reachable by the Supervisor.
+	// Exactly one of metadataURL or metadata must be configured.
+	// +optional
+	Metadata string `json:"metadata,omitempty"`
+
+	// TLS configuration for downloading the metadata from metadataURL.
+	// +optional
+	TLS *TLSSpec `json:"tls,omitempty"`
+
+	// NameIDFormat is the format of the NameID which the Supervisor will request in its authentication requests,
+	// e.g. "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress". When this setting is not configured, the
+	// Supervisor will not request any particular format, and the identity provider will choose one.
+	// +optional
+	NameIDFormat string `json:"nameIDFormat,omitempty"`
+
+	// Attributes provides the names of the SAML assertion attributes that will be used when inspecting an identity
+	// from this SAML identity provider.
+	// +optional
+	Attributes SAMLAttributes `json:"attributes,omitempty"`
+}
+
+// SAMLIdentityProvider describes the configuration of an upstream SAML 2.0 identity provider, such as ADFS
+// or Shibboleth. The Supervisor acts as a SAML service provider for each FederationDomain which uses this
+// identity provider. Its service provider metadata is served at the "/saml/metadata" path of the FederationDomain's
+// issuer, and should be registered with the identity provider.
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:resource:categories=pinniped;pinniped-idp;pinniped-idps
+// +kubebuilder:printcolumn:name="Metadata URL",type=string,JSONPath=`.spec.metadataURL`
+// +kubebuilder:printcolumn:name="Status",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+// +kubebuilder:subresource:status
+type SAMLIdentityProvider struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Spec for configuring the identity provider.
+	Spec SAMLIdentityProviderSpec `json:"spec"`
+
+	// Status of the identity provider.
+	Status SAMLIdentityProviderStatus `json:"status,omitempty"`
+}
+
+// SAMLIdentityProviderList lists SAMLIdentityProvider objects.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type SAMLIdentityProviderList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []SAMLIdentityProvider `json:"items"`
+}
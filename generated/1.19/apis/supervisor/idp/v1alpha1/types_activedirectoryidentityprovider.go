@@ -158,13 +158,38 @@ type ActiveDirectoryIdentityProviderGroupSearch struct {
 	SkipGroupRefresh bool `json:"skipGroupRefresh,omitempty"`
 }
 
+// ActiveDirectoryIdentityProviderDNSDiscovery configures how to find the domain controllers of an Active Directory
+// domain using DNS.
+type ActiveDirectoryIdentityProviderDNSDiscovery struct {
+	// Domain is the DNS name of the Active Directory domain, e.g. ad.example.com. The domain controllers are found
+	// by looking up the DNS SRV records named "_ldap._tcp.<domain>", and are tried in order of their priority and weight.
+	// The domain identifies this identity provider in the subject of the users' downstream tokens.
+	// +kubebuilder:validation:MinLength=1
+	Domain string `json:"domain"`
+}
+
 // Spec for configuring an ActiveDirectory identity provider.
 type ActiveDirectoryIdentityProviderSpec struct {
 	// Host is the hostname of this Active Directory identity provider, i.e., where to connect. For example: ldap.example.com:636.
-	// +kubebuilder:validation:MinLength=1
-	Host string `json:"host"`
+	// One of host, hosts, or dnsDiscovery must be specified. DNSDiscovery may not be combined with host or hosts.
+	// +optional
+	Host string `json:"host,omitempty"`
+
+	// Hosts is an ordered list of the hostnames of the domain controllers for this identity provider.
+	// For example: dc2.example.com:636. When host is also specified, it is tried before these hosts. When a host
+	// fails to accept a connection, the next host is tried, and the failed host is skipped for a while before it is
+	// tried again. The first host identifies this identity provider in the subject of the users' downstream tokens,
+	// so it should not be changed after users have logged in.
+	// +optional
+	// +listType=atomic
+	Hosts []string `json:"hosts,omitempty"`
+
+	// DNSDiscovery finds the domain controllers for this identity provider using DNS, instead of listing them in
+	// host or hosts.
+	// +optional
+	DNSDiscovery *ActiveDirectoryIdentityProviderDNSDiscovery `json:"dnsDiscovery,omitempty"`
 
-	// TLS contains the connection settings for how to establish the connection to the Host.
+	// TLS contains the connection settings for how to establish the connection to the hosts.
 	TLS *TLSSpec `json:"tls,omitempty"`
 
 	// Bind contains the configuration for how to provide access credentials during an initial bind to the ActiveDirectory server
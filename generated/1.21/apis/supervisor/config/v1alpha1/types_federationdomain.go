@@ -1,4 +1,4 @@
-// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package v1alpha1
@@ -18,6 +18,10 @@ const (
 	InvalidFederationDomainStatusCondition                         = FederationDomainStatusCondition("Invalid")
 )
 
+// SigningAlgorithm is a JWS algorithm which a FederationDomain can use to sign ID tokens.
+// +kubebuilder:validation:Enum=ES256;ES384;RS256;RS384;RS512;EdDSA
+type SigningAlgorithm string
+
 // FederationDomainTLSSpec is a struct that describes the TLS configuration for an OIDC Provider.
 type FederationDomainTLSSpec struct {
 	// SecretName is an optional name of a Secret in the same namespace, of type `kubernetes.io/tls`, which contains
@@ -42,6 +46,102 @@ type FederationDomainTLSSpec struct {
 	SecretName string `json:"secretName,omitempty"`
 }
 
+// FederationDomainIdentityProvider describes how an identity provider is made available in this FederationDomain.
+type FederationDomainIdentityProvider struct {
+	// ObjectRef is a reference to a Pinniped identity provider resource in the same namespace as this
+	// FederationDomain. The APIGroup must be the idp.supervisor.pinniped.dev API group (or the equivalent group
+	// when a custom API group suffix was configured) and the Kind must be one of OIDCIdentityProvider,
+	// LDAPIdentityProvider, ActiveDirectoryIdentityProvider, SAMLIdentityProvider, or GitHubIdentityProvider.
+	// The Name of the referenced identity provider is the name that clients use to choose this identity provider,
+	// e.g. using the pinniped_idp_name param of the authorization endpoint.
+	ObjectRef corev1.TypedLocalObjectReference `json:"objectRef"`
+
+	// Transforms is an optional way to specify transformations to be applied during user authentication and
+	// session refresh for users of this identity provider in this FederationDomain.
+	// +optional
+	Transforms FederationDomainTransforms `json:"transforms,omitempty"`
+}
+
+// FederationDomainTransforms defines identity transformations and policies for an identity provider.
+type FederationDomainTransforms struct {
+	// Constants defines constant variables and their values which will be made available to the transform expressions.
+	// +optional
+	// +listType=atomic
+	Constants []FederationDomainTransformsConstant `json:"constants,omitempty"`
+
+	// Expressions are an optional list of transforms and policies to be executed in the order given during every
+	// authentication attempt, including during every session refresh.
+	// Each is a CEL expression. It may use the basic CEL language as defined in
+	// https://github.com/google/cel-spec/blob/master/doc/langdef.md plus the CEL string extensions defined in
+	// https://github.com/google/cel-go/tree/master/ext#strings.
+	//
+	// The username and groups extracted from the identity provider, and the constants defined in this CR, are
+	// available as variables in all expressions. The username is provided via a variable called `username` and
+	// the list of group names is provided via a variable called `groups` (which may be an empty list).
+	// Each user-provided constant is provided via a variable named `strConst.varName` for string constants
+	// or `strListConst.varName` for string list constants.
+	//
+	// The only allowed types for expressions are currently policy/v1, username/v1, and groups/v1.
+	// Each policy/v1 must return a boolean, and when it returns false, no more expressions from the list are evaluated
+	// and the authentication attempt is rejected.
+	// Transformations of type policy/v1 do not return usernames or group names, and therefore cannot change the
+	// username or group names.
+	// Each username/v1 transform must return the new username (a string), which can be the same as the old username.
+	// Transformations of type username/v1 do not return group names, and therefore cannot change the group names.
+	// Each groups/v1 transform must return the new groups list (list of strings), which can be the same as the old
+	// groups list. Transformations of type groups/v1 do not return usernames, and therefore cannot change the usernames.
+	// After each expression, the new (potentially changed) username or groups get passed to the following expression.
+	//
+	// Any compilation or static type-checking failure of any expression will cause an error status on the
+	// FederationDomain.
+	//
+	// During an authentication attempt, each expression will be evaluated in the order defined by the list. After all
+	// expressions have been evaluated, the final username and group names will be used as the identity of the user
+	// in the downstream session. When an expression has an error during evaluation, or when the final username is
+	// an empty string, then the authentication attempt will be rejected.
+	// +optional
+	// +listType=atomic
+	Expressions []FederationDomainTransformsExpression `json:"expressions,omitempty"`
+}
+
+// FederationDomainTransformsConstant defines a constant variable and its value which will be made available to
+// the transform expressions. This is a union type, and Type is the discriminator field.
+type FederationDomainTransformsConstant struct {
+	// Name determines the name of the constant. It must be a valid identifier name.
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z][_a-zA-Z0-9]*$`
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=64
+	Name string `json:"name"`
+
+	// Type determines the type of the constant, and indicates which other field should be non-empty.
+	// +kubebuilder:validation:Enum=string;stringList
+	Type string `json:"type"`
+
+	// StringValue should hold the value when Type is "string", and is otherwise ignored.
+	// +optional
+	StringValue string `json:"stringValue,omitempty"`
+
+	// StringListValue should hold the value when Type is "stringList", and is otherwise ignored.
+	// +optional
+	StringListValue []string `json:"stringListValue,omitempty"`
+}
+
+// FederationDomainTransformsExpression defines a transform expression.
+type FederationDomainTransformsExpression struct {
+	// Type determines the type of the expression. It must be one of the supported types.
+	// +kubebuilder:validation:Enum=policy/v1;username/v1;groups/v1
+	Type string `json:"type"`
+
+	// Expression is a CEL expression that will be evaluated based on the Type during an authentication.
+	// +kubebuilder:validation:MinLength=1
+	Expression string `json:"expression"`
+
+	// Message is only used when Type is policy/v1. It defines an error message to be used when the policy rejects
+	// an authentication attempt. When empty, a default message will be used.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
 // FederationDomainSpec is a struct that describes an OIDC Provider.
 type FederationDomainSpec struct {
 	// Issuer is the OIDC Provider's issuer, per the OIDC Discovery Metadata document, as well as the
@@ -58,6 +158,121 @@ type FederationDomainSpec struct {
 	// TLS configures how this FederationDomain is served over Transport Layer Security (TLS).
 	// +optional
 	TLS *FederationDomainTLSSpec `json:"tls,omitempty"`
+
+	// IdentityProviders is the list of identity providers available for use by this FederationDomain.
+	//
+	// When this list is empty, then every identity provider configured in the Supervisor's namespace is
+	// available for use by this FederationDomain. In that case, when exactly one identity provider is configured,
+	// then clients are not required to choose which identity provider to use, which is compatible with
+	// how the Supervisor behaved before multiple identity providers were supported.
+	//
+	// When this list is not empty, then only the listed identity providers are available for use by this
+	// FederationDomain, and the discovery endpoint for identity providers will only list these identity providers.
+	// Clients may choose one of them by name and type using the pinniped_idp_name and pinniped_idp_type params
+	// of the authorization endpoint.
+	//
+	// +optional
+	// +listType=atomic
+	IdentityProviders []FederationDomainIdentityProvider `json:"identityProviders,omitempty"`
+
+	// ClientCredentialsTransforms is an optional way to specify transformations and policies to be applied to the
+	// identities of OIDCClients which use the client_credentials grant with this FederationDomain. These identities
+	// do not come from any identity provider, so the transforms of the identity providers are not applied to them.
+	// The username and groups variables of the expressions are the username and groups configured on the OIDCClient.
+	// +optional
+	ClientCredentialsTransforms FederationDomainTransforms `json:"clientCredentialsTransforms,omitempty"`
+
+	// TokenLifetimes configures how long the tokens issued by this FederationDomain are valid, and therefore how long
+	// a user's session may last before they must log in again. When not provided, the default lifetimes are used.
+	// +optional
+	TokenLifetimes *FederationDomainTokenLifetimes `json:"tokenLifetimes,omitempty"`
+
+	// SigningKeyRotation configures the scheduled rotation of the key which this FederationDomain uses to sign
+	// ID tokens. When not provided, the signing key is never rotated, unless its Secret is deleted.
+	// +optional
+	SigningKeyRotation *FederationDomainSigningKeyRotation `json:"signingKeyRotation,omitempty"`
+
+	// IDTokenSigningAlgorithms is the list of algorithms which this FederationDomain may use to sign ID tokens.
+	// A signing key is generated for each algorithm, and all of their public keys are published in the JWKS.
+	// The first algorithm in the list is used for all clients which do not ask for a specific algorithm using the
+	// idTokenSignedResponseAlg field of their OIDCClient, including the pinniped-cli client.
+	// When not provided, only ES256 is used.
+	// +optional
+	// +listType=atomic
+	IDTokenSigningAlgorithms []SigningAlgorithm `json:"idTokenSigningAlgorithms,omitempty"`
+
+	// Branding customizes the web pages which this FederationDomain shows to users while they log in, such as the
+	// login page for LDAP and Active Directory identity providers, so users can recognize them as their
+	// organization's pages. When not provided, the pages show the default Pinniped styling.
+	// +optional
+	Branding *FederationDomainBrandingSpec `json:"branding,omitempty"`
+}
+
+// FederationDomainBrandingSpec describes where the branding of a FederationDomain's web pages is configured.
+type FederationDomainBrandingSpec struct {
+	// ConfigMapName is the name of a ConfigMap in the same namespace which contains the branding.
+	// All of its keys are optional:
+	//
+	// - `title` in `data` is a title which is shown at the top of each page, of at most 100 characters.
+	// - `logo` in `binaryData` is a PNG, JPEG, GIF, or WebP image of at most 64 KiB which is shown at the top of
+	//   each page.
+	// - `primaryColor` and `backgroundColor` in `data` are colors in the format `#rrggbb`. The primary color is
+	//   used for buttons and links.
+	// - `helpURL` in `data` is an https URL of a page where users can get help with logging in, and `helpText` is
+	//   the text of the link to it, of at most 100 characters.
+	// - `legalBanner` in `data` is text, such as an acceptable use policy, which is shown at the bottom of each
+	//   page, of at most 4096 characters.
+	//
+	// When the ConfigMap does not exist, or when any of its keys are invalid or unknown, the pages show the default
+	// Pinniped styling and the Supervisor logs the reason.
+	// +kubebuilder:validation:MinLength=1
+	ConfigMapName string `json:"configMapName"`
+}
+
+// FederationDomainSigningKeyRotation configures the scheduled rotation of a FederationDomain's signing key.
+//
+// Before each rotation, the next signing key is published in the FederationDomain's JWKS for the pre-publish period,
+// so relying parties which cache the JWKS have a chance to learn about the new key before any tokens are signed
+// with it. After each rotation, the previous signing key remains published in the JWKS until every ID token
+// that was signed by it has expired.
+type FederationDomainSigningKeyRotation struct {
+	// Interval is how long each signing key is used to sign ID tokens before it is replaced by a new signing key.
+	// It must be at least one hour, and it must be longer than the pre-publish period.
+	Interval metav1.Duration `json:"interval"`
+
+	// PrePublishPeriod is how long each new signing key is published in the JWKS before it starts being used to sign
+	// ID tokens. Defaults to 24h.
+	// +optional
+	PrePublishPeriod *metav1.Duration `json:"prePublishPeriod,omitempty"`
+}
+
+// FederationDomainTokenLifetimes configures the lifetimes of the tokens issued by a FederationDomain.
+// Each lifetime is a duration string, such as "5m" or "8h", and must be at least one minute.
+type FederationDomainTokenLifetimes struct {
+	// AccessToken is the lifetime of the access tokens issued by the token endpoint. Access tokens are refreshed
+	// using the refresh token, and each refresh checks that the user's session with the upstream identity provider
+	// is still valid, so shorter access token lifetimes cause changes in the upstream identity provider to take effect
+	// sooner. It must not be longer than the refresh token lifetime. Defaults to 2m.
+	// +optional
+	AccessToken *metav1.Duration `json:"accessToken,omitempty"`
+
+	// IDToken is the lifetime of the ID tokens issued by the token endpoint, including the cluster-scoped ID tokens
+	// which are used to access Kubernetes clusters. It must not be longer than the refresh token lifetime.
+	// Defaults to the access token lifetime.
+	// +optional
+	IDToken *metav1.Duration `json:"idToken,omitempty"`
+
+	// RefreshToken is the lifetime of the refresh tokens issued by the token endpoint. Each refresh issues a new
+	// refresh token with a new lifetime, so this is how long a session may go without being refreshed before the
+	// user must log in again. Defaults to 9h.
+	// +optional
+	RefreshToken *metav1.Duration `json:"refreshToken,omitempty"`
+
+	// MaxSession is the longest that a session may last after the user logged in, no matter how often it is
+	// refreshed. Once it has passed, the user must log in again. When not provided, sessions have no maximum
+	// length, and last for as long as they keep being refreshed.
+	// +optional
+	MaxSession *metav1.Duration `json:"maxSession,omitempty"`
 }
 
 // FederationDomainSecrets holds information about this OIDC Provider's secrets.
@@ -104,6 +319,22 @@ type FederationDomainStatus struct {
 	// Secrets contains information about this OIDC Provider's secrets.
 	// +optional
 	Secrets FederationDomainSecrets `json:"secrets,omitempty"`
+
+	// SigningKey describes the key which this OIDC Provider currently uses to sign ID tokens.
+	// +optional
+	SigningKey *FederationDomainSigningKeyStatus `json:"signingKey,omitempty"`
+}
+
+// FederationDomainSigningKeyStatus describes the signing key of an OIDC Provider.
+type FederationDomainSigningKeyStatus struct {
+	// ActiveKeyID is the key ID ("kid") of the key which is currently used to sign ID tokens using the first of
+	// the FederationDomain's ID token signing algorithms.
+	ActiveKeyID string `json:"activeKeyID"`
+
+	// NextRotationTime is the time at which the next signing key will start being used to sign ID tokens.
+	// It is not set when scheduled rotation of the signing key is not configured.
+	// +optional
+	NextRotationTime *metav1.Time `json:"nextRotationTime,omitempty"`
 }
 
 // FederationDomain describes the configuration of an OIDC provider.
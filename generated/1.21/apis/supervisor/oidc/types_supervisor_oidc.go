@@ -1,4 +1,4 @@
-// Copyright 2021-2023 the Pinniped contributors. All Rights Reserved.
+// Copyright 2021-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package oidc
@@ -53,6 +53,12 @@ const (
 	// GrantTypeTokenExchange is the name of a custom grant type for RFC8693 token exchanges.
 	GrantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange" //nolint:gosec // this is not a credential
 
+	// GrantTypeDeviceCode is the name of the grant type for RFC8628 device authorization flows.
+	GrantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code" //nolint:gosec // this is not a credential
+
+	// GrantTypeClientCredentials is the name of the grant type for client credentials flows defined by the OAuth2 spec.
+	GrantTypeClientCredentials = "client_credentials"
+
 	// ScopeOpenID is name of the openid scope defined by the OIDC spec.
 	ScopeOpenID = "openid"
 
@@ -1,4 +1,4 @@
-// Copyright 2020-2023 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package v1alpha1
@@ -111,6 +111,21 @@ type OIDCAuthorizationConfig struct {
 	// allowPasswordGrant defaults to false.
 	// +optional
 	AllowPasswordGrant bool `json:"allowPasswordGrant,omitempty"`
+
+	// endUpstreamSessionOnLogout, when true, will cause the Supervisor to also end the user's session at the OIDC
+	// provider when a client of the Supervisor performs OIDC RP-Initiated Logout (see
+	// https://openid.net/specs/openid-connect-rpinitiated-1_0.html) for a session which was started by logging in to
+	// this OIDC provider. After the Supervisor has ended its own session, it will redirect the user's browser to the
+	// end_session_endpoint from the OIDC provider's discovery document, with the Supervisor's client_id from the
+	// client's secret and with the Supervisor's own logout callback as the post_logout_redirect_uri. The logout
+	// callback is the issuer URL of the FederationDomain with the path /oauth2/logout/callback appended to it. Your
+	// OIDC provider must be configured to allow that post_logout_redirect_uri for the Supervisor's client. When the
+	// OIDC provider sends the user's browser back to the logout callback, the Supervisor finishes the logout by
+	// redirecting the browser to the post_logout_redirect_uri of the Supervisor's client, when the client asked to be
+	// sent back. When the OIDC provider's discovery document does not include an end_session_endpoint, then this
+	// setting has no effect. endUpstreamSessionOnLogout defaults to false.
+	// +optional
+	EndUpstreamSessionOnLogout bool `json:"endUpstreamSessionOnLogout,omitempty"`
 }
 
 // Parameter is a key/value pair which represents a parameter in an HTTP request.
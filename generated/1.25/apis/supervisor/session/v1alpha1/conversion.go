@@ -0,0 +1,24 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package v1alpha1
+
+import (
+	"fmt"
+)
+
+// SessionFieldLabelConversionFunc allows Sessions to be listed using field selectors on the fields which
+// identify the user, the upstream identity provider, and the client of a session.
+func SessionFieldLabelConversionFunc(label, value string) (string, string, error) {
+	switch label {
+	case "metadata.name",
+		"metadata.namespace",
+		"status.username",
+		"status.clientID",
+		"status.upstreamIdentityProvider.name",
+		"status.upstreamIdentityProvider.type":
+		return label, value, nil
+	default:
+		return "", "", fmt.Errorf("field label not supported: %s", label)
+	}
+}
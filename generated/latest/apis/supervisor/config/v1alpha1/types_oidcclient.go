@@ -1,4 +1,4 @@
-// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2022-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package v1alpha1
@@ -18,25 +18,132 @@ const (
 	PhaseError OIDCClientPhase = "Error"
 )
 
-// +kubebuilder:validation:Pattern=`^https://.+|^http://(127\.0\.0\.1|\[::1\])(:\d+)?/`
+// +kubebuilder:validation:Pattern=`^https://.+|^http://(127\.0\.0\.1|\[::1\])(:\d+)?/|^[a-z][a-z0-9+-]*(\.[a-z0-9+-]+)+:/`
 type RedirectURI string
 
-// +kubebuilder:validation:Enum="authorization_code";"refresh_token";"urn:ietf:params:oauth:grant-type:token-exchange"
+// +kubebuilder:validation:Enum="authorization_code";"refresh_token";"urn:ietf:params:oauth:grant-type:token-exchange";"client_credentials"
 type GrantType string
 
 // +kubebuilder:validation:Enum="openid";"offline_access";"username";"groups";"pinniped:request-audience"
 type Scope string
 
+// TokenEndpointAuthMethod is a method which a confidential client can use to authenticate to the token endpoint.
+// +kubebuilder:validation:Enum=client_secret_basic;private_key_jwt;tls_client_auth
+type TokenEndpointAuthMethod string
+
+// ClientAssertionSigningAlgorithm is a JWS algorithm which a client can use to sign the JWTs that it presents as
+// client assertions when using the private_key_jwt token endpoint authentication method.
+// +kubebuilder:validation:Enum=RS256;RS384;RS512;PS256;PS384;PS512;ES256;ES384;ES512
+type ClientAssertionSigningAlgorithm string
+
+// OIDCClientJWKS describes where to find the public keys of a client which uses the private_key_jwt token endpoint
+// authentication method. Exactly one of inline or url must be provided.
+type OIDCClientJWKS struct {
+	// inline is a JSON Web Key Set document, as described in RFC 7517, which contains the client's public keys.
+	// Each key which is used to verify client assertions must have "use": "sig".
+	// +optional
+	Inline string `json:"inline,omitempty"`
+
+	// url is the https URL of the client's JSON Web Key Set document, like the jwks_uri client metadata of OpenID
+	// Connect Dynamic Client Registration. The document is fetched when needed and then cached. Each key which is
+	// used to verify client assertions must have "use": "sig".
+	// +kubebuilder:validation:Pattern=`^https://`
+	// +optional
+	URL string `json:"url,omitempty"`
+
+	// signingAlgorithm is the algorithm which the client must use to sign its client assertions, like the
+	// token_endpoint_auth_signing_alg client metadata of OpenID Connect Dynamic Client Registration.
+	// When not provided, RS256 is used.
+	// +optional
+	SigningAlgorithm ClientAssertionSigningAlgorithm `json:"signingAlgorithm,omitempty"`
+}
+
+// OIDCClientTLSClientAuth describes which client certificates are accepted for a client which uses the
+// tls_client_auth token endpoint authentication method, as described in RFC 8705.
+type OIDCClientTLSClientAuth struct {
+	// certificateAuthorityData is the X.509 Certificate Authority (base64-encoded PEM bundle) which must have issued
+	// the client's certificate.
+	// +kubebuilder:validation:MinLength=1
+	CertificateAuthorityData string `json:"certificateAuthorityData"`
+
+	// subjectDN is the distinguished name which the subject of the client's certificate must have, e.g.
+	// "CN=my-webapp,O=Example Inc", like the tls_client_auth_subject_dn client metadata of RFC 8705. The names are
+	// parsed and compared attribute by attribute, ignoring case.
+	// Exactly one of subjectDN, sanDNS, sanURI, sanIP, or sanEmail must be provided.
+	// +optional
+	SubjectDN string `json:"subjectDN,omitempty"`
+
+	// sanDNS is a DNS name which must be one of the subject alternative names of the client's certificate, like the
+	// tls_client_auth_san_dns client metadata of RFC 8705.
+	// +optional
+	SANDNS string `json:"sanDNS,omitempty"`
+
+	// sanURI is a URI which must be one of the subject alternative names of the client's certificate, like the
+	// tls_client_auth_san_uri client metadata of RFC 8705.
+	// +optional
+	SANURI string `json:"sanURI,omitempty"`
+
+	// sanIP is an IPv4 or IPv6 address which must be one of the subject alternative names of the client's
+	// certificate, like the tls_client_auth_san_ip client metadata of RFC 8705.
+	// +optional
+	SANIP string `json:"sanIP,omitempty"`
+
+	// sanEmail is an email address which must be one of the subject alternative names of the client's certificate,
+	// like the tls_client_auth_san_email client metadata of RFC 8705.
+	// +optional
+	SANEmail string `json:"sanEmail,omitempty"`
+}
+
+// OIDCClientCredentials describes the identity which is given to the tokens that a client receives for itself
+// using the client_credentials grant, rather than on behalf of a user.
+type OIDCClientCredentials struct {
+	// username is the username of the client's identity. It appears in the ID tokens which the client receives from
+	// RFC8693 token exchanges, so it becomes the client's username in the Kubernetes clusters which trust those tokens.
+	// Choose a username which cannot be confused with the usernames of the users from the identity providers.
+	// Usernames which start with "system:" are reserved by Kubernetes, so they are not allowed.
+	// +kubebuilder:validation:MinLength=1
+	Username string `json:"username"`
+
+	// groups are the group memberships of the client's identity. They appear in the ID tokens which the client
+	// receives from RFC8693 token exchanges, when the groups scope was requested. Groups which start with "system:"
+	// are reserved by Kubernetes, so they are not allowed.
+	// +optional
+	// +listType=set
+	Groups []string `json:"groups,omitempty"`
+}
+
+// OIDCClientConsent configures the consent page of an OIDCClient.
+type OIDCClientConsent struct {
+	// displayName is the name of the client which is shown to users on the consent page, e.g. the name of the
+	// web application. When not provided, the name of the OIDCClient is shown.
+	// +optional
+	// +kubebuilder:validation:MaxLength=64
+	DisplayName string `json:"displayName,omitempty"`
+}
+
 // OIDCClientSpec is a struct that describes an OIDCClient.
 type OIDCClientSpec struct {
 	// allowedRedirectURIs is a list of the allowed redirect_uri param values that should be accepted during OIDC flows with this
 	// client. Any other uris will be rejected.
 	// Must be a URI with the https scheme, unless the hostname is 127.0.0.1 or ::1 which may use the http scheme.
 	// Port numbers are not required for 127.0.0.1 or ::1 and are ignored when checking for a matching redirect_uri.
+	// Public clients must instead use either the http scheme with the hostname 127.0.0.1 or ::1, or a private-use
+	// URI scheme which is a reverse domain name, e.g. com.example.app:/callback, as described in RFC 8252.
 	// +listType=set
 	// +kubebuilder:validation:MinItems=1
 	AllowedRedirectURIs []RedirectURI `json:"allowedRedirectURIs"`
 
+	// allowedPostLogoutRedirectURIs is a list of the allowed post_logout_redirect_uri param values that should be accepted
+	// by the end_session_endpoint when this client performs OIDC RP-Initiated Logout. Any other uris will be rejected.
+	// When this list is empty, then the end_session_endpoint will still end the user's session, but it will not
+	// redirect the user's browser back to the client afterwards.
+	// Must be a URI with the https scheme, unless the hostname is 127.0.0.1 or ::1 which may use the http scheme.
+	// Port numbers are not required for 127.0.0.1 or ::1 and are ignored when checking for a matching
+	// post_logout_redirect_uri. Like allowedRedirectURIs, public clients may also use a private-use URI scheme.
+	// +optional
+	// +listType=set
+	AllowedPostLogoutRedirectURIs []RedirectURI `json:"allowedPostLogoutRedirectURIs,omitempty"`
+
 	// allowedGrantTypes is a list of the allowed grant_type param values that should be accepted during OIDC flows with this
 	// client.
 	//
@@ -48,6 +155,9 @@ type OIDCClientSpec struct {
 	// - urn:ietf:params:oauth:grant-type:token-exchange: allows the client to perform RFC8693 token exchange,
 	//   which is a step in the process to be able to get a cluster credential for the user.
 	//   This grant must be listed if allowedScopes lists pinniped:request-audience.
+	// - client_credentials: allows the client to get tokens for its own identity, which is described by
+	//   clientCredentials, without any user being involved. The client can then use RFC8693 token exchange
+	//   to get a cluster credential for that identity. Public clients must not list this grant.
 	// +listType=set
 	// +kubebuilder:validation:MinItems=1
 	AllowedGrantTypes []GrantType `json:"allowedGrantTypes"`
@@ -71,6 +181,56 @@ type OIDCClientSpec struct {
 	// +listType=set
 	// +kubebuilder:validation:MinItems=1
 	AllowedScopes []Scope `json:"allowedScopes"`
+
+	// idTokenSignedResponseAlg is the algorithm which must be used to sign the ID tokens which are issued to this
+	// client, like the id_token_signed_response_alg client metadata of OpenID Connect Dynamic Client Registration.
+	// The algorithm must be one of the idTokenSigningAlgorithms of each FederationDomain which this client uses,
+	// otherwise the token endpoint will refuse to issue ID tokens to this client.
+	// When not provided, the ID tokens are signed using the first of the FederationDomain's ID token signing algorithms.
+	// +optional
+	IDTokenSignedResponseAlg SigningAlgorithm `json:"idTokenSignedResponseAlg,omitempty"`
+
+	// public indicates that this client is a public client, such as a desktop or mobile application, which cannot
+	// keep a client secret confidential. A public client authenticates to the token endpoint using only its client ID,
+	// so it must never have any client secrets, and it must always use PKCE with the S256 code challenge method.
+	// Its allowedRedirectURIs may only use the http scheme with the hostname 127.0.0.1 or ::1, or a private-use URI
+	// scheme. When not provided, the client is a confidential client which authenticates using a client secret.
+	// +optional
+	Public bool `json:"public,omitempty"`
+
+	// tokenEndpointAuthMethod is the method which this client uses to authenticate to the token endpoint, like the
+	// token_endpoint_auth_method client metadata of OpenID Connect Dynamic Client Registration. Must only be one of:
+	// - client_secret_basic: the client authenticates using one of its client secrets in an HTTP basic auth header.
+	// - private_key_jwt: the client authenticates using a JWT signed by one of the keys in jwks, as described in
+	//   RFC 7523. jwks must be provided.
+	// - tls_client_auth: the client authenticates using a TLS client certificate, as described in RFC 8705.
+	//   tlsClientAuth must be provided, and the Supervisor must be configured to request client certificates.
+	// Clients which use private_key_jwt or tls_client_auth must not have any client secrets.
+	// When not provided, client_secret_basic is used. Must not be provided for public clients.
+	// +optional
+	TokenEndpointAuthMethod TokenEndpointAuthMethod `json:"tokenEndpointAuthMethod,omitempty"`
+
+	// jwks describes the public keys of a client which uses the private_key_jwt token endpoint authentication method.
+	// +optional
+	JWKS *OIDCClientJWKS `json:"jwks,omitempty"`
+
+	// tlsClientAuth describes which client certificates are accepted for a client which uses the tls_client_auth
+	// token endpoint authentication method.
+	// +optional
+	TLSClientAuth *OIDCClientTLSClientAuth `json:"tlsClientAuth,omitempty"`
+
+	// clientCredentials describes the identity which this client is given when it uses the client_credentials grant.
+	// It must be provided if and only if allowedGrantTypes lists client_credentials.
+	// +optional
+	ClientCredentials *OIDCClientCredentials `json:"clientCredentials,omitempty"`
+
+	// consent configures a consent page which asks each user whether they allow this client to receive the scopes
+	// that it requested, e.g. their username and groups, before the client is given an authorization code.
+	// Users may choose to remember their decision, so they are not asked again unless the client requests more scopes.
+	// When not provided, the requested scopes are granted without asking the user, which is only appropriate for
+	// clients which are trusted by the administrator.
+	// +optional
+	Consent *OIDCClientConsent `json:"consent,omitempty"`
 }
 
 // OIDCClientStatus is a struct that describes the actual state of an OIDCClient.
@@ -0,0 +1,198 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package auditlog implements the audit event stream of the Supervisor and Concierge.
+//
+// Audit events are kept separate from the regular Pod logs so that they can be collected and retained independently.
+// Each event is written as a single line of JSON using the fixed schema of Event. The event types are stable: the
+// value of the "event" key never contains string interpolation, and any breaking change to the keys of an event
+// type will be signaled by a change to the "v" key.
+package auditlog
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apiserver/pkg/audit"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/utils/clock"
+
+	"go.pinniped.dev/internal/plog"
+)
+
+// EventType is the stable name of a kind of audit event.
+type EventType string
+
+const (
+	// Events of the Supervisor.
+	UpstreamLoginSucceeded         EventType = "upstream login succeeded"
+	UpstreamLoginFailed            EventType = "upstream login failed"
+	DownstreamTokensIssued         EventType = "downstream tokens issued"
+	RefreshSucceeded               EventType = "refresh succeeded"
+	RefreshRejected                EventType = "refresh rejected"
+	TokenExchanged                 EventType = "token exchanged"
+	TokensRevoked                  EventType = "tokens revoked"
+	OIDCClientSecretRequestCreated EventType = "oidc client secret request created"
+	SessionGarbageCollected        EventType = "session garbage collected"
+	SessionDeleted                 EventType = "session deleted"
+	SessionLoggedOut               EventType = "session logged out"
+	DeviceAuthorizationStarted     EventType = "device authorization started"
+	DeviceAuthorizationApproved    EventType = "device authorization approved"
+	DeviceAuthorizationDenied      EventType = "device authorization denied"
+	ConsentGranted                 EventType = "consent granted"
+	ConsentDeclined                EventType = "consent declined"
+	ConsentRevoked                 EventType = "consent revoked"
+
+	// Events of the Concierge.
+	TokenCredentialRequestIssued EventType = "token credential request issued"
+)
+
+// eventFormatVersion is the "v" of every event type. It is shared by all event types until one of them needs to
+// make a breaking change.
+const eventFormatVersion = 1
+
+// Event is the schema of every audit event. Keys which do not apply to an event are omitted from its JSON.
+type Event struct {
+	// Timestamp is the time of the event in UTC, formatted as RFC3339 with nanoseconds. It is set by the Logger.
+	Timestamp string `json:"timestamp"`
+	// Type is the kind of event.
+	Type EventType `json:"event"`
+	// Version is the format version of the event type. It is set by the Logger.
+	Version int `json:"v"`
+
+	// Message is a human-readable explanation, e.g. the reason why a login failed.
+	Message string `json:"message,omitempty"`
+
+	// CorrelationID links together the events caused by the authorize, callback, and token requests of a single
+	// login, along with the events caused by later refreshes and token exchanges of the resulting session.
+	CorrelationID string `json:"correlationID,omitempty"`
+
+	// Request describes the API request which caused the event, when there was one.
+	Request
+
+	// User is the downstream identity of the user, when it is known.
+	User *User `json:"user,omitempty"`
+	// UpstreamIDP is the upstream identity provider which was used to authenticate the user, when there was one.
+	UpstreamIDP *UpstreamIDP `json:"upstreamIDP,omitempty"`
+	// ClientID is the ID of the downstream OAuth client, when there was one.
+	ClientID string `json:"clientID,omitempty"`
+	// Audience is the audience which was requested during a token exchange.
+	Audience string `json:"audience,omitempty"`
+	// Object is the Kubernetes object which was acted upon, when there was one.
+	Object *Object `json:"object,omitempty"`
+}
+
+// Request holds the keys which describe an API request. They are flattened into the JSON of the Event.
+type Request struct {
+	RequestID  string   `json:"requestID,omitempty"`
+	RequestURI string   `json:"requestURI,omitempty"`
+	Verb       string   `json:"verb,omitempty"`
+	SourceIPs  []string `json:"sourceIPs,omitempty"`
+	UserAgent  string   `json:"userAgent,omitempty"`
+}
+
+type User struct {
+	Username string   `json:"username"`
+	Groups   []string `json:"groups,omitempty"`
+	UID      string   `json:"uid,omitempty"`
+}
+
+type UpstreamIDP struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type Object struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
+// RequestFromHTTP describes an HTTP request which was served by one of our own handlers.
+func RequestFromHTTP(r *http.Request) Request {
+	var sourceIPs []string
+	for _, ip := range utilnet.SourceIPs(r) {
+		sourceIPs = append(sourceIPs, ip.String())
+	}
+	return Request{
+		RequestURI: r.URL.Path,
+		Verb:       r.Method,
+		SourceIPs:  sourceIPs,
+		UserAgent:  r.UserAgent(),
+	}
+}
+
+// RequestFromAPIContext describes a request which was served by an aggregated API server, using the request
+// metadata which was added to the context by the generic API server's handler chain. The request ID is the same
+// audit ID which is used in the Kubernetes audit logs.
+func RequestFromAPIContext(ctx context.Context) Request {
+	req := Request{RequestID: audit.GetAuditIDTruncated(ctx)}
+	if info, ok := genericapirequest.RequestInfoFrom(ctx); ok {
+		req.RequestURI = info.Path
+		req.Verb = info.Verb
+	}
+	return req
+}
+
+// UserFromAPIContext returns the authenticated user of a request which was served by an aggregated API server,
+// or nil when the context does not have one.
+func UserFromAPIContext(ctx context.Context) *User {
+	u, ok := genericapirequest.UserFrom(ctx)
+	if !ok {
+		return nil
+	}
+	return &User{Username: u.GetName(), Groups: u.GetGroups(), UID: u.GetUID()}
+}
+
+// Logger records audit events. New should be used as the production implementation and NewTestLogger
+// should be used to write test assertions.
+type Logger interface {
+	Audit(event Event)
+}
+
+type jsonLogger struct {
+	clock clock.PassiveClock
+
+	lock sync.Mutex
+	w    io.Writer
+}
+
+var _ Logger = &jsonLogger{}
+
+// New returns a Logger which writes each event to w as a single line of JSON.
+func New(w io.Writer, clock clock.PassiveClock) Logger {
+	return &jsonLogger{w: w, clock: clock}
+}
+
+func (l *jsonLogger) Audit(event Event) {
+	event.Timestamp = l.clock.Now().UTC().Format(time.RFC3339Nano)
+	event.Version = eventFormatVersion
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		plog.Error("could not encode audit event", err, "event", event.Type)
+		return
+	}
+	line = append(line, '\n')
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if _, err := l.w.Write(line); err != nil {
+		plog.Error("could not write audit event", err, "event", event.Type)
+	}
+}
+
+type noopLogger struct{}
+
+func (noopLogger) Audit(Event) {}
+
+// NewNoopLogger returns a Logger which discards all events. It is used when audit logging is disabled.
+func NewNoopLogger() Logger {
+	return noopLogger{}
+}
@@ -0,0 +1,118 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package auditlog
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apiserver/pkg/audit"
+	"k8s.io/apiserver/pkg/authentication/user"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"go.pinniped.dev/internal/here"
+)
+
+func TestJSONLogger(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		events     []Event
+		wantOutput string
+	}{
+		{
+			name:       "minimal event",
+			events:     []Event{{Type: SessionGarbageCollected}},
+			wantOutput: `{"timestamp":"2026-01-02T02:04:05.000000006Z","event":"session garbage collected","v":1}` + "\n",
+		},
+		{
+			name: "every key",
+			events: []Event{{
+				Type:          TokenExchanged,
+				Message:       "some message",
+				CorrelationID: "some-correlation-id",
+				Request: Request{
+					RequestID:  "some-request-id",
+					RequestURI: "/some/path",
+					Verb:       "POST",
+					SourceIPs:  []string{"1.2.3.4", "5.6.7.8"},
+					UserAgent:  "some-user-agent",
+				},
+				User:        &User{Username: "some-username", Groups: []string{"g1", "g2"}, UID: "some-uid"},
+				UpstreamIDP: &UpstreamIDP{Name: "some-idp", Type: "oidc"},
+				ClientID:    "some-client-id",
+				Audience:    "some-audience",
+				Object:      &Object{Kind: "Secret", Namespace: "some-namespace", Name: "some-name"},
+			}},
+			wantOutput: here.Doc(`
+				{"timestamp":"2026-01-02T02:04:05.000000006Z","event":"token exchanged","v":1,"message":"some message","correlationID":"some-correlation-id","requestID":"some-request-id","requestURI":"/some/path","verb":"POST","sourceIPs":["1.2.3.4","5.6.7.8"],"userAgent":"some-user-agent","user":{"username":"some-username","groups":["g1","g2"],"uid":"some-uid"},"upstreamIDP":{"name":"some-idp","type":"oidc"},"clientID":"some-client-id","audience":"some-audience","object":{"kind":"Secret","namespace":"some-namespace","name":"some-name"}}
+			`),
+		},
+		{
+			name: "the logger sets the timestamp and version",
+			events: []Event{
+				{Type: RefreshSucceeded, Timestamp: "ignored", Version: 42},
+				{Type: RefreshRejected},
+			},
+			wantOutput: here.Doc(`
+				{"timestamp":"2026-01-02T02:04:05.000000006Z","event":"refresh succeeded","v":1}
+				{"timestamp":"2026-01-02T02:04:05.000000006Z","event":"refresh rejected","v":1}
+			`),
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+			fakeClock := clocktesting.NewFakeClock(time.Date(2026, 1, 2, 3, 4, 5, 6, time.FixedZone("some-zone", 3600)))
+			logger := New(&buf, fakeClock)
+
+			for _, event := range tt.events {
+				logger.Audit(event)
+			}
+
+			require.Equal(t, tt.wantOutput, buf.String())
+		})
+	}
+}
+
+func TestRequestFromHTTP(t *testing.T) {
+	t.Parallel()
+
+	r := httptest.NewRequest(http.MethodPost, "https://example.com/some/path?some=query", nil)
+	r.RemoteAddr = "1.2.3.4:12345"
+	r.Header.Set("X-Forwarded-For", "5.6.7.8")
+	r.Header.Set("User-Agent", "some-user-agent")
+
+	require.Equal(t, Request{
+		RequestURI: "/some/path",
+		Verb:       http.MethodPost,
+		SourceIPs:  []string{"5.6.7.8", "1.2.3.4"},
+		UserAgent:  "some-user-agent",
+	}, RequestFromHTTP(r))
+}
+
+func TestFromAPIContext(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, Request{}, RequestFromAPIContext(context.Background()))
+	require.Nil(t, UserFromAPIContext(context.Background()))
+
+	ctx := audit.WithAuditContext(context.Background())
+	audit.WithAuditID(ctx, "some-audit-id")
+	ctx = genericapirequest.WithRequestInfo(ctx, &genericapirequest.RequestInfo{Path: "/apis/some/path", Verb: "create"})
+	ctx = genericapirequest.WithUser(ctx, &user.DefaultInfo{Name: "some-username", UID: "some-uid", Groups: []string{"g1"}})
+
+	require.Equal(t, Request{RequestID: "some-audit-id", RequestURI: "/apis/some/path", Verb: "create"}, RequestFromAPIContext(ctx))
+	require.Equal(t, &User{Username: "some-username", Groups: []string{"g1"}, UID: "some-uid"}, UserFromAPIContext(ctx))
+}
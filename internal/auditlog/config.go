@@ -0,0 +1,83 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package auditlog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"k8s.io/utils/clock"
+
+	"go.pinniped.dev/internal/constable"
+	"go.pinniped.dev/internal/plog"
+)
+
+type Sink string
+
+const (
+	SinkDisabled Sink = "disabled"
+	SinkStdout   Sink = "stdout"
+	SinkFile     Sink = "file"
+
+	errInvalidSink      = constable.Error("invalid audit sink, valid choices are the empty string, disabled, stdout and file")
+	errMissingFilePath  = constable.Error("audit.filePath is required when audit.sink is file")
+	errUnneededFilePath = constable.Error("audit.filePath may only be used when audit.sink is file")
+)
+
+// Spec configures the audit event stream. Audit events may contain personally identifiable information such as
+// usernames, so they are disabled by default.
+type Spec struct {
+	// Sink is where the events are written. The empty string means disabled.
+	Sink Sink `json:"sink,omitempty"`
+	// FilePath is the file which events are appended to when Sink is file.
+	FilePath string `json:"filePath,omitempty"`
+}
+
+func (s Spec) Validate() error {
+	switch s.Sink {
+	case "", SinkDisabled, SinkStdout:
+		if len(s.FilePath) != 0 {
+			return errUnneededFilePath
+		}
+	case SinkFile:
+		if len(s.FilePath) == 0 {
+			return errMissingFilePath
+		}
+	default:
+		return errInvalidSink
+	}
+	return nil
+}
+
+// NewFromSpec returns the production Logger for the given validated Spec. When the sink is a file, it is closed
+// once the context is canceled.
+func NewFromSpec(ctx context.Context, spec Spec) (Logger, error) {
+	var w io.Writer
+
+	switch spec.Sink {
+	case "", SinkDisabled:
+		return NewNoopLogger(), nil
+	case SinkStdout:
+		w = os.Stdout
+	case SinkFile:
+		f, err := os.OpenFile(spec.FilePath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("could not open audit log file: %w", err)
+		}
+		go func() {
+			<-ctx.Done()
+			if err := f.Close(); err != nil {
+				plog.WarningErr("could not close audit log file", err, "path", spec.FilePath)
+			}
+		}()
+		w = f
+	default:
+		return nil, errInvalidSink
+	}
+
+	plog.Info("audit events are enabled", "sink", spec.Sink)
+	return New(w, clock.RealClock{}), nil
+}
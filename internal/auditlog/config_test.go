@@ -0,0 +1,116 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package auditlog
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpecValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		spec    Spec
+		wantErr string
+	}{
+		{
+			name: "default is valid",
+			spec: Spec{},
+		},
+		{
+			name: "disabled is valid",
+			spec: Spec{Sink: SinkDisabled},
+		},
+		{
+			name: "stdout is valid",
+			spec: Spec{Sink: SinkStdout},
+		},
+		{
+			name: "file with a path is valid",
+			spec: Spec{Sink: SinkFile, FilePath: "/some/path"},
+		},
+		{
+			name:    "file without a path is invalid",
+			spec:    Spec{Sink: SinkFile},
+			wantErr: "audit.filePath is required when audit.sink is file",
+		},
+		{
+			name:    "stdout with a path is invalid",
+			spec:    Spec{Sink: SinkStdout, FilePath: "/some/path"},
+			wantErr: "audit.filePath may only be used when audit.sink is file",
+		},
+		{
+			name:    "default with a path is invalid",
+			spec:    Spec{FilePath: "/some/path"},
+			wantErr: "audit.filePath may only be used when audit.sink is file",
+		},
+		{
+			name:    "unknown sink is invalid",
+			spec:    Spec{Sink: "webhook"},
+			wantErr: "invalid audit sink, valid choices are the empty string, disabled, stdout and file",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tt.spec.Validate()
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestNewFromSpec(t *testing.T) {
+	t.Parallel()
+
+	t.Run("disabled", func(t *testing.T) {
+		t.Parallel()
+
+		logger, err := NewFromSpec(context.Background(), Spec{})
+		require.NoError(t, err)
+		require.Equal(t, NewNoopLogger(), logger)
+	})
+
+	t.Run("file", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+
+		path := filepath.Join(t.TempDir(), "audit.log")
+		require.NoError(t, os.WriteFile(path, []byte("existing line\n"), 0600))
+
+		logger, err := NewFromSpec(ctx, Spec{Sink: SinkFile, FilePath: path})
+		require.NoError(t, err)
+
+		logger.Audit(Event{Type: UpstreamLoginFailed, Message: "some reason"})
+
+		contents, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Regexp(t,
+			regexp.QuoteMeta("existing line\n")+
+				`{"timestamp":"[^"]+","event":"upstream login failed","v":1,"message":"some reason"}`+"\n$",
+			string(contents),
+		)
+	})
+
+	t.Run("file which cannot be opened", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := NewFromSpec(context.Background(), Spec{Sink: SinkFile, FilePath: filepath.Join(t.TempDir(), "missing", "audit.log")})
+		require.ErrorContains(t, err, "could not open audit log file: ")
+	})
+}
@@ -0,0 +1,38 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package auditlog
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestLogger is a Logger which remembers the events it was given, so that tests can make assertions about them.
+type TestLogger struct {
+	lock   sync.Mutex
+	events []Event
+}
+
+var _ Logger = &TestLogger{}
+
+func NewTestLogger(t *testing.T) *TestLogger {
+	t.Helper() // discourage use outside of tests
+
+	return &TestLogger{}
+}
+
+func (l *TestLogger) Audit(event Event) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.events = append(l.events, event)
+}
+
+// Events returns the events which were recorded so far, exactly as they were given to Audit.
+func (l *TestLogger) Events() []Event {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return append([]Event(nil), l.events...)
+}
@@ -0,0 +1,304 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package celtransformer is an implementation of upstream-to-downstream identity transformations
+// and policies using CEL scripts.
+//
+// The CEL language is documented in https://github.com/google/cel-spec/blob/master/doc/langdef.md
+// with optional extensions documented in https://github.com/google/cel-go/tree/master/ext.
+package celtransformer
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/ext"
+
+	"go.pinniped.dev/internal/idtransform"
+)
+
+const (
+	usernameVariableName        = "username"
+	groupsVariableName          = "groups"
+	constStringVariableName     = "strConst"
+	constStringListVariableName = "strListConst"
+
+	// DefaultPolicyRejectedAuthMessage is the message used when a policy rejects an authentication attempt
+	// and the policy was not configured with its own message.
+	DefaultPolicyRejectedAuthMessage = "Authentication was rejected by a configured policy"
+
+	// The number of iterations within a comprehension to evaluate before checking whether the evaluation
+	// has run for too long.
+	interruptCheckFrequency = 100
+)
+
+// CELTransformer can compile any number of transformation expression pipelines.
+// Each compiled pipeline can be cached in memory for later thread-safe evaluation.
+type CELTransformer struct {
+	compiler             *cel.Env
+	maxExpressionRuntime time.Duration
+}
+
+// NewCELTransformer returns a CELTransformer. The maxExpressionRuntime limits how long any single expression
+// may run during evaluation, to protect the server from expressions which would take too long.
+func NewCELTransformer(maxExpressionRuntime time.Duration) (*CELTransformer, error) {
+	env, err := newEnv()
+	if err != nil {
+		return nil, err
+	}
+	return &CELTransformer{compiler: env, maxExpressionRuntime: maxExpressionRuntime}, nil
+}
+
+// CompileTransformation compiles a CEL-based identity transformation expression.
+// The compiled transform can be cached in memory and executed repeatedly and in a thread-safe way.
+// The caller must not modify the consts param struct after calling this function.
+func (c *CELTransformer) CompileTransformation(t CELTransformation, consts *TransformationConstants) (idtransform.IdentityTransformation, error) {
+	if consts == nil {
+		consts = &TransformationConstants{}
+	}
+	if consts.StringConstants == nil {
+		consts.StringConstants = map[string]string{}
+	}
+	if consts.StringListConstants == nil {
+		consts.StringListConstants = map[string][]string{}
+	}
+	return t.compile(c, consts)
+}
+
+// TransformationConstants holds the constants which are made available to a compiled transformation
+// as variables during its evaluation.
+type TransformationConstants struct {
+	StringConstants     map[string]string
+	StringListConstants map[string][]string
+}
+
+// CELTransformation can be compiled into an IdentityTransformation.
+type CELTransformation interface {
+	compile(transformer *CELTransformer, consts *TransformationConstants) (idtransform.IdentityTransformation, error)
+}
+
+// UsernameTransformation is a CEL expression that can transform a username (or leave it unchanged).
+// It implements CELTransformation.
+type UsernameTransformation struct {
+	Expression string
+}
+
+// GroupsTransformation is a CEL expression that can transform a list of group names (or leave it unchanged).
+// It implements CELTransformation.
+type GroupsTransformation struct {
+	Expression string
+}
+
+// AllowAuthenticationPolicy is a CEL expression that can allow the authentication to proceed by returning true.
+// It implements CELTransformation.
+type AllowAuthenticationPolicy struct {
+	Expression                    string
+	RejectedAuthenticationMessage string
+}
+
+func (t *UsernameTransformation) compile(transformer *CELTransformer, consts *TransformationConstants) (idtransform.IdentityTransformation, error) {
+	program, err := transformer.compileProgram(t.Expression, cel.StringType)
+	if err != nil {
+		return nil, err
+	}
+	return &compiledUsernameTransformation{
+		baseCompiledTransformation: &baseCompiledTransformation{
+			program:              program,
+			consts:               consts,
+			maxExpressionRuntime: transformer.maxExpressionRuntime,
+		},
+	}, nil
+}
+
+func (t *GroupsTransformation) compile(transformer *CELTransformer, consts *TransformationConstants) (idtransform.IdentityTransformation, error) {
+	program, err := transformer.compileProgram(t.Expression, cel.ListType(cel.StringType))
+	if err != nil {
+		return nil, err
+	}
+	return &compiledGroupsTransformation{
+		baseCompiledTransformation: &baseCompiledTransformation{
+			program:              program,
+			consts:               consts,
+			maxExpressionRuntime: transformer.maxExpressionRuntime,
+		},
+	}, nil
+}
+
+func (t *AllowAuthenticationPolicy) compile(transformer *CELTransformer, consts *TransformationConstants) (idtransform.IdentityTransformation, error) {
+	program, err := transformer.compileProgram(t.Expression, cel.BoolType)
+	if err != nil {
+		return nil, err
+	}
+	rejectedAuthenticationMessage := t.RejectedAuthenticationMessage
+	if rejectedAuthenticationMessage == "" {
+		rejectedAuthenticationMessage = DefaultPolicyRejectedAuthMessage
+	}
+	return &compiledAllowAuthenticationPolicy{
+		baseCompiledTransformation: &baseCompiledTransformation{
+			program:              program,
+			consts:               consts,
+			maxExpressionRuntime: transformer.maxExpressionRuntime,
+		},
+		rejectedAuthenticationMessage: rejectedAuthenticationMessage,
+	}, nil
+}
+
+func (c *CELTransformer) compileProgram(expr string, expectedExpressionType *cel.Type) (cel.Program, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, fmt.Errorf("cannot compile empty CEL expression")
+	}
+
+	// compile does both parsing and type checking
+	ast, issues := c.compiler.Compile(expr)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("CEL expression compile error: %s", issues.Err().Error())
+	}
+
+	// The compiler's type checker has determined the type of the expression's result.
+	// Check that it matches the type that we expect.
+	if !expectedExpressionType.IsAssignableType(ast.OutputType()) {
+		return nil, fmt.Errorf("CEL expression should return type %q but returns type %q",
+			expectedExpressionType.String(), ast.OutputType().String())
+	}
+
+	// The interrupt check frequency allows a long-running comprehension to notice that its context was cancelled.
+	program, err := c.compiler.Program(ast, cel.InterruptCheckFrequency(interruptCheckFrequency))
+	if err != nil {
+		return nil, fmt.Errorf("CEL expression program construction error: %w", err)
+	}
+	return program, nil
+}
+
+// Base type for common aspects of compiled transformations.
+type baseCompiledTransformation struct {
+	program              cel.Program
+	consts               *TransformationConstants
+	maxExpressionRuntime time.Duration
+}
+
+// Implements idtransform.IdentityTransformation.
+type compiledUsernameTransformation struct {
+	*baseCompiledTransformation
+}
+
+// Implements idtransform.IdentityTransformation.
+type compiledGroupsTransformation struct {
+	*baseCompiledTransformation
+}
+
+// Implements idtransform.IdentityTransformation.
+type compiledAllowAuthenticationPolicy struct {
+	*baseCompiledTransformation
+	rejectedAuthenticationMessage string
+}
+
+func (c *baseCompiledTransformation) evalProgram(ctx context.Context, username string, groups []string) (ref.Val, error) {
+	// Limit the runtime of a transformation to protect the server from expressions which take too long.
+	// The context is checked before evaluating, and periodically during comprehensions.
+	timeoutCtx, cancel := context.WithTimeout(ctx, c.maxExpressionRuntime)
+	defer cancel()
+
+	// Never pass a nil list of groups to an expression, because the type checker promised a list.
+	if groups == nil {
+		groups = []string{}
+	}
+
+	// Evaluation is thread-safe and side effect free. Many inputs can be sent to the same cel.Program
+	// and if fields are present in the input, but not referenced in the expression, they are ignored.
+	// The argument to Eval may either be an `interpreter.Activation` or a `map[string]interface{}`.
+	val, _, err := c.program.ContextEval(timeoutCtx, map[string]interface{}{
+		usernameVariableName:        username,
+		groupsVariableName:          groups,
+		constStringVariableName:     c.consts.StringConstants,
+		constStringListVariableName: c.consts.StringListConstants,
+	})
+	return val, err
+}
+
+func (c *compiledUsernameTransformation) Evaluate(ctx context.Context, username string, groups []string) (*idtransform.TransformationResult, error) {
+	val, err := c.evalProgram(ctx, username, groups)
+	if err != nil {
+		return nil, err
+	}
+	nativeValue, err := val.ConvertToNative(reflect.TypeOf(""))
+	if err != nil {
+		return nil, fmt.Errorf("could not convert expression result to string: %w", err)
+	}
+	stringValue, ok := nativeValue.(string)
+	if !ok {
+		return nil, fmt.Errorf("could not convert expression result to string")
+	}
+	return &idtransform.TransformationResult{
+		Username:              stringValue,
+		Groups:                groups, // groups are not modified by username transformations
+		AuthenticationAllowed: true,
+	}, nil
+}
+
+func (c *compiledGroupsTransformation) Evaluate(ctx context.Context, username string, groups []string) (*idtransform.TransformationResult, error) {
+	val, err := c.evalProgram(ctx, username, groups)
+	if err != nil {
+		return nil, err
+	}
+	nativeValue, err := val.ConvertToNative(reflect.TypeOf([]string{}))
+	if err != nil {
+		return nil, fmt.Errorf("could not convert expression result to []string: %w", err)
+	}
+	stringSliceValue, ok := nativeValue.([]string)
+	if !ok {
+		return nil, fmt.Errorf("could not convert expression result to []string")
+	}
+	return &idtransform.TransformationResult{
+		Username:              username, // username is not modified by groups transformations
+		Groups:                stringSliceValue,
+		AuthenticationAllowed: true,
+	}, nil
+}
+
+func (c *compiledAllowAuthenticationPolicy) Evaluate(ctx context.Context, username string, groups []string) (*idtransform.TransformationResult, error) {
+	val, err := c.evalProgram(ctx, username, groups)
+	if err != nil {
+		return nil, err
+	}
+	nativeValue, err := val.ConvertToNative(reflect.TypeOf(true))
+	if err != nil {
+		return nil, fmt.Errorf("could not convert expression result to bool: %w", err)
+	}
+	boolValue, ok := nativeValue.(bool)
+	if !ok {
+		return nil, fmt.Errorf("could not convert expression result to bool")
+	}
+	result := &idtransform.TransformationResult{
+		Username:              username, // username is not modified by policies
+		Groups:                groups,   // groups are not modified by policies
+		AuthenticationAllowed: boolValue,
+	}
+	if !boolValue {
+		result.RejectedAuthenticationMessage = c.rejectedAuthenticationMessage
+	}
+	return result, nil
+}
+
+func newEnv() (*cel.Env, error) {
+	// Note that Kubernetes uses CEL for CRD validation rules and admission policies, which are helpful
+	// examples of how to configure the CEL compiler for production usage.
+	return cel.NewEnv(
+		// Declare our variable names and types.
+		cel.Variable(usernameVariableName, cel.StringType),
+		cel.Variable(groupsVariableName, cel.ListType(cel.StringType)),
+		cel.Variable(constStringVariableName, cel.MapType(cel.StringType, cel.StringType)),
+		cel.Variable(constStringListVariableName, cel.MapType(cel.StringType, cel.ListType(cel.StringType))),
+
+		// Enforce that list and map literals contain values of a single type, like Kubernetes does.
+		cel.HomogeneousAggregateLiterals(),
+
+		// Enable the string extensions, e.g. split, replace, lowerAscii, etc.
+		// See https://github.com/google/cel-go/tree/master/ext#strings for details.
+		ext.Strings(),
+	)
+}
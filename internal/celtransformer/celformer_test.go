@@ -0,0 +1,301 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package celtransformer
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"go.pinniped.dev/internal/idtransform"
+)
+
+func TestTransformer(t *testing.T) {
+	var veryLargeGroupList []string
+	for i := 0; i < 10000; i++ {
+		veryLargeGroupList = append(veryLargeGroupList, fmt.Sprintf("g%d", i))
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		groups   []string
+		consts   *TransformationConstants
+		ops      []CELTransformation
+
+		wantUsername           string
+		wantGroups             []string
+		wantAuthRejected       bool
+		wantAuthRejectedReason string
+		wantCompileErr         string
+		wantEvaluationErr      string
+	}{
+		{
+			name:         "empty transforms list does not change the identity and allows auth",
+			username:     "ryan",
+			groups:       []string{"admins", "developers", "other"},
+			ops:          []CELTransformation{},
+			wantUsername: "ryan",
+			wantGroups:   []string{"admins", "developers", "other"},
+		},
+		{
+			name:     "simple transforms which do not change the identity and allows auth",
+			username: "ryan",
+			groups:   []string{"admins", "developers", "other"},
+			ops: []CELTransformation{
+				&UsernameTransformation{Expression: `username`},
+				&GroupsTransformation{Expression: `groups`},
+				&AllowAuthenticationPolicy{Expression: `true`},
+			},
+			wantUsername: "ryan",
+			wantGroups:   []string{"admins", "developers", "other"},
+		},
+		{
+			name:     "transformations run in the order that they are given and accumulate results",
+			username: "ryan",
+			groups:   []string{"admins", "developers", "other"},
+			ops: []CELTransformation{
+				&UsernameTransformation{Expression: `"a:" + username`},
+				&UsernameTransformation{Expression: `"b:" + username`},
+				&GroupsTransformation{Expression: `groups.map(g, "a:" + g)`},
+				&GroupsTransformation{Expression: `groups.map(g, "b:" + g)`},
+			},
+			wantUsername: "b:a:ryan",
+			wantGroups:   []string{"b:a:admins", "b:a:developers", "b:a:other"},
+		},
+		{
+			name:     "adding a group prefix",
+			username: "ryan",
+			groups:   []string{"admins", "developers", "other"},
+			ops: []CELTransformation{
+				&GroupsTransformation{Expression: `groups.map(g, "okta:" + g)`},
+			},
+			wantUsername: "ryan",
+			wantGroups:   []string{"okta:admins", "okta:developers", "okta:other"},
+		},
+		{
+			name:     "stripping the domain from an email address username",
+			username: "ryan@example.com",
+			groups:   []string{"admins"},
+			ops: []CELTransformation{
+				&UsernameTransformation{Expression: `username.split("@")[0]`},
+			},
+			wantUsername: "ryan",
+			wantGroups:   []string{"admins"},
+		},
+		{
+			name:     "dropping groups which match a prefix",
+			username: "ryan",
+			groups:   []string{"admins", "noisy-1", "developers", "noisy-2"},
+			ops: []CELTransformation{
+				&GroupsTransformation{Expression: `groups.filter(g, !g.startsWith("noisy-"))`},
+			},
+			wantUsername: "ryan",
+			wantGroups:   []string{"admins", "developers"},
+		},
+		{
+			name:     "can use constants",
+			username: "ryan",
+			groups:   []string{"admins", "developers", "other"},
+			consts: &TransformationConstants{
+				StringConstants:     map[string]string{"prefix": "okta:", "suffix": "@example.com"},
+				StringListConstants: map[string][]string{"allowed": {"developers", "auditors"}},
+			},
+			ops: []CELTransformation{
+				&AllowAuthenticationPolicy{Expression: `groups.exists(g, g in strListConst.allowed)`},
+				&UsernameTransformation{Expression: `strConst.prefix + username + strConst.suffix`},
+				&GroupsTransformation{Expression: `groups.map(g, strConst.prefix + g)`},
+			},
+			wantUsername: "okta:ryan@example.com",
+			wantGroups:   []string{"okta:admins", "okta:developers", "okta:other"},
+		},
+		{
+			name:     "a policy which rejects auth uses the configured message",
+			username: "ryan",
+			groups:   []string{"other"},
+			consts: &TransformationConstants{
+				StringListConstants: map[string][]string{"allowed": {"developers", "auditors"}},
+			},
+			ops: []CELTransformation{
+				&AllowAuthenticationPolicy{
+					Expression:                    `groups.exists(g, g in strListConst.allowed)`,
+					RejectedAuthenticationMessage: "only developers and auditors may log in",
+				},
+			},
+			wantAuthRejected:       true,
+			wantAuthRejectedReason: "only developers and auditors may log in",
+		},
+		{
+			name:     "a policy which rejects auth without a configured message uses the default message",
+			username: "ryan",
+			groups:   []string{"other"},
+			ops: []CELTransformation{
+				&AllowAuthenticationPolicy{Expression: `"admins" in groups`},
+			},
+			wantAuthRejected:       true,
+			wantAuthRejectedReason: DefaultPolicyRejectedAuthMessage,
+		},
+		{
+			name:     "a policy which rejects auth stops evaluation of later transformations",
+			username: "ryan",
+			groups:   []string{"other"},
+			ops: []CELTransformation{
+				&AllowAuthenticationPolicy{Expression: `false`, RejectedAuthenticationMessage: "nope"},
+				&UsernameTransformation{Expression: `""`},
+			},
+			wantAuthRejected:       true,
+			wantAuthRejectedReason: "nope",
+		},
+		{
+			name:     "policies can use the results of earlier transformations",
+			username: "ryan",
+			groups:   []string{"admins"},
+			ops: []CELTransformation{
+				&GroupsTransformation{Expression: `groups.map(g, "okta:" + g)`},
+				&AllowAuthenticationPolicy{Expression: `"okta:admins" in groups`},
+			},
+			wantUsername: "ryan",
+			wantGroups:   []string{"okta:admins"},
+		},
+		{
+			name:     "nil groups are treated as an empty list",
+			username: "ryan",
+			groups:   nil,
+			ops: []CELTransformation{
+				&AllowAuthenticationPolicy{Expression: `size(groups) == 0`},
+				&GroupsTransformation{Expression: `groups + ["new-group"]`},
+			},
+			wantUsername: "ryan",
+			wantGroups:   []string{"new-group"},
+		},
+		{
+			name:     "a username transformation which returns an empty username is an evaluation error",
+			username: "ryan",
+			ops: []CELTransformation{
+				&UsernameTransformation{Expression: `"  "`},
+			},
+			wantEvaluationErr: "identity transformation at index 0 returned an empty username, which is not allowed",
+		},
+		{
+			name:     "runtime errors are evaluation errors",
+			username: "ryan",
+			ops: []CELTransformation{
+				&UsernameTransformation{Expression: `username`},
+				&UsernameTransformation{Expression: `strConst.doesNotExist`},
+			},
+			wantEvaluationErr: "identity transformation at index 1: no such key: doesNotExist",
+		},
+		{
+			name:     "an expression which takes too long is an evaluation error",
+			username: "ryan",
+			groups:   veryLargeGroupList,
+			ops: []CELTransformation{
+				&AllowAuthenticationPolicy{Expression: `groups.all(x, groups.all(y, x != "" && y != ""))`},
+			},
+			wantEvaluationErr: "identity transformation at index 0: operation interrupted",
+		},
+		{
+			name:           "empty expressions are compile errors",
+			ops:            []CELTransformation{&UsernameTransformation{Expression: ` `}},
+			wantCompileErr: "cannot compile empty CEL expression",
+		},
+		{
+			name:           "syntax errors are compile errors",
+			ops:            []CELTransformation{&UsernameTransformation{Expression: `username +`}},
+			wantCompileErr: "CEL expression compile error: ERROR: <input>:1:11: Syntax error: mismatched input '<EOF>' expecting {'[', '{', '(', '.', '-', '!', 'true', 'false', 'null', NUM_FLOAT, NUM_INT, NUM_UINT, STRING, BYTES, IDENTIFIER}\n | username +\n | ..........^",
+		},
+		{
+			name:           "undeclared variables are compile errors",
+			ops:            []CELTransformation{&UsernameTransformation{Expression: `foobar`}},
+			wantCompileErr: "CEL expression compile error: ERROR: <input>:1:1: undeclared reference to 'foobar' (in container '')\n | foobar\n | ^",
+		},
+		{
+			name:           "username transformations must return a string",
+			ops:            []CELTransformation{&UsernameTransformation{Expression: `groups`}},
+			wantCompileErr: `CEL expression should return type "string" but returns type "list(string)"`,
+		},
+		{
+			name:           "groups transformations must return a list of strings",
+			ops:            []CELTransformation{&GroupsTransformation{Expression: `username`}},
+			wantCompileErr: `CEL expression should return type "list(string)" but returns type "string"`,
+		},
+		{
+			name:           "policies must return a bool",
+			ops:            []CELTransformation{&AllowAuthenticationPolicy{Expression: `username`}},
+			wantCompileErr: `CEL expression should return type "bool" but returns type "string"`,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			transformer, err := NewCELTransformer(100 * time.Millisecond)
+			require.NoError(t, err)
+
+			pipeline := idtransform.NewTransformationPipeline()
+
+			for _, transform := range tt.ops {
+				compiledTransform, err := transformer.CompileTransformation(transform, tt.consts)
+				if tt.wantCompileErr != "" {
+					require.EqualError(t, err, tt.wantCompileErr)
+					return // the rest of the test doesn't make sense when there was a compile error
+				}
+				require.NoError(t, err, "got an unexpected compilation error")
+				pipeline.AppendTransformation(compiledTransform)
+			}
+			require.Empty(t, tt.wantCompileErr, "expected a compile error but did not get one")
+
+			result, err := pipeline.Evaluate(context.Background(), tt.username, tt.groups)
+			if tt.wantEvaluationErr != "" {
+				require.EqualError(t, err, tt.wantEvaluationErr)
+				require.Nil(t, result)
+				return
+			}
+			require.NoError(t, err, "got an unexpected evaluation error")
+
+			if tt.wantAuthRejected {
+				require.False(t, result.AuthenticationAllowed)
+				require.Equal(t, tt.wantAuthRejectedReason, result.RejectedAuthenticationMessage)
+				return
+			}
+			require.True(t, result.AuthenticationAllowed)
+			require.Empty(t, result.RejectedAuthenticationMessage)
+			require.Equal(t, tt.wantUsername, result.Username)
+			require.Equal(t, tt.wantGroups, result.Groups)
+		})
+	}
+}
+
+func TestTransformerIsThreadSafe(t *testing.T) {
+	transformer, err := NewCELTransformer(time.Second)
+	require.NoError(t, err)
+
+	compiledTransform, err := transformer.CompileTransformation(
+		&GroupsTransformation{Expression: `groups.map(g, strConst.prefix + g)`},
+		&TransformationConstants{StringConstants: map[string]string{"prefix": "okta:"}},
+	)
+	require.NoError(t, err)
+	pipeline := idtransform.NewTransformationPipeline()
+	pipeline.AppendTransformation(compiledTransform)
+
+	errs := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		i := i
+		go func() {
+			group := fmt.Sprintf("group%d", i)
+			result, err := pipeline.Evaluate(context.Background(), "ryan", []string{group})
+			if err == nil && (len(result.Groups) != 1 || result.Groups[0] != "okta:"+group) {
+				err = fmt.Errorf("unexpected groups: %v", result.Groups)
+			}
+			errs <- err
+		}()
+	}
+	for i := 0; i < 50; i++ {
+		require.NoError(t, <-errs)
+	}
+}
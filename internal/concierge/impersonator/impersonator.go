@@ -1,4 +1,4 @@
-// Copyright 2020-2023 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package impersonator
@@ -190,6 +190,7 @@ func newInternal( //nolint:funlen // yeah, it's kind of long.
 			impersonationProxy := impersonationProxyFunc(c)
 			handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				defer impersonationProxyCompleted.ServeHTTP(w, r)
+				defer observeProxyRequestDuration(r, time.Now())
 				impersonationProxy.ServeHTTP(w, r)
 			}))
 			handler = filterlatency.TrackStarted(handler, c.TracerProvider, "impersonationproxy")
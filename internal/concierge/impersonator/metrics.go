@@ -0,0 +1,37 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package impersonator
+
+import (
+	"net/http"
+	"time"
+
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+//nolint:gochecknoglobals // metrics are registered once per process
+var proxyRequestDuration = metrics.NewHistogramVec(&metrics.HistogramOpts{
+	Namespace: "pinniped",
+	Subsystem: "concierge",
+	Name:      "impersonation_proxy_request_duration_seconds",
+	Help:      "Time taken by the impersonation proxy to proxy requests to the Kubernetes API server, partitioned by verb.",
+	// Long-running requests such as watches and exec sessions will be counted in the last bucket.
+	Buckets:        metrics.ExponentialBuckets(0.005, 2, 14), // 5ms to about 40s
+	StabilityLevel: metrics.ALPHA,
+}, []string{"verb"})
+
+//nolint:gochecknoinits
+func init() {
+	legacyregistry.MustRegister(proxyRequestDuration)
+}
+
+func observeProxyRequestDuration(r *http.Request, start time.Time) {
+	verb := "unknown"
+	if reqInfo, ok := genericapirequest.RequestInfoFrom(r.Context()); ok && reqInfo.Verb != "" {
+		verb = reqInfo.Verb
+	}
+	proxyRequestDuration.WithLabelValues(verb).Observe(time.Since(start).Seconds())
+}
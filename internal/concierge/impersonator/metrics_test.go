@@ -0,0 +1,40 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package impersonator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/component-base/metrics/testutil"
+)
+
+func TestObserveProxyRequestDuration(t *testing.T) {
+	requestWithVerb := httptest.NewRequest(http.MethodGet, "/api/v1/namespaces", nil)
+	requestWithVerb = requestWithVerb.WithContext(genericapirequest.WithRequestInfo(requestWithVerb.Context(),
+		&genericapirequest.RequestInfo{Verb: "deletecollection"}))
+	requestWithoutVerb := httptest.NewRequest(http.MethodGet, "/api/v1/namespaces", nil)
+
+	observationCount := func(verb string) uint64 {
+		count, err := testutil.GetHistogramMetricCount(proxyRequestDuration.WithLabelValues(verb))
+		require.NoError(t, err)
+		return count
+	}
+	deleteCollectionCountBefore := observationCount("deletecollection")
+	unknownCountBefore := observationCount("unknown")
+
+	observeProxyRequestDuration(requestWithVerb, time.Now().Add(-time.Second))
+	observeProxyRequestDuration(requestWithoutVerb, time.Now())
+
+	require.Equal(t, deleteCollectionCountBefore+1, observationCount("deletecollection"))
+	require.Equal(t, unknownCountBefore+1, observationCount("unknown"))
+
+	sum, err := testutil.GetHistogramMetricValue(proxyRequestDuration.WithLabelValues("deletecollection"))
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, sum, float64(1))
+}
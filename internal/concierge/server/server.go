@@ -1,4 +1,4 @@
-// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 // Package server is the command line entry point for pinniped-concierge.
@@ -8,6 +8,8 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net"
+	"net/http"
 	"os"
 	"time"
 
@@ -21,8 +23,10 @@ import (
 	genericoptions "k8s.io/apiserver/pkg/server/options"
 	"k8s.io/client-go/pkg/version"
 	"k8s.io/client-go/rest"
+	"k8s.io/component-base/metrics/legacyregistry"
 
 	conciergeopenapi "go.pinniped.dev/generated/latest/client/concierge/openapi"
+	"go.pinniped.dev/internal/auditlog"
 	"go.pinniped.dev/internal/certauthority/dynamiccertauthority"
 	"go.pinniped.dev/internal/concierge/apiserver"
 	conciergescheme "go.pinniped.dev/internal/concierge/scheme"
@@ -159,6 +163,11 @@ func (a *App) runServer(ctx context.Context) error {
 		return fmt.Errorf("could not prepare controllers: %w", err)
 	}
 
+	auditLogger, err := auditlog.NewFromSpec(ctx, cfg.Audit)
+	if err != nil {
+		return fmt.Errorf("could not configure audit events: %w", err)
+	}
+
 	certIssuer := issuer.ClientCertIssuers{
 		dynamiccertauthority.New(dynamicSigningCertProvider),            // attempt to use the real Kube CA if possible
 		dynamiccertauthority.New(impersonationProxySigningCertProvider), // fallback to our internal CA if we need to
@@ -175,6 +184,7 @@ func (a *App) runServer(ctx context.Context) error {
 		scheme,
 		loginGV,
 		identityGV,
+		auditLogger,
 	)
 	if err != nil {
 		return fmt.Errorf("could not configure aggregated API server: %w", err)
@@ -186,10 +196,55 @@ func (a *App) runServer(ctx context.Context) error {
 		return fmt.Errorf("could not create aggregated API server: %w", err)
 	}
 
+	if e := cfg.Endpoints.Metrics; e.Network != concierge.NetworkDisabled {
+		if err := startMetricsServer(ctx, e); err != nil {
+			return err
+		}
+	}
+
 	// Run the server. Its post-start hook will start the controllers.
 	return server.GenericAPIServer.PrepareRun().Run(ctx.Done())
 }
 
+// startMetricsServer serves the Prometheus metrics on a plaintext listener until the context is cancelled.
+// All paths other than /metrics will result in 404.
+func startMetricsServer(ctx context.Context, e *concierge.Endpoint) error {
+	if e.Network == concierge.NetworkUnix {
+		_ = os.Remove(e.Address) // empty dir volumes persist across container crashes
+	}
+
+	listener, err := net.Listen(e.Network, e.Address)
+	if err != nil {
+		return fmt.Errorf("cannot create metrics listener with network %q and address %q: %w", e.Network, e.Address, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", legacyregistry.Handler())
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		err := server.Serve(listener)
+		plog.Debug("metrics server exited", "err", err)
+	}()
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			plog.Debug("metrics server shutdown failed", "err", err)
+		}
+	}()
+
+	plog.Debug("concierge metrics listener started", "address", listener.Addr().String())
+	return nil
+}
+
 // Create a configuration for the aggregated API server.
 func getAggregatedAPIServerConfig(
 	dynamicCertProvider dynamiccert.Private,
@@ -200,6 +255,7 @@ func getAggregatedAPIServerConfig(
 	aggregatedAPIServerPort int64,
 	scheme *runtime.Scheme,
 	loginConciergeGroupVersion, identityConciergeGroupVersion schema.GroupVersion,
+	auditLogger auditlog.Logger,
 ) (*apiserver.Config, error) {
 	codecs := serializer.NewCodecFactory(scheme)
 
@@ -251,6 +307,7 @@ func getAggregatedAPIServerConfig(
 			NegotiatedSerializer:          codecs,
 			LoginConciergeGroupVersion:    loginConciergeGroupVersion,
 			IdentityConciergeGroupVersion: identityConciergeGroupVersion,
+			AuditLogger:                   auditLogger,
 		},
 	}
 	return apiServerConfig, nil
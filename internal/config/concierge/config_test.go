@@ -1,4 +1,4 @@
-// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package concierge
@@ -11,6 +11,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"k8s.io/utils/pointer"
 
+	"go.pinniped.dev/internal/auditlog"
 	"go.pinniped.dev/internal/here"
 	"go.pinniped.dev/internal/plog"
 )
@@ -35,6 +36,10 @@ func TestFromPath(t *testing.T) {
 				apiGroupSuffix: some.suffix.com
 				aggregatedAPIServerPort: 12345
 				impersonationProxyServerPort: 4242
+				endpoints:
+				  metrics:
+				    network: tcp
+				    address: 127.0.0.1:9090
 				names:
 				  servingCertificateSecret: pinniped-concierge-api-tls-serving-certificate
 				  credentialIssuer: pinniped-config
@@ -56,6 +61,8 @@ func TestFromPath(t *testing.T) {
 				  image: kube-cert-agent-image
 				  imagePullSecrets: [kube-cert-agent-image-pull-secret]
 				logLevel: debug
+				audit:
+				  sink: stdout
 			`),
 			wantConfig: &Config{
 				DiscoveryInfo: DiscoveryInfoSpec{
@@ -70,6 +77,12 @@ func TestFromPath(t *testing.T) {
 				APIGroupSuffix:               pointer.String("some.suffix.com"),
 				AggregatedAPIServerPort:      pointer.Int64(12345),
 				ImpersonationProxyServerPort: pointer.Int64(4242),
+				Endpoints: &Endpoints{
+					Metrics: &Endpoint{
+						Network: "tcp",
+						Address: "127.0.0.1:9090",
+					},
+				},
 				NamesConfig: NamesConfigSpec{
 					ServingCertificateSecret:          "pinniped-concierge-api-tls-serving-certificate",
 					CredentialIssuer:                  "pinniped-config",
@@ -94,6 +107,9 @@ func TestFromPath(t *testing.T) {
 				Log: plog.LogSpec{
 					Level: plog.LevelDebug,
 				},
+				Audit: auditlog.Spec{
+					Sink: auditlog.SinkStdout,
+				},
 			},
 		},
 		{
@@ -146,6 +162,11 @@ func TestFromPath(t *testing.T) {
 				APIGroupSuffix:               pointer.String("some.suffix.com"),
 				AggregatedAPIServerPort:      pointer.Int64(12345),
 				ImpersonationProxyServerPort: pointer.Int64(4242),
+				Endpoints: &Endpoints{
+					Metrics: &Endpoint{
+						Network: "disabled",
+					},
+				},
 				NamesConfig: NamesConfigSpec{
 					ServingCertificateSecret:          "pinniped-concierge-api-tls-serving-certificate",
 					CredentialIssuer:                  "pinniped-config",
@@ -223,6 +244,11 @@ func TestFromPath(t *testing.T) {
 				APIGroupSuffix:               pointer.String("some.suffix.com"),
 				AggregatedAPIServerPort:      pointer.Int64(12345),
 				ImpersonationProxyServerPort: pointer.Int64(4242),
+				Endpoints: &Endpoints{
+					Metrics: &Endpoint{
+						Network: "disabled",
+					},
+				},
 				NamesConfig: NamesConfigSpec{
 					ServingCertificateSecret:          "pinniped-concierge-api-tls-serving-certificate",
 					CredentialIssuer:                  "pinniped-config",
@@ -270,6 +296,25 @@ func TestFromPath(t *testing.T) {
 			`),
 			wantError: "decode yaml: error unmarshaling JSON: while decoding JSON: invalid log format, valid choices are the empty string, json and text",
 		},
+		{
+			name: "invalid audit sink",
+			yaml: here.Doc(`
+				---
+				names:
+				  servingCertificateSecret: pinniped-concierge-api-tls-serving-certificate
+				  credentialIssuer: pinniped-config
+				  apiService: pinniped-api
+				  impersonationLoadBalancerService: impersonationLoadBalancerService-value
+				  impersonationClusterIPService: impersonationClusterIPService-value
+				  impersonationTLSCertificateSecret: impersonationTLSCertificateSecret-value
+				  impersonationCACertificateSecret: impersonationCACertificateSecret-value
+				  impersonationSignerSecret: impersonationSignerSecret-value
+				  agentServiceAccount: agentServiceAccount-value
+				audit:
+				  sink: webhook
+			`),
+			wantError: "validate audit: invalid audit sink, valid choices are the empty string, disabled, stdout and file",
+		},
 		{
 			name: "When only the required fields are present, causes other fields to be defaulted",
 			yaml: here.Doc(`
@@ -292,6 +337,11 @@ func TestFromPath(t *testing.T) {
 				APIGroupSuffix:               pointer.String("pinniped.dev"),
 				AggregatedAPIServerPort:      pointer.Int64(10250),
 				ImpersonationProxyServerPort: pointer.Int64(8444),
+				Endpoints: &Endpoints{
+					Metrics: &Endpoint{
+						Network: "disabled",
+					},
+				},
 				APIConfig: APIConfigSpec{
 					ServingCertificateConfig: ServingCertificateConfigSpec{
 						DurationSeconds:    pointer.Int64(60 * 60 * 24 * 365),    // about a year
@@ -538,6 +588,38 @@ func TestFromPath(t *testing.T) {
 			`),
 			wantError: "validate impersonationProxyServerPort: must be within range 1024 to 65535",
 		},
+		{
+			name: "metrics endpoint without address",
+			yaml: here.Doc(`
+				---
+				endpoints:
+				  metrics:
+				    network: tcp
+			`),
+			wantError: `validate metrics endpoint: address must be set with "tcp" network`,
+		},
+		{
+			name: "disabled metrics endpoint with address",
+			yaml: here.Doc(`
+				---
+				endpoints:
+				  metrics:
+				    network: disabled
+				    address: :9090
+			`),
+			wantError: `validate metrics endpoint: address set to ":9090" when disabled, should be empty`,
+		},
+		{
+			name: "metrics endpoint with unknown network",
+			yaml: here.Doc(`
+				---
+				endpoints:
+				  metrics:
+				    network: udp
+				    address: :9090
+			`),
+			wantError: `validate metrics endpoint: unknown network "udp"`,
+		},
 		{
 			name: "ZeroRenewBefore",
 			yaml: here.Doc(`
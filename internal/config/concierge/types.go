@@ -1,9 +1,12 @@
-// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package concierge
 
-import "go.pinniped.dev/internal/plog"
+import (
+	"go.pinniped.dev/internal/auditlog"
+	"go.pinniped.dev/internal/plog"
+)
 
 // Config contains knobs to setup an instance of the Pinniped Concierge.
 type Config struct {
@@ -12,12 +15,26 @@ type Config struct {
 	APIGroupSuffix               *string           `json:"apiGroupSuffix,omitempty"`
 	AggregatedAPIServerPort      *int64            `json:"aggregatedAPIServerPort"`
 	ImpersonationProxyServerPort *int64            `json:"impersonationProxyServerPort"`
+	Endpoints                    *Endpoints        `json:"endpoints"`
 	NamesConfig                  NamesConfigSpec   `json:"names"`
 	KubeCertAgentConfig          KubeCertAgentSpec `json:"kubeCertAgent"`
 	Labels                       map[string]string `json:"labels"`
 	// Deprecated: use log.level instead
 	LogLevel *plog.LogLevel `json:"logLevel"`
 	Log      plog.LogSpec   `json:"log"`
+	Audit    auditlog.Spec  `json:"audit"`
+}
+
+// Endpoints configures the listeners of the Concierge which are not part of its Kubernetes APIs.
+type Endpoints struct {
+	// Metrics is the listener for the plaintext Prometheus metrics endpoint, which is disabled by default.
+	Metrics *Endpoint `json:"metrics,omitempty"`
+}
+
+// Endpoint configures the network and address of a listener.
+type Endpoint struct {
+	Network string `json:"network"`
+	Address string `json:"address"`
 }
 
 // DiscoveryInfoSpec contains configuration knobs specific to
@@ -1,4 +1,4 @@
-// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 // Package supervisor contains functionality to load/store Config's from/to
@@ -11,12 +11,15 @@ import (
 	"net"
 	"os"
 	"strings"
+	"time"
 
 	"k8s.io/utils/pointer"
 	"sigs.k8s.io/yaml"
 
 	"go.pinniped.dev/internal/constable"
 	"go.pinniped.dev/internal/groupsuffix"
+	"go.pinniped.dev/internal/oidc"
+	"go.pinniped.dev/internal/oidc/device"
 	"go.pinniped.dev/internal/plog"
 )
 
@@ -30,6 +33,8 @@ const (
 	// allow traffic from the control plane to most ports, but do allow traffic to port 10250. This allows
 	// the Concierge to work without additional configuration on these types of clusters.
 	aggregatedAPIServerPortDefault = 10250
+
+	secretRotationGracePeriodDefault = 24 * time.Hour
 )
 
 // FromPath loads an Config from a provided local file path, inserts any
@@ -66,11 +71,28 @@ func FromPath(ctx context.Context, path string) (*Config, error) {
 		return nil, fmt.Errorf("validate names: %w", err)
 	}
 
+	maybeSetSecretRotationDefaults(&config.SecretRotation)
+
+	if err := validateSecretRotation(config.SecretRotation); err != nil {
+		return nil, fmt.Errorf("validate secretRotation: %w", err)
+	}
+	warnAboutShortSecretRotationGracePeriod(config.SecretRotation)
+
+	maybeSetDeviceAuthorizationDefaults(&config.DeviceAuthorization)
+
+	if err := validateDeviceAuthorization(config.DeviceAuthorization); err != nil {
+		return nil, fmt.Errorf("validate deviceAuthorization: %w", err)
+	}
+
 	plog.MaybeSetDeprecatedLogLevel(config.LogLevel, &config.Log)
 	if err := plog.ValidateAndSetLogLevelAndFormatGlobally(ctx, config.Log); err != nil {
 		return nil, fmt.Errorf("validate log level: %w", err)
 	}
 
+	if err := config.Audit.Validate(); err != nil {
+		return nil, fmt.Errorf("validate audit: %w", err)
+	}
+
 	// support setting this to null or {} or empty in the YAML
 	if config.Endpoints == nil {
 		config.Endpoints = &Endpoints{}
@@ -83,6 +105,9 @@ func FromPath(ctx context.Context, path string) (*Config, error) {
 	maybeSetEndpointDefault(&config.Endpoints.HTTP, Endpoint{
 		Network: NetworkDisabled,
 	})
+	maybeSetEndpointDefault(&config.Endpoints.Metrics, Endpoint{
+		Network: NetworkDisabled,
+	})
 
 	if err := validateEndpoint(*config.Endpoints.HTTPS); err != nil {
 		return nil, fmt.Errorf("validate https endpoint: %w", err)
@@ -96,6 +121,9 @@ func FromPath(ctx context.Context, path string) (*Config, error) {
 	if err := validateAtLeastOneEnabledEndpoint(*config.Endpoints.HTTPS, *config.Endpoints.HTTP); err != nil {
 		return nil, fmt.Errorf("validate endpoints: %w", err)
 	}
+	if err := validateEndpoint(*config.Endpoints.Metrics); err != nil {
+		return nil, fmt.Errorf("validate metrics endpoint: %w", err)
+	}
 
 	return &config, nil
 }
@@ -123,6 +151,95 @@ func maybeSetAggregatedAPIServerPortDefaults(port **int64) {
 	}
 }
 
+func maybeSetSecretRotationDefaults(secretRotation *SecretRotationSpec) {
+	if secretRotation.Interval.Duration > 0 && secretRotation.GracePeriod.Duration == 0 {
+		secretRotation.GracePeriod.Duration = secretRotationGracePeriodDefault
+	}
+}
+
+func validateSecretRotation(secretRotation SecretRotationSpec) error {
+	if secretRotation.Interval.Duration < 0 {
+		return constable.Error("interval must not be negative")
+	}
+	if secretRotation.GracePeriod.Duration < 0 {
+		return constable.Error("gracePeriod must not be negative")
+	}
+	if secretRotation.Interval.Duration > 0 && secretRotation.Interval.Duration < time.Hour {
+		return constable.Error("interval must be at least 1h")
+	}
+	// Only the most recent previous key is kept, so it must stop being needed before the next rotation.
+	if secretRotation.GracePeriod.Duration > secretRotation.Interval.Duration {
+		return constable.Error("gracePeriod must not be longer than interval")
+	}
+	return nil
+}
+
+// warnAboutShortSecretRotationGracePeriod logs a warning when the grace period is shorter than the default refresh
+// token lifetime of FederationDomains, since refresh tokens which were signed by the previous key stop working when
+// the grace period ends. FederationDomains may configure longer refresh token lifetimes, so the
+// FederationDomainWatcherController checks those against the grace period as well.
+func warnAboutShortSecretRotationGracePeriod(secretRotation SecretRotationSpec) {
+	refreshTokenLifetime := oidc.DefaultOIDCTimeoutsConfiguration().RefreshTokenLifespan
+	if secretRotation.Interval.Duration > 0 && secretRotation.GracePeriod.Duration < refreshTokenLifetime {
+		plog.Warning("secretRotation gracePeriod is shorter than the default refresh token lifetime, "+
+			"so some refresh tokens will stop working before they expire",
+			"gracePeriod", secretRotation.GracePeriod.Duration.String(),
+			"refreshTokenLifetime", refreshTokenLifetime.String())
+	}
+}
+
+func maybeSetDeviceAuthorizationDefaults(deviceAuthorization *DeviceAuthorizationSpec) {
+	defaults := device.DefaultLimits()
+	maybeSetLimitDefault := func(limit **int64, defaultLimit int) {
+		if *limit == nil {
+			*limit = pointer.Int64(int64(defaultLimit))
+		}
+	}
+	maybeSetLimitDefault(&deviceAuthorization.MaxPendingAuthorizations, defaults.MaxPendingAuthorizations)
+	maybeSetLimitDefault(&deviceAuthorization.MaxPendingAuthorizationsPerAddress, defaults.MaxPendingAuthorizationsPerAddress)
+	maybeSetLimitDefault(&deviceAuthorization.MaxFailedAttempts, defaults.MaxFailedAttempts)
+	maybeSetLimitDefault(&deviceAuthorization.MaxFailedAttemptsPerAddress, defaults.MaxFailedAttemptsPerAddress)
+}
+
+func validateDeviceAuthorization(deviceAuthorization DeviceAuthorizationSpec) error {
+	// The limits for all addresses together bound the storage which can be used by unauthenticated requests,
+	// so they cannot be disabled.
+	if *deviceAuthorization.MaxPendingAuthorizations < 1 {
+		return constable.Error("maxPendingAuthorizations must be at least 1")
+	}
+	if *deviceAuthorization.MaxFailedAttempts < 1 {
+		return constable.Error("maxFailedAttempts must be at least 1")
+	}
+	if *deviceAuthorization.MaxPendingAuthorizationsPerAddress < 0 {
+		return constable.Error("maxPendingAuthorizationsPerAddress must not be negative")
+	}
+	if *deviceAuthorization.MaxFailedAttemptsPerAddress < 0 {
+		return constable.Error("maxFailedAttemptsPerAddress must not be negative")
+	}
+	for _, cidr := range deviceAuthorization.TrustedProxies {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("trustedProxies must contain CIDRs: %w", err)
+		}
+	}
+	return nil
+}
+
+// DeviceLimits returns the limits of the device authorization grant. The spec must have been validated already.
+func (s DeviceAuthorizationSpec) DeviceLimits() device.Limits {
+	limits := device.Limits{
+		MaxPendingAuthorizations:           int(*s.MaxPendingAuthorizations),
+		MaxPendingAuthorizationsPerAddress: int(*s.MaxPendingAuthorizationsPerAddress),
+		MaxFailedAttempts:                  int(*s.MaxFailedAttempts),
+		MaxFailedAttemptsPerAddress:        int(*s.MaxFailedAttemptsPerAddress),
+	}
+	for _, cidr := range s.TrustedProxies {
+		if _, network, err := net.ParseCIDR(cidr); err == nil {
+			limits.TrustedProxies = append(limits.TrustedProxies, network)
+		}
+	}
+	return limits
+}
+
 func validateNames(names *NamesConfigSpec) error {
 	missingNames := []string{}
 	if names.DefaultTLSCertificateSecret == "" {
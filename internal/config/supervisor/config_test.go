@@ -1,4 +1,4 @@
-// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package supervisor
@@ -6,16 +6,30 @@ package supervisor
 import (
 	"context"
 	"fmt"
+	"net"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/utils/pointer"
 
+	"go.pinniped.dev/internal/auditlog"
 	"go.pinniped.dev/internal/here"
+	"go.pinniped.dev/internal/oidc/device"
 	"go.pinniped.dev/internal/plog"
 )
 
+func defaultDeviceAuthorization() DeviceAuthorizationSpec {
+	return DeviceAuthorizationSpec{
+		MaxPendingAuthorizations:           pointer.Int64(1000),
+		MaxPendingAuthorizationsPerAddress: pointer.Int64(100),
+		MaxFailedAttempts:                  pointer.Int64(500),
+		MaxFailedAttemptsPerAddress:        pointer.Int64(50),
+	}
+}
+
 func TestFromPath(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -40,9 +54,25 @@ func TestFromPath(t *testing.T) {
 				  http:
 				    network: tcp
 					address: 127.0.0.1:1234
+				  metrics:
+				    network: tcp
+				    address: :9090
 				insecureAcceptExternalUnencryptedHttpRequests: false
 				logLevel: trace
 				aggregatedAPIServerPort: 12345
+				audit:
+				  sink: file
+				  filePath: /var/log/pinniped/audit.log
+				secretRotation:
+				  interval: 720h
+				  gracePeriod: 12h
+				requestClientCertificates: true
+				deviceAuthorization:
+				  maxPendingAuthorizations: 5000
+				  maxPendingAuthorizationsPerAddress: 0
+				  maxFailedAttempts: 1000
+				  maxFailedAttemptsPerAddress: 20
+				  trustedProxies: [10.0.0.0/8, "fd00::/8"]
 			`),
 			wantConfig: &Config{
 				APIGroupSuffix: pointer.String("some.suffix.com"),
@@ -62,6 +92,10 @@ func TestFromPath(t *testing.T) {
 						Network: "tcp",
 						Address: "127.0.0.1:1234",
 					},
+					Metrics: &Endpoint{
+						Network: "tcp",
+						Address: ":9090",
+					},
 				},
 				AllowExternalHTTP: false,
 				LogLevel:          func(level plog.LogLevel) *plog.LogLevel { return &level }(plog.LevelTrace),
@@ -69,6 +103,22 @@ func TestFromPath(t *testing.T) {
 					Level: plog.LevelTrace,
 				},
 				AggregatedAPIServerPort: pointer.Int64(12345),
+				Audit: auditlog.Spec{
+					Sink:     auditlog.SinkFile,
+					FilePath: "/var/log/pinniped/audit.log",
+				},
+				SecretRotation: SecretRotationSpec{
+					Interval:    metav1.Duration{Duration: 720 * time.Hour},
+					GracePeriod: metav1.Duration{Duration: 12 * time.Hour},
+				},
+				RequestClientCertificates: true,
+				DeviceAuthorization: DeviceAuthorizationSpec{
+					MaxPendingAuthorizations:           pointer.Int64(5000),
+					MaxPendingAuthorizationsPerAddress: pointer.Int64(0),
+					MaxFailedAttempts:                  pointer.Int64(1000),
+					MaxFailedAttemptsPerAddress:        pointer.Int64(20),
+					TrustedProxies:                     []string{"10.0.0.0/8", "fd00::/8"},
+				},
 			},
 		},
 		{
@@ -112,6 +162,9 @@ func TestFromPath(t *testing.T) {
 						Network: "tcp",
 						Address: "127.0.0.1:1234",
 					},
+					Metrics: &Endpoint{
+						Network: "disabled",
+					},
 				},
 				AllowExternalHTTP: false,
 				Log: plog.LogSpec{
@@ -119,6 +172,7 @@ func TestFromPath(t *testing.T) {
 					Format: plog.FormatText,
 				},
 				AggregatedAPIServerPort: pointer.Int64(12345),
+				DeviceAuthorization:     defaultDeviceAuthorization(),
 			},
 		},
 		{
@@ -162,6 +216,9 @@ func TestFromPath(t *testing.T) {
 						Network: "tcp",
 						Address: "127.0.0.1:1234",
 					},
+					Metrics: &Endpoint{
+						Network: "disabled",
+					},
 				},
 				AllowExternalHTTP: false,
 				LogLevel:          func(level plog.LogLevel) *plog.LogLevel { return &level }(plog.LevelTrace),
@@ -170,6 +227,7 @@ func TestFromPath(t *testing.T) {
 					Format: plog.FormatText,
 				},
 				AggregatedAPIServerPort: pointer.Int64(10250),
+				DeviceAuthorization:     defaultDeviceAuthorization(),
 			},
 		},
 		{
@@ -205,9 +263,13 @@ func TestFromPath(t *testing.T) {
 					HTTP: &Endpoint{
 						Network: "disabled",
 					},
+					Metrics: &Endpoint{
+						Network: "disabled",
+					},
 				},
 				AllowExternalHTTP:       false,
 				AggregatedAPIServerPort: pointer.Int64(10250),
+				DeviceAuthorization:     defaultDeviceAuthorization(),
 			},
 		},
 		{
@@ -252,6 +314,194 @@ func TestFromPath(t *testing.T) {
 			`),
 			wantError: `validate http endpoint: unknown network "bar"`,
 		},
+		{
+			name: "invalid metrics endpoint",
+			yaml: here.Doc(`
+				---
+				names:
+				  defaultTLSCertificateSecret: my-secret-name
+				endpoints:
+				  metrics:
+				    network: baz
+			`),
+			wantError: `validate metrics endpoint: unknown network "baz"`,
+		},
+		{
+			name: "metrics endpoint does not count as an enabled endpoint",
+			yaml: here.Doc(`
+				---
+				names:
+				  defaultTLSCertificateSecret: my-secret-name
+				endpoints:
+				  https:
+				    network: disabled
+				  http:
+				    network: disabled
+				  metrics:
+				    network: tcp
+				    address: :9090
+			`),
+			wantError: "validate endpoints: all endpoints are disabled",
+		},
+		{
+			name: "secretRotation gracePeriod is defaulted when rotation is enabled",
+			yaml: here.Doc(`
+				---
+				names:
+				  defaultTLSCertificateSecret: my-secret-name
+				secretRotation:
+				  interval: 720h
+			`),
+			wantConfig: &Config{
+				APIGroupSuffix: pointer.String("pinniped.dev"),
+				Labels:         map[string]string{},
+				NamesConfig: NamesConfigSpec{
+					DefaultTLSCertificateSecret: "my-secret-name",
+				},
+				Endpoints: &Endpoints{
+					HTTPS: &Endpoint{
+						Network: "tcp",
+						Address: ":8443",
+					},
+					HTTP: &Endpoint{
+						Network: "disabled",
+					},
+					Metrics: &Endpoint{
+						Network: "disabled",
+					},
+				},
+				AllowExternalHTTP:       false,
+				AggregatedAPIServerPort: pointer.Int64(10250),
+				SecretRotation: SecretRotationSpec{
+					Interval:    metav1.Duration{Duration: 720 * time.Hour},
+					GracePeriod: metav1.Duration{Duration: 24 * time.Hour},
+				},
+				DeviceAuthorization: defaultDeviceAuthorization(),
+			},
+		},
+		{
+			name: "secretRotation interval is negative",
+			yaml: here.Doc(`
+				---
+				names:
+				  defaultTLSCertificateSecret: my-secret-name
+				secretRotation:
+				  interval: -1h
+			`),
+			wantError: "validate secretRotation: interval must not be negative",
+		},
+		{
+			name: "secretRotation interval is too short",
+			yaml: here.Doc(`
+				---
+				names:
+				  defaultTLSCertificateSecret: my-secret-name
+				secretRotation:
+				  interval: 10m
+			`),
+			wantError: "validate secretRotation: interval must be at least 1h",
+		},
+		{
+			name: "secretRotation gracePeriod is negative",
+			yaml: here.Doc(`
+				---
+				names:
+				  defaultTLSCertificateSecret: my-secret-name
+				secretRotation:
+				  interval: 24h
+				  gracePeriod: -1h
+			`),
+			wantError: "validate secretRotation: gracePeriod must not be negative",
+		},
+		{
+			name: "secretRotation gracePeriod is longer than interval",
+			yaml: here.Doc(`
+				---
+				names:
+				  defaultTLSCertificateSecret: my-secret-name
+				secretRotation:
+				  interval: 24h
+				  gracePeriod: 25h
+			`),
+			wantError: "validate secretRotation: gracePeriod must not be longer than interval",
+		},
+		{
+			name: "secretRotation gracePeriod without an interval",
+			yaml: here.Doc(`
+				---
+				names:
+				  defaultTLSCertificateSecret: my-secret-name
+				secretRotation:
+				  gracePeriod: 1h
+			`),
+			wantError: "validate secretRotation: gracePeriod must not be longer than interval",
+		},
+		{
+			name: "deviceAuthorization maxPendingAuthorizations is zero",
+			yaml: here.Doc(`
+				---
+				names:
+				  defaultTLSCertificateSecret: my-secret-name
+				deviceAuthorization:
+				  maxPendingAuthorizations: 0
+			`),
+			wantError: "validate deviceAuthorization: maxPendingAuthorizations must be at least 1",
+		},
+		{
+			name: "deviceAuthorization maxFailedAttempts is zero",
+			yaml: here.Doc(`
+				---
+				names:
+				  defaultTLSCertificateSecret: my-secret-name
+				deviceAuthorization:
+				  maxFailedAttempts: 0
+			`),
+			wantError: "validate deviceAuthorization: maxFailedAttempts must be at least 1",
+		},
+		{
+			name: "deviceAuthorization maxPendingAuthorizationsPerAddress is negative",
+			yaml: here.Doc(`
+				---
+				names:
+				  defaultTLSCertificateSecret: my-secret-name
+				deviceAuthorization:
+				  maxPendingAuthorizationsPerAddress: -1
+			`),
+			wantError: "validate deviceAuthorization: maxPendingAuthorizationsPerAddress must not be negative",
+		},
+		{
+			name: "deviceAuthorization maxFailedAttemptsPerAddress is negative",
+			yaml: here.Doc(`
+				---
+				names:
+				  defaultTLSCertificateSecret: my-secret-name
+				deviceAuthorization:
+				  maxFailedAttemptsPerAddress: -1
+			`),
+			wantError: "validate deviceAuthorization: maxFailedAttemptsPerAddress must not be negative",
+		},
+		{
+			name: "deviceAuthorization trustedProxies is not a CIDR",
+			yaml: here.Doc(`
+				---
+				names:
+				  defaultTLSCertificateSecret: my-secret-name
+				deviceAuthorization:
+				  trustedProxies: [10.0.0.1]
+			`),
+			wantError: "validate deviceAuthorization: trustedProxies must contain CIDRs: invalid CIDR address: 10.0.0.1",
+		},
+		{
+			name: "audit file sink without a file path",
+			yaml: here.Doc(`
+				---
+				names:
+				  defaultTLSCertificateSecret: my-secret-name
+				audit:
+				  sink: file
+			`),
+			wantError: "validate audit: audit.filePath is required when audit.sink is file",
+		},
 		{
 			name: "http endpoint uses tcp but binds to more than only loopback interfaces with insecureAcceptExternalUnencryptedHttpRequests missing",
 			yaml: here.Doc(`
@@ -336,9 +586,13 @@ func TestFromPath(t *testing.T) {
 						Network: "tcp",
 						Address: ":1234",
 					},
+					Metrics: &Endpoint{
+						Network: "disabled",
+					},
 				},
 				AllowExternalHTTP:       true,
 				AggregatedAPIServerPort: pointer.Int64(10250),
+				DeviceAuthorization:     defaultDeviceAuthorization(),
 			},
 		},
 		{
@@ -368,9 +622,13 @@ func TestFromPath(t *testing.T) {
 						Network: "tcp",
 						Address: ":1234",
 					},
+					Metrics: &Endpoint{
+						Network: "disabled",
+					},
 				},
 				AllowExternalHTTP:       true,
 				AggregatedAPIServerPort: pointer.Int64(10250),
+				DeviceAuthorization:     defaultDeviceAuthorization(),
 			},
 		},
 		{
@@ -548,3 +806,27 @@ func TestAddrIsOnlyOnLoopback(t *testing.T) {
 		})
 	}
 }
+
+func TestDeviceLimits(t *testing.T) {
+	spec := DeviceAuthorizationSpec{
+		MaxPendingAuthorizations:           pointer.Int64(5000),
+		MaxPendingAuthorizationsPerAddress: pointer.Int64(0),
+		MaxFailedAttempts:                  pointer.Int64(1000),
+		MaxFailedAttemptsPerAddress:        pointer.Int64(20),
+		TrustedProxies:                     []string{"10.0.0.0/8", "fd00::/8"},
+	}
+
+	require.Equal(t, device.Limits{
+		MaxPendingAuthorizations:           5000,
+		MaxPendingAuthorizationsPerAddress: 0,
+		MaxFailedAttempts:                  1000,
+		MaxFailedAttemptsPerAddress:        20,
+		TrustedProxies: []*net.IPNet{
+			{IP: net.IP{10, 0, 0, 0}, Mask: net.CIDRMask(8, 32)},
+			{IP: net.ParseIP("fd00::"), Mask: net.CIDRMask(8, 128)},
+		},
+	}, spec.DeviceLimits())
+
+	// The defaults are the same as the defaults of the device authorization endpoints.
+	require.Equal(t, device.DefaultLimits(), defaultDeviceAuthorization().DeviceLimits())
+}
@@ -1,4 +1,4 @@
-// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package supervisor
@@ -6,6 +6,9 @@ package supervisor
 import (
 	"errors"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"go.pinniped.dev/internal/auditlog"
 	"go.pinniped.dev/internal/plog"
 )
 
@@ -17,9 +20,50 @@ type Config struct {
 	// Deprecated: use log.level instead
 	LogLevel                *plog.LogLevel     `json:"logLevel"`
 	Log                     plog.LogSpec       `json:"log"`
+	Audit                   auditlog.Spec      `json:"audit"`
 	Endpoints               *Endpoints         `json:"endpoints"`
 	AllowExternalHTTP       stringOrBoolAsBool `json:"insecureAcceptExternalUnencryptedHttpRequests"`
 	AggregatedAPIServerPort *int64             `json:"aggregatedAPIServerPort"`
+	SecretRotation          SecretRotationSpec `json:"secretRotation"`
+	// RequestClientCertificates makes the HTTPS listener ask clients for TLS client certificates, which is needed by
+	// OIDCClients which use the tls_client_auth token endpoint authentication method. The certificates are optional,
+	// and are only verified for the OIDCClients which use them.
+	RequestClientCertificates bool `json:"requestClientCertificates"`
+	// DeviceAuthorization limits how much the device authorization grant may be used by unauthenticated requests.
+	DeviceAuthorization DeviceAuthorizationSpec `json:"deviceAuthorization"`
+}
+
+// DeviceAuthorizationSpec configures the limits of the device authorization grant of all FederationDomains together.
+// Anyone may start a device authorization for a public client, and try to guess the short user codes which are entered
+// by users, so both are limited for all client addresses together and for each client address.
+type DeviceAuthorizationSpec struct {
+	// MaxPendingAuthorizations limits the number of pending device authorizations. Defaults to 1000.
+	MaxPendingAuthorizations *int64 `json:"maxPendingAuthorizations"`
+	// MaxPendingAuthorizationsPerAddress limits the number of pending device authorizations which were started from
+	// each client address. Defaults to 100. Zero means that there is no limit per address.
+	MaxPendingAuthorizationsPerAddress *int64 `json:"maxPendingAuthorizationsPerAddress"`
+	// MaxFailedAttempts limits the number of failed attempts to enter a user code during each window of five minutes.
+	// Defaults to 500.
+	MaxFailedAttempts *int64 `json:"maxFailedAttempts"`
+	// MaxFailedAttemptsPerAddress limits the number of failed attempts to enter a user code from each client address
+	// during each window of five minutes. Defaults to 50. Zero means that there is no limit per address.
+	MaxFailedAttemptsPerAddress *int64 `json:"maxFailedAttemptsPerAddress"`
+	// TrustedProxies are the CIDRs of the load balancers or ingresses in front of the Supervisor which are trusted to
+	// add the addresses of clients to the X-Forwarded-For header. When empty, the address of each client is the
+	// address of its connection to the Supervisor, which is the address of the proxy when there is one, so the
+	// limits per address apply to all clients behind the proxy together.
+	TrustedProxies []string `json:"trustedProxies"`
+}
+
+// SecretRotationSpec configures the scheduled rotation of the symmetric keys which the Supervisor generates to sign
+// its opaque tokens, to sign and encrypt upstream state parameters, and to sign CSRF cookies.
+type SecretRotationSpec struct {
+	// Interval is how long each key is used before it is replaced by a new key. When zero, keys are never rotated.
+	Interval metav1.Duration `json:"interval"`
+	// GracePeriod is how long the previous key is still accepted after each rotation, so that values which it
+	// signed or encrypted stay valid. Defaults to 24h when rotation is enabled. It should be at least as long as the
+	// longest refresh token lifetime of any FederationDomain, since older refresh tokens stop working when it ends.
+	GracePeriod metav1.Duration `json:"gracePeriod"`
 }
 
 // NamesConfigSpec configures the names of some Kubernetes resources for the Supervisor.
@@ -31,6 +75,8 @@ type NamesConfigSpec struct {
 type Endpoints struct {
 	HTTPS *Endpoint `json:"https,omitempty"`
 	HTTP  *Endpoint `json:"http,omitempty"`
+	// Metrics is the listener for the plaintext Prometheus metrics endpoint, which is disabled by default.
+	Metrics *Endpoint `json:"metrics,omitempty"`
 }
 
 type Endpoint struct {
@@ -1,4 +1,4 @@
-// Copyright 2021-2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2021-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 // Package activedirectoryupstreamwatcher implements a controller which watches ActiveDirectoryIdentityProviders.
@@ -7,7 +7,9 @@ package activedirectoryupstreamwatcher
 import (
 	"context"
 	"fmt"
+	"net"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -16,6 +18,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
 	corev1informers "k8s.io/client-go/informers/core/v1"
 
 	"go.pinniped.dev/generated/latest/apis/supervisor/idp/v1alpha1"
@@ -70,14 +73,24 @@ const (
 	accountDisabledBitmapValue = 2
 	// 0x0010 UF_LOCKOUT in msDS-User-Account-Control-Computed bitmap.
 	accountLockedBitmapValue = 16
+
+	// The domain controllers of a domain are found by looking up the DNS SRV records named "_ldap._tcp.<domain>".
+	ldapSRVService = "ldap"
+	ldapSRVProto   = "tcp"
 )
 
+// srvResolver looks up DNS SRV records. It is implemented by net.Resolver.
+type srvResolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
 type activeDirectoryUpstreamGenericLDAPImpl struct {
 	activeDirectoryIdentityProvider v1alpha1.ActiveDirectoryIdentityProvider
+	srvResolver                     srvResolver
 }
 
 func (g *activeDirectoryUpstreamGenericLDAPImpl) Spec() upstreamwatchers.UpstreamGenericLDAPSpec {
-	return &activeDirectoryUpstreamGenericLDAPSpec{g.activeDirectoryIdentityProvider}
+	return &activeDirectoryUpstreamGenericLDAPSpec{g.activeDirectoryIdentityProvider, g.srvResolver}
 }
 
 func (g *activeDirectoryUpstreamGenericLDAPImpl) Namespace() string {
@@ -98,10 +111,66 @@ func (g *activeDirectoryUpstreamGenericLDAPImpl) Status() upstreamwatchers.Upstr
 
 type activeDirectoryUpstreamGenericLDAPSpec struct {
 	activeDirectoryIdentityProvider v1alpha1.ActiveDirectoryIdentityProvider
+	srvResolver                     srvResolver
+}
+
+func (s *activeDirectoryUpstreamGenericLDAPSpec) DetectAndSetHosts(ctx context.Context, config *upstreamldap.ProviderConfig) error {
+	spec := s.activeDirectoryIdentityProvider.Spec
+	if spec.DNSDiscovery == nil {
+		if len(spec.Host) == 0 && len(spec.Hosts) == 0 {
+			return fmt.Errorf("must specify host, hosts, or dnsDiscovery")
+		}
+		return upstreamwatchers.SetHosts(config, spec.Host, spec.Hosts)
+	}
+	if len(spec.Host) > 0 || len(spec.Hosts) > 0 {
+		return fmt.Errorf("must not specify host or hosts when dnsDiscovery is specified")
+	}
+
+	hosts, err := discoverDomainControllers(ctx, s.srvResolver, spec.DNSDiscovery.Domain)
+	if err != nil {
+		return err
+	}
+	// The discovered domain controllers may change over time, so the domain identifies the provider instead.
+	config.Host = spec.DNSDiscovery.Domain
+	config.Hosts = hosts
+	return nil
 }
 
-func (s *activeDirectoryUpstreamGenericLDAPSpec) Host() string {
-	return s.activeDirectoryIdentityProvider.Spec.Host
+// discoverDomainControllers looks up the DNS SRV records for the LDAP service of an Active Directory domain,
+// and returns the hosts ordered by their priority and then by their weight. Unlike net.Resolver, the order of hosts
+// with equal priority and weight is not randomized, so that the same records always result in the same list of hosts.
+func discoverDomainControllers(ctx context.Context, resolver srvResolver, domain string) ([]string, error) {
+	_, records, err := resolver.LookupSRV(ctx, ldapSRVService, ldapSRVProto, domain)
+	if err != nil {
+		return nil, fmt.Errorf("error looking up DNS SRV records for domain %q: %w", domain, err)
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		switch {
+		case records[i].Priority != records[j].Priority:
+			return records[i].Priority < records[j].Priority
+		case records[i].Weight != records[j].Weight:
+			return records[i].Weight > records[j].Weight
+		case records[i].Target != records[j].Target:
+			return records[i].Target < records[j].Target
+		default:
+			return records[i].Port < records[j].Port
+		}
+	})
+
+	hosts := make([]string, 0, len(records))
+	for _, record := range records {
+		target := strings.TrimSuffix(record.Target, ".")
+		if len(target) == 0 {
+			// A target of "." means that the service is decidedly not available at this domain (RFC 2782).
+			continue
+		}
+		hosts = append(hosts, net.JoinHostPort(target, strconv.Itoa(int(record.Port))))
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no DNS SRV records found for domain %q", domain)
+	}
+	return hosts, nil
 }
 
 func (s *activeDirectoryUpstreamGenericLDAPSpec) TLSSpec() *v1alpha1.TLSSpec {
@@ -226,7 +295,9 @@ type UpstreamActiveDirectoryIdentityProviderICache interface {
 type activeDirectoryWatcherController struct {
 	cache                                   UpstreamActiveDirectoryIdentityProviderICache
 	validatedSettingsCache                  upstreamwatchers.ValidatedSettingsCacheI
+	providerStateCache                      *upstreamldap.ProviderStateCache
 	ldapDialer                              upstreamldap.LDAPDialer
+	srvResolver                             srvResolver
 	client                                  pinnipedclientset.Interface
 	activeDirectoryIdentityProviderInformer idpinformers.ActiveDirectoryIdentityProviderInformer
 	secretInformer                          corev1informers.SecretInformer
@@ -246,6 +317,8 @@ func New(
 		upstreamwatchers.NewValidatedSettingsCache(),
 		// nil means to use a real production dialer when creating objects to add to the cache
 		nil,
+		// use the real DNS resolver to discover domain controllers
+		net.DefaultResolver,
 		client,
 		activeDirectoryIdentityProviderInformer,
 		secretInformer,
@@ -258,6 +331,7 @@ func newInternal(
 	idpCache UpstreamActiveDirectoryIdentityProviderICache,
 	validatedSettingsCache upstreamwatchers.ValidatedSettingsCacheI,
 	ldapDialer upstreamldap.LDAPDialer,
+	srvResolver srvResolver,
 	client pinnipedclientset.Interface,
 	activeDirectoryIdentityProviderInformer idpinformers.ActiveDirectoryIdentityProviderInformer,
 	secretInformer corev1informers.SecretInformer,
@@ -266,7 +340,9 @@ func newInternal(
 	c := activeDirectoryWatcherController{
 		cache:                                   idpCache,
 		validatedSettingsCache:                  validatedSettingsCache,
+		providerStateCache:                      upstreamldap.NewProviderStateCache(),
 		ldapDialer:                              ldapDialer,
+		srvResolver:                             srvResolver,
 		client:                                  client,
 		activeDirectoryIdentityProviderInformer: activeDirectoryIdentityProviderInformer,
 		secretInformer:                          secretInformer,
@@ -295,7 +371,9 @@ func (c *activeDirectoryWatcherController) Sync(ctx controllerlib.Context) error
 
 	requeue := false
 	validatedUpstreams := make([]provider.UpstreamLDAPIdentityProviderI, 0, len(actualUpstreams))
+	upstreamUIDs := make([]types.UID, 0, len(actualUpstreams))
 	for _, upstream := range actualUpstreams {
+		upstreamUIDs = append(upstreamUIDs, upstream.UID)
 		valid, requestedRequeue := c.validateUpstream(ctx.Context, upstream)
 		if valid != nil {
 			validatedUpstreams = append(validatedUpstreams, valid)
@@ -306,6 +384,7 @@ func (c *activeDirectoryWatcherController) Sync(ctx controllerlib.Context) error
 	}
 
 	c.cache.SetActiveDirectoryIdentityProviders(validatedUpstreams)
+	c.providerStateCache.Retain(upstreamUIDs)
 
 	if requeue {
 		return controllerlib.ErrSyntheticRequeue
@@ -316,12 +395,11 @@ func (c *activeDirectoryWatcherController) Sync(ctx controllerlib.Context) error
 func (c *activeDirectoryWatcherController) validateUpstream(ctx context.Context, upstream *v1alpha1.ActiveDirectoryIdentityProvider) (p provider.UpstreamLDAPIdentityProviderI, requeue bool) {
 	spec := upstream.Spec
 
-	adUpstreamImpl := &activeDirectoryUpstreamGenericLDAPImpl{activeDirectoryIdentityProvider: *upstream}
+	adUpstreamImpl := &activeDirectoryUpstreamGenericLDAPImpl{activeDirectoryIdentityProvider: *upstream, srvResolver: c.srvResolver}
 
 	config := &upstreamldap.ProviderConfig{
 		Name:        upstream.Name,
 		ResourceUID: upstream.UID,
-		Host:        spec.Host,
 		UserSearch: upstreamldap.UserSearchConfig{
 			Base:              spec.UserSearch.Base,
 			Filter:            adUpstreamImpl.Spec().UserSearch().Filter(),
@@ -355,7 +433,7 @@ func (c *activeDirectoryWatcherController) validateUpstream(ctx context.Context,
 
 	c.updateStatus(ctx, upstream, conditions.Conditions())
 
-	return upstreamwatchers.EvaluateConditions(conditions, config)
+	return upstreamwatchers.EvaluateConditions(conditions, config, c.providerStateCache)
 }
 
 func (c *activeDirectoryWatcherController) updateStatus(ctx context.Context, upstream *v1alpha1.ActiveDirectoryIdentityProvider, conditions []*v1alpha1.Condition) {
@@ -1,4 +1,4 @@
-// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package activedirectoryupstreamwatcher
@@ -8,6 +8,7 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"net"
 	"reflect"
 	"sort"
 	"testing"
@@ -144,6 +145,25 @@ type comparableDialer struct {
 	upstreamldap.LDAPDialerFunc
 }
 
+// fakeSRVResolver returns the configured DNS SRV records, keyed by the name which was looked up.
+type fakeSRVResolver struct {
+	records map[string][]*net.SRV
+	err     error
+}
+
+func (f *fakeSRVResolver) LookupSRV(_ context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	if f.err != nil {
+		return "", nil, f.err
+	}
+	cname := fmt.Sprintf("_%s._%s.%s.", service, proto, name)
+	records, ok := f.records[cname]
+	if !ok {
+		return "", nil, &net.DNSError{Err: "no such host", Name: cname, IsNotFound: true}
+	}
+	// Return copies, since the caller sorts the records.
+	return cname, append([]*net.SRV{}, records...), nil
+}
+
 func TestActiveDirectoryUpstreamWatcherControllerSync(t *testing.T) {
 	t.Parallel()
 	now := metav1.NewTime(time.Now().UTC())
@@ -156,6 +176,7 @@ func TestActiveDirectoryUpstreamWatcherControllerSync(t *testing.T) {
 		testBindUsername      = "test-bind-username"
 		testBindPassword      = "test-bind-password"
 		testHost              = "ldap.example.com:123"
+		testDomain            = "ad.example.com"
 		testUserSearchBase    = "test-user-search-base"
 		testUserSearchFilter  = "test-user-search-filter"
 		testGroupSearchBase   = "test-group-search-base"
@@ -261,6 +282,21 @@ func TestActiveDirectoryUpstreamWatcherControllerSync(t *testing.T) {
 		c.LastTransitionTime = metav1.Time{}
 		return c
 	}
+	hostsNotFoundCondition := func(gen int64, message string) v1alpha1.Condition {
+		return v1alpha1.Condition{
+			Type:               "LDAPConnectionValid",
+			Status:             "False",
+			LastTransitionTime: now,
+			Reason:             "HostsNotFound",
+			Message:            message,
+			ObservedGeneration: gen,
+		}
+	}
+	providerConfigWithHosts := func(editFunc func(config *upstreamldap.ProviderConfig)) *upstreamldap.ProviderConfig {
+		config := *providerConfigForValidUpstreamWithTLS
+		editFunc(&config)
+		return &config
+	}
 	condPtr := func(c v1alpha1.Condition) *v1alpha1.Condition {
 		return &c
 	}
@@ -365,6 +401,8 @@ func TestActiveDirectoryUpstreamWatcherControllerSync(t *testing.T) {
 		inputSecrets             []runtime.Object
 		setupMocks               func(conn *mockldapconn.MockConn)
 		dialErrors               map[string]error
+		srvRecords               map[string][]*net.SRV
+		srvError                 error
 		wantErr                  string
 		wantResultingCache       []*upstreamldap.ProviderConfig
 		wantResultingUpstreams   []v1alpha1.ActiveDirectoryIdentityProvider
@@ -1977,6 +2015,159 @@ func TestActiveDirectoryUpstreamWatcherControllerSync(t *testing.T) {
 				SearchBaseFoundCondition:  condPtr(withoutTime(searchBaseFoundInConfigCondition(0))),
 			}},
 		},
+		{
+			name: "dnsDiscovery finds the domain controllers using DNS SRV records and validates each of them",
+			inputUpstreams: []runtime.Object{editedValidUpstream(func(upstream *v1alpha1.ActiveDirectoryIdentityProvider) {
+				upstream.Spec.Host = ""
+				upstream.Spec.DNSDiscovery = &v1alpha1.ActiveDirectoryIdentityProviderDNSDiscovery{Domain: testDomain}
+			})},
+			inputSecrets: []runtime.Object{validBindUserSecret("4242")},
+			srvRecords: map[string][]*net.SRV{
+				"_ldap._tcp." + testDomain + ".": {
+					{Target: "dc3.ad.example.com.", Port: 389, Priority: 10, Weight: 100},
+					{Target: ".", Port: 0, Priority: 0, Weight: 0},
+					{Target: "dc2.ad.example.com.", Port: 636, Priority: 0, Weight: 50},
+					{Target: "dc1.ad.example.com.", Port: 636, Priority: 0, Weight: 100},
+				},
+			},
+			dialErrors: map[string]error{
+				"dc3.ad.example.com:389": fmt.Errorf("some dial error"),
+			},
+			setupMocks: func(conn *mockldapconn.MockConn) {
+				// Should perform a test dial and bind for each domain controller which can be dialed.
+				conn.EXPECT().Bind(testBindUsername, testBindPassword).Times(2)
+				conn.EXPECT().Close().Times(2)
+			},
+			wantErr: controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingCache: []*upstreamldap.ProviderConfig{providerConfigWithHosts(func(config *upstreamldap.ProviderConfig) {
+				config.Host = testDomain
+				config.Hosts = []string{"dc1.ad.example.com:636", "dc2.ad.example.com:636", "dc3.ad.example.com:389"}
+			})},
+			wantResultingUpstreams: []v1alpha1.ActiveDirectoryIdentityProvider{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testResourceUID},
+				Status: v1alpha1.ActiveDirectoryIdentityProviderStatus{
+					Phase: "Error",
+					Conditions: []v1alpha1.Condition{
+						bindSecretValidTrueCondition(1234),
+						{
+							Type:               "LDAPConnectionValid",
+							Status:             "False",
+							LastTransitionTime: now,
+							Reason:             "LDAPConnectionError",
+							Message: fmt.Sprintf(
+								`could not successfully connect to 1 of 3 hosts and bind as user "%s": "%s": error dialing host "%s": some dial error`,
+								testBindUsername, "dc3.ad.example.com:389", "dc3.ad.example.com:389"),
+							ObservedGeneration: 1234,
+						},
+						searchBaseFoundInConfigCondition(1234),
+						tlsConfigurationValidLoadedTrueCondition(1234),
+					},
+				},
+			}},
+			wantValidatedSettings: map[string]upstreamwatchers.ValidatedSettings{},
+		},
+		{
+			name: "dnsDiscovery when the DNS SRV records cannot be looked up",
+			inputUpstreams: []runtime.Object{editedValidUpstream(func(upstream *v1alpha1.ActiveDirectoryIdentityProvider) {
+				upstream.Spec.Host = ""
+				upstream.Spec.DNSDiscovery = &v1alpha1.ActiveDirectoryIdentityProviderDNSDiscovery{Domain: testDomain}
+			})},
+			inputSecrets: []runtime.Object{validBindUserSecret("4242")},
+			srvError:     fmt.Errorf("some DNS error"),
+			wantErr:      controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingCache: []*upstreamldap.ProviderConfig{providerConfigWithHosts(func(config *upstreamldap.ProviderConfig) {
+				config.Host = ""
+				config.ConnectionProtocol = ""
+			})},
+			wantResultingUpstreams: []v1alpha1.ActiveDirectoryIdentityProvider{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testResourceUID},
+				Status: v1alpha1.ActiveDirectoryIdentityProviderStatus{
+					Phase: "Error",
+					Conditions: []v1alpha1.Condition{
+						bindSecretValidTrueCondition(1234),
+						hostsNotFoundCondition(1234, fmt.Sprintf(`error looking up DNS SRV records for domain "%s": some DNS error`, testDomain)),
+						tlsConfigurationValidLoadedTrueCondition(1234),
+					},
+				},
+			}},
+			wantValidatedSettings: map[string]upstreamwatchers.ValidatedSettings{},
+		},
+		{
+			name: "dnsDiscovery when there are no usable DNS SRV records",
+			inputUpstreams: []runtime.Object{editedValidUpstream(func(upstream *v1alpha1.ActiveDirectoryIdentityProvider) {
+				upstream.Spec.Host = ""
+				upstream.Spec.DNSDiscovery = &v1alpha1.ActiveDirectoryIdentityProviderDNSDiscovery{Domain: testDomain}
+			})},
+			inputSecrets: []runtime.Object{validBindUserSecret("4242")},
+			srvRecords: map[string][]*net.SRV{
+				"_ldap._tcp." + testDomain + ".": {{Target: ".", Port: 0, Priority: 0, Weight: 0}},
+			},
+			wantErr: controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingCache: []*upstreamldap.ProviderConfig{providerConfigWithHosts(func(config *upstreamldap.ProviderConfig) {
+				config.Host = ""
+				config.ConnectionProtocol = ""
+			})},
+			wantResultingUpstreams: []v1alpha1.ActiveDirectoryIdentityProvider{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testResourceUID},
+				Status: v1alpha1.ActiveDirectoryIdentityProviderStatus{
+					Phase: "Error",
+					Conditions: []v1alpha1.Condition{
+						bindSecretValidTrueCondition(1234),
+						hostsNotFoundCondition(1234, fmt.Sprintf(`no DNS SRV records found for domain "%s"`, testDomain)),
+						tlsConfigurationValidLoadedTrueCondition(1234),
+					},
+				},
+			}},
+			wantValidatedSettings: map[string]upstreamwatchers.ValidatedSettings{},
+		},
+		{
+			name: "dnsDiscovery cannot be combined with host",
+			inputUpstreams: []runtime.Object{editedValidUpstream(func(upstream *v1alpha1.ActiveDirectoryIdentityProvider) {
+				upstream.Spec.DNSDiscovery = &v1alpha1.ActiveDirectoryIdentityProviderDNSDiscovery{Domain: testDomain}
+			})},
+			inputSecrets: []runtime.Object{validBindUserSecret("4242")},
+			wantErr:      controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingCache: []*upstreamldap.ProviderConfig{providerConfigWithHosts(func(config *upstreamldap.ProviderConfig) {
+				config.Host = ""
+				config.ConnectionProtocol = ""
+			})},
+			wantResultingUpstreams: []v1alpha1.ActiveDirectoryIdentityProvider{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testResourceUID},
+				Status: v1alpha1.ActiveDirectoryIdentityProviderStatus{
+					Phase: "Error",
+					Conditions: []v1alpha1.Condition{
+						bindSecretValidTrueCondition(1234),
+						hostsNotFoundCondition(1234, "must not specify host or hosts when dnsDiscovery is specified"),
+						tlsConfigurationValidLoadedTrueCondition(1234),
+					},
+				},
+			}},
+			wantValidatedSettings: map[string]upstreamwatchers.ValidatedSettings{},
+		},
+		{
+			name: "none of host, hosts, or dnsDiscovery is specified",
+			inputUpstreams: []runtime.Object{editedValidUpstream(func(upstream *v1alpha1.ActiveDirectoryIdentityProvider) {
+				upstream.Spec.Host = ""
+			})},
+			inputSecrets: []runtime.Object{validBindUserSecret("4242")},
+			wantErr:      controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingCache: []*upstreamldap.ProviderConfig{providerConfigWithHosts(func(config *upstreamldap.ProviderConfig) {
+				config.Host = ""
+				config.ConnectionProtocol = ""
+			})},
+			wantResultingUpstreams: []v1alpha1.ActiveDirectoryIdentityProvider{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testResourceUID},
+				Status: v1alpha1.ActiveDirectoryIdentityProviderStatus{
+					Phase: "Error",
+					Conditions: []v1alpha1.Condition{
+						bindSecretValidTrueCondition(1234),
+						hostsNotFoundCondition(1234, "must specify host, hosts, or dnsDiscovery"),
+						tlsConfigurationValidLoadedTrueCondition(1234),
+					},
+				},
+			}},
+			wantValidatedSettings: map[string]upstreamwatchers.ValidatedSettings{},
+		},
 	}
 
 	for _, tt := range tests {
@@ -2026,6 +2217,7 @@ func TestActiveDirectoryUpstreamWatcherControllerSync(t *testing.T) {
 				cache,
 				validatedSettingsCache,
 				dialer,
+				&fakeSRVResolver{records: tt.srvRecords, err: tt.srvError},
 				fakePinnipedClient,
 				pinnipedInformers.IDP().V1alpha1().ActiveDirectoryIdentityProviders(),
 				kubeInformers.Core().V1().Secrets(),
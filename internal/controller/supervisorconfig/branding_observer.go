@@ -0,0 +1,94 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package supervisorconfig
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/labels"
+	corev1informers "k8s.io/client-go/informers/core/v1"
+
+	"go.pinniped.dev/generated/latest/client/supervisor/informers/externalversions/config/v1alpha1"
+	pinnipedcontroller "go.pinniped.dev/internal/controller"
+	"go.pinniped.dev/internal/controllerlib"
+	"go.pinniped.dev/internal/oidc/provider/branding"
+	"go.pinniped.dev/internal/plog"
+)
+
+type brandingObserverController struct {
+	issuerToBrandingSetter   IssuerToBrandingMapSetter
+	configMapInformer        corev1informers.ConfigMapInformer
+	federationDomainInformer v1alpha1.FederationDomainInformer
+}
+
+type IssuerToBrandingMapSetter interface {
+	SetIssuerToBrandingMap(issuerToBrandingMap map[string]*branding.Branding)
+}
+
+// NewBrandingObserverController returns a controller which keeps the branding of each FederationDomain's web pages
+// in sync with the ConfigMap which is named by the FederationDomain.
+func NewBrandingObserverController(
+	issuerToBrandingSetter IssuerToBrandingMapSetter,
+	configMapInformer corev1informers.ConfigMapInformer,
+	federationDomainInformer v1alpha1.FederationDomainInformer,
+	withInformer pinnipedcontroller.WithInformerOptionFunc,
+) controllerlib.Controller {
+	return controllerlib.New(
+		controllerlib.Config{
+			Name: "branding-observer-controller",
+			Syncer: &brandingObserverController{
+				issuerToBrandingSetter:   issuerToBrandingSetter,
+				configMapInformer:        configMapInformer,
+				federationDomainInformer: federationDomainInformer,
+			},
+		},
+		withInformer(
+			configMapInformer,
+			pinnipedcontroller.MatchAnythingFilter(nil),
+			controllerlib.InformerOption{},
+		),
+		withInformer(
+			federationDomainInformer,
+			pinnipedcontroller.MatchAnythingFilter(nil),
+			controllerlib.InformerOption{},
+		),
+	)
+}
+
+func (c *brandingObserverController) Sync(ctx controllerlib.Context) error {
+	ns := ctx.Key.Namespace
+	allProviders, err := c.federationDomainInformer.Lister().FederationDomains(ns).List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("failed to list FederationDomains: %w", err)
+	}
+
+	// Rebuild the whole map on any change to any ConfigMap or FederationDomain, because either can have changes that
+	// can cause the map to need to be updated.
+	issuerToBrandingMap := map[string]*branding.Branding{}
+
+	for _, provider := range allProviders {
+		if provider.Spec.Branding == nil {
+			continue
+		}
+		configMapName := provider.Spec.Branding.ConfigMapName
+		configMap, err := c.configMapInformer.Lister().ConfigMaps(ns).Get(configMapName)
+		if err != nil {
+			plog.Warning("brandingObserverController Sync could not find branding ConfigMap, so the default branding will be used",
+				"namespace", ns, "federationDomain", provider.Name, "configMapName", configMapName, "error", err.Error())
+			continue
+		}
+		b, err := branding.FromConfigMapData(configMap.Data, configMap.BinaryData)
+		if err != nil {
+			plog.Warning("brandingObserverController Sync found an invalid branding ConfigMap, so the default branding will be used",
+				"namespace", ns, "federationDomain", provider.Name, "configMapName", configMapName, "error", err.Error())
+			continue
+		}
+		issuerToBrandingMap[provider.Spec.Issuer] = b
+	}
+
+	plog.Debug("brandingObserverController Sync updated the branding cache", "issuerCount", len(issuerToBrandingMap))
+	c.issuerToBrandingSetter.SetIssuerToBrandingMap(issuerToBrandingMap)
+
+	return nil
+}
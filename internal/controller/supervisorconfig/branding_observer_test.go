@@ -0,0 +1,176 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package supervisorconfig
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubeinformers "k8s.io/client-go/informers"
+	kubernetesfake "k8s.io/client-go/kubernetes/fake"
+
+	"go.pinniped.dev/generated/latest/apis/supervisor/config/v1alpha1"
+	pinnipedfake "go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned/fake"
+	pinnipedinformers "go.pinniped.dev/generated/latest/client/supervisor/informers/externalversions"
+	"go.pinniped.dev/internal/controllerlib"
+	"go.pinniped.dev/internal/oidc/provider/branding"
+	"go.pinniped.dev/internal/testutil"
+)
+
+func TestBrandingObserverControllerInformerFilters(t *testing.T) {
+	observableWithInformerOption := testutil.NewObservableWithInformerOption()
+	configMapInformer := kubeinformers.NewSharedInformerFactory(nil, 0).Core().V1().ConfigMaps()
+	federationDomainInformer := pinnipedinformers.NewSharedInformerFactory(nil, 0).Config().V1alpha1().FederationDomains()
+	_ = NewBrandingObserverController(
+		nil,
+		configMapInformer,
+		federationDomainInformer,
+		observableWithInformerOption.WithInformer, // make it possible to observe the behavior of the Filters
+	)
+
+	configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "any-name", Namespace: "any-namespace"}}
+	otherConfigMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "any-other-name", Namespace: "any-namespace"}}
+	configMapFilter := observableWithInformerOption.GetFilterForInformer(configMapInformer)
+	require.True(t, configMapFilter.Add(configMap))
+	require.True(t, configMapFilter.Update(configMap, otherConfigMap))
+	require.True(t, configMapFilter.Delete(configMap))
+
+	provider := &v1alpha1.FederationDomain{ObjectMeta: metav1.ObjectMeta{Name: "any-name", Namespace: "any-namespace"}}
+	otherProvider := &v1alpha1.FederationDomain{ObjectMeta: metav1.ObjectMeta{Name: "any-other-name", Namespace: "any-namespace"}}
+	federationDomainFilter := observableWithInformerOption.GetFilterForInformer(federationDomainInformer)
+	require.True(t, federationDomainFilter.Add(provider))
+	require.True(t, federationDomainFilter.Update(provider, otherProvider))
+	require.True(t, federationDomainFilter.Delete(provider))
+}
+
+type fakeIssuerToBrandingMapSetter struct {
+	setIssuerToBrandingMapWasCalled bool
+	issuerToBrandingMapReceived     map[string]*branding.Branding
+}
+
+func (f *fakeIssuerToBrandingMapSetter) SetIssuerToBrandingMap(issuerToBrandingMap map[string]*branding.Branding) {
+	f.setIssuerToBrandingMapWasCalled = true
+	f.issuerToBrandingMapReceived = issuerToBrandingMap
+}
+
+func TestBrandingObserverControllerSync(t *testing.T) {
+	const installedInNamespace = "some-namespace"
+
+	federationDomain := func(name, issuer, configMapName string) *v1alpha1.FederationDomain {
+		fd := &v1alpha1.FederationDomain{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: installedInNamespace},
+			Spec:       v1alpha1.FederationDomainSpec{Issuer: issuer},
+		}
+		if configMapName != "" {
+			fd.Spec.Branding = &v1alpha1.FederationDomainBrandingSpec{ConfigMapName: configMapName}
+		}
+		return fd
+	}
+	configMap := func(name string, data map[string]string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: installedInNamespace},
+			Data:       data,
+		}
+	}
+
+	tests := []struct {
+		name              string
+		federationDomains []runtime.Object
+		configMaps        []runtime.Object
+		wantTitles        map[string]string
+	}{
+		{
+			name:       "no FederationDomains",
+			wantTitles: map[string]string{},
+		},
+		{
+			name: "FederationDomains with and without branding",
+			federationDomains: []runtime.Object{
+				federationDomain("branded", "https://issuer1.com", "branding1"),
+				federationDomain("other-branded", "https://issuer2.com/path", "branding2"),
+				federationDomain("unbranded", "https://issuer3.com", ""),
+			},
+			configMaps: []runtime.Object{
+				configMap("branding1", map[string]string{"title": "Acme"}),
+				configMap("branding2", map[string]string{"title": "Acme Labs"}),
+				configMap("unrelated", map[string]string{"title": "Unrelated"}),
+			},
+			wantTitles: map[string]string{
+				"https://issuer1.com":      "Acme",
+				"https://issuer2.com/path": "Acme Labs",
+			},
+		},
+		{
+			name: "FederationDomains which share a branding ConfigMap",
+			federationDomains: []runtime.Object{
+				federationDomain("branded", "https://issuer1.com", "branding"),
+				federationDomain("other-branded", "https://issuer2.com", "branding"),
+			},
+			configMaps: []runtime.Object{
+				configMap("branding", map[string]string{"title": "Acme"}),
+			},
+			wantTitles: map[string]string{
+				"https://issuer1.com": "Acme",
+				"https://issuer2.com": "Acme",
+			},
+		},
+		{
+			name: "missing and invalid branding ConfigMaps are skipped",
+			federationDomains: []runtime.Object{
+				federationDomain("branded", "https://issuer1.com", "branding"),
+				federationDomain("missing", "https://issuer2.com", "does-not-exist"),
+				federationDomain("invalid", "https://issuer3.com", "invalid-branding"),
+			},
+			configMaps: []runtime.Object{
+				configMap("branding", map[string]string{"title": "Acme"}),
+				configMap("invalid-branding", map[string]string{"primaryColor": "red"}),
+			},
+			wantTitles: map[string]string{
+				"https://issuer1.com": "Acme",
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			kubeInformers := kubeinformers.NewSharedInformerFactory(kubernetesfake.NewSimpleClientset(tt.configMaps...), 0)
+			pinnipedInformers := pinnipedinformers.NewSharedInformerFactory(pinnipedfake.NewSimpleClientset(tt.federationDomains...), 0)
+			issuerToBrandingSetter := &fakeIssuerToBrandingMapSetter{}
+
+			subject := NewBrandingObserverController(
+				issuerToBrandingSetter,
+				kubeInformers.Core().V1().ConfigMaps(),
+				pinnipedInformers.Config().V1alpha1().FederationDomains(),
+				controllerlib.WithInformer,
+			)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			kubeInformers.Start(ctx.Done())
+			pinnipedInformers.Start(ctx.Done())
+			controllerlib.TestRunSynchronously(t, subject)
+
+			syncCtx := controllerlib.Context{
+				Context: ctx,
+				Name:    subject.Name(),
+				Key:     controllerlib.Key{Namespace: installedInNamespace, Name: "any-name"},
+			}
+			require.NoError(t, controllerlib.TestSync(t, subject, syncCtx))
+
+			require.True(t, issuerToBrandingSetter.setIssuerToBrandingMapWasCalled)
+			actualTitles := map[string]string{}
+			for issuer, b := range issuerToBrandingSetter.issuerToBrandingMapReceived {
+				actualTitles[issuer] = b.Title
+			}
+			require.Equal(t, tt.wantTitles, actualTitles)
+		})
+	}
+}
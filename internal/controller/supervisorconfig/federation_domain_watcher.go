@@ -1,4 +1,4 @@
-// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package supervisorconfig
@@ -8,23 +8,70 @@ import (
 	"fmt"
 	"net/url"
 	"strings"
+	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/util/retry"
 	"k8s.io/klog/v2"
 	"k8s.io/utils/clock"
 
 	configv1alpha1 "go.pinniped.dev/generated/latest/apis/supervisor/config/v1alpha1"
+	idpv1alpha1 "go.pinniped.dev/generated/latest/apis/supervisor/idp/v1alpha1"
+	idpdiscoveryv1alpha1 "go.pinniped.dev/generated/latest/apis/supervisor/idpdiscovery/v1alpha1"
 	pinnipedclientset "go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned"
 	configinformers "go.pinniped.dev/generated/latest/client/supervisor/informers/externalversions/config/v1alpha1"
+	"go.pinniped.dev/internal/celtransformer"
 	pinnipedcontroller "go.pinniped.dev/internal/controller"
 	"go.pinniped.dev/internal/controllerlib"
+	"go.pinniped.dev/internal/groupsuffix"
+	"go.pinniped.dev/internal/idtransform"
+	"go.pinniped.dev/internal/oidc"
 	"go.pinniped.dev/internal/oidc/provider"
 	"go.pinniped.dev/internal/plog"
 )
 
+const (
+	// celTransformerMaxExpressionRuntime limits how long any single identity transformation expression may run
+	// during an authentication or refresh.
+	celTransformerMaxExpressionRuntime = 5 * time.Second
+
+	// minTokenLifetime is the shortest lifetime which may be configured for any token or session. Shorter lifetimes
+	// would not leave clients enough time to use their tokens, given some clock skew between servers.
+	minTokenLifetime = time.Minute
+
+	// minSigningKeyRotationInterval is the shortest interval which may be configured for signing key rotation.
+	minSigningKeyRotationInterval = time.Hour
+
+	// defaultSigningKeyPrePublishPeriod is how long each new signing key is published before it is used, by default.
+	defaultSigningKeyPrePublishPeriod = 24 * time.Hour
+
+	transformsConstantTypeString     = "string"
+	transformsConstantTypeStringList = "stringList"
+
+	transformsExpressionTypePolicy   = "policy/v1"
+	transformsExpressionTypeUsername = "username/v1"
+	transformsExpressionTypeGroups   = "groups/v1"
+
+	kindOIDCIdentityProvider            = "OIDCIdentityProvider"
+	kindLDAPIdentityProvider            = "LDAPIdentityProvider"
+	kindActiveDirectoryIdentityProvider = "ActiveDirectoryIdentityProvider"
+	kindSAMLIdentityProvider            = "SAMLIdentityProvider"
+	kindGitHubIdentityProvider          = "GitHubIdentityProvider"
+)
+
+// idpTypesByKind maps the kinds of the identity provider resources to their types, as used by the
+// Supervisor's identity provider discovery endpoint and by the pinniped_idp_type authorize param.
+var idpTypesByKind = map[string]idpdiscoveryv1alpha1.IDPType{ //nolint:gochecknoglobals
+	kindOIDCIdentityProvider:            idpdiscoveryv1alpha1.IDPTypeOIDC,
+	kindLDAPIdentityProvider:            idpdiscoveryv1alpha1.IDPTypeLDAP,
+	kindActiveDirectoryIdentityProvider: idpdiscoveryv1alpha1.IDPTypeActiveDirectory,
+	kindSAMLIdentityProvider:            idpdiscoveryv1alpha1.IDPTypeSAML,
+	kindGitHubIdentityProvider:          idpdiscoveryv1alpha1.IDPTypeGitHub,
+}
+
 // ProvidersSetter can be notified of all known valid providers with its SetIssuer function.
 // If there are no longer any valid issuers, then it can be called with no arguments.
 // Implementations of this type should be thread-safe to support calls from multiple goroutines.
@@ -34,15 +81,24 @@ type ProvidersSetter interface {
 
 type federationDomainWatcherController struct {
 	providerSetter           ProvidersSetter
+	idpAPIGroup              string
 	clock                    clock.Clock
 	client                   pinnipedclientset.Interface
 	federationDomainInformer configinformers.FederationDomainInformer
+
+	// secretRotationGracePeriod is how long the previous symmetric keys are still accepted after they were rotated,
+	// or zero when the keys are never rotated.
+	secretRotationGracePeriod time.Duration
 }
 
 // NewFederationDomainWatcherController creates a controllerlib.Controller that watches
 // FederationDomain objects and notifies a callback object of the collection of provider configs.
+// The apiGroupSuffix is used to validate the API group of the identity providers referenced by the FederationDomains.
+// The secretRotationGracePeriod is only used to warn about refresh token lifetimes which are longer than it.
 func NewFederationDomainWatcherController(
 	providerSetter ProvidersSetter,
+	apiGroupSuffix string,
+	secretRotationGracePeriod time.Duration,
 	clock clock.Clock,
 	client pinnipedclientset.Interface,
 	federationDomainInformer configinformers.FederationDomainInformer,
@@ -52,10 +108,12 @@ func NewFederationDomainWatcherController(
 		controllerlib.Config{
 			Name: "FederationDomainWatcherController",
 			Syncer: &federationDomainWatcherController{
-				providerSetter:           providerSetter,
-				clock:                    clock,
-				client:                   client,
-				federationDomainInformer: federationDomainInformer,
+				providerSetter:            providerSetter,
+				idpAPIGroup:               idpAPIGroup(apiGroupSuffix),
+				clock:                     clock,
+				client:                    client,
+				federationDomainInformer:  federationDomainInformer,
+				secretRotationGracePeriod: secretRotationGracePeriod,
 			},
 		},
 		withInformer(
@@ -107,6 +165,11 @@ func (c *federationDomainWatcherController) Sync(ctx controllerlib.Context) erro
 		}
 	}
 
+	celTransformer, err := celtransformer.NewCELTransformer(celTransformerMaxExpressionRuntime)
+	if err != nil {
+		return fmt.Errorf("could not initialize CEL transformer: %w", err)
+	}
+
 	var errs []error
 
 	federationDomainIssuers := make([]*provider.FederationDomainIssuer, 0)
@@ -143,7 +206,48 @@ func (c *federationDomainWatcherController) Sync(ctx controllerlib.Context) erro
 			continue
 		}
 
-		federationDomainIssuer, err := provider.NewFederationDomainIssuer(federationDomain.Spec.Issuer) // This validates the Issuer URL.
+		identityProviders, err := c.validateIdentityProviders(federationDomain.Spec.IdentityProviders, celTransformer)
+		if err != nil {
+			if err := c.updateStatus(
+				ctx.Context,
+				federationDomain.Namespace,
+				federationDomain.Name,
+				configv1alpha1.InvalidFederationDomainStatusCondition,
+				"Invalid: "+err.Error(),
+			); err != nil {
+				errs = append(errs, fmt.Errorf("could not update status: %w", err))
+			}
+			continue
+		}
+
+		var idTokenSigningAlgorithms []string
+		var clientCredentialsTransforms *idtransform.TransformationPipeline
+		tokenLifetimes, err := validateTokenLifetimes(federationDomain.Spec.TokenLifetimes)
+		if err == nil {
+			// The rotation settings are used by the JWKS writer controller, so only validate them here.
+			_, _, err = validateSigningKeyRotation(federationDomain.Spec.SigningKeyRotation)
+		}
+		if err == nil {
+			idTokenSigningAlgorithms, err = validateIDTokenSigningAlgorithms(federationDomain.Spec.IDTokenSigningAlgorithms)
+		}
+		if err == nil {
+			clientCredentialsTransforms, err = compileClientCredentialsTransforms(federationDomain.Spec.ClientCredentialsTransforms, celTransformer)
+		}
+		if err != nil {
+			if err := c.updateStatus(
+				ctx.Context,
+				federationDomain.Namespace,
+				federationDomain.Name,
+				configv1alpha1.InvalidFederationDomainStatusCondition,
+				"Invalid: "+err.Error(),
+			); err != nil {
+				errs = append(errs, fmt.Errorf("could not update status: %w", err))
+			}
+			continue
+		}
+
+		federationDomainIssuer, err := provider.NewFederationDomainIssuer( // This validates the Issuer URL.
+			federationDomain.Spec.Issuer, identityProviders, tokenLifetimes, idTokenSigningAlgorithms, clientCredentialsTransforms)
 		if err != nil {
 			if err := c.updateStatus(
 				ctx.Context,
@@ -168,6 +272,8 @@ func (c *federationDomainWatcherController) Sync(ctx controllerlib.Context) erro
 			continue
 		}
 
+		c.maybeWarnAboutRefreshTokenLifetime(federationDomain, tokenLifetimes)
+
 		federationDomainIssuers = append(federationDomainIssuers, federationDomainIssuer)
 	}
 
@@ -176,6 +282,252 @@ func (c *federationDomainWatcherController) Sync(ctx controllerlib.Context) erro
 	return errors.NewAggregate(errs)
 }
 
+// validateIdentityProviders validates the identity providers listed in a FederationDomain's spec and converts them
+// into their internal representation, including compiling their identity transformations. It does not check whether
+// the referenced identity providers currently exist, since they may be created or deleted at any time.
+func (c *federationDomainWatcherController) validateIdentityProviders(
+	identityProviders []configv1alpha1.FederationDomainIdentityProvider,
+	celTransformer *celtransformer.CELTransformer,
+) ([]*provider.FederationDomainIdentityProvider, error) {
+	type idpKey struct {
+		name    string
+		idpType idpdiscoveryv1alpha1.IDPType
+	}
+	var result []*provider.FederationDomainIdentityProvider
+	seen := make(map[idpKey]bool)
+
+	for i, idp := range identityProviders {
+		ref := idp.ObjectRef
+
+		if ref.APIGroup == nil || *ref.APIGroup != c.idpAPIGroup {
+			return nil, fmt.Errorf("identityProviders[%d].objectRef.apiGroup must be %q", i, c.idpAPIGroup)
+		}
+
+		idpType, ok := idpTypesByKind[ref.Kind]
+		if !ok {
+			return nil, fmt.Errorf("identityProviders[%d].objectRef.kind %q is not one of %q, %q, %q, %q, or %q", i, ref.Kind,
+				kindOIDCIdentityProvider, kindLDAPIdentityProvider, kindActiveDirectoryIdentityProvider, kindSAMLIdentityProvider,
+				kindGitHubIdentityProvider)
+		}
+
+		if ref.Name == "" {
+			return nil, fmt.Errorf("identityProviders[%d].objectRef.name must not be empty", i)
+		}
+
+		key := idpKey{name: ref.Name, idpType: idpType}
+		if seen[key] {
+			return nil, fmt.Errorf("identityProviders[%d] is a duplicate reference to %s %q", i, ref.Kind, ref.Name)
+		}
+		seen[key] = true
+
+		transforms, err := compileTransforms(idp.Transforms, celTransformer)
+		if err != nil {
+			return nil, fmt.Errorf("identityProviders[%d].transforms.%w", i, err)
+		}
+
+		result = append(result, &provider.FederationDomainIdentityProvider{
+			Name:       ref.Name,
+			Type:       idpType,
+			Transforms: transforms,
+		})
+	}
+
+	return result, nil
+}
+
+// maybeWarnAboutRefreshTokenLifetime logs a warning when the FederationDomain's refresh tokens live longer than the
+// grace period of the secret rotation, because the refresh tokens which were signed by a previous key stop working
+// when its grace period ends.
+func (c *federationDomainWatcherController) maybeWarnAboutRefreshTokenLifetime(
+	federationDomain *configv1alpha1.FederationDomain,
+	tokenLifetimes *provider.FederationDomainTokenLifetimes,
+) {
+	if c.secretRotationGracePeriod == 0 {
+		return
+	}
+	refreshTokenLifetime := oidc.TimeoutsConfigurationForTokenLifetimes(tokenLifetimes).RefreshTokenLifespan
+	if refreshTokenLifetime > c.secretRotationGracePeriod {
+		plog.Warning("FederationDomain refresh token lifetime is longer than the secretRotation gracePeriod, "+
+			"so some refresh tokens will stop working before they expire",
+			"federationDomain", klog.KObj(federationDomain),
+			"refreshTokenLifetime", refreshTokenLifetime.String(),
+			"gracePeriod", c.secretRotationGracePeriod.String())
+	}
+}
+
+// validateTokenLifetimes validates the token lifetimes in a FederationDomain's spec and converts them into their
+// internal representation. It returns nil when the spec does not configure any token lifetimes.
+func validateTokenLifetimes(tokenLifetimes *configv1alpha1.FederationDomainTokenLifetimes) (*provider.FederationDomainTokenLifetimes, error) {
+	if tokenLifetimes == nil {
+		return nil, nil
+	}
+
+	result := &provider.FederationDomainTokenLifetimes{}
+	for _, field := range []struct {
+		name     string
+		value    *metav1.Duration
+		internal *time.Duration
+	}{
+		{name: "accessToken", value: tokenLifetimes.AccessToken, internal: &result.AccessToken},
+		{name: "idToken", value: tokenLifetimes.IDToken, internal: &result.IDToken},
+		{name: "refreshToken", value: tokenLifetimes.RefreshToken, internal: &result.RefreshToken},
+		{name: "maxSession", value: tokenLifetimes.MaxSession, internal: &result.MaxSession},
+	} {
+		if field.value == nil {
+			continue
+		}
+		if field.value.Duration < minTokenLifetime {
+			return nil, fmt.Errorf("tokenLifetimes.%s must be at least %s", field.name, minTokenLifetime)
+		}
+		*field.internal = field.value.Duration
+	}
+
+	// Compare the lifetimes which will actually be used, since any of them may have been left as the default.
+	timeouts := oidc.TimeoutsConfigurationForTokenLifetimes(result)
+	if timeouts.AccessTokenLifespan > timeouts.RefreshTokenLifespan {
+		return nil, fmt.Errorf("tokenLifetimes.accessToken (%s) must not be longer than tokenLifetimes.refreshToken (%s)",
+			timeouts.AccessTokenLifespan, timeouts.RefreshTokenLifespan)
+	}
+	if timeouts.IDTokenLifespan > timeouts.RefreshTokenLifespan {
+		return nil, fmt.Errorf("tokenLifetimes.idToken (%s) must not be longer than tokenLifetimes.refreshToken (%s)",
+			timeouts.IDTokenLifespan, timeouts.RefreshTokenLifespan)
+	}
+
+	return result, nil
+}
+
+// validateSigningKeyRotation validates the signing key rotation settings in a FederationDomain's spec, and returns
+// the rotation interval and the pre-publish period, including any defaulting. It returns a zero interval when the
+// spec does not configure signing key rotation.
+func validateSigningKeyRotation(rotation *configv1alpha1.FederationDomainSigningKeyRotation) (time.Duration, time.Duration, error) {
+	if rotation == nil {
+		return 0, 0, nil
+	}
+
+	interval := rotation.Interval.Duration
+	if interval < minSigningKeyRotationInterval {
+		return 0, 0, fmt.Errorf("signingKeyRotation.interval must be at least %s", minSigningKeyRotationInterval)
+	}
+
+	prePublishPeriod := defaultSigningKeyPrePublishPeriod
+	if rotation.PrePublishPeriod != nil {
+		prePublishPeriod = rotation.PrePublishPeriod.Duration
+		if prePublishPeriod < 0 {
+			return 0, 0, fmt.Errorf("signingKeyRotation.prePublishPeriod must not be negative")
+		}
+	}
+
+	if prePublishPeriod >= interval {
+		return 0, 0, fmt.Errorf("signingKeyRotation.prePublishPeriod (%s) must be shorter than signingKeyRotation.interval (%s)",
+			prePublishPeriod, interval)
+	}
+
+	return interval, prePublishPeriod, nil
+}
+
+// validateIDTokenSigningAlgorithms validates the ID token signing algorithms in a FederationDomain's spec and
+// converts them into strings. It returns an empty list when the spec does not configure any algorithms, which
+// means that the default algorithm should be used.
+func validateIDTokenSigningAlgorithms(algorithms []configv1alpha1.SigningAlgorithm) ([]string, error) {
+	if len(algorithms) == 0 {
+		return nil, nil
+	}
+
+	result := make([]string, 0, len(algorithms))
+	seen := sets.NewString()
+	for _, algorithm := range algorithms {
+		if !isSupportedIDTokenSigningAlgorithm(string(algorithm)) {
+			return nil, fmt.Errorf("idTokenSigningAlgorithms contains unsupported algorithm %q", algorithm)
+		}
+		if seen.Has(string(algorithm)) {
+			return nil, fmt.Errorf("idTokenSigningAlgorithms contains duplicate algorithm %q", algorithm)
+		}
+		seen.Insert(string(algorithm))
+		result = append(result, string(algorithm))
+	}
+	return result, nil
+}
+
+// compileClientCredentialsTransforms compiles the transforms which are applied to the identities of clients which use
+// the client_credentials grant. It returns nil when the FederationDomain does not configure any such transforms.
+func compileClientCredentialsTransforms(
+	transforms configv1alpha1.FederationDomainTransforms,
+	celTransformer *celtransformer.CELTransformer,
+) (*idtransform.TransformationPipeline, error) {
+	if len(transforms.Constants) == 0 && len(transforms.Expressions) == 0 {
+		return nil, nil
+	}
+	pipeline, err := compileTransforms(transforms, celTransformer)
+	if err != nil {
+		return nil, fmt.Errorf("clientCredentialsTransforms.%w", err)
+	}
+	return pipeline, nil
+}
+
+// compileTransforms compiles the constants and expressions of an identity provider's transforms into
+// a transformation pipeline. The returned errors start with the path of the invalid field, relative to
+// the transforms field, so the caller can prefix them with the path of the transforms field.
+func compileTransforms(
+	transforms configv1alpha1.FederationDomainTransforms,
+	celTransformer *celtransformer.CELTransformer,
+) (*idtransform.TransformationPipeline, error) {
+	consts := &celtransformer.TransformationConstants{
+		StringConstants:     map[string]string{},
+		StringListConstants: map[string][]string{},
+	}
+	constNames := make(map[string]bool)
+
+	for i, constant := range transforms.Constants {
+		if constNames[constant.Name] {
+			return nil, fmt.Errorf("constants[%d].name %q is a duplicate name", i, constant.Name)
+		}
+		constNames[constant.Name] = true
+
+		switch constant.Type {
+		case transformsConstantTypeString:
+			consts.StringConstants[constant.Name] = constant.StringValue
+		case transformsConstantTypeStringList:
+			consts.StringListConstants[constant.Name] = constant.StringListValue
+		default:
+			return nil, fmt.Errorf("constants[%d].type %q is not one of %q or %q", i, constant.Type,
+				transformsConstantTypeString, transformsConstantTypeStringList)
+		}
+	}
+
+	pipeline := idtransform.NewTransformationPipeline()
+
+	for i, expression := range transforms.Expressions {
+		var rawTransform celtransformer.CELTransformation
+		switch expression.Type {
+		case transformsExpressionTypePolicy:
+			rawTransform = &celtransformer.AllowAuthenticationPolicy{
+				Expression:                    expression.Expression,
+				RejectedAuthenticationMessage: expression.Message,
+			}
+		case transformsExpressionTypeUsername:
+			rawTransform = &celtransformer.UsernameTransformation{Expression: expression.Expression}
+		case transformsExpressionTypeGroups:
+			rawTransform = &celtransformer.GroupsTransformation{Expression: expression.Expression}
+		default:
+			return nil, fmt.Errorf("expressions[%d].type %q is not one of %q, %q, or %q", i, expression.Type,
+				transformsExpressionTypePolicy, transformsExpressionTypeUsername, transformsExpressionTypeGroups)
+		}
+
+		compiledTransform, err := celTransformer.CompileTransformation(rawTransform, consts)
+		if err != nil {
+			return nil, fmt.Errorf("expressions[%d].expression is invalid: %w", i, err)
+		}
+		pipeline.AppendTransformation(compiledTransform)
+	}
+
+	return pipeline, nil
+}
+
+func idpAPIGroup(apiGroupSuffix string) string {
+	group, _ := groupsuffix.Replace(idpv1alpha1.SchemeGroupVersion.Group, apiGroupSuffix)
+	return group
+}
+
 func (c *federationDomainWatcherController) updateStatus(
 	ctx context.Context,
 	namespace, name string,
@@ -1,4 +1,4 @@
-// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package supervisorconfig
@@ -16,18 +16,22 @@ import (
 	"github.com/sclevine/spec"
 	"github.com/sclevine/spec/report"
 	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	coretesting "k8s.io/client-go/testing"
 	clocktesting "k8s.io/utils/clock/testing"
+	"k8s.io/utils/pointer"
 
 	"go.pinniped.dev/generated/latest/apis/supervisor/config/v1alpha1"
+	idpdiscoveryv1alpha1 "go.pinniped.dev/generated/latest/apis/supervisor/idpdiscovery/v1alpha1"
 	pinnipedfake "go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned/fake"
 	pinnipedinformers "go.pinniped.dev/generated/latest/client/supervisor/informers/externalversions"
 	"go.pinniped.dev/internal/controllerlib"
 	"go.pinniped.dev/internal/here"
+	"go.pinniped.dev/internal/idtransform"
 	"go.pinniped.dev/internal/oidc/provider"
 	"go.pinniped.dev/internal/testutil"
 )
@@ -44,6 +48,8 @@ func TestInformerFilters(t *testing.T) {
 			federationDomainInformer := pinnipedinformers.NewSharedInformerFactoryWithOptions(nil, 0).Config().V1alpha1().FederationDomains()
 			_ = NewFederationDomainWatcherController(
 				nil,
+				"",
+				0,
 				nil,
 				nil,
 				federationDomainInformer,
@@ -109,6 +115,7 @@ func TestSync(t *testing.T) {
 		var frozenNow time.Time
 		var providersSetter *fakeProvidersSetter
 		var federationDomainGVR schema.GroupVersionResource
+		var secretRotationGracePeriod time.Duration
 
 		// Defer starting the informers until the last possible moment so that the
 		// nested Before's can keep adding things to the informer caches.
@@ -116,6 +123,8 @@ func TestSync(t *testing.T) {
 			// Set this at the last second to allow for injection of server override.
 			subject = NewFederationDomainWatcherController(
 				providersSetter,
+				"custom.suffix.com",
+				secretRotationGracePeriod,
 				clocktesting.NewFakeClock(frozenNow),
 				pinnipedAPIClient,
 				federationDomainInformers.Config().V1alpha1().FederationDomains(),
@@ -142,6 +151,7 @@ func TestSync(t *testing.T) {
 
 			providersSetter = &fakeProvidersSetter{}
 			frozenNow = time.Date(2020, time.September, 23, 7, 42, 0, 0, time.Local)
+			secretRotationGracePeriod = 0
 
 			cancelContext, cancelContextCancelFunc = context.WithCancel(context.Background())
 
@@ -187,10 +197,10 @@ func TestSync(t *testing.T) {
 				err := controllerlib.TestSync(t, subject, *syncContext)
 				r.NoError(err)
 
-				provider1, err := provider.NewFederationDomainIssuer(federationDomain1.Spec.Issuer)
+				provider1, err := provider.NewFederationDomainIssuer(federationDomain1.Spec.Issuer, nil, nil, nil, nil)
 				r.NoError(err)
 
-				provider2, err := provider.NewFederationDomainIssuer(federationDomain2.Spec.Issuer)
+				provider2, err := provider.NewFederationDomainIssuer(federationDomain2.Spec.Issuer, nil, nil, nil, nil)
 				r.NoError(err)
 
 				r.True(providersSetter.SetProvidersWasCalled)
@@ -288,10 +298,10 @@ func TestSync(t *testing.T) {
 					err := controllerlib.TestSync(t, subject, *syncContext)
 					r.NoError(err)
 
-					provider1, err := provider.NewFederationDomainIssuer(federationDomain1.Spec.Issuer)
+					provider1, err := provider.NewFederationDomainIssuer(federationDomain1.Spec.Issuer, nil, nil, nil, nil)
 					r.NoError(err)
 
-					provider2, err := provider.NewFederationDomainIssuer(federationDomain2.Spec.Issuer)
+					provider2, err := provider.NewFederationDomainIssuer(federationDomain2.Spec.Issuer, nil, nil, nil, nil)
 					r.NoError(err)
 
 					r.True(providersSetter.SetProvidersWasCalled)
@@ -326,10 +336,10 @@ func TestSync(t *testing.T) {
 					err := controllerlib.TestSync(t, subject, *syncContext)
 					r.EqualError(err, "could not update status: some update error")
 
-					provider1, err := provider.NewFederationDomainIssuer(federationDomain1.Spec.Issuer)
+					provider1, err := provider.NewFederationDomainIssuer(federationDomain1.Spec.Issuer, nil, nil, nil, nil)
 					r.NoError(err)
 
-					provider2, err := provider.NewFederationDomainIssuer(federationDomain2.Spec.Issuer)
+					provider2, err := provider.NewFederationDomainIssuer(federationDomain2.Spec.Issuer, nil, nil, nil, nil)
 					r.NoError(err)
 
 					r.True(providersSetter.SetProvidersWasCalled)
@@ -518,6 +528,551 @@ func TestSync(t *testing.T) {
 			})
 		})
 
+		when("there are FederationDomains with identity providers in the informer", func() {
+			var (
+				validFederationDomain   *v1alpha1.FederationDomain
+				invalidFederationDomain *v1alpha1.FederationDomain
+			)
+
+			it.Before(func() {
+				validFederationDomain = &v1alpha1.FederationDomain{
+					ObjectMeta: metav1.ObjectMeta{Name: "valid-config", Namespace: namespace},
+					Spec: v1alpha1.FederationDomainSpec{
+						Issuer: "https://valid-issuer.com",
+						IdentityProviders: []v1alpha1.FederationDomainIdentityProvider{
+							{
+								ObjectRef: corev1.TypedLocalObjectReference{APIGroup: pointer.String("idp.supervisor.custom.suffix.com"), Kind: "OIDCIdentityProvider", Name: "some-oidc-idp"},
+								Transforms: v1alpha1.FederationDomainTransforms{
+									Constants: []v1alpha1.FederationDomainTransformsConstant{
+										{Name: "prefix", Type: "string", StringValue: "okta:"},
+										{Name: "allowed", Type: "stringList", StringListValue: []string{"admins", "developers"}},
+									},
+									Expressions: []v1alpha1.FederationDomainTransformsExpression{
+										{Type: "policy/v1", Expression: `groups.exists(g, g in strListConst.allowed)`, Message: "only admins and developers"},
+										{Type: "username/v1", Expression: `username.split("@")[0]`},
+										{Type: "groups/v1", Expression: `groups.filter(g, !g.startsWith("noisy-")).map(g, strConst.prefix + g)`},
+									},
+								},
+							},
+							{ObjectRef: corev1.TypedLocalObjectReference{APIGroup: pointer.String("idp.supervisor.custom.suffix.com"), Kind: "LDAPIdentityProvider", Name: "some-ldap-idp"}},
+							{ObjectRef: corev1.TypedLocalObjectReference{APIGroup: pointer.String("idp.supervisor.custom.suffix.com"), Kind: "ActiveDirectoryIdentityProvider", Name: "some-ldap-idp"}},
+						},
+					},
+				}
+				r.NoError(pinnipedAPIClient.Tracker().Add(validFederationDomain))
+				r.NoError(federationDomainInformerClient.Tracker().Add(validFederationDomain))
+			})
+
+			it("calls the ProvidersSetter with the identity providers of the valid provider", func() {
+				startInformersAndController()
+				err := controllerlib.TestSync(t, subject, *syncContext)
+				r.NoError(err)
+
+				r.True(providersSetter.SetProvidersWasCalled)
+				r.Len(providersSetter.FederationDomainsReceived, 1)
+				r.Equal(validFederationDomain.Spec.Issuer, providersSetter.FederationDomainsReceived[0].Issuer())
+
+				identityProviders := providersSetter.FederationDomainsReceived[0].IdentityProviders()
+				r.Len(identityProviders, 3)
+				r.Equal("some-oidc-idp", identityProviders[0].Name)
+				r.Equal(idpdiscoveryv1alpha1.IDPTypeOIDC, identityProviders[0].Type)
+				r.Equal("some-ldap-idp", identityProviders[1].Name)
+				r.Equal(idpdiscoveryv1alpha1.IDPTypeLDAP, identityProviders[1].Type)
+				r.Equal("some-ldap-idp", identityProviders[2].Name)
+				r.Equal(idpdiscoveryv1alpha1.IDPTypeActiveDirectory, identityProviders[2].Type)
+
+				// The compiled transforms of the OIDC identity provider should apply its policy and transformations.
+				result, err := identityProviders[0].Transforms.Evaluate(context.Background(),
+					"ryan@example.com", []string{"admins", "noisy-group", "other"})
+				r.NoError(err)
+				r.Equal(&idtransform.TransformationResult{
+					Username:              "ryan",
+					Groups:                []string{"okta:admins", "okta:other"},
+					AuthenticationAllowed: true,
+				}, result)
+
+				result, err = identityProviders[0].Transforms.Evaluate(context.Background(), "ryan@example.com", []string{"other"})
+				r.NoError(err)
+				r.Equal(&idtransform.TransformationResult{
+					Username:                      "ryan@example.com",
+					Groups:                        []string{"other"},
+					AuthenticationAllowed:         false,
+					RejectedAuthenticationMessage: "only admins and developers",
+				}, result)
+
+				// The identity providers without transforms should not change the identity.
+				for _, idp := range identityProviders[1:] {
+					result, err = idp.Transforms.Evaluate(context.Background(), "ryan@example.com", []string{"other"})
+					r.NoError(err)
+					r.Equal(&idtransform.TransformationResult{
+						Username:              "ryan@example.com",
+						Groups:                []string{"other"},
+						AuthenticationAllowed: true,
+					}, result)
+				}
+			})
+
+			for _, test := range []struct {
+				name              string
+				identityProviders []v1alpha1.FederationDomainIdentityProvider
+				wantMessage       string
+			}{
+				{
+					name: "wrong api group",
+					identityProviders: []v1alpha1.FederationDomainIdentityProvider{
+						{ObjectRef: corev1.TypedLocalObjectReference{APIGroup: pointer.String("idp.supervisor.pinniped.dev"), Kind: "OIDCIdentityProvider", Name: "some-oidc-idp"}},
+					},
+					wantMessage: `Invalid: identityProviders[0].objectRef.apiGroup must be "idp.supervisor.custom.suffix.com"`,
+				},
+				{
+					name: "missing api group",
+					identityProviders: []v1alpha1.FederationDomainIdentityProvider{
+						{ObjectRef: corev1.TypedLocalObjectReference{Kind: "OIDCIdentityProvider", Name: "some-oidc-idp"}},
+					},
+					wantMessage: `Invalid: identityProviders[0].objectRef.apiGroup must be "idp.supervisor.custom.suffix.com"`,
+				},
+				{
+					name: "unknown kind",
+					identityProviders: []v1alpha1.FederationDomainIdentityProvider{
+						{ObjectRef: corev1.TypedLocalObjectReference{APIGroup: pointer.String("idp.supervisor.custom.suffix.com"), Kind: "OIDCIdentityProvider", Name: "some-oidc-idp"}},
+						{ObjectRef: corev1.TypedLocalObjectReference{APIGroup: pointer.String("idp.supervisor.custom.suffix.com"), Kind: "Secret", Name: "some-secret"}},
+					},
+					wantMessage: `Invalid: identityProviders[1].objectRef.kind "Secret" is not one of "OIDCIdentityProvider", "LDAPIdentityProvider", "ActiveDirectoryIdentityProvider", "SAMLIdentityProvider", or "GitHubIdentityProvider"`,
+				},
+				{
+					name: "empty name",
+					identityProviders: []v1alpha1.FederationDomainIdentityProvider{
+						{ObjectRef: corev1.TypedLocalObjectReference{APIGroup: pointer.String("idp.supervisor.custom.suffix.com"), Kind: "LDAPIdentityProvider"}},
+					},
+					wantMessage: `Invalid: identityProviders[0].objectRef.name must not be empty`,
+				},
+				{
+					name: "duplicate reference",
+					identityProviders: []v1alpha1.FederationDomainIdentityProvider{
+						{ObjectRef: corev1.TypedLocalObjectReference{APIGroup: pointer.String("idp.supervisor.custom.suffix.com"), Kind: "LDAPIdentityProvider", Name: "some-ldap-idp"}},
+						{ObjectRef: corev1.TypedLocalObjectReference{APIGroup: pointer.String("idp.supervisor.custom.suffix.com"), Kind: "LDAPIdentityProvider", Name: "some-ldap-idp"}},
+					},
+					wantMessage: `Invalid: identityProviders[1] is a duplicate reference to LDAPIdentityProvider "some-ldap-idp"`,
+				},
+				{
+					name: "duplicate transforms constant name",
+					identityProviders: []v1alpha1.FederationDomainIdentityProvider{
+						{
+							ObjectRef: corev1.TypedLocalObjectReference{APIGroup: pointer.String("idp.supervisor.custom.suffix.com"), Kind: "LDAPIdentityProvider", Name: "some-ldap-idp"},
+							Transforms: v1alpha1.FederationDomainTransforms{
+								Constants: []v1alpha1.FederationDomainTransformsConstant{
+									{Name: "foo", Type: "string", StringValue: "bar"},
+									{Name: "foo", Type: "stringList", StringListValue: []string{"bar"}},
+								},
+							},
+						},
+					},
+					wantMessage: `Invalid: identityProviders[0].transforms.constants[1].name "foo" is a duplicate name`,
+				},
+				{
+					name: "unknown transforms constant type",
+					identityProviders: []v1alpha1.FederationDomainIdentityProvider{
+						{
+							ObjectRef: corev1.TypedLocalObjectReference{APIGroup: pointer.String("idp.supervisor.custom.suffix.com"), Kind: "LDAPIdentityProvider", Name: "some-ldap-idp"},
+							Transforms: v1alpha1.FederationDomainTransforms{
+								Constants: []v1alpha1.FederationDomainTransformsConstant{
+									{Name: "foo", Type: "int"},
+								},
+							},
+						},
+					},
+					wantMessage: `Invalid: identityProviders[0].transforms.constants[0].type "int" is not one of "string" or "stringList"`,
+				},
+				{
+					name: "unknown transforms expression type",
+					identityProviders: []v1alpha1.FederationDomainIdentityProvider{
+						{
+							ObjectRef: corev1.TypedLocalObjectReference{APIGroup: pointer.String("idp.supervisor.custom.suffix.com"), Kind: "LDAPIdentityProvider", Name: "some-ldap-idp"},
+							Transforms: v1alpha1.FederationDomainTransforms{
+								Expressions: []v1alpha1.FederationDomainTransformsExpression{
+									{Type: "username/v2", Expression: "username"},
+								},
+							},
+						},
+					},
+					wantMessage: `Invalid: identityProviders[0].transforms.expressions[0].type "username/v2" is not one of "policy/v1", "username/v1", or "groups/v1"`,
+				},
+				{
+					name: "transforms expression compile error",
+					identityProviders: []v1alpha1.FederationDomainIdentityProvider{
+						{ObjectRef: corev1.TypedLocalObjectReference{APIGroup: pointer.String("idp.supervisor.custom.suffix.com"), Kind: "OIDCIdentityProvider", Name: "some-oidc-idp"}},
+						{
+							ObjectRef: corev1.TypedLocalObjectReference{APIGroup: pointer.String("idp.supervisor.custom.suffix.com"), Kind: "LDAPIdentityProvider", Name: "some-ldap-idp"},
+							Transforms: v1alpha1.FederationDomainTransforms{
+								Expressions: []v1alpha1.FederationDomainTransformsExpression{
+									{Type: "username/v1", Expression: "username"},
+									{Type: "groups/v1", Expression: "username"},
+								},
+							},
+						},
+					},
+					wantMessage: `Invalid: identityProviders[1].transforms.expressions[1].expression is invalid: CEL expression should return type "list(string)" but returns type "string"`,
+				},
+				{
+					name: "transforms expression syntax error",
+					identityProviders: []v1alpha1.FederationDomainIdentityProvider{
+						{
+							ObjectRef: corev1.TypedLocalObjectReference{APIGroup: pointer.String("idp.supervisor.custom.suffix.com"), Kind: "LDAPIdentityProvider", Name: "some-ldap-idp"},
+							Transforms: v1alpha1.FederationDomainTransforms{
+								Expressions: []v1alpha1.FederationDomainTransformsExpression{
+									{Type: "policy/v1", Expression: "username =="},
+								},
+							},
+						},
+					},
+					wantMessage: "Invalid: identityProviders[0].transforms.expressions[0].expression is invalid: CEL expression compile error: ERROR: <input>:1:12: Syntax error: mismatched input '<EOF>' expecting {'[', '{', '(', '.', '-', '!', 'true', 'false', 'null', NUM_FLOAT, NUM_INT, NUM_UINT, STRING, BYTES, IDENTIFIER}\n | username ==\n | ...........^",
+				},
+			} {
+				test := test
+				when("one FederationDomain has invalid identity providers: "+test.name, func() {
+					it.Before(func() {
+						invalidFederationDomain = &v1alpha1.FederationDomain{
+							ObjectMeta: metav1.ObjectMeta{Name: "invalid-config", Namespace: namespace},
+							Spec: v1alpha1.FederationDomainSpec{
+								Issuer:            "https://invalid-issuer.com",
+								IdentityProviders: test.identityProviders,
+							},
+						}
+						r.NoError(pinnipedAPIClient.Tracker().Add(invalidFederationDomain))
+						r.NoError(federationDomainInformerClient.Tracker().Add(invalidFederationDomain))
+					})
+
+					it("calls the ProvidersSetter with only the valid provider and updates the status of the invalid provider", func() {
+						startInformersAndController()
+						err := controllerlib.TestSync(t, subject, *syncContext)
+						r.NoError(err)
+
+						r.True(providersSetter.SetProvidersWasCalled)
+						r.Len(providersSetter.FederationDomainsReceived, 1)
+						r.Equal(validFederationDomain.Spec.Issuer, providersSetter.FederationDomainsReceived[0].Issuer())
+
+						invalidFederationDomain.Status.Status = v1alpha1.InvalidFederationDomainStatusCondition
+						invalidFederationDomain.Status.Message = test.wantMessage
+						invalidFederationDomain.Status.LastUpdateTime = timePtr(metav1.NewTime(frozenNow))
+
+						r.Contains(pinnipedAPIClient.Actions(), coretesting.NewUpdateSubresourceAction(
+							federationDomainGVR,
+							"status",
+							invalidFederationDomain.Namespace,
+							invalidFederationDomain,
+						))
+					})
+				})
+			}
+		})
+
+		when("there are FederationDomains with token lifetimes and signing key rotation in the informer", func() {
+			var (
+				validFederationDomain   *v1alpha1.FederationDomain
+				invalidFederationDomain *v1alpha1.FederationDomain
+			)
+
+			it.Before(func() {
+				validFederationDomain = &v1alpha1.FederationDomain{
+					ObjectMeta: metav1.ObjectMeta{Name: "valid-config", Namespace: namespace},
+					Spec: v1alpha1.FederationDomainSpec{
+						Issuer: "https://valid-issuer.com",
+						TokenLifetimes: &v1alpha1.FederationDomainTokenLifetimes{
+							AccessToken:  &metav1.Duration{Duration: 5 * time.Minute},
+							RefreshToken: &metav1.Duration{Duration: 4 * time.Hour},
+							MaxSession:   &metav1.Duration{Duration: 8 * time.Hour},
+						},
+						SigningKeyRotation: &v1alpha1.FederationDomainSigningKeyRotation{
+							Interval: metav1.Duration{Duration: 30 * 24 * time.Hour},
+						},
+						IDTokenSigningAlgorithms: []v1alpha1.SigningAlgorithm{"RS256", "ES256"},
+					},
+				}
+				r.NoError(pinnipedAPIClient.Tracker().Add(validFederationDomain))
+				r.NoError(federationDomainInformerClient.Tracker().Add(validFederationDomain))
+			})
+
+			it("calls the ProvidersSetter with the token lifetimes of the valid provider", func() {
+				startInformersAndController()
+				err := controllerlib.TestSync(t, subject, *syncContext)
+				r.NoError(err)
+
+				r.True(providersSetter.SetProvidersWasCalled)
+				r.Len(providersSetter.FederationDomainsReceived, 1)
+				r.Equal(validFederationDomain.Spec.Issuer, providersSetter.FederationDomainsReceived[0].Issuer())
+				r.Equal(&provider.FederationDomainTokenLifetimes{
+					AccessToken:  5 * time.Minute,
+					RefreshToken: 4 * time.Hour,
+					MaxSession:   8 * time.Hour,
+				}, providersSetter.FederationDomainsReceived[0].TokenLifetimes())
+				r.Equal([]string{"RS256", "ES256"}, providersSetter.FederationDomainsReceived[0].IDTokenSigningAlgorithms())
+			})
+
+			when("the refresh token lifetime is longer than the secret rotation grace period", func() {
+				it.Before(func() {
+					secretRotationGracePeriod = time.Hour
+				})
+
+				it("only warns about it, and still calls the ProvidersSetter with the provider", func() {
+					startInformersAndController()
+					err := controllerlib.TestSync(t, subject, *syncContext)
+					r.NoError(err)
+
+					r.True(providersSetter.SetProvidersWasCalled)
+					r.Len(providersSetter.FederationDomainsReceived, 1)
+					r.Equal(4*time.Hour, providersSetter.FederationDomainsReceived[0].TokenLifetimes().RefreshToken)
+				})
+			})
+
+			for _, test := range []struct {
+				name                     string
+				tokenLifetimes           *v1alpha1.FederationDomainTokenLifetimes
+				signingKeyRotation       *v1alpha1.FederationDomainSigningKeyRotation
+				idTokenSigningAlgorithms []v1alpha1.SigningAlgorithm
+				wantMessage              string
+			}{
+				{
+					name:           "access token lifetime too short",
+					tokenLifetimes: &v1alpha1.FederationDomainTokenLifetimes{AccessToken: &metav1.Duration{Duration: 30 * time.Second}},
+					wantMessage:    "Invalid: tokenLifetimes.accessToken must be at least 1m0s",
+				},
+				{
+					name:           "ID token lifetime too short",
+					tokenLifetimes: &v1alpha1.FederationDomainTokenLifetimes{IDToken: &metav1.Duration{}},
+					wantMessage:    "Invalid: tokenLifetimes.idToken must be at least 1m0s",
+				},
+				{
+					name:           "refresh token lifetime too short",
+					tokenLifetimes: &v1alpha1.FederationDomainTokenLifetimes{RefreshToken: &metav1.Duration{Duration: -time.Hour}},
+					wantMessage:    "Invalid: tokenLifetimes.refreshToken must be at least 1m0s",
+				},
+				{
+					name:           "max session too short",
+					tokenLifetimes: &v1alpha1.FederationDomainTokenLifetimes{MaxSession: &metav1.Duration{Duration: time.Second}},
+					wantMessage:    "Invalid: tokenLifetimes.maxSession must be at least 1m0s",
+				},
+				{
+					name: "access token lifetime longer than refresh token lifetime",
+					tokenLifetimes: &v1alpha1.FederationDomainTokenLifetimes{
+						AccessToken:  &metav1.Duration{Duration: 2 * time.Hour},
+						RefreshToken: &metav1.Duration{Duration: time.Hour},
+					},
+					wantMessage: "Invalid: tokenLifetimes.accessToken (2h0m0s) must not be longer than tokenLifetimes.refreshToken (1h0m0s)",
+				},
+				{
+					name:           "access token lifetime longer than default refresh token lifetime",
+					tokenLifetimes: &v1alpha1.FederationDomainTokenLifetimes{AccessToken: &metav1.Duration{Duration: 10 * time.Hour}},
+					wantMessage:    "Invalid: tokenLifetimes.accessToken (10h0m0s) must not be longer than tokenLifetimes.refreshToken (9h0m0s)",
+				},
+				{
+					name:           "default access token lifetime longer than refresh token lifetime",
+					tokenLifetimes: &v1alpha1.FederationDomainTokenLifetimes{RefreshToken: &metav1.Duration{Duration: time.Minute}},
+					wantMessage:    "Invalid: tokenLifetimes.accessToken (2m0s) must not be longer than tokenLifetimes.refreshToken (1m0s)",
+				},
+				{
+					name: "ID token lifetime longer than refresh token lifetime",
+					tokenLifetimes: &v1alpha1.FederationDomainTokenLifetimes{
+						IDToken:      &metav1.Duration{Duration: 2 * time.Hour},
+						RefreshToken: &metav1.Duration{Duration: time.Hour},
+					},
+					wantMessage: "Invalid: tokenLifetimes.idToken (2h0m0s) must not be longer than tokenLifetimes.refreshToken (1h0m0s)",
+				},
+				{
+					name:               "signing key rotation interval too short",
+					signingKeyRotation: &v1alpha1.FederationDomainSigningKeyRotation{Interval: metav1.Duration{Duration: 30 * time.Minute}},
+					wantMessage:        "Invalid: signingKeyRotation.interval must be at least 1h0m0s",
+				},
+				{
+					name: "negative signing key pre-publish period",
+					signingKeyRotation: &v1alpha1.FederationDomainSigningKeyRotation{
+						Interval:         metav1.Duration{Duration: 48 * time.Hour},
+						PrePublishPeriod: &metav1.Duration{Duration: -time.Hour},
+					},
+					wantMessage: "Invalid: signingKeyRotation.prePublishPeriod must not be negative",
+				},
+				{
+					name: "signing key pre-publish period as long as the interval",
+					signingKeyRotation: &v1alpha1.FederationDomainSigningKeyRotation{
+						Interval:         metav1.Duration{Duration: 2 * time.Hour},
+						PrePublishPeriod: &metav1.Duration{Duration: 2 * time.Hour},
+					},
+					wantMessage: "Invalid: signingKeyRotation.prePublishPeriod (2h0m0s) must be shorter than signingKeyRotation.interval (2h0m0s)",
+				},
+				{
+					name:               "signing key rotation interval shorter than the default pre-publish period",
+					signingKeyRotation: &v1alpha1.FederationDomainSigningKeyRotation{Interval: metav1.Duration{Duration: 12 * time.Hour}},
+					wantMessage:        "Invalid: signingKeyRotation.prePublishPeriod (24h0m0s) must be shorter than signingKeyRotation.interval (12h0m0s)",
+				},
+				{
+					name:                     "unsupported ID token signing algorithm",
+					idTokenSigningAlgorithms: []v1alpha1.SigningAlgorithm{"ES256", "HS256"},
+					wantMessage:              `Invalid: idTokenSigningAlgorithms contains unsupported algorithm "HS256"`,
+				},
+				{
+					name:                     "duplicate ID token signing algorithm",
+					idTokenSigningAlgorithms: []v1alpha1.SigningAlgorithm{"RS256", "ES256", "RS256"},
+					wantMessage:              `Invalid: idTokenSigningAlgorithms contains duplicate algorithm "RS256"`,
+				},
+			} {
+				test := test
+				when("one FederationDomain has invalid token settings: "+test.name, func() {
+					it.Before(func() {
+						invalidFederationDomain = &v1alpha1.FederationDomain{
+							ObjectMeta: metav1.ObjectMeta{Name: "invalid-config", Namespace: namespace},
+							Spec: v1alpha1.FederationDomainSpec{
+								Issuer:                   "https://invalid-issuer.com",
+								TokenLifetimes:           test.tokenLifetimes,
+								SigningKeyRotation:       test.signingKeyRotation,
+								IDTokenSigningAlgorithms: test.idTokenSigningAlgorithms,
+							},
+						}
+						r.NoError(pinnipedAPIClient.Tracker().Add(invalidFederationDomain))
+						r.NoError(federationDomainInformerClient.Tracker().Add(invalidFederationDomain))
+					})
+
+					it("calls the ProvidersSetter with only the valid provider and updates the status of the invalid provider", func() {
+						startInformersAndController()
+						err := controllerlib.TestSync(t, subject, *syncContext)
+						r.NoError(err)
+
+						r.True(providersSetter.SetProvidersWasCalled)
+						r.Len(providersSetter.FederationDomainsReceived, 1)
+						r.Equal(validFederationDomain.Spec.Issuer, providersSetter.FederationDomainsReceived[0].Issuer())
+
+						invalidFederationDomain.Status.Status = v1alpha1.InvalidFederationDomainStatusCondition
+						invalidFederationDomain.Status.Message = test.wantMessage
+						invalidFederationDomain.Status.LastUpdateTime = timePtr(metav1.NewTime(frozenNow))
+
+						r.Contains(pinnipedAPIClient.Actions(), coretesting.NewUpdateSubresourceAction(
+							federationDomainGVR,
+							"status",
+							invalidFederationDomain.Namespace,
+							invalidFederationDomain,
+						))
+					})
+				})
+			}
+		})
+
+		when("there are FederationDomains with client credentials transforms in the informer", func() {
+			var (
+				validFederationDomain   *v1alpha1.FederationDomain
+				invalidFederationDomain *v1alpha1.FederationDomain
+			)
+
+			it.Before(func() {
+				validFederationDomain = &v1alpha1.FederationDomain{
+					ObjectMeta: metav1.ObjectMeta{Name: "valid-config", Namespace: namespace},
+					Spec: v1alpha1.FederationDomainSpec{
+						Issuer: "https://valid-issuer.com",
+						ClientCredentialsTransforms: v1alpha1.FederationDomainTransforms{
+							Constants: []v1alpha1.FederationDomainTransformsConstant{
+								{Name: "prefix", Type: "string", StringValue: "client:"},
+							},
+							Expressions: []v1alpha1.FederationDomainTransformsExpression{
+								{Type: "policy/v1", Expression: `!groups.exists(g, g == "blocked")`, Message: "blocked clients are not allowed"},
+								{Type: "username/v1", Expression: `strConst.prefix + username`},
+							},
+						},
+					},
+				}
+				r.NoError(pinnipedAPIClient.Tracker().Add(validFederationDomain))
+				r.NoError(federationDomainInformerClient.Tracker().Add(validFederationDomain))
+			})
+
+			it("calls the ProvidersSetter with the compiled client credentials transforms of the valid provider", func() {
+				startInformersAndController()
+				err := controllerlib.TestSync(t, subject, *syncContext)
+				r.NoError(err)
+
+				r.True(providersSetter.SetProvidersWasCalled)
+				r.Len(providersSetter.FederationDomainsReceived, 1)
+				r.Equal(validFederationDomain.Spec.Issuer, providersSetter.FederationDomainsReceived[0].Issuer())
+
+				transforms := providersSetter.FederationDomainsReceived[0].ClientCredentialsTransforms()
+				r.NotNil(transforms)
+
+				result, err := transforms.Evaluate(context.Background(), "ci-runner", []string{"ci"})
+				r.NoError(err)
+				r.Equal(&idtransform.TransformationResult{
+					Username:              "client:ci-runner",
+					Groups:                []string{"ci"},
+					AuthenticationAllowed: true,
+				}, result)
+
+				result, err = transforms.Evaluate(context.Background(), "ci-runner", []string{"blocked"})
+				r.NoError(err)
+				r.Equal(&idtransform.TransformationResult{
+					Username:                      "ci-runner",
+					Groups:                        []string{"blocked"},
+					AuthenticationAllowed:         false,
+					RejectedAuthenticationMessage: "blocked clients are not allowed",
+				}, result)
+			})
+
+			for _, test := range []struct {
+				name        string
+				transforms  v1alpha1.FederationDomainTransforms
+				wantMessage string
+			}{
+				{
+					name: "duplicate constant name",
+					transforms: v1alpha1.FederationDomainTransforms{
+						Constants: []v1alpha1.FederationDomainTransformsConstant{
+							{Name: "foo", Type: "string", StringValue: "bar"},
+							{Name: "foo", Type: "string", StringValue: "baz"},
+						},
+					},
+					wantMessage: `Invalid: clientCredentialsTransforms.constants[1].name "foo" is a duplicate name`,
+				},
+				{
+					name: "unknown expression type",
+					transforms: v1alpha1.FederationDomainTransforms{
+						Expressions: []v1alpha1.FederationDomainTransformsExpression{
+							{Type: "other/v1", Expression: `username`},
+						},
+					},
+					wantMessage: `Invalid: clientCredentialsTransforms.expressions[0].type "other/v1" is not one of "policy/v1", "username/v1", or "groups/v1"`,
+				},
+			} {
+				test := test
+				when("one FederationDomain has invalid client credentials transforms: "+test.name, func() {
+					it.Before(func() {
+						invalidFederationDomain = &v1alpha1.FederationDomain{
+							ObjectMeta: metav1.ObjectMeta{Name: "invalid-config", Namespace: namespace},
+							Spec: v1alpha1.FederationDomainSpec{
+								Issuer:                      "https://invalid-issuer.com",
+								ClientCredentialsTransforms: test.transforms,
+							},
+						}
+						r.NoError(pinnipedAPIClient.Tracker().Add(invalidFederationDomain))
+						r.NoError(federationDomainInformerClient.Tracker().Add(invalidFederationDomain))
+					})
+
+					it("calls the ProvidersSetter with only the valid provider and updates the status of the invalid provider", func() {
+						startInformersAndController()
+						err := controllerlib.TestSync(t, subject, *syncContext)
+						r.NoError(err)
+
+						r.True(providersSetter.SetProvidersWasCalled)
+						r.Len(providersSetter.FederationDomainsReceived, 1)
+						r.Equal(validFederationDomain.Spec.Issuer, providersSetter.FederationDomainsReceived[0].Issuer())
+
+						invalidFederationDomain.Status.Status = v1alpha1.InvalidFederationDomainStatusCondition
+						invalidFederationDomain.Status.Message = test.wantMessage
+						invalidFederationDomain.Status.LastUpdateTime = timePtr(metav1.NewTime(frozenNow))
+
+						r.Contains(pinnipedAPIClient.Actions(), coretesting.NewUpdateSubresourceAction(
+							federationDomainGVR,
+							"status",
+							invalidFederationDomain.Namespace,
+							invalidFederationDomain,
+						))
+					})
+				})
+			}
+		})
+
 		when("there are both valid and invalid FederationDomains in the informer", func() {
 			var (
 				validFederationDomain   *v1alpha1.FederationDomain
@@ -545,7 +1100,7 @@ func TestSync(t *testing.T) {
 				err := controllerlib.TestSync(t, subject, *syncContext)
 				r.NoError(err)
 
-				validProvider, err := provider.NewFederationDomainIssuer(validFederationDomain.Spec.Issuer)
+				validProvider, err := provider.NewFederationDomainIssuer(validFederationDomain.Spec.Issuer, nil, nil, nil, nil)
 				r.NoError(err)
 
 				r.True(providersSetter.SetProvidersWasCalled)
@@ -619,7 +1174,7 @@ func TestSync(t *testing.T) {
 					err := controllerlib.TestSync(t, subject, *syncContext)
 					r.EqualError(err, "could not update status: some update error")
 
-					validProvider, err := provider.NewFederationDomainIssuer(validFederationDomain.Spec.Issuer)
+					validProvider, err := provider.NewFederationDomainIssuer(validFederationDomain.Spec.Issuer, nil, nil, nil, nil)
 					r.NoError(err)
 
 					r.True(providersSetter.SetProvidersWasCalled)
@@ -709,7 +1264,7 @@ func TestSync(t *testing.T) {
 				err := controllerlib.TestSync(t, subject, *syncContext)
 				r.NoError(err)
 
-				nonDuplicateProvider, err := provider.NewFederationDomainIssuer(federationDomain.Spec.Issuer)
+				nonDuplicateProvider, err := provider.NewFederationDomainIssuer(federationDomain.Spec.Issuer, nil, nil, nil, nil)
 				r.NoError(err)
 
 				r.True(providersSetter.SetProvidersWasCalled)
@@ -882,7 +1437,7 @@ func TestSync(t *testing.T) {
 				err := controllerlib.TestSync(t, subject, *syncContext)
 				r.NoError(err)
 
-				nonDuplicateProvider, err := provider.NewFederationDomainIssuer(federationDomainDifferentIssuerAddress.Spec.Issuer)
+				nonDuplicateProvider, err := provider.NewFederationDomainIssuer(federationDomainDifferentIssuerAddress.Spec.Issuer, nil, nil, nil, nil)
 				r.NoError(err)
 
 				r.True(providersSetter.SetProvidersWasCalled)
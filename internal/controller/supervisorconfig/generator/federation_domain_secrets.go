@@ -1,4 +1,4 @@
-// Copyright 2020-2021 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package generator
@@ -7,6 +7,7 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
@@ -35,7 +36,8 @@ type federationDomainSecretsController struct {
 
 // NewFederationDomainSecretsController returns a controllerlib.Controller that ensures a child Secret
 // always exists for a parent FederationDomain. It does this using the provided secretHelper, which
-// provides the parent/child mapping logic.
+// provides the parent/child mapping logic. The secretHelper also decides when the key in the Secret
+// should be rotated, and this controller requeues the FederationDomain for that time.
 func NewFederationDomainSecretsController(
 	secretHelper SecretHelper,
 	secretRefFunc func(domain *configv1alpha1.FederationDomainStatus) *corev1.LocalObjectReference,
@@ -116,6 +118,21 @@ func (c *federationDomainSecretsController) Sync(ctx controllerlib.Context) erro
 			klog.KObj(existingSecret),
 		)
 
+		rotatedSecret, nextCheck, err := c.secretHelper.Rotate(existingSecret)
+		if err != nil {
+			return fmt.Errorf("failed to rotate secret: %w", err)
+		}
+		if rotatedSecret != nil {
+			existingSecret, err = c.kubeClient.CoreV1().Secrets(rotatedSecret.Namespace).Update(ctx.Context, rotatedSecret, metav1.UpdateOptions{})
+			if err != nil {
+				return fmt.Errorf("failed to update rotated secret: %w", err)
+			}
+			plog.Debug("updated rotated secret", "federationdomain", klog.KObj(federationDomain), "secret", klog.KObj(existingSecret))
+		}
+		if !nextCheck.IsZero() {
+			ctx.Queue.AddAfter(ctx.Key, time.Until(nextCheck))
+		}
+
 		federationDomain = c.secretHelper.ObserveActiveSecretAndUpdateParentFederationDomain(federationDomain, existingSecret)
 		if err := c.updateFederationDomainStatus(ctx.Context, federationDomain); err != nil {
 			return fmt.Errorf("failed to update federationdomain: %w", err)
@@ -1,4 +1,4 @@
-// Copyright 2020-2021 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package generator
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
@@ -177,7 +178,9 @@ func TestFederationDomainControllerFilterSecret(t *testing.T) {
 				map[string]string{},
 				rand.Reader,
 				SecretUsageTokenSigningKey,
-				func(cacheKey string, cacheValue []byte) {},
+				KeyRotation{},
+				nil,
+				func(cacheKey string, cacheValue, previousCacheValue []byte) {},
 			)
 
 			secretInformer := kubeinformers.NewSharedInformerFactory(
@@ -240,7 +243,9 @@ func TestNewFederationDomainSecretsControllerFilterFederationDomain(t *testing.T
 				map[string]string{},
 				rand.Reader,
 				SecretUsageTokenSigningKey,
-				func(cacheKey string, cacheValue []byte) {},
+				KeyRotation{},
+				nil,
+				func(cacheKey string, cacheValue, previousCacheValue []byte) {},
 			)
 
 			secretInformer := kubeinformers.NewSharedInformerFactory(
@@ -341,6 +346,12 @@ func TestFederationDomainSecretsControllerSync(t *testing.T) {
 	goodFederationDomainWithJWKSAndTokenSigningKey := goodFederationDomainWithJWKS.DeepCopy()
 	goodFederationDomainWithJWKSAndTokenSigningKey.Status.Secrets.TokenSigningKey = goodFederationDomainWithTokenSigningKey.Status.Secrets.TokenSigningKey
 
+	rotatedSecret := goodSecret.DeepCopy()
+	rotatedSecret.Data = map[string][]byte{
+		"key":         []byte("some-new-value"),
+		"previousKey": []byte("some-value"),
+	}
+
 	invalidSecret := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      secretName,
@@ -366,6 +377,7 @@ func TestFederationDomainSecretsControllerSync(t *testing.T) {
 		secretHelper                func(*mocksecrethelper.MockSecretHelper)
 		wantFederationDomainActions []kubetesting.Action
 		wantSecretActions           []kubetesting.Action
+		wantRequeueAfter            time.Duration
 		wantError                   string
 	}{
 		{
@@ -463,6 +475,73 @@ func TestFederationDomainSecretsControllerSync(t *testing.T) {
 				kubetesting.NewUpdateAction(secretGVR, namespace, goodSecret),
 			},
 		},
+		{
+			name: "FederationDomain exists and valid secret exists",
+			secretHelper: func(secretHelper *mocksecrethelper.MockSecretHelper) {
+				secretHelper.EXPECT().Generate(goodFederationDomain).Times(1).Return(goodSecret, nil)
+				secretHelper.EXPECT().IsValid(goodFederationDomain, goodSecret).Times(1).Return(true)
+				secretHelper.EXPECT().Rotate(goodSecret).Times(1).Return(nil, time.Time{}, nil)
+				secretHelper.EXPECT().ObserveActiveSecretAndUpdateParentFederationDomain(goodFederationDomain, goodSecret).Times(1).Return(goodFederationDomainWithTokenSigningKey)
+			},
+			wantFederationDomainActions: []kubetesting.Action{
+				kubetesting.NewGetAction(federationDomainGVR, namespace, goodFederationDomain.Name),
+				kubetesting.NewUpdateSubresourceAction(federationDomainGVR, "status", namespace, goodFederationDomainWithTokenSigningKey),
+			},
+		},
+		{
+			name: "FederationDomain exists and valid secret exists which will need to be rotated later",
+			secretHelper: func(secretHelper *mocksecrethelper.MockSecretHelper) {
+				secretHelper.EXPECT().Generate(goodFederationDomain).Times(1).Return(goodSecret, nil)
+				secretHelper.EXPECT().IsValid(goodFederationDomain, goodSecret).Times(1).Return(true)
+				secretHelper.EXPECT().Rotate(goodSecret).Times(1).Return(nil, time.Now().Add(time.Hour), nil)
+				secretHelper.EXPECT().ObserveActiveSecretAndUpdateParentFederationDomain(goodFederationDomain, goodSecret).Times(1).Return(goodFederationDomainWithTokenSigningKey)
+			},
+			wantFederationDomainActions: []kubetesting.Action{
+				kubetesting.NewGetAction(federationDomainGVR, namespace, goodFederationDomain.Name),
+				kubetesting.NewUpdateSubresourceAction(federationDomainGVR, "status", namespace, goodFederationDomainWithTokenSigningKey),
+			},
+			wantRequeueAfter: time.Hour,
+		},
+		{
+			name: "FederationDomain exists and valid secret exists which is rotated",
+			secretHelper: func(secretHelper *mocksecrethelper.MockSecretHelper) {
+				secretHelper.EXPECT().Generate(goodFederationDomain).Times(1).Return(goodSecret, nil)
+				secretHelper.EXPECT().IsValid(goodFederationDomain, goodSecret).Times(1).Return(true)
+				secretHelper.EXPECT().Rotate(goodSecret).Times(1).Return(rotatedSecret, time.Now().Add(time.Hour), nil)
+				secretHelper.EXPECT().ObserveActiveSecretAndUpdateParentFederationDomain(goodFederationDomain, rotatedSecret).Times(1).Return(goodFederationDomainWithTokenSigningKey)
+			},
+			wantFederationDomainActions: []kubetesting.Action{
+				kubetesting.NewGetAction(federationDomainGVR, namespace, goodFederationDomain.Name),
+				kubetesting.NewUpdateSubresourceAction(federationDomainGVR, "status", namespace, goodFederationDomainWithTokenSigningKey),
+			},
+			wantSecretActions: []kubetesting.Action{
+				kubetesting.NewUpdateAction(secretGVR, namespace, rotatedSecret),
+			},
+			wantRequeueAfter: time.Hour,
+		},
+		{
+			name: "FederationDomain exists and valid secret exists and rotating the secret fails",
+			secretHelper: func(secretHelper *mocksecrethelper.MockSecretHelper) {
+				secretHelper.EXPECT().Generate(goodFederationDomain).Times(1).Return(goodSecret, nil)
+				secretHelper.EXPECT().IsValid(goodFederationDomain, goodSecret).Times(1).Return(true)
+				secretHelper.EXPECT().Rotate(goodSecret).Times(1).Return(nil, time.Time{}, errors.New("some rotate error"))
+			},
+			wantError: "failed to rotate secret: some rotate error",
+		},
+		{
+			name: "FederationDomain exists and valid secret exists and updating the rotated secret fails",
+			secretHelper: func(secretHelper *mocksecrethelper.MockSecretHelper) {
+				secretHelper.EXPECT().Generate(goodFederationDomain).Times(1).Return(goodSecret, nil)
+				secretHelper.EXPECT().IsValid(goodFederationDomain, goodSecret).Times(1).Return(true)
+				secretHelper.EXPECT().Rotate(goodSecret).Times(1).Return(rotatedSecret, time.Now().Add(time.Hour), nil)
+			},
+			client: func(_ *pinnipedfake.Clientset, c *kubernetesfake.Clientset) {
+				c.PrependReactor("update", "secrets", func(_ kubetesting.Action) (bool, runtime.Object, error) {
+					return true, nil, errors.New("some update error")
+				})
+			},
+			wantError: "failed to update rotated secret: some update error",
+		},
 		{
 			name: "FederationDomain exists and generating a secret fails",
 			secretHelper: func(secretHelper *mocksecrethelper.MockSecretHelper) {
@@ -691,12 +770,14 @@ func TestFederationDomainSecretsControllerSync(t *testing.T) {
 			pinnipedInformers.Start(ctx.Done())
 			controllerlib.TestRunSynchronously(t, c)
 
+			queue := &testQueue{t: t}
 			err := controllerlib.TestSync(t, c, controllerlib.Context{
 				Context: ctx,
 				Key: controllerlib.Key{
 					Namespace: namespace,
 					Name:      federationDomainName,
 				},
+				Queue: queue,
 			})
 			if test.wantError != "" {
 				require.EqualError(t, err, test.wantError)
@@ -712,6 +793,9 @@ func TestFederationDomainSecretsControllerSync(t *testing.T) {
 				test.wantSecretActions = []kubetesting.Action{}
 			}
 			require.Equal(t, test.wantSecretActions, kubeAPIClient.Actions())
+
+			require.Equal(t, test.wantRequeueAfter != 0, queue.called)
+			require.InDelta(t, test.wantRequeueAfter, queue.duration, float64(time.Minute))
 		})
 	}
 }
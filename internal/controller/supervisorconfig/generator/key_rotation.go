@@ -0,0 +1,157 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package generator
+
+import (
+	"encoding/json"
+	"time"
+
+	"go.pinniped.dev/internal/plog"
+)
+
+const (
+	// previousSymmetricSecretDataKey is the corev1.Secret.Data key for the symmetric key value which was replaced by
+	// the most recent rotation. It is only present during the grace period which follows a rotation.
+	previousSymmetricSecretDataKey = "previousKey"
+
+	// symmetricKeyRotationDataKey is the corev1.Secret.Data key for the bookkeeping of scheduled key rotation. It is
+	// only present after rotation has been configured.
+	symmetricKeyRotationDataKey = "rotation"
+)
+
+// KeyRotation configures the scheduled rotation of the symmetric keys which are generated by this package.
+type KeyRotation struct {
+	// Interval is how long each key is used before it is replaced by a new key. Zero means that keys are never rotated.
+	Interval time.Duration
+
+	// GracePeriod is how long the previous key continues to be accepted after it has been replaced.
+	GracePeriod time.Duration
+}
+
+// symmetricKeyRotationState is the bookkeeping for the scheduled rotation of a symmetric key.
+type symmetricKeyRotationState struct {
+	// ActivatedAt is the time at which the current key started being used.
+	ActivatedAt time.Time `json:"activatedAt"`
+	// PreviousKeyExpiresAt is the time at which the previous key stops being accepted.
+	PreviousKeyExpiresAt time.Time `json:"previousKeyExpiresAt"`
+}
+
+// rotateSymmetricKey applies the rotation schedule to the data of a Secret which holds a valid symmetric key. It
+// returns the new data of the Secret, whether it differs from the old data, and the next time at which the data
+// should be checked again. The next time is zero when there is nothing left to do, e.g. when rotation is not
+// configured and there is no previous key to remove.
+func rotateSymmetricKey(
+	data map[string][]byte,
+	rotation KeyRotation,
+	now time.Time,
+	generate func() ([]byte, error),
+) (map[string][]byte, bool, time.Time, error) {
+	now = now.UTC().Truncate(time.Second)
+
+	newData := make(map[string][]byte, len(data))
+	for k, v := range data {
+		newData[k] = v
+	}
+
+	state := symmetricKeyRotationStateFromData(data)
+	changed := false
+
+	// Remove the previous key once its grace period is over, or when it cannot be used.
+	if _, ok := newData[previousSymmetricSecretDataKey]; ok {
+		if state == nil ||
+			state.PreviousKeyExpiresAt.IsZero() ||
+			!now.Before(state.PreviousKeyExpiresAt) ||
+			len(newData[previousSymmetricSecretDataKey]) != symmetricKeySize {
+			delete(newData, previousSymmetricSecretDataKey)
+			if state != nil {
+				state.PreviousKeyExpiresAt = time.Time{}
+			}
+			changed = true
+		}
+	}
+	_, hasPreviousKey := newData[previousSymmetricSecretDataKey]
+
+	if rotation.Interval <= 0 {
+		// Rotation is not configured, but a previous key from an earlier rotation may still be in its grace period.
+		if hasPreviousKey {
+			return withRotationState(newData, state, rotation.Interval, changed)
+		}
+		if _, ok := newData[symmetricKeyRotationDataKey]; ok {
+			delete(newData, symmetricKeyRotationDataKey)
+			changed = true
+		}
+		return newData, changed, time.Time{}, nil
+	}
+
+	if state == nil {
+		// Rotation was just configured, so the schedule starts now.
+		state = &symmetricKeyRotationState{ActivatedAt: now}
+		changed = true
+	}
+
+	if rotateAt := state.ActivatedAt.Add(rotation.Interval); !now.Before(rotateAt) {
+		newKey, err := generate()
+		if err != nil {
+			return nil, false, time.Time{}, err
+		}
+
+		state = &symmetricKeyRotationState{ActivatedAt: now}
+		delete(newData, previousSymmetricSecretDataKey)
+		if rotation.GracePeriod > 0 {
+			newData[previousSymmetricSecretDataKey] = newData[symmetricSecretDataKey]
+			state.PreviousKeyExpiresAt = now.Add(rotation.GracePeriod)
+		}
+		newData[symmetricSecretDataKey] = newKey
+		changed = true
+
+		plog.Debug("rotated symmetric key", "previousKeyExpiresAt", state.PreviousKeyExpiresAt)
+	}
+
+	return withRotationState(newData, state, rotation.Interval, changed)
+}
+
+// withRotationState stores the rotation state in the data when it has changed. It also returns the soonest of the
+// next scheduled rotation and the end of the grace period of the previous key.
+func withRotationState(
+	data map[string][]byte,
+	state *symmetricKeyRotationState,
+	interval time.Duration,
+	changed bool,
+) (map[string][]byte, bool, time.Time, error) {
+	if changed {
+		stateJSON, err := json.Marshal(state)
+		if err != nil {
+			return nil, false, time.Time{}, err
+		}
+		data[symmetricKeyRotationDataKey] = stateJSON
+	}
+
+	var nextCheck time.Time
+	if interval > 0 {
+		nextCheck = state.ActivatedAt.Add(interval)
+	}
+	if _, ok := data[previousSymmetricSecretDataKey]; ok {
+		if nextCheck.IsZero() || state.PreviousKeyExpiresAt.Before(nextCheck) {
+			nextCheck = state.PreviousKeyExpiresAt
+		}
+	}
+
+	return data, changed, nextCheck, nil
+}
+
+// symmetricKeyRotationStateFromData returns the rotation bookkeeping from the Secret data, or nil when there is none.
+func symmetricKeyRotationStateFromData(data map[string][]byte) *symmetricKeyRotationState {
+	rotationData, ok := data[symmetricKeyRotationDataKey]
+	if !ok {
+		return nil
+	}
+
+	var state symmetricKeyRotationState
+	if err := json.Unmarshal(rotationData, &state); err != nil {
+		plog.Debug("cannot unmarshal symmetric key rotation state", "err", err)
+		return nil
+	}
+
+	return &state
+}
@@ -1,4 +1,4 @@
-// Copyright 2020-2021 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package generator
@@ -6,22 +6,26 @@ package generator
 import (
 	"fmt"
 	"io"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/utils/clock"
 
 	configv1alpha1 "go.pinniped.dev/generated/latest/apis/supervisor/config/v1alpha1"
 )
 
 // SecretHelper describes an object that can Generate() a Secret and determine whether a Secret
-// IsValid(). It can also be Notify()'d about a Secret being persisted.
+// IsValid(). It can also be Notify()'d about a Secret being persisted, and it can Rotate() the key
+// held by a valid Secret according to its rotation schedule.
 //
 // A SecretHelper has a NamePrefix() that can be used to identify it from other SecretHelper instances.
 type SecretHelper interface {
 	NamePrefix() string
 	Generate(*configv1alpha1.FederationDomain) (*corev1.Secret, error)
 	IsValid(*configv1alpha1.FederationDomain, *corev1.Secret) bool
+	Rotate(*corev1.Secret) (*corev1.Secret, time.Time, error)
 	ObserveActiveSecretAndUpdateParentFederationDomain(*configv1alpha1.FederationDomain, *corev1.Secret) *configv1alpha1.FederationDomain
 	Handles(metav1.Object) bool
 }
@@ -67,13 +71,17 @@ func NewSymmetricSecretHelper(
 	labels map[string]string,
 	rand io.Reader,
 	secretUsage SecretUsage,
-	updateCacheFunc func(cacheKey string, cacheValue []byte),
+	rotation KeyRotation,
+	clock clock.Clock,
+	updateCacheFunc func(cacheKey string, cacheValue, previousCacheValue []byte),
 ) SecretHelper {
 	return &symmetricSecretHelper{
 		namePrefix:      namePrefix,
 		labels:          labels,
 		rand:            rand,
 		secretUsage:     secretUsage,
+		rotation:        rotation,
+		clock:           clock,
 		updateCacheFunc: updateCacheFunc,
 	}
 }
@@ -83,15 +91,17 @@ type symmetricSecretHelper struct {
 	labels          map[string]string
 	rand            io.Reader
 	secretUsage     SecretUsage
-	updateCacheFunc func(cacheKey string, cacheValue []byte)
+	rotation        KeyRotation
+	clock           clock.Clock
+	updateCacheFunc func(cacheKey string, cacheValue, previousCacheValue []byte)
 }
 
 func (s *symmetricSecretHelper) NamePrefix() string { return s.namePrefix }
 
 // Generate implements SecretHelper.Generate().
 func (s *symmetricSecretHelper) Generate(parent *configv1alpha1.FederationDomain) (*corev1.Secret, error) {
-	key := make([]byte, symmetricKeySize)
-	if _, err := s.rand.Read(key); err != nil {
+	key, err := s.generateKey()
+	if err != nil {
 		return nil, err
 	}
 
@@ -136,12 +146,36 @@ func (s *symmetricSecretHelper) IsValid(parent *configv1alpha1.FederationDomain,
 	return true
 }
 
+// Rotate implements SecretHelper.Rotate(). It returns a copy of the secret with the rotated key, or nil when the
+// secret does not need to change, along with the next time at which the secret should be checked again.
+func (s *symmetricSecretHelper) Rotate(secret *corev1.Secret) (*corev1.Secret, time.Time, error) {
+	data, changed, nextCheck, err := rotateSymmetricKey(secret.Data, s.rotation, s.clock.Now(), s.generateKey)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if !changed {
+		return nil, nextCheck, nil
+	}
+
+	rotatedSecret := secret.DeepCopy()
+	rotatedSecret.Data = data
+	return rotatedSecret, nextCheck, nil
+}
+
+func (s *symmetricSecretHelper) generateKey() ([]byte, error) {
+	key := make([]byte, symmetricKeySize)
+	if _, err := s.rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
 // ObserveActiveSecretAndUpdateParentFederationDomain implements SecretHelper.ObserveActiveSecretAndUpdateParentFederationDomain().
 func (s *symmetricSecretHelper) ObserveActiveSecretAndUpdateParentFederationDomain(
 	federationDomain *configv1alpha1.FederationDomain,
 	secret *corev1.Secret,
 ) *configv1alpha1.FederationDomain {
-	s.updateCacheFunc(federationDomain.Spec.Issuer, secret.Data[symmetricSecretDataKey])
+	s.updateCacheFunc(federationDomain.Spec.Issuer, secret.Data[symmetricSecretDataKey], secret.Data[previousSymmetricSecretDataKey])
 
 	switch s.secretUsage {
 	case SecretUsageTokenSigningKey:
@@ -1,4 +1,4 @@
-// Copyright 2020-2021 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package generator
@@ -6,11 +6,13 @@ package generator
 import (
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	clocktesting "k8s.io/utils/clock/testing"
 
 	configv1alpha1 "go.pinniped.dev/generated/latest/apis/supervisor/config/v1alpha1"
 )
@@ -68,8 +70,11 @@ func TestSymmetricSecretHelper(t *testing.T) {
 				labels,
 				randSource,
 				test.secretUsage,
-				func(federationDomainIssuer string, symmetricKey []byte) {
+				KeyRotation{},
+				nil,
+				func(federationDomainIssuer string, symmetricKey, previousSymmetricKey []byte) {
 					require.True(t, federationDomainIssuer == "" && symmetricKeyValue == nil, "expected notify func not to have been called yet")
+					require.Nil(t, previousSymmetricKey)
 					federationDomainIssuerValue = federationDomainIssuer
 					symmetricKeyValue = symmetricKey
 				},
@@ -184,7 +189,7 @@ func TestSymmetricSecretHelperIsValid(t *testing.T) {
 	for _, test := range tests {
 		test := test
 		t.Run(test.name, func(t *testing.T) {
-			h := NewSymmetricSecretHelper("none of these args matter", nil, nil, test.secretUsage, nil)
+			h := NewSymmetricSecretHelper("none of these args matter", nil, nil, test.secretUsage, KeyRotation{}, nil, nil)
 
 			parent := &configv1alpha1.FederationDomain{
 				ObjectMeta: metav1.ObjectMeta{
@@ -221,3 +226,82 @@ func TestSymmetricSecretHelperIsValid(t *testing.T) {
 		})
 	}
 }
+
+func TestSymmetricSecretHelperRotate(t *testing.T) {
+	const otherKeyWith32Bytes = "fedcba9876543210fedcba9876543210"
+
+	now := time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC)
+	fakeClock := clocktesting.NewFakeClock(now)
+
+	var previousSymmetricKeyValue []byte
+	h := NewSymmetricSecretHelper(
+		"some-name-prefix-",
+		nil,
+		strings.NewReader(keyWith32Bytes+otherKeyWith32Bytes),
+		SecretUsageTokenSigningKey,
+		KeyRotation{Interval: 720 * time.Hour, GracePeriod: 24 * time.Hour},
+		fakeClock,
+		func(_ string, _, previousSymmetricKey []byte) {
+			previousSymmetricKeyValue = previousSymmetricKey
+		},
+	)
+
+	parent := &configv1alpha1.FederationDomain{
+		ObjectMeta: metav1.ObjectMeta{
+			UID:       "some-uid",
+			Namespace: "some-namespace",
+		},
+	}
+	secret, err := h.Generate(parent)
+	require.NoError(t, err)
+
+	// The first call starts the rotation schedule.
+	rotated, nextCheck, err := h.Rotate(secret)
+	require.NoError(t, err)
+	require.NotNil(t, rotated)
+	require.Equal(t, now.Add(720*time.Hour), nextCheck)
+	require.Equal(t, []byte(keyWith32Bytes), rotated.Data["key"])
+	require.NotContains(t, rotated.Data, "previousKey")
+	require.NotContains(t, secret.Data, "rotation", "the original secret should not be changed")
+	secret = rotated
+
+	// Nothing changes until the rotation interval has elapsed.
+	fakeClock.Step(719 * time.Hour)
+	rotated, nextCheck, err = h.Rotate(secret)
+	require.NoError(t, err)
+	require.Nil(t, rotated)
+	require.Equal(t, now.Add(720*time.Hour), nextCheck)
+
+	// Once the interval has elapsed, a new key is generated and the old key becomes the previous key.
+	fakeClock.Step(time.Hour)
+	rotated, nextCheck, err = h.Rotate(secret)
+	require.NoError(t, err)
+	require.NotNil(t, rotated)
+	require.Equal(t, now.Add(744*time.Hour), nextCheck)
+	require.Equal(t, []byte(otherKeyWith32Bytes), rotated.Data["key"])
+	require.Equal(t, []byte(keyWith32Bytes), rotated.Data["previousKey"])
+	require.True(t, h.IsValid(parent, rotated))
+
+	h.ObserveActiveSecretAndUpdateParentFederationDomain(parent, rotated)
+	require.Equal(t, []byte(keyWith32Bytes), previousSymmetricKeyValue)
+	secret = rotated
+
+	// Once the grace period has ended, the previous key is removed.
+	fakeClock.Step(24 * time.Hour)
+	rotated, nextCheck, err = h.Rotate(secret)
+	require.NoError(t, err)
+	require.NotNil(t, rotated)
+	require.Equal(t, now.Add(1440*time.Hour), nextCheck)
+	require.Equal(t, []byte(otherKeyWith32Bytes), rotated.Data["key"])
+	require.NotContains(t, rotated.Data, "previousKey")
+
+	h.ObserveActiveSecretAndUpdateParentFederationDomain(parent, rotated)
+	require.Nil(t, previousSymmetricKeyValue)
+
+	// Without a rotation schedule, a secret which was never rotated is left alone.
+	unscheduled := NewSymmetricSecretHelper("some-name-prefix-", nil, nil, SecretUsageTokenSigningKey, KeyRotation{}, fakeClock, nil)
+	rotated, nextCheck, err = unscheduled.Rotate(&corev1.Secret{Data: map[string][]byte{"key": []byte(keyWith32Bytes)}})
+	require.NoError(t, err)
+	require.Nil(t, rotated)
+	require.Zero(t, nextCheck)
+}
@@ -1,4 +1,4 @@
-// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 // Package generator provides a supervisorSecretsController that can ensure existence of a generated secret.
@@ -17,6 +17,7 @@ import (
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/util/retry"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
 
 	pinnipedcontroller "go.pinniped.dev/internal/controller"
 	"go.pinniped.dev/internal/controllerlib"
@@ -30,16 +31,21 @@ type supervisorSecretsController struct {
 	labels         map[string]string
 	kubeClient     kubernetes.Interface
 	secretInformer corev1informers.SecretInformer
-	setCacheFunc   func(secret []byte)
+	rotation       KeyRotation
+	clock          clock.Clock
+	setCacheFunc   func(secret, previousSecret []byte)
 }
 
-// NewSupervisorSecretsController instantiates a new controllerlib.Controller which will ensure existence of a generated secret.
+// NewSupervisorSecretsController instantiates a new controllerlib.Controller which will ensure existence of a generated secret,
+// and which will rotate the key in that secret according to the given rotation schedule.
 func NewSupervisorSecretsController(
 	owner *appsv1.Deployment,
 	labels map[string]string,
 	kubeClient kubernetes.Interface,
 	secretInformer corev1informers.SecretInformer,
-	setCacheFunc func(secret []byte),
+	rotation KeyRotation,
+	clock clock.Clock,
+	setCacheFunc func(secret, previousSecret []byte),
 	withInformer pinnipedcontroller.WithInformerOptionFunc,
 	initialEventFunc pinnipedcontroller.WithInitialEventOptionFunc,
 ) controllerlib.Controller {
@@ -47,6 +53,8 @@ func NewSupervisorSecretsController(
 		labels:         labels,
 		kubeClient:     kubeClient,
 		secretInformer: secretInformer,
+		rotation:       rotation,
+		clock:          clock,
 		setCacheFunc:   setCacheFunc,
 	}
 	return controllerlib.New(
@@ -83,7 +91,25 @@ func (c *supervisorSecretsController) Sync(ctx controllerlib.Context) error {
 	secretNeedsUpdate := isNotFound || !isValid(secret, c.labels)
 	if !secretNeedsUpdate {
 		plog.Debug("secret is up to date", "secret", klog.KObj(secret))
-		c.setCacheFunc(secret.Data[symmetricSecretDataKey])
+
+		data, changed, nextCheck, err := rotateSymmetricKey(secret.Data, c.rotation, c.clock.Now(), generateKey)
+		if err != nil {
+			return fmt.Errorf("failed to rotate secret %s/%s: %w", secret.Namespace, secret.Name, err)
+		}
+		if changed {
+			rotatedSecret := secret.DeepCopy()
+			rotatedSecret.Data = data
+			secret, err = c.kubeClient.CoreV1().Secrets(rotatedSecret.Namespace).Update(ctx.Context, rotatedSecret, metav1.UpdateOptions{})
+			if err != nil {
+				return fmt.Errorf("failed to update rotated secret %s/%s: %w", rotatedSecret.Namespace, rotatedSecret.Name, err)
+			}
+			plog.Debug("updated rotated secret", "secret", klog.KObj(secret))
+		}
+		if !nextCheck.IsZero() {
+			ctx.Queue.AddAfter(ctx.Key, nextCheck.Sub(c.clock.Now()))
+		}
+
+		c.setCacheFunc(secret.Data[symmetricSecretDataKey], secret.Data[previousSymmetricSecretDataKey])
 		return nil
 	}
 
@@ -101,7 +127,7 @@ func (c *supervisorSecretsController) Sync(ctx controllerlib.Context) error {
 		return fmt.Errorf("failed to create/update secret %s/%s: %w", newSecret.Namespace, newSecret.Name, err)
 	}
 
-	c.setCacheFunc(newSecret.Data[symmetricSecretDataKey])
+	c.setCacheFunc(newSecret.Data[symmetricSecretDataKey], newSecret.Data[previousSymmetricSecretDataKey])
 
 	return nil
 }
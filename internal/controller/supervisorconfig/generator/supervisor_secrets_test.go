@@ -1,13 +1,15 @@
-// Copyright 2020-2021 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package generator
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	appsv1 "k8s.io/api/apps/v1"
@@ -19,6 +21,7 @@ import (
 	kubeinformers "k8s.io/client-go/informers"
 	kubernetesfake "k8s.io/client-go/kubernetes/fake"
 	kubetesting "k8s.io/client-go/testing"
+	clocktesting "k8s.io/utils/clock/testing"
 
 	"go.pinniped.dev/internal/controllerlib"
 	"go.pinniped.dev/internal/testutil"
@@ -114,6 +117,8 @@ func TestSupervisorSecretsControllerFilterSecret(t *testing.T) {
 				labels,
 				nil, // kubeClient, not needed
 				secretInformer,
+				KeyRotation{},
+				nil, // clock, not needed
 				nil, // setCache, not needed
 				withInformer.WithInformer,
 				testutil.NewObservableWithInitialEventOption().WithInitialEvent,
@@ -140,6 +145,8 @@ func TestSupervisorSecretsControllerInitialEvent(t *testing.T) {
 		nil,
 		nil, // kubeClient, not needed
 		secretInformer,
+		KeyRotation{},
+		nil, // clock, not needed
 		nil, // setCache, not needed
 		testutil.NewObservableWithInformerOption().WithInformer,
 		initialEventOption.WithInitialEvent,
@@ -196,14 +203,26 @@ func TestSupervisorSecretsControllerSync(t *testing.T) {
 
 	once := sync.Once{}
 
+	now := time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC)
+	rotation := KeyRotation{Interval: 720 * time.Hour, GracePeriod: 24 * time.Hour}
+
+	secretWithData := func(secret *corev1.Secret, data map[string][]byte) *corev1.Secret {
+		secret = secret.DeepCopy()
+		secret.Data = data
+		return secret
+	}
+
 	tests := []struct {
-		name               string
-		storedSecret       func(**corev1.Secret)
-		generateKey        func() ([]byte, error)
-		apiClient          func(*testing.T, *kubernetesfake.Clientset)
-		wantError          string
-		wantActions        []kubetesting.Action
-		wantCallbackSecret []byte
+		name                       string
+		storedSecret               func(**corev1.Secret)
+		generateKey                func() ([]byte, error)
+		rotation                   KeyRotation
+		apiClient                  func(*testing.T, *kubernetesfake.Clientset)
+		wantError                  string
+		wantActions                []kubetesting.Action
+		wantCallbackSecret         []byte
+		wantCallbackPreviousSecret []byte
+		wantRequeueAfter           time.Duration
 	}{
 		{
 			name: "when the secrets does not exist, it gets generated",
@@ -405,6 +424,130 @@ func TestSupervisorSecretsControllerSync(t *testing.T) {
 			},
 			wantError: "failed to generate secret: some generate error",
 		},
+		{
+			name:     "when rotation is configured for a valid secret without rotation state, the rotation schedule starts now",
+			rotation: rotation,
+			wantActions: []kubetesting.Action{
+				kubetesting.NewUpdateAction(secretsGVR, generatedSecretNamespace, secretWithData(generatedSecret, map[string][]byte{
+					"key":      generatedSymmetricKey,
+					"rotation": rotationStateJSON(t, now, time.Time{}),
+				})),
+			},
+			wantCallbackSecret: generatedSymmetricKey,
+			wantRequeueAfter:   720 * time.Hour,
+		},
+		{
+			name:     "when the rotation interval has elapsed, the key is rotated and the old key becomes the previous key",
+			rotation: rotation,
+			storedSecret: func(secret **corev1.Secret) {
+				(*secret).Data = map[string][]byte{
+					"key":      otherGeneratedSymmetricKey,
+					"rotation": rotationStateJSON(t, now.Add(-720*time.Hour), time.Time{}),
+				}
+			},
+			wantActions: []kubetesting.Action{
+				kubetesting.NewUpdateAction(secretsGVR, generatedSecretNamespace, secretWithData(generatedSecret, map[string][]byte{
+					"key":         generatedSymmetricKey,
+					"previousKey": otherGeneratedSymmetricKey,
+					"rotation":    rotationStateJSON(t, now, now.Add(24*time.Hour)),
+				})),
+			},
+			wantCallbackSecret:         generatedSymmetricKey,
+			wantCallbackPreviousSecret: otherGeneratedSymmetricKey,
+			wantRequeueAfter:           24 * time.Hour,
+		},
+		{
+			name:     "during the grace period, the previous key is kept",
+			rotation: rotation,
+			storedSecret: func(secret **corev1.Secret) {
+				(*secret).Data = map[string][]byte{
+					"key":         generatedSymmetricKey,
+					"previousKey": otherGeneratedSymmetricKey,
+					"rotation":    rotationStateJSON(t, now.Add(-time.Hour), now.Add(23*time.Hour)),
+				}
+			},
+			wantCallbackSecret:         generatedSymmetricKey,
+			wantCallbackPreviousSecret: otherGeneratedSymmetricKey,
+			wantRequeueAfter:           23 * time.Hour,
+		},
+		{
+			name:     "after the grace period, the previous key is removed",
+			rotation: rotation,
+			storedSecret: func(secret **corev1.Secret) {
+				(*secret).Data = map[string][]byte{
+					"key":         generatedSymmetricKey,
+					"previousKey": otherGeneratedSymmetricKey,
+					"rotation":    rotationStateJSON(t, now.Add(-24*time.Hour), now),
+				}
+			},
+			wantActions: []kubetesting.Action{
+				kubetesting.NewUpdateAction(secretsGVR, generatedSecretNamespace, secretWithData(generatedSecret, map[string][]byte{
+					"key":      generatedSymmetricKey,
+					"rotation": rotationStateJSON(t, now.Add(-24*time.Hour), time.Time{}),
+				})),
+			},
+			wantCallbackSecret: generatedSymmetricKey,
+			wantRequeueAfter:   696 * time.Hour,
+		},
+		{
+			name: "when rotation is no longer configured, the previous key is kept until the end of its grace period",
+			storedSecret: func(secret **corev1.Secret) {
+				(*secret).Data = map[string][]byte{
+					"key":         generatedSymmetricKey,
+					"previousKey": otherGeneratedSymmetricKey,
+					"rotation":    rotationStateJSON(t, now.Add(-time.Hour), now.Add(23*time.Hour)),
+				}
+			},
+			wantCallbackSecret:         generatedSymmetricKey,
+			wantCallbackPreviousSecret: otherGeneratedSymmetricKey,
+			wantRequeueAfter:           23 * time.Hour,
+		},
+		{
+			name: "when rotation is no longer configured, the rotation state is removed",
+			storedSecret: func(secret **corev1.Secret) {
+				(*secret).Data = map[string][]byte{
+					"key":      generatedSymmetricKey,
+					"rotation": rotationStateJSON(t, now.Add(-time.Hour), time.Time{}),
+				}
+			},
+			wantActions: []kubetesting.Action{
+				kubetesting.NewUpdateAction(secretsGVR, generatedSecretNamespace, secretWithData(generatedSecret, map[string][]byte{
+					"key": generatedSymmetricKey,
+				})),
+			},
+			wantCallbackSecret: generatedSymmetricKey,
+		},
+		{
+			name:     "an error is returned when generating the rotated key fails",
+			rotation: rotation,
+			storedSecret: func(secret **corev1.Secret) {
+				(*secret).Data["rotation"] = rotationStateJSON(t, now.Add(-720*time.Hour), time.Time{})
+			},
+			generateKey: func() ([]byte, error) {
+				return nil, errors.New("some generate error")
+			},
+			wantError: "failed to rotate secret some-namespace/some-name-abc123: some generate error",
+		},
+		{
+			name:     "an error is returned when updating the rotated secret fails",
+			rotation: rotation,
+			storedSecret: func(secret **corev1.Secret) {
+				(*secret).Data["rotation"] = rotationStateJSON(t, now.Add(-720*time.Hour), time.Time{})
+			},
+			apiClient: func(t *testing.T, client *kubernetesfake.Clientset) {
+				client.PrependReactor("update", "secrets", func(action kubetesting.Action) (bool, runtime.Object, error) {
+					return true, nil, errors.New("some update error")
+				})
+			},
+			wantActions: []kubetesting.Action{
+				kubetesting.NewUpdateAction(secretsGVR, generatedSecretNamespace, secretWithData(generatedSecret, map[string][]byte{
+					"key":         generatedSymmetricKey,
+					"previousKey": generatedSymmetricKey,
+					"rotation":    rotationStateJSON(t, now, now.Add(24*time.Hour)),
+				})),
+			},
+			wantError: "failed to update rotated secret some-namespace/some-name-abc123: some update error",
+		},
 	}
 	for _, test := range tests {
 		test := test
@@ -440,15 +583,18 @@ func TestSupervisorSecretsControllerSync(t *testing.T) {
 			informers := kubeinformers.NewSharedInformerFactory(informerClient, 0)
 			secrets := informers.Core().V1().Secrets()
 
-			var callbackSecret []byte
+			var callbackSecret, callbackPreviousSecret []byte
 			c := NewSupervisorSecretsController(
 				owner,
 				labels,
 				apiClient,
 				secrets,
-				func(secret []byte) {
+				test.rotation,
+				clocktesting.NewFakeClock(now),
+				func(secret, previousSecret []byte) {
 					require.Nil(t, callbackSecret, "callback was called twice")
 					callbackSecret = secret
+					callbackPreviousSecret = previousSecret
 				},
 				testutil.NewObservableWithInformerOption().WithInformer,
 				testutil.NewObservableWithInitialEventOption().WithInitialEvent,
@@ -458,12 +604,14 @@ func TestSupervisorSecretsControllerSync(t *testing.T) {
 			informers.Start(ctx.Done())
 			controllerlib.TestRunSynchronously(t, c)
 
+			queue := &testQueue{t: t}
 			err := controllerlib.TestSync(t, c, controllerlib.Context{
 				Context: ctx,
 				Key: controllerlib.Key{
 					Namespace: generatedSecretNamespace,
 					Name:      generatedSecretName,
 				},
+				Queue: queue,
 			})
 			if test.wantError != "" {
 				require.EqualError(t, err, test.wantError)
@@ -477,6 +625,41 @@ func TestSupervisorSecretsControllerSync(t *testing.T) {
 			require.Equal(t, test.wantActions, apiClient.Actions())
 
 			require.Equal(t, test.wantCallbackSecret, callbackSecret)
+			require.Equal(t, test.wantCallbackPreviousSecret, callbackPreviousSecret)
+
+			require.Equal(t, test.wantRequeueAfter != 0, queue.called)
+			require.Equal(t, test.wantRequeueAfter, queue.duration)
 		})
 	}
 }
+
+func rotationStateJSON(t *testing.T, activatedAt, previousKeyExpiresAt time.Time) []byte {
+	t.Helper()
+
+	stateJSON, err := json.Marshal(&symmetricKeyRotationState{
+		ActivatedAt:          activatedAt,
+		PreviousKeyExpiresAt: previousKeyExpiresAt,
+	})
+	require.NoError(t, err)
+	return stateJSON
+}
+
+type testQueue struct {
+	t *testing.T
+
+	called   bool
+	key      controllerlib.Key
+	duration time.Duration
+
+	controllerlib.Queue // panic if any other methods called
+}
+
+func (q *testQueue) AddAfter(key controllerlib.Key, duration time.Duration) {
+	q.t.Helper()
+
+	require.False(q.t, q.called, "AddAfter should only be called once")
+
+	q.called = true
+	q.key = key
+	q.duration = duration
+}
@@ -0,0 +1,326 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package githubupstreamwatcher implements a controller which watches GitHubIdentityProviders.
+package githubupstreamwatcher
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/oauth2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	corev1informers "k8s.io/client-go/informers/core/v1"
+
+	"go.pinniped.dev/generated/latest/apis/supervisor/idp/v1alpha1"
+	pinnipedclientset "go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned"
+	idpinformers "go.pinniped.dev/generated/latest/client/supervisor/informers/externalversions/idp/v1alpha1"
+	pinnipedcontroller "go.pinniped.dev/internal/controller"
+	"go.pinniped.dev/internal/controller/conditionsutil"
+	"go.pinniped.dev/internal/controller/supervisorconfig/upstreamwatchers"
+	"go.pinniped.dev/internal/controllerlib"
+	"go.pinniped.dev/internal/net/phttp"
+	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/plog"
+	"go.pinniped.dev/internal/upstreamgithub"
+)
+
+const (
+	// Setup for the name of our controller in logs.
+	gitHubControllerName = "github-upstream-observer"
+
+	// Constants related to the client credentials Secret.
+	gitHubClientSecretType corev1.SecretType = "secrets.pinniped.dev/github-client"
+
+	clientIDDataKey     = "clientID"
+	clientSecretDataKey = "clientSecret"
+
+	// Constants related to conditions.
+	typeClientCredentialsValid     = "ClientCredentialsValid" //nolint:gosec // this is not a credential
+	typeHostValid                  = "HostValid"
+	typeTLSConfigurationValid      = "TLSConfigurationValid"
+	typeOrganizationsPolicyValid   = "OrganizationsPolicyValid"
+	reasonInvalidHost              = "InvalidHost"
+	reasonInvalidOrganizationsSpec = "InvalidOrganizationsSpec"
+)
+
+// UpstreamGitHubIdentityProviderICache is a thread safe cache that holds a list of validated upstream GitHub IDP configurations.
+type UpstreamGitHubIdentityProviderICache interface {
+	SetGitHubIdentityProviders([]provider.UpstreamGitHubIdentityProviderI)
+}
+
+type gitHubWatcherController struct {
+	cache                          UpstreamGitHubIdentityProviderICache
+	client                         pinnipedclientset.Interface
+	gitHubIdentityProviderInformer idpinformers.GitHubIdentityProviderInformer
+	secretInformer                 corev1informers.SecretInformer
+}
+
+// New instantiates a new controllerlib.Controller which will populate the provided UpstreamGitHubIdentityProviderICache.
+func New(
+	idpCache UpstreamGitHubIdentityProviderICache,
+	client pinnipedclientset.Interface,
+	gitHubIdentityProviderInformer idpinformers.GitHubIdentityProviderInformer,
+	secretInformer corev1informers.SecretInformer,
+	withInformer pinnipedcontroller.WithInformerOptionFunc,
+) controllerlib.Controller {
+	c := gitHubWatcherController{
+		cache:                          idpCache,
+		client:                         client,
+		gitHubIdentityProviderInformer: gitHubIdentityProviderInformer,
+		secretInformer:                 secretInformer,
+	}
+	return controllerlib.New(
+		controllerlib.Config{Name: gitHubControllerName, Syncer: &c},
+		withInformer(
+			gitHubIdentityProviderInformer,
+			pinnipedcontroller.MatchAnythingFilter(pinnipedcontroller.SingletonQueue()),
+			controllerlib.InformerOption{},
+		),
+		withInformer(
+			secretInformer,
+			pinnipedcontroller.MatchAnySecretOfTypeFilter(gitHubClientSecretType, pinnipedcontroller.SingletonQueue()),
+			controllerlib.InformerOption{},
+		),
+	)
+}
+
+// Sync implements controllerlib.Syncer.
+func (c *gitHubWatcherController) Sync(ctx controllerlib.Context) error {
+	actualUpstreams, err := c.gitHubIdentityProviderInformer.Lister().List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("failed to list GitHubIdentityProviders: %w", err)
+	}
+
+	requeue := false
+	validatedUpstreams := make([]provider.UpstreamGitHubIdentityProviderI, 0, len(actualUpstreams))
+	for _, upstream := range actualUpstreams {
+		valid := c.validateUpstream(ctx.Context, upstream)
+		if valid == nil {
+			requeue = true
+		} else {
+			validatedUpstreams = append(validatedUpstreams, valid)
+		}
+	}
+	c.cache.SetGitHubIdentityProviders(validatedUpstreams)
+	if requeue {
+		return controllerlib.ErrSyntheticRequeue
+	}
+	return nil
+}
+
+// validateUpstream validates the provided v1alpha1.GitHubIdentityProvider and returns the validated configuration as a
+// provider.UpstreamGitHubIdentityProviderI. As a side effect, it also updates the status of the v1alpha1.GitHubIdentityProvider.
+func (c *gitHubWatcherController) validateUpstream(ctx context.Context, upstream *v1alpha1.GitHubIdentityProvider) provider.UpstreamGitHubIdentityProviderI {
+	result := upstreamgithub.ProviderConfig{
+		Name:                 upstream.Name,
+		ResourceUID:          upstream.UID,
+		UsernameAttribute:    v1alpha1.GitHubUsernameLoginAndID,
+		GroupNameAttribute:   v1alpha1.GitHubUseTeamSlugForGroupName,
+		AllowedOrganizations: upstream.Spec.AllowAuthentication.Organizations.Allowed,
+		OAuth2Config:         &oauth2.Config{Scopes: upstreamgithub.Scopes},
+	}
+	if upstream.Spec.Claims.Username != nil {
+		result.UsernameAttribute = *upstream.Spec.Claims.Username
+	}
+	if upstream.Spec.Claims.Groups != nil {
+		result.GroupNameAttribute = *upstream.Spec.Claims.Groups
+	}
+
+	conditions := []*v1alpha1.Condition{
+		c.validateSecret(upstream, &result),
+		validateHost(upstream, &result),
+		validateTLS(upstream, &result),
+		validateOrganizationsPolicy(upstream),
+	}
+
+	if hadErrorCondition := c.updateStatus(ctx, upstream, conditions); hadErrorCondition {
+		return nil
+	}
+	return &result
+}
+
+// validateSecret validates the .spec.client.secretName field and returns the appropriate ClientCredentialsValid condition.
+func (c *gitHubWatcherController) validateSecret(upstream *v1alpha1.GitHubIdentityProvider, result *upstreamgithub.ProviderConfig) *v1alpha1.Condition {
+	secretName := upstream.Spec.Client.SecretName
+
+	// Fetch the Secret from informer cache.
+	secret, err := c.secretInformer.Lister().Secrets(upstream.Namespace).Get(secretName)
+	if err != nil {
+		return &v1alpha1.Condition{
+			Type:    typeClientCredentialsValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  upstreamwatchers.ReasonNotFound,
+			Message: err.Error(),
+		}
+	}
+
+	// Validate the secret .type field.
+	if secret.Type != gitHubClientSecretType {
+		return &v1alpha1.Condition{
+			Type:    typeClientCredentialsValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  upstreamwatchers.ReasonWrongType,
+			Message: fmt.Sprintf("referenced Secret %q has wrong type %q (should be %q)", secretName, secret.Type, gitHubClientSecretType),
+		}
+	}
+
+	// Validate the secret .data field.
+	clientID := secret.Data[clientIDDataKey]
+	clientSecret := secret.Data[clientSecretDataKey]
+	if len(clientID) == 0 || len(clientSecret) == 0 {
+		return &v1alpha1.Condition{
+			Type:    typeClientCredentialsValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  upstreamwatchers.ReasonMissingKeys,
+			Message: fmt.Sprintf("referenced Secret %q is missing required keys %q", secretName, []string{clientIDDataKey, clientSecretDataKey}),
+		}
+	}
+
+	// If everything is valid, update the result and set the condition to true.
+	result.OAuth2Config.ClientID = string(clientID)
+	result.OAuth2Config.ClientSecret = string(clientSecret)
+	return &v1alpha1.Condition{
+		Type:    typeClientCredentialsValid,
+		Status:  v1alpha1.ConditionTrue,
+		Reason:  upstreamwatchers.ReasonSuccess,
+		Message: "loaded client credentials",
+	}
+}
+
+// validateHost validates the .spec.githubAPI.host field and returns the appropriate HostValid condition.
+func validateHost(upstream *v1alpha1.GitHubIdentityProvider, result *upstreamgithub.ProviderConfig) *v1alpha1.Condition {
+	host := upstreamgithub.PublicGitHubHost
+	if upstream.Spec.GitHubAPI.Host != nil {
+		host = *upstream.Spec.GitHubAPI.Host
+	}
+
+	// The host may include a port, but nothing else which could appear in a URL.
+	parsed, err := url.Parse("https://" + host)
+	if err != nil || parsed.Host != host || parsed.Hostname() == "" || parsed.User != nil || parsed.Path != "" || parsed.RawQuery != "" || parsed.Fragment != "" {
+		return &v1alpha1.Condition{
+			Type:    typeHostValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  reasonInvalidHost,
+			Message: fmt.Sprintf("spec.githubAPI.host (%q) is not a valid hostname or hostname:port", host),
+		}
+	}
+
+	endpoint, apiBaseURL := upstreamgithub.Endpoints(host)
+	result.Host = host
+	result.APIBaseURL = apiBaseURL
+	result.OAuth2Config.Endpoint = endpoint
+	return &v1alpha1.Condition{
+		Type:    typeHostValid,
+		Status:  v1alpha1.ConditionTrue,
+		Reason:  upstreamwatchers.ReasonSuccess,
+		Message: fmt.Sprintf("spec.githubAPI.host (%q) is valid", host),
+	}
+}
+
+// validateTLS validates the .spec.githubAPI.tls field and returns the appropriate TLSConfigurationValid condition.
+func validateTLS(upstream *v1alpha1.GitHubIdentityProvider, result *upstreamgithub.ProviderConfig) *v1alpha1.Condition {
+	httpClient, err := getClient(upstream)
+	if err != nil {
+		return &v1alpha1.Condition{
+			Type:    typeTLSConfigurationValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  upstreamwatchers.ReasonInvalidTLSConfig,
+			Message: err.Error(),
+		}
+	}
+
+	result.HTTPClient = httpClient
+	return &v1alpha1.Condition{
+		Type:    typeTLSConfigurationValid,
+		Status:  v1alpha1.ConditionTrue,
+		Reason:  upstreamwatchers.ReasonSuccess,
+		Message: "spec.githubAPI.tls is valid",
+	}
+}
+
+// validateOrganizationsPolicy validates the .spec.allowAuthentication.organizations field and returns the
+// appropriate OrganizationsPolicyValid condition.
+func validateOrganizationsPolicy(upstream *v1alpha1.GitHubIdentityProvider) *v1alpha1.Condition {
+	organizations := upstream.Spec.AllowAuthentication.Organizations
+	policy := v1alpha1.GitHubAllowedAuthOrganizationsPolicyOnlyUsersFromAllowedOrganizations
+	if organizations.Policy != nil {
+		policy = *organizations.Policy
+	}
+
+	var message string
+	switch {
+	case policy == v1alpha1.GitHubAllowedAuthOrganizationsPolicyOnlyUsersFromAllowedOrganizations && len(organizations.Allowed) == 0:
+		message = fmt.Sprintf("spec.allowAuthentication.organizations.allowed must not be empty when policy is %q", policy)
+	case policy == v1alpha1.GitHubAllowedAuthOrganizationsPolicyAllGitHubUsers && len(organizations.Allowed) > 0:
+		message = fmt.Sprintf("spec.allowAuthentication.organizations.allowed must be empty when policy is %q", policy)
+	case policy != v1alpha1.GitHubAllowedAuthOrganizationsPolicyOnlyUsersFromAllowedOrganizations &&
+		policy != v1alpha1.GitHubAllowedAuthOrganizationsPolicyAllGitHubUsers:
+		message = fmt.Sprintf("spec.allowAuthentication.organizations.policy (%q) is not a supported policy", policy)
+	default:
+		return &v1alpha1.Condition{
+			Type:    typeOrganizationsPolicyValid,
+			Status:  v1alpha1.ConditionTrue,
+			Reason:  upstreamwatchers.ReasonSuccess,
+			Message: fmt.Sprintf("spec.allowAuthentication.organizations.policy (%q) is valid", policy),
+		}
+	}
+
+	return &v1alpha1.Condition{
+		Type:    typeOrganizationsPolicyValid,
+		Status:  v1alpha1.ConditionFalse,
+		Reason:  reasonInvalidOrganizationsSpec,
+		Message: message,
+	}
+}
+
+func (c *gitHubWatcherController) updateStatus(ctx context.Context, upstream *v1alpha1.GitHubIdentityProvider, conditions []*v1alpha1.Condition) bool {
+	log := plog.WithValues("namespace", upstream.Namespace, "name", upstream.Name)
+	updated := upstream.DeepCopy()
+
+	hadErrorCondition := conditionsutil.MergeIDPConditions(conditions, upstream.Generation, &updated.Status.Conditions, log)
+
+	updated.Status.Phase = v1alpha1.GitHubPhaseReady
+	if hadErrorCondition {
+		updated.Status.Phase = v1alpha1.GitHubPhaseError
+	}
+
+	if equality.Semantic.DeepEqual(upstream, updated) {
+		return hadErrorCondition // nothing to update
+	}
+
+	_, err := c.client.
+		IDPV1alpha1().
+		GitHubIdentityProviders(upstream.Namespace).
+		UpdateStatus(ctx, updated, metav1.UpdateOptions{})
+	if err != nil {
+		log.Error("failed to update status", err)
+	}
+	return hadErrorCondition
+}
+
+func getClient(upstream *v1alpha1.GitHubIdentityProvider) (*http.Client, error) {
+	var rootCAs *x509.CertPool
+	if tls := upstream.Spec.GitHubAPI.TLS; tls != nil && tls.CertificateAuthorityData != "" {
+		bundle, err := base64.StdEncoding.DecodeString(tls.CertificateAuthorityData)
+		if err != nil {
+			return nil, fmt.Errorf("spec.githubAPI.tls.certificateAuthorityData is invalid: %w", err)
+		}
+		rootCAs = x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("spec.githubAPI.tls.certificateAuthorityData is invalid: %w", upstreamwatchers.ErrNoCertificates)
+		}
+	}
+
+	c := phttp.Default(rootCAs)
+	c.Timeout = time.Minute
+	return c, nil
+}
@@ -0,0 +1,372 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package githubupstreamwatcher
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/pointer"
+
+	"go.pinniped.dev/generated/latest/apis/supervisor/idp/v1alpha1"
+	pinnipedfake "go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned/fake"
+	pinnipedinformers "go.pinniped.dev/generated/latest/client/supervisor/informers/externalversions"
+	"go.pinniped.dev/internal/controllerlib"
+	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/testutil"
+	"go.pinniped.dev/internal/upstreamgithub"
+)
+
+func TestGitHubUpstreamWatcherControllerSync(t *testing.T) {
+	t.Parallel()
+	now := metav1.NewTime(time.Now().UTC())
+
+	const (
+		testNamespace  = "test-namespace"
+		testName       = "test-name"
+		testUID        = types.UID("test-uid")
+		testSecretName = "test-client-secret"
+	)
+
+	testCA, _ := testutil.TLSTestServer(t, nil)
+	testCABase64 := base64.StdEncoding.EncodeToString([]byte(testCA))
+
+	usernameID := v1alpha1.GitHubUsernameID
+	groupsFromTeamNames := v1alpha1.GitHubUseTeamNameForGroupName
+	allGitHubUsers := v1alpha1.GitHubAllowedAuthOrganizationsPolicyAllGitHubUsers
+
+	objectMeta := metav1.ObjectMeta{Namespace: testNamespace, Name: testName, UID: testUID, Generation: 1234}
+	condition := func(conditionType, status, reason, message string) v1alpha1.Condition {
+		return v1alpha1.Condition{
+			Type:               conditionType,
+			Status:             v1alpha1.ConditionStatus(status),
+			LastTransitionTime: now,
+			Reason:             reason,
+			Message:            message,
+			ObservedGeneration: 1234,
+		}
+	}
+	clientCredentialsValid := condition("ClientCredentialsValid", "True", "Success", "loaded client credentials")
+	hostValid := condition("HostValid", "True", "Success", `spec.githubAPI.host ("github.com") is valid`)
+	organizationsPolicyValid := condition("OrganizationsPolicyValid", "True", "Success",
+		`spec.allowAuthentication.organizations.policy ("OnlyUsersFromAllowedOrganizations") is valid`)
+	tlsConfigurationValid := condition("TLSConfigurationValid", "True", "Success", "spec.githubAPI.tls is valid")
+
+	validSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testSecretName},
+		Type:       "secrets.pinniped.dev/github-client",
+		Data:       map[string][]byte{"clientID": []byte("test-client-id"), "clientSecret": []byte("test-client-secret")},
+	}
+	spec := func(edit func(spec *v1alpha1.GitHubIdentityProviderSpec)) v1alpha1.GitHubIdentityProviderSpec {
+		s := v1alpha1.GitHubIdentityProviderSpec{
+			AllowAuthentication: v1alpha1.GitHubAllowAuthenticationSpec{
+				Organizations: v1alpha1.GitHubOrganizationsSpec{Allowed: []string{"my-org"}},
+			},
+			Client: v1alpha1.GitHubClientSpec{SecretName: testSecretName},
+		}
+		edit(&s)
+		return s
+	}
+
+	tests := []struct {
+		name                   string
+		inputUpstreams         []runtime.Object
+		inputSecrets           []runtime.Object
+		wantErr                string
+		wantResultingCache     []*upstreamgithub.ProviderConfig
+		wantResultingUpstreams []v1alpha1.GitHubIdentityProvider
+	}{
+		{
+			name:               "no upstreams",
+			wantResultingCache: []*upstreamgithub.ProviderConfig{},
+		},
+		{
+			name: "valid upstream with defaults",
+			inputUpstreams: []runtime.Object{&v1alpha1.GitHubIdentityProvider{
+				ObjectMeta: objectMeta,
+				Spec:       spec(func(s *v1alpha1.GitHubIdentityProviderSpec) {}),
+			}},
+			inputSecrets: []runtime.Object{validSecret},
+			wantResultingCache: []*upstreamgithub.ProviderConfig{{
+				Name:                 testName,
+				ResourceUID:          testUID,
+				Host:                 "github.com",
+				APIBaseURL:           "https://api.github.com",
+				UsernameAttribute:    "login:id",
+				GroupNameAttribute:   "slug",
+				AllowedOrganizations: []string{"my-org"},
+			}},
+			wantResultingUpstreams: []v1alpha1.GitHubIdentityProvider{{
+				ObjectMeta: objectMeta,
+				Status: v1alpha1.GitHubIdentityProviderStatus{
+					Phase:      "Ready",
+					Conditions: []v1alpha1.Condition{clientCredentialsValid, hostValid, organizationsPolicyValid, tlsConfigurationValid},
+				},
+			}},
+		},
+		{
+			name: "valid upstream for GitHub Enterprise Server which allows all users",
+			inputUpstreams: []runtime.Object{&v1alpha1.GitHubIdentityProvider{
+				ObjectMeta: objectMeta,
+				Spec: spec(func(s *v1alpha1.GitHubIdentityProviderSpec) {
+					s.GitHubAPI = v1alpha1.GitHubAPIConfig{
+						Host: pointer.String("github.example.com:8443"),
+						TLS:  &v1alpha1.TLSSpec{CertificateAuthorityData: testCABase64},
+					}
+					s.Claims = v1alpha1.GitHubClaims{
+						Username: &usernameID,
+						Groups:   &groupsFromTeamNames,
+					}
+					s.AllowAuthentication.Organizations = v1alpha1.GitHubOrganizationsSpec{
+						Policy: &allGitHubUsers,
+					}
+				}),
+			}},
+			inputSecrets: []runtime.Object{validSecret},
+			wantResultingCache: []*upstreamgithub.ProviderConfig{{
+				Name:               testName,
+				ResourceUID:        testUID,
+				Host:               "github.example.com:8443",
+				APIBaseURL:         "https://github.example.com:8443/api/v3",
+				UsernameAttribute:  "id",
+				GroupNameAttribute: "name",
+			}},
+			wantResultingUpstreams: []v1alpha1.GitHubIdentityProvider{{
+				ObjectMeta: objectMeta,
+				Status: v1alpha1.GitHubIdentityProviderStatus{
+					Phase: "Ready",
+					Conditions: []v1alpha1.Condition{
+						clientCredentialsValid,
+						condition("HostValid", "True", "Success", `spec.githubAPI.host ("github.example.com:8443") is valid`),
+						condition("OrganizationsPolicyValid", "True", "Success",
+							`spec.allowAuthentication.organizations.policy ("AllGitHubUsers") is valid`),
+						tlsConfigurationValid,
+					},
+				},
+			}},
+		},
+		{
+			name: "secret not found",
+			inputUpstreams: []runtime.Object{&v1alpha1.GitHubIdentityProvider{
+				ObjectMeta: objectMeta,
+				Spec:       spec(func(s *v1alpha1.GitHubIdentityProviderSpec) {}),
+			}},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingCache: []*upstreamgithub.ProviderConfig{},
+			wantResultingUpstreams: []v1alpha1.GitHubIdentityProvider{{
+				ObjectMeta: objectMeta,
+				Status: v1alpha1.GitHubIdentityProviderStatus{
+					Phase: "Error",
+					Conditions: []v1alpha1.Condition{
+						condition("ClientCredentialsValid", "False", "SecretNotFound", `secret "test-client-secret" not found`),
+						hostValid, organizationsPolicyValid, tlsConfigurationValid,
+					},
+				},
+			}},
+		},
+		{
+			name: "secret has wrong type and missing keys",
+			inputUpstreams: []runtime.Object{
+				&v1alpha1.GitHubIdentityProvider{
+					ObjectMeta: objectMeta,
+					Spec:       spec(func(s *v1alpha1.GitHubIdentityProviderSpec) {}),
+				},
+				&v1alpha1.GitHubIdentityProvider{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "other-name", UID: "other-uid", Generation: 1234},
+					Spec: spec(func(s *v1alpha1.GitHubIdentityProviderSpec) {
+						s.Client.SecretName = "secret-missing-keys"
+					}),
+				},
+			},
+			inputSecrets: []runtime.Object{
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testSecretName},
+					Type:       "secrets.pinniped.dev/oidc-client",
+					Data:       validSecret.Data,
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "secret-missing-keys"},
+					Type:       "secrets.pinniped.dev/github-client",
+					Data:       map[string][]byte{"clientID": []byte("test-client-id")},
+				},
+			},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingCache: []*upstreamgithub.ProviderConfig{},
+			wantResultingUpstreams: []v1alpha1.GitHubIdentityProvider{
+				{
+					ObjectMeta: objectMeta,
+					Status: v1alpha1.GitHubIdentityProviderStatus{
+						Phase: "Error",
+						Conditions: []v1alpha1.Condition{
+							condition("ClientCredentialsValid", "False", "SecretWrongType",
+								`referenced Secret "test-client-secret" has wrong type "secrets.pinniped.dev/oidc-client" (should be "secrets.pinniped.dev/github-client")`),
+							hostValid, organizationsPolicyValid, tlsConfigurationValid,
+						},
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "other-name", UID: "other-uid", Generation: 1234},
+					Status: v1alpha1.GitHubIdentityProviderStatus{
+						Phase: "Error",
+						Conditions: []v1alpha1.Condition{
+							condition("ClientCredentialsValid", "False", "SecretMissingKeys",
+								`referenced Secret "secret-missing-keys" is missing required keys ["clientID" "clientSecret"]`),
+							hostValid, organizationsPolicyValid, tlsConfigurationValid,
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "invalid host, TLS, and organizations policy",
+			inputUpstreams: []runtime.Object{&v1alpha1.GitHubIdentityProvider{
+				ObjectMeta: objectMeta,
+				Spec: spec(func(s *v1alpha1.GitHubIdentityProviderSpec) {
+					s.GitHubAPI = v1alpha1.GitHubAPIConfig{
+						Host: pointer.String("https://github.example.com/path"),
+						TLS:  &v1alpha1.TLSSpec{CertificateAuthorityData: base64.StdEncoding.EncodeToString([]byte("not a PEM"))},
+					}
+					s.AllowAuthentication.Organizations.Policy = &allGitHubUsers
+				}),
+			}},
+			inputSecrets:       []runtime.Object{validSecret},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingCache: []*upstreamgithub.ProviderConfig{},
+			wantResultingUpstreams: []v1alpha1.GitHubIdentityProvider{{
+				ObjectMeta: objectMeta,
+				Status: v1alpha1.GitHubIdentityProviderStatus{
+					Phase: "Error",
+					Conditions: []v1alpha1.Condition{
+						clientCredentialsValid,
+						condition("HostValid", "False", "InvalidHost",
+							`spec.githubAPI.host ("https://github.example.com/path") is not a valid hostname or hostname:port`),
+						condition("OrganizationsPolicyValid", "False", "InvalidOrganizationsSpec",
+							`spec.allowAuthentication.organizations.allowed must be empty when policy is "AllGitHubUsers"`),
+						condition("TLSConfigurationValid", "False", "InvalidTLSConfig",
+							"spec.githubAPI.tls.certificateAuthorityData is invalid: no certificates found"),
+					},
+				},
+			}},
+		},
+		{
+			name: "allowed organizations are required by the default policy",
+			inputUpstreams: []runtime.Object{&v1alpha1.GitHubIdentityProvider{
+				ObjectMeta: objectMeta,
+				Spec: spec(func(s *v1alpha1.GitHubIdentityProviderSpec) {
+					s.AllowAuthentication.Organizations.Allowed = nil
+				}),
+			}},
+			inputSecrets:       []runtime.Object{validSecret},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingCache: []*upstreamgithub.ProviderConfig{},
+			wantResultingUpstreams: []v1alpha1.GitHubIdentityProvider{{
+				ObjectMeta: objectMeta,
+				Status: v1alpha1.GitHubIdentityProviderStatus{
+					Phase: "Error",
+					Conditions: []v1alpha1.Condition{
+						clientCredentialsValid, hostValid,
+						condition("OrganizationsPolicyValid", "False", "InvalidOrganizationsSpec",
+							`spec.allowAuthentication.organizations.allowed must not be empty when policy is "OnlyUsersFromAllowedOrganizations"`),
+						tlsConfigurationValid,
+					},
+				},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			fakePinnipedClient := pinnipedfake.NewSimpleClientset(tt.inputUpstreams...)
+			pinnipedInformers := pinnipedinformers.NewSharedInformerFactory(fakePinnipedClient, 0)
+			fakeKubeClient := fake.NewSimpleClientset(tt.inputSecrets...)
+			kubeInformers := informers.NewSharedInformerFactory(fakeKubeClient, 0)
+			cache := provider.NewDynamicUpstreamIDPProvider()
+			cache.SetGitHubIdentityProviders([]provider.UpstreamGitHubIdentityProviderI{
+				&upstreamgithub.ProviderConfig{Name: "initial-entry"},
+			})
+
+			controller := New(
+				cache,
+				fakePinnipedClient,
+				pinnipedInformers.IDP().V1alpha1().GitHubIdentityProviders(),
+				kubeInformers.Core().V1().Secrets(),
+				controllerlib.WithInformer,
+			)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			pinnipedInformers.Start(ctx.Done())
+			kubeInformers.Start(ctx.Done())
+			controllerlib.TestRunSynchronously(t, controller)
+
+			syncCtx := controllerlib.Context{Context: ctx, Key: controllerlib.Key{}}
+
+			if err := controllerlib.TestSync(t, controller, syncCtx); tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			actualIDPList := cache.GetGitHubIdentityProviders()
+			require.Len(t, actualIDPList, len(tt.wantResultingCache))
+			for i := range actualIDPList {
+				actualIDP := actualIDPList[i].(*upstreamgithub.ProviderConfig)
+				require.Equal(t, "test-client-id", actualIDP.GetClientID())
+				require.Equal(t, "test-client-secret", actualIDP.OAuth2Config.ClientSecret)
+				require.Equal(t, "https://"+tt.wantResultingCache[i].Host+"/login/oauth/authorize", actualIDP.GetAuthorizationURL())
+				require.Equal(t, []string{"read:user", "read:org"}, actualIDP.GetScopes())
+				require.NotNil(t, actualIDP.HTTPClient)
+				actualIDP.OAuth2Config = nil
+				actualIDP.HTTPClient = nil
+				require.Equal(t, tt.wantResultingCache[i], actualIDP)
+			}
+
+			actualUpstreams, err := fakePinnipedClient.IDPV1alpha1().GitHubIdentityProviders(testNamespace).List(ctx, metav1.ListOptions{})
+			require.NoError(t, err)
+
+			// Assert on the expected Status of the upstreams. Preprocess the upstreams a bit so that they're easier to assert against.
+			require.ElementsMatch(t, tt.wantResultingUpstreams, normalizeGitHubUpstreams(actualUpstreams.Items, now))
+
+			// Running the sync() a second time should be idempotent, and should return the same error.
+			if err := controllerlib.TestSync(t, controller, syncCtx); tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Len(t, cache.GetGitHubIdentityProviders(), len(tt.wantResultingCache))
+		})
+	}
+}
+
+func normalizeGitHubUpstreams(upstreams []v1alpha1.GitHubIdentityProvider, now metav1.Time) []v1alpha1.GitHubIdentityProvider {
+	result := make([]v1alpha1.GitHubIdentityProvider, 0, len(upstreams))
+	for _, u := range upstreams {
+		normalized := u.DeepCopy()
+
+		// We're only interested in comparing the status, so zero out the spec.
+		normalized.Spec = v1alpha1.GitHubIdentityProviderSpec{}
+
+		// Round down the LastTransitionTime values to `now` if they were just updated. This makes
+		// it much easier to encode assertions about the expected timestamps.
+		for i := range normalized.Status.Conditions {
+			if time.Since(normalized.Status.Conditions[i].LastTransitionTime.Time) < 5*time.Second {
+				normalized.Status.Conditions[i].LastTransitionTime = now
+			}
+		}
+		result = append(result, *normalized)
+	}
+
+	return result
+}
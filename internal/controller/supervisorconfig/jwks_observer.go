@@ -1,4 +1,4 @@
-// Copyright 2020-2021 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package supervisorconfig
@@ -27,6 +27,7 @@ type IssuerToJWKSMapSetter interface {
 	SetIssuerToJWKSMap(
 		issuerToJWKSMap map[string]*jose.JSONWebKeySet,
 		issuerToActiveJWKMap map[string]*jose.JSONWebKey,
+		issuerToAdditionalActiveJWKsMap map[string]*jose.JSONWebKeySet,
 	)
 }
 
@@ -74,6 +75,7 @@ func (c *jwksObserverController) Sync(ctx controllerlib.Context) error {
 	// can cause the map to need to be updated.
 	issuerToJWKSMap := map[string]*jose.JSONWebKeySet{}
 	issuerToActiveJWKMap := map[string]*jose.JSONWebKey{}
+	issuerToAdditionalActiveJWKsMap := map[string]*jose.JSONWebKeySet{}
 
 	for _, provider := range allProviders {
 		secretRef := provider.Status.Secrets.JWKS
@@ -99,6 +101,18 @@ func (c *jwksObserverController) Sync(ctx controllerlib.Context) error {
 
 		issuerToJWKSMap[provider.Spec.Issuer] = &jwksFromSecret
 		issuerToActiveJWKMap[provider.Spec.Issuer] = &activeJWKFromSecret
+
+		// The additional active JWKs are only present when the FederationDomain has more than one ID token
+		// signing algorithm. Tokens which need those algorithms cannot be signed until they are valid.
+		if additionalActiveJWKsData, ok := jwksSecret.Data[additionalActiveJWKsKey]; ok {
+			additionalActiveJWKsFromSecret := jose.JSONWebKeySet{}
+			err = json.Unmarshal(additionalActiveJWKsData, &additionalActiveJWKsFromSecret)
+			if err != nil {
+				plog.Debug("jwksObserverController Sync found additional active JWKs secret with Data in an unexpected format", "namespace", ns, "secretName", secretRef.Name)
+				continue
+			}
+			issuerToAdditionalActiveJWKsMap[provider.Spec.Issuer] = &additionalActiveJWKsFromSecret
+		}
 	}
 
 	plog.Debug(
@@ -108,7 +122,7 @@ func (c *jwksObserverController) Sync(ctx controllerlib.Context) error {
 		"issuerActiveJWKCount",
 		len(issuerToActiveJWKMap),
 	)
-	c.issuerToJWKSSetter.SetIssuerToJWKSMap(issuerToJWKSMap, issuerToActiveJWKMap)
+	c.issuerToJWKSSetter.SetIssuerToJWKSMap(issuerToJWKSMap, issuerToActiveJWKMap, issuerToAdditionalActiveJWKsMap)
 
 	return nil
 }
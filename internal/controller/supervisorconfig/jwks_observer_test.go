@@ -1,4 +1,4 @@
-// Copyright 2020-2021 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package supervisorconfig
@@ -107,15 +107,19 @@ type fakeIssuerToJWKSMapSetter struct {
 	setIssuerToJWKSMapWasCalled  bool
 	issuerToJWKSMapReceived      map[string]*jose.JSONWebKeySet
 	issuerToActiveJWKMapReceived map[string]*jose.JSONWebKey
+
+	issuerToAdditionalActiveJWKsMapReceived map[string]*jose.JSONWebKeySet
 }
 
 func (f *fakeIssuerToJWKSMapSetter) SetIssuerToJWKSMap(
 	issuerToJWKSMap map[string]*jose.JSONWebKeySet,
 	issuerToActiveJWKMap map[string]*jose.JSONWebKey,
+	issuerToAdditionalActiveJWKsMap map[string]*jose.JSONWebKeySet,
 ) {
 	f.setIssuerToJWKSMapWasCalled = true
 	f.issuerToJWKSMapReceived = issuerToJWKSMap
 	f.issuerToActiveJWKMapReceived = issuerToActiveJWKMap
+	f.issuerToAdditionalActiveJWKsMapReceived = issuerToAdditionalActiveJWKsMap
 }
 
 func TestJWKSObserverControllerSync(t *testing.T) {
@@ -195,6 +199,7 @@ func TestJWKSObserverControllerSync(t *testing.T) {
 				r.True(issuerToJWKSSetter.setIssuerToJWKSMapWasCalled)
 				r.Empty(issuerToJWKSSetter.issuerToJWKSMapReceived)
 				r.Empty(issuerToJWKSSetter.issuerToActiveJWKMapReceived)
+				r.Empty(issuerToJWKSSetter.issuerToAdditionalActiveJWKsMapReceived)
 			})
 		})
 
@@ -256,6 +261,18 @@ func TestJWKSObserverControllerSync(t *testing.T) {
 						},
 					},
 				}
+				federationDomainWithBadAdditionalActiveJWKsSecret := &v1alpha1.FederationDomain{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "bad-additional-active-jwks-secret-federationdomain",
+						Namespace: installedInNamespace,
+					},
+					Spec: v1alpha1.FederationDomainSpec{Issuer: "https://bad-additional-active-jwks-secret-issuer.com"},
+					Status: v1alpha1.FederationDomainStatus{
+						Secrets: v1alpha1.FederationDomainSecrets{
+							JWKS: corev1.LocalObjectReference{Name: "bad-additional-active-jwks-secret-name"},
+						},
+					},
+				}
 				federationDomainWithGoodSecret1 := &v1alpha1.FederationDomain{
 					ObjectMeta: metav1.ObjectMeta{
 						Name:      "good-secret-federationdomain1",
@@ -290,8 +307,9 @@ func TestJWKSObserverControllerSync(t *testing.T) {
 						Namespace: installedInNamespace,
 					},
 					Data: map[string][]byte{
-						"activeJWK": []byte(expectedJWK1),
-						"jwks":      []byte(`{"keys": [` + expectedJWK1 + `]}`),
+						"activeJWK":            []byte(expectedJWK1),
+						"additionalActiveJWKs": []byte(`{"keys": [` + expectedJWK2 + `]}`),
+						"jwks":                 []byte(`{"keys": [` + expectedJWK1 + `, ` + expectedJWK2 + `]}`),
 					},
 				}
 				goodJWKSSecret2 := &corev1.Secret{
@@ -331,11 +349,23 @@ func TestJWKSObserverControllerSync(t *testing.T) {
 						"jwks":      []byte(`{"keys": [` + expectedJWK2 + `]}`),
 					},
 				}
+				badAdditionalActiveJWKsSecret := &corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "bad-additional-active-jwks-secret-name",
+						Namespace: installedInNamespace,
+					},
+					Data: map[string][]byte{
+						"activeJWK":            []byte(expectedJWK2),
+						"additionalActiveJWKs": []byte("bad"),
+						"jwks":                 []byte(`{"keys": [` + expectedJWK2 + `]}`),
+					},
+				}
 				r.NoError(pinnipedInformerClient.Tracker().Add(federationDomainWithoutSecret1))
 				r.NoError(pinnipedInformerClient.Tracker().Add(federationDomainWithoutSecret2))
 				r.NoError(pinnipedInformerClient.Tracker().Add(federationDomainWithBadSecret))
 				r.NoError(pinnipedInformerClient.Tracker().Add(federationDomainWithBadJWKSSecret))
 				r.NoError(pinnipedInformerClient.Tracker().Add(federationDomainWithBadActiveJWKSecret))
+				r.NoError(pinnipedInformerClient.Tracker().Add(federationDomainWithBadAdditionalActiveJWKsSecret))
 				r.NoError(pinnipedInformerClient.Tracker().Add(federationDomainWithGoodSecret1))
 				r.NoError(pinnipedInformerClient.Tracker().Add(federationDomainWithGoodSecret2))
 				r.NoError(kubeInformerClient.Tracker().Add(goodJWKSSecret1))
@@ -343,15 +373,17 @@ func TestJWKSObserverControllerSync(t *testing.T) {
 				r.NoError(kubeInformerClient.Tracker().Add(badSecret))
 				r.NoError(kubeInformerClient.Tracker().Add(badJWKSSecret))
 				r.NoError(kubeInformerClient.Tracker().Add(badActiveJWKSecret))
+				r.NoError(kubeInformerClient.Tracker().Add(badAdditionalActiveJWKsSecret))
 			})
 
-			requireJWKSJSON := func(expectedJWKJSON string, actualJWKS *jose.JSONWebKeySet) {
+			requireJWKSJSON := func(actualJWKS *jose.JSONWebKeySet, expectedJWKJSONs ...string) {
 				r.NotNil(actualJWKS)
-				r.Len(actualJWKS.Keys, 1)
-				actualJWK := actualJWKS.Keys[0]
-				actualJWKJSON, err := json.Marshal(actualJWK)
-				r.NoError(err)
-				r.JSONEq(expectedJWKJSON, string(actualJWKJSON))
+				r.Len(actualJWKS.Keys, len(expectedJWKJSONs))
+				for i, expectedJWKJSON := range expectedJWKJSONs {
+					actualJWKJSON, err := json.Marshal(actualJWKS.Keys[i])
+					r.NoError(err)
+					r.JSONEq(expectedJWKJSON, string(actualJWKJSON))
+				}
 			}
 
 			requireJWKJSON := func(expectedJWKJSON string, actualJWK *jose.JSONWebKey) {
@@ -366,14 +398,20 @@ func TestJWKSObserverControllerSync(t *testing.T) {
 				r.NoError(controllerlib.TestSync(t, subject, *syncContext))
 
 				r.True(issuerToJWKSSetter.setIssuerToJWKSMapWasCalled)
-				r.Len(issuerToJWKSSetter.issuerToJWKSMapReceived, 2)
-				r.Len(issuerToJWKSSetter.issuerToActiveJWKMapReceived, 2)
+				r.Len(issuerToJWKSSetter.issuerToJWKSMapReceived, 3)
+				r.Len(issuerToJWKSSetter.issuerToActiveJWKMapReceived, 3)
+				r.Len(issuerToJWKSSetter.issuerToAdditionalActiveJWKsMapReceived, 1)
 
 				// the actual JWK should match the one from the test fixture that was put into the secret
-				requireJWKSJSON(expectedJWK1, issuerToJWKSSetter.issuerToJWKSMapReceived["https://issuer-with-good-secret1.com"])
+				requireJWKSJSON(issuerToJWKSSetter.issuerToJWKSMapReceived["https://issuer-with-good-secret1.com"], expectedJWK1, expectedJWK2)
 				requireJWKJSON(expectedJWK1, issuerToJWKSSetter.issuerToActiveJWKMapReceived["https://issuer-with-good-secret1.com"])
-				requireJWKSJSON(expectedJWK2, issuerToJWKSSetter.issuerToJWKSMapReceived["https://issuer-with-good-secret2.com"])
+				requireJWKSJSON(issuerToJWKSSetter.issuerToAdditionalActiveJWKsMapReceived["https://issuer-with-good-secret1.com"], expectedJWK2)
+				requireJWKSJSON(issuerToJWKSSetter.issuerToJWKSMapReceived["https://issuer-with-good-secret2.com"], expectedJWK2)
 				requireJWKJSON(expectedJWK2, issuerToJWKSSetter.issuerToActiveJWKMapReceived["https://issuer-with-good-secret2.com"])
+
+				// invalid additional active JWKs do not prevent the issuer from signing using its default active JWK
+				requireJWKSJSON(issuerToJWKSSetter.issuerToJWKSMapReceived["https://bad-additional-active-jwks-secret-issuer.com"], expectedJWK2)
+				requireJWKJSON(expectedJWK2, issuerToJWKSSetter.issuerToActiveJWKMapReceived["https://bad-additional-active-jwks-secret-issuer.com"])
 			})
 		})
 	}, spec.Parallel(), spec.Report(report.Terminal{}))
@@ -1,26 +1,34 @@
-// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package supervisorconfig
 
 import (
+	"bytes"
 	"context"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/rsa"
 	"encoding/json"
 	"fmt"
 	"io"
+	"strings"
+	"time"
 
 	"gopkg.in/square/go-jose.v2"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
 	corev1informers "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/util/retry"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
 
 	configv1alpha1 "go.pinniped.dev/generated/latest/apis/supervisor/config/v1alpha1"
 	pinnipedclientset "go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned"
@@ -28,6 +36,8 @@ import (
 	pinnipedcontroller "go.pinniped.dev/internal/controller"
 	"go.pinniped.dev/internal/controller/supervisorconfig/generator"
 	"go.pinniped.dev/internal/controllerlib"
+	"go.pinniped.dev/internal/oidc"
+	"go.pinniped.dev/internal/oidc/provider"
 	"go.pinniped.dev/internal/plog"
 )
 
@@ -41,19 +51,80 @@ const (
 	//
 	// Note! The value for this key will contain only public key material!
 	jwksKey = "jwks"
+	// nextJWKKey points to the private key which will become the active key at the next scheduled rotation. It is only
+	// present while that key is being pre-published in the JWKS.
+	//
+	// Note! The value for this key will contain private key material!
+	nextJWKKey = "nextJWK"
+	// rotationKey points to the bookkeeping for scheduled key rotation. It is only present after rotation has been
+	// configured for the FederationDomain.
+	rotationKey = "rotation"
+	// additionalActiveJWKsKey points to a JWKS of the current private keys used for signing tokens with each of the
+	// FederationDomain's ID token signing algorithms other than the first one, which uses activeJWKKey. It is only
+	// present when the FederationDomain has more than one ID token signing algorithm.
+	//
+	// Note! The value for this key will contain private key material!
+	additionalActiveJWKsKey = "additionalActiveJWKs"
+	// additionalNextJWKsKey is like nextJWKKey, but for the keys in additionalActiveJWKsKey.
+	//
+	// Note! The value for this key will contain private key material!
+	additionalNextJWKsKey = "additionalNextJWKs"
 
 	jwksSecretTypeValue corev1.SecretType = "secrets.pinniped.dev/federation-domain-jwks"
 )
 
 const (
 	federationDomainKind = "FederationDomain"
+
+	// initialKeyID is the key ID of the first key of each FederationDomain. Keys which are generated by scheduled
+	// rotation get unique key IDs, since the JWKS will contain more than one key at a time.
+	initialKeyID = "pinniped-supervisor-key"
+
+	// retiredKeyClockSkewAllowance is how much longer a retired key is kept in the JWKS after the last ID token
+	// that it signed has expired, to allow for clock skew between the Supervisor and the relying parties.
+	retiredKeyClockSkewAllowance = 5 * time.Minute
 )
 
-// generateKey is stubbed out for the purpose of testing. The default behavior is to generate an EC key.
-var generateKey = generateECKey //nolint:gochecknoglobals
+// jwksRotationState is the bookkeeping for the scheduled rotation of a FederationDomain's signing keys.
+type jwksRotationState struct {
+	// ActivatedAt is the time at which the active key started being used to sign ID tokens.
+	ActivatedAt time.Time `json:"activatedAt"`
+	// RetiredKeys maps the key IDs of previously active keys, which are still published in the JWKS, to the time
+	// at which they may be removed from the JWKS.
+	RetiredKeys map[string]time.Time `json:"retiredKeys,omitempty"`
+}
+
+// rsaKeySize is the size of the RSA keys which are generated for the RS256, RS384, and RS512 algorithms.
+const rsaKeySize = 2048
+
+// generateKey is stubbed out for the purpose of testing. The default behavior is to generate a key of the type
+// which is needed by the given signing algorithm.
+var generateKey = generateKeyForAlgorithm //nolint:gochecknoglobals
+
+func generateKeyForAlgorithm(r io.Reader, algorithm string) (interface{}, error) {
+	switch algorithm {
+	case "ES256":
+		return ecdsa.GenerateKey(elliptic.P256(), r)
+	case "ES384":
+		return ecdsa.GenerateKey(elliptic.P384(), r)
+	case "RS256", "RS384", "RS512":
+		return rsa.GenerateKey(r, rsaKeySize)
+	case "EdDSA":
+		_, key, err := ed25519.GenerateKey(r)
+		return key, err
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+}
 
-func generateECKey(r io.Reader) (interface{}, error) {
-	return ecdsa.GenerateKey(elliptic.P256(), r)
+// isSupportedIDTokenSigningAlgorithm returns whether generateKeyForAlgorithm can generate keys for the algorithm.
+func isSupportedIDTokenSigningAlgorithm(algorithm string) bool {
+	switch algorithm {
+	case "ES256", "ES384", "RS256", "RS384", "RS512", "EdDSA":
+		return true
+	default:
+		return false
+	}
 }
 
 // jwkController holds the fields necessary for the JWKS controller to communicate with FederationDomains and
@@ -64,12 +135,15 @@ type jwksWriterController struct {
 	kubeClient               kubernetes.Interface
 	federationDomainInformer configinformers.FederationDomainInformer
 	secretInformer           corev1informers.SecretInformer
+	clock                    clock.Clock
 }
 
 // NewJWKSWriterController returns a controllerlib.Controller that ensures a FederationDomain has a corresponding
-// Secret that contains a valid active JWK and JWKS.
+// Secret that contains a valid active JWK and JWKS, and which rotates the active JWK when the FederationDomain
+// configures scheduled rotation.
 func NewJWKSWriterController(
 	jwksSecretLabels map[string]string,
+	clock clock.Clock,
 	kubeClient kubernetes.Interface,
 	pinnipedClient pinnipedclientset.Interface,
 	secretInformer corev1informers.SecretInformer,
@@ -89,6 +163,7 @@ func NewJWKSWriterController(
 				pinnipedClient:           pinnipedClient,
 				secretInformer:           secretInformer,
 				federationDomainInformer: federationDomainInformer,
+				clock:                    clock,
 			},
 		},
 		// We want to be notified when a FederationDomain's secret gets updated or deleted. When this happens, we
@@ -131,18 +206,13 @@ func (c *jwksWriterController) Sync(ctx controllerlib.Context) error {
 		return nil
 	}
 
-	secretNeedsUpdate, err := c.secretNeedsUpdate(federationDomain)
+	existingSecret, secretNeedsUpdate, err := c.secretNeedsUpdate(federationDomain)
 	if err != nil {
 		return fmt.Errorf("cannot determine secret status: %w", err)
 	}
 	if !secretNeedsUpdate {
-		// Secret is up to date - we are good to go.
-		plog.Debug(
-			"secret is up to date",
-			"federationdomain",
-			klog.KRef(ctx.Key.Namespace, ctx.Key.Name),
-		)
-		return nil
+		// Secret is valid, but its keys may need to be rotated.
+		return c.rotateKeys(ctx, federationDomain, existingSecret)
 	}
 
 	// If the FederationDomain does not have a secret associated with it, that secret does not exist, or the secret
@@ -168,29 +238,29 @@ func (c *jwksWriterController) Sync(ctx controllerlib.Context) error {
 	return nil
 }
 
-func (c *jwksWriterController) secretNeedsUpdate(federationDomain *configv1alpha1.FederationDomain) (bool, error) {
+func (c *jwksWriterController) secretNeedsUpdate(federationDomain *configv1alpha1.FederationDomain) (*corev1.Secret, bool, error) {
 	if federationDomain.Status.Secrets.JWKS.Name == "" {
 		// If the FederationDomain says it doesn't have a secret associated with it, then let's create one.
-		return true, nil
+		return nil, true, nil
 	}
 
 	// This FederationDomain says it has a secret associated with it. Let's try to get it from the cache.
 	secret, err := c.secretInformer.Lister().Secrets(federationDomain.Namespace).Get(federationDomain.Status.Secrets.JWKS.Name)
 	notFound := k8serrors.IsNotFound(err)
 	if err != nil && !notFound {
-		return false, fmt.Errorf("cannot get secret: %w", err)
+		return nil, false, fmt.Errorf("cannot get secret: %w", err)
 	}
 	if notFound {
 		// If we can't find the secret, let's assume we need to create it.
-		return true, nil
+		return nil, true, nil
 	}
 
 	if !isValid(secret) {
 		// If this secret is invalid, we need to generate a new one.
-		return true, nil
+		return nil, true, nil
 	}
 
-	return false, nil
+	return secret, false, nil
 }
 
 func (c *jwksWriterController) generateSecret(federationDomain *configv1alpha1.FederationDomain) (*corev1.Secret, error) {
@@ -198,30 +268,25 @@ func (c *jwksWriterController) generateSecret(federationDomain *configv1alpha1.F
 	// this FederationDomain should sign and verify ID tokens (e.g., hardcoded token secret, gRPC
 	// connection to KMS, etc).
 	//
-	// For now, we just generate an new RSA keypair and put that in the secret.
+	// For now, we just generate a new keypair for each of the ID token signing algorithms and put them in the secret.
 
-	key, err := generateKey(rand.Reader)
-	if err != nil {
-		return nil, fmt.Errorf("cannot generate key: %w", err)
+	var activeJWKs []jose.JSONWebKey
+	for _, algorithm := range idTokenSigningAlgorithms(federationDomain) {
+		jwk, err := newJWK(algorithm, keyIDPrefix(algorithm))
+		if err != nil {
+			return nil, err
+		}
+		activeJWKs = append(activeJWKs, *jwk)
 	}
 
-	jwk := jose.JSONWebKey{
-		Key:       key,
-		KeyID:     "pinniped-supervisor-key",
-		Algorithm: "ES256",
-		Use:       "sig",
-	}
-	jwkData, err := json.Marshal(jwk)
-	if err != nil {
-		return nil, fmt.Errorf("cannot marshal jwk: %w", err)
+	jwks := jose.JSONWebKeySet{}
+	for i := range activeJWKs {
+		jwks.Keys = append(jwks.Keys, activeJWKs[i].Public())
 	}
 
-	jwks := jose.JSONWebKeySet{
-		Keys: []jose.JSONWebKey{jwk.Public()},
-	}
-	jwksData, err := json.Marshal(jwks)
+	data, err := secretDataForKeys(&corev1.Secret{}, activeJWKs, &jwks, nil, nil)
 	if err != nil {
-		return nil, fmt.Errorf("cannot marshal jwks: %w", err)
+		return nil, err
 	}
 
 	s := corev1.Secret{
@@ -237,16 +302,476 @@ func (c *jwksWriterController) generateSecret(federationDomain *configv1alpha1.F
 				}),
 			},
 		},
-		Data: map[string][]byte{
-			activeJWKKey: jwkData,
-			jwksKey:      jwksData,
-		},
+		Data: data,
 		Type: jwksSecretTypeValue,
 	}
 
 	return &s, nil
 }
 
+// newJWK generates a new signing key for the given algorithm with the given key ID.
+func newJWK(algorithm, keyID string) (*jose.JSONWebKey, error) {
+	key, err := generateKey(rand.Reader, algorithm)
+	if err != nil {
+		return nil, fmt.Errorf("cannot generate key: %w", err)
+	}
+
+	return &jose.JSONWebKey{
+		Key:       key,
+		KeyID:     keyID,
+		Algorithm: algorithm,
+		Use:       "sig",
+	}, nil
+}
+
+// idTokenSigningAlgorithms returns the ID token signing algorithms of the FederationDomain, with the default
+// algorithm first. Invalid algorithms are reported on the FederationDomain's status by the FederationDomain
+// watcher, so in that case only the default algorithm is returned.
+func idTokenSigningAlgorithms(federationDomain *configv1alpha1.FederationDomain) []string {
+	algorithms, err := validateIDTokenSigningAlgorithms(federationDomain.Spec.IDTokenSigningAlgorithms)
+	if err != nil || len(algorithms) == 0 {
+		return []string{provider.DefaultIDTokenSigningAlgorithm}
+	}
+	return algorithms
+}
+
+// rotateKeys brings the keys in a valid JWKS Secret up to date with the FederationDomain's ID token signing
+// algorithms and signing key rotation schedule. It adds keys for newly configured algorithms, pre-publishes the next
+// keys, rotates the active keys, removes retired keys from the JWKS after all the tokens that they signed have
+// expired, and reports the active key on the FederationDomain's status. It requeues the FederationDomain for the next
+// time that the keys will need to change.
+func (c *jwksWriterController) rotateKeys(
+	ctx controllerlib.Context,
+	federationDomain *configv1alpha1.FederationDomain,
+	secret *corev1.Secret,
+) error {
+	now := c.clock.Now().UTC().Truncate(time.Second)
+
+	interval, prePublishPeriod, err := validateSigningKeyRotation(federationDomain.Spec.SigningKeyRotation)
+	if err != nil {
+		// The FederationDomain watcher reports this error on the FederationDomain's status.
+		plog.Debug("not rotating keys for invalid signing key rotation settings",
+			"federationdomain", klog.KObj(federationDomain), "err", err)
+		interval = 0
+	}
+
+	var activeJWK jose.JSONWebKey
+	if err := json.Unmarshal(secret.Data[activeJWKKey], &activeJWK); err != nil {
+		return fmt.Errorf("cannot unmarshal active jwk: %w", err)
+	}
+	var publishedJWKS jose.JSONWebKeySet
+	if err := json.Unmarshal(secret.Data[jwksKey], &publishedJWKS); err != nil {
+		return fmt.Errorf("cannot unmarshal jwks: %w", err)
+	}
+	activeJWKs := append([]jose.JSONWebKey{activeJWK}, privateJWKsFromSecret(secret, additionalActiveJWKsKey)...)
+	var nextJWKs []jose.JSONWebKey
+	if nextJWK := nextJWKFromSecret(secret); nextJWK != nil {
+		nextJWKs = append(nextJWKs, *nextJWK)
+	}
+	nextJWKs = append(nextJWKs, privateJWKsFromSecret(secret, additionalNextJWKsKey)...)
+	state := rotationStateFromSecret(secret)
+
+	algorithms, err := validateIDTokenSigningAlgorithms(federationDomain.Spec.IDTokenSigningAlgorithms)
+	switch {
+	case err != nil:
+		// The FederationDomain watcher reports this error on the FederationDomain's status. Keep using the
+		// current keys rather than retiring any of them.
+		plog.Debug("not changing keys for invalid ID token signing algorithms",
+			"federationdomain", klog.KObj(federationDomain), "err", err)
+		algorithms = algorithmsOfKeys(activeJWKs)
+	case len(algorithms) == 0:
+		algorithms = []string{provider.DefaultIDTokenSigningAlgorithm}
+	}
+
+	// Every new key gets a key ID which has never been published by this FederationDomain.
+	usedKeyIDs := sets.NewString()
+	for _, keys := range [][]jose.JSONWebKey{activeJWKs, nextJWKs, publishedJWKS.Keys} {
+		for _, key := range keys {
+			usedKeyIDs.Insert(key.KeyID)
+		}
+	}
+	newKey := func(algorithm string) (*jose.JSONWebKey, error) {
+		keyID := rotatedKeyID(algorithm, now)
+		for i := 2; usedKeyIDs.Has(keyID); i++ {
+			keyID = fmt.Sprintf("%s-%d", rotatedKeyID(algorithm, now), i)
+		}
+		usedKeyIDs.Insert(keyID)
+		return newJWK(algorithm, keyID)
+	}
+
+	// There is one active key, and at most one next key, for each algorithm. The keys of algorithms which are
+	// no longer configured are left out below, after which they are retired like any other unknown published key.
+	activeByAlgorithm := keysByAlgorithm(activeJWKs)
+	nextByAlgorithm := keysByAlgorithm(nextJWKs)
+	for _, algorithm := range algorithms {
+		if _, ok := activeByAlgorithm[algorithm]; !ok {
+			if activeByAlgorithm[algorithm], err = newKey(algorithm); err != nil {
+				return err
+			}
+			plog.Info("added signing key", "federationdomain", klog.KObj(federationDomain),
+				"algorithm", algorithm, "keyid", activeByAlgorithm[algorithm].KeyID)
+		}
+	}
+
+	var nextRotationTime *metav1.Time
+	var requeueAt []time.Time
+
+	if interval > 0 {
+		if state == nil {
+			state = &jwksRotationState{}
+		}
+		if state.ActivatedAt.IsZero() {
+			// Rotation was just configured, so the schedule starts now.
+			state.ActivatedAt = now
+		}
+		if state.RetiredKeys == nil {
+			state.RetiredKeys = map[string]time.Time{}
+		}
+
+		rotateAt := state.ActivatedAt.Add(interval)
+		if !now.Before(rotateAt) {
+			for _, algorithm := range algorithms {
+				nextJWK, ok := nextByAlgorithm[algorithm]
+				if !ok {
+					// This can only happen when the pre-publish period was skipped, e.g. when the Supervisor was not
+					// running at the time. Rotate anyway, since relying parties will fetch the JWKS for unknown keys.
+					if nextJWK, err = newKey(algorithm); err != nil {
+						return err
+					}
+				}
+				state.RetiredKeys[activeByAlgorithm[algorithm].KeyID] = now.Add(c.retiredKeyLifetime(federationDomain))
+				activeByAlgorithm[algorithm] = nextJWK
+				plog.Info("rotated signing key", "federationdomain", klog.KObj(federationDomain),
+					"algorithm", algorithm, "keyid", nextJWK.KeyID)
+			}
+			nextByAlgorithm = map[string]*jose.JSONWebKey{}
+			state.ActivatedAt = now
+			rotateAt = now.Add(interval)
+		}
+
+		prePublishAt := rotateAt.Add(-prePublishPeriod)
+		if now.Before(prePublishAt) {
+			requeueAt = append(requeueAt, prePublishAt)
+		} else {
+			for _, algorithm := range algorithms {
+				if _, ok := nextByAlgorithm[algorithm]; ok {
+					continue
+				}
+				if nextByAlgorithm[algorithm], err = newKey(algorithm); err != nil {
+					return err
+				}
+			}
+		}
+
+		requeueAt = append(requeueAt, rotateAt)
+		nextRotationTime = &metav1.Time{Time: rotateAt.Truncate(time.Second)}
+	} else {
+		// Without scheduled rotation, pre-published keys will never be used, so they no longer need to be published.
+		nextByAlgorithm = map[string]*jose.JSONWebKey{}
+	}
+
+	newActiveJWKs := make([]jose.JSONWebKey, 0, len(algorithms))
+	var newNextJWKs []jose.JSONWebKey
+	for _, algorithm := range algorithms {
+		newActiveJWKs = append(newActiveJWKs, *activeByAlgorithm[algorithm])
+		if nextJWK, ok := nextByAlgorithm[algorithm]; ok {
+			newNextJWKs = append(newNextJWKs, *nextJWK)
+		}
+	}
+
+	// Keep the public keys of retired keys in the JWKS until every ID token which they signed has expired.
+	newJWKS := jose.JSONWebKeySet{}
+	for _, keys := range [][]jose.JSONWebKey{newActiveJWKs, newNextJWKs} {
+		for i := range keys {
+			newJWKS.Keys = append(newJWKS.Keys, keys[i].Public())
+		}
+	}
+	currentKeyIDs := keyIDsOfKeys(newJWKS.Keys)
+	for _, publishedJWK := range publishedJWKS.Keys {
+		if currentKeyIDs.Has(publishedJWK.KeyID) {
+			continue
+		}
+		if state == nil {
+			state = &jwksRotationState{}
+		}
+		if state.RetiredKeys == nil {
+			state.RetiredKeys = map[string]time.Time{}
+		}
+		removeAt, ok := state.RetiredKeys[publishedJWK.KeyID]
+		if !ok {
+			// We don't know when this key was retired, so assume that it could have been just now.
+			removeAt = now.Add(c.retiredKeyLifetime(federationDomain))
+			state.RetiredKeys[publishedJWK.KeyID] = removeAt
+		}
+		if !now.Before(removeAt) {
+			continue
+		}
+		newJWKS.Keys = append(newJWKS.Keys, publishedJWK)
+		requeueAt = append(requeueAt, removeAt)
+	}
+	if state != nil {
+		for keyID := range state.RetiredKeys {
+			if !jwksHasKeyID(&newJWKS, keyID) {
+				delete(state.RetiredKeys, keyID)
+			}
+		}
+		if interval == 0 && len(state.RetiredKeys) == 0 {
+			// Scheduled rotation is not configured and there is nothing left to clean up.
+			state = nil
+		}
+	}
+
+	newData, err := secretDataForKeys(secret, newActiveJWKs, &newJWKS, newNextJWKs, state)
+	if err != nil {
+		return err
+	}
+	if !secretDataEqual(secret.Data, newData) {
+		updatedSecret := secret.DeepCopy()
+		updatedSecret.Data = newData
+		if _, err := c.kubeClient.CoreV1().Secrets(secret.Namespace).Update(ctx.Context, updatedSecret, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("cannot update secret: %w", err)
+		}
+		plog.Debug("updated keys in secret", "secret", klog.KObj(secret))
+	}
+
+	newFederationDomain := federationDomain.DeepCopy()
+	newFederationDomain.Status.SigningKey = &configv1alpha1.FederationDomainSigningKeyStatus{
+		ActiveKeyID:      newActiveJWKs[0].KeyID,
+		NextRotationTime: nextRotationTime,
+	}
+	if err := c.updateFederationDomainStatus(ctx.Context, newFederationDomain); err != nil {
+		return fmt.Errorf("cannot update FederationDomain: %w", err)
+	}
+
+	if len(requeueAt) > 0 {
+		soonest := requeueAt[0]
+		for _, t := range requeueAt[1:] {
+			if t.Before(soonest) {
+				soonest = t
+			}
+		}
+		ctx.Queue.AddAfter(ctx.Key, soonest.Sub(now))
+	}
+
+	return nil
+}
+
+// retiredKeyLifetime returns how long a key must stay in the JWKS after it stops being used to sign ID tokens.
+func (c *jwksWriterController) retiredKeyLifetime(federationDomain *configv1alpha1.FederationDomain) time.Duration {
+	// Use the default lifetimes when the configured lifetimes are invalid, since the FederationDomain
+	// will not be issuing any tokens in that case.
+	tokenLifetimes, _ := validateTokenLifetimes(federationDomain.Spec.TokenLifetimes)
+	return oidc.TimeoutsConfigurationForTokenLifetimes(tokenLifetimes).IDTokenLifespan + retiredKeyClockSkewAllowance
+}
+
+// keyIDPrefix returns the key ID of the first key for the given algorithm. The keys of the default algorithm
+// have the same key IDs as they did before other algorithms were supported.
+func keyIDPrefix(algorithm string) string {
+	if algorithm == provider.DefaultIDTokenSigningAlgorithm {
+		return initialKeyID
+	}
+	return initialKeyID + "-" + strings.ToLower(algorithm)
+}
+
+// rotatedKeyID returns a key ID for a key for the given algorithm which is generated after the secret was created,
+// e.g. by scheduled rotation at the given time.
+func rotatedKeyID(algorithm string, now time.Time) string {
+	return fmt.Sprintf("%s-%d", keyIDPrefix(algorithm), now.Unix())
+}
+
+// nextJWKFromSecret returns the pre-published next key from the secret, or nil when there is no valid next key.
+func nextJWKFromSecret(secret *corev1.Secret) *jose.JSONWebKey {
+	nextJWKData, ok := secret.Data[nextJWKKey]
+	if !ok {
+		return nil
+	}
+
+	var nextJWK jose.JSONWebKey
+	if err := json.Unmarshal(nextJWKData, &nextJWK); err != nil {
+		plog.Debug("cannot unmarshal next jwk", "err", err)
+		return nil
+	}
+	if nextJWK.IsPublic() || !nextJWK.Valid() {
+		plog.Debug("next jwk is not a valid private key", "keyid", nextJWK.KeyID)
+		return nil
+	}
+
+	return &nextJWK
+}
+
+// privateJWKsFromSecret returns the valid private keys from the JWKS at the given key of the secret's data. Invalid
+// keys are left out, in which case new keys will be generated for their algorithms.
+func privateJWKsFromSecret(secret *corev1.Secret, dataKey string) []jose.JSONWebKey {
+	jwksData, ok := secret.Data[dataKey]
+	if !ok {
+		return nil
+	}
+
+	var jwks jose.JSONWebKeySet
+	if err := json.Unmarshal(jwksData, &jwks); err != nil {
+		plog.Debug("cannot unmarshal private jwks", "dataKey", dataKey, "err", err)
+		return nil
+	}
+
+	keys := make([]jose.JSONWebKey, 0, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.IsPublic() || !jwk.Valid() {
+			plog.Debug("jwk is not a valid private key", "dataKey", dataKey, "keyid", jwk.KeyID)
+			continue
+		}
+		keys = append(keys, jwk)
+	}
+	return keys
+}
+
+// rotationStateFromSecret returns the rotation bookkeeping from the secret, or nil when there is none.
+func rotationStateFromSecret(secret *corev1.Secret) *jwksRotationState {
+	rotationData, ok := secret.Data[rotationKey]
+	if !ok {
+		return nil
+	}
+
+	var state jwksRotationState
+	if err := json.Unmarshal(rotationData, &state); err != nil {
+		plog.Debug("cannot unmarshal key rotation state", "err", err)
+		return nil
+	}
+
+	return &state
+}
+
+// keysByAlgorithm returns the first of the given keys for each algorithm.
+func keysByAlgorithm(keys []jose.JSONWebKey) map[string]*jose.JSONWebKey {
+	result := make(map[string]*jose.JSONWebKey, len(keys))
+	for i := range keys {
+		if _, ok := result[keys[i].Algorithm]; !ok {
+			result[keys[i].Algorithm] = &keys[i]
+		}
+	}
+	return result
+}
+
+// algorithmsOfKeys returns the distinct algorithms of the given keys, in order.
+func algorithmsOfKeys(keys []jose.JSONWebKey) []string {
+	var algorithms []string
+	seen := sets.NewString()
+	for _, key := range keys {
+		if !seen.Has(key.Algorithm) {
+			seen.Insert(key.Algorithm)
+			algorithms = append(algorithms, key.Algorithm)
+		}
+	}
+	return algorithms
+}
+
+func keyIDsOfKeys(keys []jose.JSONWebKey) sets.String {
+	keyIDs := sets.NewString()
+	for _, key := range keys {
+		keyIDs.Insert(key.KeyID)
+	}
+	return keyIDs
+}
+
+func jwksHasKeyID(jwks *jose.JSONWebKeySet, keyID string) bool {
+	return len(jwks.Key(keyID)) > 0
+}
+
+// secretDataForKeys returns the data of a JWKS secret for the given keys. The first of the active keys and of the
+// next keys belong to the first algorithm. It reuses the existing data of the secret for any keys which did not
+// change, so that unchanged keys never cause an update to the secret.
+func secretDataForKeys(
+	secret *corev1.Secret,
+	activeJWKs []jose.JSONWebKey,
+	jwks *jose.JSONWebKeySet,
+	nextJWKs []jose.JSONWebKey,
+	state *jwksRotationState,
+) (map[string][]byte, error) {
+	data := map[string][]byte{}
+
+	var existingActiveJWK jose.JSONWebKey
+	_ = json.Unmarshal(secret.Data[activeJWKKey], &existingActiveJWK)
+	if err := setSecretDataForKey(data, secret, activeJWKKey, &activeJWKs[0], existingActiveJWK.KeyID == activeJWKs[0].KeyID); err != nil {
+		return nil, err
+	}
+
+	var existingJWKS jose.JSONWebKeySet
+	_ = json.Unmarshal(secret.Data[jwksKey], &existingJWKS)
+	if err := setSecretDataForKey(data, secret, jwksKey, jwks, sameKeyIDs(existingJWKS.Keys, jwks.Keys)); err != nil {
+		return nil, err
+	}
+
+	if len(activeJWKs) > 1 {
+		additional := activeJWKs[1:]
+		unchanged := sameKeyIDs(privateJWKsFromSecret(secret, additionalActiveJWKsKey), additional)
+		if err := setSecretDataForKey(data, secret, additionalActiveJWKsKey, &jose.JSONWebKeySet{Keys: additional}, unchanged); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(nextJWKs) > 0 {
+		existing := nextJWKFromSecret(secret)
+		unchanged := existing != nil && existing.KeyID == nextJWKs[0].KeyID
+		if err := setSecretDataForKey(data, secret, nextJWKKey, &nextJWKs[0], unchanged); err != nil {
+			return nil, err
+		}
+	}
+	if len(nextJWKs) > 1 {
+		additional := nextJWKs[1:]
+		unchanged := sameKeyIDs(privateJWKsFromSecret(secret, additionalNextJWKsKey), additional)
+		if err := setSecretDataForKey(data, secret, additionalNextJWKsKey, &jose.JSONWebKeySet{Keys: additional}, unchanged); err != nil {
+			return nil, err
+		}
+	}
+
+	if state != nil {
+		if err := setSecretDataForKey(data, secret, rotationKey, state, false); err != nil {
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
+
+// setSecretDataForKey sets the given key of the data to the existing data of the secret when it is unchanged,
+// or otherwise to the JSON of the given value.
+func setSecretDataForKey(data map[string][]byte, secret *corev1.Secret, dataKey string, value interface{}, unchanged bool) error {
+	if unchanged {
+		data[dataKey] = secret.Data[dataKey]
+		return nil
+	}
+
+	valueData, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("cannot marshal %s: %w", dataKey, err)
+	}
+	data[dataKey] = valueData
+	return nil
+}
+
+func sameKeyIDs(a, b []jose.JSONWebKey) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].KeyID != b[i].KeyID {
+			return false
+		}
+	}
+	return true
+}
+
+func secretDataEqual(a, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if other, ok := b[k]; !ok || !bytes.Equal(v, other) {
+			return false
+		}
+	}
+	return true
+}
+
 func (c *jwksWriterController) createOrUpdateSecret(
 	ctx context.Context,
 	newSecret *corev1.Secret,
@@ -293,12 +818,19 @@ func (c *jwksWriterController) updateFederationDomainStatus(
 			return fmt.Errorf("cannot get FederationDomain: %w", err)
 		}
 
-		if newFederationDomain.Status.Secrets.JWKS.Name == oldFederationDomain.Status.Secrets.JWKS.Name {
+		// The signing key is only reported once the secret is known to be valid, so leave it alone until then.
+		signingKeyUpToDate := newFederationDomain.Status.SigningKey == nil ||
+			equality.Semantic.DeepEqual(newFederationDomain.Status.SigningKey, oldFederationDomain.Status.SigningKey)
+
+		if newFederationDomain.Status.Secrets.JWKS.Name == oldFederationDomain.Status.Secrets.JWKS.Name && signingKeyUpToDate {
 			// If the existing FederationDomain is up to date, we don't need to update it.
 			return nil
 		}
 
 		oldFederationDomain.Status.Secrets.JWKS.Name = newFederationDomain.Status.Secrets.JWKS.Name
+		if newFederationDomain.Status.SigningKey != nil {
+			oldFederationDomain.Status.SigningKey = newFederationDomain.Status.SigningKey
+		}
 		_, err = federationDomainClient.UpdateStatus(ctx, oldFederationDomain, metav1.UpdateOptions{})
 		return err
 	})
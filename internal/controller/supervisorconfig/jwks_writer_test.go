@@ -1,4 +1,4 @@
-// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package supervisorconfig
@@ -6,14 +6,22 @@ package supervisorconfig
 import (
 	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
 	"crypto/x509"
+	"encoding/json"
 	"encoding/pem"
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -21,6 +29,7 @@ import (
 	kubeinformers "k8s.io/client-go/informers"
 	kubernetesfake "k8s.io/client-go/kubernetes/fake"
 	kubetesting "k8s.io/client-go/testing"
+	clocktesting "k8s.io/utils/clock/testing"
 
 	configv1alpha1 "go.pinniped.dev/generated/latest/apis/supervisor/config/v1alpha1"
 	pinnipedfake "go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned/fake"
@@ -182,6 +191,7 @@ func TestJWKSWriterControllerFilterSecret(t *testing.T) {
 			withInformer := testutil.NewObservableWithInformerOption()
 			_ = NewJWKSWriterController(
 				nil, // labels, not needed
+				nil, // clock, not needed
 				nil, // kubeClient, not needed
 				nil, // pinnipedClient, not needed
 				secretInformer,
@@ -236,6 +246,7 @@ func TestJWKSWriterControllerFilterFederationDomain(t *testing.T) {
 			withInformer := testutil.NewObservableWithInformerOption()
 			_ = NewJWKSWriterController(
 				nil, // labels, not needed
+				nil, // clock, not needed
 				nil, // kubeClient, not needed
 				nil, // pinnipedClient, not needed
 				secretInformer,
@@ -259,6 +270,8 @@ func TestJWKSWriterControllerSync(t *testing.T) {
 
 	const namespace = "tuna-namespace"
 
+	frozenNow := time.Date(2020, time.September, 23, 7, 42, 0, 0, time.UTC)
+
 	goodKeyPEM, err := os.ReadFile("testdata/good-ec-key.pem")
 	require.NoError(t, err)
 	block, _ := pem.Decode(goodKeyPEM)
@@ -284,6 +297,10 @@ func TestJWKSWriterControllerSync(t *testing.T) {
 	}
 	goodFederationDomainWithStatus := goodFederationDomain.DeepCopy()
 	goodFederationDomainWithStatus.Status.Secrets.JWKS.Name = goodFederationDomainWithStatus.Name + "-jwks"
+	goodFederationDomainWithSigningKeyStatus := goodFederationDomainWithStatus.DeepCopy()
+	goodFederationDomainWithSigningKeyStatus.Status.SigningKey = &configv1alpha1.FederationDomainSigningKeyStatus{
+		ActiveKeyID: "pinniped-supervisor-key",
+	}
 
 	secretGVR := schema.GroupVersionResource{
 		Group:    corev1.SchemeGroupVersion.Group,
@@ -399,6 +416,25 @@ func TestJWKSWriterControllerSync(t *testing.T) {
 			secrets: []*corev1.Secret{
 				goodSecret,
 			},
+			wantSecretActions: []kubetesting.Action{},
+			wantFederationDomainActions: []kubetesting.Action{
+				kubetesting.NewGetAction(federationDomainGVR, namespace, goodFederationDomain.Name),
+				kubetesting.NewUpdateSubresourceAction(federationDomainGVR, "status", namespace, goodFederationDomainWithSigningKeyStatus),
+			},
+		},
+		{
+			name: "existing federationDomain with existing secret and signing key status",
+			key:  controllerlib.Key{Namespace: goodFederationDomain.Namespace, Name: goodFederationDomain.Name},
+			federationDomains: []*configv1alpha1.FederationDomain{
+				goodFederationDomainWithSigningKeyStatus,
+			},
+			secrets: []*corev1.Secret{
+				goodSecret,
+			},
+			wantSecretActions: []kubetesting.Action{},
+			wantFederationDomainActions: []kubetesting.Action{
+				kubetesting.NewGetAction(federationDomainGVR, namespace, goodFederationDomain.Name),
+			},
 		},
 		{
 			name: "deleted federationDomain",
@@ -668,7 +704,7 @@ func TestJWKSWriterControllerSync(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			// We shouldn't run this test in parallel since it messes with a global function (generateKey).
 			generateKeyCount := 0
-			generateKey = func(_ io.Reader) (interface{}, error) {
+			generateKey = func(_ io.Reader, _ string) (interface{}, error) {
 				generateKeyCount++
 				return goodKey, test.generateKeyErr
 			}
@@ -710,6 +746,7 @@ func TestJWKSWriterControllerSync(t *testing.T) {
 					"myLabelKey1": "myLabelValue1",
 					"myLabelKey2": "myLabelValue2",
 				},
+				clocktesting.NewFakeClock(frozenNow),
 				kubeAPIClient,
 				pinnipedAPIClient,
 				kubeInformers.Core().V1().Secrets(),
@@ -744,6 +781,561 @@ func TestJWKSWriterControllerSync(t *testing.T) {
 	}
 }
 
+func TestJWKSWriterControllerKeyRotation(t *testing.T) {
+	// We shouldn't run this test in parallel since it messes with a global function (generateKey).
+
+	const namespace = "tuna-namespace"
+
+	now := time.Date(2020, time.September, 23, 7, 42, 0, 0, time.UTC)
+	rotatedKeyIDForNow := fmt.Sprintf("pinniped-supervisor-key-%d", now.Unix())
+	rotatedRS256KeyIDForNow := fmt.Sprintf("pinniped-supervisor-key-rs256-%d", now.Unix())
+
+	goodKeyPEM, err := os.ReadFile("testdata/good-ec-key.pem")
+	require.NoError(t, err)
+	block, _ := pem.Decode(goodKeyPEM)
+	require.NotNil(t, block, "expected block to be non-nil...is goodKeyPEM a valid PEM?")
+	goodKey, err := x509.ParseECPrivateKey(block.Bytes)
+	require.NoError(t, err)
+
+	// All keys in this test have the same key material, but they are distinguished by their key IDs and algorithms.
+	jwkForAlgorithm := func(algorithm, keyID string) jose.JSONWebKey {
+		return jose.JSONWebKey{Key: goodKey, KeyID: keyID, Algorithm: algorithm, Use: "sig"}
+	}
+	jwkWithKeyID := func(keyID string) jose.JSONWebKey {
+		return jwkForAlgorithm("ES256", keyID)
+	}
+	mustMarshal := func(v interface{}) []byte {
+		data, err := json.Marshal(v)
+		require.NoError(t, err)
+		return data
+	}
+
+	federationDomainWithRotation := func(rotation *configv1alpha1.FederationDomainSigningKeyRotation) *configv1alpha1.FederationDomain {
+		fd := &configv1alpha1.FederationDomain{
+			ObjectMeta: metav1.ObjectMeta{Name: "good-federationDomain", Namespace: namespace, UID: "good-federationDomain-uid"},
+			Spec: configv1alpha1.FederationDomainSpec{
+				Issuer:             "https://some-issuer.com",
+				SigningKeyRotation: rotation,
+			},
+		}
+		fd.Status.Secrets.JWKS.Name = fd.Name + "-jwks"
+		return fd
+	}
+	monthlyRotation := &configv1alpha1.FederationDomainSigningKeyRotation{
+		Interval: metav1.Duration{Duration: 30 * 24 * time.Hour},
+	}
+
+	// newSecret returns a JWKS secret with the given active key, published key IDs, optional next key, and optional state.
+	// newSecretWithAlgorithms returns a JWKS secret with the given active keys, published key IDs, next keys, and
+	// optional state. The first active key and the first next key belong to the first algorithm.
+	newSecretWithAlgorithms := func(activeKeys []jose.JSONWebKey, publishedKeyIDs []string, nextKeys []jose.JSONWebKey, state *jwksRotationState) *corev1.Secret {
+		jwks := jose.JSONWebKeySet{}
+		for _, keyID := range publishedKeyIDs {
+			jwk := jwkWithKeyID(keyID)
+			jwks.Keys = append(jwks.Keys, jwk.Public())
+		}
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "good-federationDomain-jwks", Namespace: namespace},
+			Type:       "secrets.pinniped.dev/federation-domain-jwks",
+			Data: map[string][]byte{
+				"activeJWK": mustMarshal(activeKeys[0]),
+				"jwks":      mustMarshal(jwks),
+			},
+		}
+		if len(activeKeys) > 1 {
+			secret.Data["additionalActiveJWKs"] = mustMarshal(jose.JSONWebKeySet{Keys: activeKeys[1:]})
+		}
+		if len(nextKeys) > 0 {
+			secret.Data["nextJWK"] = mustMarshal(nextKeys[0])
+		}
+		if len(nextKeys) > 1 {
+			secret.Data["additionalNextJWKs"] = mustMarshal(jose.JSONWebKeySet{Keys: nextKeys[1:]})
+		}
+		if state != nil {
+			secret.Data["rotation"] = mustMarshal(state)
+		}
+		return secret
+	}
+
+	// newSecret returns a JWKS secret with the given active key, published key IDs, optional next key, and optional state.
+	newSecret := func(activeKeyID string, publishedKeyIDs []string, nextKeyID string, state *jwksRotationState) *corev1.Secret {
+		active := jwkWithKeyID(activeKeyID)
+		jwks := jose.JSONWebKeySet{}
+		for _, keyID := range publishedKeyIDs {
+			jwk := jwkWithKeyID(keyID)
+			jwks.Keys = append(jwks.Keys, jwk.Public())
+		}
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "good-federationDomain-jwks", Namespace: namespace},
+			Type:       "secrets.pinniped.dev/federation-domain-jwks",
+			Data: map[string][]byte{
+				"activeJWK": mustMarshal(active),
+				"jwks":      mustMarshal(jwks),
+			},
+		}
+		if nextKeyID != "" {
+			secret.Data["nextJWK"] = mustMarshal(jwkWithKeyID(nextKeyID))
+		}
+		if state != nil {
+			secret.Data["rotation"] = mustMarshal(state)
+		}
+		return secret
+	}
+
+	tests := []struct {
+		name             string
+		federationDomain *configv1alpha1.FederationDomain
+		secret           *corev1.Secret
+
+		wantGenerateKeyCount       int
+		wantGeneratedAlgorithms    []string
+		wantSecretUpdated          bool
+		wantActiveKeyID            string
+		wantAdditionalActiveKeyIDs []string
+		wantPublishedKeyIDs        []string
+		wantNextKeyID              string
+		wantAdditionalNextKeyIDs   []string
+		wantState                  *jwksRotationState
+		wantNextRotationTime       *metav1.Time
+		wantRequeueAfter           time.Duration
+		wantNoRequeue              bool
+	}{
+		{
+			name:                "rotation is not configured",
+			federationDomain:    federationDomainWithRotation(nil),
+			secret:              newSecret("pinniped-supervisor-key", []string{"pinniped-supervisor-key"}, "", nil),
+			wantActiveKeyID:     "pinniped-supervisor-key",
+			wantPublishedKeyIDs: []string{"pinniped-supervisor-key"},
+			wantNoRequeue:       true,
+		},
+		{
+			name:                 "rotation was just configured",
+			federationDomain:     federationDomainWithRotation(monthlyRotation),
+			secret:               newSecret("pinniped-supervisor-key", []string{"pinniped-supervisor-key"}, "", nil),
+			wantSecretUpdated:    true,
+			wantActiveKeyID:      "pinniped-supervisor-key",
+			wantPublishedKeyIDs:  []string{"pinniped-supervisor-key"},
+			wantState:            &jwksRotationState{ActivatedAt: now},
+			wantNextRotationTime: &metav1.Time{Time: now.Add(30 * 24 * time.Hour)},
+			wantRequeueAfter:     29 * 24 * time.Hour, // when the next key should be pre-published
+		},
+		{
+			name:             "nothing to do before the pre-publish period",
+			federationDomain: federationDomainWithRotation(monthlyRotation),
+			secret: newSecret("pinniped-supervisor-key", []string{"pinniped-supervisor-key"}, "",
+				&jwksRotationState{ActivatedAt: now.Add(-10 * 24 * time.Hour)}),
+			wantActiveKeyID:      "pinniped-supervisor-key",
+			wantPublishedKeyIDs:  []string{"pinniped-supervisor-key"},
+			wantState:            &jwksRotationState{ActivatedAt: now.Add(-10 * 24 * time.Hour)},
+			wantNextRotationTime: &metav1.Time{Time: now.Add(20 * 24 * time.Hour)},
+			wantRequeueAfter:     19 * 24 * time.Hour,
+		},
+		{
+			name: "the next key is pre-published",
+			federationDomain: federationDomainWithRotation(&configv1alpha1.FederationDomainSigningKeyRotation{
+				Interval:         metav1.Duration{Duration: 30 * 24 * time.Hour},
+				PrePublishPeriod: &metav1.Duration{Duration: 48 * time.Hour},
+			}),
+			secret: newSecret("pinniped-supervisor-key", []string{"pinniped-supervisor-key"}, "",
+				&jwksRotationState{ActivatedAt: now.Add(-29 * 24 * time.Hour)}),
+			wantGenerateKeyCount: 1,
+			wantSecretUpdated:    true,
+			wantActiveKeyID:      "pinniped-supervisor-key",
+			wantPublishedKeyIDs:  []string{"pinniped-supervisor-key", rotatedKeyIDForNow},
+			wantNextKeyID:        rotatedKeyIDForNow,
+			wantState:            &jwksRotationState{ActivatedAt: now.Add(-29 * 24 * time.Hour)},
+			wantNextRotationTime: &metav1.Time{Time: now.Add(24 * time.Hour)},
+			wantRequeueAfter:     24 * time.Hour, // when the next key should become active
+		},
+		{
+			name:             "the pre-published key becomes the active key",
+			federationDomain: federationDomainWithRotation(monthlyRotation),
+			secret: newSecret("pinniped-supervisor-key", []string{"pinniped-supervisor-key", "pinniped-supervisor-key-next"}, "pinniped-supervisor-key-next",
+				&jwksRotationState{ActivatedAt: now.Add(-30 * 24 * time.Hour)}),
+			wantSecretUpdated:   true,
+			wantActiveKeyID:     "pinniped-supervisor-key-next",
+			wantPublishedKeyIDs: []string{"pinniped-supervisor-key-next", "pinniped-supervisor-key"},
+			wantState: &jwksRotationState{
+				ActivatedAt: now,
+				// The default ID token lifetime, plus the allowance for clock skew.
+				RetiredKeys: map[string]time.Time{"pinniped-supervisor-key": now.Add(7 * time.Minute)},
+			},
+			wantNextRotationTime: &metav1.Time{Time: now.Add(30 * 24 * time.Hour)},
+			wantRequeueAfter:     7 * time.Minute, // when the retired key can be removed
+		},
+		{
+			name: "the retired key is kept for the configured ID token lifetime",
+			federationDomain: func() *configv1alpha1.FederationDomain {
+				fd := federationDomainWithRotation(monthlyRotation)
+				fd.Spec.TokenLifetimes = &configv1alpha1.FederationDomainTokenLifetimes{IDToken: &metav1.Duration{Duration: time.Hour}}
+				return fd
+			}(),
+			secret: newSecret("pinniped-supervisor-key", []string{"pinniped-supervisor-key", "pinniped-supervisor-key-next"}, "pinniped-supervisor-key-next",
+				&jwksRotationState{ActivatedAt: now.Add(-30 * 24 * time.Hour)}),
+			wantSecretUpdated:   true,
+			wantActiveKeyID:     "pinniped-supervisor-key-next",
+			wantPublishedKeyIDs: []string{"pinniped-supervisor-key-next", "pinniped-supervisor-key"},
+			wantState: &jwksRotationState{
+				ActivatedAt: now,
+				RetiredKeys: map[string]time.Time{"pinniped-supervisor-key": now.Add(65 * time.Minute)},
+			},
+			wantNextRotationTime: &metav1.Time{Time: now.Add(30 * 24 * time.Hour)},
+			wantRequeueAfter:     65 * time.Minute,
+		},
+		{
+			name:             "the active key is rotated even when the next key was never pre-published",
+			federationDomain: federationDomainWithRotation(monthlyRotation),
+			secret: newSecret("pinniped-supervisor-key", []string{"pinniped-supervisor-key"}, "",
+				&jwksRotationState{ActivatedAt: now.Add(-40 * 24 * time.Hour)}),
+			wantGenerateKeyCount: 1,
+			wantSecretUpdated:    true,
+			wantActiveKeyID:      rotatedKeyIDForNow,
+			wantPublishedKeyIDs:  []string{rotatedKeyIDForNow, "pinniped-supervisor-key"},
+			wantState: &jwksRotationState{
+				ActivatedAt: now,
+				RetiredKeys: map[string]time.Time{"pinniped-supervisor-key": now.Add(7 * time.Minute)},
+			},
+			wantNextRotationTime: &metav1.Time{Time: now.Add(30 * 24 * time.Hour)},
+			wantRequeueAfter:     7 * time.Minute,
+		},
+		{
+			name:             "the retired key is removed after the tokens which it signed have expired",
+			federationDomain: federationDomainWithRotation(monthlyRotation),
+			secret: newSecret("pinniped-supervisor-key-new", []string{"pinniped-supervisor-key-new", "pinniped-supervisor-key"}, "",
+				&jwksRotationState{
+					ActivatedAt: now.Add(-time.Hour),
+					RetiredKeys: map[string]time.Time{"pinniped-supervisor-key": now},
+				}),
+			wantSecretUpdated:    true,
+			wantActiveKeyID:      "pinniped-supervisor-key-new",
+			wantPublishedKeyIDs:  []string{"pinniped-supervisor-key-new"},
+			wantState:            &jwksRotationState{ActivatedAt: now.Add(-time.Hour)},
+			wantNextRotationTime: &metav1.Time{Time: now.Add(30*24*time.Hour - time.Hour)},
+			wantRequeueAfter:     29*24*time.Hour - time.Hour,
+		},
+		{
+			name:             "retired keys are still removed after rotation is no longer configured",
+			federationDomain: federationDomainWithRotation(nil),
+			secret: newSecret("pinniped-supervisor-key-new", []string{"pinniped-supervisor-key-new", "pinniped-supervisor-key"}, "",
+				&jwksRotationState{
+					ActivatedAt: now.Add(-time.Hour),
+					RetiredKeys: map[string]time.Time{"pinniped-supervisor-key": now.Add(time.Minute)},
+				}),
+			wantActiveKeyID:     "pinniped-supervisor-key-new",
+			wantPublishedKeyIDs: []string{"pinniped-supervisor-key-new", "pinniped-supervisor-key"},
+			wantState: &jwksRotationState{
+				ActivatedAt: now.Add(-time.Hour),
+				RetiredKeys: map[string]time.Time{"pinniped-supervisor-key": now.Add(time.Minute)},
+			},
+			wantRequeueAfter: time.Minute,
+		},
+		{
+			name:             "the rotation state is removed when rotation is no longer configured and all retired keys are gone",
+			federationDomain: federationDomainWithRotation(nil),
+			secret: newSecret("pinniped-supervisor-key-new", []string{"pinniped-supervisor-key-new", "pinniped-supervisor-key"}, "",
+				&jwksRotationState{
+					ActivatedAt: now.Add(-time.Hour),
+					RetiredKeys: map[string]time.Time{"pinniped-supervisor-key": now.Add(-time.Minute)},
+				}),
+			wantSecretUpdated:   true,
+			wantActiveKeyID:     "pinniped-supervisor-key-new",
+			wantPublishedKeyIDs: []string{"pinniped-supervisor-key-new"},
+			wantNoRequeue:       true,
+		},
+		{
+			name: "invalid rotation settings are treated as if rotation was not configured",
+			federationDomain: federationDomainWithRotation(&configv1alpha1.FederationDomainSigningKeyRotation{
+				Interval: metav1.Duration{Duration: time.Minute},
+			}),
+			secret: newSecret("pinniped-supervisor-key", []string{"pinniped-supervisor-key", "pinniped-supervisor-key-next"}, "pinniped-supervisor-key-next",
+				&jwksRotationState{ActivatedAt: now.Add(-30 * 24 * time.Hour)}),
+			wantSecretUpdated:   true,
+			wantActiveKeyID:     "pinniped-supervisor-key",
+			wantPublishedKeyIDs: []string{"pinniped-supervisor-key", "pinniped-supervisor-key-next"},
+			// The unused next key is kept like a retired key, since it was already published.
+			wantState: &jwksRotationState{
+				ActivatedAt: now.Add(-30 * 24 * time.Hour),
+				RetiredKeys: map[string]time.Time{"pinniped-supervisor-key-next": now.Add(7 * time.Minute)},
+			},
+			wantRequeueAfter: 7 * time.Minute,
+		},
+		{
+			name: "a key is added for a newly configured algorithm",
+			federationDomain: func() *configv1alpha1.FederationDomain {
+				fd := federationDomainWithRotation(nil)
+				fd.Spec.IDTokenSigningAlgorithms = []configv1alpha1.SigningAlgorithm{"ES256", "RS256"}
+				return fd
+			}(),
+			secret:                     newSecret("pinniped-supervisor-key", []string{"pinniped-supervisor-key"}, "", nil),
+			wantGenerateKeyCount:       1,
+			wantGeneratedAlgorithms:    []string{"RS256"},
+			wantSecretUpdated:          true,
+			wantActiveKeyID:            "pinniped-supervisor-key",
+			wantAdditionalActiveKeyIDs: []string{rotatedRS256KeyIDForNow},
+			wantPublishedKeyIDs:        []string{"pinniped-supervisor-key", rotatedRS256KeyIDForNow},
+			wantNoRequeue:              true,
+		},
+		{
+			name: "a different algorithm becomes the default algorithm",
+			federationDomain: func() *configv1alpha1.FederationDomain {
+				fd := federationDomainWithRotation(nil)
+				fd.Spec.IDTokenSigningAlgorithms = []configv1alpha1.SigningAlgorithm{"RS256", "ES256"}
+				return fd
+			}(),
+			secret: newSecretWithAlgorithms(
+				[]jose.JSONWebKey{jwkWithKeyID("pinniped-supervisor-key"), jwkForAlgorithm("RS256", "pinniped-supervisor-key-rs256")},
+				[]string{"pinniped-supervisor-key", "pinniped-supervisor-key-rs256"}, nil, nil),
+			wantSecretUpdated:          true,
+			wantActiveKeyID:            "pinniped-supervisor-key-rs256",
+			wantAdditionalActiveKeyIDs: []string{"pinniped-supervisor-key"},
+			wantPublishedKeyIDs:        []string{"pinniped-supervisor-key-rs256", "pinniped-supervisor-key"},
+			wantNoRequeue:              true,
+		},
+		{
+			name:             "the key of an algorithm which is no longer configured is retired",
+			federationDomain: federationDomainWithRotation(nil),
+			secret: newSecretWithAlgorithms(
+				[]jose.JSONWebKey{jwkWithKeyID("pinniped-supervisor-key"), jwkForAlgorithm("RS256", "pinniped-supervisor-key-rs256")},
+				[]string{"pinniped-supervisor-key", "pinniped-supervisor-key-rs256"}, nil, nil),
+			wantSecretUpdated:   true,
+			wantActiveKeyID:     "pinniped-supervisor-key",
+			wantPublishedKeyIDs: []string{"pinniped-supervisor-key", "pinniped-supervisor-key-rs256"},
+			wantState: &jwksRotationState{
+				RetiredKeys: map[string]time.Time{"pinniped-supervisor-key-rs256": now.Add(7 * time.Minute)},
+			},
+			wantRequeueAfter: 7 * time.Minute,
+		},
+		{
+			name: "invalid algorithms are treated as if the algorithms of the current keys were configured",
+			federationDomain: func() *configv1alpha1.FederationDomain {
+				fd := federationDomainWithRotation(nil)
+				fd.Spec.IDTokenSigningAlgorithms = []configv1alpha1.SigningAlgorithm{"ES256", "ES256"}
+				return fd
+			}(),
+			secret: newSecretWithAlgorithms(
+				[]jose.JSONWebKey{jwkWithKeyID("pinniped-supervisor-key"), jwkForAlgorithm("RS256", "pinniped-supervisor-key-rs256")},
+				[]string{"pinniped-supervisor-key", "pinniped-supervisor-key-rs256"}, nil, nil),
+			wantActiveKeyID:            "pinniped-supervisor-key",
+			wantAdditionalActiveKeyIDs: []string{"pinniped-supervisor-key-rs256"},
+			wantPublishedKeyIDs:        []string{"pinniped-supervisor-key", "pinniped-supervisor-key-rs256"},
+			wantNoRequeue:              true,
+		},
+		{
+			name: "the next keys of all algorithms are pre-published together",
+			federationDomain: func() *configv1alpha1.FederationDomain {
+				fd := federationDomainWithRotation(monthlyRotation)
+				fd.Spec.IDTokenSigningAlgorithms = []configv1alpha1.SigningAlgorithm{"ES256", "RS256"}
+				return fd
+			}(),
+			secret: newSecretWithAlgorithms(
+				[]jose.JSONWebKey{jwkWithKeyID("pinniped-supervisor-key"), jwkForAlgorithm("RS256", "pinniped-supervisor-key-rs256")},
+				[]string{"pinniped-supervisor-key", "pinniped-supervisor-key-rs256"}, nil,
+				&jwksRotationState{ActivatedAt: now.Add(-29 * 24 * time.Hour)}),
+			wantGenerateKeyCount:       2,
+			wantGeneratedAlgorithms:    []string{"ES256", "RS256"},
+			wantSecretUpdated:          true,
+			wantActiveKeyID:            "pinniped-supervisor-key",
+			wantAdditionalActiveKeyIDs: []string{"pinniped-supervisor-key-rs256"},
+			wantPublishedKeyIDs:        []string{"pinniped-supervisor-key", "pinniped-supervisor-key-rs256", rotatedKeyIDForNow, rotatedRS256KeyIDForNow},
+			wantNextKeyID:              rotatedKeyIDForNow,
+			wantAdditionalNextKeyIDs:   []string{rotatedRS256KeyIDForNow},
+			wantState:                  &jwksRotationState{ActivatedAt: now.Add(-29 * 24 * time.Hour)},
+			wantNextRotationTime:       &metav1.Time{Time: now.Add(24 * time.Hour)},
+			wantRequeueAfter:           24 * time.Hour,
+		},
+		{
+			name: "the keys of all algorithms are rotated together",
+			federationDomain: func() *configv1alpha1.FederationDomain {
+				fd := federationDomainWithRotation(monthlyRotation)
+				fd.Spec.IDTokenSigningAlgorithms = []configv1alpha1.SigningAlgorithm{"ES256", "RS256"}
+				return fd
+			}(),
+			secret: newSecretWithAlgorithms(
+				[]jose.JSONWebKey{jwkWithKeyID("pinniped-supervisor-key"), jwkForAlgorithm("RS256", "pinniped-supervisor-key-rs256")},
+				[]string{"pinniped-supervisor-key", "pinniped-supervisor-key-rs256", "pinniped-supervisor-key-next", "pinniped-supervisor-key-rs256-next"},
+				[]jose.JSONWebKey{jwkWithKeyID("pinniped-supervisor-key-next"), jwkForAlgorithm("RS256", "pinniped-supervisor-key-rs256-next")},
+				&jwksRotationState{ActivatedAt: now.Add(-30 * 24 * time.Hour)}),
+			wantSecretUpdated:          true,
+			wantActiveKeyID:            "pinniped-supervisor-key-next",
+			wantAdditionalActiveKeyIDs: []string{"pinniped-supervisor-key-rs256-next"},
+			wantPublishedKeyIDs:        []string{"pinniped-supervisor-key-next", "pinniped-supervisor-key-rs256-next", "pinniped-supervisor-key", "pinniped-supervisor-key-rs256"},
+			wantState: &jwksRotationState{
+				ActivatedAt: now,
+				RetiredKeys: map[string]time.Time{
+					"pinniped-supervisor-key":       now.Add(7 * time.Minute),
+					"pinniped-supervisor-key-rs256": now.Add(7 * time.Minute),
+				},
+			},
+			wantNextRotationTime: &metav1.Time{Time: now.Add(30 * 24 * time.Hour)},
+			wantRequeueAfter:     7 * time.Minute,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			// We shouldn't run this test in parallel since it messes with a global function (generateKey).
+			generateKeyCount := 0
+			var generatedAlgorithms []string
+			generateKey = func(_ io.Reader, algorithm string) (interface{}, error) {
+				generateKeyCount++
+				generatedAlgorithms = append(generatedAlgorithms, algorithm)
+				return goodKey, nil
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			kubeAPIClient := kubernetesfake.NewSimpleClientset(test.secret)
+			kubeInformerClient := kubernetesfake.NewSimpleClientset(test.secret)
+			pinnipedAPIClient := pinnipedfake.NewSimpleClientset(test.federationDomain)
+			pinnipedInformerClient := pinnipedfake.NewSimpleClientset(test.federationDomain)
+
+			kubeInformers := kubeinformers.NewSharedInformerFactory(kubeInformerClient, 0)
+			pinnipedInformers := pinnipedinformers.NewSharedInformerFactory(pinnipedInformerClient, 0)
+
+			c := NewJWKSWriterController(
+				nil,
+				clocktesting.NewFakeClock(now),
+				kubeAPIClient,
+				pinnipedAPIClient,
+				kubeInformers.Core().V1().Secrets(),
+				pinnipedInformers.Config().V1alpha1().FederationDomains(),
+				controllerlib.WithInformer,
+			)
+
+			// Must start informers before calling TestRunSynchronously().
+			kubeInformers.Start(ctx.Done())
+			pinnipedInformers.Start(ctx.Done())
+			controllerlib.TestRunSynchronously(t, c)
+
+			key := controllerlib.Key{Namespace: namespace, Name: test.federationDomain.Name}
+			queue := &testQueue{t: t}
+			err := controllerlib.TestSync(t, c, controllerlib.Context{Context: ctx, Key: key, Queue: queue})
+			require.NoError(t, err)
+
+			require.Equal(t, test.wantGenerateKeyCount, generateKeyCount)
+			if test.wantGeneratedAlgorithms != nil {
+				require.Equal(t, test.wantGeneratedAlgorithms, generatedAlgorithms)
+			}
+
+			secret, err := kubeAPIClient.CoreV1().Secrets(namespace).Get(ctx, test.secret.Name, metav1.GetOptions{})
+			require.NoError(t, err)
+			require.Equal(t, test.wantSecretUpdated, !secretDataEqual(test.secret.Data, secret.Data))
+			require.True(t, isValid(secret))
+
+			var activeJWK jose.JSONWebKey
+			require.NoError(t, json.Unmarshal(secret.Data["activeJWK"], &activeJWK))
+			require.Equal(t, test.wantActiveKeyID, activeJWK.KeyID)
+
+			var jwks jose.JSONWebKeySet
+			require.NoError(t, json.Unmarshal(secret.Data["jwks"], &jwks))
+			publishedKeyIDs := make([]string, 0, len(jwks.Keys))
+			for _, jwk := range jwks.Keys {
+				require.True(t, jwk.IsPublic())
+				publishedKeyIDs = append(publishedKeyIDs, jwk.KeyID)
+			}
+			require.Equal(t, test.wantPublishedKeyIDs, publishedKeyIDs)
+
+			if test.wantNextKeyID == "" {
+				require.NotContains(t, secret.Data, "nextJWK")
+			} else {
+				nextJWK := nextJWKFromSecret(secret)
+				require.NotNil(t, nextJWK)
+				require.Equal(t, test.wantNextKeyID, nextJWK.KeyID)
+			}
+
+			requireKeyIDs := func(dataKey string, wantKeyIDs []string) {
+				if wantKeyIDs == nil {
+					require.NotContains(t, secret.Data, dataKey)
+					return
+				}
+				keyIDs := make([]string, 0, len(wantKeyIDs))
+				for _, jwk := range privateJWKsFromSecret(secret, dataKey) {
+					keyIDs = append(keyIDs, jwk.KeyID)
+				}
+				require.Equal(t, wantKeyIDs, keyIDs)
+			}
+			requireKeyIDs("additionalActiveJWKs", test.wantAdditionalActiveKeyIDs)
+			requireKeyIDs("additionalNextJWKs", test.wantAdditionalNextKeyIDs)
+
+			if test.wantState == nil {
+				require.NotContains(t, secret.Data, "rotation")
+			} else {
+				require.Equal(t, test.wantState, rotationStateFromSecret(secret))
+			}
+
+			federationDomain, err := pinnipedAPIClient.ConfigV1alpha1().FederationDomains(namespace).Get(ctx, test.federationDomain.Name, metav1.GetOptions{})
+			require.NoError(t, err)
+			require.Equal(t, &configv1alpha1.FederationDomainSigningKeyStatus{
+				ActiveKeyID:      test.wantActiveKeyID,
+				NextRotationTime: test.wantNextRotationTime,
+			}, federationDomain.Status.SigningKey)
+
+			if test.wantNoRequeue {
+				require.False(t, queue.called)
+			} else {
+				require.True(t, queue.called)
+				require.Equal(t, key, queue.key)
+				require.Equal(t, test.wantRequeueAfter, queue.duration)
+			}
+		})
+	}
+}
+
+func TestJWKSWriterControllerGenerateSecretForAlgorithms(t *testing.T) {
+	// We shouldn't run this test in parallel since other tests mess with a global function (generateKey).
+	generateKey = generateKeyForAlgorithm
+
+	federationDomain := &configv1alpha1.FederationDomain{
+		ObjectMeta: metav1.ObjectMeta{Name: "some-federationDomain", Namespace: "some-namespace"},
+		Spec: configv1alpha1.FederationDomainSpec{
+			Issuer:                   "https://some-issuer.com",
+			IDTokenSigningAlgorithms: []configv1alpha1.SigningAlgorithm{"RS256", "ES256", "ES384", "RS384", "RS512", "EdDSA"},
+		},
+	}
+
+	c := &jwksWriterController{}
+	secret, err := c.generateSecret(federationDomain)
+	require.NoError(t, err)
+	require.True(t, isValid(secret))
+
+	var activeJWK jose.JSONWebKey
+	require.NoError(t, json.Unmarshal(secret.Data["activeJWK"], &activeJWK))
+	require.Equal(t, "pinniped-supervisor-key-rs256", activeJWK.KeyID)
+	require.Equal(t, "RS256", activeJWK.Algorithm)
+	require.IsType(t, &rsa.PrivateKey{}, activeJWK.Key)
+
+	additionalJWKs := privateJWKsFromSecret(secret, "additionalActiveJWKs")
+	require.Len(t, additionalJWKs, 5)
+	for i, want := range []struct {
+		keyID     string
+		algorithm string
+		keyType   interface{}
+	}{
+		{keyID: "pinniped-supervisor-key", algorithm: "ES256", keyType: &ecdsa.PrivateKey{}},
+		{keyID: "pinniped-supervisor-key-es384", algorithm: "ES384", keyType: &ecdsa.PrivateKey{}},
+		{keyID: "pinniped-supervisor-key-rs384", algorithm: "RS384", keyType: &rsa.PrivateKey{}},
+		{keyID: "pinniped-supervisor-key-rs512", algorithm: "RS512", keyType: &rsa.PrivateKey{}},
+		{keyID: "pinniped-supervisor-key-eddsa", algorithm: "EdDSA", keyType: ed25519.PrivateKey{}},
+	} {
+		require.Equal(t, want.keyID, additionalJWKs[i].KeyID)
+		require.Equal(t, want.algorithm, additionalJWKs[i].Algorithm)
+		require.IsType(t, want.keyType, additionalJWKs[i].Key)
+	}
+	require.Equal(t, elliptic.P384(), additionalJWKs[1].Key.(*ecdsa.PrivateKey).Curve)
+
+	var jwks jose.JSONWebKeySet
+	require.NoError(t, json.Unmarshal(secret.Data["jwks"], &jwks))
+	require.Len(t, jwks.Keys, 6)
+	for i, jwk := range jwks.Keys {
+		require.True(t, jwk.IsPublic())
+		require.Equal(t, append([]jose.JSONWebKey{activeJWK}, additionalJWKs...)[i].KeyID, jwk.KeyID)
+	}
+	require.NotContains(t, secret.Data, "nextJWK")
+	require.NotContains(t, secret.Data, "additionalNextJWKs")
+	require.NotContains(t, secret.Data, "rotation")
+}
+
 func readJWKJSON(t *testing.T, path string) []byte {
 	t.Helper()
 
@@ -759,3 +1351,23 @@ func readJWKJSON(t *testing.T, path string) []byte {
 }
 
 func boolPtr(b bool) *bool { return &b }
+
+type testQueue struct {
+	t *testing.T
+
+	called   bool
+	key      controllerlib.Key
+	duration time.Duration
+
+	controllerlib.Queue // panic if any other methods called
+}
+
+func (q *testQueue) AddAfter(key controllerlib.Key, duration time.Duration) {
+	q.t.Helper()
+
+	require.False(q.t, q.called, "AddAfter should only be called once")
+
+	q.called = true
+	q.key = key
+	q.duration = duration
+}
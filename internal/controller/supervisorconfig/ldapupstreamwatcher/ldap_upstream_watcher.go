@@ -1,4 +1,4 @@
-// Copyright 2021-2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2021-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 // Package ldapupstreamwatcher implements a controller which watches LDAPIdentityProviders.
@@ -11,6 +11,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
 	corev1informers "k8s.io/client-go/informers/core/v1"
 
 	"go.pinniped.dev/generated/latest/apis/supervisor/idp/v1alpha1"
@@ -57,8 +58,8 @@ type ldapUpstreamGenericLDAPSpec struct {
 	ldapIdentityProvider v1alpha1.LDAPIdentityProvider
 }
 
-func (s *ldapUpstreamGenericLDAPSpec) Host() string {
-	return s.ldapIdentityProvider.Spec.Host
+func (s *ldapUpstreamGenericLDAPSpec) DetectAndSetHosts(_ context.Context, config *upstreamldap.ProviderConfig) error {
+	return upstreamwatchers.SetHosts(config, s.ldapIdentityProvider.Spec.Host, s.ldapIdentityProvider.Spec.Hosts)
 }
 
 func (s *ldapUpstreamGenericLDAPSpec) TLSSpec() *v1alpha1.TLSSpec {
@@ -135,6 +136,7 @@ type UpstreamLDAPIdentityProviderICache interface {
 type ldapWatcherController struct {
 	cache                        UpstreamLDAPIdentityProviderICache
 	validatedSettingsCache       upstreamwatchers.ValidatedSettingsCacheI
+	providerStateCache           *upstreamldap.ProviderStateCache
 	ldapDialer                   upstreamldap.LDAPDialer
 	client                       pinnipedclientset.Interface
 	ldapIdentityProviderInformer idpinformers.LDAPIdentityProviderInformer
@@ -175,6 +177,7 @@ func newInternal(
 	c := ldapWatcherController{
 		cache:                        idpCache,
 		validatedSettingsCache:       validatedSettingsCache,
+		providerStateCache:           upstreamldap.NewProviderStateCache(),
 		ldapDialer:                   ldapDialer,
 		client:                       client,
 		ldapIdentityProviderInformer: ldapIdentityProviderInformer,
@@ -204,7 +207,9 @@ func (c *ldapWatcherController) Sync(ctx controllerlib.Context) error {
 
 	requeue := false
 	validatedUpstreams := make([]provider.UpstreamLDAPIdentityProviderI, 0, len(actualUpstreams))
+	upstreamUIDs := make([]types.UID, 0, len(actualUpstreams))
 	for _, upstream := range actualUpstreams {
+		upstreamUIDs = append(upstreamUIDs, upstream.UID)
 		valid, requestedRequeue := c.validateUpstream(ctx.Context, upstream)
 		if valid != nil {
 			validatedUpstreams = append(validatedUpstreams, valid)
@@ -215,6 +220,7 @@ func (c *ldapWatcherController) Sync(ctx controllerlib.Context) error {
 	}
 
 	c.cache.SetLDAPIdentityProviders(validatedUpstreams)
+	c.providerStateCache.Retain(upstreamUIDs)
 
 	if requeue {
 		return controllerlib.ErrSyntheticRequeue
@@ -228,7 +234,6 @@ func (c *ldapWatcherController) validateUpstream(ctx context.Context, upstream *
 	config := &upstreamldap.ProviderConfig{
 		Name:        upstream.Name,
 		ResourceUID: upstream.UID,
-		Host:        spec.Host,
 		UserSearch: upstreamldap.UserSearchConfig{
 			Base:              spec.UserSearch.Base,
 			Filter:            spec.UserSearch.Filter,
@@ -248,7 +253,7 @@ func (c *ldapWatcherController) validateUpstream(ctx context.Context, upstream *
 
 	c.updateStatus(ctx, upstream, conditions.Conditions())
 
-	return upstreamwatchers.EvaluateConditions(conditions, config)
+	return upstreamwatchers.EvaluateConditions(conditions, config, c.providerStateCache)
 }
 
 func (c *ldapWatcherController) updateStatus(ctx context.Context, upstream *v1alpha1.LDAPIdentityProvider, conditions []*v1alpha1.Condition) {
@@ -1,4 +1,4 @@
-// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package ldapupstreamwatcher
@@ -17,6 +17,7 @@ import (
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes/fake"
@@ -272,6 +273,28 @@ func TestLDAPUpstreamWatcherControllerSync(t *testing.T) {
 			ObservedGeneration: gen,
 		}
 	}
+	ldapMultipleHostsConnectionValidTrueCondition := func(gen int64, secretVersion string) v1alpha1.Condition {
+		return v1alpha1.Condition{
+			Type:               "LDAPConnectionValid",
+			Status:             "True",
+			LastTransitionTime: now,
+			Reason:             "Success",
+			Message: fmt.Sprintf(
+				`successfully able to connect to all hosts ["%s" "%s"] and bind as user "%s" [validated with Secret "%s" at version "%s"]`,
+				testHost, "ldap2.example.com:123", testBindUsername, testSecretName, secretVersion),
+			ObservedGeneration: gen,
+		}
+	}
+	withoutTimeOrGeneration := func(c v1alpha1.Condition) v1alpha1.Condition {
+		c.LastTransitionTime = metav1.Time{}
+		c.ObservedGeneration = 0
+		return c
+	}
+	providerConfigWithHosts := func(editFunc func(config *upstreamldap.ProviderConfig)) *upstreamldap.ProviderConfig {
+		config := *providerConfigForValidUpstreamWithTLS
+		editFunc(&config)
+		return &config
+	}
 	allConditionsTrue := func(gen int64, secretVersion string) []v1alpha1.Condition {
 		return []v1alpha1.Condition{
 			bindSecretValidTrueCondition(gen),
@@ -1115,6 +1138,156 @@ func TestLDAPUpstreamWatcherControllerSync(t *testing.T) {
 				ConnectionValidCondition:  condPtr(ldapConnectionValidTrueConditionWithoutTimeOrGeneration("4242")),
 			}},
 		},
+		{
+			name: "multiple hosts when one of the hosts cannot be dialed names that host in the connection condition",
+			inputUpstreams: []runtime.Object{editedValidUpstream(func(upstream *v1alpha1.LDAPIdentityProvider) {
+				upstream.Spec.Hosts = []string{"ldap2.example.com:123"}
+			})},
+			inputSecrets: []runtime.Object{validBindUserSecret("4242")},
+			dialErrors: map[string]error{
+				"ldap2.example.com:123": fmt.Errorf("some dial error"),
+			},
+			setupMocks: func(conn *mockldapconn.MockConn) {
+				// Should perform a test dial and bind for the first host using TLS, and then only attempt
+				// to dial the second host using TLS, since TLS worked for the first host.
+				conn.EXPECT().Bind(testBindUsername, testBindPassword).Times(1)
+				conn.EXPECT().Close().Times(1)
+			},
+			wantErr: controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingCache: []*upstreamldap.ProviderConfig{providerConfigWithHosts(func(config *upstreamldap.ProviderConfig) {
+				config.Hosts = []string{testHost, "ldap2.example.com:123"}
+			})},
+			wantResultingUpstreams: []v1alpha1.LDAPIdentityProvider{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testResourceUID},
+				Status: v1alpha1.LDAPIdentityProviderStatus{
+					Phase: "Error",
+					Conditions: []v1alpha1.Condition{
+						bindSecretValidTrueCondition(1234),
+						{
+							Type:               "LDAPConnectionValid",
+							Status:             "False",
+							LastTransitionTime: now,
+							Reason:             "LDAPConnectionError",
+							Message: fmt.Sprintf(
+								`could not successfully connect to 1 of 2 hosts and bind as user "%s": "%s": error dialing host "%s": some dial error`,
+								testBindUsername, "ldap2.example.com:123", "ldap2.example.com:123"),
+							ObservedGeneration: 1234,
+						},
+						tlsConfigurationValidLoadedTrueCondition(1234),
+					},
+				},
+			}},
+			wantValidatedSettings: map[string]upstreamwatchers.ValidatedSettings{},
+		},
+		{
+			name: "multiple hosts which can all be dialed are remembered in the validated settings cache",
+			inputUpstreams: []runtime.Object{editedValidUpstream(func(upstream *v1alpha1.LDAPIdentityProvider) {
+				upstream.Spec.Host = ""
+				upstream.Spec.Hosts = []string{testHost, "ldap2.example.com:123"}
+			})},
+			inputSecrets: []runtime.Object{validBindUserSecret("4242")},
+			setupMocks: func(conn *mockldapconn.MockConn) {
+				conn.EXPECT().Bind(testBindUsername, testBindPassword).Times(2)
+				conn.EXPECT().Close().Times(2)
+			},
+			wantResultingCache: []*upstreamldap.ProviderConfig{providerConfigWithHosts(func(config *upstreamldap.ProviderConfig) {
+				config.Hosts = []string{testHost, "ldap2.example.com:123"}
+			})},
+			wantResultingUpstreams: []v1alpha1.LDAPIdentityProvider{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testResourceUID},
+				Status: v1alpha1.LDAPIdentityProviderStatus{
+					Phase: "Ready",
+					Conditions: []v1alpha1.Condition{
+						bindSecretValidTrueCondition(1234),
+						ldapMultipleHostsConnectionValidTrueCondition(1234, "4242"),
+						tlsConfigurationValidLoadedTrueCondition(1234),
+					},
+				},
+			}},
+			wantValidatedSettings: map[string]upstreamwatchers.ValidatedSettings{testName: {
+				BindSecretResourceVersion: "4242",
+				LDAPConnectionProtocol:    upstreamldap.TLS,
+				UserSearchBase:            testUserSearchBase,
+				GroupSearchBase:           testGroupSearchBase,
+				IDPSpecGeneration:         1234,
+				Hosts:                     []string{testHost, "ldap2.example.com:123"},
+				ConnectionValidCondition:  condPtr(withoutTimeOrGeneration(ldapMultipleHostsConnectionValidTrueCondition(0, "4242"))),
+			}},
+		},
+		{
+			name: "when the hosts have changed since they were validated, the hosts are validated again",
+			inputUpstreams: []runtime.Object{editedValidUpstream(func(upstream *v1alpha1.LDAPIdentityProvider) {
+				upstream.Spec.Hosts = []string{"ldap2.example.com:123"}
+			})},
+			inputSecrets: []runtime.Object{validBindUserSecret("4242")},
+			initialValidatedSettings: map[string]upstreamwatchers.ValidatedSettings{testName: {
+				BindSecretResourceVersion: "4242",
+				LDAPConnectionProtocol:    upstreamldap.TLS,
+				UserSearchBase:            testUserSearchBase,
+				GroupSearchBase:           testGroupSearchBase,
+				IDPSpecGeneration:         1234,
+				ConnectionValidCondition:  condPtr(ldapConnectionValidTrueConditionWithoutTimeOrGeneration("4242")),
+			}},
+			setupMocks: func(conn *mockldapconn.MockConn) {
+				// Should perform a test dial and bind for each host, even though the previous settings were cached.
+				conn.EXPECT().Bind(testBindUsername, testBindPassword).Times(2)
+				conn.EXPECT().Close().Times(2)
+			},
+			wantResultingCache: []*upstreamldap.ProviderConfig{providerConfigWithHosts(func(config *upstreamldap.ProviderConfig) {
+				config.Hosts = []string{testHost, "ldap2.example.com:123"}
+			})},
+			wantResultingUpstreams: []v1alpha1.LDAPIdentityProvider{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testResourceUID},
+				Status: v1alpha1.LDAPIdentityProviderStatus{
+					Phase: "Ready",
+					Conditions: []v1alpha1.Condition{
+						bindSecretValidTrueCondition(1234),
+						ldapMultipleHostsConnectionValidTrueCondition(1234, "4242"),
+						tlsConfigurationValidLoadedTrueCondition(1234),
+					},
+				},
+			}},
+			wantValidatedSettings: map[string]upstreamwatchers.ValidatedSettings{testName: {
+				BindSecretResourceVersion: "4242",
+				LDAPConnectionProtocol:    upstreamldap.TLS,
+				UserSearchBase:            testUserSearchBase,
+				GroupSearchBase:           testGroupSearchBase,
+				IDPSpecGeneration:         1234,
+				Hosts:                     []string{testHost, "ldap2.example.com:123"},
+				ConnectionValidCondition:  condPtr(withoutTimeOrGeneration(ldapMultipleHostsConnectionValidTrueCondition(0, "4242"))),
+			}},
+		},
+		{
+			name: "neither host nor hosts is specified",
+			inputUpstreams: []runtime.Object{editedValidUpstream(func(upstream *v1alpha1.LDAPIdentityProvider) {
+				upstream.Spec.Host = ""
+			})},
+			inputSecrets: []runtime.Object{validBindUserSecret("4242")},
+			wantErr:      controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingCache: []*upstreamldap.ProviderConfig{providerConfigWithHosts(func(config *upstreamldap.ProviderConfig) {
+				config.Host = ""
+				config.ConnectionProtocol = ""
+			})},
+			wantResultingUpstreams: []v1alpha1.LDAPIdentityProvider{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testResourceUID},
+				Status: v1alpha1.LDAPIdentityProviderStatus{
+					Phase: "Error",
+					Conditions: []v1alpha1.Condition{
+						bindSecretValidTrueCondition(1234),
+						{
+							Type:               "LDAPConnectionValid",
+							Status:             "False",
+							LastTransitionTime: now,
+							Reason:             "HostsNotFound",
+							Message:            "must specify host or hosts",
+							ObservedGeneration: 1234,
+						},
+						tlsConfigurationValidLoadedTrueCondition(1234),
+					},
+				},
+			}},
+			wantValidatedSettings: map[string]upstreamwatchers.ValidatedSettings{},
+		},
 	}
 
 	for _, tt := range tests {
@@ -1216,6 +1389,111 @@ func TestLDAPUpstreamWatcherControllerSync(t *testing.T) {
 	}
 }
 
+func TestLDAPUpstreamWatcherControllerSyncSharesConnectionPool(t *testing.T) {
+	t.Parallel()
+
+	const (
+		testNamespace    = "test-namespace"
+		testName         = "test-name"
+		testSecretName   = "test-bind-secret"
+		testBindUsername = "test-bind-username"
+		testBindPassword = "test-bind-password"
+	)
+
+	upstream := &v1alpha1.LDAPIdentityProvider{
+		ObjectMeta: metav1.ObjectMeta{Name: testName, Namespace: testNamespace, Generation: 1234, UID: "test-resource-uid"},
+		Spec: v1alpha1.LDAPIdentityProviderSpec{
+			Host: "ldap.example.com:123",
+			Bind: v1alpha1.LDAPIdentityProviderBind{SecretName: testSecretName},
+			UserSearch: v1alpha1.LDAPIdentityProviderUserSearch{
+				Base:       "test-user-search-base",
+				Filter:     "test-user-search-filter",
+				Attributes: v1alpha1.LDAPIdentityProviderUserSearchAttributes{Username: "test-username-attr", UID: "test-uid-attr"},
+			},
+			GroupSearch: v1alpha1.LDAPIdentityProviderGroupSearch{
+				Base:       "test-group-search-base",
+				Filter:     "test-group-search-filter",
+				Attributes: v1alpha1.LDAPIdentityProviderGroupSearchAttributes{GroupName: "test-group-name-attr"},
+			},
+		},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: testSecretName, Namespace: testNamespace, ResourceVersion: "4242"},
+		Type:       corev1.SecretTypeBasicAuth,
+		Data:       map[string][]byte{"username": []byte(testBindUsername), "password": []byte(testBindPassword)},
+	}
+
+	fakePinnipedClient := pinnipedfake.NewSimpleClientset(upstream)
+	pinnipedInformers := pinnipedinformers.NewSharedInformerFactory(fakePinnipedClient, 0)
+	fakeKubeClient := fake.NewSimpleClientset(secret)
+	kubeInformers := informers.NewSharedInformerFactory(fakeKubeClient, 0)
+	cache := provider.NewDynamicUpstreamIDPProvider()
+
+	ctrl := gomock.NewController(t)
+	t.Cleanup(ctrl.Finish)
+
+	// The first connection is used to validate the upstream, and the second connection is pooled.
+	testConn := mockldapconn.NewMockConn(ctrl)
+	testConn.EXPECT().Bind(testBindUsername, testBindPassword).Times(1)
+	testConn.EXPECT().Close().Times(1)
+	pooledConn := mockldapconn.NewMockConn(ctrl)
+	pooledConn.EXPECT().Bind(testBindUsername, testBindPassword).Times(1)
+	pooledConn.EXPECT().Search(gomock.Any()).Return(&ldap.SearchResult{}, nil).Times(2)
+
+	undialed := []upstreamldap.Conn{testConn, pooledConn}
+	dialer := &comparableDialer{upstreamldap.LDAPDialerFunc(func(ctx context.Context, addr endpointaddr.HostPort) (upstreamldap.Conn, error) {
+		require.NotEmpty(t, undialed, "unexpected dial")
+		conn := undialed[0]
+		undialed = undialed[1:]
+		return conn, nil
+	})}
+
+	controller := newInternal(
+		cache,
+		&upstreamwatchers.ValidatedSettingsCache{ValidatedSettingsByName: map[string]upstreamwatchers.ValidatedSettings{}},
+		dialer,
+		fakePinnipedClient,
+		pinnipedInformers.IDP().V1alpha1().LDAPIdentityProviders(),
+		kubeInformers.Core().V1().Secrets(),
+		controllerlib.WithInformer,
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pinnipedInformers.Start(ctx.Done())
+	kubeInformers.Start(ctx.Done())
+	controllerlib.TestRunSynchronously(t, controller)
+
+	syncCtx := controllerlib.Context{Context: ctx, Key: controllerlib.Key{}}
+
+	authenticateWithLoadedProvider := func() {
+		t.Helper()
+		providers := cache.GetLDAPIdentityProviders()
+		require.Len(t, providers, 1)
+		_, authenticated, err := providers[0].AuthenticateUser(ctx, "some-username", "some-password", nil)
+		require.NoError(t, err)
+		require.False(t, authenticated)
+	}
+
+	// Each sync creates a new Provider, but the Providers should share the pooled connection.
+	for i := 0; i < 2; i++ {
+		require.NoError(t, controllerlib.TestSync(t, controller, syncCtx))
+		authenticateWithLoadedProvider()
+	}
+	require.Empty(t, undialed)
+
+	// The pooled connection should be closed when the upstream is deleted.
+	pooledConn.EXPECT().Close().Times(1)
+	require.NoError(t, fakePinnipedClient.IDPV1alpha1().LDAPIdentityProviders(testNamespace).Delete(ctx, testName, metav1.DeleteOptions{}))
+	require.Eventually(t, func() bool {
+		upstreams, err := pinnipedInformers.IDP().V1alpha1().LDAPIdentityProviders().Lister().List(labels.Everything())
+		return err == nil && len(upstreams) == 0
+	}, time.Minute, time.Millisecond)
+	require.NoError(t, controllerlib.TestSync(t, controller, syncCtx))
+	require.Empty(t, cache.GetLDAPIdentityProviders())
+}
+
 func normalizeLDAPUpstreams(upstreams []v1alpha1.LDAPIdentityProvider, now metav1.Time) []v1alpha1.LDAPIdentityProvider {
 	result := make([]v1alpha1.LDAPIdentityProvider, 0, len(upstreams))
 	for _, u := range upstreams {
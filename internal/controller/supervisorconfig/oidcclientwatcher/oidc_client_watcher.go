@@ -1,4 +1,4 @@
-// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2022-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package oidcclientwatcher
@@ -12,6 +12,7 @@ import (
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
 	corev1informers "k8s.io/client-go/informers/core/v1"
 
 	"go.pinniped.dev/generated/latest/apis/supervisor/config/v1alpha1"
@@ -133,6 +134,20 @@ func (c *oidcClientWatcherController) updateStatus(
 ) error {
 	updated := upstream.DeepCopy()
 
+	// Drop any conditions which are no longer reported for this client, e.g. ClientSecretExists after the client
+	// was changed to be a public client.
+	currentTypes := sets.New[string]()
+	for _, c := range conditions {
+		currentTypes.Insert(c.Type)
+	}
+	keptConditions := make([]v1alpha1.Condition, 0, len(updated.Status.Conditions))
+	for _, c := range updated.Status.Conditions {
+		if currentTypes.Has(c.Type) {
+			keptConditions = append(keptConditions, c)
+		}
+	}
+	updated.Status.Conditions = keptConditions
+
 	hadErrorCondition := conditionsutil.MergeConfigConditions(conditions, upstream.Generation, &updated.Status.Conditions, plog.New())
 
 	updated.Status.Phase = v1alpha1.PhaseReady
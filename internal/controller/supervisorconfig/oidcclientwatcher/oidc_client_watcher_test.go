@@ -1,15 +1,21 @@
-// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2022-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package oidcclientwatcher
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -19,6 +25,7 @@ import (
 	configv1alpha1 "go.pinniped.dev/generated/latest/apis/supervisor/config/v1alpha1"
 	pinnipedfake "go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned/fake"
 	pinnipedinformers "go.pinniped.dev/generated/latest/client/supervisor/informers/externalversions"
+	"go.pinniped.dev/internal/certauthority"
 	"go.pinniped.dev/internal/controllerlib"
 	"go.pinniped.dev/internal/testutil"
 )
@@ -191,6 +198,28 @@ func TestOIDCClientWatcherControllerSync(t *testing.T) {
 		}
 	}
 
+	happyAllowedRedirectURIsCondition := func(time metav1.Time, observedGeneration int64) configv1alpha1.Condition {
+		return configv1alpha1.Condition{
+			Type:               "AllowedRedirectURIsValid",
+			Status:             "True",
+			LastTransitionTime: time,
+			Reason:             "Success",
+			Message:            `"allowedRedirectURIs" and "allowedPostLogoutRedirectURIs" are valid`,
+			ObservedGeneration: observedGeneration,
+		}
+	}
+
+	sadAllowedRedirectURIsCondition := func(time metav1.Time, observedGeneration int64, message string) configv1alpha1.Condition {
+		return configv1alpha1.Condition{
+			Type:               "AllowedRedirectURIsValid",
+			Status:             "False",
+			LastTransitionTime: time,
+			Reason:             "InvalidRedirectURI",
+			Message:            message,
+			ObservedGeneration: observedGeneration,
+		}
+	}
+
 	happyClientSecretsCondition := func(howMany int, time metav1.Time, observedGeneration int64) configv1alpha1.Condition {
 		return configv1alpha1.Condition{
 			Type:               "ClientSecretExists",
@@ -224,6 +253,39 @@ func TestOIDCClientWatcherControllerSync(t *testing.T) {
 		}
 	}
 
+	happyNoClientSecretsCondition := func(time metav1.Time, observedGeneration int64) configv1alpha1.Condition {
+		return configv1alpha1.Condition{
+			Type:               "NoClientSecretExists",
+			Status:             "True",
+			LastTransitionTime: time,
+			Reason:             "Success",
+			Message:            "no client secret found, as required for public clients",
+			ObservedGeneration: observedGeneration,
+		}
+	}
+
+	happyNoClientSecretsForAuthMethodCondition := func(tokenEndpointAuthMethod string, time metav1.Time, observedGeneration int64) configv1alpha1.Condition {
+		return configv1alpha1.Condition{
+			Type:               "NoClientSecretExists",
+			Status:             "True",
+			LastTransitionTime: time,
+			Reason:             "Success",
+			Message:            fmt.Sprintf(`no client secret found, as required for clients which use "tokenEndpointAuthMethod" %q`, tokenEndpointAuthMethod),
+			ObservedGeneration: observedGeneration,
+		}
+	}
+
+	sadPublicClientSecretsCondition := func(time metav1.Time, observedGeneration int64, message string) configv1alpha1.Condition {
+		return configv1alpha1.Condition{
+			Type:               "NoClientSecretExists",
+			Status:             "False",
+			LastTransitionTime: time,
+			Reason:             "ClientSecretFound",
+			Message:            message,
+			ObservedGeneration: observedGeneration,
+		}
+	}
+
 	happyAllowedScopesCondition := func(time metav1.Time, observedGeneration int64) configv1alpha1.Condition {
 		return configv1alpha1.Condition{
 			Type:               "AllowedScopesValid",
@@ -246,6 +308,43 @@ func TestOIDCClientWatcherControllerSync(t *testing.T) {
 		}
 	}
 
+	happyTokenEndpointAuthMethodCondition := func(time metav1.Time, observedGeneration int64) configv1alpha1.Condition {
+		return configv1alpha1.Condition{
+			Type:               "TokenEndpointAuthMethodValid",
+			Status:             "True",
+			LastTransitionTime: time,
+			Reason:             "Success",
+			Message:            `"tokenEndpointAuthMethod" is valid`,
+			ObservedGeneration: observedGeneration,
+		}
+	}
+
+	sadTokenEndpointAuthMethodCondition := func(time metav1.Time, observedGeneration int64, message string) configv1alpha1.Condition {
+		return configv1alpha1.Condition{
+			Type:               "TokenEndpointAuthMethodValid",
+			Status:             "False",
+			LastTransitionTime: time,
+			Reason:             "InvalidClientAuthenticationConfig",
+			Message:            message,
+			ObservedGeneration: observedGeneration,
+		}
+	}
+
+	clientAssertionKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	clientJWKS, err := json.Marshal(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: clientAssertionKey.Public(), KeyID: "client-key", Algorithm: "ES256", Use: "sig"},
+	}})
+	require.NoError(t, err)
+	privateClientJWKS, err := json.Marshal(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: clientAssertionKey, KeyID: "client-key", Algorithm: "ES256", Use: "sig"},
+	}})
+	require.NoError(t, err)
+
+	clientCA, err := certauthority.New("client CA", time.Hour)
+	require.NoError(t, err)
+	clientCAData := base64.StdEncoding.EncodeToString(clientCA.Bundle())
+
 	tests := []struct {
 		name                     string
 		inputObjects             []runtime.Object
@@ -294,8 +393,10 @@ func TestOIDCClientWatcherControllerSync(t *testing.T) {
 						Phase: "Ready",
 						Conditions: []configv1alpha1.Condition{
 							happyAllowedGrantTypesCondition(now, 1234),
+							happyAllowedRedirectURIsCondition(now, 1234),
 							happyAllowedScopesCondition(now, 1234),
 							happyClientSecretsCondition(1, now, 1234),
+							happyTokenEndpointAuthMethodCondition(now, 1234),
 						},
 						TotalClientSecrets: 1,
 					},
@@ -319,8 +420,10 @@ func TestOIDCClientWatcherControllerSync(t *testing.T) {
 					Phase: "Ready",
 					Conditions: []configv1alpha1.Condition{
 						happyAllowedGrantTypesCondition(now, 1234),
+						happyAllowedRedirectURIsCondition(now, 1234),
 						happyAllowedScopesCondition(now, 1234),
 						happyClientSecretsCondition(2, now, 1234),
+						happyTokenEndpointAuthMethodCondition(now, 1234),
 					},
 					TotalClientSecrets: 2,
 				},
@@ -338,8 +441,10 @@ func TestOIDCClientWatcherControllerSync(t *testing.T) {
 					Phase: "Ready",
 					Conditions: []configv1alpha1.Condition{
 						happyAllowedGrantTypesCondition(earlier, 1234),
+						happyAllowedRedirectURIsCondition(earlier, 1234),
 						happyAllowedScopesCondition(earlier, 1234),
 						happyClientSecretsCondition(1, earlier, 1234),
+						happyTokenEndpointAuthMethodCondition(earlier, 1234),
 					},
 					TotalClientSecrets: 1,
 				},
@@ -352,8 +457,10 @@ func TestOIDCClientWatcherControllerSync(t *testing.T) {
 					Phase: "Ready",
 					Conditions: []configv1alpha1.Condition{
 						happyAllowedGrantTypesCondition(earlier, 1234),
+						happyAllowedRedirectURIsCondition(earlier, 1234),
 						happyAllowedScopesCondition(earlier, 1234),
 						happyClientSecretsCondition(1, earlier, 1234),
+						happyTokenEndpointAuthMethodCondition(earlier, 1234),
 					},
 					TotalClientSecrets: 1,
 				},
@@ -372,8 +479,10 @@ func TestOIDCClientWatcherControllerSync(t *testing.T) {
 					Phase: "Error",
 					Conditions: []configv1alpha1.Condition{
 						sadAllowedGrantTypesCondition(now, 1234, `"authorization_code" must always be included in "allowedGrantTypes"`),
+						happyAllowedRedirectURIsCondition(now, 1234),
 						sadAllowedScopesCondition(now, 1234, `"openid" must always be included in "allowedScopes"`),
 						sadNoClientSecretsCondition(now, 1234, "no client secret found (no Secret storage found)"),
+						happyTokenEndpointAuthMethodCondition(now, 1234),
 					},
 				},
 			}},
@@ -395,8 +504,10 @@ func TestOIDCClientWatcherControllerSync(t *testing.T) {
 					Phase: "Error",
 					Conditions: []configv1alpha1.Condition{
 						happyAllowedGrantTypesCondition(now, 1234),
+						happyAllowedRedirectURIsCondition(now, 1234),
 						happyAllowedScopesCondition(now, 1234),
 						sadNoClientSecretsCondition(now, 1234, "error reading client secret storage: OIDC client secret storage data has wrong version: OIDC client secret storage has version wrong-version instead of 1"),
+						happyTokenEndpointAuthMethodCondition(now, 1234),
 					},
 				},
 			}},
@@ -418,8 +529,10 @@ func TestOIDCClientWatcherControllerSync(t *testing.T) {
 					Phase: "Error",
 					Conditions: []configv1alpha1.Condition{
 						happyAllowedGrantTypesCondition(now, 1234),
+						happyAllowedRedirectURIsCondition(now, 1234),
 						happyAllowedScopesCondition(now, 1234),
 						sadNoClientSecretsCondition(now, 1234, "no client secret found (empty list in storage)"),
+						happyTokenEndpointAuthMethodCondition(now, 1234),
 					},
 					TotalClientSecrets: 0,
 				},
@@ -445,11 +558,13 @@ func TestOIDCClientWatcherControllerSync(t *testing.T) {
 					Phase: "Error",
 					Conditions: []configv1alpha1.Condition{
 						happyAllowedGrantTypesCondition(now, 1234),
+						happyAllowedRedirectURIsCondition(now, 1234),
 						happyAllowedScopesCondition(now, 1234),
 						sadInvalidClientSecretsCondition(now, 1234,
 							"3 stored client secrets found, but some were invalid, so none will be used: "+
 								"hashed client secret at index 1: bcrypt cost 11 is below the required minimum of 12; "+
 								"hashed client secret at index 2: crypto/bcrypt: hashedSecret too short to be a bcrypted password"),
+						happyTokenEndpointAuthMethodCondition(now, 1234),
 					},
 					TotalClientSecrets: 0,
 				},
@@ -479,8 +594,10 @@ func TestOIDCClientWatcherControllerSync(t *testing.T) {
 						Phase: "Ready",
 						Conditions: []configv1alpha1.Condition{
 							happyAllowedGrantTypesCondition(now, 1234),
+							happyAllowedRedirectURIsCondition(now, 1234),
 							happyAllowedScopesCondition(now, 1234),
 							happyClientSecretsCondition(1, now, 1234),
+							happyTokenEndpointAuthMethodCondition(now, 1234),
 						},
 						TotalClientSecrets: 1,
 					},
@@ -491,8 +608,10 @@ func TestOIDCClientWatcherControllerSync(t *testing.T) {
 						Phase: "Error",
 						Conditions: []configv1alpha1.Condition{
 							sadAllowedGrantTypesCondition(now, 4567, `"authorization_code" must always be included in "allowedGrantTypes"`),
+							happyAllowedRedirectURIsCondition(now, 4567),
 							sadAllowedScopesCondition(now, 4567, `"openid" must always be included in "allowedScopes"`),
 							sadNoClientSecretsCondition(now, 4567, "no client secret found (no Secret storage found)"),
+							happyTokenEndpointAuthMethodCondition(now, 4567),
 						},
 						TotalClientSecrets: 0,
 					},
@@ -512,8 +631,10 @@ func TestOIDCClientWatcherControllerSync(t *testing.T) {
 					Phase: "Error",
 					Conditions: []configv1alpha1.Condition{
 						sadAllowedGrantTypesCondition(earlier, 1234, `"authorization_code" must always be included in "allowedGrantTypes"`),
+						happyAllowedRedirectURIsCondition(earlier, 1234),
 						sadAllowedScopesCondition(earlier, 1234, `"openid" must always be included in "allowedScopes"`),
 						happyClientSecretsCondition(1, earlier, 1234),
+						happyTokenEndpointAuthMethodCondition(earlier, 1234),
 					},
 					TotalClientSecrets: 1,
 				},
@@ -527,8 +648,10 @@ func TestOIDCClientWatcherControllerSync(t *testing.T) {
 					Phase: "Ready",
 					Conditions: []configv1alpha1.Condition{
 						happyAllowedGrantTypesCondition(now, 4567),
+						happyAllowedRedirectURIsCondition(earlier, 4567), // was already validated earlier
 						happyAllowedScopesCondition(now, 4567),
 						happyClientSecretsCondition(1, earlier, 4567), // was already validated earlier
+						happyTokenEndpointAuthMethodCondition(earlier, 4567),
 					},
 					TotalClientSecrets: 1,
 				},
@@ -551,8 +674,10 @@ func TestOIDCClientWatcherControllerSync(t *testing.T) {
 					Phase: "Error",
 					Conditions: []configv1alpha1.Condition{
 						sadAllowedGrantTypesCondition(now, 1234, `"refresh_token" must be included in "allowedGrantTypes" when "offline_access" is included in "allowedScopes"`),
+						happyAllowedRedirectURIsCondition(now, 1234),
 						happyAllowedScopesCondition(now, 1234),
 						happyClientSecretsCondition(1, now, 1234),
+						happyTokenEndpointAuthMethodCondition(now, 1234),
 					},
 					TotalClientSecrets: 1,
 				},
@@ -577,11 +702,13 @@ func TestOIDCClientWatcherControllerSync(t *testing.T) {
 						sadAllowedGrantTypesCondition(now, 1234,
 							`"authorization_code" must always be included in "allowedGrantTypes"; `+
 								`"urn:ietf:params:oauth:grant-type:token-exchange" must be included in "allowedGrantTypes" when "pinniped:request-audience" is included in "allowedScopes"`),
+						happyAllowedRedirectURIsCondition(now, 1234),
 						sadAllowedScopesCondition(now, 1234,
 							`"openid" must always be included in "allowedScopes"; `+
 								`"offline_access" must be included in "allowedScopes" when "refresh_token" is included in "allowedGrantTypes"; `+
 								`"username" and "groups" must be included in "allowedScopes" when "pinniped:request-audience" is included in "allowedScopes"`),
 						happyClientSecretsCondition(1, now, 1234),
+						happyTokenEndpointAuthMethodCondition(now, 1234),
 					},
 					TotalClientSecrets: 1,
 				},
@@ -606,10 +733,12 @@ func TestOIDCClientWatcherControllerSync(t *testing.T) {
 						sadAllowedGrantTypesCondition(now, 1234,
 							`"authorization_code" must always be included in "allowedGrantTypes"; `+
 								`"refresh_token" must be included in "allowedGrantTypes" when "offline_access" is included in "allowedScopes"`),
+						happyAllowedRedirectURIsCondition(now, 1234),
 						sadAllowedScopesCondition(now, 1234,
 							`"openid" must always be included in "allowedScopes"; `+
 								`"pinniped:request-audience" must be included in "allowedScopes" when "urn:ietf:params:oauth:grant-type:token-exchange" is included in "allowedGrantTypes"`),
 						happyClientSecretsCondition(1, now, 1234),
+						happyTokenEndpointAuthMethodCondition(now, 1234),
 					},
 					TotalClientSecrets: 1,
 				},
@@ -632,8 +761,10 @@ func TestOIDCClientWatcherControllerSync(t *testing.T) {
 					Phase: "Error",
 					Conditions: []configv1alpha1.Condition{
 						sadAllowedGrantTypesCondition(now, 1234, `"urn:ietf:params:oauth:grant-type:token-exchange" must be included in "allowedGrantTypes" when "pinniped:request-audience" is included in "allowedScopes"`),
+						happyAllowedRedirectURIsCondition(now, 1234),
 						happyAllowedScopesCondition(now, 1234),
 						happyClientSecretsCondition(1, now, 1234),
+						happyTokenEndpointAuthMethodCondition(now, 1234),
 					},
 					TotalClientSecrets: 1,
 				},
@@ -656,8 +787,10 @@ func TestOIDCClientWatcherControllerSync(t *testing.T) {
 					Phase: "Error",
 					Conditions: []configv1alpha1.Condition{
 						happyAllowedGrantTypesCondition(now, 1234),
+						happyAllowedRedirectURIsCondition(now, 1234),
 						sadAllowedScopesCondition(now, 1234, `"offline_access" must be included in "allowedScopes" when "refresh_token" is included in "allowedGrantTypes"`),
 						happyClientSecretsCondition(1, now, 1234),
+						happyTokenEndpointAuthMethodCondition(now, 1234),
 					},
 					TotalClientSecrets: 1,
 				},
@@ -680,8 +813,10 @@ func TestOIDCClientWatcherControllerSync(t *testing.T) {
 					Phase: "Error",
 					Conditions: []configv1alpha1.Condition{
 						happyAllowedGrantTypesCondition(now, 1234),
+						happyAllowedRedirectURIsCondition(now, 1234),
 						sadAllowedScopesCondition(now, 1234, `"username" and "groups" must be included in "allowedScopes" when "pinniped:request-audience" is included in "allowedScopes"`),
 						happyClientSecretsCondition(1, now, 1234),
+						happyTokenEndpointAuthMethodCondition(now, 1234),
 					},
 					TotalClientSecrets: 1,
 				},
@@ -704,8 +839,10 @@ func TestOIDCClientWatcherControllerSync(t *testing.T) {
 					Phase: "Error",
 					Conditions: []configv1alpha1.Condition{
 						happyAllowedGrantTypesCondition(now, 1234),
+						happyAllowedRedirectURIsCondition(now, 1234),
 						sadAllowedScopesCondition(now, 1234, `"username" and "groups" must be included in "allowedScopes" when "pinniped:request-audience" is included in "allowedScopes"`),
 						happyClientSecretsCondition(1, now, 1234),
+						happyTokenEndpointAuthMethodCondition(now, 1234),
 					},
 					TotalClientSecrets: 1,
 				},
@@ -728,8 +865,10 @@ func TestOIDCClientWatcherControllerSync(t *testing.T) {
 					Phase: "Error",
 					Conditions: []configv1alpha1.Condition{
 						happyAllowedGrantTypesCondition(now, 1234),
+						happyAllowedRedirectURIsCondition(now, 1234),
 						sadAllowedScopesCondition(now, 1234, `"username" and "groups" must be included in "allowedScopes" when "pinniped:request-audience" is included in "allowedScopes"`),
 						happyClientSecretsCondition(1, now, 1234),
+						happyTokenEndpointAuthMethodCondition(now, 1234),
 					},
 					TotalClientSecrets: 1,
 				},
@@ -752,8 +891,10 @@ func TestOIDCClientWatcherControllerSync(t *testing.T) {
 					Phase: "Error",
 					Conditions: []configv1alpha1.Condition{
 						happyAllowedGrantTypesCondition(now, 1234),
+						happyAllowedRedirectURIsCondition(now, 1234),
 						sadAllowedScopesCondition(now, 1234, `"pinniped:request-audience" must be included in "allowedScopes" when "urn:ietf:params:oauth:grant-type:token-exchange" is included in "allowedGrantTypes"`),
 						happyClientSecretsCondition(1, now, 1234),
+						happyTokenEndpointAuthMethodCondition(now, 1234),
 					},
 					TotalClientSecrets: 1,
 				},
@@ -776,8 +917,10 @@ func TestOIDCClientWatcherControllerSync(t *testing.T) {
 					Phase: "Ready",
 					Conditions: []configv1alpha1.Condition{
 						happyAllowedGrantTypesCondition(now, 1234),
+						happyAllowedRedirectURIsCondition(now, 1234),
 						happyAllowedScopesCondition(now, 1234),
 						happyClientSecretsCondition(1, now, 1234),
+						happyTokenEndpointAuthMethodCondition(now, 1234),
 					},
 					TotalClientSecrets: 1,
 				},
@@ -800,8 +943,10 @@ func TestOIDCClientWatcherControllerSync(t *testing.T) {
 					Phase: "Ready",
 					Conditions: []configv1alpha1.Condition{
 						happyAllowedGrantTypesCondition(now, 1234),
+						happyAllowedRedirectURIsCondition(now, 1234),
 						happyAllowedScopesCondition(now, 1234),
 						happyClientSecretsCondition(1, now, 1234),
+						happyTokenEndpointAuthMethodCondition(now, 1234),
 					},
 					TotalClientSecrets: 1,
 				},
@@ -824,8 +969,10 @@ func TestOIDCClientWatcherControllerSync(t *testing.T) {
 					Phase: "Ready",
 					Conditions: []configv1alpha1.Condition{
 						happyAllowedGrantTypesCondition(now, 1234),
+						happyAllowedRedirectURIsCondition(now, 1234),
 						happyAllowedScopesCondition(now, 1234),
 						happyClientSecretsCondition(1, now, 1234),
+						happyTokenEndpointAuthMethodCondition(now, 1234),
 					},
 					TotalClientSecrets: 1,
 				},
@@ -848,8 +995,10 @@ func TestOIDCClientWatcherControllerSync(t *testing.T) {
 					Phase: "Ready",
 					Conditions: []configv1alpha1.Condition{
 						happyAllowedGrantTypesCondition(now, 1234),
+						happyAllowedRedirectURIsCondition(now, 1234),
 						happyAllowedScopesCondition(now, 1234),
 						happyClientSecretsCondition(1, now, 1234),
+						happyTokenEndpointAuthMethodCondition(now, 1234),
 					},
 					TotalClientSecrets: 1,
 				},
@@ -872,8 +1021,10 @@ func TestOIDCClientWatcherControllerSync(t *testing.T) {
 					Phase: "Ready",
 					Conditions: []configv1alpha1.Condition{
 						happyAllowedGrantTypesCondition(now, 1234),
+						happyAllowedRedirectURIsCondition(now, 1234),
 						happyAllowedScopesCondition(now, 1234),
 						happyClientSecretsCondition(1, now, 1234),
+						happyTokenEndpointAuthMethodCondition(now, 1234),
 					},
 					TotalClientSecrets: 1,
 				},
@@ -896,8 +1047,10 @@ func TestOIDCClientWatcherControllerSync(t *testing.T) {
 					Phase: "Ready",
 					Conditions: []configv1alpha1.Condition{
 						happyAllowedGrantTypesCondition(now, 1234),
+						happyAllowedRedirectURIsCondition(now, 1234),
 						happyAllowedScopesCondition(now, 1234),
 						happyClientSecretsCondition(1, now, 1234),
+						happyTokenEndpointAuthMethodCondition(now, 1234),
 					},
 					TotalClientSecrets: 1,
 				},
@@ -920,8 +1073,10 @@ func TestOIDCClientWatcherControllerSync(t *testing.T) {
 					Phase: "Ready",
 					Conditions: []configv1alpha1.Condition{
 						happyAllowedGrantTypesCondition(now, 1234),
+						happyAllowedRedirectURIsCondition(now, 1234),
 						happyAllowedScopesCondition(now, 1234),
 						happyClientSecretsCondition(1, now, 1234),
+						happyTokenEndpointAuthMethodCondition(now, 1234),
 					},
 					TotalClientSecrets: 1,
 				},
@@ -944,13 +1099,728 @@ func TestOIDCClientWatcherControllerSync(t *testing.T) {
 					Phase: "Ready",
 					Conditions: []configv1alpha1.Condition{
 						happyAllowedGrantTypesCondition(now, 1234),
+						happyAllowedRedirectURIsCondition(now, 1234),
+						happyAllowedScopesCondition(now, 1234),
+						happyClientSecretsCondition(1, now, 1234),
+						happyTokenEndpointAuthMethodCondition(now, 1234),
+					},
+					TotalClientSecrets: 1,
+				},
+			}},
+		},
+		{
+			name: "successfully validate a public OIDCClient which has no client secret storage",
+			inputObjects: []runtime.Object{&configv1alpha1.OIDCClient{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testUID},
+				Spec: configv1alpha1.OIDCClientSpec{
+					Public:              true,
+					AllowedRedirectURIs: []configv1alpha1.RedirectURI{"http://127.0.0.1/callback", "http://[::1]:1234/callback", "com.example.app:/callback"},
+					AllowedGrantTypes:   []configv1alpha1.GrantType{"authorization_code"},
+					AllowedScopes:       []configv1alpha1.Scope{"openid"},
+				},
+			}},
+			wantAPIActions: 1, // one update
+			wantResultingOIDCClients: []configv1alpha1.OIDCClient{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testUID},
+				Status: configv1alpha1.OIDCClientStatus{
+					Phase: "Ready",
+					Conditions: []configv1alpha1.Condition{
+						happyAllowedGrantTypesCondition(now, 1234),
+						happyAllowedRedirectURIsCondition(now, 1234),
+						happyAllowedScopesCondition(now, 1234),
+						happyNoClientSecretsCondition(now, 1234),
+						happyTokenEndpointAuthMethodCondition(now, 1234),
+					},
+					TotalClientSecrets: 0,
+				},
+			}},
+		},
+		{
+			name: "successfully validate a public OIDCClient which has client secret storage containing an empty list",
+			inputObjects: []runtime.Object{&configv1alpha1.OIDCClient{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testUID},
+				Spec: configv1alpha1.OIDCClientSpec{
+					Public:              true,
+					AllowedRedirectURIs: []configv1alpha1.RedirectURI{"http://127.0.0.1/callback"},
+					AllowedGrantTypes:   []configv1alpha1.GrantType{"authorization_code"},
+					AllowedScopes:       []configv1alpha1.Scope{"openid"},
+				},
+			}},
+			inputSecrets:   []runtime.Object{testutil.OIDCClientSecretStorageSecretForUID(t, testNamespace, testUID, []string{})},
+			wantAPIActions: 1, // one update
+			wantResultingOIDCClients: []configv1alpha1.OIDCClient{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testUID},
+				Status: configv1alpha1.OIDCClientStatus{
+					Phase: "Ready",
+					Conditions: []configv1alpha1.Condition{
+						happyAllowedGrantTypesCondition(now, 1234),
+						happyAllowedRedirectURIsCondition(now, 1234),
+						happyAllowedScopesCondition(now, 1234),
+						happyNoClientSecretsCondition(now, 1234),
+						happyTokenEndpointAuthMethodCondition(now, 1234),
+					},
+					TotalClientSecrets: 0,
+				},
+			}},
+		},
+		{
+			name: "a public OIDCClient must not have any client secrets",
+			inputObjects: []runtime.Object{&configv1alpha1.OIDCClient{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testUID},
+				Spec: configv1alpha1.OIDCClientSpec{
+					Public:              true,
+					AllowedRedirectURIs: []configv1alpha1.RedirectURI{"http://127.0.0.1/callback"},
+					AllowedGrantTypes:   []configv1alpha1.GrantType{"authorization_code"},
+					AllowedScopes:       []configv1alpha1.Scope{"openid"},
+				},
+			}},
+			inputSecrets:   []runtime.Object{testutil.OIDCClientSecretStorageSecretForUID(t, testNamespace, testUID, []string{testutil.HashedPassword1AtSupervisorMinCost})},
+			wantAPIActions: 1, // one update
+			wantResultingOIDCClients: []configv1alpha1.OIDCClient{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testUID},
+				Status: configv1alpha1.OIDCClientStatus{
+					Phase: "Error",
+					Conditions: []configv1alpha1.Condition{
+						happyAllowedGrantTypesCondition(now, 1234),
+						happyAllowedRedirectURIsCondition(now, 1234),
+						happyAllowedScopesCondition(now, 1234),
+						sadPublicClientSecretsCondition(now, 1234, "1 client secret(s) found, but public clients must not have client secrets"),
+						happyTokenEndpointAuthMethodCondition(now, 1234),
+					},
+					TotalClientSecrets: 0,
+				},
+			}},
+		},
+		{
+			name: "a public OIDCClient must use loopback or private-use URI scheme redirect URIs",
+			inputObjects: []runtime.Object{&configv1alpha1.OIDCClient{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testUID},
+				Spec: configv1alpha1.OIDCClientSpec{
+					Public:                        true,
+					AllowedRedirectURIs:           []configv1alpha1.RedirectURI{"https://example.com/callback", "http://127.0.0.1/callback"},
+					AllowedPostLogoutRedirectURIs: []configv1alpha1.RedirectURI{"https://example.com/logout", "com.example.app:/logout"},
+					AllowedGrantTypes:             []configv1alpha1.GrantType{"authorization_code"},
+					AllowedScopes:                 []configv1alpha1.Scope{"openid"},
+				},
+			}},
+			wantAPIActions: 1, // one update
+			wantResultingOIDCClients: []configv1alpha1.OIDCClient{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testUID},
+				Status: configv1alpha1.OIDCClientStatus{
+					Phase: "Error",
+					Conditions: []configv1alpha1.Condition{
+						happyAllowedGrantTypesCondition(now, 1234),
+						sadAllowedRedirectURIsCondition(now, 1234,
+							`"https://example.com/callback" in "allowedRedirectURIs" must use either the http scheme with the hostname 127.0.0.1 or ::1, `+
+								`or a private-use URI scheme, because the client is public`),
+						happyAllowedScopesCondition(now, 1234),
+						happyNoClientSecretsCondition(now, 1234),
+						happyTokenEndpointAuthMethodCondition(now, 1234),
+					},
+					TotalClientSecrets: 0,
+				},
+			}},
+		},
+		{
+			name: "a confidential OIDCClient must not use private-use URI scheme redirect URIs",
+			inputObjects: []runtime.Object{&configv1alpha1.OIDCClient{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testUID},
+				Spec: configv1alpha1.OIDCClientSpec{
+					AllowedRedirectURIs:           []configv1alpha1.RedirectURI{"com.example.app:/callback"},
+					AllowedPostLogoutRedirectURIs: []configv1alpha1.RedirectURI{"com.example.app:/logout"},
+					AllowedGrantTypes:             []configv1alpha1.GrantType{"authorization_code"},
+					AllowedScopes:                 []configv1alpha1.Scope{"openid"},
+				},
+			}},
+			inputSecrets:   []runtime.Object{testutil.OIDCClientSecretStorageSecretForUID(t, testNamespace, testUID, []string{testutil.HashedPassword1AtSupervisorMinCost})},
+			wantAPIActions: 1, // one update
+			wantResultingOIDCClients: []configv1alpha1.OIDCClient{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testUID},
+				Status: configv1alpha1.OIDCClientStatus{
+					Phase: "Error",
+					Conditions: []configv1alpha1.Condition{
+						happyAllowedGrantTypesCondition(now, 1234),
+						sadAllowedRedirectURIsCondition(now, 1234,
+							`"com.example.app:/callback" in "allowedRedirectURIs" uses a private-use URI scheme, which is only allowed for public clients; `+
+								`"com.example.app:/logout" in "allowedPostLogoutRedirectURIs" uses a private-use URI scheme, which is only allowed for public clients`),
 						happyAllowedScopesCondition(now, 1234),
 						happyClientSecretsCondition(1, now, 1234),
+						happyTokenEndpointAuthMethodCondition(now, 1234),
 					},
 					TotalClientSecrets: 1,
 				},
 			}},
 		},
+		{
+			name: "a confidential OIDCClient which is changed to be a public client no longer has the ClientSecretExists condition",
+			inputObjects: []runtime.Object{&configv1alpha1.OIDCClient{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 4567, UID: testUID},
+				Spec: configv1alpha1.OIDCClientSpec{
+					Public:              true,
+					AllowedRedirectURIs: []configv1alpha1.RedirectURI{"http://127.0.0.1/callback"},
+					AllowedGrantTypes:   []configv1alpha1.GrantType{"authorization_code"},
+					AllowedScopes:       []configv1alpha1.Scope{"openid"},
+				},
+				Status: configv1alpha1.OIDCClientStatus{
+					Phase: "Error",
+					Conditions: []configv1alpha1.Condition{
+						happyAllowedGrantTypesCondition(earlier, 1234),
+						happyAllowedRedirectURIsCondition(earlier, 1234),
+						happyAllowedScopesCondition(earlier, 1234),
+						sadNoClientSecretsCondition(earlier, 1234, "no client secret found (no Secret storage found)"),
+						happyTokenEndpointAuthMethodCondition(earlier, 1234),
+					},
+				},
+			}},
+			wantAPIActions: 1, // one update
+			wantResultingOIDCClients: []configv1alpha1.OIDCClient{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 4567, UID: testUID},
+				Status: configv1alpha1.OIDCClientStatus{
+					Phase: "Ready",
+					Conditions: []configv1alpha1.Condition{
+						happyAllowedGrantTypesCondition(earlier, 4567),
+						happyAllowedRedirectURIsCondition(earlier, 4567),
+						happyAllowedScopesCondition(earlier, 4567),
+						happyNoClientSecretsCondition(now, 4567),
+						happyTokenEndpointAuthMethodCondition(earlier, 4567),
+					},
+					TotalClientSecrets: 0,
+				},
+			}},
+		},
+		{
+			name: "successfully validate an OIDCClient which uses private_key_jwt with an inline JWKS",
+			inputObjects: []runtime.Object{&configv1alpha1.OIDCClient{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testUID},
+				Spec: configv1alpha1.OIDCClientSpec{
+					AllowedGrantTypes:       []configv1alpha1.GrantType{"authorization_code"},
+					AllowedScopes:           []configv1alpha1.Scope{"openid"},
+					TokenEndpointAuthMethod: "private_key_jwt",
+					JWKS:                    &configv1alpha1.OIDCClientJWKS{Inline: string(clientJWKS), SigningAlgorithm: "ES256"},
+				},
+			}},
+			wantAPIActions: 1, // one update
+			wantResultingOIDCClients: []configv1alpha1.OIDCClient{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testUID},
+				Status: configv1alpha1.OIDCClientStatus{
+					Phase: "Ready",
+					Conditions: []configv1alpha1.Condition{
+						happyAllowedGrantTypesCondition(now, 1234),
+						happyAllowedRedirectURIsCondition(now, 1234),
+						happyAllowedScopesCondition(now, 1234),
+						happyNoClientSecretsForAuthMethodCondition("private_key_jwt", now, 1234),
+						happyTokenEndpointAuthMethodCondition(now, 1234),
+					},
+					TotalClientSecrets: 0,
+				},
+			}},
+		},
+		{
+			name: "successfully validate an OIDCClient which uses tls_client_auth",
+			inputObjects: []runtime.Object{&configv1alpha1.OIDCClient{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testUID},
+				Spec: configv1alpha1.OIDCClientSpec{
+					AllowedGrantTypes:       []configv1alpha1.GrantType{"authorization_code"},
+					AllowedScopes:           []configv1alpha1.Scope{"openid"},
+					TokenEndpointAuthMethod: "tls_client_auth",
+					TLSClientAuth:           &configv1alpha1.OIDCClientTLSClientAuth{CertificateAuthorityData: clientCAData, SubjectDN: "CN=my-webapp"},
+				},
+			}},
+			wantAPIActions: 1, // one update
+			wantResultingOIDCClients: []configv1alpha1.OIDCClient{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testUID},
+				Status: configv1alpha1.OIDCClientStatus{
+					Phase: "Ready",
+					Conditions: []configv1alpha1.Condition{
+						happyAllowedGrantTypesCondition(now, 1234),
+						happyAllowedRedirectURIsCondition(now, 1234),
+						happyAllowedScopesCondition(now, 1234),
+						happyNoClientSecretsForAuthMethodCondition("tls_client_auth", now, 1234),
+						happyTokenEndpointAuthMethodCondition(now, 1234),
+					},
+					TotalClientSecrets: 0,
+				},
+			}},
+		},
+		{
+			name: "an OIDCClient which uses private_key_jwt must not have any client secrets",
+			inputObjects: []runtime.Object{&configv1alpha1.OIDCClient{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testUID},
+				Spec: configv1alpha1.OIDCClientSpec{
+					AllowedGrantTypes:       []configv1alpha1.GrantType{"authorization_code"},
+					AllowedScopes:           []configv1alpha1.Scope{"openid"},
+					TokenEndpointAuthMethod: "private_key_jwt",
+					JWKS:                    &configv1alpha1.OIDCClientJWKS{URL: "https://example.com/jwks.json"},
+				},
+			}},
+			inputSecrets:   []runtime.Object{testutil.OIDCClientSecretStorageSecretForUID(t, testNamespace, testUID, []string{testutil.HashedPassword1AtSupervisorMinCost})},
+			wantAPIActions: 1, // one update
+			wantResultingOIDCClients: []configv1alpha1.OIDCClient{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testUID},
+				Status: configv1alpha1.OIDCClientStatus{
+					Phase: "Error",
+					Conditions: []configv1alpha1.Condition{
+						happyAllowedGrantTypesCondition(now, 1234),
+						happyAllowedRedirectURIsCondition(now, 1234),
+						happyAllowedScopesCondition(now, 1234),
+						sadPublicClientSecretsCondition(now, 1234,
+							`1 client secret(s) found, but clients which use "tokenEndpointAuthMethod" "private_key_jwt" must not have client secrets`),
+						happyTokenEndpointAuthMethodCondition(now, 1234),
+					},
+					TotalClientSecrets: 0,
+				},
+			}},
+		},
+		{
+			name: "an OIDCClient which uses private_key_jwt must have a valid JWKS",
+			inputObjects: []runtime.Object{
+				&configv1alpha1.OIDCClient{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "client.oauth.pinniped.dev-test1", Generation: 1234, UID: "uid1"},
+					Spec: configv1alpha1.OIDCClientSpec{
+						AllowedGrantTypes:       []configv1alpha1.GrantType{"authorization_code"},
+						AllowedScopes:           []configv1alpha1.Scope{"openid"},
+						TokenEndpointAuthMethod: "private_key_jwt",
+					},
+				},
+				&configv1alpha1.OIDCClient{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "client.oauth.pinniped.dev-test2", Generation: 1234, UID: "uid2"},
+					Spec: configv1alpha1.OIDCClientSpec{
+						AllowedGrantTypes:       []configv1alpha1.GrantType{"authorization_code"},
+						AllowedScopes:           []configv1alpha1.Scope{"openid"},
+						TokenEndpointAuthMethod: "private_key_jwt",
+						JWKS:                    &configv1alpha1.OIDCClientJWKS{Inline: string(clientJWKS), URL: "https://example.com/jwks.json"},
+					},
+				},
+				&configv1alpha1.OIDCClient{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "client.oauth.pinniped.dev-test3", Generation: 1234, UID: "uid3"},
+					Spec: configv1alpha1.OIDCClientSpec{
+						AllowedGrantTypes:       []configv1alpha1.GrantType{"authorization_code"},
+						AllowedScopes:           []configv1alpha1.Scope{"openid"},
+						TokenEndpointAuthMethod: "private_key_jwt",
+						JWKS:                    &configv1alpha1.OIDCClientJWKS{Inline: string(privateClientJWKS)},
+					},
+				},
+			},
+			wantAPIActions: 3, // one update for each OIDCClient
+			wantResultingOIDCClients: []configv1alpha1.OIDCClient{
+				{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "client.oauth.pinniped.dev-test1", Generation: 1234, UID: "uid1"},
+					Status: configv1alpha1.OIDCClientStatus{
+						Phase: "Error",
+						Conditions: []configv1alpha1.Condition{
+							happyAllowedGrantTypesCondition(now, 1234),
+							happyAllowedRedirectURIsCondition(now, 1234),
+							happyAllowedScopesCondition(now, 1234),
+							happyNoClientSecretsForAuthMethodCondition("private_key_jwt", now, 1234),
+							sadTokenEndpointAuthMethodCondition(now, 1234, `"jwks" must be provided when "tokenEndpointAuthMethod" is "private_key_jwt"`),
+						},
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "client.oauth.pinniped.dev-test2", Generation: 1234, UID: "uid2"},
+					Status: configv1alpha1.OIDCClientStatus{
+						Phase: "Error",
+						Conditions: []configv1alpha1.Condition{
+							happyAllowedGrantTypesCondition(now, 1234),
+							happyAllowedRedirectURIsCondition(now, 1234),
+							happyAllowedScopesCondition(now, 1234),
+							happyNoClientSecretsForAuthMethodCondition("private_key_jwt", now, 1234),
+							sadTokenEndpointAuthMethodCondition(now, 1234, `exactly one of "jwks.inline" or "jwks.url" must be provided`),
+						},
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "client.oauth.pinniped.dev-test3", Generation: 1234, UID: "uid3"},
+					Status: configv1alpha1.OIDCClientStatus{
+						Phase: "Error",
+						Conditions: []configv1alpha1.Condition{
+							happyAllowedGrantTypesCondition(now, 1234),
+							happyAllowedRedirectURIsCondition(now, 1234),
+							happyAllowedScopesCondition(now, 1234),
+							happyNoClientSecretsForAuthMethodCondition("private_key_jwt", now, 1234),
+							sadTokenEndpointAuthMethodCondition(now, 1234, `"jwks.inline" is invalid: key at index 0 is not a public key`),
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "jwks and tlsClientAuth must only be used with their token endpoint auth methods",
+			inputObjects: []runtime.Object{
+				&configv1alpha1.OIDCClient{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "client.oauth.pinniped.dev-test1", Generation: 1234, UID: "uid1"},
+					Spec: configv1alpha1.OIDCClientSpec{
+						AllowedGrantTypes: []configv1alpha1.GrantType{"authorization_code"},
+						AllowedScopes:     []configv1alpha1.Scope{"openid"},
+						JWKS:              &configv1alpha1.OIDCClientJWKS{Inline: string(clientJWKS)},
+						TLSClientAuth:     &configv1alpha1.OIDCClientTLSClientAuth{CertificateAuthorityData: clientCAData},
+					},
+				},
+				&configv1alpha1.OIDCClient{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "client.oauth.pinniped.dev-test2", Generation: 1234, UID: "uid2"},
+					Spec: configv1alpha1.OIDCClientSpec{
+						AllowedGrantTypes:       []configv1alpha1.GrantType{"authorization_code"},
+						AllowedScopes:           []configv1alpha1.Scope{"openid"},
+						TokenEndpointAuthMethod: "tls_client_auth",
+						TLSClientAuth:           &configv1alpha1.OIDCClientTLSClientAuth{CertificateAuthorityData: base64.StdEncoding.EncodeToString([]byte("not a PEM")), SubjectDN: "CN=my-webapp"},
+					},
+				},
+				&configv1alpha1.OIDCClient{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "client.oauth.pinniped.dev-test3", Generation: 1234, UID: "uid3"},
+					Spec: configv1alpha1.OIDCClientSpec{
+						Public:                  true,
+						AllowedRedirectURIs:     []configv1alpha1.RedirectURI{"http://127.0.0.1/callback"},
+						AllowedGrantTypes:       []configv1alpha1.GrantType{"authorization_code"},
+						AllowedScopes:           []configv1alpha1.Scope{"openid"},
+						TokenEndpointAuthMethod: "client_secret_basic",
+					},
+				},
+			},
+			inputSecrets:   []runtime.Object{testutil.OIDCClientSecretStorageSecretForUID(t, testNamespace, "uid1", []string{testutil.HashedPassword1AtSupervisorMinCost})},
+			wantAPIActions: 3, // one update for each OIDCClient
+			wantResultingOIDCClients: []configv1alpha1.OIDCClient{
+				{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "client.oauth.pinniped.dev-test1", Generation: 1234, UID: "uid1"},
+					Status: configv1alpha1.OIDCClientStatus{
+						Phase: "Error",
+						Conditions: []configv1alpha1.Condition{
+							happyAllowedGrantTypesCondition(now, 1234),
+							happyAllowedRedirectURIsCondition(now, 1234),
+							happyAllowedScopesCondition(now, 1234),
+							happyClientSecretsCondition(1, now, 1234),
+							sadTokenEndpointAuthMethodCondition(now, 1234,
+								`"jwks" must only be provided when "tokenEndpointAuthMethod" is "private_key_jwt"; `+
+									`"tlsClientAuth" must only be provided when "tokenEndpointAuthMethod" is "tls_client_auth"`),
+						},
+						TotalClientSecrets: 1,
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "client.oauth.pinniped.dev-test2", Generation: 1234, UID: "uid2"},
+					Status: configv1alpha1.OIDCClientStatus{
+						Phase: "Error",
+						Conditions: []configv1alpha1.Condition{
+							happyAllowedGrantTypesCondition(now, 1234),
+							happyAllowedRedirectURIsCondition(now, 1234),
+							happyAllowedScopesCondition(now, 1234),
+							happyNoClientSecretsForAuthMethodCondition("tls_client_auth", now, 1234),
+							sadTokenEndpointAuthMethodCondition(now, 1234, `"tlsClientAuth.certificateAuthorityData" is invalid: no certificates found`),
+						},
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "client.oauth.pinniped.dev-test3", Generation: 1234, UID: "uid3"},
+					Status: configv1alpha1.OIDCClientStatus{
+						Phase: "Error",
+						Conditions: []configv1alpha1.Condition{
+							happyAllowedGrantTypesCondition(now, 1234),
+							happyAllowedRedirectURIsCondition(now, 1234),
+							happyAllowedScopesCondition(now, 1234),
+							happyNoClientSecretsCondition(now, 1234),
+							sadTokenEndpointAuthMethodCondition(now, 1234, `"tokenEndpointAuthMethod" must not be provided for public clients`),
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "tlsClientAuth must identify the client's certificate by exactly one valid subject or subject alternative name",
+			inputObjects: []runtime.Object{
+				&configv1alpha1.OIDCClient{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "client.oauth.pinniped.dev-test1", Generation: 1234, UID: "uid1"},
+					Spec: configv1alpha1.OIDCClientSpec{
+						AllowedGrantTypes:       []configv1alpha1.GrantType{"authorization_code"},
+						AllowedScopes:           []configv1alpha1.Scope{"openid"},
+						TokenEndpointAuthMethod: "tls_client_auth",
+						TLSClientAuth:           &configv1alpha1.OIDCClientTLSClientAuth{CertificateAuthorityData: clientCAData},
+					},
+				},
+				&configv1alpha1.OIDCClient{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "client.oauth.pinniped.dev-test2", Generation: 1234, UID: "uid2"},
+					Spec: configv1alpha1.OIDCClientSpec{
+						AllowedGrantTypes:       []configv1alpha1.GrantType{"authorization_code"},
+						AllowedScopes:           []configv1alpha1.Scope{"openid"},
+						TokenEndpointAuthMethod: "tls_client_auth",
+						TLSClientAuth:           &configv1alpha1.OIDCClientTLSClientAuth{CertificateAuthorityData: clientCAData, SubjectDN: "CN=my-webapp", SANDNS: "webapp.example.com"},
+					},
+				},
+				&configv1alpha1.OIDCClient{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "client.oauth.pinniped.dev-test3", Generation: 1234, UID: "uid3"},
+					Spec: configv1alpha1.OIDCClientSpec{
+						AllowedGrantTypes:       []configv1alpha1.GrantType{"authorization_code"},
+						AllowedScopes:           []configv1alpha1.Scope{"openid"},
+						TokenEndpointAuthMethod: "tls_client_auth",
+						TLSClientAuth:           &configv1alpha1.OIDCClientTLSClientAuth{CertificateAuthorityData: clientCAData, SubjectDN: "CN"},
+					},
+				},
+				&configv1alpha1.OIDCClient{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "client.oauth.pinniped.dev-test4", Generation: 1234, UID: "uid4"},
+					Spec: configv1alpha1.OIDCClientSpec{
+						AllowedGrantTypes:       []configv1alpha1.GrantType{"authorization_code"},
+						AllowedScopes:           []configv1alpha1.Scope{"openid"},
+						TokenEndpointAuthMethod: "tls_client_auth",
+						TLSClientAuth:           &configv1alpha1.OIDCClientTLSClientAuth{CertificateAuthorityData: clientCAData, SANURI: "webapp"},
+					},
+				},
+				&configv1alpha1.OIDCClient{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "client.oauth.pinniped.dev-test5", Generation: 1234, UID: "uid5"},
+					Spec: configv1alpha1.OIDCClientSpec{
+						AllowedGrantTypes:       []configv1alpha1.GrantType{"authorization_code"},
+						AllowedScopes:           []configv1alpha1.Scope{"openid"},
+						TokenEndpointAuthMethod: "tls_client_auth",
+						TLSClientAuth:           &configv1alpha1.OIDCClientTLSClientAuth{CertificateAuthorityData: clientCAData, SANIP: "webapp.example.com"},
+					},
+				},
+			},
+			wantAPIActions: 5, // one update for each OIDCClient
+			wantResultingOIDCClients: []configv1alpha1.OIDCClient{
+				{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "client.oauth.pinniped.dev-test1", Generation: 1234, UID: "uid1"},
+					Status: configv1alpha1.OIDCClientStatus{
+						Phase: "Error",
+						Conditions: []configv1alpha1.Condition{
+							happyAllowedGrantTypesCondition(now, 1234),
+							happyAllowedRedirectURIsCondition(now, 1234),
+							happyAllowedScopesCondition(now, 1234),
+							happyNoClientSecretsForAuthMethodCondition("tls_client_auth", now, 1234),
+							sadTokenEndpointAuthMethodCondition(now, 1234, `exactly one of "tlsClientAuth.subjectDN", "tlsClientAuth.sanDNS", "tlsClientAuth.sanURI", "tlsClientAuth.sanIP", or "tlsClientAuth.sanEmail" must be provided`),
+						},
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "client.oauth.pinniped.dev-test2", Generation: 1234, UID: "uid2"},
+					Status: configv1alpha1.OIDCClientStatus{
+						Phase: "Error",
+						Conditions: []configv1alpha1.Condition{
+							happyAllowedGrantTypesCondition(now, 1234),
+							happyAllowedRedirectURIsCondition(now, 1234),
+							happyAllowedScopesCondition(now, 1234),
+							happyNoClientSecretsForAuthMethodCondition("tls_client_auth", now, 1234),
+							sadTokenEndpointAuthMethodCondition(now, 1234, `exactly one of "tlsClientAuth.subjectDN", "tlsClientAuth.sanDNS", "tlsClientAuth.sanURI", "tlsClientAuth.sanIP", or "tlsClientAuth.sanEmail" must be provided`),
+						},
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "client.oauth.pinniped.dev-test3", Generation: 1234, UID: "uid3"},
+					Status: configv1alpha1.OIDCClientStatus{
+						Phase: "Error",
+						Conditions: []configv1alpha1.Condition{
+							happyAllowedGrantTypesCondition(now, 1234),
+							happyAllowedRedirectURIsCondition(now, 1234),
+							happyAllowedScopesCondition(now, 1234),
+							happyNoClientSecretsForAuthMethodCondition("tls_client_auth", now, 1234),
+							sadTokenEndpointAuthMethodCondition(now, 1234, `"tlsClientAuth.subjectDN" is invalid: could not parse distinguished name: DN ended with incomplete type, value pair`),
+						},
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "client.oauth.pinniped.dev-test4", Generation: 1234, UID: "uid4"},
+					Status: configv1alpha1.OIDCClientStatus{
+						Phase: "Error",
+						Conditions: []configv1alpha1.Condition{
+							happyAllowedGrantTypesCondition(now, 1234),
+							happyAllowedRedirectURIsCondition(now, 1234),
+							happyAllowedScopesCondition(now, 1234),
+							happyNoClientSecretsForAuthMethodCondition("tls_client_auth", now, 1234),
+							sadTokenEndpointAuthMethodCondition(now, 1234, `"tlsClientAuth.sanURI" is invalid: must be an absolute URI`),
+						},
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "client.oauth.pinniped.dev-test5", Generation: 1234, UID: "uid5"},
+					Status: configv1alpha1.OIDCClientStatus{
+						Phase: "Error",
+						Conditions: []configv1alpha1.Condition{
+							happyAllowedGrantTypesCondition(now, 1234),
+							happyAllowedRedirectURIsCondition(now, 1234),
+							happyAllowedScopesCondition(now, 1234),
+							happyNoClientSecretsForAuthMethodCondition("tls_client_auth", now, 1234),
+							sadTokenEndpointAuthMethodCondition(now, 1234, `"tlsClientAuth.sanIP" is invalid: must be an IPv4 or IPv6 address`),
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "clientCredentials must be provided exactly when a confidential OIDCClient allows the client_credentials grant",
+			inputObjects: []runtime.Object{
+				&configv1alpha1.OIDCClient{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "client.oauth.pinniped.dev-test1", Generation: 1234, UID: "uid1"},
+					Spec: configv1alpha1.OIDCClientSpec{
+						AllowedGrantTypes: []configv1alpha1.GrantType{"authorization_code", "client_credentials"},
+						AllowedScopes:     []configv1alpha1.Scope{"openid"},
+						ClientCredentials: &configv1alpha1.OIDCClientCredentials{Username: "ci-runner", Groups: []string{"ci"}},
+					},
+				},
+				&configv1alpha1.OIDCClient{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "client.oauth.pinniped.dev-test2", Generation: 1234, UID: "uid2"},
+					Spec: configv1alpha1.OIDCClientSpec{
+						AllowedGrantTypes: []configv1alpha1.GrantType{"authorization_code", "client_credentials"},
+						AllowedScopes:     []configv1alpha1.Scope{"openid"},
+					},
+				},
+				&configv1alpha1.OIDCClient{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "client.oauth.pinniped.dev-test3", Generation: 1234, UID: "uid3"},
+					Spec: configv1alpha1.OIDCClientSpec{
+						AllowedGrantTypes: []configv1alpha1.GrantType{"authorization_code"},
+						AllowedScopes:     []configv1alpha1.Scope{"openid"},
+						ClientCredentials: &configv1alpha1.OIDCClientCredentials{Username: "ci-runner"},
+					},
+				},
+				&configv1alpha1.OIDCClient{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "client.oauth.pinniped.dev-test4", Generation: 1234, UID: "uid4"},
+					Spec: configv1alpha1.OIDCClientSpec{
+						Public:              true,
+						AllowedRedirectURIs: []configv1alpha1.RedirectURI{"http://127.0.0.1/callback"},
+						AllowedGrantTypes:   []configv1alpha1.GrantType{"authorization_code", "client_credentials"},
+						AllowedScopes:       []configv1alpha1.Scope{"openid"},
+						ClientCredentials:   &configv1alpha1.OIDCClientCredentials{Username: "ci-runner"},
+					},
+				},
+			},
+			inputSecrets: []runtime.Object{
+				testutil.OIDCClientSecretStorageSecretForUID(t, testNamespace, "uid1", []string{testutil.HashedPassword1AtSupervisorMinCost}),
+				testutil.OIDCClientSecretStorageSecretForUID(t, testNamespace, "uid2", []string{testutil.HashedPassword1AtSupervisorMinCost}),
+				testutil.OIDCClientSecretStorageSecretForUID(t, testNamespace, "uid3", []string{testutil.HashedPassword1AtSupervisorMinCost}),
+			},
+			wantAPIActions: 4, // one update for each OIDCClient
+			wantResultingOIDCClients: []configv1alpha1.OIDCClient{
+				{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "client.oauth.pinniped.dev-test1", Generation: 1234, UID: "uid1"},
+					Status: configv1alpha1.OIDCClientStatus{
+						Phase: "Ready",
+						Conditions: []configv1alpha1.Condition{
+							happyAllowedGrantTypesCondition(now, 1234),
+							happyAllowedRedirectURIsCondition(now, 1234),
+							happyAllowedScopesCondition(now, 1234),
+							happyClientSecretsCondition(1, now, 1234),
+							happyTokenEndpointAuthMethodCondition(now, 1234),
+						},
+						TotalClientSecrets: 1,
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "client.oauth.pinniped.dev-test2", Generation: 1234, UID: "uid2"},
+					Status: configv1alpha1.OIDCClientStatus{
+						Phase: "Error",
+						Conditions: []configv1alpha1.Condition{
+							sadAllowedGrantTypesCondition(now, 1234, `"clientCredentials" must be provided when "client_credentials" is included in "allowedGrantTypes"`),
+							happyAllowedRedirectURIsCondition(now, 1234),
+							happyAllowedScopesCondition(now, 1234),
+							happyClientSecretsCondition(1, now, 1234),
+							happyTokenEndpointAuthMethodCondition(now, 1234),
+						},
+						TotalClientSecrets: 1,
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "client.oauth.pinniped.dev-test3", Generation: 1234, UID: "uid3"},
+					Status: configv1alpha1.OIDCClientStatus{
+						Phase: "Error",
+						Conditions: []configv1alpha1.Condition{
+							sadAllowedGrantTypesCondition(now, 1234, `"clientCredentials" must only be provided when "client_credentials" is included in "allowedGrantTypes"`),
+							happyAllowedRedirectURIsCondition(now, 1234),
+							happyAllowedScopesCondition(now, 1234),
+							happyClientSecretsCondition(1, now, 1234),
+							happyTokenEndpointAuthMethodCondition(now, 1234),
+						},
+						TotalClientSecrets: 1,
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "client.oauth.pinniped.dev-test4", Generation: 1234, UID: "uid4"},
+					Status: configv1alpha1.OIDCClientStatus{
+						Phase: "Error",
+						Conditions: []configv1alpha1.Condition{
+							sadAllowedGrantTypesCondition(now, 1234, `"client_credentials" must not be included in "allowedGrantTypes" for public clients`),
+							happyAllowedRedirectURIsCondition(now, 1234),
+							happyAllowedScopesCondition(now, 1234),
+							happyNoClientSecretsCondition(now, 1234),
+							happyTokenEndpointAuthMethodCondition(now, 1234),
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "clientCredentials must not use usernames or groups which are reserved for Kubernetes system identities",
+			inputObjects: []runtime.Object{
+				&configv1alpha1.OIDCClient{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "client.oauth.pinniped.dev-test1", Generation: 1234, UID: "uid1"},
+					Spec: configv1alpha1.OIDCClientSpec{
+						AllowedGrantTypes: []configv1alpha1.GrantType{"authorization_code", "client_credentials"},
+						AllowedScopes:     []configv1alpha1.Scope{"openid"},
+						ClientCredentials: &configv1alpha1.OIDCClientCredentials{Username: "system:admin", Groups: []string{"ci"}},
+					},
+				},
+				&configv1alpha1.OIDCClient{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "client.oauth.pinniped.dev-test2", Generation: 1234, UID: "uid2"},
+					Spec: configv1alpha1.OIDCClientSpec{
+						AllowedGrantTypes: []configv1alpha1.GrantType{"authorization_code", "client_credentials"},
+						AllowedScopes:     []configv1alpha1.Scope{"openid"},
+						ClientCredentials: &configv1alpha1.OIDCClientCredentials{Username: "ci-runner", Groups: []string{"ci", "system:masters"}},
+					},
+				},
+				&configv1alpha1.OIDCClient{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "client.oauth.pinniped.dev-test3", Generation: 1234, UID: "uid3"},
+					Spec: configv1alpha1.OIDCClientSpec{
+						AllowedGrantTypes: []configv1alpha1.GrantType{"authorization_code", "client_credentials"},
+						AllowedScopes:     []configv1alpha1.Scope{"openid"},
+						ClientCredentials: &configv1alpha1.OIDCClientCredentials{Username: "system:serviceaccount:ns:sa", Groups: []string{"system:masters", "system:nodes"}},
+					},
+				},
+			},
+			inputSecrets: []runtime.Object{
+				testutil.OIDCClientSecretStorageSecretForUID(t, testNamespace, "uid1", []string{testutil.HashedPassword1AtSupervisorMinCost}),
+				testutil.OIDCClientSecretStorageSecretForUID(t, testNamespace, "uid2", []string{testutil.HashedPassword1AtSupervisorMinCost}),
+				testutil.OIDCClientSecretStorageSecretForUID(t, testNamespace, "uid3", []string{testutil.HashedPassword1AtSupervisorMinCost}),
+			},
+			wantAPIActions: 3, // one update for each OIDCClient
+			wantResultingOIDCClients: []configv1alpha1.OIDCClient{
+				{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "client.oauth.pinniped.dev-test1", Generation: 1234, UID: "uid1"},
+					Status: configv1alpha1.OIDCClientStatus{
+						Phase: "Error",
+						Conditions: []configv1alpha1.Condition{
+							sadAllowedGrantTypesCondition(now, 1234, `"clientCredentials.username" must not start with "system:"`),
+							happyAllowedRedirectURIsCondition(now, 1234),
+							happyAllowedScopesCondition(now, 1234),
+							happyClientSecretsCondition(1, now, 1234),
+							happyTokenEndpointAuthMethodCondition(now, 1234),
+						},
+						TotalClientSecrets: 1,
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "client.oauth.pinniped.dev-test2", Generation: 1234, UID: "uid2"},
+					Status: configv1alpha1.OIDCClientStatus{
+						Phase: "Error",
+						Conditions: []configv1alpha1.Condition{
+							sadAllowedGrantTypesCondition(now, 1234, `"clientCredentials.groups" must not contain groups which start with "system:"`),
+							happyAllowedRedirectURIsCondition(now, 1234),
+							happyAllowedScopesCondition(now, 1234),
+							happyClientSecretsCondition(1, now, 1234),
+							happyTokenEndpointAuthMethodCondition(now, 1234),
+						},
+						TotalClientSecrets: 1,
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "client.oauth.pinniped.dev-test3", Generation: 1234, UID: "uid3"},
+					Status: configv1alpha1.OIDCClientStatus{
+						Phase: "Error",
+						Conditions: []configv1alpha1.Condition{
+							sadAllowedGrantTypesCondition(now, 1234, `"clientCredentials.username" must not start with "system:"; "clientCredentials.groups" must not contain groups which start with "system:"`),
+							happyAllowedRedirectURIsCondition(now, 1234),
+							happyAllowedScopesCondition(now, 1234),
+							happyClientSecretsCondition(1, now, 1234),
+							happyTokenEndpointAuthMethodCondition(now, 1234),
+						},
+						TotalClientSecrets: 1,
+					},
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
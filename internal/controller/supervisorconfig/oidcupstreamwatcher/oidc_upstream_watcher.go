@@ -1,4 +1,4 @@
-// Copyright 2020-2023 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 // Package oidcupstreamwatcher implements a controller which watches OIDCIdentityProviders.
@@ -214,6 +214,7 @@ func (c *oidcWatcherController) validateUpstream(ctx controllerlib.Context, upst
 		UsernameClaim:            upstream.Spec.Claims.Username,
 		GroupsClaim:              upstream.Spec.Claims.Groups,
 		AllowPasswordGrant:       authorizationConfig.AllowPasswordGrant,
+		EndSessionOnLogout:       authorizationConfig.EndUpstreamSessionOnLogout,
 		AdditionalAuthcodeParams: additionalAuthcodeAuthorizeParameters,
 		AdditionalClaimMappings:  upstream.Spec.Claims.AdditionalClaimMappings,
 		ResourceUID:              upstream.UID,
@@ -350,10 +351,12 @@ func (c *oidcWatcherController) validateIssuer(ctx context.Context, upstream *v1
 		c.validatorCache.putProvider(&upstream.Spec, discoveredProvider, httpClient)
 	}
 
-	// Get the revocation endpoint, if there is one. Many providers do not offer a revocation endpoint.
+	// Get the revocation and end session endpoints, if there are any. Many providers do not offer them.
 	var additionalDiscoveryClaims struct {
 		// "revocation_endpoint" is specified by https://datatracker.ietf.org/doc/html/rfc8414#section-2
 		RevocationEndpoint string `json:"revocation_endpoint"`
+		// "end_session_endpoint" is specified by https://openid.net/specs/openid-connect-rpinitiated-1_0.html#OPMetadata
+		EndSessionEndpoint string `json:"end_session_endpoint"`
 	}
 	if err := discoveredProvider.Claims(&additionalDiscoveryClaims); err != nil {
 		// This shouldn't actually happen because the above call to NewProvider() would have already returned this error.
@@ -377,6 +380,19 @@ func (c *oidcWatcherController) validateIssuer(ctx context.Context, upstream *v1
 		// Remember the URL for later use.
 		result.RevocationURL = revocationURL
 	}
+	if additionalDiscoveryClaims.EndSessionEndpoint != "" {
+		// Found an end session URL. Validate it.
+		endSessionURL, endSessionURLCondition := validateHTTPSURL(
+			additionalDiscoveryClaims.EndSessionEndpoint,
+			"end session endpoint",
+			reasonInvalidResponse,
+		)
+		if endSessionURLCondition != nil {
+			return endSessionURLCondition
+		}
+		// Remember the URL for later use.
+		result.EndSessionURL = endSessionURL
+	}
 
 	_, authorizeURLCondition := validateHTTPSURL(
 		discoveredProvider.Endpoint().AuthURL,
@@ -0,0 +1,292 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package samlupstreamwatcher implements a controller which watches SAMLIdentityProviders.
+package samlupstreamwatcher
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/cache"
+
+	"go.pinniped.dev/generated/latest/apis/supervisor/idp/v1alpha1"
+	pinnipedclientset "go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned"
+	idpinformers "go.pinniped.dev/generated/latest/client/supervisor/informers/externalversions/idp/v1alpha1"
+	pinnipedcontroller "go.pinniped.dev/internal/controller"
+	"go.pinniped.dev/internal/controller/conditionsutil"
+	"go.pinniped.dev/internal/controller/supervisorconfig/upstreamwatchers"
+	"go.pinniped.dev/internal/controllerlib"
+	"go.pinniped.dev/internal/net/phttp"
+	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/plog"
+	"go.pinniped.dev/internal/upstreamsaml"
+)
+
+const (
+	// Setup for the name of our controller in logs.
+	samlControllerName = "saml-upstream-observer"
+
+	// Constants related to the metadata cache. Downloaded metadata is reused for this long, so rotated signing
+	// certificates of the identity provider will be noticed at most this long after they were published.
+	metadataCacheTTL = 15 * time.Minute
+
+	// The largest metadata document which will be downloaded.
+	maxMetadataBytes = 1 << 20
+
+	// Constants related to conditions.
+	typeMetadataValid = "MetadataValid"
+
+	reasonInvalidSpec     = "InvalidSpec"
+	reasonUnreachable     = "Unreachable"
+	reasonInvalidMetadata = "InvalidMetadata"
+)
+
+// UpstreamSAMLIdentityProviderICache is a thread safe cache that holds a list of validated upstream SAML IDP configurations.
+type UpstreamSAMLIdentityProviderICache interface {
+	SetSAMLIdentityProviders([]provider.UpstreamSAMLIdentityProviderI)
+}
+
+// lruMetadataCache caches the metadata document downloaded from a particular URL/TLS configuration.
+type lruMetadataCache struct{ cache *cache.Expiring }
+
+func (c *lruMetadataCache) getMetadata(spec *v1alpha1.SAMLIdentityProviderSpec) []byte {
+	if result, ok := c.cache.Get(c.cacheKey(spec)); ok {
+		return result.([]byte)
+	}
+	return nil
+}
+
+func (c *lruMetadataCache) putMetadata(spec *v1alpha1.SAMLIdentityProviderSpec, metadata []byte) {
+	c.cache.Set(c.cacheKey(spec), metadata, metadataCacheTTL)
+}
+
+func (c *lruMetadataCache) cacheKey(spec *v1alpha1.SAMLIdentityProviderSpec) interface{} {
+	var key struct{ metadataURL, caBundle string }
+	key.metadataURL = spec.MetadataURL
+	if spec.TLS != nil {
+		key.caBundle = spec.TLS.CertificateAuthorityData
+	}
+	return key
+}
+
+type samlWatcherController struct {
+	cache                        UpstreamSAMLIdentityProviderICache
+	client                       pinnipedclientset.Interface
+	samlIdentityProviderInformer idpinformers.SAMLIdentityProviderInformer
+	metadataCache                interface {
+		getMetadata(*v1alpha1.SAMLIdentityProviderSpec) []byte
+		putMetadata(*v1alpha1.SAMLIdentityProviderSpec, []byte)
+	}
+}
+
+// New instantiates a new controllerlib.Controller which will populate the provided UpstreamSAMLIdentityProviderICache.
+func New(
+	idpCache UpstreamSAMLIdentityProviderICache,
+	client pinnipedclientset.Interface,
+	samlIdentityProviderInformer idpinformers.SAMLIdentityProviderInformer,
+	withInformer pinnipedcontroller.WithInformerOptionFunc,
+) controllerlib.Controller {
+	c := samlWatcherController{
+		cache:                        idpCache,
+		client:                       client,
+		samlIdentityProviderInformer: samlIdentityProviderInformer,
+		metadataCache:                &lruMetadataCache{cache: cache.NewExpiring()},
+	}
+	return controllerlib.New(
+		controllerlib.Config{Name: samlControllerName, Syncer: &c},
+		withInformer(
+			samlIdentityProviderInformer,
+			pinnipedcontroller.MatchAnythingFilter(pinnipedcontroller.SingletonQueue()),
+			controllerlib.InformerOption{},
+		),
+	)
+}
+
+// Sync implements controllerlib.Syncer.
+func (c *samlWatcherController) Sync(ctx controllerlib.Context) error {
+	actualUpstreams, err := c.samlIdentityProviderInformer.Lister().List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("failed to list SAMLIdentityProviders: %w", err)
+	}
+
+	requeue := false
+	validatedUpstreams := make([]provider.UpstreamSAMLIdentityProviderI, 0, len(actualUpstreams))
+	for _, upstream := range actualUpstreams {
+		valid := c.validateUpstream(ctx.Context, upstream)
+		if valid == nil {
+			requeue = true
+		} else {
+			validatedUpstreams = append(validatedUpstreams, valid)
+		}
+	}
+	c.cache.SetSAMLIdentityProviders(validatedUpstreams)
+	if requeue {
+		return controllerlib.ErrSyntheticRequeue
+	}
+	return nil
+}
+
+// validateUpstream validates the provided v1alpha1.SAMLIdentityProvider and returns the validated configuration as a
+// provider.UpstreamSAMLIdentityProviderI. As a side effect, it also updates the status of the v1alpha1.SAMLIdentityProvider.
+func (c *samlWatcherController) validateUpstream(ctx context.Context, upstream *v1alpha1.SAMLIdentityProvider) provider.UpstreamSAMLIdentityProviderI {
+	result := upstreamsaml.ProviderConfig{
+		Name:              upstream.Name,
+		ResourceUID:       upstream.UID,
+		NameIDFormat:      upstream.Spec.NameIDFormat,
+		UsernameAttribute: upstream.Spec.Attributes.Username,
+		GroupsAttribute:   upstream.Spec.Attributes.Groups,
+	}
+
+	condition := c.validateMetadata(ctx, upstream, &result)
+
+	if hadErrorCondition := c.updateStatus(ctx, upstream, []*v1alpha1.Condition{condition}); hadErrorCondition {
+		return nil
+	}
+	return &result
+}
+
+// validateMetadata reads the metadata of the identity provider, either from .spec.metadata or by downloading it
+// from .spec.metadataURL, and returns the appropriate MetadataValid condition.
+func (c *samlWatcherController) validateMetadata(ctx context.Context, upstream *v1alpha1.SAMLIdentityProvider, result *upstreamsaml.ProviderConfig) *v1alpha1.Condition {
+	spec := &upstream.Spec
+
+	var metadata []byte
+	downloaded := false
+	switch {
+	case spec.MetadataURL != "" && spec.Metadata != "":
+		return &v1alpha1.Condition{
+			Type:    typeMetadataValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  reasonInvalidSpec,
+			Message: "only one of spec.metadataURL or spec.metadata may be configured",
+		}
+	case spec.Metadata != "":
+		metadata = []byte(spec.Metadata)
+	case spec.MetadataURL != "":
+		metadata = c.metadataCache.getMetadata(spec)
+		if metadata == nil {
+			httpClient, err := getClient(upstream)
+			if err != nil {
+				return &v1alpha1.Condition{
+					Type:    typeMetadataValid,
+					Status:  v1alpha1.ConditionFalse,
+					Reason:  upstreamwatchers.ReasonInvalidTLSConfig,
+					Message: err.Error(),
+				}
+			}
+			metadata, err = fetchMetadata(ctx, httpClient, spec.MetadataURL)
+			if err != nil {
+				plog.TraceErr("failed to download SAML metadata", err,
+					"namespace", upstream.Namespace, "name", upstream.Name, "metadataURL", spec.MetadataURL)
+				return &v1alpha1.Condition{
+					Type:    typeMetadataValid,
+					Status:  v1alpha1.ConditionFalse,
+					Reason:  reasonUnreachable,
+					Message: fmt.Sprintf("failed to download metadata from %q: %s", spec.MetadataURL, err.Error()),
+				}
+			}
+			downloaded = true
+		}
+	default:
+		return &v1alpha1.Condition{
+			Type:    typeMetadataValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  reasonInvalidSpec,
+			Message: "one of spec.metadataURL or spec.metadata must be configured",
+		}
+	}
+
+	parsed, err := upstreamsaml.ParseIdentityProviderMetadata(metadata)
+	if err != nil {
+		return &v1alpha1.Condition{
+			Type:    typeMetadataValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  reasonInvalidMetadata,
+			Message: err.Error(),
+		}
+	}
+
+	// Only cache downloaded metadata which was valid, so that a fix on the identity provider's side is noticed quickly.
+	if downloaded {
+		c.metadataCache.putMetadata(spec, metadata)
+	}
+
+	result.EntityID = parsed.EntityID
+	result.SSOURL = parsed.SSOURL
+	result.SigningCertificates = parsed.SigningCertificates
+	return &v1alpha1.Condition{
+		Type:    typeMetadataValid,
+		Status:  v1alpha1.ConditionTrue,
+		Reason:  upstreamwatchers.ReasonSuccess,
+		Message: fmt.Sprintf("loaded metadata of identity provider %q", parsed.EntityID),
+	}
+}
+
+func (c *samlWatcherController) updateStatus(ctx context.Context, upstream *v1alpha1.SAMLIdentityProvider, conditions []*v1alpha1.Condition) bool {
+	log := plog.WithValues("namespace", upstream.Namespace, "name", upstream.Name)
+	updated := upstream.DeepCopy()
+
+	hadErrorCondition := conditionsutil.MergeIDPConditions(conditions, upstream.Generation, &updated.Status.Conditions, log)
+
+	updated.Status.Phase = v1alpha1.SAMLPhaseReady
+	if hadErrorCondition {
+		updated.Status.Phase = v1alpha1.SAMLPhaseError
+	}
+
+	if equality.Semantic.DeepEqual(upstream, updated) {
+		return hadErrorCondition // nothing to update
+	}
+
+	_, err := c.client.
+		IDPV1alpha1().
+		SAMLIdentityProviders(upstream.Namespace).
+		UpdateStatus(ctx, updated, metav1.UpdateOptions{})
+	if err != nil {
+		log.Error("failed to update status", err)
+	}
+	return hadErrorCondition
+}
+
+func fetchMetadata(ctx context.Context, httpClient *http.Client, metadataURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadataURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response status %q", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxMetadataBytes))
+}
+
+func getClient(upstream *v1alpha1.SAMLIdentityProvider) (*http.Client, error) {
+	var rootCAs *x509.CertPool
+	if upstream.Spec.TLS != nil && upstream.Spec.TLS.CertificateAuthorityData != "" {
+		bundle, err := base64.StdEncoding.DecodeString(upstream.Spec.TLS.CertificateAuthorityData)
+		if err != nil {
+			return nil, fmt.Errorf("spec.tls.certificateAuthorityData is invalid: %w", err)
+		}
+		rootCAs = x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("spec.tls.certificateAuthorityData is invalid: %w", upstreamwatchers.ErrNoCertificates)
+		}
+	}
+
+	c := phttp.Default(rootCAs)
+	c.Timeout = time.Minute
+	return c, nil
+}
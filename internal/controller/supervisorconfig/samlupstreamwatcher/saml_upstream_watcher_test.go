@@ -0,0 +1,338 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package samlupstreamwatcher
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+
+	"go.pinniped.dev/generated/latest/apis/supervisor/idp/v1alpha1"
+	pinnipedfake "go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned/fake"
+	pinnipedinformers "go.pinniped.dev/generated/latest/client/supervisor/informers/externalversions"
+	"go.pinniped.dev/internal/controllerlib"
+	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/testutil"
+	"go.pinniped.dev/internal/testutil/samltestutil"
+	"go.pinniped.dev/internal/upstreamsaml"
+)
+
+func TestSAMLUpstreamWatcherControllerSync(t *testing.T) {
+	t.Parallel()
+	now := metav1.NewTime(time.Now().UTC())
+
+	const (
+		testNamespace = "test-namespace"
+		testName      = "test-name"
+		testUID       = types.UID("test-uid")
+	)
+
+	idp := samltestutil.NewIdentityProvider(t, "https://idp.example.com/adfs")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metadata", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/samlmetadata+xml")
+		_, _ = w.Write([]byte(idp.Metadata()))
+	})
+	mux.HandleFunc("/not-metadata", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("<html></html>"))
+	})
+	testCA, testURL := testutil.TLSTestServer(t, mux.ServeHTTP)
+	testCABase64 := base64.StdEncoding.EncodeToString([]byte(testCA))
+
+	objectMeta := metav1.ObjectMeta{Namespace: testNamespace, Name: testName, UID: testUID, Generation: 1234}
+	successCondition := v1alpha1.Condition{
+		Type:               "MetadataValid",
+		Status:             "True",
+		LastTransitionTime: now,
+		Reason:             "Success",
+		Message:            `loaded metadata of identity provider "https://idp.example.com/adfs"`,
+		ObservedGeneration: 1234,
+	}
+	errorCondition := func(reason, message string) v1alpha1.Condition {
+		return v1alpha1.Condition{
+			Type:               "MetadataValid",
+			Status:             "False",
+			LastTransitionTime: now,
+			Reason:             reason,
+			Message:            message,
+			ObservedGeneration: 1234,
+		}
+	}
+	wantProvider := &upstreamsaml.ProviderConfig{
+		Name:                testName,
+		ResourceUID:         testUID,
+		EntityID:            "https://idp.example.com/adfs",
+		SigningCertificates: []*x509.Certificate{idp.Cert},
+		NameIDFormat:        "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress",
+		UsernameAttribute:   "email",
+		GroupsAttribute:     "groups",
+	}
+	spec := func(edit func(spec *v1alpha1.SAMLIdentityProviderSpec)) v1alpha1.SAMLIdentityProviderSpec {
+		s := v1alpha1.SAMLIdentityProviderSpec{
+			NameIDFormat: "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress",
+			Attributes:   v1alpha1.SAMLAttributes{Username: "email", Groups: "groups"},
+		}
+		edit(&s)
+		return s
+	}
+
+	tests := []struct {
+		name                   string
+		inputUpstreams         []runtime.Object
+		wantErr                string
+		wantResultingCache     []*upstreamsaml.ProviderConfig
+		wantResultingUpstreams []v1alpha1.SAMLIdentityProvider
+	}{
+		{
+			name:               "no upstreams",
+			wantResultingCache: []*upstreamsaml.ProviderConfig{},
+		},
+		{
+			name: "inline metadata",
+			inputUpstreams: []runtime.Object{&v1alpha1.SAMLIdentityProvider{
+				ObjectMeta: objectMeta,
+				Spec:       spec(func(s *v1alpha1.SAMLIdentityProviderSpec) { s.Metadata = idp.Metadata() }),
+			}},
+			wantResultingCache: []*upstreamsaml.ProviderConfig{wantProvider},
+			wantResultingUpstreams: []v1alpha1.SAMLIdentityProvider{{
+				ObjectMeta: objectMeta,
+				Status: v1alpha1.SAMLIdentityProviderStatus{
+					Phase:      "Ready",
+					Conditions: []v1alpha1.Condition{successCondition},
+				},
+			}},
+		},
+		{
+			name: "metadata URL",
+			inputUpstreams: []runtime.Object{&v1alpha1.SAMLIdentityProvider{
+				ObjectMeta: objectMeta,
+				Spec: spec(func(s *v1alpha1.SAMLIdentityProviderSpec) {
+					s.MetadataURL = testURL + "/metadata"
+					s.TLS = &v1alpha1.TLSSpec{CertificateAuthorityData: testCABase64}
+				}),
+			}},
+			wantResultingCache: []*upstreamsaml.ProviderConfig{wantProvider},
+			wantResultingUpstreams: []v1alpha1.SAMLIdentityProvider{{
+				ObjectMeta: objectMeta,
+				Status: v1alpha1.SAMLIdentityProviderStatus{
+					Phase:      "Ready",
+					Conditions: []v1alpha1.Condition{successCondition},
+				},
+			}},
+		},
+		{
+			name: "both metadata URL and inline metadata",
+			inputUpstreams: []runtime.Object{&v1alpha1.SAMLIdentityProvider{
+				ObjectMeta: objectMeta,
+				Spec: spec(func(s *v1alpha1.SAMLIdentityProviderSpec) {
+					s.MetadataURL = testURL + "/metadata"
+					s.Metadata = idp.Metadata()
+				}),
+			}},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingCache: []*upstreamsaml.ProviderConfig{},
+			wantResultingUpstreams: []v1alpha1.SAMLIdentityProvider{{
+				ObjectMeta: objectMeta,
+				Status: v1alpha1.SAMLIdentityProviderStatus{
+					Phase:      "Error",
+					Conditions: []v1alpha1.Condition{errorCondition("InvalidSpec", "only one of spec.metadataURL or spec.metadata may be configured")},
+				},
+			}},
+		},
+		{
+			name: "neither metadata URL nor inline metadata",
+			inputUpstreams: []runtime.Object{&v1alpha1.SAMLIdentityProvider{
+				ObjectMeta: objectMeta,
+				Spec:       spec(func(s *v1alpha1.SAMLIdentityProviderSpec) {}),
+			}},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingCache: []*upstreamsaml.ProviderConfig{},
+			wantResultingUpstreams: []v1alpha1.SAMLIdentityProvider{{
+				ObjectMeta: objectMeta,
+				Status: v1alpha1.SAMLIdentityProviderStatus{
+					Phase:      "Error",
+					Conditions: []v1alpha1.Condition{errorCondition("InvalidSpec", "one of spec.metadataURL or spec.metadata must be configured")},
+				},
+			}},
+		},
+		{
+			name: "invalid CA bundle",
+			inputUpstreams: []runtime.Object{&v1alpha1.SAMLIdentityProvider{
+				ObjectMeta: objectMeta,
+				Spec: spec(func(s *v1alpha1.SAMLIdentityProviderSpec) {
+					s.MetadataURL = testURL + "/metadata"
+					s.TLS = &v1alpha1.TLSSpec{CertificateAuthorityData: base64.StdEncoding.EncodeToString([]byte("not a PEM"))}
+				}),
+			}},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingCache: []*upstreamsaml.ProviderConfig{},
+			wantResultingUpstreams: []v1alpha1.SAMLIdentityProvider{{
+				ObjectMeta: objectMeta,
+				Status: v1alpha1.SAMLIdentityProviderStatus{
+					Phase:      "Error",
+					Conditions: []v1alpha1.Condition{errorCondition("InvalidTLSConfig", "spec.tls.certificateAuthorityData is invalid: no certificates found")},
+				},
+			}},
+		},
+		{
+			name: "metadata URL not found",
+			inputUpstreams: []runtime.Object{&v1alpha1.SAMLIdentityProvider{
+				ObjectMeta: objectMeta,
+				Spec: spec(func(s *v1alpha1.SAMLIdentityProviderSpec) {
+					s.MetadataURL = testURL + "/missing"
+					s.TLS = &v1alpha1.TLSSpec{CertificateAuthorityData: testCABase64}
+				}),
+			}},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingCache: []*upstreamsaml.ProviderConfig{},
+			wantResultingUpstreams: []v1alpha1.SAMLIdentityProvider{{
+				ObjectMeta: objectMeta,
+				Status: v1alpha1.SAMLIdentityProviderStatus{
+					Phase: "Error",
+					Conditions: []v1alpha1.Condition{errorCondition("Unreachable",
+						`failed to download metadata from "`+testURL+`/missing": unexpected response status "404 Not Found"`)},
+				},
+			}},
+		},
+		{
+			name: "metadata URL does not serve metadata",
+			inputUpstreams: []runtime.Object{&v1alpha1.SAMLIdentityProvider{
+				ObjectMeta: objectMeta,
+				Spec: spec(func(s *v1alpha1.SAMLIdentityProviderSpec) {
+					s.MetadataURL = testURL + "/not-metadata"
+					s.TLS = &v1alpha1.TLSSpec{CertificateAuthorityData: testCABase64}
+				}),
+			}},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingCache: []*upstreamsaml.ProviderConfig{},
+			wantResultingUpstreams: []v1alpha1.SAMLIdentityProvider{{
+				ObjectMeta: objectMeta,
+				Status: v1alpha1.SAMLIdentityProviderStatus{
+					Phase:      "Error",
+					Conditions: []v1alpha1.Condition{errorCondition("InvalidMetadata", "metadata contains an unexpected html element")},
+				},
+			}},
+		},
+		{
+			name: "metadata URL with untrusted TLS certificate",
+			inputUpstreams: []runtime.Object{&v1alpha1.SAMLIdentityProvider{
+				ObjectMeta: objectMeta,
+				Spec:       spec(func(s *v1alpha1.SAMLIdentityProviderSpec) { s.MetadataURL = testURL + "/metadata" }),
+			}},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingCache: []*upstreamsaml.ProviderConfig{},
+			wantResultingUpstreams: []v1alpha1.SAMLIdentityProvider{{
+				ObjectMeta: objectMeta,
+				Status: v1alpha1.SAMLIdentityProviderStatus{
+					Phase: "Error",
+					Conditions: []v1alpha1.Condition{errorCondition("Unreachable",
+						`failed to download metadata from "`+testURL+`/metadata": Get "`+testURL+`/metadata": tls: failed to verify certificate: x509: certificate signed by unknown authority`)},
+				},
+			}},
+		},
+		{
+			name: "invalid inline metadata",
+			inputUpstreams: []runtime.Object{&v1alpha1.SAMLIdentityProvider{
+				ObjectMeta: objectMeta,
+				Spec:       spec(func(s *v1alpha1.SAMLIdentityProviderSpec) { s.Metadata = "not xml" }),
+			}},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingCache: []*upstreamsaml.ProviderConfig{},
+			wantResultingUpstreams: []v1alpha1.SAMLIdentityProvider{{
+				ObjectMeta: objectMeta,
+				Status: v1alpha1.SAMLIdentityProviderStatus{
+					Phase:      "Error",
+					Conditions: []v1alpha1.Condition{errorCondition("InvalidMetadata", "could not parse metadata: EOF")},
+				},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			fakePinnipedClient := pinnipedfake.NewSimpleClientset(tt.inputUpstreams...)
+			pinnipedInformers := pinnipedinformers.NewSharedInformerFactory(fakePinnipedClient, 0)
+			cache := provider.NewDynamicUpstreamIDPProvider()
+			cache.SetSAMLIdentityProviders([]provider.UpstreamSAMLIdentityProviderI{
+				&upstreamsaml.ProviderConfig{Name: "initial-entry"},
+			})
+
+			controller := New(
+				cache,
+				fakePinnipedClient,
+				pinnipedInformers.IDP().V1alpha1().SAMLIdentityProviders(),
+				controllerlib.WithInformer,
+			)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			pinnipedInformers.Start(ctx.Done())
+			controllerlib.TestRunSynchronously(t, controller)
+
+			syncCtx := controllerlib.Context{Context: ctx, Key: controllerlib.Key{}}
+
+			if err := controllerlib.TestSync(t, controller, syncCtx); tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			actualIDPList := cache.GetSAMLIdentityProviders()
+			require.Len(t, actualIDPList, len(tt.wantResultingCache))
+			for i := range actualIDPList {
+				actualIDP := actualIDPList[i].(*upstreamsaml.ProviderConfig)
+				require.Equal(t, idp.SSOURL, actualIDP.SSOURL.String())
+				actualIDP.SSOURL = nil
+				require.Equal(t, tt.wantResultingCache[i], actualIDP)
+			}
+
+			actualUpstreams, err := fakePinnipedClient.IDPV1alpha1().SAMLIdentityProviders(testNamespace).List(ctx, metav1.ListOptions{})
+			require.NoError(t, err)
+
+			// Assert on the expected Status of the upstreams. Preprocess the upstreams a bit so that they're easier to assert against.
+			require.ElementsMatch(t, tt.wantResultingUpstreams, normalizeSAMLUpstreams(actualUpstreams.Items, now))
+
+			// Running the sync() a second time should be idempotent, and should return the same error.
+			// This also helps exercise code paths where the downloaded metadata hits cache.
+			if err := controllerlib.TestSync(t, controller, syncCtx); tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Len(t, cache.GetSAMLIdentityProviders(), len(tt.wantResultingCache))
+		})
+	}
+}
+
+func normalizeSAMLUpstreams(upstreams []v1alpha1.SAMLIdentityProvider, now metav1.Time) []v1alpha1.SAMLIdentityProvider {
+	result := make([]v1alpha1.SAMLIdentityProvider, 0, len(upstreams))
+	for _, u := range upstreams {
+		normalized := u.DeepCopy()
+
+		// We're only interested in comparing the status, so zero out the spec.
+		normalized.Spec = v1alpha1.SAMLIdentityProviderSpec{}
+
+		// Round down the LastTransitionTime values to `now` if they were just updated. This makes
+		// it much easier to encode assertions about the expected timestamps.
+		for i := range normalized.Status.Conditions {
+			if time.Since(normalized.Status.Conditions[i].LastTransitionTime.Time) < 5*time.Second {
+				normalized.Status.Conditions[i].LastTransitionTime = now
+			}
+		}
+		result = append(result, *normalized)
+	}
+
+	return result
+}
@@ -1,4 +1,4 @@
-// Copyright 2021-2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2021-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package upstreamwatchers
@@ -8,10 +8,12 @@ import (
 	"crypto/x509"
 	"encoding/base64"
 	"fmt"
+	"strings"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	corev1informers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/utils/strings/slices"
 
 	"go.pinniped.dev/generated/latest/apis/supervisor/idp/v1alpha1"
 	"go.pinniped.dev/internal/constable"
@@ -38,6 +40,7 @@ const (
 	typeLDAPConnectionValid          = "LDAPConnectionValid"
 	TypeSearchBaseFound              = "SearchBaseFound"
 	reasonLDAPConnectionError        = "LDAPConnectionError"
+	reasonHostsNotFound              = "HostsNotFound"
 	noTLSConfigurationMessage        = "no TLS configuration provided"
 	loadedTLSConfigurationMessage    = "loaded TLS configuration"
 	ReasonUsingConfigurationFromSpec = "UsingConfigurationFromSpec"
@@ -56,6 +59,10 @@ type ValidatedSettings struct {
 	// case of AD they can also be auto-discovered by probing the server.
 	UserSearchBase, GroupSearchBase string
 
+	// Cache which hosts were validated, when there is more than one host. The hosts could be configured by the
+	// IDP spec, or in the case of AD they can also be discovered using DNS, so they may change between validations.
+	Hosts []string
+
 	// Cache copies of the conditions that were computed when the above settings were cached, so we
 	// can keep writing them to the status in the future. This matters most when the first attempt
 	// to write them to the IDP's status fails. In this case, future Syncs calls will be able to
@@ -108,7 +115,7 @@ type UpstreamGenericLDAPIDP interface {
 }
 
 type UpstreamGenericLDAPSpec interface {
-	Host() string
+	DetectAndSetHosts(ctx context.Context, config *upstreamldap.ProviderConfig) error
 	TLSSpec() *v1alpha1.TLSSpec
 	BindSecretName() string
 	UserSearch() UpstreamGenericLDAPUserSearch
@@ -156,12 +163,105 @@ func ValidateTLSConfig(tlsSpec *v1alpha1.TLSSpec, config *upstreamldap.ProviderC
 	return validTLSCondition(loadedTLSConfigurationMessage)
 }
 
+// SetHosts sets the hosts of the config from an optional host and an optional ordered list of additional hosts.
+// The first host identifies the provider, so that adding failover hosts to an existing provider does not change
+// the downstream subjects of its users. It returns an error when there are no hosts.
+func SetHosts(config *upstreamldap.ProviderConfig, host string, hosts []string) error {
+	allHosts := hosts
+	if len(host) > 0 {
+		allHosts = append([]string{host}, hosts...)
+	}
+	if len(allHosts) == 0 {
+		return fmt.Errorf("must specify host or hosts")
+	}
+	config.Host = allHosts[0]
+	config.Hosts = nil
+	if len(allHosts) > 1 {
+		config.Hosts = allHosts
+	}
+	return nil
+}
+
+// TestConnection tests dialing and binding to the LDAP server, and auto-detects whether to use TLS or StartTLS.
+// When the config has a list of hosts, each host is tested separately, and the returned condition is only
+// successful when all of the hosts were successful. Its message names each host which was not successful.
 func TestConnection(
 	ctx context.Context,
 	bindSecretName string,
 	config *upstreamldap.ProviderConfig,
 	currentSecretVersion string,
 ) *v1alpha1.Condition {
+	if len(config.Hosts) == 0 {
+		err := testConnectionAndDetectProtocol(ctx, config)
+		if err != nil {
+			return &v1alpha1.Condition{
+				Type:   typeLDAPConnectionValid,
+				Status: v1alpha1.ConditionFalse,
+				Reason: reasonLDAPConnectionError,
+				Message: fmt.Sprintf(`could not successfully connect to "%s" and bind as user "%s": %s`,
+					config.Host, config.BindUsername, err.Error()),
+			}
+		}
+		return &v1alpha1.Condition{
+			Type:   typeLDAPConnectionValid,
+			Status: v1alpha1.ConditionTrue,
+			Reason: ReasonSuccess,
+			Message: fmt.Sprintf(`successfully able to connect to "%s" and bind as user "%s" [validated with Secret "%s" at version "%s"]`,
+				config.Host, config.BindUsername, bindSecretName, currentSecretVersion),
+		}
+	}
+
+	var detectedProtocol upstreamldap.LDAPConnectionProtocol
+	var hostErrors []string
+	for _, host := range config.Hosts {
+		hostConfig := *config
+		hostConfig.Host = host
+		hostConfig.Hosts = nil
+
+		var err error
+		if detectedProtocol == "" {
+			err = testConnectionAndDetectProtocol(ctx, &hostConfig)
+		} else {
+			// Assume that all hosts use the same protocol as the first host which was successful.
+			hostConfig.ConnectionProtocol = detectedProtocol
+			err = upstreamldap.New(hostConfig).TestConnection(ctx)
+		}
+		if err != nil {
+			hostErrors = append(hostErrors, fmt.Sprintf(`"%s": %s`, host, err.Error()))
+			continue
+		}
+		if detectedProtocol == "" {
+			detectedProtocol = hostConfig.ConnectionProtocol
+		}
+	}
+
+	if detectedProtocol == "" {
+		// None of the hosts were successful, so put TLS back into the config.
+		detectedProtocol = upstreamldap.TLS
+	}
+	config.ConnectionProtocol = detectedProtocol
+
+	if len(hostErrors) > 0 {
+		return &v1alpha1.Condition{
+			Type:   typeLDAPConnectionValid,
+			Status: v1alpha1.ConditionFalse,
+			Reason: reasonLDAPConnectionError,
+			Message: fmt.Sprintf(`could not successfully connect to %d of %d hosts and bind as user "%s": %s`,
+				len(hostErrors), len(config.Hosts), config.BindUsername, strings.Join(hostErrors, "; ")),
+		}
+	}
+	return &v1alpha1.Condition{
+		Type:   typeLDAPConnectionValid,
+		Status: v1alpha1.ConditionTrue,
+		Reason: ReasonSuccess,
+		Message: fmt.Sprintf(`successfully able to connect to all hosts %q and bind as user "%s" [validated with Secret "%s" at version "%s"]`,
+			config.Hosts, config.BindUsername, bindSecretName, currentSecretVersion),
+	}
+}
+
+// testConnectionAndDetectProtocol tests the connection using TLS, and falls back to StartTLS when that fails.
+// It sets the ConnectionProtocol of the config to the protocol which was successful.
+func testConnectionAndDetectProtocol(ctx context.Context, config *upstreamldap.ProviderConfig) error {
 	// First try using TLS.
 	config.ConnectionProtocol = upstreamldap.TLS
 	tlsLDAPProvider := upstreamldap.New(*config)
@@ -184,24 +284,7 @@ func TestConnection(
 			config.ConnectionProtocol = upstreamldap.TLS
 		}
 	}
-
-	if err != nil {
-		return &v1alpha1.Condition{
-			Type:   typeLDAPConnectionValid,
-			Status: v1alpha1.ConditionFalse,
-			Reason: reasonLDAPConnectionError,
-			Message: fmt.Sprintf(`could not successfully connect to "%s" and bind as user "%s": %s`,
-				config.Host, config.BindUsername, err.Error()),
-		}
-	}
-
-	return &v1alpha1.Condition{
-		Type:   typeLDAPConnectionValid,
-		Status: v1alpha1.ConditionTrue,
-		Reason: ReasonSuccess,
-		Message: fmt.Sprintf(`successfully able to connect to "%s" and bind as user "%s" [validated with Secret "%s" at version "%s"]`,
-			config.Host, config.BindUsername, bindSecretName, currentSecretVersion),
-	}
+	return err
 }
 
 func validTLSCondition(message string) *v1alpha1.Condition {
@@ -301,10 +384,20 @@ func ValidateGenericLDAP(
 	tlsValidCondition := ValidateTLSConfig(upstream.Spec().TLSSpec(), config)
 	conditions.Append(tlsValidCondition, true)
 
-	var ldapConnectionValidCondition, searchBaseFoundCondition *v1alpha1.Condition
 	// No point in trying to connect to the server if the config was already determined to be invalid.
 	if secretValidCondition.Status == v1alpha1.ConditionTrue && tlsValidCondition.Status == v1alpha1.ConditionTrue {
-		ldapConnectionValidCondition, searchBaseFoundCondition = validateAndSetLDAPServerConnectivityAndSearchBase(ctx, validatedSettingsCache, upstream, config, currentSecretVersion)
+		err := upstream.Spec().DetectAndSetHosts(ctx, config)
+		if err != nil {
+			conditions.Append(&v1alpha1.Condition{
+				Type:    typeLDAPConnectionValid,
+				Status:  v1alpha1.ConditionFalse,
+				Reason:  reasonHostsNotFound,
+				Message: err.Error(),
+			}, false)
+			return conditions
+		}
+
+		ldapConnectionValidCondition, searchBaseFoundCondition := validateAndSetLDAPServerConnectivityAndSearchBase(ctx, validatedSettingsCache, upstream, config, currentSecretVersion)
 		conditions.Append(ldapConnectionValidCondition, false)
 		if searchBaseFoundCondition != nil { // currently, only used for AD, so may be nil
 			conditions.Append(searchBaseFoundCondition, true)
@@ -323,7 +416,8 @@ func validateAndSetLDAPServerConnectivityAndSearchBase(
 	validatedSettings, hasPreviousValidatedSettings := validatedSettingsCache.Get(upstream.Name(), currentSecretVersion, upstream.Generation())
 	var ldapConnectionValidCondition, searchBaseFoundCondition *v1alpha1.Condition
 
-	if hasPreviousValidatedSettings && validatedSettings.UserSearchBase != "" && validatedSettings.GroupSearchBase != "" {
+	if hasPreviousValidatedSettings && validatedSettings.UserSearchBase != "" && validatedSettings.GroupSearchBase != "" &&
+		slices.Equal(validatedSettings.Hosts, config.Hosts) {
 		// Found previously validated settings in the cache (which is also not missing search base fields), so use them.
 		config.ConnectionProtocol = validatedSettings.LDAPConnectionProtocol
 		config.UserSearch.Base = validatedSettings.UserSearchBase
@@ -342,7 +436,8 @@ func validateAndSetLDAPServerConnectivityAndSearchBase(
 
 		// When there were no failures, write the newly validated settings to the cache.
 		// It's okay for the search base condition to be nil, since it's only used by Active Directory providers,
-		// but if it exists make sure it was not a failure.
+		// but if it exists make sure it was not a failure. When any host failed, do not cache, so that the hosts
+		// will be tested again to notice when they recover.
 		if ldapConnectionValidCondition.Status == v1alpha1.ConditionTrue &&
 			(searchBaseFoundCondition == nil || (searchBaseFoundCondition.Status == v1alpha1.ConditionTrue)) {
 			// Remember (in-memory for this pod) that the controller has successfully validated the LDAP or AD provider
@@ -354,6 +449,7 @@ func validateAndSetLDAPServerConnectivityAndSearchBase(
 				LDAPConnectionProtocol:    config.ConnectionProtocol,
 				UserSearchBase:            config.UserSearch.Base,
 				GroupSearchBase:           config.GroupSearch.Base,
+				Hosts:                     config.Hosts,
 				ConnectionValidCondition:  ldapConnectionValidCondition.DeepCopy(),
 				SearchBaseFoundCondition:  searchBaseFoundCondition.DeepCopy(), // currently, only used for AD, so may be nil
 			})
@@ -363,7 +459,11 @@ func validateAndSetLDAPServerConnectivityAndSearchBase(
 	return ldapConnectionValidCondition, searchBaseFoundCondition
 }
 
-func EvaluateConditions(conditions GradatedConditions, config *upstreamldap.ProviderConfig) (provider.UpstreamLDAPIdentityProviderI, bool) {
+func EvaluateConditions(
+	conditions GradatedConditions,
+	config *upstreamldap.ProviderConfig,
+	providerStateCache *upstreamldap.ProviderStateCache,
+) (provider.UpstreamLDAPIdentityProviderI, bool) {
 	for _, gradatedCondition := range conditions.gradatedConditions {
 		if gradatedCondition.condition.Status != v1alpha1.ConditionTrue && gradatedCondition.isFatal {
 			// Invalid provider, so do not load it into the cache.
@@ -375,9 +475,9 @@ func EvaluateConditions(conditions GradatedConditions, config *upstreamldap.Prov
 		if gradatedCondition.condition.Status != v1alpha1.ConditionTrue && !gradatedCondition.isFatal {
 			// Error but load it into the cache anyway, treating this condition failure more like a warning.
 			// Try again hoping that the condition will improve.
-			return upstreamldap.New(*config), true
+			return providerStateCache.New(*config), true
 		}
 	}
 	// Fully validated provider, so load it into the cache.
-	return upstreamldap.New(*config), false
+	return providerStateCache.New(*config), false
 }
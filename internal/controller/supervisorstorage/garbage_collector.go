@@ -1,4 +1,4 @@
-// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package supervisorstorage
@@ -18,14 +18,21 @@ import (
 	clocktesting "k8s.io/utils/clock/testing"
 
 	oidcapi "go.pinniped.dev/generated/latest/apis/supervisor/oidc"
+	"go.pinniped.dev/internal/auditlog"
 	pinnipedcontroller "go.pinniped.dev/internal/controller"
 	"go.pinniped.dev/internal/controllerlib"
 	"go.pinniped.dev/internal/crud"
+	"go.pinniped.dev/internal/fositestorage"
 	"go.pinniped.dev/internal/fositestorage/accesstoken"
 	"go.pinniped.dev/internal/fositestorage/authorizationcode"
+	"go.pinniped.dev/internal/fositestorage/clientassertion"
+	"go.pinniped.dev/internal/fositestorage/consent"
+	"go.pinniped.dev/internal/fositestorage/consentrequest"
+	"go.pinniped.dev/internal/fositestorage/devicecode"
 	"go.pinniped.dev/internal/fositestorage/openidconnect"
 	"go.pinniped.dev/internal/fositestorage/pkce"
 	"go.pinniped.dev/internal/fositestorage/refreshtoken"
+	"go.pinniped.dev/internal/fositestorage/samlassertion"
 	"go.pinniped.dev/internal/oidc/provider"
 	"go.pinniped.dev/internal/plog"
 	"go.pinniped.dev/internal/psession"
@@ -38,6 +45,7 @@ type garbageCollectorController struct {
 	secretInformer        corev1informers.SecretInformer
 	kubeClient            kubernetes.Interface
 	clock                 clock.Clock
+	auditLogger           auditlog.Logger
 	timeOfMostRecentSweep time.Time
 }
 
@@ -52,6 +60,7 @@ func GarbageCollectorController(
 	kubeClient kubernetes.Interface,
 	secretInformer corev1informers.SecretInformer,
 	withInformer pinnipedcontroller.WithInformerOptionFunc,
+	auditLogger auditlog.Logger,
 ) controllerlib.Controller {
 	isSecretWithGCAnnotation := func(obj metav1.Object) bool {
 		secret, ok := obj.(*v1.Secret)
@@ -69,6 +78,7 @@ func GarbageCollectorController(
 				secretInformer: secretInformer,
 				kubeClient:     kubeClient,
 				clock:          clock,
+				auditLogger:    auditLogger,
 			},
 		},
 		withInformer(
@@ -163,6 +173,14 @@ func (c *garbageCollectorController) Sync(ctx controllerlib.Context) error {
 			continue
 		}
 		plog.Info("storage garbage collector deleted resource", logKV(secret)...)
+		if isSessionStorage {
+			c.auditLogger.Audit(auditlog.Event{
+				Type:          auditlog.SessionGarbageCollected,
+				Message:       fmt.Sprintf("deleted expired %s storage", storageType),
+				CorrelationID: correlationIDOf(storageType, secret),
+				Object:        &auditlog.Object{Kind: "Secret", Namespace: secret.Namespace, Name: secret.Name},
+			})
+		}
 	}
 
 	return nil
@@ -231,6 +249,34 @@ func (c *garbageCollectorController) maybeRevokeUpstreamOIDCToken(ctx context.Co
 		// be revoked by one of the other cases above.
 		return nil
 
+	case clientassertion.TypeLabelValue:
+		// Client assertion storage only remembers which client assertion JWTs were already used, so it never
+		// contains any upstream tokens.
+		return nil
+
+	case samlassertion.TypeLabelValue:
+		// SAML assertion storage only remembers which SAML assertions were already used, so it never contains
+		// any upstream tokens.
+		return nil
+
+	case devicecode.TypeLabelValue:
+		// Device code storage only holds an authcode, whose own session storage holds the upstream tokens.
+		return nil
+
+	case consentrequest.TypeLabelValue:
+		// Consent request storage is deleted when the user consents, at which point its session is moved into the
+		// authcode storage. When it still exists, the user declined or never answered, so no other storage has
+		// this session and its upstream token must be revoked here.
+		consentRequest, err := consentrequest.ReadFromSecret(secret)
+		if err != nil {
+			return err
+		}
+		return c.tryRevokeUpstreamOIDCToken(ctx, consentRequest.Session.Custom, secret)
+
+	case consent.TypeLabelValue:
+		// Remembered consent storage only holds the scopes which a user approved for a client.
+		return nil
+
 	default:
 		// There are no other storage types, so this should never happen in practice.
 		return errors.New("garbage collector saw invalid label on Secret when trying to determine if upstream revocation was needed")
@@ -278,6 +324,31 @@ func (c *garbageCollectorController) tryRevokeUpstreamOIDCToken(ctx context.Cont
 	return nil
 }
 
+// correlationIDOf returns the correlation ID of the session of an access or refresh token storage Secret. The other
+// types of session storage do not link their audit events to a login.
+func correlationIDOf(storageType string, secret *v1.Secret) string {
+	var session *psession.PinnipedSession
+	switch storageType {
+	case accesstoken.TypeLabelValue:
+		accessTokenSession, err := accesstoken.ReadFromSecret(secret)
+		if err == nil {
+			session, _ = accessTokenSession.Request.Session.(*psession.PinnipedSession)
+		}
+	case refreshtoken.TypeLabelValue:
+		refreshTokenSession, err := refreshtoken.ReadFromSecret(secret)
+		if err == nil {
+			session, _ = refreshTokenSession.Request.Session.(*psession.PinnipedSession)
+		}
+	}
+	if session != nil && session.Custom != nil && session.Custom.CorrelationID != "" {
+		return session.Custom.CorrelationID
+	}
+	// Sessions which were created by older versions of the Supervisor do not remember their correlation ID, in which
+	// case the ID of the authorize request which created them is used. Only the storage of access and refresh tokens
+	// has this label.
+	return secret.Labels[fositestorage.StorageRequestIDLabelName]
+}
+
 func logKV(secret *v1.Secret) []interface{} {
 	return []interface{}{
 		"secretName", secret.Name,
@@ -1,4 +1,4 @@
-// Copyright 2020 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package controllerlib
@@ -203,6 +203,10 @@ func (c *controller) handleKey(key Key, err error) {
 		return
 	}
 
+	if !errors.Is(err, ErrSyntheticRequeue) {
+		syncErrorsTotal.WithLabelValues(c.Name()).Inc()
+	}
+
 	retryForever := c.maxRetries <= 0
 	shouldRetry := retryForever || c.queue.NumRequeues(key) < c.maxRetries
 
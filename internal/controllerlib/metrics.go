@@ -0,0 +1,27 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package controllerlib
+
+import (
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+
+	// Register the workqueue metrics provider, which reports the depth, latency, etc. of each controller's
+	// queue using the controller's name as the value of the "name" label.
+	_ "k8s.io/component-base/metrics/prometheus/workqueue"
+)
+
+//nolint:gochecknoglobals // metrics are registered once per process
+var syncErrorsTotal = metrics.NewCounterVec(&metrics.CounterOpts{
+	Namespace:      "pinniped",
+	Subsystem:      "controller",
+	Name:           "sync_errors_total",
+	Help:           "Number of times that a controller's sync function returned an error, not counting synthetic requeues.",
+	StabilityLevel: metrics.ALPHA,
+}, []string{"controller"})
+
+//nolint:gochecknoinits
+func init() {
+	legacyregistry.MustRegister(syncErrorsTotal)
+}
@@ -0,0 +1,38 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package controllerlib
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"k8s.io/component-base/metrics/testutil"
+)
+
+func TestSyncErrorsAreCounted(t *testing.T) {
+	c := New(Config{Name: "test-sync-errors-controller"}).(*controller)
+	key := Key{Namespace: "some-namespace", Name: "some-name"}
+
+	syncErrors := func() float64 {
+		count, err := testutil.GetCounterMetricValue(syncErrorsTotal.WithLabelValues("test-sync-errors-controller"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return count
+	}
+
+	c.handleKey(key, nil)
+	c.handleKey(key, ErrSyntheticRequeue)
+	c.handleKey(key, fmt.Errorf("wrapped: %w", ErrSyntheticRequeue))
+	if got := syncErrors(); got != 0 {
+		t.Errorf("expected successful syncs and synthetic requeues not to be counted, got %v", got)
+	}
+
+	c.handleKey(key, errors.New("some sync error"))
+	c.handleKey(key, errors.New("some other sync error"))
+	if got := syncErrors(); got != 2 {
+		t.Errorf("expected 2 sync errors to be counted, got %v", got)
+	}
+}
@@ -1,4 +1,4 @@
-// Copyright 2021 the Pinniped contributors. All Rights Reserved.
+// Copyright 2021-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 // Package execcredcache implements a cache for Kubernetes ExecCredential data.
@@ -111,6 +111,25 @@ func (c *Cache) Put(key interface{}, cred *clientauthenticationv1beta1.ExecCrede
 	})
 }
 
+// Delete removes the entry for the given key, if one exists.
+func (c *Cache) Delete(key interface{}) {
+	// If the cache file does not exist, there is nothing to delete.
+	if _, err := os.Stat(c.path); errors.Is(err, os.ErrNotExist) {
+		return
+	}
+
+	cacheKey := jsonSHA256Hex(key)
+	c.withCache(func(cache *credCache) {
+		remaining := make([]entry, 0, len(cache.Entries))
+		for _, e := range cache.Entries {
+			if e.Key != cacheKey {
+				remaining = append(remaining, e)
+			}
+		}
+		cache.Entries = remaining
+	})
+}
+
 func jsonSHA256Hex(key interface{}) string {
 	hash := sha256.New()
 	if err := json.NewEncoder(hash).Encode(key); err != nil {
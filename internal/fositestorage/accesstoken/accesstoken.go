@@ -1,4 +1,4 @@
-// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package accesstoken
@@ -31,7 +31,13 @@ const (
 	// Version 2 is when we switched to storing psession.PinnipedSession inside the fosite request.
 	// Version 3 is when we added the Username field to the psession.CustomSessionData.
 	// Version 4 is when fosite added json tags to their openid.DefaultSession struct.
-	accessTokenStorageVersion = "4"
+	// Version 5 is when we added the UpstreamUsername and UpstreamGroups fields to psession.CustomSessionData.
+	// Version 6 is when we added the PostLogoutRedirectURIs field to clientregistry.Client.
+	// Version 7 is when we added the IDTokenSignedResponseAlg field to clientregistry.Client.
+	// Version 8 is when we added the SAML field to psession.CustomSessionData.
+	// Version 9 is when we added the GitHub field to psession.CustomSessionData.
+	// Version 10 is when we added the CorrelationID field to psession.CustomSessionData.
+	accessTokenStorageVersion = "10"
 )
 
 type RevocationStorage interface {
@@ -43,6 +49,7 @@ var _ RevocationStorage = &accessTokenStorage{}
 
 type accessTokenStorage struct {
 	storage crud.Storage
+	issuer  string
 }
 
 type Session struct {
@@ -50,8 +57,9 @@ type Session struct {
 	Version string          `json:"version"`
 }
 
-func New(secrets corev1client.SecretInterface, clock func() time.Time, sessionStorageLifetime time.Duration) RevocationStorage {
-	return &accessTokenStorage{storage: crud.New(TypeLabelValue, secrets, clock, sessionStorageLifetime)}
+// New creates the storage of the sessions which are started by the FederationDomain with the given issuer.
+func New(secrets corev1client.SecretInterface, clock func() time.Time, sessionStorageLifetime time.Duration, issuer string) RevocationStorage {
+	return &accessTokenStorage{storage: crud.New(TypeLabelValue, secrets, clock, sessionStorageLifetime), issuer: issuer}
 }
 
 // ReadFromSecret reads the contents of a Secret as a Session.
@@ -85,7 +93,7 @@ func (a *accessTokenStorage) CreateAccessTokenSession(ctx context.Context, signa
 		ctx,
 		signature,
 		&Session{Request: request, Version: accessTokenStorageVersion},
-		map[string]string{fositestorage.StorageRequestIDLabelName: requester.GetID()},
+		fositestorage.SessionLabels(a.issuer, requester),
 		nil,
 	)
 	return err
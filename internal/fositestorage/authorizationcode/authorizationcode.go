@@ -1,4 +1,4 @@
-// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package authorizationcode
@@ -32,7 +32,13 @@ const (
 	// Version 2 is when we switched to storing psession.PinnipedSession inside the fosite request.
 	// Version 3 is when we added the Username field to the psession.CustomSessionData.
 	// Version 4 is when fosite added json tags to their openid.DefaultSession struct.
-	authorizeCodeStorageVersion = "4"
+	// Version 5 is when we added the UpstreamUsername and UpstreamGroups fields to psession.CustomSessionData.
+	// Version 6 is when we added the PostLogoutRedirectURIs field to clientregistry.Client.
+	// Version 7 is when we added the IDTokenSignedResponseAlg field to clientregistry.Client.
+	// Version 8 is when we added the SAML field to psession.CustomSessionData.
+	// Version 9 is when we added the GitHub field to psession.CustomSessionData.
+	// Version 10 is when we added the CorrelationID field to psession.CustomSessionData.
+	authorizeCodeStorageVersion = "10"
 )
 
 var _ oauth2.AuthorizeCodeStorage = &authorizeCodeStorage{}
@@ -90,7 +96,13 @@ func (a *authorizeCodeStorage) CreateAuthorizeCodeSession(ctx context.Context, s
 	//      of the consent authorization request. It is used to identify the session.
 	//  signature for lookup in the DB
 
-	_, err = a.storage.Create(ctx, signature, &Session{Active: true, Request: request, Version: authorizeCodeStorageVersion}, nil, nil)
+	_, err = a.storage.Create(
+		ctx,
+		signature,
+		&Session{Active: true, Request: request, Version: authorizeCodeStorageVersion},
+		map[string]string{fositestorage.StorageRequestIDLabelName: requester.GetID()},
+		nil,
+	)
 	return err
 }
 
@@ -236,12 +248,12 @@ const ExpectedAuthorizeCodeSessionJSONFromFuzzing = `{
 							"User": null,
 							"Host": "",
 							"Path": "",
+							"Fragment": "",
+							"RawQuery": "",
 							"RawPath": "",
-							"OmitHost": false,
+							"RawFragment": "",
 							"ForceQuery": false,
-							"RawQuery": "",
-							"Fragment": "",
-							"RawFragment": ""
+							"OmitHost": false
 						}
 					},
 					{
@@ -254,12 +266,12 @@ const ExpectedAuthorizeCodeSessionJSONFromFuzzing = `{
 							"User": null,
 							"Host": "",
 							"Path": "",
+							"Fragment": "",
+							"RawQuery": "",
 							"RawPath": "",
-							"OmitHost": false,
+							"RawFragment": "",
 							"ForceQuery": false,
-							"RawQuery": "",
-							"Fragment": "",
-							"RawFragment": ""
+							"OmitHost": false
 						}
 					},
 					{
@@ -272,12 +284,12 @@ const ExpectedAuthorizeCodeSessionJSONFromFuzzing = `{
 							"User": null,
 							"Host": "",
 							"Path": "",
+							"Fragment": "",
+							"RawQuery": "",
 							"RawPath": "",
-							"OmitHost": false,
+							"RawFragment": "",
 							"ForceQuery": false,
-							"RawQuery": "",
-							"Fragment": "",
-							"RawFragment": ""
+							"OmitHost": false
 						}
 					}
 				]
@@ -289,106 +301,112 @@ const ExpectedAuthorizeCodeSessionJSONFromFuzzing = `{
 				"Q7钎漡臧n栀,i"
 			],
 			"request_object_signing_alg": "廜+v,淬Ʋ4Dʧ呩锏緍场脋",
-			"token_endpoint_auth_signing_alg": "ưƓǴ罷ǹ~]ea胠Ĺĩv絹b垇I"
+			"token_endpoint_auth_signing_alg": "ưƓǴ罷ǹ~]ea胠Ĺĩv絹b垇I",
+			"post_logout_redirect_uris": [
+				"D凘ǳ[甿",
+				"頂箨J-a稆涒聽ȑǕÄŮǻ并峸Tćɇ}"
+			],
+			"id_token_signed_response_alg": "ÉhOǹ冟[ǟ褾攚ŝlĆ厦"
 		},
 		"scopes": [
-			"ĩǀŻQ'k頂箨J-a",
-			"ɓ啶#昏Q遐*\\髎bŸ1慂U"
+			"骪l拁乖¡J¿Ƈ妔MʑÚ鴊#碓ɎǛƍd",
+			"c\"Ǌřðȿ/",
+			"裢?霃谥vƘ:ƿ/濔Aʉ\u003c"
 		],
 		"grantedScopes": [
-			"ƼĮǡ鑻Z¥篚h°ʣ£ǖ%\"砬ʍ"
+			"獾蔀OƭUǦȾ舸*"
 		],
 		"form": {
-			"¡": [
-				"Ła卦牟懧¥ɂĵ",
-				"ɎǛƍdÚ慂+槰蚪i齥篗裢?霃谥vƘ:",
-				"/濔Aʉ\u003cS獾蔀OƭUǦ"
-			],
-			"民撲ʓeŘ嬀j¤囡莒汗狲N\u003cCq": [
-				"5ȏ樛ȧ.mĔ櫓Ǩ療騃Ǐ}ɟ",
-				"潠[ĝU噤'",
-				"ŁȗɉY妶ǵ!ȁ"
-			],
-			"褰ʎɰ癟VĎĢ婄磫绒u妔隤ʑƍš駎竪": [
-				"鱙翑ȲŻ麤ã桒嘞\\摗Ǘū稖咾鎅ǸÖ"
+			"Ř嬀j¤囡莒汗狲N": [
+				"霋Ɔ輡5ȏ樛ȧ.mĔ櫓Ǩ療",
+				"Ǉ/"
 			]
 		},
 		"session": {
 			"fosite": {
 				"id_token_claims": {
-					"jti": "褗6巽ēđų蓼tùZ蛆鬣a\"ÙǞ0觢",
-					"iss": "j¦鲶H股ƲLŋZ-{",
-					"sub": "ehpƧ蓟",
+					"jti": "8",
+					"iss": "[ĝU噤'pX ʨ裄@",
+					"sub": "!ȁu狍ɶȳsčɦƦ诱ļ攬林Ñ",
 					"aud": [
-						"驜Ŗ~ů崧軒q腟u尿宲!"
+						"ƍ",
+						"¿o\u003e"
 					],
-					"nonce": "ǎ^嫯R忑隯ƗƋ*L\u0026",
-					"exp": "1989-06-02T14:40:29.613836765Z",
-					"iat": "2052-03-26T02:39:27.882495556Z",
-					"rat": "2038-04-06T10:46:24.698586972Z",
-					"auth_time": "2003-01-05T11:30:18.206004879Z",
-					"at_hash": "ğǫ\\aȊ4ț髄Al",
-					"acr": "曓蓳n匟鯘磹*金爃鶴滱ůĮǐ_c3#",
+					"nonce": "ɔ闏À1#锰劝旣樎Ȱ",
+					"exp": "2008-03-21T05:57:43.261171532Z",
+					"iat": "2080-07-31T09:39:36.259602759Z",
+					"rat": "2093-01-01T11:32:44.398071123Z",
+					"auth_time": "2088-07-12T21:20:22.8199645Z",
+					"at_hash": "鎅ǸÖ绝TFǊĆw宵ɚe",
+					"acr": "ùZ蛆鬣a\"ÙǞ0觢Û±¤ǟaȭ_Ǣ",
 					"amr": [
-						"装ƹýĸŴB岺Ð嫹Sx镯荫őł疂ư墫"
+						"-{5£踉4"
 					],
-					"c_hash": "\u0026鶡",
+					"c_hash": "5^驜Ŗ~ů崧軒q腟u尿",
 					"ext": {
-						"rǓ\\BRë_g\"ʎ啴SƇMǃļū": {
-							"4撎胬龯,t猟i\u0026\u0026Q@ǤǟǗ": [
-								1239190737
+						"ğ": 1479850437,
+						"ǎ^嫯R忑隯ƗƋ*L\u0026": {
+							"4鞀腉篓ğǫ\\aȊ4ț髄AlȒ曓蓳n匟": [
+								1260036883
 							],
-							"飘ȱF?Ƈ畋": {
-								"劰û橸ɽ銐ƭ?}HƟ玈鳚": null,
-								"骲v0H晦XŘO溪V蔓Ȍ+~ē埅Ȝ": {
-									"4Ǟ": false
+							"磹*金爃鶴滱ůĮǐ": {
+								"c3#\u0026PƢ曰l騌蘙螤": null,
+								"Ð嫹Sx镯荫őł": {
+									"鿞ČY\u0026鶡萷ɵ啜s攦Ɩ": true
 								}
 							}
-						},
-						"鑳绪": 2738428764
+						}
 					}
 				},
 				"headers": {
 					"extra": {
-						"d謺錳4帳ŅǃĊ": 663773398,
-						"Ř鸨EJ": {
-							"Ǽǟ迍阊v\"豑觳翢砜": [
-								995342744
-							],
-							"ȏl鐉诳DT=3骜Ǹ": {
-								"厷ɁOƪ穋嶿鳈恱va|载ǰɱ汶C]ɲ": null,
-								"荤Ý呐ʣ®ǅȪǣǎǔ爣縗ɦü": {
-									"H :靥湤庤毩fɤȆʪ融ƆuŤn": true
+						"Rë_g\"": 573016912,
+						"啴SƇMǃļū@$": {
+							"i\u0026\u0026Q@Ǥ": {
+								"ĊƑ÷Ƒ螞费": null,
+								"Ƈ畋rɞ?Ɵ]旎Ȳ濡胉室癑勦e": {
+									"9ǍȬ劘$iA砳_": true
 								}
-							}
+							},
+							"胬龯,t": [
+								1355041984
+							]
 						}
 					}
 				},
 				"expires_at": {
-					"韁臯氃妪婝rȤ\"h丬鎒ơ娻}ɼƟ": "1970-04-27T04:31:30.902468229Z"
+					"埅ȜʁɁ;Bd謺錳4帳Ņ": "1982-04-18T19:26:28.008651843Z",
+					"碼Ǫ": "2028-05-31T03:22:30.23394531Z"
 				},
-				"username": "髉龳ǽÙ",
-				"subject": "\u0026¥潝邎Ȗ莅ŝǔ盕戙鵮碡ʯiŬŽ"
+				"username": "鋖颤ōɓɡ Ǽǟ迍阊v\"豑觳翢砜",
+				"subject": "ɆƊ#XɗD愌铵ĸYų厷ɁOƪ"
 			},
 			"custom": {
-				"username": "Ĝ眧Ĭ",
-				"providerUID": "ŉ2ƋŢ觛ǂ焺nŐǛ",
-				"providerName": "ɥ闣ʬ橳(ý綃ʃʚƟ覣k眐4",
-				"providerType": "ȣ掘ʃƸ澺淗a紽ǒ|鰽",
+				"username": "嶿鳈恱va|载ǰɱ汶C]ɲ'=ĸ",
+				"upstreamUsername": "ʣ®ǅȪǣǎǔ爣縗ɦüHêQ仏1őƖ2",
+				"upstreamGroups": [
+					"Ȇ",
+					"ǞʜƢú4¶鎰"
+				],
+				"providerUID": "韁臯氃妪婝rȤ\"h丬鎒ơ娻}ɼƟ",
+				"providerName": "闺髉龳ǽÙ龦O亾EW莛8嘶×",
+				"providerType": "戙鵮碡ʯiŬŽ非Ĝ眧Ĭ葜SŦ",
+				"correlationID": "Ţ觛ǂ焺nŐ",
 				"warnings": [
-					"t毇妬\u003e6鉢緋uƴŤȱʀļÂ",
-					"虝27就伒犘c钡ɏȫ齁š"
+					"ɥ闣ʬ橳(ý綃ʃʚƟ覣k眐4",
+					"ȣ掘ʃƸ澺淗a紽ǒ|鰽",
+					"ɵt毇妬\u003e6鉢緋uƴŤȱ"
 				],
 				"oidc": {
-					"upstreamRefreshToken": "OpKȱ藚ɏ¬Ê蒭堜]ȗ韚ʫ繕ȫ碰+ʫ",
-					"upstreamAccessToken": "k9帴",
-					"upstreamSubject": "磊ůď逳鞪?3)藵睋邔\u0026Ű惫蜀Ģ",
-					"upstreamIssuer": "4İ"
+					"upstreamRefreshToken": "ļÂ?墖\u003cƬb獭潜",
+					"upstreamAccessToken": "钡ɏȫ齁š%Op",
+					"upstreamSubject": "概÷驣7Ʀ澉",
+					"upstreamIssuer": "堜]ȗ韚ʫ繕ȫ碰+ʫ怓曥Ċi磊"
 				},
 				"ldap": {
-					"userDN": "×",
+					"userDN": "ď逳鞪?3)藵睋邔\u0026Ű惫蜀Ģ¡圔",
 					"extraRefreshAttributes": {
-						"ʥ笿0D": "s"
+						"×": "Mʥ笿0D餹s"
 					}
 				},
 				"activedirectory": {
@@ -397,17 +415,25 @@ const ExpectedAuthorizeCodeSessionJSONFromFuzzing = `{
 						"IȽ齤士bEǎ": "跞@)¿,ɭS隑ip偶宾儮猷V麹",
 						"ȝƋ鬯犦獢9c5¤.岵": "浛a齙\\蹼偦歛"
 					}
+				},
+				"saml": {
+					"upstreamEntityID": " 皦pSǬŝ社Vƅȭǝ*擦28ǅ",
+					"upstreamNameID": "vư",
+					"sessionNotOnOrAfter": "2008-08-28T11:50:55.993968003Z"
+				},
+				"github": {
+					"upstreamAccessToken": "bņ抰蛖a³2ʫ承dʬ)ġ,TÀqy_"
 				}
 			}
 		},
 		"requestedAudience": [
-			" 皦pSǬŝ社Vƅȭǝ*擦28ǅ",
-			"vư"
+			"$+溪ŸȢŒų崓ļ憽",
+			"姧骦:駝重EȫʆɵʮGɃ"
 		],
 		"grantedAudience": [
-			"置b",
-			"筫MN\u0026錝D肁Ŷɽ蔒PR}Ųʓl{"
+			"囤1+,Ȳ齠@ɍB鳛Nč乿ƔǴę鏶",
+			"ĩŦʀ宍D挟"
 		]
 	},
-	"version": "4"
+	"version": "10"
 }`
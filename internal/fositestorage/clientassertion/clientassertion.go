@@ -0,0 +1,137 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package clientassertion
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ory/fosite"
+	"k8s.io/apimachinery/pkg/api/errors"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"go.pinniped.dev/internal/crud"
+)
+
+const (
+	TypeLabelValue = "client-assertion"
+
+	// Version 1 was the initial release of storage.
+	clientAssertionStorageVersion = "1"
+)
+
+// Storage remembers the "jti" claims of the client assertion JWTs which were used by clients to authenticate
+// with the private_key_jwt token endpoint authentication method, so that each assertion can only be used once.
+type Storage interface {
+	ClientAssertionJWTValid(ctx context.Context, jti string) error
+	SetClientAssertionJWT(ctx context.Context, jti string, exp time.Time) error
+}
+
+type clientAssertionStorage struct {
+	secrets corev1client.SecretInterface
+	clock   func() time.Time
+}
+
+type usedJTI struct {
+	Expiry  time.Time `json:"expiry"`
+	Version string    `json:"version"`
+}
+
+func New(secrets corev1client.SecretInterface, clock func() time.Time) Storage {
+	return &clientAssertionStorage{secrets: secrets, clock: clock}
+}
+
+type requestScopeKey struct{}
+
+// WithRequestScope returns a context which lets a request authenticate its client more than once using the same
+// client assertion, e.g. when the token endpoint authenticates the client of a device code grant before fosite
+// authenticates it again. A jti which was remembered using this context is still rejected by all other requests.
+func WithRequestScope(ctx context.Context) context.Context {
+	return context.WithValue(ctx, requestScopeKey{}, &sync.Map{})
+}
+
+func usedByThisRequest(ctx context.Context, jti string) bool {
+	scope, ok := ctx.Value(requestScopeKey{}).(*sync.Map)
+	if !ok {
+		return false
+	}
+	_, used := scope.Load(jti)
+	return used
+}
+
+func rememberForThisRequest(ctx context.Context, jti string) {
+	if scope, ok := ctx.Value(requestScopeKey{}).(*sync.Map); ok {
+		scope.Store(jti, true)
+	}
+}
+
+// ClientAssertionJWTValid returns an error when the jti was already used and has not expired yet.
+func (s *clientAssertionStorage) ClientAssertionJWTValid(ctx context.Context, jti string) error {
+	if usedByThisRequest(ctx, jti) {
+		return nil
+	}
+	used := &usedJTI{}
+	_, err := s.storage(0).Get(ctx, signature(jti), used)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get client assertion jti: %w", err)
+	}
+	if used.Version != clientAssertionStorageVersion || used.Expiry.After(s.clock()) {
+		return fosite.ErrJTIKnown
+	}
+	// The jti was used before but has expired, so the garbage collector simply did not delete it yet.
+	return nil
+}
+
+// SetClientAssertionJWT remembers the jti until the client assertion which contained it expires.
+func (s *clientAssertionStorage) SetClientAssertionJWT(ctx context.Context, jti string, exp time.Time) error {
+	if usedByThisRequest(ctx, jti) {
+		return nil
+	}
+	lifetime := exp.Sub(s.clock())
+	if lifetime <= 0 {
+		// Fosite will reject the expired client assertion anyway, so there is no need to remember its jti.
+		return nil
+	}
+
+	storage := s.storage(lifetime)
+	_, err := storage.Create(ctx, signature(jti), &usedJTI{Expiry: exp, Version: clientAssertionStorageVersion}, nil, nil)
+	if errors.IsAlreadyExists(err) {
+		// Allow an expired jti which was not garbage collected yet to be used again.
+		if validErr := s.ClientAssertionJWTValid(ctx, jti); validErr != nil {
+			return validErr
+		}
+		if err := storage.Delete(ctx, signature(jti)); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		_, err = storage.Create(ctx, signature(jti), &usedJTI{Expiry: exp, Version: clientAssertionStorageVersion}, nil, nil)
+		if errors.IsAlreadyExists(err) {
+			return fosite.ErrJTIKnown
+		}
+	}
+	if err != nil {
+		return err
+	}
+	rememberForThisRequest(ctx, jti)
+	return nil
+}
+
+// storage returns a crud.Storage which will mark new Secrets for garbage collection after the given lifetime,
+// since each jti only needs to be remembered until its client assertion expires.
+func (s *clientAssertionStorage) storage(lifetime time.Duration) crud.Storage {
+	return crud.New(TypeLabelValue, s.secrets, s.clock, lifetime)
+}
+
+// signature hashes the jti, since a jti can be an arbitrarily long string chosen by the client, which
+// could otherwise be too long to be used in the name of a Secret.
+func signature(jti string) string {
+	hash := sha256.Sum256([]byte(jti))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
@@ -0,0 +1,94 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package clientassertion
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ory/fosite"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+const namespace = "test-ns"
+
+var fakeNow = time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+func TestClientAssertionStorage(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+	secrets := client.CoreV1().Secrets(namespace)
+	clock := clocktesting.NewFakeClock(fakeNow)
+	storage := New(secrets, clock.Now)
+
+	// An unknown jti is valid.
+	require.NoError(t, storage.ClientAssertionJWTValid(ctx, "jti-1"))
+
+	// Once it has been used, the jti is known until its client assertion expires.
+	require.NoError(t, storage.SetClientAssertionJWT(ctx, "jti-1", fakeNow.Add(5*time.Minute)))
+	require.ErrorIs(t, storage.ClientAssertionJWTValid(ctx, "jti-1"), fosite.ErrJTIKnown)
+	require.ErrorIs(t, storage.SetClientAssertionJWT(ctx, "jti-1", fakeNow.Add(5*time.Minute)), fosite.ErrJTIKnown)
+	require.NoError(t, storage.ClientAssertionJWTValid(ctx, "jti-2"))
+
+	secretList, err := secrets.List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, secretList.Items, 1)
+	secret := secretList.Items[0]
+	require.Equal(t, "pinniped-storage-client-assertion-lfsnubk24mopr23sgdqzbjiergog6yhqp6przu6k32p36itorqua", secret.Name)
+	require.Equal(t, "client-assertion", secret.Labels["storage.pinniped.dev/type"])
+	require.Equal(t, "2030-01-01T00:05:00Z", secret.Annotations["storage.pinniped.dev/garbage-collect-after"])
+	require.Equal(t, `{"expiry":"2030-01-01T00:05:00Z","version":"1"}`, string(secret.Data["pinniped-storage-data"]))
+	require.Equal(t, "storage.pinniped.dev/client-assertion", string(secret.Type))
+
+	// After the client assertion expires, the jti may be used again even before the garbage collector deletes it.
+	clock.Step(6 * time.Minute)
+	require.NoError(t, storage.ClientAssertionJWTValid(ctx, "jti-1"))
+	require.NoError(t, storage.SetClientAssertionJWT(ctx, "jti-1", clock.Now().Add(time.Minute)))
+	require.ErrorIs(t, storage.ClientAssertionJWTValid(ctx, "jti-1"), fosite.ErrJTIKnown)
+
+	// An already expired client assertion does not need to be remembered.
+	require.NoError(t, storage.SetClientAssertionJWT(ctx, "jti-3", clock.Now().Add(-time.Second)))
+	require.NoError(t, storage.ClientAssertionJWTValid(ctx, "jti-3"))
+
+	secretList, err = secrets.List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, secretList.Items, 1)
+	require.Equal(t, "2030-01-01T00:07:00Z", secretList.Items[0].Annotations["storage.pinniped.dev/garbage-collect-after"])
+}
+
+func TestRequestScope(t *testing.T) {
+	secrets := fake.NewSimpleClientset().CoreV1().Secrets(namespace)
+	storage := New(secrets, func() time.Time { return fakeNow })
+
+	// The request which used the jti may use it again, e.g. to authenticate the same client twice.
+	requestCtx := WithRequestScope(context.Background())
+	require.NoError(t, storage.ClientAssertionJWTValid(requestCtx, "jti-1"))
+	require.NoError(t, storage.SetClientAssertionJWT(requestCtx, "jti-1", fakeNow.Add(time.Minute)))
+	require.NoError(t, storage.ClientAssertionJWTValid(requestCtx, "jti-1"))
+	require.NoError(t, storage.SetClientAssertionJWT(requestCtx, "jti-1", fakeNow.Add(time.Minute)))
+
+	// Other requests may not use it again.
+	otherRequestCtx := WithRequestScope(context.Background())
+	require.ErrorIs(t, storage.ClientAssertionJWTValid(otherRequestCtx, "jti-1"), fosite.ErrJTIKnown)
+	require.ErrorIs(t, storage.SetClientAssertionJWT(otherRequestCtx, "jti-1", fakeNow.Add(time.Minute)), fosite.ErrJTIKnown)
+	require.ErrorIs(t, storage.ClientAssertionJWTValid(context.Background(), "jti-1"), fosite.ErrJTIKnown)
+
+	// A jti which was used by another request may not be used again by this request either.
+	require.NoError(t, storage.SetClientAssertionJWT(context.Background(), "jti-2", fakeNow.Add(time.Minute)))
+	require.ErrorIs(t, storage.ClientAssertionJWTValid(requestCtx, "jti-2"), fosite.ErrJTIKnown)
+}
+
+func TestLongJTI(t *testing.T) {
+	ctx := context.Background()
+	secrets := fake.NewSimpleClientset().CoreV1().Secrets(namespace)
+	storage := New(secrets, func() time.Time { return fakeNow })
+
+	longJTI := string(make([]byte, 1000))
+	require.NoError(t, storage.SetClientAssertionJWT(ctx, longJTI, fakeNow.Add(time.Minute)))
+	require.ErrorIs(t, storage.ClientAssertionJWTValid(ctx, longJTI), fosite.ErrJTIKnown)
+}
@@ -0,0 +1,188 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package consent stores the consents which users gave to the OIDCClients which require consent, so the users are
+// not asked again each time that they log in to the same client.
+package consent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/utils/strings/slices"
+
+	"go.pinniped.dev/internal/constable"
+	"go.pinniped.dev/internal/crud"
+)
+
+const (
+	TypeLabelValue = "consent"
+
+	// SubjectLabelName is the label which allows all consents of a user to be found. Its value is a hash of the
+	// downstream subject, because subjects are URLs which are not valid label values.
+	SubjectLabelName = "storage.pinniped.dev/consent-subject"
+
+	ErrNotFound               = constable.Error("consent not found")
+	ErrInvalidConsentVersion  = constable.Error("consent data has wrong version")
+	ErrInvalidConsentIdentity = constable.Error("consent data is for a different client or subject")
+
+	// Version 1 was the initial release of storage.
+	consentStorageVersion = "1"
+)
+
+// Consent is the remembered approval by one user of the scopes which were requested by one client.
+type Consent struct {
+	ClientID string `json:"clientID"`
+	// Subject is the downstream subject of the user, which identifies the user across all of their logins.
+	Subject string `json:"subject"`
+	// Username is the downstream username of the user at the time of their consent, which is only for display.
+	Username  string    `json:"username"`
+	Scopes    []string  `json:"scopes"`
+	GrantedAt time.Time `json:"grantedAt"`
+	Version   string    `json:"version"`
+}
+
+// Covers returns true when the user consented to all the given scopes.
+func (c *Consent) Covers(scopes []string) bool {
+	for _, scope := range scopes {
+		if !slices.Contains(c.Scopes, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// Storage holds the remembered consents, keyed by their client ID and downstream subject.
+type Storage interface {
+	// Get returns the consent which the user with the given downstream subject gave to the client.
+	// It returns ErrNotFound when there is none, or when it has expired.
+	Get(ctx context.Context, clientID string, subject string) (*Consent, error)
+	// Save stores the consent, replacing any previous consent of the same user for the same client.
+	Save(ctx context.Context, consent *Consent) error
+	// List returns all unexpired consents of the user with the given downstream subject, sorted by client ID.
+	List(ctx context.Context, subject string) ([]*Consent, error)
+	// Delete removes the consent of the user with the given downstream subject for the client.
+	// It returns ErrNotFound when there is none.
+	Delete(ctx context.Context, clientID string, subject string) error
+}
+
+type consentStorage struct {
+	storage  crud.Storage
+	secrets  corev1client.SecretInterface
+	clock    func() time.Time
+	lifetime time.Duration
+}
+
+// New returns a Storage whose consents expire after the given lifetime, after which users are asked again.
+func New(secrets corev1client.SecretInterface, clock func() time.Time, lifetime time.Duration) Storage {
+	return &consentStorage{
+		storage:  crud.New(TypeLabelValue, secrets, clock, lifetime),
+		secrets:  secrets,
+		clock:    clock,
+		lifetime: lifetime,
+	}
+}
+
+func (s *consentStorage) Get(ctx context.Context, clientID string, subject string) (*Consent, error) {
+	consent := &Consent{}
+	if _, err := s.storage.Get(ctx, signature(clientID, subject), consent); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get consent: %w", err)
+	}
+	if err := validate(consent); err != nil {
+		return nil, err
+	}
+	if consent.ClientID != clientID || consent.Subject != subject {
+		return nil, ErrInvalidConsentIdentity
+	}
+	if s.isExpired(consent) {
+		return nil, ErrNotFound
+	}
+	return consent, nil
+}
+
+func (s *consentStorage) Save(ctx context.Context, consent *Consent) error {
+	consent.Version = consentStorageVersion
+	key := signature(consent.ClientID, consent.Subject)
+
+	// Replace any previous consent by deleting and recreating it, which also restarts its garbage collection lifetime.
+	if err := s.storage.Delete(ctx, key); err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete previous consent: %w", err)
+	}
+	if _, err := s.storage.Create(ctx, key, consent, map[string]string{SubjectLabelName: subjectLabelValue(consent.Subject)}, nil); err != nil {
+		return fmt.Errorf("failed to create consent: %w", err)
+	}
+	return nil
+}
+
+func (s *consentStorage) List(ctx context.Context, subject string) ([]*Consent, error) {
+	list, err := s.secrets.List(ctx, metav1.ListOptions{
+		LabelSelector: labels.Set{
+			crud.SecretLabelKey: TypeLabelValue,
+			SubjectLabelName:    subjectLabelValue(subject),
+		}.String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list consents: %w", err)
+	}
+
+	consents := make([]*Consent, 0, len(list.Items))
+	for i := range list.Items {
+		consent := &Consent{}
+		if err := crud.FromSecret(TypeLabelValue, &list.Items[i], consent); err != nil {
+			return nil, err
+		}
+		if err := validate(consent); err != nil {
+			return nil, err
+		}
+		if consent.Subject != subject || s.isExpired(consent) {
+			continue
+		}
+		consents = append(consents, consent)
+	}
+	sort.Slice(consents, func(i, j int) bool { return consents[i].ClientID < consents[j].ClientID })
+	return consents, nil
+}
+
+func (s *consentStorage) Delete(ctx context.Context, clientID string, subject string) error {
+	if err := s.storage.Delete(ctx, signature(clientID, subject)); err != nil {
+		if errors.IsNotFound(err) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to delete consent: %w", err)
+	}
+	return nil
+}
+
+// isExpired checks the lifetime of the consent itself, because the garbage collector may not have deleted it yet.
+func (s *consentStorage) isExpired(consent *Consent) bool {
+	return s.lifetime > 0 && !s.clock().Before(consent.GrantedAt.Add(s.lifetime))
+}
+
+func validate(consent *Consent) error {
+	if consent.Version != consentStorageVersion {
+		return fmt.Errorf("%w: consent has version %s instead of %s",
+			ErrInvalidConsentVersion, consent.Version, consentStorageVersion)
+	}
+	return nil
+}
+
+// signature returns the storage key of the consent of a subject for a client.
+func signature(clientID string, subject string) string {
+	hash := sha256.Sum256([]byte(clientID + "\n" + subject))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+func subjectLabelValue(subject string) string {
+	return fmt.Sprintf("%x", sha256.Sum224([]byte(subject)))
+}
@@ -0,0 +1,128 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package consent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const namespace = "test-ns"
+
+var fakeNow = time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+func TestConsentStorage(t *testing.T) {
+	ctx := context.Background()
+	secrets := fake.NewSimpleClientset().CoreV1().Secrets(namespace)
+	storage := New(secrets, func() time.Time { return fakeNow }, 24*time.Hour)
+
+	_, err := storage.Get(ctx, "client-b", "https://upstream?sub=user-1")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, storage.Save(ctx, &Consent{
+		ClientID:  "client-b",
+		Subject:   "https://upstream?sub=user-1",
+		Username:  "user-1",
+		Scopes:    []string{"openid", "username"},
+		GrantedAt: fakeNow.Add(-time.Hour),
+	}))
+	require.NoError(t, storage.Save(ctx, &Consent{
+		ClientID:  "client-a",
+		Subject:   "https://upstream?sub=user-1",
+		Username:  "user-1",
+		Scopes:    []string{"openid"},
+		GrantedAt: fakeNow.Add(-time.Hour),
+	}))
+	require.NoError(t, storage.Save(ctx, &Consent{
+		ClientID:  "client-a",
+		Subject:   "https://upstream?sub=user-2",
+		Username:  "user-2",
+		Scopes:    []string{"openid"},
+		GrantedAt: fakeNow.Add(-time.Hour),
+	}))
+
+	secretList, err := secrets.List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, secretList.Items, 3)
+	for _, secret := range secretList.Items {
+		require.Equal(t, "consent", secret.Labels["storage.pinniped.dev/type"])
+		require.Len(t, secret.Labels["storage.pinniped.dev/consent-subject"], 56)
+		require.Equal(t, "2030-01-02T00:00:00Z", secret.Annotations["storage.pinniped.dev/garbage-collect-after"])
+		require.Equal(t, "storage.pinniped.dev/consent", string(secret.Type))
+	}
+
+	consent, err := storage.Get(ctx, "client-b", "https://upstream?sub=user-1")
+	require.NoError(t, err)
+	require.Equal(t, "user-1", consent.Username)
+	require.True(t, consent.Covers([]string{"openid", "username"}))
+	require.True(t, consent.Covers([]string{"openid"}))
+	require.False(t, consent.Covers([]string{"openid", "groups"}))
+
+	// Saving again replaces the previous consent.
+	consent.Scopes = []string{"openid", "username", "groups"}
+	require.NoError(t, storage.Save(ctx, consent))
+	consent, err = storage.Get(ctx, "client-b", "https://upstream?sub=user-1")
+	require.NoError(t, err)
+	require.True(t, consent.Covers([]string{"openid", "groups"}))
+
+	consents, err := storage.List(ctx, "https://upstream?sub=user-1")
+	require.NoError(t, err)
+	require.Len(t, consents, 2)
+	require.Equal(t, "client-a", consents[0].ClientID)
+	require.Equal(t, "client-b", consents[1].ClientID)
+
+	require.NoError(t, storage.Delete(ctx, "client-a", "https://upstream?sub=user-1"))
+	require.ErrorIs(t, storage.Delete(ctx, "client-a", "https://upstream?sub=user-1"), ErrNotFound)
+	_, err = storage.Get(ctx, "client-a", "https://upstream?sub=user-1")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	// The consent of the other user to the same client was not deleted.
+	_, err = storage.Get(ctx, "client-a", "https://upstream?sub=user-2")
+	require.NoError(t, err)
+}
+
+func TestExpiredConsentsAreIgnored(t *testing.T) {
+	ctx := context.Background()
+	secrets := fake.NewSimpleClientset().CoreV1().Secrets(namespace)
+	storage := New(secrets, func() time.Time { return fakeNow }, 24*time.Hour)
+
+	require.NoError(t, storage.Save(ctx, &Consent{
+		ClientID:  "some-client",
+		Subject:   "some-subject",
+		Scopes:    []string{"openid"},
+		GrantedAt: fakeNow.Add(-24 * time.Hour),
+	}))
+
+	// The garbage collector has not deleted it yet, but it has expired.
+	_, err := storage.Get(ctx, "some-client", "some-subject")
+	require.ErrorIs(t, err, ErrNotFound)
+	consents, err := storage.List(ctx, "some-subject")
+	require.NoError(t, err)
+	require.Empty(t, consents)
+}
+
+func TestGetWithWrongVersion(t *testing.T) {
+	ctx := context.Background()
+	secrets := fake.NewSimpleClientset().CoreV1().Secrets(namespace)
+	storage := New(secrets, func() time.Time { return fakeNow }, time.Hour)
+
+	require.NoError(t, storage.Save(ctx, &Consent{ClientID: "some-client", Subject: "some-subject", GrantedAt: fakeNow}))
+	secretList, err := secrets.List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, secretList.Items, 1)
+	secret := secretList.Items[0]
+	secret.Data["pinniped-storage-data"] = []byte(`{"clientID":"some-client","subject":"some-subject","version":"0"}`)
+	_, err = secrets.Update(ctx, &secret, metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	_, err = storage.Get(ctx, "some-client", "some-subject")
+	require.ErrorIs(t, err, ErrInvalidConsentVersion)
+	_, err = storage.List(ctx, "some-subject")
+	require.ErrorIs(t, err, ErrInvalidConsentVersion)
+}
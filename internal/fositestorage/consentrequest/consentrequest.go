@@ -0,0 +1,154 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package consentrequest stores the authorization requests which are waiting for the user to answer the consent page.
+package consentrequest
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"go.pinniped.dev/internal/constable"
+	"go.pinniped.dev/internal/crud"
+	"go.pinniped.dev/internal/psession"
+)
+
+const (
+	TypeLabelValue = "consent-request"
+
+	ErrNotFound                     = constable.Error("consent request not found")
+	ErrInvalidConsentRequestVersion = constable.Error("consent request data has wrong version")
+
+	// Version 1 was the initial release of storage.
+	// Version 2 is when we added the CorrelationID field to psession.CustomSessionData.
+	consentRequestStorageVersion = "2"
+)
+
+// Request is an authorization request which was interrupted to ask the user for their consent, after the user
+// already logged in. It is created when the consent page is shown, and it is deleted when the user consents.
+// When the user declines, it is kept until it is garbage collected, so the upstream tokens in its session will
+// be revoked by the garbage collector.
+type Request struct {
+	// AuthParams are the params of the original authorization request, which are used to recreate it.
+	AuthParams    string `json:"authParams"`
+	CorrelationID string `json:"correlationID,omitempty"`
+
+	// Session is the downstream session which is given to the client after the user consents.
+	Session *psession.PinnipedSession `json:"session"`
+
+	// CSRFHash is the hash of the CSRF token from the user's browser, which binds the request to that browser.
+	CSRFHash  string    `json:"csrfHash"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Declined  bool      `json:"declined,omitempty"`
+
+	Version string `json:"version"`
+}
+
+// Storage holds consent requests, keyed by their randomly generated IDs.
+type Storage interface {
+	// Create stores a new request, and returns its newly generated ID.
+	Create(ctx context.Context, request *Request) (id string, err error)
+	// Get returns the request of the given ID, along with its resource version for use with Update.
+	Get(ctx context.Context, id string) (request *Request, resourceVersion string, err error)
+	// Update replaces the request of the given ID, failing when it was changed since the given resource version.
+	Update(ctx context.Context, id string, resourceVersion string, request *Request) error
+	// Delete removes the request of the given ID.
+	Delete(ctx context.Context, id string) error
+}
+
+type consentRequestStorage struct {
+	storage crud.Storage
+	rand    io.Reader
+}
+
+func New(secrets corev1client.SecretInterface, clock func() time.Time, sessionStorageLifetime time.Duration) Storage {
+	return &consentRequestStorage{storage: crud.New(TypeLabelValue, secrets, clock, sessionStorageLifetime), rand: rand.Reader}
+}
+
+// ReadFromSecret reads the contents of a Secret as a Request.
+func ReadFromSecret(secret *v1.Secret) (*Request, error) {
+	request := newValidEmptyRequest()
+	if err := crud.FromSecret(TypeLabelValue, secret, request); err != nil {
+		return nil, err
+	}
+	if err := validate(request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func (s *consentRequestStorage) Create(ctx context.Context, request *Request) (string, error) {
+	b := make([]byte, 32)
+	if _, err := io.ReadFull(s.rand, b); err != nil {
+		return "", fmt.Errorf("failed to generate consent request ID: %w", err)
+	}
+	id := base64.RawURLEncoding.EncodeToString(b)
+
+	request.Version = consentRequestStorageVersion
+	if _, err := s.storage.Create(ctx, id, request, nil, nil); err != nil {
+		return "", fmt.Errorf("failed to create consent request: %w", err)
+	}
+	return id, nil
+}
+
+func (s *consentRequestStorage) Get(ctx context.Context, id string) (*Request, string, error) {
+	if id == "" {
+		return nil, "", ErrNotFound
+	}
+	request := newValidEmptyRequest()
+	rv, err := s.storage.Get(ctx, id, request)
+	if errors.IsNotFound(err) {
+		return nil, "", ErrNotFound
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get consent request: %w", err)
+	}
+	if err := validate(request); err != nil {
+		return nil, "", err
+	}
+	return request, rv, nil
+}
+
+func (s *consentRequestStorage) Update(ctx context.Context, id string, resourceVersion string, request *Request) error {
+	if _, err := s.storage.Update(ctx, id, resourceVersion, request); err != nil {
+		return fmt.Errorf("failed to update consent request: %w", err)
+	}
+	return nil
+}
+
+func (s *consentRequestStorage) Delete(ctx context.Context, id string) error {
+	return s.storage.Delete(ctx, id)
+}
+
+// HashCSRF returns the hash of a CSRF token, for storage in a Request.
+func HashCSRF(csrf string) string {
+	hash := sha256.Sum256([]byte(csrf))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// VerifyCSRF returns true when the CSRF token matches the hash from a Request.
+func VerifyCSRF(csrf string, hash string) bool {
+	return csrf != "" && hash != "" && subtle.ConstantTimeCompare([]byte(HashCSRF(csrf)), []byte(hash)) == 1
+}
+
+func validate(request *Request) error {
+	if request.Version != consentRequestStorageVersion {
+		return fmt.Errorf("%w: consent request has version %s instead of %s",
+			ErrInvalidConsentRequestVersion, request.Version, consentRequestStorageVersion)
+	}
+	return nil
+}
+
+func newValidEmptyRequest() *Request {
+	return &Request{Session: psession.NewPinnipedSession()}
+}
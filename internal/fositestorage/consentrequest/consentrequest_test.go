@@ -0,0 +1,100 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package consentrequest
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"go.pinniped.dev/internal/psession"
+)
+
+const namespace = "test-ns"
+
+var fakeNow = time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+func TestConsentRequestStorage(t *testing.T) {
+	ctx := context.Background()
+	secrets := fake.NewSimpleClientset().CoreV1().Secrets(namespace)
+	storage := New(secrets, func() time.Time { return fakeNow }, time.Hour)
+	storage.(*consentRequestStorage).rand = bytes.NewReader(make([]byte, 32))
+
+	session := psession.NewPinnipedSession()
+	session.Fosite.Claims.Subject = "some-subject"
+	session.Custom = &psession.CustomSessionData{Username: "some-username", ProviderType: psession.ProviderTypeLDAP}
+
+	id, err := storage.Create(ctx, &Request{
+		AuthParams:    "client_id=some-client",
+		CorrelationID: "some-correlation-id",
+		Session:       session,
+		CSRFHash:      HashCSRF("some-csrf"),
+		ExpiresAt:     fakeNow.Add(15 * time.Minute),
+	})
+	require.NoError(t, err)
+	require.Equal(t, "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA", id)
+
+	secretList, err := secrets.List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, secretList.Items, 1)
+	secret := secretList.Items[0]
+	require.Equal(t, "consent-request", secret.Labels["storage.pinniped.dev/type"])
+	require.Equal(t, "2030-01-01T01:00:00Z", secret.Annotations["storage.pinniped.dev/garbage-collect-after"])
+	require.Equal(t, "storage.pinniped.dev/consent-request", string(secret.Type))
+
+	fromSecret, err := ReadFromSecret(&secret)
+	require.NoError(t, err)
+	require.Equal(t, "some-subject", fromSecret.Session.Fosite.Claims.Subject)
+	require.Equal(t, "some-username", fromSecret.Session.Custom.Username)
+
+	request, resourceVersion, err := storage.Get(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, "client_id=some-client", request.AuthParams)
+	require.Equal(t, "some-correlation-id", request.CorrelationID)
+	require.True(t, VerifyCSRF("some-csrf", request.CSRFHash))
+	require.False(t, VerifyCSRF("wrong", request.CSRFHash))
+	require.False(t, request.Declined)
+
+	request.Declined = true
+	require.NoError(t, storage.Update(ctx, id, resourceVersion, request))
+
+	request, _, err = storage.Get(ctx, id)
+	require.NoError(t, err)
+	require.True(t, request.Declined)
+
+	require.NoError(t, storage.Delete(ctx, id))
+	_, _, err = storage.Get(ctx, id)
+	require.ErrorIs(t, err, ErrNotFound)
+	_, _, err = storage.Get(ctx, "")
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestGetWithWrongVersion(t *testing.T) {
+	ctx := context.Background()
+	secrets := fake.NewSimpleClientset().CoreV1().Secrets(namespace)
+	storage := New(secrets, func() time.Time { return fakeNow }, time.Hour)
+
+	id, err := storage.Create(ctx, &Request{Session: psession.NewPinnipedSession()})
+	require.NoError(t, err)
+
+	request, resourceVersion, err := storage.Get(ctx, id)
+	require.NoError(t, err)
+	request.Version = "0"
+	require.NoError(t, storage.Update(ctx, id, resourceVersion, request))
+
+	_, _, err = storage.Get(ctx, id)
+	require.ErrorIs(t, err, ErrInvalidConsentRequestVersion)
+}
+
+func TestVerifyCSRF(t *testing.T) {
+	require.True(t, VerifyCSRF("some-csrf", HashCSRF("some-csrf")))
+	require.False(t, VerifyCSRF("some-csrf", HashCSRF("other-csrf")))
+	require.False(t, VerifyCSRF("", HashCSRF("")))
+	require.False(t, VerifyCSRF("some-csrf", ""))
+}
@@ -0,0 +1,395 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package devicecode stores the sessions of the OAuth 2.0 device authorization grant, as described in
+// https://datatracker.ietf.org/doc/html/rfc8628.
+package devicecode
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"go.pinniped.dev/internal/constable"
+	"go.pinniped.dev/internal/crud"
+	"go.pinniped.dev/internal/plog"
+)
+
+const (
+	TypeLabelValue = "device-code"
+
+	// FailuresTypeLabelValue is the type of the storage which counts the failed attempts to enter a user code, so that
+	// guessing user codes is throttled the same way by all Supervisor pods.
+	FailuresTypeLabelValue = "device-code-failures"
+
+	// SourceAddressLabelName is the name of the label which identifies the address from which a session was started,
+	// so the sessions which were started from an address can be counted. Addresses are not always valid label values,
+	// so the value of the label is a hash of the address.
+	SourceAddressLabelName = "storage.pinniped.dev/device-code-source"
+
+	ErrInvalidDeviceCodeRequestVersion = constable.Error("device code request data has wrong version")
+	ErrInvalidCode                     = constable.Error("device code or user code is invalid")
+
+	// Version 1 was the initial release of storage.
+	// Version 2 is when we added the SourceAddress field to the Session.
+	deviceCodeStorageVersion = "2"
+
+	// Version 1 was the initial release of storage.
+	failuresStorageVersion = "1"
+
+	// How many times to retry recording a failure when another Supervisor pod recorded a failure of the same key
+	// at the same time.
+	maxFailureUpdateAttempts = 5
+
+	// The characters of user codes. These are the consonants from the English alphabet, without "Y", which are
+	// easy to type and cannot spell words, as recommended by https://datatracker.ietf.org/doc/html/rfc8628#section-6.1.
+	userCodeCharset = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength  = 8
+
+	// How many times to generate another user code when the generated user code is already in use.
+	maxUserCodeAttempts = 5
+)
+
+type Status string
+
+const (
+	// StatusPending means that the user has not finished their login in their web browser yet.
+	StatusPending Status = "pending"
+	// StatusApproved means that the user finished their login and the session holds an authcode for the client.
+	StatusApproved Status = "approved"
+	// StatusDenied means that the login of the user failed or was canceled.
+	StatusDenied Status = "denied"
+)
+
+// Session is the state of one device authorization. It is created by the device authorization endpoint, is
+// updated while the user logs in using their web browser, and is deleted when the client redeems it at the
+// token endpoint.
+type Session struct {
+	ClientID        string   `json:"clientID"`
+	Scopes          []string `json:"scopes"`
+	UpstreamIDPName string   `json:"upstreamIDPName,omitempty"`
+	UpstreamIDPType string   `json:"upstreamIDPType,omitempty"`
+
+	// SourceAddress is the address of the device which started the device authorization.
+	SourceAddress string `json:"sourceAddress,omitempty"`
+
+	// DeviceCodeHash is the hash of the secret part of the device code which was given to the client.
+	DeviceCodeHash string    `json:"deviceCodeHash"`
+	ExpiresAt      time.Time `json:"expiresAt"`
+	LastPolledAt   time.Time `json:"lastPolledAt,omitempty"`
+
+	// These are used by the Supervisor to act as the client of its own authorization endpoint on behalf of
+	// the device. StateHash is the hash of the secret part of the state param.
+	StateHash    string `json:"stateHash,omitempty"`
+	Nonce        string `json:"nonce,omitempty"`
+	CodeVerifier string `json:"codeVerifier,omitempty"`
+
+	Status            Status `json:"status"`
+	AuthorizationCode string `json:"authorizationCode,omitempty"`
+
+	Version string `json:"version"`
+}
+
+// Storage holds device authorization sessions, keyed by their user codes.
+type Storage interface {
+	// Create stores a new session, and returns its newly generated user code and device code.
+	Create(ctx context.Context, session *Session) (userCode string, deviceCode string, err error)
+	// Get returns the session of the given user code, along with its resource version for use with Update.
+	Get(ctx context.Context, userCode string) (session *Session, resourceVersion string, err error)
+	// Update replaces the session of the given user code, failing when it was changed since the given resource version.
+	Update(ctx context.Context, userCode string, resourceVersion string, session *Session) error
+	// Delete removes the session of the given user code.
+	Delete(ctx context.Context, userCode string) error
+	// CountPending returns the number of sessions which were started from the given source address, and which are
+	// pending and have not expired. When the source address is empty, the sessions from all addresses are counted.
+	CountPending(ctx context.Context, sourceAddress string) (int, error)
+
+	// CountFailures returns how many times the given key, e.g. a browser session or a source address, failed to
+	// enter a valid user code during its current window of time, which starts at its first failure.
+	CountFailures(ctx context.Context, key string, window time.Duration) (int, error)
+	// RecordFailure counts a failure of the given key to enter a valid user code.
+	RecordFailure(ctx context.Context, key string, window time.Duration) error
+}
+
+// failures counts the failed attempts to enter a user code during a window of time.
+type failures struct {
+	WindowStart time.Time `json:"windowStart"`
+	Count       int       `json:"count"`
+	Version     string    `json:"version"`
+}
+
+type deviceCodeStorage struct {
+	storage crud.Storage
+	secrets corev1client.SecretInterface
+	clock   func() time.Time
+	rand    io.Reader
+}
+
+func New(secrets corev1client.SecretInterface, clock func() time.Time, sessionStorageLifetime time.Duration) Storage {
+	return &deviceCodeStorage{
+		storage: crud.New(TypeLabelValue, secrets, clock, sessionStorageLifetime),
+		secrets: secrets,
+		clock:   clock,
+		rand:    rand.Reader,
+	}
+}
+
+func (s *deviceCodeStorage) Create(ctx context.Context, session *Session) (string, string, error) {
+	deviceCodeSecret, err := randomSecret(s.rand)
+	if err != nil {
+		return "", "", err
+	}
+	session.DeviceCodeHash = Hash(deviceCodeSecret)
+	session.Version = deviceCodeStorageVersion
+
+	// User codes are short enough to be typed by people, so they could collide with the user code of another
+	// session which is in progress. Try again with another user code when that happens.
+	for attempt := 1; ; attempt++ {
+		userCode, err := generateUserCode(s.rand)
+		if err != nil {
+			return "", "", err
+		}
+		_, err = s.storage.Create(ctx, signature(userCode), session, map[string]string{SourceAddressLabelName: sourceAddressLabelValue(session.SourceAddress)}, nil)
+		if errors.IsAlreadyExists(err) && attempt < maxUserCodeAttempts {
+			continue
+		}
+		if err != nil {
+			return "", "", fmt.Errorf("failed to create device code session: %w", err)
+		}
+		return FormatUserCode(userCode), JoinCode(userCode, deviceCodeSecret), nil
+	}
+}
+
+func (s *deviceCodeStorage) Get(ctx context.Context, userCode string) (*Session, string, error) {
+	normalized, ok := NormalizeUserCode(userCode)
+	if !ok {
+		return nil, "", ErrInvalidCode
+	}
+	session := &Session{}
+	rv, err := s.storage.Get(ctx, signature(normalized), session)
+	if errors.IsNotFound(err) {
+		return nil, "", ErrInvalidCode
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get device code session: %w", err)
+	}
+	if session.Version != deviceCodeStorageVersion {
+		return nil, "", fmt.Errorf("%w: device code session for %s has version %s instead of %s",
+			ErrInvalidDeviceCodeRequestVersion, normalized, session.Version, deviceCodeStorageVersion)
+	}
+	return session, rv, nil
+}
+
+func (s *deviceCodeStorage) Update(ctx context.Context, userCode string, resourceVersion string, session *Session) error {
+	normalized, ok := NormalizeUserCode(userCode)
+	if !ok {
+		return ErrInvalidCode
+	}
+	if _, err := s.storage.Update(ctx, signature(normalized), resourceVersion, session); err != nil {
+		return fmt.Errorf("failed to update device code session: %w", err)
+	}
+	return nil
+}
+
+func (s *deviceCodeStorage) Delete(ctx context.Context, userCode string) error {
+	normalized, ok := NormalizeUserCode(userCode)
+	if !ok {
+		return ErrInvalidCode
+	}
+	return s.storage.Delete(ctx, signature(normalized))
+}
+
+func (s *deviceCodeStorage) CountPending(ctx context.Context, sourceAddress string) (int, error) {
+	selector := labels.Set{crud.SecretLabelKey: TypeLabelValue}
+	if sourceAddress != "" {
+		selector[SourceAddressLabelName] = sourceAddressLabelValue(sourceAddress)
+	}
+	list, err := s.secrets.List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list device code sessions: %w", err)
+	}
+
+	now := s.clock()
+	count := 0
+	for i := range list.Items {
+		session := &Session{}
+		if err := crud.FromSecret(TypeLabelValue, &list.Items[i], session); err != nil {
+			plog.WarningErr("could not read device code session storage", err, "secretName", list.Items[i].Name)
+			continue
+		}
+		// Sessions which have expired are not deleted until they are garbage collected.
+		if (sourceAddress == "" || session.SourceAddress == sourceAddress) && session.Status == StatusPending && now.Before(session.ExpiresAt) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *deviceCodeStorage) CountFailures(ctx context.Context, key string, window time.Duration) (int, error) {
+	f := &failures{}
+	_, err := s.failuresStorage(window).Get(ctx, failuresSignature(key), f)
+	if errors.IsNotFound(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get device code failures: %w", err)
+	}
+	// Failures whose window has ended are not deleted until they are garbage collected.
+	if f.Version != failuresStorageVersion || !s.clock().Before(f.WindowStart.Add(window)) {
+		return 0, nil
+	}
+	return f.Count, nil
+}
+
+func (s *deviceCodeStorage) RecordFailure(ctx context.Context, key string, window time.Duration) error {
+	// Each window gets its own Secret, which is garbage collected when the window ends.
+	storage := s.failuresStorage(window)
+	sig := failuresSignature(key)
+	for attempt := 1; ; attempt++ {
+		now := s.clock()
+		f := &failures{}
+		resourceVersion, err := storage.Get(ctx, sig, f)
+		switch {
+		case errors.IsNotFound(err):
+			_, err = storage.Create(ctx, sig, &failures{WindowStart: now, Count: 1, Version: failuresStorageVersion}, nil, nil)
+		case err != nil:
+			return fmt.Errorf("failed to get device code failures: %w", err)
+		case f.Version != failuresStorageVersion || !now.Before(f.WindowStart.Add(window)):
+			// The window has ended, but the Secret was not garbage collected yet, so start a new window.
+			err = storage.Delete(ctx, sig)
+			if errors.IsNotFound(err) {
+				err = nil
+			}
+			if err == nil {
+				_, err = storage.Create(ctx, sig, &failures{WindowStart: now, Count: 1, Version: failuresStorageVersion}, nil, nil)
+			}
+		default:
+			f.Count++
+			_, err = storage.Update(ctx, sig, resourceVersion, f)
+		}
+		if (errors.IsAlreadyExists(err) || errors.IsConflict(err) || errors.IsNotFound(err)) && attempt < maxFailureUpdateAttempts {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to record device code failure: %w", err)
+		}
+		return nil
+	}
+}
+
+// failuresStorage returns a crud.Storage which will mark new Secrets for garbage collection after the given window.
+func (s *deviceCodeStorage) failuresStorage(window time.Duration) crud.Storage {
+	return crud.New(FailuresTypeLabelValue, s.secrets, s.clock, window)
+}
+
+// JoinCode makes a code for a session by combining the user code of the session with a secret. Device codes and
+// the state params of the session use this format, so the session can be found by the user code and the code
+// can be verified by comparing the hash of the secret.
+func JoinCode(userCode string, secret string) string {
+	normalized, _ := NormalizeUserCode(userCode)
+	return normalized + "." + secret
+}
+
+// SplitCode splits a code made by JoinCode into its user code and secret.
+func SplitCode(code string) (userCode string, secret string, err error) {
+	userCode, secret, found := strings.Cut(code, ".")
+	if !found || secret == "" {
+		return "", "", ErrInvalidCode
+	}
+	if _, ok := NormalizeUserCode(userCode); !ok {
+		return "", "", ErrInvalidCode
+	}
+	return userCode, secret, nil
+}
+
+func sourceAddressLabelValue(sourceAddress string) string {
+	return fmt.Sprintf("%x", sha256.Sum224([]byte(sourceAddress)))
+}
+
+// Hash returns the hash of a secret, for storage in a Session.
+func Hash(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// VerifyHash returns true when the secret matches the hash from a Session.
+func VerifyHash(secret string, hash string) bool {
+	return hash != "" && subtle.ConstantTimeCompare([]byte(Hash(secret)), []byte(hash)) == 1
+}
+
+// NormalizeUserCode removes the formatting from a user code which was typed by the user, since users may type
+// it in lower case and with or without the dash.
+func NormalizeUserCode(userCode string) (string, bool) {
+	normalized := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(userCode))
+	if len(normalized) != userCodeLength {
+		return "", false
+	}
+	for _, c := range normalized {
+		if !strings.ContainsRune(userCodeCharset, c) {
+			return "", false
+		}
+	}
+	return normalized, true
+}
+
+// FormatUserCode formats a user code for display, e.g. "BCDF-GHJK".
+func FormatUserCode(userCode string) string {
+	normalized, ok := NormalizeUserCode(userCode)
+	if !ok {
+		return userCode
+	}
+	return normalized[:userCodeLength/2] + "-" + normalized[userCodeLength/2:]
+}
+
+// GenerateSecret returns a new random secret which is suitable for use with JoinCode.
+func GenerateSecret() (string, error) {
+	return randomSecret(rand.Reader)
+}
+
+func randomSecret(r io.Reader) (string, error) {
+	b := make([]byte, 32)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", fmt.Errorf("failed to generate secret: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func generateUserCode(r io.Reader) (string, error) {
+	b := make([]byte, userCodeLength)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", fmt.Errorf("failed to generate user code: %w", err)
+	}
+	code := make([]byte, userCodeLength)
+	for i := range b {
+		// The charset has 20 characters, which evenly divides 240, so reject bytes above that to avoid bias.
+		for b[i] >= 240 {
+			if _, err := io.ReadFull(r, b[i:i+1]); err != nil {
+				return "", fmt.Errorf("failed to generate user code: %w", err)
+			}
+		}
+		code[i] = userCodeCharset[int(b[i])%len(userCodeCharset)]
+	}
+	return string(code), nil
+}
+
+// signature returns the storage key of a normalized user code.
+func signature(userCode string) string {
+	return userCode
+}
+
+// failuresSignature returns the storage key of the failures of a key, which is hashed because keys such as CSRF
+// tokens are secret and could be too long to be used in the name of a Secret.
+func failuresSignature(key string) string {
+	return Hash(key)
+}
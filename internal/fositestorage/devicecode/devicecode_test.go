@@ -0,0 +1,244 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package devicecode
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const namespace = "test-ns"
+
+var fakeNow = time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+func TestDeviceCodeStorage(t *testing.T) {
+	ctx := context.Background()
+	secrets := fake.NewSimpleClientset().CoreV1().Secrets(namespace)
+	storage := New(secrets, func() time.Time { return fakeNow }, time.Hour)
+	storage.(*deviceCodeStorage).rand = bytes.NewReader(append(make([]byte, 32), 0, 1, 2, 3, 4, 5, 6, 7))
+
+	userCode, deviceCode, err := storage.Create(ctx, &Session{
+		ClientID:      "pinniped-cli",
+		Scopes:        []string{"openid"},
+		SourceAddress: "1.2.3.4",
+		ExpiresAt:     fakeNow.Add(15 * time.Minute),
+		Status:        StatusPending,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "BCDF-GHJK", userCode)
+	require.Equal(t, "BCDFGHJK.AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA", deviceCode)
+
+	secretList, err := secrets.List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, secretList.Items, 1)
+	secret := secretList.Items[0]
+	require.Equal(t, "device-code", secret.Labels["storage.pinniped.dev/type"])
+	require.Equal(t, "b0fbf17d14f6e449e60760030ffe048c29421e4ca353c36670a71504", secret.Labels["storage.pinniped.dev/device-code-source"])
+	require.Equal(t, "2030-01-01T01:00:00Z", secret.Annotations["storage.pinniped.dev/garbage-collect-after"])
+	require.Equal(t, "storage.pinniped.dev/device-code", string(secret.Type))
+	require.JSONEq(t, `{
+		"clientID": "pinniped-cli",
+		"scopes": ["openid"],
+		"sourceAddress": "1.2.3.4",
+		"deviceCodeHash": "DwBzhbb51LfusnSGBa_hqYSgo7-j8BTQnip4TOnlzRo",
+		"expiresAt": "2030-01-01T00:15:00Z",
+		"lastPolledAt": "0001-01-01T00:00:00Z",
+		"status": "pending",
+		"version": "2"
+	}`, string(secret.Data["pinniped-storage-data"]))
+
+	// The session can be found by the user code as typed by the user.
+	session, resourceVersion, err := storage.Get(ctx, "bcdf ghjk")
+	require.NoError(t, err)
+	_, deviceCodeSecret, err := SplitCode(deviceCode)
+	require.NoError(t, err)
+	require.True(t, VerifyHash(deviceCodeSecret, session.DeviceCodeHash))
+	require.False(t, VerifyHash("wrong", session.DeviceCodeHash))
+
+	session.Status = StatusApproved
+	session.AuthorizationCode = "some-authcode"
+	require.NoError(t, storage.Update(ctx, userCode, resourceVersion, session))
+
+	session, _, err = storage.Get(ctx, userCode)
+	require.NoError(t, err)
+	require.Equal(t, StatusApproved, session.Status)
+	require.Equal(t, "some-authcode", session.AuthorizationCode)
+
+	require.NoError(t, storage.Delete(ctx, userCode))
+	_, _, err = storage.Get(ctx, userCode)
+	require.ErrorIs(t, err, ErrInvalidCode)
+}
+
+func TestCountPending(t *testing.T) {
+	ctx := context.Background()
+	secrets := fake.NewSimpleClientset().CoreV1().Secrets(namespace)
+	storage := New(secrets, func() time.Time { return fakeNow }, time.Hour)
+
+	for _, session := range []*Session{
+		{SourceAddress: "1.2.3.4", ExpiresAt: fakeNow.Add(time.Minute), Status: StatusPending},
+		{SourceAddress: "1.2.3.4", ExpiresAt: fakeNow.Add(time.Minute), Status: StatusPending},
+		{SourceAddress: "1.2.3.4", ExpiresAt: fakeNow.Add(time.Minute), Status: StatusApproved},
+		{SourceAddress: "1.2.3.4", ExpiresAt: fakeNow.Add(time.Minute), Status: StatusDenied},
+		{SourceAddress: "1.2.3.4", ExpiresAt: fakeNow.Add(-time.Minute), Status: StatusPending},
+		{SourceAddress: "5.6.7.8", ExpiresAt: fakeNow.Add(time.Minute), Status: StatusPending},
+	} {
+		_, _, err := storage.Create(ctx, session)
+		require.NoError(t, err)
+	}
+
+	count, err := storage.CountPending(ctx, "1.2.3.4")
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+
+	count, err = storage.CountPending(ctx, "5.6.7.8")
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	count, err = storage.CountPending(ctx, "9.9.9.9")
+	require.NoError(t, err)
+	require.Equal(t, 0, count)
+
+	count, err = storage.CountPending(ctx, "")
+	require.NoError(t, err)
+	require.Equal(t, 3, count)
+}
+
+func TestFailures(t *testing.T) {
+	ctx := context.Background()
+	now := fakeNow
+	secrets := fake.NewSimpleClientset().CoreV1().Secrets(namespace)
+	storage := New(secrets, func() time.Time { return now }, time.Hour)
+	const window = 5 * time.Minute
+
+	count, err := storage.CountFailures(ctx, "some-key", window)
+	require.NoError(t, err)
+	require.Equal(t, 0, count)
+
+	require.NoError(t, storage.RecordFailure(ctx, "some-key", window))
+	now = now.Add(time.Minute)
+	require.NoError(t, storage.RecordFailure(ctx, "some-key", window))
+	require.NoError(t, storage.RecordFailure(ctx, "some-other-key", window))
+
+	count, err = storage.CountFailures(ctx, "some-key", window)
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+	count, err = storage.CountFailures(ctx, "some-other-key", window)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	secretList, err := secrets.List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, secretList.Items, 2)
+	for _, secret := range secretList.Items {
+		require.Equal(t, "device-code-failures", secret.Labels["storage.pinniped.dev/type"])
+		// The keys may be secret, so they are not stored.
+		require.NotContains(t, string(secret.Data["pinniped-storage-data"]), "key")
+	}
+
+	// The window starts at the first failure, so its failures are forgotten when it ends, even though the
+	// Secret has not been garbage collected yet.
+	now = fakeNow.Add(window)
+	count, err = storage.CountFailures(ctx, "some-key", window)
+	require.NoError(t, err)
+	require.Equal(t, 0, count)
+
+	// The next failure starts a new window.
+	require.NoError(t, storage.RecordFailure(ctx, "some-key", window))
+	count, err = storage.CountFailures(ctx, "some-key", window)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+	now = now.Add(window - time.Second)
+	count, err = storage.CountFailures(ctx, "some-key", window)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+}
+
+func TestCreateRetriesWhenUserCodeIsInUse(t *testing.T) {
+	ctx := context.Background()
+	secrets := fake.NewSimpleClientset().CoreV1().Secrets(namespace)
+	storage := New(secrets, func() time.Time { return fakeNow }, time.Hour)
+
+	sameUserCode := []byte{0, 1, 2, 3, 4, 5, 6, 7}
+	otherUserCode := []byte{7, 6, 5, 4, 3, 2, 1, 0}
+	var random []byte
+	random = append(random, make([]byte, 32)...)
+	random = append(random, sameUserCode...)
+	random = append(random, make([]byte, 32)...)
+	random = append(random, sameUserCode...)
+	random = append(random, otherUserCode...)
+	storage.(*deviceCodeStorage).rand = bytes.NewReader(random)
+
+	userCode, _, err := storage.Create(ctx, &Session{Status: StatusPending})
+	require.NoError(t, err)
+	require.Equal(t, "BCDF-GHJK", userCode)
+
+	userCode, _, err = storage.Create(ctx, &Session{Status: StatusPending})
+	require.NoError(t, err)
+	require.Equal(t, "KJHG-FDCB", userCode)
+}
+
+func TestGetWithWrongVersion(t *testing.T) {
+	ctx := context.Background()
+	secrets := fake.NewSimpleClientset().CoreV1().Secrets(namespace)
+	storage := New(secrets, func() time.Time { return fakeNow }, time.Hour)
+
+	userCode, _, err := storage.Create(ctx, &Session{Status: StatusPending})
+	require.NoError(t, err)
+
+	session, resourceVersion, err := storage.Get(ctx, userCode)
+	require.NoError(t, err)
+	session.Version = "0"
+	require.NoError(t, storage.Update(ctx, userCode, resourceVersion, session))
+
+	_, _, err = storage.Get(ctx, userCode)
+	require.ErrorIs(t, err, ErrInvalidDeviceCodeRequestVersion)
+}
+
+func TestInvalidUserCodes(t *testing.T) {
+	ctx := context.Background()
+	storage := New(fake.NewSimpleClientset().CoreV1().Secrets(namespace), func() time.Time { return fakeNow }, time.Hour)
+
+	for _, userCode := range []string{"", "BCDF-GHJ", "BCDF-GHJKL", "ABCD-EFGH", "BCDF-GHJ1"} {
+		_, _, err := storage.Get(ctx, userCode)
+		require.ErrorIs(t, err, ErrInvalidCode, userCode)
+		require.ErrorIs(t, storage.Update(ctx, userCode, "1", &Session{}), ErrInvalidCode, userCode)
+		require.ErrorIs(t, storage.Delete(ctx, userCode), ErrInvalidCode, userCode)
+	}
+}
+
+func TestCodes(t *testing.T) {
+	normalized, ok := NormalizeUserCode("bcdf-ghjk")
+	require.True(t, ok)
+	require.Equal(t, "BCDFGHJK", normalized)
+	require.Equal(t, "BCDF-GHJK", FormatUserCode("bcdfghjk"))
+	require.Equal(t, "not-a-code", FormatUserCode("not-a-code"))
+
+	code := JoinCode("bcdf-ghjk", "some-secret")
+	require.Equal(t, "BCDFGHJK.some-secret", code)
+	userCode, secret, err := SplitCode(code)
+	require.NoError(t, err)
+	require.Equal(t, "BCDFGHJK", userCode)
+	require.Equal(t, "some-secret", secret)
+
+	for _, invalid := range []string{"", "BCDFGHJK", "BCDFGHJK.", "AAAAAAAA.some-secret"} {
+		_, _, err := SplitCode(invalid)
+		require.ErrorIs(t, err, ErrInvalidCode, invalid)
+	}
+
+	secret1, err := GenerateSecret()
+	require.NoError(t, err)
+	secret2, err := GenerateSecret()
+	require.NoError(t, err)
+	require.NotEqual(t, secret1, secret2)
+	require.Len(t, secret1, 43)
+	require.True(t, VerifyHash(secret1, Hash(secret1)))
+	require.False(t, VerifyHash(secret1, Hash(secret2)))
+	require.False(t, VerifyHash(secret1, ""))
+}
@@ -1,9 +1,12 @@
-// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package fositestorage
 
 import (
+	"crypto/sha256"
+	"fmt"
+
 	"github.com/ory/fosite"
 
 	"go.pinniped.dev/internal/constable"
@@ -16,6 +19,11 @@ const (
 	ErrInvalidClientType      = constable.Error("requester's client must be of type clientregistry.Client")
 	ErrInvalidSessionType     = constable.Error("requester's session must be of type PinnipedSession")
 	StorageRequestIDLabelName = "storage.pinniped.dev/request-id"
+
+	// SessionOfSubjectLabelName is the label which allows the access token and refresh token sessions of a user with
+	// a client of a FederationDomain to be found, e.g. to end those sessions during RP-initiated logout. Its value is
+	// a hash of the issuer of the FederationDomain, the client ID, and the downstream subject.
+	SessionOfSubjectLabelName = "storage.pinniped.dev/session-of-subject"
 )
 
 func ValidateAndExtractAuthorizeRequest(requester fosite.Requester) (*fosite.Request, error) {
@@ -34,3 +42,26 @@ func ValidateAndExtractAuthorizeRequest(requester fosite.Requester) (*fosite.Req
 
 	return request, nil
 }
+
+// SessionLabels returns the labels of the storage of a token of the session of the request, which was started
+// by the FederationDomain with the given issuer.
+func SessionLabels(issuer string, requester fosite.Requester) map[string]string {
+	labels := map[string]string{StorageRequestIDLabelName: requester.GetID()}
+	if subject := SessionSubject(requester); subject != "" {
+		labels[SessionOfSubjectLabelName] = SessionOfSubjectLabelValue(issuer, requester.GetClient().GetID(), subject)
+	}
+	return labels
+}
+
+func SessionOfSubjectLabelValue(issuer string, clientID string, subject string) string {
+	return fmt.Sprintf("%x", sha256.Sum224([]byte(issuer+"\n"+clientID+"\n"+subject)))
+}
+
+// SessionSubject returns the downstream subject of the session of the request, or an empty string when it is unknown.
+func SessionSubject(requester fosite.Requester) string {
+	session, ok := requester.GetSession().(*psession.PinnipedSession)
+	if !ok || session.Fosite == nil || session.Fosite.Claims == nil {
+		return ""
+	}
+	return session.Fosite.Claims.Subject
+}
@@ -1,4 +1,4 @@
-// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package openidconnect
@@ -32,7 +32,13 @@ const (
 	// Version 2 is when we switched to storing psession.PinnipedSession inside the fosite request.
 	// Version 3 is when we added the Username field to the psession.CustomSessionData.
 	// Version 4 is when fosite added json tags to their openid.DefaultSession struct.
-	oidcStorageVersion = "4"
+	// Version 5 is when we added the UpstreamUsername and UpstreamGroups fields to psession.CustomSessionData.
+	// Version 6 is when we added the PostLogoutRedirectURIs field to clientregistry.Client.
+	// Version 7 is when we added the IDTokenSignedResponseAlg field to clientregistry.Client.
+	// Version 8 is when we added the SAML field to psession.CustomSessionData.
+	// Version 9 is when we added the GitHub field to psession.CustomSessionData.
+	// Version 10 is when we added the CorrelationID field to psession.CustomSessionData.
+	oidcStorageVersion = "10"
 )
 
 var _ openid.OpenIDConnectRequestStorage = &openIDConnectRequestStorage{}
@@ -61,7 +67,13 @@ func (a *openIDConnectRequestStorage) CreateOpenIDConnectSession(ctx context.Con
 		return err
 	}
 
-	_, err = a.storage.Create(ctx, signature, &session{Request: request, Version: oidcStorageVersion}, nil, nil)
+	_, err = a.storage.Create(
+		ctx,
+		signature,
+		&session{Request: request, Version: oidcStorageVersion},
+		map[string]string{fositestorage.StorageRequestIDLabelName: requester.GetID()},
+		nil,
+	)
 	return err
 }
 
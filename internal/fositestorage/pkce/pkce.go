@@ -1,4 +1,4 @@
-// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package pkce
@@ -30,7 +30,13 @@ const (
 	// Version 2 is when we switched to storing psession.PinnipedSession inside the fosite request.
 	// Version 3 is when we added the Username field to the psession.CustomSessionData.
 	// Version 4 is when fosite added json tags to their openid.DefaultSession struct.
-	pkceStorageVersion = "4"
+	// Version 5 is when we added the UpstreamUsername and UpstreamGroups fields to psession.CustomSessionData.
+	// Version 6 is when we added the PostLogoutRedirectURIs field to clientregistry.Client.
+	// Version 7 is when we added the IDTokenSignedResponseAlg field to clientregistry.Client.
+	// Version 8 is when we added the SAML field to psession.CustomSessionData.
+	// Version 9 is when we added the GitHub field to psession.CustomSessionData.
+	// Version 10 is when we added the CorrelationID field to psession.CustomSessionData.
+	pkceStorageVersion = "10"
 )
 
 var _ pkce.PKCERequestStorage = &pkceStorage{}
@@ -54,7 +60,13 @@ func (a *pkceStorage) CreatePKCERequestSession(ctx context.Context, signature st
 		return err
 	}
 
-	_, err = a.storage.Create(ctx, signature, &session{Request: request, Version: pkceStorageVersion}, nil, nil)
+	_, err = a.storage.Create(
+		ctx,
+		signature,
+		&session{Request: request, Version: pkceStorageVersion},
+		map[string]string{fositestorage.StorageRequestIDLabelName: requester.GetID()},
+		nil,
+	)
 	return err
 }
 
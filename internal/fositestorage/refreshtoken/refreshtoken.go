@@ -1,4 +1,4 @@
-// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package refreshtoken
@@ -31,7 +31,13 @@ const (
 	// Version 2 is when we switched to storing psession.PinnipedSession inside the fosite request.
 	// Version 3 is when we added the Username field to the psession.CustomSessionData.
 	// Version 4 is when fosite added json tags to their openid.DefaultSession struct.
-	refreshTokenStorageVersion = "4"
+	// Version 5 is when we added the UpstreamUsername and UpstreamGroups fields to psession.CustomSessionData.
+	// Version 6 is when we added the PostLogoutRedirectURIs field to clientregistry.Client.
+	// Version 7 is when we added the IDTokenSignedResponseAlg field to clientregistry.Client.
+	// Version 8 is when we added the SAML field to psession.CustomSessionData.
+	// Version 9 is when we added the GitHub field to psession.CustomSessionData.
+	// Version 10 is when we added the CorrelationID field to psession.CustomSessionData.
+	refreshTokenStorageVersion = "10"
 )
 
 type RevocationStorage interface {
@@ -44,6 +50,7 @@ var _ RevocationStorage = &refreshTokenStorage{}
 
 type refreshTokenStorage struct {
 	storage crud.Storage
+	issuer  string
 }
 
 type Session struct {
@@ -51,8 +58,9 @@ type Session struct {
 	Version string          `json:"version"`
 }
 
-func New(secrets corev1client.SecretInterface, clock func() time.Time, sessionStorageLifetime time.Duration) RevocationStorage {
-	return &refreshTokenStorage{storage: crud.New(TypeLabelValue, secrets, clock, sessionStorageLifetime)}
+// New creates the storage of the sessions which are started by the FederationDomain with the given issuer.
+func New(secrets corev1client.SecretInterface, clock func() time.Time, sessionStorageLifetime time.Duration, issuer string) RevocationStorage {
+	return &refreshTokenStorage{storage: crud.New(TypeLabelValue, secrets, clock, sessionStorageLifetime), issuer: issuer}
 }
 
 // ReadFromSecret reads the contents of a Secret as a Session.
@@ -91,7 +99,7 @@ func (a *refreshTokenStorage) CreateRefreshTokenSession(ctx context.Context, sig
 		ctx,
 		signature,
 		&Session{Request: request, Version: refreshTokenStorageVersion},
-		map[string]string{fositestorage.StorageRequestIDLabelName: requester.GetID()},
+		fositestorage.SessionLabels(a.issuer, requester),
 		nil,
 	)
 	return err
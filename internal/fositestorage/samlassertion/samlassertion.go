@@ -0,0 +1,98 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package samlassertion
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"go.pinniped.dev/internal/constable"
+	"go.pinniped.dev/internal/crud"
+)
+
+const (
+	TypeLabelValue = "saml-assertion"
+
+	ErrAssertionAlreadyUsed = constable.Error("SAML assertion was already used")
+
+	// Version 1 was the initial release of storage.
+	samlAssertionStorageVersion = "1"
+)
+
+// Storage remembers the SAML assertions which were used to log in at the assertion consumer service, so that a
+// captured SAML response cannot be used to log in a second time, even by another Supervisor pod.
+type Storage interface {
+	// UseAssertion records that the assertion with the given ID, which was issued in response to the SAML request
+	// with the given ID, was used. It returns ErrAssertionAlreadyUsed when the assertion was already used before,
+	// and remembers the assertion until notOnOrAfter, after which the assertion is no longer accepted anyway.
+	UseAssertion(ctx context.Context, assertionID, inResponseTo string, notOnOrAfter time.Time) error
+}
+
+type samlAssertionStorage struct {
+	secrets corev1client.SecretInterface
+	clock   func() time.Time
+}
+
+type usedAssertion struct {
+	Expiry  time.Time `json:"expiry"`
+	Version string    `json:"version"`
+}
+
+func New(secrets corev1client.SecretInterface, clock func() time.Time) Storage {
+	return &samlAssertionStorage{secrets: secrets, clock: clock}
+}
+
+func (s *samlAssertionStorage) UseAssertion(ctx context.Context, assertionID, inResponseTo string, notOnOrAfter time.Time) error {
+	lifetime := notOnOrAfter.Sub(s.clock())
+	if lifetime <= 0 {
+		return fmt.Errorf("%w: assertion is no longer valid", ErrAssertionAlreadyUsed)
+	}
+
+	storage := s.storage(lifetime)
+	sig := signature(assertionID, inResponseTo)
+	_, err := storage.Create(ctx, sig, &usedAssertion{Expiry: notOnOrAfter, Version: samlAssertionStorageVersion}, nil, nil)
+	if !errors.IsAlreadyExists(err) {
+		if err != nil {
+			return fmt.Errorf("failed to record use of SAML assertion: %w", err)
+		}
+		return nil
+	}
+
+	// Allow an expired assertion ID which was not garbage collected yet to be used again, which can only happen
+	// when the upstream provider reuses its assertion IDs.
+	used := &usedAssertion{}
+	if _, err := storage.Get(ctx, sig, used); err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to get used SAML assertion: %w", err)
+	}
+	if used.Version == samlAssertionStorageVersion && used.Expiry.After(s.clock()) {
+		return ErrAssertionAlreadyUsed
+	}
+	if err := storage.Delete(ctx, sig); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	_, err = storage.Create(ctx, sig, &usedAssertion{Expiry: notOnOrAfter, Version: samlAssertionStorageVersion}, nil, nil)
+	if errors.IsAlreadyExists(err) {
+		return ErrAssertionAlreadyUsed
+	}
+	return err
+}
+
+// storage returns a crud.Storage which will mark new Secrets for garbage collection after the given lifetime,
+// since each assertion only needs to be remembered until it expires.
+func (s *samlAssertionStorage) storage(lifetime time.Duration) crud.Storage {
+	return crud.New(TypeLabelValue, s.secrets, s.clock, lifetime)
+}
+
+// signature hashes the assertion ID and the request ID, which are chosen by the upstream provider and could
+// otherwise be too long to be used in the name of a Secret.
+func signature(assertionID, inResponseTo string) string {
+	hash := sha256.Sum256([]byte(inResponseTo + "\n" + assertionID))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
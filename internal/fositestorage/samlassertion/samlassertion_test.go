@@ -0,0 +1,65 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package samlassertion
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+const namespace = "test-ns"
+
+var fakeNow = time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+func TestSAMLAssertionStorage(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+	secrets := client.CoreV1().Secrets(namespace)
+	clock := clocktesting.NewFakeClock(fakeNow)
+	storage := New(secrets, clock.Now)
+
+	// Each assertion can only be used once until it expires.
+	require.NoError(t, storage.UseAssertion(ctx, "assertion-1", "request-1", fakeNow.Add(5*time.Minute)))
+	require.ErrorIs(t, storage.UseAssertion(ctx, "assertion-1", "request-1", fakeNow.Add(5*time.Minute)), ErrAssertionAlreadyUsed)
+	require.NoError(t, storage.UseAssertion(ctx, "assertion-1", "request-2", fakeNow.Add(5*time.Minute)))
+	require.NoError(t, storage.UseAssertion(ctx, "assertion-2", "request-1", fakeNow.Add(5*time.Minute)))
+
+	secretList, err := secrets.List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, secretList.Items, 3)
+	for _, secret := range secretList.Items {
+		require.Equal(t, "saml-assertion", secret.Labels["storage.pinniped.dev/type"])
+		require.Equal(t, "2030-01-01T00:05:00Z", secret.Annotations["storage.pinniped.dev/garbage-collect-after"])
+		require.Equal(t, `{"expiry":"2030-01-01T00:05:00Z","version":"1"}`, string(secret.Data["pinniped-storage-data"]))
+		require.Equal(t, "storage.pinniped.dev/saml-assertion", string(secret.Type))
+	}
+
+	// After the assertion expires, its ID may be used again even before the garbage collector deletes it.
+	clock.Step(6 * time.Minute)
+	require.NoError(t, storage.UseAssertion(ctx, "assertion-1", "request-1", clock.Now().Add(time.Minute)))
+	require.ErrorIs(t, storage.UseAssertion(ctx, "assertion-1", "request-1", clock.Now().Add(time.Minute)), ErrAssertionAlreadyUsed)
+
+	// An already expired assertion is never accepted.
+	require.ErrorIs(t, storage.UseAssertion(ctx, "assertion-3", "request-3", clock.Now()), ErrAssertionAlreadyUsed)
+
+	secretList, err = secrets.List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, secretList.Items, 3)
+}
+
+func TestLongAssertionID(t *testing.T) {
+	ctx := context.Background()
+	secrets := fake.NewSimpleClientset().CoreV1().Secrets(namespace)
+	storage := New(secrets, func() time.Time { return fakeNow })
+
+	longID := string(make([]byte, 1000))
+	require.NoError(t, storage.UseAssertion(ctx, longID, "request-1", fakeNow.Add(time.Minute)))
+	require.ErrorIs(t, storage.UseAssertion(ctx, longID, "request-1", fakeNow.Add(time.Minute)), ErrAssertionAlreadyUsed)
+}
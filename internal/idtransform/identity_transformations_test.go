@@ -0,0 +1,104 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package idtransform
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeTransformation struct {
+	result *TransformationResult
+	err    error
+	called bool
+}
+
+func (f *fakeTransformation) Evaluate(_ context.Context, _ string, _ []string) (*TransformationResult, error) {
+	f.called = true
+	return f.result, f.err
+}
+
+func allowed(username string, groups ...string) *TransformationResult {
+	return &TransformationResult{Username: username, Groups: groups, AuthenticationAllowed: true}
+}
+
+func TestTransformationPipelineEvaluate(t *testing.T) {
+	tests := []struct {
+		name            string
+		transforms      []*fakeTransformation
+		wantResult      *TransformationResult
+		wantErr         string
+		wantCalledCount int
+	}{
+		{
+			name:       "no transformations returns the inputs unchanged",
+			wantResult: allowed("input-username", "input-group"),
+		},
+		{
+			name: "the result of the last transformation is returned",
+			transforms: []*fakeTransformation{
+				{result: allowed("username1", "group1")},
+				{result: allowed("username2", "group2")},
+			},
+			wantResult:      allowed("username2", "group2"),
+			wantCalledCount: 2,
+		},
+		{
+			name: "rejected authentication stops the pipeline",
+			transforms: []*fakeTransformation{
+				{result: &TransformationResult{AuthenticationAllowed: false, RejectedAuthenticationMessage: "nope"}},
+				{result: allowed("username2", "group2")},
+			},
+			wantResult:      &TransformationResult{AuthenticationAllowed: false, RejectedAuthenticationMessage: "nope"},
+			wantCalledCount: 1,
+		},
+		{
+			name: "errors stop the pipeline",
+			transforms: []*fakeTransformation{
+				{result: allowed("username1", "group1")},
+				{err: errors.New("some error")},
+				{result: allowed("username3", "group3")},
+			},
+			wantErr:         "identity transformation at index 1: some error",
+			wantCalledCount: 2,
+		},
+		{
+			name: "empty usernames are not allowed",
+			transforms: []*fakeTransformation{
+				{result: allowed("", "group1")},
+			},
+			wantErr:         "identity transformation at index 0 returned an empty username, which is not allowed",
+			wantCalledCount: 1,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			pipeline := NewTransformationPipeline()
+			for _, transform := range tt.transforms {
+				pipeline.AppendTransformation(transform)
+			}
+
+			result, err := pipeline.Evaluate(context.Background(), "input-username", []string{"input-group"})
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				require.Nil(t, result)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, tt.wantResult, result)
+			}
+
+			calledCount := 0
+			for _, transform := range tt.transforms {
+				if transform.called {
+					calledCount++
+				}
+			}
+			require.Equal(t, tt.wantCalledCount, calledCount)
+		})
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package oidc
+
+import (
+	"net/http"
+
+	"github.com/ory/fosite"
+
+	"go.pinniped.dev/internal/auditlog"
+	"go.pinniped.dev/internal/psession"
+)
+
+// The ID of a downstream authorize request is used as the correlation ID of the audit events for a login.
+// It is remembered in the custom data of the downstream session, which fosite copies into the access and refresh
+// token requests of the session, so it links the events of the authorize, callback, and token endpoints together.
+// Browser-based logins span multiple requests to the authorize, callback, and login endpoints, so the ID of the
+// original authorize request is carried in the upstream state param. The correlation ID is never used as the ID of
+// a fosite request, because fosite relies on the IDs of stored sessions being unique.
+
+// RestoreCorrelationID gives an authorize request which was recreated from the upstream state param a session which
+// remembers the ID of the original authorize request, so it can be found by CorrelationID and copied into the
+// downstream session which is about to be created by SetCorrelationID.
+func RestoreCorrelationID(authorizeRequester fosite.AuthorizeRequester, state *UpstreamStateParamData) {
+	// State params which were created by older versions of the Supervisor will not have a correlation ID.
+	if state.CorrelationID != "" {
+		authorizeRequester.SetSession(&psession.PinnipedSession{Custom: &psession.CustomSessionData{CorrelationID: state.CorrelationID}})
+	}
+}
+
+// SetCorrelationID remembers the correlation ID of the authorize request in the downstream session which will be
+// created for it.
+func SetCorrelationID(session *psession.PinnipedSession, authorizeRequester fosite.Requester) {
+	if session.Custom == nil {
+		session.Custom = &psession.CustomSessionData{}
+	}
+	session.Custom.CorrelationID = CorrelationID(authorizeRequester)
+}
+
+// CorrelationID returns the correlation ID of the login which the request belongs to. Requests which were not
+// given a correlation ID, e.g. the sessions which were created by older versions of the Supervisor, use their own ID.
+func CorrelationID(requester fosite.Requester) string {
+	session, ok := requester.GetSession().(*psession.PinnipedSession)
+	if ok && session.Custom != nil && session.Custom.CorrelationID != "" {
+		return session.Custom.CorrelationID
+	}
+	return requester.GetID()
+}
+
+// AuditUpstreamLoginSucceeded records that the user logged in to the upstream identity provider, and was given
+// the downstream username and groups after any identity transformations were applied.
+func AuditUpstreamLoginSucceeded(
+	auditLogger auditlog.Logger,
+	r *http.Request,
+	authorizeRequester fosite.AuthorizeRequester,
+	upstreamName string,
+	upstreamType psession.ProviderType,
+	username string,
+	groups []string,
+) {
+	event := upstreamLoginEvent(auditlog.UpstreamLoginSucceeded, r, authorizeRequester, upstreamName, upstreamType)
+	event.User = &auditlog.User{Username: username, Groups: groups}
+	auditLogger.Audit(event)
+}
+
+// AuditUpstreamLoginFailed records that the user could not log in to the upstream identity provider, or that their
+// upstream identity was not allowed to log in to the FederationDomain, for the given reason.
+func AuditUpstreamLoginFailed(
+	auditLogger auditlog.Logger,
+	r *http.Request,
+	authorizeRequester fosite.AuthorizeRequester,
+	upstreamName string,
+	upstreamType psession.ProviderType,
+	reason string,
+) {
+	event := upstreamLoginEvent(auditlog.UpstreamLoginFailed, r, authorizeRequester, upstreamName, upstreamType)
+	event.Message = reason
+	auditLogger.Audit(event)
+}
+
+func upstreamLoginEvent(
+	eventType auditlog.EventType,
+	r *http.Request,
+	authorizeRequester fosite.AuthorizeRequester,
+	upstreamName string,
+	upstreamType psession.ProviderType,
+) auditlog.Event {
+	return auditlog.Event{
+		Type:          eventType,
+		CorrelationID: CorrelationID(authorizeRequester),
+		Request:       auditlog.RequestFromHTTP(r),
+		UpstreamIDP:   &auditlog.UpstreamIDP{Name: upstreamName, Type: string(upstreamType)},
+		ClientID:      authorizeRequester.GetClient().GetID(),
+	}
+}
@@ -1,4 +1,4 @@
-// Copyright 2020-2023 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 // Package auth provides a handler for the OIDC authorization endpoint.
@@ -15,14 +15,18 @@ import (
 	"github.com/ory/fosite/token/jwt"
 	"golang.org/x/oauth2"
 
+	idpdiscoveryv1alpha1 "go.pinniped.dev/generated/latest/apis/supervisor/idpdiscovery/v1alpha1"
 	oidcapi "go.pinniped.dev/generated/latest/apis/supervisor/oidc"
+	"go.pinniped.dev/internal/auditlog"
 	"go.pinniped.dev/internal/httputil/httperr"
 	"go.pinniped.dev/internal/httputil/securityheader"
+	"go.pinniped.dev/internal/idtransform"
 	"go.pinniped.dev/internal/oidc"
 	"go.pinniped.dev/internal/oidc/csrftoken"
 	"go.pinniped.dev/internal/oidc/downstreamsession"
 	"go.pinniped.dev/internal/oidc/login"
 	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/oidc/provider/branding"
 	"go.pinniped.dev/internal/oidc/provider/formposthtml"
 	"go.pinniped.dev/internal/plog"
 	"go.pinniped.dev/internal/psession"
@@ -37,7 +41,7 @@ const (
 
 func NewHandler(
 	downstreamIssuer string,
-	idpLister oidc.UpstreamIdentityProvidersLister,
+	idpLister oidc.FederationDomainIdentityProvidersListerI,
 	oauthHelperWithoutStorage fosite.OAuth2Provider,
 	oauthHelperWithStorage fosite.OAuth2Provider,
 	generateCSRF func() (csrftoken.CSRFToken, error),
@@ -45,6 +49,8 @@ func NewHandler(
 	generateNonce func() (nonce.Nonce, error),
 	upstreamStateEncoder oidc.Encoder,
 	cookieCodec oidc.Codec,
+	getBranding func() *branding.Branding,
+	auditLogger auditlog.Logger,
 ) http.Handler {
 	handler := httperr.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
 		if r.Method != http.MethodPost && r.Method != http.MethodGet {
@@ -54,23 +60,40 @@ func NewHandler(
 			return httperr.Newf(http.StatusMethodNotAllowed, "%s (try GET or POST)", r.Method)
 		}
 
-		// Note that the client might have used oidcapi.AuthorizeUpstreamIDPNameParamName and
+		// Parse the form now so that the params used to choose an upstream IDP can be read.
+		// The rest of the params will be validated later by fosite.
+		if err := r.ParseForm(); err != nil {
+			return httperr.Wrap(http.StatusBadRequest, "error parsing request params", err)
+		}
+
+		// The client might have used oidcapi.AuthorizeUpstreamIDPNameParamName and
 		// oidcapi.AuthorizeUpstreamIDPTypeParamName query params to request a certain upstream IDP.
 		// The Pinniped CLI has been sending these params since v0.9.0.
-		// Currently, these are ignored because the Supervisor does not yet support logins when multiple IDPs
-		// are configured. However, these params should be honored in the future when choosing an upstream
-		// here, e.g. by calling oidcapi.FindUpstreamIDPByNameAndType() when the params are present.
-		oidcUpstream, ldapUpstream, idpType, err := chooseUpstreamIDP(idpLister)
+		requestedIDPName := r.Form.Get(oidcapi.AuthorizeUpstreamIDPNameParamName)
+		requestedIDPType := r.Form.Get(oidcapi.AuthorizeUpstreamIDPTypeParamName)
+
+		if requestedIDPName == "" && !hasUsernameOrPasswordHeader(r) && countUpstreamIDPs(idpLister) > 1 {
+			// This is a browser-based login which did not choose an upstream IDP, and there is more than one
+			// upstream IDP available, so let the user choose one.
+			return handleAuthRequestForBrowserFlowWhichRequiresChoosingUpstreamIDP(r, w, oauthHelperWithoutStorage, downstreamIssuer)
+		}
+
+		oidcUpstream, ldapUpstream, samlUpstream, gitHubUpstream, idpType, err := chooseUpstreamIDP(requestedIDPName, requestedIDPType, idpLister)
 		if err != nil {
 			plog.WarningErr("authorize upstream config", err)
 			return err
 		}
 
 		if idpType == psession.ProviderTypeOIDC {
-			if len(r.Header.Values(oidcapi.AuthorizeUsernameHeaderName)) > 0 ||
-				len(r.Header.Values(oidcapi.AuthorizePasswordHeaderName)) > 0 {
+			oidc.RecordUpstreamIDPForMetrics(r.Context(), oidcUpstream.GetName(), idpType)
+			if hasUsernameOrPasswordHeader(r) {
 				// The client set a username header, so they are trying to log in with a username/password.
-				return handleAuthRequestForOIDCUpstreamPasswordGrant(r, w, oauthHelperWithStorage, oidcUpstream)
+				return handleAuthRequestForOIDCUpstreamPasswordGrant(r, w,
+					oauthHelperWithStorage,
+					oidcUpstream,
+					idpLister.GetIdentityTransformations(oidcUpstream.GetName(), idpType),
+					auditLogger,
+				)
 			}
 			return handleAuthRequestForOIDCUpstreamBrowserFlow(r, w,
 				oauthHelperWithoutStorage,
@@ -82,14 +105,48 @@ func NewHandler(
 			)
 		}
 
+		if idpType == psession.ProviderTypeSAML {
+			oidc.RecordUpstreamIDPForMetrics(r.Context(), samlUpstream.GetName(), idpType)
+			if hasUsernameOrPasswordHeader(r) {
+				// The client set a username header, but SAML logins can only happen in a browser.
+				return handleAuthRequestForBrowserOnlyUpstreamCLIFlow(r, w, oauthHelperWithoutStorage, "SAML")
+			}
+			return handleAuthRequestForSAMLUpstreamBrowserFlow(r, w,
+				oauthHelperWithoutStorage,
+				generateCSRF, generateNonce, generatePKCE,
+				samlUpstream,
+				downstreamIssuer,
+				upstreamStateEncoder,
+				cookieCodec,
+			)
+		}
+
+		if idpType == psession.ProviderTypeGitHub {
+			oidc.RecordUpstreamIDPForMetrics(r.Context(), gitHubUpstream.GetName(), idpType)
+			if hasUsernameOrPasswordHeader(r) {
+				// The client set a username header, but GitHub logins can only happen in a browser.
+				return handleAuthRequestForBrowserOnlyUpstreamCLIFlow(r, w, oauthHelperWithoutStorage, "GitHub")
+			}
+			return handleAuthRequestForGitHubUpstreamBrowserFlow(r, w,
+				oauthHelperWithoutStorage,
+				generateCSRF, generateNonce, generatePKCE,
+				gitHubUpstream,
+				downstreamIssuer,
+				upstreamStateEncoder,
+				cookieCodec,
+			)
+		}
+
 		// We know it's an AD/LDAP upstream.
-		if len(r.Header.Values(oidcapi.AuthorizeUsernameHeaderName)) > 0 ||
-			len(r.Header.Values(oidcapi.AuthorizePasswordHeaderName)) > 0 {
+		oidc.RecordUpstreamIDPForMetrics(r.Context(), ldapUpstream.GetName(), idpType)
+		if hasUsernameOrPasswordHeader(r) {
 			// The client set a username header, so they are trying to log in with a username/password.
 			return handleAuthRequestForLDAPUpstreamCLIFlow(r, w,
 				oauthHelperWithStorage,
 				ldapUpstream,
 				idpType,
+				idpLister.GetIdentityTransformations(ldapUpstream.GetName(), idpType),
+				auditLogger,
 			)
 		}
 		return handleAuthRequestForLDAPUpstreamBrowserFlow(
@@ -110,7 +167,57 @@ func NewHandler(
 	// During a response_mode=form_post auth request using the browser flow, the custom form_post html page may
 	// be used to post certain errors back to the CLI from this handler's response, so allow the form_post
 	// page's CSS and JS to run.
-	return securityheader.WrapWithCustomCSP(handler, formposthtml.ContentSecurityPolicy())
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		securityheader.WrapWithCustomCSP(handler, formposthtml.ContentSecurityPolicyWithBranding(getBranding())).ServeHTTP(w, r)
+	})
+}
+
+func hasUsernameOrPasswordHeader(r *http.Request) bool {
+	return len(r.Header.Values(oidcapi.AuthorizeUsernameHeaderName)) > 0 ||
+		len(r.Header.Values(oidcapi.AuthorizePasswordHeaderName)) > 0
+}
+
+func countUpstreamIDPs(idpLister oidc.UpstreamIdentityProvidersLister) int {
+	return len(idpLister.GetOIDCIdentityProviders()) +
+		len(idpLister.GetLDAPIdentityProviders()) +
+		len(idpLister.GetActiveDirectoryIdentityProviders()) +
+		len(idpLister.GetSAMLIdentityProviders()) +
+		len(idpLister.GetGitHubIdentityProviders())
+}
+
+// handleAuthRequestForBrowserFlowWhichRequiresChoosingUpstreamIDP validates the authorization request and then
+// redirects to the page which lets the user choose an upstream IDP, passing along all the authorization params.
+// The state param and CSRF cookie are not created here. That will happen when the user's choice sends them back
+// to this endpoint with the params which choose the upstream IDP.
+func handleAuthRequestForBrowserFlowWhichRequiresChoosingUpstreamIDP(
+	r *http.Request,
+	w http.ResponseWriter,
+	oauthHelper fosite.OAuth2Provider,
+	downstreamIssuer string,
+) error {
+	authorizeRequester, created := newAuthorizeRequest(r, w, oauthHelper, false)
+	if !created {
+		return nil
+	}
+
+	promptParam := r.Form.Get(promptParamName)
+	if promptParam == promptParamNone && oidc.ScopeWasRequested(authorizeRequester, oidcapi.ScopeOpenID) {
+		oidc.WriteAuthorizeError(r, w, oauthHelper, authorizeRequester, fosite.ErrLoginRequired, false)
+		return nil
+	}
+
+	chooseIDPURL, err := url.Parse(downstreamIssuer + oidc.ChooseIDPEndpointPath)
+	if err != nil {
+		return err
+	}
+	chooseIDPURL.RawQuery = r.Form.Encode()
+
+	http.Redirect(w, r,
+		chooseIDPURL.String(),
+		http.StatusSeeOther, // match fosite and https://tools.ietf.org/id/draft-ietf-oauth-security-topics-18.html#section-4.11
+	)
+
+	return nil
 }
 
 func handleAuthRequestForLDAPUpstreamCLIFlow(
@@ -119,6 +226,8 @@ func handleAuthRequestForLDAPUpstreamCLIFlow(
 	oauthHelper fosite.OAuth2Provider,
 	ldapUpstream provider.UpstreamLDAPIdentityProviderI,
 	idpType psession.ProviderType,
+	identityTransforms *idtransform.TransformationPipeline,
+	auditLogger auditlog.Logger,
 ) error {
 	authorizeRequester, created := newAuthorizeRequest(r, w, oauthHelper, true)
 	if !created {
@@ -137,18 +246,31 @@ func handleAuthRequestForLDAPUpstreamCLIFlow(
 	authenticateResponse, authenticated, err := ldapUpstream.AuthenticateUser(r.Context(), username, password, authorizeRequester.GetGrantedScopes())
 	if err != nil {
 		plog.WarningErr("unexpected error during upstream LDAP authentication", err, "upstreamName", ldapUpstream.GetName())
+		oidc.AuditUpstreamLoginFailed(auditLogger, r, authorizeRequester, ldapUpstream.GetName(), idpType, err.Error())
 		return httperr.New(http.StatusBadGateway, "unexpected error during upstream authentication")
 	}
 	if !authenticated {
+		oidc.AuditUpstreamLoginFailed(auditLogger, r, authorizeRequester, ldapUpstream.GetName(), idpType, "username/password not accepted")
 		oidc.WriteAuthorizeError(r, w, oauthHelper, authorizeRequester,
 			fosite.ErrAccessDenied.WithHintf("Username/password not accepted by LDAP provider."), true)
 		return nil
 	}
 
 	subject := downstreamsession.DownstreamSubjectFromUpstreamLDAP(ldapUpstream, authenticateResponse)
-	username = authenticateResponse.User.GetName()
-	groups := authenticateResponse.User.GetGroups()
-	customSessionData := downstreamsession.MakeDownstreamLDAPOrADCustomSessionData(ldapUpstream, idpType, authenticateResponse, username)
+	upstreamUsername := authenticateResponse.User.GetName()
+	upstreamGroups := authenticateResponse.User.GetGroups()
+
+	username, groups, err := downstreamsession.ApplyIdentityTransformations(r.Context(), identityTransforms, upstreamUsername, upstreamGroups)
+	if err != nil {
+		oidc.AuditUpstreamLoginFailed(auditLogger, r, authorizeRequester, ldapUpstream.GetName(), idpType, err.Error())
+		oidc.WriteAuthorizeError(r, w, oauthHelper, authorizeRequester,
+			fosite.ErrAccessDenied.WithHintf("Reason: %s.", err.Error()), true,
+		)
+		return nil
+	}
+
+	oidc.AuditUpstreamLoginSucceeded(auditLogger, r, authorizeRequester, ldapUpstream.GetName(), idpType, username, groups)
+	customSessionData := downstreamsession.MakeDownstreamLDAPOrADCustomSessionData(ldapUpstream, idpType, authenticateResponse, username, upstreamUsername, upstreamGroups)
 	openIDSession := downstreamsession.MakeDownstreamSession(subject, username, groups,
 		authorizeRequester.GetGrantedScopes(), authorizeRequester.GetClient().GetID(), customSessionData, map[string]interface{}{})
 	oidc.PerformAuthcodeRedirect(r, w, oauthHelper, authorizeRequester, openIDSession, true)
@@ -197,6 +319,8 @@ func handleAuthRequestForOIDCUpstreamPasswordGrant(
 	w http.ResponseWriter,
 	oauthHelper fosite.OAuth2Provider,
 	oidcUpstream provider.UpstreamOIDCIdentityProviderI,
+	identityTransforms *idtransform.TransformationPipeline,
+	auditLogger auditlog.Logger,
 ) error {
 	authorizeRequester, created := newAuthorizeRequest(r, w, oauthHelper, true)
 	if !created {
@@ -229,13 +353,15 @@ func handleAuthRequestForOIDCUpstreamPasswordGrant(
 		// However, the exact response is undefined in the sense that there is no such thing as a password grant in
 		// the OIDC spec, so we don't try too hard to read the upstream errors in this case. (E.g. Dex departs from the
 		// spec and returns something other than an "invalid_grant" error for bad resource owner credentials.)
+		oidc.AuditUpstreamLoginFailed(auditLogger, r, authorizeRequester, oidcUpstream.GetName(), psession.ProviderTypeOIDC, err.Error())
 		oidc.WriteAuthorizeError(r, w, oauthHelper, authorizeRequester,
 			fosite.ErrAccessDenied.WithDebug(err.Error()), true) // WithDebug hides the error from the client
 		return nil
 	}
 
-	subject, username, groups, err := downstreamsession.GetDownstreamIdentityFromUpstreamIDToken(oidcUpstream, token.IDToken.Claims)
+	subject, upstreamUsername, upstreamGroups, err := downstreamsession.GetDownstreamIdentityFromUpstreamIDToken(oidcUpstream, token.IDToken.Claims)
 	if err != nil {
+		oidc.AuditUpstreamLoginFailed(auditLogger, r, authorizeRequester, oidcUpstream.GetName(), psession.ProviderTypeOIDC, err.Error())
 		// Return a user-friendly error for this case which is entirely within our control.
 		oidc.WriteAuthorizeError(r, w, oauthHelper, authorizeRequester,
 			fosite.ErrAccessDenied.WithHintf("Reason: %s.", err.Error()), true,
@@ -243,16 +369,27 @@ func handleAuthRequestForOIDCUpstreamPasswordGrant(
 		return nil
 	}
 
+	username, groups, err := downstreamsession.ApplyIdentityTransformations(r.Context(), identityTransforms, upstreamUsername, upstreamGroups)
+	if err != nil {
+		oidc.AuditUpstreamLoginFailed(auditLogger, r, authorizeRequester, oidcUpstream.GetName(), psession.ProviderTypeOIDC, err.Error())
+		oidc.WriteAuthorizeError(r, w, oauthHelper, authorizeRequester,
+			fosite.ErrAccessDenied.WithHintf("Reason: %s.", err.Error()), true,
+		)
+		return nil
+	}
+
 	additionalClaims := downstreamsession.MapAdditionalClaimsFromUpstreamIDToken(oidcUpstream, token.IDToken.Claims)
 
-	customSessionData, err := downstreamsession.MakeDownstreamOIDCCustomSessionData(oidcUpstream, token, username)
+	customSessionData, err := downstreamsession.MakeDownstreamOIDCCustomSessionData(oidcUpstream, token, username, upstreamUsername, upstreamGroups)
 	if err != nil {
+		oidc.AuditUpstreamLoginFailed(auditLogger, r, authorizeRequester, oidcUpstream.GetName(), psession.ProviderTypeOIDC, err.Error())
 		oidc.WriteAuthorizeError(r, w, oauthHelper, authorizeRequester,
 			fosite.ErrAccessDenied.WithHintf("Reason: %s.", err.Error()), true,
 		)
 		return nil
 	}
 
+	oidc.AuditUpstreamLoginSucceeded(auditLogger, r, authorizeRequester, oidcUpstream.GetName(), psession.ProviderTypeOIDC, username, groups)
 	openIDSession := downstreamsession.MakeDownstreamSession(subject, username, groups,
 		authorizeRequester.GetGrantedScopes(), authorizeRequester.GetClient().GetID(), customSessionData, additionalClaims)
 
@@ -323,6 +460,141 @@ func handleAuthRequestForOIDCUpstreamBrowserFlow(
 	return nil
 }
 
+// handleAuthRequestForBrowserOnlyUpstreamCLIFlow rejects a login which used the username and password headers
+// with an upstream IDP of a type which only supports browser-based logins.
+func handleAuthRequestForBrowserOnlyUpstreamCLIFlow(
+	r *http.Request,
+	w http.ResponseWriter,
+	oauthHelper fosite.OAuth2Provider,
+	upstreamTypeDisplayName string,
+) error {
+	authorizeRequester, created := newAuthorizeRequest(r, w, oauthHelper, true)
+	if !created {
+		return nil
+	}
+
+	// Return a user-friendly error for this case which is entirely within our control.
+	oidc.WriteAuthorizeError(r, w, oauthHelper, authorizeRequester,
+		fosite.ErrAccessDenied.WithHintf(
+			"Username and password headers are not supported for %s upstream providers, which only support browser-based logins.",
+			upstreamTypeDisplayName), true)
+	return nil
+}
+
+func handleAuthRequestForSAMLUpstreamBrowserFlow(
+	r *http.Request,
+	w http.ResponseWriter,
+	oauthHelper fosite.OAuth2Provider,
+	generateCSRF func() (csrftoken.CSRFToken, error),
+	generateNonce func() (nonce.Nonce, error),
+	generatePKCE func() (pkce.Code, error),
+	samlUpstream provider.UpstreamSAMLIdentityProviderI,
+	downstreamIssuer string,
+	upstreamStateEncoder oidc.Encoder,
+	cookieCodec oidc.Codec,
+) error {
+	authRequestState, err := handleBrowserFlowAuthRequest(
+		r,
+		w,
+		oauthHelper,
+		generateCSRF,
+		generateNonce,
+		generatePKCE,
+		samlUpstream.GetName(),
+		psession.ProviderTypeSAML,
+		cookieCodec,
+		upstreamStateEncoder,
+	)
+	if err != nil {
+		return err
+	}
+	if authRequestState == nil {
+		// There was an error but handleBrowserFlowAuthRequest() already took care of writing the response for it.
+		return nil
+	}
+
+	// The nonce is random and short enough to be used as the RelayState, which the upstream IDP will send back
+	// along with its response. The state param itself is too long, so it is kept in a cookie named after the RelayState.
+	relayState := string(authRequestState.nonce)
+	redirectURL, err := samlUpstream.AuthnRequestURL(
+		oidc.SAMLServiceProviderForIssuer(downstreamIssuer),
+		oidc.SAMLRequestID(authRequestState.nonce),
+		relayState,
+	)
+	if err != nil {
+		plog.Error("error creating SAML authentication request", err, "upstreamName", samlUpstream.GetName())
+		return httperr.Wrap(http.StatusInternalServerError, "error creating SAML authentication request", err)
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidc.SAMLRequestCookieNamePrefix + relayState,
+		Value:    authRequestState.encodedStateParam,
+		HttpOnly: true,
+		// The upstream IDP will post its response from its own site, so this cookie must be sent cross-site.
+		SameSite: http.SameSiteNoneMode,
+		Secure:   true,
+		Path:     "/",
+		MaxAge:   int(oidc.SAMLRequestCookieLifespan.Seconds()),
+	})
+
+	http.Redirect(w, r,
+		redirectURL.String(),
+		http.StatusSeeOther, // match fosite and https://tools.ietf.org/id/draft-ietf-oauth-security-topics-18.html#section-4.11
+	)
+
+	return nil
+}
+
+func handleAuthRequestForGitHubUpstreamBrowserFlow(
+	r *http.Request,
+	w http.ResponseWriter,
+	oauthHelper fosite.OAuth2Provider,
+	generateCSRF func() (csrftoken.CSRFToken, error),
+	generateNonce func() (nonce.Nonce, error),
+	generatePKCE func() (pkce.Code, error),
+	gitHubUpstream provider.UpstreamGitHubIdentityProviderI,
+	downstreamIssuer string,
+	upstreamStateEncoder oidc.Encoder,
+	cookieCodec oidc.Codec,
+) error {
+	authRequestState, err := handleBrowserFlowAuthRequest(
+		r,
+		w,
+		oauthHelper,
+		generateCSRF,
+		generateNonce,
+		generatePKCE,
+		gitHubUpstream.GetName(),
+		psession.ProviderTypeGitHub,
+		cookieCodec,
+		upstreamStateEncoder,
+	)
+	if err != nil {
+		return err
+	}
+	if authRequestState == nil {
+		// There was an error but handleBrowserFlowAuthRequest() already took care of writing the response for it.
+		return nil
+	}
+
+	// GitHub is not an OIDC provider, so there is no nonce. The state param protects against CSRF.
+	upstreamOAuthConfig := oauth2.Config{
+		ClientID: gitHubUpstream.GetClientID(),
+		Endpoint: oauth2.Endpoint{
+			AuthURL: gitHubUpstream.GetAuthorizationURL(),
+		},
+		RedirectURL: fmt.Sprintf("%s/callback", downstreamIssuer),
+		Scopes:      gitHubUpstream.GetScopes(),
+	}
+
+	http.Redirect(w, r,
+		upstreamOAuthConfig.AuthCodeURL(authRequestState.encodedStateParam),
+		http.StatusSeeOther, // match fosite and https://tools.ietf.org/id/draft-ietf-oauth-security-topics-18.html#section-4.11
+	)
+
+	return nil
+}
+
 func requireStaticClientForUsernameAndPasswordHeaders(r *http.Request, w http.ResponseWriter, oauthHelper fosite.OAuth2Provider, authorizeRequester fosite.AuthorizeRequester) bool {
 	isStaticClient := authorizeRequester.GetClient().GetID() == oidcapi.ClientIDPinnipedCLI
 	if !isStaticClient {
@@ -380,19 +652,39 @@ func readCSRFCookie(r *http.Request, codec oidc.Decoder) csrftoken.CSRFToken {
 	return csrfFromCookie
 }
 
-// chooseUpstreamIDP selects either an OIDC, an LDAP, or an AD IDP, or returns an error.
+// chooseUpstreamIDP selects either an OIDC, an LDAP, an AD, a SAML, or a GitHub IDP, or returns an error.
+// When the client requested an IDP by name (and optionally by type), then that IDP is chosen.
+// Otherwise, when there is exactly one IDP available, then it is chosen for backwards compatibility
+// with clients which do not send the params for choosing an IDP.
 // Note that AD and LDAP IDPs both return the same interface type, but different ProviderTypes values.
-func chooseUpstreamIDP(idpLister oidc.UpstreamIdentityProvidersLister) (provider.UpstreamOIDCIdentityProviderI, provider.UpstreamLDAPIdentityProviderI, psession.ProviderType, error) {
+func chooseUpstreamIDP(
+	requestedIDPName string,
+	requestedIDPType string,
+	idpLister oidc.UpstreamIdentityProvidersLister,
+) (
+	provider.UpstreamOIDCIdentityProviderI,
+	provider.UpstreamLDAPIdentityProviderI,
+	provider.UpstreamSAMLIdentityProviderI,
+	provider.UpstreamGitHubIdentityProviderI,
+	psession.ProviderType,
+	error,
+) {
+	if requestedIDPName != "" {
+		return findRequestedUpstreamIDP(requestedIDPName, requestedIDPType, idpLister)
+	}
+
 	oidcUpstreams := idpLister.GetOIDCIdentityProviders()
 	ldapUpstreams := idpLister.GetLDAPIdentityProviders()
 	adUpstreams := idpLister.GetActiveDirectoryIdentityProviders()
+	samlUpstreams := idpLister.GetSAMLIdentityProviders()
+	gitHubUpstreams := idpLister.GetGitHubIdentityProviders()
 	switch {
-	case len(oidcUpstreams)+len(ldapUpstreams)+len(adUpstreams) == 0:
-		return nil, nil, "", httperr.New(
+	case len(oidcUpstreams)+len(ldapUpstreams)+len(adUpstreams)+len(samlUpstreams)+len(gitHubUpstreams) == 0:
+		return nil, nil, nil, nil, "", httperr.New(
 			http.StatusUnprocessableEntity,
 			"No upstream providers are configured",
 		)
-	case len(oidcUpstreams)+len(ldapUpstreams)+len(adUpstreams) > 1:
+	case len(oidcUpstreams)+len(ldapUpstreams)+len(adUpstreams)+len(samlUpstreams)+len(gitHubUpstreams) > 1:
 		var upstreamIDPNames []string
 		for _, idp := range oidcUpstreams {
 			upstreamIDPNames = append(upstreamIDPNames, idp.GetName())
@@ -403,17 +695,87 @@ func chooseUpstreamIDP(idpLister oidc.UpstreamIdentityProvidersLister) (provider
 		for _, idp := range adUpstreams {
 			upstreamIDPNames = append(upstreamIDPNames, idp.GetName())
 		}
-		plog.Warning("Too many upstream providers are configured (found: %s)", upstreamIDPNames)
-		return nil, nil, "", httperr.New(
+		for _, idp := range samlUpstreams {
+			upstreamIDPNames = append(upstreamIDPNames, idp.GetName())
+		}
+		for _, idp := range gitHubUpstreams {
+			upstreamIDPNames = append(upstreamIDPNames, idp.GetName())
+		}
+		plog.Warning("Too many upstream providers are configured to choose one without the pinniped_idp_name param", "found", upstreamIDPNames)
+		return nil, nil, nil, nil, "", httperr.Newf(
 			http.StatusUnprocessableEntity,
-			"Too many upstream providers are configured (support for multiple upstreams is not yet implemented)",
+			"Too many upstream providers are configured (use the %s param to choose one)",
+			oidcapi.AuthorizeUpstreamIDPNameParamName,
 		)
 	case len(oidcUpstreams) == 1:
-		return oidcUpstreams[0], nil, psession.ProviderTypeOIDC, nil
+		return oidcUpstreams[0], nil, nil, nil, psession.ProviderTypeOIDC, nil
 	case len(adUpstreams) == 1:
-		return nil, adUpstreams[0], psession.ProviderTypeActiveDirectory, nil
+		return nil, adUpstreams[0], nil, nil, psession.ProviderTypeActiveDirectory, nil
+	case len(samlUpstreams) == 1:
+		return nil, nil, samlUpstreams[0], nil, psession.ProviderTypeSAML, nil
+	case len(gitHubUpstreams) == 1:
+		return nil, nil, nil, gitHubUpstreams[0], psession.ProviderTypeGitHub, nil
+	default:
+		return nil, ldapUpstreams[0], nil, nil, psession.ProviderTypeLDAP, nil
+	}
+}
+
+// findRequestedUpstreamIDP finds the IDP that was requested by name, and by type when the type was also requested.
+// When the type was not requested, then the name must be unique across all types of IDPs.
+func findRequestedUpstreamIDP(
+	requestedIDPName string,
+	requestedIDPType string,
+	idpLister oidc.UpstreamIdentityProvidersLister,
+) (
+	provider.UpstreamOIDCIdentityProviderI,
+	provider.UpstreamLDAPIdentityProviderI,
+	provider.UpstreamSAMLIdentityProviderI,
+	provider.UpstreamGitHubIdentityProviderI,
+	psession.ProviderType,
+	error,
+) {
+	if requestedIDPType != "" {
+		oidcUpstream, ldapUpstream, samlUpstream, gitHubUpstream, idpType, err := oidc.FindUpstreamIDPByNameAndType(idpLister, requestedIDPName, requestedIDPType)
+		if err != nil {
+			return nil, nil, nil, nil, "", httperr.Newf(http.StatusUnprocessableEntity,
+				"Requested upstream provider not found (name %q, type %q)", requestedIDPName, requestedIDPType)
+		}
+		return oidcUpstream, ldapUpstream, samlUpstream, gitHubUpstream, idpType, nil
+	}
+
+	var (
+		foundOIDCUpstream   provider.UpstreamOIDCIdentityProviderI
+		foundLDAPUpstream   provider.UpstreamLDAPIdentityProviderI
+		foundSAMLUpstream   provider.UpstreamSAMLIdentityProviderI
+		foundGitHubUpstream provider.UpstreamGitHubIdentityProviderI
+		foundIDPType        psession.ProviderType
+		foundCount          int
+	)
+	for _, idpType := range []idpdiscoveryv1alpha1.IDPType{
+		idpdiscoveryv1alpha1.IDPTypeOIDC,
+		idpdiscoveryv1alpha1.IDPTypeLDAP,
+		idpdiscoveryv1alpha1.IDPTypeActiveDirectory,
+		idpdiscoveryv1alpha1.IDPTypeSAML,
+		idpdiscoveryv1alpha1.IDPTypeGitHub,
+	} {
+		oidcUpstream, ldapUpstream, samlUpstream, gitHubUpstream, providerType, err := oidc.FindUpstreamIDPByNameAndType(idpLister, requestedIDPName, idpType.String())
+		if err == nil {
+			foundOIDCUpstream, foundLDAPUpstream, foundSAMLUpstream, foundGitHubUpstream, foundIDPType =
+				oidcUpstream, ldapUpstream, samlUpstream, gitHubUpstream, providerType
+			foundCount++
+		}
+	}
+
+	switch foundCount {
+	case 0:
+		return nil, nil, nil, nil, "", httperr.Newf(http.StatusUnprocessableEntity,
+			"Requested upstream provider not found (name %q)", requestedIDPName)
+	case 1:
+		return foundOIDCUpstream, foundLDAPUpstream, foundSAMLUpstream, foundGitHubUpstream, foundIDPType, nil
 	default:
-		return nil, ldapUpstreams[0], psession.ProviderTypeLDAP, nil
+		return nil, nil, nil, nil, "", httperr.Newf(http.StatusUnprocessableEntity,
+			"Multiple upstream providers are named %q (use the %s param to choose one)",
+			requestedIDPName, oidcapi.AuthorizeUpstreamIDPTypeParamName)
 	}
 }
 
@@ -424,7 +786,7 @@ type browserFlowAuthRequestState struct {
 }
 
 // handleBrowserFlowAuthRequest performs the shared validations and setup between browser based
-// auth requests regardless of IDP type-- LDAP, Active Directory and OIDC.
+// auth requests regardless of IDP type-- LDAP, Active Directory, OIDC, SAML and GitHub.
 // It generates the state param, sets the CSRF cookie, and validates the prompt param.
 // It returns an error when it encounters an error without handling it, leaving it to
 // the caller to decide how to handle it.
@@ -552,6 +914,7 @@ func upstreamStateParam(
 		CSRFToken:     csrfValue,
 		PKCECode:      pkceValue,
 		FormatVersion: oidc.UpstreamStateParamFormatVersion,
+		CorrelationID: authorizeRequester.GetID(),
 	}
 	encodedStateParamValue, err := encoder.Encode(oidc.UpstreamStateParamEncodingName, stateParamData)
 	if err != nil {
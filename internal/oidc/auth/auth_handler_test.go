@@ -1,4 +1,4 @@
-// Copyright 2020-2023 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package auth
@@ -29,13 +29,16 @@ import (
 
 	supervisorfake "go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned/fake"
 	"go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned/typed/config/v1alpha1"
+	"go.pinniped.dev/internal/auditlog"
 	"go.pinniped.dev/internal/authenticators"
+	"go.pinniped.dev/internal/celtransformer"
 	"go.pinniped.dev/internal/here"
 	"go.pinniped.dev/internal/oidc"
 	"go.pinniped.dev/internal/oidc/csrftoken"
 	"go.pinniped.dev/internal/oidc/jwks"
 	"go.pinniped.dev/internal/oidc/oidcclientvalidator"
 	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/oidc/provider/branding"
 	"go.pinniped.dev/internal/psession"
 	"go.pinniped.dev/internal/testutil"
 	"go.pinniped.dev/internal/testutil/oidctestutil"
@@ -64,8 +67,15 @@ func TestAuthorizationEndpoint(t *testing.T) {
 		oidcPasswordGrantUpstreamRefreshToken = "some-opaque-token" //nolint:gosec
 		oidcUpstreamAccessToken               = "some-access-token"
 
+		samlUpstreamName        = "some-saml-idp"
+		samlUpstreamResourceUID = "saml-resource-uid"
+
+		githubUpstreamName        = "some-github-idp"
+		githubUpstreamResourceUID = "github-resource-uid"
+
 		downstreamIssuer                       = "https://my-downstream-issuer.com/some-path"
 		downstreamRedirectURI                  = "http://127.0.0.1/callback"
+		downstreamPrivateUseSchemeRedirectURI  = "com.example.app:/callback"
 		downstreamRedirectURIWithDifferentPort = "http://127.0.0.1:42/callback"
 		downstreamNonce                        = "some-nonce-value"
 		downstreamPKCEChallenge                = "some-challenge"
@@ -178,12 +188,30 @@ func TestAuthorizationEndpoint(t *testing.T) {
 			"state":             happyState,
 		}
 
+		fositeAccessDeniedWithConfiguredPolicyRejectionHintErrorQuery = map[string]string{
+			"error":             "access_denied",
+			"error_description": "The resource owner or authorization server denied the request. Reason: configured identity policy rejected this authentication: only admins may log in.",
+			"state":             happyState,
+		}
+
 		fositeAccessDeniedWithPasswordGrantDisallowedHintErrorQuery = map[string]string{
 			"error":             "access_denied",
 			"error_description": "The resource owner or authorization server denied the request. Resource owner password credentials grant is not allowed for this upstream provider according to its configuration.",
 			"state":             happyState,
 		}
 
+		fositeAccessDeniedWithSAMLUsernamePasswordHeadersHintErrorQuery = map[string]string{
+			"error":             "access_denied",
+			"error_description": "The resource owner or authorization server denied the request. Username and password headers are not supported for SAML upstream providers, which only support browser-based logins.",
+			"state":             happyState,
+		}
+
+		fositeAccessDeniedWithGitHubUsernamePasswordHeadersHintErrorQuery = map[string]string{
+			"error":             "access_denied",
+			"error_description": "The resource owner or authorization server denied the request. Username and password headers are not supported for GitHub upstream providers, which only support browser-based logins.",
+			"state":             happyState,
+		}
+
 		fositeAccessDeniedWithUsernamePasswordHeadersDisallowedHintErrorQuery = map[string]string{
 			"error":             "access_denied",
 			"error_description": "The resource owner or authorization server denied the request. This client is not allowed to submit username or password headers to this endpoint.",
@@ -236,15 +264,15 @@ func TestAuthorizationEndpoint(t *testing.T) {
 		// Configure fosite the same way that the production code would when using Kube storage.
 		// Inject this into our test subject at the last second so we get a fresh storage for every test.
 		// Use lower minimum required bcrypt cost than we would use in production to keep unit the tests fast.
-		kubeOauthStore := oidc.NewKubeStorage(secretsClient, oidcClientsClient, timeoutsConfiguration, bcrypt.MinCost)
-		return oidc.FositeOauth2Helper(kubeOauthStore, downstreamIssuer, hmacSecretFunc, jwksProviderIsUnused, timeoutsConfiguration), kubeOauthStore
+		kubeOauthStore := oidc.NewKubeStorage(secretsClient, oidcClientsClient, downstreamIssuer, timeoutsConfiguration, bcrypt.MinCost)
+		return oidc.FositeOauth2Helper(kubeOauthStore, downstreamIssuer, hmacSecretFunc, nil, jwksProviderIsUnused, timeoutsConfiguration, nil), kubeOauthStore
 	}
 
 	createOauthHelperWithNullStorage := func(secretsClient v1.SecretInterface, oidcClientsClient v1alpha1.OIDCClientInterface) (fosite.OAuth2Provider, *oidc.NullStorage) {
 		// Configure fosite the same way that the production code would, using NullStorage to turn off storage.
 		// Use lower minimum required bcrypt cost than we would use in production to keep unit the tests fast.
 		nullOauthStore := oidc.NewNullStorage(secretsClient, oidcClientsClient, bcrypt.MinCost)
-		return oidc.FositeOauth2Helper(nullOauthStore, downstreamIssuer, hmacSecretFunc, jwksProviderIsUnused, timeoutsConfiguration), nullOauthStore
+		return oidc.FositeOauth2Helper(nullOauthStore, downstreamIssuer, hmacSecretFunc, nil, jwksProviderIsUnused, timeoutsConfiguration, nil), nullOauthStore
 	}
 
 	upstreamAuthURL, err := url.Parse("https://some-upstream-idp:8443/auth")
@@ -337,6 +365,21 @@ func TestAuthorizationEndpoint(t *testing.T) {
 		AuthenticateFunc: ldapAuthenticateFunc,
 	}
 
+	upstreamSAMLIdentityProvider := oidctestutil.TestUpstreamSAMLIdentityProvider{
+		Name:        samlUpstreamName,
+		ResourceUID: samlUpstreamResourceUID,
+		EntityID:    "https://saml-idp.example.com/metadata",
+		SSOURL:      &url.URL{Scheme: "https", Host: "saml-idp.example.com", Path: "/sso", RawQuery: "existing=param"},
+	}
+
+	upstreamGitHubIdentityProvider := oidctestutil.TestUpstreamGitHubIdentityProvider{
+		Name:             githubUpstreamName,
+		ResourceUID:      githubUpstreamResourceUID,
+		ClientID:         "some-github-client-id",
+		AuthorizationURL: "https://github.example.com/login/oauth/authorize",
+		Scopes:           []string{"read:user", "read:org"},
+	}
+
 	erroringUpstreamLDAPIdentityProvider := oidctestutil.TestUpstreamLDAPIdentityProvider{
 		Name:        ldapUpstreamName,
 		ResourceUID: ldapUpstreamResourceUID,
@@ -466,12 +509,14 @@ func TestAuthorizationEndpoint(t *testing.T) {
 	}
 
 	expectedHappyActiveDirectoryUpstreamCustomSession := &psession.CustomSessionData{
-		Username:     happyLDAPUsernameFromAuthenticator,
-		ProviderUID:  activeDirectoryUpstreamResourceUID,
-		ProviderName: activeDirectoryUpstreamName,
-		ProviderType: psession.ProviderTypeActiveDirectory,
-		OIDC:         nil,
-		LDAP:         nil,
+		Username:         happyLDAPUsernameFromAuthenticator,
+		UpstreamUsername: happyLDAPUsernameFromAuthenticator,
+		UpstreamGroups:   happyLDAPGroups,
+		ProviderUID:      activeDirectoryUpstreamResourceUID,
+		ProviderName:     activeDirectoryUpstreamName,
+		ProviderType:     psession.ProviderTypeActiveDirectory,
+		OIDC:             nil,
+		LDAP:             nil,
 		ActiveDirectory: &psession.ActiveDirectorySessionData{
 			UserDN:                 happyLDAPUserDN,
 			ExtraRefreshAttributes: map[string]string{happyLDAPExtraRefreshAttribute: happyLDAPExtraRefreshValue},
@@ -479,11 +524,13 @@ func TestAuthorizationEndpoint(t *testing.T) {
 	}
 
 	expectedHappyLDAPUpstreamCustomSession := &psession.CustomSessionData{
-		Username:     happyLDAPUsernameFromAuthenticator,
-		ProviderUID:  ldapUpstreamResourceUID,
-		ProviderName: ldapUpstreamName,
-		ProviderType: psession.ProviderTypeLDAP,
-		OIDC:         nil,
+		Username:         happyLDAPUsernameFromAuthenticator,
+		UpstreamUsername: happyLDAPUsernameFromAuthenticator,
+		UpstreamGroups:   happyLDAPGroups,
+		ProviderUID:      ldapUpstreamResourceUID,
+		ProviderName:     ldapUpstreamName,
+		ProviderType:     psession.ProviderTypeLDAP,
+		OIDC:             nil,
 		LDAP: &psession.LDAPSessionData{
 			UserDN:                 happyLDAPUserDN,
 			ExtraRefreshAttributes: map[string]string{happyLDAPExtraRefreshAttribute: happyLDAPExtraRefreshValue},
@@ -492,10 +539,12 @@ func TestAuthorizationEndpoint(t *testing.T) {
 	}
 
 	expectedHappyOIDCPasswordGrantCustomSession := &psession.CustomSessionData{
-		Username:     oidcUpstreamUsername,
-		ProviderUID:  oidcPasswordGrantUpstreamResourceUID,
-		ProviderName: oidcPasswordGrantUpstreamName,
-		ProviderType: psession.ProviderTypeOIDC,
+		Username:         oidcUpstreamUsername,
+		UpstreamUsername: oidcUpstreamUsername,
+		UpstreamGroups:   oidcUpstreamGroupMembership,
+		ProviderUID:      oidcPasswordGrantUpstreamResourceUID,
+		ProviderName:     oidcPasswordGrantUpstreamName,
+		ProviderType:     psession.ProviderTypeOIDC,
 		OIDC: &psession.OIDCSessionData{
 			UpstreamRefreshToken: oidcPasswordGrantUpstreamRefreshToken,
 			UpstreamSubject:      oidcUpstreamSubject,
@@ -508,14 +557,39 @@ func TestAuthorizationEndpoint(t *testing.T) {
 		copyOfOIDC := *(expectedHappyOIDCPasswordGrantCustomSession.OIDC)
 		copyOfCustomSession.OIDC = &copyOfOIDC
 		copyOfCustomSession.Username = wantUsername
+		copyOfCustomSession.UpstreamUsername = wantUsername
 		return &copyOfCustomSession
 	}
 
+	expectedHappyOIDCPasswordGrantCustomSessionWithTransformedUsername := func(wantDownstreamUsername string) *psession.CustomSessionData {
+		copyOfCustomSession := *expectedHappyOIDCPasswordGrantCustomSession
+		copyOfOIDC := *(expectedHappyOIDCPasswordGrantCustomSession.OIDC)
+		copyOfCustomSession.OIDC = &copyOfOIDC
+		copyOfCustomSession.Username = wantDownstreamUsername
+		return &copyOfCustomSession
+	}
+
+	expectedHappyLDAPUpstreamCustomSessionWithUsername := func(wantDownstreamUsername string) *psession.CustomSessionData {
+		copyOfCustomSession := *expectedHappyLDAPUpstreamCustomSession
+		copyOfLDAP := *(expectedHappyLDAPUpstreamCustomSession.LDAP)
+		copyOfCustomSession.LDAP = &copyOfLDAP
+		copyOfCustomSession.Username = wantDownstreamUsername
+		return &copyOfCustomSession
+	}
+
+	expectedHappyOIDCPasswordGrantCustomSessionWithUsernameAndGroups := func(wantUsername string, wantGroups []string) *psession.CustomSessionData {
+		copyOfCustomSession := expectedHappyOIDCPasswordGrantCustomSessionWithUsername(wantUsername)
+		copyOfCustomSession.UpstreamGroups = wantGroups
+		return copyOfCustomSession
+	}
+
 	expectedHappyOIDCPasswordGrantCustomSessionWithAccessToken := &psession.CustomSessionData{
-		Username:     oidcUpstreamUsername,
-		ProviderUID:  oidcPasswordGrantUpstreamResourceUID,
-		ProviderName: oidcPasswordGrantUpstreamName,
-		ProviderType: psession.ProviderTypeOIDC,
+		Username:         oidcUpstreamUsername,
+		UpstreamUsername: oidcUpstreamUsername,
+		UpstreamGroups:   oidcUpstreamGroupMembership,
+		ProviderUID:      oidcPasswordGrantUpstreamResourceUID,
+		ProviderName:     oidcPasswordGrantUpstreamName,
+		ProviderType:     psession.ProviderTypeOIDC,
 		OIDC: &psession.OIDCSessionData{
 			UpstreamAccessToken: oidcUpstreamAccessToken,
 			UpstreamSubject:     oidcUpstreamSubject,
@@ -523,6 +597,23 @@ func TestAuthorizationEndpoint(t *testing.T) {
 		},
 	}
 
+	const (
+		transformationUsernamePrefix = "username_prefix:"
+		transformationGroupsPrefix   = "groups_prefix:"
+	)
+
+	prefixUsernameAndGroupsPipeline := oidctestutil.NewTransformationPipeline(t, nil,
+		&celtransformer.UsernameTransformation{Expression: fmt.Sprintf(`"%s" + username`, transformationUsernamePrefix)},
+		&celtransformer.GroupsTransformation{Expression: fmt.Sprintf(`groups.map(g, "%s" + g)`, transformationGroupsPrefix)},
+	)
+
+	rejectAuthPipeline := oidctestutil.NewTransformationPipeline(t, nil,
+		&celtransformer.AllowAuthenticationPolicy{
+			Expression:                    `"admins" in groups`,
+			RejectedAuthenticationMessage: "only admins may log in",
+		},
+	)
+
 	addFullyCapableDynamicClientAndSecretToKubeResources := func(t *testing.T, supervisorClient *supervisorfake.Clientset, kubeClient *fake.Clientset) {
 		oidcClient, secret := testutil.FullyCapableOIDCClientAndStorageSecret(t,
 			"some-namespace", dynamicClientID, dynamicClientUID, downstreamRedirectURI,
@@ -531,6 +622,16 @@ func TestAuthorizationEndpoint(t *testing.T) {
 		require.NoError(t, kubeClient.Tracker().Add(secret))
 	}
 
+	addPublicDynamicClientWithPrivateUseSchemeRedirectURIToKubeResources := func(t *testing.T, supervisorClient *supervisorfake.Clientset, kubeClient *fake.Clientset) {
+		oidcClient, _ := testutil.FullyCapableOIDCClientAndStorageSecret(t,
+			"some-namespace", dynamicClientID, dynamicClientUID, downstreamRedirectURI,
+			[]string{testutil.HashedPassword1AtGoMinCost}, oidcclientvalidator.Validate)
+		// Public clients have no client secret storage Secret.
+		oidcClient.Spec.Public = true
+		oidcClient.Spec.AllowedRedirectURIs[0] = downstreamPrivateUseSchemeRedirectURI
+		require.NoError(t, supervisorClient.Tracker().Add(oidcClient))
+	}
+
 	// Note that fosite puts the granted scopes as a param in the redirect URI even though the spec doesn't seem to require it
 	happyAuthcodeDownstreamRedirectLocationRegexp := downstreamRedirectURI + `\?code=([^&]+)&scope=openid\+username\+groups&state=` + happyState
 
@@ -655,6 +756,29 @@ func TestAuthorizationEndpoint(t *testing.T) {
 			wantUpstreamStateParamInLocationHeader: true,
 			wantBodyStringWithLocationInHref:       true,
 		},
+		{
+			name:                        "GitHub upstream browser flow happy path using GET without a CSRF cookie",
+			idps:                        oidctestutil.NewUpstreamIDPListerBuilder().WithGitHub(&upstreamGitHubIdentityProvider),
+			generateCSRF:                happyCSRFGenerator,
+			generatePKCE:                happyPKCEGenerator,
+			generateNonce:               happyNonceGenerator,
+			stateEncoder:                happyStateEncoder,
+			cookieEncoder:               happyCookieEncoder,
+			method:                      http.MethodGet,
+			path:                        happyGetRequestPath,
+			wantStatus:                  http.StatusSeeOther,
+			wantContentType:             htmlContentType,
+			wantCSRFValueInCookieHeader: happyCSRF,
+			wantLocationHeader: urlWithQuery("https://github.example.com/login/oauth/authorize", map[string]string{
+				"response_type": "code",
+				"client_id":     "some-github-client-id",
+				"redirect_uri":  downstreamIssuer + "/callback",
+				"scope":         "read:user read:org",
+				"state":         expectedUpstreamStateParam(nil, "", githubUpstreamName, "github"),
+			}),
+			wantUpstreamStateParamInLocationHeader: true,
+			wantBodyStringWithLocationInHref:       true,
+		},
 		{
 			name:                                   "Active Directory upstream browser flow happy path using GET without a CSRF cookie",
 			idps:                                   oidctestutil.NewUpstreamIDPListerBuilder().WithActiveDirectory(&upstreamActiveDirectoryIdentityProvider),
@@ -712,6 +836,43 @@ func TestAuthorizationEndpoint(t *testing.T) {
 			wantDownstreamPKCEChallengeMethod: downstreamPKCEChallengeMethod,
 			wantDownstreamCustomSessionData:   expectedHappyOIDCPasswordGrantCustomSession,
 		},
+		{
+			name: "OIDC upstream password grant happy path using GET with identity transformations",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(passwordGrantUpstreamOIDCIdentityProviderBuilder().Build()).
+				WithIdentityTransformations(oidcPasswordGrantUpstreamName, psession.ProviderTypeOIDC, prefixUsernameAndGroupsPipeline),
+			method:                            http.MethodGet,
+			path:                              happyGetRequestPath,
+			customUsernameHeader:              pointer.String(oidcUpstreamUsername),
+			customPasswordHeader:              pointer.String(oidcUpstreamPassword),
+			wantPasswordGrantCall:             happyUpstreamPasswordGrantMockExpectation,
+			wantStatus:                        http.StatusFound,
+			wantContentType:                   htmlContentType,
+			wantRedirectLocationRegexp:        happyAuthcodeDownstreamRedirectLocationRegexp,
+			wantDownstreamIDTokenSubject:      oidcUpstreamIssuer + "?sub=" + oidcUpstreamSubjectQueryEscaped,
+			wantDownstreamIDTokenUsername:     transformationUsernamePrefix + oidcUpstreamUsername,
+			wantDownstreamIDTokenGroups:       testutil.AddPrefixToEach(transformationGroupsPrefix, oidcUpstreamGroupMembership),
+			wantDownstreamRequestedScopes:     happyDownstreamScopesRequested,
+			wantDownstreamRedirectURI:         downstreamRedirectURI,
+			wantDownstreamGrantedScopes:       happyDownstreamScopesGranted,
+			wantDownstreamNonce:               downstreamNonce,
+			wantDownstreamPKCEChallenge:       downstreamPKCEChallenge,
+			wantDownstreamPKCEChallengeMethod: downstreamPKCEChallengeMethod,
+			wantDownstreamCustomSessionData:   expectedHappyOIDCPasswordGrantCustomSessionWithTransformedUsername(transformationUsernamePrefix + oidcUpstreamUsername),
+		},
+		{
+			name: "OIDC upstream password grant when an identity policy rejects the authentication",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(passwordGrantUpstreamOIDCIdentityProviderBuilder().Build()).
+				WithIdentityTransformations(oidcPasswordGrantUpstreamName, psession.ProviderTypeOIDC, rejectAuthPipeline),
+			method:                http.MethodGet,
+			path:                  happyGetRequestPath,
+			customUsernameHeader:  pointer.String(oidcUpstreamUsername),
+			customPasswordHeader:  pointer.String(oidcUpstreamPassword),
+			wantPasswordGrantCall: happyUpstreamPasswordGrantMockExpectation,
+			wantStatus:            http.StatusFound,
+			wantContentType:       jsonContentType,
+			wantLocationHeader:    urlWithQuery(downstreamRedirectURI, fositeAccessDeniedWithConfiguredPolicyRejectionHintErrorQuery),
+			wantBodyString:        "",
+		},
 		{
 			name: "OIDC upstream password grant happy path using GET with additional claim mappings",
 			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(passwordGrantUpstreamOIDCIdentityProviderBuilder().
@@ -795,6 +956,41 @@ func TestAuthorizationEndpoint(t *testing.T) {
 			wantDownstreamPKCEChallengeMethod: downstreamPKCEChallengeMethod,
 			wantDownstreamCustomSessionData:   expectedHappyLDAPUpstreamCustomSession,
 		},
+		{
+			name: "LDAP cli upstream happy path using GET with identity transformations",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithLDAP(&upstreamLDAPIdentityProvider).
+				WithIdentityTransformations(ldapUpstreamName, psession.ProviderTypeLDAP, prefixUsernameAndGroupsPipeline),
+			method:                            http.MethodGet,
+			path:                              happyGetRequestPath,
+			customUsernameHeader:              pointer.String(happyLDAPUsername),
+			customPasswordHeader:              pointer.String(happyLDAPPassword),
+			wantStatus:                        http.StatusFound,
+			wantContentType:                   htmlContentType,
+			wantRedirectLocationRegexp:        happyAuthcodeDownstreamRedirectLocationRegexp,
+			wantDownstreamIDTokenSubject:      upstreamLDAPURL + "&sub=" + happyLDAPUID,
+			wantDownstreamIDTokenUsername:     transformationUsernamePrefix + happyLDAPUsernameFromAuthenticator,
+			wantDownstreamIDTokenGroups:       testutil.AddPrefixToEach(transformationGroupsPrefix, happyLDAPGroups),
+			wantDownstreamRequestedScopes:     happyDownstreamScopesRequested,
+			wantDownstreamRedirectURI:         downstreamRedirectURI,
+			wantDownstreamGrantedScopes:       happyDownstreamScopesGranted,
+			wantDownstreamNonce:               downstreamNonce,
+			wantDownstreamPKCEChallenge:       downstreamPKCEChallenge,
+			wantDownstreamPKCEChallengeMethod: downstreamPKCEChallengeMethod,
+			wantDownstreamCustomSessionData:   expectedHappyLDAPUpstreamCustomSessionWithUsername(transformationUsernamePrefix + happyLDAPUsernameFromAuthenticator),
+		},
+		{
+			name: "LDAP cli upstream when an identity policy rejects the authentication",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithLDAP(&upstreamLDAPIdentityProvider).
+				WithIdentityTransformations(ldapUpstreamName, psession.ProviderTypeLDAP, rejectAuthPipeline),
+			method:               http.MethodGet,
+			path:                 happyGetRequestPath,
+			customUsernameHeader: pointer.String(happyLDAPUsername),
+			customPasswordHeader: pointer.String(happyLDAPPassword),
+			wantStatus:           http.StatusFound,
+			wantContentType:      jsonContentType,
+			wantLocationHeader:   urlWithQuery(downstreamRedirectURI, fositeAccessDeniedWithConfiguredPolicyRejectionHintErrorQuery),
+			wantBodyString:       "",
+		},
 		{
 			name:                              "ActiveDirectory cli upstream happy path using GET",
 			idps:                              oidctestutil.NewUpstreamIDPListerBuilder().WithActiveDirectory(&upstreamActiveDirectoryIdentityProvider),
@@ -1080,7 +1276,7 @@ func TestAuthorizationEndpoint(t *testing.T) {
 			stateEncoder:                           happyStateEncoder,
 			cookieEncoder:                          happyCookieEncoder,
 			method:                                 http.MethodGet,
-			path:                                   modifiedHappyGetRequestPath(map[string]string{"pinniped_idp_name": "currently-ignored", "pinniped_idp_type": "oidc"}),
+			path:                                   modifiedHappyGetRequestPath(map[string]string{"pinniped_idp_name": oidcUpstreamName, "pinniped_idp_type": "oidc"}),
 			contentType:                            formContentType,
 			wantStatus:                             http.StatusSeeOther,
 			wantContentType:                        htmlContentType,
@@ -1089,6 +1285,57 @@ func TestAuthorizationEndpoint(t *testing.T) {
 			wantLocationHeader:                     expectedRedirectLocationForUpstreamOIDC(expectedUpstreamStateParam(nil, "", oidcUpstreamName, "oidc"), nil),
 			wantUpstreamStateParamInLocationHeader: true,
 		},
+		{
+			name:                                   "OIDC upstream browser flow happy path when multiple upstreams are configured and the IDP name and type query params choose one",
+			idps:                                   oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(upstreamOIDCIdentityProviderBuilder().Build()).WithLDAP(&upstreamLDAPIdentityProvider).WithActiveDirectory(&upstreamActiveDirectoryIdentityProvider),
+			generateCSRF:                           happyCSRFGenerator,
+			generatePKCE:                           happyPKCEGenerator,
+			generateNonce:                          happyNonceGenerator,
+			stateEncoder:                           happyStateEncoder,
+			cookieEncoder:                          happyCookieEncoder,
+			method:                                 http.MethodGet,
+			path:                                   modifiedHappyGetRequestPath(map[string]string{"pinniped_idp_name": oidcUpstreamName, "pinniped_idp_type": "oidc"}),
+			wantStatus:                             http.StatusSeeOther,
+			wantContentType:                        htmlContentType,
+			wantBodyStringWithLocationInHref:       true,
+			wantCSRFValueInCookieHeader:            happyCSRF,
+			wantLocationHeader:                     expectedRedirectLocationForUpstreamOIDC(expectedUpstreamStateParam(nil, "", oidcUpstreamName, "oidc"), nil),
+			wantUpstreamStateParamInLocationHeader: true,
+		},
+		{
+			name:                                   "LDAP upstream browser flow happy path when multiple upstreams are configured and only the IDP name query param chooses one",
+			idps:                                   oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(upstreamOIDCIdentityProviderBuilder().Build()).WithLDAP(&upstreamLDAPIdentityProvider).WithActiveDirectory(&upstreamActiveDirectoryIdentityProvider),
+			generateCSRF:                           happyCSRFGenerator,
+			generatePKCE:                           happyPKCEGenerator,
+			generateNonce:                          happyNonceGenerator,
+			stateEncoder:                           happyStateEncoder,
+			cookieEncoder:                          happyCookieEncoder,
+			method:                                 http.MethodGet,
+			path:                                   modifiedHappyGetRequestPath(map[string]string{"pinniped_idp_name": ldapUpstreamName}),
+			wantStatus:                             http.StatusSeeOther,
+			wantContentType:                        htmlContentType,
+			wantBodyStringWithLocationInHref:       true,
+			wantCSRFValueInCookieHeader:            happyCSRF,
+			wantLocationHeader:                     urlWithQuery(downstreamIssuer+"/login", map[string]string{"state": expectedUpstreamStateParam(nil, "", ldapUpstreamName, "ldap")}),
+			wantUpstreamStateParamInLocationHeader: true,
+		},
+		{
+			name:                                   "Active Directory upstream browser flow happy path when multiple upstreams are configured and the IDP name and type query params choose one",
+			idps:                                   oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(upstreamOIDCIdentityProviderBuilder().Build()).WithLDAP(&upstreamLDAPIdentityProvider).WithActiveDirectory(&upstreamActiveDirectoryIdentityProvider),
+			generateCSRF:                           happyCSRFGenerator,
+			generatePKCE:                           happyPKCEGenerator,
+			generateNonce:                          happyNonceGenerator,
+			stateEncoder:                           happyStateEncoder,
+			cookieEncoder:                          happyCookieEncoder,
+			method:                                 http.MethodGet,
+			path:                                   modifiedHappyGetRequestPath(map[string]string{"pinniped_idp_name": activeDirectoryUpstreamName, "pinniped_idp_type": "activedirectory"}),
+			wantStatus:                             http.StatusSeeOther,
+			wantContentType:                        htmlContentType,
+			wantBodyStringWithLocationInHref:       true,
+			wantCSRFValueInCookieHeader:            happyCSRF,
+			wantLocationHeader:                     urlWithQuery(downstreamIssuer+"/login", map[string]string{"state": expectedUpstreamStateParam(nil, "", activeDirectoryUpstreamName, "activedirectory")}),
+			wantUpstreamStateParamInLocationHeader: true,
+		},
 		{
 			name:                                   "OIDC upstream browser flow happy path with extra params that get passed through",
 			idps:                                   oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(upstreamOIDCIdentityProviderBuilder().WithAdditionalAuthcodeParams(map[string]string{"prompt": "consent", "abc": "123", "def": "456"}).Build()),
@@ -1187,6 +1434,32 @@ func TestAuthorizationEndpoint(t *testing.T) {
 			wantUpstreamStateParamInLocationHeader: true,
 			wantBodyStringWithLocationInHref:       true,
 		},
+		{
+			name:          "OIDC upstream browser flow happy path using a public dynamic client with a private-use URI scheme redirect uri",
+			idps:          oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(upstreamOIDCIdentityProviderBuilder().Build()),
+			kubeResources: addPublicDynamicClientWithPrivateUseSchemeRedirectURIToKubeResources,
+			generateCSRF:  happyCSRFGenerator,
+			generatePKCE:  happyPKCEGenerator,
+			generateNonce: happyNonceGenerator,
+			stateEncoder:  happyStateEncoder,
+			cookieEncoder: happyCookieEncoder,
+			method:        http.MethodGet,
+			path: modifiedHappyGetRequestPath(map[string]string{
+				"redirect_uri": downstreamPrivateUseSchemeRedirectURI,
+				"client_id":    dynamicClientID,
+				"scope":        testutil.AllDynamicClientScopesSpaceSep,
+			}),
+			wantStatus:                  http.StatusSeeOther,
+			wantContentType:             htmlContentType,
+			wantCSRFValueInCookieHeader: happyCSRF,
+			wantLocationHeader: expectedRedirectLocationForUpstreamOIDC(expectedUpstreamStateParam(map[string]string{
+				"redirect_uri": downstreamPrivateUseSchemeRedirectURI,
+				"client_id":    dynamicClientID,
+				"scope":        testutil.AllDynamicClientScopesSpaceSep,
+			}, "", oidcUpstreamName, "oidc"), nil),
+			wantUpstreamStateParamInLocationHeader: true,
+			wantBodyStringWithLocationInHref:       true,
+		},
 		{
 			name:   "OIDC upstream password grant happy path when downstream redirect uri matches what is configured for client except for the port number",
 			idps:   oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(passwordGrantUpstreamOIDCIdentityProviderBuilder().Build()),
@@ -1296,11 +1569,13 @@ func TestAuthorizationEndpoint(t *testing.T) {
 			wantDownstreamPKCEChallenge:       downstreamPKCEChallenge,
 			wantDownstreamPKCEChallengeMethod: downstreamPKCEChallengeMethod,
 			wantDownstreamCustomSessionData: &psession.CustomSessionData{
-				Username:     oidcUpstreamUsername,
-				ProviderUID:  oidcPasswordGrantUpstreamResourceUID,
-				ProviderName: oidcPasswordGrantUpstreamName,
-				ProviderType: psession.ProviderTypeOIDC,
-				Warnings:     []string{"Access token from identity provider has lifetime of less than 3 hours. Expect frequent prompts to log in."},
+				Username:         oidcUpstreamUsername,
+				UpstreamUsername: oidcUpstreamUsername,
+				UpstreamGroups:   oidcUpstreamGroupMembership,
+				ProviderUID:      oidcPasswordGrantUpstreamResourceUID,
+				ProviderName:     oidcPasswordGrantUpstreamName,
+				ProviderType:     psession.ProviderTypeOIDC,
+				Warnings:         []string{"Access token from identity provider has lifetime of less than 3 hours. Expect frequent prompts to log in."},
 				OIDC: &psession.OIDCSessionData{
 					UpstreamAccessToken: oidcUpstreamAccessToken,
 					UpstreamSubject:     oidcUpstreamSubject,
@@ -1585,6 +1860,30 @@ func TestAuthorizationEndpoint(t *testing.T) {
 			wantLocationHeader:   urlWithQuery(downstreamRedirectURI, fositeAccessDeniedWithPasswordGrantDisallowedHintErrorQuery),
 			wantBodyString:       "",
 		},
+		{
+			name:                 "using the custom username header on request for SAML upstream is not supported",
+			idps:                 oidctestutil.NewUpstreamIDPListerBuilder().WithSAML(&upstreamSAMLIdentityProvider),
+			method:               http.MethodGet,
+			path:                 happyGetRequestPath,
+			customUsernameHeader: pointer.String(oidcUpstreamUsername),
+			customPasswordHeader: pointer.String(oidcUpstreamPassword),
+			wantStatus:           http.StatusFound,
+			wantContentType:      jsonContentType,
+			wantLocationHeader:   urlWithQuery(downstreamRedirectURI, fositeAccessDeniedWithSAMLUsernamePasswordHeadersHintErrorQuery),
+			wantBodyString:       "",
+		},
+		{
+			name:                 "using the custom username header on request for GitHub upstream is not supported",
+			idps:                 oidctestutil.NewUpstreamIDPListerBuilder().WithGitHub(&upstreamGitHubIdentityProvider),
+			method:               http.MethodGet,
+			path:                 happyGetRequestPath,
+			customUsernameHeader: pointer.String(oidcUpstreamUsername),
+			customPasswordHeader: pointer.String(oidcUpstreamPassword),
+			wantStatus:           http.StatusFound,
+			wantContentType:      jsonContentType,
+			wantLocationHeader:   urlWithQuery(downstreamRedirectURI, fositeAccessDeniedWithGitHubUsernamePasswordHeadersHintErrorQuery),
+			wantBodyString:       "",
+		},
 		{
 			name:                 "dynamic clients are not allowed to use OIDC password grant because we don't want them to handle user credentials",
 			idps:                 oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(passwordGrantUpstreamOIDCIdentityProviderBuilder().Build()),
@@ -2507,7 +2806,7 @@ func TestAuthorizationEndpoint(t *testing.T) {
 			wantDownstreamNonce:               downstreamNonce,
 			wantDownstreamPKCEChallenge:       downstreamPKCEChallenge,
 			wantDownstreamPKCEChallengeMethod: downstreamPKCEChallengeMethod,
-			wantDownstreamCustomSessionData:   expectedHappyOIDCPasswordGrantCustomSessionWithUsername(oidcUpstreamIssuer + "?sub=" + oidcUpstreamSubjectQueryEscaped),
+			wantDownstreamCustomSessionData:   expectedHappyOIDCPasswordGrantCustomSessionWithUsernameAndGroups(oidcUpstreamIssuer+"?sub="+oidcUpstreamSubjectQueryEscaped, nil),
 		},
 		{
 			name: "OIDC upstream password grant: upstream IDP configures username claim as special claim `email` and `email_verified` upstream claim is missing",
@@ -2673,7 +2972,7 @@ func TestAuthorizationEndpoint(t *testing.T) {
 			wantDownstreamNonce:               downstreamNonce,
 			wantDownstreamPKCEChallenge:       downstreamPKCEChallenge,
 			wantDownstreamPKCEChallengeMethod: downstreamPKCEChallengeMethod,
-			wantDownstreamCustomSessionData:   expectedHappyOIDCPasswordGrantCustomSession,
+			wantDownstreamCustomSessionData:   expectedHappyOIDCPasswordGrantCustomSessionWithUsernameAndGroups(oidcUpstreamUsername, []string{"notAnArrayGroup1 notAnArrayGroup2"}),
 		},
 		{
 			name: "OIDC upstream password grant: upstream IDP's configured groups claim in the ID token is a slice of interfaces",
@@ -2698,7 +2997,7 @@ func TestAuthorizationEndpoint(t *testing.T) {
 			wantDownstreamNonce:               downstreamNonce,
 			wantDownstreamPKCEChallenge:       downstreamPKCEChallenge,
 			wantDownstreamPKCEChallengeMethod: downstreamPKCEChallengeMethod,
-			wantDownstreamCustomSessionData:   expectedHappyOIDCPasswordGrantCustomSession,
+			wantDownstreamCustomSessionData:   expectedHappyOIDCPasswordGrantCustomSessionWithUsernameAndGroups(oidcUpstreamUsername, []string{"group1", "group2"}),
 		},
 		{
 			name: "OIDC upstream password grant: upstream ID token does not contain requested username claim",
@@ -2737,7 +3036,7 @@ func TestAuthorizationEndpoint(t *testing.T) {
 			wantDownstreamNonce:               downstreamNonce,
 			wantDownstreamPKCEChallenge:       downstreamPKCEChallenge,
 			wantDownstreamPKCEChallengeMethod: downstreamPKCEChallengeMethod,
-			wantDownstreamCustomSessionData:   expectedHappyOIDCPasswordGrantCustomSession,
+			wantDownstreamCustomSessionData:   expectedHappyOIDCPasswordGrantCustomSessionWithUsernameAndGroups(oidcUpstreamUsername, nil),
 		},
 		{
 			name: "OIDC upstream password grant: upstream ID token contains username claim with weird format",
@@ -3039,49 +3338,180 @@ func TestAuthorizationEndpoint(t *testing.T) {
 			wantBodyString:  "Unprocessable Entity: No upstream providers are configured\n",
 		},
 		{
-			name:            "too many upstream providers are configured: multiple OIDC",
-			idps:            oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(upstreamOIDCIdentityProviderBuilder().Build(), upstreamOIDCIdentityProviderBuilder().Build()), // more than one not allowed
-			method:          http.MethodGet,
-			path:            happyGetRequestPath,
-			wantStatus:      http.StatusUnprocessableEntity,
-			wantContentType: "text/plain; charset=utf-8",
-			wantBodyString:  "Unprocessable Entity: Too many upstream providers are configured (support for multiple upstreams is not yet implemented)\n",
+			name:                 "too many upstream providers are configured for a login using username and password headers: multiple OIDC",
+			idps:                 oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(upstreamOIDCIdentityProviderBuilder().Build(), upstreamOIDCIdentityProviderBuilder().Build()), // more than one not allowed without choosing one
+			method:               http.MethodGet,
+			path:                 happyGetRequestPath,
+			customUsernameHeader: pointer.String(oidcUpstreamUsername),
+			customPasswordHeader: pointer.String(oidcUpstreamPassword),
+			wantStatus:           http.StatusUnprocessableEntity,
+			wantContentType:      "text/plain; charset=utf-8",
+			wantBodyString:       "Unprocessable Entity: Too many upstream providers are configured (use the pinniped_idp_name param to choose one)\n",
 		},
 		{
-			name:            "too many upstream providers are configured: multiple LDAP",
-			idps:            oidctestutil.NewUpstreamIDPListerBuilder().WithLDAP(&upstreamLDAPIdentityProvider, &upstreamLDAPIdentityProvider), // more than one not allowed
-			method:          http.MethodGet,
-			path:            happyGetRequestPath,
-			wantStatus:      http.StatusUnprocessableEntity,
-			wantContentType: "text/plain; charset=utf-8",
-			wantBodyString:  "Unprocessable Entity: Too many upstream providers are configured (support for multiple upstreams is not yet implemented)\n",
+			name:                 "too many upstream providers are configured for a login using username and password headers: multiple LDAP",
+			idps:                 oidctestutil.NewUpstreamIDPListerBuilder().WithLDAP(&upstreamLDAPIdentityProvider, &upstreamLDAPIdentityProvider), // more than one not allowed without choosing one
+			method:               http.MethodGet,
+			path:                 happyGetRequestPath,
+			customUsernameHeader: pointer.String(oidcUpstreamUsername),
+			customPasswordHeader: pointer.String(oidcUpstreamPassword),
+			wantStatus:           http.StatusUnprocessableEntity,
+			wantContentType:      "text/plain; charset=utf-8",
+			wantBodyString:       "Unprocessable Entity: Too many upstream providers are configured (use the pinniped_idp_name param to choose one)\n",
+		},
+		{
+			name:                 "too many upstream providers are configured for a login using username and password headers: multiple Active Directory",
+			idps:                 oidctestutil.NewUpstreamIDPListerBuilder().WithActiveDirectory(&upstreamLDAPIdentityProvider, &upstreamLDAPIdentityProvider), // more than one not allowed without choosing one
+			method:               http.MethodGet,
+			path:                 happyGetRequestPath,
+			customUsernameHeader: pointer.String(oidcUpstreamUsername),
+			customPasswordHeader: pointer.String(oidcUpstreamPassword),
+			wantStatus:           http.StatusUnprocessableEntity,
+			wantContentType:      "text/plain; charset=utf-8",
+			wantBodyString:       "Unprocessable Entity: Too many upstream providers are configured (use the pinniped_idp_name param to choose one)\n",
+		},
+		{
+			name:                 "too many upstream providers are configured for a login using username and password headers: both OIDC and LDAP",
+			idps:                 oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(upstreamOIDCIdentityProviderBuilder().Build()).WithLDAP(&upstreamLDAPIdentityProvider), // more than one not allowed without choosing one
+			method:               http.MethodGet,
+			path:                 happyGetRequestPath,
+			customUsernameHeader: pointer.String(oidcUpstreamUsername),
+			customPasswordHeader: pointer.String(oidcUpstreamPassword),
+			wantStatus:           http.StatusUnprocessableEntity,
+			wantContentType:      "text/plain; charset=utf-8",
+			wantBodyString:       "Unprocessable Entity: Too many upstream providers are configured (use the pinniped_idp_name param to choose one)\n",
+		},
+		{
+			name:                 "too many upstream providers are configured for a login using username and password headers: OIDC, LDAP and AD",
+			idps:                 oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(upstreamOIDCIdentityProviderBuilder().Build()).WithLDAP(&upstreamLDAPIdentityProvider).WithActiveDirectory(&upstreamActiveDirectoryIdentityProvider), // more than one not allowed without choosing one
+			method:               http.MethodGet,
+			path:                 happyGetRequestPath,
+			customUsernameHeader: pointer.String(oidcUpstreamUsername),
+			customPasswordHeader: pointer.String(oidcUpstreamPassword),
+			wantStatus:           http.StatusUnprocessableEntity,
+			wantContentType:      "text/plain; charset=utf-8",
+			wantBodyString:       "Unprocessable Entity: Too many upstream providers are configured (use the pinniped_idp_name param to choose one)\n",
+		},
+		{
+			name:                             "browser flow redirects to the identity provider chooser page when too many upstream providers are configured to choose one automatically: multiple OIDC",
+			idps:                             oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(upstreamOIDCIdentityProviderBuilder().Build(), upstreamOIDCIdentityProviderBuilder().Build()),
+			method:                           http.MethodGet,
+			path:                             happyGetRequestPath,
+			wantStatus:                       http.StatusSeeOther,
+			wantContentType:                  htmlContentType,
+			wantLocationHeader:               urlWithQuery(downstreamIssuer+"/choose_identity_provider", happyGetRequestQueryMap),
+			wantBodyStringWithLocationInHref: true,
+		},
+		{
+			name:                             "browser flow redirects to the identity provider chooser page when too many upstream providers are configured to choose one automatically: multiple LDAP",
+			idps:                             oidctestutil.NewUpstreamIDPListerBuilder().WithLDAP(&upstreamLDAPIdentityProvider, &upstreamLDAPIdentityProvider),
+			method:                           http.MethodGet,
+			path:                             happyGetRequestPath,
+			wantStatus:                       http.StatusSeeOther,
+			wantContentType:                  htmlContentType,
+			wantLocationHeader:               urlWithQuery(downstreamIssuer+"/choose_identity_provider", happyGetRequestQueryMap),
+			wantBodyStringWithLocationInHref: true,
+		},
+		{
+			name:                             "browser flow redirects to the identity provider chooser page when too many upstream providers are configured to choose one automatically: multiple Active Directory",
+			idps:                             oidctestutil.NewUpstreamIDPListerBuilder().WithActiveDirectory(&upstreamLDAPIdentityProvider, &upstreamLDAPIdentityProvider),
+			method:                           http.MethodGet,
+			path:                             happyGetRequestPath,
+			wantStatus:                       http.StatusSeeOther,
+			wantContentType:                  htmlContentType,
+			wantLocationHeader:               urlWithQuery(downstreamIssuer+"/choose_identity_provider", happyGetRequestQueryMap),
+			wantBodyStringWithLocationInHref: true,
+		},
+		{
+			name:                             "browser flow redirects to the identity provider chooser page when too many upstream providers are configured to choose one automatically: both OIDC and LDAP",
+			idps:                             oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(upstreamOIDCIdentityProviderBuilder().Build()).WithLDAP(&upstreamLDAPIdentityProvider),
+			method:                           http.MethodGet,
+			path:                             happyGetRequestPath,
+			wantStatus:                       http.StatusSeeOther,
+			wantContentType:                  htmlContentType,
+			wantLocationHeader:               urlWithQuery(downstreamIssuer+"/choose_identity_provider", happyGetRequestQueryMap),
+			wantBodyStringWithLocationInHref: true,
+		},
+		{
+			name:                             "browser flow redirects to the identity provider chooser page when too many upstream providers are configured to choose one automatically: OIDC, LDAP and AD",
+			idps:                             oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(upstreamOIDCIdentityProviderBuilder().Build()).WithLDAP(&upstreamLDAPIdentityProvider).WithActiveDirectory(&upstreamActiveDirectoryIdentityProvider),
+			method:                           http.MethodGet,
+			path:                             happyGetRequestPath,
+			wantStatus:                       http.StatusSeeOther,
+			wantContentType:                  htmlContentType,
+			wantLocationHeader:               urlWithQuery(downstreamIssuer+"/choose_identity_provider", happyGetRequestQueryMap),
+			wantBodyStringWithLocationInHref: true,
+		},
+		{
+			name:                             "browser flow redirects to the identity provider chooser page when too many upstream providers are configured, using a dynamic client",
+			idps:                             oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(upstreamOIDCIdentityProviderBuilder().Build()).WithLDAP(&upstreamLDAPIdentityProvider),
+			kubeResources:                    addFullyCapableDynamicClientAndSecretToKubeResources,
+			method:                           http.MethodGet,
+			path:                             modifiedHappyGetRequestPath(map[string]string{"client_id": dynamicClientID, "scope": testutil.AllDynamicClientScopesSpaceSep}),
+			wantStatus:                       http.StatusSeeOther,
+			wantContentType:                  htmlContentType,
+			wantLocationHeader:               urlWithQuery(downstreamIssuer+"/choose_identity_provider", modifiedHappyGetRequestQueryMap(map[string]string{"client_id": dynamicClientID, "scope": testutil.AllDynamicClientScopesSpaceSep})),
+			wantBodyStringWithLocationInHref: true,
+		},
+		{
+			name:               "browser flow redirects to the identity provider chooser page when too many upstream providers are configured, using POST",
+			idps:               oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(upstreamOIDCIdentityProviderBuilder().Build()).WithLDAP(&upstreamLDAPIdentityProvider),
+			method:             http.MethodPost,
+			path:               "/some/path",
+			contentType:        formContentType,
+			body:               encodeQuery(happyGetRequestQueryMap),
+			wantStatus:         http.StatusSeeOther,
+			wantContentType:    "",
+			wantBodyString:     "",
+			wantLocationHeader: urlWithQuery(downstreamIssuer+"/choose_identity_provider", happyGetRequestQueryMap),
+		},
+		{
+			name:               "browser flow with prompt param none throws an error when too many upstream providers are configured, because the user would need to choose one",
+			idps:               oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(upstreamOIDCIdentityProviderBuilder().Build()).WithLDAP(&upstreamLDAPIdentityProvider),
+			method:             http.MethodGet,
+			path:               modifiedHappyGetRequestPath(map[string]string{"prompt": "none"}),
+			wantStatus:         http.StatusSeeOther,
+			wantContentType:    jsonContentType,
+			wantLocationHeader: urlWithQuery(downstreamRedirectURI, fositeLoginRequiredErrorQuery),
+			wantBodyString:     "",
 		},
 		{
-			name:            "too many upstream providers are configured: multiple Active Directory",
-			idps:            oidctestutil.NewUpstreamIDPListerBuilder().WithActiveDirectory(&upstreamLDAPIdentityProvider, &upstreamLDAPIdentityProvider), // more than one not allowed
+			name:   "browser flow validates the request before redirecting to the identity provider chooser page",
+			idps:   oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(upstreamOIDCIdentityProviderBuilder().Build()).WithLDAP(&upstreamLDAPIdentityProvider),
+			method: http.MethodGet,
+			path: modifiedHappyGetRequestPath(map[string]string{
+				"redirect_uri": "http://127.0.0.1/does-not-match-what-is-configured-for-pinniped-cli-client",
+			}),
+			wantStatus:      http.StatusBadRequest,
+			wantContentType: jsonContentType,
+			wantBodyJSON:    fositeInvalidRedirectURIErrorBody,
+		},
+		{
+			name:            "requested upstream provider not found by name",
+			idps:            oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(upstreamOIDCIdentityProviderBuilder().Build()).WithLDAP(&upstreamLDAPIdentityProvider),
 			method:          http.MethodGet,
-			path:            happyGetRequestPath,
+			path:            modifiedHappyGetRequestPath(map[string]string{"pinniped_idp_name": "does-not-exist"}),
 			wantStatus:      http.StatusUnprocessableEntity,
 			wantContentType: "text/plain; charset=utf-8",
-			wantBodyString:  "Unprocessable Entity: Too many upstream providers are configured (support for multiple upstreams is not yet implemented)\n",
+			wantBodyString:  "Unprocessable Entity: Requested upstream provider not found (name \"does-not-exist\")\n",
 		},
 		{
-			name:            "too many upstream providers are configured: both OIDC and LDAP",
-			idps:            oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(upstreamOIDCIdentityProviderBuilder().Build()).WithLDAP(&upstreamLDAPIdentityProvider), // more than one not allowed
+			name:            "requested upstream provider not found by name and type",
+			idps:            oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(upstreamOIDCIdentityProviderBuilder().Build()).WithLDAP(&upstreamLDAPIdentityProvider),
 			method:          http.MethodGet,
-			path:            happyGetRequestPath,
+			path:            modifiedHappyGetRequestPath(map[string]string{"pinniped_idp_name": oidcUpstreamName, "pinniped_idp_type": "ldap"}),
 			wantStatus:      http.StatusUnprocessableEntity,
 			wantContentType: "text/plain; charset=utf-8",
-			wantBodyString:  "Unprocessable Entity: Too many upstream providers are configured (support for multiple upstreams is not yet implemented)\n",
+			wantBodyString:  "Unprocessable Entity: Requested upstream provider not found (name \"some-oidc-idp\", type \"ldap\")\n",
 		},
 		{
-			name:            "too many upstream providers are configured: OIDC, LDAP and AD",
-			idps:            oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(upstreamOIDCIdentityProviderBuilder().Build()).WithLDAP(&upstreamLDAPIdentityProvider).WithActiveDirectory(&upstreamActiveDirectoryIdentityProvider), // more than one not allowed
+			name:            "requested upstream provider name is ambiguous without a type",
+			idps:            oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(upstreamOIDCIdentityProviderBuilder().Build()).WithLDAP(&upstreamLDAPIdentityProvider).WithActiveDirectory(&upstreamLDAPIdentityProvider),
 			method:          http.MethodGet,
-			path:            happyGetRequestPath,
+			path:            modifiedHappyGetRequestPath(map[string]string{"pinniped_idp_name": ldapUpstreamName}),
 			wantStatus:      http.StatusUnprocessableEntity,
 			wantContentType: "text/plain; charset=utf-8",
-			wantBodyString:  "Unprocessable Entity: Too many upstream providers are configured (support for multiple upstreams is not yet implemented)\n",
+			wantBodyString:  "Unprocessable Entity: Multiple upstream providers are named \"some-ldap-idp\" (use the pinniped_idp_type param to choose one)\n",
 		},
 		{
 			name:            "PUT is a bad method",
@@ -3246,17 +3676,82 @@ func TestAuthorizationEndpoint(t *testing.T) {
 				require.True(t, len(idps.GetOIDCIdentityProviders()) > 0, "wantDownstreamAdditionalClaims requires at least one OIDC IDP")
 			}
 
+			auditLogger := auditlog.NewTestLogger(t)
 			subject := NewHandler(
 				downstreamIssuer,
 				idps,
 				oauthHelperWithNullStorage, oauthHelperWithRealStorage,
 				test.generateCSRF, test.generatePKCE, test.generateNonce,
 				test.stateEncoder, test.cookieEncoder,
+				branding.None,
+				auditLogger,
 			)
 			runOneTestCase(t, test, subject, kubeOauthStore, supervisorClient, kubeClient, secretsClient)
+
+			// Every request which reached an upstream IDP should be audited exactly once, as either a success or a failure.
+			auditEvents := auditLogger.Events()
+			require.LessOrEqual(t, len(auditEvents), 1)
+			for _, event := range auditEvents {
+				require.NotEmpty(t, event.CorrelationID)
+				require.NotNil(t, event.UpstreamIDP)
+				if event.Type == auditlog.UpstreamLoginSucceeded {
+					require.NotEmpty(t, event.User.Username)
+				} else {
+					require.Equal(t, auditlog.UpstreamLoginFailed, event.Type)
+					require.NotEmpty(t, event.Message)
+				}
+			}
+			if test.wantDownstreamIDTokenUsername != "" {
+				require.Len(t, auditEvents, 1)
+				require.Equal(t, auditlog.UpstreamLoginSucceeded, auditEvents[0].Type)
+				require.Equal(t, test.wantDownstreamIDTokenUsername, auditEvents[0].User.Username)
+			}
 		})
 	}
 
+	t.Run("SAML upstream browser flow happy path keeps the state in a cookie named after the RelayState and redirects to the upstream SSO URL", func(t *testing.T) {
+		kubeClient := fake.NewSimpleClientset()
+		supervisorClient := supervisorfake.NewSimpleClientset()
+		secretsClient := kubeClient.CoreV1().Secrets("some-namespace")
+		oidcClientsClient := supervisorClient.ConfigV1alpha1().OIDCClients("some-namespace")
+		oauthHelperWithRealStorage, _ := createOauthHelperWithRealStorage(secretsClient, oidcClientsClient)
+		oauthHelperWithNullStorage, _ := createOauthHelperWithNullStorage(secretsClient, oidcClientsClient)
+
+		subject := NewHandler(
+			downstreamIssuer,
+			oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(upstreamOIDCIdentityProviderBuilder().Build()).WithSAML(&upstreamSAMLIdentityProvider).Build(),
+			oauthHelperWithNullStorage, oauthHelperWithRealStorage,
+			happyCSRFGenerator, happyPKCEGenerator, happyNonceGenerator,
+			happyStateEncoder, happyCookieEncoder,
+			branding.None,
+			auditlog.NewTestLogger(t),
+		)
+		req := httptest.NewRequest(http.MethodGet, modifiedHappyGetRequestPath(map[string]string{"pinniped_idp_name": samlUpstreamName}), nil)
+		rsp := httptest.NewRecorder()
+		subject.ServeHTTP(rsp, req)
+
+		require.Equal(t, http.StatusSeeOther, rsp.Code)
+		testutil.RequireSecurityHeadersWithFormPostPageCSPs(t, rsp)
+
+		// The test double encodes the AuthnRequest's ID and issuer in place of a real AuthnRequest.
+		requireEqualURLs(t, rsp.Header().Get("Location"), urlWithQuery("https://saml-idp.example.com/sso", map[string]string{
+			"existing":    "param",
+			"SAMLRequest": "id-" + happyNonce + " from " + downstreamIssuer + "/saml/metadata",
+			"RelayState":  happyNonce,
+		}), false)
+
+		cookies := rsp.Header().Values("Set-Cookie")
+		require.Len(t, cookies, 2)
+		require.Regexp(t, "^__Host-pinniped-csrf=[^;]+; Path=/; HttpOnly; Secure; SameSite=Lax$", cookies[0])
+		regex := regexp.MustCompile("^__Host-pinniped-saml-" + happyNonce + "=([^;]+); Path=/; Max-Age=5400; HttpOnly; Secure; SameSite=None$")
+		submatches := regex.FindStringSubmatch(cookies[1])
+		require.Len(t, submatches, 2, cookies[1])
+		requireEqualDecodedStateParams(t,
+			"https://example.com?state="+submatches[1],
+			"https://example.com?state="+expectedUpstreamStateParam(nil, "", samlUpstreamName, "saml"),
+			happyStateEncoder)
+	})
+
 	t.Run("allows upstream provider configuration to change between requests", func(t *testing.T) {
 		test := tests[0]
 		// Double-check that we are re-using the happy path test case here as we intend.
@@ -3275,6 +3770,8 @@ func TestAuthorizationEndpoint(t *testing.T) {
 			oauthHelperWithNullStorage, oauthHelperWithRealStorage,
 			test.generateCSRF, test.generatePKCE, test.generateNonce,
 			test.stateEncoder, test.cookieEncoder,
+			branding.None,
+			auditlog.NewNoopLogger(),
 		)
 
 		runOneTestCase(t, test, subject, kubeOauthStore, supervisorClient, kubeClient, secretsClient)
@@ -3351,6 +3848,10 @@ func requireEqualDecodedStateParams(t *testing.T, actualURL string, expectedURL
 	err = stateParamDecoder.Decode("s", actualQueryStateParam, &actualDecodedStateParam)
 	require.NoError(t, err)
 
+	// The correlation ID is the random ID of the authorize request.
+	require.NotEmpty(t, actualDecodedStateParam.R)
+	actualDecodedStateParam.R = ""
+
 	require.Equal(t, expectedDecodedStateParam, actualDecodedStateParam)
 }
 
@@ -0,0 +1,60 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package oidc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/ory/fosite"
+
+	"go.pinniped.dev/internal/plog"
+	"go.pinniped.dev/internal/psession"
+)
+
+// IntrospectBearerAccessToken introspects the downstream access token which was sent as a bearer token to one of the
+// Supervisor's endpoints, as described in RFC 6750. When the request has no valid access token, it writes the error
+// response and returns nil, in which case the caller must not write anything else. The endpointName is only used
+// in log messages.
+func IntrospectBearerAccessToken(
+	w http.ResponseWriter,
+	r *http.Request,
+	oauthHelper fosite.OAuth2Provider,
+	endpointName string,
+) fosite.AccessRequester {
+	accessToken := fosite.AccessTokenFromRequest(r)
+	if accessToken == "" {
+		// RFC 6750 section 3.1 says that the error code should be omitted when the request has no authentication.
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		w.WriteHeader(http.StatusUnauthorized)
+		return nil
+	}
+
+	tokenUse, accessRequester, err := oauthHelper.IntrospectToken(r.Context(), accessToken, fosite.AccessToken, psession.NewPinnipedSession())
+	if err != nil {
+		plog.Info(endpointName+" request error", FositeErrorForLog(err)...)
+		WriteBearerError(w, http.StatusUnauthorized, "invalid_token", "The access token is invalid, expired, or revoked.")
+		return nil
+	}
+	if tokenUse != fosite.AccessToken {
+		plog.Info(endpointName+" request error", "reason", "token is not an access token", "tokenUse", tokenUse)
+		WriteBearerError(w, http.StatusUnauthorized, "invalid_token", "The token is not an access token.")
+		return nil
+	}
+
+	return accessRequester
+}
+
+// WriteBearerError writes an error response as described in RFC 6750 section 3, with the error in the
+// WWW-Authenticate header. The error is also written as a JSON body for clients which do not read the header.
+func WriteBearerError(w http.ResponseWriter, status int, errorCode string, description string) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf("Bearer error=%q, error_description=%q", errorCode, description))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"error":             errorCode,
+		"error_description": description,
+	})
+}
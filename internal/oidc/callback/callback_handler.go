@@ -1,29 +1,37 @@
-// Copyright 2020-2023 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 // Package callback provides a handler for the OIDC callback endpoint.
 package callback
 
 import (
+	"errors"
 	"net/http"
 	"net/url"
 
 	"github.com/ory/fosite"
 
+	"go.pinniped.dev/internal/auditlog"
 	"go.pinniped.dev/internal/httputil/httperr"
 	"go.pinniped.dev/internal/httputil/securityheader"
 	"go.pinniped.dev/internal/oidc"
+	"go.pinniped.dev/internal/oidc/consent"
 	"go.pinniped.dev/internal/oidc/downstreamsession"
 	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/oidc/provider/branding"
 	"go.pinniped.dev/internal/oidc/provider/formposthtml"
 	"go.pinniped.dev/internal/plog"
+	"go.pinniped.dev/internal/psession"
 )
 
 func NewHandler(
-	upstreamIDPs oidc.UpstreamOIDCIdentityProvidersLister,
+	upstreamIDPs oidc.FederationDomainIdentityProvidersListerI,
 	oauthHelper fosite.OAuth2Provider,
 	stateDecoder, cookieDecoder oidc.Decoder,
 	redirectURI string,
+	consentResponder *consent.Responder,
+	getBranding func() *branding.Branding,
+	auditLogger auditlog.Logger,
 ) http.Handler {
 	handler := httperr.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
 		state, err := validateRequest(r, stateDecoder, cookieDecoder)
@@ -31,32 +39,26 @@ func NewHandler(
 			return err
 		}
 
+		if state.UpstreamType == string(psession.ProviderTypeGitHub) {
+			return handleGitHubCallback(w, r, state, upstreamIDPs, oauthHelper, redirectURI, consentResponder, auditLogger)
+		}
+
 		upstreamIDPConfig := findUpstreamIDPConfig(state.UpstreamName, upstreamIDPs)
 		if upstreamIDPConfig == nil {
 			plog.Warning("upstream provider not found")
 			return httperr.New(http.StatusUnprocessableEntity, "upstream provider not found")
 		}
+		oidc.RecordUpstreamIDPForMetrics(r.Context(), upstreamIDPConfig.GetName(), psession.ProviderTypeOIDC)
 
-		downstreamAuthParams, err := url.ParseQuery(state.AuthParams)
+		authorizeRequester, err := reconstituteAuthorizeRequest(r, oauthHelper, state)
 		if err != nil {
-			plog.Error("error reading state downstream auth params", err)
-			return httperr.New(http.StatusBadRequest, "error reading state downstream auth params")
+			return err
 		}
 
-		// Recreate enough of the original authorize request so we can pass it to NewAuthorizeRequest().
-		reconstitutedAuthRequest := &http.Request{Form: downstreamAuthParams}
-		authorizeRequester, err := oauthHelper.NewAuthorizeRequest(r.Context(), reconstitutedAuthRequest)
-		if err != nil {
-			plog.Error("error using state downstream auth params", err,
-				"fositeErr", oidc.FositeErrorForLog(err))
-			return httperr.New(http.StatusBadRequest, "error using state downstream auth params")
+		auditLoginFailed := func(err error) {
+			oidc.AuditUpstreamLoginFailed(auditLogger, r, authorizeRequester, upstreamIDPConfig.GetName(), psession.ProviderTypeOIDC, err.Error())
 		}
 
-		// Automatically grant certain scopes, but only if they were requested.
-		// This is instead of asking the user to approve these scopes. Note that `NewAuthorizeRequest` would have returned
-		// an error if the client requested a scope that they are not allowed to request, so we don't need to worry about that here.
-		downstreamsession.AutoApproveScopes(authorizeRequester)
-
 		token, err := upstreamIDPConfig.ExchangeAuthcodeAndValidateTokens(
 			r.Context(),
 			authcode(r),
@@ -66,36 +68,161 @@ func NewHandler(
 		)
 		if err != nil {
 			plog.WarningErr("error exchanging and validating upstream tokens", err, "upstreamName", upstreamIDPConfig.GetName())
+			auditLoginFailed(err)
 			return httperr.New(http.StatusBadGateway, "error exchanging and validating upstream tokens")
 		}
 
-		subject, username, groups, err := downstreamsession.GetDownstreamIdentityFromUpstreamIDToken(upstreamIDPConfig, token.IDToken.Claims)
+		subject, upstreamUsername, upstreamGroups, err := downstreamsession.GetDownstreamIdentityFromUpstreamIDToken(upstreamIDPConfig, token.IDToken.Claims)
+		if err != nil {
+			auditLoginFailed(err)
+			return httperr.Wrap(http.StatusUnprocessableEntity, err.Error(), err)
+		}
+
+		identityTransforms := upstreamIDPs.GetIdentityTransformations(upstreamIDPConfig.GetName(), psession.ProviderTypeOIDC)
+		username, groups, err := downstreamsession.ApplyIdentityTransformations(r.Context(), identityTransforms, upstreamUsername, upstreamGroups)
 		if err != nil {
+			auditLoginFailed(err)
 			return httperr.Wrap(http.StatusUnprocessableEntity, err.Error(), err)
 		}
 
 		additionalClaims := downstreamsession.MapAdditionalClaimsFromUpstreamIDToken(upstreamIDPConfig, token.IDToken.Claims)
 
-		customSessionData, err := downstreamsession.MakeDownstreamOIDCCustomSessionData(upstreamIDPConfig, token, username)
+		customSessionData, err := downstreamsession.MakeDownstreamOIDCCustomSessionData(upstreamIDPConfig, token, username, upstreamUsername, upstreamGroups)
 		if err != nil {
+			auditLoginFailed(err)
 			return httperr.Wrap(http.StatusUnprocessableEntity, err.Error(), err)
 		}
 
+		oidc.AuditUpstreamLoginSucceeded(auditLogger, r, authorizeRequester, upstreamIDPConfig.GetName(), psession.ProviderTypeOIDC, username, groups)
+
 		openIDSession := downstreamsession.MakeDownstreamSession(subject, username, groups,
 			authorizeRequester.GetGrantedScopes(), authorizeRequester.GetClient().GetID(), customSessionData, additionalClaims)
 
-		authorizeResponder, err := oauthHelper.NewAuthorizeResponse(r.Context(), authorizeRequester, openIDSession)
-		if err != nil {
-			plog.WarningErr("error while generating and saving authcode", err,
-				"upstreamName", upstreamIDPConfig.GetName(), "fositeErr", oidc.FositeErrorForLog(err))
-			return httperr.Wrap(http.StatusInternalServerError, "error while generating and saving authcode", err)
+		return finishLogin(w, r, oauthHelper, consentResponder, authorizeRequester, openIDSession, state)
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		securityheader.WrapWithCustomCSP(handler, formposthtml.ContentSecurityPolicyWithBranding(getBranding())).ServeHTTP(w, r)
+	})
+}
+
+// handleGitHubCallback completes a login with an upstream GitHub identity provider, which is an OAuth 2.0
+// authorization server but not an OIDC provider, so the user's identity is read from the GitHub REST API
+// using the access token instead of from an ID token.
+func handleGitHubCallback(
+	w http.ResponseWriter,
+	r *http.Request,
+	state *oidc.UpstreamStateParamData,
+	upstreamIDPs oidc.FederationDomainIdentityProvidersListerI,
+	oauthHelper fosite.OAuth2Provider,
+	redirectURI string,
+	consentResponder *consent.Responder,
+	auditLogger auditlog.Logger,
+) error {
+	upstreamIDPConfig := findGitHubUpstreamIDPConfig(state.UpstreamName, upstreamIDPs)
+	if upstreamIDPConfig == nil {
+		plog.Warning("upstream provider not found")
+		return httperr.New(http.StatusUnprocessableEntity, "upstream provider not found")
+	}
+	oidc.RecordUpstreamIDPForMetrics(r.Context(), upstreamIDPConfig.GetName(), psession.ProviderTypeGitHub)
+
+	authorizeRequester, err := reconstituteAuthorizeRequest(r, oauthHelper, state)
+	if err != nil {
+		return err
+	}
+
+	auditLoginFailed := func(err error) {
+		oidc.AuditUpstreamLoginFailed(auditLogger, r, authorizeRequester, upstreamIDPConfig.GetName(), psession.ProviderTypeGitHub, err.Error())
+	}
+
+	accessToken, err := upstreamIDPConfig.ExchangeAuthcode(r.Context(), authcode(r), redirectURI)
+	if err != nil {
+		plog.WarningErr("error exchanging upstream authcode", err, "upstreamName", upstreamIDPConfig.GetName())
+		auditLoginFailed(err)
+		return httperr.New(http.StatusBadGateway, "error exchanging upstream authcode")
+	}
+
+	user, err := upstreamIDPConfig.GetUser(r.Context(), accessToken)
+	if err != nil {
+		auditLoginFailed(err)
+		if errors.Is(err, provider.ErrGitHubUserNotInAllowedOrganizations) {
+			return httperr.Wrap(http.StatusForbidden, err.Error(), err)
 		}
+		plog.WarningErr("error getting upstream GitHub user", err, "upstreamName", upstreamIDPConfig.GetName())
+		return httperr.New(http.StatusBadGateway, "error getting upstream GitHub user")
+	}
+
+	identityTransforms := upstreamIDPs.GetIdentityTransformations(upstreamIDPConfig.GetName(), psession.ProviderTypeGitHub)
+	username, groups, err := downstreamsession.ApplyIdentityTransformations(r.Context(), identityTransforms, user.Username, user.Groups)
+	if err != nil {
+		auditLoginFailed(err)
+		return httperr.Wrap(http.StatusUnprocessableEntity, err.Error(), err)
+	}
 
-		oauthHelper.WriteAuthorizeResponse(r.Context(), w, authorizeRequester, authorizeResponder)
+	customSessionData := downstreamsession.MakeDownstreamGitHubCustomSessionData(upstreamIDPConfig, accessToken, username, user.Username, user.Groups)
 
-		return nil
-	})
-	return securityheader.WrapWithCustomCSP(handler, formposthtml.ContentSecurityPolicy())
+	oidc.AuditUpstreamLoginSucceeded(auditLogger, r, authorizeRequester, upstreamIDPConfig.GetName(), psession.ProviderTypeGitHub, username, groups)
+
+	openIDSession := downstreamsession.MakeDownstreamSession(user.DownstreamSubject, username, groups,
+		authorizeRequester.GetGrantedScopes(), authorizeRequester.GetClient().GetID(), customSessionData, map[string]interface{}{})
+
+	return finishLogin(w, r, oauthHelper, consentResponder, authorizeRequester, openIDSession, state)
+}
+
+// reconstituteAuthorizeRequest recreates the original downstream authorize request from the state param.
+func reconstituteAuthorizeRequest(
+	r *http.Request,
+	oauthHelper fosite.OAuth2Provider,
+	state *oidc.UpstreamStateParamData,
+) (fosite.AuthorizeRequester, error) {
+	downstreamAuthParams, err := url.ParseQuery(state.AuthParams)
+	if err != nil {
+		plog.Error("error reading state downstream auth params", err)
+		return nil, httperr.New(http.StatusBadRequest, "error reading state downstream auth params")
+	}
+
+	// Recreate enough of the original authorize request so we can pass it to NewAuthorizeRequest().
+	reconstitutedAuthRequest := &http.Request{Form: downstreamAuthParams}
+	authorizeRequester, err := oauthHelper.NewAuthorizeRequest(r.Context(), reconstitutedAuthRequest)
+	if err != nil {
+		plog.Error("error using state downstream auth params", err,
+			"fositeErr", oidc.FositeErrorForLog(err))
+		return nil, httperr.New(http.StatusBadRequest, "error using state downstream auth params")
+	}
+	oidc.RestoreCorrelationID(authorizeRequester, state)
+
+	// Automatically grant certain scopes, but only if they were requested.
+	// This is instead of asking the user to approve these scopes. Note that `NewAuthorizeRequest` would have returned
+	// an error if the client requested a scope that they are not allowed to request, so we don't need to worry about that here.
+	downstreamsession.AutoApproveScopes(authorizeRequester)
+
+	return authorizeRequester, nil
+}
+
+// finishLogin either redirects to the consent page, or issues the downstream authcode for the new session.
+func finishLogin(
+	w http.ResponseWriter,
+	r *http.Request,
+	oauthHelper fosite.OAuth2Provider,
+	consentResponder *consent.Responder,
+	authorizeRequester fosite.AuthorizeRequester,
+	openIDSession *psession.PinnipedSession,
+	state *oidc.UpstreamStateParamData,
+) error {
+	oidc.SetCorrelationID(openIDSession, authorizeRequester)
+	if redirected, err := consentResponder.RedirectToConsentPageIfRequired(w, r, authorizeRequester, openIDSession, state); err != nil || redirected {
+		return err
+	}
+
+	authorizeResponder, err := oauthHelper.NewAuthorizeResponse(r.Context(), authorizeRequester, openIDSession)
+	if err != nil {
+		plog.WarningErr("error while generating and saving authcode", err,
+			"upstreamName", state.UpstreamName, "fositeErr", oidc.FositeErrorForLog(err))
+		return httperr.Wrap(http.StatusInternalServerError, "error while generating and saving authcode", err)
+	}
+
+	oauthHelper.WriteAuthorizeResponse(r.Context(), w, authorizeRequester, authorizeResponder)
+
+	return nil
 }
 
 func authcode(r *http.Request) string {
@@ -129,3 +256,12 @@ func findUpstreamIDPConfig(upstreamName string, upstreamIDPs oidc.UpstreamOIDCId
 	}
 	return nil
 }
+
+func findGitHubUpstreamIDPConfig(upstreamName string, upstreamIDPs oidc.UpstreamGitHubIdentityProvidersLister) provider.UpstreamGitHubIdentityProviderI {
+	for _, p := range upstreamIDPs.GetGitHubIdentityProviders() {
+		if p.GetName() == upstreamName {
+			return p
+		}
+	}
+	return nil
+}
@@ -1,4 +1,4 @@
-// Copyright 2020-2023 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package callback
@@ -6,6 +6,7 @@ package callback
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -17,13 +18,23 @@ import (
 	"github.com/stretchr/testify/require"
 	"golang.org/x/crypto/bcrypt"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes/fake"
 
 	configv1alpha1 "go.pinniped.dev/generated/latest/apis/supervisor/config/v1alpha1"
 	supervisorfake "go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned/fake"
+	"go.pinniped.dev/internal/auditlog"
+	"go.pinniped.dev/internal/celtransformer"
+	"go.pinniped.dev/internal/crud"
+	"go.pinniped.dev/internal/fositestorage/authorizationcode"
+	consentstorage "go.pinniped.dev/internal/fositestorage/consent"
+	"go.pinniped.dev/internal/fositestorage/consentrequest"
 	"go.pinniped.dev/internal/oidc"
+	"go.pinniped.dev/internal/oidc/consent"
 	"go.pinniped.dev/internal/oidc/jwks"
 	"go.pinniped.dev/internal/oidc/oidcclientvalidator"
+	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/oidc/provider/branding"
 	"go.pinniped.dev/internal/psession"
 	"go.pinniped.dev/internal/testutil"
 	"go.pinniped.dev/internal/testutil/oidctestutil"
@@ -63,11 +74,16 @@ const (
 	downstreamPKCEChallenge       = "some-challenge"
 	downstreamPKCEChallengeMethod = "S256"
 
+	githubUpstreamAccessToken = "test-github-access-token"
+	githubUpstreamSubject     = "https://github.com?sub=1234"
+	githubUpstreamUsername    = "octocat:1234"
+
 	htmlContentType = "text/html; charset=utf-8"
 )
 
 var (
 	oidcUpstreamGroupMembership    = []string{"test-pinniped-group-0", "test-pinniped-group-1"}
+	githubUpstreamGroupMembership  = []string{"my-org/team-one", "my-org/team-two"}
 	happyDownstreamScopesRequested = []string{"openid", "username", "groups"}
 	happyDownstreamScopesGranted   = []string{"openid", "username", "groups"}
 
@@ -89,10 +105,12 @@ var (
 	happyDownstreamRequestParamsForDynamicClient = happyDownstreamRequestParamsQueryForDynamicClient.Encode()
 
 	happyDownstreamCustomSessionData = &psession.CustomSessionData{
-		Username:     oidcUpstreamUsername,
-		ProviderUID:  happyUpstreamIDPResourceUID,
-		ProviderName: happyUpstreamIDPName,
-		ProviderType: psession.ProviderTypeOIDC,
+		Username:         oidcUpstreamUsername,
+		UpstreamUsername: oidcUpstreamUsername,
+		UpstreamGroups:   oidcUpstreamGroupMembership,
+		ProviderUID:      happyUpstreamIDPResourceUID,
+		ProviderName:     happyUpstreamIDPName,
+		ProviderType:     psession.ProviderTypeOIDC,
 		OIDC: &psession.OIDCSessionData{
 			UpstreamRefreshToken: oidcUpstreamRefreshToken,
 			UpstreamIssuer:       oidcUpstreamIssuer,
@@ -104,13 +122,39 @@ var (
 		copyOfOIDC := *(happyDownstreamCustomSessionData.OIDC)
 		copyOfCustomSession.OIDC = &copyOfOIDC
 		copyOfCustomSession.Username = wantUsername
+		copyOfCustomSession.UpstreamUsername = wantUsername
+		return &copyOfCustomSession
+	}
+	happyDownstreamCustomSessionDataWithTransformedUsername = func(wantDownstreamUsername string) *psession.CustomSessionData {
+		copyOfCustomSession := *happyDownstreamCustomSessionData
+		copyOfOIDC := *(happyDownstreamCustomSessionData.OIDC)
+		copyOfCustomSession.OIDC = &copyOfOIDC
+		copyOfCustomSession.Username = wantDownstreamUsername
 		return &copyOfCustomSession
 	}
+	happyDownstreamCustomSessionDataWithUsernameAndGroups = func(wantUsername string, wantGroups []string) *psession.CustomSessionData {
+		copyOfCustomSession := happyDownstreamCustomSessionDataWithUsername(wantUsername)
+		copyOfCustomSession.UpstreamGroups = wantGroups
+		return copyOfCustomSession
+	}
+	happyDownstreamGitHubCustomSessionData = &psession.CustomSessionData{
+		Username:         githubUpstreamUsername,
+		UpstreamUsername: githubUpstreamUsername,
+		UpstreamGroups:   githubUpstreamGroupMembership,
+		ProviderUID:      happyUpstreamIDPResourceUID,
+		ProviderName:     happyUpstreamIDPName,
+		ProviderType:     psession.ProviderTypeGitHub,
+		GitHub: &psession.GitHubSessionData{
+			UpstreamAccessToken: githubUpstreamAccessToken,
+		},
+	}
 	happyDownstreamAccessTokenCustomSessionData = &psession.CustomSessionData{
-		Username:     oidcUpstreamUsername,
-		ProviderUID:  happyUpstreamIDPResourceUID,
-		ProviderName: happyUpstreamIDPName,
-		ProviderType: psession.ProviderTypeOIDC,
+		Username:         oidcUpstreamUsername,
+		UpstreamUsername: oidcUpstreamUsername,
+		UpstreamGroups:   oidcUpstreamGroupMembership,
+		ProviderUID:      happyUpstreamIDPResourceUID,
+		ProviderName:     happyUpstreamIDPName,
+		ProviderType:     psession.ProviderTypeOIDC,
 		OIDC: &psession.OIDCSessionData{
 			UpstreamAccessToken: oidcUpstreamAccessToken,
 			UpstreamIssuer:      oidcUpstreamIssuer,
@@ -122,6 +166,23 @@ var (
 func TestCallbackEndpoint(t *testing.T) {
 	require.Len(t, happyDownstreamState, 8, "we expect fosite to allow 8 byte state params, so we want to test that boundary case")
 
+	const (
+		transformationUsernamePrefix = "username_prefix:"
+		transformationGroupsPrefix   = "groups_prefix:"
+	)
+
+	prefixUsernameAndGroupsPipeline := oidctestutil.NewTransformationPipeline(t, nil,
+		&celtransformer.UsernameTransformation{Expression: fmt.Sprintf(`"%s" + username`, transformationUsernamePrefix)},
+		&celtransformer.GroupsTransformation{Expression: fmt.Sprintf(`groups.map(g, "%s" + g)`, transformationGroupsPrefix)},
+	)
+
+	rejectAuthPipeline := oidctestutil.NewTransformationPipeline(t, nil,
+		&celtransformer.AllowAuthenticationPolicy{
+			Expression:                    `"admins" in groups`,
+			RejectedAuthenticationMessage: "only admins may log in",
+		},
+	)
+
 	otherUpstreamOIDCIdentityProvider := oidctestutil.TestUpstreamOIDCIdentityProvider{
 		Name:     "other-upstream-idp-name",
 		ClientID: "other-some-client-id",
@@ -141,6 +202,7 @@ func TestCallbackEndpoint(t *testing.T) {
 	happyCookieCodec.SetSerializer(securecookie.JSONEncoder{})
 
 	happyState := happyUpstreamStateParam().Build(t, happyStateCodec)
+	happyGitHubState := happyUpstreamStateParam().WithUpstreamIDPType("github").Build(t, happyStateCodec)
 	happyStateForDynamicClient := happyUpstreamStateParamForDynamicClient().Build(t, happyStateCodec)
 
 	encodedIncomingCookieCSRFValue, err := happyCookieCodec.Encode("csrf", happyDownstreamCSRF)
@@ -154,6 +216,29 @@ func TestCallbackEndpoint(t *testing.T) {
 		RedirectURI:          happyUpstreamRedirectURI,
 	}
 
+	happyGitHubUpstream := func() *oidctestutil.TestUpstreamGitHubIdentityProvider {
+		return &oidctestutil.TestUpstreamGitHubIdentityProvider{
+			Name:        happyUpstreamIDPName,
+			ResourceUID: happyUpstreamIDPResourceUID,
+			ExchangeAuthcodeFunc: func(ctx context.Context, authcode string, redirectURI string) (string, error) {
+				if authcode != happyUpstreamAuthcode || redirectURI != happyUpstreamRedirectURI {
+					return "", errors.New("unexpected authcode or redirect URI")
+				}
+				return githubUpstreamAccessToken, nil
+			},
+			GetUserFunc: func(ctx context.Context, accessToken string) (*provider.GitHubUser, error) {
+				if accessToken != githubUpstreamAccessToken {
+					return nil, errors.New("unexpected access token")
+				}
+				return &provider.GitHubUser{
+					Username:          githubUpstreamUsername,
+					Groups:            githubUpstreamGroupMembership,
+					DownstreamSubject: githubUpstreamSubject,
+				}, nil
+			},
+		}
+	}
+
 	// Note that fosite puts the granted scopes as a param in the redirect URI even though the spec doesn't seem to require it
 	happyDownstreamRedirectLocationRegexp := downstreamRedirectURI + `\?code=([^&]+)&scope=openid\+username\+groups&state=` + happyDownstreamState
 
@@ -165,6 +250,15 @@ func TestCallbackEndpoint(t *testing.T) {
 		require.NoError(t, kubeClient.Tracker().Add(secret))
 	}
 
+	addFullyCapableDynamicClientRequiringConsentAndSecretToKubeResources := func(t *testing.T, supervisorClient *supervisorfake.Clientset, kubeClient *fake.Clientset) {
+		oidcClient, secret := testutil.FullyCapableOIDCClientAndStorageSecret(t,
+			"some-namespace", downstreamDynamicClientID, downstreamDynamicClientUID, downstreamRedirectURI,
+			[]string{testutil.HashedPassword1AtGoMinCost}, oidcclientvalidator.Validate)
+		oidcClient.Spec.Consent = &configv1alpha1.OIDCClientConsent{DisplayName: "Some App"}
+		require.NoError(t, supervisorClient.Tracker().Add(oidcClient))
+		require.NoError(t, kubeClient.Tracker().Add(secret))
+	}
+
 	tests := []struct {
 		name string
 
@@ -190,6 +284,7 @@ func TestCallbackEndpoint(t *testing.T) {
 		wantDownstreamPKCEChallengeMethod string
 		wantDownstreamCustomSessionData   *psession.CustomSessionData
 		wantDownstreamAdditionalClaims    map[string]interface{}
+		wantRedirectToConsentPage         bool
 
 		wantAuthcodeExchangeCall *expectedAuthcodeExchange
 	}{
@@ -291,6 +386,46 @@ func TestCallbackEndpoint(t *testing.T) {
 				args:                    happyExchangeAndValidateTokensArgs,
 			},
 		},
+		{
+			name: "GET with good state and cookie and successful upstream token exchange with identity transformations returns 303 to downstream client callback",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(happyUpstream().Build()).
+				WithIdentityTransformations(happyUpstreamIDPName, psession.ProviderTypeOIDC, prefixUsernameAndGroupsPipeline),
+			method:                            http.MethodGet,
+			path:                              newRequestPath().WithState(happyState).String(),
+			csrfCookie:                        happyCSRFCookie,
+			wantStatus:                        http.StatusSeeOther,
+			wantRedirectLocationRegexp:        happyDownstreamRedirectLocationRegexp,
+			wantBody:                          "",
+			wantDownstreamIDTokenSubject:      oidcUpstreamIssuer + "?sub=" + oidcUpstreamSubjectQueryEscaped,
+			wantDownstreamIDTokenUsername:     transformationUsernamePrefix + oidcUpstreamUsername,
+			wantDownstreamIDTokenGroups:       testutil.AddPrefixToEach(transformationGroupsPrefix, oidcUpstreamGroupMembership),
+			wantDownstreamRequestedScopes:     happyDownstreamScopesRequested,
+			wantDownstreamGrantedScopes:       happyDownstreamScopesGranted,
+			wantDownstreamNonce:               downstreamNonce,
+			wantDownstreamClientID:            downstreamPinnipedClientID,
+			wantDownstreamPKCEChallenge:       downstreamPKCEChallenge,
+			wantDownstreamPKCEChallengeMethod: downstreamPKCEChallengeMethod,
+			wantDownstreamCustomSessionData:   happyDownstreamCustomSessionDataWithTransformedUsername(transformationUsernamePrefix + oidcUpstreamUsername),
+			wantAuthcodeExchangeCall: &expectedAuthcodeExchange{
+				performedByUpstreamName: happyUpstreamIDPName,
+				args:                    happyExchangeAndValidateTokensArgs,
+			},
+		},
+		{
+			name: "GET with good state and cookie and successful upstream token exchange when an identity policy rejects the authentication",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(happyUpstream().Build()).
+				WithIdentityTransformations(happyUpstreamIDPName, psession.ProviderTypeOIDC, rejectAuthPipeline),
+			method:          http.MethodGet,
+			path:            newRequestPath().WithState(happyState).String(),
+			csrfCookie:      happyCSRFCookie,
+			wantStatus:      http.StatusUnprocessableEntity,
+			wantContentType: htmlContentType,
+			wantBody:        "Unprocessable Entity: configured identity policy rejected this authentication: only admins may log in\n",
+			wantAuthcodeExchangeCall: &expectedAuthcodeExchange{
+				performedByUpstreamName: happyUpstreamIDPName,
+				args:                    happyExchangeAndValidateTokensArgs,
+			},
+		},
 		{
 			name:                              "GET with good state and cookie and successful upstream token exchange returns 303 to downstream client callback with its state and code when using dynamic client",
 			idps:                              oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(happyUpstream().Build()),
@@ -316,6 +451,60 @@ func TestCallbackEndpoint(t *testing.T) {
 				args:                    happyExchangeAndValidateTokensArgs,
 			},
 		},
+		{
+			name: "GET with good state and cookie and successful upstream token exchange returns 303 to the consent page when using dynamic client which requires consent",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(happyUpstream().Build()),
+			kubeResources: func(t *testing.T, supervisorClient *supervisorfake.Clientset, kubeClient *fake.Clientset) {
+				addFullyCapableDynamicClientRequiringConsentAndSecretToKubeResources(t, supervisorClient, kubeClient)
+			},
+			method:                        http.MethodGet,
+			path:                          newRequestPath().WithState(happyStateForDynamicClient).String(),
+			csrfCookie:                    happyCSRFCookie,
+			wantStatus:                    http.StatusSeeOther,
+			wantContentType:               htmlContentType,
+			wantRedirectToConsentPage:     true,
+			wantDownstreamIDTokenUsername: oidcUpstreamUsername,
+			wantAuthcodeExchangeCall: &expectedAuthcodeExchange{
+				performedByUpstreamName: happyUpstreamIDPName,
+				args:                    happyExchangeAndValidateTokensArgs,
+			},
+		},
+		{
+			name: "GET with good state and cookie and successful upstream token exchange returns 303 to downstream client callback when using dynamic client which requires consent that the user already gave",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(happyUpstream().Build()),
+			kubeResources: func(t *testing.T, supervisorClient *supervisorfake.Clientset, kubeClient *fake.Clientset) {
+				addFullyCapableDynamicClientRequiringConsentAndSecretToKubeResources(t, supervisorClient, kubeClient)
+				consents := consentstorage.New(kubeClient.CoreV1().Secrets("some-namespace"), time.Now, time.Hour)
+				require.NoError(t, consents.Save(context.Background(), &consentstorage.Consent{
+					ClientID:  downstreamDynamicClientID,
+					Subject:   oidcUpstreamIssuer + "?sub=" + oidcUpstreamSubjectQueryEscaped,
+					Scopes:    happyDownstreamScopesGranted,
+					GrantedAt: time.Now(),
+				}))
+				// Only count the Secrets which are created by the test subject.
+				kubeClient.ClearActions()
+			},
+			method:                            http.MethodGet,
+			path:                              newRequestPath().WithState(happyStateForDynamicClient).String(),
+			csrfCookie:                        happyCSRFCookie,
+			wantStatus:                        http.StatusSeeOther,
+			wantRedirectLocationRegexp:        happyDownstreamRedirectLocationRegexp,
+			wantBody:                          "",
+			wantDownstreamIDTokenSubject:      oidcUpstreamIssuer + "?sub=" + oidcUpstreamSubjectQueryEscaped,
+			wantDownstreamIDTokenUsername:     oidcUpstreamUsername,
+			wantDownstreamIDTokenGroups:       oidcUpstreamGroupMembership,
+			wantDownstreamRequestedScopes:     happyDownstreamScopesRequested,
+			wantDownstreamGrantedScopes:       happyDownstreamScopesGranted,
+			wantDownstreamNonce:               downstreamNonce,
+			wantDownstreamClientID:            downstreamDynamicClientID,
+			wantDownstreamPKCEChallenge:       downstreamPKCEChallenge,
+			wantDownstreamPKCEChallengeMethod: downstreamPKCEChallengeMethod,
+			wantDownstreamCustomSessionData:   happyDownstreamCustomSessionData,
+			wantAuthcodeExchangeCall: &expectedAuthcodeExchange{
+				performedByUpstreamName: happyUpstreamIDPName,
+				args:                    happyExchangeAndValidateTokensArgs,
+			},
+		},
 		{
 			name:                              "GET with authcode exchange that returns an access token but no refresh token when there is a userinfo endpoint returns 303 to downstream client callback with its state and code",
 			idps:                              oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(happyUpstream().WithEmptyRefreshToken().WithAccessToken(oidcUpstreamAccessToken, metav1.NewTime(time.Now().Add(9*time.Hour))).WithUserInfoURL().Build()),
@@ -394,11 +583,13 @@ func TestCallbackEndpoint(t *testing.T) {
 			wantDownstreamPKCEChallenge:       downstreamPKCEChallenge,
 			wantDownstreamPKCEChallengeMethod: downstreamPKCEChallengeMethod,
 			wantDownstreamCustomSessionData: &psession.CustomSessionData{
-				Username:     oidcUpstreamUsername,
-				ProviderUID:  happyUpstreamIDPResourceUID,
-				ProviderName: happyUpstreamIDPName,
-				ProviderType: psession.ProviderTypeOIDC,
-				Warnings:     []string{"Access token from identity provider has lifetime of less than 3 hours. Expect frequent prompts to log in."},
+				Username:         oidcUpstreamUsername,
+				UpstreamUsername: oidcUpstreamUsername,
+				UpstreamGroups:   oidcUpstreamGroupMembership,
+				ProviderUID:      happyUpstreamIDPResourceUID,
+				ProviderName:     happyUpstreamIDPName,
+				ProviderType:     psession.ProviderTypeOIDC,
+				Warnings:         []string{"Access token from identity provider has lifetime of less than 3 hours. Expect frequent prompts to log in."},
 				OIDC: &psession.OIDCSessionData{
 					UpstreamAccessToken: oidcUpstreamAccessToken,
 					UpstreamIssuer:      oidcUpstreamIssuer,
@@ -430,7 +621,7 @@ func TestCallbackEndpoint(t *testing.T) {
 			wantDownstreamClientID:            downstreamPinnipedClientID,
 			wantDownstreamPKCEChallenge:       downstreamPKCEChallenge,
 			wantDownstreamPKCEChallengeMethod: downstreamPKCEChallengeMethod,
-			wantDownstreamCustomSessionData:   happyDownstreamCustomSessionDataWithUsername(oidcUpstreamIssuer + "?sub=" + oidcUpstreamSubjectQueryEscaped),
+			wantDownstreamCustomSessionData:   happyDownstreamCustomSessionDataWithUsernameAndGroups(oidcUpstreamIssuer+"?sub="+oidcUpstreamSubjectQueryEscaped, nil),
 			wantAuthcodeExchangeCall: &expectedAuthcodeExchange{
 				performedByUpstreamName: happyUpstreamIDPName,
 				args:                    happyExchangeAndValidateTokensArgs,
@@ -670,7 +861,7 @@ func TestCallbackEndpoint(t *testing.T) {
 			wantDownstreamClientID:            downstreamPinnipedClientID,
 			wantDownstreamPKCEChallenge:       downstreamPKCEChallenge,
 			wantDownstreamPKCEChallengeMethod: downstreamPKCEChallengeMethod,
-			wantDownstreamCustomSessionData:   happyDownstreamCustomSessionData,
+			wantDownstreamCustomSessionData:   happyDownstreamCustomSessionDataWithUsernameAndGroups(oidcUpstreamUsername, []string{"notAnArrayGroup1 notAnArrayGroup2"}),
 			wantAuthcodeExchangeCall: &expectedAuthcodeExchange{
 				performedByUpstreamName: happyUpstreamIDPName,
 				args:                    happyExchangeAndValidateTokensArgs,
@@ -696,7 +887,7 @@ func TestCallbackEndpoint(t *testing.T) {
 			wantDownstreamClientID:            downstreamPinnipedClientID,
 			wantDownstreamPKCEChallenge:       downstreamPKCEChallenge,
 			wantDownstreamPKCEChallengeMethod: downstreamPKCEChallengeMethod,
-			wantDownstreamCustomSessionData:   happyDownstreamCustomSessionData,
+			wantDownstreamCustomSessionData:   happyDownstreamCustomSessionDataWithUsernameAndGroups(oidcUpstreamUsername, []string{"group1", "group2"}),
 			wantAuthcodeExchangeCall: &expectedAuthcodeExchange{
 				performedByUpstreamName: happyUpstreamIDPName,
 				args:                    happyExchangeAndValidateTokensArgs,
@@ -1251,7 +1442,7 @@ func TestCallbackEndpoint(t *testing.T) {
 			wantDownstreamClientID:            downstreamPinnipedClientID,
 			wantDownstreamPKCEChallenge:       downstreamPKCEChallenge,
 			wantDownstreamPKCEChallengeMethod: downstreamPKCEChallengeMethod,
-			wantDownstreamCustomSessionData:   happyDownstreamCustomSessionData,
+			wantDownstreamCustomSessionData:   happyDownstreamCustomSessionDataWithUsernameAndGroups(oidcUpstreamUsername, nil),
 			wantAuthcodeExchangeCall: &expectedAuthcodeExchange{
 				performedByUpstreamName: happyUpstreamIDPName,
 				args:                    happyExchangeAndValidateTokensArgs,
@@ -1433,6 +1624,109 @@ func TestCallbackEndpoint(t *testing.T) {
 				args:                    happyExchangeAndValidateTokensArgs,
 			},
 		},
+		{
+			name:                              "GitHub: GET with good state and cookie and successful upstream authcode exchange returns 303 to downstream client callback",
+			idps:                              oidctestutil.NewUpstreamIDPListerBuilder().WithGitHub(happyGitHubUpstream()),
+			method:                            http.MethodGet,
+			path:                              newRequestPath().WithState(happyGitHubState).String(),
+			csrfCookie:                        happyCSRFCookie,
+			wantStatus:                        http.StatusSeeOther,
+			wantRedirectLocationRegexp:        happyDownstreamRedirectLocationRegexp,
+			wantBody:                          "",
+			wantDownstreamIDTokenSubject:      githubUpstreamSubject,
+			wantDownstreamIDTokenUsername:     githubUpstreamUsername,
+			wantDownstreamIDTokenGroups:       githubUpstreamGroupMembership,
+			wantDownstreamRequestedScopes:     happyDownstreamScopesRequested,
+			wantDownstreamGrantedScopes:       happyDownstreamScopesGranted,
+			wantDownstreamNonce:               downstreamNonce,
+			wantDownstreamClientID:            downstreamPinnipedClientID,
+			wantDownstreamPKCEChallenge:       downstreamPKCEChallenge,
+			wantDownstreamPKCEChallengeMethod: downstreamPKCEChallengeMethod,
+			wantDownstreamCustomSessionData:   happyDownstreamGitHubCustomSessionData,
+		},
+		{
+			name: "GitHub: GET with good state and cookie and successful upstream authcode exchange with identity transformations returns 303 to downstream client callback",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithGitHub(happyGitHubUpstream()).
+				WithIdentityTransformations(happyUpstreamIDPName, psession.ProviderTypeGitHub, prefixUsernameAndGroupsPipeline),
+			method:                            http.MethodGet,
+			path:                              newRequestPath().WithState(happyGitHubState).String(),
+			csrfCookie:                        happyCSRFCookie,
+			wantStatus:                        http.StatusSeeOther,
+			wantRedirectLocationRegexp:        happyDownstreamRedirectLocationRegexp,
+			wantBody:                          "",
+			wantDownstreamIDTokenSubject:      githubUpstreamSubject,
+			wantDownstreamIDTokenUsername:     transformationUsernamePrefix + githubUpstreamUsername,
+			wantDownstreamIDTokenGroups:       testutil.AddPrefixToEach(transformationGroupsPrefix, githubUpstreamGroupMembership),
+			wantDownstreamRequestedScopes:     happyDownstreamScopesRequested,
+			wantDownstreamGrantedScopes:       happyDownstreamScopesGranted,
+			wantDownstreamNonce:               downstreamNonce,
+			wantDownstreamClientID:            downstreamPinnipedClientID,
+			wantDownstreamPKCEChallenge:       downstreamPKCEChallenge,
+			wantDownstreamPKCEChallengeMethod: downstreamPKCEChallengeMethod,
+			wantDownstreamCustomSessionData: func() *psession.CustomSessionData {
+				copyOfCustomSession := *happyDownstreamGitHubCustomSessionData
+				copyOfCustomSession.Username = transformationUsernamePrefix + githubUpstreamUsername
+				return &copyOfCustomSession
+			}(),
+		},
+		{
+			name: "GitHub: upstream authcode exchange fails",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithGitHub(func() *oidctestutil.TestUpstreamGitHubIdentityProvider {
+				p := happyGitHubUpstream()
+				p.ExchangeAuthcodeFunc = func(ctx context.Context, authcode string, redirectURI string) (string, error) {
+					return "", errors.New("some exchange error")
+				}
+				return p
+			}()),
+			method:          http.MethodGet,
+			path:            newRequestPath().WithState(happyGitHubState).String(),
+			csrfCookie:      happyCSRFCookie,
+			wantStatus:      http.StatusBadGateway,
+			wantContentType: htmlContentType,
+			wantBody:        "Bad Gateway: error exchanging upstream authcode\n",
+		},
+		{
+			name: "GitHub: user is not a member of any allowed organization",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithGitHub(func() *oidctestutil.TestUpstreamGitHubIdentityProvider {
+				p := happyGitHubUpstream()
+				p.GetUserFunc = func(ctx context.Context, accessToken string) (*provider.GitHubUser, error) {
+					return nil, provider.ErrGitHubUserNotInAllowedOrganizations
+				}
+				return p
+			}()),
+			method:          http.MethodGet,
+			path:            newRequestPath().WithState(happyGitHubState).String(),
+			csrfCookie:      happyCSRFCookie,
+			wantStatus:      http.StatusForbidden,
+			wantContentType: htmlContentType,
+			wantBody:        "Forbidden: user is not a member of any of the allowed GitHub organizations\n",
+		},
+		{
+			name: "GitHub: error getting the user from the GitHub API",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithGitHub(func() *oidctestutil.TestUpstreamGitHubIdentityProvider {
+				p := happyGitHubUpstream()
+				p.GetUserFunc = func(ctx context.Context, accessToken string) (*provider.GitHubUser, error) {
+					return nil, errors.New("some GitHub API error")
+				}
+				return p
+			}()),
+			method:          http.MethodGet,
+			path:            newRequestPath().WithState(happyGitHubState).String(),
+			csrfCookie:      happyCSRFCookie,
+			wantStatus:      http.StatusBadGateway,
+			wantContentType: htmlContentType,
+			wantBody:        "Bad Gateway: error getting upstream GitHub user\n",
+		},
+		{
+			name:            "GitHub: the GitHubIdentityProvider CRD has been deleted",
+			idps:            oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(happyUpstream().Build()),
+			method:          http.MethodGet,
+			path:            newRequestPath().WithState(happyGitHubState).String(),
+			csrfCookie:      happyCSRFCookie,
+			wantStatus:      http.StatusUnprocessableEntity,
+			wantContentType: htmlContentType,
+			wantBody:        "Unprocessable Entity: upstream provider not found\n",
+		},
 	}
 	for _, test := range tests {
 		test := test
@@ -1451,13 +1745,19 @@ func TestCallbackEndpoint(t *testing.T) {
 			// Inject this into our test subject at the last second so we get a fresh storage for every test.
 			timeoutsConfiguration := oidc.DefaultOIDCTimeoutsConfiguration()
 			// Use lower minimum required bcrypt cost than we would use in production to keep unit the tests fast.
-			oauthStore := oidc.NewKubeStorage(secrets, oidcClientsClient, timeoutsConfiguration, bcrypt.MinCost)
+			oauthStore := oidc.NewKubeStorage(secrets, oidcClientsClient, downstreamIssuer, timeoutsConfiguration, bcrypt.MinCost)
 			hmacSecretFunc := func() []byte { return []byte("some secret - must have at least 32 bytes") }
 			require.GreaterOrEqual(t, len(hmacSecretFunc()), 32, "fosite requires that hmac secrets have at least 32 bytes")
 			jwksProviderIsUnused := jwks.NewDynamicJWKSProvider()
-			oauthHelper := oidc.FositeOauth2Helper(oauthStore, downstreamIssuer, hmacSecretFunc, jwksProviderIsUnused, timeoutsConfiguration)
+			oauthHelper := oidc.FositeOauth2Helper(oauthStore, downstreamIssuer, hmacSecretFunc, nil, jwksProviderIsUnused, timeoutsConfiguration, nil)
 
-			subject := NewHandler(test.idps.Build(), oauthHelper, happyStateCodec, happyCookieCodec, happyUpstreamRedirectURI)
+			consentResponder := consent.NewResponder(downstreamIssuer,
+				consentstorage.New(secrets, time.Now, time.Hour),
+				consentrequest.New(secrets, time.Now, time.Hour),
+				time.Hour)
+
+			auditLogger := auditlog.NewTestLogger(t)
+			subject := NewHandler(test.idps.Build(), oauthHelper, happyStateCodec, happyCookieCodec, happyUpstreamRedirectURI, consentResponder, branding.None, auditLogger)
 			reqContext := context.WithValue(context.Background(), struct{ name string }{name: "test"}, "request-context")
 			req := httptest.NewRequest(test.method, test.path, nil).WithContext(reqContext)
 			if test.csrfCookie != "" {
@@ -1483,6 +1783,13 @@ func TestCallbackEndpoint(t *testing.T) {
 			testutil.RequireEqualContentType(t, rsp.Header().Get("Content-Type"), test.wantContentType)
 
 			switch {
+			// If we want a redirect to the consent page, assert that the login is waiting there for the user's answer.
+			case test.wantRedirectToConsentPage:
+				require.Len(t, rsp.Header().Values("Location"), 1)
+				require.Regexp(t, `^`+downstreamIssuer+`/consent\?request=[A-Za-z0-9_-]+$`, rsp.Header().Get("Location"))
+				testutil.RequireNumberOfSecretsMatchingLabelSelector(t, secrets, labels.Set{crud.SecretLabelKey: consentrequest.TypeLabelValue}, 1)
+				testutil.RequireNumberOfSecretsMatchingLabelSelector(t, secrets, labels.Set{crud.SecretLabelKey: authorizationcode.TypeLabelValue}, 0)
+
 			// If we want a specific static response body, assert that.
 			case test.wantBody != "":
 				require.Equal(t, test.wantBody, rsp.Body.String())
@@ -1538,6 +1845,25 @@ func TestCallbackEndpoint(t *testing.T) {
 					test.wantDownstreamAdditionalClaims,
 				)
 			}
+
+			// Every request which reached an upstream IDP should be audited exactly once, as either a success or a failure.
+			auditEvents := auditLogger.Events()
+			require.LessOrEqual(t, len(auditEvents), 1)
+			for _, event := range auditEvents {
+				require.NotEmpty(t, event.CorrelationID)
+				require.NotNil(t, event.UpstreamIDP)
+				if event.Type == auditlog.UpstreamLoginSucceeded {
+					require.NotEmpty(t, event.User.Username)
+				} else {
+					require.Equal(t, auditlog.UpstreamLoginFailed, event.Type)
+					require.NotEmpty(t, event.Message)
+				}
+			}
+			if test.wantDownstreamIDTokenUsername != "" {
+				require.Len(t, auditEvents, 1)
+				require.Equal(t, auditlog.UpstreamLoginSucceeded, auditEvents[0].Type)
+				require.Equal(t, test.wantDownstreamIDTokenUsername, auditEvents[0].User.Username)
+			}
 		})
 	}
 }
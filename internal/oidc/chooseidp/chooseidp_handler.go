@@ -0,0 +1,79 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package chooseidp provides a handler for the page which lets the user choose an upstream IDP during a browser-based login.
+package chooseidp
+
+import (
+	"net/http"
+	"net/url"
+
+	"go.pinniped.dev/generated/latest/apis/supervisor/idpdiscovery/v1alpha1"
+	oidcapi "go.pinniped.dev/generated/latest/apis/supervisor/oidc"
+	"go.pinniped.dev/internal/httputil/httperr"
+	"go.pinniped.dev/internal/httputil/securityheader"
+	"go.pinniped.dev/internal/oidc"
+	"go.pinniped.dev/internal/oidc/chooseidp/chooseidphtml"
+	"go.pinniped.dev/internal/oidc/idpdiscovery"
+)
+
+// NewHandler returns a http.Handler that serves the page which lists the upstream IDPs that can be used for a
+// browser-based login, so the user can choose one of them.
+//
+// Users should only get redirected to this page by the authorization endpoint, which copies the original
+// authorization request's params onto the query of this page. Each choice on this page links back to the
+// authorization endpoint with those same params, plus the params which choose the upstream IDP. The authorization
+// endpoint is then responsible for validating the request, creating the state param, and setting the CSRF cookie,
+// the same as it would have if the client had chosen the upstream IDP.
+func NewHandler(authorizationPath string, upstreamIDPs oidc.UpstreamIdentityProvidersLister) http.Handler {
+	handler := httperr.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		if r.Method != http.MethodGet {
+			return httperr.Newf(http.StatusMethodNotAllowed, "%s (try GET)", r.Method)
+		}
+
+		authorizeParams := r.URL.Query()
+		if authorizeParams.Get("client_id") == "" {
+			return httperr.New(http.StatusBadRequest, "missing client_id param")
+		}
+
+		pageInputs := &chooseidphtml.PageData{}
+		for _, idp := range idpdiscovery.GetIDPList(upstreamIDPs) {
+			if !supportsBrowserFlow(idp) {
+				continue
+			}
+			pageInputs.IdentityProviders = append(pageInputs.IdentityProviders, chooseidphtml.IdentityProvider{
+				Name: idp.Name,
+				Type: idp.Type.String(),
+				URL:  authorizationURLForIDP(authorizationPath, authorizeParams, idp),
+			})
+		}
+
+		if len(pageInputs.IdentityProviders) == 0 {
+			return httperr.New(http.StatusUnprocessableEntity, "No upstream providers are configured")
+		}
+
+		return chooseidphtml.Template().Execute(w, pageInputs)
+	})
+
+	return securityheader.WrapWithCustomCSP(handler, chooseidphtml.ContentSecurityPolicy())
+}
+
+func supportsBrowserFlow(idp v1alpha1.PinnipedIDP) bool {
+	for _, flow := range idp.Flows {
+		if flow == v1alpha1.IDPFlowBrowserAuthcode {
+			return true
+		}
+	}
+	return false
+}
+
+func authorizationURLForIDP(authorizationPath string, authorizeParams url.Values, idp v1alpha1.PinnipedIDP) string {
+	params := url.Values{}
+	for k, v := range authorizeParams {
+		params[k] = v
+	}
+	params.Set(oidcapi.AuthorizeUpstreamIDPNameParamName, idp.Name)
+	params.Set(oidcapi.AuthorizeUpstreamIDPTypeParamName, idp.Type.String())
+
+	return authorizationPath + "?" + params.Encode()
+}
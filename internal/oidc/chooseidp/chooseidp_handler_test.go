@@ -0,0 +1,126 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package chooseidp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"go.pinniped.dev/internal/oidc/chooseidp/chooseidphtml"
+	"go.pinniped.dev/internal/testutil"
+	"go.pinniped.dev/internal/testutil/oidctestutil"
+)
+
+func TestChooseIDPHandler(t *testing.T) {
+	const (
+		htmlContentType = "text/html; charset=utf-8"
+		testAuthPath    = "/some/path/oauth2/authorize"
+	)
+
+	happyIDPs := func() *oidctestutil.UpstreamIDPListerBuilder {
+		return oidctestutil.NewUpstreamIDPListerBuilder().
+			WithOIDC(oidctestutil.NewTestUpstreamOIDCIdentityProviderBuilder().WithName("z-some-oidc-idp").Build()).
+			WithLDAP(&oidctestutil.TestUpstreamLDAPIdentityProvider{Name: "some-ldap-idp"}).
+			WithActiveDirectory(&oidctestutil.TestUpstreamLDAPIdentityProvider{Name: "a-some-ad-idp"})
+	}
+
+	tests := []struct {
+		name string
+
+		idps   *oidctestutil.UpstreamIDPListerBuilder
+		method string
+		path   string
+
+		wantStatus      int
+		wantContentType string
+		wantBody        string
+	}{
+		{
+			name:            "happy path lists all upstream IDPs sorted by name, with links back to the authorization endpoint",
+			idps:            happyIDPs(),
+			method:          http.MethodGet,
+			path:            "/some/path/choose_identity_provider?client_id=foo&redirect_uri=http%3A%2F%2F127.0.0.1%2Fcallback&state=abc&scope=openid+groups",
+			wantStatus:      http.StatusOK,
+			wantContentType: htmlContentType,
+			wantBody: testutil.ExpectedChooseIDPPageHTML(chooseidphtml.CSS(), []testutil.ChooseIDPPageChoice{
+				{
+					Name: "a-some-ad-idp",
+					Type: "activedirectory",
+					URL:  testAuthPath + "?client_id=foo&pinniped_idp_name=a-some-ad-idp&pinniped_idp_type=activedirectory&redirect_uri=http%3A%2F%2F127.0.0.1%2Fcallback&scope=openid+groups&state=abc",
+				},
+				{
+					Name: "some-ldap-idp",
+					Type: "ldap",
+					URL:  testAuthPath + "?client_id=foo&pinniped_idp_name=some-ldap-idp&pinniped_idp_type=ldap&redirect_uri=http%3A%2F%2F127.0.0.1%2Fcallback&scope=openid+groups&state=abc",
+				},
+				{
+					Name: "z-some-oidc-idp",
+					Type: "oidc",
+					URL:  testAuthPath + "?client_id=foo&pinniped_idp_name=z-some-oidc-idp&pinniped_idp_type=oidc&redirect_uri=http%3A%2F%2F127.0.0.1%2Fcallback&scope=openid+groups&state=abc",
+				},
+			}),
+		},
+		{
+			name:            "any incoming IDP params are replaced by the ones for each choice",
+			idps:            oidctestutil.NewUpstreamIDPListerBuilder().WithLDAP(&oidctestutil.TestUpstreamLDAPIdentityProvider{Name: "some-ldap-idp"}),
+			method:          http.MethodGet,
+			path:            "/some/path/choose_identity_provider?client_id=foo&pinniped_idp_name=other&pinniped_idp_type=oidc",
+			wantStatus:      http.StatusOK,
+			wantContentType: htmlContentType,
+			wantBody: testutil.ExpectedChooseIDPPageHTML(chooseidphtml.CSS(), []testutil.ChooseIDPPageChoice{
+				{
+					Name: "some-ldap-idp",
+					Type: "ldap",
+					URL:  testAuthPath + "?client_id=foo&pinniped_idp_name=some-ldap-idp&pinniped_idp_type=ldap",
+				},
+			}),
+		},
+		{
+			name:            "no upstream IDPs are configured",
+			idps:            oidctestutil.NewUpstreamIDPListerBuilder(),
+			method:          http.MethodGet,
+			path:            "/some/path/choose_identity_provider?client_id=foo",
+			wantStatus:      http.StatusUnprocessableEntity,
+			wantContentType: "text/plain; charset=utf-8",
+			wantBody:        "Unprocessable Entity: No upstream providers are configured\n",
+		},
+		{
+			name:            "missing client_id param",
+			idps:            happyIDPs(),
+			method:          http.MethodGet,
+			path:            "/some/path/choose_identity_provider?state=abc",
+			wantStatus:      http.StatusBadRequest,
+			wantContentType: "text/plain; charset=utf-8",
+			wantBody:        "Bad Request: missing client_id param\n",
+		},
+		{
+			name:            "bad method",
+			idps:            happyIDPs(),
+			method:          http.MethodPost,
+			path:            "/some/path/choose_identity_provider?client_id=foo",
+			wantStatus:      http.StatusMethodNotAllowed,
+			wantContentType: "text/plain; charset=utf-8",
+			wantBody:        "Method Not Allowed: POST (try GET)\n",
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			subject := NewHandler(testAuthPath, test.idps.Build())
+
+			req := httptest.NewRequest(test.method, test.path, nil)
+			rsp := httptest.NewRecorder()
+			subject.ServeHTTP(rsp, req)
+
+			require.Equal(t, test.wantStatus, rsp.Code)
+			testutil.RequireEqualContentType(t, rsp.Header().Get("Content-Type"), test.wantContentType)
+			require.Equal(t, chooseidphtml.ContentSecurityPolicy(), rsp.Header().Get("Content-Security-Policy"))
+			testutil.RequireSecurityHeadersWithLoginPageCSPs(t, rsp)
+			require.Equal(t, test.wantBody, rsp.Body.String())
+		})
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package chooseidphtml
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"go.pinniped.dev/internal/testutil"
+)
+
+var (
+	testExpectedCSS = `html{height:100%}body{font-family:metropolis-light,Helvetica,sans-serif;display:flex;flex-flow:column wrap;justify-content:flex-start;align-items:center;background:linear-gradient(to top,#f8f8f8,white);min-height:100%}h1{font-size:20px;margin:0}.box{display:flex;flex-direction:column;flex-wrap:nowrap;border-radius:4px;border-color:#ddd;border-width:1px;border-style:solid;width:400px;padding:30px 30px 0;margin:60px 20px 0;background:#fff;font-size:14px}.form-field{display:flex;margin-bottom:30px}.form-field a{width:100%;padding:1em;border-radius:3px;background-color:#218fcf;color:#eee;font-weight:700;text-align:center;text-decoration:none;transition:all .3s}.form-field a:focus,.form-field a:hover{background-color:#1abfd3}.form-field a:active{transform:scale(.99)}`
+
+	// It's okay if this changes in the future, but this gives us a chance to eyeball the formatting.
+	// Our browser-based integration tests should find any incompatibilities.
+	testExpectedCSP = `default-src 'none'; ` +
+		`style-src 'sha256-IRoW1ihmmRsWpkd1cZ0stvLZmR8QbY9wVMegJQdXTlY='; ` +
+		`frame-ancestors 'none'`
+)
+
+func TestTemplate(t *testing.T) {
+	var buf bytes.Buffer
+	pageInputs := &PageData{
+		IdentityProviders: []IdentityProvider{
+			{Name: "some-ldap-idp", Type: "ldap", URL: "/some/path/oauth2/authorize?client_id=foo&pinniped_idp_name=some-ldap-idp&pinniped_idp_type=ldap"},
+			{Name: "some-oidc-<idp>", Type: "oidc", URL: "/some/path/oauth2/authorize?client_id=foo&pinniped_idp_name=some-oidc-%3Cidp%3E&pinniped_idp_type=oidc"},
+		},
+	}
+
+	expectedHTML := testutil.ExpectedChooseIDPPageHTML(testExpectedCSS, []testutil.ChooseIDPPageChoice{
+		{Name: "some-ldap-idp", Type: "ldap", URL: "/some/path/oauth2/authorize?client_id=foo&pinniped_idp_name=some-ldap-idp&pinniped_idp_type=ldap"},
+		{Name: "some-oidc-<idp>", Type: "oidc", URL: "/some/path/oauth2/authorize?client_id=foo&pinniped_idp_name=some-oidc-%3Cidp%3E&pinniped_idp_type=oidc"},
+	})
+	require.NoError(t, Template().Execute(&buf, pageInputs))
+	// t.Logf("actual value:\n%s", buf.String()) // useful when updating minify library causes new output
+	require.Equal(t, expectedHTML, buf.String())
+}
+
+func TestContentSecurityPolicy(t *testing.T) {
+	require.Equal(t, testExpectedCSP, ContentSecurityPolicy())
+}
+
+func TestCSS(t *testing.T) {
+	require.Equal(t, testExpectedCSS, CSS())
+}
+
+func TestHelpers(t *testing.T) {
+	require.Equal(t, "test", panicOnError("test", nil))
+	require.PanicsWithError(t, "some error", func() { panicOnError("", fmt.Errorf("some error")) })
+}
@@ -0,0 +1,59 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package oidc
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"net/url"
+
+	"github.com/ory/fosite"
+	errorsx "github.com/pkg/errors"
+
+	"go.pinniped.dev/internal/oidc/oidcclientvalidator"
+)
+
+// tlsClientAuthClient is a client which can authenticate at the token endpoint using a TLS client certificate.
+type tlsClientAuthClient interface {
+	fosite.OpenIDConnectClient
+	VerifyTLSClientCertificate(peerCertificates []*x509.Certificate) error
+}
+
+// newClientAuthenticationStrategy returns a fosite.ClientAuthenticationStrategy which adds support for the
+// tls_client_auth method from https://datatracker.ietf.org/doc/html/rfc8705#section-2.1, which fosite does not
+// implement. All other client authentication methods, including private_key_jwt, are delegated to fosite.
+func newClientAuthenticationStrategy(oauthStore interface{}, defaultStrategy fosite.ClientAuthenticationStrategy) fosite.ClientAuthenticationStrategy {
+	return func(ctx context.Context, r *http.Request, form url.Values) (fosite.Client, error) {
+		clientManager, ok := oauthStore.(fosite.ClientManager)
+		clientID := form.Get("client_id")
+		_, _, hasBasicAuth := r.BasicAuth()
+		if !ok || clientID == "" || hasBasicAuth || form.Get("client_secret") != "" || form.Get("client_assertion_type") != "" {
+			// The client is not attempting to use tls_client_auth, since it is using other credentials.
+			return defaultStrategy(ctx, r, form)
+		}
+
+		client, err := clientManager.GetClient(ctx, clientID)
+		if err != nil {
+			return nil, errorsx.WithStack(fosite.ErrInvalidClient.WithWrap(err).WithDebug(err.Error()))
+		}
+
+		tlsClient, ok := client.(tlsClientAuthClient)
+		if !ok || tlsClient.GetTokenEndpointAuthMethod() != oidcclientvalidator.TokenEndpointAuthMethodTLSClientAuth {
+			return defaultStrategy(ctx, r, form)
+		}
+
+		var peerCertificates []*x509.Certificate
+		if r.TLS != nil {
+			peerCertificates = r.TLS.PeerCertificates
+		}
+		if err := tlsClient.VerifyTLSClientCertificate(peerCertificates); err != nil {
+			return nil, errorsx.WithStack(fosite.ErrInvalidClient.
+				WithHint("The client's TLS certificate could not be used to authenticate the client.").
+				WithWrap(err).WithDebug(err.Error()))
+		}
+
+		return client, nil
+	}
+}
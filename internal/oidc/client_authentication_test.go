@@ -0,0 +1,260 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ory/fosite"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	configv1alpha1 "go.pinniped.dev/generated/latest/apis/supervisor/config/v1alpha1"
+	supervisorfake "go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned/fake"
+	"go.pinniped.dev/internal/certauthority"
+	"go.pinniped.dev/internal/fositestorage/clientassertion"
+	"go.pinniped.dev/internal/oidc/jwks"
+	"go.pinniped.dev/internal/testutil"
+)
+
+func TestClientAuthenticationStrategy(t *testing.T) {
+	const (
+		namespace  = "test-namespace"
+		issuer     = "https://issuer.example.com/some/path"
+		jwtClient  = "client.oauth.pinniped.dev-jwt-client"
+		tlsClient  = "client.oauth.pinniped.dev-tls-client"
+		basicAuthn = "client.oauth.pinniped.dev-basic-client"
+	)
+
+	clientAssertionKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	clientJWKS, err := json.Marshal(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: clientAssertionKey.Public(), KeyID: "client-key", Algorithm: "ES256", Use: "sig"},
+	}})
+	require.NoError(t, err)
+
+	clientCA, err := certauthority.New("client CA", time.Hour)
+	require.NoError(t, err)
+	clientCert, err := clientCA.IssueClientCert("my-webapp", nil, time.Hour)
+	require.NoError(t, err)
+	otherCA, err := certauthority.New("other CA", time.Hour)
+	require.NoError(t, err)
+	otherClientCert, err := otherCA.IssueClientCert("my-webapp", nil, time.Hour)
+	require.NoError(t, err)
+
+	spec := func(modify func(spec *configv1alpha1.OIDCClientSpec)) configv1alpha1.OIDCClientSpec {
+		s := configv1alpha1.OIDCClientSpec{
+			AllowedGrantTypes:   []configv1alpha1.GrantType{"authorization_code"},
+			AllowedScopes:       []configv1alpha1.Scope{"openid"},
+			AllowedRedirectURIs: []configv1alpha1.RedirectURI{"https://foobar.com/callback"},
+		}
+		modify(&s)
+		return s
+	}
+
+	kubeClient := fake.NewSimpleClientset()
+	secrets := kubeClient.CoreV1().Secrets(namespace)
+	supervisorClient := supervisorfake.NewSimpleClientset(
+		&configv1alpha1.OIDCClient{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: jwtClient, UID: "jwt-uid"},
+			Spec: spec(func(s *configv1alpha1.OIDCClientSpec) {
+				s.TokenEndpointAuthMethod = "private_key_jwt"
+				s.JWKS = &configv1alpha1.OIDCClientJWKS{Inline: string(clientJWKS), SigningAlgorithm: "ES256"}
+			}),
+		},
+		&configv1alpha1.OIDCClient{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: tlsClient, UID: "tls-uid"},
+			Spec: spec(func(s *configv1alpha1.OIDCClientSpec) {
+				s.TokenEndpointAuthMethod = "tls_client_auth"
+				s.TLSClientAuth = &configv1alpha1.OIDCClientTLSClientAuth{
+					CertificateAuthorityData: base64.StdEncoding.EncodeToString(clientCA.Bundle()),
+					SubjectDN:                "CN=my-webapp",
+				}
+			}),
+		},
+		&configv1alpha1.OIDCClient{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: basicAuthn, UID: "basic-uid"},
+			Spec:       spec(func(s *configv1alpha1.OIDCClientSpec) {}),
+		},
+	)
+	require.NoError(t, kubeClient.Tracker().Add(
+		testutil.OIDCClientSecretStorageSecretForUID(t, namespace, "basic-uid", []string{testutil.HashedPassword1AtSupervisorMinCost}),
+	))
+
+	oauthStore := NewKubeStorage(secrets, supervisorClient.ConfigV1alpha1().OIDCClients(namespace), issuer, DefaultOIDCTimeoutsConfiguration(), bcrypt.MinCost)
+	hmacSecretFunc := func() []byte { return []byte("some secret - must have at least 32 bytes") }
+	oauthHelper := FositeOauth2Helper(oauthStore, issuer, hmacSecretFunc, nil, jwks.NewDynamicJWKSProvider(), DefaultOIDCTimeoutsConfiguration(), nil)
+
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.ES256, Key: clientAssertionKey},
+		(&jose.SignerOptions{}).WithHeader("kid", "client-key"),
+	)
+	require.NoError(t, err)
+	clientAssertion := func(t *testing.T, jti string, audience string) string {
+		t.Helper()
+		assertion, err := jwt.Signed(signer).Claims(jwt.Claims{
+			Issuer:   jwtClient,
+			Subject:  jwtClient,
+			Audience: jwt.Audience{audience},
+			ID:       jti,
+			Expiry:   jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		}).CompactSerialize()
+		require.NoError(t, err)
+		return assertion
+	}
+
+	peerCertificates := func(t *testing.T, cert *tls.Certificate) *tls.ConnectionState {
+		t.Helper()
+		parsed, err := x509.ParseCertificate(cert.Certificate[0])
+		require.NoError(t, err)
+		return &tls.ConnectionState{PeerCertificates: []*x509.Certificate{parsed}}
+	}
+
+	tests := []struct {
+		name         string
+		form         url.Values
+		basicAuth    []string
+		tls          *tls.ConnectionState
+		wantClientID string
+		wantErr      string
+		// authenticateTwice authenticates the client twice during the same request, like the token endpoint
+		// does for the device code grant.
+		authenticateTwice bool
+	}{
+		{
+			name: "private_key_jwt client with a valid client assertion",
+			form: url.Values{
+				"client_assertion_type": {"urn:ietf:params:oauth:client-assertion-type:jwt-bearer"},
+				"client_assertion":      {clientAssertion(t, "jti-1", issuer+"/oauth2/token")},
+			},
+			wantClientID: jwtClient,
+		},
+		{
+			name: "private_key_jwt client reusing a client assertion",
+			form: url.Values{
+				"client_assertion_type": {"urn:ietf:params:oauth:client-assertion-type:jwt-bearer"},
+				"client_assertion":      {clientAssertion(t, "jti-1", issuer+"/oauth2/token")},
+			},
+			wantErr: fosite.ErrJTIKnown.Error(),
+		},
+		{
+			name: "private_key_jwt client authenticated twice during the same request",
+			form: url.Values{
+				"client_assertion_type": {"urn:ietf:params:oauth:client-assertion-type:jwt-bearer"},
+				"client_assertion":      {clientAssertion(t, "jti-3", issuer+"/oauth2/token")},
+			},
+			authenticateTwice: true,
+			wantClientID:      jwtClient,
+		},
+		{
+			name: "private_key_jwt client reusing a client assertion from another request which authenticated twice",
+			form: url.Values{
+				"client_assertion_type": {"urn:ietf:params:oauth:client-assertion-type:jwt-bearer"},
+				"client_assertion":      {clientAssertion(t, "jti-3", issuer+"/oauth2/token")},
+			},
+			authenticateTwice: true,
+			wantErr:           fosite.ErrJTIKnown.Error(),
+		},
+		{
+			name: "private_key_jwt client with the wrong audience",
+			form: url.Values{
+				"client_assertion_type": {"urn:ietf:params:oauth:client-assertion-type:jwt-bearer"},
+				"client_assertion":      {clientAssertion(t, "jti-2", "https://wrong.example.com/oauth2/token")},
+			},
+			wantErr: fosite.ErrInvalidClient.Error(),
+		},
+		{
+			name:         "tls_client_auth client with a valid certificate",
+			form:         url.Values{"client_id": {tlsClient}},
+			tls:          peerCertificates(t, clientCert),
+			wantClientID: tlsClient,
+		},
+		{
+			name:    "tls_client_auth client with a certificate from another CA",
+			form:    url.Values{"client_id": {tlsClient}},
+			tls:     peerCertificates(t, otherClientCert),
+			wantErr: fosite.ErrInvalidClient.Error(),
+		},
+		{
+			name:    "tls_client_auth client without a certificate",
+			form:    url.Values{"client_id": {tlsClient}},
+			wantErr: fosite.ErrInvalidClient.Error(),
+		},
+		{
+			name:      "tls_client_auth client trying to use a client secret",
+			basicAuth: []string{tlsClient, "some-secret"},
+			tls:       peerCertificates(t, clientCert),
+			wantErr:   fosite.ErrInvalidClient.Error(),
+		},
+		{
+			name:         "client_secret_basic client with a valid client secret",
+			basicAuth:    []string{basicAuthn, testutil.PlaintextPassword1},
+			wantClientID: basicAuthn,
+		},
+		{
+			name:    "client_secret_basic client presenting only a certificate",
+			form:    url.Values{"client_id": {basicAuthn}},
+			tls:     peerCertificates(t, clientCert),
+			wantErr: fosite.ErrInvalidClient.Error(),
+		},
+		{
+			name:    "unknown client",
+			form:    url.Values{"client_id": {"client.oauth.pinniped.dev-does-not-exist"}},
+			tls:     peerCertificates(t, clientCert),
+			wantErr: fosite.ErrInvalidClient.Error(),
+		},
+	}
+	for _, test := range tests {
+		test := test
+		// Not parallel, since some test cases depend on the client assertions which were used by earlier cases.
+		t.Run(test.name, func(t *testing.T) {
+			form := test.form
+			if form == nil {
+				form = url.Values{}
+			}
+			req := httptest.NewRequest(http.MethodPost, issuer+"/oauth2/token", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if test.basicAuth != nil {
+				req.SetBasicAuth(test.basicAuth[0], test.basicAuth[1])
+			}
+			req.TLS = test.tls
+
+			ctx := context.Background()
+			if test.authenticateTwice {
+				ctx = clientassertion.WithRequestScope(ctx)
+				_, err := oauthHelper.AuthenticateClient(ctx, req, form)
+				if test.wantErr != "" {
+					require.EqualError(t, err, test.wantErr)
+					return
+				}
+				require.NoError(t, err)
+			}
+			client, err := oauthHelper.AuthenticateClient(ctx, req, form)
+			if test.wantErr != "" {
+				require.EqualError(t, err, test.wantErr)
+				require.Nil(t, client)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.wantClientID, client.GetID())
+		})
+	}
+}
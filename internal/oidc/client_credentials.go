@@ -0,0 +1,102 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package oidc
+
+import (
+	"context"
+	"time"
+
+	"github.com/ory/fosite"
+	"github.com/pkg/errors"
+
+	oidcapi "go.pinniped.dev/generated/latest/apis/supervisor/oidc"
+	"go.pinniped.dev/internal/oidc/clientregistry"
+	"go.pinniped.dev/internal/psession"
+)
+
+// ClientCredentialsIdentityFactory creates a token endpoint handler which gives the session of a client_credentials
+// grant the identity that is configured on the client. Fosite's client credentials grant handler only issues an access
+// token for the client, but that token can be used for RFC8693 token exchange, which needs a username in the session.
+func ClientCredentialsIdentityFactory(_ fosite.Configurator, _ interface{}, _ interface{}) interface{} {
+	return &clientCredentialsIdentityHandler{}
+}
+
+type clientCredentialsIdentityHandler struct{}
+
+var _ fosite.TokenEndpointHandler = (*clientCredentialsIdentityHandler)(nil)
+
+func (h *clientCredentialsIdentityHandler) HandleTokenEndpointRequest(ctx context.Context, requester fosite.AccessRequester) error {
+	if !h.CanHandleTokenEndpointRequest(ctx, requester) {
+		return errors.WithStack(fosite.ErrUnknownRequest)
+	}
+
+	// Fosite's client credentials grant handler has already checked the requested scopes against the client's
+	// allowed scopes, and it has rejected public clients. It checks the client's allowed grant types later.
+	var username string
+	var groups []string
+	if client, ok := requester.GetClient().(*clientregistry.Client); ok {
+		username, groups = client.ClientCredentialsIdentity()
+	}
+	if username == "" {
+		// This error message is copied from the similar check in fosite's flow_client_credentials.go.
+		return errors.WithStack(fosite.ErrUnauthorizedClient.WithHint("The OAuth 2.0 Client is not allowed to use authorization grant 'client_credentials'."))
+	}
+
+	// There is no user to approve the scopes, so grant the ones which we support. No refresh token is issued by
+	// this grant, so offline_access is never granted.
+	for _, scope := range []string{
+		oidcapi.ScopeOpenID,
+		oidcapi.ScopeRequestAudience,
+		oidcapi.ScopeUsername,
+		oidcapi.ScopeGroups,
+	} {
+		if requester.GetRequestedScopes().Has(scope) {
+			requester.GrantScope(scope)
+		}
+	}
+
+	session, ok := requester.GetSession().(*psession.PinnipedSession)
+	if !ok {
+		// This shouldn't really happen.
+		return errors.WithStack(fosite.ErrServerError.WithHint("Invalid session storage."))
+	}
+
+	// The subject of a client's own identity is its client ID, like in the access tokens of RFC9068.
+	clientID := requester.GetClient().GetID()
+	now := time.Now().UTC()
+	claims := session.IDTokenClaims()
+	claims.Subject = clientID
+	claims.RequestedAt = now
+	claims.AuthTime = now
+
+	extras := map[string]interface{}{oidcapi.IDTokenClaimAuthorizedParty: clientID}
+	if requester.GetGrantedScopes().Has(oidcapi.ScopeUsername) {
+		extras[oidcapi.IDTokenClaimUsername] = username
+	}
+	if requester.GetGrantedScopes().Has(oidcapi.ScopeGroups) {
+		if groups == nil {
+			groups = []string{}
+		}
+		extras[oidcapi.IDTokenClaimGroups] = groups
+	}
+	claims.Extra = extras
+
+	// The identity did not come from an upstream identity provider, so only the downstream username is known.
+	session.Custom = &psession.CustomSessionData{Username: username, CorrelationID: requester.GetID()}
+
+	return nil
+}
+
+func (h *clientCredentialsIdentityHandler) PopulateTokenEndpointResponse(_ context.Context, _ fosite.AccessRequester, _ fosite.AccessResponder) error {
+	// This handler only adjusts the request, so it never contributes to the response.
+	return errors.WithStack(fosite.ErrUnknownRequest)
+}
+
+func (h *clientCredentialsIdentityHandler) CanSkipClientAuth(_ context.Context, _ fosite.AccessRequester) bool {
+	return false
+}
+
+func (h *clientCredentialsIdentityHandler) CanHandleTokenEndpointRequest(_ context.Context, requester fosite.AccessRequester) bool {
+	return requester.GetGrantTypes().ExactOne(oidcapi.GrantTypeClientCredentials)
+}
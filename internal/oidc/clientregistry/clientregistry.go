@@ -1,4 +1,4 @@
-// Copyright 2021-2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2021-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 // Package clientregistry defines Pinniped's OAuth2/OIDC clients.
@@ -6,11 +6,14 @@ package clientregistry
 
 import (
 	"context"
+	"crypto/x509"
 	"fmt"
+	"net"
 	"strings"
 	"time"
 
 	coreosoidc "github.com/coreos/go-oidc/v3/oidc"
+	"github.com/go-ldap/ldap/v3"
 	"github.com/ory/fosite"
 	"k8s.io/apimachinery/pkg/api/errors"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -27,6 +30,35 @@ import (
 // or a dynamic client defined by an OIDCClient CR.
 type Client struct {
 	fosite.DefaultOpenIDConnectClient
+
+	// PostLogoutRedirectURIs are the allowed post_logout_redirect_uri values for OIDC RP-Initiated Logout.
+	PostLogoutRedirectURIs []string `json:"post_logout_redirect_uris,omitempty"`
+
+	// IDTokenSignedResponseAlg is the JWS algorithm which must be used to sign this client's ID tokens.
+	// When empty, the FederationDomain's default ID token signing algorithm is used.
+	IDTokenSignedResponseAlg string `json:"id_token_signed_response_alg,omitempty"`
+
+	// tlsClientAuthCertPool holds the Certificate Authorities which must have issued the client's TLS certificate
+	// when the client uses the tls_client_auth token endpoint authentication method.
+	tlsClientAuthCertPool *x509.CertPool
+
+	// tlsClientAuthSubjectDN is the required subject of the client's TLS certificate when the client uses the
+	// tls_client_auth token endpoint authentication method, unless tlsClientAuthSAN is used instead.
+	tlsClientAuthSubjectDN *ldap.DN
+
+	// tlsClientAuthSAN is the subject alternative name which the client's TLS certificate must have, when the
+	// client is identified by a subject alternative name instead of its subject.
+	tlsClientAuthSAN tlsClientAuthSAN
+
+	// clientCredentialsUsername and clientCredentialsGroups are the identity which is given to the client when it
+	// uses the client_credentials grant. The username is empty when the client is not allowed to use that grant.
+	clientCredentialsUsername string
+	clientCredentialsGroups   []string
+
+	// consentRequired means that users must be asked for their consent before the client receives an authcode.
+	// consentDisplayName is the name of the client which is shown to the users on the consent page.
+	consentRequired    bool
+	consentDisplayName string
 }
 
 // Client implements the base, OIDC, and response_mode client interfaces of Fosite.
@@ -36,6 +68,103 @@ var (
 	_ fosite.ResponseModeClient  = (*Client)(nil)
 )
 
+// VerifyTLSClientCertificate checks that the certificate chain which was presented during the TLS handshake
+// authenticates this client, as described in https://datatracker.ietf.org/doc/html/rfc8705#section-2.1.
+func (c *Client) VerifyTLSClientCertificate(peerCertificates []*x509.Certificate) error {
+	if c.TokenEndpointAuthMethod != oidcclientvalidator.TokenEndpointAuthMethodTLSClientAuth || c.tlsClientAuthCertPool == nil {
+		return fmt.Errorf("client does not use TLS client certificate authentication")
+	}
+	if len(peerCertificates) == 0 {
+		return fmt.Errorf("no TLS client certificate was presented")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range peerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	if _, err := peerCertificates[0].Verify(x509.VerifyOptions{
+		Roots:         c.tlsClientAuthCertPool,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}); err != nil {
+		return fmt.Errorf("TLS client certificate could not be verified: %w", err)
+	}
+
+	cert := peerCertificates[0]
+	if c.tlsClientAuthSubjectDN != nil {
+		// Compare the parsed names, since the same name may be written in different ways, e.g. with other spacing,
+		// escaping, or case.
+		subject, err := ldap.ParseDN(cert.Subject.String())
+		if err != nil || !subject.EqualFold(c.tlsClientAuthSubjectDN) {
+			return fmt.Errorf("TLS client certificate subject %q does not match the required subject", cert.Subject.String())
+		}
+		return nil
+	}
+	if !c.tlsClientAuthSAN.matches(cert) {
+		return fmt.Errorf("TLS client certificate does not have the required subject alternative name")
+	}
+
+	return nil
+}
+
+// tlsClientAuthSAN is a subject alternative name of the client's TLS certificate, like the tls_client_auth_san_*
+// client metadata of RFC 8705. Only one of its fields is set.
+type tlsClientAuthSAN struct {
+	dns   string
+	uri   string
+	ip    net.IP
+	email string
+}
+
+func (s tlsClientAuthSAN) matches(cert *x509.Certificate) bool {
+	switch {
+	case s.dns != "":
+		for _, name := range cert.DNSNames {
+			if strings.EqualFold(name, s.dns) {
+				return true
+			}
+		}
+	case s.uri != "":
+		for _, uri := range cert.URIs {
+			if uri.String() == s.uri {
+				return true
+			}
+		}
+	case s.ip != nil:
+		for _, ip := range cert.IPAddresses {
+			if ip.Equal(s.ip) {
+				return true
+			}
+		}
+	case s.email != "":
+		for _, email := range cert.EmailAddresses {
+			if email == s.email {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ClientCredentialsIdentity returns the username and groups which the client is given when it uses the
+// client_credentials grant. The username is empty when the client is not allowed to use that grant.
+func (c *Client) ClientCredentialsIdentity() (string, []string) {
+	return c.clientCredentialsUsername, c.clientCredentialsGroups
+}
+
+// RequiresConsent returns true when users must be asked for their consent before the client receives an authcode.
+func (c *Client) RequiresConsent() bool {
+	return c.consentRequired
+}
+
+// ConsentDisplayName returns the name of the client which is shown to users on the consent page.
+func (c *Client) ConsentDisplayName() string {
+	if c.consentDisplayName != "" {
+		return c.consentDisplayName
+	}
+	return c.GetID()
+}
+
 func (c *Client) GetResponseModes() []fosite.ResponseModeType {
 	if c.ID == oidcapi.ClientIDPinnipedCLI {
 		// The pinniped-cli client supports "" (unspecified), "query", and "form_post" response modes.
@@ -110,8 +239,15 @@ func (m *ClientManager) GetClient(ctx context.Context, id string) (fosite.Client
 		return nil, fmt.Errorf("client %q exists but is invalid or not ready", id)
 	}
 
-	// Everything is valid, so return the client. Note that it has at least one client secret to be considered valid.
-	return oidcClientCRToFositeClient(oidcClient, clientSecrets), nil
+	// Everything is valid, so return the client. Note that a confidential client which authenticates using a client
+	// secret has at least one client secret to be considered valid, while other clients have none.
+	client, err := oidcClientCRToFositeClient(oidcClient, clientSecrets)
+	if err != nil {
+		// This should not happen, since the same settings were just successfully validated.
+		plog.Debug("invalid client credentials configuration", "clientID", id, "err", err)
+		return nil, fmt.Errorf("client %q exists but is invalid or not ready", id)
+	}
+	return client, nil
 }
 
 // ClientAssertionJWTValid returns an error if the JTI is
@@ -144,6 +280,7 @@ func PinnipedCLI() *Client {
 					oidcapi.GrantTypeAuthorizationCode,
 					oidcapi.GrantTypeRefreshToken,
 					oidcapi.GrantTypeTokenExchange,
+					oidcapi.GrantTypeDeviceCode,
 				},
 				ResponseTypes: []string{"code"},
 				Scopes: fosite.Arguments{
@@ -168,8 +305,18 @@ func PinnipedCLI() *Client {
 	}
 }
 
-func oidcClientCRToFositeClient(oidcClient *configv1alpha1.OIDCClient, clientSecrets []string) *Client {
-	return &Client{
+func oidcClientCRToFositeClient(oidcClient *configv1alpha1.OIDCClient, clientSecrets []string) (*Client, error) {
+	// Public clients cannot authenticate at the token endpoint, so they rely on PKCE instead. Fosite will reject
+	// any client secret which is presented by a client whose auth method is "none".
+	tokenEndpointAuthMethod := oidcclientvalidator.TokenEndpointAuthMethodClientSecretBasic
+	if oidcClient.Spec.Public {
+		tokenEndpointAuthMethod = "none"
+		clientSecrets = nil
+	} else if oidcClient.Spec.TokenEndpointAuthMethod != "" {
+		tokenEndpointAuthMethod = string(oidcClient.Spec.TokenEndpointAuthMethod)
+	}
+
+	client := &Client{
 		DefaultOpenIDConnectClient: fosite.DefaultOpenIDConnectClient{
 			DefaultClient: &fosite.DefaultClient{
 				ID: oidcClient.Name,
@@ -183,16 +330,67 @@ func oidcClientCRToFositeClient(oidcClient *configv1alpha1.OIDCClient, clientSec
 				ResponseTypes:  []string{"code"},
 				Scopes:         scopesToArguments(oidcClient.Spec.AllowedScopes),
 				Audience:       nil,
-				Public:         false,
+				Public:         oidcClient.Spec.Public,
 			},
 			RequestURIs:                       nil,
 			JSONWebKeys:                       nil,
 			JSONWebKeysURI:                    "",
 			RequestObjectSigningAlgorithm:     "",
 			TokenEndpointAuthSigningAlgorithm: coreosoidc.RS256,
-			TokenEndpointAuthMethod:           "client_secret_basic",
+			TokenEndpointAuthMethod:           tokenEndpointAuthMethod,
 		},
+		PostLogoutRedirectURIs:   redirectURIsToStrings(oidcClient.Spec.AllowedPostLogoutRedirectURIs),
+		IDTokenSignedResponseAlg: string(oidcClient.Spec.IDTokenSignedResponseAlg),
+	}
+
+	if clientCredentials := oidcClient.Spec.ClientCredentials; clientCredentials != nil {
+		client.clientCredentialsUsername = clientCredentials.Username
+		client.clientCredentialsGroups = clientCredentials.Groups
 	}
+
+	if consent := oidcClient.Spec.Consent; consent != nil {
+		client.consentRequired = true
+		client.consentDisplayName = consent.DisplayName
+	}
+
+	switch tokenEndpointAuthMethod {
+	case oidcclientvalidator.TokenEndpointAuthMethodPrivateKeyJWT:
+		// Fosite verifies the client assertion using either the inline keys or the keys fetched from the URL.
+		client.RotatedSecrets = nil
+		if jwks := oidcClient.Spec.JWKS; jwks.Inline != "" {
+			keys, err := oidcclientvalidator.ParseJWKS(jwks.Inline)
+			if err != nil {
+				return nil, err
+			}
+			client.JSONWebKeys = keys
+		} else {
+			client.JSONWebKeysURI = jwks.URL
+		}
+		if alg := oidcClient.Spec.JWKS.SigningAlgorithm; alg != "" {
+			client.TokenEndpointAuthSigningAlgorithm = string(alg)
+		}
+	case oidcclientvalidator.TokenEndpointAuthMethodTLSClientAuth:
+		client.RotatedSecrets = nil
+		pool, err := oidcclientvalidator.ParseCertificateAuthorityData(oidcClient.Spec.TLSClientAuth.CertificateAuthorityData)
+		if err != nil {
+			return nil, err
+		}
+		client.tlsClientAuthCertPool = pool
+		tlsClientAuth := oidcClient.Spec.TLSClientAuth
+		if tlsClientAuth.SubjectDN != "" {
+			if client.tlsClientAuthSubjectDN, err = oidcclientvalidator.ParseSubjectDN(tlsClientAuth.SubjectDN); err != nil {
+				return nil, err
+			}
+		}
+		client.tlsClientAuthSAN = tlsClientAuthSAN{
+			dns:   tlsClientAuth.SANDNS,
+			uri:   tlsClientAuth.SANURI,
+			ip:    net.ParseIP(tlsClientAuth.SANIP),
+			email: tlsClientAuth.SANEmail,
+		}
+	}
+
+	return client, nil
 }
 
 func scopesToArguments(scopes []configv1alpha1.Scope) fosite.Arguments {
@@ -1,18 +1,29 @@
-// Copyright 2021-2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2021-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package clientregistry
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"math/big"
+	"net"
+	"net/url"
 	"testing"
 	"time"
 
 	"github.com/coreos/go-oidc/v3/oidc"
 	"github.com/ory/fosite"
 	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -21,6 +32,7 @@ import (
 
 	configv1alpha1 "go.pinniped.dev/generated/latest/apis/supervisor/config/v1alpha1"
 	supervisorfake "go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned/fake"
+	"go.pinniped.dev/internal/certauthority"
 	"go.pinniped.dev/internal/oidc/oidcclientvalidator"
 	"go.pinniped.dev/internal/oidcclientsecretstorage"
 	"go.pinniped.dev/internal/testutil"
@@ -35,6 +47,37 @@ func TestClientManager(t *testing.T) {
 		testUID       = "test-uid-123"
 	)
 
+	clientAssertionKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	clientJWKS, err := json.Marshal(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: clientAssertionKey.Public(), KeyID: "client-key", Algorithm: "ES256", Use: "sig"},
+	}})
+	require.NoError(t, err)
+
+	clientCA, err := certauthority.New("client CA", time.Hour)
+	require.NoError(t, err)
+	clientCAData := base64.StdEncoding.EncodeToString(clientCA.Bundle())
+	clientCert, err := clientCA.IssueClientCert("my-webapp", nil, time.Hour)
+	require.NoError(t, err)
+	otherCA, err := certauthority.New("other CA", time.Hour)
+	require.NoError(t, err)
+	otherClientCert, err := otherCA.IssueClientCert("my-webapp", nil, time.Hour)
+	require.NoError(t, err)
+	wrongSubjectClientCert, err := clientCA.IssueClientCert("not-my-webapp", nil, time.Hour)
+	require.NoError(t, err)
+	orgClientCert, err := clientCA.IssueClientCert("my-webapp", []string{"my-org"}, time.Hour)
+	require.NoError(t, err)
+	sanClientCert, sanClientCAPEM := newSelfSignedClientCert(t, &x509.Certificate{
+		Subject: pkix.Name{CommonName: "anything"},
+		URIs:    []*url.URL{{Scheme: "spiffe", Host: "example.com", Path: "/my-webapp"}},
+	})
+	parseCert := func(t *testing.T, der []byte) *x509.Certificate {
+		t.Helper()
+		cert, err := x509.ParseCertificate(der)
+		require.NoError(t, err)
+		return cert
+	}
+
 	tests := []struct {
 		name                   string
 		secrets                []*corev1.Secret
@@ -185,9 +228,11 @@ func TestClientManager(t *testing.T) {
 				{
 					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testUID},
 					Spec: configv1alpha1.OIDCClientSpec{
-						AllowedGrantTypes:   []configv1alpha1.GrantType{"authorization_code", "urn:ietf:params:oauth:grant-type:token-exchange", "refresh_token"},
-						AllowedScopes:       []configv1alpha1.Scope{"openid", "offline_access", "pinniped:request-audience", "username", "groups"},
-						AllowedRedirectURIs: []configv1alpha1.RedirectURI{"http://localhost:80", "https://foobar.com/callback"},
+						AllowedGrantTypes:             []configv1alpha1.GrantType{"authorization_code", "urn:ietf:params:oauth:grant-type:token-exchange", "refresh_token"},
+						AllowedScopes:                 []configv1alpha1.Scope{"openid", "offline_access", "pinniped:request-audience", "username", "groups"},
+						AllowedRedirectURIs:           []configv1alpha1.RedirectURI{"http://localhost:80", "https://foobar.com/callback"},
+						AllowedPostLogoutRedirectURIs: []configv1alpha1.RedirectURI{"https://foobar.com/logged-out"},
+						IDTokenSignedResponseAlg:      "RS256",
 					},
 				},
 				{
@@ -209,6 +254,8 @@ func TestClientManager(t *testing.T) {
 				require.Equal(t, testutil.HashedPassword1AtSupervisorMinCost, string(c.GetRotatedHashes()[0]))
 				require.Equal(t, testutil.HashedPassword2AtSupervisorMinCost, string(c.GetRotatedHashes()[1]))
 				require.Equal(t, []string{"http://localhost:80", "https://foobar.com/callback"}, c.GetRedirectURIs())
+				require.Equal(t, []string{"https://foobar.com/logged-out"}, c.PostLogoutRedirectURIs)
+				require.Equal(t, "RS256", c.IDTokenSignedResponseAlg)
 				require.Equal(t, fosite.Arguments{"authorization_code", "urn:ietf:params:oauth:grant-type:token-exchange", "refresh_token"}, c.GetGrantTypes())
 				require.Equal(t, fosite.Arguments{"code"}, c.GetResponseTypes())
 				require.Equal(t, fosite.Arguments{"openid", "offline_access", "pinniped:request-audience", "username", "groups"}, c.GetScopes())
@@ -223,6 +270,275 @@ func TestClientManager(t *testing.T) {
 				require.Equal(t, []fosite.ResponseModeType{"", "query"}, c.GetResponseModes())
 			},
 		},
+		{
+			name: "find a valid dynamic public client",
+			oidcClients: []*configv1alpha1.OIDCClient{
+				{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testUID},
+					Spec: configv1alpha1.OIDCClientSpec{
+						Public:              true,
+						AllowedGrantTypes:   []configv1alpha1.GrantType{"authorization_code", "refresh_token"},
+						AllowedScopes:       []configv1alpha1.Scope{"openid", "offline_access", "username", "groups"},
+						AllowedRedirectURIs: []configv1alpha1.RedirectURI{"http://127.0.0.1/callback", "com.example.app:/callback"},
+					},
+				},
+			},
+			run: func(t *testing.T, subject *ClientManager) {
+				got, err := subject.GetClient(ctx, testName)
+				require.NoError(t, err)
+				require.IsType(t, &Client{}, got)
+				c := got.(*Client)
+
+				require.Equal(t, testName, c.GetID())
+				require.Nil(t, c.GetHashedSecret())
+				require.Empty(t, c.GetRotatedHashes())
+				require.Equal(t, []string{"http://127.0.0.1/callback", "com.example.app:/callback"}, c.GetRedirectURIs())
+				require.Equal(t, fosite.Arguments{"authorization_code", "refresh_token"}, c.GetGrantTypes())
+				require.Equal(t, fosite.Arguments{"openid", "offline_access", "username", "groups"}, c.GetScopes())
+				require.True(t, c.IsPublic())
+				require.Equal(t, "none", c.GetTokenEndpointAuthMethod())
+			},
+		},
+		{
+			name: "find a valid dynamic client which uses private_key_jwt with inline keys",
+			oidcClients: []*configv1alpha1.OIDCClient{
+				{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testUID},
+					Spec: configv1alpha1.OIDCClientSpec{
+						AllowedGrantTypes:       []configv1alpha1.GrantType{"authorization_code"},
+						AllowedScopes:           []configv1alpha1.Scope{"openid"},
+						AllowedRedirectURIs:     []configv1alpha1.RedirectURI{"https://foobar.com/callback"},
+						TokenEndpointAuthMethod: "private_key_jwt",
+						JWKS:                    &configv1alpha1.OIDCClientJWKS{Inline: string(clientJWKS), SigningAlgorithm: "ES256"},
+					},
+				},
+			},
+			run: func(t *testing.T, subject *ClientManager) {
+				got, err := subject.GetClient(ctx, testName)
+				require.NoError(t, err)
+				require.IsType(t, &Client{}, got)
+				c := got.(*Client)
+
+				require.Nil(t, c.GetHashedSecret())
+				require.Empty(t, c.GetRotatedHashes())
+				require.False(t, c.IsPublic())
+				require.Equal(t, "private_key_jwt", c.GetTokenEndpointAuthMethod())
+				require.Equal(t, "ES256", c.GetTokenEndpointAuthSigningAlgorithm())
+				require.Len(t, c.GetJSONWebKeys().Keys, 1)
+				require.Equal(t, "client-key", c.GetJSONWebKeys().Keys[0].KeyID)
+				require.Empty(t, c.GetJSONWebKeysURI())
+			},
+		},
+		{
+			name: "find a valid dynamic client which uses private_key_jwt with a JWKS URL",
+			oidcClients: []*configv1alpha1.OIDCClient{
+				{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testUID},
+					Spec: configv1alpha1.OIDCClientSpec{
+						AllowedGrantTypes:       []configv1alpha1.GrantType{"authorization_code"},
+						AllowedScopes:           []configv1alpha1.Scope{"openid"},
+						AllowedRedirectURIs:     []configv1alpha1.RedirectURI{"https://foobar.com/callback"},
+						TokenEndpointAuthMethod: "private_key_jwt",
+						JWKS:                    &configv1alpha1.OIDCClientJWKS{URL: "https://foobar.com/jwks.json"},
+					},
+				},
+			},
+			run: func(t *testing.T, subject *ClientManager) {
+				got, err := subject.GetClient(ctx, testName)
+				require.NoError(t, err)
+				require.IsType(t, &Client{}, got)
+				c := got.(*Client)
+
+				require.Equal(t, "private_key_jwt", c.GetTokenEndpointAuthMethod())
+				require.Equal(t, "RS256", c.GetTokenEndpointAuthSigningAlgorithm())
+				require.Nil(t, c.GetJSONWebKeys())
+				require.Equal(t, "https://foobar.com/jwks.json", c.GetJSONWebKeysURI())
+			},
+		},
+		{
+			name: "find a valid dynamic client which uses tls_client_auth",
+			oidcClients: []*configv1alpha1.OIDCClient{
+				{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testUID},
+					Spec: configv1alpha1.OIDCClientSpec{
+						AllowedGrantTypes:       []configv1alpha1.GrantType{"authorization_code"},
+						AllowedScopes:           []configv1alpha1.Scope{"openid"},
+						AllowedRedirectURIs:     []configv1alpha1.RedirectURI{"https://foobar.com/callback"},
+						TokenEndpointAuthMethod: "tls_client_auth",
+						TLSClientAuth:           &configv1alpha1.OIDCClientTLSClientAuth{CertificateAuthorityData: clientCAData, SubjectDN: "CN=my-webapp"},
+					},
+				},
+			},
+			run: func(t *testing.T, subject *ClientManager) {
+				got, err := subject.GetClient(ctx, testName)
+				require.NoError(t, err)
+				require.IsType(t, &Client{}, got)
+				c := got.(*Client)
+
+				require.Nil(t, c.GetHashedSecret())
+				require.Empty(t, c.GetRotatedHashes())
+				require.Equal(t, "tls_client_auth", c.GetTokenEndpointAuthMethod())
+				require.Equal(t, "cn=my-webapp", c.tlsClientAuthSubjectDN.String())
+
+				require.NoError(t, c.VerifyTLSClientCertificate([]*x509.Certificate{parseCert(t, clientCert.Certificate[0])}))
+				require.EqualError(t, c.VerifyTLSClientCertificate(nil), "no TLS client certificate was presented")
+				require.ErrorContains(t, c.VerifyTLSClientCertificate([]*x509.Certificate{parseCert(t, otherClientCert.Certificate[0])}),
+					"TLS client certificate could not be verified: x509: certificate signed by unknown authority")
+				require.EqualError(t, c.VerifyTLSClientCertificate([]*x509.Certificate{parseCert(t, wrongSubjectClientCert.Certificate[0])}),
+					`TLS client certificate subject "CN=not-my-webapp" does not match the required subject`)
+			},
+		},
+		{
+			name: "find a valid dynamic client which uses tls_client_auth with a subject written in another way",
+			oidcClients: []*configv1alpha1.OIDCClient{
+				{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testUID},
+					Spec: configv1alpha1.OIDCClientSpec{
+						AllowedGrantTypes:       []configv1alpha1.GrantType{"authorization_code"},
+						AllowedScopes:           []configv1alpha1.Scope{"openid"},
+						AllowedRedirectURIs:     []configv1alpha1.RedirectURI{"https://foobar.com/callback"},
+						TokenEndpointAuthMethod: "tls_client_auth",
+						TLSClientAuth:           &configv1alpha1.OIDCClientTLSClientAuth{CertificateAuthorityData: clientCAData, SubjectDN: "cn=My-Webapp, o=my-org"},
+					},
+				},
+			},
+			run: func(t *testing.T, subject *ClientManager) {
+				got, err := subject.GetClient(ctx, testName)
+				require.NoError(t, err)
+				c := got.(*Client)
+
+				require.NoError(t, c.VerifyTLSClientCertificate([]*x509.Certificate{parseCert(t, orgClientCert.Certificate[0])}))
+				require.EqualError(t, c.VerifyTLSClientCertificate([]*x509.Certificate{parseCert(t, clientCert.Certificate[0])}),
+					`TLS client certificate subject "CN=my-webapp" does not match the required subject`)
+			},
+		},
+		{
+			name: "find a valid dynamic client which uses tls_client_auth with a subject alternative name",
+			oidcClients: []*configv1alpha1.OIDCClient{
+				{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testUID},
+					Spec: configv1alpha1.OIDCClientSpec{
+						AllowedGrantTypes:       []configv1alpha1.GrantType{"authorization_code"},
+						AllowedScopes:           []configv1alpha1.Scope{"openid"},
+						AllowedRedirectURIs:     []configv1alpha1.RedirectURI{"https://foobar.com/callback"},
+						TokenEndpointAuthMethod: "tls_client_auth",
+						TLSClientAuth: &configv1alpha1.OIDCClientTLSClientAuth{
+							CertificateAuthorityData: base64.StdEncoding.EncodeToString(append(sanClientCAPEM, clientCA.Bundle()...)),
+							SANURI:                   "spiffe://example.com/my-webapp",
+						},
+					},
+				},
+			},
+			run: func(t *testing.T, subject *ClientManager) {
+				got, err := subject.GetClient(ctx, testName)
+				require.NoError(t, err)
+				c := got.(*Client)
+
+				require.Nil(t, c.tlsClientAuthSubjectDN)
+				require.NoError(t, c.VerifyTLSClientCertificate([]*x509.Certificate{sanClientCert}))
+				require.EqualError(t, c.VerifyTLSClientCertificate([]*x509.Certificate{parseCert(t, clientCert.Certificate[0])}),
+					"TLS client certificate does not have the required subject alternative name")
+			},
+		},
+		{
+			name: "find a valid dynamic client which uses the client_credentials grant",
+			oidcClients: []*configv1alpha1.OIDCClient{
+				{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testUID},
+					Spec: configv1alpha1.OIDCClientSpec{
+						AllowedGrantTypes:   []configv1alpha1.GrantType{"authorization_code", "client_credentials", "urn:ietf:params:oauth:grant-type:token-exchange"},
+						AllowedScopes:       []configv1alpha1.Scope{"openid", "pinniped:request-audience", "username", "groups"},
+						AllowedRedirectURIs: []configv1alpha1.RedirectURI{"https://foobar.com/callback"},
+						ClientCredentials:   &configv1alpha1.OIDCClientCredentials{Username: "ci-runner", Groups: []string{"ci", "deployers"}},
+					},
+				},
+			},
+			secrets: []*corev1.Secret{
+				testutil.OIDCClientSecretStorageSecretForUID(t, testNamespace, testUID, []string{testutil.HashedPassword1AtSupervisorMinCost}),
+			},
+			run: func(t *testing.T, subject *ClientManager) {
+				got, err := subject.GetClient(ctx, testName)
+				require.NoError(t, err)
+				require.IsType(t, &Client{}, got)
+				c := got.(*Client)
+
+				require.Equal(t, fosite.Arguments{"authorization_code", "client_credentials", "urn:ietf:params:oauth:grant-type:token-exchange"}, c.GetGrantTypes())
+				username, groups := c.ClientCredentialsIdentity()
+				require.Equal(t, "ci-runner", username)
+				require.Equal(t, []string{"ci", "deployers"}, groups)
+			},
+		},
+		{
+			name: "find a valid dynamic client which requires consent",
+			oidcClients: []*configv1alpha1.OIDCClient{
+				{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testUID},
+					Spec: configv1alpha1.OIDCClientSpec{
+						AllowedGrantTypes:   []configv1alpha1.GrantType{"authorization_code"},
+						AllowedScopes:       []configv1alpha1.Scope{"openid", "username", "groups"},
+						AllowedRedirectURIs: []configv1alpha1.RedirectURI{"https://foobar.com/callback"},
+						Consent:             &configv1alpha1.OIDCClientConsent{DisplayName: "Foobar"},
+					},
+				},
+			},
+			secrets: []*corev1.Secret{
+				testutil.OIDCClientSecretStorageSecretForUID(t, testNamespace, testUID, []string{testutil.HashedPassword1AtSupervisorMinCost}),
+			},
+			run: func(t *testing.T, subject *ClientManager) {
+				got, err := subject.GetClient(ctx, testName)
+				require.NoError(t, err)
+				require.IsType(t, &Client{}, got)
+				c := got.(*Client)
+
+				require.True(t, c.RequiresConsent())
+				require.Equal(t, "Foobar", c.ConsentDisplayName())
+
+				c.consentDisplayName = ""
+				require.Equal(t, testName, c.ConsentDisplayName())
+			},
+		},
+		{
+			name: "find a dynamic public client which is invalid because it uses the client_credentials grant",
+			oidcClients: []*configv1alpha1.OIDCClient{
+				{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testUID},
+					Spec: configv1alpha1.OIDCClientSpec{
+						Public:              true,
+						AllowedGrantTypes:   []configv1alpha1.GrantType{"authorization_code", "client_credentials"},
+						AllowedScopes:       []configv1alpha1.Scope{"openid"},
+						AllowedRedirectURIs: []configv1alpha1.RedirectURI{"http://127.0.0.1/callback"},
+						ClientCredentials:   &configv1alpha1.OIDCClientCredentials{Username: "ci-runner"},
+					},
+				},
+			},
+			run: func(t *testing.T, subject *ClientManager) {
+				got, err := subject.GetClient(ctx, testName)
+				require.EqualError(t, err, fmt.Sprintf("client %q exists but is invalid or not ready", testName))
+				require.Nil(t, got)
+			},
+		},
+		{
+			name: "find a dynamic public client which is invalid because it has a client secret",
+			oidcClients: []*configv1alpha1.OIDCClient{
+				{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testUID},
+					Spec: configv1alpha1.OIDCClientSpec{
+						Public:              true,
+						AllowedGrantTypes:   []configv1alpha1.GrantType{"authorization_code"},
+						AllowedScopes:       []configv1alpha1.Scope{"openid"},
+						AllowedRedirectURIs: []configv1alpha1.RedirectURI{"http://127.0.0.1/callback"},
+					},
+				},
+			},
+			secrets: []*corev1.Secret{
+				testutil.OIDCClientSecretStorageSecretForUID(t, testNamespace, testUID, []string{testutil.HashedPassword1AtSupervisorMinCost}),
+			},
+			run: func(t *testing.T, subject *ClientManager) {
+				got, err := subject.GetClient(ctx, testName)
+				require.EqualError(t, err, fmt.Sprintf("client %q exists but is invalid or not ready", testName))
+				require.Nil(t, got)
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -259,6 +575,61 @@ func TestClientManager(t *testing.T) {
 	}
 }
 
+func TestTLSClientAuthSANMatches(t *testing.T) {
+	cert := &x509.Certificate{
+		DNSNames:       []string{"a.example.com", "webapp.example.com"},
+		URIs:           []*url.URL{{Scheme: "spiffe", Host: "example.com", Path: "/my-webapp"}},
+		IPAddresses:    []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("fd00::1")},
+		EmailAddresses: []string{"webapp@example.com"},
+	}
+
+	tests := []struct {
+		name string
+		san  tlsClientAuthSAN
+		want bool
+	}{
+		{name: "dns name", san: tlsClientAuthSAN{dns: "webapp.example.com"}, want: true},
+		{name: "dns name with other case", san: tlsClientAuthSAN{dns: "WebApp.Example.com"}, want: true},
+		{name: "other dns name", san: tlsClientAuthSAN{dns: "other.example.com"}, want: false},
+		{name: "uri", san: tlsClientAuthSAN{uri: "spiffe://example.com/my-webapp"}, want: true},
+		{name: "other uri", san: tlsClientAuthSAN{uri: "spiffe://example.com/other"}, want: false},
+		{name: "ipv4 address", san: tlsClientAuthSAN{ip: net.ParseIP("10.0.0.1")}, want: true},
+		{name: "ipv6 address", san: tlsClientAuthSAN{ip: net.ParseIP("fd00:0::1")}, want: true},
+		{name: "other ip address", san: tlsClientAuthSAN{ip: net.ParseIP("10.0.0.2")}, want: false},
+		{name: "email address", san: tlsClientAuthSAN{email: "webapp@example.com"}, want: true},
+		{name: "other email address", san: tlsClientAuthSAN{email: "other@example.com"}, want: false},
+		{name: "dns name is not an email address", san: tlsClientAuthSAN{email: "webapp.example.com"}, want: false},
+		{name: "nothing", san: tlsClientAuthSAN{}, want: false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, tt.san.matches(cert))
+		})
+	}
+}
+
+// newSelfSignedClientCert returns a self-signed TLS client certificate which is made from the template, and its
+// PEM form, which can be used as the Certificate Authority of the client.
+func newSelfSignedClientCert(t *testing.T, template *x509.Certificate) (*x509.Certificate, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template.SerialNumber = big.NewInt(1)
+	template.NotBefore = time.Now().Add(-time.Minute)
+	template.NotAfter = time.Now().Add(time.Hour)
+	template.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	template.BasicConstraintsValid = true
+	template.IsCA = true
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
 func TestPinnipedCLI(t *testing.T) {
 	requireEqualsPinnipedCLI(t, PinnipedCLI())
 }
@@ -267,7 +638,9 @@ func requireEqualsPinnipedCLI(t *testing.T, c *Client) {
 	require.Equal(t, "pinniped-cli", c.GetID())
 	require.Nil(t, c.GetHashedSecret())
 	require.Equal(t, []string{"http://127.0.0.1/callback"}, c.GetRedirectURIs())
-	require.Equal(t, fosite.Arguments{"authorization_code", "refresh_token", "urn:ietf:params:oauth:grant-type:token-exchange"}, c.GetGrantTypes())
+	require.Nil(t, c.PostLogoutRedirectURIs)
+	require.Empty(t, c.IDTokenSignedResponseAlg)
+	require.Equal(t, fosite.Arguments{"authorization_code", "refresh_token", "urn:ietf:params:oauth:grant-type:token-exchange", "urn:ietf:params:oauth:grant-type:device_code"}, c.GetGrantTypes())
 	require.Equal(t, fosite.Arguments{"code"}, c.GetResponseTypes())
 	require.Equal(t, fosite.Arguments{oidc.ScopeOpenID, oidc.ScopeOfflineAccess, "profile", "email", "pinniped:request-audience", "username", "groups"}, c.GetScopes())
 	require.True(t, c.IsPublic())
@@ -291,7 +664,8 @@ func requireEqualsPinnipedCLI(t *testing.T, c *Client) {
 		  "grant_types": [
 			"authorization_code",
 			"refresh_token",
-			"urn:ietf:params:oauth:grant-type:token-exchange"
+			"urn:ietf:params:oauth:grant-type:token-exchange",
+			"urn:ietf:params:oauth:grant-type:device_code"
 		  ],
 		  "response_types": [
 			"code"
@@ -0,0 +1,111 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package consent asks users for their consent before their identity is given to an OIDCClient which requires
+// consent, and lets users list and revoke the consents which they asked to be remembered.
+package consent
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ory/fosite"
+
+	oidcapi "go.pinniped.dev/generated/latest/apis/supervisor/oidc"
+	consentstorage "go.pinniped.dev/internal/fositestorage/consent"
+	"go.pinniped.dev/internal/fositestorage/consentrequest"
+	"go.pinniped.dev/internal/httputil/httperr"
+	"go.pinniped.dev/internal/oidc"
+	"go.pinniped.dev/internal/oidc/clientregistry"
+	"go.pinniped.dev/internal/plog"
+	"go.pinniped.dev/internal/psession"
+)
+
+const requestParamName = "request"
+
+// Responder interrupts the authorization code flow of the clients which require consent to show the consent page,
+// after the user has logged in and before the client is given an authcode.
+type Responder struct {
+	consentURL      string
+	consents        consentstorage.Storage
+	requests        consentrequest.Storage
+	requestLifespan time.Duration
+}
+
+func NewResponder(issuer string, consents consentstorage.Storage, requests consentrequest.Storage, requestLifespan time.Duration) *Responder {
+	return &Responder{
+		consentURL:      issuer + oidc.ConsentEndpointPath,
+		consents:        consents,
+		requests:        requests,
+		requestLifespan: requestLifespan,
+	}
+}
+
+// RedirectToConsentPageIfRequired redirects the user's browser to the consent page when the client requires consent
+// and the user has not already consented to all the scopes which were granted to the authorize request. It returns
+// true when it has written the response, in which case the caller must not write the authorization response.
+//
+// The session is saved with the original authorization request, so the consent page can continue the flow later.
+// The state param holds the original authorization request and the CSRF token of the user's browser.
+func (c *Responder) RedirectToConsentPageIfRequired(
+	w http.ResponseWriter,
+	r *http.Request,
+	authorizeRequester fosite.AuthorizeRequester,
+	session *psession.PinnipedSession,
+	state *oidc.UpstreamStateParamData,
+) (bool, error) {
+	client, ok := authorizeRequester.GetClient().(*clientregistry.Client)
+	if !ok || !client.RequiresConsent() {
+		return false, nil
+	}
+
+	ctx := r.Context()
+	subject := session.Fosite.Claims.Subject
+	remembered, err := c.consents.Get(ctx, client.GetID(), subject)
+	switch {
+	case err == nil && remembered.Covers(authorizeRequester.GetGrantedScopes()):
+		return false, nil
+	case err != nil && err != consentstorage.ErrNotFound: //nolint:errorlint // this is a sentinel error from the storage
+		// Asking the user again is better than failing their login.
+		plog.WarningErr("error reading remembered consent", err, "clientID", client.GetID())
+	}
+
+	id, err := c.requests.Create(ctx, &consentrequest.Request{
+		AuthParams:    state.AuthParams,
+		CorrelationID: oidc.CorrelationID(authorizeRequester),
+		Session:       session,
+		CSRFHash:      consentrequest.HashCSRF(string(state.CSRFToken)),
+		ExpiresAt:     time.Now().Add(c.requestLifespan),
+	})
+	if err != nil {
+		plog.Error("error saving consent request", err)
+		return false, httperr.New(http.StatusInternalServerError, "error saving consent request")
+	}
+
+	http.Redirect(w, r, c.consentURL+"?"+url.Values{requestParamName: {id}}.Encode(), http.StatusSeeOther)
+	return true, nil
+}
+
+// describeScopes returns the descriptions of the granted scopes, for the user to read on the consent page.
+func describeScopes(grantedScopes fosite.Arguments) []string {
+	descriptions := make([]string, 0, len(grantedScopes))
+	for _, scope := range grantedScopes {
+		switch scope {
+		case oidcapi.ScopeOpenID:
+			descriptions = append(descriptions, "Verify your identity")
+		case oidcapi.ScopeUsername:
+			descriptions = append(descriptions, "See your username")
+		case oidcapi.ScopeGroups:
+			descriptions = append(descriptions, "See your group memberships")
+		case oidcapi.ScopeOfflineAccess:
+			descriptions = append(descriptions, "Stay logged in as you while you are not using it")
+		case oidcapi.ScopeRequestAudience:
+			descriptions = append(descriptions, "Access Kubernetes clusters as you")
+		default:
+			descriptions = append(descriptions, fmt.Sprintf("Use the %q scope", scope))
+		}
+	}
+	return descriptions
+}
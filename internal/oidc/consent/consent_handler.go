@@ -0,0 +1,204 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package consent
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ory/fosite"
+
+	"go.pinniped.dev/internal/auditlog"
+	consentstorage "go.pinniped.dev/internal/fositestorage/consent"
+	"go.pinniped.dev/internal/fositestorage/consentrequest"
+	"go.pinniped.dev/internal/httputil/httperr"
+	"go.pinniped.dev/internal/httputil/securityheader"
+	"go.pinniped.dev/internal/oidc"
+	"go.pinniped.dev/internal/oidc/clientregistry"
+	"go.pinniped.dev/internal/oidc/downstreamsession"
+	"go.pinniped.dev/internal/oidc/login/consenthtml"
+	"go.pinniped.dev/internal/oidc/provider/branding"
+	"go.pinniped.dev/internal/oidc/provider/formposthtml"
+	"go.pinniped.dev/internal/plog"
+)
+
+const (
+	csrfParamName     = "csrf"
+	decisionParamName = "decision"
+	rememberParamName = "remember"
+
+	decisionAllow = "allow"
+	decisionDeny  = "deny"
+)
+
+// NewHandler returns a http.Handler that serves the consent page, where the user decides whether to give their
+// identity to a client which requires consent.
+//
+// The consent request is bound to the CSRF cookie of the browser which logged in, so only that browser can answer
+// it. Otherwise, an attacker who tricked the user into logging in could answer the consent page on their behalf.
+func NewHandler(
+	postPath string,
+	oauthHelper fosite.OAuth2Provider,
+	consents consentstorage.Storage,
+	requests consentrequest.Storage,
+	cookieCodec oidc.Decoder,
+	getBranding func() *branding.Branding,
+	auditLogger auditlog.Logger,
+) http.Handler {
+	handler := httperr.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		switch r.Method {
+		case http.MethodGet:
+			csrfFromCookie, err := oidc.ReadCSRFCookie(r, cookieCodec)
+			if err != nil {
+				return err
+			}
+			requestID := r.URL.Query().Get(requestParamName)
+			request, _, err := loadRequest(r, requests, requestID, string(csrfFromCookie))
+			if err != nil {
+				return err
+			}
+			authorizeRequester, client, err := recreateAuthorizeRequest(r, oauthHelper, request)
+			if err != nil {
+				return err
+			}
+			return consenthtml.Template().Execute(w, &consenthtml.PageData{
+				CSRFToken:         string(csrfFromCookie),
+				RequestID:         requestID,
+				ClientName:        client.ConsentDisplayName(),
+				Username:          request.Session.Custom.Username,
+				ScopeDescriptions: describeScopes(authorizeRequester.GetGrantedScopes()),
+				PostPath:          postPath,
+				Branding:          getBranding(),
+			})
+
+		case http.MethodPost:
+			if err := r.ParseForm(); err != nil {
+				return httperr.Wrap(http.StatusBadRequest, "error parsing form", err)
+			}
+			csrfFromCookie, err := oidc.ReadCSRFCookie(r, cookieCodec)
+			if err != nil {
+				return err
+			}
+			if subtle.ConstantTimeCompare([]byte(csrfFromCookie), []byte(r.PostForm.Get(csrfParamName))) != 1 {
+				return httperr.New(http.StatusForbidden, "CSRF value does not match")
+			}
+			requestID := r.PostForm.Get(requestParamName)
+			request, resourceVersion, err := loadRequest(r, requests, requestID, string(csrfFromCookie))
+			if err != nil {
+				return err
+			}
+			authorizeRequester, client, err := recreateAuthorizeRequest(r, oauthHelper, request)
+			if err != nil {
+				return err
+			}
+
+			event := auditlog.Event{
+				Type:          auditlog.ConsentGranted,
+				CorrelationID: oidc.CorrelationID(authorizeRequester),
+				Request:       auditlog.RequestFromHTTP(r),
+				User:          &auditlog.User{Username: request.Session.Custom.Username},
+				ClientID:      client.GetID(),
+			}
+
+			switch r.PostForm.Get(decisionParamName) {
+			case decisionAllow:
+				// Delete the request before continuing, so the same answer cannot be used to get a second authcode.
+				if err := requests.Delete(r.Context(), requestID); err != nil {
+					plog.Error("error deleting consent request", err)
+					return httperr.New(http.StatusInternalServerError, "error deleting consent request")
+				}
+				if r.PostForm.Get(rememberParamName) == "true" {
+					err := consents.Save(r.Context(), &consentstorage.Consent{
+						ClientID:  client.GetID(),
+						Subject:   request.Session.Fosite.Claims.Subject,
+						Username:  request.Session.Custom.Username,
+						Scopes:    authorizeRequester.GetGrantedScopes(),
+						GrantedAt: time.Now(),
+					})
+					if err != nil {
+						// The user has consented to this login, so only remembering their answer failed.
+						plog.WarningErr("error saving consent", err, "clientID", client.GetID())
+					}
+				}
+				auditLogger.Audit(event)
+				oidc.PerformAuthcodeRedirect(r, w, oauthHelper, authorizeRequester, request.Session, false)
+				return nil
+
+			case decisionDeny:
+				// Keep the declined request until it is garbage collected, which will revoke its upstream tokens.
+				request.Declined = true
+				if err := requests.Update(r.Context(), requestID, resourceVersion, request); err != nil {
+					plog.Error("error updating consent request", err)
+					return httperr.New(http.StatusInternalServerError, "error updating consent request")
+				}
+				event.Type = auditlog.ConsentDeclined
+				auditLogger.Audit(event)
+				oidc.WriteAuthorizeError(r, w, oauthHelper, authorizeRequester,
+					fosite.ErrAccessDenied.WithHint("The user did not consent to the requested scopes."), false)
+				return nil
+
+			default:
+				return httperr.New(http.StatusBadRequest, "decision param not found")
+			}
+
+		default:
+			return httperr.Newf(http.StatusMethodNotAllowed, "%s (try GET or POST)", r.Method)
+		}
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b := getBranding()
+		wrapped := securityheader.WrapWithCustomCSP(handler, consenthtml.ContentSecurityPolicyWithBranding(b))
+		if r.Method == http.MethodPost {
+			// POST requests can result in the form_post html page, so allow it with CSP headers.
+			wrapped = securityheader.WrapWithCustomCSP(handler, formposthtml.ContentSecurityPolicyWithBranding(b))
+		}
+		wrapped.ServeHTTP(w, r)
+	})
+}
+
+// loadRequest returns the consent request of the given ID, when it may still be answered by the browser which
+// has the given CSRF token. The same error is returned for all unusable requests, to avoid revealing which exist.
+func loadRequest(r *http.Request, requests consentrequest.Storage, requestID string, csrf string) (*consentrequest.Request, string, error) {
+	request, resourceVersion, err := requests.Get(r.Context(), requestID)
+	if errors.Is(err, consentrequest.ErrNotFound) {
+		return nil, "", httperr.New(http.StatusBadRequest, "consent request not found or expired")
+	}
+	if err != nil {
+		plog.Error("error reading consent request", err)
+		return nil, "", httperr.New(http.StatusInternalServerError, "error reading consent request")
+	}
+	if !consentrequest.VerifyCSRF(csrf, request.CSRFHash) || request.Declined || !time.Now().Before(request.ExpiresAt) {
+		return nil, "", httperr.New(http.StatusBadRequest, "consent request not found or expired")
+	}
+	return request, resourceVersion, nil
+}
+
+// recreateAuthorizeRequest recreates the original authorize request of the consent request, in the same way that
+// the callback endpoint recreates it from the upstream state param.
+func recreateAuthorizeRequest(r *http.Request, oauthHelper fosite.OAuth2Provider, request *consentrequest.Request) (fosite.AuthorizeRequester, *clientregistry.Client, error) {
+	authParams, err := url.ParseQuery(request.AuthParams)
+	if err != nil {
+		plog.Error("error reading consent request auth params", err)
+		return nil, nil, httperr.New(http.StatusBadRequest, "error reading consent request auth params")
+	}
+
+	authorizeRequester, err := oauthHelper.NewAuthorizeRequest(r.Context(), &http.Request{Form: authParams})
+	if err != nil {
+		plog.Error("error using consent request auth params", err, "fositeErr", oidc.FositeErrorForLog(err))
+		return nil, nil, httperr.New(http.StatusBadRequest, "error using consent request auth params")
+	}
+	oidc.RestoreCorrelationID(authorizeRequester, &oidc.UpstreamStateParamData{CorrelationID: request.CorrelationID})
+	downstreamsession.AutoApproveScopes(authorizeRequester)
+
+	client, ok := authorizeRequester.GetClient().(*clientregistry.Client)
+	if !ok {
+		// This shouldn't really happen, because only these clients can require consent.
+		return nil, nil, httperr.New(http.StatusInternalServerError, "consent request has an unexpected client")
+	}
+	return authorizeRequester, client, nil
+}
@@ -0,0 +1,352 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package consent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/ory/fosite"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"k8s.io/client-go/kubernetes/fake"
+
+	configv1alpha1 "go.pinniped.dev/generated/latest/apis/supervisor/config/v1alpha1"
+	supervisorfake "go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned/fake"
+	"go.pinniped.dev/internal/auditlog"
+	consentstorage "go.pinniped.dev/internal/fositestorage/consent"
+	"go.pinniped.dev/internal/fositestorage/consentrequest"
+	"go.pinniped.dev/internal/oidc"
+	"go.pinniped.dev/internal/oidc/downstreamsession"
+	"go.pinniped.dev/internal/oidc/jwks"
+	"go.pinniped.dev/internal/oidc/login/consenthtml"
+	"go.pinniped.dev/internal/oidc/oidcclientvalidator"
+	"go.pinniped.dev/internal/oidc/provider/branding"
+	"go.pinniped.dev/internal/oidc/provider/formposthtml"
+	"go.pinniped.dev/internal/psession"
+	"go.pinniped.dev/internal/testutil"
+)
+
+const (
+	downstreamIssuer      = "https://my-downstream-issuer.com/path"
+	downstreamRedirectURI = "http://127.0.0.1/callback"
+	dynamicClientID       = "client.oauth.pinniped.dev-test-name"
+	dynamicClientUID      = "fake-client-uid"
+	downstreamSubject     = "https://some-upstream-issuer.com?sub=some-upstream-subject"
+	happyCSRF             = "test-csrf"
+	happyPostPath         = "/path/consent"
+)
+
+func TestConsentEndpoint(t *testing.T) {
+	cookieCodec := securecookie.New([]byte("fake-cookie-hash-secret"), []byte("0123456789ABCDEF"))
+	cookieCodec.SetSerializer(securecookie.JSONEncoder{})
+	encodedCSRF, err := cookieCodec.Encode(oidc.CSRFCookieEncodingName, happyCSRF)
+	require.NoError(t, err)
+	happyCSRFCookie := oidc.CSRFCookieName + "=" + encodedCSRF
+
+	happyAuthParams := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {dynamicClientID},
+		"redirect_uri":          {downstreamRedirectURI},
+		"scope":                 {"openid username groups"},
+		"state":                 {"some-state-value-with-enough-bytes-to-exceed-min-allowed"},
+		"nonce":                 {"some-nonce-value-with-enough-bytes-to-exceed-min-allowed"},
+		"code_challenge":        {"some-challenge-value-with-enough-bytes-to-exceed-min-allowed"},
+		"code_challenge_method": {"S256"},
+	}.Encode()
+
+	happyAllowForm := func(requestID string) url.Values {
+		return url.Values{"csrf": {happyCSRF}, "request": {requestID}, "decision": {"allow"}}
+	}
+
+	tests := []struct {
+		name          string
+		method        string
+		csrfCookie    string
+		modifyRequest func(request *consentrequest.Request)
+		// form returns the form params of a POST, or the query params of a GET.
+		form func(requestID string) url.Values
+
+		wantStatus             int
+		wantBody               string
+		wantBodyContains       string
+		wantLocationRegexp     string
+		wantRequestDeleted     bool
+		wantRequestDeclined    bool
+		wantRememberedConsent  bool
+		wantAuditEventType     auditlog.EventType
+		wantAuditCorrelationID string
+	}{
+		{
+			name:       "GET shows the consent page",
+			method:     http.MethodGet,
+			csrfCookie: happyCSRFCookie,
+			wantStatus: http.StatusOK,
+			wantBody: testutil.ExpectedConsentPageHTML(consenthtml.CSS(), happyPostPath, happyCSRF, "REQUEST-ID",
+				"Some App", "some-username", []string{"Verify your identity", "See your username", "See your group memberships"}),
+		},
+		{
+			name:             "GET without the CSRF cookie",
+			method:           http.MethodGet,
+			wantStatus:       http.StatusForbidden,
+			wantBodyContains: "Forbidden: CSRF cookie is missing",
+		},
+		{
+			name:       "GET from another browser, whose CSRF cookie does not match the request",
+			method:     http.MethodGet,
+			csrfCookie: happyCSRFCookie,
+			modifyRequest: func(request *consentrequest.Request) {
+				request.CSRFHash = consentrequest.HashCSRF("some-other-csrf")
+			},
+			wantStatus:       http.StatusBadRequest,
+			wantBodyContains: "Bad Request: consent request not found or expired",
+		},
+		{
+			name:       "GET for an unknown request",
+			method:     http.MethodGet,
+			csrfCookie: happyCSRFCookie,
+			form: func(_ string) url.Values {
+				return url.Values{"request": {"some-unknown-request"}}
+			},
+			wantStatus:       http.StatusBadRequest,
+			wantBodyContains: "Bad Request: consent request not found or expired",
+		},
+		{
+			name:       "GET for an expired request",
+			method:     http.MethodGet,
+			csrfCookie: happyCSRFCookie,
+			modifyRequest: func(request *consentrequest.Request) {
+				request.ExpiresAt = time.Now().Add(-time.Second)
+			},
+			wantStatus:       http.StatusBadRequest,
+			wantBodyContains: "Bad Request: consent request not found or expired",
+		},
+		{
+			name:       "POST allow redirects to the client with an authcode",
+			method:     http.MethodPost,
+			csrfCookie: happyCSRFCookie,
+			form:       happyAllowForm,
+			wantStatus: http.StatusSeeOther,
+			wantLocationRegexp: `^` + regexp.QuoteMeta(downstreamRedirectURI) +
+				`\?code=[^&]+&scope=openid\+username\+groups&state=some-state-value-with-enough-bytes-to-exceed-min-allowed$`,
+			wantRequestDeleted:     true,
+			wantAuditEventType:     auditlog.ConsentGranted,
+			wantAuditCorrelationID: "some-correlation-id",
+		},
+		{
+			name:       "POST allow with remember also remembers the consent",
+			method:     http.MethodPost,
+			csrfCookie: happyCSRFCookie,
+			form: func(requestID string) url.Values {
+				form := happyAllowForm(requestID)
+				form.Set("remember", "true")
+				return form
+			},
+			wantStatus: http.StatusSeeOther,
+			wantLocationRegexp: `^` + regexp.QuoteMeta(downstreamRedirectURI) +
+				`\?code=[^&]+&scope=openid\+username\+groups&state=some-state-value-with-enough-bytes-to-exceed-min-allowed$`,
+			wantRequestDeleted:     true,
+			wantRememberedConsent:  true,
+			wantAuditEventType:     auditlog.ConsentGranted,
+			wantAuditCorrelationID: "some-correlation-id",
+		},
+		{
+			name:       "POST deny redirects to the client with an error",
+			method:     http.MethodPost,
+			csrfCookie: happyCSRFCookie,
+			form: func(requestID string) url.Values {
+				return url.Values{"csrf": {happyCSRF}, "request": {requestID}, "decision": {"deny"}, "remember": {"true"}}
+			},
+			wantStatus: http.StatusSeeOther,
+			wantLocationRegexp: `^` + regexp.QuoteMeta(downstreamRedirectURI) +
+				`\?error=access_denied&error_description=[^&]+&state=some-state-value-with-enough-bytes-to-exceed-min-allowed$`,
+			wantRequestDeclined:    true,
+			wantAuditEventType:     auditlog.ConsentDeclined,
+			wantAuditCorrelationID: "some-correlation-id",
+		},
+		{
+			name:       "POST for a request which was already declined",
+			method:     http.MethodPost,
+			csrfCookie: happyCSRFCookie,
+			form:       happyAllowForm,
+			modifyRequest: func(request *consentrequest.Request) {
+				request.Declined = true
+			},
+			wantStatus:          http.StatusBadRequest,
+			wantBodyContains:    "Bad Request: consent request not found or expired",
+			wantRequestDeclined: true,
+		},
+		{
+			name:       "POST with a CSRF value which does not match the cookie",
+			method:     http.MethodPost,
+			csrfCookie: happyCSRFCookie,
+			form: func(requestID string) url.Values {
+				form := happyAllowForm(requestID)
+				form.Set("csrf", "wrong-csrf")
+				return form
+			},
+			wantStatus:       http.StatusForbidden,
+			wantBodyContains: "Forbidden: CSRF value does not match",
+		},
+		{
+			name:       "POST without a decision",
+			method:     http.MethodPost,
+			csrfCookie: happyCSRFCookie,
+			form: func(requestID string) url.Values {
+				return url.Values{"csrf": {happyCSRF}, "request": {requestID}}
+			},
+			wantStatus:       http.StatusBadRequest,
+			wantBodyContains: "Bad Request: decision param not found",
+		},
+		{
+			name:             "PUT is not allowed",
+			method:           http.MethodPut,
+			csrfCookie:       happyCSRFCookie,
+			wantStatus:       http.StatusMethodNotAllowed,
+			wantBodyContains: "Method Not Allowed: PUT (try GET or POST)",
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			kubeClient := fake.NewSimpleClientset()
+			supervisorClient := supervisorfake.NewSimpleClientset()
+			secrets := kubeClient.CoreV1().Secrets("some-namespace")
+			oauthHelper := newOAuthHelper(t, kubeClient, supervisorClient)
+
+			consents := consentstorage.New(secrets, time.Now, time.Hour)
+			requests := consentrequest.New(secrets, time.Now, time.Hour)
+
+			// Simulate the callback endpoint having interrupted a login to ask for consent.
+			request := &consentrequest.Request{
+				AuthParams:    happyAuthParams,
+				CorrelationID: "some-correlation-id",
+				Session: downstreamsession.MakeDownstreamSession(downstreamSubject, "some-username", []string{"some-group"},
+					[]string{"openid", "username", "groups"}, dynamicClientID,
+					&psession.CustomSessionData{
+						Username:     "some-username",
+						ProviderUID:  "some-ldap-resource-uid",
+						ProviderName: "some-ldap-idp",
+						ProviderType: psession.ProviderTypeLDAP,
+						LDAP:         &psession.LDAPSessionData{UserDN: "some-user-dn"},
+					},
+					map[string]interface{}{}),
+				CSRFHash:  consentrequest.HashCSRF(happyCSRF),
+				ExpiresAt: time.Now().Add(time.Hour),
+			}
+			if test.modifyRequest != nil {
+				test.modifyRequest(request)
+			}
+			requestID, err := requests.Create(ctx, request)
+			require.NoError(t, err)
+
+			params := url.Values{"request": {requestID}}
+			if test.form != nil {
+				params = test.form(requestID)
+			}
+			var req *http.Request
+			if test.method == http.MethodPost {
+				req = httptest.NewRequest(test.method, happyPostPath, strings.NewReader(params.Encode()))
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			} else {
+				req = httptest.NewRequest(test.method, happyPostPath+"?"+params.Encode(), nil)
+			}
+			if test.csrfCookie != "" {
+				req.Header.Set("Cookie", test.csrfCookie)
+			}
+
+			auditLogger := auditlog.NewTestLogger(t)
+			subject := NewHandler(happyPostPath, oauthHelper, consents, requests, cookieCodec, branding.None, auditLogger)
+			rsp := httptest.NewRecorder()
+			subject.ServeHTTP(rsp, req)
+			t.Logf("response: %#v", rsp)
+			t.Logf("response body: %q", rsp.Body.String())
+
+			require.Equal(t, test.wantStatus, rsp.Code)
+			if test.method == http.MethodPost {
+				require.Equal(t, formposthtml.ContentSecurityPolicy(), rsp.Header().Get("Content-Security-Policy"))
+			} else {
+				require.Equal(t, consenthtml.ContentSecurityPolicy(), rsp.Header().Get("Content-Security-Policy"))
+			}
+			if test.wantBody != "" {
+				require.Equal(t, strings.ReplaceAll(test.wantBody, "REQUEST-ID", requestID), rsp.Body.String())
+			}
+			if test.wantBodyContains != "" {
+				require.Contains(t, rsp.Body.String(), test.wantBodyContains)
+			}
+			if test.wantLocationRegexp != "" {
+				require.Regexp(t, test.wantLocationRegexp, rsp.Header().Get("Location"))
+			}
+
+			storedRequest, _, err := requests.Get(ctx, requestID)
+			if test.wantRequestDeleted {
+				require.ErrorIs(t, err, consentrequest.ErrNotFound)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, test.wantRequestDeclined, storedRequest.Declined)
+			}
+
+			remembered, err := consents.Get(ctx, dynamicClientID, downstreamSubject)
+			if test.wantRememberedConsent {
+				require.NoError(t, err)
+				require.Equal(t, "some-username", remembered.Username)
+				require.Equal(t, []string{"openid", "username", "groups"}, remembered.Scopes)
+			} else {
+				require.ErrorIs(t, err, consentstorage.ErrNotFound)
+			}
+
+			if test.wantAuditEventType == "" {
+				require.Empty(t, auditLogger.Events())
+				return
+			}
+			require.Len(t, auditLogger.Events(), 1)
+			event := auditLogger.Events()[0]
+			require.Equal(t, test.wantAuditEventType, event.Type)
+			require.Equal(t, test.wantAuditCorrelationID, event.CorrelationID)
+			require.Equal(t, dynamicClientID, event.ClientID)
+			require.Equal(t, "some-username", event.User.Username)
+		})
+	}
+}
+
+func TestDescribeScopes(t *testing.T) {
+	require.Equal(t, []string{
+		"Verify your identity",
+		"Stay logged in as you while you are not using it",
+		"Access Kubernetes clusters as you",
+		"See your username",
+		"See your group memberships",
+		`Use the "some-other-scope" scope`,
+	}, describeScopes(fosite.Arguments{
+		"openid", "offline_access", "pinniped:request-audience", "username", "groups", "some-other-scope",
+	}))
+}
+
+// newOAuthHelper configures fosite the same way that the production code would, with a dynamic client which
+// requires consent.
+func newOAuthHelper(t *testing.T, kubeClient *fake.Clientset, supervisorClient *supervisorfake.Clientset) fosite.OAuth2Provider {
+	t.Helper()
+
+	oidcClient, secret := testutil.FullyCapableOIDCClientAndStorageSecret(t,
+		"some-namespace", dynamicClientID, dynamicClientUID, downstreamRedirectURI,
+		[]string{testutil.HashedPassword1AtGoMinCost}, oidcclientvalidator.Validate)
+	oidcClient.Spec.Consent = &configv1alpha1.OIDCClientConsent{DisplayName: "Some App"}
+	require.NoError(t, supervisorClient.Tracker().Add(oidcClient))
+	require.NoError(t, kubeClient.Tracker().Add(secret))
+
+	timeoutsConfiguration := oidc.DefaultOIDCTimeoutsConfiguration()
+	// Use lower minimum required bcrypt cost than we would use in production to keep unit the tests fast.
+	oauthStore := oidc.NewKubeStorage(kubeClient.CoreV1().Secrets("some-namespace"),
+		supervisorClient.ConfigV1alpha1().OIDCClients("some-namespace"), downstreamIssuer, timeoutsConfiguration, bcrypt.MinCost)
+	hmacSecretFunc := func() []byte { return []byte("some secret - must have at least 32 bytes") }
+	return oidc.FositeOauth2Helper(oauthStore, downstreamIssuer, hmacSecretFunc, nil, jwks.NewDynamicJWKSProvider(), timeoutsConfiguration, nil)
+}
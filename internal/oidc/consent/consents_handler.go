@@ -0,0 +1,119 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package consent
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ory/fosite"
+
+	oidcapi "go.pinniped.dev/generated/latest/apis/supervisor/oidc"
+	"go.pinniped.dev/internal/auditlog"
+	consentstorage "go.pinniped.dev/internal/fositestorage/consent"
+	"go.pinniped.dev/internal/httputil/httperr"
+	"go.pinniped.dev/internal/oidc"
+	"go.pinniped.dev/internal/plog"
+	"go.pinniped.dev/internal/psession"
+)
+
+const clientIDParamName = "client_id"
+
+type consentsResponse struct {
+	Consents []consentResponse `json:"consents"`
+}
+
+type consentResponse struct {
+	ClientID  string    `json:"client_id"`
+	Scopes    []string  `json:"scopes"`
+	GrantedAt time.Time `json:"granted_at"`
+}
+
+// NewConsentsHandler returns an http.Handler which lets a user list their remembered consents with GET, and revoke
+// the remembered consent to the client given by the client_id param with DELETE. It accepts a downstream access token
+// as a bearer token, in the same way as the UserInfo endpoint.
+//
+// The access tokens of the pinniped-cli client may see and revoke all consents of the user. The access tokens of
+// other clients may only see and revoke the user's consent to that same client, so a client cannot learn which other
+// clients the user has used.
+func NewConsentsHandler(oauthHelper fosite.OAuth2Provider, consents consentstorage.Storage, auditLogger auditlog.Logger) http.Handler {
+	return httperr.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+			return httperr.Newf(http.StatusMethodNotAllowed, "%s (try GET or DELETE)", r.Method)
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+
+		accessRequester := oidc.IntrospectBearerAccessToken(w, r, oauthHelper, "consents")
+		if accessRequester == nil {
+			return nil
+		}
+
+		session, ok := accessRequester.GetSession().(*psession.PinnipedSession)
+		if !ok || session.Fosite == nil || session.Fosite.Claims == nil {
+			return httperr.New(http.StatusInternalServerError, "session is missing its identity claims")
+		}
+		subject := session.Fosite.Claims.Subject
+
+		tokenClientID := accessRequester.GetClient().GetID()
+		clientID := r.URL.Query().Get(clientIDParamName)
+		if tokenClientID != oidcapi.ClientIDPinnipedCLI {
+			if clientID != "" && clientID != tokenClientID {
+				oidc.WriteBearerError(w, http.StatusForbidden, "insufficient_scope", "The access token may only be used for the consent to its own client.")
+				return nil
+			}
+			clientID = tokenClientID
+		}
+
+		if r.Method == http.MethodGet {
+			list, err := consents.List(r.Context(), subject)
+			if err != nil {
+				plog.Error("error listing consents", err)
+				return httperr.New(http.StatusInternalServerError, "error listing consents")
+			}
+			response := consentsResponse{Consents: []consentResponse{}}
+			for _, consent := range list {
+				if clientID != "" && consent.ClientID != clientID {
+					continue
+				}
+				response.Consents = append(response.Consents, consentResponse{
+					ClientID:  consent.ClientID,
+					Scopes:    consent.Scopes,
+					GrantedAt: consent.GrantedAt.UTC(),
+				})
+			}
+			w.Header().Set("Content-Type", "application/json")
+			return json.NewEncoder(w).Encode(response)
+		}
+
+		if clientID == "" {
+			return httperr.Newf(http.StatusBadRequest, "%s param not found", clientIDParamName)
+		}
+		err := consents.Delete(r.Context(), clientID, subject)
+		if errors.Is(err, consentstorage.ErrNotFound) {
+			return httperr.New(http.StatusNotFound, "consent not found")
+		}
+		if err != nil {
+			plog.Error("error deleting consent", err)
+			return httperr.New(http.StatusInternalServerError, "error deleting consent")
+		}
+
+		var username string
+		if session.Custom != nil {
+			username = session.Custom.Username
+		}
+		auditLogger.Audit(auditlog.Event{
+			Type:          auditlog.ConsentRevoked,
+			CorrelationID: oidc.CorrelationID(accessRequester),
+			Request:       auditlog.RequestFromHTTP(r),
+			User:          &auditlog.User{Username: username},
+			ClientID:      clientID,
+		})
+
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	})
+}
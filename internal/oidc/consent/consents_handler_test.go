@@ -0,0 +1,217 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package consent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ory/fosite/token/jwt"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+
+	supervisorfake "go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned/fake"
+	"go.pinniped.dev/internal/auditlog"
+	consentstorage "go.pinniped.dev/internal/fositestorage/consent"
+	"go.pinniped.dev/internal/psession"
+	"go.pinniped.dev/internal/testutil"
+	"go.pinniped.dev/internal/testutil/oidctestutil"
+)
+
+func TestConsentsEndpoint(t *testing.T) {
+	grantedAt := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		tokenClientID string
+		method        string
+		query         url.Values
+		noToken       bool
+
+		wantStatus          int
+		wantWWWAuthenticate string
+		wantBodyJSON        string
+		wantBodyContains    string
+		wantRemaining       []string
+		wantAuditEvent      bool
+	}{
+		{
+			name:          "GET lists all consents of the user for the pinniped-cli client",
+			tokenClientID: "pinniped-cli",
+			method:        http.MethodGet,
+			wantStatus:    http.StatusOK,
+			wantBodyJSON: `{"consents": [
+				{"client_id": "client.oauth.pinniped.dev-other", "scopes": ["openid"], "granted_at": "2030-01-01T00:00:00Z"},
+				{"client_id": "client.oauth.pinniped.dev-test-name", "scopes": ["openid", "username"], "granted_at": "2030-01-01T00:00:00Z"}
+			]}`,
+			wantRemaining: []string{"client.oauth.pinniped.dev-other", dynamicClientID},
+		},
+		{
+			name:          "GET lists one consent of the user for the pinniped-cli client when client_id is given",
+			tokenClientID: "pinniped-cli",
+			method:        http.MethodGet,
+			query:         url.Values{"client_id": {dynamicClientID}},
+			wantStatus:    http.StatusOK,
+			wantBodyJSON: `{"consents": [
+				{"client_id": "client.oauth.pinniped.dev-test-name", "scopes": ["openid", "username"], "granted_at": "2030-01-01T00:00:00Z"}
+			]}`,
+			wantRemaining: []string{"client.oauth.pinniped.dev-other", dynamicClientID},
+		},
+		{
+			name:          "GET only lists the consent to the token's own client for other clients",
+			tokenClientID: dynamicClientID,
+			method:        http.MethodGet,
+			wantStatus:    http.StatusOK,
+			wantBodyJSON: `{"consents": [
+				{"client_id": "client.oauth.pinniped.dev-test-name", "scopes": ["openid", "username"], "granted_at": "2030-01-01T00:00:00Z"}
+			]}`,
+			wantRemaining: []string{"client.oauth.pinniped.dev-other", dynamicClientID},
+		},
+		{
+			name:                "GET of the consent to another client is forbidden for other clients",
+			tokenClientID:       dynamicClientID,
+			method:              http.MethodGet,
+			query:               url.Values{"client_id": {"client.oauth.pinniped.dev-other"}},
+			wantStatus:          http.StatusForbidden,
+			wantWWWAuthenticate: `Bearer error="insufficient_scope", error_description="The access token may only be used for the consent to its own client."`,
+			wantBodyJSON:        `{"error": "insufficient_scope", "error_description": "The access token may only be used for the consent to its own client."}`,
+			wantRemaining:       []string{"client.oauth.pinniped.dev-other", dynamicClientID},
+		},
+		{
+			name:           "DELETE revokes the consent to the given client for the pinniped-cli client",
+			tokenClientID:  "pinniped-cli",
+			method:         http.MethodDelete,
+			query:          url.Values{"client_id": {"client.oauth.pinniped.dev-other"}},
+			wantStatus:     http.StatusNoContent,
+			wantRemaining:  []string{dynamicClientID},
+			wantAuditEvent: true,
+		},
+		{
+			name:             "DELETE requires a client_id for the pinniped-cli client",
+			tokenClientID:    "pinniped-cli",
+			method:           http.MethodDelete,
+			wantStatus:       http.StatusBadRequest,
+			wantBodyContains: "Bad Request: client_id param not found",
+			wantRemaining:    []string{"client.oauth.pinniped.dev-other", dynamicClientID},
+		},
+		{
+			name:             "DELETE of an unknown consent",
+			tokenClientID:    "pinniped-cli",
+			method:           http.MethodDelete,
+			query:            url.Values{"client_id": {"client.oauth.pinniped.dev-unknown"}},
+			wantStatus:       http.StatusNotFound,
+			wantBodyContains: "Not Found: consent not found",
+			wantRemaining:    []string{"client.oauth.pinniped.dev-other", dynamicClientID},
+		},
+		{
+			name:           "DELETE revokes the consent to the token's own client for other clients",
+			tokenClientID:  dynamicClientID,
+			method:         http.MethodDelete,
+			wantStatus:     http.StatusNoContent,
+			wantRemaining:  []string{"client.oauth.pinniped.dev-other"},
+			wantAuditEvent: true,
+		},
+		{
+			name:                "no access token",
+			tokenClientID:       "pinniped-cli",
+			method:              http.MethodGet,
+			noToken:             true,
+			wantStatus:          http.StatusUnauthorized,
+			wantWWWAuthenticate: "Bearer",
+			wantRemaining:       []string{"client.oauth.pinniped.dev-other", dynamicClientID},
+		},
+		{
+			name:             "POST is not allowed",
+			tokenClientID:    "pinniped-cli",
+			method:           http.MethodPost,
+			wantStatus:       http.StatusMethodNotAllowed,
+			wantBodyContains: "Method Not Allowed: POST (try GET or DELETE)",
+			wantRemaining:    []string{"client.oauth.pinniped.dev-other", dynamicClientID},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			kubeClient := fake.NewSimpleClientset()
+			supervisorClient := supervisorfake.NewSimpleClientset()
+			oauthHelper := newOAuthHelper(t, kubeClient, supervisorClient)
+
+			consents := consentstorage.New(kubeClient.CoreV1().Secrets("some-namespace"), func() time.Time { return grantedAt }, time.Hour)
+			for _, consent := range []*consentstorage.Consent{
+				{ClientID: dynamicClientID, Subject: downstreamSubject, Scopes: []string{"openid", "username"}, GrantedAt: grantedAt},
+				{ClientID: "client.oauth.pinniped.dev-other", Subject: downstreamSubject, Scopes: []string{"openid"}, GrantedAt: grantedAt},
+				{ClientID: dynamicClientID, Subject: "https://some-upstream-issuer.com?sub=some-other-user", Scopes: []string{"openid"}, GrantedAt: grantedAt},
+			} {
+				require.NoError(t, consents.Save(ctx, consent))
+			}
+
+			login := oidctestutil.SimulatedLogin{
+				ClientID:      test.tokenClientID,
+				RedirectURI:   downstreamRedirectURI,
+				Scopes:        []string{"username"},
+				IDTokenClaims: &jwt.IDTokenClaims{Subject: downstreamSubject},
+				CustomSessionData: &psession.CustomSessionData{
+					Username:     "some-username",
+					ProviderUID:  "some-ldap-resource-uid",
+					ProviderName: "some-ldap-idp",
+					ProviderType: psession.ProviderTypeLDAP,
+					LDAP:         &psession.LDAPSessionData{UserDN: "some-user-dn"},
+				},
+			}
+			if test.tokenClientID != "pinniped-cli" {
+				login.ClientSecret = testutil.PlaintextPassword1
+			}
+			accessToken := oidctestutil.SimulateLoginHavingAlreadyHappened(t, oauthHelper, login).AccessToken
+
+			req := httptest.NewRequest(test.method, "/path/oauth2/consents?"+test.query.Encode(), nil)
+			if !test.noToken {
+				req.Header.Set("Authorization", "Bearer "+accessToken)
+			}
+			auditLogger := auditlog.NewTestLogger(t)
+			subject := NewConsentsHandler(oauthHelper, consents, auditLogger)
+			rsp := httptest.NewRecorder()
+			subject.ServeHTTP(rsp, req)
+			t.Logf("response: %#v", rsp)
+			t.Logf("response body: %q", rsp.Body.String())
+
+			require.Equal(t, test.wantStatus, rsp.Code)
+			require.Equal(t, test.wantWWWAuthenticate, rsp.Header().Get("WWW-Authenticate"))
+			if test.wantBodyJSON != "" {
+				require.Equal(t, "application/json", rsp.Header().Get("Content-Type"))
+				require.Equal(t, "no-store", rsp.Header().Get("Cache-Control"))
+				require.JSONEq(t, test.wantBodyJSON, rsp.Body.String())
+			}
+			if test.wantBodyContains != "" {
+				require.Contains(t, rsp.Body.String(), test.wantBodyContains)
+			}
+
+			remaining, err := consents.List(ctx, downstreamSubject)
+			require.NoError(t, err)
+			remainingClientIDs := make([]string, 0, len(remaining))
+			for _, consent := range remaining {
+				remainingClientIDs = append(remainingClientIDs, consent.ClientID)
+			}
+			require.Equal(t, test.wantRemaining, remainingClientIDs)
+
+			// The consent of the other user is never changed.
+			_, err = consents.Get(ctx, dynamicClientID, "https://some-upstream-issuer.com?sub=some-other-user")
+			require.NoError(t, err)
+
+			if !test.wantAuditEvent {
+				require.Empty(t, auditLogger.Events())
+				return
+			}
+			require.Len(t, auditLogger.Events(), 1)
+			event := auditLogger.Events()[0]
+			require.Equal(t, auditlog.ConsentRevoked, event.Type)
+			require.Equal(t, "some-username", event.User.Username)
+			require.NotEmpty(t, event.CorrelationID)
+		})
+	}
+}
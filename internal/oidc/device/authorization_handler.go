@@ -0,0 +1,168 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package device provides the handlers for the OAuth 2.0 device authorization grant, as described in
+// https://datatracker.ietf.org/doc/html/rfc8628. This grant allows a CLI which cannot open a web browser,
+// e.g. on a jump host which the user reached by SSH, to get tokens after the user logs in using a web browser
+// on some other device.
+//
+// The user's browser goes through the same authorize, upstream login, and callback endpoints as any other
+// browser-based login. The Supervisor acts as the client of its own authorization endpoint on behalf of the
+// device, so the resulting authcode is issued to the device callback endpoint. The device then redeems that authcode
+// when it polls the token endpoint using its device code.
+package device
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ory/fosite"
+
+	oidcapi "go.pinniped.dev/generated/latest/apis/supervisor/oidc"
+	"go.pinniped.dev/internal/auditlog"
+	"go.pinniped.dev/internal/fositestorage/devicecode"
+	"go.pinniped.dev/internal/httputil/httperr"
+	"go.pinniped.dev/internal/oidc"
+	"go.pinniped.dev/internal/plog"
+)
+
+// PollingInterval is the minimum amount of time that clients must wait between their requests to the token endpoint
+// while the user has not finished their login.
+const PollingInterval = 5 * time.Second
+
+// ClientAuthenticator authenticates the client of a request, in the same way as the token endpoint.
+type ClientAuthenticator interface {
+	fosite.OAuth2Provider
+	AuthenticateClient(ctx context.Context, r *http.Request, form url.Values) (fosite.Client, error)
+}
+
+type authorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+// NewAuthorizationHandler returns a http.Handler that serves the device authorization endpoint, which gives the
+// client a device code to poll the token endpoint with, and a user code for the user to enter into the
+// verification page using their web browser.
+//
+// The number of pending device authorizations is limited per address rather than per client, so that one address
+// cannot stop everyone else from using a shared client such as the pinniped CLI.
+func NewAuthorizationHandler(
+	issuer string,
+	oauthHelper ClientAuthenticator,
+	storage devicecode.Storage,
+	deviceCodeLifespan time.Duration,
+	limits Limits,
+	auditLogger auditlog.Logger,
+) http.Handler {
+	return httperr.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		if r.Method != http.MethodPost {
+			return httperr.Newf(http.StatusMethodNotAllowed, "%s (try POST)", r.Method)
+		}
+
+		ctx := r.Context()
+		if err := r.ParseForm(); err != nil {
+			oauthHelper.WriteAccessError(ctx, w, nil, fosite.ErrInvalidRequest.WithHint("Unable to parse HTTP body, make sure to send a properly formatted form request body.").WithWrap(err))
+			return nil
+		}
+
+		client, err := oauthHelper.AuthenticateClient(ctx, r, r.PostForm)
+		if err != nil {
+			plog.Info("device authorization request error", oidc.FositeErrorForLog(err)...)
+			oauthHelper.WriteAccessError(ctx, w, nil, err)
+			return nil
+		}
+
+		if !client.GetGrantTypes().Has(oidcapi.GrantTypeDeviceCode) {
+			err := fosite.ErrUnauthorizedClient.WithHintf("The OAuth 2.0 Client is not allowed to use the grant type '%s'.", oidcapi.GrantTypeDeviceCode)
+			plog.Info("device authorization request error", oidc.FositeErrorForLog(err)...)
+			oauthHelper.WriteAccessError(ctx, w, nil, err)
+			return nil
+		}
+
+		scopes := fosite.RemoveEmpty(strings.Split(r.PostForm.Get("scope"), " "))
+		for _, scope := range scopes {
+			if !fosite.ExactScopeStrategy(client.GetScopes(), scope) {
+				err := fosite.ErrInvalidScope.WithHintf("The OAuth 2.0 Client is not allowed to request scope '%s'.", scope)
+				plog.Info("device authorization request error", oidc.FositeErrorForLog(err)...)
+				oauthHelper.WriteAccessError(ctx, w, nil, err)
+				return nil
+			}
+		}
+
+		address := limits.clientAddress(r)
+		if err := checkPendingLimits(ctx, storage, limits, address); err != nil {
+			plog.Info("device authorization request error", append(oidc.FositeErrorForLog(err), "remoteAddress", address)...)
+			oauthHelper.WriteAccessError(ctx, w, nil, err)
+			return nil
+		}
+
+		userCode, deviceCode, err := storage.Create(ctx, &devicecode.Session{
+			ClientID:        client.GetID(),
+			Scopes:          scopes,
+			UpstreamIDPName: r.PostForm.Get(oidcapi.AuthorizeUpstreamIDPNameParamName),
+			UpstreamIDPType: r.PostForm.Get(oidcapi.AuthorizeUpstreamIDPTypeParamName),
+			SourceAddress:   address,
+			ExpiresAt:       time.Now().Add(deviceCodeLifespan),
+			Status:          devicecode.StatusPending,
+		})
+		if err != nil {
+			plog.Error("error creating device code session", err)
+			oauthHelper.WriteAccessError(ctx, w, nil, fosite.ErrServerError.WithWrap(err))
+			return nil
+		}
+
+		auditLogger.Audit(auditlog.Event{
+			Type:     auditlog.DeviceAuthorizationStarted,
+			Request:  auditlog.RequestFromHTTP(r),
+			ClientID: client.GetID(),
+		})
+
+		verificationURI := issuer + oidc.DeviceVerificationEndpointPath
+		w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Pragma", "no-cache")
+		return json.NewEncoder(w).Encode(&authorizationResponse{
+			DeviceCode:              deviceCode,
+			UserCode:                userCode,
+			VerificationURI:         verificationURI,
+			VerificationURIComplete: verificationURI + "?" + url.Values{"user_code": []string{userCode}}.Encode(),
+			ExpiresIn:               int64(deviceCodeLifespan / time.Second),
+			Interval:                int64(PollingInterval / time.Second),
+		})
+	})
+}
+
+// checkPendingLimits returns an error when there are too many pending device authorizations, either from all
+// addresses together or from the given address.
+func checkPendingLimits(ctx context.Context, storage devicecode.Storage, limits Limits, address string) error {
+	pendingCount, err := storage.CountPending(ctx, "")
+	if err != nil {
+		plog.Error("error counting pending device code sessions", err)
+		return fosite.ErrServerError.WithWrap(err)
+	}
+	if pendingCount >= limits.MaxPendingAuthorizations {
+		return fosite.ErrTemporarilyUnavailable.WithHint("There are too many pending device authorizations, please try again later.")
+	}
+
+	if limits.MaxPendingAuthorizationsPerAddress == 0 {
+		return nil
+	}
+	pendingCount, err = storage.CountPending(ctx, address)
+	if err != nil {
+		plog.Error("error counting pending device code sessions", err)
+		return fosite.ErrServerError.WithWrap(err)
+	}
+	if pendingCount >= limits.MaxPendingAuthorizationsPerAddress {
+		return fosite.ErrTemporarilyUnavailable.WithHint("There are too many pending device authorizations from this address, please try again later.")
+	}
+	return nil
+}
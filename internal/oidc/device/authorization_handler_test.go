@@ -0,0 +1,300 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package device
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/fake"
+
+	supervisorfake "go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned/fake"
+	"go.pinniped.dev/internal/auditlog"
+	"go.pinniped.dev/internal/crud"
+	"go.pinniped.dev/internal/fositestorage/devicecode"
+	"go.pinniped.dev/internal/oidc"
+	"go.pinniped.dev/internal/oidc/jwks"
+	"go.pinniped.dev/internal/testutil"
+)
+
+const (
+	downstreamIssuer   = "https://my-downstream-issuer.com/path"
+	downstreamClientID = "pinniped-cli"
+
+	// testRemoteAddress is the address of the requests made by httptest.NewRequest.
+	testRemoteAddress = "192.0.2.1"
+)
+
+func TestAuthorizationEndpoint(t *testing.T) {
+	tests := []struct {
+		name            string
+		method          string
+		form            url.Values
+		pendingSessions []*devicecode.Session
+		modifyLimits    func(limits *Limits)
+		forwardedFor    string
+		wantStatus      int
+		wantError       string
+		wantSession     *devicecode.Session
+	}{
+		{
+			name:   "happy path",
+			method: http.MethodPost,
+			form: url.Values{
+				"client_id":                 {downstreamClientID},
+				"scope":                     {"openid offline_access pinniped:request-audience"},
+				"pinniped_idp_name":         {"some-idp"},
+				"pinniped_idp_type":         {"oidc"},
+				"some_unrelated_form_param": {"is ignored"},
+			},
+			wantStatus: http.StatusOK,
+			wantSession: &devicecode.Session{
+				ClientID:        downstreamClientID,
+				Scopes:          []string{"openid", "offline_access", "pinniped:request-audience"},
+				UpstreamIDPName: "some-idp",
+				UpstreamIDPType: "oidc",
+				SourceAddress:   testRemoteAddress,
+				Status:          devicecode.StatusPending,
+				Version:         "2",
+			},
+		},
+		{
+			name:       "wrong method",
+			method:     http.MethodGet,
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "unknown client",
+			method:     http.MethodPost,
+			form:       url.Values{"client_id": {"some-unknown-client"}, "scope": {"openid"}},
+			wantStatus: http.StatusUnauthorized,
+			wantError:  "invalid_client",
+		},
+		{
+			name:       "missing client",
+			method:     http.MethodPost,
+			form:       url.Values{"scope": {"openid"}},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid_request",
+		},
+		{
+			name:   "the address has pending sessions, but fewer than the maximum",
+			method: http.MethodPost,
+			form:   url.Values{"client_id": {downstreamClientID}, "scope": {"openid"}},
+			pendingSessions: append(
+				sessionsFromAddress(testRemoteAddress, devicecode.StatusPending, time.Hour, DefaultLimits().MaxPendingAuthorizationsPerAddress-1),
+				// Sessions which are not pending anymore or which have expired are not counted.
+				&devicecode.Session{SourceAddress: testRemoteAddress, Status: devicecode.StatusApproved, ExpiresAt: time.Now().Add(time.Hour)},
+				&devicecode.Session{SourceAddress: testRemoteAddress, Status: devicecode.StatusPending, ExpiresAt: time.Now().Add(-time.Minute)},
+			),
+			wantStatus: http.StatusOK,
+			wantSession: &devicecode.Session{
+				ClientID:      downstreamClientID,
+				Scopes:        []string{"openid"},
+				SourceAddress: testRemoteAddress,
+				Status:        devicecode.StatusPending,
+				Version:       "2",
+			},
+		},
+		{
+			name:            "the address has the maximum number of pending sessions",
+			method:          http.MethodPost,
+			form:            url.Values{"client_id": {downstreamClientID}, "scope": {"openid"}},
+			pendingSessions: sessionsFromAddress(testRemoteAddress, devicecode.StatusPending, time.Hour, DefaultLimits().MaxPendingAuthorizationsPerAddress),
+			wantStatus:      http.StatusServiceUnavailable,
+			wantError:       "temporarily_unavailable",
+		},
+		{
+			name:            "another address has the maximum number of pending sessions of the same client",
+			method:          http.MethodPost,
+			form:            url.Values{"client_id": {downstreamClientID}, "scope": {"openid"}},
+			pendingSessions: sessionsFromAddress("198.51.100.1", devicecode.StatusPending, time.Hour, DefaultLimits().MaxPendingAuthorizationsPerAddress),
+			wantStatus:      http.StatusOK,
+			wantSession: &devicecode.Session{
+				ClientID:      downstreamClientID,
+				Scopes:        []string{"openid"},
+				SourceAddress: testRemoteAddress,
+				Status:        devicecode.StatusPending,
+				Version:       "2",
+			},
+		},
+		{
+			name:            "the maximum number of pending sessions from all addresses together",
+			method:          http.MethodPost,
+			form:            url.Values{"client_id": {downstreamClientID}, "scope": {"openid"}},
+			modifyLimits:    func(limits *Limits) { limits.MaxPendingAuthorizations = 3 },
+			pendingSessions: append(sessionsFromAddress("198.51.100.1", devicecode.StatusPending, time.Hour, 2), sessionsFromAddress("198.51.100.2", devicecode.StatusPending, time.Hour, 1)...),
+			wantStatus:      http.StatusServiceUnavailable,
+			wantError:       "temporarily_unavailable",
+		},
+		{
+			name:         "the X-Forwarded-For header is ignored when the request did not come from a trusted proxy",
+			method:       http.MethodPost,
+			form:         url.Values{"client_id": {downstreamClientID}, "scope": {"openid"}},
+			forwardedFor: "203.0.113.1",
+			wantStatus:   http.StatusOK,
+			wantSession: &devicecode.Session{
+				ClientID:      downstreamClientID,
+				Scopes:        []string{"openid"},
+				SourceAddress: testRemoteAddress,
+				Status:        devicecode.StatusPending,
+				Version:       "2",
+			},
+		},
+		{
+			name:   "many users behind a trusted proxy, one of whom has the maximum number of pending sessions",
+			method: http.MethodPost,
+			form:   url.Values{"client_id": {downstreamClientID}, "scope": {"openid"}},
+			modifyLimits: func(limits *Limits) {
+				limits.TrustedProxies = []*net.IPNet{{IP: net.IPv4(192, 0, 2, 0), Mask: net.CIDRMask(24, 32)}}
+			},
+			pendingSessions: append(
+				sessionsFromAddress("203.0.113.66", devicecode.StatusPending, time.Hour, DefaultLimits().MaxPendingAuthorizationsPerAddress),
+				append(
+					sessionsFromAddress("203.0.113.2", devicecode.StatusPending, time.Hour, 1),
+					sessionsFromAddress("203.0.113.3", devicecode.StatusPending, time.Hour, 1)...,
+				)...,
+			),
+			// The client's own address is the rightmost address which was not added by a trusted proxy.
+			forwardedFor: "198.51.100.99, 203.0.113.1, 192.0.2.2",
+			wantStatus:   http.StatusOK,
+			wantSession: &devicecode.Session{
+				ClientID:      downstreamClientID,
+				Scopes:        []string{"openid"},
+				SourceAddress: "203.0.113.1",
+				Status:        devicecode.StatusPending,
+				Version:       "2",
+			},
+		},
+		{
+			name:   "the user behind a trusted proxy who has the maximum number of pending sessions",
+			method: http.MethodPost,
+			form:   url.Values{"client_id": {downstreamClientID}, "scope": {"openid"}},
+			modifyLimits: func(limits *Limits) {
+				limits.TrustedProxies = []*net.IPNet{{IP: net.IPv4(192, 0, 2, 0), Mask: net.CIDRMask(24, 32)}}
+			},
+			pendingSessions: sessionsFromAddress("203.0.113.66", devicecode.StatusPending, time.Hour, DefaultLimits().MaxPendingAuthorizationsPerAddress),
+			forwardedFor:    "203.0.113.66",
+			wantStatus:      http.StatusServiceUnavailable,
+			wantError:       "temporarily_unavailable",
+		},
+		{
+			name:            "no limit per address",
+			method:          http.MethodPost,
+			form:            url.Values{"client_id": {downstreamClientID}, "scope": {"openid"}},
+			modifyLimits:    func(limits *Limits) { limits.MaxPendingAuthorizationsPerAddress = 0 },
+			pendingSessions: sessionsFromAddress(testRemoteAddress, devicecode.StatusPending, time.Hour, DefaultLimits().MaxPendingAuthorizationsPerAddress),
+			wantStatus:      http.StatusOK,
+			wantSession: &devicecode.Session{
+				ClientID:      downstreamClientID,
+				Scopes:        []string{"openid"},
+				SourceAddress: testRemoteAddress,
+				Status:        devicecode.StatusPending,
+				Version:       "2",
+			},
+		},
+		{
+			name:       "scope which is not allowed for the client",
+			method:     http.MethodPost,
+			form:       url.Values{"client_id": {downstreamClientID}, "scope": {"openid some-other-scope"}},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid_scope",
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			kubeClient := fake.NewSimpleClientset()
+			supervisorClient := supervisorfake.NewSimpleClientset()
+			secrets := kubeClient.CoreV1().Secrets("some-namespace")
+
+			// Use lower minimum required bcrypt cost than we would use in production to keep unit the tests fast.
+			oauthStore := oidc.NewKubeStorage(secrets, supervisorClient.ConfigV1alpha1().OIDCClients("some-namespace"), downstreamIssuer, oidc.DefaultOIDCTimeoutsConfiguration(), bcrypt.MinCost)
+			hmacSecretFunc := func() []byte { return []byte("some secret - must have at least 32 bytes") }
+			oauthHelper := oidc.FositeOauth2Helper(oauthStore, downstreamIssuer, hmacSecretFunc, nil, jwks.NewDynamicJWKSProvider(), oidc.DefaultOIDCTimeoutsConfiguration(), nil)
+			storage := devicecode.New(secrets, time.Now, time.Hour)
+			for _, session := range test.pendingSessions {
+				_, _, err := storage.Create(context.Background(), session)
+				require.NoError(t, err)
+			}
+			auditLogger := auditlog.NewTestLogger(t)
+
+			limits := DefaultLimits()
+			if test.modifyLimits != nil {
+				test.modifyLimits(&limits)
+			}
+
+			subject := NewAuthorizationHandler(downstreamIssuer, oauthHelper, storage, 15*time.Minute, limits, auditLogger)
+
+			req := httptest.NewRequest(test.method, "/oauth2/device_authorization", strings.NewReader(test.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if test.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", test.forwardedFor)
+			}
+			rsp := httptest.NewRecorder()
+			subject.ServeHTTP(rsp, req)
+			t.Logf("response: %#v", rsp)
+			t.Logf("response body: %q", rsp.Body.String())
+
+			require.Equal(t, test.wantStatus, rsp.Code)
+
+			if test.wantError != "" {
+				var body map[string]interface{}
+				require.NoError(t, json.Unmarshal(rsp.Body.Bytes(), &body))
+				require.Equal(t, test.wantError, body["error"])
+			}
+
+			if test.wantSession == nil {
+				require.Empty(t, auditLogger.Events())
+				testutil.RequireNumberOfSecretsMatchingLabelSelector(t, secrets, labels.Set{crud.SecretLabelKey: devicecode.TypeLabelValue}, len(test.pendingSessions))
+				return
+			}
+
+			testutil.RequireEqualContentType(t, rsp.Header().Get("Content-Type"), "application/json")
+			require.Equal(t, "no-store", rsp.Header().Get("Cache-Control"))
+			var body authorizationResponse
+			require.NoError(t, json.Unmarshal(rsp.Body.Bytes(), &body))
+			require.Regexp(t, "^[BCDFGHJKLMNPQRSTVWXZ]{4}-[BCDFGHJKLMNPQRSTVWXZ]{4}$", body.UserCode)
+			require.Equal(t, downstreamIssuer+"/oauth2/device", body.VerificationURI)
+			require.Equal(t, downstreamIssuer+"/oauth2/device?user_code="+body.UserCode, body.VerificationURIComplete)
+			require.Equal(t, int64(900), body.ExpiresIn)
+			require.Equal(t, int64(5), body.Interval)
+
+			session, _, err := storage.Get(context.Background(), body.UserCode)
+			require.NoError(t, err)
+			userCode, deviceCodeSecret, err := devicecode.SplitCode(body.DeviceCode)
+			require.NoError(t, err)
+			require.Equal(t, strings.ReplaceAll(body.UserCode, "-", ""), userCode)
+			require.True(t, devicecode.VerifyHash(deviceCodeSecret, session.DeviceCodeHash))
+			testutil.RequireTimeInDelta(t, time.Now().Add(15*time.Minute), session.ExpiresAt, time.Minute)
+
+			// Clear the fields which cannot be predicted before comparing.
+			session.DeviceCodeHash = ""
+			session.ExpiresAt = time.Time{}
+			require.Equal(t, test.wantSession, session)
+
+			require.Len(t, auditLogger.Events(), 1)
+			require.Equal(t, auditlog.DeviceAuthorizationStarted, auditLogger.Events()[0].Type)
+			require.Equal(t, downstreamClientID, auditLogger.Events()[0].ClientID)
+		})
+	}
+}
+
+func sessionsFromAddress(sourceAddress string, status devicecode.Status, expiresIn time.Duration, count int) []*devicecode.Session {
+	sessions := make([]*devicecode.Session, count)
+	for i := range sessions {
+		sessions[i] = &devicecode.Session{ClientID: downstreamClientID, SourceAddress: sourceAddress, Status: status, ExpiresAt: time.Now().Add(expiresIn)}
+	}
+	return sessions
+}
@@ -0,0 +1,88 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package device
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"go.pinniped.dev/internal/auditlog"
+	"go.pinniped.dev/internal/fositestorage/devicecode"
+	"go.pinniped.dev/internal/httputil/httperr"
+	"go.pinniped.dev/internal/httputil/securityheader"
+	"go.pinniped.dev/internal/oidc/login/devicehtml"
+	"go.pinniped.dev/internal/plog"
+)
+
+const (
+	approvedMessage = "You have been logged in. You may now close this window and return to your device."
+	deniedMessage   = "Your login failed. You may now close this window."
+)
+
+// NewCallbackHandler returns a http.Handler that serves the device callback endpoint, which is the redirect URI
+// of the authorization requests which were started by the device verification page. It saves the authcode for
+// the device to redeem at the token endpoint, or remembers that the login failed.
+func NewCallbackHandler(storage devicecode.Storage, auditLogger auditlog.Logger) http.Handler {
+	handler := httperr.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		if r.Method != http.MethodGet {
+			return httperr.Newf(http.StatusMethodNotAllowed, "%s (try GET)", r.Method)
+		}
+
+		ctx := r.Context()
+		params := r.URL.Query()
+
+		userCode, stateSecret, err := devicecode.SplitCode(params.Get("state"))
+		if err != nil {
+			return httperr.New(http.StatusBadRequest, "error reading state")
+		}
+		session, resourceVersion, err := storage.Get(ctx, userCode)
+		if errors.Is(err, devicecode.ErrInvalidCode) {
+			return httperr.New(http.StatusBadRequest, "error reading state")
+		}
+		if err != nil {
+			plog.Error("error reading device code session", err)
+			return httperr.New(http.StatusInternalServerError, "error reading device code session")
+		}
+		if !devicecode.VerifyHash(stateSecret, session.StateHash) {
+			return httperr.New(http.StatusBadRequest, "error reading state")
+		}
+		if session.Status != devicecode.StatusPending {
+			return httperr.New(http.StatusBadRequest, "device authorization was already completed")
+		}
+
+		event := auditlog.Event{
+			Type:     auditlog.DeviceAuthorizationApproved,
+			Request:  auditlog.RequestFromHTTP(r),
+			ClientID: session.ClientID,
+		}
+		message := approvedMessage
+		if errorParam := params.Get("error"); errorParam != "" {
+			session.Status = devicecode.StatusDenied
+			event.Type = auditlog.DeviceAuthorizationDenied
+			event.Message = strings.TrimSpace(errorParam + " " + params.Get("error_description"))
+			message = deniedMessage
+		} else {
+			code := params.Get("code")
+			if code == "" {
+				return httperr.New(http.StatusBadRequest, "code param not found")
+			}
+			session.Status = devicecode.StatusApproved
+			session.AuthorizationCode = code
+		}
+		// Clear the state so the same callback cannot be used twice.
+		session.StateHash = ""
+
+		if err := storage.Update(ctx, userCode, resourceVersion, session); err != nil {
+			plog.Error("error updating device code session", err)
+			return httperr.New(http.StatusInternalServerError, "error updating device code session")
+		}
+
+		auditLogger.Audit(event)
+
+		return devicehtml.Template().Execute(w, &devicehtml.PageData{Message: message})
+	})
+
+	return securityheader.WrapWithCustomCSP(handler, devicehtml.ContentSecurityPolicy())
+}
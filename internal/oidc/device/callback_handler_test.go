@@ -0,0 +1,202 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package device
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"go.pinniped.dev/internal/auditlog"
+	"go.pinniped.dev/internal/fositestorage/devicecode"
+	"go.pinniped.dev/internal/oidc/login/devicehtml"
+	"go.pinniped.dev/internal/testutil"
+)
+
+func TestCallbackEndpoint(t *testing.T) {
+	const happyStateSecret = "some-state-secret"
+
+	tests := []struct {
+		name          string
+		method        string
+		modifyParams  func(params url.Values)
+		modifySession func(session *devicecode.Session)
+
+		wantStatus            int
+		wantBody              string
+		wantBodyContains      string
+		wantSessionStatus     devicecode.Status
+		wantAuthorizationCode string
+		wantAuditEvent        *auditlog.Event
+	}{
+		{
+			name:                  "login succeeded",
+			method:                http.MethodGet,
+			wantStatus:            http.StatusOK,
+			wantBody:              testutil.ExpectedDeviceMessagePageHTML(devicehtml.CSS(), approvedMessage),
+			wantSessionStatus:     devicecode.StatusApproved,
+			wantAuthorizationCode: "some-authcode",
+			wantAuditEvent:        &auditlog.Event{Type: auditlog.DeviceAuthorizationApproved, ClientID: downstreamClientID},
+		},
+		{
+			name:   "login failed",
+			method: http.MethodGet,
+			modifyParams: func(params url.Values) {
+				params.Del("code")
+				params.Set("error", "access_denied")
+				params.Set("error_description", "The resource owner or authorization server denied the request.")
+			},
+			wantStatus:        http.StatusOK,
+			wantBody:          testutil.ExpectedDeviceMessagePageHTML(devicehtml.CSS(), deniedMessage),
+			wantSessionStatus: devicecode.StatusDenied,
+			wantAuditEvent: &auditlog.Event{
+				Type:     auditlog.DeviceAuthorizationDenied,
+				ClientID: downstreamClientID,
+				Message:  "access_denied The resource owner or authorization server denied the request.",
+			},
+		},
+		{
+			name:   "missing code",
+			method: http.MethodGet,
+			modifyParams: func(params url.Values) {
+				params.Del("code")
+			},
+			wantStatus:        http.StatusBadRequest,
+			wantBodyContains:  "Bad Request: code param not found",
+			wantSessionStatus: devicecode.StatusPending,
+		},
+		{
+			name:   "state has the wrong secret",
+			method: http.MethodGet,
+			modifyParams: func(params url.Values) {
+				userCode, _, err := devicecode.SplitCode(params.Get("state"))
+				require.NoError(t, err)
+				params.Set("state", devicecode.JoinCode(userCode, "wrong-secret"))
+			},
+			wantStatus:        http.StatusBadRequest,
+			wantBodyContains:  "Bad Request: error reading state",
+			wantSessionStatus: devicecode.StatusPending,
+		},
+		{
+			name:   "state is for an unknown session",
+			method: http.MethodGet,
+			modifyParams: func(params url.Values) {
+				params.Set("state", devicecode.JoinCode("ZZZZZZZZ", happyStateSecret))
+			},
+			wantStatus:        http.StatusBadRequest,
+			wantBodyContains:  "Bad Request: error reading state",
+			wantSessionStatus: devicecode.StatusPending,
+		},
+		{
+			name:   "state is malformed",
+			method: http.MethodGet,
+			modifyParams: func(params url.Values) {
+				params.Set("state", "not-a-state")
+			},
+			wantStatus:        http.StatusBadRequest,
+			wantBodyContains:  "Bad Request: error reading state",
+			wantSessionStatus: devicecode.StatusPending,
+		},
+		{
+			name:   "state was already used",
+			method: http.MethodGet,
+			modifySession: func(session *devicecode.Session) {
+				session.StateHash = ""
+			},
+			wantStatus:        http.StatusBadRequest,
+			wantBodyContains:  "Bad Request: error reading state",
+			wantSessionStatus: devicecode.StatusPending,
+		},
+		{
+			name:   "session was already completed",
+			method: http.MethodGet,
+			modifySession: func(session *devicecode.Session) {
+				session.Status = devicecode.StatusDenied
+			},
+			wantStatus:        http.StatusBadRequest,
+			wantBodyContains:  "Bad Request: device authorization was already completed",
+			wantSessionStatus: devicecode.StatusDenied,
+		},
+		{
+			name:              "wrong method",
+			method:            http.MethodPost,
+			wantStatus:        http.StatusMethodNotAllowed,
+			wantBodyContains:  "Method Not Allowed: POST (try GET)",
+			wantSessionStatus: devicecode.StatusPending,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			secrets := fake.NewSimpleClientset().CoreV1().Secrets("some-namespace")
+			storage := devicecode.New(secrets, time.Now, time.Hour)
+
+			// Simulate the verification page having started a login.
+			userCode, _, err := storage.Create(ctx, &devicecode.Session{
+				ClientID:  downstreamClientID,
+				Scopes:    []string{"openid"},
+				ExpiresAt: time.Now().Add(time.Hour),
+				StateHash: devicecode.Hash(happyStateSecret),
+				Status:    devicecode.StatusPending,
+			})
+			require.NoError(t, err)
+			if test.modifySession != nil {
+				session, resourceVersion, err := storage.Get(ctx, userCode)
+				require.NoError(t, err)
+				test.modifySession(session)
+				require.NoError(t, storage.Update(ctx, userCode, resourceVersion, session))
+			}
+
+			params := url.Values{
+				"code":  {"some-authcode"},
+				"state": {devicecode.JoinCode(userCode, happyStateSecret)},
+			}
+			if test.modifyParams != nil {
+				test.modifyParams(params)
+			}
+
+			auditLogger := auditlog.NewTestLogger(t)
+			subject := NewCallbackHandler(storage, auditLogger)
+			req := httptest.NewRequest(test.method, "/oauth2/device/callback?"+params.Encode(), nil)
+			rsp := httptest.NewRecorder()
+			subject.ServeHTTP(rsp, req)
+			t.Logf("response: %#v", rsp)
+			t.Logf("response body: %q", rsp.Body.String())
+
+			require.Equal(t, test.wantStatus, rsp.Code)
+			testutil.RequireSecurityHeadersWithLoginPageCSPs(t, rsp)
+
+			if test.wantBody != "" {
+				require.Equal(t, test.wantBody, rsp.Body.String())
+			}
+			if test.wantBodyContains != "" {
+				require.Contains(t, rsp.Body.String(), test.wantBodyContains)
+			}
+
+			session, _, err := storage.Get(ctx, userCode)
+			require.NoError(t, err)
+			require.Equal(t, test.wantSessionStatus, session.Status)
+			require.Equal(t, test.wantAuthorizationCode, session.AuthorizationCode)
+
+			if test.wantAuditEvent == nil {
+				require.Empty(t, auditLogger.Events())
+				return
+			}
+			// The same state cannot be used again.
+			require.Empty(t, session.StateHash)
+			require.Len(t, auditLogger.Events(), 1)
+			event := auditLogger.Events()[0]
+			require.Equal(t, test.wantAuditEvent.Type, event.Type)
+			require.Equal(t, test.wantAuditEvent.ClientID, event.ClientID)
+			require.Equal(t, test.wantAuditEvent.Message, event.Message)
+		})
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package device
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Limits configures how much the device authorization grant may be used by unauthenticated requests. Anyone may
+// start a device authorization for a public client, and each one is stored until it expires, so the number of
+// pending device authorizations is limited. User codes are short enough to be typed by people, so the number of
+// failed attempts to enter a user code is limited too, as recommended by
+// https://datatracker.ietf.org/doc/html/rfc8628#section-5.1.
+//
+// The limits per address stop one client from using up the limits for everyone else. The address of each request
+// is the address of its TCP connection, unless that connection came from one of the TrustedProxies. When the
+// Supervisor is behind a load balancer or an ingress which hides the addresses of clients, all clients appear to
+// have the same address, so the limits per address apply to all of them together unless TrustedProxies is set.
+type Limits struct {
+	// MaxPendingAuthorizations limits the number of pending device authorizations, from all addresses together.
+	MaxPendingAuthorizations int
+	// MaxPendingAuthorizationsPerAddress limits the number of pending device authorizations which were started from
+	// each address. Zero means that there is no limit per address.
+	MaxPendingAuthorizationsPerAddress int
+	// MaxFailedAttempts limits the number of failed attempts to enter a user code during each window of five
+	// minutes, from all addresses together.
+	MaxFailedAttempts int
+	// MaxFailedAttemptsPerAddress limits the number of failed attempts to enter a user code from each address during
+	// each window of five minutes. Zero means that there is no limit per address.
+	MaxFailedAttemptsPerAddress int
+	// TrustedProxies are the networks of the proxies which are trusted to add the address of the client which
+	// they forwarded a request for to its X-Forwarded-For header. When nil, the header is always ignored.
+	TrustedProxies []*net.IPNet
+}
+
+// DefaultLimits returns the limits which are used unless the Supervisor's static configuration changes them.
+func DefaultLimits() Limits {
+	return Limits{
+		MaxPendingAuthorizations:           1000,
+		MaxPendingAuthorizationsPerAddress: 100,
+		MaxFailedAttempts:                  500,
+		// Many users may share an address, e.g. behind a NAT, so more failures are allowed per address than
+		// per browser. This still stops attackers who start a new browser session for each guess.
+		MaxFailedAttemptsPerAddress: 50,
+	}
+}
+
+// clientAddress returns the address of the client which sent the request. When the request came from a trusted
+// proxy, the X-Forwarded-For header is read from right to left, skipping the addresses of other trusted proxies,
+// since only the rightmost entries were added by trusted proxies and the others may have been chosen by the client.
+func (l Limits) clientAddress(r *http.Request) string {
+	address := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		address = host
+	}
+	if !l.isTrustedProxy(address) {
+		return address
+	}
+
+	var forwarded []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		forwarded = append(forwarded, strings.Split(header, ",")...)
+	}
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if ip == nil {
+			// The header is malformed, so the last trusted proxy is the best known address of the client.
+			return address
+		}
+		address = ip.String()
+		if !l.isTrustedProxy(address) {
+			return address
+		}
+	}
+	return address
+}
+
+func (l Limits) isTrustedProxy(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, network := range l.TrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
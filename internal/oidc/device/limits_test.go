@@ -0,0 +1,111 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package device
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientAddress(t *testing.T) {
+	mustParseCIDR := func(cidr string) *net.IPNet {
+		_, network, err := net.ParseCIDR(cidr)
+		require.NoError(t, err)
+		return network
+	}
+	trustedProxies := []*net.IPNet{mustParseCIDR("10.0.0.0/8"), mustParseCIDR("fd00::/8")}
+
+	tests := []struct {
+		name           string
+		remoteAddr     string
+		forwardedFor   []string
+		trustedProxies []*net.IPNet
+		wantAddress    string
+	}{
+		{
+			name:        "no trusted proxies",
+			remoteAddr:  "203.0.113.1:1234",
+			wantAddress: "203.0.113.1",
+		},
+		{
+			name:         "no trusted proxies ignores the header",
+			remoteAddr:   "10.0.0.1:1234",
+			forwardedFor: []string{"203.0.113.1"},
+			wantAddress:  "10.0.0.1",
+		},
+		{
+			name:           "request which did not come from a trusted proxy ignores the header",
+			remoteAddr:     "198.51.100.1:1234",
+			forwardedFor:   []string{"203.0.113.1"},
+			trustedProxies: trustedProxies,
+			wantAddress:    "198.51.100.1",
+		},
+		{
+			name:           "request from a trusted proxy",
+			remoteAddr:     "10.0.0.1:1234",
+			forwardedFor:   []string{"203.0.113.1"},
+			trustedProxies: trustedProxies,
+			wantAddress:    "203.0.113.1",
+		},
+		{
+			name:           "request through several trusted proxies",
+			remoteAddr:     "10.0.0.1:1234",
+			forwardedFor:   []string{"203.0.113.1, 10.0.0.3", "10.0.0.2"},
+			trustedProxies: trustedProxies,
+			wantAddress:    "203.0.113.1",
+		},
+		{
+			name:           "addresses chosen by the client are ignored",
+			remoteAddr:     "10.0.0.1:1234",
+			forwardedFor:   []string{"198.51.100.1, 10.0.0.9, 203.0.113.1"},
+			trustedProxies: trustedProxies,
+			wantAddress:    "203.0.113.1",
+		},
+		{
+			name:           "request from a trusted proxy without the header",
+			remoteAddr:     "10.0.0.1:1234",
+			trustedProxies: trustedProxies,
+			wantAddress:    "10.0.0.1",
+		},
+		{
+			name:           "malformed header",
+			remoteAddr:     "10.0.0.1:1234",
+			forwardedFor:   []string{"203.0.113.1, not-an-address, 10.0.0.2"},
+			trustedProxies: trustedProxies,
+			wantAddress:    "10.0.0.2",
+		},
+		{
+			name:           "IPv6",
+			remoteAddr:     "[fd00::1]:1234",
+			forwardedFor:   []string{"2001:db8::1"},
+			trustedProxies: trustedProxies,
+			wantAddress:    "2001:db8::1",
+		},
+		{
+			name:        "remote address without a port",
+			remoteAddr:  "203.0.113.1",
+			wantAddress: "203.0.113.1",
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodPost, "/oauth2/device", nil)
+			req.RemoteAddr = test.remoteAddr
+			for _, value := range test.forwardedFor {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+			limits := DefaultLimits()
+			limits.TrustedProxies = test.trustedProxies
+
+			require.Equal(t, test.wantAddress, limits.clientAddress(req))
+		})
+	}
+}
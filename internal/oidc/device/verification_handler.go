@@ -0,0 +1,269 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package device
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	oidcapi "go.pinniped.dev/generated/latest/apis/supervisor/oidc"
+	"go.pinniped.dev/internal/fositestorage/devicecode"
+	"go.pinniped.dev/internal/httputil/httperr"
+	"go.pinniped.dev/internal/httputil/securityheader"
+	"go.pinniped.dev/internal/oidc"
+	"go.pinniped.dev/internal/oidc/csrftoken"
+	"go.pinniped.dev/internal/oidc/login/devicehtml"
+	"go.pinniped.dev/internal/plog"
+	"go.pinniped.dev/pkg/oidcclient/nonce"
+	"go.pinniped.dev/pkg/oidcclient/pkce"
+)
+
+const (
+	userCodeParamName = "user_code"
+	csrfParamName     = "csrf"
+
+	invalidUserCodeMessage = "The code is invalid or expired. Please check the code and try again."
+	tooManyAttemptsMessage = "Too many invalid codes were entered. Please wait a few minutes and try again."
+
+	failedAttemptsWindow     = 5 * time.Minute
+	maxFailedAttemptsPerCSRF = 5
+
+	// globalFailuresKey is the key of the failures from all addresses together.
+	globalFailuresKey = "global"
+)
+
+// NewVerificationHandler returns a http.Handler that serves the device verification page, where the user enters
+// the user code which was shown by their device.
+//
+// After the user enters a valid user code, their browser is redirected to the authorization endpoint to log in
+// on behalf of the device. The CSRF token protects against other websites making the user's browser submit a user
+// code of a device authorization which was started by an attacker, which would give the user's tokens to the attacker.
+func NewVerificationHandler(
+	issuer string,
+	postPath string,
+	storage devicecode.Storage,
+	generateCSRF func() (csrftoken.CSRFToken, error),
+	generateNonce func() (nonce.Nonce, error),
+	generatePKCE func() (pkce.Code, error),
+	cookieCodec oidc.Codec,
+	limits Limits,
+) http.Handler {
+	// User codes are short enough to be typed by people, so guessing them must be throttled, as recommended by
+	// https://datatracker.ietf.org/doc/html/rfc8628#section-5.1. Failures are counted per browser session, i.e.
+	// per CSRF cookie, per source address, and for all addresses together, which also limits the storage used to
+	// count them. They are kept in the device code storage, so they are counted the same way by all Supervisor pods.
+	handler := httperr.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		switch r.Method {
+		case http.MethodGet:
+			csrfValue, err := csrfValueForPage(w, r, cookieCodec, generateCSRF)
+			if err != nil {
+				return err
+			}
+			return devicehtml.Template().Execute(w, &devicehtml.PageData{
+				CSRFToken: string(csrfValue),
+				UserCode:  r.URL.Query().Get(userCodeParamName),
+				PostPath:  postPath,
+			})
+
+		case http.MethodPost:
+			if err := r.ParseForm(); err != nil {
+				return httperr.Wrap(http.StatusBadRequest, "error parsing form", err)
+			}
+			csrfFromCookie := readCSRFCookie(r, cookieCodec)
+			if csrfFromCookie == "" {
+				return httperr.New(http.StatusForbidden, "CSRF cookie is missing")
+			}
+			if subtle.ConstantTimeCompare([]byte(csrfFromCookie), []byte(r.PostForm.Get(csrfParamName))) != 1 {
+				return httperr.New(http.StatusForbidden, "CSRF value does not match")
+			}
+
+			userCode := r.PostForm.Get(userCodeParamName)
+			address := limits.clientAddress(r)
+			maxFailuresByKey := limits.maxFailuresByKey(csrfFromCookie, address)
+			throttled, err := tooManyFailures(r.Context(), storage, maxFailuresByKey)
+			if err != nil {
+				return err
+			}
+			if throttled {
+				plog.Info("too many failed device verification attempts", "remoteAddress", address)
+				w.WriteHeader(http.StatusTooManyRequests)
+				return devicehtml.Template().Execute(w, &devicehtml.PageData{
+					CSRFToken:    string(csrfFromCookie),
+					UserCode:     userCode,
+					AlertMessage: tooManyAttemptsMessage,
+					PostPath:     postPath,
+				})
+			}
+
+			authorizeURL, err := startLogin(r, issuer, storage, userCode, generateNonce, generatePKCE)
+			if errors.Is(err, devicecode.ErrInvalidCode) {
+				for key := range maxFailuresByKey {
+					if err := storage.RecordFailure(r.Context(), key, failedAttemptsWindow); err != nil {
+						return httperr.Wrap(http.StatusInternalServerError, "error recording failed attempt", err)
+					}
+				}
+				return devicehtml.Template().Execute(w, &devicehtml.PageData{
+					CSRFToken:    string(csrfFromCookie),
+					UserCode:     userCode,
+					AlertMessage: invalidUserCodeMessage,
+					PostPath:     postPath,
+				})
+			}
+			if err != nil {
+				return err
+			}
+
+			http.Redirect(w, r, authorizeURL, http.StatusSeeOther)
+			return nil
+
+		default:
+			return httperr.Newf(http.StatusMethodNotAllowed, "%s (try GET or POST)", r.Method)
+		}
+	})
+
+	return securityheader.WrapWithCustomCSP(handler, devicehtml.ContentSecurityPolicy())
+}
+
+// startLogin remembers the values which are needed to act as the client of the authorization endpoint on behalf
+// of the device, and returns the URL of the authorization request.
+func startLogin(
+	r *http.Request,
+	issuer string,
+	storage devicecode.Storage,
+	userCode string,
+	generateNonce func() (nonce.Nonce, error),
+	generatePKCE func() (pkce.Code, error),
+) (string, error) {
+	ctx := r.Context()
+	session, resourceVersion, err := storage.Get(ctx, userCode)
+	if err != nil {
+		if errors.Is(err, devicecode.ErrInvalidCode) {
+			return "", err
+		}
+		plog.Error("error reading device code session", err)
+		return "", httperr.New(http.StatusInternalServerError, "error reading device code session")
+	}
+	// The user may enter the same code again while it is pending, e.g. after they abandoned their first attempt.
+	if session.Status != devicecode.StatusPending || !time.Now().Before(session.ExpiresAt) {
+		return "", devicecode.ErrInvalidCode
+	}
+
+	stateSecret, err := devicecode.GenerateSecret()
+	if err != nil {
+		return "", httperr.Wrap(http.StatusInternalServerError, "error generating state param", err)
+	}
+	nonceValue, err := generateNonce()
+	if err != nil {
+		return "", httperr.Wrap(http.StatusInternalServerError, "error generating nonce param", err)
+	}
+	pkceValue, err := generatePKCE()
+	if err != nil {
+		return "", httperr.Wrap(http.StatusInternalServerError, "error generating PKCE param", err)
+	}
+
+	session.StateHash = devicecode.Hash(stateSecret)
+	session.Nonce = string(nonceValue)
+	session.CodeVerifier = string(pkceValue)
+	if err := storage.Update(ctx, userCode, resourceVersion, session); err != nil {
+		plog.Error("error updating device code session", err)
+		return "", httperr.New(http.StatusInternalServerError, "error updating device code session")
+	}
+
+	oauth2Config := &oauth2.Config{
+		ClientID:    session.ClientID,
+		Endpoint:    oauth2.Endpoint{AuthURL: issuer + oidc.AuthorizationEndpointPath},
+		RedirectURL: issuer + oidc.DeviceCallbackEndpointPath,
+		Scopes:      session.Scopes,
+	}
+	authCodeOptions := []oauth2.AuthCodeOption{nonceValue.Param(), pkceValue.Challenge(), pkceValue.Method()}
+	if session.UpstreamIDPName != "" {
+		authCodeOptions = append(authCodeOptions, oauth2.SetAuthURLParam(oidcapi.AuthorizeUpstreamIDPNameParamName, session.UpstreamIDPName))
+	}
+	if session.UpstreamIDPType != "" {
+		authCodeOptions = append(authCodeOptions, oauth2.SetAuthURLParam(oidcapi.AuthorizeUpstreamIDPTypeParamName, session.UpstreamIDPType))
+	}
+	return oauth2Config.AuthCodeURL(devicecode.JoinCode(userCode, stateSecret), authCodeOptions...), nil
+}
+
+// csrfValueForPage returns the CSRF value from the CSRF cookie, or sets a new CSRF cookie when there was none.
+// This is the same cookie which is used by the authorization endpoint.
+func csrfValueForPage(w http.ResponseWriter, r *http.Request, cookieCodec oidc.Codec, generateCSRF func() (csrftoken.CSRFToken, error)) (csrftoken.CSRFToken, error) {
+	if csrfFromCookie := readCSRFCookie(r, cookieCodec); csrfFromCookie != "" {
+		return csrfFromCookie, nil
+	}
+
+	csrfValue, err := generateCSRF()
+	if err != nil {
+		return "", httperr.Wrap(http.StatusInternalServerError, "error generating CSRF token", err)
+	}
+	encodedCSRFValue, err := cookieCodec.Encode(oidc.CSRFCookieEncodingName, csrfValue)
+	if err != nil {
+		return "", httperr.Wrap(http.StatusInternalServerError, "error encoding CSRF cookie", err)
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidc.CSRFCookieName,
+		Value:    encodedCSRFValue,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Secure:   true,
+		Path:     "/",
+	})
+	return csrfValue, nil
+}
+
+func readCSRFCookie(r *http.Request, cookieCodec oidc.Decoder) csrftoken.CSRFToken {
+	receivedCSRFCookie, err := r.Cookie(oidc.CSRFCookieName)
+	if err != nil {
+		return ""
+	}
+	var csrfFromCookie csrftoken.CSRFToken
+	if err := cookieCodec.Decode(oidc.CSRFCookieEncodingName, receivedCSRFCookie.Value, &csrfFromCookie); err != nil {
+		// Ignore an invalid cookie, e.g. after the cookie encoding keys were rotated, and make a new one.
+		return ""
+	}
+	return csrfFromCookie
+}
+
+// csrfFailuresKey and addressFailuresKey return the keys of the failures of a browser session and of an address.
+// They are prefixed, so that a CSRF token can never count towards the failures of an address or vice versa.
+func csrfFailuresKey(csrf csrftoken.CSRFToken) string {
+	return "csrf:" + string(csrf)
+}
+
+func addressFailuresKey(address string) string {
+	return "address:" + address
+}
+
+// maxFailuresByKey returns the keys whose failures are counted for an attempt to enter a user code, along with the
+// maximum number of failures of each key.
+func (l Limits) maxFailuresByKey(csrf csrftoken.CSRFToken, address string) map[string]int {
+	maxFailuresByKey := map[string]int{
+		csrfFailuresKey(csrf): maxFailedAttemptsPerCSRF,
+		globalFailuresKey:     l.MaxFailedAttempts,
+	}
+	if l.MaxFailedAttemptsPerAddress > 0 {
+		maxFailuresByKey[addressFailuresKey(address)] = l.MaxFailedAttemptsPerAddress
+	}
+	return maxFailuresByKey
+}
+
+// tooManyFailures returns true when any of the keys has already failed its maximum number of times in its current
+// window.
+func tooManyFailures(ctx context.Context, storage devicecode.Storage, maxFailuresByKey map[string]int) (bool, error) {
+	for key, maxFailures := range maxFailuresByKey {
+		count, err := storage.CountFailures(ctx, key, failedAttemptsWindow)
+		if err != nil {
+			return false, httperr.Wrap(http.StatusInternalServerError, "error counting failed attempts", err)
+		}
+		if count >= maxFailures {
+			return true, nil
+		}
+	}
+	return false, nil
+}
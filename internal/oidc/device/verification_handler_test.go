@@ -0,0 +1,439 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package device
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"go.pinniped.dev/internal/fositestorage/devicecode"
+	"go.pinniped.dev/internal/oidc/csrftoken"
+	"go.pinniped.dev/internal/oidc/login/devicehtml"
+	"go.pinniped.dev/internal/testutil"
+	"go.pinniped.dev/pkg/oidcclient/nonce"
+	"go.pinniped.dev/pkg/oidcclient/pkce"
+)
+
+const (
+	happyCSRF     = "test-csrf"
+	happyNonce    = "test-nonce"
+	happyPKCE     = "test-pkce"
+	happyPostPath = "/path/oauth2/device"
+
+	// This is the S256 code challenge of happyPKCE.
+	happyPKCEChallenge = "VVaezYqum7reIhoavCHD1n2d-piN3r_mywoYj7fCR7g"
+)
+
+func TestVerificationEndpoint(t *testing.T) {
+	cookieCodec := securecookie.New([]byte("fake-hash-secret"), []byte("0123456789ABCDEF"))
+	cookieCodec.SetSerializer(securecookie.JSONEncoder{})
+	encodedCSRF, err := cookieCodec.Encode("csrf", csrftoken.CSRFToken(happyCSRF))
+	require.NoError(t, err)
+	happyCSRFCookie := "__Host-pinniped-csrf=" + encodedCSRF
+
+	tests := []struct {
+		name          string
+		method        string
+		query         string
+		form          url.Values
+		cookie        string
+		modifySession func(session *devicecode.Session)
+		generateCSRF  func() (csrftoken.CSRFToken, error)
+
+		wantStatus          int
+		wantBody            string
+		wantBodyContains    string
+		wantSetCSRFCookie   bool
+		wantRedirectToLogin bool
+	}{
+		{
+			name:              "GET without a CSRF cookie sets one and shows the form",
+			method:            http.MethodGet,
+			wantStatus:        http.StatusOK,
+			wantBody:          testutil.ExpectedDevicePageHTML(devicehtml.CSS(), happyPostPath, happyCSRF, "", ""),
+			wantSetCSRFCookie: true,
+		},
+		{
+			name:       "GET with a CSRF cookie prefills the user code",
+			method:     http.MethodGet,
+			query:      "?user_code=BCDF-GHJK",
+			cookie:     happyCSRFCookie,
+			wantStatus: http.StatusOK,
+			wantBody:   testutil.ExpectedDevicePageHTML(devicehtml.CSS(), happyPostPath, happyCSRF, "BCDF-GHJK", ""),
+		},
+		{
+			name:             "GET when generating the CSRF token fails",
+			method:           http.MethodGet,
+			generateCSRF:     func() (csrftoken.CSRFToken, error) { return "", errors.New("some error") },
+			wantStatus:       http.StatusInternalServerError,
+			wantBodyContains: "Internal Server Error: error generating CSRF token",
+		},
+		{
+			name:                "POST with a valid user code redirects to the authorization endpoint",
+			method:              http.MethodPost,
+			form:                url.Values{"csrf": {happyCSRF}},
+			cookie:              happyCSRFCookie,
+			wantStatus:          http.StatusSeeOther,
+			wantRedirectToLogin: true,
+		},
+		{
+			name:       "POST with an unknown user code shows the form again",
+			method:     http.MethodPost,
+			form:       url.Values{"csrf": {happyCSRF}, "user_code": {"ZZZZ-ZZZZ"}},
+			cookie:     happyCSRFCookie,
+			wantStatus: http.StatusOK,
+			wantBody:   testutil.ExpectedDevicePageHTML(devicehtml.CSS(), happyPostPath, happyCSRF, "ZZZZ-ZZZZ", invalidUserCodeMessage),
+		},
+		{
+			name:       "POST with a malformed user code shows the form again",
+			method:     http.MethodPost,
+			form:       url.Values{"csrf": {happyCSRF}, "user_code": {"nope"}},
+			cookie:     happyCSRFCookie,
+			wantStatus: http.StatusOK,
+			wantBody:   testutil.ExpectedDevicePageHTML(devicehtml.CSS(), happyPostPath, happyCSRF, "nope", invalidUserCodeMessage),
+		},
+		{
+			name:   "POST with an expired user code shows the form again",
+			method: http.MethodPost,
+			form:   url.Values{"csrf": {happyCSRF}},
+			cookie: happyCSRFCookie,
+			modifySession: func(session *devicecode.Session) {
+				session.ExpiresAt = time.Now().Add(-time.Second)
+			},
+			wantStatus:       http.StatusOK,
+			wantBodyContains: invalidUserCodeMessage,
+		},
+		{
+			name:   "POST with a user code which was already used shows the form again",
+			method: http.MethodPost,
+			form:   url.Values{"csrf": {happyCSRF}},
+			cookie: happyCSRFCookie,
+			modifySession: func(session *devicecode.Session) {
+				session.Status = devicecode.StatusApproved
+			},
+			wantStatus:       http.StatusOK,
+			wantBodyContains: invalidUserCodeMessage,
+		},
+		{
+			name:             "POST without a CSRF cookie",
+			method:           http.MethodPost,
+			form:             url.Values{"csrf": {happyCSRF}},
+			wantStatus:       http.StatusForbidden,
+			wantBodyContains: "Forbidden: CSRF cookie is missing",
+		},
+		{
+			name:             "POST with the wrong CSRF value",
+			method:           http.MethodPost,
+			form:             url.Values{"csrf": {"wrong"}},
+			cookie:           happyCSRFCookie,
+			wantStatus:       http.StatusForbidden,
+			wantBodyContains: "Forbidden: CSRF value does not match",
+		},
+		{
+			name:             "POST without a CSRF value",
+			method:           http.MethodPost,
+			cookie:           happyCSRFCookie,
+			wantStatus:       http.StatusForbidden,
+			wantBodyContains: "Forbidden: CSRF value does not match",
+		},
+		{
+			name:             "wrong method",
+			method:           http.MethodPut,
+			wantStatus:       http.StatusMethodNotAllowed,
+			wantBodyContains: "Method Not Allowed: PUT (try GET or POST)",
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			secrets := fake.NewSimpleClientset().CoreV1().Secrets("some-namespace")
+			storage := devicecode.New(secrets, time.Now, time.Hour)
+
+			userCode, _, err := storage.Create(ctx, &devicecode.Session{
+				ClientID:        downstreamClientID,
+				Scopes:          []string{"openid", "offline_access"},
+				UpstreamIDPName: "some-idp",
+				UpstreamIDPType: "ldap",
+				ExpiresAt:       time.Now().Add(time.Hour),
+				Status:          devicecode.StatusPending,
+			})
+			require.NoError(t, err)
+			if test.modifySession != nil {
+				session, resourceVersion, err := storage.Get(ctx, userCode)
+				require.NoError(t, err)
+				test.modifySession(session)
+				require.NoError(t, storage.Update(ctx, userCode, resourceVersion, session))
+			}
+			if test.form != nil && !test.form.Has("user_code") {
+				test.form.Set("user_code", userCode)
+			}
+
+			generateCSRF := func() (csrftoken.CSRFToken, error) { return happyCSRF, nil }
+			if test.generateCSRF != nil {
+				generateCSRF = test.generateCSRF
+			}
+			subject := NewVerificationHandler(
+				downstreamIssuer,
+				happyPostPath,
+				storage,
+				generateCSRF,
+				func() (nonce.Nonce, error) { return happyNonce, nil },
+				func() (pkce.Code, error) { return happyPKCE, nil },
+				cookieCodec,
+				DefaultLimits(),
+			)
+
+			req := httptest.NewRequest(test.method, "/oauth2/device"+test.query, strings.NewReader(test.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if test.cookie != "" {
+				req.Header.Set("Cookie", test.cookie)
+			}
+			rsp := httptest.NewRecorder()
+			subject.ServeHTTP(rsp, req)
+			t.Logf("response: %#v", rsp)
+			t.Logf("response body: %q", rsp.Body.String())
+
+			require.Equal(t, test.wantStatus, rsp.Code)
+			testutil.RequireSecurityHeadersWithLoginPageCSPs(t, rsp)
+
+			if test.wantBody != "" {
+				require.Equal(t, test.wantBody, rsp.Body.String())
+			}
+			if test.wantBodyContains != "" {
+				require.Contains(t, rsp.Body.String(), test.wantBodyContains)
+			}
+
+			if test.wantSetCSRFCookie {
+				require.Len(t, rsp.Result().Cookies(), 1)
+				cookie := rsp.Result().Cookies()[0]
+				require.Equal(t, "__Host-pinniped-csrf", cookie.Name)
+				var csrfFromCookie csrftoken.CSRFToken
+				require.NoError(t, cookieCodec.Decode("csrf", cookie.Value, &csrfFromCookie))
+				require.Equal(t, csrftoken.CSRFToken(happyCSRF), csrfFromCookie)
+				require.True(t, cookie.HttpOnly)
+				require.True(t, cookie.Secure)
+				require.Equal(t, http.SameSiteLaxMode, cookie.SameSite)
+			} else {
+				require.Empty(t, rsp.Header().Values("Set-Cookie"))
+			}
+
+			session, _, err := storage.Get(ctx, userCode)
+			require.NoError(t, err)
+
+			if !test.wantRedirectToLogin {
+				require.Empty(t, session.StateHash)
+				return
+			}
+
+			redirectURL, err := url.Parse(rsp.Header().Get("Location"))
+			require.NoError(t, err)
+			require.Equal(t, downstreamIssuer+"/oauth2/authorize", redirectURL.Scheme+"://"+redirectURL.Host+redirectURL.Path)
+			redirectParams := redirectURL.Query()
+			state := redirectParams.Get("state")
+			redirectParams.Del("state")
+			require.Equal(t, url.Values{
+				"response_type":         {"code"},
+				"client_id":             {downstreamClientID},
+				"redirect_uri":          {downstreamIssuer + "/oauth2/device/callback"},
+				"scope":                 {"openid offline_access"},
+				"nonce":                 {happyNonce},
+				"code_challenge":        {happyPKCEChallenge},
+				"code_challenge_method": {"S256"},
+				"pinniped_idp_name":     {"some-idp"},
+				"pinniped_idp_type":     {"ldap"},
+			}, redirectParams)
+
+			stateUserCode, stateSecret, err := devicecode.SplitCode(state)
+			require.NoError(t, err)
+			require.Equal(t, strings.ReplaceAll(userCode, "-", ""), stateUserCode)
+			require.True(t, devicecode.VerifyHash(stateSecret, session.StateHash))
+			require.Equal(t, happyNonce, session.Nonce)
+			require.Equal(t, happyPKCE, session.CodeVerifier)
+			require.Equal(t, devicecode.StatusPending, session.Status)
+		})
+	}
+}
+
+func TestVerificationEndpointThrottlesFailedAttempts(t *testing.T) {
+	ctx := context.Background()
+	cookieCodec := securecookie.New([]byte("fake-hash-secret"), []byte("0123456789ABCDEF"))
+	cookieCodec.SetSerializer(securecookie.JSONEncoder{})
+
+	now := time.Now()
+	clock := func() time.Time { return now }
+	secrets := fake.NewSimpleClientset().CoreV1().Secrets("some-namespace")
+	storage := devicecode.New(secrets, clock, time.Hour)
+	userCode, _, err := storage.Create(ctx, &devicecode.Session{
+		ClientID:  downstreamClientID,
+		Scopes:    []string{"openid"},
+		ExpiresAt: now.Add(time.Hour),
+		Status:    devicecode.StatusPending,
+	})
+	require.NoError(t, err)
+
+	newSubject := func() http.Handler {
+		return NewVerificationHandler(
+			downstreamIssuer,
+			happyPostPath,
+			storage,
+			func() (csrftoken.CSRFToken, error) { return happyCSRF, nil },
+			func() (nonce.Nonce, error) { return happyNonce, nil },
+			func() (pkce.Code, error) { return happyPKCE, nil },
+			cookieCodec,
+			DefaultLimits(),
+		)
+	}
+	subject := newSubject()
+
+	submit := func(t *testing.T, csrf string, remoteAddr string, code string) *httptest.ResponseRecorder {
+		t.Helper()
+		encodedCSRF, err := cookieCodec.Encode("csrf", csrftoken.CSRFToken(csrf))
+		require.NoError(t, err)
+		form := url.Values{"csrf": {csrf}, "user_code": {code}}
+		req := httptest.NewRequest(http.MethodPost, "/oauth2/device", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Cookie", "__Host-pinniped-csrf="+encodedCSRF)
+		req.RemoteAddr = remoteAddr
+		rsp := httptest.NewRecorder()
+		subject.ServeHTTP(rsp, req)
+		return rsp
+	}
+	requireInvalid := func(t *testing.T, rsp *httptest.ResponseRecorder) {
+		t.Helper()
+		require.Equal(t, http.StatusOK, rsp.Code)
+		require.Contains(t, rsp.Body.String(), "The code is invalid or expired.")
+	}
+	requireThrottled := func(t *testing.T, rsp *httptest.ResponseRecorder) {
+		t.Helper()
+		require.Equal(t, http.StatusTooManyRequests, rsp.Code)
+		require.Contains(t, rsp.Body.String(), "Too many invalid codes were entered.")
+	}
+	const wrongCode = "BBBB-BBBB"
+
+	// Each browser session may only fail a few times, after which even the correct code is not accepted.
+	for i := 0; i < maxFailedAttemptsPerCSRF; i++ {
+		requireInvalid(t, submit(t, "csrf-1", "1.2.3.4:1234", wrongCode))
+	}
+	requireThrottled(t, submit(t, "csrf-1", "1.2.3.4:1234", userCode))
+
+	// The failures are shared by all handlers which use the same storage, e.g. on other Supervisor pods.
+	subject = newSubject()
+	requireThrottled(t, submit(t, "csrf-1", "1.2.3.4:1234", userCode))
+
+	// Another browser session from the same address may still enter the correct code.
+	require.Equal(t, http.StatusSeeOther, submit(t, "csrf-2", "1.2.3.4:5678", userCode).Code)
+
+	// The failures are forgotten after the window ends.
+	now = now.Add(failedAttemptsWindow)
+	requireInvalid(t, submit(t, "csrf-1", "1.2.3.4:1234", wrongCode))
+
+	// An address may fail more times, but not an unlimited number of times, even when using new browser sessions.
+	for i := 1; i < DefaultLimits().MaxFailedAttemptsPerAddress; i++ {
+		requireInvalid(t, submit(t, fmt.Sprintf("csrf-for-attempt-%d", i), "1.2.3.4:1234", wrongCode))
+	}
+	requireThrottled(t, submit(t, "some-new-csrf", "1.2.3.4:1234", wrongCode))
+	requireInvalid(t, submit(t, "some-new-csrf", "5.6.7.8:1234", wrongCode))
+}
+
+func TestVerificationEndpointLimitsBehindProxy(t *testing.T) {
+	cookieCodec := securecookie.New([]byte("fake-hash-secret"), []byte("0123456789ABCDEF"))
+	cookieCodec.SetSerializer(securecookie.JSONEncoder{})
+	const (
+		proxyAddress = "10.0.0.1:443"
+		wrongCode    = "BBBB-BBBB"
+	)
+
+	// setup returns a function which submits a user code for the user at the given address, through the proxy,
+	// along with the user code of a pending device authorization.
+	setup := func(t *testing.T, limits Limits) (func(t *testing.T, csrf string, userAddress string, code string) int, string) {
+		t.Helper()
+		ctx := context.Background()
+		storage := devicecode.New(fake.NewSimpleClientset().CoreV1().Secrets("some-namespace"), time.Now, time.Hour)
+		userCode, _, err := storage.Create(ctx, &devicecode.Session{
+			ClientID:  downstreamClientID,
+			Scopes:    []string{"openid"},
+			ExpiresAt: time.Now().Add(time.Hour),
+			Status:    devicecode.StatusPending,
+		})
+		require.NoError(t, err)
+
+		subject := NewVerificationHandler(
+			downstreamIssuer,
+			happyPostPath,
+			storage,
+			func() (csrftoken.CSRFToken, error) { return happyCSRF, nil },
+			func() (nonce.Nonce, error) { return happyNonce, nil },
+			func() (pkce.Code, error) { return happyPKCE, nil },
+			cookieCodec,
+			limits,
+		)
+		submit := func(t *testing.T, csrf string, userAddress string, code string) int {
+			t.Helper()
+			encodedCSRF, err := cookieCodec.Encode("csrf", csrftoken.CSRFToken(csrf))
+			require.NoError(t, err)
+			form := url.Values{"csrf": {csrf}, "user_code": {code}}
+			req := httptest.NewRequest(http.MethodPost, "/oauth2/device", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Set("Cookie", "__Host-pinniped-csrf="+encodedCSRF)
+			req.Header.Set("X-Forwarded-For", userAddress)
+			req.RemoteAddr = proxyAddress
+			rsp := httptest.NewRecorder()
+			subject.ServeHTTP(rsp, req)
+			return rsp.Code
+		}
+		return submit, userCode
+	}
+
+	t.Run("without trusted proxies, all users behind the proxy share the failures of its address", func(t *testing.T) {
+		submit, userCode := setup(t, DefaultLimits())
+
+		for i := 0; i < DefaultLimits().MaxFailedAttemptsPerAddress; i++ {
+			require.Equal(t, http.StatusOK, submit(t, fmt.Sprintf("attacker-csrf-%d", i), "203.0.113.66", wrongCode))
+		}
+		require.Equal(t, http.StatusTooManyRequests, submit(t, "user-csrf", "203.0.113.1", userCode))
+	})
+
+	t.Run("with trusted proxies, each user behind the proxy has their own failures", func(t *testing.T) {
+		limits := DefaultLimits()
+		limits.TrustedProxies = []*net.IPNet{{IP: net.IPv4(10, 0, 0, 0), Mask: net.CIDRMask(8, 32)}}
+		submit, userCode := setup(t, limits)
+
+		for i := 0; i < limits.MaxFailedAttemptsPerAddress; i++ {
+			require.Equal(t, http.StatusOK, submit(t, fmt.Sprintf("attacker-csrf-%d", i), "203.0.113.66", wrongCode))
+		}
+		require.Equal(t, http.StatusTooManyRequests, submit(t, "attacker-csrf", "203.0.113.66", wrongCode))
+
+		// Many other users behind the same proxy may still make mistakes and then enter their codes.
+		for i := 1; i <= 20; i++ {
+			require.Equal(t, http.StatusOK, submit(t, fmt.Sprintf("user-csrf-%d", i), fmt.Sprintf("203.0.113.%d", i), wrongCode))
+		}
+		require.Equal(t, http.StatusSeeOther, submit(t, "user-csrf-1", "203.0.113.1", userCode))
+	})
+
+	t.Run("without limits per address, only the global limit applies to the address of the proxy", func(t *testing.T) {
+		limits := DefaultLimits()
+		limits.MaxFailedAttemptsPerAddress = 0
+		limits.MaxFailedAttempts = 10
+		submit, userCode := setup(t, limits)
+
+		for i := 0; i < 10; i++ {
+			require.Equal(t, http.StatusOK, submit(t, fmt.Sprintf("user-csrf-%d", i), "203.0.113.1", wrongCode))
+		}
+		// The global limit applies to all addresses together, so it still stops attackers who use many addresses.
+		require.Equal(t, http.StatusTooManyRequests, submit(t, "other-user-csrf", "198.51.100.1", userCode))
+	})
+}
@@ -0,0 +1,46 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package oidc
+
+import (
+	"context"
+
+	"github.com/ory/fosite"
+
+	oidcapi "go.pinniped.dev/generated/latest/apis/supervisor/oidc"
+	"go.pinniped.dev/internal/fositestoragei"
+	"go.pinniped.dev/internal/oidc/clientregistry"
+)
+
+// deviceFlowClientStorage allows the clients which may use the device authorization grant to redirect to the
+// device callback endpoint. During a device authorization, the Supervisor acts as the client of its own authorization
+// endpoint on behalf of the device, and the authcode which is issued to the device callback endpoint is later
+// redeemed at the token endpoint when the device polls for its tokens.
+type deviceFlowClientStorage struct {
+	fositestoragei.AllFositeStorage
+	deviceCallbackURL string
+}
+
+func newDeviceFlowClientStorage(storage fositestoragei.AllFositeStorage, deviceCallbackURL string) *deviceFlowClientStorage {
+	return &deviceFlowClientStorage{AllFositeStorage: storage, deviceCallbackURL: deviceCallbackURL}
+}
+
+func (s *deviceFlowClientStorage) GetClient(ctx context.Context, id string) (fosite.Client, error) {
+	client, err := s.AllFositeStorage.GetClient(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	pinnipedClient, ok := client.(*clientregistry.Client)
+	if !ok || !pinnipedClient.GetGrantTypes().Has(oidcapi.GrantTypeDeviceCode) {
+		return client, nil
+	}
+
+	// Copy the client before changing its redirect URIs, since the client could be shared.
+	clientCopy := *pinnipedClient
+	defaultClientCopy := *pinnipedClient.DefaultClient
+	defaultClientCopy.RedirectURIs = append(append([]string{}, defaultClientCopy.RedirectURIs...), s.deviceCallbackURL)
+	clientCopy.DefaultClient = &defaultClientCopy
+	return &clientCopy, nil
+}
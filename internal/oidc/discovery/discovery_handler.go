@@ -1,4 +1,4 @@
-// Copyright 2020-2023 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 // Package discovery provides a handler for the OIDC discovery endpoint.
@@ -12,6 +12,7 @@ import (
 	"go.pinniped.dev/generated/latest/apis/supervisor/idpdiscovery/v1alpha1"
 	oidcapi "go.pinniped.dev/generated/latest/apis/supervisor/oidc"
 	"go.pinniped.dev/internal/oidc"
+	"go.pinniped.dev/internal/oidc/oidcclientvalidator"
 )
 
 // Metadata holds all fields (that we care about) from the OpenID Provider Metadata section in the
@@ -35,13 +36,31 @@ type Metadata struct {
 
 	// vvv Optional vvv
 
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
 	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
-	ScopesSupported                   []string `json:"scopes_supported"`
-	ClaimsSupported                   []string `json:"claims_supported"`
+	// https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderMetadata says this is required when
+	// the private_key_jwt method is supported.
+	TokenEndpointAuthSigningAlgValuesSupported []string `json:"token_endpoint_auth_signing_alg_values_supported"`
+	ScopesSupported                            []string `json:"scopes_supported"`
+	ClaimsSupported                            []string `json:"claims_supported"`
 
 	// https://datatracker.ietf.org/doc/html/rfc8414#section-2 says, “If omitted, the authorization server does not support PKCE.”
 	CodeChallengeMethodsSupported []string `json:"code_challenge_methods_supported"`
 
+	// https://datatracker.ietf.org/doc/html/rfc8414#section-2 describes these fields for the RFC7009 revocation endpoint.
+	RevocationEndpoint                     string   `json:"revocation_endpoint"`
+	RevocationEndpointAuthMethodsSupported []string `json:"revocation_endpoint_auth_methods_supported"`
+
+	// https://datatracker.ietf.org/doc/html/rfc8414#section-2 describes these fields for the RFC7662 introspection endpoint.
+	IntrospectionEndpoint                     string   `json:"introspection_endpoint"`
+	IntrospectionEndpointAuthMethodsSupported []string `json:"introspection_endpoint_auth_methods_supported"`
+
+	// https://openid.net/specs/openid-connect-rpinitiated-1_0.html#OPMetadata describes this field for RP-initiated logout.
+	EndSessionEndpoint string `json:"end_session_endpoint"`
+
+	// https://datatracker.ietf.org/doc/html/rfc8628#section-4 describes this field for the device authorization grant.
+	DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint"`
+
 	// ^^^ Optional ^^^
 
 	// vvv Custom vvv
@@ -51,26 +70,41 @@ type Metadata struct {
 	// ^^^ Custom ^^^
 }
 
-// NewHandler returns an http.Handler that serves an OIDC discovery endpoint.
-func NewHandler(issuerURL string) http.Handler {
+// NewHandler returns an http.Handler that serves an OIDC discovery endpoint. The idTokenSigningAlgorithms are the
+// algorithms which the issuer can use to sign ID tokens, starting with its default algorithm.
+func NewHandler(issuerURL string, idTokenSigningAlgorithms []string) http.Handler {
+	// Introspection only supports client secrets, because fosite only supports client secrets there.
+	tokenEndpointAuthMethods := []string{
+		oidcclientvalidator.TokenEndpointAuthMethodClientSecretBasic,
+		oidcclientvalidator.TokenEndpointAuthMethodPrivateKeyJWT,
+		oidcclientvalidator.TokenEndpointAuthMethodTLSClientAuth,
+	}
 	oidcConfig := Metadata{
 		Issuer:                issuerURL,
 		AuthorizationEndpoint: issuerURL + oidc.AuthorizationEndpointPath,
 		TokenEndpoint:         issuerURL + oidc.TokenEndpointPath,
 		JWKSURI:               issuerURL + oidc.JWKSEndpointPath,
+		UserInfoEndpoint:      issuerURL + oidc.UserInfoEndpointPath,
 		OIDCDiscoveryResponse: v1alpha1.OIDCDiscoveryResponse{
 			SupervisorDiscovery: v1alpha1.OIDCDiscoveryResponseIDPEndpoint{
 				PinnipedIDPsEndpoint: issuerURL + oidc.PinnipedIDPsPathV1Alpha1,
 			},
 		},
-		ResponseTypesSupported:            []string{"code"},
-		ResponseModesSupported:            []string{"query", "form_post"},
-		SubjectTypesSupported:             []string{"public"},
-		IDTokenSigningAlgValuesSupported:  []string{"ES256"},
-		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic"},
-		CodeChallengeMethodsSupported:     []string{"S256"},
-		ScopesSupported:                   []string{oidcapi.ScopeOpenID, oidcapi.ScopeOfflineAccess, oidcapi.ScopeRequestAudience, oidcapi.ScopeUsername, oidcapi.ScopeGroups},
-		ClaimsSupported:                   []string{oidcapi.IDTokenClaimUsername, oidcapi.IDTokenClaimGroups, oidcapi.IDTokenClaimAdditionalClaims},
+		ResponseTypesSupported:                     []string{"code"},
+		ResponseModesSupported:                     []string{"query", "form_post"},
+		SubjectTypesSupported:                      []string{"public"},
+		IDTokenSigningAlgValuesSupported:           idTokenSigningAlgorithms,
+		TokenEndpointAuthMethodsSupported:          tokenEndpointAuthMethods,
+		TokenEndpointAuthSigningAlgValuesSupported: oidcclientvalidator.ClientAssertionSigningAlgorithms,
+		CodeChallengeMethodsSupported:              []string{"S256"},
+		RevocationEndpoint:                         issuerURL + oidc.RevocationEndpointPath,
+		RevocationEndpointAuthMethodsSupported:     tokenEndpointAuthMethods,
+		IntrospectionEndpoint:                      issuerURL + oidc.IntrospectionEndpointPath,
+		IntrospectionEndpointAuthMethodsSupported:  []string{"client_secret_basic"},
+		EndSessionEndpoint:                         issuerURL + oidc.EndSessionEndpointPath,
+		DeviceAuthorizationEndpoint:                issuerURL + oidc.DeviceAuthorizationEndpointPath,
+		ScopesSupported:                            []string{oidcapi.ScopeOpenID, oidcapi.ScopeOfflineAccess, oidcapi.ScopeRequestAudience, oidcapi.ScopeUsername, oidcapi.ScopeGroups},
+		ClaimsSupported:                            []string{oidcapi.IDTokenClaimUsername, oidcapi.IDTokenClaimGroups, oidcapi.IDTokenClaimAdditionalClaims},
 	}
 
 	var b bytes.Buffer
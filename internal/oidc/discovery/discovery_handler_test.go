@@ -1,4 +1,4 @@
-// Copyright 2020-2023 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package discovery
@@ -18,9 +18,10 @@ func TestDiscovery(t *testing.T) {
 	tests := []struct {
 		name string
 
-		issuer string
-		method string
-		path   string
+		issuer                   string
+		idTokenSigningAlgorithms []string
+		method                   string
+		path                     string
 
 		wantStatus      int
 		wantContentType string
@@ -28,12 +29,13 @@ func TestDiscovery(t *testing.T) {
 		wantBodyString  string
 	}{
 		{
-			name:            "happy path",
-			issuer:          "https://some-issuer.com/some/path",
-			method:          http.MethodGet,
-			path:            "/some/path" + oidc.WellKnownEndpointPath,
-			wantStatus:      http.StatusOK,
-			wantContentType: "application/json",
+			name:                     "happy path",
+			issuer:                   "https://some-issuer.com/some/path",
+			idTokenSigningAlgorithms: []string{"ES256"},
+			method:                   http.MethodGet,
+			path:                     "/some/path" + oidc.WellKnownEndpointPath,
+			wantStatus:               http.StatusOK,
+			wantContentType:          "application/json",
 			wantBodyJSON: here.Doc(`
 			{
 				"issuer": "https://some-issuer.com/some/path",
@@ -44,9 +46,53 @@ func TestDiscovery(t *testing.T) {
 				"response_modes_supported": ["query", "form_post"],
 				"subject_types_supported": ["public"],
 				"id_token_signing_alg_values_supported": ["ES256"],
-				"token_endpoint_auth_methods_supported": ["client_secret_basic"],
+				"userinfo_endpoint": "https://some-issuer.com/some/path/oauth2/userinfo",
+				"token_endpoint_auth_methods_supported": ["client_secret_basic", "private_key_jwt", "tls_client_auth"],
+				"token_endpoint_auth_signing_alg_values_supported": ["RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"],
 				"scopes_supported": ["openid", "offline_access", "pinniped:request-audience", "username", "groups"],
 				"code_challenge_methods_supported": ["S256"],
+				"revocation_endpoint": "https://some-issuer.com/some/path/oauth2/revoke",
+				"revocation_endpoint_auth_methods_supported": ["client_secret_basic", "private_key_jwt", "tls_client_auth"],
+				"introspection_endpoint": "https://some-issuer.com/some/path/oauth2/introspect",
+				"introspection_endpoint_auth_methods_supported": ["client_secret_basic"],
+				"end_session_endpoint": "https://some-issuer.com/some/path/oauth2/logout",
+				"device_authorization_endpoint": "https://some-issuer.com/some/path/oauth2/device_authorization",
+				"claims_supported": ["username", "groups", "additionalClaims"],
+				"discovery.supervisor.pinniped.dev/v1alpha1": {
+					"pinniped_identity_providers_endpoint": "https://some-issuer.com/some/path/v1alpha1/pinniped_identity_providers"
+				}
+			}
+			`),
+		},
+		{
+			name:                     "happy path with several ID token signing algorithms",
+			issuer:                   "https://some-issuer.com/some/path",
+			idTokenSigningAlgorithms: []string{"RS256", "ES256", "EdDSA"},
+			method:                   http.MethodGet,
+			path:                     "/some/path" + oidc.WellKnownEndpointPath,
+			wantStatus:               http.StatusOK,
+			wantContentType:          "application/json",
+			wantBodyJSON: here.Doc(`
+			{
+				"issuer": "https://some-issuer.com/some/path",
+				"authorization_endpoint": "https://some-issuer.com/some/path/oauth2/authorize",
+				"token_endpoint": "https://some-issuer.com/some/path/oauth2/token",
+				"jwks_uri": "https://some-issuer.com/some/path/jwks.json",
+				"response_types_supported": ["code"],
+				"response_modes_supported": ["query", "form_post"],
+				"subject_types_supported": ["public"],
+				"id_token_signing_alg_values_supported": ["RS256", "ES256", "EdDSA"],
+				"userinfo_endpoint": "https://some-issuer.com/some/path/oauth2/userinfo",
+				"token_endpoint_auth_methods_supported": ["client_secret_basic", "private_key_jwt", "tls_client_auth"],
+				"token_endpoint_auth_signing_alg_values_supported": ["RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"],
+				"scopes_supported": ["openid", "offline_access", "pinniped:request-audience", "username", "groups"],
+				"code_challenge_methods_supported": ["S256"],
+				"revocation_endpoint": "https://some-issuer.com/some/path/oauth2/revoke",
+				"revocation_endpoint_auth_methods_supported": ["client_secret_basic", "private_key_jwt", "tls_client_auth"],
+				"introspection_endpoint": "https://some-issuer.com/some/path/oauth2/introspect",
+				"introspection_endpoint_auth_methods_supported": ["client_secret_basic"],
+				"end_session_endpoint": "https://some-issuer.com/some/path/oauth2/logout",
+				"device_authorization_endpoint": "https://some-issuer.com/some/path/oauth2/device_authorization",
 				"claims_supported": ["username", "groups", "additionalClaims"],
 				"discovery.supervisor.pinniped.dev/v1alpha1": {
 					"pinniped_identity_providers_endpoint": "https://some-issuer.com/some/path/v1alpha1/pinniped_identity_providers"
@@ -67,7 +113,7 @@ func TestDiscovery(t *testing.T) {
 	for _, test := range tests {
 		test := test
 		t.Run(test.name, func(t *testing.T) {
-			handler := NewHandler(test.issuer)
+			handler := NewHandler(test.issuer, test.idTokenSigningAlgorithms)
 			req := httptest.NewRequest(test.method, test.path, nil)
 			rsp := httptest.NewRecorder()
 			handler.ServeHTTP(rsp, req)
@@ -1,10 +1,11 @@
-// Copyright 2021-2023 the Pinniped contributors. All Rights Reserved.
+// Copyright 2021-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 // Package downstreamsession provides some shared helpers for creating downstream OIDC sessions.
 package downstreamsession
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/url"
@@ -19,6 +20,7 @@ import (
 	oidcapi "go.pinniped.dev/generated/latest/apis/supervisor/oidc"
 	"go.pinniped.dev/internal/authenticators"
 	"go.pinniped.dev/internal/constable"
+	"go.pinniped.dev/internal/idtransform"
 	"go.pinniped.dev/internal/oidc"
 	"go.pinniped.dev/internal/oidc/provider"
 	"go.pinniped.dev/internal/plog"
@@ -38,6 +40,10 @@ const (
 	requiredClaimEmptyErr              = constable.Error("required claim in upstream ID token is empty")
 	emailVerifiedClaimInvalidFormatErr = constable.Error("email_verified claim in upstream ID token has invalid format")
 	emailVerifiedClaimFalseErr         = constable.Error("email_verified claim in upstream ID token has false value")
+	idTransformUnexpectedErr           = constable.Error("configured identity transformation or policy resulted in unexpected error")
+	idTransformPolicyErr               = constable.Error("configured identity policy rejected this authentication")
+	requiredAttributeMissingErr        = constable.Error("required attribute in upstream SAML assertion missing")
+	requiredAttributeEmptyErr          = constable.Error("required attribute in upstream SAML assertion is empty")
 )
 
 // MakeDownstreamSession creates a downstream OIDC session.
@@ -86,12 +92,16 @@ func MakeDownstreamLDAPOrADCustomSessionData(
 	idpType psession.ProviderType,
 	authenticateResponse *authenticators.Response,
 	username string,
+	untransformedUpstreamUsername string,
+	untransformedUpstreamGroups []string,
 ) *psession.CustomSessionData {
 	customSessionData := &psession.CustomSessionData{
-		Username:     username,
-		ProviderUID:  ldapUpstream.GetResourceUID(),
-		ProviderName: ldapUpstream.GetName(),
-		ProviderType: idpType,
+		Username:         username,
+		UpstreamUsername: untransformedUpstreamUsername,
+		UpstreamGroups:   untransformedUpstreamGroups,
+		ProviderUID:      ldapUpstream.GetResourceUID(),
+		ProviderName:     ldapUpstream.GetName(),
+		ProviderType:     idpType,
 	}
 
 	if idpType == psession.ProviderTypeLDAP {
@@ -111,10 +121,54 @@ func MakeDownstreamLDAPOrADCustomSessionData(
 	return customSessionData
 }
 
+func MakeDownstreamSAMLCustomSessionData(
+	samlUpstream provider.UpstreamSAMLIdentityProviderI,
+	assertion *provider.SAMLAssertion,
+	username string,
+	untransformedUpstreamUsername string,
+	untransformedUpstreamGroups []string,
+) *psession.CustomSessionData {
+	return &psession.CustomSessionData{
+		Username:         username,
+		UpstreamUsername: untransformedUpstreamUsername,
+		UpstreamGroups:   untransformedUpstreamGroups,
+		ProviderUID:      samlUpstream.GetResourceUID(),
+		ProviderName:     samlUpstream.GetName(),
+		ProviderType:     psession.ProviderTypeSAML,
+		SAML: &psession.SAMLSessionData{
+			UpstreamEntityID:    samlUpstream.GetEntityID(),
+			UpstreamNameID:      assertion.NameID,
+			SessionNotOnOrAfter: assertion.SessionNotOnOrAfter,
+		},
+	}
+}
+
+func MakeDownstreamGitHubCustomSessionData(
+	gitHubUpstream provider.UpstreamGitHubIdentityProviderI,
+	accessToken string,
+	username string,
+	untransformedUpstreamUsername string,
+	untransformedUpstreamGroups []string,
+) *psession.CustomSessionData {
+	return &psession.CustomSessionData{
+		Username:         username,
+		UpstreamUsername: untransformedUpstreamUsername,
+		UpstreamGroups:   untransformedUpstreamGroups,
+		ProviderUID:      gitHubUpstream.GetResourceUID(),
+		ProviderName:     gitHubUpstream.GetName(),
+		ProviderType:     psession.ProviderTypeGitHub,
+		GitHub: &psession.GitHubSessionData{
+			UpstreamAccessToken: accessToken,
+		},
+	}
+}
+
 func MakeDownstreamOIDCCustomSessionData(
 	oidcUpstream provider.UpstreamOIDCIdentityProviderI,
 	token *oidctypes.Token,
 	username string,
+	untransformedUpstreamUsername string,
+	untransformedUpstreamGroups []string,
 ) (*psession.CustomSessionData, error) {
 	upstreamSubject, err := ExtractStringClaimValue(oidcapi.IDTokenClaimSubject, oidcUpstream.GetName(), token.IDToken.Claims)
 	if err != nil {
@@ -126,10 +180,12 @@ func MakeDownstreamOIDCCustomSessionData(
 	}
 
 	customSessionData := &psession.CustomSessionData{
-		Username:     username,
-		ProviderUID:  oidcUpstream.GetResourceUID(),
-		ProviderName: oidcUpstream.GetName(),
-		ProviderType: psession.ProviderTypeOIDC,
+		Username:         username,
+		UpstreamUsername: untransformedUpstreamUsername,
+		UpstreamGroups:   untransformedUpstreamGroups,
+		ProviderUID:      oidcUpstream.GetResourceUID(),
+		ProviderName:     oidcUpstream.GetName(),
+		ProviderType:     psession.ProviderTypeOIDC,
 		OIDC: &psession.OIDCSessionData{
 			UpstreamIssuer:  upstreamIssuer,
 			UpstreamSubject: upstreamSubject,
@@ -174,7 +230,8 @@ func MakeDownstreamOIDCCustomSessionData(
 
 // AutoApproveScopes auto-grants the scopes which we support and for which we do not require end-user approval,
 // if they were requested. This should only be called after it has been validated that the client is allowed to request
-// the scopes that it requested (which is a check performed by fosite).
+// the scopes that it requested (which is a check performed by fosite). The OIDCClients which require consent still
+// ask the user to approve the granted scopes after the user logs in, before the client is given an authcode.
 func AutoApproveScopes(authorizeRequester fosite.AuthorizeRequester) {
 	for _, scope := range []string{
 		oidcapi.ScopeOpenID,
@@ -216,6 +273,33 @@ func GetDownstreamIdentityFromUpstreamIDToken(
 	return subject, username, groups, err
 }
 
+// ApplyIdentityTransformations applies an identity transformation pipeline to an upstream identity to determine the
+// downstream username and groups, in that order. It returns an error when the pipeline rejects the authentication
+// or when the pipeline could not be evaluated. The error messages are suitable to be returned to the client.
+func ApplyIdentityTransformations(
+	ctx context.Context,
+	identityTransforms *idtransform.TransformationPipeline,
+	username string,
+	groups []string,
+) (string, []string, error) {
+	transformationResult, err := identityTransforms.Evaluate(ctx, username, groups)
+	if err != nil {
+		plog.Error("unexpected identity transformation error during authentication", err, "inputUsername", username)
+		return "", nil, idTransformUnexpectedErr
+	}
+	if !transformationResult.AuthenticationAllowed {
+		plog.Debug("authentication rejected by configured policy", "inputUsername", username, "inputGroups", groups)
+		return "", nil, fmt.Errorf("%w: %s", idTransformPolicyErr, transformationResult.RejectedAuthenticationMessage)
+	}
+	plog.Debug("identity transformation successfully applied during authentication",
+		"originalUsername", username,
+		"newUsername", transformationResult.Username,
+		"originalGroups", groups,
+		"newGroups", transformationResult.Groups,
+	)
+	return transformationResult.Username, transformationResult.Groups, nil
+}
+
 // MapAdditionalClaimsFromUpstreamIDToken returns the additionalClaims mapped from the upstream token, if any.
 func MapAdditionalClaimsFromUpstreamIDToken(
 	upstreamIDPConfig provider.UpstreamOIDCIdentityProviderI,
@@ -323,6 +407,49 @@ func ExtractStringClaimValue(claimName string, upstreamIDPName string, idTokenCl
 	return valueAsString, nil
 }
 
+// GetDownstreamIdentityFromUpstreamSAMLAssertion returns the mapped subject, username, and group names, in that order.
+func GetDownstreamIdentityFromUpstreamSAMLAssertion(
+	samlUpstream provider.UpstreamSAMLIdentityProviderI,
+	assertion *provider.SAMLAssertion,
+) (string, string, []string, error) {
+	subject := DownstreamSAMLSubject(samlUpstream.GetEntityID(), assertion.NameID)
+
+	username := assertion.NameID
+	if usernameAttribute := samlUpstream.GetUsernameAttribute(); usernameAttribute != "" {
+		values, ok := assertion.Attributes[usernameAttribute]
+		if !ok {
+			plog.Warning(
+				"username attribute configured for upstream SAML provider is missing from the assertion",
+				"upstreamName", samlUpstream.GetName(),
+				"configuredUsernameAttribute", usernameAttribute,
+			)
+			return "", "", nil, requiredAttributeMissingErr
+		}
+		if len(values) == 0 || values[0] == "" {
+			plog.Warning(
+				"username attribute configured for upstream SAML provider has an empty value in the assertion",
+				"upstreamName", samlUpstream.GetName(),
+				"configuredUsernameAttribute", usernameAttribute,
+			)
+			return "", "", nil, requiredAttributeEmptyErr
+		}
+		username = values[0]
+	}
+
+	var groups []string
+	if groupsAttribute := samlUpstream.GetGroupsAttribute(); groupsAttribute != "" {
+		groups = assertion.Attributes[groupsAttribute]
+	}
+
+	return subject, username, groups, nil
+}
+
+// DownstreamSAMLSubject returns the downstream subject for a user of an upstream SAML IDP. It is built like the
+// subjects of users of upstream OIDC IDPs, using the entity ID of the IDP and the NameID of the user.
+func DownstreamSAMLSubject(upstreamEntityID string, upstreamNameID string) string {
+	return fmt.Sprintf("%s?%s=%s", upstreamEntityID, oidcapi.IDTokenClaimSubject, url.QueryEscape(upstreamNameID))
+}
+
 func DownstreamSubjectFromUpstreamLDAP(ldapUpstream provider.UpstreamLDAPIdentityProviderI, authenticateResponse *authenticators.Response) string {
 	ldapURL := *ldapUpstream.GetURL()
 	return DownstreamLDAPSubject(authenticateResponse.User.GetUID(), ldapURL)
@@ -1,4 +1,4 @@
-// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package oidc
@@ -12,11 +12,15 @@ import (
 	"github.com/ory/fosite/compose"
 )
 
+// minimumHMACSecretLength is the minimum length of an HMAC secret which is accepted by fosite.
+const minimumHMACSecretLength = 32
+
 // DynamicGlobalSecretConfig is a wrapper around fosite.Config which allows us to always return dynamic secrets,
 // since those secrets can change at any time when they are loaded or reloaded by our controllers.
 type DynamicGlobalSecretConfig struct {
-	fositeConfig *fosite.Config
-	keyFunc      func() []byte
+	fositeConfig    *fosite.Config
+	keyFunc         func() []byte
+	previousKeyFunc func() []byte
 }
 
 var _ compose.HMACSHAStrategyConfigurator = &DynamicGlobalSecretConfig{}
@@ -24,10 +28,12 @@ var _ compose.HMACSHAStrategyConfigurator = &DynamicGlobalSecretConfig{}
 func NewDynamicGlobalSecretConfig(
 	fositeConfig *fosite.Config,
 	keyFunc func() []byte,
+	previousKeyFunc func() []byte,
 ) *DynamicGlobalSecretConfig {
 	return &DynamicGlobalSecretConfig{
-		fositeConfig: fositeConfig,
-		keyFunc:      keyFunc,
+		fositeConfig:    fositeConfig,
+		keyFunc:         keyFunc,
+		previousKeyFunc: previousKeyFunc,
 	}
 }
 
@@ -58,6 +64,15 @@ func (d *DynamicGlobalSecretConfig) GetGlobalSecret(ctx context.Context) ([]byte
 }
 
 func (d *DynamicGlobalSecretConfig) GetRotatedGlobalSecrets(ctx context.Context) ([][]byte, error) {
-	// We don't support having multiple global secrets yet, but when we do we will need to implement this.
-	return nil, nil
+	// The previous secret is only available during the grace period which follows a rotation of the secret.
+	// Fosite stops trying the rotated secrets as soon as it finds one which is too short to use, so only
+	// return the previous secret when it is long enough to be valid.
+	if d.previousKeyFunc == nil {
+		return nil, nil
+	}
+	previousKey := d.previousKeyFunc()
+	if len(previousKey) < minimumHMACSecretLength {
+		return nil, nil
+	}
+	return [][]byte{previousKey}, nil
 }
@@ -1,4 +1,4 @@
-// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package oidc
@@ -37,9 +37,14 @@ const (
 // out of context, such as when accidentally committed to a GitHub repo. After we implemented the
 // custom prefix feature, fosite later added the same feature, but did not make the prefix customizable.
 // Therefore, this code has been updated to replace the fosite prefix with our custom prefix.
+//
+// When the HMAC key is rotated, the previous key is still accepted when validating tokens, so that authcodes
+// and refresh tokens which were issued before the rotation continue to work until the previous key expires.
+// New tokens are always signed using the current key.
 type dynamicOauth2HMACStrategy struct {
-	fositeConfig *fosite.Config
-	keyFunc      func() []byte
+	fositeConfig    *fosite.Config
+	keyFunc         func() []byte
+	previousKeyFunc func() []byte
 }
 
 var _ oauth2.CoreStrategy = &dynamicOauth2HMACStrategy{}
@@ -47,10 +52,12 @@ var _ oauth2.CoreStrategy = &dynamicOauth2HMACStrategy{}
 func newDynamicOauth2HMACStrategy(
 	fositeConfig *fosite.Config,
 	keyFunc func() []byte,
+	previousKeyFunc func() []byte,
 ) *dynamicOauth2HMACStrategy {
 	return &dynamicOauth2HMACStrategy{
-		fositeConfig: fositeConfig,
-		keyFunc:      keyFunc,
+		fositeConfig:    fositeConfig,
+		keyFunc:         keyFunc,
+		previousKeyFunc: previousKeyFunc,
 	}
 }
 
@@ -155,5 +162,5 @@ func (s *dynamicOauth2HMACStrategy) ValidateAuthorizeCode(
 }
 
 func (s *dynamicOauth2HMACStrategy) delegate() *oauth2.HMACSHAStrategy {
-	return compose.NewOAuth2HMACStrategy(NewDynamicGlobalSecretConfig(s.fositeConfig, s.keyFunc))
+	return compose.NewOAuth2HMACStrategy(NewDynamicGlobalSecretConfig(s.fositeConfig, s.keyFunc, s.previousKeyFunc))
 }
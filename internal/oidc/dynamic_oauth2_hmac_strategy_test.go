@@ -1,4 +1,4 @@
-// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2022-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package oidc
@@ -18,6 +18,7 @@ func TestDynamicOauth2HMACStrategy_Signatures(t *testing.T) {
 	s := newDynamicOauth2HMACStrategy(
 		&fosite.Config{}, // defaults are good enough for this unit test
 		func() []byte { return []byte("12345678901234567890123456789012") }, // 32 character secret key
+		nil,
 	)
 
 	tests := []struct {
@@ -60,11 +61,13 @@ func TestDynamicOauth2HMACStrategy_Generate(t *testing.T) {
 	s := newDynamicOauth2HMACStrategy(
 		&fosite.Config{}, // defaults are good enough for this unit test
 		func() []byte { return []byte("12345678901234567890123456789012") }, // 32 character secret key
+		nil,
 	)
 
 	generateTokenErrorCausingStrategy := newDynamicOauth2HMACStrategy(
 		&fosite.Config{},
 		func() []byte { return []byte("too_short_causes_error") }, // secret key is below required 32 characters
+		nil,
 	)
 
 	tests := []struct {
@@ -137,6 +140,7 @@ func TestDynamicOauth2HMACStrategy_Validate(t *testing.T) {
 	s := newDynamicOauth2HMACStrategy(
 		&fosite.Config{}, // defaults are good enough for this unit test
 		func() []byte { return []byte("12345678901234567890123456789012") }, // 32 character secret key
+		nil,
 	)
 
 	tests := []struct {
@@ -215,3 +219,76 @@ func TestDynamicOauth2HMACStrategy_Validate(t *testing.T) {
 		})
 	}
 }
+
+func TestDynamicOauth2HMACStrategy_ValidateWithPreviousKey(t *testing.T) {
+	const (
+		oldKey = "old-key-which-is-32-bytes-long.."
+		newKey = "new-key-which-is-32-bytes-long.."
+	)
+
+	var currentKey, previousKey []byte
+	s := newDynamicOauth2HMACStrategy(
+		&fosite.Config{}, // defaults are good enough for this unit test
+		func() []byte { return currentKey },
+		func() []byte { return previousKey },
+	)
+
+	tests := []struct {
+		name         string
+		generateFunc func(ctx context.Context, requester fosite.Requester) (token string, signature string, err error)
+		validateFunc func(ctx context.Context, requester fosite.Requester, token string) error
+	}{
+		{
+			name:         "access tokens",
+			generateFunc: s.GenerateAccessToken,
+			validateFunc: s.ValidateAccessToken,
+		},
+		{
+			name:         "refresh tokens",
+			generateFunc: s.GenerateRefreshToken,
+			validateFunc: s.ValidateRefreshToken,
+		},
+		{
+			name:         "authcodes",
+			generateFunc: s.GenerateAuthorizeCode,
+			validateFunc: s.ValidateAuthorizeCode,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			// Not parallel, because the subtests change the keys used by the shared strategy.
+			var ctxIsIgnored context.Context
+			var requesterIsIgnored fosite.Requester
+
+			unexpiredSession := &fosite.DefaultSession{}
+			unexpiredSession.SetExpiresAt(fosite.RefreshToken, time.Now().Add(time.Hour))
+			unexpiredSession.SetExpiresAt(fosite.AccessToken, time.Now().Add(time.Hour))
+			unexpiredSession.SetExpiresAt(fosite.AuthorizeCode, time.Now().Add(time.Hour))
+			requester := &fosite.Request{Session: unexpiredSession}
+
+			// Generate a token before the key is rotated.
+			currentKey, previousKey = []byte(oldKey), nil
+			tokenFromOldKey, _, err := tt.generateFunc(ctxIsIgnored, requesterIsIgnored)
+			require.NoError(t, err)
+
+			// During the grace period, tokens from both keys are valid.
+			currentKey, previousKey = []byte(newKey), []byte(oldKey)
+			tokenFromNewKey, _, err := tt.generateFunc(ctxIsIgnored, requesterIsIgnored)
+			require.NoError(t, err)
+			require.NoError(t, tt.validateFunc(ctxIsIgnored, requester, tokenFromOldKey))
+			require.NoError(t, tt.validateFunc(ctxIsIgnored, requester, tokenFromNewKey))
+
+			// A previous key which is too short to be used is ignored.
+			previousKey = []byte("too_short_to_be_used")
+			require.EqualError(t, tt.validateFunc(ctxIsIgnored, requester, tokenFromOldKey), "token_signature_mismatch")
+			require.NoError(t, tt.validateFunc(ctxIsIgnored, requester, tokenFromNewKey))
+
+			// After the grace period, only tokens from the new key are valid.
+			previousKey = nil
+			require.EqualError(t, tt.validateFunc(ctxIsIgnored, requester, tokenFromOldKey), "token_signature_mismatch")
+			require.NoError(t, tt.validateFunc(ctxIsIgnored, requester, tokenFromNewKey))
+		})
+	}
+}
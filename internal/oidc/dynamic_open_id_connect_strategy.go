@@ -0,0 +1,90 @@
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package oidc
+
+import (
+	"context"
+	"time"
+
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/compose"
+	"github.com/ory/fosite/handler/openid"
+	"gopkg.in/square/go-jose.v2"
+
+	"go.pinniped.dev/internal/constable"
+	"go.pinniped.dev/internal/oidc/clientregistry"
+	"go.pinniped.dev/internal/oidc/jwks"
+	"go.pinniped.dev/internal/plog"
+)
+
+// dynamicOpenIDConnectStrategy is an openid.OpenIDConnectTokenStrategy that can dynamically
+// load a signing key to issue ID tokens. We want this dynamic capability since our controllers for
+// loading FederationDomain's and signing keys run in parallel, and thus the signing key might not be
+// ready when an FederationDomain is otherwise ready.
+//
+// If we ever update FederationDomain's to hold their signing key, we might not need this type, since we
+// could have an invariant that routes to an FederationDomain's endpoints are only wired up if an
+// FederationDomain has a valid signing key.
+//
+// ID tokens are signed using the FederationDomain's active key for the algorithm which was requested by the
+// client's idTokenSignedResponseAlg, or else using the FederationDomain's default active key.
+type dynamicOpenIDConnectStrategy struct {
+	fositeConfig *fosite.Config
+	jwksProvider jwks.DynamicJWKSProvider
+}
+
+var _ openid.OpenIDConnectTokenStrategy = &dynamicOpenIDConnectStrategy{}
+
+func newDynamicOpenIDConnectStrategy(
+	fositeConfig *fosite.Config,
+	jwksProvider jwks.DynamicJWKSProvider,
+) *dynamicOpenIDConnectStrategy {
+	return &dynamicOpenIDConnectStrategy{
+		fositeConfig: fositeConfig,
+		jwksProvider: jwksProvider,
+	}
+}
+
+func (s *dynamicOpenIDConnectStrategy) GenerateIDToken(
+	ctx context.Context,
+	lifespan time.Duration,
+	requester fosite.Requester,
+) (string, error) {
+	algorithm := ""
+	if client, ok := requester.GetClient().(*clientregistry.Client); ok {
+		algorithm = client.IDTokenSignedResponseAlg
+	}
+
+	var activeJwk *jose.JSONWebKey
+	if algorithm == "" {
+		_, activeJwk = s.jwksProvider.GetJWKS(s.fositeConfig.IDTokenIssuer)
+		if activeJwk == nil {
+			plog.Debug("no JWK found for issuer", "issuer", s.fositeConfig.IDTokenIssuer)
+			return "", fosite.ErrTemporarilyUnavailable.WithWrap(constable.Error("no JWK found for issuer"))
+		}
+	} else {
+		activeJwk = s.jwksProvider.GetActiveJWKForAlgorithm(s.fositeConfig.IDTokenIssuer, algorithm)
+		if activeJwk == nil {
+			// Either the FederationDomain does not enable the algorithm, or its key was not loaded yet.
+			plog.Debug("no JWK found for the client's ID token signing algorithm",
+				"issuer", s.fositeConfig.IDTokenIssuer, "clientID", requester.GetClient().GetID(), "algorithm", algorithm)
+			return "", fosite.ErrServerError.
+				WithHintf("The client requires ID tokens to be signed using %s, which is not available.", algorithm).
+				WithWrap(constable.Error("no JWK found for the client's ID token signing algorithm"))
+		}
+	}
+
+	if activeJwk.Algorithm == "" {
+		plog.Debug("JWK must have an algorithm", "issuer", s.fositeConfig.IDTokenIssuer, "keyid", activeJwk.KeyID)
+		return "", fosite.ErrServerError.WithWrap(constable.Error("JWK must have an algorithm"))
+	}
+
+	// Fosite signs the ID token using the algorithm of the JWK.
+	keyGetter := func(context.Context) (interface{}, error) {
+		return activeJwk, nil
+	}
+	strategy := compose.NewOpenIDConnectStrategy(keyGetter, s.fositeConfig)
+
+	return strategy.GenerateIDToken(ctx, lifespan, requester)
+}
@@ -0,0 +1,206 @@
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/handler/openid"
+	"github.com/ory/fosite/token/jwt"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
+
+	"go.pinniped.dev/internal/oidc/clientregistry"
+	"go.pinniped.dev/internal/oidc/jwks"
+	"go.pinniped.dev/internal/testutil/oidctestutil"
+)
+
+func TestDynamicOpenIDConnectStrategy(t *testing.T) {
+	const (
+		goodIssuer   = "https://some-good-issuer.com"
+		clientID     = "some-client-id"
+		goodSubject  = "some-subject"
+		goodUsername = "some-username"
+		goodNonce    = "some-nonce-value-with-enough-bytes-to-exceed-min-allowed"
+	)
+
+	ecPrivateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	rsaPrivateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	_, edPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	ecJWK := &jose.JSONWebKey{Key: ecPrivateKey, KeyID: "ec-key", Algorithm: "ES256"}
+	rsaJWK := &jose.JSONWebKey{Key: rsaPrivateKey, KeyID: "rsa-key", Algorithm: "RS256"}
+	edJWK := &jose.JSONWebKey{Key: edPrivateKey, KeyID: "ed-key", Algorithm: "EdDSA"}
+
+	setKeys := func(activeJWK *jose.JSONWebKey, additionalActiveJWKs ...jose.JSONWebKey) func(jwks.DynamicJWKSProvider) {
+		return func(provider jwks.DynamicJWKSProvider) {
+			provider.SetIssuerToJWKSMap(
+				nil,
+				map[string]*jose.JSONWebKey{goodIssuer: activeJWK},
+				map[string]*jose.JSONWebKeySet{goodIssuer: {Keys: additionalActiveJWKs}},
+			)
+		}
+	}
+
+	tests := []struct {
+		name                     string
+		issuer                   string
+		idTokenSignedResponseAlg string
+		jwksProvider             func(jwks.DynamicJWKSProvider)
+		wantErrorType            *fosite.RFC6749Error
+		wantErrorCause           string
+		wantErrorHint            string
+		wantSigningJWK           *jose.JSONWebKey
+	}{
+		{
+			name:           "jwks provider does contain signing key for issuer",
+			issuer:         goodIssuer,
+			jwksProvider:   setKeys(ecJWK),
+			wantSigningJWK: ecJWK,
+		},
+		{
+			name:           "jwks provider does not contain signing key for issuer",
+			issuer:         goodIssuer,
+			wantErrorType:  fosite.ErrTemporarilyUnavailable,
+			wantErrorCause: "no JWK found for issuer",
+		},
+		{
+			name:           "the default signing key for the issuer is not an ECDSA key",
+			issuer:         goodIssuer,
+			jwksProvider:   setKeys(rsaJWK, *ecJWK),
+			wantSigningJWK: rsaJWK,
+		},
+		{
+			name:   "jwks provider contains signing key without an algorithm for issuer",
+			issuer: goodIssuer,
+			jwksProvider: setKeys(&jose.JSONWebKey{
+				Key: ecPrivateKey,
+			}),
+			wantErrorType:  fosite.ErrServerError,
+			wantErrorCause: "JWK must have an algorithm",
+		},
+		{
+			name:                     "client requires the algorithm of the default signing key",
+			issuer:                   goodIssuer,
+			idTokenSignedResponseAlg: "ES256",
+			jwksProvider:             setKeys(ecJWK, *rsaJWK),
+			wantSigningJWK:           ecJWK,
+		},
+		{
+			name:                     "client requires RS256 and the issuer has an additional RS256 signing key",
+			issuer:                   goodIssuer,
+			idTokenSignedResponseAlg: "RS256",
+			jwksProvider:             setKeys(ecJWK, *rsaJWK, *edJWK),
+			wantSigningJWK:           rsaJWK,
+		},
+		{
+			name:                     "client requires EdDSA and the issuer has an additional EdDSA signing key",
+			issuer:                   goodIssuer,
+			idTokenSignedResponseAlg: "EdDSA",
+			jwksProvider:             setKeys(ecJWK, *rsaJWK, *edJWK),
+			wantSigningJWK:           edJWK,
+		},
+		{
+			name:                     "client requires an algorithm which the issuer does not have a signing key for",
+			issuer:                   goodIssuer,
+			idTokenSignedResponseAlg: "RS512",
+			jwksProvider:             setKeys(ecJWK, *rsaJWK),
+			wantErrorType:            fosite.ErrServerError,
+			wantErrorCause:           "no JWK found for the client's ID token signing algorithm",
+			wantErrorHint:            "The client requires ID tokens to be signed using RS512, which is not available.",
+		},
+		{
+			name:                     "client requires an algorithm and the jwks provider does not contain any signing keys for issuer",
+			issuer:                   goodIssuer,
+			idTokenSignedResponseAlg: "ES256",
+			wantErrorType:            fosite.ErrServerError,
+			wantErrorCause:           "no JWK found for the client's ID token signing algorithm",
+			wantErrorHint:            "The client requires ID tokens to be signed using ES256, which is not available.",
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			jwksProvider := jwks.NewDynamicJWKSProvider()
+			if test.jwksProvider != nil {
+				test.jwksProvider(jwksProvider)
+			}
+			s := newDynamicOpenIDConnectStrategy(
+				&fosite.Config{IDTokenIssuer: test.issuer},
+				jwksProvider,
+			)
+
+			var client fosite.Client = &fosite.DefaultClient{ID: clientID}
+			if test.idTokenSignedResponseAlg != "" {
+				client = &clientregistry.Client{
+					DefaultOpenIDConnectClient: fosite.DefaultOpenIDConnectClient{
+						DefaultClient: &fosite.DefaultClient{ID: clientID},
+					},
+					IDTokenSignedResponseAlg: test.idTokenSignedResponseAlg,
+				}
+			}
+
+			requester := &fosite.Request{
+				Client: client,
+				Session: &openid.DefaultSession{
+					Claims: &jwt.IDTokenClaims{
+						Subject: goodSubject,
+					},
+					Subject:  goodSubject,
+					Username: goodUsername,
+				},
+				Form: url.Values{
+					"nonce": {goodNonce},
+				},
+			}
+			idToken, err := s.GenerateIDToken(context.Background(), 2*time.Hour, requester)
+			if test.wantErrorType != nil {
+				require.True(t, errors.Is(err, test.wantErrorType))
+				require.EqualError(t, err.(*fosite.RFC6749Error).Cause(), test.wantErrorCause)
+				require.Equal(t, test.wantErrorHint, err.(*fosite.RFC6749Error).HintField)
+				return
+			}
+			require.NoError(t, err)
+
+			if privateKey, ok := test.wantSigningJWK.Key.(*ecdsa.PrivateKey); ok {
+				// Perform a light validation on the token to make sure 1) we passed through the correct
+				// signing key and 2) we forwarded the fosite.Requester correctly. Token generation is
+				// tested more expansively in the token endpoint.
+				token := oidctestutil.VerifyECDSAIDToken(t, goodIssuer, clientID, privateKey, idToken)
+				require.Equal(t, goodSubject, token.Subject)
+				require.Equal(t, goodNonce, token.Nonce)
+			}
+
+			// Make sure that the token was signed using the wanted key and its algorithm.
+			jws, err := jose.ParseSigned(idToken)
+			require.NoError(t, err)
+			require.Len(t, jws.Signatures, 1)
+			require.Equal(t, test.wantSigningJWK.Algorithm, jws.Signatures[0].Header.Algorithm)
+			payload, err := jws.Verify(test.wantSigningJWK.Public().Key)
+			require.NoError(t, err)
+
+			var claims map[string]interface{}
+			require.NoError(t, json.Unmarshal(payload, &claims))
+			require.Equal(t, goodIssuer, claims["iss"])
+			require.Equal(t, goodSubject, claims["sub"])
+			require.Equal(t, goodNonce, claims["nonce"])
+		})
+	}
+}
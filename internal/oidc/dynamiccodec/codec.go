@@ -1,4 +1,4 @@
-// Copyright 2020 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 // Package dynamiccodec provides a type that can encode information using a just-in-time signing and
@@ -21,38 +21,79 @@ type KeyFunc func() []byte
 // Codec can dynamically encode and decode information by using a KeyFunc to get its keys
 // just-in-time.
 type Codec struct {
-	lifespan          time.Duration
-	signingKeyFunc    KeyFunc
-	encryptionKeyFunc KeyFunc
+	lifespan                  time.Duration
+	signingKeyFunc            KeyFunc
+	encryptionKeyFunc         KeyFunc
+	previousSigningKeyFunc    KeyFunc
+	previousEncryptionKeyFunc KeyFunc
 }
 
 // New creates a new Codec that will use the provided keyFuncs for its key source, and
 // use the securecookie.JSONEncoder. The securecookie.JSONEncoder is used because the default
 // securecookie.GobEncoder is less compact and more difficult to make forward compatible.
 //
+// The previous keyFuncs return the keys which were replaced by the most recent rotation of the signing and
+// encryption keys, or nil when there are none. Values are always encoded using the current keys, but values which
+// were encoded before a rotation can still be decoded using the previous keys. Either previous keyFunc may be nil.
+//
 // The returned Codec will make ensure that the encoded values will only be valid for the provided
 // lifespan.
-func New(lifespan time.Duration, signingKeyFunc, encryptionKeyFunc KeyFunc) *Codec {
+func New(lifespan time.Duration, signingKeyFunc, encryptionKeyFunc, previousSigningKeyFunc, previousEncryptionKeyFunc KeyFunc) *Codec {
 	return &Codec{
-		lifespan:          lifespan,
-		signingKeyFunc:    signingKeyFunc,
-		encryptionKeyFunc: encryptionKeyFunc,
+		lifespan:                  lifespan,
+		signingKeyFunc:            signingKeyFunc,
+		encryptionKeyFunc:         encryptionKeyFunc,
+		previousSigningKeyFunc:    previousSigningKeyFunc,
+		previousEncryptionKeyFunc: previousEncryptionKeyFunc,
 	}
 }
 
 // Encode implements oidc.Encode().
 func (c *Codec) Encode(name string, value interface{}) (string, error) {
-	return c.delegate().Encode(name, value)
+	return c.delegate(c.signingKeyFunc(), c.encryptionKeyFunc()).Encode(name, value)
 }
 
 // Decode implements oidc.Decode().
 func (c *Codec) Decode(name string, value string, into interface{}) error {
-	return c.delegate().Decode(name, value, into)
+	signingKeys := keys(c.signingKeyFunc, c.previousSigningKeyFunc)
+	encryptionKeys := keys(c.encryptionKeyFunc, c.previousEncryptionKeyFunc)
+
+	err := c.delegate(signingKeys[0], encryptionKeys[0]).Decode(name, value, into)
+	if err == nil {
+		return nil
+	}
+
+	// The signing and encryption keys are rotated independently, so the value could have been encoded using any
+	// combination of the current and previous keys.
+	for i, signingKey := range signingKeys {
+		for j, encryptionKey := range encryptionKeys {
+			if i == 0 && j == 0 {
+				continue // already tried above
+			}
+			if c.delegate(signingKey, encryptionKey).Decode(name, value, into) == nil {
+				return nil
+			}
+		}
+	}
+
+	// Report the error from the current keys, since the previous keys are only a fallback.
+	return err
 }
 
-func (c *Codec) delegate() *securecookie.SecureCookie {
-	codec := securecookie.New(c.signingKeyFunc(), c.encryptionKeyFunc())
+func (c *Codec) delegate(signingKey, encryptionKey []byte) *securecookie.SecureCookie {
+	codec := securecookie.New(signingKey, encryptionKey)
 	codec.MaxAge(int(c.lifespan.Seconds()))
 	codec.SetSerializer(securecookie.JSONEncoder{})
 	return codec
 }
+
+// keys returns the current key, followed by the previous key when there is one.
+func keys(current, previous KeyFunc) [][]byte {
+	result := [][]byte{current()}
+	if previous != nil {
+		if previousKey := previous(); len(previousKey) > 0 {
+			result = append(result, previousKey)
+		}
+	}
+	return result
+}
@@ -1,4 +1,4 @@
-// Copyright 2020 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package dynamiccodec
@@ -96,7 +96,7 @@ func TestCodec(t *testing.T) {
 			}
 
 			encoder := New(lifespan, func() []byte { return encoderSigningKey },
-				func() []byte { return encoderEncryptionKey })
+				func() []byte { return encoderEncryptionKey }, nil, nil)
 
 			encoded, err := encoder.Encode("some-name", "some-message")
 			if test.wantEncoderErrorPrefix != "" {
@@ -110,7 +110,7 @@ func TestCodec(t *testing.T) {
 			}
 
 			decoder := New(lifespan, func() []byte { return decoderSigningKey },
-				func() []byte { return decoderEncryptionKey })
+				func() []byte { return decoderEncryptionKey }, nil, nil)
 
 			var decoded string
 			err = decoder.Decode("some-name", encoded, &decoded)
@@ -125,3 +125,112 @@ func TestCodec(t *testing.T) {
 		})
 	}
 }
+
+func TestCodecWithPreviousKeys(t *testing.T) {
+	var (
+		oldSigningKey    = []byte("old-signing-key")
+		newSigningKey    = []byte("new-signing-key")
+		oldEncryptionKey = []byte("16-byte-old-encr")
+		newEncryptionKey = []byte("16-byte-new-encr")
+	)
+
+	tests := []struct {
+		name                   string
+		encoderSigningKey      []byte
+		encoderEncryptionKey   []byte
+		decoderSigningKeys     [][]byte // current key, then optional previous key
+		decoderEncryptionKeys  [][]byte // current key, then optional previous key
+		wantDecoderErrorPrefix string
+	}{
+		{
+			name:                  "encoded using the current keys when there are previous keys",
+			encoderSigningKey:     newSigningKey,
+			encoderEncryptionKey:  newEncryptionKey,
+			decoderSigningKeys:    [][]byte{newSigningKey, oldSigningKey},
+			decoderEncryptionKeys: [][]byte{newEncryptionKey, oldEncryptionKey},
+		},
+		{
+			name:                  "encoded using the previous signing key",
+			encoderSigningKey:     oldSigningKey,
+			encoderEncryptionKey:  newEncryptionKey,
+			decoderSigningKeys:    [][]byte{newSigningKey, oldSigningKey},
+			decoderEncryptionKeys: [][]byte{newEncryptionKey},
+		},
+		{
+			name:                  "encoded using the previous encryption key",
+			encoderSigningKey:     newSigningKey,
+			encoderEncryptionKey:  oldEncryptionKey,
+			decoderSigningKeys:    [][]byte{newSigningKey},
+			decoderEncryptionKeys: [][]byte{newEncryptionKey, oldEncryptionKey},
+		},
+		{
+			name:                  "encoded using the previous signing and encryption keys",
+			encoderSigningKey:     oldSigningKey,
+			encoderEncryptionKey:  oldEncryptionKey,
+			decoderSigningKeys:    [][]byte{newSigningKey, oldSigningKey},
+			decoderEncryptionKeys: [][]byte{newEncryptionKey, oldEncryptionKey},
+		},
+		{
+			name:                  "encoded using the previous signing key and no encryption key",
+			encoderSigningKey:     oldSigningKey,
+			decoderSigningKeys:    [][]byte{newSigningKey, oldSigningKey},
+			decoderEncryptionKeys: [][]byte{nil},
+		},
+		{
+			name:                   "encoded using a signing key which is no longer the previous key",
+			encoderSigningKey:      oldSigningKey,
+			encoderEncryptionKey:   newEncryptionKey,
+			decoderSigningKeys:     [][]byte{newSigningKey},
+			decoderEncryptionKeys:  [][]byte{newEncryptionKey, oldEncryptionKey},
+			wantDecoderErrorPrefix: "securecookie: the value is not valid",
+		},
+		{
+			name:                   "encoded using an encryption key which is no longer the previous key",
+			encoderSigningKey:      newSigningKey,
+			encoderEncryptionKey:   oldEncryptionKey,
+			decoderSigningKeys:     [][]byte{newSigningKey, oldSigningKey},
+			decoderEncryptionKeys:  [][]byte{newEncryptionKey},
+			wantDecoderErrorPrefix: "securecookie: error - caused by: securecookie: error - caused by: ",
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			keyFuncs := func(keys [][]byte) (KeyFunc, KeyFunc) {
+				current := func() []byte { return keys[0] }
+				previous := func() []byte { return nil }
+				if len(keys) > 1 {
+					previous = func() []byte { return keys[1] }
+				}
+				return current, previous
+			}
+
+			encoder := New(time.Hour, func() []byte { return test.encoderSigningKey },
+				func() []byte { return test.encoderEncryptionKey }, nil, nil)
+			encoded, err := encoder.Encode("some-name", "some-message")
+			require.NoError(t, err)
+
+			signingKeyFunc, previousSigningKeyFunc := keyFuncs(test.decoderSigningKeys)
+			encryptionKeyFunc, previousEncryptionKeyFunc := keyFuncs(test.decoderEncryptionKeys)
+			decoder := New(time.Hour, signingKeyFunc, encryptionKeyFunc, previousSigningKeyFunc, previousEncryptionKeyFunc)
+
+			var decoded string
+			err = decoder.Decode("some-name", encoded, &decoded)
+			if test.wantDecoderErrorPrefix != "" {
+				require.Error(t, err)
+				require.True(t, strings.HasPrefix(err.Error(), test.wantDecoderErrorPrefix), "expected %q to start with %q", err.Error(), test.wantDecoderErrorPrefix)
+				require.Empty(t, decoded)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, "some-message", decoded)
+
+			// Values are always encoded using the current keys.
+			reencoded, err := decoder.Encode("some-name", "some-other-message")
+			require.NoError(t, err)
+			currentKeysOnlyDecoder := New(time.Hour, signingKeyFunc, encryptionKeyFunc, nil, nil)
+			require.NoError(t, currentKeysOnlyDecoder.Decode("some-name", reencoded, &decoded))
+			require.Equal(t, "some-other-message", decoded)
+		})
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package oidc
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/felixge/httpsnoop"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+
+	"go.pinniped.dev/internal/psession"
+)
+
+const (
+	// Values for the endpoint label of the endpoint metrics.
+	AuthorizationEndpointMetricsName = "authorize"
+	CallbackEndpointMetricsName      = "callback"
+	TokenEndpointMetricsName         = "token"
+
+	endpointMetricsOutcomeSuccess = "success"
+	endpointMetricsOutcomeFailure = "failure"
+)
+
+//nolint:gochecknoglobals // metrics are registered once per process
+var (
+	endpointRequestsTotal = metrics.NewCounterVec(&metrics.CounterOpts{
+		Namespace:      "pinniped",
+		Subsystem:      "supervisor",
+		Name:           "oidc_endpoint_requests_total",
+		Help:           "Number of requests handled by the Supervisor's OIDC endpoints, partitioned by upstream identity provider and outcome.",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"endpoint", "upstream_name", "upstream_type", "outcome"})
+
+	endpointRequestDuration = metrics.NewHistogramVec(&metrics.HistogramOpts{
+		Namespace:      "pinniped",
+		Subsystem:      "supervisor",
+		Name:           "oidc_endpoint_request_duration_seconds",
+		Help:           "Time taken to handle requests to the Supervisor's OIDC endpoints, partitioned by upstream identity provider and outcome.",
+		Buckets:        metrics.ExponentialBuckets(0.005, 2, 12), // 5ms to about 10s
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"endpoint", "upstream_name", "upstream_type", "outcome"})
+)
+
+//nolint:gochecknoinits
+func init() {
+	legacyregistry.MustRegister(endpointRequestsTotal, endpointRequestDuration)
+}
+
+type endpointMetricsContextKey struct{}
+
+// endpointMetricsRequestData is filled in by the handler while it serves a request. Each request gets its own
+// copy, so it does not need to be thread-safe.
+type endpointMetricsRequestData struct {
+	upstreamName string
+	upstreamType psession.ProviderType
+	failed       bool
+}
+
+// WithEndpointMetrics wraps the handler of an OIDC endpoint to count and time each request. A request is considered
+// to have failed when the handler responds with an error status code, or when it writes an OAuth error to the
+// client using WriteAuthorizeError. Handlers should call RecordUpstreamIDPForMetrics once they know which upstream
+// identity provider is being used, so that the request can be attributed to that provider.
+func WithEndpointMetrics(endpointName string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data := &endpointMetricsRequestData{}
+		r = r.WithContext(context.WithValue(r.Context(), endpointMetricsContextKey{}, data))
+
+		m := httpsnoop.CaptureMetrics(handler, w, r)
+
+		outcome := endpointMetricsOutcomeSuccess
+		if data.failed || m.Code >= http.StatusBadRequest {
+			outcome = endpointMetricsOutcomeFailure
+		}
+
+		labels := []string{endpointName, data.upstreamName, string(data.upstreamType), outcome}
+		endpointRequestsTotal.WithLabelValues(labels...).Inc()
+		endpointRequestDuration.WithLabelValues(labels...).Observe(m.Duration.Seconds())
+	})
+}
+
+// RecordUpstreamIDPForMetrics attributes the current request to the given upstream identity provider in the
+// metrics recorded by WithEndpointMetrics. It does nothing when the request is not being measured.
+func RecordUpstreamIDPForMetrics(ctx context.Context, upstreamName string, upstreamType psession.ProviderType) {
+	if data, ok := ctx.Value(endpointMetricsContextKey{}).(*endpointMetricsRequestData); ok {
+		data.upstreamName = upstreamName
+		data.upstreamType = upstreamType
+	}
+}
+
+// recordFailureForMetrics marks the current request as failed in the metrics recorded by WithEndpointMetrics.
+// This is needed for errors which are returned to the client using a redirect, since the status code of
+// the response does not reveal that they are errors.
+func recordFailureForMetrics(ctx context.Context) {
+	if data, ok := ctx.Value(endpointMetricsContextKey{}).(*endpointMetricsRequestData); ok {
+		data.failed = true
+	}
+}
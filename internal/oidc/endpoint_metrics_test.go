@@ -0,0 +1,95 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package oidc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/component-base/metrics/testutil"
+
+	"go.pinniped.dev/internal/psession"
+)
+
+func TestWithEndpointMetrics(t *testing.T) {
+	tests := []struct {
+		name         string
+		endpointName string
+		handler      http.HandlerFunc
+
+		wantUpstreamName string
+		wantUpstreamType string
+		wantOutcome      string
+	}{
+		{
+			name:         "successful request attributed to an upstream",
+			endpointName: "test-endpoint-1",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				RecordUpstreamIDPForMetrics(r.Context(), "some-upstream", psession.ProviderTypeLDAP)
+				w.WriteHeader(http.StatusFound)
+			},
+			wantUpstreamName: "some-upstream",
+			wantUpstreamType: "ldap",
+			wantOutcome:      "success",
+		},
+		{
+			name:         "request with an error status code which was not attributed to an upstream",
+			endpointName: "test-endpoint-2",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+			},
+			wantOutcome: "failure",
+		},
+		{
+			name:         "request which was explicitly marked as failed",
+			endpointName: "test-endpoint-3",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				RecordUpstreamIDPForMetrics(r.Context(), "some-upstream", psession.ProviderTypeOIDC)
+				recordFailureForMetrics(r.Context())
+				w.WriteHeader(http.StatusSeeOther)
+			},
+			wantUpstreamName: "some-upstream",
+			wantUpstreamType: "oidc",
+			wantOutcome:      "failure",
+		},
+		{
+			name:         "request with the default status code",
+			endpointName: "test-endpoint-4",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				RecordUpstreamIDPForMetrics(r.Context(), "some-upstream", psession.ProviderTypeActiveDirectory)
+				_, _ = w.Write([]byte("hello"))
+			},
+			wantUpstreamName: "some-upstream",
+			wantUpstreamType: "activedirectory",
+			wantOutcome:      "success",
+		},
+	}
+	for _, test := range tests {
+		tt := test
+		t.Run(tt.name, func(t *testing.T) {
+			rsp := httptest.NewRecorder()
+			WithEndpointMetrics(tt.endpointName, tt.handler).ServeHTTP(rsp, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			labels := []string{tt.endpointName, tt.wantUpstreamName, tt.wantUpstreamType, tt.wantOutcome}
+
+			count, err := testutil.GetCounterMetricValue(endpointRequestsTotal.WithLabelValues(labels...))
+			require.NoError(t, err)
+			require.Equal(t, float64(1), count)
+
+			observations, err := testutil.GetHistogramMetricCount(endpointRequestDuration.WithLabelValues(labels...))
+			require.NoError(t, err)
+			require.Equal(t, uint64(1), observations)
+		})
+	}
+}
+
+func TestRecordingMetricsDataWithoutEndpointMetricsDoesNothing(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	require.NotPanics(t, func() {
+		RecordUpstreamIDPForMetrics(req.Context(), "some-upstream", psession.ProviderTypeOIDC)
+		recordFailureForMetrics(req.Context())
+	})
+}
@@ -0,0 +1,117 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package oidc
+
+import (
+	"go.pinniped.dev/generated/latest/apis/supervisor/idpdiscovery/v1alpha1"
+	"go.pinniped.dev/internal/idtransform"
+	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/psession"
+)
+
+// federationDomainIdentityProvidersLister is a FederationDomainIdentityProvidersListerI which only returns the
+// upstream identity providers that are allowed by a particular FederationDomain.
+type federationDomainIdentityProvidersLister struct {
+	wrapped                     UpstreamIdentityProvidersLister
+	identityProviders           []*provider.FederationDomainIdentityProvider
+	clientCredentialsTransforms *idtransform.TransformationPipeline
+}
+
+// NewFederationDomainIdentityProvidersLister returns a FederationDomainIdentityProvidersListerI which filters the
+// results of the wrapped lister to only include the identityProviders allowed by a FederationDomain. When
+// identityProviders is empty, then all upstream identity providers are allowed, without any identity transformations.
+// The clientCredentialsTransforms may be nil when the identities of clients are not transformed. The filtering
+// happens each time one of the Get functions is called, because the upstream identity providers can change at any time.
+func NewFederationDomainIdentityProvidersLister(
+	wrapped UpstreamIdentityProvidersLister,
+	identityProviders []*provider.FederationDomainIdentityProvider,
+	clientCredentialsTransforms *idtransform.TransformationPipeline,
+) FederationDomainIdentityProvidersListerI {
+	return &federationDomainIdentityProvidersLister{
+		wrapped:                     wrapped,
+		identityProviders:           identityProviders,
+		clientCredentialsTransforms: clientCredentialsTransforms,
+	}
+}
+
+func (l *federationDomainIdentityProvidersLister) GetOIDCIdentityProviders() []provider.UpstreamOIDCIdentityProviderI {
+	var allowed []provider.UpstreamOIDCIdentityProviderI
+	for _, p := range l.wrapped.GetOIDCIdentityProviders() {
+		if l.isAllowed(p.GetName(), v1alpha1.IDPTypeOIDC) {
+			allowed = append(allowed, p)
+		}
+	}
+	return allowed
+}
+
+func (l *federationDomainIdentityProvidersLister) GetLDAPIdentityProviders() []provider.UpstreamLDAPIdentityProviderI {
+	var allowed []provider.UpstreamLDAPIdentityProviderI
+	for _, p := range l.wrapped.GetLDAPIdentityProviders() {
+		if l.isAllowed(p.GetName(), v1alpha1.IDPTypeLDAP) {
+			allowed = append(allowed, p)
+		}
+	}
+	return allowed
+}
+
+func (l *federationDomainIdentityProvidersLister) GetActiveDirectoryIdentityProviders() []provider.UpstreamLDAPIdentityProviderI {
+	var allowed []provider.UpstreamLDAPIdentityProviderI
+	for _, p := range l.wrapped.GetActiveDirectoryIdentityProviders() {
+		if l.isAllowed(p.GetName(), v1alpha1.IDPTypeActiveDirectory) {
+			allowed = append(allowed, p)
+		}
+	}
+	return allowed
+}
+
+func (l *federationDomainIdentityProvidersLister) GetSAMLIdentityProviders() []provider.UpstreamSAMLIdentityProviderI {
+	var allowed []provider.UpstreamSAMLIdentityProviderI
+	for _, p := range l.wrapped.GetSAMLIdentityProviders() {
+		if l.isAllowed(p.GetName(), v1alpha1.IDPTypeSAML) {
+			allowed = append(allowed, p)
+		}
+	}
+	return allowed
+}
+
+func (l *federationDomainIdentityProvidersLister) GetGitHubIdentityProviders() []provider.UpstreamGitHubIdentityProviderI {
+	var allowed []provider.UpstreamGitHubIdentityProviderI
+	for _, p := range l.wrapped.GetGitHubIdentityProviders() {
+		if l.isAllowed(p.GetName(), v1alpha1.IDPTypeGitHub) {
+			allowed = append(allowed, p)
+		}
+	}
+	return allowed
+}
+
+func (l *federationDomainIdentityProvidersLister) GetIdentityTransformations(
+	idpName string,
+	idpType psession.ProviderType,
+) *idtransform.TransformationPipeline {
+	idp := l.find(idpName, v1alpha1.IDPType(idpType))
+	if idp == nil || idp.Transforms == nil {
+		return idtransform.NewTransformationPipeline()
+	}
+	return idp.Transforms
+}
+
+func (l *federationDomainIdentityProvidersLister) GetClientCredentialsTransformations() *idtransform.TransformationPipeline {
+	if l.clientCredentialsTransforms == nil {
+		return idtransform.NewTransformationPipeline()
+	}
+	return l.clientCredentialsTransforms
+}
+
+func (l *federationDomainIdentityProvidersLister) isAllowed(name string, idpType v1alpha1.IDPType) bool {
+	return len(l.identityProviders) == 0 || l.find(name, idpType) != nil
+}
+
+func (l *federationDomainIdentityProvidersLister) find(name string, idpType v1alpha1.IDPType) *provider.FederationDomainIdentityProvider {
+	for _, idp := range l.identityProviders {
+		if idp.Name == name && idp.Type == idpType {
+			return idp
+		}
+	}
+	return nil
+}
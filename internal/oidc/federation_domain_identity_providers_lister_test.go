@@ -0,0 +1,186 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package oidc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"go.pinniped.dev/generated/latest/apis/supervisor/idpdiscovery/v1alpha1"
+	"go.pinniped.dev/internal/celtransformer"
+	"go.pinniped.dev/internal/idtransform"
+	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/psession"
+	"go.pinniped.dev/internal/testutil/oidctestutil"
+)
+
+func TestFederationDomainIdentityProvidersLister(t *testing.T) {
+	wrapped := oidctestutil.NewUpstreamIDPListerBuilder().
+		WithOIDC(
+			oidctestutil.NewTestUpstreamOIDCIdentityProviderBuilder().WithName("oidc1").Build(),
+			oidctestutil.NewTestUpstreamOIDCIdentityProviderBuilder().WithName("oidc2").Build(),
+		).
+		WithLDAP(
+			&oidctestutil.TestUpstreamLDAPIdentityProvider{Name: "ldap1"},
+			&oidctestutil.TestUpstreamLDAPIdentityProvider{Name: "shared-name"},
+		).
+		WithActiveDirectory(
+			&oidctestutil.TestUpstreamLDAPIdentityProvider{Name: "ad1"},
+			&oidctestutil.TestUpstreamLDAPIdentityProvider{Name: "shared-name"},
+		).
+		Build()
+
+	tests := []struct {
+		name              string
+		identityProviders []*provider.FederationDomainIdentityProvider
+		wantOIDCNames     []string
+		wantLDAPNames     []string
+		wantADNames       []string
+	}{
+		{
+			name:              "no identity providers listed allows all upstreams",
+			identityProviders: nil,
+			wantOIDCNames:     []string{"oidc1", "oidc2"},
+			wantLDAPNames:     []string{"ldap1", "shared-name"},
+			wantADNames:       []string{"ad1", "shared-name"},
+		},
+		{
+			name: "only the listed identity providers are allowed",
+			identityProviders: []*provider.FederationDomainIdentityProvider{
+				{Name: "oidc2", Type: v1alpha1.IDPTypeOIDC},
+				{Name: "shared-name", Type: v1alpha1.IDPTypeActiveDirectory},
+			},
+			wantOIDCNames: []string{"oidc2"},
+			wantADNames:   []string{"shared-name"},
+		},
+		{
+			name: "the type must also match",
+			identityProviders: []*provider.FederationDomainIdentityProvider{
+				{Name: "oidc1", Type: v1alpha1.IDPTypeLDAP},
+				{Name: "ldap1", Type: v1alpha1.IDPTypeLDAP},
+			},
+			wantLDAPNames: []string{"ldap1"},
+		},
+		{
+			name: "listed identity providers which do not exist are ignored",
+			identityProviders: []*provider.FederationDomainIdentityProvider{
+				{Name: "does-not-exist", Type: v1alpha1.IDPTypeOIDC},
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			lister := NewFederationDomainIdentityProvidersLister(wrapped, tt.identityProviders, nil)
+
+			var oidcNames, ldapNames, adNames []string
+			for _, p := range lister.GetOIDCIdentityProviders() {
+				oidcNames = append(oidcNames, p.GetName())
+			}
+			for _, p := range lister.GetLDAPIdentityProviders() {
+				ldapNames = append(ldapNames, p.GetName())
+			}
+			for _, p := range lister.GetActiveDirectoryIdentityProviders() {
+				adNames = append(adNames, p.GetName())
+			}
+
+			require.Equal(t, tt.wantOIDCNames, oidcNames)
+			require.Equal(t, tt.wantLDAPNames, ldapNames)
+			require.Equal(t, tt.wantADNames, adNames)
+		})
+	}
+}
+
+func TestFederationDomainIdentityProvidersListerGetIdentityTransformations(t *testing.T) {
+	ldapTransforms := oidctestutil.NewTransformationPipeline(t, nil,
+		&celtransformer.UsernameTransformation{Expression: `"ldap:" + username`},
+	)
+
+	lister := NewFederationDomainIdentityProvidersLister(
+		oidctestutil.NewUpstreamIDPListerBuilder().Build(),
+		[]*provider.FederationDomainIdentityProvider{
+			{Name: "shared-name", Type: v1alpha1.IDPTypeLDAP, Transforms: ldapTransforms},
+			{Name: "shared-name", Type: v1alpha1.IDPTypeOIDC},
+		},
+		nil,
+	)
+
+	tests := []struct {
+		name         string
+		idpName      string
+		idpType      psession.ProviderType
+		wantUsername string
+	}{
+		{
+			name:         "identity provider with transforms",
+			idpName:      "shared-name",
+			idpType:      psession.ProviderTypeLDAP,
+			wantUsername: "ldap:ryan",
+		},
+		{
+			name:         "identity provider without transforms returns an empty pipeline",
+			idpName:      "shared-name",
+			idpType:      psession.ProviderTypeOIDC,
+			wantUsername: "ryan",
+		},
+		{
+			name:         "identity provider which is not listed returns an empty pipeline",
+			idpName:      "shared-name",
+			idpType:      psession.ProviderTypeActiveDirectory,
+			wantUsername: "ryan",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			pipeline := lister.GetIdentityTransformations(tt.idpName, tt.idpType)
+			require.NotNil(t, pipeline)
+
+			result, err := pipeline.Evaluate(context.Background(), "ryan", []string{"group1"})
+			require.NoError(t, err)
+			require.Equal(t, tt.wantUsername, result.Username)
+			require.Equal(t, []string{"group1"}, result.Groups)
+		})
+	}
+}
+
+func TestFederationDomainIdentityProvidersListerGetClientCredentialsTransformations(t *testing.T) {
+	clientTransforms := oidctestutil.NewTransformationPipeline(t, nil,
+		&celtransformer.UsernameTransformation{Expression: `"client:" + username`},
+	)
+
+	tests := []struct {
+		name                        string
+		clientCredentialsTransforms *idtransform.TransformationPipeline
+		wantUsername                string
+	}{
+		{
+			name:                        "with transforms",
+			clientCredentialsTransforms: clientTransforms,
+			wantUsername:                "client:ci-runner",
+		},
+		{
+			name:                        "without transforms returns an empty pipeline",
+			clientCredentialsTransforms: nil,
+			wantUsername:                "ci-runner",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			lister := NewFederationDomainIdentityProvidersLister(
+				oidctestutil.NewUpstreamIDPListerBuilder().Build(), nil, tt.clientCredentialsTransforms)
+
+			pipeline := lister.GetClientCredentialsTransformations()
+			require.NotNil(t, pipeline)
+
+			result, err := pipeline.Evaluate(context.Background(), "ci-runner", []string{"ci"})
+			require.NoError(t, err)
+			require.Equal(t, tt.wantUsername, result.Username)
+			require.Equal(t, []string{"ci"}, result.Groups)
+		})
+	}
+}
@@ -1,4 +1,4 @@
-// Copyright 2021-2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2021-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 // Package idpdiscovery provides a handler for the upstream IDP discovery endpoint.
@@ -37,29 +37,55 @@ func NewHandler(upstreamIDPs oidc.UpstreamIdentityProvidersLister) http.Handler
 }
 
 func responseAsJSON(upstreamIDPs oidc.UpstreamIdentityProvidersLister) ([]byte, error) {
-	r := v1alpha1.IDPDiscoveryResponse{PinnipedIDPs: []v1alpha1.PinnipedIDP{}}
+	r := v1alpha1.IDPDiscoveryResponse{PinnipedIDPs: GetIDPList(upstreamIDPs)}
+
+	var b bytes.Buffer
+	encodeErr := json.NewEncoder(&b).Encode(&r)
+	encodedMetadata := b.Bytes()
+
+	return encodedMetadata, encodeErr
+}
+
+// GetIDPList returns the upstream IDPs which are currently available, along with the flows that each supports,
+// sorted by name. This is the same list which is served by the upstream IDP discovery endpoint.
+func GetIDPList(upstreamIDPs oidc.UpstreamIdentityProvidersLister) []v1alpha1.PinnipedIDP {
+	pinnipedIDPs := []v1alpha1.PinnipedIDP{}
 
 	// The cache of IDPs could change at any time, so always recalculate the list.
 	for _, provider := range upstreamIDPs.GetLDAPIdentityProviders() {
-		r.PinnipedIDPs = append(r.PinnipedIDPs, v1alpha1.PinnipedIDP{
+		pinnipedIDPs = append(pinnipedIDPs, v1alpha1.PinnipedIDP{
 			Name:  provider.GetName(),
 			Type:  v1alpha1.IDPTypeLDAP,
 			Flows: []v1alpha1.IDPFlow{v1alpha1.IDPFlowCLIPassword, v1alpha1.IDPFlowBrowserAuthcode},
 		})
 	}
 	for _, provider := range upstreamIDPs.GetActiveDirectoryIdentityProviders() {
-		r.PinnipedIDPs = append(r.PinnipedIDPs, v1alpha1.PinnipedIDP{
+		pinnipedIDPs = append(pinnipedIDPs, v1alpha1.PinnipedIDP{
 			Name:  provider.GetName(),
 			Type:  v1alpha1.IDPTypeActiveDirectory,
 			Flows: []v1alpha1.IDPFlow{v1alpha1.IDPFlowCLIPassword, v1alpha1.IDPFlowBrowserAuthcode},
 		})
 	}
+	for _, provider := range upstreamIDPs.GetSAMLIdentityProviders() {
+		pinnipedIDPs = append(pinnipedIDPs, v1alpha1.PinnipedIDP{
+			Name:  provider.GetName(),
+			Type:  v1alpha1.IDPTypeSAML,
+			Flows: []v1alpha1.IDPFlow{v1alpha1.IDPFlowBrowserAuthcode},
+		})
+	}
+	for _, provider := range upstreamIDPs.GetGitHubIdentityProviders() {
+		pinnipedIDPs = append(pinnipedIDPs, v1alpha1.PinnipedIDP{
+			Name:  provider.GetName(),
+			Type:  v1alpha1.IDPTypeGitHub,
+			Flows: []v1alpha1.IDPFlow{v1alpha1.IDPFlowBrowserAuthcode},
+		})
+	}
 	for _, provider := range upstreamIDPs.GetOIDCIdentityProviders() {
 		flows := []v1alpha1.IDPFlow{v1alpha1.IDPFlowBrowserAuthcode}
 		if provider.AllowsPasswordGrant() {
 			flows = append(flows, v1alpha1.IDPFlowCLIPassword)
 		}
-		r.PinnipedIDPs = append(r.PinnipedIDPs, v1alpha1.PinnipedIDP{
+		pinnipedIDPs = append(pinnipedIDPs, v1alpha1.PinnipedIDP{
 			Name:  provider.GetName(),
 			Type:  v1alpha1.IDPTypeOIDC,
 			Flows: flows,
@@ -67,13 +93,9 @@ func responseAsJSON(upstreamIDPs oidc.UpstreamIdentityProvidersLister) ([]byte,
 	}
 
 	// Nobody like an API that changes the results unnecessarily. :)
-	sort.SliceStable(r.PinnipedIDPs, func(i, j int) bool {
-		return r.PinnipedIDPs[i].Name < r.PinnipedIDPs[j].Name
+	sort.SliceStable(pinnipedIDPs, func(i, j int) bool {
+		return pinnipedIDPs[i].Name < pinnipedIDPs[j].Name
 	})
 
-	var b bytes.Buffer
-	encodeErr := json.NewEncoder(&b).Encode(&r)
-	encodedMetadata := b.Bytes()
-
-	return encodedMetadata, encodeErr
+	return pinnipedIDPs
 }
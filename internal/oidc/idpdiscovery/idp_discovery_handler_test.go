@@ -39,6 +39,8 @@ func TestIDPDiscovery(t *testing.T) {
 				"pinniped_identity_providers": [
 					{"name": "a-some-ldap-idp", "type": "ldap",            "flows": ["cli_password", "browser_authcode"]},
 					{"name": "a-some-oidc-idp", "type": "oidc",            "flows": ["browser_authcode"]},
+					{"name": "b-some-saml-idp", "type": "saml",            "flows": ["browser_authcode"]},
+					{"name": "c-some-github-idp", "type": "github",        "flows": ["browser_authcode"]},
 					{"name": "x-some-idp",      "type": "ldap",            "flows": ["cli_password", "browser_authcode"]},
 					{"name": "x-some-idp",      "type": "oidc",            "flows": ["browser_authcode"]},
 					{"name": "y-some-ad-idp",   "type": "activedirectory", "flows": ["cli_password", "browser_authcode"]},
@@ -51,10 +53,12 @@ func TestIDPDiscovery(t *testing.T) {
 				"pinniped_identity_providers": [
 					{"name": "some-other-ad-idp-1",   "type": "activedirectory", "flows": ["cli_password", "browser_authcode"]},
 					{"name": "some-other-ad-idp-2",   "type": "activedirectory", "flows": ["cli_password", "browser_authcode"]},
+					{"name": "some-other-github-idp-1", "type": "github",        "flows": ["browser_authcode"]},
 					{"name": "some-other-ldap-idp-1", "type": "ldap",            "flows": ["cli_password", "browser_authcode"]},
 					{"name": "some-other-ldap-idp-2", "type": "ldap",            "flows": ["cli_password", "browser_authcode"]},
 					{"name": "some-other-oidc-idp-1", "type": "oidc",            "flows": ["browser_authcode", "cli_password"]},
-					{"name": "some-other-oidc-idp-2", "type": "oidc",            "flows": ["browser_authcode"]}
+					{"name": "some-other-oidc-idp-2", "type": "oidc",            "flows": ["browser_authcode"]},
+					{"name": "some-other-saml-idp-1", "type": "saml",            "flows": ["browser_authcode"]}
 				]
 			}`),
 		},
@@ -79,6 +83,8 @@ func TestIDPDiscovery(t *testing.T) {
 				WithLDAP(&oidctestutil.TestUpstreamLDAPIdentityProvider{Name: "x-some-idp"}).
 				WithActiveDirectory(&oidctestutil.TestUpstreamLDAPIdentityProvider{Name: "z-some-ad-idp"}).
 				WithActiveDirectory(&oidctestutil.TestUpstreamLDAPIdentityProvider{Name: "y-some-ad-idp"}).
+				WithSAML(&oidctestutil.TestUpstreamSAMLIdentityProvider{Name: "b-some-saml-idp"}).
+				WithGitHub(&oidctestutil.TestUpstreamGitHubIdentityProvider{Name: "c-some-github-idp"}).
 				Build()
 
 			handler := NewHandler(idpLister)
@@ -113,6 +119,14 @@ func TestIDPDiscovery(t *testing.T) {
 				&oidctestutil.TestUpstreamLDAPIdentityProvider{Name: "some-other-ad-idp-1"},
 			})
 
+			idpLister.SetSAMLIdentityProviders([]provider.UpstreamSAMLIdentityProviderI{
+				&oidctestutil.TestUpstreamSAMLIdentityProvider{Name: "some-other-saml-idp-1"},
+			})
+
+			idpLister.SetGitHubIdentityProviders([]provider.UpstreamGitHubIdentityProviderI{
+				&oidctestutil.TestUpstreamGitHubIdentityProvider{Name: "some-other-github-idp-1"},
+			})
+
 			// Make the same request to the same handler instance again, and expect different results.
 			rsp = httptest.NewRecorder()
 			handler.ServeHTTP(rsp, req)
@@ -0,0 +1,120 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package introspection provides a handler for the OAuth 2.0 token introspection endpoint (RFC 7662).
+package introspection
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ory/fosite"
+
+	oidcapi "go.pinniped.dev/generated/latest/apis/supervisor/oidc"
+	"go.pinniped.dev/internal/httputil/httperr"
+	"go.pinniped.dev/internal/oidc"
+	"go.pinniped.dev/internal/plog"
+	"go.pinniped.dev/internal/psession"
+)
+
+// response is the body of a successful introspection response, as described in
+// https://datatracker.ietf.org/doc/html/rfc7662#section-2.2. The username and groups are not defined by the RFC.
+// They are the same values that appear in the username and groups claims of the session's ID tokens.
+type response struct {
+	Active    bool     `json:"active"`
+	Subject   string   `json:"sub,omitempty"`
+	Username  string   `json:"username,omitempty"`
+	Groups    []string `json:"groups,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+}
+
+// NewHandler returns an http.Handler which serves the RFC 7662 token introspection endpoint. Resource servers use it
+// to check whether a downstream access token is active, and to find out who it belongs to. The caller must
+// authenticate as an OIDCClient using its client secret in an HTTP basic auth header. Tokens which are unknown,
+// expired, revoked, or which are not access tokens, are reported as inactive.
+func NewHandler(oauthHelper fosite.OAuth2Provider) http.Handler {
+	return httperr.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		ctx := r.Context()
+
+		if r.Method != http.MethodPost {
+			return httperr.Newf(http.StatusMethodNotAllowed, "%s (try POST)", r.Method)
+		}
+
+		// Fosite would also allow the caller to authenticate using any active access token as a bearer token, which
+		// would let any logged-in user introspect the tokens of other users, so only allow client authentication.
+		if fosite.AccessTokenFromRequest(r) != "" {
+			plog.Info("introspection request error", "reason", "bearer token authentication is not allowed")
+			oauthHelper.WriteIntrospectionError(ctx, w, fosite.ErrRequestUnauthorized.WithHint("Bearer tokens may not be used to authenticate introspection requests."))
+			return nil
+		}
+		if _, _, ok := r.BasicAuth(); !ok {
+			plog.Info("introspection request error", "reason", "missing client credentials")
+			oauthHelper.WriteIntrospectionError(ctx, w, fosite.ErrRequestUnauthorized.WithHint("HTTP Authorization header missing."))
+			return nil
+		}
+
+		// This authenticates the client, and then looks up the session of the token in the KubeStorage.
+		introspectionResponse, err := oauthHelper.NewIntrospectionRequest(ctx, r, psession.NewPinnipedSession())
+		if err != nil {
+			plog.Info("introspection request error", oidc.FositeErrorForLog(err)...)
+			oauthHelper.WriteIntrospectionError(ctx, w, err)
+			return nil
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+
+		if introspectionResponse.GetTokenUse() != fosite.AccessToken {
+			plog.Info("introspection request error", "reason", "token is not an access token", "tokenUse", introspectionResponse.GetTokenUse())
+			return json.NewEncoder(w).Encode(&response{Active: false})
+		}
+
+		return json.NewEncoder(w).Encode(activeResponse(introspectionResponse.GetAccessRequester()))
+	})
+}
+
+func activeResponse(accessRequester fosite.AccessRequester) *response {
+	resp := &response{
+		Active:   true,
+		ClientID: accessRequester.GetClient().GetID(),
+	}
+
+	if expiresAt := accessRequester.GetSession().GetExpiresAt(fosite.AccessToken); !expiresAt.IsZero() {
+		resp.ExpiresAt = expiresAt.Unix()
+	}
+
+	session, ok := accessRequester.GetSession().(*psession.PinnipedSession)
+	if !ok || session.Fosite == nil || session.Fosite.Claims == nil {
+		return resp
+	}
+	resp.Subject = session.Fosite.Claims.Subject
+
+	// The username and groups were only put into the session when the client was granted the corresponding scopes.
+	extra := session.Fosite.Claims.Extra
+	if username, ok := extra[oidcapi.IDTokenClaimUsername].(string); ok {
+		resp.Username = username
+	}
+	resp.Groups = stringSlice(extra[oidcapi.IDTokenClaimGroups])
+
+	return resp
+}
+
+// stringSlice converts the value of a claim to a string slice. Claims which were read back from storage are
+// unmarshalled from JSON as []interface{} rather than as []string.
+func stringSlice(value interface{}) []string {
+	switch list := value.(type) {
+	case []string:
+		return list
+	case []interface{}:
+		result := make([]string, 0, len(list))
+		for _, item := range list {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package introspection
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ory/fosite/token/jwt"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"k8s.io/client-go/kubernetes/fake"
+
+	supervisorfake "go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned/fake"
+	"go.pinniped.dev/internal/oidc"
+	"go.pinniped.dev/internal/oidc/jwks"
+	"go.pinniped.dev/internal/oidc/oidcclientvalidator"
+	"go.pinniped.dev/internal/psession"
+	"go.pinniped.dev/internal/testutil"
+	"go.pinniped.dev/internal/testutil/oidctestutil"
+)
+
+const (
+	downstreamIssuer      = "https://my-downstream-issuer.com/path"
+	downstreamRedirectURI = "http://127.0.0.1/callback"
+	downstreamClientID    = "pinniped-cli"
+	downstreamSubject     = "https://some-upstream-issuer.com?sub=some-upstream-subject"
+	downstreamUsername    = "some-downstream-username"
+
+	resourceServerClientID  = "client.oauth.pinniped.dev-resource-server"
+	resourceServerClientUID = "fake-client-uid"
+)
+
+func TestIntrospectionEndpoint(t *testing.T) {
+	tests := []struct {
+		name string
+		// modifyForm may change the form of the request, which by default only has the access token in its token param.
+		modifyForm func(form url.Values, accessToken, refreshToken string)
+		// modifyRequest may change the request, which by default is authenticated by the resource server's client
+		// ID and secret.
+		modifyRequest func(req *http.Request, accessToken string)
+		method        string
+
+		wantStatus   int
+		wantActive   bool
+		wantBodyJSON string
+		wantBody     string
+	}{
+		{
+			name:       "an active access token is described",
+			wantStatus: http.StatusOK,
+			wantActive: true,
+		},
+		{
+			name: "an access token is described even when the token_type_hint says otherwise",
+			modifyForm: func(form url.Values, _, _ string) {
+				form.Set("token_type_hint", "refresh_token")
+			},
+			wantStatus: http.StatusOK,
+			wantActive: true,
+		},
+		{
+			name: "a refresh token is reported as inactive",
+			modifyForm: func(form url.Values, _, refreshToken string) {
+				form.Set("token", refreshToken)
+			},
+			wantStatus:   http.StatusOK,
+			wantBodyJSON: `{"active": false}`,
+		},
+		{
+			name: "an unknown token is reported as inactive",
+			modifyForm: func(form url.Values, _, _ string) {
+				form.Set("token", "pin_at_some-unknown-token.some-signature")
+			},
+			wantStatus:   http.StatusOK,
+			wantBodyJSON: `{"active": false}`,
+		},
+		{
+			name: "a missing token is reported as inactive",
+			modifyForm: func(form url.Values, _, _ string) {
+				form.Del("token")
+				form.Set("unrelated", "param")
+			},
+			wantStatus:   http.StatusOK,
+			wantBodyJSON: `{"active": false}`,
+		},
+		{
+			name: "a client which uses the wrong secret is rejected",
+			modifyRequest: func(req *http.Request, _ string) {
+				req.SetBasicAuth(resourceServerClientID, "wrong-secret")
+			},
+			wantStatus: http.StatusUnauthorized,
+			wantBodyJSON: `{
+				"error": "request_unauthorized",
+				"error_description": "The request could not be authorized. OAuth 2.0 Client credentials are invalid."
+			}`,
+		},
+		{
+			name: "an unknown client is rejected",
+			modifyRequest: func(req *http.Request, _ string) {
+				req.SetBasicAuth("client.oauth.pinniped.dev-unknown", testutil.PlaintextPassword1)
+			},
+			wantStatus: http.StatusUnauthorized,
+			wantBodyJSON: `{
+				"error": "request_unauthorized",
+				"error_description": "The request could not be authorized. Unable to find OAuth 2.0 Client from HTTP basic authorization header."
+			}`,
+		},
+		{
+			name: "the public pinniped-cli client cannot authenticate",
+			modifyRequest: func(req *http.Request, _ string) {
+				req.SetBasicAuth(downstreamClientID, "")
+			},
+			wantStatus: http.StatusUnauthorized,
+			wantBodyJSON: `{
+				"error": "request_unauthorized",
+				"error_description": "The request could not be authorized. OAuth 2.0 Client credentials are invalid."
+			}`,
+		},
+		{
+			name: "a request without client credentials is rejected",
+			modifyRequest: func(req *http.Request, _ string) {
+				req.Header.Del("Authorization")
+			},
+			wantStatus: http.StatusUnauthorized,
+			wantBodyJSON: `{
+				"error": "request_unauthorized",
+				"error_description": "The request could not be authorized. HTTP Authorization header missing."
+			}`,
+		},
+		{
+			name: "a request which authenticates with a bearer token is rejected",
+			modifyRequest: func(req *http.Request, accessToken string) {
+				req.Header.Set("Authorization", "Bearer "+accessToken+"-other")
+			},
+			wantStatus: http.StatusUnauthorized,
+			wantBodyJSON: `{
+				"error": "request_unauthorized",
+				"error_description": "The request could not be authorized. Bearer tokens may not be used to authenticate introspection requests."
+			}`,
+		},
+		{
+			name: "a request which also has an access_token param is rejected",
+			modifyForm: func(form url.Values, accessToken, _ string) {
+				form.Set("access_token", accessToken)
+			},
+			wantStatus: http.StatusUnauthorized,
+			wantBodyJSON: `{
+				"error": "request_unauthorized",
+				"error_description": "The request could not be authorized. Bearer tokens may not be used to authenticate introspection requests."
+			}`,
+		},
+		{
+			name:       "GET requests are rejected",
+			method:     http.MethodGet,
+			wantStatus: http.StatusMethodNotAllowed,
+			wantBody:   "Method Not Allowed: GET (try POST)\n",
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			kubeClient := fake.NewSimpleClientset()
+			supervisorClient := supervisorfake.NewSimpleClientset()
+			secrets := kubeClient.CoreV1().Secrets("some-namespace")
+			oidcClientsClient := supervisorClient.ConfigV1alpha1().OIDCClients("some-namespace")
+
+			oidcClient, clientSecret := testutil.FullyCapableOIDCClientAndStorageSecret(t,
+				"some-namespace", resourceServerClientID, resourceServerClientUID, "https://resource-server.example.com/callback",
+				[]string{testutil.HashedPassword1AtGoMinCost}, oidcclientvalidator.Validate)
+			require.NoError(t, supervisorClient.Tracker().Add(oidcClient))
+			require.NoError(t, kubeClient.Tracker().Add(clientSecret))
+
+			// Use lower minimum required bcrypt cost than we would use in production to keep unit the tests fast.
+			oauthStore := oidc.NewKubeStorage(secrets, oidcClientsClient, downstreamIssuer, oidc.DefaultOIDCTimeoutsConfiguration(), bcrypt.MinCost)
+			hmacSecretFunc := func() []byte { return []byte("some secret - must have at least 32 bytes") }
+			oauthHelper := oidc.FositeOauth2Helper(oauthStore, downstreamIssuer, hmacSecretFunc, nil, jwks.NewDynamicJWKSProvider(), oidc.DefaultOIDCTimeoutsConfiguration(), nil)
+
+			loginTime := time.Now()
+			tokens := oidctestutil.SimulateLoginHavingAlreadyHappened(t, oauthHelper, oidctestutil.SimulatedLogin{
+				ClientID:    downstreamClientID,
+				RedirectURI: downstreamRedirectURI,
+				Scopes:      []string{"offline_access", "username", "groups"},
+				IDTokenClaims: &jwt.IDTokenClaims{
+					Subject: downstreamSubject,
+					Extra: map[string]interface{}{
+						"username": downstreamUsername,
+						"groups":   []string{"group1", "group2"},
+					},
+				},
+				CustomSessionData: &psession.CustomSessionData{
+					Username:     downstreamUsername,
+					ProviderUID:  "some-resource-uid",
+					ProviderName: "some-idp",
+					ProviderType: psession.ProviderTypeLDAP,
+					LDAP:         &psession.LDAPSessionData{UserDN: "some-user-dn"},
+				},
+			})
+			accessToken, refreshToken := tokens.AccessToken, tokens.RefreshToken
+
+			form := url.Values{"token": []string{accessToken}}
+			if test.modifyForm != nil {
+				test.modifyForm(form, accessToken, refreshToken)
+			}
+			method := http.MethodPost
+			if test.method != "" {
+				method = test.method
+			}
+			req := httptest.NewRequest(method, "/path/shouldn't/matter", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.SetBasicAuth(resourceServerClientID, testutil.PlaintextPassword1)
+			if test.modifyRequest != nil {
+				test.modifyRequest(req, accessToken)
+			}
+			rsp := httptest.NewRecorder()
+
+			subject := NewHandler(oauthHelper)
+			subject.ServeHTTP(rsp, req)
+			t.Logf("response: %#v", rsp)
+			t.Logf("response body: %q", rsp.Body.String())
+
+			require.Equal(t, test.wantStatus, rsp.Code)
+
+			switch {
+			case test.wantActive:
+				require.Equal(t, "application/json", rsp.Header().Get("Content-Type"))
+				require.Equal(t, "no-store", rsp.Header().Get("Cache-Control"))
+				var body map[string]interface{}
+				require.NoError(t, json.Unmarshal(rsp.Body.Bytes(), &body))
+
+				// The expiration time depends on when the access token was issued.
+				exp, ok := body["exp"].(float64)
+				require.True(t, ok, "wanted exp to be a number, but was %T", body["exp"])
+				wantExp := loginTime.Add(oidc.DefaultOIDCTimeoutsConfiguration().AccessTokenLifespan).Unix()
+				require.InDelta(t, wantExp, int64(exp), 2)
+				delete(body, "exp")
+
+				require.Equal(t, map[string]interface{}{
+					"active":    true,
+					"sub":       downstreamSubject,
+					"username":  downstreamUsername,
+					"groups":    []interface{}{"group1", "group2"},
+					"client_id": downstreamClientID,
+				}, body)
+			case test.wantBodyJSON != "":
+				require.JSONEq(t, test.wantBodyJSON, rsp.Body.String())
+			default:
+				require.Equal(t, test.wantBody, rsp.Body.String())
+			}
+		})
+	}
+}
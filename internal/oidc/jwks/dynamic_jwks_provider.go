@@ -1,4 +1,4 @@
-// Copyright 2020 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package jwks
@@ -13,31 +13,39 @@ type DynamicJWKSProvider interface {
 	SetIssuerToJWKSMap(
 		issuerToJWKSMap map[string]*jose.JSONWebKeySet,
 		issuerToActiveJWKMap map[string]*jose.JSONWebKey,
+		issuerToAdditionalActiveJWKsMap map[string]*jose.JSONWebKeySet,
 	)
 	GetJWKS(issuerName string) (jwks *jose.JSONWebKeySet, activeJWK *jose.JSONWebKey)
+	// GetActiveJWKForAlgorithm returns the active JWK which an issuer uses to sign tokens with the given algorithm,
+	// or nil when the issuer does not have an active JWK for that algorithm.
+	GetActiveJWKForAlgorithm(issuerName string, algorithm string) *jose.JSONWebKey
 }
 
 type dynamicJWKSProvider struct {
-	issuerToJWKSMap      map[string]*jose.JSONWebKeySet
-	issuerToActiveJWKMap map[string]*jose.JSONWebKey
-	mutex                sync.RWMutex
+	issuerToJWKSMap                 map[string]*jose.JSONWebKeySet
+	issuerToActiveJWKMap            map[string]*jose.JSONWebKey
+	issuerToAdditionalActiveJWKsMap map[string]*jose.JSONWebKeySet
+	mutex                           sync.RWMutex
 }
 
 func NewDynamicJWKSProvider() DynamicJWKSProvider {
 	return &dynamicJWKSProvider{
-		issuerToJWKSMap:      map[string]*jose.JSONWebKeySet{},
-		issuerToActiveJWKMap: map[string]*jose.JSONWebKey{},
+		issuerToJWKSMap:                 map[string]*jose.JSONWebKeySet{},
+		issuerToActiveJWKMap:            map[string]*jose.JSONWebKey{},
+		issuerToAdditionalActiveJWKsMap: map[string]*jose.JSONWebKeySet{},
 	}
 }
 
 func (p *dynamicJWKSProvider) SetIssuerToJWKSMap(
 	issuerToJWKSMap map[string]*jose.JSONWebKeySet,
 	issuerToActiveJWKMap map[string]*jose.JSONWebKey,
+	issuerToAdditionalActiveJWKsMap map[string]*jose.JSONWebKeySet,
 ) {
 	p.mutex.Lock() // acquire a write lock
 	defer p.mutex.Unlock()
 	p.issuerToJWKSMap = issuerToJWKSMap
 	p.issuerToActiveJWKMap = issuerToActiveJWKMap
+	p.issuerToAdditionalActiveJWKsMap = issuerToAdditionalActiveJWKsMap
 }
 
 func (p *dynamicJWKSProvider) GetJWKS(issuerName string) (*jose.JSONWebKeySet, *jose.JSONWebKey) {
@@ -45,3 +53,20 @@ func (p *dynamicJWKSProvider) GetJWKS(issuerName string) (*jose.JSONWebKeySet, *
 	defer p.mutex.RUnlock()
 	return p.issuerToJWKSMap[issuerName], p.issuerToActiveJWKMap[issuerName]
 }
+
+func (p *dynamicJWKSProvider) GetActiveJWKForAlgorithm(issuerName string, algorithm string) *jose.JSONWebKey {
+	p.mutex.RLock() // acquire a read lock
+	defer p.mutex.RUnlock()
+
+	if activeJWK := p.issuerToActiveJWKMap[issuerName]; activeJWK != nil && activeJWK.Algorithm == algorithm {
+		return activeJWK
+	}
+	if additionalActiveJWKs := p.issuerToAdditionalActiveJWKsMap[issuerName]; additionalActiveJWKs != nil {
+		for i := range additionalActiveJWKs.Keys {
+			if additionalActiveJWKs.Keys[i].Algorithm == algorithm {
+				return &additionalActiveJWKs.Keys[i]
+			}
+		}
+	}
+	return nil
+}
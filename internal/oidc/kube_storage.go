@@ -1,36 +1,47 @@
-// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package oidc
 
 import (
 	"context"
+	"sort"
 	"time"
 
 	"github.com/ory/fosite"
 	"github.com/ory/fosite/handler/oauth2"
 	"github.com/ory/fosite/handler/openid"
 	fositepkce "github.com/ory/fosite/handler/pkce"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
 	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
 
 	"go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned/typed/config/v1alpha1"
+	"go.pinniped.dev/internal/crud"
+	"go.pinniped.dev/internal/fositestorage"
 	"go.pinniped.dev/internal/fositestorage/accesstoken"
 	"go.pinniped.dev/internal/fositestorage/authorizationcode"
+	"go.pinniped.dev/internal/fositestorage/clientassertion"
 	"go.pinniped.dev/internal/fositestorage/openidconnect"
 	"go.pinniped.dev/internal/fositestorage/pkce"
 	"go.pinniped.dev/internal/fositestorage/refreshtoken"
 	"go.pinniped.dev/internal/fositestoragei"
 	"go.pinniped.dev/internal/oidc/clientregistry"
 	"go.pinniped.dev/internal/oidcclientsecretstorage"
+	"go.pinniped.dev/internal/plog"
 )
 
 type KubeStorage struct {
+	secrets                  corev1client.SecretInterface
+	issuer                   string
 	clientManager            fosite.ClientManager
 	authorizationCodeStorage oauth2.AuthorizeCodeStorage
 	pkceStorage              fositepkce.PKCERequestStorage
 	oidcStorage              openid.OpenIDConnectRequestStorage
 	accessTokenStorage       accesstoken.RevocationStorage
 	refreshTokenStorage      refreshtoken.RevocationStorage
+	clientAssertionStorage   clientassertion.Storage
 }
 
 var _ fositestoragei.AllFositeStorage = &KubeStorage{}
@@ -38,17 +49,21 @@ var _ fositestoragei.AllFositeStorage = &KubeStorage{}
 func NewKubeStorage(
 	secrets corev1client.SecretInterface,
 	oidcClientsClient v1alpha1.OIDCClientInterface,
+	issuer string,
 	timeoutsConfiguration TimeoutsConfiguration,
 	minBcryptCost int,
 ) *KubeStorage {
 	nowFunc := time.Now
 	return &KubeStorage{
+		secrets:                  secrets,
+		issuer:                   issuer,
 		clientManager:            clientregistry.NewClientManager(oidcClientsClient, oidcclientsecretstorage.New(secrets), minBcryptCost),
 		authorizationCodeStorage: authorizationcode.New(secrets, nowFunc, timeoutsConfiguration.AuthorizationCodeSessionStorageLifetime),
 		pkceStorage:              pkce.New(secrets, nowFunc, timeoutsConfiguration.PKCESessionStorageLifetime),
 		oidcStorage:              openidconnect.New(secrets, nowFunc, timeoutsConfiguration.OIDCSessionStorageLifetime),
-		accessTokenStorage:       accesstoken.New(secrets, nowFunc, timeoutsConfiguration.AccessTokenSessionStorageLifetime),
-		refreshTokenStorage:      refreshtoken.New(secrets, nowFunc, timeoutsConfiguration.RefreshTokenSessionStorageLifetime),
+		accessTokenStorage:       accesstoken.New(secrets, nowFunc, timeoutsConfiguration.AccessTokenSessionStorageLifetime, issuer),
+		refreshTokenStorage:      refreshtoken.New(secrets, nowFunc, timeoutsConfiguration.RefreshTokenSessionStorageLifetime, issuer),
+		clientAssertionStorage:   clientassertion.New(secrets, nowFunc),
 	}
 }
 
@@ -199,10 +214,90 @@ func (k KubeStorage) GetClient(ctx context.Context, id string) (fosite.Client, e
 	return k.clientManager.GetClient(ctx, id)
 }
 
+//
+// Client assertion JWTs:
+//
+// These are keyed by the "jti" claim of the client assertion JWTs which clients use for private_key_jwt authentication.
+//
+// Fosite will check these and then create them in each endpoint which authenticates clients, so each client assertion
+// can only be used once. They are garbage collected after their client assertion expires.
+//
+
 func (k KubeStorage) ClientAssertionJWTValid(ctx context.Context, jti string) error {
-	return k.clientManager.ClientAssertionJWTValid(ctx, jti)
+	return k.clientAssertionStorage.ClientAssertionJWTValid(ctx, jti)
 }
 
 func (k KubeStorage) SetClientAssertionJWT(ctx context.Context, jti string, exp time.Time) error {
-	return k.clientManager.SetClientAssertionJWT(ctx, jti, exp)
+	return k.clientAssertionStorage.SetClientAssertionJWT(ctx, jti, exp)
+}
+
+//
+// Downstream sessions:
+//
+// Fosite only ever looks up the storage of a session by the signature of one of its tokens. These methods find the
+// sessions of a user without having any of their tokens, e.g. to end those sessions during RP-initiated logout.
+//
+
+// ListSessionsOfSubject returns the stored requests of the sessions of the given client and downstream subject which
+// were started by this FederationDomain and which still have an access token or a refresh token. The ID of each request
+// is the ID of its session, which can be used to revoke the tokens of the session. When a session has both kinds of
+// tokens, then the request from the refresh token storage is returned, because it holds the latest upstream tokens of
+// the session. Only the storage of the sessions of the subject is read, because it is selected by its label.
+func (k KubeStorage) ListSessionsOfSubject(ctx context.Context, clientID string, subject string) ([]fosite.Requester, error) {
+	typeRequirement, err := labels.NewRequirement(crud.SecretLabelKey, selection.In,
+		[]string{accesstoken.TypeLabelValue, refreshtoken.TypeLabelValue})
+	if err != nil {
+		return nil, err
+	}
+	subjectRequirement, err := labels.NewRequirement(fositestorage.SessionOfSubjectLabelName, selection.Equals,
+		[]string{fositestorage.SessionOfSubjectLabelValue(k.issuer, clientID, subject)})
+	if err != nil {
+		return nil, err
+	}
+	secrets, err := k.secrets.List(ctx, metav1.ListOptions{
+		LabelSelector: labels.NewSelector().Add(*typeRequirement, *subjectRequirement).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	requestsByID := map[string]fosite.Requester{}
+	var requestIDs []string
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		var request *fosite.Request
+		switch secret.Labels[crud.SecretLabelKey] {
+		case refreshtoken.TypeLabelValue:
+			refreshTokenSession, err := refreshtoken.ReadFromSecret(secret)
+			if err != nil {
+				plog.WarningErr("could not read refresh token session storage", err, "secretName", secret.Name)
+				continue
+			}
+			request = refreshTokenSession.Request
+		case accesstoken.TypeLabelValue:
+			accessTokenSession, err := accesstoken.ReadFromSecret(secret)
+			if err != nil {
+				plog.WarningErr("could not read access token session storage", err, "secretName", secret.Name)
+				continue
+			}
+			request = accessTokenSession.Request
+		}
+
+		if request.GetClient().GetID() != clientID || fositestorage.SessionSubject(request) != subject {
+			continue
+		}
+		if _, found := requestsByID[request.GetID()]; !found {
+			requestIDs = append(requestIDs, request.GetID())
+		} else if secret.Labels[crud.SecretLabelKey] != refreshtoken.TypeLabelValue {
+			continue // already have the request from the refresh token storage
+		}
+		requestsByID[request.GetID()] = request
+	}
+	sort.Strings(requestIDs)
+
+	requests := make([]fosite.Requester, 0, len(requestIDs))
+	for _, id := range requestIDs {
+		requests = append(requests, requestsByID[id])
+	}
+	return requests, nil
 }
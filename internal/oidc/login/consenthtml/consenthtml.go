@@ -0,0 +1,84 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package consenthtml defines HTML templates used by the Supervisor.
+package consenthtml
+
+import (
+	_ "embed" // Needed to trigger //go:embed directives below.
+	"html/template"
+	"strings"
+
+	"github.com/tdewolff/minify/v2/minify"
+
+	"go.pinniped.dev/internal/oidc/provider/branding"
+	"go.pinniped.dev/internal/oidc/provider/csp"
+)
+
+//nolint:gochecknoglobals // This package uses globals to ensure that all parsing and minifying happens at init.
+var (
+	//go:embed consent.css
+	rawCSS      string
+	minifiedCSS = panicOnError(minify.CSS(rawCSS))
+
+	//go:embed consent.gohtml
+	rawHTMLTemplate string
+
+	// Parse the Go templated HTML and inject functions providing the minified inline CSS.
+	parsedHTMLTemplate = template.Must(template.New("consent.gohtml").Funcs(template.FuncMap{
+		"minifiedCSS": func() template.CSS { return template.CSS(CSS()) },
+	}).Parse(rawHTMLTemplate))
+
+	// Generate the CSP header value once since it's effectively constant.
+	cspValue = strings.Join([]string{
+		`default-src 'none'`,
+		`style-src '` + csp.Hash(minifiedCSS) + `'`,
+		`frame-ancestors 'none'`,
+	}, "; ")
+)
+
+func panicOnError(s string, err error) string {
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// ContentSecurityPolicy returns the Content-Security-Policy header value to make the Template() operate correctly.
+//
+// See https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Content-Security-Policy.
+func ContentSecurityPolicy() string { return cspValue }
+
+// ContentSecurityPolicyWithBranding returns the Content-Security-Policy header value to make the Template() operate
+// correctly when it renders the given branding, which may be nil. It additionally allows only the CSS of the branding,
+// and the data URL of its logo.
+func ContentSecurityPolicyWithBranding(b *branding.Branding) string {
+	if b == nil {
+		return cspValue
+	}
+	directives := []string{
+		`default-src 'none'`,
+		`style-src '` + csp.Hash(minifiedCSS) + `' ` + b.StyleSrc(),
+	}
+	if b.Logo != "" {
+		directives = append(directives, `img-src data:`)
+	}
+	return strings.Join(append(directives, `frame-ancestors 'none'`), "; ")
+}
+
+// Template returns the html/template.Template for rendering the consent page.
+func Template() *template.Template { return parsedHTMLTemplate }
+
+// CSS returns the minified CSS that will be embedded into the page template.
+func CSS() string { return minifiedCSS }
+
+// PageData represents the inputs to the template.
+type PageData struct {
+	CSRFToken         string
+	RequestID         string
+	ClientName        string
+	Username          string
+	ScopeDescriptions []string
+	PostPath          string
+	Branding          *branding.Branding
+}
@@ -0,0 +1,132 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package consenthtml
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"go.pinniped.dev/internal/here"
+	"go.pinniped.dev/internal/oidc/provider/branding"
+	"go.pinniped.dev/internal/oidc/provider/csp"
+	"go.pinniped.dev/internal/testutil"
+)
+
+var (
+	testExpectedCSS = `html{height:100%}body{font-family:metropolis-light,Helvetica,sans-serif;display:flex;flex-flow:column wrap;justify-content:flex-start;align-items:center;background:var(--background-color,linear-gradient(to top,#f8f8f8,white));min-height:100%}h1{font-size:20px;margin:0}ul{margin:0;padding-left:20px}li{margin-bottom:8px}.box{display:flex;flex-direction:column;flex-wrap:nowrap;border-radius:4px;border-color:#ddd;border-width:1px;border-style:solid;width:400px;padding:30px 30px 0;margin:60px 20px 0;background:#fff;font-size:14px}button{color:inherit;font:inherit;border:0;margin:0;outline:0;padding:0}.form-field{display:flex;align-items:center;gap:10px;margin-bottom:30px}.form-field button{width:100%;padding:1em;background-color:var(--primary-color,#218fcf);color:#eee;font-weight:700;cursor:pointer;transition:all .3s}.form-field button:focus,.form-field button:hover{background-color:var(--primary-color,#1abfd3)}.form-field button:active{transform:scale(.99)}.form-field button.secondary{background-color:#a6a6a6}.form-field button.secondary:focus,.form-field button.secondary:hover{background-color:#8c8c8c}.branding-header{display:flex;flex-direction:column;align-items:center;margin-top:40px}.branding-header+.box{margin-top:30px}.branding-header .logo{max-width:300px;max-height:80px}.branding-header .title{font-size:24px;margin-top:10px}.branding-footer{width:400px;margin:30px 20px;font-size:12px;text-align:center}.branding-footer a{color:var(--primary-color,#218fcf)}.legal-banner{white-space:pre-line}`
+
+	// It's okay if this changes in the future, but this gives us a chance to eyeball the formatting.
+	// Our browser-based integration tests should find any incompatibilities.
+	testExpectedCSP = `default-src 'none'; ` +
+		`style-src 'sha256-ppbt6lGZLouG4uZDeCWehhAp90qcB0Guyy4ZK/94QB0='; ` +
+		`frame-ancestors 'none'`
+)
+
+func TestTemplate(t *testing.T) {
+	tests := []struct {
+		name         string
+		pageInputs   *PageData
+		expectedHTML string
+	}{
+		{
+			name: "form",
+			pageInputs: &PageData{
+				CSRFToken:         "some-csrf-token",
+				RequestID:         "some-request-id",
+				ClientName:        "My App",
+				Username:          "some-user",
+				ScopeDescriptions: []string{"See your username", "See your group memberships"},
+				PostPath:          "/issuer/path/consent",
+			},
+			expectedHTML: testutil.ExpectedConsentPageHTML(testExpectedCSS, "/issuer/path/consent", "some-csrf-token", "some-request-id",
+				"My App", "some-user", []string{"See your username", "See your group memberships"}),
+		},
+		{
+			name: "values are escaped",
+			pageInputs: &PageData{
+				CSRFToken:         "some-csrf-token",
+				RequestID:         "some-request-id",
+				ClientName:        `<script>`,
+				Username:          `"quoted"`,
+				ScopeDescriptions: []string{"Verify your identity"},
+				PostPath:          "/issuer/path/consent",
+			},
+			expectedHTML: testutil.ExpectedConsentPageHTML(testExpectedCSS, "/issuer/path/consent", "some-csrf-token", "some-request-id",
+				"&lt;script&gt;", "&#34;quoted&#34;", []string{"Verify your identity"}),
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, Template().Execute(&buf, tt.pageInputs))
+			// t.Logf("actual value:\n%s", buf.String()) // useful when updating minify library causes new output
+			require.Equal(t, tt.expectedHTML, buf.String())
+		})
+	}
+}
+
+func TestTemplateWithBranding(t *testing.T) {
+	b, err := branding.FromConfigMapData(map[string]string{
+		"title":       "Acme",
+		"legalBanner": "For authorized use only.",
+	}, nil)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, Template().Execute(&buf, &PageData{
+		CSRFToken:         "some-csrf-token",
+		RequestID:         "some-request-id",
+		ClientName:        "My App",
+		Username:          "some-user",
+		ScopeDescriptions: []string{"See your username"},
+		PostPath:          "/issuer/path/consent",
+		Branding:          b,
+	}))
+	page := buf.String()
+
+	require.Contains(t, page, "<title>Acme</title>")
+	require.Contains(t, page, "<style>:root{}</style>")
+	require.Contains(t, page, here.Doc(`
+		<body>
+		<header class="branding-header" role="banner">
+		    <div class="title">Acme</div>
+		</header>
+		<div class="box" aria-label="consent form" role="main">
+	`))
+	require.Contains(t, page, here.Doc(`
+		<footer class="branding-footer" role="contentinfo">
+		    <p class="legal-banner" id="legal-banner">For authorized use only.</p>
+		</footer>
+		</body>
+	`))
+}
+
+func TestContentSecurityPolicy(t *testing.T) {
+	require.Equal(t, testExpectedCSP, ContentSecurityPolicy())
+}
+
+func TestContentSecurityPolicyWithBranding(t *testing.T) {
+	require.Equal(t, testExpectedCSP, ContentSecurityPolicyWithBranding(nil))
+
+	b, err := branding.FromConfigMapData(map[string]string{"primaryColor": "#123456"}, map[string][]byte{"logo": []byte("GIF89a")})
+	require.NoError(t, err)
+	require.Equal(t, `default-src 'none'; `+
+		`style-src '`+csp.Hash(CSS())+`' '`+csp.Hash(":root{--primary-color:#123456}")+`'; `+
+		`img-src data:; `+
+		`frame-ancestors 'none'`,
+		ContentSecurityPolicyWithBranding(b))
+}
+
+func TestCSS(t *testing.T) {
+	require.Equal(t, testExpectedCSS, CSS())
+}
+
+func TestHelpers(t *testing.T) {
+	require.Equal(t, "test", panicOnError("test", nil))
+	require.PanicsWithError(t, "some error", func() { panicOnError("", fmt.Errorf("some error")) })
+}
@@ -1,4 +1,4 @@
-// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2022-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package login
@@ -8,6 +8,7 @@ import (
 
 	"go.pinniped.dev/internal/oidc"
 	"go.pinniped.dev/internal/oidc/login/loginhtml"
+	"go.pinniped.dev/internal/oidc/provider/branding"
 )
 
 const (
@@ -15,7 +16,7 @@ const (
 	incorrectUsernameOrPasswordErrorMessage = "Incorrect username or password."
 )
 
-func NewGetHandler(loginPath string) HandlerFunc {
+func NewGetHandler(loginPath string, getBranding func() *branding.Branding) HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request, encodedState string, decodedState *oidc.UpstreamStateParamData) error {
 		alertMessage, hasAlert := getAlert(r)
 
@@ -25,6 +26,7 @@ func NewGetHandler(loginPath string) HandlerFunc {
 			IDPName:       decodedState.UpstreamName,
 			HasAlertError: hasAlert,
 			AlertMessage:  alertMessage,
+			Branding:      getBranding(),
 		}
 		return loginhtml.Template().Execute(w, pageInputs)
 	}
@@ -1,4 +1,4 @@
-// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2022-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package login
@@ -12,6 +12,7 @@ import (
 
 	"go.pinniped.dev/internal/oidc"
 	"go.pinniped.dev/internal/oidc/login/loginhtml"
+	"go.pinniped.dev/internal/oidc/provider/branding"
 	"go.pinniped.dev/internal/testutil"
 )
 
@@ -24,14 +25,16 @@ func TestGetLogin(t *testing.T) {
 	)
 
 	tests := []struct {
-		name            string
-		decodedState    *oidc.UpstreamStateParamData
-		encodedState    string
-		errParam        string
-		idps            oidc.UpstreamIdentityProvidersLister
-		wantStatus      int
-		wantContentType string
-		wantBody        string
+		name             string
+		decodedState     *oidc.UpstreamStateParamData
+		encodedState     string
+		errParam         string
+		idps             oidc.UpstreamIdentityProvidersLister
+		getBranding      func() *branding.Branding
+		wantStatus       int
+		wantContentType  string
+		wantBody         string
+		wantBodyContains []string
 	}{
 		{
 			name: "Happy path ldap",
@@ -88,6 +91,33 @@ func TestGetLogin(t *testing.T) {
 				"An internal error occurred. Please contact your administrator for help.",
 			),
 		},
+		{
+			name: "branded page",
+			decodedState: &oidc.UpstreamStateParamData{
+				UpstreamName: testUpstreamName,
+				UpstreamType: testUpstreamType,
+			},
+			encodedState: testEncodedState,
+			getBranding: func() *branding.Branding {
+				b, err := branding.FromConfigMapData(map[string]string{
+					"title":        "Acme <Corp>",
+					"primaryColor": "#aa0000",
+					"helpURL":      "https://help.example.com",
+					"legalBanner":  "For authorized use only.",
+				}, nil)
+				require.NoError(t, err)
+				return b
+			},
+			wantStatus:      http.StatusOK,
+			wantContentType: htmlContentType,
+			wantBodyContains: []string{
+				"<title>Acme &lt;Corp&gt;</title>",
+				"<style>:root{--primary-color:#aa0000}</style>",
+				`<a href="https://help.example.com" id="help">Need help logging in?</a>`,
+				`<p class="legal-banner" id="legal-banner">For authorized use only.</p>`,
+				`<input type="hidden" name="state" id="state" value="` + testEncodedState + `">`,
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -96,7 +126,11 @@ func TestGetLogin(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
 
-			handler := NewGetHandler(testPath)
+			getBranding := branding.None
+			if tt.getBranding != nil {
+				getBranding = tt.getBranding
+			}
+			handler := NewGetHandler(testPath, getBranding)
 			target := testPath + "?state=" + tt.encodedState
 			if tt.errParam != "" {
 				target += "&err=" + tt.errParam
@@ -110,7 +144,12 @@ func TestGetLogin(t *testing.T) {
 			testutil.RequireEqualContentType(t, rsp.Header().Get("Content-Type"), tt.wantContentType)
 			body := rsp.Body.String()
 			// t.Log("actual body:", body) // useful when updating expected values
-			require.Equal(t, tt.wantBody, body)
+			if tt.wantBody != "" {
+				require.Equal(t, tt.wantBody, body)
+			}
+			for _, want := range tt.wantBodyContains {
+				require.Contains(t, body, want)
+			}
 		})
 	}
 }
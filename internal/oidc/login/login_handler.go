@@ -1,4 +1,4 @@
-// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2022-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package login
@@ -12,6 +12,7 @@ import (
 	"go.pinniped.dev/internal/httputil/securityheader"
 	"go.pinniped.dev/internal/oidc"
 	"go.pinniped.dev/internal/oidc/login/loginhtml"
+	"go.pinniped.dev/internal/oidc/provider/branding"
 	"go.pinniped.dev/internal/oidc/provider/formposthtml"
 	"go.pinniped.dev/internal/plog"
 )
@@ -52,6 +53,7 @@ func NewHandler(
 	cookieDecoder oidc.Decoder,
 	getHandler HandlerFunc, // use NewGetHandler() for production
 	postHandler HandlerFunc, // use NewPostHandler() for production
+	getBranding func() *branding.Branding,
 ) http.Handler {
 	loginHandler := httperr.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
 		var handler HandlerFunc
@@ -80,15 +82,16 @@ func NewHandler(
 		return handler(w, r, encodedState, decodedState)
 	})
 
-	return wrapSecurityHeaders(loginHandler)
+	return wrapSecurityHeaders(loginHandler, getBranding)
 }
 
-func wrapSecurityHeaders(handler http.Handler) http.Handler {
+func wrapSecurityHeaders(handler http.Handler, getBranding func() *branding.Branding) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		wrapped := securityheader.WrapWithCustomCSP(handler, loginhtml.ContentSecurityPolicy())
+		b := getBranding()
+		wrapped := securityheader.WrapWithCustomCSP(handler, loginhtml.ContentSecurityPolicyWithBranding(b))
 		if r.Method == http.MethodPost {
 			// POST requests can result in the form_post html page, so allow it with CSP headers.
-			wrapped = securityheader.WrapWithCustomCSP(handler, formposthtml.ContentSecurityPolicy())
+			wrapped = securityheader.WrapWithCustomCSP(handler, formposthtml.ContentSecurityPolicyWithBranding(b))
 		}
 		wrapped.ServeHTTP(w, r)
 	})
@@ -1,4 +1,4 @@
-// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2022-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 // Package loginhtml defines HTML templates used by the Supervisor.
@@ -11,6 +11,7 @@ import (
 
 	"github.com/tdewolff/minify/v2/minify"
 
+	"go.pinniped.dev/internal/oidc/provider/branding"
 	"go.pinniped.dev/internal/oidc/provider/csp"
 )
 
@@ -48,6 +49,23 @@ func panicOnError(s string, err error) string {
 // See https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Content-Security-Policy.
 func ContentSecurityPolicy() string { return cspValue }
 
+// ContentSecurityPolicyWithBranding returns the Content-Security-Policy header value to make the Template() operate
+// correctly when it renders the given branding, which may be nil. It additionally allows only the CSS of the branding,
+// and the data URL of its logo.
+func ContentSecurityPolicyWithBranding(b *branding.Branding) string {
+	if b == nil {
+		return cspValue
+	}
+	directives := []string{
+		`default-src 'none'`,
+		`style-src '` + csp.Hash(minifiedCSS) + `' ` + b.StyleSrc(),
+	}
+	if b.Logo != "" {
+		directives = append(directives, `img-src data:`)
+	}
+	return strings.Join(append(directives, `frame-ancestors 'none'`), "; ")
+}
+
 // Template returns the html/template.Template for rendering the login page.
 func Template() *template.Template { return parsedHTMLTemplate }
 
@@ -62,4 +80,5 @@ type PageData struct {
 	AlertMessage  string
 	MinifiedCSS   template.CSS
 	PostPath      string
+	Branding      *branding.Branding
 }
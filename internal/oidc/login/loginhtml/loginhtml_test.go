@@ -1,4 +1,4 @@
-// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2022-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package loginhtml
@@ -8,18 +8,21 @@ import (
 	"fmt"
 	"testing"
 
-	"go.pinniped.dev/internal/testutil"
-
 	"github.com/stretchr/testify/require"
+
+	"go.pinniped.dev/internal/here"
+	"go.pinniped.dev/internal/oidc/provider/branding"
+	"go.pinniped.dev/internal/oidc/provider/csp"
+	"go.pinniped.dev/internal/testutil"
 )
 
 var (
-	testExpectedCSS = `html{height:100%}body{font-family:metropolis-light,Helvetica,sans-serif;display:flex;flex-flow:column wrap;justify-content:flex-start;align-items:center;background:linear-gradient(to top,#f8f8f8,white);min-height:100%}h1{font-size:20px;margin:0}.box{display:flex;flex-direction:column;flex-wrap:nowrap;border-radius:4px;border-color:#ddd;border-width:1px;border-style:solid;width:400px;padding:30px 30px 0;margin:60px 20px 0;background:#fff;font-size:14px}input{color:inherit;font:inherit;border:0;margin:0;outline:0;padding:0}.form-field{display:flex;margin-bottom:30px}.form-field input[type=password],.form-field input[type=text],.form-field input[type=submit]{width:100%;padding:1em}.form-field input[type=password],.form-field input[type=text]{border-radius:3px;border-width:1px;border-style:solid;border-color:#a6a6a6}.form-field input[type=submit]{background-color:#218fcf;color:#eee;font-weight:700;cursor:pointer;transition:all .3s}.form-field input[type=submit]:focus,.form-field input[type=submit]:hover{background-color:#1abfd3}.form-field input[type=submit]:active{transform:scale(.99)}.hidden{border:0;clip:rect(0 0 0 0);height:1px;margin:-1px;overflow:hidden;padding:0;position:absolute;width:1px}.alert{color:crimson}`
+	testExpectedCSS = `html{height:100%}body{font-family:metropolis-light,Helvetica,sans-serif;display:flex;flex-flow:column wrap;justify-content:flex-start;align-items:center;background:var(--background-color,linear-gradient(to top,#f8f8f8,white));min-height:100%}h1{font-size:20px;margin:0}.box{display:flex;flex-direction:column;flex-wrap:nowrap;border-radius:4px;border-color:#ddd;border-width:1px;border-style:solid;width:400px;padding:30px 30px 0;margin:60px 20px 0;background:#fff;font-size:14px}input{color:inherit;font:inherit;border:0;margin:0;outline:0;padding:0}.form-field{display:flex;margin-bottom:30px}.form-field input[type=password],.form-field input[type=text],.form-field input[type=submit]{width:100%;padding:1em}.form-field input[type=password],.form-field input[type=text]{border-radius:3px;border-width:1px;border-style:solid;border-color:#a6a6a6}.form-field input[type=submit]{background-color:var(--primary-color,#218fcf);color:#eee;font-weight:700;cursor:pointer;transition:all .3s}.form-field input[type=submit]:focus,.form-field input[type=submit]:hover{background-color:var(--primary-color,#1abfd3)}.form-field input[type=submit]:active{transform:scale(.99)}.hidden{border:0;clip:rect(0 0 0 0);height:1px;margin:-1px;overflow:hidden;padding:0;position:absolute;width:1px}.alert{color:crimson}.branding-header{display:flex;flex-direction:column;align-items:center;margin-top:40px}.branding-header+.box{margin-top:30px}.branding-header .logo{max-width:300px;max-height:80px}.branding-header .title{font-size:24px;margin-top:10px}.branding-footer{width:400px;margin:30px 20px;font-size:12px;text-align:center}.branding-footer a{color:var(--primary-color,#218fcf)}.legal-banner{white-space:pre-line}`
 
 	// It's okay if this changes in the future, but this gives us a chance to eyeball the formatting.
 	// Our browser-based integration tests should find any incompatibilities.
 	testExpectedCSP = `default-src 'none'; ` +
-		`style-src 'sha256-QC9ckaUFAdcN0Ysmu8q8iqCazYFgrJSQDJPa/przPXU='; ` +
+		`style-src 'sha256-SVlTa0gfhvRRlr54Wlti/y/9xpm3bAztsA5X5D0VlDg='; ` +
 		`frame-ancestors 'none'`
 )
 
@@ -54,10 +57,67 @@ func TestTemplate(t *testing.T) {
 	require.Equal(t, expectedHTMLWithoutAlert, buf.String())
 }
 
+func TestTemplateWithBranding(t *testing.T) {
+	b, err := branding.FromConfigMapData(map[string]string{
+		"title":        "Acme <Login>",
+		"primaryColor": "#AA0000",
+		"helpURL":      "https://help.example.com/login?a=1&b=2",
+		"legalBanner":  "For authorized use only.\nAll activity is monitored.",
+	}, map[string][]byte{"logo": []byte("\x89PNG\r\n\x1a\nsome-png")})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, Template().Execute(&buf, &PageData{
+		PostPath: "test-post-path",
+		State:    "test-encoded-state",
+		IDPName:  "test-idp-name",
+		Branding: b,
+	}))
+	page := buf.String()
+
+	require.Contains(t, page, "<title>Acme &lt;Login&gt;</title>")
+	require.Contains(t, page, "<style>:root{--primary-color:#aa0000}</style>")
+	require.Contains(t, page, here.Doc(`
+		<body>
+		<header class="branding-header" role="banner">
+		    <img class="logo" src="data:image/png;base64,iVBORw0KGgpzb21lLXBuZw==" alt="logo">
+		    <div class="title">Acme &lt;Login&gt;</div>
+		</header>
+		<div class="box" aria-label="login form" role="main">
+	`))
+	require.Contains(t, page, here.Doc(`
+		<footer class="branding-footer" role="contentinfo">
+		    <a href="https://help.example.com/login?a=1&amp;b=2" id="help">Need help logging in?</a>
+		    <p class="legal-banner" id="legal-banner">For authorized use only.
+		All activity is monitored.</p>
+		</footer>
+		</body>
+	`))
+}
+
 func TestContentSecurityPolicy(t *testing.T) {
 	require.Equal(t, testExpectedCSP, ContentSecurityPolicy())
 }
 
+func TestContentSecurityPolicyWithBranding(t *testing.T) {
+	require.Equal(t, testExpectedCSP, ContentSecurityPolicyWithBranding(nil))
+
+	withoutLogo, err := branding.FromConfigMapData(map[string]string{"backgroundColor": "#eeeeee"}, nil)
+	require.NoError(t, err)
+	require.Equal(t, `default-src 'none'; `+
+		`style-src '`+csp.Hash(CSS())+`' '`+csp.Hash(":root{--background-color:#eeeeee}")+`'; `+
+		`frame-ancestors 'none'`,
+		ContentSecurityPolicyWithBranding(withoutLogo))
+
+	withLogo, err := branding.FromConfigMapData(nil, map[string][]byte{"logo": []byte("GIF89a")})
+	require.NoError(t, err)
+	require.Equal(t, `default-src 'none'; `+
+		`style-src '`+csp.Hash(CSS())+`' '`+csp.Hash(":root{}")+`'; `+
+		`img-src data:; `+
+		`frame-ancestors 'none'`,
+		ContentSecurityPolicyWithBranding(withLogo))
+}
+
 func TestCSS(t *testing.T) {
 	require.Equal(t, testExpectedCSS, CSS())
 }
@@ -1,4 +1,4 @@
-// Copyright 2022-2023 the Pinniped contributors. All Rights Reserved.
+// Copyright 2022-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package login
@@ -11,16 +11,27 @@ import (
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"golang.org/x/crypto/bcrypt"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apiserver/pkg/authentication/user"
 	"k8s.io/client-go/kubernetes/fake"
 
 	configv1alpha1 "go.pinniped.dev/generated/latest/apis/supervisor/config/v1alpha1"
 	supervisorfake "go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned/fake"
+	"go.pinniped.dev/internal/auditlog"
 	"go.pinniped.dev/internal/authenticators"
+	"go.pinniped.dev/internal/celtransformer"
+	"go.pinniped.dev/internal/crud"
+	"go.pinniped.dev/internal/fositestorage"
+	"go.pinniped.dev/internal/fositestorage/authorizationcode"
+	consentstorage "go.pinniped.dev/internal/fositestorage/consent"
+	"go.pinniped.dev/internal/fositestorage/consentrequest"
 	"go.pinniped.dev/internal/oidc"
+	"go.pinniped.dev/internal/oidc/consent"
 	"go.pinniped.dev/internal/oidc/jwks"
 	"go.pinniped.dev/internal/oidc/oidcclientvalidator"
 	"go.pinniped.dev/internal/psession"
@@ -63,6 +74,12 @@ func TestPostLoginEndpoint(t *testing.T) {
 	)
 
 	var (
+		fositeConfiguredPolicyRejectedAuthErrorQuery = map[string]string{
+			"error":             "access_denied",
+			"error_description": "The resource owner or authorization server denied the request. Reason: configured identity policy rejected this authentication: only admins may log in.",
+			"state":             happyDownstreamState,
+		}
+
 		fositeMissingCodeChallengeErrorQuery = map[string]string{
 			"error":             "invalid_request",
 			"error_description": "The request is missing a required parameter, includes an invalid parameter value, includes a parameter more than once, or is otherwise malformed. Clients must include a code_challenge when performing the authorize code flow, but it is missing.",
@@ -194,12 +211,14 @@ func TestPostLoginEndpoint(t *testing.T) {
 	}
 
 	expectedHappyActiveDirectoryUpstreamCustomSession := &psession.CustomSessionData{
-		Username:     happyLDAPUsernameFromAuthenticator,
-		ProviderUID:  activeDirectoryUpstreamResourceUID,
-		ProviderName: activeDirectoryUpstreamName,
-		ProviderType: psession.ProviderTypeActiveDirectory,
-		OIDC:         nil,
-		LDAP:         nil,
+		Username:         happyLDAPUsernameFromAuthenticator,
+		UpstreamUsername: happyLDAPUsernameFromAuthenticator,
+		UpstreamGroups:   happyLDAPGroups,
+		ProviderUID:      activeDirectoryUpstreamResourceUID,
+		ProviderName:     activeDirectoryUpstreamName,
+		ProviderType:     psession.ProviderTypeActiveDirectory,
+		OIDC:             nil,
+		LDAP:             nil,
 		ActiveDirectory: &psession.ActiveDirectorySessionData{
 			UserDN:                 happyLDAPUserDN,
 			ExtraRefreshAttributes: map[string]string{happyLDAPExtraRefreshAttribute: happyLDAPExtraRefreshValue},
@@ -207,11 +226,13 @@ func TestPostLoginEndpoint(t *testing.T) {
 	}
 
 	expectedHappyLDAPUpstreamCustomSession := &psession.CustomSessionData{
-		Username:     happyLDAPUsernameFromAuthenticator,
-		ProviderUID:  ldapUpstreamResourceUID,
-		ProviderName: ldapUpstreamName,
-		ProviderType: psession.ProviderTypeLDAP,
-		OIDC:         nil,
+		Username:         happyLDAPUsernameFromAuthenticator,
+		UpstreamUsername: happyLDAPUsernameFromAuthenticator,
+		UpstreamGroups:   happyLDAPGroups,
+		ProviderUID:      ldapUpstreamResourceUID,
+		ProviderName:     ldapUpstreamName,
+		ProviderType:     psession.ProviderTypeLDAP,
+		OIDC:             nil,
 		LDAP: &psession.LDAPSessionData{
 			UserDN:                 happyLDAPUserDN,
 			ExtraRefreshAttributes: map[string]string{happyLDAPExtraRefreshAttribute: happyLDAPExtraRefreshValue},
@@ -219,6 +240,31 @@ func TestPostLoginEndpoint(t *testing.T) {
 		ActiveDirectory: nil,
 	}
 
+	expectedHappyLDAPUpstreamCustomSessionWithUsername := func(wantDownstreamUsername string) *psession.CustomSessionData {
+		copyOfCustomSession := *expectedHappyLDAPUpstreamCustomSession
+		copyOfLDAP := *(expectedHappyLDAPUpstreamCustomSession.LDAP)
+		copyOfCustomSession.LDAP = &copyOfLDAP
+		copyOfCustomSession.Username = wantDownstreamUsername
+		return &copyOfCustomSession
+	}
+
+	const (
+		transformationUsernamePrefix = "username_prefix:"
+		transformationGroupsPrefix   = "groups_prefix:"
+	)
+
+	prefixUsernameAndGroupsPipeline := oidctestutil.NewTransformationPipeline(t, nil,
+		&celtransformer.UsernameTransformation{Expression: fmt.Sprintf(`"%s" + username`, transformationUsernamePrefix)},
+		&celtransformer.GroupsTransformation{Expression: fmt.Sprintf(`groups.map(g, "%s" + g)`, transformationGroupsPrefix)},
+	)
+
+	rejectAuthPipeline := oidctestutil.NewTransformationPipeline(t, nil,
+		&celtransformer.AllowAuthenticationPolicy{
+			Expression:                    `"admins" in groups`,
+			RejectedAuthenticationMessage: "only admins may log in",
+		},
+	)
+
 	// Note that fosite puts the granted scopes as a param in the redirect URI even though the spec doesn't seem to require it
 	happyAuthcodeDownstreamRedirectLocationRegexp := downstreamRedirectURI + `\?code=([^&]+)&scope=openid\+username\+groups&state=` + happyDownstreamState
 
@@ -263,6 +309,9 @@ func TestPostLoginEndpoint(t *testing.T) {
 		// Assertion that the response should be a redirect to the login page with an error param.
 		wantRedirectToLoginPageError string
 
+		// Assertion that the response should be a redirect to the consent page, for clients which require consent.
+		wantRedirectToConsentPage bool
+
 		// Assertions for when an authcode should be returned, i.e. the request was authenticated by an
 		// upstream LDAP or AD provider.
 		wantRedirectLocationRegexp        string // for loose matching
@@ -310,6 +359,41 @@ func TestPostLoginEndpoint(t *testing.T) {
 			wantDownstreamPKCEChallengeMethod: downstreamPKCEChallengeMethod,
 			wantDownstreamCustomSessionData:   expectedHappyLDAPUpstreamCustomSession,
 		},
+		{
+			name: "happy LDAP login with identity transformations",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().
+				WithLDAP(&upstreamLDAPIdentityProvider).
+				WithIdentityTransformations(ldapUpstreamName, psession.ProviderTypeLDAP, prefixUsernameAndGroupsPipeline),
+			decodedState:                      happyLDAPDecodedState,
+			formParams:                        happyUsernamePasswordFormParams,
+			wantStatus:                        http.StatusSeeOther,
+			wantContentType:                   htmlContentType,
+			wantBodyString:                    "",
+			wantRedirectLocationRegexp:        happyAuthcodeDownstreamRedirectLocationRegexp,
+			wantDownstreamIDTokenSubject:      upstreamLDAPURL + "&sub=" + happyLDAPUID,
+			wantDownstreamIDTokenUsername:     transformationUsernamePrefix + happyLDAPUsernameFromAuthenticator,
+			wantDownstreamIDTokenGroups:       testutil.AddPrefixToEach(transformationGroupsPrefix, happyLDAPGroups),
+			wantDownstreamRequestedScopes:     happyDownstreamScopesRequested,
+			wantDownstreamRedirectURI:         downstreamRedirectURI,
+			wantDownstreamGrantedScopes:       happyDownstreamScopesGranted,
+			wantDownstreamNonce:               downstreamNonce,
+			wantDownstreamClient:              downstreamPinnipedCLIClientID,
+			wantDownstreamPKCEChallenge:       downstreamPKCEChallenge,
+			wantDownstreamPKCEChallengeMethod: downstreamPKCEChallengeMethod,
+			wantDownstreamCustomSessionData:   expectedHappyLDAPUpstreamCustomSessionWithUsername(transformationUsernamePrefix + happyLDAPUsernameFromAuthenticator),
+		},
+		{
+			name: "LDAP login when an identity policy rejects the authentication",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().
+				WithLDAP(&upstreamLDAPIdentityProvider).
+				WithIdentityTransformations(ldapUpstreamName, psession.ProviderTypeLDAP, rejectAuthPipeline),
+			decodedState:               happyLDAPDecodedState,
+			formParams:                 happyUsernamePasswordFormParams,
+			wantStatus:                 http.StatusSeeOther,
+			wantContentType:            htmlContentType,
+			wantBodyString:             "",
+			wantRedirectLocationString: urlWithQuery(downstreamRedirectURI, fositeConfiguredPolicyRejectedAuthErrorQuery),
+		},
 		{
 			name: "happy LDAP login with dynamic client",
 			idps: oidctestutil.NewUpstreamIDPListerBuilder().
@@ -334,6 +418,26 @@ func TestPostLoginEndpoint(t *testing.T) {
 			wantDownstreamPKCEChallengeMethod: downstreamPKCEChallengeMethod,
 			wantDownstreamCustomSessionData:   expectedHappyLDAPUpstreamCustomSession,
 		},
+		{
+			name: "happy LDAP login with dynamic client which requires consent redirects to the consent page",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().
+				WithLDAP(&upstreamLDAPIdentityProvider). // should pick this one
+				WithActiveDirectory(&erroringUpstreamLDAPIdentityProvider),
+			kubeResources: func(t *testing.T, supervisorClient *supervisorfake.Clientset, kubeClient *fake.Clientset) {
+				oidcClient, secret := testutil.FullyCapableOIDCClientAndStorageSecret(t,
+					"some-namespace", downstreamDynamicClientID, downstreamDynamicClientUID, downstreamRedirectURI,
+					[]string{testutil.HashedPassword1AtGoMinCost}, oidcclientvalidator.Validate)
+				oidcClient.Spec.Consent = &configv1alpha1.OIDCClientConsent{}
+				require.NoError(t, supervisorClient.Tracker().Add(oidcClient))
+				require.NoError(t, kubeClient.Tracker().Add(secret))
+			},
+			decodedState:                  happyLDAPDecodedStateForDynamicClient,
+			formParams:                    happyUsernamePasswordFormParams,
+			wantStatus:                    http.StatusSeeOther,
+			wantContentType:               htmlContentType,
+			wantRedirectToConsentPage:     true,
+			wantDownstreamIDTokenUsername: happyLDAPUsernameFromAuthenticator,
+		},
 		{
 			name: "happy AD login",
 			idps: oidctestutil.NewUpstreamIDPListerBuilder().
@@ -974,11 +1078,11 @@ func TestPostLoginEndpoint(t *testing.T) {
 			// Inject this into our test subject at the last second so we get a fresh storage for every test.
 			timeoutsConfiguration := oidc.DefaultOIDCTimeoutsConfiguration()
 			// Use lower minimum required bcrypt cost than we would use in production to keep unit the tests fast.
-			kubeOauthStore := oidc.NewKubeStorage(secretsClient, oidcClientsClient, timeoutsConfiguration, bcrypt.MinCost)
+			kubeOauthStore := oidc.NewKubeStorage(secretsClient, oidcClientsClient, downstreamIssuer, timeoutsConfiguration, bcrypt.MinCost)
 			hmacSecretFunc := func() []byte { return []byte("some secret - must have at least 32 bytes") }
 			require.GreaterOrEqual(t, len(hmacSecretFunc()), 32, "fosite requires that hmac secrets have at least 32 bytes")
 			jwksProviderIsUnused := jwks.NewDynamicJWKSProvider()
-			oauthHelper := oidc.FositeOauth2Helper(kubeOauthStore, downstreamIssuer, hmacSecretFunc, jwksProviderIsUnused, timeoutsConfiguration)
+			oauthHelper := oidc.FositeOauth2Helper(kubeOauthStore, downstreamIssuer, hmacSecretFunc, nil, jwksProviderIsUnused, timeoutsConfiguration, nil)
 
 			req := httptest.NewRequest(http.MethodPost, "/ignored", strings.NewReader(tt.formParams.Encode()))
 			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
@@ -988,9 +1092,35 @@ func TestPostLoginEndpoint(t *testing.T) {
 
 			rsp := httptest.NewRecorder()
 
-			subject := NewPostHandler(downstreamIssuer, tt.idps.Build(), oauthHelper)
+			consentResponder := consent.NewResponder(downstreamIssuer,
+				consentstorage.New(secretsClient, time.Now, time.Hour),
+				consentrequest.New(secretsClient, time.Now, time.Hour),
+				time.Hour)
+
+			auditLogger := auditlog.NewTestLogger(t)
+			subject := NewPostHandler(downstreamIssuer, tt.idps.Build(), oauthHelper, consentResponder, auditLogger)
 
 			err := subject(rsp, req, happyEncodedUpstreamState, tt.decodedState)
+
+			// Every request which reached an upstream IDP should be audited exactly once, as either a success or a failure.
+			auditEvents := auditLogger.Events()
+			require.LessOrEqual(t, len(auditEvents), 1)
+			for _, event := range auditEvents {
+				require.NotEmpty(t, event.CorrelationID)
+				require.NotNil(t, event.UpstreamIDP)
+				if event.Type == auditlog.UpstreamLoginSucceeded {
+					require.NotEmpty(t, event.User.Username)
+				} else {
+					require.Equal(t, auditlog.UpstreamLoginFailed, event.Type)
+					require.NotEmpty(t, event.Message)
+				}
+			}
+			if tt.wantDownstreamIDTokenUsername != "" {
+				require.Len(t, auditEvents, 1)
+				require.Equal(t, auditlog.UpstreamLoginSucceeded, auditEvents[0].Type)
+				require.Equal(t, tt.wantDownstreamIDTokenUsername, auditEvents[0].User.Username)
+			}
+
 			if tt.wantErr != "" {
 				require.EqualError(t, err, tt.wantErr)
 				require.Empty(t, oidctestutil.FilterClientSecretCreateActions(kubeClient.Actions()))
@@ -1036,6 +1166,11 @@ func TestPostLoginEndpoint(t *testing.T) {
 					"?err=" + tt.wantRedirectToLoginPageError + "&state=" + happyEncodedUpstreamState
 				require.Equal(t, expectedLocation, actualLocation)
 				require.Len(t, oidctestutil.FilterClientSecretCreateActions(kubeClient.Actions()), tt.wantUnnecessaryStoredRecords)
+			case tt.wantRedirectToConsentPage:
+				// Expecting a redirect to the consent page, where the login waits for the user's answer.
+				require.Regexp(t, `^`+downstreamIssuer+`/consent\?request=[A-Za-z0-9_-]+$`, actualLocation)
+				testutil.RequireNumberOfSecretsMatchingLabelSelector(t, secretsClient, labels.Set{crud.SecretLabelKey: consentrequest.TypeLabelValue}, 1)
+				testutil.RequireNumberOfSecretsMatchingLabelSelector(t, secretsClient, labels.Set{crud.SecretLabelKey: authorizationcode.TypeLabelValue}, 0)
 			case tt.wantRedirectLocationString != "":
 				// Expecting an error redirect to the client.
 				require.Equal(t, tt.wantBodyString, rsp.Body.String())
@@ -1073,6 +1208,93 @@ func TestPostLoginEndpoint(t *testing.T) {
 	}
 }
 
+func TestPostLoginEndpointWithReusedUpstreamState(t *testing.T) {
+	const (
+		downstreamIssuer = "https://my-downstream-issuer.com/path"
+		correlationID    = "some-correlation-id"
+	)
+
+	kubeClient := fake.NewSimpleClientset()
+	supervisorClient := supervisorfake.NewSimpleClientset()
+	secretsClient := kubeClient.CoreV1().Secrets("some-namespace")
+	oidcClientsClient := supervisorClient.ConfigV1alpha1().OIDCClients("some-namespace")
+
+	timeoutsConfiguration := oidc.DefaultOIDCTimeoutsConfiguration()
+	kubeOauthStore := oidc.NewKubeStorage(secretsClient, oidcClientsClient, downstreamIssuer, timeoutsConfiguration, bcrypt.MinCost)
+	hmacSecretFunc := func() []byte { return []byte("some secret - must have at least 32 bytes") }
+	oauthHelper := oidc.FositeOauth2Helper(kubeOauthStore, downstreamIssuer, hmacSecretFunc, nil, jwks.NewDynamicJWKSProvider(), timeoutsConfiguration, nil)
+
+	consentResponder := consent.NewResponder(downstreamIssuer,
+		consentstorage.New(secretsClient, time.Now, time.Hour),
+		consentrequest.New(secretsClient, time.Now, time.Hour),
+		time.Hour)
+
+	idps := oidctestutil.NewUpstreamIDPListerBuilder().WithLDAP(&oidctestutil.TestUpstreamLDAPIdentityProvider{
+		Name:        "some-ldap-idp",
+		ResourceUID: "ldap-resource-uid",
+		URL:         &url.URL{Scheme: "ldaps", Host: "some-ldap-host:123"},
+		AuthenticateFunc: func(ctx context.Context, username, password string) (*authenticators.Response, bool, error) {
+			return &authenticators.Response{User: &user.DefaultInfo{Name: username}, DN: "cn=foo,dn=bar"}, true, nil
+		},
+	})
+
+	decodedState := &oidc.UpstreamStateParamData{
+		AuthParams: url.Values{
+			"response_type":         []string{"code"},
+			"scope":                 []string{"openid username groups"},
+			"client_id":             []string{"pinniped-cli"},
+			"state":                 []string{"8b-state"},
+			"nonce":                 []string{"some-nonce-value"},
+			"code_challenge":        []string{"some-challenge"},
+			"code_challenge_method": []string{"S256"},
+			"redirect_uri":          []string{"http://127.0.0.1/callback"},
+		}.Encode(),
+		UpstreamName:  "some-ldap-idp",
+		UpstreamType:  "ldap",
+		Nonce:         "test-nonce",
+		CSRFToken:     "test-csrf",
+		PKCECode:      "test-pkce",
+		FormatVersion: "2",
+		CorrelationID: correlationID,
+	}
+
+	auditLogger := auditlog.NewTestLogger(t)
+	subject := NewPostHandler(downstreamIssuer, idps.Build(), oauthHelper, consentResponder, auditLogger)
+
+	// The login form may be posted more than once using the same upstream state param.
+	for i := 0; i < 2; i++ {
+		formParams := url.Values{"username": []string{"some-ldap-user"}, "password": []string{"some-ldap-password"}}
+		req := httptest.NewRequest(http.MethodPost, "/ignored", strings.NewReader(formParams.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rsp := httptest.NewRecorder()
+		require.NoError(t, subject(rsp, req, "fake-encoded-state-param-value", decodedState))
+		require.Equal(t, http.StatusSeeOther, rsp.Code)
+	}
+
+	// Each login creates its own session with its own request ID, which fosite requires to be unique.
+	authcodeSecrets, err := secretsClient.List(context.Background(), metav1.ListOptions{
+		LabelSelector: labels.Set{crud.SecretLabelKey: authorizationcode.TypeLabelValue}.String(),
+	})
+	require.NoError(t, err)
+	require.Len(t, authcodeSecrets.Items, 2)
+	requestIDs := map[string]bool{}
+	for _, secret := range authcodeSecrets.Items {
+		requestID := secret.Labels[fositestorage.StorageRequestIDLabelName]
+		require.NotEmpty(t, requestID)
+		require.NotEqual(t, correlationID, requestID)
+		requestIDs[requestID] = true
+	}
+	require.Len(t, requestIDs, 2)
+
+	// Both logins are audited using the correlation ID from the state param.
+	auditEvents := auditLogger.Events()
+	require.Len(t, auditEvents, 2)
+	for _, event := range auditEvents {
+		require.Equal(t, auditlog.UpstreamLoginSucceeded, event.Type)
+		require.Equal(t, correlationID, event.CorrelationID)
+	}
+}
+
 func shallowCopyAndModifyQuery(query url.Values, modifications map[string]string) url.Values {
 	copied := url.Values{}
 	for key, value := range query {
@@ -0,0 +1,360 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package logout provides a handler for the OIDC end_session_endpoint, which is used for RP-initiated logout.
+package logout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ory/fosite"
+	josejwt "gopkg.in/square/go-jose.v2/jwt"
+
+	"go.pinniped.dev/internal/auditlog"
+	"go.pinniped.dev/internal/httputil/httperr"
+	"go.pinniped.dev/internal/oidc"
+	"go.pinniped.dev/internal/oidc/clientregistry"
+	"go.pinniped.dev/internal/oidc/jwks"
+	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/plog"
+	"go.pinniped.dev/internal/psession"
+)
+
+// SessionStorage is the part of the Supervisor's session storage which is needed to end the sessions of a user.
+type SessionStorage interface {
+	GetClient(ctx context.Context, id string) (fosite.Client, error)
+	ListSessionsOfSubject(ctx context.Context, clientID string, subject string) ([]fosite.Requester, error)
+	RevokeAccessToken(ctx context.Context, requestID string) error
+	RevokeRefreshToken(ctx context.Context, requestID string) error
+}
+
+// logoutStateEncodingName is the `name` passed to the encoder for encoding the state param which is sent to the
+// end_session_endpoint of an upstream OIDC provider.
+const logoutStateEncodingName = "l"
+
+// logoutState is the state param which is sent to the end_session_endpoint of an upstream OIDC provider, from which it
+// comes back to the logout callback. It holds what is needed to finish the downstream logout.
+type logoutState struct {
+	PostLogoutRedirectURI string `json:"r,omitempty"`
+	State                 string `json:"s,omitempty"`
+}
+
+// idTokenHintClaims are the claims of a downstream ID token which are used to find the sessions to end.
+type idTokenHintClaims struct {
+	josejwt.Claims
+	AuthorizedParty string `json:"azp"`
+	AuthTime        int64  `json:"auth_time"`
+}
+
+// NewHandler returns an http.Handler which serves the end_session_endpoint of OIDC RP-Initiated Logout, as
+// described in https://openid.net/specs/openid-connect-rpinitiated-1_0.html. The id_token_hint param is required,
+// and it must be an ID token which was issued by this FederationDomain no longer than maxIDTokenHintAge ago. The
+// downstream sessions of the user of that ID token with the client of that ID token in this FederationDomain are
+// ended by revoking their downstream and upstream tokens. Then the user's browser is redirected to the upstream OIDC
+// provider's end_session_endpoint, when the upstream session should also be ended, or else directly to the client's
+// post_logout_redirect_uri. The upstream provider sends the browser back to the handler returned by NewCallbackHandler,
+// which finishes the logout.
+func NewHandler(
+	issuerURL string,
+	jwksProvider jwks.DynamicJWKSProvider,
+	stateEncoder oidc.Encoder,
+	sessionStorage SessionStorage,
+	maxIDTokenHintAge time.Duration,
+	idpLister oidc.FederationDomainIdentityProvidersListerI,
+	auditLogger auditlog.Logger,
+) http.Handler {
+	return httperr.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			return httperr.Newf(http.StatusMethodNotAllowed, "%s (try GET or POST)", r.Method)
+		}
+		if err := r.ParseForm(); err != nil {
+			return httperr.Wrap(http.StatusBadRequest, "error parsing request params", err)
+		}
+		ctx := r.Context()
+
+		rawIDTokenHint := r.Form.Get("id_token_hint")
+		if rawIDTokenHint == "" {
+			return httperr.New(http.StatusBadRequest, "id_token_hint param is required")
+		}
+		claims, err := verifyIDTokenHint(issuerURL, jwksProvider, rawIDTokenHint, maxIDTokenHintAge)
+		if err != nil {
+			plog.Info("end session request error", "reason", "invalid id_token_hint", "err", err)
+			return httperr.New(http.StatusBadRequest, "id_token_hint param is invalid")
+		}
+
+		clientID := claims.clientID()
+		if !claims.Audience.Contains(clientID) {
+			// For example, ID tokens from a token exchange are for a cluster, not for the client.
+			plog.Info("end session request error", "reason", "id_token_hint was not issued to its authorized party", "clientID", clientID)
+			return httperr.New(http.StatusBadRequest, "id_token_hint param is invalid")
+		}
+		if requestedClientID := r.Form.Get("client_id"); requestedClientID != "" && requestedClientID != clientID {
+			return httperr.New(http.StatusBadRequest, "client_id param does not match the client of the id_token_hint")
+		}
+
+		client, err := sessionStorage.GetClient(ctx, clientID)
+		if err != nil {
+			plog.Info("end session request error", "reason", "client lookup failed", "clientID", clientID, "err", err)
+			return httperr.New(http.StatusBadRequest, "client of the id_token_hint is invalid")
+		}
+
+		var postLogoutRedirectURL *url.URL
+		if rawPostLogoutRedirectURI := r.Form.Get("post_logout_redirect_uri"); rawPostLogoutRedirectURI != "" {
+			postLogoutRedirectURL, err = matchPostLogoutRedirectURI(rawPostLogoutRedirectURI, client)
+			if err != nil {
+				plog.Info("end session request error", "reason", "invalid post_logout_redirect_uri", "clientID", clientID, "err", err)
+				return httperr.New(http.StatusBadRequest, "post_logout_redirect_uri param is not allowed for this client")
+			}
+		}
+
+		endedSessions, err := endSessions(ctx, sessionStorage, clientID, claims)
+		if err != nil {
+			plog.WarningErr("end session request failed to end sessions", err, "clientID", clientID)
+			return httperr.New(http.StatusInternalServerError, "failed to end sessions")
+		}
+
+		var upstreamToLogOut provider.UpstreamOIDCIdentityProviderI
+		for _, endedSession := range endedSessions {
+			auditLogger.Audit(auditEvent(r, endedSession))
+
+			session, ok := endedSession.GetSession().(*psession.PinnipedSession)
+			if !ok || session.Custom == nil {
+				continue
+			}
+			// The downstream tokens are already revoked, so failing to revoke the upstream tokens should not fail
+			// the request. The upstream tokens will expire on their own.
+			if err := oidc.RevokeUpstreamOIDCTokens(ctx, session.Custom, idpLister); err != nil {
+				plog.WarningErr("could not revoke upstream tokens after ending session", err, "sessionID", endedSession.GetID())
+			}
+			if upstreamToLogOut == nil {
+				upstreamToLogOut = upstreamToEndSessionOf(session.Custom, idpLister)
+			}
+		}
+
+		state := r.Form.Get("state")
+		if upstreamToLogOut == nil {
+			writeLoggedOutResponse(w, r, postLogoutRedirectURL, state)
+			return nil
+		}
+
+		// The upstream provider does not know the client's post_logout_redirect_uri, so it is asked to send the
+		// user's browser back to the Supervisor, which then finishes the logout. The Supervisor does not hold the
+		// upstream ID token which would usually be sent as the id_token_hint, so tell the upstream provider which
+		// of its clients is asking.
+		encodedState := logoutState{State: state}
+		if postLogoutRedirectURL != nil {
+			encodedState.PostLogoutRedirectURI = postLogoutRedirectURL.String()
+		}
+		upstreamState, err := stateEncoder.Encode(logoutStateEncodingName, &encodedState)
+		if err != nil {
+			plog.Error("error encoding upstream logout state", err)
+			return httperr.New(http.StatusInternalServerError, "error encoding upstream logout state")
+		}
+		http.Redirect(w, r, withQueryParams(upstreamToLogOut.GetEndSessionURL(), url.Values{
+			"client_id":                []string{upstreamToLogOut.GetClientID()},
+			"post_logout_redirect_uri": []string{issuerURL + oidc.EndSessionCallbackPath},
+			"state":                    []string{upstreamState},
+		}), http.StatusSeeOther)
+		return nil
+	})
+}
+
+// NewCallbackHandler returns an http.Handler which serves the Supervisor's logout callback, to which an upstream OIDC
+// provider sends the user's browser after ending its own session. It finishes the logout which was started by the
+// handler returned by NewHandler, using the state param which that handler encoded.
+func NewCallbackHandler(stateDecoder oidc.Decoder) http.Handler {
+	return httperr.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		if r.Method != http.MethodGet {
+			return httperr.Newf(http.StatusMethodNotAllowed, "%s (try GET)", r.Method)
+		}
+
+		rawState := r.URL.Query().Get("state")
+		if rawState == "" {
+			return httperr.New(http.StatusBadRequest, "state param not found")
+		}
+		var state logoutState
+		if err := stateDecoder.Decode(logoutStateEncodingName, rawState, &state); err != nil {
+			plog.InfoErr("error reading state from upstream logout", err)
+			return httperr.New(http.StatusBadRequest, "error reading state")
+		}
+
+		var postLogoutRedirectURL *url.URL
+		if state.PostLogoutRedirectURI != "" {
+			// The end session endpoint already checked that the URI is allowed for the client.
+			var err error
+			if postLogoutRedirectURL, err = url.Parse(state.PostLogoutRedirectURI); err != nil {
+				return httperr.New(http.StatusBadRequest, "error reading state")
+			}
+		}
+		writeLoggedOutResponse(w, r, postLogoutRedirectURL, state.State)
+		return nil
+	})
+}
+
+// writeLoggedOutResponse redirects the user's browser back to the client when it asked for that, or else tells the
+// user that they have been logged out.
+func writeLoggedOutResponse(w http.ResponseWriter, r *http.Request, postLogoutRedirectURL *url.URL, state string) {
+	if postLogoutRedirectURL != nil {
+		params := url.Values{}
+		if state != "" {
+			params.Set("state", state)
+		}
+		http.Redirect(w, r, withQueryParams(postLogoutRedirectURL, params), http.StatusSeeOther)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = fmt.Fprintln(w, "You have been logged out.")
+}
+
+// verifyIDTokenHint checks that the ID token was signed by one of the keys of the FederationDomain. The expiration
+// of the ID token is not checked, because an ID token which has expired is still good enough to identify the
+// session, and browser clients often hold an expired ID token by the time that the user logs out. However, ID tokens
+// which were issued longer than maxAge ago are rejected, so that an old ID token cannot be used to end sessions forever.
+func verifyIDTokenHint(issuerURL string, jwksProvider jwks.DynamicJWKSProvider, rawIDToken string, maxAge time.Duration) (*idTokenHintClaims, error) {
+	token, err := josejwt.ParseSigned(rawIDToken)
+	if err != nil {
+		return nil, err
+	}
+
+	keySet, _ := jwksProvider.GetJWKS(issuerURL)
+	if keySet == nil {
+		return nil, errors.New("no JWKS found for issuer")
+	}
+
+	var claims idTokenHintClaims
+	verified := false
+	for _, key := range keySet.Keys {
+		publicKey := key.Public()
+		if !publicKey.Valid() {
+			continue
+		}
+		if err := token.Claims(&publicKey, &claims); err == nil {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, errors.New("signature was not made by any key of the issuer")
+	}
+
+	if claims.Issuer != issuerURL {
+		return nil, fmt.Errorf("issuer %q does not match", claims.Issuer)
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("subject is missing")
+	}
+	if claims.IssuedAt == nil {
+		return nil, errors.New("issued at time is missing")
+	}
+	if issuedAt := claims.IssuedAt.Time(); time.Since(issuedAt) > maxAge {
+		return nil, fmt.Errorf("issued at %s, which is longer ago than the maximum age of %s", issuedAt.UTC().Format(time.RFC3339), maxAge)
+	}
+	return &claims, nil
+}
+
+// clientID returns the ID of the client to which the ID token was issued. The Supervisor always includes the azp
+// claim in its ID tokens, but also accept ID tokens with only one audience in case that ever changes.
+func (c *idTokenHintClaims) clientID() string {
+	if c.AuthorizedParty != "" {
+		return c.AuthorizedParty
+	}
+	if len(c.Audience) == 1 {
+		return c.Audience[0]
+	}
+	return ""
+}
+
+// matchPostLogoutRedirectURI compares the requested post_logout_redirect_uri to the ones which are allowed for the
+// client using the same rules that are used for the redirect_uri param of the authorization endpoint, so that
+// loopback interface URIs may use any port.
+func matchPostLogoutRedirectURI(rawURI string, client fosite.Client) (*url.URL, error) {
+	pinnipedClient, ok := client.(*clientregistry.Client)
+	if !ok || len(pinnipedClient.PostLogoutRedirectURIs) == 0 {
+		return nil, errors.New("client does not allow any post_logout_redirect_uri")
+	}
+	return fosite.MatchRedirectURIWithClientRedirectURIs(rawURI, &fosite.DefaultClient{
+		RedirectURIs: pinnipedClient.PostLogoutRedirectURIs,
+	})
+}
+
+// endSessions revokes the downstream tokens of the sessions of the user which were started by the same login as the
+// ID token, and returns those sessions. The Supervisor includes the auth_time claim in its ID tokens, which is the
+// time of the login which started the session. ID tokens without auth_time end all sessions of the user with the client.
+func endSessions(ctx context.Context, sessionStorage SessionStorage, clientID string, claims *idTokenHintClaims) ([]fosite.Requester, error) {
+	sessions, err := sessionStorage.ListSessionsOfSubject(ctx, clientID, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	var endedSessions []fosite.Requester
+	for _, session := range sessions {
+		if claims.AuthTime != 0 && authTime(session) != claims.AuthTime {
+			continue
+		}
+		if err := sessionStorage.RevokeAccessToken(ctx, session.GetID()); err != nil {
+			return nil, err
+		}
+		if err := sessionStorage.RevokeRefreshToken(ctx, session.GetID()); err != nil {
+			return nil, err
+		}
+		endedSessions = append(endedSessions, session)
+	}
+	return endedSessions, nil
+}
+
+func authTime(session fosite.Requester) int64 {
+	pinnipedSession, ok := session.GetSession().(*psession.PinnipedSession)
+	if !ok || pinnipedSession.Fosite == nil || pinnipedSession.Fosite.Claims == nil {
+		return 0
+	}
+	return pinnipedSession.Fosite.Claims.AuthTime.Unix()
+}
+
+// upstreamToEndSessionOf returns the upstream OIDC provider which started the session, when the upstream session
+// should also be ended.
+func upstreamToEndSessionOf(
+	customSessionData *psession.CustomSessionData,
+	idpLister oidc.FederationDomainIdentityProvidersListerI,
+) provider.UpstreamOIDCIdentityProviderI {
+	if customSessionData.ProviderType != psession.ProviderTypeOIDC {
+		return nil
+	}
+	upstreamOIDCIdentityProvider, err := oidc.FindUpstreamOIDCIdentityProviderOfSession(idpLister, customSessionData)
+	if err != nil || upstreamOIDCIdentityProvider.GetEndSessionURL() == nil {
+		return nil
+	}
+	return upstreamOIDCIdentityProvider
+}
+
+func withQueryParams(u *url.URL, params url.Values) string {
+	withParams := *u
+	query := withParams.Query()
+	for name := range params {
+		query.Set(name, params.Get(name))
+	}
+	withParams.RawQuery = query.Encode()
+	return withParams.String()
+}
+
+func auditEvent(r *http.Request, endedSession fosite.Requester) auditlog.Event {
+	event := auditlog.Event{
+		Type:          auditlog.SessionLoggedOut,
+		CorrelationID: oidc.CorrelationID(endedSession),
+		Request:       auditlog.RequestFromHTTP(r),
+		ClientID:      endedSession.GetClient().GetID(),
+	}
+	session, ok := endedSession.GetSession().(*psession.PinnipedSession)
+	if ok && session.Custom != nil {
+		event.UpstreamIDP = &auditlog.UpstreamIDP{Name: session.Custom.ProviderName, Type: string(session.Custom.ProviderType)}
+		if session.Custom.Username != "" {
+			event.User = &auditlog.User{Username: session.Custom.Username}
+		}
+	}
+	return event
+}
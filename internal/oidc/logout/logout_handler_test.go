@@ -0,0 +1,588 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package logout
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/token/jwt"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/square/go-jose.v2"
+	josejwt "gopkg.in/square/go-jose.v2/jwt"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/fake"
+	v1 "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	configv1alpha1 "go.pinniped.dev/generated/latest/apis/supervisor/config/v1alpha1"
+	supervisorfake "go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned/fake"
+	"go.pinniped.dev/internal/auditlog"
+	"go.pinniped.dev/internal/crud"
+	"go.pinniped.dev/internal/fositestorage/accesstoken"
+	"go.pinniped.dev/internal/oidc"
+	"go.pinniped.dev/internal/oidc/jwks"
+	"go.pinniped.dev/internal/oidc/oidcclientvalidator"
+	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/psession"
+	"go.pinniped.dev/internal/testutil"
+	"go.pinniped.dev/internal/testutil/oidctestutil"
+)
+
+const (
+	downstreamIssuer          = "https://my-downstream-issuer.com/path"
+	otherDownstreamIssuer     = "https://my-downstream-issuer.com/other-path"
+	downstreamClientID        = "client.oauth.pinniped.dev-test-name"
+	downstreamClientUID       = "fake-client-uid"
+	downstreamRedirectURI     = "https://client.example.com/callback"
+	downstreamPostLogoutURI   = "https://client.example.com/logged-out"
+	downstreamLoopbackLogout  = "http://127.0.0.1/logged-out"
+	downstreamSubject         = "https://some-upstream-issuer.com?sub=some-upstream-subject"
+	downstreamOtherSubject    = "https://some-upstream-issuer.com?sub=some-other-upstream-subject"
+	downstreamUsername        = "some-downstream-username"
+	upstreamOIDCName          = "some-oidc-idp"
+	upstreamOIDCResourceUID   = "oidc-resource-uid"
+	upstreamOIDCClientID      = "some-upstream-client-id"
+	upstreamRefreshToken      = "some-upstream-refresh-token"
+	upstreamEndSessionURL     = "https://some-upstream-issuer.com/logout?some=param"
+	someStateFromTheClient    = "some-state-from-the-client"
+	otherLoginAuthTimeSeconds = 1000
+	maxIDTokenHintAge         = 2 * time.Hour
+)
+
+func TestEndSessionEndpoint(t *testing.T) {
+	oidcSession := &psession.CustomSessionData{
+		Username:     downstreamUsername,
+		ProviderUID:  upstreamOIDCResourceUID,
+		ProviderName: upstreamOIDCName,
+		ProviderType: psession.ProviderTypeOIDC,
+		OIDC:         &psession.OIDCSessionData{UpstreamRefreshToken: upstreamRefreshToken},
+	}
+
+	happyOIDCUpstream := func() *oidctestutil.TestUpstreamOIDCIdentityProviderBuilder {
+		return oidctestutil.NewTestUpstreamOIDCIdentityProviderBuilder().
+			WithName(upstreamOIDCName).
+			WithResourceUID(upstreamOIDCResourceUID).
+			WithClientID(upstreamOIDCClientID)
+	}
+
+	parsedUpstreamEndSessionURL, err := url.Parse(upstreamEndSessionURL)
+	require.NoError(t, err)
+
+	otherSigningKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	happyStateCodec := securecookie.New([]byte("fake-hash-secret"), []byte("0123456789ABCDEF"))
+	happyStateCodec.SetSerializer(securecookie.JSONEncoder{})
+
+	tests := []struct {
+		name string
+		idps *oidctestutil.UpstreamIDPListerBuilder
+		// modifyForm may change the form of the request, which already has the ID token of the session which is
+		// being logged out in its id_token_hint param, the allowed post_logout_redirect_uri, and a state param.
+		modifyForm func(t *testing.T, form url.Values, signingKey *ecdsa.PrivateKey)
+		method     string
+
+		wantStatus   int
+		wantLocation string
+		// wantUpstreamState is the state which should be sent to the upstream end_session_endpoint, instead of the
+		// state param of wantLocation.
+		wantUpstreamState      *logoutState
+		wantBody               string
+		wantRemainingSessions  int
+		wantUpstreamRevokeCall *oidctestutil.RevokeTokenArgs
+	}{
+		{
+			name:                   "ending the session redirects to the post_logout_redirect_uri with the state",
+			idps:                   oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(happyOIDCUpstream().Build()),
+			wantStatus:             http.StatusSeeOther,
+			wantLocation:           downstreamPostLogoutURI + "?state=" + someStateFromTheClient,
+			wantRemainingSessions:  2,
+			wantUpstreamRevokeCall: &oidctestutil.RevokeTokenArgs{Token: upstreamRefreshToken, TokenType: provider.RefreshTokenType},
+		},
+		{
+			name: "POST requests are also accepted",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(happyOIDCUpstream().Build()),
+			modifyForm: func(_ *testing.T, form url.Values, _ *ecdsa.PrivateKey) {
+				form.Del("state")
+			},
+			method:                 http.MethodPost,
+			wantStatus:             http.StatusSeeOther,
+			wantLocation:           downstreamPostLogoutURI,
+			wantRemainingSessions:  2,
+			wantUpstreamRevokeCall: &oidctestutil.RevokeTokenArgs{Token: upstreamRefreshToken, TokenType: provider.RefreshTokenType},
+		},
+		{
+			name: "loopback post_logout_redirect_uri may use any port",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(happyOIDCUpstream().Build()),
+			modifyForm: func(_ *testing.T, form url.Values, _ *ecdsa.PrivateKey) {
+				form.Set("post_logout_redirect_uri", "http://127.0.0.1:12345/logged-out")
+			},
+			wantStatus:             http.StatusSeeOther,
+			wantLocation:           "http://127.0.0.1:12345/logged-out?state=" + someStateFromTheClient,
+			wantRemainingSessions:  2,
+			wantUpstreamRevokeCall: &oidctestutil.RevokeTokenArgs{Token: upstreamRefreshToken, TokenType: provider.RefreshTokenType},
+		},
+		{
+			name: "without a post_logout_redirect_uri, the user is told that they have been logged out",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(happyOIDCUpstream().Build()),
+			modifyForm: func(_ *testing.T, form url.Values, _ *ecdsa.PrivateKey) {
+				form.Del("post_logout_redirect_uri")
+			},
+			wantStatus:             http.StatusOK,
+			wantBody:               "You have been logged out.\n",
+			wantRemainingSessions:  2,
+			wantUpstreamRevokeCall: &oidctestutil.RevokeTokenArgs{Token: upstreamRefreshToken, TokenType: provider.RefreshTokenType},
+		},
+		{
+			name: "when the upstream session should be ended, redirects to the upstream end_session_endpoint",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(
+				happyOIDCUpstream().WithEndSessionURL(parsedUpstreamEndSessionURL).Build(),
+			),
+			wantStatus: http.StatusSeeOther,
+			wantLocation: "https://some-upstream-issuer.com/logout?" + url.Values{
+				"some":                     []string{"param"},
+				"client_id":                []string{upstreamOIDCClientID},
+				"post_logout_redirect_uri": []string{downstreamIssuer + "/oauth2/logout/callback"},
+			}.Encode(),
+			wantUpstreamState:      &logoutState{PostLogoutRedirectURI: downstreamPostLogoutURI, State: someStateFromTheClient},
+			wantRemainingSessions:  2,
+			wantUpstreamRevokeCall: &oidctestutil.RevokeTokenArgs{Token: upstreamRefreshToken, TokenType: provider.RefreshTokenType},
+		},
+		{
+			name: "when the upstream session should be ended without a post_logout_redirect_uri",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(
+				happyOIDCUpstream().WithEndSessionURL(parsedUpstreamEndSessionURL).Build(),
+			),
+			modifyForm: func(_ *testing.T, form url.Values, _ *ecdsa.PrivateKey) {
+				form.Del("post_logout_redirect_uri")
+			},
+			wantStatus: http.StatusSeeOther,
+			wantLocation: "https://some-upstream-issuer.com/logout?" + url.Values{
+				"some":                     []string{"param"},
+				"client_id":                []string{upstreamOIDCClientID},
+				"post_logout_redirect_uri": []string{downstreamIssuer + "/oauth2/logout/callback"},
+			}.Encode(),
+			wantUpstreamState:      &logoutState{State: someStateFromTheClient},
+			wantRemainingSessions:  2,
+			wantUpstreamRevokeCall: &oidctestutil.RevokeTokenArgs{Token: upstreamRefreshToken, TokenType: provider.RefreshTokenType},
+		},
+		{
+			name: "the session is still ended when the upstream revocation fails",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(
+				happyOIDCUpstream().WithRevokeTokenError(errors.New("some upstream revocation error")).Build(),
+			),
+			wantStatus:             http.StatusSeeOther,
+			wantLocation:           downstreamPostLogoutURI + "?state=" + someStateFromTheClient,
+			wantRemainingSessions:  2,
+			wantUpstreamRevokeCall: &oidctestutil.RevokeTokenArgs{Token: upstreamRefreshToken, TokenType: provider.RefreshTokenType},
+		},
+		{
+			name: "an expired id_token_hint still ends the session",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(happyOIDCUpstream().Build()),
+			modifyForm: func(t *testing.T, form url.Values, signingKey *ecdsa.PrivateKey) {
+				claims := idTokenClaimsForLogin(t, form.Get("id_token_hint"))
+				claims["iat"] = time.Now().Add(-maxIDTokenHintAge + time.Minute).Unix()
+				claims["exp"] = time.Now().Add(-time.Hour).Unix()
+				form.Set("id_token_hint", signIDToken(t, signingKey, claims))
+			},
+			wantStatus:             http.StatusSeeOther,
+			wantLocation:           downstreamPostLogoutURI + "?state=" + someStateFromTheClient,
+			wantRemainingSessions:  2,
+			wantUpstreamRevokeCall: &oidctestutil.RevokeTokenArgs{Token: upstreamRefreshToken, TokenType: provider.RefreshTokenType},
+		},
+		{
+			name: "an id_token_hint without auth_time ends all sessions of the user with the client",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(happyOIDCUpstream().Build()),
+			modifyForm: func(t *testing.T, form url.Values, signingKey *ecdsa.PrivateKey) {
+				claims := idTokenClaimsForLogin(t, form.Get("id_token_hint"))
+				delete(claims, "auth_time")
+				form.Set("id_token_hint", signIDToken(t, signingKey, claims))
+				form.Del("post_logout_redirect_uri")
+			},
+			wantStatus:            http.StatusOK,
+			wantBody:              "You have been logged out.\n",
+			wantRemainingSessions: 1,
+		},
+		{
+			name: "a matching client_id param is accepted",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(happyOIDCUpstream().Build()),
+			modifyForm: func(_ *testing.T, form url.Values, _ *ecdsa.PrivateKey) {
+				form.Set("client_id", downstreamClientID)
+			},
+			wantStatus:             http.StatusSeeOther,
+			wantLocation:           downstreamPostLogoutURI + "?state=" + someStateFromTheClient,
+			wantRemainingSessions:  2,
+			wantUpstreamRevokeCall: &oidctestutil.RevokeTokenArgs{Token: upstreamRefreshToken, TokenType: provider.RefreshTokenType},
+		},
+		{
+			name: "a different client_id param is rejected",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(happyOIDCUpstream().Build()),
+			modifyForm: func(_ *testing.T, form url.Values, _ *ecdsa.PrivateKey) {
+				form.Set("client_id", "pinniped-cli")
+			},
+			wantStatus:            http.StatusBadRequest,
+			wantBody:              "Bad Request: client_id param does not match the client of the id_token_hint\n",
+			wantRemainingSessions: 3,
+		},
+		{
+			name: "a post_logout_redirect_uri which is not allowed for the client is rejected",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(happyOIDCUpstream().Build()),
+			modifyForm: func(_ *testing.T, form url.Values, _ *ecdsa.PrivateKey) {
+				form.Set("post_logout_redirect_uri", "https://evil.example.com/logged-out")
+			},
+			wantStatus:            http.StatusBadRequest,
+			wantBody:              "Bad Request: post_logout_redirect_uri param is not allowed for this client\n",
+			wantRemainingSessions: 3,
+		},
+		{
+			name: "a missing id_token_hint is rejected",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(happyOIDCUpstream().Build()),
+			modifyForm: func(_ *testing.T, form url.Values, _ *ecdsa.PrivateKey) {
+				form.Del("id_token_hint")
+			},
+			wantStatus:            http.StatusBadRequest,
+			wantBody:              "Bad Request: id_token_hint param is required\n",
+			wantRemainingSessions: 3,
+		},
+		{
+			name: "an id_token_hint which is not a JWT is rejected",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(happyOIDCUpstream().Build()),
+			modifyForm: func(_ *testing.T, form url.Values, _ *ecdsa.PrivateKey) {
+				form.Set("id_token_hint", "not-a-jwt")
+			},
+			wantStatus:            http.StatusBadRequest,
+			wantBody:              "Bad Request: id_token_hint param is invalid\n",
+			wantRemainingSessions: 3,
+		},
+		{
+			name: "an id_token_hint which was signed by another key is rejected",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(happyOIDCUpstream().Build()),
+			modifyForm: func(t *testing.T, form url.Values, _ *ecdsa.PrivateKey) {
+				form.Set("id_token_hint", signIDToken(t, otherSigningKey, idTokenClaimsForLogin(t, form.Get("id_token_hint"))))
+			},
+			wantStatus:            http.StatusBadRequest,
+			wantBody:              "Bad Request: id_token_hint param is invalid\n",
+			wantRemainingSessions: 3,
+		},
+		{
+			name: "an id_token_hint from another issuer is rejected",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(happyOIDCUpstream().Build()),
+			modifyForm: func(t *testing.T, form url.Values, signingKey *ecdsa.PrivateKey) {
+				claims := idTokenClaimsForLogin(t, form.Get("id_token_hint"))
+				claims["iss"] = "https://some-other-issuer.com"
+				form.Set("id_token_hint", signIDToken(t, signingKey, claims))
+			},
+			wantStatus:            http.StatusBadRequest,
+			wantBody:              "Bad Request: id_token_hint param is invalid\n",
+			wantRemainingSessions: 3,
+		},
+		{
+			name: "an id_token_hint which was issued longer ago than the maximum age is rejected",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(happyOIDCUpstream().Build()),
+			modifyForm: func(t *testing.T, form url.Values, signingKey *ecdsa.PrivateKey) {
+				claims := idTokenClaimsForLogin(t, form.Get("id_token_hint"))
+				claims["iat"] = time.Now().Add(-maxIDTokenHintAge - time.Minute).Unix()
+				claims["exp"] = time.Now().Add(-maxIDTokenHintAge).Unix()
+				form.Set("id_token_hint", signIDToken(t, signingKey, claims))
+			},
+			wantStatus:            http.StatusBadRequest,
+			wantBody:              "Bad Request: id_token_hint param is invalid\n",
+			wantRemainingSessions: 3,
+		},
+		{
+			name: "an id_token_hint without an issued at time is rejected",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(happyOIDCUpstream().Build()),
+			modifyForm: func(t *testing.T, form url.Values, signingKey *ecdsa.PrivateKey) {
+				claims := idTokenClaimsForLogin(t, form.Get("id_token_hint"))
+				delete(claims, "iat")
+				form.Set("id_token_hint", signIDToken(t, signingKey, claims))
+			},
+			wantStatus:            http.StatusBadRequest,
+			wantBody:              "Bad Request: id_token_hint param is invalid\n",
+			wantRemainingSessions: 3,
+		},
+		{
+			name: "an id_token_hint from a token exchange is rejected because it was issued to a cluster",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(happyOIDCUpstream().Build()),
+			modifyForm: func(t *testing.T, form url.Values, signingKey *ecdsa.PrivateKey) {
+				claims := idTokenClaimsForLogin(t, form.Get("id_token_hint"))
+				claims["aud"] = []string{"some-cluster-audience"}
+				form.Set("id_token_hint", signIDToken(t, signingKey, claims))
+			},
+			wantStatus:            http.StatusBadRequest,
+			wantBody:              "Bad Request: id_token_hint param is invalid\n",
+			wantRemainingSessions: 3,
+		},
+		{
+			name:                  "PUT requests are rejected",
+			idps:                  oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(happyOIDCUpstream().Build()),
+			method:                http.MethodPut,
+			wantStatus:            http.StatusMethodNotAllowed,
+			wantBody:              "Method Not Allowed: PUT (try GET or POST)\n",
+			wantRemainingSessions: 3,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			kubeClient := fake.NewSimpleClientset()
+			supervisorClient := supervisorfake.NewSimpleClientset()
+			secrets := kubeClient.CoreV1().Secrets("some-namespace")
+			oidcClientsClient := supervisorClient.ConfigV1alpha1().OIDCClients("some-namespace")
+
+			oidcClient, clientSecret := testutil.FullyCapableOIDCClientAndStorageSecret(t,
+				"some-namespace", downstreamClientID, downstreamClientUID, downstreamRedirectURI,
+				[]string{testutil.HashedPassword1AtGoMinCost}, oidcclientvalidator.Validate)
+			oidcClient.Spec.AllowedPostLogoutRedirectURIs = []configv1alpha1.RedirectURI{downstreamPostLogoutURI, downstreamLoopbackLogout}
+			require.NoError(t, supervisorClient.Tracker().Add(oidcClient))
+			require.NoError(t, kubeClient.Tracker().Add(clientSecret))
+
+			// Use lower minimum required bcrypt cost than we would use in production to keep unit the tests fast.
+			oauthStore := oidc.NewKubeStorage(secrets, oidcClientsClient, downstreamIssuer, oidc.DefaultOIDCTimeoutsConfiguration(), bcrypt.MinCost)
+			otherOauthStore := oidc.NewKubeStorage(secrets, oidcClientsClient, otherDownstreamIssuer, oidc.DefaultOIDCTimeoutsConfiguration(), bcrypt.MinCost)
+			hmacSecretFunc := func() []byte { return []byte("some secret - must have at least 32 bytes") }
+			signingKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			require.NoError(t, err)
+			jwksProvider := jwks.NewDynamicJWKSProvider()
+			signingJWK := &jose.JSONWebKey{Key: signingKey, KeyID: "some-key-id", Algorithm: "ES256", Use: "sig"}
+			jwksProvider.SetIssuerToJWKSMap(
+				map[string]*jose.JSONWebKeySet{
+					downstreamIssuer:      {Keys: []jose.JSONWebKey{signingJWK.Public()}},
+					otherDownstreamIssuer: {Keys: []jose.JSONWebKey{signingJWK.Public()}},
+				},
+				map[string]*jose.JSONWebKey{downstreamIssuer: signingJWK, otherDownstreamIssuer: signingJWK},
+				nil,
+			)
+			oauthHelper := oidc.FositeOauth2Helper(oauthStore, downstreamIssuer, hmacSecretFunc, nil, jwksProvider, oidc.DefaultOIDCTimeoutsConfiguration(), nil)
+			otherOauthHelper := oidc.FositeOauth2Helper(otherOauthStore, otherDownstreamIssuer, hmacSecretFunc, nil, jwksProvider, oidc.DefaultOIDCTimeoutsConfiguration(), nil)
+
+			// The user has logged in twice with the same client, e.g. from two browsers, and another user has also
+			// logged in with the same client. Only the first login of the first user should be ended. The user has
+			// also logged in at the same time with the same client of another FederationDomain, which should not be ended.
+			login := func(oauthHelper fosite.OAuth2Provider, subject string, authTime time.Time) *oidctestutil.SimulatedLoginTokens {
+				return oidctestutil.SimulateLoginHavingAlreadyHappened(t, oauthHelper, oidctestutil.SimulatedLogin{
+					ClientID:     downstreamClientID,
+					ClientSecret: testutil.PlaintextPassword1,
+					RedirectURI:  downstreamRedirectURI,
+					Scopes:       []string{"openid", "offline_access", "username"},
+					IDTokenClaims: &jwt.IDTokenClaims{
+						Subject:     subject,
+						RequestedAt: authTime.UTC(),
+						AuthTime:    authTime.UTC(),
+						Extra:       map[string]interface{}{"azp": downstreamClientID, "username": downstreamUsername},
+					},
+					CustomSessionData: oidcSession,
+				})
+			}
+			loginTime := time.Now()
+			firstLogin := login(oauthHelper, downstreamSubject, loginTime)
+			idToken, sessionID := firstLogin.IDToken, firstLogin.RequestID
+			login(oauthHelper, downstreamSubject, time.Unix(otherLoginAuthTimeSeconds, 0))
+			login(oauthHelper, downstreamOtherSubject, loginTime)
+			login(otherOauthHelper, downstreamSubject, loginTime)
+			requireNumberOfSessions(t, secrets, 4)
+
+			form := url.Values{
+				"id_token_hint":            []string{idToken},
+				"post_logout_redirect_uri": []string{downstreamPostLogoutURI},
+				"state":                    []string{someStateFromTheClient},
+			}
+			if test.modifyForm != nil {
+				test.modifyForm(t, form, signingKey)
+			}
+
+			var req *http.Request
+			reqContext := context.WithValue(context.Background(), struct{ name string }{name: "test"}, "request-context")
+			switch test.method {
+			case "", http.MethodGet:
+				req = httptest.NewRequest(http.MethodGet, "/path/shouldn't/matter?"+form.Encode(), nil)
+			default:
+				req = httptest.NewRequest(test.method, "/path/shouldn't/matter", strings.NewReader(form.Encode()))
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			req = req.WithContext(reqContext)
+			rsp := httptest.NewRecorder()
+
+			auditLogger := auditlog.NewTestLogger(t)
+			subject := NewHandler(downstreamIssuer, jwksProvider, happyStateCodec, oauthStore, maxIDTokenHintAge, test.idps.Build(), auditLogger)
+			subject.ServeHTTP(rsp, req)
+			t.Logf("response: %#v", rsp)
+			t.Logf("response body: %q", rsp.Body.String())
+
+			require.Equal(t, test.wantStatus, rsp.Code)
+			location := rsp.Header().Get("Location")
+			if test.wantUpstreamState != nil {
+				locationURL, err := url.Parse(location)
+				require.NoError(t, err)
+				query := locationURL.Query()
+				var state logoutState
+				require.NoError(t, happyStateCodec.Decode("l", query.Get("state"), &state))
+				require.Equal(t, test.wantUpstreamState, &state)
+				query.Del("state")
+				locationURL.RawQuery = query.Encode()
+				location = locationURL.String()
+			}
+			require.Equal(t, test.wantLocation, location)
+			if test.wantBody != "" {
+				require.Equal(t, test.wantBody, rsp.Body.String())
+			}
+
+			requireNumberOfSessions(t, secrets, test.wantRemainingSessions+1)
+			otherFederationDomainSessions, err := otherOauthStore.ListSessionsOfSubject(reqContext, downstreamClientID, downstreamSubject)
+			require.NoError(t, err)
+			require.Len(t, otherFederationDomainSessions, 1)
+
+			if test.wantUpstreamRevokeCall != nil {
+				test.wantUpstreamRevokeCall.Ctx = reqContext
+				test.idps.RequireExactlyOneCallToRevokeToken(t, upstreamOIDCName, test.wantUpstreamRevokeCall)
+			} else if test.wantRemainingSessions == 3 {
+				test.idps.RequireExactlyZeroCallsToRevokeToken(t)
+			}
+
+			auditEvents := auditLogger.Events()
+			require.Len(t, auditEvents, 3-test.wantRemainingSessions)
+			for _, event := range auditEvents {
+				require.Equal(t, auditlog.SessionLoggedOut, event.Type)
+				require.Equal(t, downstreamClientID, event.ClientID)
+				require.Equal(t, &auditlog.User{Username: downstreamUsername}, event.User)
+				require.Equal(t, &auditlog.UpstreamIDP{Name: upstreamOIDCName, Type: "oidc"}, event.UpstreamIDP)
+			}
+			if test.wantRemainingSessions == 2 {
+				require.Equal(t, sessionID, auditEvents[0].CorrelationID)
+			}
+		})
+	}
+}
+
+// idTokenClaimsForLogin returns the claims of an ID token without verifying it, so a test can sign a modified copy.
+func idTokenClaimsForLogin(t *testing.T, rawIDToken string) map[string]interface{} {
+	t.Helper()
+	token, err := josejwt.ParseSigned(rawIDToken)
+	require.NoError(t, err)
+	claims := map[string]interface{}{}
+	require.NoError(t, token.UnsafeClaimsWithoutVerification(&claims))
+	for name, value := range claims {
+		// Numeric claims are decoded as floats, which would be re-encoded using exponents.
+		if number, ok := value.(float64); ok {
+			claims[name] = int64(number)
+		}
+	}
+	return claims
+}
+
+func signIDToken(t *testing.T, signingKey *ecdsa.PrivateKey, claims map[string]interface{}) string {
+	t.Helper()
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: signingKey}, nil)
+	require.NoError(t, err)
+	idToken, err := josejwt.Signed(signer).Claims(claims).CompactSerialize()
+	require.NoError(t, err)
+	return idToken
+}
+
+func requireNumberOfSessions(t *testing.T, secrets v1.SecretInterface, want int) {
+	t.Helper()
+	testutil.RequireNumberOfSecretsMatchingLabelSelector(t, secrets, labels.Set{crud.SecretLabelKey: accesstoken.TypeLabelValue}, want)
+}
+
+func TestCallbackHandler(t *testing.T) {
+	happyStateCodec := securecookie.New([]byte("fake-hash-secret"), []byte("0123456789ABCDEF"))
+	happyStateCodec.SetSerializer(securecookie.JSONEncoder{})
+	otherStateCodec := securecookie.New([]byte("other-hash-secret"), []byte("0123456789ABCDEF"))
+	otherStateCodec.SetSerializer(securecookie.JSONEncoder{})
+
+	encodeState := func(codec *securecookie.SecureCookie, name string, state *logoutState) string {
+		encoded, err := codec.Encode(name, state)
+		require.NoError(t, err)
+		return encoded
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		query  url.Values
+
+		wantStatus   int
+		wantLocation string
+		wantBody     string
+	}{
+		{
+			name: "redirects to the post_logout_redirect_uri of the client with its state",
+			query: url.Values{"state": []string{encodeState(happyStateCodec, "l",
+				&logoutState{PostLogoutRedirectURI: downstreamPostLogoutURI, State: someStateFromTheClient})}},
+			wantStatus:   http.StatusSeeOther,
+			wantLocation: downstreamPostLogoutURI + "?state=" + someStateFromTheClient,
+		},
+		{
+			name: "redirects to the post_logout_redirect_uri of the client without a state",
+			query: url.Values{"state": []string{encodeState(happyStateCodec, "l",
+				&logoutState{PostLogoutRedirectURI: downstreamPostLogoutURI})}},
+			wantStatus:   http.StatusSeeOther,
+			wantLocation: downstreamPostLogoutURI,
+		},
+		{
+			name:       "without a post_logout_redirect_uri, the user is told that they have been logged out",
+			query:      url.Values{"state": []string{encodeState(happyStateCodec, "l", &logoutState{State: someStateFromTheClient})}},
+			wantStatus: http.StatusOK,
+			wantBody:   "You have been logged out.\n",
+		},
+		{
+			name:       "a missing state is rejected",
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "Bad Request: state param not found\n",
+		},
+		{
+			name: "a state which was not signed by the Supervisor is rejected",
+			query: url.Values{"state": []string{encodeState(otherStateCodec, "l",
+				&logoutState{PostLogoutRedirectURI: "https://evil.example.com"})}},
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "Bad Request: error reading state\n",
+		},
+		{
+			name: "a state which was encoded for another purpose is rejected",
+			query: url.Values{"state": []string{encodeState(happyStateCodec, oidc.UpstreamStateParamEncodingName,
+				&logoutState{PostLogoutRedirectURI: "https://evil.example.com"})}},
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "Bad Request: error reading state\n",
+		},
+		{
+			name:       "POST requests are rejected",
+			method:     http.MethodPost,
+			wantStatus: http.StatusMethodNotAllowed,
+			wantBody:   "Method Not Allowed: POST (try GET)\n",
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			method := test.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, "/path/shouldn't/matter?"+test.query.Encode(), nil)
+			rsp := httptest.NewRecorder()
+
+			NewCallbackHandler(happyStateCodec).ServeHTTP(rsp, req)
+			t.Logf("response: %#v", rsp)
+			t.Logf("response body: %q", rsp.Body.String())
+
+			require.Equal(t, test.wantStatus, rsp.Code)
+			require.Equal(t, test.wantLocation, rsp.Header().Get("Location"))
+			if test.wantBody != "" {
+				require.Equal(t, test.wantBody, rsp.Body.String())
+			}
+		})
+	}
+}
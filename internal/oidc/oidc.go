@@ -1,4 +1,4 @@
-// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 // Package oidc contains common OIDC functionality needed by Pinniped.
@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/felixge/httpsnoop"
@@ -20,10 +21,13 @@ import (
 
 	"go.pinniped.dev/generated/latest/apis/supervisor/idpdiscovery/v1alpha1"
 	oidcapi "go.pinniped.dev/generated/latest/apis/supervisor/oidc"
+	"go.pinniped.dev/internal/fositestoragei"
 	"go.pinniped.dev/internal/httputil/httperr"
+	"go.pinniped.dev/internal/idtransform"
 	"go.pinniped.dev/internal/oidc/csrftoken"
 	"go.pinniped.dev/internal/oidc/jwks"
 	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/oidc/provider/branding"
 	"go.pinniped.dev/internal/oidc/provider/formposthtml"
 	"go.pinniped.dev/internal/plog"
 	"go.pinniped.dev/internal/psession"
@@ -35,10 +39,26 @@ const (
 	WellKnownEndpointPath     = "/.well-known/openid-configuration"
 	AuthorizationEndpointPath = "/oauth2/authorize"
 	TokenEndpointPath         = "/oauth2/token" //nolint:gosec // ignore lint warning that this is a credential
+	RevocationEndpointPath    = "/oauth2/revoke"
+	IntrospectionEndpointPath = "/oauth2/introspect"
+	UserInfoEndpointPath      = "/oauth2/userinfo"
+	EndSessionEndpointPath    = "/oauth2/logout"
+	EndSessionCallbackPath    = "/oauth2/logout/callback"
 	CallbackEndpointPath      = "/callback"
 	JWKSEndpointPath          = "/jwks.json"
 	PinnipedIDPsPathV1Alpha1  = "/v1alpha1/pinniped_identity_providers"
 	PinnipedLoginPath         = "/login"
+	ChooseIDPEndpointPath     = "/choose_identity_provider"
+
+	DeviceAuthorizationEndpointPath = "/oauth2/device_authorization"
+	DeviceVerificationEndpointPath  = "/oauth2/device"
+	DeviceCallbackEndpointPath      = "/oauth2/device/callback"
+
+	ConsentEndpointPath  = "/consent"
+	ConsentsEndpointPath = "/oauth2/consents"
+
+	SAMLMetadataEndpointPath = "/saml/metadata"
+	SAMLACSEndpointPath      = "/saml/acs"
 )
 
 const (
@@ -48,6 +68,7 @@ const (
 	//
 	// Version 1 was the original version.
 	// Version 2 added the UpstreamType field to the UpstreamStateParamData struct.
+	// The optional CorrelationID field was added later without changing the version, since it may be absent.
 	UpstreamStateParamFormatVersion = "2"
 
 	// UpstreamStateParamEncodingName is the `name` passed to the encoder for encoding the upstream state param value.
@@ -68,6 +89,17 @@ const (
 	// Supervisor's authorization endpoint should give the browser a new CSRF cookie. We set it to
 	// a week so that it is unlikely to expire during a login.
 	CSRFCookieLifespan = time.Hour * 24 * 7
+
+	// SAMLRequestCookieNamePrefix is the prefix of the names of the browser cookies which hold the upstream state
+	// during a login using an upstream SAML IDP. Each login gets its own cookie, named after the RelayState of its
+	// SAML AuthnRequest, because the RelayState is too small to hold the state itself. Since the IDP posts its response
+	// to the assertion consumer service from another site, these cookies must be sent on cross-site requests.
+	// Only the browser which started the login has its cookie, which protects against login CSRF.
+	SAMLRequestCookieNamePrefix = "__Host-pinniped-saml-"
+
+	// SAMLRequestCookieLifespan is the length of time that the browser keeps a SAML request cookie. The encoded state
+	// inside of it expires on its own, so this only makes sure that the cookies of abandoned logins do not pile up.
+	SAMLRequestCookieLifespan = 90 * time.Minute
 )
 
 // Encoder is the encoding side of the securecookie.Codec interface.
@@ -100,6 +132,7 @@ type UpstreamStateParamData struct {
 	CSRFToken     csrftoken.CSRFToken `json:"c"`
 	PKCECode      pkce.Code           `json:"k"`
 	FormatVersion string              `json:"v"`
+	CorrelationID string              `json:"r,omitempty"`
 }
 
 type TimeoutsConfiguration struct {
@@ -131,6 +164,24 @@ type TimeoutsConfiguration struct {
 	// in their web browser.
 	RefreshTokenLifespan time.Duration
 
+	// The maximum length of a downstream session, measured from the time that the user logged in. Each refresh
+	// issues a new refresh token with a new lifetime, so without this maximum a session could be kept alive forever
+	// by refreshing it regularly. The tokens issued by the token endpoint are never valid beyond the end of the
+	// session, and refreshes are rejected after that. Zero means that sessions have no maximum length.
+	MaxSessionLifespan time.Duration
+
+	// How long a device code issued by the device authorization endpoint is valid. This determines how much time
+	// the end user has to enter the user code into their web browser and finish their login with the upstream IDP,
+	// while their CLI keeps polling the token endpoint.
+	DeviceCodeLifespan time.Duration
+
+	// How long the user has to answer the consent page of a client which requires consent, after they have logged in.
+	// After this time, the user must start their login again.
+	ConsentRequestLifespan time.Duration
+
+	// How long a user's remembered consent to a client is kept. After this time, the user is asked for consent again.
+	RememberedConsentLifespan time.Duration
+
 	// AuthorizationCodeSessionStorageLifetime is the length of time after which an authcode is allowed to be garbage
 	// collected from storage. Authcodes are kept in storage after they are redeemed to allow the system to mark the
 	// authcode as already used, so it can reject any future uses of the same authcode with special case handling which
@@ -168,25 +219,68 @@ type TimeoutsConfiguration struct {
 	// when the token does not exist. If this is desirable, then the RefreshTokenSessionStorageLifetime can be made
 	// to be significantly larger than RefreshTokenLifespan, at the cost of slower cleanup.
 	RefreshTokenSessionStorageLifetime time.Duration
+
+	// DeviceCodeSessionStorageLifetime is the length of time after which a device code's session data is allowed
+	// to be garbage collected from storage. The session is deleted when its authcode is redeemed by the token
+	// endpoint, but the user might never finish their login. Therefore, this can be just slightly longer than the
+	// DeviceCodeLifespan.
+	DeviceCodeSessionStorageLifetime time.Duration
+
+	// ConsentRequestSessionStorageLifetime is the length of time after which a consent request's session data is
+	// allowed to be garbage collected from storage. The request is deleted when the user consents, but it is kept
+	// when the user declines, so the garbage collector will revoke its upstream tokens. Therefore, this can be
+	// just slightly longer than the ConsentRequestLifespan.
+	ConsentRequestSessionStorageLifetime time.Duration
 }
 
 // Get the defaults for the Supervisor server.
 func DefaultOIDCTimeoutsConfiguration() TimeoutsConfiguration {
+	return TimeoutsConfigurationForTokenLifetimes(nil)
+}
+
+// TimeoutsConfigurationForTokenLifetimes gets the defaults for the Supervisor server, except for the token lifetimes
+// which were configured by a FederationDomain. The storage lifetimes are derived from the resulting token lifetimes,
+// so they keep the relationships described on the fields of TimeoutsConfiguration. A nil tokenLifetimes, or any
+// zero lifetime within it, means that the default is used.
+func TimeoutsConfigurationForTokenLifetimes(tokenLifetimes *provider.FederationDomainTokenLifetimes) TimeoutsConfiguration {
 	accessTokenLifespan := 2 * time.Minute
 	authorizationCodeLifespan := 10 * time.Minute
 	refreshTokenLifespan := 9 * time.Hour
+	deviceCodeLifespan := 15 * time.Minute
+	consentRequestLifespan := 15 * time.Minute
+	var idTokenLifespan, maxSessionLifespan time.Duration
+
+	if tokenLifetimes != nil {
+		if tokenLifetimes.AccessToken != 0 {
+			accessTokenLifespan = tokenLifetimes.AccessToken
+		}
+		if tokenLifetimes.RefreshToken != 0 {
+			refreshTokenLifespan = tokenLifetimes.RefreshToken
+		}
+		idTokenLifespan = tokenLifetimes.IDToken
+		maxSessionLifespan = tokenLifetimes.MaxSession
+	}
+	if idTokenLifespan == 0 {
+		idTokenLifespan = accessTokenLifespan
+	}
 
 	return TimeoutsConfiguration{
 		UpstreamStateParamLifespan:              90 * time.Minute,
 		AuthorizeCodeLifespan:                   authorizationCodeLifespan,
 		AccessTokenLifespan:                     accessTokenLifespan,
-		IDTokenLifespan:                         accessTokenLifespan,
+		IDTokenLifespan:                         idTokenLifespan,
 		RefreshTokenLifespan:                    refreshTokenLifespan,
+		MaxSessionLifespan:                      maxSessionLifespan,
+		DeviceCodeLifespan:                      deviceCodeLifespan,
+		ConsentRequestLifespan:                  consentRequestLifespan,
+		RememberedConsentLifespan:               90 * 24 * time.Hour,
 		AuthorizationCodeSessionStorageLifetime: authorizationCodeLifespan + refreshTokenLifespan,
 		PKCESessionStorageLifetime:              authorizationCodeLifespan + (1 * time.Minute),
 		OIDCSessionStorageLifetime:              authorizationCodeLifespan + (1 * time.Minute),
 		AccessTokenSessionStorageLifetime:       refreshTokenLifespan + accessTokenLifespan,
 		RefreshTokenSessionStorageLifetime:      refreshTokenLifespan + accessTokenLifespan,
+		DeviceCodeSessionStorageLifetime:        deviceCodeLifespan + (1 * time.Minute),
+		ConsentRequestSessionStorageLifetime:    consentRequestLifespan + (1 * time.Minute),
 	}
 }
 
@@ -194,16 +288,33 @@ func FositeOauth2Helper(
 	oauthStore interface{},
 	issuer string,
 	hmacSecretOfLengthAtLeast32Func func() []byte,
+	previousHMACSecretFunc func() []byte,
 	jwksProvider jwks.DynamicJWKSProvider,
 	timeoutsConfiguration TimeoutsConfiguration,
-) fosite.OAuth2Provider {
+	getBranding func() *branding.Branding,
+) *fosite.Fosite {
 	isRedirectURISecureStrict := func(_ context.Context, uri *url.URL) bool {
+		// Fosite only calls this after the redirect URI has been matched against the client's registered redirect URIs,
+		// and only public OIDCClients may register redirect URIs which use a private-use URI scheme, so it is safe to
+		// allow those schemes here. Note that private-use URI schemes are reverse domain names, so they contain a dot.
+		if uri.Scheme != "http" && uri.Scheme != "https" && strings.Contains(uri.Scheme, ".") {
+			return true
+		}
 		return fosite.IsRedirectURISecureStrict(uri)
 	}
 
+	// The form_post page is unbranded when there is no branding getter.
+	formPostHTMLTemplate := formposthtml.Template()
+	if getBranding != nil {
+		formPostHTMLTemplate = formposthtml.TemplateWithBranding(getBranding)
+	}
+
 	oauthConfig := &fosite.Config{
 		IDTokenIssuer: issuer,
 
+		// the audience which clients must use in their client assertion JWTs for the private_key_jwt auth method
+		TokenURL: issuer + TokenEndpointPath,
+
 		AuthorizeCodeLifespan: timeoutsConfiguration.AuthorizeCodeLifespan,
 		IDTokenLifespan:       timeoutsConfiguration.IDTokenLifespan,
 		AccessTokenLifespan:   timeoutsConfiguration.AccessTokenLifespan,
@@ -226,27 +337,45 @@ func FositeOauth2Helper(
 		RedirectSecureChecker: isRedirectURISecureStrict,
 
 		// html template for rendering the authorization response when the request has response_mode=form_post
-		FormPostHTMLTemplate: formposthtml.Template(),
+		FormPostHTMLTemplate: formPostHTMLTemplate,
 
 		// defaults to using BCrypt when nil
 		ClientSecretsHasher: nil,
 	}
 
-	oAuth2Provider := compose.Compose(
+	if storage, ok := oauthStore.(fositestoragei.AllFositeStorage); ok {
+		oauthStore = newDeviceFlowClientStorage(storage, issuer+DeviceCallbackEndpointPath)
+	}
+
+	// The default strategy is only available after composing the provider, so it is looked up lazily.
+	var oAuth2Provider *fosite.Fosite
+	oauthConfig.ClientAuthenticationStrategy = newClientAuthenticationStrategy(oauthStore,
+		func(ctx context.Context, r *http.Request, form url.Values) (fosite.Client, error) {
+			return oAuth2Provider.DefaultClientAuthenticationStrategy(ctx, r, form)
+		},
+	)
+
+	oAuth2Provider = compose.Compose(
 		oauthConfig,
 		oauthStore,
 		&compose.CommonStrategy{
 			// Note that Fosite requires the HMAC secret to be at least 32 bytes.
-			CoreStrategy:               newDynamicOauth2HMACStrategy(oauthConfig, hmacSecretOfLengthAtLeast32Func),
-			OpenIDConnectTokenStrategy: newDynamicOpenIDConnectECDSAStrategy(oauthConfig, jwksProvider),
+			CoreStrategy:               newDynamicOauth2HMACStrategy(oauthConfig, hmacSecretOfLengthAtLeast32Func, previousHMACSecretFunc),
+			OpenIDConnectTokenStrategy: newDynamicOpenIDConnectStrategy(oauthConfig, jwksProvider),
 		},
 		compose.OAuth2AuthorizeExplicitFactory,
 		compose.OAuth2RefreshTokenGrantFactory,
 		compose.OpenIDConnectExplicitFactory,
 		compose.OpenIDConnectRefreshFactory,
+		// must come after the authcode and refresh grant factories, which set the token expiry times
+		MaxSessionLifespanFactory(timeoutsConfiguration.MaxSessionLifespan),
 		compose.OAuth2PKCEFactory,
+		compose.OAuth2ClientCredentialsGrantFactory,
+		ClientCredentialsIdentityFactory,        // must come after the client credentials grant factory, which rejects public clients
+		compose.OAuth2TokenIntrospectionFactory, // used by the revocation endpoint to find the session of a token
+		compose.OAuth2TokenRevocationFactory,
 		TokenExchangeFactory, // handle the "urn:ietf:params:oauth:grant-type:token-exchange" grant type
-	)
+	).(*fosite.Fosite)
 
 	return oAuth2Provider
 }
@@ -291,10 +420,51 @@ type UpstreamActiveDirectoryIdentityProviderLister interface {
 	GetActiveDirectoryIdentityProviders() []provider.UpstreamLDAPIdentityProviderI
 }
 
+type UpstreamSAMLIdentityProvidersLister interface {
+	GetSAMLIdentityProviders() []provider.UpstreamSAMLIdentityProviderI
+}
+
+type UpstreamGitHubIdentityProvidersLister interface {
+	GetGitHubIdentityProviders() []provider.UpstreamGitHubIdentityProviderI
+}
+
 type UpstreamIdentityProvidersLister interface {
 	UpstreamOIDCIdentityProvidersLister
 	UpstreamLDAPIdentityProvidersLister
 	UpstreamActiveDirectoryIdentityProviderLister
+	UpstreamSAMLIdentityProvidersLister
+	UpstreamGitHubIdentityProvidersLister
+}
+
+// FederationDomainIdentityProvidersListerI is an UpstreamIdentityProvidersLister for a particular FederationDomain,
+// which also knows the identity transformations which that FederationDomain configured for each identity provider.
+type FederationDomainIdentityProvidersListerI interface {
+	UpstreamIdentityProvidersLister
+
+	// GetIdentityTransformations returns the identity transformation pipeline for the identity provider with
+	// the given name and type. It never returns nil. When there are no configured transformations, then it
+	// returns an empty pipeline, which does not change identities.
+	GetIdentityTransformations(idpName string, idpType psession.ProviderType) *idtransform.TransformationPipeline
+
+	// GetClientCredentialsTransformations returns the identity transformation pipeline for the identities of clients
+	// which use the client_credentials grant. Like GetIdentityTransformations, it never returns nil.
+	GetClientCredentialsTransformations() *idtransform.TransformationPipeline
+}
+
+// SAMLServiceProviderForIssuer returns the SAML service provider which represents the FederationDomain with the
+// given issuer to upstream SAML IDPs.
+func SAMLServiceProviderForIssuer(issuer string) provider.SAMLServiceProvider {
+	return provider.SAMLServiceProvider{
+		EntityID: issuer + SAMLMetadataEndpointPath,
+		ACSURL:   issuer + SAMLACSEndpointPath,
+	}
+}
+
+// SAMLRequestID returns the ID of the SAML AuthnRequest for the login with the given nonce. The upstream SAML IDP
+// echos it in the InResponseTo attribute of its response, which ties the response to the login, like an OIDC nonce.
+// The prefix is needed because XML IDs must not start with a digit.
+func SAMLRequestID(nonceValue nonce.Nonce) string {
+	return "id-" + string(nonceValue)
 }
 
 func GrantScopeIfRequested(authorizeRequester fosite.AuthorizeRequester, scopeName string) {
@@ -313,7 +483,7 @@ func ScopeWasRequested(authorizeRequester fosite.AuthorizeRequester, scopeName s
 }
 
 func ReadStateParamAndValidateCSRFCookie(r *http.Request, cookieDecoder Decoder, stateDecoder Decoder) (string, *UpstreamStateParamData, error) {
-	csrfValue, err := readCSRFCookie(r, cookieDecoder)
+	csrfValue, err := ReadCSRFCookie(r, cookieDecoder)
 	if err != nil {
 		return "", nil, err
 	}
@@ -331,7 +501,8 @@ func ReadStateParamAndValidateCSRFCookie(r *http.Request, cookieDecoder Decoder,
 	return encodedState, decodedState, nil
 }
 
-func readCSRFCookie(r *http.Request, cookieDecoder Decoder) (csrftoken.CSRFToken, error) {
+// ReadCSRFCookie returns the CSRF token from the CSRF cookie of the request, or an error when it is missing or invalid.
+func ReadCSRFCookie(r *http.Request, cookieDecoder Decoder) (csrftoken.CSRFToken, error) {
 	receivedCSRFCookie, err := r.Cookie(CSRFCookieName)
 	if err != nil {
 		// Error means that the cookie was not found
@@ -386,6 +557,8 @@ func FindUpstreamIDPByNameAndType(
 ) (
 	provider.UpstreamOIDCIdentityProviderI,
 	provider.UpstreamLDAPIdentityProviderI,
+	provider.UpstreamSAMLIdentityProviderI,
+	provider.UpstreamGitHubIdentityProviderI,
 	psession.ProviderType,
 	error,
 ) {
@@ -393,23 +566,86 @@ func FindUpstreamIDPByNameAndType(
 	case string(v1alpha1.IDPTypeOIDC):
 		for _, p := range idpLister.GetOIDCIdentityProviders() {
 			if p.GetName() == upstreamName {
-				return p, nil, psession.ProviderTypeOIDC, nil
+				return p, nil, nil, nil, psession.ProviderTypeOIDC, nil
 			}
 		}
 	case string(v1alpha1.IDPTypeLDAP):
 		for _, p := range idpLister.GetLDAPIdentityProviders() {
 			if p.GetName() == upstreamName {
-				return nil, p, psession.ProviderTypeLDAP, nil
+				return nil, p, nil, nil, psession.ProviderTypeLDAP, nil
 			}
 		}
 	case string(v1alpha1.IDPTypeActiveDirectory):
 		for _, p := range idpLister.GetActiveDirectoryIdentityProviders() {
 			if p.GetName() == upstreamName {
-				return nil, p, psession.ProviderTypeActiveDirectory, nil
+				return nil, p, nil, nil, psession.ProviderTypeActiveDirectory, nil
 			}
 		}
+	case string(v1alpha1.IDPTypeSAML):
+		for _, p := range idpLister.GetSAMLIdentityProviders() {
+			if p.GetName() == upstreamName {
+				return nil, nil, p, nil, psession.ProviderTypeSAML, nil
+			}
+		}
+	case string(v1alpha1.IDPTypeGitHub):
+		for _, p := range idpLister.GetGitHubIdentityProviders() {
+			if p.GetName() == upstreamName {
+				return nil, nil, nil, p, psession.ProviderTypeGitHub, nil
+			}
+		}
+	}
+	return nil, nil, nil, nil, "", errors.New("provider not found")
+}
+
+// FindUpstreamOIDCIdentityProviderOfSession finds the upstream OIDC IDP which was used to start a downstream session,
+// or returns an error. The resource UID must also match, so that a session which was started by a deleted IDP is not
+// mixed up with a new IDP of the same name.
+func FindUpstreamOIDCIdentityProviderOfSession(
+	idpLister UpstreamOIDCIdentityProvidersLister,
+	customSessionData *psession.CustomSessionData,
+) (provider.UpstreamOIDCIdentityProviderI, error) {
+	for _, p := range idpLister.GetOIDCIdentityProviders() {
+		if p.GetName() == customSessionData.ProviderName && p.GetResourceUID() == customSessionData.ProviderUID {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("could not find upstream OIDC provider named %q with resource UID %q",
+		customSessionData.ProviderName, customSessionData.ProviderUID)
+}
+
+// RevokeUpstreamOIDCTokens revokes the upstream OIDC tokens which are stored in a downstream session, in the same way
+// that the garbage collector does when it deletes an expired session. Sessions which were started by other types of
+// upstream IDPs, e.g. LDAP, do not hold any upstream tokens, so there is nothing to revoke for them.
+func RevokeUpstreamOIDCTokens(
+	ctx context.Context,
+	customSessionData *psession.CustomSessionData,
+	idpLister UpstreamOIDCIdentityProvidersLister,
+) error {
+	if customSessionData.ProviderType != psession.ProviderTypeOIDC || customSessionData.OIDC == nil {
+		return nil
+	}
+
+	upstreamOIDCIdentityProvider, err := FindUpstreamOIDCIdentityProviderOfSession(idpLister, customSessionData)
+	if err != nil {
+		return err
+	}
+
+	// In practice, there should only be one of these tokens saved in the session.
+	if upstreamRefreshToken := customSessionData.OIDC.UpstreamRefreshToken; upstreamRefreshToken != "" {
+		if err := upstreamOIDCIdentityProvider.RevokeToken(ctx, upstreamRefreshToken, provider.RefreshTokenType); err != nil {
+			return err
+		}
+		plog.Trace("successfully revoked upstream OIDC refresh token (or provider has no revocation endpoint)")
+	}
+
+	if upstreamAccessToken := customSessionData.OIDC.UpstreamAccessToken; upstreamAccessToken != "" {
+		if err := upstreamOIDCIdentityProvider.RevokeToken(ctx, upstreamAccessToken, provider.AccessTokenType); err != nil {
+			return err
+		}
+		plog.Trace("successfully revoked upstream OIDC access token (or provider has no revocation endpoint)")
 	}
-	return nil, nil, "", errors.New("provider not found")
+
+	return nil
 }
 
 // WriteAuthorizeError writes an authorization error as it should be returned by the authorization endpoint and other
@@ -427,6 +663,7 @@ func WriteAuthorizeError(r *http.Request, w http.ResponseWriter, oauthHelper fos
 	} else {
 		plog.Info("authorize response error", FositeErrorForLog(err)...)
 	}
+	recordFailureForMetrics(r.Context())
 	if isBrowserless {
 		w = rewriteStatusSeeOtherToStatusFoundForBrowserless(w)
 	}
@@ -445,6 +682,7 @@ func PerformAuthcodeRedirect(
 	openIDSession *psession.PinnipedSession,
 	isBrowserless bool,
 ) {
+	SetCorrelationID(openIDSession, authorizeRequester)
 	authorizeResponder, err := oauthHelper.NewAuthorizeResponse(r.Context(), authorizeRequester, openIDSession)
 	if err != nil {
 		plog.WarningErr("error while generating and saving authcode", err, "fositeErr", FositeErrorForLog(err))
@@ -1,10 +1,11 @@
-// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2022-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package oidcclientvalidator
 
 import (
 	"fmt"
+	"net/url"
 	"strings"
 
 	"golang.org/x/crypto/bcrypt"
@@ -18,28 +19,55 @@ import (
 const (
 	DefaultMinBcryptCost = 12
 
-	clientSecretExists     = "ClientSecretExists"
-	allowedGrantTypesValid = "AllowedGrantTypesValid"
-	allowedScopesValid     = "AllowedScopesValid"
+	clientSecretExists           = "ClientSecretExists"
+	noClientSecretExists         = "NoClientSecretExists"
+	allowedRedirectURIsValid     = "AllowedRedirectURIsValid"
+	allowedGrantTypesValid       = "AllowedGrantTypesValid"
+	allowedScopesValid           = "AllowedScopesValid"
+	tokenEndpointAuthMethodValid = "TokenEndpointAuthMethodValid"
 
 	reasonSuccess                  = "Success"
 	reasonMissingRequiredValue     = "MissingRequiredValue"
 	reasonNoClientSecretFound      = "NoClientSecretFound"
 	reasonInvalidClientSecretFound = "InvalidClientSecretFound"
+	reasonClientSecretFound        = "ClientSecretFound"
+	reasonInvalidRedirectURI       = "InvalidRedirectURI"
+	reasonInvalidClientAuthConfig  = "InvalidClientAuthenticationConfig"
 
-	allowedGrantTypesFieldName = "allowedGrantTypes"
-	allowedScopesFieldName     = "allowedScopes"
+	allowedRedirectURIsFieldName           = "allowedRedirectURIs"
+	allowedPostLogoutRedirectURIsFieldName = "allowedPostLogoutRedirectURIs"
+	allowedGrantTypesFieldName             = "allowedGrantTypes"
+	allowedScopesFieldName                 = "allowedScopes"
+	tokenEndpointAuthMethodFieldName       = "tokenEndpointAuthMethod"
+	jwksFieldName                          = "jwks"
+	tlsClientAuthFieldName                 = "tlsClientAuth"
+	clientCredentialsFieldName             = "clientCredentials"
+
+	// reservedKubernetesIdentityPrefix is the prefix which Kubernetes reserves for its own usernames and groups.
+	reservedKubernetesIdentityPrefix = "system:"
 )
 
 // Validate validates the OIDCClient and its corresponding client secret storage Secret.
 // When the corresponding client secret storage Secret was not found, pass nil to this function to
 // get the validation error for that case. It returns a bool to indicate if the client is valid,
 // along with a slice of conditions containing more details, and the list of client secrets in the
-// case that the client was valid.
+// case that the client was valid. Public clients, and clients which authenticate using asymmetric credentials
+// instead of client secrets, must not have any client secrets, so the list of client secrets is always empty for them.
 func Validate(oidcClient *v1alpha1.OIDCClient, secret *v1.Secret, minBcryptCost int) (bool, []*v1alpha1.Condition, []string) {
-	conds := make([]*v1alpha1.Condition, 0, 3)
+	conds := make([]*v1alpha1.Condition, 0, 5)
 
-	conds, clientSecrets := validateSecret(secret, conds, minBcryptCost)
+	var clientSecrets []string
+	switch {
+	case oidcClient.Spec.Public:
+		conds, clientSecrets = validateNoClientSecret(secret, "public clients", conds)
+	case usesClientSecret(oidcClient):
+		conds, clientSecrets = validateSecret(secret, conds, minBcryptCost)
+	default:
+		conds, clientSecrets = validateNoClientSecret(secret,
+			fmt.Sprintf("clients which use %q %q", tokenEndpointAuthMethodFieldName, oidcClient.Spec.TokenEndpointAuthMethod), conds)
+	}
+	conds = validateTokenEndpointAuthMethod(oidcClient, conds)
+	conds = validateAllowedRedirectURIs(oidcClient, conds)
 	conds = validateAllowedGrantTypes(oidcClient, conds)
 	conds = validateAllowedScopes(oidcClient, conds)
 
@@ -53,6 +81,67 @@ func Validate(oidcClient *v1alpha1.OIDCClient, secret *v1.Secret, minBcryptCost
 	return valid, conds, clientSecrets
 }
 
+// validateAllowedRedirectURIs checks if allowedRedirectURIs and allowedPostLogoutRedirectURIs are valid on the
+// OIDCClient. Only public clients may use private-use URI schemes, and public clients must not use https redirect
+// URIs, since any app on the user's device could claim those (see https://datatracker.ietf.org/doc/html/rfc8252).
+func validateAllowedRedirectURIs(oidcClient *v1alpha1.OIDCClient, conditions []*v1alpha1.Condition) []*v1alpha1.Condition {
+	m := make([]string, 0, len(oidcClient.Spec.AllowedRedirectURIs))
+
+	for _, uri := range oidcClient.Spec.AllowedRedirectURIs {
+		switch {
+		case !oidcClient.Spec.Public && isPrivateUseSchemeURI(string(uri)):
+			m = append(m, fmt.Sprintf("%q in %q uses a private-use URI scheme, which is only allowed for public clients",
+				uri, allowedRedirectURIsFieldName))
+		case oidcClient.Spec.Public && !isLoopbackHTTPURI(string(uri)) && !isPrivateUseSchemeURI(string(uri)):
+			m = append(m, fmt.Sprintf("%q in %q must use either the http scheme with the hostname 127.0.0.1 or ::1, or a private-use URI scheme, because the client is public",
+				uri, allowedRedirectURIsFieldName))
+		}
+	}
+	for _, uri := range oidcClient.Spec.AllowedPostLogoutRedirectURIs {
+		if !oidcClient.Spec.Public && isPrivateUseSchemeURI(string(uri)) {
+			m = append(m, fmt.Sprintf("%q in %q uses a private-use URI scheme, which is only allowed for public clients",
+				uri, allowedPostLogoutRedirectURIsFieldName))
+		}
+	}
+
+	if len(m) == 0 {
+		conditions = append(conditions, &v1alpha1.Condition{
+			Type:    allowedRedirectURIsValid,
+			Status:  v1alpha1.ConditionTrue,
+			Reason:  reasonSuccess,
+			Message: fmt.Sprintf("%q and %q are valid", allowedRedirectURIsFieldName, allowedPostLogoutRedirectURIsFieldName),
+		})
+	} else {
+		conditions = append(conditions, &v1alpha1.Condition{
+			Type:    allowedRedirectURIsValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  reasonInvalidRedirectURI,
+			Message: strings.Join(m, "; "),
+		})
+	}
+
+	return conditions
+}
+
+// isLoopbackHTTPURI returns whether the URI uses the http scheme with a loopback IP address as its hostname.
+func isLoopbackHTTPURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return false
+	}
+	return u.Scheme == "http" && (u.Hostname() == "127.0.0.1" || u.Hostname() == "::1")
+}
+
+// isPrivateUseSchemeURI returns whether the URI uses a private-use URI scheme, which is a reverse domain name,
+// as described in https://datatracker.ietf.org/doc/html/rfc8252#section-7.1.
+func isPrivateUseSchemeURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return false
+	}
+	return u.Scheme != "http" && u.Scheme != "https" && strings.Contains(u.Scheme, ".")
+}
+
 // validateAllowedScopes checks if allowedScopes is valid on the OIDCClient.
 func validateAllowedScopes(oidcClient *v1alpha1.OIDCClient, conditions []*v1alpha1.Condition) []*v1alpha1.Condition {
 	m := make([]string, 0, 4)
@@ -95,7 +184,7 @@ func validateAllowedScopes(oidcClient *v1alpha1.OIDCClient, conditions []*v1alph
 
 // validateAllowedGrantTypes checks if allowedGrantTypes is valid on the OIDCClient.
 func validateAllowedGrantTypes(oidcClient *v1alpha1.OIDCClient, conditions []*v1alpha1.Condition) []*v1alpha1.Condition {
-	m := make([]string, 0, 3)
+	m := make([]string, 0, 4)
 
 	if !allowedGrantTypesContains(oidcClient, oidcapi.GrantTypeAuthorizationCode) {
 		m = append(m, fmt.Sprintf("%q must always be included in %q",
@@ -109,6 +198,7 @@ func validateAllowedGrantTypes(oidcClient *v1alpha1.OIDCClient, conditions []*v1
 		m = append(m, fmt.Sprintf("%q must be included in %q when %q is included in %q",
 			oidcapi.GrantTypeTokenExchange, allowedGrantTypesFieldName, oidcapi.ScopeRequestAudience, allowedScopesFieldName))
 	}
+	m = append(m, clientCredentialsErrors(oidcClient)...)
 
 	if len(m) == 0 {
 		conditions = append(conditions, &v1alpha1.Condition{
@@ -129,6 +219,47 @@ func validateAllowedGrantTypes(oidcClient *v1alpha1.OIDCClient, conditions []*v1
 	return conditions
 }
 
+// clientCredentialsErrors checks that the identity for the client_credentials grant is provided exactly when the
+// grant is allowed. The grant authenticates only the client itself, so a public client must not be allowed to use it.
+// Anyone who can create an OIDCClient chooses this identity, so it must not claim to be a Kubernetes system identity.
+func clientCredentialsErrors(oidcClient *v1alpha1.OIDCClient) []string {
+	allowed := allowedGrantTypesContains(oidcClient, oidcapi.GrantTypeClientCredentials)
+
+	switch {
+	case allowed && oidcClient.Spec.Public:
+		return []string{fmt.Sprintf("%q must not be included in %q for public clients",
+			oidcapi.GrantTypeClientCredentials, allowedGrantTypesFieldName)}
+	case allowed && oidcClient.Spec.ClientCredentials == nil:
+		return []string{fmt.Sprintf("%q must be provided when %q is included in %q",
+			clientCredentialsFieldName, oidcapi.GrantTypeClientCredentials, allowedGrantTypesFieldName)}
+	case !allowed && oidcClient.Spec.ClientCredentials != nil:
+		return []string{fmt.Sprintf("%q must only be provided when %q is included in %q",
+			clientCredentialsFieldName, oidcapi.GrantTypeClientCredentials, allowedGrantTypesFieldName)}
+	case allowed:
+		return reservedClientCredentialsIdentityErrors(oidcClient.Spec.ClientCredentials)
+	default:
+		return nil
+	}
+}
+
+// reservedClientCredentialsIdentityErrors rejects usernames and group names which are reserved by Kubernetes
+// for its own system identities, such as the system:masters group.
+func reservedClientCredentialsIdentityErrors(clientCredentials *v1alpha1.OIDCClientCredentials) []string {
+	var m []string
+	if strings.HasPrefix(clientCredentials.Username, reservedKubernetesIdentityPrefix) {
+		m = append(m, fmt.Sprintf("%q must not start with %q",
+			clientCredentialsFieldName+".username", reservedKubernetesIdentityPrefix))
+	}
+	for _, group := range clientCredentials.Groups {
+		if strings.HasPrefix(group, reservedKubernetesIdentityPrefix) {
+			m = append(m, fmt.Sprintf("%q must not contain groups which start with %q",
+				clientCredentialsFieldName+".groups", reservedKubernetesIdentityPrefix))
+			break
+		}
+	}
+	return m
+}
+
 // validateSecret checks if the client secret storage Secret is valid and contains at least one client secret.
 // It returns the updated conditions slice along with the client secrets found in that case that it is valid.
 func validateSecret(secret *v1.Secret, conditions []*v1alpha1.Condition, minBcryptCost int) ([]*v1alpha1.Condition, []string) {
@@ -206,6 +337,50 @@ func validateSecret(secret *v1.Secret, conditions []*v1alpha1.Condition, minBcry
 	return conditions, storedClientSecrets
 }
 
+// validateNoClientSecret checks that the client secret storage Secret of a client which does not authenticate using
+// a client secret does not contain any client secrets. A public client cannot keep a client secret confidential, and a
+// client which authenticates using asymmetric credentials has no use for one, so neither should have one. The
+// kindOfClient describes the client in the condition messages. It returns the updated conditions slice along with an
+// empty list of client secrets.
+func validateNoClientSecret(secret *v1.Secret, kindOfClient string, conditions []*v1alpha1.Condition) ([]*v1alpha1.Condition, []string) {
+	emptyList := []string{}
+
+	if secret != nil {
+		storedClientSecrets, err := oidcclientsecretstorage.ReadFromSecret(secret)
+		if err != nil {
+			// Invalid: storage Secret exists but its data could not be parsed, so it might contain client secrets.
+			conditions = append(conditions, &v1alpha1.Condition{
+				Type:    noClientSecretExists,
+				Status:  v1alpha1.ConditionFalse,
+				Reason:  reasonInvalidClientSecretFound,
+				Message: fmt.Sprintf("error reading client secret storage: %s", err.Error()),
+			})
+			return conditions, emptyList
+		}
+
+		if len(storedClientSecrets) > 0 {
+			// Invalid: public clients must not have client secrets.
+			conditions = append(conditions, &v1alpha1.Condition{
+				Type:   noClientSecretExists,
+				Status: v1alpha1.ConditionFalse,
+				Reason: reasonClientSecretFound,
+				Message: fmt.Sprintf("%d client secret(s) found, but %s must not have client secrets",
+					len(storedClientSecrets), kindOfClient),
+			})
+			return conditions, emptyList
+		}
+	}
+
+	// Valid: the public client has no client secrets.
+	conditions = append(conditions, &v1alpha1.Condition{
+		Type:    noClientSecretExists,
+		Status:  v1alpha1.ConditionTrue,
+		Reason:  reasonSuccess,
+		Message: fmt.Sprintf("no client secret found, as required for %s", kindOfClient),
+	})
+	return conditions, emptyList
+}
+
 func allowedGrantTypesContains(haystack *v1alpha1.OIDCClient, needle string) bool {
 	for _, hay := range haystack.Spec.AllowedGrantTypes {
 		if hay == v1alpha1.GrantType(needle) {
@@ -0,0 +1,199 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package oidcclientvalidator
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+	"gopkg.in/square/go-jose.v2"
+
+	"go.pinniped.dev/generated/latest/apis/supervisor/config/v1alpha1"
+)
+
+const (
+	TokenEndpointAuthMethodClientSecretBasic = "client_secret_basic"
+	TokenEndpointAuthMethodPrivateKeyJWT     = "private_key_jwt"
+	TokenEndpointAuthMethodTLSClientAuth     = "tls_client_auth"
+)
+
+// ClientAssertionSigningAlgorithms are the algorithms which clients may use to sign their client assertion JWTs
+// for the private_key_jwt token endpoint authentication method.
+var ClientAssertionSigningAlgorithms = []string{ //nolint:gochecknoglobals
+	"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512",
+}
+
+// usesClientSecret returns whether the confidential OIDCClient authenticates to the token endpoint using a client secret.
+func usesClientSecret(oidcClient *v1alpha1.OIDCClient) bool {
+	method := oidcClient.Spec.TokenEndpointAuthMethod
+	return method == "" || method == TokenEndpointAuthMethodClientSecretBasic
+}
+
+// validateTokenEndpointAuthMethod checks if tokenEndpointAuthMethod is valid on the OIDCClient, along with the jwks
+// and tlsClientAuth settings which are used by some of the methods.
+func validateTokenEndpointAuthMethod(oidcClient *v1alpha1.OIDCClient, conditions []*v1alpha1.Condition) []*v1alpha1.Condition {
+	m := make([]string, 0)
+
+	method := oidcClient.Spec.TokenEndpointAuthMethod
+	jwks := oidcClient.Spec.JWKS
+	tlsClientAuth := oidcClient.Spec.TLSClientAuth
+
+	if oidcClient.Spec.Public && method != "" {
+		m = append(m, fmt.Sprintf("%q must not be provided for public clients", tokenEndpointAuthMethodFieldName))
+	}
+
+	if method == TokenEndpointAuthMethodPrivateKeyJWT {
+		if jwks == nil {
+			m = append(m, fmt.Sprintf("%q must be provided when %q is %q",
+				jwksFieldName, tokenEndpointAuthMethodFieldName, TokenEndpointAuthMethodPrivateKeyJWT))
+		} else {
+			m = append(m, validateJWKS(jwks)...)
+		}
+	} else if jwks != nil {
+		m = append(m, fmt.Sprintf("%q must only be provided when %q is %q",
+			jwksFieldName, tokenEndpointAuthMethodFieldName, TokenEndpointAuthMethodPrivateKeyJWT))
+	}
+
+	if method == TokenEndpointAuthMethodTLSClientAuth {
+		if tlsClientAuth == nil {
+			m = append(m, fmt.Sprintf("%q must be provided when %q is %q",
+				tlsClientAuthFieldName, tokenEndpointAuthMethodFieldName, TokenEndpointAuthMethodTLSClientAuth))
+		} else {
+			m = append(m, validateTLSClientAuth(tlsClientAuth)...)
+		}
+	} else if tlsClientAuth != nil {
+		m = append(m, fmt.Sprintf("%q must only be provided when %q is %q",
+			tlsClientAuthFieldName, tokenEndpointAuthMethodFieldName, TokenEndpointAuthMethodTLSClientAuth))
+	}
+
+	if len(m) == 0 {
+		conditions = append(conditions, &v1alpha1.Condition{
+			Type:    tokenEndpointAuthMethodValid,
+			Status:  v1alpha1.ConditionTrue,
+			Reason:  reasonSuccess,
+			Message: fmt.Sprintf("%q is valid", tokenEndpointAuthMethodFieldName),
+		})
+	} else {
+		conditions = append(conditions, &v1alpha1.Condition{
+			Type:    tokenEndpointAuthMethodValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  reasonInvalidClientAuthConfig,
+			Message: strings.Join(m, "; "),
+		})
+	}
+
+	return conditions
+}
+
+// validateJWKS returns a list of problems with the jwks of an OIDCClient, which is empty when the jwks is valid.
+func validateJWKS(jwks *v1alpha1.OIDCClientJWKS) []string {
+	if (jwks.Inline == "") == (jwks.URL == "") {
+		return []string{fmt.Sprintf("exactly one of %q or %q must be provided", jwksFieldName+".inline", jwksFieldName+".url")}
+	}
+	if jwks.Inline == "" {
+		// The document at the URL is fetched when it is needed, so it cannot be validated here.
+		return nil
+	}
+	if _, err := ParseJWKS(jwks.Inline); err != nil {
+		return []string{fmt.Sprintf("%q is invalid: %s", jwksFieldName+".inline", err.Error())}
+	}
+	return nil
+}
+
+// validateTLSClientAuth returns a list of problems with the tlsClientAuth of an OIDCClient, which is empty when it
+// is valid. Like the client metadata of RFC 8705 section 2.1.2, it must identify the client's certificate by exactly
+// one subject distinguished name or subject alternative name.
+func validateTLSClientAuth(tlsClientAuth *v1alpha1.OIDCClientTLSClientAuth) []string {
+	var m []string
+	if _, err := ParseCertificateAuthorityData(tlsClientAuth.CertificateAuthorityData); err != nil {
+		m = append(m, fmt.Sprintf("%q is invalid: %s", tlsClientAuthFieldName+".certificateAuthorityData", err.Error()))
+	}
+
+	identities := 0
+	for _, value := range []string{
+		tlsClientAuth.SubjectDN, tlsClientAuth.SANDNS, tlsClientAuth.SANURI, tlsClientAuth.SANIP, tlsClientAuth.SANEmail,
+	} {
+		if value != "" {
+			identities++
+		}
+	}
+	if identities != 1 {
+		m = append(m, fmt.Sprintf("exactly one of %q, %q, %q, %q, or %q must be provided",
+			tlsClientAuthFieldName+".subjectDN", tlsClientAuthFieldName+".sanDNS", tlsClientAuthFieldName+".sanURI",
+			tlsClientAuthFieldName+".sanIP", tlsClientAuthFieldName+".sanEmail"))
+	}
+
+	if tlsClientAuth.SubjectDN != "" {
+		if _, err := ParseSubjectDN(tlsClientAuth.SubjectDN); err != nil {
+			m = append(m, fmt.Sprintf("%q is invalid: %s", tlsClientAuthFieldName+".subjectDN", err.Error()))
+		}
+	}
+	if tlsClientAuth.SANURI != "" {
+		if u, err := url.Parse(tlsClientAuth.SANURI); err != nil || !u.IsAbs() {
+			m = append(m, fmt.Sprintf("%q is invalid: must be an absolute URI", tlsClientAuthFieldName+".sanURI"))
+		}
+	}
+	if tlsClientAuth.SANIP != "" && net.ParseIP(tlsClientAuth.SANIP) == nil {
+		m = append(m, fmt.Sprintf("%q is invalid: must be an IPv4 or IPv6 address", tlsClientAuthFieldName+".sanIP"))
+	}
+	return m
+}
+
+// ParseSubjectDN parses the subjectDN of the tlsClientAuth of an OIDCClient as an RFC 4514 distinguished name.
+func ParseSubjectDN(subjectDN string) (*ldap.DN, error) {
+	dn, err := ldap.ParseDN(subjectDN)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse distinguished name: %w", err)
+	}
+	if len(dn.RDNs) == 0 {
+		return nil, fmt.Errorf("distinguished name is empty")
+	}
+	return dn, nil
+}
+
+// ParseJWKS parses the inline JSON Web Key Set of an OIDCClient. The key set must contain at least one public key
+// which can be used to verify signatures, and it must not contain any private or symmetric keys.
+func ParseJWKS(inline string) (*jose.JSONWebKeySet, error) {
+	var jwks jose.JSONWebKeySet
+	if err := json.Unmarshal([]byte(inline), &jwks); err != nil {
+		return nil, fmt.Errorf("could not parse JSON Web Key Set: %w", err)
+	}
+
+	signingKeys := 0
+	for i, key := range jwks.Keys {
+		if !key.IsPublic() {
+			return nil, fmt.Errorf("key at index %d is not a public key", i)
+		}
+		if key.Use == "sig" {
+			signingKeys++
+		}
+	}
+	if signingKeys == 0 {
+		return nil, fmt.Errorf(`no public keys with "use": "sig" found`)
+	}
+
+	return &jwks, nil
+}
+
+// ParseCertificateAuthorityData parses the base64-encoded PEM bundle of Certificate Authorities which issue the TLS
+// client certificates of an OIDCClient.
+func ParseCertificateAuthorityData(certificateAuthorityData string) (*x509.CertPool, error) {
+	pemBytes, err := base64.StdEncoding.DecodeString(certificateAuthorityData)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode base64: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pemBytes) {
+		return nil, fmt.Errorf("no certificates found")
+	}
+
+	return pool, nil
+}
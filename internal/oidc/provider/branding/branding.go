@@ -0,0 +1,204 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package branding validates the customizations of the Supervisor's web pages which a FederationDomain can
+// configure, and prepares them for rendering by the page templates.
+package branding
+
+import (
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"k8s.io/utils/strings/slices"
+
+	"go.pinniped.dev/internal/oidc/provider/csp"
+)
+
+// The keys of the ConfigMap which configures the branding of a FederationDomain.
+const (
+	TitleKey           = "title"
+	LogoKey            = "logo"
+	PrimaryColorKey    = "primaryColor"
+	BackgroundColorKey = "backgroundColor"
+	HelpURLKey         = "helpURL"
+	HelpTextKey        = "helpText"
+	LegalBannerKey     = "legalBanner"
+)
+
+const (
+	maxTitleLength       = 100
+	maxHelpTextLength    = 100
+	maxLegalBannerLength = 4096
+	maxLogoSize          = 64 * 1024
+
+	defaultHelpText = "Need help logging in?"
+)
+
+//nolint:gochecknoglobals // These are effectively constants.
+var (
+	colorRegexp = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+	// The logo is embedded into the pages as a data URL, so only image formats which cannot contain scripts are allowed.
+	allowedLogoContentTypes = []string{"image/png", "image/jpeg", "image/gif", "image/webp"}
+)
+
+// Branding is the validated branding of a FederationDomain. Its exported fields are used by the page templates,
+// so each may be empty when it was not configured.
+type Branding struct {
+	// Title is shown at the top of each page and used as the title of the login page.
+	Title string
+	// Logo is a data URL of the image which is shown at the top of each page.
+	Logo template.URL
+	// HelpURL is the https URL of a page where users can get help with logging in.
+	HelpURL string
+	// HelpText is the text of the link to the HelpURL.
+	HelpText string
+	// LegalBanner is text, such as an acceptable use policy, which is shown at the bottom of each page.
+	LegalBanner string
+
+	css     string
+	cssHash string
+}
+
+// None returns nil, which means that the Supervisor's web pages are not branded. It can be used as the branding
+// getter of the page handlers for FederationDomains which do not configure any branding.
+func None() *Branding { return nil }
+
+// FromConfigMapData validates the data of a branding ConfigMap and returns the resulting Branding. Unknown keys are
+// rejected to catch typos, since an unnoticed typo would silently leave part of the branding unconfigured.
+func FromConfigMapData(data map[string]string, binaryData map[string][]byte) (*Branding, error) {
+	for key := range data {
+		switch key {
+		case TitleKey, PrimaryColorKey, BackgroundColorKey, HelpURLKey, HelpTextKey, LegalBannerKey:
+		default:
+			return nil, fmt.Errorf("unknown key %q in data", key)
+		}
+	}
+	for key := range binaryData {
+		if key != LogoKey {
+			return nil, fmt.Errorf("unknown key %q in binaryData", key)
+		}
+	}
+
+	b := &Branding{
+		Title:       strings.TrimSpace(data[TitleKey]),
+		HelpURL:     data[HelpURLKey],
+		HelpText:    strings.TrimSpace(data[HelpTextKey]),
+		LegalBanner: strings.TrimSpace(data[LegalBannerKey]),
+	}
+
+	if err := validateLength(TitleKey, b.Title, maxTitleLength); err != nil {
+		return nil, err
+	}
+	if err := validateLength(HelpTextKey, b.HelpText, maxHelpTextLength); err != nil {
+		return nil, err
+	}
+	if err := validateLength(LegalBannerKey, b.LegalBanner, maxLegalBannerLength); err != nil {
+		return nil, err
+	}
+
+	if b.HelpURL != "" {
+		if err := validateHelpURL(b.HelpURL); err != nil {
+			return nil, err
+		}
+		if b.HelpText == "" {
+			b.HelpText = defaultHelpText
+		}
+	} else if b.HelpText != "" {
+		return nil, fmt.Errorf("%q requires %q", HelpTextKey, HelpURLKey)
+	}
+
+	if logo, ok := binaryData[LogoKey]; ok {
+		logoURL, err := logoDataURL(logo)
+		if err != nil {
+			return nil, err
+		}
+		b.Logo = logoURL
+	}
+
+	// The colors are inserted into the CSS, so they must be validated strictly.
+	var cssVariables []string
+	for _, color := range []struct{ key, variable string }{
+		{key: PrimaryColorKey, variable: "--primary-color"},
+		{key: BackgroundColorKey, variable: "--background-color"},
+	} {
+		value, ok := data[color.key]
+		if !ok {
+			continue
+		}
+		if !colorRegexp.MatchString(value) {
+			return nil, fmt.Errorf("%q must be a color in the format #rrggbb", color.key)
+		}
+		cssVariables = append(cssVariables, color.variable+":"+strings.ToLower(value))
+	}
+	sort.Strings(cssVariables)
+	b.css = ":root{" + strings.Join(cssVariables, ";") + "}"
+	b.cssHash = csp.Hash(b.css)
+
+	return b, nil
+}
+
+func validateLength(key string, value string, maxLength int) error {
+	if !utf8.ValidString(value) {
+		return fmt.Errorf("%q must be valid UTF-8", key)
+	}
+	if utf8.RuneCountInString(value) > maxLength {
+		return fmt.Errorf("%q must be at most %d characters", key, maxLength)
+	}
+	return nil
+}
+
+func validateHelpURL(helpURL string) error {
+	parsed, err := url.Parse(helpURL)
+	if err != nil {
+		return fmt.Errorf("%q is not a valid URL: %w", HelpURLKey, err)
+	}
+	if parsed.Scheme != "https" || parsed.Host == "" {
+		return fmt.Errorf("%q must be an absolute https URL", HelpURLKey)
+	}
+	if parsed.User != nil {
+		return fmt.Errorf("%q must not have username or password", HelpURLKey)
+	}
+	return nil
+}
+
+func logoDataURL(logo []byte) (template.URL, error) {
+	if len(logo) == 0 {
+		return "", fmt.Errorf("%q must not be empty", LogoKey)
+	}
+	if len(logo) > maxLogoSize {
+		return "", fmt.Errorf("%q must be at most %d bytes", LogoKey, maxLogoSize)
+	}
+	contentType := http.DetectContentType(logo)
+	if !slices.Contains(allowedLogoContentTypes, contentType) {
+		return "", fmt.Errorf("%q must be a PNG, JPEG, GIF, or WebP image, but it looks like %q", LogoKey, contentType)
+	}
+	//nolint:gosec // The content type was detected from the bytes and the data is base64 encoded, so the URL is safe.
+	return template.URL("data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(logo)), nil
+}
+
+// CSS returns the CSS which sets the variables used by the stylesheets of the page templates.
+func (b *Branding) CSS() template.CSS {
+	return template.CSS(b.css) //nolint:gosec // This is built only from validated colors.
+}
+
+// StyleSrc returns the Content-Security-Policy source which allows the CSS of the branding.
+func (b *Branding) StyleSrc() string {
+	return "'" + b.cssHash + "'"
+}
+
+// PageTitle returns the title of the branding, or the given default title when there is no title. It may be called
+// on a nil Branding, so the page templates can use it whether or not the page is branded.
+func (b *Branding) PageTitle(defaultTitle string) string {
+	if b == nil || b.Title == "" {
+		return defaultTitle
+	}
+	return b.Title
+}
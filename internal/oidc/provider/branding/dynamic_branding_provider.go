@@ -0,0 +1,35 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package branding
+
+import "sync"
+
+type DynamicBrandingProvider interface {
+	SetIssuerToBrandingMap(issuerToBrandingMap map[string]*Branding)
+	// GetBranding returns the branding of the given issuer, or nil when the issuer's pages are not branded.
+	GetBranding(issuerName string) *Branding
+}
+
+type dynamicBrandingProvider struct {
+	issuerToBrandingMap map[string]*Branding
+	mutex               sync.RWMutex
+}
+
+func NewDynamicBrandingProvider() DynamicBrandingProvider {
+	return &dynamicBrandingProvider{
+		issuerToBrandingMap: map[string]*Branding{},
+	}
+}
+
+func (p *dynamicBrandingProvider) SetIssuerToBrandingMap(issuerToBrandingMap map[string]*Branding) {
+	p.mutex.Lock() // acquire a write lock
+	defer p.mutex.Unlock()
+	p.issuerToBrandingMap = issuerToBrandingMap
+}
+
+func (p *dynamicBrandingProvider) GetBranding(issuerName string) *Branding {
+	p.mutex.RLock() // acquire a read lock
+	defer p.mutex.RUnlock()
+	return p.issuerToBrandingMap[issuerName]
+}
@@ -1,4 +1,4 @@
-// Copyright 2020-2023 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package provider
@@ -8,11 +8,13 @@ import (
 	"fmt"
 	"net/url"
 	"sync"
+	"time"
 
 	"golang.org/x/oauth2"
 	"k8s.io/apimachinery/pkg/types"
 
 	"go.pinniped.dev/internal/authenticators"
+	"go.pinniped.dev/internal/constable"
 	"go.pinniped.dev/pkg/oidcclient/nonce"
 	"go.pinniped.dev/pkg/oidcclient/oidctypes"
 	"go.pinniped.dev/pkg/oidcclient/pkce"
@@ -43,6 +45,11 @@ type UpstreamOIDCIdentityProviderI interface {
 	// HasUserInfoURL returns whether there is a non-empty value for userinfo_endpoint fetched from discovery.
 	HasUserInfoURL() bool
 
+	// GetEndSessionURL returns the end_session_endpoint fetched from discovery when the upstream session should be
+	// ended during RP-initiated logout. It returns nil when the upstream session should not be ended, or when the
+	// provider does not offer an end_session_endpoint.
+	GetEndSessionURL() *url.URL
+
 	// GetScopes returns the scopes to request in authorization (authcode or password grant) flow.
 	GetScopes() []string
 
@@ -114,6 +121,94 @@ type UpstreamLDAPIdentityProviderI interface {
 	PerformRefresh(ctx context.Context, storedRefreshAttributes RefreshAttributes) (groups []string, err error)
 }
 
+type UpstreamSAMLIdentityProviderI interface {
+	// GetName returns a name for this upstream provider.
+	GetName() string
+
+	// GetResourceUID returns the Kubernetes resource ID
+	GetResourceUID() types.UID
+
+	// GetEntityID returns the entity ID of the upstream provider, fetched from its metadata. Together with the NameID
+	// of a user, it creates a globally unique user identifier, since NameIDs are only unique within one provider.
+	GetEntityID() string
+
+	// GetUsernameAttribute returns the name of the assertion attribute which holds the username. May return empty
+	// string, in which case the NameID of the subject of the assertion will be used as the username.
+	GetUsernameAttribute() string
+
+	// GetGroupsAttribute returns the name of the assertion attribute which holds the group names. May return empty
+	// string, in which case we won't try to read groups from the assertion.
+	GetGroupsAttribute() string
+
+	// AuthnRequestURL returns the URL of the single sign-on service of the upstream provider, which carries an
+	// AuthnRequest with the given ID from the given service provider and the given RelayState, as specified by the
+	// HTTP-Redirect binding.
+	AuthnRequestURL(sp SAMLServiceProvider, requestID string, relayState string) (*url.URL, error)
+
+	// ValidateResponse validates the base64-encoded SAMLResponse which was posted to the assertion consumer service
+	// of the given service provider in response to the AuthnRequest with the given ID. It returns the content of the
+	// validated assertion.
+	ValidateResponse(sp SAMLServiceProvider, samlResponse string, requestID string) (*SAMLAssertion, error)
+}
+
+// SAMLServiceProvider describes the Supervisor acting as a SAML service provider on behalf of a FederationDomain.
+type SAMLServiceProvider struct {
+	// EntityID is the entity ID of the service provider, which is also the URL of its metadata.
+	EntityID string
+
+	// ACSURL is the URL of the assertion consumer service of the service provider.
+	ACSURL string
+}
+
+// SAMLAssertion contains the information about the user from a validated SAML assertion.
+type SAMLAssertion struct {
+	NameID              string
+	Attributes          map[string][]string
+	SessionNotOnOrAfter *time.Time
+
+	// ID is the ID of the assertion, and NotOnOrAfter is the time after which the assertion is no longer
+	// accepted. The assertion must be remembered until then to prevent it from being used twice.
+	ID           string
+	NotOnOrAfter time.Time
+}
+
+type UpstreamGitHubIdentityProviderI interface {
+	// GetName returns a name for this upstream provider.
+	GetName() string
+
+	// GetResourceUID returns the Kubernetes resource ID
+	GetResourceUID() types.UID
+
+	// GetClientID returns the OAuth client ID registered with the upstream provider to be used in the authorization code flow.
+	GetClientID() string
+
+	// GetAuthorizationURL returns the authorization endpoint of the GitHub server, to which the user's browser is
+	// redirected to start an OAuth 2.0 web application flow.
+	GetAuthorizationURL() string
+
+	// GetScopes returns the scopes to request in the authorization code flow.
+	GetScopes() []string
+
+	// ExchangeAuthcode performs an upstream GitHub authorization code exchange and returns the user's access token.
+	ExchangeAuthcode(ctx context.Context, authcode string, redirectURI string) (string, error)
+
+	// GetUser uses the given access token to look up the user and their organization and team memberships
+	// using the GitHub REST API. It returns ErrGitHubUserNotInAllowedOrganizations when the user is not a member
+	// of any of the organizations which are allowed to authenticate.
+	GetUser(ctx context.Context, accessToken string) (*GitHubUser, error)
+}
+
+// GitHubUser contains the identity of a user of an upstream GitHub provider, mapped according to its configuration.
+type GitHubUser struct {
+	Username          string
+	Groups            []string
+	DownstreamSubject string
+}
+
+// ErrGitHubUserNotInAllowedOrganizations is returned when a GitHub user is not allowed to authenticate because
+// of their organization memberships.
+const ErrGitHubUserNotInAllowedOrganizations = constable.Error("user is not a member of any of the allowed GitHub organizations")
+
 // RefreshAttributes contains information about the user from the original login request
 // and previous refreshes.
 type RefreshAttributes struct {
@@ -132,12 +227,18 @@ type DynamicUpstreamIDPProvider interface {
 	GetLDAPIdentityProviders() []UpstreamLDAPIdentityProviderI
 	SetActiveDirectoryIdentityProviders(adIDPs []UpstreamLDAPIdentityProviderI)
 	GetActiveDirectoryIdentityProviders() []UpstreamLDAPIdentityProviderI
+	SetSAMLIdentityProviders(samlIDPs []UpstreamSAMLIdentityProviderI)
+	GetSAMLIdentityProviders() []UpstreamSAMLIdentityProviderI
+	SetGitHubIdentityProviders(gitHubIDPs []UpstreamGitHubIdentityProviderI)
+	GetGitHubIdentityProviders() []UpstreamGitHubIdentityProviderI
 }
 
 type dynamicUpstreamIDPProvider struct {
 	oidcUpstreams            []UpstreamOIDCIdentityProviderI
 	ldapUpstreams            []UpstreamLDAPIdentityProviderI
 	activeDirectoryUpstreams []UpstreamLDAPIdentityProviderI
+	samlUpstreams            []UpstreamSAMLIdentityProviderI
+	gitHubUpstreams          []UpstreamGitHubIdentityProviderI
 	mutex                    sync.RWMutex
 }
 
@@ -146,6 +247,8 @@ func NewDynamicUpstreamIDPProvider() DynamicUpstreamIDPProvider {
 		oidcUpstreams:            []UpstreamOIDCIdentityProviderI{},
 		ldapUpstreams:            []UpstreamLDAPIdentityProviderI{},
 		activeDirectoryUpstreams: []UpstreamLDAPIdentityProviderI{},
+		samlUpstreams:            []UpstreamSAMLIdentityProviderI{},
+		gitHubUpstreams:          []UpstreamGitHubIdentityProviderI{},
 	}
 }
 
@@ -185,6 +288,30 @@ func (p *dynamicUpstreamIDPProvider) GetActiveDirectoryIdentityProviders() []Ups
 	return p.activeDirectoryUpstreams
 }
 
+func (p *dynamicUpstreamIDPProvider) SetSAMLIdentityProviders(samlIDPs []UpstreamSAMLIdentityProviderI) {
+	p.mutex.Lock() // acquire a write lock
+	defer p.mutex.Unlock()
+	p.samlUpstreams = samlIDPs
+}
+
+func (p *dynamicUpstreamIDPProvider) GetSAMLIdentityProviders() []UpstreamSAMLIdentityProviderI {
+	p.mutex.RLock() // acquire a read lock
+	defer p.mutex.RUnlock()
+	return p.samlUpstreams
+}
+
+func (p *dynamicUpstreamIDPProvider) SetGitHubIdentityProviders(gitHubIDPs []UpstreamGitHubIdentityProviderI) {
+	p.mutex.Lock() // acquire a write lock
+	defer p.mutex.Unlock()
+	p.gitHubUpstreams = gitHubIDPs
+}
+
+func (p *dynamicUpstreamIDPProvider) GetGitHubIdentityProviders() []UpstreamGitHubIdentityProviderI {
+	p.mutex.RLock() // acquire a read lock
+	defer p.mutex.RUnlock()
+	return p.gitHubUpstreams
+}
+
 type RetryableRevocationError struct {
 	wrapped error
 }
@@ -1,4 +1,4 @@
-// Copyright 2020 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package provider
@@ -7,20 +7,82 @@ import (
 	"fmt"
 	"net/url"
 	"strings"
+	"time"
 
+	"go.pinniped.dev/generated/latest/apis/supervisor/idpdiscovery/v1alpha1"
 	"go.pinniped.dev/internal/constable"
+	"go.pinniped.dev/internal/idtransform"
 )
 
+// FederationDomainIdentityProvider represents an identity provider as configured in a FederationDomain's spec.
+// The referenced upstream identity provider may or may not currently exist, since identity providers can be
+// created or deleted at any time.
+type FederationDomainIdentityProvider struct {
+	// Name is the name of the referenced upstream identity provider resource.
+	Name string
+	// Type is the type of the referenced upstream identity provider resource.
+	Type v1alpha1.IDPType
+	// Transforms is the pipeline of identity transformations and policies which are applied to the identities of
+	// users of this identity provider in this FederationDomain. It may be nil when there are no transformations.
+	Transforms *idtransform.TransformationPipeline
+}
+
+// FederationDomainTokenLifetimes represents the token lifetimes as configured in a FederationDomain's spec.
+// Each zero value means that the default lifetime should be used. A zero MaxSession means that sessions
+// have no maximum length.
+type FederationDomainTokenLifetimes struct {
+	AccessToken  time.Duration
+	IDToken      time.Duration
+	RefreshToken time.Duration
+	MaxSession   time.Duration
+}
+
+// DefaultIDTokenSigningAlgorithm is the algorithm used to sign ID tokens when a FederationDomain does not
+// configure any ID token signing algorithms.
+const DefaultIDTokenSigningAlgorithm = "ES256"
+
 // FederationDomainIssuer represents all of the settings and state for a downstream OIDC provider
 // as defined by a FederationDomain.
 type FederationDomainIssuer struct {
 	issuer     string
 	issuerHost string
 	issuerPath string
+
+	// identityProviders is the list of identity providers which are allowed by the FederationDomain.
+	// When empty, all upstream identity providers are allowed.
+	identityProviders []*FederationDomainIdentityProvider
+
+	// tokenLifetimes are the token lifetimes configured by the FederationDomain. When nil, the defaults are used.
+	tokenLifetimes *FederationDomainTokenLifetimes
+
+	// idTokenSigningAlgorithms are the ID token signing algorithms configured by the FederationDomain, with the
+	// default algorithm first. When empty, only the DefaultIDTokenSigningAlgorithm is used.
+	idTokenSigningAlgorithms []string
+
+	// clientCredentialsTransforms is the pipeline of identity transformations and policies which are applied to the
+	// identities of clients which use the client_credentials grant. It may be nil when there are no transformations.
+	clientCredentialsTransforms *idtransform.TransformationPipeline
 }
 
-func NewFederationDomainIssuer(issuer string) (*FederationDomainIssuer, error) {
-	p := FederationDomainIssuer{issuer: issuer}
+// NewFederationDomainIssuer returns a FederationDomainIssuer for the given issuer string, or an error if the issuer
+// is not valid. The identityProviders list may be empty, which means that all upstream identity providers are allowed.
+// The tokenLifetimes may be nil, which means that the default token lifetimes are used. The idTokenSigningAlgorithms
+// may be empty, which means that only the DefaultIDTokenSigningAlgorithm is used. The clientCredentialsTransforms
+// may be nil, which means that the identities of clients which use the client_credentials grant are not transformed.
+func NewFederationDomainIssuer(
+	issuer string,
+	identityProviders []*FederationDomainIdentityProvider,
+	tokenLifetimes *FederationDomainTokenLifetimes,
+	idTokenSigningAlgorithms []string,
+	clientCredentialsTransforms *idtransform.TransformationPipeline,
+) (*FederationDomainIssuer, error) {
+	p := FederationDomainIssuer{
+		issuer:                      issuer,
+		identityProviders:           identityProviders,
+		tokenLifetimes:              tokenLifetimes,
+		idTokenSigningAlgorithms:    idTokenSigningAlgorithms,
+		clientCredentialsTransforms: clientCredentialsTransforms,
+	}
 	err := p.validate()
 	if err != nil {
 		return nil, err
@@ -75,3 +137,30 @@ func (p *FederationDomainIssuer) IssuerHost() string {
 func (p *FederationDomainIssuer) IssuerPath() string {
 	return p.issuerPath
 }
+
+// IdentityProviders returns the identity providers which were configured on the FederationDomain.
+// When empty, all upstream identity providers should be made available by this FederationDomain.
+func (p *FederationDomainIssuer) IdentityProviders() []*FederationDomainIdentityProvider {
+	return p.identityProviders
+}
+
+// TokenLifetimes returns the token lifetimes which were configured on the FederationDomain.
+// When nil, the default token lifetimes should be used.
+func (p *FederationDomainIssuer) TokenLifetimes() *FederationDomainTokenLifetimes {
+	return p.tokenLifetimes
+}
+
+// IDTokenSigningAlgorithms returns the algorithms which the FederationDomain uses to sign ID tokens. The first
+// algorithm is used for clients which do not ask for a specific algorithm. It is never empty.
+func (p *FederationDomainIssuer) IDTokenSigningAlgorithms() []string {
+	if len(p.idTokenSigningAlgorithms) == 0 {
+		return []string{DefaultIDTokenSigningAlgorithm}
+	}
+	return p.idTokenSigningAlgorithms
+}
+
+// ClientCredentialsTransforms returns the identity transformations and policies which were configured on the
+// FederationDomain for clients which use the client_credentials grant. It may be nil.
+func (p *FederationDomainIssuer) ClientCredentialsTransforms() *idtransform.TransformationPipeline {
+	return p.clientCredentialsTransforms
+}
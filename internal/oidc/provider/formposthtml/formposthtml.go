@@ -1,4 +1,4 @@
-// Copyright 2021-2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2021-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 // Package formposthtml defines HTML templates used by the Supervisor.
@@ -11,6 +11,7 @@ import (
 
 	"github.com/tdewolff/minify/v2/minify"
 
+	"go.pinniped.dev/internal/oidc/provider/branding"
 	"go.pinniped.dev/internal/oidc/provider/csp"
 )
 
@@ -27,12 +28,18 @@ var (
 	//go:embed form_post.gohtml
 	rawHTMLTemplate string
 
-	// Parse the Go templated HTML and inject functions providing the minified inline CSS and JS.
+	// Parse the Go templated HTML and inject functions providing the minified inline CSS and JS. The branding function
+	// is replaced by TemplateWithBranding, because Fosite renders this template without any other way to pass it in.
 	parsedHTMLTemplate = template.Must(template.New("form_post.gohtml").Funcs(template.FuncMap{
 		"minifiedCSS": func() template.CSS { return template.CSS(minifiedCSS) },
 		"minifiedJS":  func() template.JS { return template.JS(minifiedJS) }, //nolint:gosec // This is 100% static input, not attacker-controlled.
+		"branding":    branding.None,
 	}).Parse(rawHTMLTemplate))
 
+	// The template without branding. Templates cannot be cloned after they were executed, so the parsed template is
+	// never executed itself.
+	unbrandedHTMLTemplate = TemplateWithBranding(branding.None)
+
 	// Generate the CSP header value once since it's effectively constant.
 	cspValue = strings.Join([]string{
 		`default-src 'none'`,
@@ -56,5 +63,28 @@ func panicOnError(s string, err error) string {
 // See https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Content-Security-Policy.
 func ContentSecurityPolicy() string { return cspValue }
 
+// ContentSecurityPolicyWithBranding returns the Content-Security-Policy header value to make the template returned by
+// TemplateWithBranding() operate correctly when it renders the given branding, which may be nil. It additionally
+// allows only the CSS of the branding.
+func ContentSecurityPolicyWithBranding(b *branding.Branding) string {
+	if b == nil {
+		return cspValue
+	}
+	return strings.Join([]string{
+		`default-src 'none'`,
+		`script-src '` + csp.Hash(minifiedJS) + `'`,
+		`style-src '` + csp.Hash(minifiedCSS) + `' ` + b.StyleSrc(),
+		`img-src data:`,
+		`connect-src *`,
+		`frame-ancestors 'none'`,
+	}, "; ")
+}
+
 // Template returns the html/template.Template for rendering the response_type=form_post response page.
-func Template() *template.Template { return parsedHTMLTemplate }
+func Template() *template.Template { return unbrandedHTMLTemplate }
+
+// TemplateWithBranding returns an html/template.Template for rendering the response_type=form_post response page
+// with the branding which is returned by the given function at the time that the page is rendered.
+func TemplateWithBranding(getBranding func() *branding.Branding) *template.Template {
+	return template.Must(parsedHTMLTemplate.Clone()).Funcs(template.FuncMap{"branding": getBranding})
+}
@@ -1,4 +1,4 @@
-// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package manager
@@ -7,22 +7,37 @@ import (
 	"net/http"
 	"strings"
 	"sync"
+	"time"
 
 	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
 
 	"go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned/typed/config/v1alpha1"
+	"go.pinniped.dev/internal/auditlog"
+	consentstorage "go.pinniped.dev/internal/fositestorage/consent"
+	"go.pinniped.dev/internal/fositestorage/consentrequest"
+	"go.pinniped.dev/internal/fositestorage/devicecode"
+	"go.pinniped.dev/internal/fositestorage/samlassertion"
 	"go.pinniped.dev/internal/oidc"
 	"go.pinniped.dev/internal/oidc/auth"
 	"go.pinniped.dev/internal/oidc/callback"
+	"go.pinniped.dev/internal/oidc/chooseidp"
+	"go.pinniped.dev/internal/oidc/consent"
 	"go.pinniped.dev/internal/oidc/csrftoken"
+	"go.pinniped.dev/internal/oidc/device"
 	"go.pinniped.dev/internal/oidc/discovery"
 	"go.pinniped.dev/internal/oidc/dynamiccodec"
 	"go.pinniped.dev/internal/oidc/idpdiscovery"
+	"go.pinniped.dev/internal/oidc/introspection"
 	"go.pinniped.dev/internal/oidc/jwks"
 	"go.pinniped.dev/internal/oidc/login"
+	"go.pinniped.dev/internal/oidc/logout"
 	"go.pinniped.dev/internal/oidc/oidcclientvalidator"
 	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/oidc/provider/branding"
+	"go.pinniped.dev/internal/oidc/revocation"
+	"go.pinniped.dev/internal/oidc/saml"
 	"go.pinniped.dev/internal/oidc/token"
+	"go.pinniped.dev/internal/oidc/userinfo"
 	"go.pinniped.dev/internal/plog"
 	"go.pinniped.dev/internal/secret"
 	"go.pinniped.dev/pkg/oidcclient/nonce"
@@ -38,32 +53,44 @@ type Manager struct {
 	providerHandlers    map[string]http.Handler              // map of all routes for all providers
 	nextHandler         http.Handler                         // the next handler in a chain, called when this manager didn't know how to handle a request
 	dynamicJWKSProvider jwks.DynamicJWKSProvider             // in-memory cache of per-issuer JWKS data
+	dynamicBranding     branding.DynamicBrandingProvider     // in-memory cache of per-issuer branding of the web pages
 	upstreamIDPs        oidc.UpstreamIdentityProvidersLister // in-memory cache of upstream IDPs
 	secretCache         *secret.Cache                        // in-memory cache of cryptographic material
 	secretsClient       corev1client.SecretInterface
 	oidcClientsClient   v1alpha1.OIDCClientInterface
+	deviceLimits        device.Limits   // limits the use of the device authorization grant by unauthenticated requests
+	auditLogger         auditlog.Logger // where the endpoints record audit events
 }
 
 // NewManager returns an empty Manager.
 // nextHandler will be invoked for any requests that could not be handled by this manager's providers.
 // dynamicJWKSProvider will be used as an in-memory cache for per-issuer JWKS data.
+// dynamicBranding will be used as an in-memory cache for the per-issuer branding of the web pages.
 // upstreamIDPs will be used as an in-memory cache of currently configured upstream IDPs.
+// deviceLimits will be used by the device authorization grant endpoints of every provider.
+// auditLogger will be used by the endpoints of every provider to record audit events.
 func NewManager(
 	nextHandler http.Handler,
 	dynamicJWKSProvider jwks.DynamicJWKSProvider,
+	dynamicBranding branding.DynamicBrandingProvider,
 	upstreamIDPs oidc.UpstreamIdentityProvidersLister,
 	secretCache *secret.Cache,
 	secretsClient corev1client.SecretInterface,
 	oidcClientsClient v1alpha1.OIDCClientInterface,
+	deviceLimits device.Limits,
+	auditLogger auditlog.Logger,
 ) *Manager {
 	return &Manager{
 		providerHandlers:    make(map[string]http.Handler),
 		nextHandler:         nextHandler,
 		dynamicJWKSProvider: dynamicJWKSProvider,
+		dynamicBranding:     dynamicBranding,
 		upstreamIDPs:        upstreamIDPs,
 		secretCache:         secretCache,
 		secretsClient:       secretsClient,
 		oidcClientsClient:   oidcClientsClient,
+		deviceLimits:        deviceLimits,
+		auditLogger:         auditLogger,
 	}
 }
 
@@ -86,6 +113,8 @@ func (m *Manager) SetProviders(federationDomains ...*provider.FederationDomainIs
 		oidc.CSRFCookieLifespan,
 		m.secretCache.GetCSRFCookieEncoderHashKey,
 		func() []byte { return nil },
+		m.secretCache.GetPreviousCSRFCookieEncoderHashKey,
+		nil,
 	)
 
 	for _, incomingProvider := range federationDomains {
@@ -93,8 +122,13 @@ func (m *Manager) SetProviders(federationDomains ...*provider.FederationDomainIs
 		issuerHostWithPath := strings.ToLower(incomingProvider.IssuerHost()) + "/" + incomingProvider.IssuerPath()
 
 		tokenHMACKeyGetter := wrapGetter(incomingProvider.Issuer(), m.secretCache.GetTokenHMACKey)
+		previousTokenHMACKeyGetter := wrapGetter(incomingProvider.Issuer(), m.secretCache.GetPreviousTokenHMACKey)
 
-		timeoutsConfiguration := oidc.DefaultOIDCTimeoutsConfiguration()
+		timeoutsConfiguration := oidc.TimeoutsConfigurationForTokenLifetimes(incomingProvider.TokenLifetimes())
+
+		// The branding is looked up each time that a page is rendered, since it can change without the
+		// FederationDomain changing.
+		getBranding := func() *branding.Branding { return m.dynamicBranding.GetBranding(issuer) }
 
 		// Use NullStorage for the authorize endpoint because we do not actually want to store anything until
 		// the upstream callback endpoint is called later.
@@ -102,34 +136,50 @@ func (m *Manager) SetProviders(federationDomains ...*provider.FederationDomainIs
 			oidc.NewNullStorage(m.secretsClient, m.oidcClientsClient, oidcclientvalidator.DefaultMinBcryptCost),
 			issuer,
 			tokenHMACKeyGetter,
+			previousTokenHMACKeyGetter,
 			nil,
 			timeoutsConfiguration,
+			getBranding,
 		)
 
 		// For all the other endpoints, make another oauth helper with exactly the same settings except use real storage.
+		kubeStorage := oidc.NewKubeStorage(m.secretsClient, m.oidcClientsClient, issuer, timeoutsConfiguration, oidcclientvalidator.DefaultMinBcryptCost)
 		oauthHelperWithKubeStorage := oidc.FositeOauth2Helper(
-			oidc.NewKubeStorage(m.secretsClient, m.oidcClientsClient, timeoutsConfiguration, oidcclientvalidator.DefaultMinBcryptCost),
+			kubeStorage,
 			issuer,
 			tokenHMACKeyGetter,
+			previousTokenHMACKeyGetter,
 			m.dynamicJWKSProvider,
 			timeoutsConfiguration,
+			getBranding,
 		)
 
+		deviceCodeStorage := devicecode.New(m.secretsClient, time.Now, timeoutsConfiguration.DeviceCodeSessionStorageLifetime)
+		consentStorage := consentstorage.New(m.secretsClient, time.Now, timeoutsConfiguration.RememberedConsentLifespan)
+		consentRequestStorage := consentrequest.New(m.secretsClient, time.Now, timeoutsConfiguration.ConsentRequestSessionStorageLifetime)
+		consentResponder := consent.NewResponder(issuer, consentStorage, consentRequestStorage, timeoutsConfiguration.ConsentRequestLifespan)
+
+		// Only the upstream identity providers which are allowed by this FederationDomain should be visible
+		// to its endpoints.
+		idpLister := oidc.NewFederationDomainIdentityProvidersLister(m.upstreamIDPs, incomingProvider.IdentityProviders(), incomingProvider.ClientCredentialsTransforms())
+
 		var upstreamStateEncoder = dynamiccodec.New(
 			timeoutsConfiguration.UpstreamStateParamLifespan,
 			wrapGetter(incomingProvider.Issuer(), m.secretCache.GetStateEncoderHashKey),
 			wrapGetter(incomingProvider.Issuer(), m.secretCache.GetStateEncoderBlockKey),
+			wrapGetter(incomingProvider.Issuer(), m.secretCache.GetPreviousStateEncoderHashKey),
+			wrapGetter(incomingProvider.Issuer(), m.secretCache.GetPreviousStateEncoderBlockKey),
 		)
 
-		m.providerHandlers[(issuerHostWithPath + oidc.WellKnownEndpointPath)] = discovery.NewHandler(issuer)
+		m.providerHandlers[(issuerHostWithPath + oidc.WellKnownEndpointPath)] = discovery.NewHandler(issuer, incomingProvider.IDTokenSigningAlgorithms())
 
 		m.providerHandlers[(issuerHostWithPath + oidc.JWKSEndpointPath)] = jwks.NewHandler(issuer, m.dynamicJWKSProvider)
 
-		m.providerHandlers[(issuerHostWithPath + oidc.PinnipedIDPsPathV1Alpha1)] = idpdiscovery.NewHandler(m.upstreamIDPs)
+		m.providerHandlers[(issuerHostWithPath + oidc.PinnipedIDPsPathV1Alpha1)] = idpdiscovery.NewHandler(idpLister)
 
-		m.providerHandlers[(issuerHostWithPath + oidc.AuthorizationEndpointPath)] = auth.NewHandler(
+		m.providerHandlers[(issuerHostWithPath + oidc.AuthorizationEndpointPath)] = oidc.WithEndpointMetrics(oidc.AuthorizationEndpointMetricsName, auth.NewHandler(
 			issuer,
-			m.upstreamIDPs,
+			idpLister,
 			oauthHelperWithNullStorage,
 			oauthHelperWithKubeStorage,
 			csrftoken.Generate,
@@ -137,26 +187,118 @@ func (m *Manager) SetProviders(federationDomains ...*provider.FederationDomainIs
 			nonce.Generate,
 			upstreamStateEncoder,
 			csrfCookieEncoder,
-		)
+			getBranding,
+			m.auditLogger,
+		))
 
-		m.providerHandlers[(issuerHostWithPath + oidc.CallbackEndpointPath)] = callback.NewHandler(
-			m.upstreamIDPs,
+		m.providerHandlers[(issuerHostWithPath + oidc.CallbackEndpointPath)] = oidc.WithEndpointMetrics(oidc.CallbackEndpointMetricsName, callback.NewHandler(
+			idpLister,
 			oauthHelperWithKubeStorage,
 			upstreamStateEncoder,
 			csrfCookieEncoder,
 			issuer+oidc.CallbackEndpointPath,
-		)
+			consentResponder,
+			getBranding,
+			m.auditLogger,
+		))
 
-		m.providerHandlers[(issuerHostWithPath + oidc.TokenEndpointPath)] = token.NewHandler(
-			m.upstreamIDPs,
+		m.providerHandlers[(issuerHostWithPath + oidc.TokenEndpointPath)] = oidc.WithEndpointMetrics(oidc.TokenEndpointMetricsName, token.NewHandler(
+			idpLister,
 			oauthHelperWithKubeStorage,
+			deviceCodeStorage,
+			issuer+oidc.DeviceCallbackEndpointPath,
+			m.auditLogger,
+		))
+
+		m.providerHandlers[(issuerHostWithPath + oidc.RevocationEndpointPath)] = revocation.NewHandler(
+			idpLister,
+			oauthHelperWithKubeStorage,
+			m.auditLogger,
+		)
+
+		m.providerHandlers[(issuerHostWithPath + oidc.IntrospectionEndpointPath)] = introspection.NewHandler(oauthHelperWithKubeStorage)
+
+		m.providerHandlers[(issuerHostWithPath + oidc.UserInfoEndpointPath)] = userinfo.NewHandler(oauthHelperWithKubeStorage)
+
+		m.providerHandlers[(issuerHostWithPath + oidc.EndSessionEndpointPath)] = logout.NewHandler(
+			issuer,
+			m.dynamicJWKSProvider,
+			upstreamStateEncoder,
+			kubeStorage,
+			// Each refresh issues a new ID token, so an ID token which was issued before the longest time that the
+			// tokens of a session are stored cannot identify a session which can still be used.
+			timeoutsConfiguration.AccessTokenSessionStorageLifetime,
+			idpLister,
+			m.auditLogger,
 		)
 
+		m.providerHandlers[(issuerHostWithPath + oidc.EndSessionCallbackPath)] = logout.NewCallbackHandler(upstreamStateEncoder)
+
 		m.providerHandlers[(issuerHostWithPath + oidc.PinnipedLoginPath)] = login.NewHandler(
 			upstreamStateEncoder,
 			csrfCookieEncoder,
-			login.NewGetHandler(incomingProvider.IssuerPath()+oidc.PinnipedLoginPath),
-			login.NewPostHandler(issuer, m.upstreamIDPs, oauthHelperWithKubeStorage),
+			login.NewGetHandler(incomingProvider.IssuerPath()+oidc.PinnipedLoginPath, getBranding),
+			login.NewPostHandler(issuer, idpLister, oauthHelperWithKubeStorage, consentResponder, m.auditLogger),
+			getBranding,
+		)
+
+		m.providerHandlers[(issuerHostWithPath + oidc.ChooseIDPEndpointPath)] = chooseidp.NewHandler(
+			incomingProvider.IssuerPath()+oidc.AuthorizationEndpointPath,
+			idpLister,
+		)
+
+		m.providerHandlers[(issuerHostWithPath + oidc.DeviceAuthorizationEndpointPath)] = device.NewAuthorizationHandler(
+			issuer,
+			oauthHelperWithKubeStorage,
+			deviceCodeStorage,
+			timeoutsConfiguration.DeviceCodeLifespan,
+			m.deviceLimits,
+			m.auditLogger,
+		)
+
+		m.providerHandlers[(issuerHostWithPath + oidc.DeviceVerificationEndpointPath)] = device.NewVerificationHandler(
+			issuer,
+			incomingProvider.IssuerPath()+oidc.DeviceVerificationEndpointPath,
+			deviceCodeStorage,
+			csrftoken.Generate,
+			nonce.Generate,
+			pkce.Generate,
+			csrfCookieEncoder,
+			m.deviceLimits,
+		)
+
+		m.providerHandlers[(issuerHostWithPath + oidc.DeviceCallbackEndpointPath)] = device.NewCallbackHandler(
+			deviceCodeStorage,
+			m.auditLogger,
+		)
+
+		m.providerHandlers[(issuerHostWithPath + oidc.ConsentEndpointPath)] = consent.NewHandler(
+			incomingProvider.IssuerPath()+oidc.ConsentEndpointPath,
+			oauthHelperWithKubeStorage,
+			consentStorage,
+			consentRequestStorage,
+			csrfCookieEncoder,
+			getBranding,
+			m.auditLogger,
+		)
+
+		m.providerHandlers[(issuerHostWithPath + oidc.ConsentsEndpointPath)] = consent.NewConsentsHandler(
+			oauthHelperWithKubeStorage,
+			consentStorage,
+			m.auditLogger,
+		)
+
+		m.providerHandlers[(issuerHostWithPath + oidc.SAMLMetadataEndpointPath)] = saml.NewMetadataHandler(issuer)
+
+		m.providerHandlers[(issuerHostWithPath + oidc.SAMLACSEndpointPath)] = saml.NewACSHandler(
+			issuer,
+			idpLister,
+			oauthHelperWithKubeStorage,
+			upstreamStateEncoder,
+			samlassertion.New(m.secretsClient, time.Now),
+			consentResponder,
+			getBranding,
+			m.auditLogger,
 		)
 
 		plog.Debug("oidc provider manager added or updated issuer", "issuer", issuer)
@@ -1,4 +1,4 @@
-// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package manager
@@ -21,11 +21,14 @@ import (
 	"k8s.io/client-go/kubernetes/fake"
 
 	supervisorfake "go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned/fake"
+	"go.pinniped.dev/internal/auditlog"
 	"go.pinniped.dev/internal/here"
 	"go.pinniped.dev/internal/oidc"
+	"go.pinniped.dev/internal/oidc/device"
 	"go.pinniped.dev/internal/oidc/discovery"
 	"go.pinniped.dev/internal/oidc/jwks"
 	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/oidc/provider/branding"
 	"go.pinniped.dev/internal/secret"
 	"go.pinniped.dev/internal/testutil"
 	"go.pinniped.dev/internal/testutil/oidctestutil"
@@ -113,6 +116,21 @@ func TestManager(t *testing.T) {
 			)
 		}
 
+		requireChooseIDPRequestToBeHandled := func(requestIssuer, requestURLSuffix, expectedAuthorizationPath, expectedIDPName string) {
+			recorder := httptest.NewRecorder()
+
+			subject.ServeHTTP(recorder, newGetRequest(requestIssuer+oidc.ChooseIDPEndpointPath+requestURLSuffix))
+
+			r.False(fallbackHandlerWasCalled)
+
+			// Minimal check to ensure that the right endpoint was called
+			r.Equal(http.StatusOK, recorder.Code)
+			responseBody, err := io.ReadAll(recorder.Body)
+			r.NoError(err)
+			r.Contains(string(responseBody), `<a href="`+expectedAuthorizationPath+`?client_id=`)
+			r.Contains(string(responseBody), ">"+expectedIDPName+"</a>")
+		}
+
 		requireAuthorizationRequestToBeHandled := func(requestIssuer, requestURLSuffix, expectedRedirectLocationPrefix string) (string, string) {
 			recorder := httptest.NewRecorder()
 
@@ -182,7 +200,7 @@ func TestManager(t *testing.T) {
 			return actualLocationQueryParams.Get("code")
 		}
 
-		requireTokenRequestToBeHandled := func(requestIssuer, authCode string, jwks *jose.JSONWebKeySet, jwkIssuer string) {
+		requireTokenRequestToBeHandled := func(requestIssuer, authCode string, jwks *jose.JSONWebKeySet, jwkIssuer string) string {
 			recorder := httptest.NewRecorder()
 
 			numberOfKubeActionsBeforeThisRequest := len(kubeClient.Actions())
@@ -219,6 +237,75 @@ func TestManager(t *testing.T) {
 			// Make sure that we wired up the callback endpoint to use kube storage for fosite sessions.
 			r.Equal(len(kubeClient.Actions()), numberOfKubeActionsBeforeThisRequest+9,
 				"did not perform any kube actions during the callback request, but should have")
+
+			// Return the access token so we can revoke it in our next request to the revocation endpoint.
+			accessToken, ok := body["access_token"].(string)
+			r.True(ok, "wanted access_token type to be string, but was %T", body["access_token"])
+			return accessToken
+		}
+
+		requireUserInfoRequestToBeHandled := func(requestIssuer, accessToken string) {
+			recorder := httptest.NewRecorder()
+
+			userInfoRequest := newGetRequest(requestIssuer + oidc.UserInfoEndpointPath)
+			userInfoRequest.Header.Set("Authorization", "Bearer "+accessToken)
+			subject.ServeHTTP(recorder, userInfoRequest)
+
+			r.False(fallbackHandlerWasCalled)
+
+			// Minimal check to ensure that the right endpoint was called
+			r.Equal(http.StatusOK, recorder.Code, "unexpected response body: %s", recorder.Body.String())
+			var body map[string]interface{}
+			r.NoError(json.Unmarshal(recorder.Body.Bytes(), &body))
+			r.Contains(body, "sub")
+			r.Contains(body, "username")
+		}
+
+		requireIntrospectionRequestToBeHandled := func(requestIssuer, accessToken string) {
+			recorder := httptest.NewRecorder()
+
+			introspectionRequestBody := url.Values{"token": []string{accessToken}}.Encode()
+			subject.ServeHTTP(recorder, newPostRequest(requestIssuer+oidc.IntrospectionEndpointPath, introspectionRequestBody))
+
+			r.False(fallbackHandlerWasCalled)
+
+			// Minimal check to ensure that the right endpoint was called. The pinniped-cli client has no secret,
+			// so it cannot authenticate. The endpoint's own unit tests cover successful introspection.
+			r.Equal(http.StatusUnauthorized, recorder.Code)
+			r.Contains(recorder.Body.String(), "request_unauthorized")
+		}
+
+		requireRevocationRequestToBeHandled := func(requestIssuer, accessToken string) {
+			recorder := httptest.NewRecorder()
+
+			numberOfKubeActionsBeforeThisRequest := len(kubeClient.Actions())
+
+			revocationRequestBody := url.Values{
+				"token":     []string{accessToken},
+				"client_id": []string{downstreamClientID},
+			}.Encode()
+			subject.ServeHTTP(recorder, newPostRequest(requestIssuer+oidc.RevocationEndpointPath, revocationRequestBody))
+
+			r.False(fallbackHandlerWasCalled)
+
+			// Minimal check to ensure that the right endpoint was called
+			r.Equal(http.StatusOK, recorder.Code)
+
+			// Make sure that we wired up the revocation endpoint to use kube storage for fosite sessions.
+			r.Greater(len(kubeClient.Actions()), numberOfKubeActionsBeforeThisRequest,
+				"did not perform any kube actions during the revocation request, but should have")
+		}
+
+		requireEndSessionRequestToBeHandled := func(requestIssuer string) {
+			recorder := httptest.NewRecorder()
+
+			subject.ServeHTTP(recorder, newGetRequest(requestIssuer+oidc.EndSessionEndpointPath))
+
+			r.False(fallbackHandlerWasCalled)
+
+			// Minimal check to ensure that the right endpoint was called. The endpoint's own unit tests cover ending sessions.
+			r.Equal(http.StatusBadRequest, recorder.Code)
+			r.Equal("Bad Request: id_token_hint param is required\n", recorder.Body.String())
 		}
 
 		requireJWKSRequestToBeHandled := func(requestIssuer, requestURLSuffix, expectedJWKKeyID string) *jose.JSONWebKeySet {
@@ -284,7 +371,7 @@ func TestManager(t *testing.T) {
 			cache.SetStateEncoderHashKey(issuer2, []byte("some-state-encoder-hash-key-2"))
 			cache.SetStateEncoderBlockKey(issuer2, []byte("16-bytes-STATE02"))
 
-			subject = NewManager(nextHandler, dynamicJWKSProvider, idpLister, &cache, secretsClient, oidcClientsClient)
+			subject = NewManager(nextHandler, dynamicJWKSProvider, branding.NewDynamicBrandingProvider(), idpLister, &cache, secretsClient, oidcClientsClient, device.DefaultLimits(), auditlog.NewNoopLogger())
 		})
 
 		when("given no providers via SetProviders()", func() {
@@ -332,6 +419,13 @@ func TestManager(t *testing.T) {
 			requirePinnipedIDPsDiscoveryRequestToBeHandled(issuer2DifferentCaseHostname, "", upstreamIDPName, upstreamIDPType, upstreamIDPFlows)
 			requirePinnipedIDPsDiscoveryRequestToBeHandled(issuer2DifferentCaseHostname, "?some=query", upstreamIDPName, upstreamIDPType, upstreamIDPFlows)
 
+			requireChooseIDPRequestToBeHandled(issuer1, "?client_id=foo", "/some/path"+oidc.AuthorizationEndpointPath, upstreamIDPName)
+			requireChooseIDPRequestToBeHandled(issuer2, "?client_id=foo", "/some/path/more/deeply/nested/path"+oidc.AuthorizationEndpointPath, upstreamIDPName)
+
+			// Hostnames are case-insensitive, so test that we can handle that.
+			requireChooseIDPRequestToBeHandled(issuer1DifferentCaseHostname, "?client_id=foo", "/some/path"+oidc.AuthorizationEndpointPath, upstreamIDPName)
+			requireChooseIDPRequestToBeHandled(issuer2DifferentCaseHostname, "?client_id=foo", "/some/path/more/deeply/nested/path"+oidc.AuthorizationEndpointPath, upstreamIDPName)
+
 			issuer1JWKS := requireJWKSRequestToBeHandled(issuer1, "", issuer1KeyID)
 			issuer2JWKS := requireJWKSRequestToBeHandled(issuer2, "", issuer2KeyID)
 			requireJWKSRequestToBeHandled(issuer2, "?some=query", issuer2KeyID)
@@ -377,19 +471,47 @@ func TestManager(t *testing.T) {
 			downstreamAuthCode3 := requireCallbackRequestToBeHandled(issuer1DifferentCaseHostname, callbackRequestParams1, csrfCookieValue1)
 			downstreamAuthCode4 := requireCallbackRequestToBeHandled(issuer2DifferentCaseHostname, callbackRequestParams2, csrfCookieValue2)
 
-			requireTokenRequestToBeHandled(issuer1, downstreamAuthCode1, issuer1JWKS, issuer1)
-			requireTokenRequestToBeHandled(issuer2, downstreamAuthCode2, issuer2JWKS, issuer2)
+			accessToken1 := requireTokenRequestToBeHandled(issuer1, downstreamAuthCode1, issuer1JWKS, issuer1)
+			accessToken2 := requireTokenRequestToBeHandled(issuer2, downstreamAuthCode2, issuer2JWKS, issuer2)
+
+			// Hostnames are case-insensitive, so test that we can handle that.
+			accessToken3 := requireTokenRequestToBeHandled(issuer1DifferentCaseHostname, downstreamAuthCode3, issuer1JWKS, issuer1)
+			accessToken4 := requireTokenRequestToBeHandled(issuer2DifferentCaseHostname, downstreamAuthCode4, issuer2JWKS, issuer2)
+
+			requireUserInfoRequestToBeHandled(issuer1, accessToken1)
+			requireUserInfoRequestToBeHandled(issuer2, accessToken2)
+
+			// Hostnames are case-insensitive, so test that we can handle that.
+			requireUserInfoRequestToBeHandled(issuer1DifferentCaseHostname, accessToken3)
+			requireUserInfoRequestToBeHandled(issuer2DifferentCaseHostname, accessToken4)
+
+			requireIntrospectionRequestToBeHandled(issuer1, accessToken1)
+			requireIntrospectionRequestToBeHandled(issuer2, accessToken2)
+
+			// Hostnames are case-insensitive, so test that we can handle that.
+			requireIntrospectionRequestToBeHandled(issuer1DifferentCaseHostname, accessToken3)
+			requireIntrospectionRequestToBeHandled(issuer2DifferentCaseHostname, accessToken4)
+
+			requireRevocationRequestToBeHandled(issuer1, accessToken1)
+			requireRevocationRequestToBeHandled(issuer2, accessToken2)
+
+			// Hostnames are case-insensitive, so test that we can handle that.
+			requireRevocationRequestToBeHandled(issuer1DifferentCaseHostname, accessToken3)
+			requireRevocationRequestToBeHandled(issuer2DifferentCaseHostname, accessToken4)
+
+			requireEndSessionRequestToBeHandled(issuer1)
+			requireEndSessionRequestToBeHandled(issuer2)
 
 			// Hostnames are case-insensitive, so test that we can handle that.
-			requireTokenRequestToBeHandled(issuer1DifferentCaseHostname, downstreamAuthCode3, issuer1JWKS, issuer1)
-			requireTokenRequestToBeHandled(issuer2DifferentCaseHostname, downstreamAuthCode4, issuer2JWKS, issuer2)
+			requireEndSessionRequestToBeHandled(issuer1DifferentCaseHostname)
+			requireEndSessionRequestToBeHandled(issuer2DifferentCaseHostname)
 		}
 
 		when("given some valid providers via SetProviders()", func() {
 			it.Before(func() {
-				p1, err := provider.NewFederationDomainIssuer(issuer1)
+				p1, err := provider.NewFederationDomainIssuer(issuer1, nil, nil, nil, nil)
 				r.NoError(err)
-				p2, err := provider.NewFederationDomainIssuer(issuer2)
+				p2, err := provider.NewFederationDomainIssuer(issuer2, nil, nil, nil, nil)
 				r.NoError(err)
 				subject.SetProviders(p1, p2)
 
@@ -401,7 +523,7 @@ func TestManager(t *testing.T) {
 					issuer1: newTestJWK(issuer1KeyID),
 					issuer2: newTestJWK(issuer2KeyID),
 				}
-				dynamicJWKSProvider.SetIssuerToJWKSMap(jwksMap, activeJWK)
+				dynamicJWKSProvider.SetIssuerToJWKSMap(jwksMap, activeJWK, nil)
 			})
 
 			it("sends all non-matching host requests to the nextHandler", func() {
@@ -430,9 +552,9 @@ func TestManager(t *testing.T) {
 
 		when("given the same valid providers as arguments to SetProviders() in reverse order", func() {
 			it.Before(func() {
-				p1, err := provider.NewFederationDomainIssuer(issuer1)
+				p1, err := provider.NewFederationDomainIssuer(issuer1, nil, nil, nil, nil)
 				r.NoError(err)
-				p2, err := provider.NewFederationDomainIssuer(issuer2)
+				p2, err := provider.NewFederationDomainIssuer(issuer2, nil, nil, nil, nil)
 				r.NoError(err)
 				subject.SetProviders(p2, p1)
 
@@ -444,7 +566,7 @@ func TestManager(t *testing.T) {
 					issuer1: newTestJWK(issuer1KeyID),
 					issuer2: newTestJWK(issuer2KeyID),
 				}
-				dynamicJWKSProvider.SetIssuerToJWKSMap(jwksMap, activeJWK)
+				dynamicJWKSProvider.SetIssuerToJWKSMap(jwksMap, activeJWK, nil)
 			})
 
 			it("still routes matching requests to the appropriate provider", func() {
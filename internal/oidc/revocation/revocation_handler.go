@@ -0,0 +1,94 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package revocation provides a handler for the OAuth 2.0 token revocation endpoint (RFC 7009).
+package revocation
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/ory/fosite"
+
+	"go.pinniped.dev/internal/auditlog"
+	"go.pinniped.dev/internal/httputil/httperr"
+	"go.pinniped.dev/internal/oidc"
+	"go.pinniped.dev/internal/plog"
+	"go.pinniped.dev/internal/psession"
+)
+
+// NewHandler returns an http.Handler which revokes a downstream access or refresh token, along with all other
+// downstream tokens of the same session. When the session was started by logging in to an upstream OIDC provider,
+// then the upstream tokens which are stored in the session are also revoked.
+func NewHandler(
+	idpLister oidc.FederationDomainIdentityProvidersListerI,
+	oauthHelper fosite.OAuth2Provider,
+	auditLogger auditlog.Logger,
+) http.Handler {
+	return httperr.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		ctx := r.Context()
+
+		// Look up the session of the token before it gets revoked, since it holds the upstream tokens. This lookup
+		// does not authenticate the client, so the session is only used after fosite has authenticated the client
+		// and checked that the client owns the token. The session will not be found when the token is unknown,
+		// expired, or already revoked, in which case there is nothing more to revoke.
+		var sessionRequester fosite.AccessRequester
+		if r.Method == http.MethodPost {
+			tokenTypeHint := fosite.TokenUse(r.PostFormValue("token_type_hint"))
+			_, sessionRequester, _ = oauthHelper.IntrospectToken(ctx, r.PostFormValue("token"), tokenTypeHint, psession.NewPinnipedSession())
+		}
+
+		err := oauthHelper.NewRevocationRequest(ctx, r)
+		if err != nil {
+			plog.Info("revocation request error", oidc.FositeErrorForLog(err)...)
+			oauthHelper.WriteRevocationResponse(ctx, w, err)
+			return nil
+		}
+
+		if sessionRequester != nil {
+			auditLogger.Audit(auditEvent(r, sessionRequester))
+
+			// The downstream tokens are already revoked, so failing to revoke the upstream tokens should not fail
+			// the request. Retrying would not help the client, because the downstream session is gone.
+			if err := revokeUpstreamTokens(ctx, sessionRequester, idpLister); err != nil {
+				plog.WarningErr("could not revoke upstream tokens after revoking downstream tokens", err,
+					"clientID", sessionRequester.GetClient().GetID())
+			}
+		}
+
+		oauthHelper.WriteRevocationResponse(ctx, w, nil)
+		return nil
+	})
+}
+
+func auditEvent(r *http.Request, sessionRequester fosite.AccessRequester) auditlog.Event {
+	event := auditlog.Event{
+		Type:          auditlog.TokensRevoked,
+		CorrelationID: oidc.CorrelationID(sessionRequester),
+		Request:       auditlog.RequestFromHTTP(r),
+		ClientID:      sessionRequester.GetClient().GetID(),
+	}
+	session, ok := sessionRequester.GetSession().(*psession.PinnipedSession)
+	if ok && session.Custom != nil {
+		event.UpstreamIDP = &auditlog.UpstreamIDP{Name: session.Custom.ProviderName, Type: string(session.Custom.ProviderType)}
+		if session.Custom.Username != "" {
+			event.User = &auditlog.User{Username: session.Custom.Username}
+		}
+	}
+	return event
+}
+
+// revokeUpstreamTokens revokes the upstream OIDC tokens of the session in the same way that the garbage collector
+// does when it deletes an expired session.
+func revokeUpstreamTokens(
+	ctx context.Context,
+	sessionRequester fosite.AccessRequester,
+	idpLister oidc.FederationDomainIdentityProvidersListerI,
+) error {
+	session, ok := sessionRequester.GetSession().(*psession.PinnipedSession)
+	if !ok || session.Custom == nil {
+		return fmt.Errorf("session is missing its upstream session data")
+	}
+	return oidc.RevokeUpstreamOIDCTokens(ctx, session.Custom, idpLister)
+}
@@ -0,0 +1,261 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package revocation
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ory/fosite/token/jwt"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/fake"
+	v1 "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	supervisorfake "go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned/fake"
+	"go.pinniped.dev/internal/auditlog"
+	"go.pinniped.dev/internal/crud"
+	"go.pinniped.dev/internal/fositestorage/accesstoken"
+	"go.pinniped.dev/internal/fositestorage/refreshtoken"
+	"go.pinniped.dev/internal/oidc"
+	"go.pinniped.dev/internal/oidc/jwks"
+	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/psession"
+	"go.pinniped.dev/internal/testutil"
+	"go.pinniped.dev/internal/testutil/oidctestutil"
+)
+
+const (
+	downstreamIssuer      = "https://my-downstream-issuer.com/path"
+	downstreamRedirectURI = "http://127.0.0.1/callback"
+	downstreamClientID    = "pinniped-cli"
+
+	upstreamOIDCName        = "some-oidc-idp"
+	upstreamOIDCResourceUID = "oidc-resource-uid"
+	upstreamLDAPName        = "some-ldap-idp"
+	upstreamLDAPResourceUID = "ldap-resource-uid"
+	upstreamRefreshToken    = "some-upstream-refresh-token"
+	upstreamAccessToken     = "some-upstream-access-token"
+	downstreamUsername      = "some-downstream-username"
+)
+
+func TestRevocationEndpoint(t *testing.T) {
+	oidcSessionWithRefreshToken := &psession.CustomSessionData{
+		Username:     downstreamUsername,
+		ProviderUID:  upstreamOIDCResourceUID,
+		ProviderName: upstreamOIDCName,
+		ProviderType: psession.ProviderTypeOIDC,
+		OIDC:         &psession.OIDCSessionData{UpstreamRefreshToken: upstreamRefreshToken},
+	}
+	oidcSessionWithAccessToken := &psession.CustomSessionData{
+		Username:     downstreamUsername,
+		ProviderUID:  upstreamOIDCResourceUID,
+		ProviderName: upstreamOIDCName,
+		ProviderType: psession.ProviderTypeOIDC,
+		OIDC:         &psession.OIDCSessionData{UpstreamAccessToken: upstreamAccessToken},
+	}
+	ldapSession := &psession.CustomSessionData{
+		Username:     downstreamUsername,
+		ProviderUID:  upstreamLDAPResourceUID,
+		ProviderName: upstreamLDAPName,
+		ProviderType: psession.ProviderTypeLDAP,
+		LDAP:         &psession.LDAPSessionData{UserDN: "some-user-dn"},
+	}
+
+	happyOIDCUpstream := func() *oidctestutil.TestUpstreamOIDCIdentityProviderBuilder {
+		return oidctestutil.NewTestUpstreamOIDCIdentityProviderBuilder().
+			WithName(upstreamOIDCName).
+			WithResourceUID(upstreamOIDCResourceUID)
+	}
+
+	tests := []struct {
+		name              string
+		idps              *oidctestutil.UpstreamIDPListerBuilder
+		customSessionData *psession.CustomSessionData
+		// modifyRevocationRequest may change the form of the revocation request, which already has the downstream
+		// refresh token in its token param and the pinniped-cli client ID in its client_id param.
+		modifyRevocationRequest func(form url.Values, accessToken string)
+		method                  string
+
+		wantStatus              int
+		wantBodyJSON            string
+		wantDownstreamRevoked   bool
+		wantUpstreamRevokeCall  *oidctestutil.RevokeTokenArgs
+		wantAuditedRevokedToken bool
+	}{
+		{
+			name:                    "revoking the downstream refresh token of an OIDC session revokes the upstream refresh token",
+			idps:                    oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(happyOIDCUpstream().Build()),
+			customSessionData:       oidcSessionWithRefreshToken,
+			wantStatus:              http.StatusOK,
+			wantDownstreamRevoked:   true,
+			wantUpstreamRevokeCall:  &oidctestutil.RevokeTokenArgs{Token: upstreamRefreshToken, TokenType: provider.RefreshTokenType},
+			wantAuditedRevokedToken: true,
+		},
+		{
+			name:              "revoking the downstream access token of an OIDC session revokes the upstream access token",
+			idps:              oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(happyOIDCUpstream().Build()),
+			customSessionData: oidcSessionWithAccessToken,
+			modifyRevocationRequest: func(form url.Values, accessToken string) {
+				form.Set("token", accessToken)
+				form.Set("token_type_hint", "access_token")
+			},
+			wantStatus:              http.StatusOK,
+			wantDownstreamRevoked:   true,
+			wantUpstreamRevokeCall:  &oidctestutil.RevokeTokenArgs{Token: upstreamAccessToken, TokenType: provider.AccessTokenType},
+			wantAuditedRevokedToken: true,
+		},
+		{
+			name:                    "revoking the downstream refresh token of an LDAP session does not need any upstream revocation",
+			idps:                    oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(happyOIDCUpstream().Build()),
+			customSessionData:       ldapSession,
+			wantStatus:              http.StatusOK,
+			wantDownstreamRevoked:   true,
+			wantAuditedRevokedToken: true,
+		},
+		{
+			name: "the downstream tokens are still revoked when the upstream revocation fails",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(
+				happyOIDCUpstream().WithRevokeTokenError(errors.New("some upstream revocation error")).Build(),
+			),
+			customSessionData:       oidcSessionWithRefreshToken,
+			wantStatus:              http.StatusOK,
+			wantDownstreamRevoked:   true,
+			wantUpstreamRevokeCall:  &oidctestutil.RevokeTokenArgs{Token: upstreamRefreshToken, TokenType: provider.RefreshTokenType},
+			wantAuditedRevokedToken: true,
+		},
+		{
+			name: "the downstream tokens are still revoked when the upstream provider has changed its resource UID",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(
+				happyOIDCUpstream().WithResourceUID("some-new-resource-uid").Build(),
+			),
+			customSessionData:       oidcSessionWithRefreshToken,
+			wantStatus:              http.StatusOK,
+			wantDownstreamRevoked:   true,
+			wantAuditedRevokedToken: true,
+		},
+		{
+			name:              "unknown tokens are successfully ignored, per RFC 7009",
+			idps:              oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(happyOIDCUpstream().Build()),
+			customSessionData: oidcSessionWithRefreshToken,
+			modifyRevocationRequest: func(form url.Values, _ string) {
+				form.Set("token", "pin_rt_some-unknown-token.some-unknown-signature")
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:              "requests from unknown clients are rejected",
+			idps:              oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(happyOIDCUpstream().Build()),
+			customSessionData: oidcSessionWithRefreshToken,
+			modifyRevocationRequest: func(form url.Values, _ string) {
+				form.Set("client_id", "some-unknown-client")
+			},
+			wantStatus:   http.StatusUnauthorized,
+			wantBodyJSON: `{"error":"invalid_client","error_description":"Client authentication failed (e.g., unknown client, no client authentication included, or unsupported authentication method)."}`,
+		},
+		{
+			name:              "GET requests are rejected",
+			idps:              oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(happyOIDCUpstream().Build()),
+			customSessionData: oidcSessionWithRefreshToken,
+			method:            http.MethodGet,
+			wantStatus:        http.StatusBadRequest,
+			wantBodyJSON:      `{"error":"invalid_request","error_description":"The request is missing a required parameter, includes an invalid parameter value, includes a parameter more than once, or is otherwise malformed. Make sure that the various parameters are correct, be aware of case sensitivity and trim your parameters. Make sure that the client you are using has exactly whitelisted the redirect_uri you specified."}`,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			kubeClient := fake.NewSimpleClientset()
+			supervisorClient := supervisorfake.NewSimpleClientset()
+			secrets := kubeClient.CoreV1().Secrets("some-namespace")
+			oidcClientsClient := supervisorClient.ConfigV1alpha1().OIDCClients("some-namespace")
+
+			// Use lower minimum required bcrypt cost than we would use in production to keep unit the tests fast.
+			oauthStore := oidc.NewKubeStorage(secrets, oidcClientsClient, downstreamIssuer, oidc.DefaultOIDCTimeoutsConfiguration(), bcrypt.MinCost)
+			hmacSecretFunc := func() []byte { return []byte("some secret - must have at least 32 bytes") }
+			oauthHelper := oidc.FositeOauth2Helper(oauthStore, downstreamIssuer, hmacSecretFunc, nil, jwks.NewDynamicJWKSProvider(), oidc.DefaultOIDCTimeoutsConfiguration(), nil)
+
+			tokens := oidctestutil.SimulateLoginHavingAlreadyHappened(t, oauthHelper, oidctestutil.SimulatedLogin{
+				ClientID:          downstreamClientID,
+				RedirectURI:       downstreamRedirectURI,
+				Scopes:            []string{"offline_access"},
+				IDTokenClaims:     &jwt.IDTokenClaims{Subject: "some-subject", Extra: map[string]interface{}{}},
+				CustomSessionData: test.customSessionData,
+			})
+			accessToken, refreshToken := tokens.AccessToken, tokens.RefreshToken
+			requireNumberOfDownstreamTokens(t, secrets, 1)
+
+			form := url.Values{
+				"token":     []string{refreshToken},
+				"client_id": []string{downstreamClientID},
+			}
+			if test.modifyRevocationRequest != nil {
+				test.modifyRevocationRequest(form, accessToken)
+			}
+
+			method := http.MethodPost
+			if test.method != "" {
+				method = test.method
+			}
+			reqContext := context.WithValue(context.Background(), struct{ name string }{name: "test"}, "request-context")
+			req := httptest.NewRequest(method, "/path/shouldn't/matter", strings.NewReader(form.Encode())).WithContext(reqContext)
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rsp := httptest.NewRecorder()
+
+			auditLogger := auditlog.NewTestLogger(t)
+			subject := NewHandler(test.idps.Build(), oauthHelper, auditLogger)
+			subject.ServeHTTP(rsp, req)
+			t.Logf("response: %#v", rsp)
+			t.Logf("response body: %q", rsp.Body.String())
+
+			require.Equal(t, test.wantStatus, rsp.Code)
+			require.Equal(t, "no-store", rsp.Header().Get("Cache-Control"))
+			if test.wantBodyJSON != "" {
+				require.JSONEq(t, test.wantBodyJSON, rsp.Body.String())
+			} else {
+				require.Empty(t, rsp.Body.String())
+			}
+
+			if test.wantDownstreamRevoked {
+				requireNumberOfDownstreamTokens(t, secrets, 0)
+			} else {
+				requireNumberOfDownstreamTokens(t, secrets, 1)
+			}
+
+			if test.wantUpstreamRevokeCall != nil {
+				test.wantUpstreamRevokeCall.Ctx = reqContext
+				test.idps.RequireExactlyOneCallToRevokeToken(t, upstreamOIDCName, test.wantUpstreamRevokeCall)
+			} else {
+				test.idps.RequireExactlyZeroCallsToRevokeToken(t)
+			}
+
+			auditEvents := auditLogger.Events()
+			if test.wantAuditedRevokedToken {
+				require.Len(t, auditEvents, 1)
+				require.Equal(t, auditlog.TokensRevoked, auditEvents[0].Type)
+				require.NotEmpty(t, auditEvents[0].CorrelationID)
+				require.Equal(t, downstreamClientID, auditEvents[0].ClientID)
+				require.Equal(t, &auditlog.User{Username: downstreamUsername}, auditEvents[0].User)
+				require.Equal(t, &auditlog.UpstreamIDP{
+					Name: test.customSessionData.ProviderName,
+					Type: string(test.customSessionData.ProviderType),
+				}, auditEvents[0].UpstreamIDP)
+			} else {
+				require.Empty(t, auditEvents)
+			}
+		})
+	}
+}
+
+func requireNumberOfDownstreamTokens(t *testing.T, secrets v1.SecretInterface, want int) {
+	t.Helper()
+	testutil.RequireNumberOfSecretsMatchingLabelSelector(t, secrets, labels.Set{crud.SecretLabelKey: accesstoken.TypeLabelValue}, want)
+	testutil.RequireNumberOfSecretsMatchingLabelSelector(t, secrets, labels.Set{crud.SecretLabelKey: refreshtoken.TypeLabelValue}, want)
+}
@@ -0,0 +1,213 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package saml provides the handlers for the endpoints which are used by upstream SAML identity providers,
+// where the Supervisor acts as a SAML service provider.
+package saml
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/ory/fosite"
+
+	idpdiscoveryv1alpha1 "go.pinniped.dev/generated/latest/apis/supervisor/idpdiscovery/v1alpha1"
+	"go.pinniped.dev/internal/auditlog"
+	"go.pinniped.dev/internal/fositestorage/samlassertion"
+	"go.pinniped.dev/internal/httputil/httperr"
+	"go.pinniped.dev/internal/httputil/securityheader"
+	"go.pinniped.dev/internal/oidc"
+	"go.pinniped.dev/internal/oidc/consent"
+	"go.pinniped.dev/internal/oidc/downstreamsession"
+	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/oidc/provider/branding"
+	"go.pinniped.dev/internal/oidc/provider/formposthtml"
+	"go.pinniped.dev/internal/plog"
+	"go.pinniped.dev/internal/psession"
+)
+
+const (
+	samlResponseParamName = "SAMLResponse"
+	relayStateParamName   = "RelayState"
+)
+
+// NewACSHandler returns the handler for the assertion consumer service, to which upstream SAML IDPs post their
+// responses using the HTTP-POST binding. It plays the same role for SAML logins as the callback endpoint does for
+// OIDC logins.
+func NewACSHandler(
+	downstreamIssuer string,
+	upstreamIDPs oidc.FederationDomainIdentityProvidersListerI,
+	oauthHelper fosite.OAuth2Provider,
+	stateDecoder oidc.Decoder,
+	assertionStorage samlassertion.Storage,
+	consentResponder *consent.Responder,
+	getBranding func() *branding.Branding,
+	auditLogger auditlog.Logger,
+) http.Handler {
+	sp := oidc.SAMLServiceProviderForIssuer(downstreamIssuer)
+
+	handler := httperr.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		state, err := validateRequest(w, r, stateDecoder)
+		if err != nil {
+			return err
+		}
+
+		upstreamIDPConfig := findUpstreamIDPConfig(state.UpstreamName, upstreamIDPs)
+		if upstreamIDPConfig == nil {
+			plog.Warning("upstream provider not found")
+			return httperr.New(http.StatusUnprocessableEntity, "upstream provider not found")
+		}
+		oidc.RecordUpstreamIDPForMetrics(r.Context(), upstreamIDPConfig.GetName(), psession.ProviderTypeSAML)
+
+		downstreamAuthParams, err := url.ParseQuery(state.AuthParams)
+		if err != nil {
+			plog.Error("error reading state downstream auth params", err)
+			return httperr.New(http.StatusBadRequest, "error reading state downstream auth params")
+		}
+
+		// Recreate enough of the original authorize request so we can pass it to NewAuthorizeRequest().
+		reconstitutedAuthRequest := &http.Request{Form: downstreamAuthParams}
+		authorizeRequester, err := oauthHelper.NewAuthorizeRequest(r.Context(), reconstitutedAuthRequest)
+		if err != nil {
+			plog.Error("error using state downstream auth params", err,
+				"fositeErr", oidc.FositeErrorForLog(err))
+			return httperr.New(http.StatusBadRequest, "error using state downstream auth params")
+		}
+		oidc.RestoreCorrelationID(authorizeRequester, state)
+
+		// Automatically grant certain scopes, but only if they were requested.
+		// This is instead of asking the user to approve these scopes. Note that `NewAuthorizeRequest` would have returned
+		// an error if the client requested a scope that they are not allowed to request, so we don't need to worry about that here.
+		downstreamsession.AutoApproveScopes(authorizeRequester)
+
+		auditLoginFailed := func(err error) {
+			oidc.AuditUpstreamLoginFailed(auditLogger, r, authorizeRequester, upstreamIDPConfig.GetName(), psession.ProviderTypeSAML, err.Error())
+		}
+
+		requestID := oidc.SAMLRequestID(state.Nonce)
+		assertion, err := upstreamIDPConfig.ValidateResponse(sp, r.PostForm.Get(samlResponseParamName), requestID)
+		if err != nil {
+			plog.WarningErr("error validating upstream SAML response", err, "upstreamName", upstreamIDPConfig.GetName())
+			auditLoginFailed(err)
+			return httperr.New(http.StatusUnprocessableEntity, "error validating upstream SAML response")
+		}
+
+		// The request cookie only proves that this browser started the login, so also remember the assertion on
+		// the server to make sure that a captured SAML response cannot be used again, even from the same browser.
+		if err := assertionStorage.UseAssertion(r.Context(), assertion.ID, requestID, assertion.NotOnOrAfter); err != nil {
+			plog.WarningErr("error recording use of upstream SAML assertion", err, "upstreamName", upstreamIDPConfig.GetName())
+			auditLoginFailed(err)
+			if errors.Is(err, samlassertion.ErrAssertionAlreadyUsed) {
+				return httperr.New(http.StatusUnprocessableEntity, "upstream SAML assertion was already used")
+			}
+			return httperr.Wrap(http.StatusInternalServerError, "error recording use of upstream SAML assertion", err)
+		}
+
+		subject, upstreamUsername, upstreamGroups, err := downstreamsession.GetDownstreamIdentityFromUpstreamSAMLAssertion(upstreamIDPConfig, assertion)
+		if err != nil {
+			auditLoginFailed(err)
+			return httperr.Wrap(http.StatusUnprocessableEntity, err.Error(), err)
+		}
+
+		identityTransforms := upstreamIDPs.GetIdentityTransformations(upstreamIDPConfig.GetName(), psession.ProviderTypeSAML)
+		username, groups, err := downstreamsession.ApplyIdentityTransformations(r.Context(), identityTransforms, upstreamUsername, upstreamGroups)
+		if err != nil {
+			auditLoginFailed(err)
+			return httperr.Wrap(http.StatusUnprocessableEntity, err.Error(), err)
+		}
+
+		customSessionData := downstreamsession.MakeDownstreamSAMLCustomSessionData(upstreamIDPConfig, assertion, username, upstreamUsername, upstreamGroups)
+
+		oidc.AuditUpstreamLoginSucceeded(auditLogger, r, authorizeRequester, upstreamIDPConfig.GetName(), psession.ProviderTypeSAML, username, groups)
+
+		openIDSession := downstreamsession.MakeDownstreamSession(subject, username, groups,
+			authorizeRequester.GetGrantedScopes(), authorizeRequester.GetClient().GetID(), customSessionData, map[string]interface{}{})
+		oidc.SetCorrelationID(openIDSession, authorizeRequester)
+
+		if redirected, err := consentResponder.RedirectToConsentPageIfRequired(w, r, authorizeRequester, openIDSession, state); err != nil || redirected {
+			return err
+		}
+
+		authorizeResponder, err := oauthHelper.NewAuthorizeResponse(r.Context(), authorizeRequester, openIDSession)
+		if err != nil {
+			plog.WarningErr("error while generating and saving authcode", err,
+				"upstreamName", upstreamIDPConfig.GetName(), "fositeErr", oidc.FositeErrorForLog(err))
+			return httperr.Wrap(http.StatusInternalServerError, "error while generating and saving authcode", err)
+		}
+
+		oauthHelper.WriteAuthorizeResponse(r.Context(), w, authorizeRequester, authorizeResponder)
+
+		return nil
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		securityheader.WrapWithCustomCSP(handler, formposthtml.ContentSecurityPolicyWithBranding(getBranding())).ServeHTTP(w, r)
+	})
+}
+
+// validateRequest reads the state of the login from the SAML request cookie which is named after the RelayState
+// param, and deletes that cookie. Deleting the cookie is not enough to prevent a SAML response from being used twice,
+// so the handler also remembers each used assertion in its assertion storage.
+func validateRequest(w http.ResponseWriter, r *http.Request, stateDecoder oidc.Decoder) (*oidc.UpstreamStateParamData, error) {
+	if r.Method != http.MethodPost {
+		return nil, httperr.Newf(http.StatusMethodNotAllowed, "%s (try POST)", r.Method)
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return nil, httperr.Wrap(http.StatusBadRequest, "error parsing request params", err)
+	}
+
+	relayState := r.PostForm.Get(relayStateParamName)
+	if relayState == "" {
+		plog.Info("RelayState param not found")
+		return nil, httperr.New(http.StatusBadRequest, "RelayState param not found")
+	}
+
+	cookieName := oidc.SAMLRequestCookieNamePrefix + relayState
+	cookie, err := r.Cookie(cookieName)
+	if err != nil {
+		// Error means that the cookie was not found. Either the login was started by another browser,
+		// or it was already finished.
+		plog.Info("SAML request cookie not found")
+		return nil, httperr.Wrap(http.StatusForbidden, "SAML request cookie is missing", err)
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieName,
+		Value:    "",
+		HttpOnly: true,
+		SameSite: http.SameSiteNoneMode,
+		Secure:   true,
+		Path:     "/",
+		MaxAge:   -1,
+	})
+
+	var state oidc.UpstreamStateParamData
+	if err := stateDecoder.Decode(oidc.UpstreamStateParamEncodingName, cookie.Value, &state); err != nil {
+		plog.InfoErr("error reading state from SAML request cookie", err)
+		return nil, httperr.New(http.StatusBadRequest, "error reading state")
+	}
+
+	if state.FormatVersion != oidc.UpstreamStateParamFormatVersion {
+		return nil, httperr.New(http.StatusUnprocessableEntity, "state format version is invalid")
+	}
+
+	if state.UpstreamType != string(idpdiscoveryv1alpha1.IDPTypeSAML) || string(state.Nonce) != relayState {
+		return nil, httperr.New(http.StatusBadRequest, "state does not belong to this SAML response")
+	}
+
+	if r.PostForm.Get(samlResponseParamName) == "" {
+		plog.Info("SAMLResponse param not found")
+		return nil, httperr.New(http.StatusBadRequest, "SAMLResponse param not found")
+	}
+
+	return &state, nil
+}
+
+func findUpstreamIDPConfig(upstreamName string, upstreamIDPs oidc.UpstreamSAMLIdentityProvidersLister) provider.UpstreamSAMLIdentityProviderI {
+	for _, p := range upstreamIDPs.GetSAMLIdentityProviders() {
+		if p.GetName() == upstreamName {
+			return p
+		}
+	}
+	return nil
+}
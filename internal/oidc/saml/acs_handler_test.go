@@ -0,0 +1,565 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package saml
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	supervisorfake "go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned/fake"
+	"go.pinniped.dev/internal/auditlog"
+	"go.pinniped.dev/internal/celtransformer"
+	consentstorage "go.pinniped.dev/internal/fositestorage/consent"
+	"go.pinniped.dev/internal/fositestorage/consentrequest"
+	"go.pinniped.dev/internal/fositestorage/samlassertion"
+	"go.pinniped.dev/internal/oidc"
+	"go.pinniped.dev/internal/oidc/consent"
+	"go.pinniped.dev/internal/oidc/jwks"
+	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/oidc/provider/branding"
+	"go.pinniped.dev/internal/psession"
+	"go.pinniped.dev/internal/testutil"
+	"go.pinniped.dev/internal/testutil/oidctestutil"
+	"go.pinniped.dev/internal/testutil/samltestutil"
+	"go.pinniped.dev/internal/upstreamsaml"
+)
+
+const (
+	happyUpstreamIDPName        = "upstream-saml-idp-name"
+	happyUpstreamIDPResourceUID = "upstream-uid"
+	happyUpstreamEntityID       = "https://saml-idp.example.com/metadata"
+
+	upstreamNameID            = "some NameID" // has a space character which should get escaped in the subject
+	upstreamNameIDQueryEscape = "some+NameID"
+	upstreamUsernameAttribute = "the-username-attribute"
+	upstreamGroupsAttribute   = "the-groups-attribute"
+	upstreamUsername          = "test-pinniped-username"
+
+	happyDownstreamState        = "8b-state"
+	happyDownstreamCSRF         = "test-csrf"
+	happyDownstreamPKCE         = "test-pkce"
+	happyDownstreamNonce        = "test-nonce"
+	happyDownstreamStateVersion = "2"
+
+	downstreamIssuer              = "https://my-downstream-issuer.com/path"
+	downstreamRedirectURI         = "http://127.0.0.1/callback"
+	downstreamPinnipedClientID    = "pinniped-cli"
+	downstreamNonce               = "some-nonce-value"
+	downstreamPKCEChallenge       = "some-challenge"
+	downstreamPKCEChallengeMethod = "S256"
+
+	happySAMLResponse = "some-saml-response"
+
+	htmlContentType = "text/html; charset=utf-8"
+)
+
+var (
+	upstreamGroupMembership        = []string{"test-pinniped-group-0", "test-pinniped-group-1"}
+	happyDownstreamScopesRequested = []string{"openid", "username", "groups"}
+	happyDownstreamScopesGranted   = []string{"openid", "username", "groups"}
+
+	happyDownstreamRequestParams = url.Values{
+		"response_type":         []string{"code"},
+		"scope":                 []string{strings.Join(happyDownstreamScopesRequested, " ")},
+		"client_id":             []string{downstreamPinnipedClientID},
+		"state":                 []string{happyDownstreamState},
+		"nonce":                 []string{downstreamNonce},
+		"code_challenge":        []string{downstreamPKCEChallenge},
+		"code_challenge_method": []string{downstreamPKCEChallengeMethod},
+		"redirect_uri":          []string{downstreamRedirectURI},
+	}.Encode()
+
+	happySP = provider.SAMLServiceProvider{
+		EntityID: downstreamIssuer + "/saml/metadata",
+		ACSURL:   downstreamIssuer + "/saml/acs",
+	}
+)
+
+func TestACSEndpoint(t *testing.T) {
+	const (
+		transformationUsernamePrefix = "username_prefix:"
+		transformationGroupsPrefix   = "groups_prefix:"
+	)
+
+	prefixUsernameAndGroupsPipeline := oidctestutil.NewTransformationPipeline(t, nil,
+		&celtransformer.UsernameTransformation{Expression: fmt.Sprintf(`"%s" + username`, transformationUsernamePrefix)},
+		&celtransformer.GroupsTransformation{Expression: fmt.Sprintf(`groups.map(g, "%s" + g)`, transformationGroupsPrefix)},
+	)
+
+	rejectAuthPipeline := oidctestutil.NewTransformationPipeline(t, nil,
+		&celtransformer.AllowAuthenticationPolicy{
+			Expression:                    `"admins" in groups`,
+			RejectedAuthenticationMessage: "only admins may log in",
+		},
+	)
+
+	var happyStateCodec = securecookie.New([]byte("fake-hash-secret"), []byte("0123456789ABCDEF"))
+	happyStateCodec.SetSerializer(securecookie.JSONEncoder{})
+
+	happyState := happyUpstreamStateParam().Build(t, happyStateCodec)
+	happyCookie := oidc.SAMLRequestCookieNamePrefix + happyDownstreamNonce + "=" + happyState
+
+	sessionNotOnOrAfter := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	happyAssertionID := "some-assertion-id"
+
+	happyAssertion := func() *provider.SAMLAssertion {
+		return &provider.SAMLAssertion{
+			NameID: upstreamNameID,
+			Attributes: map[string][]string{
+				upstreamUsernameAttribute: {upstreamUsername},
+				upstreamGroupsAttribute:   upstreamGroupMembership,
+				"other-attribute":         {"should be ignored"},
+			},
+			SessionNotOnOrAfter: &sessionNotOnOrAfter,
+			ID:                  happyAssertionID,
+			NotOnOrAfter:        time.Now().Add(5 * time.Minute),
+		}
+	}
+
+	happyUpstream := func() *oidctestutil.TestUpstreamSAMLIdentityProvider {
+		return &oidctestutil.TestUpstreamSAMLIdentityProvider{
+			Name:              happyUpstreamIDPName,
+			ResourceUID:       happyUpstreamIDPResourceUID,
+			EntityID:          happyUpstreamEntityID,
+			UsernameAttribute: upstreamUsernameAttribute,
+			GroupsAttribute:   upstreamGroupsAttribute,
+			ValidateResponseFunc: func(_ provider.SAMLServiceProvider, _ string, _ string) (*provider.SAMLAssertion, error) {
+				return happyAssertion(), nil
+			},
+		}
+	}
+
+	happyDownstreamCustomSessionData := func(username string, groups []string, sessionNotOnOrAfter *time.Time) *psession.CustomSessionData {
+		return &psession.CustomSessionData{
+			Username:         username,
+			UpstreamUsername: upstreamUsername,
+			UpstreamGroups:   groups,
+			ProviderUID:      happyUpstreamIDPResourceUID,
+			ProviderName:     happyUpstreamIDPName,
+			ProviderType:     psession.ProviderTypeSAML,
+			SAML: &psession.SAMLSessionData{
+				UpstreamEntityID:    happyUpstreamEntityID,
+				UpstreamNameID:      upstreamNameID,
+				SessionNotOnOrAfter: sessionNotOnOrAfter,
+			},
+		}
+	}
+
+	// The stand-in IDP produces real signed responses, which are validated by a real upstream provider config.
+	standInIDP := samltestutil.NewIdentityProvider(t, happyUpstreamEntityID)
+	standInIDPConfig := &upstreamsaml.ProviderConfig{
+		Name:                happyUpstreamIDPName,
+		ResourceUID:         happyUpstreamIDPResourceUID,
+		EntityID:            happyUpstreamEntityID,
+		SigningCertificates: []*x509.Certificate{standInIDP.Cert},
+		UsernameAttribute:   upstreamUsernameAttribute,
+		GroupsAttribute:     upstreamGroupsAttribute,
+	}
+	standInIDPResponse := standInIDP.NewResponse(happySP, oidc.SAMLRequestID(happyDownstreamNonce), upstreamNameID)
+	standInIDPResponse.Attributes = map[string][]string{
+		upstreamUsernameAttribute: {upstreamUsername},
+		upstreamGroupsAttribute:   upstreamGroupMembership,
+	}
+	standInIDPEncodedResponse := standInIDP.Encode(t, standInIDPResponse)
+
+	happyDownstreamRedirectLocationRegexp := downstreamRedirectURI + `\?code=([^&]+)&scope=openid\+username\+groups&state=` + happyDownstreamState
+
+	tests := []struct {
+		name string
+
+		idps          *oidctestutil.UpstreamIDPListerBuilder
+		method        string
+		form          url.Values
+		cookie        string
+		wantResponse  string // the SAMLResponse which should be passed to the upstream provider, when not the happy one
+		assertionUsed bool   // whether the happy assertion was already used before the request
+
+		wantStatus                      int
+		wantContentType                 string
+		wantBody                        string
+		wantRedirectLocationRegexp      string
+		wantDownstreamIDTokenSubject    string
+		wantDownstreamIDTokenUsername   string
+		wantDownstreamIDTokenGroups     []string
+		wantDownstreamCustomSessionData *psession.CustomSessionData
+		wantValidateResponseCall        bool
+		wantAuditEventType              auditlog.EventType
+	}{
+		{
+			name:                            "POST with good RelayState and cookie and valid SAMLResponse returns 303 to downstream client callback with its state and code",
+			idps:                            oidctestutil.NewUpstreamIDPListerBuilder().WithSAML(happyUpstream()),
+			method:                          http.MethodPost,
+			form:                            happyForm(),
+			cookie:                          happyCookie,
+			wantStatus:                      http.StatusSeeOther,
+			wantRedirectLocationRegexp:      happyDownstreamRedirectLocationRegexp,
+			wantDownstreamIDTokenSubject:    happyUpstreamEntityID + "?sub=" + upstreamNameIDQueryEscape,
+			wantDownstreamIDTokenUsername:   upstreamUsername,
+			wantDownstreamIDTokenGroups:     upstreamGroupMembership,
+			wantDownstreamCustomSessionData: happyDownstreamCustomSessionData(upstreamUsername, upstreamGroupMembership, &sessionNotOnOrAfter),
+			wantValidateResponseCall:        true,
+			wantAuditEventType:              auditlog.UpstreamLoginSucceeded,
+		},
+		{
+			name: "POST with a real signed response from the stand-in IDP returns 303 to downstream client callback",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithSAML(&oidctestutil.TestUpstreamSAMLIdentityProvider{
+				Name:                 happyUpstreamIDPName,
+				ResourceUID:          happyUpstreamIDPResourceUID,
+				EntityID:             happyUpstreamEntityID,
+				UsernameAttribute:    upstreamUsernameAttribute,
+				GroupsAttribute:      upstreamGroupsAttribute,
+				ValidateResponseFunc: standInIDPConfig.ValidateResponse,
+			}),
+			method:                          http.MethodPost,
+			form:                            url.Values{"SAMLResponse": {standInIDPEncodedResponse}, "RelayState": {happyDownstreamNonce}},
+			cookie:                          happyCookie,
+			wantResponse:                    standInIDPEncodedResponse,
+			wantStatus:                      http.StatusSeeOther,
+			wantRedirectLocationRegexp:      happyDownstreamRedirectLocationRegexp,
+			wantDownstreamIDTokenSubject:    happyUpstreamEntityID + "?sub=" + upstreamNameIDQueryEscape,
+			wantDownstreamIDTokenUsername:   upstreamUsername,
+			wantDownstreamIDTokenGroups:     upstreamGroupMembership,
+			wantDownstreamCustomSessionData: happyDownstreamCustomSessionData(upstreamUsername, upstreamGroupMembership, nil),
+			wantValidateResponseCall:        true,
+			wantAuditEventType:              auditlog.UpstreamLoginSucceeded,
+		},
+		{
+			name: "POST with identity transformations returns 303 to downstream client callback with transformed identity",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithSAML(happyUpstream()).
+				WithIdentityTransformations(happyUpstreamIDPName, psession.ProviderTypeSAML, prefixUsernameAndGroupsPipeline),
+			method:                        http.MethodPost,
+			form:                          happyForm(),
+			cookie:                        happyCookie,
+			wantStatus:                    http.StatusSeeOther,
+			wantRedirectLocationRegexp:    happyDownstreamRedirectLocationRegexp,
+			wantDownstreamIDTokenSubject:  happyUpstreamEntityID + "?sub=" + upstreamNameIDQueryEscape,
+			wantDownstreamIDTokenUsername: transformationUsernamePrefix + upstreamUsername,
+			wantDownstreamIDTokenGroups:   testutil.AddPrefixToEach(transformationGroupsPrefix, upstreamGroupMembership),
+			wantDownstreamCustomSessionData: happyDownstreamCustomSessionData(
+				transformationUsernamePrefix+upstreamUsername, upstreamGroupMembership, &sessionNotOnOrAfter),
+			wantValidateResponseCall: true,
+			wantAuditEventType:       auditlog.UpstreamLoginSucceeded,
+		},
+		{
+			name: "POST when the identity policy rejects the user returns 422",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithSAML(happyUpstream()).
+				WithIdentityTransformations(happyUpstreamIDPName, psession.ProviderTypeSAML, rejectAuthPipeline),
+			method:                   http.MethodPost,
+			form:                     happyForm(),
+			cookie:                   happyCookie,
+			wantStatus:               http.StatusUnprocessableEntity,
+			wantContentType:          htmlContentType,
+			wantBody:                 "Unprocessable Entity: configured identity policy rejected this authentication: only admins may log in\n",
+			wantValidateResponseCall: true,
+			wantAuditEventType:       auditlog.UpstreamLoginFailed,
+		},
+		{
+			name: "POST when no username attribute is configured uses the NameID as the username",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithSAML(func() *oidctestutil.TestUpstreamSAMLIdentityProvider {
+				p := happyUpstream()
+				p.UsernameAttribute = ""
+				p.GroupsAttribute = ""
+				return p
+			}()),
+			method:                        http.MethodPost,
+			form:                          happyForm(),
+			cookie:                        happyCookie,
+			wantStatus:                    http.StatusSeeOther,
+			wantRedirectLocationRegexp:    happyDownstreamRedirectLocationRegexp,
+			wantDownstreamIDTokenSubject:  happyUpstreamEntityID + "?sub=" + upstreamNameIDQueryEscape,
+			wantDownstreamIDTokenUsername: upstreamNameID,
+			wantDownstreamIDTokenGroups:   []string{},
+			wantDownstreamCustomSessionData: func() *psession.CustomSessionData {
+				d := happyDownstreamCustomSessionData(upstreamNameID, nil, &sessionNotOnOrAfter)
+				d.UpstreamUsername = upstreamNameID
+				return d
+			}(),
+			wantValidateResponseCall: true,
+			wantAuditEventType:       auditlog.UpstreamLoginSucceeded,
+		},
+		{
+			name: "POST when the assertion is missing the configured username attribute returns 422",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithSAML(func() *oidctestutil.TestUpstreamSAMLIdentityProvider {
+				p := happyUpstream()
+				p.UsernameAttribute = "some-missing-attribute"
+				return p
+			}()),
+			method:                   http.MethodPost,
+			form:                     happyForm(),
+			cookie:                   happyCookie,
+			wantStatus:               http.StatusUnprocessableEntity,
+			wantContentType:          htmlContentType,
+			wantBody:                 "Unprocessable Entity: required attribute in upstream SAML assertion missing\n",
+			wantValidateResponseCall: true,
+			wantAuditEventType:       auditlog.UpstreamLoginFailed,
+		},
+		{
+			name: "POST when the upstream provider rejects the SAMLResponse returns 422",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithSAML(func() *oidctestutil.TestUpstreamSAMLIdentityProvider {
+				p := happyUpstream()
+				p.ValidateResponseFunc = func(_ provider.SAMLServiceProvider, _ string, _ string) (*provider.SAMLAssertion, error) {
+					return nil, errors.New("some validation error")
+				}
+				return p
+			}()),
+			method:                   http.MethodPost,
+			form:                     happyForm(),
+			cookie:                   happyCookie,
+			wantStatus:               http.StatusUnprocessableEntity,
+			wantContentType:          htmlContentType,
+			wantBody:                 "Unprocessable Entity: error validating upstream SAML response\n",
+			wantValidateResponseCall: true,
+			wantAuditEventType:       auditlog.UpstreamLoginFailed,
+		},
+		{
+			name:                     "POST with an assertion which was already used returns 422",
+			idps:                     oidctestutil.NewUpstreamIDPListerBuilder().WithSAML(happyUpstream()),
+			method:                   http.MethodPost,
+			form:                     happyForm(),
+			cookie:                   happyCookie,
+			assertionUsed:            true,
+			wantStatus:               http.StatusUnprocessableEntity,
+			wantContentType:          htmlContentType,
+			wantBody:                 "Unprocessable Entity: upstream SAML assertion was already used\n",
+			wantValidateResponseCall: true,
+			wantAuditEventType:       auditlog.UpstreamLoginFailed,
+		},
+		{
+			name:            "GET is not allowed",
+			idps:            oidctestutil.NewUpstreamIDPListerBuilder().WithSAML(happyUpstream()),
+			method:          http.MethodGet,
+			cookie:          happyCookie,
+			wantStatus:      http.StatusMethodNotAllowed,
+			wantContentType: htmlContentType,
+			wantBody:        "Method Not Allowed: GET (try POST)\n",
+		},
+		{
+			name:            "POST without RelayState returns 400",
+			idps:            oidctestutil.NewUpstreamIDPListerBuilder().WithSAML(happyUpstream()),
+			method:          http.MethodPost,
+			form:            url.Values{"SAMLResponse": {happySAMLResponse}},
+			cookie:          happyCookie,
+			wantStatus:      http.StatusBadRequest,
+			wantContentType: htmlContentType,
+			wantBody:        "Bad Request: RelayState param not found\n",
+		},
+		{
+			name:            "POST without the SAML request cookie returns 403",
+			idps:            oidctestutil.NewUpstreamIDPListerBuilder().WithSAML(happyUpstream()),
+			method:          http.MethodPost,
+			form:            happyForm(),
+			wantStatus:      http.StatusForbidden,
+			wantContentType: htmlContentType,
+			wantBody:        "Forbidden: SAML request cookie is missing\n",
+		},
+		{
+			name:            "POST with a SAML request cookie which cannot be decoded returns 400",
+			idps:            oidctestutil.NewUpstreamIDPListerBuilder().WithSAML(happyUpstream()),
+			method:          http.MethodPost,
+			form:            happyForm(),
+			cookie:          oidc.SAMLRequestCookieNamePrefix + happyDownstreamNonce + "=garbage",
+			wantStatus:      http.StatusBadRequest,
+			wantContentType: htmlContentType,
+			wantBody:        "Bad Request: error reading state\n",
+		},
+		{
+			name:   "POST with state of the wrong upstream type returns 400",
+			idps:   oidctestutil.NewUpstreamIDPListerBuilder().WithSAML(happyUpstream()),
+			method: http.MethodPost,
+			form:   happyForm(),
+			cookie: oidc.SAMLRequestCookieNamePrefix + happyDownstreamNonce + "=" +
+				happyUpstreamStateParam().WithUpstreamIDPType("oidc").Build(t, happyStateCodec),
+			wantStatus:      http.StatusBadRequest,
+			wantContentType: htmlContentType,
+			wantBody:        "Bad Request: state does not belong to this SAML response\n",
+		},
+		{
+			name:   "POST with state of an unsupported format version returns 422",
+			idps:   oidctestutil.NewUpstreamIDPListerBuilder().WithSAML(happyUpstream()),
+			method: http.MethodPost,
+			form:   happyForm(),
+			cookie: oidc.SAMLRequestCookieNamePrefix + happyDownstreamNonce + "=" +
+				happyUpstreamStateParam().WithStateVersion("wrong").Build(t, happyStateCodec),
+			wantStatus:      http.StatusUnprocessableEntity,
+			wantContentType: htmlContentType,
+			wantBody:        "Unprocessable Entity: state format version is invalid\n",
+		},
+		{
+			name:            "POST without SAMLResponse returns 400",
+			idps:            oidctestutil.NewUpstreamIDPListerBuilder().WithSAML(happyUpstream()),
+			method:          http.MethodPost,
+			form:            url.Values{"RelayState": {happyDownstreamNonce}},
+			cookie:          happyCookie,
+			wantStatus:      http.StatusBadRequest,
+			wantContentType: htmlContentType,
+			wantBody:        "Bad Request: SAMLResponse param not found\n",
+		},
+		{
+			name:            "POST when the upstream provider no longer exists returns 422",
+			idps:            oidctestutil.NewUpstreamIDPListerBuilder(),
+			method:          http.MethodPost,
+			form:            happyForm(),
+			cookie:          happyCookie,
+			wantStatus:      http.StatusUnprocessableEntity,
+			wantContentType: htmlContentType,
+			wantBody:        "Unprocessable Entity: upstream provider not found\n",
+		},
+	}
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			kubeClient := fake.NewSimpleClientset()
+			supervisorClient := supervisorfake.NewSimpleClientset()
+			secrets := kubeClient.CoreV1().Secrets("some-namespace")
+			oidcClientsClient := supervisorClient.ConfigV1alpha1().OIDCClients("some-namespace")
+
+			// Configure fosite the same way that the production code would.
+			timeoutsConfiguration := oidc.DefaultOIDCTimeoutsConfiguration()
+			// Use lower minimum required bcrypt cost than we would use in production to keep unit the tests fast.
+			oauthStore := oidc.NewKubeStorage(secrets, oidcClientsClient, downstreamIssuer, timeoutsConfiguration, bcrypt.MinCost)
+			hmacSecretFunc := func() []byte { return []byte("some secret - must have at least 32 bytes") }
+			jwksProviderIsUnused := jwks.NewDynamicJWKSProvider()
+			oauthHelper := oidc.FositeOauth2Helper(oauthStore, downstreamIssuer, hmacSecretFunc, nil, jwksProviderIsUnused, timeoutsConfiguration, nil)
+
+			consentResponder := consent.NewResponder(downstreamIssuer,
+				consentstorage.New(secrets, time.Now, time.Hour),
+				consentrequest.New(secrets, time.Now, time.Hour),
+				time.Hour)
+
+			idps := test.idps.Build()
+			auditLogger := auditlog.NewTestLogger(t)
+			// Use a separate client for the assertion storage, so that the checks of the authcode storage are not affected.
+			assertionSecrets := fake.NewSimpleClientset().CoreV1().Secrets("some-namespace")
+			assertionStorage := samlassertion.New(assertionSecrets, time.Now)
+			if test.assertionUsed {
+				require.NoError(t, assertionStorage.UseAssertion(context.Background(), happyAssertionID, "id-"+happyDownstreamNonce, time.Now().Add(time.Minute)))
+			}
+			subject := NewACSHandler(downstreamIssuer, idps, oauthHelper, happyStateCodec, assertionStorage, consentResponder, branding.None, auditLogger)
+
+			var body *strings.Reader
+			if test.form != nil {
+				body = strings.NewReader(test.form.Encode())
+			} else {
+				body = strings.NewReader("")
+			}
+			req := httptest.NewRequest(test.method, "/downstream-provider-name/saml/acs", body)
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if test.cookie != "" {
+				req.Header.Set("Cookie", test.cookie)
+			}
+			rsp := httptest.NewRecorder()
+			subject.ServeHTTP(rsp, req)
+			t.Logf("response: %#v", rsp)
+			t.Logf("response body: %q", rsp.Body.String())
+
+			testutil.RequireSecurityHeadersWithFormPostPageCSPs(t, rsp)
+
+			samlUpstreams := idps.GetSAMLIdentityProviders()
+			if test.wantValidateResponseCall {
+				require.Len(t, samlUpstreams, 1)
+				testUpstream := samlUpstreams[0].(*oidctestutil.TestUpstreamSAMLIdentityProvider)
+				require.Equal(t, 1, testUpstream.ValidateResponseCallCount())
+				wantResponse := happySAMLResponse
+				if test.wantResponse != "" {
+					wantResponse = test.wantResponse
+				}
+				require.Equal(t, &oidctestutil.ValidateResponseArgs{
+					SP:           happySP,
+					SAMLResponse: wantResponse,
+					RequestID:    "id-" + happyDownstreamNonce,
+				}, testUpstream.ValidateResponseArgs(0))
+			} else {
+				for _, p := range samlUpstreams {
+					require.Zero(t, p.(*oidctestutil.TestUpstreamSAMLIdentityProvider).ValidateResponseCallCount())
+				}
+			}
+
+			require.Equal(t, test.wantStatus, rsp.Code)
+			testutil.RequireEqualContentType(t, rsp.Header().Get("Content-Type"), test.wantContentType)
+
+			if test.wantRedirectLocationRegexp != "" {
+				// The assertion must not be accepted again.
+				usedAssertions, err := assertionSecrets.List(context.Background(), metav1.ListOptions{})
+				require.NoError(t, err)
+				require.Len(t, usedAssertions.Items, 1)
+
+				require.Empty(t, rsp.Body.String())
+				require.Len(t, rsp.Header().Values("Location"), 1)
+				oidctestutil.RequireAuthCodeRegexpMatch(
+					t,
+					rsp.Header().Get("Location"),
+					test.wantRedirectLocationRegexp,
+					kubeClient,
+					secrets,
+					oauthStore,
+					happyDownstreamScopesGranted,
+					test.wantDownstreamIDTokenSubject,
+					test.wantDownstreamIDTokenUsername,
+					test.wantDownstreamIDTokenGroups,
+					happyDownstreamScopesRequested,
+					downstreamPKCEChallenge,
+					downstreamPKCEChallengeMethod,
+					downstreamNonce,
+					downstreamPinnipedClientID,
+					downstreamRedirectURI,
+					test.wantDownstreamCustomSessionData,
+					map[string]interface{}{},
+				)
+			} else {
+				require.Equal(t, test.wantBody, rsp.Body.String())
+			}
+
+			// Once the cookie was found, it should always be deleted, since each SAML response may only be used once.
+			if test.cookie != "" && test.form.Get("RelayState") != "" {
+				deletedCookie := rsp.Header().Get("Set-Cookie")
+				require.True(t, strings.HasPrefix(deletedCookie, oidc.SAMLRequestCookieNamePrefix+happyDownstreamNonce+"=;"), deletedCookie)
+				require.Contains(t, deletedCookie, "Max-Age=0")
+			}
+
+			auditEvents := auditLogger.Events()
+			if test.wantAuditEventType == "" {
+				require.Empty(t, auditEvents)
+			} else {
+				require.Len(t, auditEvents, 1)
+				require.Equal(t, test.wantAuditEventType, auditEvents[0].Type)
+				require.NotEmpty(t, auditEvents[0].CorrelationID)
+				require.Equal(t, happyUpstreamIDPName, auditEvents[0].UpstreamIDP.Name)
+			}
+		})
+	}
+}
+
+func happyForm() url.Values {
+	return url.Values{
+		"SAMLResponse": {happySAMLResponse},
+		"RelayState":   {happyDownstreamNonce},
+	}
+}
+
+func happyUpstreamStateParam() *oidctestutil.UpstreamStateParamBuilder {
+	return &oidctestutil.UpstreamStateParamBuilder{
+		U: happyUpstreamIDPName,
+		P: happyDownstreamRequestParams,
+		T: "saml",
+		N: happyDownstreamNonce,
+		C: happyDownstreamCSRF,
+		K: happyDownstreamPKCE,
+		V: happyDownstreamStateVersion,
+	}
+}
@@ -0,0 +1,33 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package saml
+
+import (
+	"net/http"
+
+	"go.pinniped.dev/internal/httputil/httperr"
+	"go.pinniped.dev/internal/oidc"
+	"go.pinniped.dev/internal/upstreamsaml"
+)
+
+const metadataContentType = "application/samlmetadata+xml"
+
+// NewMetadataHandler returns the handler which serves the SAML service provider metadata of the FederationDomain
+// with the given issuer. Admins register this metadata with their upstream SAML IDPs.
+func NewMetadataHandler(downstreamIssuer string) http.Handler {
+	return httperr.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		if r.Method != http.MethodGet {
+			return httperr.Newf(http.StatusMethodNotAllowed, "%s (try GET)", r.Method)
+		}
+
+		metadata, err := upstreamsaml.ServiceProviderMetadata(oidc.SAMLServiceProviderForIssuer(downstreamIssuer))
+		if err != nil {
+			return httperr.Wrap(http.StatusInternalServerError, "error encoding metadata", err)
+		}
+
+		w.Header().Set("Content-Type", metadataContentType)
+		_, _ = w.Write(metadata)
+		return nil
+	})
+}
@@ -0,0 +1,34 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package saml
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetadataEndpoint(t *testing.T) {
+	subject := NewMetadataHandler(downstreamIssuer)
+
+	t.Run("GET returns the service provider metadata", func(t *testing.T) {
+		rsp := httptest.NewRecorder()
+		subject.ServeHTTP(rsp, httptest.NewRequest(http.MethodGet, "/downstream-provider-name/saml/metadata", nil))
+
+		require.Equal(t, http.StatusOK, rsp.Code)
+		require.Equal(t, "application/samlmetadata+xml", rsp.Header().Get("Content-Type"))
+		require.Contains(t, rsp.Body.String(), `entityID="`+happySP.EntityID+`"`)
+		require.Contains(t, rsp.Body.String(), `Location="`+happySP.ACSURL+`"`)
+	})
+
+	t.Run("POST is not allowed", func(t *testing.T) {
+		rsp := httptest.NewRecorder()
+		subject.ServeHTTP(rsp, httptest.NewRequest(http.MethodPost, "/downstream-provider-name/saml/metadata", nil))
+
+		require.Equal(t, http.StatusMethodNotAllowed, rsp.Code)
+		require.Equal(t, "Method Not Allowed: POST (try GET)\n", rsp.Body.String())
+	})
+}
@@ -0,0 +1,84 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package oidc
+
+import (
+	"context"
+	"time"
+
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/compose"
+	"github.com/pkg/errors"
+
+	"go.pinniped.dev/internal/psession"
+)
+
+// MaxSessionLifespanFactory returns a factory which creates a token endpoint handler that enforces the maximum length
+// of a downstream session. Fosite gives each refreshed refresh token a full new lifetime, so it has no concept of the
+// total length of a session. This handler caps the expiry times of the tokens issued by the authcode and refresh
+// grants at the end of the session, and rejects refreshes of sessions which have already ended. A maxSessionLifespan
+// of zero means that sessions have no maximum length, in which case the handler does nothing.
+func MaxSessionLifespanFactory(maxSessionLifespan time.Duration) compose.Factory {
+	return func(config fosite.Configurator, _ interface{}, _ interface{}) interface{} {
+		return &maxSessionLifespanHandler{
+			config:             config,
+			maxSessionLifespan: maxSessionLifespan,
+		}
+	}
+}
+
+type maxSessionLifespanHandler struct {
+	config             fosite.IDTokenLifespanProvider
+	maxSessionLifespan time.Duration
+}
+
+var _ fosite.TokenEndpointHandler = (*maxSessionLifespanHandler)(nil)
+
+func (h *maxSessionLifespanHandler) HandleTokenEndpointRequest(ctx context.Context, requester fosite.AccessRequester) error {
+	if !h.CanHandleTokenEndpointRequest(ctx, requester) {
+		return errors.WithStack(fosite.ErrUnknownRequest)
+	}
+
+	// The grant handlers which ran before this handler have already restored the session from storage
+	// and have set the expiry times of the new access and refresh tokens.
+	session, ok := requester.GetSession().(*psession.PinnipedSession)
+	if !ok || session.Fosite == nil || session.Fosite.Claims == nil || session.Fosite.Claims.AuthTime.IsZero() {
+		// Sessions always have an auth time, but if one does not, then there is no way to know when it ends.
+		return nil
+	}
+
+	now := time.Now().UTC()
+	sessionEnd := session.Fosite.Claims.AuthTime.Add(h.maxSessionLifespan).UTC()
+
+	if !now.Before(sessionEnd) {
+		return errors.WithStack(fosite.ErrInvalidGrant.WithHint("The session has reached its maximum length. Please log in again."))
+	}
+
+	for _, tokenType := range []fosite.TokenType{fosite.AccessToken, fosite.RefreshToken} {
+		if expiresAt := session.GetExpiresAt(tokenType); !expiresAt.IsZero() && expiresAt.After(sessionEnd) {
+			session.SetExpiresAt(tokenType, sessionEnd)
+		}
+	}
+
+	// Fosite only computes the expiry of the ID token when it is issued, unless the session already has one.
+	if now.Add(h.config.GetIDTokenLifespan(ctx)).After(sessionEnd) {
+		session.IDTokenClaims().ExpiresAt = sessionEnd
+	}
+
+	return nil
+}
+
+func (h *maxSessionLifespanHandler) PopulateTokenEndpointResponse(_ context.Context, _ fosite.AccessRequester, _ fosite.AccessResponder) error {
+	// This handler only adjusts the request, so it never contributes to the response.
+	return errors.WithStack(fosite.ErrUnknownRequest)
+}
+
+func (h *maxSessionLifespanHandler) CanSkipClientAuth(_ context.Context, _ fosite.AccessRequester) bool {
+	return false
+}
+
+func (h *maxSessionLifespanHandler) CanHandleTokenEndpointRequest(_ context.Context, requester fosite.AccessRequester) bool {
+	return h.maxSessionLifespan > 0 &&
+		(requester.GetGrantTypes().ExactOne("authorization_code") || requester.GetGrantTypes().ExactOne("refresh_token"))
+}
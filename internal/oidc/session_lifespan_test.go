@@ -0,0 +1,173 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package oidc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ory/fosite"
+	"github.com/stretchr/testify/require"
+
+	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/psession"
+	"go.pinniped.dev/internal/testutil"
+)
+
+func TestMaxSessionLifespanHandler(t *testing.T) {
+	const idTokenLifespan = 5 * time.Minute
+
+	now := time.Now().UTC().Truncate(time.Second)
+
+	tests := []struct {
+		name               string
+		maxSessionLifespan time.Duration
+		grantType          string
+		authTime           time.Time
+		accessTokenExpiry  time.Time
+		refreshTokenExpiry time.Time
+
+		wantErr            string
+		wantUnknownRequest bool
+		wantAccessExpiry   time.Time
+		wantRefreshExpiry  time.Time
+		wantIDTokenExpiry  time.Time
+	}{
+		{
+			name:               "no maximum session length",
+			maxSessionLifespan: 0,
+			grantType:          "refresh_token",
+			authTime:           now.Add(-100 * time.Hour),
+			wantUnknownRequest: true,
+		},
+		{
+			name:               "unsupported grant type",
+			maxSessionLifespan: 8 * time.Hour,
+			grantType:          "urn:ietf:params:oauth:grant-type:token-exchange",
+			authTime:           now.Add(-100 * time.Hour),
+			wantUnknownRequest: true,
+		},
+		{
+			name:               "authcode grant for a new session which ends after all of its tokens expire",
+			maxSessionLifespan: 8 * time.Hour,
+			grantType:          "authorization_code",
+			authTime:           now,
+			accessTokenExpiry:  now.Add(2 * time.Minute),
+			refreshTokenExpiry: now.Add(4 * time.Hour),
+			wantAccessExpiry:   now.Add(2 * time.Minute),
+			wantRefreshExpiry:  now.Add(4 * time.Hour),
+		},
+		{
+			name:               "authcode grant for a new session which ends before its refresh token expires",
+			maxSessionLifespan: 1 * time.Hour,
+			grantType:          "authorization_code",
+			authTime:           now,
+			accessTokenExpiry:  now.Add(2 * time.Minute),
+			refreshTokenExpiry: now.Add(9 * time.Hour),
+			wantAccessExpiry:   now.Add(2 * time.Minute),
+			wantRefreshExpiry:  now.Add(1 * time.Hour),
+		},
+		{
+			name:               "refresh grant for a session which ends before its new tokens would expire",
+			maxSessionLifespan: 8 * time.Hour,
+			grantType:          "refresh_token",
+			authTime:           now.Add(-8 * time.Hour).Add(time.Minute),
+			accessTokenExpiry:  now.Add(2 * time.Minute),
+			refreshTokenExpiry: now.Add(4 * time.Hour),
+			wantAccessExpiry:   now.Add(time.Minute),
+			wantRefreshExpiry:  now.Add(time.Minute),
+			wantIDTokenExpiry:  now.Add(time.Minute),
+		},
+		{
+			name:               "refresh grant for a session which has already ended",
+			maxSessionLifespan: 8 * time.Hour,
+			grantType:          "refresh_token",
+			authTime:           now.Add(-8 * time.Hour),
+			accessTokenExpiry:  now.Add(2 * time.Minute),
+			refreshTokenExpiry: now.Add(4 * time.Hour),
+			wantErr:            "The provided authorization grant (e.g., authorization code, resource owner credentials) or refresh token is invalid, expired, revoked, does not match the redirection URI used in the authorization request, or was issued to another client. The session has reached its maximum length. Please log in again.",
+		},
+		{
+			name:               "session without an auth time",
+			maxSessionLifespan: 8 * time.Hour,
+			grantType:          "refresh_token",
+			accessTokenExpiry:  now.Add(2 * time.Minute),
+			refreshTokenExpiry: now.Add(4 * time.Hour),
+			wantAccessExpiry:   now.Add(2 * time.Minute),
+			wantRefreshExpiry:  now.Add(4 * time.Hour),
+		},
+	}
+	for _, test := range tests {
+		tt := test
+		t.Run(tt.name, func(t *testing.T) {
+			session := psession.NewPinnipedSession()
+			session.Fosite.Claims.AuthTime = tt.authTime
+			if !tt.accessTokenExpiry.IsZero() {
+				session.SetExpiresAt(fosite.AccessToken, tt.accessTokenExpiry)
+			}
+			if !tt.refreshTokenExpiry.IsZero() {
+				session.SetExpiresAt(fosite.RefreshToken, tt.refreshTokenExpiry)
+			}
+
+			requester := fosite.NewAccessRequest(session)
+			requester.GrantTypes = fosite.Arguments{tt.grantType}
+
+			config := &fosite.Config{IDTokenLifespan: idTokenLifespan}
+			handler := MaxSessionLifespanFactory(tt.maxSessionLifespan)(config, nil, nil).(fosite.TokenEndpointHandler)
+
+			err := handler.HandleTokenEndpointRequest(context.Background(), requester)
+			switch {
+			case tt.wantUnknownRequest:
+				require.ErrorIs(t, err, fosite.ErrUnknownRequest)
+				return
+			case tt.wantErr != "":
+				require.ErrorIs(t, err, fosite.ErrInvalidGrant)
+				require.Equal(t, tt.wantErr, fosite.ErrorToRFC6749Error(err).WithExposeDebug(true).GetDescription())
+				return
+			default:
+				require.NoError(t, err)
+			}
+
+			testutil.RequireTimeInDelta(t, tt.wantAccessExpiry, session.GetExpiresAt(fosite.AccessToken), time.Second)
+			testutil.RequireTimeInDelta(t, tt.wantRefreshExpiry, session.GetExpiresAt(fosite.RefreshToken), time.Second)
+			testutil.RequireTimeInDelta(t, tt.wantIDTokenExpiry, session.IDTokenClaims().ExpiresAt, time.Second)
+
+			// This handler never contributes to the token endpoint response.
+			require.ErrorIs(t, handler.PopulateTokenEndpointResponse(context.Background(), requester, fosite.NewAccessResponse()), fosite.ErrUnknownRequest)
+		})
+	}
+}
+
+func TestTimeoutsConfigurationForTokenLifetimes(t *testing.T) {
+	require.Equal(t, DefaultOIDCTimeoutsConfiguration(), TimeoutsConfigurationForTokenLifetimes(nil))
+	require.Equal(t, DefaultOIDCTimeoutsConfiguration(), TimeoutsConfigurationForTokenLifetimes(&provider.FederationDomainTokenLifetimes{}))
+
+	defaults := DefaultOIDCTimeoutsConfiguration()
+	require.Equal(t, 2*time.Minute, defaults.AccessTokenLifespan)
+	require.Equal(t, 2*time.Minute, defaults.IDTokenLifespan)
+	require.Equal(t, 9*time.Hour, defaults.RefreshTokenLifespan)
+	require.Zero(t, defaults.MaxSessionLifespan)
+
+	configured := TimeoutsConfigurationForTokenLifetimes(&provider.FederationDomainTokenLifetimes{
+		AccessToken:  5 * time.Minute,
+		RefreshToken: 1 * time.Hour,
+		MaxSession:   8 * time.Hour,
+	})
+	require.Equal(t, 5*time.Minute, configured.AccessTokenLifespan)
+	require.Equal(t, 5*time.Minute, configured.IDTokenLifespan) // defaults to the access token lifespan
+	require.Equal(t, 1*time.Hour, configured.RefreshTokenLifespan)
+	require.Equal(t, 8*time.Hour, configured.MaxSessionLifespan)
+	require.Equal(t, defaults.AuthorizeCodeLifespan, configured.AuthorizeCodeLifespan)
+	require.Equal(t, defaults.UpstreamStateParamLifespan, configured.UpstreamStateParamLifespan)
+
+	// The storage lifetimes must keep pace with the token lifetimes.
+	require.Equal(t, configured.AuthorizeCodeLifespan+1*time.Hour, configured.AuthorizationCodeSessionStorageLifetime)
+	require.Equal(t, 1*time.Hour+5*time.Minute, configured.AccessTokenSessionStorageLifetime)
+	require.Equal(t, 1*time.Hour+5*time.Minute, configured.RefreshTokenSessionStorageLifetime)
+
+	require.Equal(t, 30*time.Minute, TimeoutsConfigurationForTokenLifetimes(&provider.FederationDomainTokenLifetimes{
+		IDToken: 30 * time.Minute,
+	}).IDTokenLifespan)
+}
@@ -0,0 +1,139 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package token
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ory/fosite"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+
+	oidcapi "go.pinniped.dev/generated/latest/apis/supervisor/oidc"
+	"go.pinniped.dev/internal/fositestorage/devicecode"
+	"go.pinniped.dev/internal/oidc/device"
+	"go.pinniped.dev/internal/plog"
+)
+
+// These are the errors of the token endpoint for the device code grant which are not already defined by fosite.
+// See https://datatracker.ietf.org/doc/html/rfc8628#section-3.5.
+//
+//nolint:gochecknoglobals // these are effectively constants
+var (
+	errAuthorizationPending = &fosite.RFC6749Error{
+		ErrorField:       "authorization_pending",
+		DescriptionField: "The authorization request is still pending as the end user hasn't yet completed the user-interaction steps.",
+		CodeField:        http.StatusBadRequest,
+	}
+	errSlowDown = &fosite.RFC6749Error{
+		ErrorField:       "slow_down",
+		DescriptionField: "The authorization request is still pending and the client should poll less frequently.",
+		CodeField:        http.StatusBadRequest,
+	}
+	errExpiredToken = &fosite.RFC6749Error{
+		ErrorField:       "expired_token",
+		DescriptionField: "The device code has expired and the device authorization session has concluded.",
+		CodeField:        http.StatusBadRequest,
+	}
+	errDeviceAccessDenied = &fosite.RFC6749Error{
+		ErrorField:       "access_denied",
+		DescriptionField: "The end user denied the authorization request or their login failed.",
+		CodeField:        http.StatusBadRequest,
+	}
+)
+
+// exchangeDeviceCode handles a token request which uses the device code grant. While the user has not finished their
+// login, it returns the errors which tell the client to keep polling. After the user has finished their login, it
+// changes the request into a request which redeems the authcode that was issued to the device callback endpoint,
+// so the rest of the token endpoint can handle it like any other authcode redemption.
+//
+// The client is authenticated before the device code session is changed in any way, so a request which knows the
+// device code but cannot authenticate as its client cannot end the session or use up its polling interval.
+func exchangeDeviceCode(r *http.Request, oauthHelper device.ClientAuthenticator, storage devicecode.Storage, deviceCallbackURL string) error {
+	ctx := r.Context()
+
+	client, err := oauthHelper.AuthenticateClient(ctx, r, r.PostForm)
+	if err != nil {
+		return err
+	}
+
+	userCode, deviceCodeSecret, err := devicecode.SplitCode(r.PostForm.Get("device_code"))
+	if err != nil {
+		return fosite.ErrInvalidGrant.WithHint("The device code is invalid.")
+	}
+	session, resourceVersion, err := storage.Get(ctx, userCode)
+	if errors.Is(err, devicecode.ErrInvalidCode) {
+		return fosite.ErrInvalidGrant.WithHint("The device code is invalid.")
+	}
+	if err != nil {
+		return fosite.ErrServerError.WithWrap(err).WithDebug(err.Error())
+	}
+	if !devicecode.VerifyHash(deviceCodeSecret, session.DeviceCodeHash) {
+		return fosite.ErrInvalidGrant.WithHint("The device code is invalid.")
+	}
+	if client.GetID() != session.ClientID {
+		return fosite.ErrInvalidGrant.WithHint("The device code was issued to another client.")
+	}
+
+	now := time.Now()
+	if !now.Before(session.ExpiresAt) {
+		deleteDeviceCodeSession(r, storage, userCode)
+		return errExpiredToken
+	}
+
+	switch session.Status {
+	case devicecode.StatusDenied:
+		deleteDeviceCodeSession(r, storage, userCode)
+		return errDeviceAccessDenied
+
+	case devicecode.StatusApproved:
+		// Deleting the session makes sure that the device code can only be exchanged once.
+		if err := storage.Delete(ctx, userCode); err != nil {
+			if k8serrors.IsNotFound(err) {
+				return fosite.ErrInvalidGrant.WithHint("The device code is invalid.")
+			}
+			return fosite.ErrServerError.WithWrap(err).WithDebug(err.Error())
+		}
+		rewriteFormToRedeemAuthcode(r, session, deviceCallbackURL)
+		return nil
+
+	default:
+		pollingTooFast := !session.LastPolledAt.IsZero() && now.Sub(session.LastPolledAt) < device.PollingInterval
+		session.LastPolledAt = now
+		if err := storage.Update(ctx, userCode, resourceVersion, session); err != nil {
+			// Another request updated the session at the same time, so the client is polling too fast anyway.
+			plog.Debug("could not update device code session while polling", "err", err)
+			return errSlowDown
+		}
+		if pollingTooFast {
+			return errSlowDown
+		}
+		return errAuthorizationPending
+	}
+}
+
+func rewriteFormToRedeemAuthcode(r *http.Request, session *devicecode.Session, deviceCallbackURL string) {
+	form := url.Values{
+		"grant_type":    []string{oidcapi.GrantTypeAuthorizationCode},
+		"code":          []string{session.AuthorizationCode},
+		"redirect_uri":  []string{deviceCallbackURL},
+		"code_verifier": []string{session.CodeVerifier},
+	}
+	// Keep the params which are used for client authentication.
+	for _, param := range []string{"client_id", "client_secret", "client_assertion", "client_assertion_type"} {
+		if value := r.PostForm.Get(param); value != "" {
+			form.Set(param, value)
+		}
+	}
+	r.PostForm = form
+	r.Form = form
+}
+
+func deleteDeviceCodeSession(r *http.Request, storage devicecode.Storage, userCode string) {
+	if err := storage.Delete(r.Context(), userCode); err != nil && !k8serrors.IsNotFound(err) {
+		plog.Debug("could not delete device code session", "err", err)
+	}
+}
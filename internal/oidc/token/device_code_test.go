@@ -0,0 +1,226 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package token
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/fake"
+
+	supervisorfake "go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned/fake"
+	"go.pinniped.dev/internal/auditlog"
+	"go.pinniped.dev/internal/crud"
+	"go.pinniped.dev/internal/fositestorage/devicecode"
+	"go.pinniped.dev/internal/oidc"
+	"go.pinniped.dev/internal/testutil"
+	"go.pinniped.dev/internal/testutil/oidctestutil"
+)
+
+func TestTokenEndpointDeviceCodeGrant(t *testing.T) {
+	deviceCallbackURL := goodIssuer + oidc.DeviceCallbackEndpointPath
+
+	tests := []struct {
+		name          string
+		modifySession func(session *devicecode.Session, authCode string)
+		modifyRequest func(form url.Values)
+		wantStatus    int
+		wantError     string
+		wantDeleted   bool
+		// When clientSecret is set, the client authenticates using basic auth instead of sending its client_id.
+		clientSecret string
+	}{
+		{
+			name:       "login is still pending",
+			wantStatus: http.StatusBadRequest,
+			wantError:  "authorization_pending",
+		},
+		{
+			name: "client polls too quickly",
+			modifySession: func(session *devicecode.Session, _ string) {
+				session.LastPolledAt = time.Now().Add(-time.Second)
+			},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "slow_down",
+		},
+		{
+			name: "client polls slowly enough",
+			modifySession: func(session *devicecode.Session, _ string) {
+				session.LastPolledAt = time.Now().Add(-10 * time.Second)
+			},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "authorization_pending",
+		},
+		{
+			name: "device code has expired",
+			modifySession: func(session *devicecode.Session, _ string) {
+				session.ExpiresAt = time.Now().Add(-time.Second)
+			},
+			wantStatus:  http.StatusBadRequest,
+			wantError:   "expired_token",
+			wantDeleted: true,
+		},
+		{
+			name: "login failed",
+			modifySession: func(session *devicecode.Session, _ string) {
+				session.Status = devicecode.StatusDenied
+			},
+			wantStatus:  http.StatusBadRequest,
+			wantError:   "access_denied",
+			wantDeleted: true,
+		},
+		{
+			name: "device code belongs to another client",
+			modifyRequest: func(form url.Values) {
+				form.Set("client_id", dynamicClientID)
+			},
+			clientSecret: testutil.PlaintextPassword1,
+			wantStatus:   http.StatusBadRequest,
+			wantError:    "invalid_grant",
+		},
+		{
+			name: "confidential client sends the wrong client secret",
+			modifySession: func(session *devicecode.Session, authCode string) {
+				session.ClientID = dynamicClientID
+				session.Status = devicecode.StatusApproved
+				session.AuthorizationCode = authCode
+			},
+			modifyRequest: func(form url.Values) {
+				form.Set("client_id", dynamicClientID)
+			},
+			clientSecret: "wrong-secret",
+			wantStatus:   http.StatusUnauthorized,
+			wantError:    "invalid_client",
+		},
+		{
+			name: "unknown client",
+			modifyRequest: func(form url.Values) {
+				form.Set("client_id", "some-unknown-client")
+			},
+			wantStatus: http.StatusUnauthorized,
+			wantError:  "invalid_client",
+		},
+		{
+			name: "device code has the wrong secret",
+			modifyRequest: func(form url.Values) {
+				userCode, _, err := devicecode.SplitCode(form.Get("device_code"))
+				require.NoError(t, err)
+				form.Set("device_code", devicecode.JoinCode(userCode, "wrong-secret"))
+			},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid_grant",
+		},
+		{
+			name: "device code is unknown",
+			modifyRequest: func(form url.Values) {
+				form.Set("device_code", devicecode.JoinCode("BCDFGHJK", "some-secret"))
+			},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid_grant",
+		},
+		{
+			name: "device code is malformed",
+			modifyRequest: func(form url.Values) {
+				form.Set("device_code", "not-a-device-code")
+			},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid_grant",
+		},
+		{
+			name: "login was approved",
+			modifySession: func(session *devicecode.Session, authCode string) {
+				session.Status = devicecode.StatusApproved
+				session.AuthorizationCode = authCode
+			},
+			wantStatus:  http.StatusOK,
+			wantDeleted: true,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+
+			kubeClient := fake.NewSimpleClientset()
+			supervisorClient := supervisorfake.NewSimpleClientset()
+			secrets := kubeClient.CoreV1().Secrets("some-namespace")
+			addFullyCapableDynamicClientAndSecretToKubeResources(t, supervisorClient, kubeClient)
+			oauthStore := oidc.NewKubeStorage(secrets, supervisorClient.ConfigV1alpha1().OIDCClients("some-namespace"), goodIssuer, oidc.DefaultOIDCTimeoutsConfiguration(), bcrypt.MinCost)
+
+			// Simulate the verification page having started a login which redirects back to the device callback endpoint.
+			authRequest := deepCopyRequestForm(happyAuthRequest)
+			authRequest.Form.Set("redirect_uri", deviceCallbackURL)
+			oauthHelper, authCode, _ := makeHappyOauthHelper(t, authRequest, oauthStore, generateJWTSigningKeyAndJWKSProvider, nil, nil)
+
+			storage := devicecode.New(secrets, time.Now, time.Hour)
+			userCode, deviceCode, err := storage.Create(ctx, &devicecode.Session{
+				ClientID:  pinnipedCLIClientID,
+				Scopes:    strings.Split(happyAuthRequest.Form.Get("scope"), " "),
+				ExpiresAt: time.Now().Add(time.Hour),
+				Status:    devicecode.StatusPending,
+			})
+			require.NoError(t, err)
+			session, resourceVersion, err := storage.Get(ctx, userCode)
+			require.NoError(t, err)
+			session.CodeVerifier = goodPKCECodeVerifier
+			if test.modifySession != nil {
+				test.modifySession(session, authCode)
+			}
+			require.NoError(t, storage.Update(ctx, userCode, resourceVersion, session))
+
+			auditLogger := auditlog.NewTestLogger(t)
+			subject := NewHandler(oidctestutil.NewUpstreamIDPListerBuilder().Build(), oauthHelper, storage, deviceCallbackURL, auditLogger)
+
+			form := url.Values{
+				"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+				"device_code": {deviceCode},
+				"client_id":   {pinnipedCLIClientID},
+			}
+			if test.modifyRequest != nil {
+				test.modifyRequest(form)
+			}
+			clientID := form.Get("client_id")
+			if test.clientSecret != "" {
+				form.Del("client_id")
+			}
+			req := httptest.NewRequest(http.MethodPost, "/path/shouldn't/matter", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if test.clientSecret != "" {
+				req.SetBasicAuth(clientID, test.clientSecret)
+			}
+			rsp := httptest.NewRecorder()
+			subject.ServeHTTP(rsp, req)
+			t.Logf("response body: %q", rsp.Body.String())
+
+			require.Equal(t, test.wantStatus, rsp.Code)
+			testutil.RequireEqualContentType(t, rsp.Header().Get("Content-Type"), "application/json")
+			var body map[string]interface{}
+			require.NoError(t, json.Unmarshal(rsp.Body.Bytes(), &body))
+			if test.wantError != "" {
+				require.Equal(t, test.wantError, body["error"])
+			} else {
+				require.NotEmpty(t, body["id_token"])
+				require.NotEmpty(t, body["access_token"])
+				require.Len(t, auditLogger.Events(), 1)
+				require.Equal(t, auditlog.DownstreamTokensIssued, auditLogger.Events()[0].Type)
+			}
+
+			wantDeviceCodeSessions := 1
+			if test.wantDeleted {
+				wantDeviceCodeSessions = 0
+			}
+			testutil.RequireNumberOfSecretsMatchingLabelSelector(t, secrets, labels.Set{crud.SecretLabelKey: devicecode.TypeLabelValue}, wantDeviceCodeSessions)
+		})
+	}
+}
@@ -1,4 +1,4 @@
-// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 // Package token provides a handler for the OIDC token endpoint.
@@ -9,6 +9,8 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/ory/fosite"
 	errorsx "github.com/pkg/errors"
@@ -18,8 +20,14 @@ import (
 	"k8s.io/utils/strings/slices"
 
 	oidcapi "go.pinniped.dev/generated/latest/apis/supervisor/oidc"
+	"go.pinniped.dev/internal/auditlog"
+	"go.pinniped.dev/internal/fositestorage/clientassertion"
+	"go.pinniped.dev/internal/fositestorage/devicecode"
 	"go.pinniped.dev/internal/httputil/httperr"
+	"go.pinniped.dev/internal/idtransform"
 	"go.pinniped.dev/internal/oidc"
+	"go.pinniped.dev/internal/oidc/clientregistry"
+	"go.pinniped.dev/internal/oidc/device"
 	"go.pinniped.dev/internal/oidc/downstreamsession"
 	"go.pinniped.dev/internal/oidc/provider"
 	"go.pinniped.dev/internal/plog"
@@ -27,18 +35,48 @@ import (
 )
 
 func NewHandler(
-	idpLister oidc.UpstreamIdentityProvidersLister,
-	oauthHelper fosite.OAuth2Provider,
+	idpLister oidc.FederationDomainIdentityProvidersListerI,
+	oauthHelper device.ClientAuthenticator,
+	deviceCodeStorage devicecode.Storage,
+	deviceCallbackURL string,
+	auditLogger auditlog.Logger,
 ) http.Handler {
 	return httperr.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		// Fosite does not support the device code grant, so change the request into an authcode redemption
+		// once the user has finished their login. Until then, tell the client to keep polling.
+		if r.Method == http.MethodPost && r.ParseForm() == nil && r.PostForm.Get("grant_type") == oidcapi.GrantTypeDeviceCode {
+			// The client is authenticated again by fosite after the request was changed, so allow that to use
+			// the same client assertion.
+			r = r.WithContext(clientassertion.WithRequestScope(r.Context()))
+			if err := exchangeDeviceCode(r, oauthHelper, deviceCodeStorage, deviceCallbackURL); err != nil {
+				plog.Info("token request error", oidc.FositeErrorForLog(err)...)
+				oauthHelper.WriteAccessError(r.Context(), w, nil, err)
+				return nil
+			}
+		}
+
 		session := psession.NewPinnipedSession()
 		accessRequest, err := oauthHelper.NewAccessRequest(r.Context(), r, session)
 		if err != nil {
 			plog.Info("token request error", oidc.FositeErrorForLog(err)...)
+			if r.PostForm.Get("grant_type") == oidcapi.GrantTypeRefreshToken {
+				// The refresh token could not be used, e.g. because it was already used or revoked. The session
+				// could not be loaded, so the event cannot include the correlation ID or the user's identity.
+				auditLogger.Audit(auditlog.Event{
+					Type:    auditlog.RefreshRejected,
+					Message: fositeErrorMessage(err),
+					Request: auditlog.RequestFromHTTP(r),
+				})
+			}
 			oauthHelper.WriteAccessError(r.Context(), w, accessRequest, err)
 			return nil
 		}
 
+		// The session was loaded from storage, so it knows which upstream IDP was used to start this session.
+		if customSessionData := accessRequest.GetSession().(*psession.PinnipedSession).Custom; customSessionData != nil {
+			oidc.RecordUpstreamIDPForMetrics(r.Context(), customSessionData.ProviderName, customSessionData.ProviderType)
+		}
+
 		// Check if we are performing a refresh grant.
 		if accessRequest.GetGrantTypes().ExactOne(oidcapi.GrantTypeRefreshToken) {
 			// The above call to NewAccessRequest has loaded the session from storage into the accessRequest variable.
@@ -48,6 +86,18 @@ func NewHandler(
 			err = upstreamRefresh(r.Context(), accessRequest, idpLister)
 			if err != nil {
 				plog.Info("upstream refresh error", oidc.FositeErrorForLog(err)...)
+				auditLogger.Audit(auditEventForSession(auditlog.RefreshRejected, r, accessRequest, fositeErrorMessage(err)))
+				oauthHelper.WriteAccessError(r.Context(), w, accessRequest, err)
+				return nil
+			}
+		}
+
+		// The identity of a client which is using the client_credentials grant is subject to the same identity
+		// transformations and policies as the identities of users, which were already applied during their logins.
+		if accessRequest.GetGrantTypes().ExactOne(oidcapi.GrantTypeClientCredentials) {
+			err = applyClientCredentialsTransformations(r.Context(), accessRequest, idpLister.GetClientCredentialsTransformations())
+			if err != nil {
+				plog.Info("client credentials identity transformation error", oidc.FositeErrorForLog(err)...)
 				oauthHelper.WriteAccessError(r.Context(), w, accessRequest, err)
 				return nil
 			}
@@ -68,16 +118,108 @@ func NewHandler(
 		accessResponse, err := oauthHelper.NewAccessResponse(r.Context(), accessRequest)
 		if err != nil {
 			plog.Info("token response error", oidc.FositeErrorForLog(err)...)
+			if accessRequest.GetGrantTypes().ExactOne(oidcapi.GrantTypeRefreshToken) {
+				auditLogger.Audit(auditEventForSession(auditlog.RefreshRejected, r, accessRequest, fositeErrorMessage(err)))
+			}
 			oauthHelper.WriteAccessError(r.Context(), w, accessRequest, err)
 			return nil
 		}
 
+		switch {
+		case accessRequest.GetGrantTypes().ExactOne(oidcapi.GrantTypeAuthorizationCode),
+			accessRequest.GetGrantTypes().ExactOne(oidcapi.GrantTypeClientCredentials):
+			auditLogger.Audit(auditEventForSession(auditlog.DownstreamTokensIssued, r, accessRequest, ""))
+		case accessRequest.GetGrantTypes().ExactOne(oidcapi.GrantTypeRefreshToken):
+			auditLogger.Audit(auditEventForSession(auditlog.RefreshSucceeded, r, accessRequest, ""))
+		case accessRequest.GetGrantTypes().ExactOne(oidcapi.GrantTypeTokenExchange):
+			// The token exchange handler made the session of the subject token available on the accessRequest.
+			event := auditEventForSession(auditlog.TokenExchanged, r, accessRequest, "")
+			event.Audience = r.PostForm.Get("audience")
+			auditLogger.Audit(event)
+		}
+
 		oauthHelper.WriteAccessResponse(r.Context(), w, accessRequest, accessResponse)
 
 		return nil
 	})
 }
 
+// applyClientCredentialsTransformations applies the FederationDomain's identity transformations and policies to the
+// identity which the client_credentials grant handler has put into the session, before any tokens are issued.
+func applyClientCredentialsTransformations(
+	ctx context.Context,
+	accessRequest fosite.AccessRequester,
+	identityTransforms *idtransform.TransformationPipeline,
+) error {
+	client, clientOK := accessRequest.GetClient().(*clientregistry.Client)
+	session, sessionOK := accessRequest.GetSession().(*psession.PinnipedSession)
+	if !clientOK || !sessionOK || session.Custom == nil {
+		// This shouldn't really happen.
+		return errorsx.WithStack(fosite.ErrServerError.WithHint("Invalid session storage."))
+	}
+
+	// The session only contains the groups when the groups scope was granted, so use the client's configured groups.
+	username, groups := client.ClientCredentialsIdentity()
+	transformationResult, err := identityTransforms.Evaluate(ctx, username, groups)
+	if err != nil {
+		return errorsx.WithStack(fosite.ErrServerError.WithHint(
+			"Error while applying configured identity transformations.").WithWrap(err).WithDebug(err.Error()))
+	}
+	if !transformationResult.AuthenticationAllowed {
+		return errorsx.WithStack(fosite.ErrAccessDenied.WithHintf(
+			"Rejected by configured identity policy: %s.", transformationResult.RejectedAuthenticationMessage))
+	}
+
+	session.Custom.Username = transformationResult.Username
+	extra := session.Fosite.Claims.Extra
+	if _, ok := extra[oidcapi.IDTokenClaimUsername]; ok {
+		extra[oidcapi.IDTokenClaimUsername] = transformationResult.Username
+	}
+	if _, ok := extra[oidcapi.IDTokenClaimGroups]; ok {
+		transformedGroups := transformationResult.Groups
+		if transformedGroups == nil {
+			transformedGroups = []string{}
+		}
+		extra[oidcapi.IDTokenClaimGroups] = transformedGroups
+	}
+
+	return nil
+}
+
+// auditEventForSession returns an audit event about the downstream session which was loaded by the accessRequest.
+func auditEventForSession(eventType auditlog.EventType, r *http.Request, accessRequest fosite.AccessRequester, message string) auditlog.Event {
+	event := auditlog.Event{
+		Type:          eventType,
+		Message:       message,
+		CorrelationID: oidc.CorrelationID(accessRequest),
+		Request:       auditlog.RequestFromHTTP(r),
+		ClientID:      accessRequest.GetClient().GetID(),
+	}
+
+	session, ok := accessRequest.GetSession().(*psession.PinnipedSession)
+	if !ok || session.Custom == nil {
+		return event
+	}
+	// The identity of a client which used the client_credentials grant did not come from an upstream IDP.
+	if session.Custom.ProviderName != "" {
+		event.UpstreamIDP = &auditlog.UpstreamIDP{Name: session.Custom.ProviderName, Type: string(session.Custom.ProviderType)}
+	}
+	if session.Custom.Username != "" {
+		event.User = &auditlog.User{Username: session.Custom.Username}
+		// The groups are only in the session when the groups scope was granted.
+		if groups, err := getDownstreamGroupsFromPinnipedSession(session); err == nil {
+			event.User.Groups = groups
+		}
+	}
+	return event
+}
+
+// fositeErrorMessage describes an error from fosite, including its hint and debug details.
+func fositeErrorMessage(err error) string {
+	rfc6749Error := fosite.ErrorToRFC6749Error(err)
+	return strings.TrimSpace(rfc6749Error.GetDescription() + " " + rfc6749Error.Debug())
+}
+
 func errMissingUpstreamSessionInternalError() *fosite.RFC6749Error {
 	return &fosite.RFC6749Error{
 		ErrorField:       "error",
@@ -95,7 +237,7 @@ func errUpstreamRefreshError() *fosite.RFC6749Error {
 	}
 }
 
-func upstreamRefresh(ctx context.Context, accessRequest fosite.AccessRequester, providerCache oidc.UpstreamIdentityProvidersLister) error {
+func upstreamRefresh(ctx context.Context, accessRequest fosite.AccessRequester, providerCache oidc.FederationDomainIdentityProvidersListerI) error {
 	session := accessRequest.GetSession().(*psession.PinnipedSession)
 
 	customSessionData := session.Custom
@@ -118,6 +260,10 @@ func upstreamRefresh(ctx context.Context, accessRequest fosite.AccessRequester,
 		return upstreamLDAPRefresh(ctx, providerCache, session, grantedScopes, clientID)
 	case psession.ProviderTypeActiveDirectory:
 		return upstreamLDAPRefresh(ctx, providerCache, session, grantedScopes, clientID)
+	case psession.ProviderTypeSAML:
+		return upstreamSAMLRefresh(ctx, providerCache, session, grantedScopes, clientID)
+	case psession.ProviderTypeGitHub:
+		return upstreamGitHubRefresh(ctx, providerCache, session, grantedScopes, clientID)
 	default:
 		return errorsx.WithStack(errMissingUpstreamSessionInternalError())
 	}
@@ -126,7 +272,7 @@ func upstreamRefresh(ctx context.Context, accessRequest fosite.AccessRequester,
 func upstreamOIDCRefresh(
 	ctx context.Context,
 	session *psession.PinnipedSession,
-	providerCache oidc.UpstreamIdentityProvidersLister,
+	providerCache oidc.FederationDomainIdentityProvidersListerI,
 	grantedScopes []string,
 	clientID string,
 ) error {
@@ -188,33 +334,28 @@ func upstreamOIDCRefresh(
 		return err
 	}
 
-	groupsScope := slices.Contains(grantedScopes, oidcapi.ScopeGroups)
-	if groupsScope { //nolint:nestif
-		// If possible, update the user's group memberships. The configured groups claim name (if there is one) may or
-		// may not be included in the newly fetched and merged claims. It could be missing due to a misconfiguration of the
-		// claim name. It could also be missing because the claim was originally found in the ID token during login, but
-		// now we might not have a refreshed ID token.
-		// If the claim is found, then use it to update the user's group membership in the session.
-		// If the claim is not found, then we have no new information about groups, so skip updating the group membership
-		// and let any old groups memberships in the session remain.
-		refreshedGroups, err := downstreamsession.GetGroupsFromUpstreamIDToken(p, mergedClaims)
-		if err != nil {
-			return errUpstreamRefreshError().WithHintf(
-				"Upstream refresh error while extracting groups claim.").WithTrace(err).
-				WithDebugf("provider name: %q, provider type: %q", s.ProviderName, s.ProviderType)
-		}
-		if refreshedGroups != nil {
-			oldGroups, err := getDownstreamGroupsFromPinnipedSession(session)
-			if err != nil {
-				return err
-			}
-			username, err := getDownstreamUsernameFromPinnipedSession(session)
-			if err != nil {
-				return err
-			}
-			warnIfGroupsChanged(ctx, oldGroups, refreshedGroups, username, clientID)
-			session.Fosite.Claims.Extra[oidcapi.IDTokenClaimGroups] = refreshedGroups
-		}
+	// If possible, update the user's group memberships. The configured groups claim name (if there is one) may or
+	// may not be included in the newly fetched and merged claims. It could be missing due to a misconfiguration of the
+	// claim name. It could also be missing because the claim was originally found in the ID token during login, but
+	// now we might not have a refreshed ID token.
+	// If the claim is found, then use it to update the user's group membership in the session.
+	// If the claim is not found, then we have no new information about groups, so use the untransformed groups
+	// from the initial login when reapplying the identity transformations.
+	refreshedUntransformedGroups, err := downstreamsession.GetGroupsFromUpstreamIDToken(p, mergedClaims)
+	if err != nil {
+		return errUpstreamRefreshError().WithHintf(
+			"Upstream refresh error while extracting groups claim.").WithTrace(err).
+			WithDebugf("provider name: %q, provider type: %q", s.ProviderName, s.ProviderType)
+	}
+	if refreshedUntransformedGroups == nil {
+		refreshedUntransformedGroups = s.UpstreamGroups
+	}
+
+	err = updateSessionFromRefreshedIdentity(ctx, session,
+		providerCache.GetIdentityTransformations(s.ProviderName, s.ProviderType),
+		refreshedUntransformedGroups, grantedScopes, clientID)
+	if err != nil {
+		return err
 	}
 
 	// Upstream refresh may or may not return a new refresh token. If we got a new refresh token, then update it in
@@ -261,13 +402,13 @@ func validateIdentityUnchangedSinceInitialLogin(mergedClaims map[string]interfac
 	}
 
 	newUsername, hasUsername := getString(mergedClaims, usernameClaimName)
-	oldUsername, err := getDownstreamUsernameFromPinnipedSession(session)
+	oldUntransformedUsername, err := getUpstreamUsernameFromPinnipedSession(session)
 	if err != nil {
 		return err
 	}
 	// It's possible that a username wasn't returned by the upstream provider during refresh,
 	// but if it is, verify that it hasn't changed.
-	if hasUsername && oldUsername != newUsername {
+	if hasUsername && oldUntransformedUsername != newUsername {
 		return errUpstreamRefreshError().WithHintf(
 			"Upstream refresh failed.").WithTrace(errors.New("username in upstream refresh does not match previous value")).
 			WithDebugf("provider name: %q, provider type: %q", s.ProviderName, s.ProviderType)
@@ -292,7 +433,7 @@ func getString(m map[string]interface{}, key string) (string, bool) {
 
 func findOIDCProviderByNameAndValidateUID(
 	s *psession.CustomSessionData,
-	providerCache oidc.UpstreamIdentityProvidersLister,
+	providerCache oidc.FederationDomainIdentityProvidersListerI,
 ) (provider.UpstreamOIDCIdentityProviderI, error) {
 	for _, p := range providerCache.GetOIDCIdentityProviders() {
 		if p.GetName() == s.ProviderName {
@@ -310,23 +451,26 @@ func findOIDCProviderByNameAndValidateUID(
 
 func upstreamLDAPRefresh(
 	ctx context.Context,
-	providerCache oidc.UpstreamIdentityProvidersLister,
+	providerCache oidc.FederationDomainIdentityProvidersListerI,
 	session *psession.PinnipedSession,
 	grantedScopes []string,
 	clientID string,
 ) error {
-	username, err := getDownstreamUsernameFromPinnipedSession(session)
+	untransformedUsername, err := getUpstreamUsernameFromPinnipedSession(session)
 	if err != nil {
 		return err
 	}
-	subject := session.Fosite.Claims.Subject
-	var oldGroups []string
+	// Check that the downstream identity is present in the session before performing the upstream refresh,
+	// because it will be needed after the refresh.
+	if _, err = getDownstreamUsernameFromPinnipedSession(session); err != nil {
+		return err
+	}
 	if slices.Contains(grantedScopes, oidcapi.ScopeGroups) {
-		oldGroups, err = getDownstreamGroupsFromPinnipedSession(session)
-		if err != nil {
+		if _, err = getDownstreamGroupsFromPinnipedSession(session); err != nil {
 			return err
 		}
 	}
+	subject := session.Fosite.Claims.Subject
 
 	s := session.Custom
 
@@ -353,11 +497,11 @@ func upstreamLDAPRefresh(
 		return errorsx.WithStack(errMissingUpstreamSessionInternalError())
 	}
 	// run PerformRefresh
-	groups, err := p.PerformRefresh(ctx, provider.RefreshAttributes{
-		Username:             username,
+	refreshedUntransformedGroups, err := p.PerformRefresh(ctx, provider.RefreshAttributes{
+		Username:             untransformedUsername,
 		Subject:              subject,
 		DN:                   dn,
-		Groups:               oldGroups,
+		Groups:               s.UpstreamGroups,
 		AdditionalAttributes: additionalAttributes,
 		GrantedScopes:        grantedScopes,
 	})
@@ -366,19 +510,201 @@ func upstreamLDAPRefresh(
 			"Upstream refresh failed.").WithTrace(err).
 			WithDebugf("provider name: %q, provider type: %q", s.ProviderName, s.ProviderType)
 	}
-	groupsScope := slices.Contains(grantedScopes, oidcapi.ScopeGroups)
-	if groupsScope {
-		warnIfGroupsChanged(ctx, oldGroups, groups, username, clientID)
+	if !slices.Contains(grantedScopes, oidcapi.ScopeGroups) {
+		// The groups are not refreshed without the groups scope, so use the untransformed groups from the
+		// initial login when reapplying the identity transformations.
+		refreshedUntransformedGroups = s.UpstreamGroups
+	}
+
+	return updateSessionFromRefreshedIdentity(ctx, session,
+		providerCache.GetIdentityTransformations(s.ProviderName, s.ProviderType),
+		refreshedUntransformedGroups, grantedScopes, clientID)
+}
+
+// updateSessionFromRefreshedIdentity reapplies the identity transformations to the user's untransformed upstream
+// username and refreshed untransformed upstream groups. The transformations and policies could have been changed
+// by an admin since the initial login, or they could depend on the user's group memberships, which may have changed.
+// The downstream username must not change during a refresh. When the groups scope was granted, the downstream groups
+// in the session are replaced by the newly transformed groups.
+func updateSessionFromRefreshedIdentity(
+	ctx context.Context,
+	session *psession.PinnipedSession,
+	identityTransforms *idtransform.TransformationPipeline,
+	refreshedUntransformedGroups []string,
+	grantedScopes []string,
+	clientID string,
+) error {
+	s := session.Custom
+
+	oldTransformedUsername, err := getDownstreamUsernameFromPinnipedSession(session)
+	if err != nil {
+		return err
+	}
+
+	transformationResult, err := identityTransforms.Evaluate(ctx, s.UpstreamUsername, refreshedUntransformedGroups)
+	if err != nil {
+		return errUpstreamRefreshError().WithHintf(
+			"Upstream refresh error while applying configured identity transformations.").WithTrace(err).
+			WithDebugf("provider name: %q, provider type: %q", s.ProviderName, s.ProviderType)
+	}
+	if !transformationResult.AuthenticationAllowed {
+		return errUpstreamRefreshError().WithHintf(
+			"Upstream refresh rejected by configured identity policy: %s.", transformationResult.RejectedAuthenticationMessage).
+			WithDebugf("provider name: %q, provider type: %q", s.ProviderName, s.ProviderType)
+	}
+	if transformationResult.Username != oldTransformedUsername {
+		return errUpstreamRefreshError().WithHintf(
+			"Upstream refresh failed.").WithTrace(errors.New("username in upstream refresh does not match previous value")).
+			WithDebugf("provider name: %q, provider type: %q", s.ProviderName, s.ProviderType)
+	}
+
+	if slices.Contains(grantedScopes, oidcapi.ScopeGroups) {
+		oldTransformedGroups, err := getDownstreamGroupsFromPinnipedSession(session)
+		if err != nil {
+			return err
+		}
+		newTransformedGroups := transformationResult.Groups
+		if newTransformedGroups == nil {
+			newTransformedGroups = []string{}
+		}
+		warnIfGroupsChanged(ctx, oldTransformedGroups, newTransformedGroups, oldTransformedUsername, clientID)
 		// Replace the old value with the new value.
-		session.Fosite.Claims.Extra[oidcapi.IDTokenClaimGroups] = groups
+		session.Fosite.Claims.Extra[oidcapi.IDTokenClaimGroups] = newTransformedGroups
 	}
 
+	// Remember the refreshed untransformed groups, so they can be used for the next refresh when needed.
+	s.UpstreamGroups = refreshedUntransformedGroups
+
 	return nil
 }
 
+// upstreamSAMLRefresh checks that the user's upstream SAML session is still valid. SAML has no way to ask the
+// upstream IDP about the user without the user's browser, so the groups from the initial login are kept and the
+// identity transformations are reapplied to them.
+func upstreamSAMLRefresh(
+	ctx context.Context,
+	providerCache oidc.FederationDomainIdentityProvidersListerI,
+	session *psession.PinnipedSession,
+	grantedScopes []string,
+	clientID string,
+) error {
+	s := session.Custom
+	if s.SAML == nil || s.SAML.UpstreamNameID == "" {
+		return errorsx.WithStack(errMissingUpstreamSessionInternalError())
+	}
+	if _, err := getUpstreamUsernameFromPinnipedSession(session); err != nil {
+		return err
+	}
+
+	if _, err := findSAMLProviderByNameAndValidateUID(s, providerCache); err != nil {
+		return err
+	}
+
+	if s.SAML.SessionNotOnOrAfter != nil && !time.Now().Before(*s.SAML.SessionNotOnOrAfter) {
+		return errorsx.WithStack(errUpstreamRefreshError().
+			WithHint("Upstream session has expired.").
+			WithDebugf("provider name: %q, provider type: %q", s.ProviderName, s.ProviderType))
+	}
+
+	return updateSessionFromRefreshedIdentity(ctx, session,
+		providerCache.GetIdentityTransformations(s.ProviderName, s.ProviderType),
+		s.UpstreamGroups, grantedScopes, clientID)
+}
+
+func findSAMLProviderByNameAndValidateUID(
+	s *psession.CustomSessionData,
+	providerCache oidc.FederationDomainIdentityProvidersListerI,
+) (provider.UpstreamSAMLIdentityProviderI, error) {
+	for _, p := range providerCache.GetSAMLIdentityProviders() {
+		if p.GetName() == s.ProviderName {
+			if p.GetResourceUID() != s.ProviderUID {
+				return nil, errorsx.WithStack(errUpstreamRefreshError().WithHint(
+					"Provider from upstream session data has changed its resource UID since authentication.").
+					WithDebugf("provider name: %q, provider type: %q", s.ProviderName, s.ProviderType))
+			}
+			return p, nil
+		}
+	}
+	return nil, errorsx.WithStack(errUpstreamRefreshError().
+		WithHint("Provider from upstream session data was not found.").
+		WithDebugf("provider name: %q, provider type: %q", s.ProviderName, s.ProviderType))
+}
+
+// upstreamGitHubRefresh uses the upstream access token from the initial login to look up the user again in the
+// GitHub REST API. This checks that the access token has not been revoked, that the user is still a member of an
+// allowed organization, and refreshes the user's team memberships. GitHub access tokens for OAuth apps do not expire.
+func upstreamGitHubRefresh(
+	ctx context.Context,
+	providerCache oidc.FederationDomainIdentityProvidersListerI,
+	session *psession.PinnipedSession,
+	grantedScopes []string,
+	clientID string,
+) error {
+	s := session.Custom
+	if s.GitHub == nil || s.GitHub.UpstreamAccessToken == "" {
+		return errorsx.WithStack(errMissingUpstreamSessionInternalError())
+	}
+	untransformedUsername, err := getUpstreamUsernameFromPinnipedSession(session)
+	if err != nil {
+		return err
+	}
+
+	p, err := findGitHubProviderByNameAndValidateUID(s, providerCache)
+	if err != nil {
+		return err
+	}
+
+	user, err := p.GetUser(ctx, s.GitHub.UpstreamAccessToken)
+	if err != nil {
+		return errUpstreamRefreshError().WithHint(
+			"Upstream refresh failed.").WithTrace(err).
+			WithDebugf("provider name: %q, provider type: %q", s.ProviderName, s.ProviderType)
+	}
+	if user.DownstreamSubject != session.Fosite.Claims.Subject {
+		return errUpstreamRefreshError().WithHint(
+			"Upstream refresh failed.").WithTrace(errors.New("subject in upstream refresh does not match previous value")).
+			WithDebugf("provider name: %q, provider type: %q", s.ProviderName, s.ProviderType)
+	}
+	if user.Username != untransformedUsername {
+		return errUpstreamRefreshError().WithHint(
+			"Upstream refresh failed.").WithTrace(errors.New("username in upstream refresh does not match previous value")).
+			WithDebugf("provider name: %q, provider type: %q", s.ProviderName, s.ProviderType)
+	}
+
+	refreshedUntransformedGroups := user.Groups
+	if !slices.Contains(grantedScopes, oidcapi.ScopeGroups) {
+		// The groups are not refreshed without the groups scope, so use the untransformed groups from the
+		// initial login when reapplying the identity transformations.
+		refreshedUntransformedGroups = s.UpstreamGroups
+	}
+
+	return updateSessionFromRefreshedIdentity(ctx, session,
+		providerCache.GetIdentityTransformations(s.ProviderName, s.ProviderType),
+		refreshedUntransformedGroups, grantedScopes, clientID)
+}
+
+func findGitHubProviderByNameAndValidateUID(
+	s *psession.CustomSessionData,
+	providerCache oidc.FederationDomainIdentityProvidersListerI,
+) (provider.UpstreamGitHubIdentityProviderI, error) {
+	for _, p := range providerCache.GetGitHubIdentityProviders() {
+		if p.GetName() == s.ProviderName {
+			if p.GetResourceUID() != s.ProviderUID {
+				return nil, errorsx.WithStack(errUpstreamRefreshError().WithHint(
+					"Provider from upstream session data has changed its resource UID since authentication.").
+					WithDebugf("provider name: %q, provider type: %q", s.ProviderName, s.ProviderType))
+			}
+			return p, nil
+		}
+	}
+	return nil, errorsx.WithStack(errUpstreamRefreshError().
+		WithHint("Provider from upstream session data was not found.").
+		WithDebugf("provider name: %q, provider type: %q", s.ProviderName, s.ProviderType))
+}
+
 func findLDAPProviderByNameAndValidateUID(
 	s *psession.CustomSessionData,
-	providerCache oidc.UpstreamIdentityProvidersLister,
+	providerCache oidc.FederationDomainIdentityProvidersListerI,
 ) (provider.UpstreamLDAPIdentityProviderI, string, error) {
 	var providers []provider.UpstreamLDAPIdentityProviderI
 	var dn string
@@ -414,6 +740,14 @@ func getDownstreamUsernameFromPinnipedSession(session *psession.PinnipedSession)
 	return downstreamUsername, nil
 }
 
+func getUpstreamUsernameFromPinnipedSession(session *psession.PinnipedSession) (string, error) {
+	upstreamUsername := session.Custom.UpstreamUsername
+	if len(upstreamUsername) == 0 {
+		return "", errorsx.WithStack(errMissingUpstreamSessionInternalError())
+	}
+	return upstreamUsername, nil
+}
+
 func getDownstreamGroupsFromPinnipedSession(session *psession.PinnipedSession) ([]string, error) {
 	extra := session.Fosite.Claims.Extra
 	if extra == nil {
@@ -423,6 +757,10 @@ func getDownstreamGroupsFromPinnipedSession(session *psession.PinnipedSession) (
 	if downstreamGroupsInterface == nil {
 		return nil, errorsx.WithStack(errMissingUpstreamSessionInternalError())
 	}
+	if downstreamGroups, ok := downstreamGroupsInterface.([]string); ok {
+		// The session was created during this request, so it was not read from storage.
+		return downstreamGroups, nil
+	}
 	downstreamGroupsInterfaceList, ok := downstreamGroupsInterface.([]interface{})
 	if !ok {
 		return nil, errorsx.WithStack(errMissingUpstreamSessionInternalError())
@@ -1,4 +1,4 @@
-// Copyright 2020-2023 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package token
@@ -41,9 +41,12 @@ import (
 
 	configv1alpha1 "go.pinniped.dev/generated/latest/apis/supervisor/config/v1alpha1"
 	supervisorfake "go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned/fake"
+	"go.pinniped.dev/internal/auditlog"
+	"go.pinniped.dev/internal/celtransformer"
 	"go.pinniped.dev/internal/crud"
 	"go.pinniped.dev/internal/fositestorage/accesstoken"
 	"go.pinniped.dev/internal/fositestorage/authorizationcode"
+	"go.pinniped.dev/internal/fositestorage/devicecode"
 	"go.pinniped.dev/internal/fositestorage/openidconnect"
 	storagepkce "go.pinniped.dev/internal/fositestorage/pkce"
 	"go.pinniped.dev/internal/fositestorage/refreshtoken"
@@ -52,6 +55,7 @@ import (
 	"go.pinniped.dev/internal/httputil/httperr"
 	"go.pinniped.dev/internal/oidc"
 	"go.pinniped.dev/internal/oidc/clientregistry"
+	"go.pinniped.dev/internal/oidc/device"
 	"go.pinniped.dev/internal/oidc/jwks"
 	"go.pinniped.dev/internal/oidc/oidcclientvalidator"
 	"go.pinniped.dev/internal/oidc/provider"
@@ -915,7 +919,7 @@ func TestTokenEndpointWhenAuthcodeIsUsedTwice(t *testing.T) {
 
 			// First call - should be successful.
 			// Authcode exchange doesn't use the upstream provider cache, so just pass an empty cache.
-			subject, rsp, authCode, _, secrets, oauthStore := exchangeAuthcodeForTokens(t,
+			subject, rsp, authCode, _, secrets, oauthStore, _ := exchangeAuthcodeForTokens(t,
 				test.authcodeExchange, oidctestutil.NewUpstreamIDPListerBuilder().Build(), test.kubeResources)
 			var parsedResponseBody map[string]interface{}
 			require.NoError(t, json.Unmarshal(rsp.Body.Bytes(), &parsedResponseBody))
@@ -1575,8 +1579,12 @@ func TestTokenEndpointTokenExchange(t *testing.T) { // tests for grant_type "urn
 		t.Run(test.name, func(t *testing.T) {
 			t.Parallel()
 
+			// Every real login stores custom session data, which carries the correlation ID used to audit the exchange.
+			test.authcodeExchange.customSessionData = &psession.CustomSessionData{Username: goodUsername, ProviderType: psession.ProviderTypeOIDC}
+			test.authcodeExchange.want.wantCustomSessionDataStored = test.authcodeExchange.customSessionData
+
 			// Authcode exchange doesn't use the upstream provider cache, so just pass an empty cache.
-			subject, rsp, _, _, secrets, storage := exchangeAuthcodeForTokens(t,
+			subject, rsp, _, _, secrets, storage, auditLogger := exchangeAuthcodeForTokens(t,
 				test.authcodeExchange, oidctestutil.NewUpstreamIDPListerBuilder().Build(), test.kubeResources)
 			var parsedAuthcodeExchangeResponseBody map[string]interface{}
 			require.NoError(t, json.Unmarshal(rsp.Body.Bytes(), &parsedAuthcodeExchangeResponseBody))
@@ -1632,6 +1640,13 @@ func TestTokenEndpointTokenExchange(t *testing.T) { // tests for grant_type "urn
 				return
 			}
 
+			// The token exchange should be audited as part of the same session as the authcode exchange.
+			auditEvents := auditLogger.Events()
+			require.Len(t, auditEvents, 2)
+			require.Equal(t, auditlog.TokenExchanged, auditEvents[1].Type)
+			require.Equal(t, auditEvents[0].CorrelationID, auditEvents[1].CorrelationID)
+			require.Equal(t, test.requestedAudience, auditEvents[1].Audience)
+
 			claimsOfFirstIDToken := map[string]interface{}{}
 			originalIDToken := parsedAuthcodeExchangeResponseBody["id_token"].(string)
 			firstIDTokenDecoded, _ := josejwt.ParseSigned(originalIDToken)
@@ -1723,6 +1738,249 @@ func TestTokenEndpointTokenExchange(t *testing.T) { // tests for grant_type "urn
 	}
 }
 
+func TestTokenEndpointClientCredentialsGrant(t *testing.T) {
+	const (
+		serviceUsername = "ci-runner"
+		workloadCluster = "some-workload-cluster"
+	)
+	serviceGroups := []string{"ci", "deployers"}
+
+	tests := []struct {
+		name              string
+		clientCredentials *configv1alpha1.OIDCClientCredentials
+		transforms        []celtransformer.CELTransformation
+		modifyForm        func(form url.Values)
+		clientSecret      string
+
+		wantStatus            int
+		wantError             string
+		wantErrorDescription  string
+		wantExchangeStatus    int
+		wantExchangeError     string
+		wantExchangedUsername string
+		wantExchangedGroups   []interface{}
+	}{
+		{
+			name:                "happy path",
+			clientCredentials:   &configv1alpha1.OIDCClientCredentials{Username: serviceUsername, Groups: serviceGroups},
+			wantStatus:          http.StatusOK,
+			wantExchangeStatus:  http.StatusOK,
+			wantExchangedGroups: []interface{}{"ci", "deployers"},
+		},
+		{
+			name:                "happy path for a client without groups",
+			clientCredentials:   &configv1alpha1.OIDCClientCredentials{Username: serviceUsername},
+			wantStatus:          http.StatusOK,
+			wantExchangeStatus:  http.StatusOK,
+			wantExchangedGroups: []interface{}{},
+		},
+		{
+			name:              "happy path without requesting the groups scope",
+			clientCredentials: &configv1alpha1.OIDCClientCredentials{Username: serviceUsername, Groups: serviceGroups},
+			modifyForm: func(form url.Values) {
+				form.Set("scope", "openid pinniped:request-audience username")
+			},
+			wantStatus:         http.StatusOK,
+			wantExchangeStatus: http.StatusOK,
+		},
+		{
+			name:              "the access token cannot be exchanged without the username scope",
+			clientCredentials: &configv1alpha1.OIDCClientCredentials{Username: serviceUsername, Groups: serviceGroups},
+			modifyForm: func(form url.Values) {
+				form.Set("scope", "openid pinniped:request-audience groups")
+			},
+			wantStatus:         http.StatusOK,
+			wantExchangeStatus: http.StatusForbidden,
+			wantExchangeError:  "access_denied",
+		},
+		{
+			name:              "the FederationDomain's identity transformations are applied to the client's identity",
+			clientCredentials: &configv1alpha1.OIDCClientCredentials{Username: serviceUsername, Groups: serviceGroups},
+			transforms: []celtransformer.CELTransformation{
+				&celtransformer.UsernameTransformation{Expression: `"client:" + username`},
+				&celtransformer.GroupsTransformation{Expression: `groups.map(g, "client:" + g)`},
+			},
+			wantStatus:            http.StatusOK,
+			wantExchangeStatus:    http.StatusOK,
+			wantExchangedUsername: "client:ci-runner",
+			wantExchangedGroups:   []interface{}{"client:ci", "client:deployers"},
+		},
+		{
+			name:              "the FederationDomain's identity policies apply to all of the client's groups, even when the groups scope was not requested",
+			clientCredentials: &configv1alpha1.OIDCClientCredentials{Username: serviceUsername, Groups: serviceGroups},
+			transforms: []celtransformer.CELTransformation{
+				&celtransformer.AllowAuthenticationPolicy{
+					Expression:                    `!("deployers" in groups)`,
+					RejectedAuthenticationMessage: "deployers may not use the client_credentials grant",
+				},
+			},
+			modifyForm: func(form url.Values) {
+				form.Set("scope", "openid pinniped:request-audience username")
+			},
+			wantStatus:           http.StatusForbidden,
+			wantError:            "access_denied",
+			wantErrorDescription: "The resource owner or authorization server denied the request. Rejected by configured identity policy: deployers may not use the client_credentials grant.",
+		},
+		{
+			name:              "the client is not allowed to use the client_credentials grant",
+			clientCredentials: nil,
+			wantStatus:        http.StatusBadRequest,
+			wantError:         "unauthorized_client",
+		},
+		{
+			name:              "the client requests a scope which it is not allowed to request",
+			clientCredentials: &configv1alpha1.OIDCClientCredentials{Username: serviceUsername},
+			modifyForm: func(form url.Values) {
+				form.Set("scope", "openid offline_access")
+			},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid_scope",
+		},
+		{
+			name:              "the client uses the wrong client secret",
+			clientCredentials: &configv1alpha1.OIDCClientCredentials{Username: serviceUsername},
+			clientSecret:      "wrong-secret",
+			wantStatus:        http.StatusUnauthorized,
+			wantError:         "invalid_client",
+		},
+		{
+			name:              "the pinniped-cli client is public, so it cannot use the client_credentials grant",
+			clientCredentials: &configv1alpha1.OIDCClientCredentials{Username: serviceUsername},
+			modifyForm: func(form url.Values) {
+				form.Set("client_id", pinnipedCLIClientID)
+			},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid_grant",
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			kubeClient := fake.NewSimpleClientset()
+			supervisorClient := supervisorfake.NewSimpleClientset()
+			secrets := kubeClient.CoreV1().Secrets("some-namespace")
+
+			grantTypes := []configv1alpha1.GrantType{"authorization_code", "urn:ietf:params:oauth:grant-type:token-exchange"}
+			if test.clientCredentials != nil {
+				grantTypes = append(grantTypes, "client_credentials")
+			}
+			oidcClient := &configv1alpha1.OIDCClient{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "some-namespace", Name: dynamicClientID, Generation: 1, UID: dynamicClientUID},
+				Spec: configv1alpha1.OIDCClientSpec{
+					AllowedGrantTypes:   grantTypes,
+					AllowedScopes:       []configv1alpha1.Scope{"openid", "pinniped:request-audience", "username", "groups"},
+					AllowedRedirectURIs: []configv1alpha1.RedirectURI{goodRedirectURI},
+					ClientCredentials:   test.clientCredentials,
+				},
+			}
+			secret := testutil.OIDCClientSecretStorageSecretForUID(t, "some-namespace", dynamicClientUID, []string{testutil.HashedPassword1AtGoMinCost})
+			valid, conditions, _ := oidcclientvalidator.Validate(oidcClient, secret, bcrypt.MinCost)
+			require.True(t, valid, "Test's OIDCClient should have been valid. See conditions for errors: %s", conditions)
+			require.NoError(t, supervisorClient.Tracker().Add(oidcClient))
+			require.NoError(t, kubeClient.Tracker().Add(secret))
+
+			oauthStore := oidc.NewKubeStorage(secrets, supervisorClient.ConfigV1alpha1().OIDCClients("some-namespace"), goodIssuer, oidc.DefaultOIDCTimeoutsConfiguration(), bcrypt.MinCost)
+			_, jwkProvider := generateJWTSigningKeyAndJWKSProvider(t, goodIssuer)
+			oauthHelper := oidc.FositeOauth2Helper(oauthStore, goodIssuer, hmacSecretFunc, nil, jwkProvider, oidc.DefaultOIDCTimeoutsConfiguration(), nil)
+			auditLogger := auditlog.NewTestLogger(t)
+			idpListerBuilder := oidctestutil.NewUpstreamIDPListerBuilder()
+			if test.transforms != nil {
+				idpListerBuilder.WithClientCredentialsTransformations(oidctestutil.NewTransformationPipeline(t, nil, test.transforms...))
+			}
+			subject := NewHandler(idpListerBuilder.Build(), oauthHelper, nil, "", auditLogger)
+
+			clientSecret := testutil.PlaintextPassword1
+			if test.clientSecret != "" {
+				clientSecret = test.clientSecret
+			}
+			postForm := func(form url.Values) (int, map[string]interface{}) {
+				req := httptest.NewRequest(http.MethodPost, "/path/shouldn't/matter", body(form).ReadCloser())
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				if form.Get("client_id") == "" {
+					req.SetBasicAuth(dynamicClientID, clientSecret)
+				}
+				rsp := httptest.NewRecorder()
+				subject.ServeHTTP(rsp, req)
+				t.Logf("response body: %q", rsp.Body.String())
+				testutil.RequireEqualContentType(t, rsp.Header().Get("Content-Type"), "application/json")
+				var parsedResponseBody map[string]interface{}
+				require.NoError(t, json.Unmarshal(rsp.Body.Bytes(), &parsedResponseBody))
+				return rsp.Code, parsedResponseBody
+			}
+
+			form := url.Values{
+				"grant_type": {"client_credentials"},
+				"scope":      {"openid pinniped:request-audience username groups"},
+			}
+			if test.modifyForm != nil {
+				test.modifyForm(form)
+			}
+			status, parsedResponseBody := postForm(form)
+			require.Equal(t, test.wantStatus, status)
+			if test.wantError != "" {
+				require.Equal(t, test.wantError, parsedResponseBody["error"])
+				if test.wantErrorDescription != "" {
+					require.Equal(t, test.wantErrorDescription, parsedResponseBody["error_description"])
+				}
+				require.Empty(t, auditLogger.Events())
+				testutil.RequireNumberOfSecretsMatchingLabelSelector(t, secrets, labels.Set{crud.SecretLabelKey: accesstoken.TypeLabelValue}, 0)
+				return
+			}
+
+			wantUsername := serviceUsername
+			if test.wantExchangedUsername != "" {
+				wantUsername = test.wantExchangedUsername
+			}
+
+			// The client gets only an access token for itself, which can be exchanged for an ID token.
+			require.ElementsMatch(t, []string{"access_token", "token_type", "expires_in", "scope"}, getMapKeys(parsedResponseBody))
+			require.Equal(t, form.Get("scope"), parsedResponseBody["scope"])
+			testutil.RequireNumberOfSecretsMatchingLabelSelector(t, secrets, labels.Set{crud.SecretLabelKey: accesstoken.TypeLabelValue}, 1)
+
+			require.Len(t, auditLogger.Events(), 1)
+			tokensIssuedEvent := auditLogger.Events()[0]
+			require.Equal(t, auditlog.DownstreamTokensIssued, tokensIssuedEvent.Type)
+			require.Equal(t, dynamicClientID, tokensIssuedEvent.ClientID)
+			require.Nil(t, tokensIssuedEvent.UpstreamIDP)
+			require.Equal(t, wantUsername, tokensIssuedEvent.User.Username)
+
+			exchangeStatus, parsedExchangeResponseBody := postForm(url.Values{
+				"grant_type":           {"urn:ietf:params:oauth:grant-type:token-exchange"},
+				"audience":             {workloadCluster},
+				"subject_token":        {parsedResponseBody["access_token"].(string)},
+				"subject_token_type":   {"urn:ietf:params:oauth:token-type:access_token"},
+				"requested_token_type": {"urn:ietf:params:oauth:token-type:jwt"},
+			})
+			require.Equal(t, test.wantExchangeStatus, exchangeStatus)
+			if test.wantExchangeError != "" {
+				require.Equal(t, test.wantExchangeError, parsedExchangeResponseBody["error"])
+				return
+			}
+
+			require.Len(t, auditLogger.Events(), 2)
+			require.Equal(t, auditlog.TokenExchanged, auditLogger.Events()[1].Type)
+			require.Equal(t, tokensIssuedEvent.CorrelationID, auditLogger.Events()[1].CorrelationID)
+
+			parsedJWT, err := jose.ParseSigned(parsedExchangeResponseBody["access_token"].(string))
+			require.NoError(t, err)
+			var tokenClaims map[string]interface{}
+			require.NoError(t, json.Unmarshal(parsedJWT.UnsafePayloadWithoutVerification(), &tokenClaims))
+			require.Equal(t, dynamicClientID, tokenClaims["sub"])
+			require.Equal(t, dynamicClientID, tokenClaims["azp"])
+			require.Equal(t, goodIssuer, tokenClaims["iss"])
+			require.Equal(t, []interface{}{workloadCluster}, tokenClaims["aud"])
+			require.Equal(t, wantUsername, tokenClaims["username"])
+			if test.wantExchangedGroups != nil {
+				require.Equal(t, test.wantExchangedGroups, tokenClaims["groups"])
+			} else {
+				require.NotContains(t, tokenClaims, "groups")
+			}
+		})
+	}
+}
+
 type refreshRequestInputs struct {
 	modifyTokenRequest func(tokenRequest *http.Request, refreshToken string, accessToken string)
 	want               tokenEndpointResponseExpectedValues
@@ -1747,10 +2005,24 @@ func TestRefreshGrant(t *testing.T) {
 		activeDirectoryUpstreamResourceUID = "ad-resource-uid"
 		activeDirectoryUpstreamType        = "activedirectory"
 		activeDirectoryUpstreamDN          = "some-ad-user-dn"
+
+		samlUpstreamName        = "some-saml-idp"
+		samlUpstreamResourceUID = "saml-resource-uid"
+		samlUpstreamType        = "saml"
+		samlUpstreamEntityID    = "https://saml-idp.example.com/metadata"
+		samlUpstreamNameID      = "some-saml-name-id"
+
+		githubUpstreamName        = "some-github-idp"
+		githubUpstreamResourceUID = "github-resource-uid"
+		githubUpstreamType        = "github"
+		githubUpstreamAccessToken = "some-github-access-token"
 	)
 
 	ldapUpstreamURL, _ := url.Parse("some-url")
 
+	futureTime := time.Now().Add(time.Hour).UTC()
+	pastTime := time.Now().Add(-time.Hour).UTC()
+
 	// The below values are funcs so every test can have its own copy of the objects, to avoid data races
 	// in these parallel tests.
 
@@ -1762,10 +2034,12 @@ func TestRefreshGrant(t *testing.T) {
 
 	initialUpstreamOIDCRefreshTokenCustomSessionData := func() *psession.CustomSessionData {
 		return &psession.CustomSessionData{
-			Username:     goodUsername,
-			ProviderName: oidcUpstreamName,
-			ProviderUID:  oidcUpstreamResourceUID,
-			ProviderType: oidcUpstreamType,
+			Username:         goodUsername,
+			UpstreamUsername: goodUsername,
+			UpstreamGroups:   goodGroups,
+			ProviderName:     oidcUpstreamName,
+			ProviderUID:      oidcUpstreamResourceUID,
+			ProviderType:     oidcUpstreamType,
 			OIDC: &psession.OIDCSessionData{
 				UpstreamRefreshToken: oidcUpstreamInitialRefreshToken,
 				UpstreamSubject:      goodUpstreamSubject,
@@ -1776,10 +2050,12 @@ func TestRefreshGrant(t *testing.T) {
 
 	initialUpstreamOIDCAccessTokenCustomSessionData := func() *psession.CustomSessionData {
 		return &psession.CustomSessionData{
-			Username:     goodUsername,
-			ProviderName: oidcUpstreamName,
-			ProviderUID:  oidcUpstreamResourceUID,
-			ProviderType: oidcUpstreamType,
+			Username:         goodUsername,
+			UpstreamUsername: goodUsername,
+			UpstreamGroups:   goodGroups,
+			ProviderName:     oidcUpstreamName,
+			ProviderUID:      oidcUpstreamResourceUID,
+			ProviderType:     oidcUpstreamType,
 			OIDC: &psession.OIDCSessionData{
 				UpstreamAccessToken: oidcUpstreamAccessToken,
 				UpstreamSubject:     goodUpstreamSubject,
@@ -1794,6 +2070,12 @@ func TestRefreshGrant(t *testing.T) {
 		return sessionData
 	}
 
+	withUpstreamGroups := func(sessionData *psession.CustomSessionData, upstreamGroups []string) *psession.CustomSessionData {
+		copyOfSessionData := *sessionData
+		copyOfSessionData.UpstreamGroups = upstreamGroups
+		return &copyOfSessionData
+	}
+
 	happyOIDCUpstreamRefreshCall := func() *expectedUpstreamRefresh {
 		return &expectedUpstreamRefresh{
 			performedByUpstreamName: oidcUpstreamName,
@@ -1916,25 +2198,123 @@ func TestRefreshGrant(t *testing.T) {
 	}
 
 	happyActiveDirectoryCustomSessionData := &psession.CustomSessionData{
-		Username:     goodUsername,
-		ProviderUID:  activeDirectoryUpstreamResourceUID,
-		ProviderName: activeDirectoryUpstreamName,
-		ProviderType: activeDirectoryUpstreamType,
+		Username:         goodUsername,
+		UpstreamUsername: goodUsername,
+		UpstreamGroups:   goodGroups,
+		ProviderUID:      activeDirectoryUpstreamResourceUID,
+		ProviderName:     activeDirectoryUpstreamName,
+		ProviderType:     activeDirectoryUpstreamType,
 		ActiveDirectory: &psession.ActiveDirectorySessionData{
 			UserDN: activeDirectoryUpstreamDN,
 		},
 	}
 
 	happyLDAPCustomSessionData := &psession.CustomSessionData{
-		Username:     goodUsername,
-		ProviderUID:  ldapUpstreamResourceUID,
-		ProviderName: ldapUpstreamName,
-		ProviderType: ldapUpstreamType,
+		Username:         goodUsername,
+		UpstreamUsername: goodUsername,
+		UpstreamGroups:   goodGroups,
+		ProviderUID:      ldapUpstreamResourceUID,
+		ProviderName:     ldapUpstreamName,
+		ProviderType:     ldapUpstreamType,
+		LDAP: &psession.LDAPSessionData{
+			UserDN: ldapUpstreamDN,
+		},
+	}
+
+	samlCustomSessionData := func(sessionNotOnOrAfter *time.Time) *psession.CustomSessionData {
+		return &psession.CustomSessionData{
+			Username:         goodUsername,
+			UpstreamUsername: goodUsername,
+			UpstreamGroups:   goodGroups,
+			ProviderUID:      samlUpstreamResourceUID,
+			ProviderName:     samlUpstreamName,
+			ProviderType:     samlUpstreamType,
+			SAML: &psession.SAMLSessionData{
+				UpstreamEntityID:    samlUpstreamEntityID,
+				UpstreamNameID:      samlUpstreamNameID,
+				SessionNotOnOrAfter: sessionNotOnOrAfter,
+			},
+		}
+	}
+
+	happySAMLUpstream := func() *oidctestutil.TestUpstreamSAMLIdentityProvider {
+		return &oidctestutil.TestUpstreamSAMLIdentityProvider{
+			Name:        samlUpstreamName,
+			ResourceUID: samlUpstreamResourceUID,
+			EntityID:    samlUpstreamEntityID,
+		}
+	}
+
+	githubCustomSessionData := &psession.CustomSessionData{
+		Username:         goodUsername,
+		UpstreamUsername: goodUsername,
+		UpstreamGroups:   goodGroups,
+		ProviderUID:      githubUpstreamResourceUID,
+		ProviderName:     githubUpstreamName,
+		ProviderType:     githubUpstreamType,
+		GitHub: &psession.GitHubSessionData{
+			UpstreamAccessToken: githubUpstreamAccessToken,
+		},
+	}
+
+	gitHubUpstreamWithUser := func(user *provider.GitHubUser, err error) *oidctestutil.TestUpstreamGitHubIdentityProvider {
+		return &oidctestutil.TestUpstreamGitHubIdentityProvider{
+			Name:        githubUpstreamName,
+			ResourceUID: githubUpstreamResourceUID,
+			GetUserFunc: func(ctx context.Context, accessToken string) (*provider.GitHubUser, error) {
+				if accessToken != githubUpstreamAccessToken {
+					return nil, errors.New("unexpected access token")
+				}
+				return user, err
+			},
+		}
+	}
+
+	happyGitHubUser := func() *provider.GitHubUser {
+		return &provider.GitHubUser{Username: goodUsername, Groups: goodGroups, DownstreamSubject: goodSubject}
+	}
+
+	upstreamGitHubRefreshFailedErrorBody := here.Doc(`
+		{
+			"error":             "error",
+			"error_description": "Error during upstream refresh. Upstream refresh failed."
+		}
+	`)
+
+	happyLDAPCustomSessionDataWithEmailUpstreamUsername := &psession.CustomSessionData{
+		Username:         goodUsername,
+		UpstreamUsername: goodUsername + "@example.com",
+		UpstreamGroups:   goodGroups,
+		ProviderUID:      ldapUpstreamResourceUID,
+		ProviderName:     ldapUpstreamName,
+		ProviderType:     ldapUpstreamType,
 		LDAP: &psession.LDAPSessionData{
 			UserDN: ldapUpstreamDN,
 		},
 	}
 
+	ldapUpstreamRefreshCallWithUsername := func(username string) *expectedUpstreamRefresh {
+		call := happyLDAPUpstreamRefreshCall()
+		call.args.ExpectedUsername = username
+		return call
+	}
+
+	stripDomainAndPrefixGroupsPipeline := oidctestutil.NewTransformationPipeline(t, nil,
+		&celtransformer.UsernameTransformation{Expression: `username.split("@")[0]`},
+		&celtransformer.GroupsTransformation{Expression: `groups.map(g, "groups_prefix:" + g)`},
+	)
+
+	prefixUsernamePipeline := oidctestutil.NewTransformationPipeline(t, nil,
+		&celtransformer.UsernameTransformation{Expression: `"username_prefix:" + username`},
+	)
+
+	rejectAuthPipeline := oidctestutil.NewTransformationPipeline(t, nil,
+		&celtransformer.AllowAuthenticationPolicy{
+			Expression:                    `"admins" in groups`,
+			RejectedAuthenticationMessage: "only admins may log in",
+		},
+	)
+
 	happyAuthcodeExchangeInputsForOIDCUpstream := authcodeExchangeInputs{
 		customSessionData: initialUpstreamOIDCRefreshTokenCustomSessionData(),
 		modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access username groups") },
@@ -2330,7 +2710,7 @@ func TestRefreshGrant(t *testing.T) {
 					wantGroups:                        []string{"new-group1", "new-group2", "new-group3"},
 					wantUpstreamRefreshCall:           happyOIDCUpstreamRefreshCall(),
 					wantUpstreamOIDCValidateTokenCall: happyUpstreamValidateTokenCall(refreshedUpstreamTokensWithIDAndRefreshTokens(), true),
-					wantCustomSessionDataStored:       upstreamOIDCCustomSessionDataWithNewRefreshToken(oidcUpstreamRefreshedRefreshToken),
+					wantCustomSessionDataStored:       withUpstreamGroups(upstreamOIDCCustomSessionDataWithNewRefreshToken(oidcUpstreamRefreshedRefreshToken), []string{"new-group1", "new-group2", "new-group3"}),
 					wantWarnings: []RecordedWarning{
 						{Text: `User "some-username" has been added to the following groups: ["new-group1" "new-group2" "new-group3"]`},
 						{Text: `User "some-username" has been removed from the following groups: ["group1" "groups2"]`},
@@ -2371,7 +2751,7 @@ func TestRefreshGrant(t *testing.T) {
 					wantGroups:                        []string{"new-group1", "new-group2", "new-group3"},
 					wantUpstreamRefreshCall:           happyOIDCUpstreamRefreshCall(),
 					wantUpstreamOIDCValidateTokenCall: happyUpstreamValidateTokenCall(refreshedUpstreamTokensWithIDAndRefreshTokens(), true),
-					wantCustomSessionDataStored:       upstreamOIDCCustomSessionDataWithNewRefreshToken(oidcUpstreamRefreshedRefreshToken),
+					wantCustomSessionDataStored:       withUpstreamGroups(upstreamOIDCCustomSessionDataWithNewRefreshToken(oidcUpstreamRefreshedRefreshToken), []string{"new-group1", "new-group2", "new-group3"}),
 					wantWarnings:                      nil, // dynamic clients should not get these warnings which are intended for the pinniped-cli client
 				},
 			},
@@ -2399,7 +2779,7 @@ func TestRefreshGrant(t *testing.T) {
 					wantGroups:                        []string{"new-group1", "new-group2", "new-group3"},
 					wantUpstreamRefreshCall:           happyOIDCUpstreamRefreshCall(),
 					wantUpstreamOIDCValidateTokenCall: happyUpstreamValidateTokenCall(refreshedUpstreamTokensWithIDAndRefreshTokens(), true),
-					wantCustomSessionDataStored:       upstreamOIDCCustomSessionDataWithNewRefreshToken(oidcUpstreamRefreshedRefreshToken),
+					wantCustomSessionDataStored:       withUpstreamGroups(upstreamOIDCCustomSessionDataWithNewRefreshToken(oidcUpstreamRefreshedRefreshToken), []string{"new-group1", "new-group2", "new-group3"}),
 					wantWarnings: []RecordedWarning{
 						{Text: `User "some-username" has been added to the following groups: ["new-group1" "new-group2" "new-group3"]`},
 						{Text: `User "some-username" has been removed from the following groups: ["group1" "groups2"]`},
@@ -2430,7 +2810,7 @@ func TestRefreshGrant(t *testing.T) {
 					wantGroups:                        []string{}, // the user no longer belongs to any groups
 					wantUpstreamRefreshCall:           happyOIDCUpstreamRefreshCall(),
 					wantUpstreamOIDCValidateTokenCall: happyUpstreamValidateTokenCall(refreshedUpstreamTokensWithIDAndRefreshTokens(), true),
-					wantCustomSessionDataStored:       upstreamOIDCCustomSessionDataWithNewRefreshToken(oidcUpstreamRefreshedRefreshToken),
+					wantCustomSessionDataStored:       withUpstreamGroups(upstreamOIDCCustomSessionDataWithNewRefreshToken(oidcUpstreamRefreshedRefreshToken), []string{}),
 					wantWarnings: []RecordedWarning{
 						{Text: `User "some-username" has been removed from the following groups: ["group1" "groups2"]`},
 					},
@@ -2483,7 +2863,7 @@ func TestRefreshGrant(t *testing.T) {
 					wantUsername:                goodUsername,
 					wantGroups:                  []string{"new-group1", "new-group2", "new-group3"},
 					wantUpstreamRefreshCall:     happyLDAPUpstreamRefreshCall(),
-					wantCustomSessionDataStored: happyLDAPCustomSessionData,
+					wantCustomSessionDataStored: withUpstreamGroups(happyLDAPCustomSessionData, []string{"new-group1", "new-group2", "new-group3"}),
 					wantWarnings: []RecordedWarning{
 						{Text: `User "some-username" has been added to the following groups: ["new-group1" "new-group2" "new-group3"]`},
 						{Text: `User "some-username" has been removed from the following groups: ["group1" "groups2"]`},
@@ -2520,7 +2900,7 @@ func TestRefreshGrant(t *testing.T) {
 					wantUsername:                goodUsername,
 					wantGroups:                  []string{"new-group1", "new-group2", "new-group3"},
 					wantUpstreamRefreshCall:     happyLDAPUpstreamRefreshCall(),
-					wantCustomSessionDataStored: happyLDAPCustomSessionData,
+					wantCustomSessionDataStored: withUpstreamGroups(happyLDAPCustomSessionData, []string{"new-group1", "new-group2", "new-group3"}),
 					wantWarnings:                nil, // dynamic clients should not get these warnings which are intended for the pinniped-cli client
 				},
 			},
@@ -2544,7 +2924,7 @@ func TestRefreshGrant(t *testing.T) {
 					wantUsername:                goodUsername,
 					wantGroups:                  []string{},
 					wantUpstreamRefreshCall:     happyLDAPUpstreamRefreshCall(),
-					wantCustomSessionDataStored: happyLDAPCustomSessionData,
+					wantCustomSessionDataStored: withUpstreamGroups(happyLDAPCustomSessionData, []string{}),
 					wantWarnings: []RecordedWarning{
 						{Text: `User "some-username" has been removed from the following groups: ["group1" "groups2"]`},
 					},
@@ -2586,7 +2966,7 @@ func TestRefreshGrant(t *testing.T) {
 					wantUsername:                goodUsername,
 					wantGroups:                  []string{"new-group1", "new-group2", "new-group3"},
 					wantUpstreamRefreshCall:     happyLDAPUpstreamRefreshCall(),
-					wantCustomSessionDataStored: happyLDAPCustomSessionData,
+					wantCustomSessionDataStored: withUpstreamGroups(happyLDAPCustomSessionData, []string{"new-group1", "new-group2", "new-group3"}),
 					wantWarnings: []RecordedWarning{
 						{Text: `User "some-username" has been added to the following groups: ["new-group1" "new-group2" "new-group3"]`},
 						{Text: `User "some-username" has been removed from the following groups: ["group1" "groups2"]`},
@@ -2633,7 +3013,7 @@ func TestRefreshGrant(t *testing.T) {
 					wantGroups:                        []string{"new-group1", "new-group2", "new-group3"},
 					wantUpstreamRefreshCall:           happyOIDCUpstreamRefreshCall(),
 					wantUpstreamOIDCValidateTokenCall: happyUpstreamValidateTokenCall(refreshedUpstreamTokensWithIDAndRefreshTokens(), true),
-					wantCustomSessionDataStored:       upstreamOIDCCustomSessionDataWithNewRefreshToken(oidcUpstreamRefreshedRefreshToken),
+					wantCustomSessionDataStored:       withUpstreamGroups(upstreamOIDCCustomSessionDataWithNewRefreshToken(oidcUpstreamRefreshedRefreshToken), []string{"new-group1", "new-group2", "new-group3"}),
 					wantWarnings: []RecordedWarning{
 						{Text: `User "some-username" has been added to the following groups: ["new-group1" "new-group2" "new-group3"]`},
 						{Text: `User "some-username" has been removed from the following groups: ["group1" "groups2"]`},
@@ -2686,7 +3066,7 @@ func TestRefreshGrant(t *testing.T) {
 					wantGroups:                        nil,
 					wantUpstreamRefreshCall:           happyOIDCUpstreamRefreshCall(),
 					wantUpstreamOIDCValidateTokenCall: happyUpstreamValidateTokenCall(refreshedUpstreamTokensWithIDAndRefreshTokens(), true),
-					wantCustomSessionDataStored:       upstreamOIDCCustomSessionDataWithNewRefreshToken(oidcUpstreamRefreshedRefreshToken),
+					wantCustomSessionDataStored:       withUpstreamGroups(upstreamOIDCCustomSessionDataWithNewRefreshToken(oidcUpstreamRefreshedRefreshToken), []string{"new-group1", "new-group2", "new-group3"}),
 				},
 			},
 		},
@@ -2727,7 +3107,7 @@ func TestRefreshGrant(t *testing.T) {
 					wantUsername:                goodUsername,
 					wantGroups:                  []string{"new-group1", "new-group2", "new-group3"}, // groups are updated even though the scope was not included
 					wantUpstreamRefreshCall:     happyLDAPUpstreamRefreshCall(),
-					wantCustomSessionDataStored: happyLDAPCustomSessionData,
+					wantCustomSessionDataStored: withUpstreamGroups(happyLDAPCustomSessionData, []string{"new-group1", "new-group2", "new-group3"}),
 					wantWarnings: []RecordedWarning{
 						{Text: `User "some-username" has been added to the following groups: ["new-group1" "new-group2" "new-group3"]`},
 						{Text: `User "some-username" has been removed from the following groups: ["group1" "groups2"]`},
@@ -3568,6 +3948,260 @@ func TestRefreshGrant(t *testing.T) {
 				),
 			},
 		},
+		{
+			name: "upstream saml refresh happy path without a SessionNotOnOrAfter",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithSAML(happySAMLUpstream()),
+			authcodeExchange: authcodeExchangeInputs{
+				modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access username groups") },
+				customSessionData: samlCustomSessionData(nil),
+				want:              happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(samlCustomSessionData(nil)),
+			},
+			refreshRequest: refreshRequestInputs{
+				want: happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(samlCustomSessionData(nil)),
+			},
+		},
+		{
+			name: "upstream saml refresh happy path before the SessionNotOnOrAfter",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithSAML(happySAMLUpstream()),
+			authcodeExchange: authcodeExchangeInputs{
+				modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access username groups") },
+				customSessionData: samlCustomSessionData(&futureTime),
+				want:              happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(samlCustomSessionData(&futureTime)),
+			},
+			refreshRequest: refreshRequestInputs{
+				want: happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(samlCustomSessionData(&futureTime)),
+			},
+		},
+		{
+			name: "upstream saml refresh after the SessionNotOnOrAfter",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithSAML(happySAMLUpstream()),
+			authcodeExchange: authcodeExchangeInputs{
+				modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access username groups") },
+				customSessionData: samlCustomSessionData(&pastTime),
+				want:              happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(samlCustomSessionData(&pastTime)),
+			},
+			refreshRequest: refreshRequestInputs{
+				want: tokenEndpointResponseExpectedValues{
+					wantStatus: http.StatusUnauthorized,
+					wantErrorResponseBody: here.Doc(`
+						{
+							"error":             "error",
+							"error_description": "Error during upstream refresh. Upstream session has expired."
+						}
+					`),
+				},
+			},
+		},
+		{
+			name: "upstream saml refresh when the resource UID of the provider has changed",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithSAML(&oidctestutil.TestUpstreamSAMLIdentityProvider{
+				Name:        samlUpstreamName,
+				ResourceUID: "some-other-resource-uid",
+				EntityID:    samlUpstreamEntityID,
+			}),
+			authcodeExchange: authcodeExchangeInputs{
+				modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access username groups") },
+				customSessionData: samlCustomSessionData(nil),
+				want:              happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(samlCustomSessionData(nil)),
+			},
+			refreshRequest: refreshRequestInputs{
+				want: tokenEndpointResponseExpectedValues{
+					wantStatus: http.StatusUnauthorized,
+					wantErrorResponseBody: here.Doc(`
+						{
+							"error":             "error",
+							"error_description": "Error during upstream refresh. Provider from upstream session data has changed its resource UID since authentication."
+						}
+					`),
+				},
+			},
+		},
+		{
+			name: "upstream saml refresh when the SAML session data is nil",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithSAML(happySAMLUpstream()),
+			authcodeExchange: authcodeExchangeInputs{
+				modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access username groups") },
+				customSessionData: &psession.CustomSessionData{
+					ProviderUID:  samlUpstreamResourceUID,
+					ProviderName: samlUpstreamName,
+					ProviderType: samlUpstreamType,
+					SAML:         nil,
+				},
+				want: happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(
+					&psession.CustomSessionData{
+						ProviderUID:  samlUpstreamResourceUID,
+						ProviderName: samlUpstreamName,
+						ProviderType: samlUpstreamType,
+						SAML:         nil,
+					},
+				),
+			},
+			refreshRequest: refreshRequestInputs{
+				want: tokenEndpointResponseExpectedValues{
+					wantStatus:            http.StatusInternalServerError,
+					wantErrorResponseBody: pinnipedUpstreamSessionDataNotFoundErrorBody,
+				},
+			},
+		},
+		{
+			name: "upstream github refresh happy path",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithGitHub(gitHubUpstreamWithUser(happyGitHubUser(), nil)),
+			authcodeExchange: authcodeExchangeInputs{
+				modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access username groups") },
+				customSessionData: githubCustomSessionData,
+				want:              happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(githubCustomSessionData),
+			},
+			refreshRequest: refreshRequestInputs{
+				want: happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(githubCustomSessionData),
+			},
+		},
+		{
+			name: "upstream github refresh when the user's teams have changed, it updates groups",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithGitHub(gitHubUpstreamWithUser(&provider.GitHubUser{
+				Username:          goodUsername,
+				Groups:            []string{"my-org/new-team"},
+				DownstreamSubject: goodSubject,
+			}, nil)),
+			authcodeExchange: authcodeExchangeInputs{
+				modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access username groups") },
+				customSessionData: githubCustomSessionData,
+				want:              happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(githubCustomSessionData),
+			},
+			refreshRequest: refreshRequestInputs{
+				want: tokenEndpointResponseExpectedValues{
+					wantStatus:                  http.StatusOK,
+					wantClientID:                pinnipedCLIClientID,
+					wantSuccessBodyFields:       []string{"refresh_token", "access_token", "id_token", "token_type", "expires_in", "scope"},
+					wantRequestedScopes:         []string{"openid", "offline_access", "username", "groups"},
+					wantGrantedScopes:           []string{"openid", "offline_access", "username", "groups"},
+					wantUsername:                goodUsername,
+					wantGroups:                  []string{"my-org/new-team"},
+					wantCustomSessionDataStored: withUpstreamGroups(githubCustomSessionData, []string{"my-org/new-team"}),
+					wantWarnings: []RecordedWarning{
+						{Text: `User "some-username" has been added to the following groups: ["my-org/new-team"]`},
+						{Text: `User "some-username" has been removed from the following groups: ["group1" "groups2"]`},
+					},
+				},
+			},
+		},
+		{
+			name: "upstream github refresh when the user is no longer a member of an allowed organization",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithGitHub(gitHubUpstreamWithUser(nil, provider.ErrGitHubUserNotInAllowedOrganizations)),
+			authcodeExchange: authcodeExchangeInputs{
+				modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access username groups") },
+				customSessionData: githubCustomSessionData,
+				want:              happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(githubCustomSessionData),
+			},
+			refreshRequest: refreshRequestInputs{
+				want: tokenEndpointResponseExpectedValues{
+					wantStatus:            http.StatusUnauthorized,
+					wantErrorResponseBody: upstreamGitHubRefreshFailedErrorBody,
+				},
+			},
+		},
+		{
+			name: "upstream github refresh when the upstream access token has been revoked",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithGitHub(gitHubUpstreamWithUser(nil, errors.New("some GitHub API error"))),
+			authcodeExchange: authcodeExchangeInputs{
+				modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access username groups") },
+				customSessionData: githubCustomSessionData,
+				want:              happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(githubCustomSessionData),
+			},
+			refreshRequest: refreshRequestInputs{
+				want: tokenEndpointResponseExpectedValues{
+					wantStatus:            http.StatusUnauthorized,
+					wantErrorResponseBody: upstreamGitHubRefreshFailedErrorBody,
+				},
+			},
+		},
+		{
+			name: "upstream github refresh when the subject has changed",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithGitHub(gitHubUpstreamWithUser(&provider.GitHubUser{
+				Username:          goodUsername,
+				Groups:            goodGroups,
+				DownstreamSubject: "https://github.com?sub=some-other-id",
+			}, nil)),
+			authcodeExchange: authcodeExchangeInputs{
+				modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access username groups") },
+				customSessionData: githubCustomSessionData,
+				want:              happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(githubCustomSessionData),
+			},
+			refreshRequest: refreshRequestInputs{
+				want: tokenEndpointResponseExpectedValues{
+					wantStatus:            http.StatusUnauthorized,
+					wantErrorResponseBody: upstreamGitHubRefreshFailedErrorBody,
+				},
+			},
+		},
+		{
+			name: "upstream github refresh when the username has changed",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithGitHub(gitHubUpstreamWithUser(&provider.GitHubUser{
+				Username:          "some-renamed-username",
+				Groups:            goodGroups,
+				DownstreamSubject: goodSubject,
+			}, nil)),
+			authcodeExchange: authcodeExchangeInputs{
+				modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access username groups") },
+				customSessionData: githubCustomSessionData,
+				want:              happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(githubCustomSessionData),
+			},
+			refreshRequest: refreshRequestInputs{
+				want: tokenEndpointResponseExpectedValues{
+					wantStatus:            http.StatusUnauthorized,
+					wantErrorResponseBody: upstreamGitHubRefreshFailedErrorBody,
+				},
+			},
+		},
+		{
+			name: "upstream github refresh when the resource UID of the provider has changed",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithGitHub(&oidctestutil.TestUpstreamGitHubIdentityProvider{
+				Name:        githubUpstreamName,
+				ResourceUID: "some-other-resource-uid",
+			}),
+			authcodeExchange: authcodeExchangeInputs{
+				modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access username groups") },
+				customSessionData: githubCustomSessionData,
+				want:              happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(githubCustomSessionData),
+			},
+			refreshRequest: refreshRequestInputs{
+				want: tokenEndpointResponseExpectedValues{
+					wantStatus: http.StatusUnauthorized,
+					wantErrorResponseBody: here.Doc(`
+						{
+							"error":             "error",
+							"error_description": "Error during upstream refresh. Provider from upstream session data has changed its resource UID since authentication."
+						}
+					`),
+				},
+			},
+		},
+		{
+			name: "upstream github refresh when the GitHub session data is nil",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithGitHub(gitHubUpstreamWithUser(happyGitHubUser(), nil)),
+			authcodeExchange: authcodeExchangeInputs{
+				modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access username groups") },
+				customSessionData: &psession.CustomSessionData{
+					ProviderUID:  githubUpstreamResourceUID,
+					ProviderName: githubUpstreamName,
+					ProviderType: githubUpstreamType,
+					GitHub:       nil,
+				},
+				want: happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(
+					&psession.CustomSessionData{
+						ProviderUID:  githubUpstreamResourceUID,
+						ProviderName: githubUpstreamName,
+						ProviderType: githubUpstreamType,
+						GitHub:       nil,
+					},
+				),
+			},
+			refreshRequest: refreshRequestInputs{
+				want: tokenEndpointResponseExpectedValues{
+					wantStatus:            http.StatusInternalServerError,
+					wantErrorResponseBody: pinnipedUpstreamSessionDataNotFoundErrorBody,
+				},
+			},
+		},
 		{
 			name: "upstream ldap refresh when the LDAP session data is nil",
 			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithLDAP(&oidctestutil.TestUpstreamLDAPIdentityProvider{
@@ -3742,6 +4376,110 @@ func TestRefreshGrant(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "upstream ldap refresh happy path with identity transformations",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithLDAP(&oidctestutil.TestUpstreamLDAPIdentityProvider{
+				Name:                 ldapUpstreamName,
+				ResourceUID:          ldapUpstreamResourceUID,
+				URL:                  ldapUpstreamURL,
+				PerformRefreshGroups: []string{"new-group1", "new-group2", "new-group3"},
+			}).WithIdentityTransformations(ldapUpstreamName, ldapUpstreamType, stripDomainAndPrefixGroupsPipeline),
+			authcodeExchange: authcodeExchangeInputs{
+				modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access username groups") },
+				customSessionData: happyLDAPCustomSessionDataWithEmailUpstreamUsername,
+				want:              happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(happyLDAPCustomSessionDataWithEmailUpstreamUsername),
+			},
+			refreshRequest: refreshRequestInputs{
+				want: tokenEndpointResponseExpectedValues{
+					wantStatus:              http.StatusOK,
+					wantClientID:            pinnipedCLIClientID,
+					wantSuccessBodyFields:   []string{"refresh_token", "access_token", "id_token", "token_type", "expires_in", "scope"},
+					wantRequestedScopes:     []string{"openid", "offline_access", "username", "groups"},
+					wantGrantedScopes:       []string{"openid", "offline_access", "username", "groups"},
+					wantUsername:            goodUsername,
+					wantGroups:              []string{"groups_prefix:new-group1", "groups_prefix:new-group2", "groups_prefix:new-group3"},
+					wantUpstreamRefreshCall: ldapUpstreamRefreshCallWithUsername(goodUsername + "@example.com"),
+					wantCustomSessionDataStored: withUpstreamGroups(
+						happyLDAPCustomSessionDataWithEmailUpstreamUsername,
+						[]string{"new-group1", "new-group2", "new-group3"},
+					),
+					wantWarnings: []RecordedWarning{
+						{Text: `User "some-username" has been added to the following groups: ["groups_prefix:new-group1" "groups_prefix:new-group2" "groups_prefix:new-group3"]`},
+						{Text: `User "some-username" has been removed from the following groups: ["group1" "groups2"]`},
+					},
+				},
+			},
+		},
+		{
+			name: "upstream ldap refresh when an identity policy rejects the refresh",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithLDAP(&oidctestutil.TestUpstreamLDAPIdentityProvider{
+				Name:                 ldapUpstreamName,
+				ResourceUID:          ldapUpstreamResourceUID,
+				URL:                  ldapUpstreamURL,
+				PerformRefreshGroups: []string{"new-group1", "new-group2", "new-group3"},
+			}).WithIdentityTransformations(ldapUpstreamName, ldapUpstreamType, rejectAuthPipeline),
+			authcodeExchange: happyAuthcodeExchangeInputsForLDAPUpstream,
+			refreshRequest: refreshRequestInputs{
+				want: tokenEndpointResponseExpectedValues{
+					wantUpstreamRefreshCall: happyLDAPUpstreamRefreshCall(),
+					wantStatus:              http.StatusUnauthorized,
+					wantErrorResponseBody: here.Doc(`
+						{
+							"error":             "error",
+							"error_description": "Error during upstream refresh. Upstream refresh rejected by configured identity policy: only admins may log in."
+						}
+					`),
+				},
+			},
+		},
+		{
+			name: "upstream ldap refresh when the identity transformations now produce a different username",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithLDAP(&oidctestutil.TestUpstreamLDAPIdentityProvider{
+				Name:                 ldapUpstreamName,
+				ResourceUID:          ldapUpstreamResourceUID,
+				URL:                  ldapUpstreamURL,
+				PerformRefreshGroups: goodGroups,
+			}).WithIdentityTransformations(ldapUpstreamName, ldapUpstreamType, prefixUsernamePipeline),
+			authcodeExchange: happyAuthcodeExchangeInputsForLDAPUpstream,
+			refreshRequest: refreshRequestInputs{
+				want: tokenEndpointResponseExpectedValues{
+					wantUpstreamRefreshCall: happyLDAPUpstreamRefreshCall(),
+					wantStatus:              http.StatusUnauthorized,
+					wantErrorResponseBody: here.Doc(`
+						{
+							"error":             "error",
+							"error_description": "Error during upstream refresh. Upstream refresh failed."
+						}
+					`),
+				},
+			},
+		},
+		{
+			name: "upstream oidc refresh when an identity policy rejects the refresh",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(
+				upstreamOIDCIdentityProviderBuilder().WithValidatedAndMergedWithUserInfoTokens(&oidctypes.Token{
+					IDToken: &oidctypes.IDToken{
+						Claims: map[string]interface{}{
+							"sub": goodUpstreamSubject,
+						},
+					},
+				}).WithRefreshedTokens(refreshedUpstreamTokensWithIDAndRefreshTokens()).Build(),
+			).WithIdentityTransformations(oidcUpstreamName, oidcUpstreamType, rejectAuthPipeline),
+			authcodeExchange: happyAuthcodeExchangeInputsForOIDCUpstream,
+			refreshRequest: refreshRequestInputs{
+				want: tokenEndpointResponseExpectedValues{
+					wantUpstreamRefreshCall:           happyOIDCUpstreamRefreshCall(),
+					wantUpstreamOIDCValidateTokenCall: happyUpstreamValidateTokenCall(refreshedUpstreamTokensWithIDAndRefreshTokens(), true),
+					wantStatus:                        http.StatusUnauthorized,
+					wantErrorResponseBody: here.Doc(`
+						{
+							"error":             "error",
+							"error_description": "Error during upstream refresh. Upstream refresh rejected by configured identity policy: only admins may log in."
+						}
+					`),
+				},
+			},
+		},
 		{
 			name: "upstream active directory refresh returns an error",
 			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithActiveDirectory(&oidctestutil.TestUpstreamLDAPIdentityProvider{
@@ -4001,7 +4739,7 @@ func TestRefreshGrant(t *testing.T) {
 			// First exchange the authcode for tokens, including a refresh token.
 			// its actually fine to use this function even when simulating ldap (which uses a different flow) because it's
 			// just populating a secret in storage.
-			subject, rsp, authCode, jwtSigningKey, secrets, oauthStore := exchangeAuthcodeForTokens(t,
+			subject, rsp, authCode, jwtSigningKey, secrets, oauthStore, auditLogger := exchangeAuthcodeForTokens(t,
 				test.authcodeExchange, test.idps.Build(), test.kubeResources)
 			var parsedAuthcodeExchangeResponseBody map[string]interface{}
 			require.NoError(t, json.Unmarshal(rsp.Body.Bytes(), &parsedAuthcodeExchangeResponseBody))
@@ -4087,6 +4825,17 @@ func TestRefreshGrant(t *testing.T) {
 				approxRequestTime,
 			)
 
+			// The refresh should be audited after the authcode exchange. Successful refreshes belong to the same session.
+			auditEvents := auditLogger.Events()
+			require.Len(t, auditEvents, 2)
+			if test.refreshRequest.want.wantStatus == http.StatusOK {
+				require.Equal(t, auditlog.RefreshSucceeded, auditEvents[1].Type)
+				require.Equal(t, auditEvents[0].CorrelationID, auditEvents[1].CorrelationID)
+			} else {
+				require.Equal(t, auditlog.RefreshRejected, auditEvents[1].Type)
+				require.NotEmpty(t, auditEvents[1].Message)
+			}
+
 			if test.refreshRequest.want.wantStatus == http.StatusOK {
 				wantIDToken := contains(test.refreshRequest.want.wantSuccessBodyFields, "id_token")
 
@@ -4149,7 +4898,7 @@ func requireClaimsAreEqual(t *testing.T, claimName string, claimsOfTokenA map[st
 func exchangeAuthcodeForTokens(
 	t *testing.T,
 	test authcodeExchangeInputs,
-	idps provider.DynamicUpstreamIDPProvider,
+	idps *oidctestutil.TestFederationDomainIdentityProvidersLister,
 	kubeResources func(t *testing.T, supervisorClient *supervisorfake.Clientset, kubeClient *fake.Clientset),
 ) (
 	subject http.Handler,
@@ -4158,6 +4907,7 @@ func exchangeAuthcodeForTokens(
 	jwtSigningKey *ecdsa.PrivateKey,
 	secrets v1.SecretInterface,
 	oauthStore *oidc.KubeStorage,
+	auditLogger *auditlog.TestLogger,
 ) {
 	authRequest := deepCopyRequestForm(happyAuthRequest)
 	if test.modifyAuthRequest != nil {
@@ -4173,9 +4923,9 @@ func exchangeAuthcodeForTokens(
 		kubeResources(t, supervisorClient, kubeClient)
 	}
 
-	var oauthHelper fosite.OAuth2Provider
+	var oauthHelper device.ClientAuthenticator
 	// Use lower minimum required bcrypt cost than we would use in production to keep unit the tests fast.
-	oauthStore = oidc.NewKubeStorage(secrets, oidcClientsClient, oidc.DefaultOIDCTimeoutsConfiguration(), bcrypt.MinCost)
+	oauthStore = oidc.NewKubeStorage(secrets, oidcClientsClient, goodIssuer, oidc.DefaultOIDCTimeoutsConfiguration(), bcrypt.MinCost)
 
 	if test.makeJwksSigningKeyAndProvider == nil {
 		test.makeJwksSigningKeyAndProvider = generateJWTSigningKeyAndJWKSProvider
@@ -4184,7 +4934,8 @@ func exchangeAuthcodeForTokens(
 	// Note that makeHappyOauthHelper() calls simulateAuthEndpointHavingAlreadyRun() to preload the session storage.
 	oauthHelper, authCode, jwtSigningKey = makeHappyOauthHelper(t, authRequest, oauthStore, test.makeJwksSigningKeyAndProvider, test.customSessionData, test.modifySession)
 
-	subject = NewHandler(idps, oauthHelper)
+	auditLogger = auditlog.NewTestLogger(t)
+	subject = NewHandler(idps, oauthHelper, devicecode.New(secrets, time.Now, time.Hour), goodIssuer+oidc.DeviceCallbackEndpointPath, auditLogger)
 
 	authorizeEndpointGrantedOpenIDScope := strings.Contains(authRequest.Form.Get("scope"), "openid")
 	expectedNumberOfIDSessionsStored := 0
@@ -4226,7 +4977,17 @@ func exchangeAuthcodeForTokens(
 		approxRequestTime,
 	)
 
-	return subject, rsp, authCode, jwtSigningKey, secrets, oauthStore
+	auditEvents := auditLogger.Events()
+	if test.want.wantStatus == http.StatusOK {
+		require.Len(t, auditEvents, 1)
+		require.Equal(t, auditlog.DownstreamTokensIssued, auditEvents[0].Type)
+		require.NotEmpty(t, auditEvents[0].CorrelationID)
+		require.Equal(t, test.want.wantClientID, auditEvents[0].ClientID)
+	} else {
+		require.Empty(t, auditEvents)
+	}
+
+	return subject, rsp, authCode, jwtSigningKey, secrets, oauthStore, auditLogger
 }
 
 func requireTokenEndpointBehavior(
@@ -4383,11 +5144,11 @@ func makeHappyOauthHelper(
 	makeJwksSigningKeyAndProvider MakeJwksSigningKeyAndProviderFunc,
 	initialCustomSessionData *psession.CustomSessionData,
 	modifySession func(session *psession.PinnipedSession),
-) (fosite.OAuth2Provider, string, *ecdsa.PrivateKey) {
+) (device.ClientAuthenticator, string, *ecdsa.PrivateKey) {
 	t.Helper()
 
 	jwtSigningKey, jwkProvider := makeJwksSigningKeyAndProvider(t, goodIssuer)
-	oauthHelper := oidc.FositeOauth2Helper(store, goodIssuer, hmacSecretFunc, jwkProvider, oidc.DefaultOIDCTimeoutsConfiguration())
+	oauthHelper := oidc.FositeOauth2Helper(store, goodIssuer, hmacSecretFunc, nil, jwkProvider, oidc.DefaultOIDCTimeoutsConfiguration(), nil)
 	authResponder := simulateAuthEndpointHavingAlreadyRun(t, authRequest, oauthHelper, initialCustomSessionData, modifySession)
 	return oauthHelper, authResponder.GetCode(), jwtSigningKey
 }
@@ -4459,6 +5220,14 @@ func simulateAuthEndpointHavingAlreadyRun(
 	// The authorization endpoint sets the authorized party to the client ID of the original requester.
 	session.Fosite.Claims.Extra["azp"] = authRequester.GetClient().GetID()
 
+	// The authorization endpoint remembers the correlation ID of the login in the session. Copy the custom session
+	// data first, because the tests share it with their expectations.
+	if session.Custom != nil {
+		customSessionData := *session.Custom
+		session.Custom = &customSessionData
+		oidc.SetCorrelationID(session, authRequester)
+	}
+
 	authResponder, err := oauthHelper.NewAuthorizeResponse(ctx, authRequester, session)
 	require.NoError(t, err)
 	return authResponder
@@ -4474,8 +5243,9 @@ func generateJWTSigningKeyAndJWKSProvider(t *testing.T, issuer string) (*ecdsa.P
 	jwksProvider.SetIssuerToJWKSMap(
 		nil, // public JWKS unused
 		map[string]*jose.JSONWebKey{
-			issuer: {Key: key},
+			issuer: {Key: key, Algorithm: "ES256"},
 		},
+		nil,
 	)
 
 	return key, jwksProvider
@@ -4793,7 +5563,13 @@ func requireValidStoredRequest(
 	require.Empty(t, session.Fosite.Username)
 	require.Empty(t, session.Fosite.Subject)
 
-	// The custom session data was stored as expected.
+	// The custom session data was stored as expected. Its correlation ID is the ID of the authorize request
+	// which created the session, which fosite also uses as the ID of all the token requests of the session.
+	if wantCustomSessionData != nil && wantCustomSessionData.CorrelationID == "" {
+		wantCustomSessionDataWithCorrelationID := *wantCustomSessionData
+		wantCustomSessionDataWithCorrelationID.CorrelationID = request.GetID()
+		wantCustomSessionData = &wantCustomSessionDataWithCorrelationID
+	}
 	require.Equal(t, wantCustomSessionData, session.Custom)
 }
 
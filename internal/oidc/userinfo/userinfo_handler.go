@@ -0,0 +1,91 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package userinfo provides a handler for the OIDC UserInfo endpoint.
+package userinfo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/ory/fosite"
+
+	oidcapi "go.pinniped.dev/generated/latest/apis/supervisor/oidc"
+	"go.pinniped.dev/internal/httputil/httperr"
+	"go.pinniped.dev/internal/oidc"
+	"go.pinniped.dev/internal/psession"
+)
+
+// NewHandler returns an http.Handler which serves the OIDC UserInfo endpoint, as described in
+// https://openid.net/specs/openid-connect-core-1_0.html#UserInfo. It accepts a downstream access token as a bearer
+// token and returns the same identity claims that were put into the ID token of the session, limited by the scopes
+// which were granted to the client.
+func NewHandler(oauthHelper fosite.OAuth2Provider) http.Handler {
+	return httperr.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			return httperr.Newf(http.StatusMethodNotAllowed, "%s (try GET or POST)", r.Method)
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+
+		accessRequester := oidc.IntrospectBearerAccessToken(w, r, oauthHelper, "userinfo")
+		if accessRequester == nil {
+			return nil
+		}
+
+		// The UserInfo endpoint is part of OIDC, so it is only available to sessions which were granted the openid scope.
+		grantedScopes := accessRequester.GetGrantedScopes()
+		if !grantedScopes.Has(oidcapi.ScopeOpenID) {
+			oidc.WriteBearerError(w, http.StatusForbidden, "insufficient_scope", fmt.Sprintf("The access token was not granted the %q scope.", oidcapi.ScopeOpenID))
+			return nil
+		}
+
+		session, ok := accessRequester.GetSession().(*psession.PinnipedSession)
+		if !ok || session.Fosite == nil || session.Fosite.Claims == nil {
+			return httperr.New(http.StatusInternalServerError, "session is missing its identity claims")
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(userInfoClaims(session, grantedScopes))
+	})
+}
+
+// userInfoClaims returns the identity claims of the session. These are the same claims that the token endpoint puts
+// into ID tokens, which were already filtered by the granted scopes when the session was created. They are filtered
+// again here in case the granted scopes of the session have changed since then.
+func userInfoClaims(session *psession.PinnipedSession, grantedScopes fosite.Arguments) map[string]interface{} {
+	claims := map[string]interface{}{
+		oidcapi.IDTokenClaimSubject: session.Fosite.Claims.Subject,
+	}
+	extra := session.Fosite.Claims.Extra
+	if username, ok := extra[oidcapi.IDTokenClaimUsername]; ok && grantedScopes.Has(oidcapi.ScopeUsername) {
+		claims[oidcapi.IDTokenClaimUsername] = username
+	}
+	// An empty groups list is returned as an empty list, in the same way that it appears in ID tokens, so clients can
+	// tell that the user has no groups.
+	if groups, ok := extra[oidcapi.IDTokenClaimGroups]; ok && grantedScopes.Has(oidcapi.ScopeGroups) {
+		if isNilList(groups) {
+			groups = []string{}
+		}
+		claims[oidcapi.IDTokenClaimGroups] = groups
+	}
+	if additionalClaims, ok := extra[oidcapi.IDTokenClaimAdditionalClaims]; ok {
+		claims[oidcapi.IDTokenClaimAdditionalClaims] = additionalClaims
+	}
+	return claims
+}
+
+// isNilList returns true for a nil list, which would otherwise be encoded as null.
+func isNilList(value interface{}) bool {
+	switch list := value.(type) {
+	case nil:
+		return true
+	case []string:
+		return list == nil
+	case []interface{}:
+		return list == nil
+	default:
+		return false
+	}
+}
@@ -1,4 +1,4 @@
-// Copyright 2021-2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2021-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package psession
@@ -32,6 +32,18 @@ type CustomSessionData struct {
 	// all users must have a username.
 	Username string `json:"username"`
 
+	// UpstreamUsername is the username from the upstream identity provider during the user's initial login before
+	// identity transformations were applied. We store this so that we can still reapply identity transformations
+	// during refresh flows even when an upstream OIDC provider does not return the username again during the
+	// upstream refresh, and so we can validate that same untransformed username was found during an LDAP refresh.
+	UpstreamUsername string `json:"upstreamUsername"`
+
+	// UpstreamGroups is the groups list from the upstream identity provider during the user's initial login before
+	// identity transformations were applied. We store this so that we can still reapply identity transformations
+	// during refresh flows even when an OIDC provider does not return the groups again during the upstream
+	// refresh, and when the LDAP search was configured to skip group refreshes.
+	UpstreamGroups []string `json:"upstreamGroups"`
+
 	// The Kubernetes resource UID of the identity provider CRD for the upstream IDP used to start this session.
 	// This should be validated again upon downstream refresh to make sure that we are not refreshing against
 	// a different identity provider CRD which just happens to have the same name.
@@ -48,6 +60,12 @@ type CustomSessionData struct {
 	// Used during a downstream refresh to decide which upstream to refresh.
 	ProviderType ProviderType `json:"providerType"`
 
+	// CorrelationID is the ID of the downstream authorize request which started this session. It links together
+	// the audit events of the login and of the later use of the session. It is not the ID of the stored session,
+	// which fosite requires to be unique, because a browser-based login may create more than one session using the
+	// same upstream state param. Sessions which were created by older versions of the Supervisor will not have it.
+	CorrelationID string `json:"correlationID,omitempty"`
+
 	// Warnings that were encountered at some point during login that should be emitted to the client.
 	// These will be RFC 2616-formatted errors with error code 299.
 	Warnings []string `json:"warnings"`
@@ -58,6 +76,12 @@ type CustomSessionData struct {
 	LDAP *LDAPSessionData `json:"ldap,omitempty"`
 
 	ActiveDirectory *ActiveDirectorySessionData `json:"activedirectory,omitempty"`
+
+	// Only used when ProviderType == "saml".
+	SAML *SAMLSessionData `json:"saml,omitempty"`
+
+	// Only used when ProviderType == "github".
+	GitHub *GitHubSessionData `json:"github,omitempty"`
 }
 
 type ProviderType string
@@ -66,6 +90,8 @@ const (
 	ProviderTypeOIDC            ProviderType = "oidc"
 	ProviderTypeLDAP            ProviderType = "ldap"
 	ProviderTypeActiveDirectory ProviderType = "activedirectory"
+	ProviderTypeSAML            ProviderType = "saml"
+	ProviderTypeGitHub          ProviderType = "github"
 )
 
 // OIDCSessionData is the additional data needed by Pinniped when the upstream IDP is an OIDC provider.
@@ -105,6 +131,30 @@ type ActiveDirectorySessionData struct {
 	ExtraRefreshAttributes map[string]string `json:"extraRefreshAttributes,omitempty"`
 }
 
+// SAMLSessionData is the additional data needed by Pinniped when the upstream IDP is a SAML provider.
+type SAMLSessionData struct {
+	// UpstreamEntityID is the entity ID of the upstream SAML identity provider which issued the assertion during
+	// the user's initial login.
+	UpstreamEntityID string `json:"upstreamEntityID"`
+
+	// UpstreamNameID is the NameID of the subject of the assertion from the user's initial login.
+	UpstreamNameID string `json:"upstreamNameID"`
+
+	// SessionNotOnOrAfter is the SessionNotOnOrAfter of the AuthnStatement of the assertion from the user's initial
+	// login, if the upstream identity provider included one. SAML has no equivalent of a refresh token, so this
+	// is the only upstream limit on the length of the downstream session. Downstream refreshes are not allowed
+	// at or after this time.
+	SessionNotOnOrAfter *time.Time `json:"sessionNotOnOrAfter,omitempty"`
+}
+
+// GitHubSessionData is the additional data needed by Pinniped when the upstream IDP is a GitHub provider.
+type GitHubSessionData struct {
+	// UpstreamAccessToken is the access token of the user from the initial login. GitHub does not issue refresh
+	// tokens for OAuth Apps, so this token is used during downstream refreshes to check the user's current
+	// organization and team memberships.
+	UpstreamAccessToken string `json:"upstreamAccessToken"`
+}
+
 // NewPinnipedSession returns a new empty session.
 func NewPinnipedSession() *PinnipedSession {
 	return &PinnipedSession{
@@ -1,4 +1,4 @@
-// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2022-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 // Package clientsecretrequest provides REST functionality for the CredentialRequest resource.
@@ -27,6 +27,8 @@ import (
 
 	clientsecretapi "go.pinniped.dev/generated/latest/apis/supervisor/clientsecret"
 	configv1alpha1clientset "go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned/typed/config/v1alpha1"
+	"go.pinniped.dev/internal/auditlog"
+	"go.pinniped.dev/internal/oidc/oidcclientvalidator"
 	"go.pinniped.dev/internal/oidcclientsecretstorage"
 )
 
@@ -46,6 +48,7 @@ func NewREST(
 	randByteGenerator io.Reader,
 	byteHasher byteHasher,
 	timeNowFunc timeNowFunc,
+	auditLogger auditlog.Logger,
 ) *REST {
 	return &REST{
 		secretStorage:     oidcclientsecretstorage.New(secretsClient),
@@ -56,6 +59,7 @@ func NewREST(
 		byteHasher:        byteHasher,
 		tableConvertor:    rest.NewDefaultTableConvertor(resource),
 		timeNowFunc:       timeNowFunc,
+		auditLogger:       auditLogger,
 	}
 }
 
@@ -68,6 +72,7 @@ type REST struct {
 	byteHasher        byteHasher
 	tableConvertor    rest.TableConvertor
 	timeNowFunc       timeNowFunc
+	auditLogger       auditlog.Logger
 }
 
 // Assert that our *REST implements all the optional interfaces that we expect it to implement.
@@ -141,6 +146,21 @@ func (r *REST) Create(ctx context.Context, obj runtime.Object, createValidation
 	}
 	t.Step("oidcClientsClient.Get")
 
+	// Public clients, and clients which authenticate without a client secret, must never have client secrets.
+	// They may still revoke any client secrets which were generated before the client was changed.
+	var noSecretsReason string
+	switch method := oidcClient.Spec.TokenEndpointAuthMethod; {
+	case oidcClient.Spec.Public:
+		noSecretsReason = "is a public client"
+	case method != "" && method != oidcclientvalidator.TokenEndpointAuthMethodClientSecretBasic:
+		noSecretsReason = fmt.Sprintf("uses the %q token endpoint authentication method", method)
+	}
+	if noSecretsReason != "" && req.Spec.GenerateNewSecret {
+		msg := fmt.Sprintf("OIDCClient %s %s, so it cannot have client secrets", oidcClient.Name, noSecretsReason)
+		traceFailure(t, "generateSecret", msg)
+		return nil, apierrors.NewBadRequest(msg)
+	}
+
 	// Using the OIDCClient's UID, check to see if the storage Secret for its client secrets already exists.
 	// Note that when it does not exist, this Get() function will not return an error, and will return nil rv and hashes.
 	rv, hashes, err := r.secretStorage.Get(ctx, oidcClient.UID)
@@ -170,10 +190,15 @@ func (r *REST) Create(ctx context.Context, obj runtime.Object, createValidation
 		hashes = append([]string{string(hash)}, hashes...)
 	}
 
-	// If requested, remove all client secrets except for the most recent one.
+	// If requested, remove all client secrets except for the most recent one. A client which must not have
+	// client secrets keeps none of them.
 	needsRevoke := req.Spec.RevokeOldSecrets && len(hashes) > 0
 	if needsRevoke {
-		hashes = []string{hashes[0]}
+		if noSecretsReason != "" {
+			hashes = []string{}
+		} else {
+			hashes = []string{hashes[0]}
+		}
 	}
 
 	// If anything was requested to change...
@@ -199,6 +224,14 @@ func (r *REST) Create(ctx context.Context, obj runtime.Object, createValidation
 		t.Step("secretStorage.Set")
 	}
 
+	r.auditLogger.Audit(auditlog.Event{
+		Type:    auditlog.OIDCClientSecretRequestCreated,
+		Message: auditMessage(req.Spec.GenerateNewSecret, needsRevoke, len(hashes)),
+		Request: auditlog.RequestFromAPIContext(ctx),
+		User:    auditlog.UserFromAPIContext(ctx),
+		Object:  &auditlog.Object{Kind: "OIDCClient", Namespace: oidcClient.Namespace, Name: oidcClient.Name},
+	})
+
 	// Return the new secret in plaintext, if one was generated, along with the total number of secrets.
 	return &clientsecretapi.OIDCClientSecretRequest{
 		ObjectMeta: metav1.ObjectMeta{
@@ -338,3 +371,17 @@ func kindFromContext(ctx context.Context) schema.GroupKind {
 	// this should never happen in practice
 	return clientsecretapi.Kind("OIDCClientSecretRequest")
 }
+
+func auditMessage(generatedNewSecret bool, revokedOldSecrets bool, totalClientSecrets int) string {
+	var changes []string
+	if generatedNewSecret {
+		changes = append(changes, "generated a new client secret")
+	}
+	if revokedOldSecrets {
+		changes = append(changes, "revoked old client secrets")
+	}
+	if len(changes) == 0 {
+		changes = append(changes, "made no changes")
+	}
+	return fmt.Sprintf("%s, client now has %d client secrets", strings.Join(changes, " and "), totalClientSecrets)
+}
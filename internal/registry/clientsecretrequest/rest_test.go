@@ -1,4 +1,4 @@
-// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2022-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package clientsecretrequest
@@ -31,6 +31,7 @@ import (
 	clientsecretapi "go.pinniped.dev/generated/latest/apis/supervisor/clientsecret"
 	"go.pinniped.dev/generated/latest/apis/supervisor/config/v1alpha1"
 	supervisorfake "go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned/fake"
+	"go.pinniped.dev/internal/auditlog"
 	"go.pinniped.dev/internal/oidcclientsecretstorage"
 	"go.pinniped.dev/internal/plog"
 )
@@ -45,6 +46,7 @@ func TestNew(t *testing.T) {
 		nil,
 		nil,
 		nil,
+		auditlog.NewNoopLogger(),
 	)
 
 	require.NotNil(t, r)
@@ -120,6 +122,7 @@ func TestCreate(t *testing.T) {
 		wantErrStatus     *metav1.Status
 		wantHashes        *wantHashes
 		wantLogLines      []string
+		wantAuditMessage  string
 	}{
 		{
 			name: "wrong type of request object provided",
@@ -714,6 +717,7 @@ func TestCreate(t *testing.T) {
 				`secretStorage.Set`,
 				`END`,
 			},
+			wantAuditMessage: "generated a new client secret, client now has 1 client secrets",
 		},
 		{
 			name: "happy path: secret exists, prepend new secret hash to secret to the list of hashes for found oidcclient",
@@ -783,6 +787,7 @@ func TestCreate(t *testing.T) {
 				`secretStorage.Set`,
 				`END`,
 			},
+			wantAuditMessage: "generated a new client secret, client now has 3 client secrets",
 		},
 		{
 			name: "happy path: secret exists, append new secret hash to secret and revoke old for found oidcclient",
@@ -849,6 +854,7 @@ func TestCreate(t *testing.T) {
 				`secretStorage.Set`,
 				`END`,
 			},
+			wantAuditMessage: "generated a new client secret and revoked old client secrets, client now has 1 client secrets",
 		},
 		{
 			name: "happy path: secret exists, revoke old secrets but retain latest for found oidcclient",
@@ -913,6 +919,206 @@ func TestCreate(t *testing.T) {
 				`secretStorage.Set`,
 				`END`,
 			},
+			wantAuditMessage: "revoked old client secrets, client now has 1 client secrets",
+		},
+		{
+			name: "public oidcclient cannot have a new client secret generated",
+			args: args{
+				ctx: namespacedContext,
+				obj: &clientsecretapi.OIDCClientSecretRequest{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "client.oauth.pinniped.dev-public-client",
+					},
+					Spec: clientsecretapi.OIDCClientSecretRequestSpec{
+						GenerateNewSecret: true,
+						RevokeOldSecrets:  false,
+					},
+				},
+			},
+			seedOIDCClients: []*v1alpha1.OIDCClient{{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "client.oauth.pinniped.dev-public-client",
+					Namespace: namespace,
+					UID:       "12345",
+				},
+				Spec: v1alpha1.OIDCClientSpec{Public: true},
+			}},
+			wantErrStatus: &metav1.Status{
+				Status:  metav1.StatusFailure,
+				Message: `OIDCClient client.oauth.pinniped.dev-public-client is a public client, so it cannot have client secrets`,
+				Reason:  metav1.StatusReasonBadRequest,
+				Code:    http.StatusBadRequest,
+			},
+			wantLogLines: []string{
+				`"create"`,
+				`"validateRequest"`,
+				`oidcClientsClient.Get`,
+				`failureType:generateSecret,msg:OIDCClient client.oauth.pinniped.dev-public-client is a public client, so it cannot have client secrets`,
+				`END`,
+			},
+			want: nil,
+		},
+		{
+			name: "happy path: public oidcclient revokes all of its old secrets",
+			args: args{
+				ctx: namespacedContext,
+				obj: &clientsecretapi.OIDCClientSecretRequest{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "client.oauth.pinniped.dev-public-client",
+					},
+					Spec: clientsecretapi.OIDCClientSecretRequestSpec{
+						GenerateNewSecret: false,
+						RevokeOldSecrets:  true,
+					},
+				},
+			},
+			seedHashes: func(storage *oidcclientsecretstorage.OIDCClientSecretStorage) {
+				require.NoError(t,
+					storage.Set(
+						context.Background(),
+						"",
+						"client.oauth.pinniped.dev-public-client",
+						"12345",
+						[]string{
+							"hashed-password-1",
+							"hashed-password-2",
+						},
+					))
+			},
+			seedOIDCClients: []*v1alpha1.OIDCClient{{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "client.oauth.pinniped.dev-public-client",
+					Namespace: namespace,
+					UID:       "12345",
+				},
+				Spec: v1alpha1.OIDCClientSpec{Public: true},
+			}},
+			wantHashes: &wantHashes{
+				UID:    "12345",
+				hashes: []string{},
+			},
+			want: &clientsecretapi.OIDCClientSecretRequest{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "client.oauth.pinniped.dev-public-client",
+					Namespace:         namespace,
+					CreationTimestamp: fakeNow,
+				},
+				Spec: clientsecretapi.OIDCClientSecretRequestSpec{
+					GenerateNewSecret: false,
+					RevokeOldSecrets:  true,
+				},
+				Status: clientsecretapi.OIDCClientSecretRequestStatus{
+					GeneratedSecret:    "",
+					TotalClientSecrets: 0,
+				},
+			},
+			wantLogLines: []string{
+				`"create"`,
+				`"validateRequest"`,
+				`oidcClientsClient.Get`,
+				`secretStorage.Get`,
+				`secretStorage.Set`,
+				`END`,
+			},
+			wantAuditMessage: "revoked old client secrets, client now has 0 client secrets",
+		},
+		{
+			name: "oidcclient which uses private_key_jwt cannot have a new client secret generated",
+			args: args{
+				ctx: namespacedContext,
+				obj: &clientsecretapi.OIDCClientSecretRequest{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "client.oauth.pinniped.dev-jwt-client",
+					},
+					Spec: clientsecretapi.OIDCClientSecretRequestSpec{
+						GenerateNewSecret: true,
+						RevokeOldSecrets:  false,
+					},
+				},
+			},
+			seedOIDCClients: []*v1alpha1.OIDCClient{{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "client.oauth.pinniped.dev-jwt-client",
+					Namespace: namespace,
+					UID:       "12345",
+				},
+				Spec: v1alpha1.OIDCClientSpec{TokenEndpointAuthMethod: "private_key_jwt"},
+			}},
+			wantErrStatus: &metav1.Status{
+				Status:  metav1.StatusFailure,
+				Message: `OIDCClient client.oauth.pinniped.dev-jwt-client uses the "private_key_jwt" token endpoint authentication method, so it cannot have client secrets`,
+				Reason:  metav1.StatusReasonBadRequest,
+				Code:    http.StatusBadRequest,
+			},
+			wantLogLines: []string{
+				`"create"`,
+				`"validateRequest"`,
+				`oidcClientsClient.Get`,
+				`failureType:generateSecret,msg:OIDCClient client.oauth.pinniped.dev-jwt-client uses the "private_key_jwt" token endpoint authentication method, so it cannot have client secrets`,
+				`END`,
+			},
+			want: nil,
+		},
+		{
+			name: "happy path: oidcclient which uses tls_client_auth revokes all of its old secrets",
+			args: args{
+				ctx: namespacedContext,
+				obj: &clientsecretapi.OIDCClientSecretRequest{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "client.oauth.pinniped.dev-tls-client",
+					},
+					Spec: clientsecretapi.OIDCClientSecretRequestSpec{
+						GenerateNewSecret: false,
+						RevokeOldSecrets:  true,
+					},
+				},
+			},
+			seedHashes: func(storage *oidcclientsecretstorage.OIDCClientSecretStorage) {
+				require.NoError(t,
+					storage.Set(
+						context.Background(),
+						"",
+						"client.oauth.pinniped.dev-tls-client",
+						"12345",
+						[]string{"hashed-password-1"},
+					))
+			},
+			seedOIDCClients: []*v1alpha1.OIDCClient{{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "client.oauth.pinniped.dev-tls-client",
+					Namespace: namespace,
+					UID:       "12345",
+				},
+				Spec: v1alpha1.OIDCClientSpec{TokenEndpointAuthMethod: "tls_client_auth"},
+			}},
+			wantHashes: &wantHashes{
+				UID:    "12345",
+				hashes: []string{},
+			},
+			want: &clientsecretapi.OIDCClientSecretRequest{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "client.oauth.pinniped.dev-tls-client",
+					Namespace:         namespace,
+					CreationTimestamp: fakeNow,
+				},
+				Spec: clientsecretapi.OIDCClientSecretRequestSpec{
+					GenerateNewSecret: false,
+					RevokeOldSecrets:  true,
+				},
+				Status: clientsecretapi.OIDCClientSecretRequestStatus{
+					GeneratedSecret:    "",
+					TotalClientSecrets: 0,
+				},
+			},
+			wantLogLines: []string{
+				`"create"`,
+				`"validateRequest"`,
+				`oidcClientsClient.Get`,
+				`secretStorage.Get`,
+				`secretStorage.Set`,
+				`END`,
+			},
+			wantAuditMessage: "revoked old client secrets, client now has 0 client secrets",
 		},
 		{
 			name: "secret exists but oidcclient secret has too many hashes, fails to create when RevokeOldSecrets:false (max 5), secret is not updated",
@@ -1240,6 +1446,7 @@ func TestCreate(t *testing.T) {
 				`secretStorage.Get`,
 				`END`,
 			},
+			wantAuditMessage: "made no changes, client now has 0 client secrets",
 		},
 		{
 			name: "happy path noop: do not create a new secret, revoke old secrets, but there is no existing storage secret",
@@ -1284,6 +1491,7 @@ func TestCreate(t *testing.T) {
 				`secretStorage.Get`,
 				`END`,
 			},
+			wantAuditMessage: "made no changes, client now has 0 client secrets",
 		},
 		{
 			name: "happy path noop: do not create a new secret, revoke old secrets, and there is an existing storage secret",
@@ -1348,6 +1556,7 @@ func TestCreate(t *testing.T) {
 				`secretStorage.Get`,
 				`END`,
 			},
+			wantAuditMessage: "made no changes, client now has 2 client secrets",
 		},
 		{
 			name: "happy path: generate new secret and revoking old secret when there was a single secret hash to start with",
@@ -1413,6 +1622,7 @@ func TestCreate(t *testing.T) {
 				`secretStorage.Set`,
 				`END`,
 			},
+			wantAuditMessage: "generated a new client secret and revoked old client secrets, client now has 1 client secrets",
 		},
 		{
 			name: "happy path: generate new secret when existing secrets is max (5)",
@@ -1482,6 +1692,7 @@ func TestCreate(t *testing.T) {
 				`secretStorage.Set`,
 				`END`,
 			},
+			wantAuditMessage: "generated a new client secret and revoked old client secrets, client now has 1 client secrets",
 		},
 		{
 			name: "happy path: generate new secret when existing secrets exceeds maximum (5)",
@@ -1552,6 +1763,7 @@ func TestCreate(t *testing.T) {
 				`secretStorage.Set`,
 				`END`,
 			},
+			wantAuditMessage: "generated a new client secret and revoked old client secrets, client now has 1 client secrets",
 		},
 	}
 	for _, tt := range tests {
@@ -1566,6 +1778,7 @@ func TestCreate(t *testing.T) {
 				klog.ClearLogger()
 			})
 
+			auditLogger := auditlog.NewTestLogger(t)
 			kubeClient := kubefake.NewSimpleClientset()
 			secretsClient := kubeClient.CoreV1().Secrets(namespace)
 			// Production code depends on secrets having a resource version.
@@ -1614,6 +1827,7 @@ func TestCreate(t *testing.T) {
 				fakeByteGenerator,
 				fakeHasher,
 				fakeTimeNowFunc,
+				auditLogger,
 			)
 
 			got, err := r.Create(tt.args.ctx, tt.args.obj, tt.args.createValidation, tt.args.options)
@@ -1645,6 +1859,20 @@ func TestCreate(t *testing.T) {
 			}
 
 			requireLogLinesContain(t, log.String(), tt.wantLogLines)
+
+			if tt.wantAuditMessage == "" {
+				require.Empty(t, auditLogger.Events())
+			} else {
+				require.Equal(t, []auditlog.Event{{
+					Type:    auditlog.OIDCClientSecretRequestCreated,
+					Message: tt.wantAuditMessage,
+					Object: &auditlog.Object{
+						Kind:      "OIDCClient",
+						Namespace: namespace,
+						Name:      tt.want.(*clientsecretapi.OIDCClientSecretRequest).Name,
+					},
+				}}, auditLogger.Events())
+			}
 		})
 	}
 }
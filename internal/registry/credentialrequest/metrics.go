@@ -0,0 +1,50 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package credentialrequest
+
+import (
+	"time"
+
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+// Values for the outcome label of the TokenCredentialRequest metrics.
+const (
+	outcomeSuccess             = "success"
+	outcomeInvalidRequest      = "invalid_request"
+	outcomeAuthenticationError = "authentication_error"
+	outcomeNotAuthenticated    = "not_authenticated"
+	outcomeCertIssuerError     = "cert_issuer_error"
+)
+
+//nolint:gochecknoglobals // metrics are registered once per process
+var (
+	tokenCredentialRequestsTotal = metrics.NewCounterVec(&metrics.CounterOpts{
+		Namespace:      "pinniped",
+		Subsystem:      "concierge",
+		Name:           "token_credential_requests_total",
+		Help:           "Number of TokenCredentialRequests handled by the Concierge, partitioned by outcome.",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"outcome"})
+
+	tokenCredentialRequestDuration = metrics.NewHistogramVec(&metrics.HistogramOpts{
+		Namespace:      "pinniped",
+		Subsystem:      "concierge",
+		Name:           "token_credential_request_duration_seconds",
+		Help:           "Time taken to handle TokenCredentialRequests, partitioned by outcome.",
+		Buckets:        metrics.ExponentialBuckets(0.005, 2, 12), // 5ms to about 10s
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"outcome"})
+)
+
+//nolint:gochecknoinits
+func init() {
+	legacyregistry.MustRegister(tokenCredentialRequestsTotal, tokenCredentialRequestDuration)
+}
+
+func recordTokenCredentialRequest(start time.Time, outcome string) {
+	tokenCredentialRequestsTotal.WithLabelValues(outcome).Inc()
+	tokenCredentialRequestDuration.WithLabelValues(outcome).Observe(time.Since(start).Seconds())
+}
@@ -1,4 +1,4 @@
-// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 // Package credentialrequest provides REST functionality for the CredentialRequest resource.
@@ -21,6 +21,7 @@ import (
 	"k8s.io/utils/trace"
 
 	loginapi "go.pinniped.dev/generated/latest/apis/concierge/login"
+	"go.pinniped.dev/internal/auditlog"
 	"go.pinniped.dev/internal/issuer"
 )
 
@@ -31,11 +32,12 @@ type TokenCredentialRequestAuthenticator interface {
 	AuthenticateTokenCredentialRequest(ctx context.Context, req *loginapi.TokenCredentialRequest) (user.Info, error)
 }
 
-func NewREST(authenticator TokenCredentialRequestAuthenticator, issuer issuer.ClientCertIssuer, resource schema.GroupResource) *REST {
+func NewREST(authenticator TokenCredentialRequestAuthenticator, issuer issuer.ClientCertIssuer, resource schema.GroupResource, auditLogger auditlog.Logger) *REST {
 	return &REST{
 		authenticator:  authenticator,
 		issuer:         issuer,
 		tableConvertor: rest.NewDefaultTableConvertor(resource),
+		auditLogger:    auditLogger,
 	}
 }
 
@@ -43,6 +45,7 @@ type REST struct {
 	authenticator  TokenCredentialRequestAuthenticator
 	issuer         issuer.ClientCertIssuer
 	tableConvertor rest.TableConvertor
+	auditLogger    auditlog.Logger
 }
 
 // Assert that our *REST implements all the optional interfaces that we expect it to implement.
@@ -93,18 +96,23 @@ func (r *REST) Create(ctx context.Context, obj runtime.Object, createValidation
 	})
 	defer t.Log()
 
+	start := time.Now()
+
 	credentialRequest, err := validateRequest(ctx, obj, createValidation, options, t)
 	if err != nil {
+		recordTokenCredentialRequest(start, outcomeInvalidRequest)
 		return nil, err
 	}
 
 	userInfo, err := r.authenticator.AuthenticateTokenCredentialRequest(ctx, credentialRequest)
 	if err != nil {
 		traceFailureWithError(t, "token authentication", err)
+		recordTokenCredentialRequest(start, outcomeAuthenticationError)
 		return failureResponse(), nil
 	}
 	if ok := isUserInfoValid(userInfo); !ok {
 		traceSuccess(t, userInfo, false)
+		recordTokenCredentialRequest(start, outcomeNotAuthenticated)
 		return failureResponse(), nil
 	}
 
@@ -113,10 +121,21 @@ func (r *REST) Create(ctx context.Context, obj runtime.Object, createValidation
 	certPEM, keyPEM, err := r.issuer.IssueClientCertPEM(userInfo.GetName(), userInfo.GetGroups(), clientCertificateTTL)
 	if err != nil {
 		traceFailureWithError(t, "cert issuer", err)
+		recordTokenCredentialRequest(start, outcomeCertIssuerError)
 		return failureResponse(), nil
 	}
 
 	traceSuccess(t, userInfo, true)
+	recordTokenCredentialRequest(start, outcomeSuccess)
+	r.auditLogger.Audit(auditlog.Event{
+		Type:    auditlog.TokenCredentialRequestIssued,
+		Request: auditlog.RequestFromAPIContext(ctx),
+		User:    &auditlog.User{Username: userInfo.GetName(), Groups: userInfo.GetGroups(), UID: userInfo.GetUID()},
+		Object: &auditlog.Object{
+			Kind: credentialRequest.Spec.Authenticator.Kind,
+			Name: credentialRequest.Spec.Authenticator.Name,
+		},
+	})
 
 	return &loginapi.TokenCredentialRequest{
 		Status: loginapi.TokenCredentialRequestStatus{
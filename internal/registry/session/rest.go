@@ -0,0 +1,525 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package session provides REST functionality for the Session resource.
+package session
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/registry/rest"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/utils/trace"
+
+	sessionapi "go.pinniped.dev/generated/latest/apis/supervisor/session"
+	"go.pinniped.dev/internal/auditlog"
+	"go.pinniped.dev/internal/crud"
+	"go.pinniped.dev/internal/fositestorage"
+	"go.pinniped.dev/internal/fositestorage/accesstoken"
+	"go.pinniped.dev/internal/fositestorage/refreshtoken"
+	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/plog"
+	"go.pinniped.dev/internal/psession"
+)
+
+// UpstreamOIDCIdentityProviderICache is a thread safe cache that holds a list of validated upstream OIDC IDP configurations.
+type UpstreamOIDCIdentityProviderICache interface {
+	GetOIDCIdentityProviders() []provider.UpstreamOIDCIdentityProviderI
+}
+
+func NewREST(
+	resource schema.GroupResource,
+	secretsClient corev1client.SecretInterface,
+	idpCache UpstreamOIDCIdentityProviderICache,
+	namespace string,
+	auditLogger auditlog.Logger,
+) *REST {
+	return &REST{
+		resource:      resource,
+		secretsClient: secretsClient,
+		idpCache:      idpCache,
+		namespace:     namespace,
+		auditLogger:   auditLogger,
+	}
+}
+
+type REST struct {
+	resource      schema.GroupResource
+	secretsClient corev1client.SecretInterface
+	idpCache      UpstreamOIDCIdentityProviderICache
+	namespace     string
+	auditLogger   auditlog.Logger
+}
+
+// Assert that our *REST implements all the optional interfaces that we expect it to implement.
+var _ interface {
+	rest.Getter
+	rest.Lister
+	rest.GracefulDeleter
+	rest.Scoper
+	rest.Storage
+	rest.CategoriesProvider
+	rest.TableConvertor
+} = (*REST)(nil)
+
+func (*REST) New() runtime.Object {
+	return &sessionapi.Session{}
+}
+
+func (*REST) Destroy() {}
+
+func (*REST) NewList() runtime.Object {
+	return &sessionapi.SessionList{}
+}
+
+func (*REST) NamespaceScoped() bool {
+	return true
+}
+
+func (*REST) Categories() []string {
+	return []string{"pinniped"}
+}
+
+// storedSession is a downstream session along with the upstream session data which was read from its storage.
+type storedSession struct {
+	session *sessionapi.Session
+	// custom is the session data which holds the latest upstream tokens of the session.
+	custom *psession.CustomSessionData
+}
+
+func (r *REST) Get(ctx context.Context, name string, _ *metav1.GetOptions) (runtime.Object, error) {
+	t := trace.FromContext(ctx).Nest("get",
+		trace.Field{Key: "kind", Value: "Session"},
+		trace.Field{Key: "metadata.name", Value: name},
+	)
+	defer t.Log()
+
+	stored, err := r.getSession(ctx, name)
+	if err != nil {
+		traceFailureWithError(t, "getSession", err)
+		return nil, err
+	}
+	return stored.session, nil
+}
+
+// List implements the list verb. It returns the sessions which have downstream access or refresh tokens. Sessions
+// are only stored in the Supervisor's namespace, so listing any other namespace returns an empty list.
+func (r *REST) List(ctx context.Context, options *metainternalversion.ListOptions) (runtime.Object, error) {
+	t := trace.FromContext(ctx).Nest("list", trace.Field{Key: "kind", Value: "Session"})
+	defer t.Log()
+
+	list := &sessionapi.SessionList{
+		Items: []sessionapi.Session{}, // avoid sending nil items list
+	}
+
+	if requestNamespace := genericapirequest.NamespaceValue(ctx); requestNamespace != "" && requestNamespace != r.namespace {
+		return list, nil
+	}
+
+	labelSelector, fieldSelector := labels.Everything(), fields.Everything()
+	if options != nil {
+		if options.LabelSelector != nil {
+			labelSelector = options.LabelSelector
+		}
+		if options.FieldSelector != nil {
+			fieldSelector = options.FieldSelector
+		}
+	}
+
+	storedSessions, err := r.listSessions(ctx, "")
+	if err != nil {
+		traceFailureWithError(t, "listSessions", err)
+		return nil, apierrors.NewInternalError(fmt.Errorf("listing sessions failed"))
+	}
+	t.Step("listSessions")
+
+	for _, stored := range storedSessions {
+		if labelSelector.Matches(labels.Set(stored.session.Labels)) && fieldSelector.Matches(sessionFields(stored.session)) {
+			list.Items = append(list.Items, *stored.session)
+		}
+	}
+	return list, nil
+}
+
+// Delete implements the delete verb. It ends the session by deleting all of its downstream storage, and then
+// revokes the upstream tokens which the Supervisor was holding for the session.
+func (r *REST) Delete(ctx context.Context, name string, deleteValidation rest.ValidateObjectFunc, options *metav1.DeleteOptions) (runtime.Object, bool, error) {
+	t := trace.FromContext(ctx).Nest("delete",
+		trace.Field{Key: "kind", Value: "Session"},
+		trace.Field{Key: "metadata.name", Value: name},
+	)
+	defer t.Log()
+
+	// just a sanity check, not sure how to honor a dry run on a virtual API
+	if options != nil && len(options.DryRun) != 0 {
+		traceValidationFailure(t, "dryRun not supported")
+		errs := field.ErrorList{field.NotSupported(field.NewPath("dryRun"), options.DryRun, nil)}
+		return nil, false, apierrors.NewInvalid(kindFromContext(ctx), name, errs)
+	}
+
+	stored, err := r.getSession(ctx, name)
+	if err != nil {
+		traceFailureWithError(t, "getSession", err)
+		return nil, false, err
+	}
+	t.Step("getSession")
+
+	if deleteValidation != nil {
+		if err := deleteValidation(ctx, stored.session.DeepCopyObject()); err != nil {
+			traceFailureWithError(t, "validation webhook", err)
+			return nil, false, err
+		}
+	}
+
+	if err := r.deleteSessionStorage(ctx, name); err != nil {
+		traceFailureWithError(t, "deleteSessionStorage", err)
+		return nil, false, apierrors.NewInternalError(fmt.Errorf("deleting session %q failed", name))
+	}
+	t.Step("deleteSessionStorage")
+
+	// Sessions which were created by older versions of the Supervisor do not remember their correlation ID,
+	// in which case their ID is the ID of the authorize request which created them.
+	correlationID := name
+	if stored.custom.CorrelationID != "" {
+		correlationID = stored.custom.CorrelationID
+	}
+	r.auditLogger.Audit(auditlog.Event{
+		Type:          auditlog.SessionDeleted,
+		CorrelationID: correlationID,
+		Request:       auditlog.RequestFromAPIContext(ctx),
+		User:          auditlog.UserFromAPIContext(ctx),
+		UpstreamIDP: &auditlog.UpstreamIDP{
+			Name: stored.session.Status.UpstreamIdentityProvider.Name,
+			Type: stored.session.Status.UpstreamIdentityProvider.Type,
+		},
+		ClientID: stored.session.Status.ClientID,
+		Object:   &auditlog.Object{Kind: "Session", Namespace: r.namespace, Name: name},
+	})
+
+	// The downstream session is already gone, so there is nothing left for the caller to retry. An upstream token
+	// which could not be revoked will expire on its own, so only log the failure.
+	if err := r.revokeUpstreamOIDCTokens(ctx, stored.custom); err != nil {
+		plog.WarningErr("could not revoke upstream tokens of deleted session", err, "sessionID", name)
+	}
+	t.Step("revokeUpstreamOIDCTokens")
+
+	return stored.session, true, nil
+}
+
+// deleteSessionStorage deletes every kind of storage which is labeled with the ID of the session, which includes the
+// storage of its authorization code, PKCE, and OIDC requests along with the storage of its tokens.
+func (r *REST) deleteSessionStorage(ctx context.Context, requestID string) error {
+	secrets, err := r.secretsClient.List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{fositestorage.StorageRequestIDLabelName: requestID}).String(),
+	})
+	if err != nil {
+		return err
+	}
+	for _, secret := range secrets.Items {
+		secret := secret
+		err := r.secretsClient.Delete(ctx, secret.Name, metav1.DeleteOptions{
+			Preconditions: &metav1.Preconditions{UID: &secret.UID},
+		})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *REST) getSession(ctx context.Context, name string) (*storedSession, error) {
+	// Sessions only exist in the Supervisor's namespace.
+	if requestNamespace, ok := genericapirequest.NamespaceFrom(ctx); !ok || requestNamespace != r.namespace {
+		return nil, apierrors.NewNotFound(r.resource, name)
+	}
+
+	storedSessions, err := r.listSessions(ctx, name)
+	if err != nil {
+		return nil, apierrors.NewInternalError(fmt.Errorf("getting session %q failed", name))
+	}
+	if len(storedSessions) == 0 {
+		return nil, apierrors.NewNotFound(r.resource, name)
+	}
+	return storedSessions[0], nil
+}
+
+// listSessions finds the sessions by reading the storage of their downstream access and refresh tokens, which are
+// labeled with the ID of the session. When requestID is not empty, then only that session is returned.
+func (r *REST) listSessions(ctx context.Context, requestID string) ([]*storedSession, error) {
+	typeRequirement, err := labels.NewRequirement(crud.SecretLabelKey, selection.In,
+		[]string{accesstoken.TypeLabelValue, refreshtoken.TypeLabelValue})
+	if err != nil {
+		return nil, err
+	}
+	idOperator, idValues := selection.Exists, []string(nil)
+	if requestID != "" {
+		idOperator, idValues = selection.Equals, []string{requestID}
+	}
+	idRequirement, err := labels.NewRequirement(fositestorage.StorageRequestIDLabelName, idOperator, idValues)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets, err := r.secretsClient.List(ctx, metav1.ListOptions{
+		LabelSelector: labels.NewSelector().Add(*typeRequirement, *idRequirement).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	secretsByRequestID := map[string][]corev1.Secret{}
+	for _, secret := range secrets.Items {
+		id := secret.Labels[fositestorage.StorageRequestIDLabelName]
+		secretsByRequestID[id] = append(secretsByRequestID[id], secret)
+	}
+
+	storedSessions := make([]*storedSession, 0, len(secretsByRequestID))
+	for id, sessionSecrets := range secretsByRequestID {
+		stored, err := r.sessionFromSecrets(sessionSecrets)
+		if err != nil {
+			// Skip unreadable storage, e.g. from an older version of the Supervisor, so one bad Secret does not
+			// prevent listing the other sessions. The garbage collector will eventually delete it.
+			plog.WarningErr("could not read session storage", err, "sessionID", id)
+			continue
+		}
+		storedSessions = append(storedSessions, stored)
+	}
+
+	sort.Slice(storedSessions, func(i, j int) bool {
+		return storedSessions[i].session.Name < storedSessions[j].session.Name
+	})
+	return storedSessions, nil
+}
+
+func (r *REST) sessionFromSecrets(secrets []corev1.Secret) (*storedSession, error) {
+	var refreshTokenSecret, accessTokenSecret *corev1.Secret
+	var expiration time.Time
+	for i := range secrets {
+		secret := &secrets[i]
+		switch secret.Labels[crud.SecretLabelKey] {
+		case refreshtoken.TypeLabelValue:
+			refreshTokenSecret = secret
+		case accesstoken.TypeLabelValue:
+			accessTokenSecret = secret
+		}
+		// The session ends when the garbage collector deletes the last of its storage.
+		if gcAfter, err := time.Parse(crud.SecretLifetimeAnnotationDateFormat, secret.Annotations[crud.SecretLifetimeAnnotationKey]); err == nil && gcAfter.After(expiration) {
+			expiration = gcAfter
+		}
+	}
+
+	// When there is a refresh token, then its storage holds the latest upstream tokens, because it is replaced
+	// during each downstream refresh. Otherwise, the access token storage is all that remains of the session.
+	var request *sessionRequest
+	var err error
+	switch {
+	case refreshTokenSecret != nil:
+		request, err = readRefreshTokenSecret(refreshTokenSecret)
+	case accessTokenSecret != nil:
+		request, err = readAccessTokenSecret(accessTokenSecret)
+	default:
+		err = fmt.Errorf("session has no token storage")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	session := &sessionapi.Session{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              request.id,
+			Namespace:         r.namespace,
+			CreationTimestamp: metav1.NewTime(request.requestedAt),
+		},
+		Status: sessionapi.SessionStatus{
+			Username:         request.custom.Username,
+			UpstreamUsername: request.custom.UpstreamUsername,
+			UpstreamIdentityProvider: sessionapi.SessionUpstreamIdentityProvider{
+				Name: request.custom.ProviderName,
+				Type: string(request.custom.ProviderType),
+				UID:  string(request.custom.ProviderUID),
+			},
+			ClientID:      request.clientID,
+			GrantedScopes: request.grantedScopes,
+		},
+	}
+	if !expiration.IsZero() {
+		expirationTimestamp := metav1.NewTime(expiration)
+		session.Status.ExpirationTimestamp = &expirationTimestamp
+	}
+
+	return &storedSession{session: session, custom: request.custom}, nil
+}
+
+// sessionRequest holds the parts of a stored fosite request which describe the session.
+type sessionRequest struct {
+	id            string
+	clientID      string
+	grantedScopes []string
+	requestedAt   time.Time
+	custom        *psession.CustomSessionData
+}
+
+func readRefreshTokenSecret(secret *corev1.Secret) (*sessionRequest, error) {
+	refreshTokenSession, err := refreshtoken.ReadFromSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+	return newSessionRequest(refreshTokenSession.Request.ID, refreshTokenSession.Request.Client.GetID(),
+		refreshTokenSession.Request.GetGrantedScopes(), refreshTokenSession.Request.RequestedAt,
+		refreshTokenSession.Request.Session)
+}
+
+func readAccessTokenSecret(secret *corev1.Secret) (*sessionRequest, error) {
+	accessTokenSession, err := accesstoken.ReadFromSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+	return newSessionRequest(accessTokenSession.Request.ID, accessTokenSession.Request.Client.GetID(),
+		accessTokenSession.Request.GetGrantedScopes(), accessTokenSession.Request.RequestedAt,
+		accessTokenSession.Request.Session)
+}
+
+func newSessionRequest(id, clientID string, grantedScopes []string, requestedAt time.Time, session interface{}) (*sessionRequest, error) {
+	pinnipedSession, ok := session.(*psession.PinnipedSession)
+	if !ok || pinnipedSession.Custom == nil {
+		return nil, fmt.Errorf("session storage is missing its upstream session data")
+	}
+	return &sessionRequest{
+		id:            id,
+		clientID:      clientID,
+		grantedScopes: grantedScopes,
+		requestedAt:   requestedAt,
+		custom:        pinnipedSession.Custom,
+	}, nil
+}
+
+func (r *REST) revokeUpstreamOIDCTokens(ctx context.Context, customSessionData *psession.CustomSessionData) error {
+	// Sessions of other upstream IDP types, e.g. LDAP, do not hold any upstream tokens.
+	if customSessionData.ProviderType != psession.ProviderTypeOIDC || customSessionData.OIDC == nil {
+		return nil
+	}
+
+	var foundOIDCIdentityProviderI provider.UpstreamOIDCIdentityProviderI
+	for _, p := range r.idpCache.GetOIDCIdentityProviders() {
+		if p.GetName() == customSessionData.ProviderName && p.GetResourceUID() == customSessionData.ProviderUID {
+			foundOIDCIdentityProviderI = p
+			break
+		}
+	}
+	if foundOIDCIdentityProviderI == nil {
+		return fmt.Errorf("could not find upstream OIDC provider named %q with resource UID %q", customSessionData.ProviderName, customSessionData.ProviderUID)
+	}
+
+	if upstreamRefreshToken := customSessionData.OIDC.UpstreamRefreshToken; upstreamRefreshToken != "" {
+		if err := foundOIDCIdentityProviderI.RevokeToken(ctx, upstreamRefreshToken, provider.RefreshTokenType); err != nil {
+			return err
+		}
+	}
+	if upstreamAccessToken := customSessionData.OIDC.UpstreamAccessToken; upstreamAccessToken != "" {
+		if err := foundOIDCIdentityProviderI.RevokeToken(ctx, upstreamAccessToken, provider.AccessTokenType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sessionFields returns the fields of a Session which can be used in a field selector. These must be kept in sync
+// with the field label conversion func which is registered in the scheme.
+func sessionFields(session *sessionapi.Session) fields.Set {
+	return fields.Set{
+		"metadata.name":                        session.Name,
+		"metadata.namespace":                   session.Namespace,
+		"status.username":                      session.Status.Username,
+		"status.clientID":                      session.Status.ClientID,
+		"status.upstreamIdentityProvider.name": session.Status.UpstreamIdentityProvider.Name,
+		"status.upstreamIdentityProvider.type": session.Status.UpstreamIdentityProvider.Type,
+	}
+}
+
+func (r *REST) ConvertToTable(_ context.Context, obj runtime.Object, tableOptions runtime.Object) (*metav1.Table, error) {
+	var sessions []sessionapi.Session
+	table := &metav1.Table{}
+	switch t := obj.(type) {
+	case *sessionapi.Session:
+		sessions = []sessionapi.Session{*t}
+	case *sessionapi.SessionList:
+		sessions = t.Items
+		table.ResourceVersion = t.ResourceVersion
+		table.Continue = t.Continue
+	default:
+		return nil, fmt.Errorf("not a Session or SessionList: %T", obj)
+	}
+
+	if opt, ok := tableOptions.(*metav1.TableOptions); !ok || !opt.NoHeaders {
+		table.ColumnDefinitions = []metav1.TableColumnDefinition{
+			{Name: "Name", Type: "string", Format: "name", Description: "The ID of the session"},
+			{Name: "Username", Type: "string", Description: "The downstream username of the user"},
+			{Name: "Identity Provider", Type: "string", Description: "The upstream identity provider of the user"},
+			{Name: "Client", Type: "string", Description: "The OIDC client which started the session"},
+			{Name: "Scopes", Type: "string", Priority: 1, Description: "The scopes which were granted to the client"},
+			{Name: "Age", Type: "date", Description: "The time since the user logged in"},
+		}
+	}
+
+	for i := range sessions {
+		s := &sessions[i]
+		table.Rows = append(table.Rows, metav1.TableRow{
+			Cells: []interface{}{
+				s.Name,
+				s.Status.Username,
+				s.Status.UpstreamIdentityProvider.Name,
+				s.Status.ClientID,
+				strings.Join(s.Status.GrantedScopes, ","),
+				translateTimestampSince(s.CreationTimestamp),
+			},
+			Object: runtime.RawExtension{Object: s},
+		})
+	}
+	return table, nil
+}
+
+func translateTimestampSince(timestamp metav1.Time) string {
+	if timestamp.IsZero() {
+		return "<unknown>"
+	}
+	return duration.HumanDuration(time.Since(timestamp.Time))
+}
+
+func traceFailure(t *trace.Trace, failureType string, msg string) {
+	t.Step("failure",
+		trace.Field{Key: "failureType", Value: failureType},
+		trace.Field{Key: "msg", Value: msg},
+	)
+}
+
+func traceValidationFailure(t *trace.Trace, msg string) {
+	traceFailure(t, "request validation", msg)
+}
+
+func traceFailureWithError(t *trace.Trace, failureType string, err error) {
+	traceFailure(t, failureType, err.Error())
+}
+
+func kindFromContext(ctx context.Context) schema.GroupKind {
+	if info, ok := genericapirequest.RequestInfoFrom(ctx); ok {
+		return schema.GroupKind{Group: info.APIGroup, Kind: "Session"}
+	}
+	// this should never happen in practice
+	return sessionapi.Kind("Session")
+}
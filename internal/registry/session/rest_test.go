@@ -0,0 +1,373 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package session
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/handler/openid"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/authentication/user"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	sessionapi "go.pinniped.dev/generated/latest/apis/supervisor/session"
+	"go.pinniped.dev/internal/auditlog"
+	"go.pinniped.dev/internal/fositestorage/accesstoken"
+	"go.pinniped.dev/internal/fositestorage/authorizationcode"
+	"go.pinniped.dev/internal/fositestorage/refreshtoken"
+	"go.pinniped.dev/internal/oidc/clientregistry"
+	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/psession"
+	"go.pinniped.dev/internal/testutil/oidctestutil"
+)
+
+const namespace = "some-namespace"
+
+var (
+	requestedAt = time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	lifetime    = 9 * time.Hour
+)
+
+type fakeIDPCache []provider.UpstreamOIDCIdentityProviderI
+
+func (c fakeIDPCache) GetOIDCIdentityProviders() []provider.UpstreamOIDCIdentityProviderI {
+	return c
+}
+
+func TestNew(t *testing.T) {
+	r := NewREST(schema.GroupResource{Group: "bears", Resource: "panda"}, nil, nil, namespace, auditlog.NewNoopLogger())
+
+	require.NotNil(t, r)
+	require.True(t, r.NamespaceScoped())
+	require.Equal(t, []string{"pinniped"}, r.Categories())
+	require.IsType(t, &sessionapi.Session{}, r.New())
+	require.IsType(t, &sessionapi.SessionList{}, r.NewList())
+}
+
+func TestList(t *testing.T) {
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		options   *metainternalversion.ListOptions
+		wantNames []string
+	}{
+		{
+			name:      "all sessions",
+			ctx:       namespacedContext(namespace),
+			wantNames: []string{"ldap-session", "oidc-session"},
+		},
+		{
+			name:      "all namespaces",
+			ctx:       namespacedContext(""),
+			wantNames: []string{"ldap-session", "oidc-session"},
+		},
+		{
+			name:      "some other namespace",
+			ctx:       namespacedContext("other-namespace"),
+			wantNames: []string{},
+		},
+		{
+			name: "field selector on the username",
+			ctx:  namespacedContext(namespace),
+			options: &metainternalversion.ListOptions{
+				FieldSelector: fields.OneTermEqualSelector("status.username", "ldap-user"),
+			},
+			wantNames: []string{"ldap-session"},
+		},
+		{
+			name: "field selector on the upstream identity provider type",
+			ctx:  namespacedContext(namespace),
+			options: &metainternalversion.ListOptions{
+				FieldSelector: fields.OneTermEqualSelector("status.upstreamIdentityProvider.type", "oidc"),
+			},
+			wantNames: []string{"oidc-session"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			secretsClient := seedSessions(t)
+			r := NewREST(sessionapi.Resource("sessions"), secretsClient, fakeIDPCache{}, namespace, auditlog.NewNoopLogger())
+
+			got, err := r.List(tt.ctx, tt.options)
+			require.NoError(t, err)
+			require.IsType(t, &sessionapi.SessionList{}, got)
+
+			names := []string{}
+			for _, item := range got.(*sessionapi.SessionList).Items {
+				names = append(names, item.Name)
+			}
+			require.Equal(t, tt.wantNames, names)
+		})
+	}
+}
+
+func TestGet(t *testing.T) {
+	secretsClient := seedSessions(t)
+	r := NewREST(sessionapi.Resource("sessions"), secretsClient, fakeIDPCache{}, namespace, auditlog.NewNoopLogger())
+
+	got, err := r.Get(namespacedContext(namespace), "oidc-session", &metav1.GetOptions{})
+	require.NoError(t, err)
+	wantExpiration := metav1.NewTime(requestedAt.Add(lifetime))
+	require.Equal(t, &sessionapi.Session{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "oidc-session",
+			Namespace:         namespace,
+			CreationTimestamp: metav1.NewTime(requestedAt),
+		},
+		Status: sessionapi.SessionStatus{
+			Username:         "oidc-user",
+			UpstreamUsername: "upstream-oidc-user",
+			UpstreamIdentityProvider: sessionapi.SessionUpstreamIdentityProvider{
+				Name: "some-oidc-idp",
+				Type: "oidc",
+				UID:  "some-oidc-idp-uid",
+			},
+			ClientID:            "pinniped-cli",
+			GrantedScopes:       []string{"openid", "offline_access"},
+			ExpirationTimestamp: &wantExpiration,
+		},
+	}, got)
+
+	_, err = r.Get(namespacedContext(namespace), "does-not-exist", &metav1.GetOptions{})
+	require.True(t, apierrors.IsNotFound(err), "expected not found error but got: %v", err)
+
+	_, err = r.Get(namespacedContext("other-namespace"), "oidc-session", &metav1.GetOptions{})
+	require.True(t, apierrors.IsNotFound(err), "expected not found error but got: %v", err)
+
+	_, err = r.Get(namespacedContext(namespace), "unreadable-session", &metav1.GetOptions{})
+	require.True(t, apierrors.IsNotFound(err), "expected not found error but got: %v", err)
+}
+
+func TestDelete(t *testing.T) {
+	tests := []struct {
+		name            string
+		sessionName     string
+		ctx             context.Context
+		options         *metav1.DeleteOptions
+		revokeTokenErr  error
+		wantErr         string
+		wantRevocations []string
+		wantSecrets     int
+	}{
+		{
+			name:            "oidc session",
+			sessionName:     "oidc-session",
+			ctx:             namespacedContext(namespace),
+			wantRevocations: []string{"upstream-refresh-token"},
+			wantSecrets:     2,
+		},
+		{
+			name:            "oidc session when upstream revocation fails",
+			sessionName:     "oidc-session",
+			ctx:             namespacedContext(namespace),
+			revokeTokenErr:  errors.New("some revocation error"),
+			wantRevocations: []string{"upstream-refresh-token"},
+			wantSecrets:     2,
+		},
+		{
+			name:        "ldap session",
+			sessionName: "ldap-session",
+			ctx:         namespacedContext(namespace),
+			wantSecrets: 4,
+		},
+		{
+			name:        "dry run",
+			sessionName: "oidc-session",
+			ctx:         namespacedContext(namespace),
+			options:     &metav1.DeleteOptions{DryRun: []string{metav1.DryRunAll}},
+			wantErr:     `Session.session.supervisor.pinniped.dev "oidc-session" is invalid: dryRun: Unsupported value: []string{"All"}`,
+			wantSecrets: 5,
+		},
+		{
+			name:        "does not exist",
+			sessionName: "does-not-exist",
+			ctx:         namespacedContext(namespace),
+			wantErr:     `sessions.session.supervisor.pinniped.dev "does-not-exist" not found`,
+			wantSecrets: 5,
+		},
+		{
+			name:        "some other namespace",
+			sessionName: "oidc-session",
+			ctx:         namespacedContext("other-namespace"),
+			wantErr:     `sessions.session.supervisor.pinniped.dev "oidc-session" not found`,
+			wantSecrets: 5,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			secretsClient := seedSessions(t)
+			upstream := oidctestutil.NewTestUpstreamOIDCIdentityProviderBuilder().
+				WithName("some-oidc-idp").
+				WithResourceUID("some-oidc-idp-uid").
+				WithRevokeTokenError(tt.revokeTokenErr).
+				Build()
+			auditLogger := auditlog.NewTestLogger(t)
+			r := NewREST(sessionapi.Resource("sessions"), secretsClient, fakeIDPCache{upstream}, namespace, auditLogger)
+
+			got, deleted, err := r.Delete(tt.ctx, tt.sessionName, nil, tt.options)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				require.False(t, deleted)
+				require.Nil(t, got)
+				require.Empty(t, auditLogger.Events())
+			} else {
+				require.NoError(t, err)
+				require.True(t, deleted)
+				require.Equal(t, tt.sessionName, got.(*sessionapi.Session).Name)
+
+				s := got.(*sessionapi.Session)
+				require.Equal(t, []auditlog.Event{{
+					Type:          auditlog.SessionDeleted,
+					CorrelationID: tt.sessionName,
+					Request:       auditlog.Request{RequestURI: "/some/path", Verb: "delete"},
+					User:          &auditlog.User{Username: "some-admin", Groups: []string{"some-group"}},
+					UpstreamIDP: &auditlog.UpstreamIDP{
+						Name: s.Status.UpstreamIdentityProvider.Name,
+						Type: s.Status.UpstreamIdentityProvider.Type,
+					},
+					ClientID: "pinniped-cli",
+					Object:   &auditlog.Object{Kind: "Session", Namespace: namespace, Name: tt.sessionName},
+				}}, auditLogger.Events())
+			}
+
+			require.Equal(t, len(tt.wantRevocations), upstream.RevokeTokenCallCount())
+			for i, wantToken := range tt.wantRevocations {
+				require.Equal(t, wantToken, upstream.RevokeTokenArgs(i).Token)
+			}
+
+			secrets, err := secretsClient.List(context.Background(), metav1.ListOptions{})
+			require.NoError(t, err)
+			require.Len(t, secrets.Items, tt.wantSecrets)
+		})
+	}
+}
+
+func TestConvertToTable(t *testing.T) {
+	r := NewREST(sessionapi.Resource("sessions"), nil, nil, namespace, auditlog.NewNoopLogger())
+
+	list := &sessionapi.SessionList{
+		ListMeta: metav1.ListMeta{ResourceVersion: "42"},
+		Items: []sessionapi.Session{{
+			ObjectMeta: metav1.ObjectMeta{Name: "some-session"},
+			Status: sessionapi.SessionStatus{
+				Username:                 "some-user",
+				UpstreamIdentityProvider: sessionapi.SessionUpstreamIdentityProvider{Name: "some-idp"},
+				ClientID:                 "some-client",
+				GrantedScopes:            []string{"openid", "username"},
+			},
+		}},
+	}
+	table, err := r.ConvertToTable(context.Background(), list, nil)
+	require.NoError(t, err)
+	require.Equal(t, "42", table.ResourceVersion)
+	require.Len(t, table.ColumnDefinitions, 6)
+	require.Len(t, table.Rows, 1)
+	require.Equal(t, []interface{}{"some-session", "some-user", "some-idp", "some-client", "openid,username", "<unknown>"}, table.Rows[0].Cells)
+
+	table, err = r.ConvertToTable(context.Background(), &list.Items[0], &metav1.TableOptions{NoHeaders: true})
+	require.NoError(t, err)
+	require.Empty(t, table.ColumnDefinitions)
+	require.Len(t, table.Rows, 1)
+
+	_, err = r.ConvertToTable(context.Background(), &metav1.APIGroup{}, nil)
+	require.EqualError(t, err, "not a Session or SessionList: *v1.APIGroup")
+}
+
+func namespacedContext(ns string) context.Context {
+	ctx := genericapirequest.WithRequestInfo(genericapirequest.NewContext(), &genericapirequest.RequestInfo{
+		APIGroup:   "session.supervisor.pinniped.dev",
+		APIVersion: "v1alpha1",
+		Resource:   "sessions",
+		Verb:       "delete",
+		Path:       "/some/path",
+	})
+	ctx = genericapirequest.WithUser(ctx, &user.DefaultInfo{Name: "some-admin", Groups: []string{"some-group"}})
+	if ns != "" {
+		ctx = genericapirequest.WithNamespace(ctx, ns)
+	}
+	return ctx
+}
+
+// seedSessions stores an OIDC session with an authorization code, a refresh token, and an access token, an LDAP
+// session with only an access token, and a session whose storage cannot be read.
+func seedSessions(t *testing.T) corev1client.SecretInterface {
+	t.Helper()
+
+	ctx := context.Background()
+	secretsClient := kubefake.NewSimpleClientset().CoreV1().Secrets(namespace)
+	clock := func() time.Time { return requestedAt }
+	refreshTokenStorage := refreshtoken.New(secretsClient, clock, lifetime, "https://some-issuer.com")
+	accessTokenStorage := accesstoken.New(secretsClient, clock, lifetime, "https://some-issuer.com")
+
+	oidcRequest := newRequest("oidc-session", &psession.CustomSessionData{
+		Username:         "oidc-user",
+		UpstreamUsername: "upstream-oidc-user",
+		ProviderUID:      "some-oidc-idp-uid",
+		ProviderName:     "some-oidc-idp",
+		ProviderType:     psession.ProviderTypeOIDC,
+		OIDC: &psession.OIDCSessionData{
+			UpstreamRefreshToken: "upstream-refresh-token",
+			UpstreamSubject:      "some-subject",
+			UpstreamIssuer:       "https://some-issuer.example.com",
+		},
+	})
+	require.NoError(t, refreshTokenStorage.CreateRefreshTokenSession(ctx, "oidc-refresh-token-signature", oidcRequest))
+	require.NoError(t, accessTokenStorage.CreateAccessTokenSession(ctx, "oidc-access-token-signature", oidcRequest))
+	require.NoError(t, authorizationcode.New(secretsClient, clock, lifetime).CreateAuthorizeCodeSession(ctx, "oidc-authcode-signature", oidcRequest))
+
+	ldapRequest := newRequest("ldap-session", &psession.CustomSessionData{
+		Username:     "ldap-user",
+		ProviderUID:  "some-ldap-idp-uid",
+		ProviderName: "some-ldap-idp",
+		ProviderType: psession.ProviderTypeLDAP,
+		LDAP:         &psession.LDAPSessionData{UserDN: "cn=ldap-user"},
+	})
+	require.NoError(t, accessTokenStorage.CreateAccessTokenSession(ctx, "ldap-access-token-signature", ldapRequest))
+
+	_, err := secretsClient.Create(ctx, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "unreadable-session-storage",
+			Labels: map[string]string{
+				"storage.pinniped.dev/type":       "refresh-token",
+				"storage.pinniped.dev/request-id": "unreadable-session",
+			},
+		},
+		Type: "storage.pinniped.dev/refresh-token",
+		Data: map[string][]byte{"pinniped-storage-data": []byte("not json"), "pinniped-storage-version": []byte("1")},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	return secretsClient
+}
+
+func newRequest(id string, custom *psession.CustomSessionData) *fosite.Request {
+	return &fosite.Request{
+		ID:          id,
+		RequestedAt: requestedAt,
+		Client: &clientregistry.Client{
+			DefaultOpenIDConnectClient: fosite.DefaultOpenIDConnectClient{
+				DefaultClient: &fosite.DefaultClient{ID: "pinniped-cli", Public: true},
+			},
+		},
+		GrantedScope: fosite.Arguments{"openid", "offline_access"},
+		Session: &psession.PinnipedSession{
+			Fosite: &openid.DefaultSession{},
+			Custom: custom,
+		},
+	}
+}
@@ -1,4 +1,4 @@
-// Copyright 2020 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package secret
@@ -8,18 +8,25 @@ import (
 	"sync/atomic"
 )
 
+// Cache holds the symmetric keys which the Supervisor generated. After a key is rotated, the key which it replaced
+// is also held until its grace period ends, so that values which the previous key signed or encrypted can still be
+// decoded.
 type Cache struct {
-	csrfCookieEncoderHashKey atomic.Value
-	federationDomainCacheMap sync.Map
+	csrfCookieEncoderHashKey         atomic.Value
+	previousCSRFCookieEncoderHashKey atomic.Value
+	federationDomainCacheMap         sync.Map
 }
 
 // New returns an empty Cache.
 func New() *Cache { return &Cache{} }
 
 type federationDomainCache struct {
-	tokenHMACKey         atomic.Value
-	stateEncoderHashKey  atomic.Value
-	stateEncoderBlockKey atomic.Value
+	tokenHMACKey                 atomic.Value
+	previousTokenHMACKey         atomic.Value
+	stateEncoderHashKey          atomic.Value
+	previousStateEncoderHashKey  atomic.Value
+	stateEncoderBlockKey         atomic.Value
+	previousStateEncoderBlockKey atomic.Value
 }
 
 func (c *Cache) GetCSRFCookieEncoderHashKey() []byte {
@@ -30,6 +37,14 @@ func (c *Cache) SetCSRFCookieEncoderHashKey(key []byte) {
 	c.csrfCookieEncoderHashKey.Store(key)
 }
 
+func (c *Cache) GetPreviousCSRFCookieEncoderHashKey() []byte {
+	return bytesOrNil(c.previousCSRFCookieEncoderHashKey.Load())
+}
+
+func (c *Cache) SetPreviousCSRFCookieEncoderHashKey(key []byte) {
+	c.previousCSRFCookieEncoderHashKey.Store(key)
+}
+
 func (c *Cache) GetTokenHMACKey(oidcIssuer string) []byte {
 	return bytesOrNil(c.getFederationDomainCache(oidcIssuer).tokenHMACKey.Load())
 }
@@ -38,6 +53,14 @@ func (c *Cache) SetTokenHMACKey(oidcIssuer string, key []byte) {
 	c.getFederationDomainCache(oidcIssuer).tokenHMACKey.Store(key)
 }
 
+func (c *Cache) GetPreviousTokenHMACKey(oidcIssuer string) []byte {
+	return bytesOrNil(c.getFederationDomainCache(oidcIssuer).previousTokenHMACKey.Load())
+}
+
+func (c *Cache) SetPreviousTokenHMACKey(oidcIssuer string, key []byte) {
+	c.getFederationDomainCache(oidcIssuer).previousTokenHMACKey.Store(key)
+}
+
 func (c *Cache) GetStateEncoderHashKey(oidcIssuer string) []byte {
 	return bytesOrNil(c.getFederationDomainCache(oidcIssuer).stateEncoderHashKey.Load())
 }
@@ -46,6 +69,14 @@ func (c *Cache) SetStateEncoderHashKey(oidcIssuer string, key []byte) {
 	c.getFederationDomainCache(oidcIssuer).stateEncoderHashKey.Store(key)
 }
 
+func (c *Cache) GetPreviousStateEncoderHashKey(oidcIssuer string) []byte {
+	return bytesOrNil(c.getFederationDomainCache(oidcIssuer).previousStateEncoderHashKey.Load())
+}
+
+func (c *Cache) SetPreviousStateEncoderHashKey(oidcIssuer string, key []byte) {
+	c.getFederationDomainCache(oidcIssuer).previousStateEncoderHashKey.Store(key)
+}
+
 func (c *Cache) GetStateEncoderBlockKey(oidcIssuer string) []byte {
 	return bytesOrNil(c.getFederationDomainCache(oidcIssuer).stateEncoderBlockKey.Load())
 }
@@ -54,6 +85,14 @@ func (c *Cache) SetStateEncoderBlockKey(oidcIssuer string, key []byte) {
 	c.getFederationDomainCache(oidcIssuer).stateEncoderBlockKey.Store(key)
 }
 
+func (c *Cache) GetPreviousStateEncoderBlockKey(oidcIssuer string) []byte {
+	return bytesOrNil(c.getFederationDomainCache(oidcIssuer).previousStateEncoderBlockKey.Load())
+}
+
+func (c *Cache) SetPreviousStateEncoderBlockKey(oidcIssuer string, key []byte) {
+	c.getFederationDomainCache(oidcIssuer).previousStateEncoderBlockKey.Store(key)
+}
+
 func (c *Cache) getFederationDomainCache(oidcIssuer string) *federationDomainCache {
 	value, ok := c.federationDomainCacheMap.Load(oidcIssuer)
 	if !ok {
@@ -1,4 +1,4 @@
-// Copyright 2020-2021 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package secret
@@ -23,6 +23,11 @@ var (
 	stateEncoderHashKey      = []byte("state-encoder-hash-key")
 	otherStateEncoderHashKey = []byte("other-state-encoder-hash-key")
 	stateEncoderBlockKey     = []byte("state-encoder-block-key")
+
+	previousCSRFCookieEncoderHashKey = []byte("previous-csrf-cookie-encoder-hash-key")
+	previousTokenHMACKey             = []byte("previous-token-hmac-key")
+	previousStateEncoderHashKey      = []byte("previous-state-encoder-hash-key")
+	previousStateEncoderBlockKey     = []byte("previous-state-encoder-block-key")
 )
 
 func TestCache(t *testing.T) {
@@ -58,6 +63,44 @@ func TestCache(t *testing.T) {
 	require.Nil(t, c.GetStateEncoderBlockKey(otherIssuer))
 }
 
+func TestCachePreviousKeys(t *testing.T) {
+	c := New()
+
+	// Validate we get a nil return value when there are no previous keys.
+	c.SetCSRFCookieEncoderHashKey(csrfCookieEncoderHashKey)
+	c.SetTokenHMACKey(issuer, tokenHMACKey)
+	c.SetStateEncoderHashKey(issuer, stateEncoderHashKey)
+	c.SetStateEncoderBlockKey(issuer, stateEncoderBlockKey)
+	require.Nil(t, c.GetPreviousCSRFCookieEncoderHashKey())
+	require.Nil(t, c.GetPreviousTokenHMACKey(issuer))
+	require.Nil(t, c.GetPreviousStateEncoderHashKey(issuer))
+	require.Nil(t, c.GetPreviousStateEncoderBlockKey(issuer))
+
+	// Validate that the previous keys are held separately from the current keys.
+	c.SetPreviousCSRFCookieEncoderHashKey(previousCSRFCookieEncoderHashKey)
+	c.SetPreviousTokenHMACKey(issuer, previousTokenHMACKey)
+	c.SetPreviousStateEncoderHashKey(issuer, previousStateEncoderHashKey)
+	c.SetPreviousStateEncoderBlockKey(issuer, previousStateEncoderBlockKey)
+	require.Equal(t, csrfCookieEncoderHashKey, c.GetCSRFCookieEncoderHashKey())
+	require.Equal(t, previousCSRFCookieEncoderHashKey, c.GetPreviousCSRFCookieEncoderHashKey())
+	require.Equal(t, tokenHMACKey, c.GetTokenHMACKey(issuer))
+	require.Equal(t, previousTokenHMACKey, c.GetPreviousTokenHMACKey(issuer))
+	require.Equal(t, stateEncoderHashKey, c.GetStateEncoderHashKey(issuer))
+	require.Equal(t, previousStateEncoderHashKey, c.GetPreviousStateEncoderHashKey(issuer))
+	require.Equal(t, stateEncoderBlockKey, c.GetStateEncoderBlockKey(issuer))
+	require.Equal(t, previousStateEncoderBlockKey, c.GetPreviousStateEncoderBlockKey(issuer))
+
+	// Validate that stuff is still nil for an unknown issuer.
+	require.Nil(t, c.GetPreviousTokenHMACKey(otherIssuer))
+	require.Nil(t, c.GetPreviousStateEncoderHashKey(otherIssuer))
+	require.Nil(t, c.GetPreviousStateEncoderBlockKey(otherIssuer))
+
+	// Validate that a previous key is forgotten when its grace period ends.
+	c.SetPreviousTokenHMACKey(issuer, nil)
+	require.Nil(t, c.GetPreviousTokenHMACKey(issuer))
+	require.Equal(t, tokenHMACKey, c.GetTokenHMACKey(issuer))
+}
+
 // TestCacheSynchronized should mimic the behavior of an FederationDomain: multiple goroutines
 // read the same fields, sequentially, from the cache.
 func TestCacheSynchronized(t *testing.T) {
@@ -1,4 +1,4 @@
-// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2022-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package apiserver
@@ -20,9 +20,11 @@ import (
 	"k8s.io/client-go/pkg/version"
 
 	configv1alpha1clientset "go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned/typed/config/v1alpha1"
+	"go.pinniped.dev/internal/auditlog"
 	"go.pinniped.dev/internal/controllerinit"
 	"go.pinniped.dev/internal/plog"
 	"go.pinniped.dev/internal/registry/clientsecretrequest"
+	"go.pinniped.dev/internal/registry/session"
 )
 
 type Config struct {
@@ -35,9 +37,12 @@ type ExtraConfig struct {
 	Scheme                             *runtime.Scheme
 	NegotiatedSerializer               runtime.NegotiatedSerializer
 	ClientSecretSupervisorGroupVersion schema.GroupVersion
+	SessionSupervisorGroupVersion      schema.GroupVersion
 	Secrets                            corev1client.SecretInterface
 	OIDCClients                        configv1alpha1clientset.OIDCClientInterface
+	UpstreamOIDCIdentityProviders      session.UpstreamOIDCIdentityProviderICache
 	Namespace                          string
+	AuditLogger                        auditlog.Logger
 }
 
 type PinnipedServer struct {
@@ -91,9 +96,21 @@ func (c completedConfig) New() (*PinnipedServer, error) {
 				rand.Reader,
 				bcrypt.GenerateFromPassword,
 				metav1.Now,
+				c.ExtraConfig.AuditLogger,
 			)
 			return clientSecretReqGVR, clientSecretReqStorage
 		},
+		func() (schema.GroupVersionResource, rest.Storage) {
+			sessionGVR := c.ExtraConfig.SessionSupervisorGroupVersion.WithResource("sessions")
+			sessionStorage := session.NewREST(
+				sessionGVR.GroupResource(),
+				c.ExtraConfig.Secrets,
+				c.ExtraConfig.UpstreamOIDCIdentityProviders,
+				c.ExtraConfig.Namespace,
+				c.ExtraConfig.AuditLogger,
+			)
+			return sessionGVR, sessionStorage
+		},
 	} {
 		gvr, storage := f()
 		errs = append(errs,
@@ -1,4 +1,4 @@
-// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2022-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package scheme
@@ -14,6 +14,8 @@ import (
 
 	clientsecretapi "go.pinniped.dev/generated/latest/apis/supervisor/clientsecret"
 	clientsecretv1alpha1 "go.pinniped.dev/generated/latest/apis/supervisor/clientsecret/v1alpha1"
+	sessionapi "go.pinniped.dev/generated/latest/apis/supervisor/session"
+	sessionv1alpha1 "go.pinniped.dev/generated/latest/apis/supervisor/session/v1alpha1"
 )
 
 func TestNew(t *testing.T) {
@@ -26,6 +28,14 @@ func TestNew(t *testing.T) {
 		Group:   "clientsecret.supervisor.pinniped.dev",
 		Version: runtime.APIVersionInternal,
 	}
+	regularSessionGV := schema.GroupVersion{
+		Group:   "session.supervisor.pinniped.dev",
+		Version: "v1alpha1",
+	}
+	regularSessionGVInternal := schema.GroupVersion{
+		Group:   "session.supervisor.pinniped.dev",
+		Version: runtime.APIVersionInternal,
+	}
 
 	// the canonical other group
 	otherClientSecretGV := schema.GroupVersion{
@@ -36,6 +46,14 @@ func TestNew(t *testing.T) {
 		Group:   "clientsecret.supervisor.walrus.tld",
 		Version: runtime.APIVersionInternal,
 	}
+	otherSessionGV := schema.GroupVersion{
+		Group:   "session.supervisor.walrus.tld",
+		Version: "v1alpha1",
+	}
+	otherSessionGVInternal := schema.GroupVersion{
+		Group:   "session.supervisor.walrus.tld",
+		Version: runtime.APIVersionInternal,
+	}
 
 	// kube's core internal
 	internalGV := schema.GroupVersion{
@@ -48,6 +66,7 @@ func TestNew(t *testing.T) {
 		apiGroupSuffix               string
 		want                         map[schema.GroupVersionKind]reflect.Type
 		wantClientSecretGroupVersion schema.GroupVersion
+		wantSessionGroupVersion      schema.GroupVersion
 	}{
 		{
 			name:           "regular api group",
@@ -71,6 +90,22 @@ func TestNew(t *testing.T) {
 
 				regularClientSecretGVInternal.WithKind("WatchEvent"): reflect.TypeOf(&metav1.InternalEvent{}).Elem(),
 
+				regularSessionGV.WithKind("Session"):     reflect.TypeOf(&sessionv1alpha1.Session{}).Elem(),
+				regularSessionGV.WithKind("SessionList"): reflect.TypeOf(&sessionv1alpha1.SessionList{}).Elem(),
+
+				regularSessionGVInternal.WithKind("Session"):     reflect.TypeOf(&sessionapi.Session{}).Elem(),
+				regularSessionGVInternal.WithKind("SessionList"): reflect.TypeOf(&sessionapi.SessionList{}).Elem(),
+
+				regularSessionGV.WithKind("CreateOptions"): reflect.TypeOf(&metav1.CreateOptions{}).Elem(),
+				regularSessionGV.WithKind("DeleteOptions"): reflect.TypeOf(&metav1.DeleteOptions{}).Elem(),
+				regularSessionGV.WithKind("GetOptions"):    reflect.TypeOf(&metav1.GetOptions{}).Elem(),
+				regularSessionGV.WithKind("ListOptions"):   reflect.TypeOf(&metav1.ListOptions{}).Elem(),
+				regularSessionGV.WithKind("PatchOptions"):  reflect.TypeOf(&metav1.PatchOptions{}).Elem(),
+				regularSessionGV.WithKind("UpdateOptions"): reflect.TypeOf(&metav1.UpdateOptions{}).Elem(),
+				regularSessionGV.WithKind("WatchEvent"):    reflect.TypeOf(&metav1.WatchEvent{}).Elem(),
+
+				regularSessionGVInternal.WithKind("WatchEvent"): reflect.TypeOf(&metav1.InternalEvent{}).Elem(),
+
 				// the types below this line do not really matter to us because they are in the core group
 
 				internalGV.WithKind("WatchEvent"): reflect.TypeOf(&metav1.InternalEvent{}).Elem(),
@@ -89,6 +124,7 @@ func TestNew(t *testing.T) {
 				metav1.Unversioned.WithKind("WatchEvent"):      reflect.TypeOf(&metav1.WatchEvent{}).Elem(),
 			},
 			wantClientSecretGroupVersion: regularClientSecretGV,
+			wantSessionGroupVersion:      regularSessionGV,
 		},
 		{
 			name:           "other api group",
@@ -112,6 +148,22 @@ func TestNew(t *testing.T) {
 
 				otherClientSecretGVInternal.WithKind("WatchEvent"): reflect.TypeOf(&metav1.InternalEvent{}).Elem(),
 
+				otherSessionGV.WithKind("Session"):     reflect.TypeOf(&sessionv1alpha1.Session{}).Elem(),
+				otherSessionGV.WithKind("SessionList"): reflect.TypeOf(&sessionv1alpha1.SessionList{}).Elem(),
+
+				otherSessionGVInternal.WithKind("Session"):     reflect.TypeOf(&sessionapi.Session{}).Elem(),
+				otherSessionGVInternal.WithKind("SessionList"): reflect.TypeOf(&sessionapi.SessionList{}).Elem(),
+
+				otherSessionGV.WithKind("CreateOptions"): reflect.TypeOf(&metav1.CreateOptions{}).Elem(),
+				otherSessionGV.WithKind("DeleteOptions"): reflect.TypeOf(&metav1.DeleteOptions{}).Elem(),
+				otherSessionGV.WithKind("GetOptions"):    reflect.TypeOf(&metav1.GetOptions{}).Elem(),
+				otherSessionGV.WithKind("ListOptions"):   reflect.TypeOf(&metav1.ListOptions{}).Elem(),
+				otherSessionGV.WithKind("PatchOptions"):  reflect.TypeOf(&metav1.PatchOptions{}).Elem(),
+				otherSessionGV.WithKind("UpdateOptions"): reflect.TypeOf(&metav1.UpdateOptions{}).Elem(),
+				otherSessionGV.WithKind("WatchEvent"):    reflect.TypeOf(&metav1.WatchEvent{}).Elem(),
+
+				otherSessionGVInternal.WithKind("WatchEvent"): reflect.TypeOf(&metav1.InternalEvent{}).Elem(),
+
 				// the types below this line do not really matter to us because they are in the core group
 
 				internalGV.WithKind("WatchEvent"): reflect.TypeOf(&metav1.InternalEvent{}).Elem(),
@@ -130,14 +182,23 @@ func TestNew(t *testing.T) {
 				metav1.Unversioned.WithKind("WatchEvent"):      reflect.TypeOf(&metav1.WatchEvent{}).Elem(),
 			},
 			wantClientSecretGroupVersion: otherClientSecretGV,
+			wantSessionGroupVersion:      otherSessionGV,
 		},
 	}
 	for _, tt := range tests {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			scheme, clientSecretGV := New(tt.apiGroupSuffix)
+			scheme, clientSecretGV, sessionGV := New(tt.apiGroupSuffix)
 			require.Equal(t, tt.want, scheme.AllKnownTypes())
 			require.Equal(t, tt.wantClientSecretGroupVersion, clientSecretGV)
+			require.Equal(t, tt.wantSessionGroupVersion, sessionGV)
+
+			label, value, err := scheme.ConvertFieldLabel(sessionGV.WithKind("Session"), "status.username", "some-user")
+			require.NoError(t, err)
+			require.Equal(t, "status.username", label)
+			require.Equal(t, "some-user", value)
+			_, _, err = scheme.ConvertFieldLabel(sessionGV.WithKind("Session"), "status.grantedScopes", "openid")
+			require.EqualError(t, err, "field label not supported: status.grantedScopes")
 		})
 	}
 }
@@ -1,4 +1,4 @@
-// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 // Package server defines the entrypoint for the Pinniped Supervisor server.
@@ -35,6 +35,7 @@ import (
 	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/pkg/version"
 	"k8s.io/client-go/rest"
+	"k8s.io/component-base/metrics/legacyregistry"
 	aggregatorclient "k8s.io/kube-aggregator/pkg/client/clientset_generated/clientset"
 	"k8s.io/utils/clock"
 
@@ -44,14 +45,17 @@ import (
 	pinnipedinformers "go.pinniped.dev/generated/latest/client/supervisor/informers/externalversions"
 	supervisoropenapi "go.pinniped.dev/generated/latest/client/supervisor/openapi"
 	"go.pinniped.dev/internal/apiserviceref"
+	"go.pinniped.dev/internal/auditlog"
 	"go.pinniped.dev/internal/config/supervisor"
 	"go.pinniped.dev/internal/controller/apicerts"
 	"go.pinniped.dev/internal/controller/supervisorconfig"
 	"go.pinniped.dev/internal/controller/supervisorconfig/activedirectoryupstreamwatcher"
 	"go.pinniped.dev/internal/controller/supervisorconfig/generator"
+	"go.pinniped.dev/internal/controller/supervisorconfig/githubupstreamwatcher"
 	"go.pinniped.dev/internal/controller/supervisorconfig/ldapupstreamwatcher"
 	"go.pinniped.dev/internal/controller/supervisorconfig/oidcclientwatcher"
 	"go.pinniped.dev/internal/controller/supervisorconfig/oidcupstreamwatcher"
+	"go.pinniped.dev/internal/controller/supervisorconfig/samlupstreamwatcher"
 	"go.pinniped.dev/internal/controller/supervisorstorage"
 	"go.pinniped.dev/internal/controllerinit"
 	"go.pinniped.dev/internal/controllerlib"
@@ -64,8 +68,10 @@ import (
 	"go.pinniped.dev/internal/leaderelection"
 	"go.pinniped.dev/internal/oidc/jwks"
 	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/oidc/provider/branding"
 	"go.pinniped.dev/internal/oidc/provider/manager"
 	"go.pinniped.dev/internal/plog"
+	"go.pinniped.dev/internal/registry/session"
 	"go.pinniped.dev/internal/secret"
 	"go.pinniped.dev/internal/supervisor/apiserver"
 	supervisorscheme "go.pinniped.dev/internal/supervisor/scheme"
@@ -131,6 +137,7 @@ func prepareControllers(
 	cfg *supervisor.Config,
 	issuerManager *manager.Manager,
 	dynamicJWKSProvider jwks.DynamicJWKSProvider,
+	dynamicBrandingProvider branding.DynamicBrandingProvider,
 	dynamicTLSCertProvider provider.DynamicTLSCertProvider,
 	dynamicUpstreamIDPProvider provider.DynamicUpstreamIDPProvider,
 	dynamicServingCertProvider dynamiccert.Private,
@@ -143,12 +150,17 @@ func prepareControllers(
 	pinnipedInformers pinnipedinformers.SharedInformerFactory,
 	leaderElector controllerinit.RunnerWrapper,
 	podInfo *downward.PodInfo,
+	auditLogger auditlog.Logger,
 ) controllerinit.RunnerBuilder {
 	const certificateName string = "pinniped-supervisor-api-tls-serving-certificate"
-	clientSecretSupervisorGroupData := groupsuffix.SupervisorAggregatedGroups(*cfg.APIGroupSuffix)
+	clientSecretSupervisorGroupData, sessionSupervisorGroupData := groupsuffix.SupervisorAggregatedGroups(*cfg.APIGroupSuffix)
 	federationDomainInformer := pinnipedInformers.Config().V1alpha1().FederationDomains()
 	oidcClientInformer := pinnipedInformers.Config().V1alpha1().OIDCClients()
 	secretInformer := kubeInformers.Core().V1().Secrets()
+	keyRotation := generator.KeyRotation{
+		Interval:    cfg.SecretRotation.Interval.Duration,
+		GracePeriod: cfg.SecretRotation.GracePeriod.Duration,
+	}
 
 	// Create controller manager.
 	controllerManager := controllerlib.
@@ -160,12 +172,15 @@ func prepareControllers(
 				kubeClient,
 				secretInformer,
 				controllerlib.WithInformer,
+				auditLogger,
 			),
 			singletonWorker,
 		).
 		WithController(
 			supervisorconfig.NewFederationDomainWatcherController(
 				issuerManager,
+				*cfg.APIGroupSuffix,
+				keyRotation.GracePeriod,
 				clock.RealClock{},
 				pinnipedClient,
 				federationDomainInformer,
@@ -176,6 +191,7 @@ func prepareControllers(
 		WithController(
 			supervisorconfig.NewJWKSWriterController(
 				cfg.Labels,
+				clock.RealClock{},
 				kubeClient,
 				pinnipedClient,
 				secretInformer,
@@ -193,6 +209,15 @@ func prepareControllers(
 			),
 			singletonWorker,
 		).
+		WithController(
+			supervisorconfig.NewBrandingObserverController(
+				dynamicBrandingProvider,
+				kubeInformers.Core().V1().ConfigMaps(),
+				federationDomainInformer,
+				controllerlib.WithInformer,
+			),
+			singletonWorker,
+		).
 		WithController(
 			supervisorconfig.NewTLSCertObserverController(
 				dynamicTLSCertProvider,
@@ -209,9 +234,12 @@ func prepareControllers(
 				cfg.Labels,
 				kubeClient,
 				secretInformer,
-				func(secret []byte) {
-					plog.Debug("setting csrf cookie secret")
+				keyRotation,
+				clock.RealClock{},
+				func(secret, previousSecret []byte) {
+					plog.Debug("setting csrf cookie secret", "hasPreviousSecret", previousSecret != nil)
 					secretCache.SetCSRFCookieEncoderHashKey(secret)
+					secretCache.SetPreviousCSRFCookieEncoderHashKey(previousSecret)
 				},
 				controllerlib.WithInformer,
 				controllerlib.WithInitialEvent,
@@ -225,9 +253,12 @@ func prepareControllers(
 					cfg.Labels,
 					rand.Reader,
 					generator.SecretUsageTokenSigningKey,
-					func(federationDomainIssuer string, symmetricKey []byte) {
-						plog.Debug("setting hmac secret", "issuer", federationDomainIssuer)
+					keyRotation,
+					clock.RealClock{},
+					func(federationDomainIssuer string, symmetricKey, previousSymmetricKey []byte) {
+						plog.Debug("setting hmac secret", "issuer", federationDomainIssuer, "hasPreviousKey", previousSymmetricKey != nil)
 						secretCache.SetTokenHMACKey(federationDomainIssuer, symmetricKey)
+						secretCache.SetPreviousTokenHMACKey(federationDomainIssuer, previousSymmetricKey)
 					},
 				),
 				func(fd *configv1alpha1.FederationDomainStatus) *corev1.LocalObjectReference {
@@ -248,9 +279,12 @@ func prepareControllers(
 					cfg.Labels,
 					rand.Reader,
 					generator.SecretUsageStateSigningKey,
-					func(federationDomainIssuer string, symmetricKey []byte) {
-						plog.Debug("setting state signature key", "issuer", federationDomainIssuer)
+					keyRotation,
+					clock.RealClock{},
+					func(federationDomainIssuer string, symmetricKey, previousSymmetricKey []byte) {
+						plog.Debug("setting state signature key", "issuer", federationDomainIssuer, "hasPreviousKey", previousSymmetricKey != nil)
 						secretCache.SetStateEncoderHashKey(federationDomainIssuer, symmetricKey)
+						secretCache.SetPreviousStateEncoderHashKey(federationDomainIssuer, previousSymmetricKey)
 					},
 				),
 				func(fd *configv1alpha1.FederationDomainStatus) *corev1.LocalObjectReference {
@@ -271,9 +305,12 @@ func prepareControllers(
 					cfg.Labels,
 					rand.Reader,
 					generator.SecretUsageStateEncryptionKey,
-					func(federationDomainIssuer string, symmetricKey []byte) {
-						plog.Debug("setting state encryption key", "issuer", federationDomainIssuer)
+					keyRotation,
+					clock.RealClock{},
+					func(federationDomainIssuer string, symmetricKey, previousSymmetricKey []byte) {
+						plog.Debug("setting state encryption key", "issuer", federationDomainIssuer, "hasPreviousKey", previousSymmetricKey != nil)
 						secretCache.SetStateEncoderBlockKey(federationDomainIssuer, symmetricKey)
+						secretCache.SetPreviousStateEncoderBlockKey(federationDomainIssuer, previousSymmetricKey)
 					},
 				),
 				func(fd *configv1alpha1.FederationDomainStatus) *corev1.LocalObjectReference {
@@ -315,6 +352,23 @@ func prepareControllers(
 				controllerlib.WithInformer,
 			),
 			singletonWorker).
+		WithController(
+			samlupstreamwatcher.New(
+				dynamicUpstreamIDPProvider,
+				pinnipedClient,
+				pinnipedInformers.IDP().V1alpha1().SAMLIdentityProviders(),
+				controllerlib.WithInformer,
+			),
+			singletonWorker).
+		WithController(
+			githubupstreamwatcher.New(
+				dynamicUpstreamIDPProvider,
+				pinnipedClient,
+				pinnipedInformers.IDP().V1alpha1().GitHubIdentityProviders(),
+				secretInformer,
+				controllerlib.WithInformer,
+			),
+			singletonWorker).
 		WithController(
 			apicerts.NewCertsManagerController(
 				podInfo.Namespace,
@@ -341,6 +395,17 @@ func prepareControllers(
 			),
 			singletonWorker,
 		).
+		WithController(
+			apicerts.NewAPIServiceUpdaterController(
+				podInfo.Namespace,
+				certificateName,
+				sessionSupervisorGroupData.APIServiceName(),
+				aggregatorClient,
+				secretInformer,
+				controllerlib.WithInformer,
+			),
+			singletonWorker,
+		).
 		WithController(
 			apicerts.NewCertsObserverController(
 				podInfo.Namespace,
@@ -380,7 +445,7 @@ func prepareControllers(
 //nolint:funlen
 func runSupervisor(ctx context.Context, podInfo *downward.PodInfo, cfg *supervisor.Config) error {
 	serverInstallationNamespace := podInfo.Namespace
-	clientSecretSupervisorGroupData := groupsuffix.SupervisorAggregatedGroups(*cfg.APIGroupSuffix)
+	clientSecretSupervisorGroupData, _ := groupsuffix.SupervisorAggregatedGroups(*cfg.APIGroupSuffix)
 
 	apiServiceRef, err := apiserviceref.New(clientSecretSupervisorGroupData.APIServiceName())
 	if err != nil {
@@ -430,9 +495,15 @@ func runSupervisor(ctx context.Context, podInfo *downward.PodInfo, cfg *supervis
 		_, _ = writer.Write([]byte("ok"))
 	}))
 
+	auditLogger, err := auditlog.NewFromSpec(ctx, cfg.Audit)
+	if err != nil {
+		return fmt.Errorf("could not configure audit events: %w", err)
+	}
+
 	dynamicServingCertProvider := dynamiccert.NewServingCert("supervisor-serving-cert")
 
 	dynamicJWKSProvider := jwks.NewDynamicJWKSProvider()
+	dynamicBrandingProvider := branding.NewDynamicBrandingProvider()
 	dynamicTLSCertProvider := provider.NewDynamicTLSCertProvider()
 	dynamicUpstreamIDPProvider := provider.NewDynamicUpstreamIDPProvider()
 	secretCache := secret.Cache{}
@@ -441,20 +512,24 @@ func runSupervisor(ctx context.Context, podInfo *downward.PodInfo, cfg *supervis
 	oidProvidersManager := manager.NewManager(
 		healthMux,
 		dynamicJWKSProvider,
+		dynamicBrandingProvider,
 		dynamicUpstreamIDPProvider,
 		&secretCache,
 		clientWithoutLeaderElection.Kubernetes.CoreV1().Secrets(serverInstallationNamespace), // writes to kube storage are allowed for non-leaders
 		client.PinnipedSupervisor.ConfigV1alpha1().OIDCClients(serverInstallationNamespace),
+		cfg.DeviceAuthorization.DeviceLimits(),
+		auditLogger,
 	)
 
-	// Get the "real" name of the client secret supervisor API group (i.e., the API group name with the
+	// Get the "real" names of the supervisor aggregated API groups (i.e., the API group names with the
 	// injected suffix).
-	scheme, clientSecretGV := supervisorscheme.New(*cfg.APIGroupSuffix)
+	scheme, clientSecretGV, sessionGV := supervisorscheme.New(*cfg.APIGroupSuffix)
 
 	buildControllersFunc := prepareControllers(
 		cfg,
 		oidProvidersManager,
 		dynamicJWKSProvider,
+		dynamicBrandingProvider,
 		dynamicTLSCertProvider,
 		dynamicUpstreamIDPProvider,
 		dynamicServingCertProvider,
@@ -467,6 +542,7 @@ func runSupervisor(ctx context.Context, podInfo *downward.PodInfo, cfg *supervis
 		pinnipedInformers,
 		leaderElector,
 		podInfo,
+		auditLogger,
 	)
 
 	shutdown := &sync.WaitGroup{}
@@ -479,9 +555,12 @@ func runSupervisor(ctx context.Context, podInfo *downward.PodInfo, cfg *supervis
 		*cfg.AggregatedAPIServerPort,
 		scheme,
 		clientSecretGV,
+		sessionGV,
 		clientWithoutLeaderElection.Kubernetes.CoreV1().Secrets(serverInstallationNamespace),
 		client.PinnipedSupervisor.ConfigV1alpha1().OIDCClients(serverInstallationNamespace),
+		dynamicUpstreamIDPProvider,
 		serverInstallationNamespace,
+		auditLogger,
 	)
 	if err != nil {
 		return fmt.Errorf("could not configure aggregated API server: %w", err)
@@ -547,6 +626,10 @@ func runSupervisor(ctx context.Context, podInfo *downward.PodInfo, cfg *supervis
 
 			return cert, nil
 		}
+		if cfg.RequestClientCertificates {
+			// The certificates are verified by the token endpoint, only for the OIDCClients which use tls_client_auth.
+			c.ClientAuth = tls.RequestClientCert
+		}
 
 		httpsListener, err := tls.Listen(e.Network, e.Address, c)
 		if err != nil {
@@ -562,6 +645,27 @@ func runSupervisor(ctx context.Context, podInfo *downward.PodInfo, cfg *supervis
 		plog.Debug("supervisor https listener started", "address", httpsListener.Addr().String())
 	}
 
+	if e := cfg.Endpoints.Metrics; e.Network != supervisor.NetworkDisabled {
+		finishSetupPerms := maybeSetupUnixPerms(e, supervisorPod)
+
+		metricsListener, err := net.Listen(e.Network, e.Address)
+		if err != nil {
+			return fmt.Errorf("cannot create metrics listener with network %q and address %q: %w", e.Network, e.Address, err)
+		}
+
+		if err := finishSetupPerms(); err != nil {
+			return fmt.Errorf("cannot setup metrics listener permissions for network %q and address %q: %w", e.Network, e.Address, err)
+		}
+
+		// Serve the Prometheus metrics and make all other paths result in 404.
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", legacyregistry.Handler())
+
+		defer func() { _ = metricsListener.Close() }()
+		startServer(ctx, shutdown, metricsListener, metricsMux)
+		plog.Debug("supervisor metrics listener started", "address", metricsListener.Addr().String())
+	}
+
 	plog.Debug("supervisor started")
 	defer plog.Debug("supervisor exiting")
 
@@ -582,9 +686,12 @@ func getAggregatedAPIServerConfig(
 	aggregatedAPIServerPort int64,
 	scheme *runtime.Scheme,
 	clientSecretSupervisorGroupVersion schema.GroupVersion,
+	sessionSupervisorGroupVersion schema.GroupVersion,
 	secrets corev1client.SecretInterface,
 	oidcClients v1alpha1.OIDCClientInterface,
+	upstreamOIDCIdentityProviders session.UpstreamOIDCIdentityProviderICache,
 	serverInstallationNamespace string,
+	auditLogger auditlog.Logger,
 ) (*apiserver.Config, error) {
 	codecs := serializer.NewCodecFactory(scheme)
 
@@ -593,7 +700,7 @@ func getAggregatedAPIServerConfig(
 
 	recommendedOptions := genericoptions.NewRecommendedOptions(
 		defaultEtcdPathPrefix,
-		codecs.LegacyCodec(clientSecretSupervisorGroupVersion),
+		codecs.LegacyCodec(clientSecretSupervisorGroupVersion, sessionSupervisorGroupVersion),
 	)
 	recommendedOptions.Etcd = nil // turn off etcd storage because we don't need it yet
 	recommendedOptions.SecureServing.ServerCert.GeneratedCert = dynamicCertProvider
@@ -633,9 +740,12 @@ func getAggregatedAPIServerConfig(
 			Scheme:                             scheme,
 			NegotiatedSerializer:               codecs,
 			ClientSecretSupervisorGroupVersion: clientSecretSupervisorGroupVersion,
+			SessionSupervisorGroupVersion:      sessionSupervisorGroupVersion,
 			Secrets:                            secrets,
 			OIDCClients:                        oidcClients,
+			UpstreamOIDCIdentityProviders:      upstreamOIDCIdentityProviders,
 			Namespace:                          serverInstallationNamespace,
+			AuditLogger:                        auditLogger,
 		},
 	}
 	return apiServerConfig, nil
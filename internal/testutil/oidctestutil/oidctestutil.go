@@ -1,4 +1,4 @@
-// Copyright 2020-2023 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package oidctestutil
@@ -7,7 +7,11 @@ import (
 	"context"
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/base64"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"regexp"
 	"strings"
@@ -17,6 +21,8 @@ import (
 	coreosoidc "github.com/coreos/go-oidc/v3/oidc"
 	"github.com/gorilla/securecookie"
 	"github.com/ory/fosite"
+	"github.com/ory/fosite/handler/openid"
+	"github.com/ory/fosite/token/jwt"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/oauth2"
 	"gopkg.in/square/go-jose.v2"
@@ -29,11 +35,13 @@ import (
 	"k8s.io/utils/strings/slices"
 
 	"go.pinniped.dev/internal/authenticators"
+	"go.pinniped.dev/internal/celtransformer"
 	"go.pinniped.dev/internal/crud"
 	"go.pinniped.dev/internal/fositestorage/authorizationcode"
 	"go.pinniped.dev/internal/fositestorage/openidconnect"
 	pkce2 "go.pinniped.dev/internal/fositestorage/pkce"
 	"go.pinniped.dev/internal/fositestoragei"
+	"go.pinniped.dev/internal/idtransform"
 	"go.pinniped.dev/internal/oidc/provider"
 	"go.pinniped.dev/internal/psession"
 	"go.pinniped.dev/internal/testutil"
@@ -160,6 +168,7 @@ type TestUpstreamOIDCIdentityProvider struct {
 	AuthorizationURL         url.URL
 	UserInfoURL              bool
 	RevocationURL            *url.URL
+	EndSessionURL            *url.URL
 	UsernameClaim            string
 	GroupsClaim              string
 	Scopes                   []string
@@ -232,6 +241,10 @@ func (u *TestUpstreamOIDCIdentityProvider) GetRevocationURL() *url.URL {
 	return u.RevocationURL
 }
 
+func (u *TestUpstreamOIDCIdentityProvider) GetEndSessionURL() *url.URL {
+	return u.EndSessionURL
+}
+
 func (u *TestUpstreamOIDCIdentityProvider) GetScopes() []string {
 	return u.Scopes
 }
@@ -327,7 +340,7 @@ func (u *TestUpstreamOIDCIdentityProvider) PerformRefreshArgs(call int) *Perform
 }
 
 func (u *TestUpstreamOIDCIdentityProvider) RevokeTokenCallCount() int {
-	return u.performRefreshCallCount
+	return u.revokeTokenCallCount
 }
 
 func (u *TestUpstreamOIDCIdentityProvider) RevokeTokenArgs(call int) *RevokeTokenArgs {
@@ -363,10 +376,210 @@ func (u *TestUpstreamOIDCIdentityProvider) ValidateTokenAndMergeWithUserInfoArgs
 	return u.validateTokenAndMergeWithUserInfoArgs[call]
 }
 
+// ValidateResponseArgs is used to spy on calls to
+// TestUpstreamSAMLIdentityProvider.ValidateResponseFunc().
+type ValidateResponseArgs struct {
+	SP           provider.SAMLServiceProvider
+	SAMLResponse string
+	RequestID    string
+}
+
+// TestUpstreamSAMLIdentityProvider is a test double for provider.UpstreamSAMLIdentityProviderI. Its SSO URL
+// does not encode an actual AuthnRequest, so tests can easily make assertions about the redirect.
+type TestUpstreamSAMLIdentityProvider struct {
+	Name                  string
+	ResourceUID           types.UID
+	EntityID              string
+	SSOURL                *url.URL
+	UsernameAttribute     string
+	GroupsAttribute       string
+	ValidateResponseFunc  func(sp provider.SAMLServiceProvider, samlResponse string, requestID string) (*provider.SAMLAssertion, error)
+	validateResponseCalls int
+	validateResponseArgs  []*ValidateResponseArgs
+}
+
+var _ provider.UpstreamSAMLIdentityProviderI = &TestUpstreamSAMLIdentityProvider{}
+
+func (u *TestUpstreamSAMLIdentityProvider) GetName() string {
+	return u.Name
+}
+
+func (u *TestUpstreamSAMLIdentityProvider) GetResourceUID() types.UID {
+	return u.ResourceUID
+}
+
+func (u *TestUpstreamSAMLIdentityProvider) GetEntityID() string {
+	return u.EntityID
+}
+
+func (u *TestUpstreamSAMLIdentityProvider) GetUsernameAttribute() string {
+	return u.UsernameAttribute
+}
+
+func (u *TestUpstreamSAMLIdentityProvider) GetGroupsAttribute() string {
+	return u.GroupsAttribute
+}
+
+func (u *TestUpstreamSAMLIdentityProvider) AuthnRequestURL(sp provider.SAMLServiceProvider, requestID string, relayState string) (*url.URL, error) {
+	redirectURL := *u.SSOURL
+	q := redirectURL.Query()
+	q.Set("SAMLRequest", fmt.Sprintf("%s from %s", requestID, sp.EntityID))
+	q.Set("RelayState", relayState)
+	redirectURL.RawQuery = q.Encode()
+	return &redirectURL, nil
+}
+
+func (u *TestUpstreamSAMLIdentityProvider) ValidateResponse(sp provider.SAMLServiceProvider, samlResponse string, requestID string) (*provider.SAMLAssertion, error) {
+	u.validateResponseCalls++
+	u.validateResponseArgs = append(u.validateResponseArgs, &ValidateResponseArgs{
+		SP:           sp,
+		SAMLResponse: samlResponse,
+		RequestID:    requestID,
+	})
+	return u.ValidateResponseFunc(sp, samlResponse, requestID)
+}
+
+func (u *TestUpstreamSAMLIdentityProvider) ValidateResponseCallCount() int {
+	return u.validateResponseCalls
+}
+
+func (u *TestUpstreamSAMLIdentityProvider) ValidateResponseArgs(call int) *ValidateResponseArgs {
+	return u.validateResponseArgs[call]
+}
+
+// ExchangeAuthcodeArgs is used to spy on calls to
+// TestUpstreamGitHubIdentityProvider.ExchangeAuthcodeFunc().
+type ExchangeAuthcodeArgs struct {
+	Ctx         context.Context
+	Authcode    string
+	RedirectURI string
+}
+
+// GetUserArgs is used to spy on calls to
+// TestUpstreamGitHubIdentityProvider.GetUserFunc().
+type GetUserArgs struct {
+	Ctx         context.Context
+	AccessToken string
+}
+
+// TestUpstreamGitHubIdentityProvider is a test double for provider.UpstreamGitHubIdentityProviderI.
+type TestUpstreamGitHubIdentityProvider struct {
+	Name                 string
+	ResourceUID          types.UID
+	ClientID             string
+	AuthorizationURL     string
+	Scopes               []string
+	ExchangeAuthcodeFunc func(ctx context.Context, authcode string, redirectURI string) (string, error)
+	GetUserFunc          func(ctx context.Context, accessToken string) (*provider.GitHubUser, error)
+	exchangeAuthcodeArgs []*ExchangeAuthcodeArgs
+	getUserArgs          []*GetUserArgs
+}
+
+var _ provider.UpstreamGitHubIdentityProviderI = &TestUpstreamGitHubIdentityProvider{}
+
+func (u *TestUpstreamGitHubIdentityProvider) GetName() string {
+	return u.Name
+}
+
+func (u *TestUpstreamGitHubIdentityProvider) GetResourceUID() types.UID {
+	return u.ResourceUID
+}
+
+func (u *TestUpstreamGitHubIdentityProvider) GetClientID() string {
+	return u.ClientID
+}
+
+func (u *TestUpstreamGitHubIdentityProvider) GetAuthorizationURL() string {
+	return u.AuthorizationURL
+}
+
+func (u *TestUpstreamGitHubIdentityProvider) GetScopes() []string {
+	return u.Scopes
+}
+
+func (u *TestUpstreamGitHubIdentityProvider) ExchangeAuthcode(ctx context.Context, authcode string, redirectURI string) (string, error) {
+	u.exchangeAuthcodeArgs = append(u.exchangeAuthcodeArgs, &ExchangeAuthcodeArgs{
+		Ctx:         ctx,
+		Authcode:    authcode,
+		RedirectURI: redirectURI,
+	})
+	return u.ExchangeAuthcodeFunc(ctx, authcode, redirectURI)
+}
+
+func (u *TestUpstreamGitHubIdentityProvider) ExchangeAuthcodeCallCount() int {
+	return len(u.exchangeAuthcodeArgs)
+}
+
+func (u *TestUpstreamGitHubIdentityProvider) ExchangeAuthcodeArgs(call int) *ExchangeAuthcodeArgs {
+	return u.exchangeAuthcodeArgs[call]
+}
+
+func (u *TestUpstreamGitHubIdentityProvider) GetUser(ctx context.Context, accessToken string) (*provider.GitHubUser, error) {
+	u.getUserArgs = append(u.getUserArgs, &GetUserArgs{
+		Ctx:         ctx,
+		AccessToken: accessToken,
+	})
+	return u.GetUserFunc(ctx, accessToken)
+}
+
+func (u *TestUpstreamGitHubIdentityProvider) GetUserCallCount() int {
+	return len(u.getUserArgs)
+}
+
+func (u *TestUpstreamGitHubIdentityProvider) GetUserArgs(call int) *GetUserArgs {
+	return u.getUserArgs[call]
+}
+
+// TestFederationDomainIdentityProvidersLister is a test double for oidc.FederationDomainIdentityProvidersListerI.
+type TestFederationDomainIdentityProvidersLister struct {
+	provider.DynamicUpstreamIDPProvider
+	identityTransforms          map[idpNameAndType]*idtransform.TransformationPipeline
+	clientCredentialsTransforms *idtransform.TransformationPipeline
+}
+
+type idpNameAndType struct {
+	name    string
+	idpType psession.ProviderType
+}
+
+func (l *TestFederationDomainIdentityProvidersLister) GetIdentityTransformations(idpName string, idpType psession.ProviderType) *idtransform.TransformationPipeline {
+	if transforms, ok := l.identityTransforms[idpNameAndType{name: idpName, idpType: idpType}]; ok {
+		return transforms
+	}
+	return idtransform.NewTransformationPipeline()
+}
+
+func (l *TestFederationDomainIdentityProvidersLister) GetClientCredentialsTransformations() *idtransform.TransformationPipeline {
+	if l.clientCredentialsTransforms != nil {
+		return l.clientCredentialsTransforms
+	}
+	return idtransform.NewTransformationPipeline()
+}
+
+// NewTransformationPipeline compiles the given CEL transformations into a pipeline, in the order given.
+func NewTransformationPipeline(t *testing.T, consts *celtransformer.TransformationConstants, transforms ...celtransformer.CELTransformation) *idtransform.TransformationPipeline {
+	t.Helper()
+
+	transformer, err := celtransformer.NewCELTransformer(5 * time.Second)
+	require.NoError(t, err)
+
+	pipeline := idtransform.NewTransformationPipeline()
+	for _, transform := range transforms {
+		compiledTransform, err := transformer.CompileTransformation(transform, consts)
+		require.NoError(t, err)
+		pipeline.AppendTransformation(compiledTransform)
+	}
+	return pipeline
+}
+
 type UpstreamIDPListerBuilder struct {
 	upstreamOIDCIdentityProviders            []*TestUpstreamOIDCIdentityProvider
 	upstreamLDAPIdentityProviders            []*TestUpstreamLDAPIdentityProvider
 	upstreamActiveDirectoryIdentityProviders []*TestUpstreamLDAPIdentityProvider
+	upstreamSAMLIdentityProviders            []*TestUpstreamSAMLIdentityProvider
+	upstreamGitHubIdentityProviders          []*TestUpstreamGitHubIdentityProvider
+	identityTransforms                       map[idpNameAndType]*idtransform.TransformationPipeline
+	clientCredentialsTransforms              *idtransform.TransformationPipeline
 }
 
 func (b *UpstreamIDPListerBuilder) WithOIDC(upstreamOIDCIdentityProviders ...*TestUpstreamOIDCIdentityProvider) *UpstreamIDPListerBuilder {
@@ -384,7 +597,34 @@ func (b *UpstreamIDPListerBuilder) WithActiveDirectory(upstreamActiveDirectoryId
 	return b
 }
 
-func (b *UpstreamIDPListerBuilder) Build() provider.DynamicUpstreamIDPProvider {
+func (b *UpstreamIDPListerBuilder) WithSAML(upstreamSAMLIdentityProviders ...*TestUpstreamSAMLIdentityProvider) *UpstreamIDPListerBuilder {
+	b.upstreamSAMLIdentityProviders = append(b.upstreamSAMLIdentityProviders, upstreamSAMLIdentityProviders...)
+	return b
+}
+
+func (b *UpstreamIDPListerBuilder) WithGitHub(upstreamGitHubIdentityProviders ...*TestUpstreamGitHubIdentityProvider) *UpstreamIDPListerBuilder {
+	b.upstreamGitHubIdentityProviders = append(b.upstreamGitHubIdentityProviders, upstreamGitHubIdentityProviders...)
+	return b
+}
+
+// WithIdentityTransformations configures the identity transformations which will be returned by the built
+// lister for the identity provider of the given name and type.
+func (b *UpstreamIDPListerBuilder) WithIdentityTransformations(idpName string, idpType psession.ProviderType, transforms *idtransform.TransformationPipeline) *UpstreamIDPListerBuilder {
+	if b.identityTransforms == nil {
+		b.identityTransforms = map[idpNameAndType]*idtransform.TransformationPipeline{}
+	}
+	b.identityTransforms[idpNameAndType{name: idpName, idpType: idpType}] = transforms
+	return b
+}
+
+// WithClientCredentialsTransformations configures the identity transformations which will be returned by the built
+// lister for the identities of clients which use the client_credentials grant.
+func (b *UpstreamIDPListerBuilder) WithClientCredentialsTransformations(transforms *idtransform.TransformationPipeline) *UpstreamIDPListerBuilder {
+	b.clientCredentialsTransforms = transforms
+	return b
+}
+
+func (b *UpstreamIDPListerBuilder) Build() *TestFederationDomainIdentityProvidersLister {
 	idpProvider := provider.NewDynamicUpstreamIDPProvider()
 
 	oidcUpstreams := make([]provider.UpstreamOIDCIdentityProviderI, len(b.upstreamOIDCIdentityProviders))
@@ -405,7 +645,23 @@ func (b *UpstreamIDPListerBuilder) Build() provider.DynamicUpstreamIDPProvider {
 	}
 	idpProvider.SetActiveDirectoryIdentityProviders(adUpstreams)
 
-	return idpProvider
+	samlUpstreams := make([]provider.UpstreamSAMLIdentityProviderI, len(b.upstreamSAMLIdentityProviders))
+	for i := range b.upstreamSAMLIdentityProviders {
+		samlUpstreams[i] = provider.UpstreamSAMLIdentityProviderI(b.upstreamSAMLIdentityProviders[i])
+	}
+	idpProvider.SetSAMLIdentityProviders(samlUpstreams)
+
+	gitHubUpstreams := make([]provider.UpstreamGitHubIdentityProviderI, len(b.upstreamGitHubIdentityProviders))
+	for i := range b.upstreamGitHubIdentityProviders {
+		gitHubUpstreams[i] = provider.UpstreamGitHubIdentityProviderI(b.upstreamGitHubIdentityProviders[i])
+	}
+	idpProvider.SetGitHubIdentityProviders(gitHubUpstreams)
+
+	return &TestFederationDomainIdentityProvidersLister{
+		DynamicUpstreamIDPProvider:  idpProvider,
+		identityTransforms:          b.identityTransforms,
+		clientCredentialsTransforms: b.clientCredentialsTransforms,
+	}
 }
 
 func (b *UpstreamIDPListerBuilder) RequireExactlyOneCallToPasswordCredentialsGrantAndValidateTokens(
@@ -634,6 +890,7 @@ type TestUpstreamOIDCIdentityProviderBuilder struct {
 	validatedAndMergedWithUserInfoTokens *oidctypes.Token
 	authorizationURL                     url.URL
 	hasUserInfoURL                       bool
+	endSessionURL                        *url.URL
 	additionalAuthcodeParams             map[string]string
 	additionalClaimMappings              map[string]string
 	allowPasswordGrant                   bool
@@ -674,6 +931,11 @@ func (u *TestUpstreamOIDCIdentityProviderBuilder) WithoutUserInfoURL() *TestUpst
 	return u
 }
 
+func (u *TestUpstreamOIDCIdentityProviderBuilder) WithEndSessionURL(value *url.URL) *TestUpstreamOIDCIdentityProviderBuilder {
+	u.endSessionURL = value
+	return u
+}
+
 func (u *TestUpstreamOIDCIdentityProviderBuilder) WithAllowPasswordGrant(value bool) *TestUpstreamOIDCIdentityProviderBuilder {
 	u.allowPasswordGrant = value
 	return u
@@ -802,6 +1064,7 @@ func (u *TestUpstreamOIDCIdentityProviderBuilder) Build() *TestUpstreamOIDCIdent
 		AllowPasswordGrant:       u.allowPasswordGrant,
 		AuthorizationURL:         u.authorizationURL,
 		UserInfoURL:              u.hasUserInfoURL,
+		EndSessionURL:            u.endSessionURL,
 		AdditionalAuthcodeParams: u.additionalAuthcodeParams,
 		AdditionalClaimMappings:  u.additionalClaimMappings,
 		ExchangeAuthcodeAndValidateTokensFunc: func(ctx context.Context, authcode string, pkceCodeVerifier pkce.Code, expectedIDTokenNonce nonce.Nonce) (*oidctypes.Token, error) {
@@ -850,6 +1113,7 @@ type ExpectedUpstreamStateParamFormat struct {
 	C string `json:"c"`
 	K string `json:"k"`
 	V string `json:"v"`
+	R string `json:"r,omitempty"`
 }
 
 type UpstreamStateParamBuilder ExpectedUpstreamStateParamFormat
@@ -865,6 +1129,11 @@ func (b *UpstreamStateParamBuilder) WithAuthorizeRequestParams(params string) *U
 	return b
 }
 
+func (b *UpstreamStateParamBuilder) WithCorrelationID(correlationID string) *UpstreamStateParamBuilder {
+	b.R = correlationID
+	return b
+}
+
 func (b *UpstreamStateParamBuilder) WithNonce(nonce string) *UpstreamStateParamBuilder {
 	b.N = nonce
 	return b
@@ -928,6 +1197,96 @@ func VerifyECDSAIDToken(
 	return token
 }
 
+// SimulatedLogin describes the downstream login performed by SimulateLoginHavingAlreadyHappened.
+type SimulatedLogin struct {
+	ClientID    string
+	RedirectURI string
+	// ClientSecret is used to authenticate to the token endpoint. Leave it empty for public clients like pinniped-cli.
+	ClientSecret string
+	// Scopes are both requested and granted.
+	Scopes            []string
+	IDTokenClaims     *jwt.IDTokenClaims
+	CustomSessionData *psession.CustomSessionData
+}
+
+// SimulatedLoginTokens are the downstream tokens returned by SimulateLoginHavingAlreadyHappened. The refresh token
+// and ID token are only returned when the offline_access and openid scopes were granted.
+type SimulatedLoginTokens struct {
+	RequestID    string
+	AccessToken  string
+	RefreshToken string
+	IDToken      string
+}
+
+// SimulateLoginHavingAlreadyHappened runs the authorize and token endpoints' fosite code to fill the storage with a
+// realistic session, for tests of the endpoints which are used after a login.
+func SimulateLoginHavingAlreadyHappened(t *testing.T, oauthHelper fosite.OAuth2Provider, login SimulatedLogin) *SimulatedLoginTokens {
+	t.Helper()
+	ctx := context.Background()
+	pkceVerifier := "test-pkce-code-verifier-which-is-long-enough-to-be-valid"
+	pkceChallenge := sha256.Sum256([]byte(pkceVerifier))
+
+	authRequest := httptest.NewRequest(http.MethodGet, "/authorize?"+url.Values{
+		"response_type":         []string{"code"},
+		"client_id":             []string{login.ClientID},
+		"redirect_uri":          []string{login.RedirectURI},
+		"scope":                 []string{strings.Join(login.Scopes, " ")},
+		"state":                 []string{"some-state-value-with-enough-bytes-to-exceed-min-allowed"},
+		"nonce":                 []string{"some-nonce-value-with-enough-bytes-to-exceed-min-allowed"},
+		"code_challenge":        []string{base64.RawURLEncoding.EncodeToString(pkceChallenge[:])},
+		"code_challenge_method": []string{"S256"},
+	}.Encode(), nil)
+	authRequester, err := oauthHelper.NewAuthorizeRequest(ctx, authRequest)
+	require.NoError(t, err)
+	for _, scope := range login.Scopes {
+		authRequester.GrantScope(scope)
+	}
+
+	session := &psession.PinnipedSession{
+		Fosite: &openid.DefaultSession{Claims: login.IDTokenClaims},
+	}
+	if login.CustomSessionData != nil {
+		// Like the Supervisor's login endpoints, remember the authorize request which started the session.
+		customSessionData := *login.CustomSessionData
+		customSessionData.CorrelationID = authRequester.GetID()
+		session.Custom = &customSessionData
+	}
+	authResponder, err := oauthHelper.NewAuthorizeResponse(ctx, authRequester, session)
+	require.NoError(t, err)
+
+	tokenForm := url.Values{
+		"grant_type":    []string{"authorization_code"},
+		"code":          []string{authResponder.GetCode()},
+		"redirect_uri":  []string{login.RedirectURI},
+		"code_verifier": []string{pkceVerifier},
+	}
+	if login.ClientSecret == "" {
+		tokenForm.Set("client_id", login.ClientID)
+	}
+	tokenRequest := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(tokenForm.Encode()))
+	tokenRequest.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if login.ClientSecret != "" {
+		tokenRequest.SetBasicAuth(login.ClientID, login.ClientSecret)
+	}
+	accessRequester, err := oauthHelper.NewAccessRequest(ctx, tokenRequest, psession.NewPinnipedSession())
+	require.NoError(t, err)
+	accessResponder, err := oauthHelper.NewAccessResponse(ctx, accessRequester)
+	require.NoError(t, err)
+
+	tokens := &SimulatedLoginTokens{RequestID: accessRequester.GetID(), AccessToken: accessResponder.GetAccessToken()}
+	if slices.Contains(login.Scopes, "offline_access") {
+		var ok bool
+		tokens.RefreshToken, ok = accessResponder.GetExtra("refresh_token").(string)
+		require.True(t, ok)
+	}
+	if slices.Contains(login.Scopes, "openid") {
+		var ok bool
+		tokens.IDToken, ok = accessResponder.GetExtra("id_token").(string)
+		require.True(t, ok)
+	}
+	return tokens
+}
+
 func RequireAuthCodeRegexpMatch(
 	t *testing.T,
 	actualContent string,
@@ -1140,7 +1499,13 @@ func validateAuthcodeStorage(
 	require.Empty(t, actualClaims.AuthenticationContextClassReference)
 	require.Empty(t, actualClaims.AuthenticationMethodsReferences)
 
-	// Check that the custom Pinniped session data matches.
+	// Check that the custom Pinniped session data matches. Unless the test expects the correlation ID to come from
+	// the upstream state param, it is the ID of the authorize request which created the session.
+	if wantCustomSessionData != nil && wantCustomSessionData.CorrelationID == "" {
+		wantCustomSessionDataWithCorrelationID := *wantCustomSessionData
+		wantCustomSessionDataWithCorrelationID.CorrelationID = storedRequestFromAuthcode.GetID()
+		wantCustomSessionData = &wantCustomSessionDataWithCorrelationID
+	}
 	require.Equal(t, wantCustomSessionData, storedSessionFromAuthcode.Custom)
 
 	return storedRequestFromAuthcode, storedSessionFromAuthcode
@@ -1217,6 +1582,9 @@ func FilterClientSecretCreateActions(actions []kubetesting.Action) []kubetesting
 			if strings.HasPrefix(getAction.GetName(), "pinniped-storage-oidc-client-secret-") {
 				continue // filter out OIDCClient's storage secret reads
 			}
+			if strings.HasPrefix(getAction.GetName(), "pinniped-storage-consent-") {
+				continue // filter out reads of the remembered consents of OIDCClients which require consent
+			}
 		}
 		filtered = append(filtered, action) // otherwise include the action
 	}
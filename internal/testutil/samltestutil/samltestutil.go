@@ -0,0 +1,246 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package samltestutil provides a stand-in SAML identity provider for tests, which signs responses the same way
+// as real identity providers such as ADFS and Shibboleth, without any real user authentication.
+package samltestutil
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math/big"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/russellhaering/goxmldsig/etreeutils"
+	"github.com/stretchr/testify/require"
+
+	"go.pinniped.dev/internal/oidc/provider"
+)
+
+// IdentityProvider is a stand-in SAML identity provider.
+type IdentityProvider struct {
+	EntityID string
+	SSOURL   string
+	Key      *rsa.PrivateKey
+	Cert     *x509.Certificate
+}
+
+// NewIdentityProvider creates a stand-in identity provider with a new signing key.
+func NewIdentityProvider(t *testing.T, entityID string) *IdentityProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test-saml-idp-signer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &IdentityProvider{
+		EntityID: entityID,
+		SSOURL:   strings.TrimSuffix(entityID, "/") + "/sso",
+		Key:      key,
+		Cert:     cert,
+	}
+}
+
+// Metadata returns the metadata of the identity provider.
+func (idp *IdentityProvider) Metadata() string {
+	return fmt.Sprintf(`<?xml version="1.0"?>
+<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata" entityID="%s">
+  <md:IDPSSODescriptor protocolSupportEnumeration="urn:oasis:names:tc:SAML:2.0:protocol" WantAuthnRequestsSigned="false">
+    <md:KeyDescriptor use="signing">
+      <ds:KeyInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#">
+        <ds:X509Data><ds:X509Certificate>%s</ds:X509Certificate></ds:X509Data>
+      </ds:KeyInfo>
+    </md:KeyDescriptor>
+    <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST" Location="%s"/>
+    <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect" Location="%s"/>
+  </md:IDPSSODescriptor>
+</md:EntityDescriptor>
+`, escape(idp.EntityID), base64.StdEncoding.EncodeToString(idp.Cert.Raw), escape(idp.SSOURL), escape(idp.SSOURL))
+}
+
+// AuthnRequest is the content of an AuthnRequest which was received by the identity provider.
+type AuthnRequest struct {
+	ID                          string `xml:"ID,attr"`
+	Destination                 string `xml:"Destination,attr"`
+	AssertionConsumerServiceURL string `xml:"AssertionConsumerServiceURL,attr"`
+	ProtocolBinding             string `xml:"ProtocolBinding,attr"`
+	Issuer                      string `xml:"Issuer"`
+	NameIDPolicy                struct {
+		Format      string `xml:"Format,attr"`
+		AllowCreate bool   `xml:"AllowCreate,attr"`
+	} `xml:"NameIDPolicy"`
+}
+
+// ParseAuthnRequestURL decodes the AuthnRequest and the RelayState from a URL which redirects the browser
+// to the identity provider using the HTTP-Redirect binding.
+func ParseAuthnRequestURL(t *testing.T, redirectURL string) (*AuthnRequest, string) {
+	t.Helper()
+
+	parsed, err := url.Parse(redirectURL)
+	require.NoError(t, err)
+	compressed, err := base64.StdEncoding.DecodeString(parsed.Query().Get("SAMLRequest"))
+	require.NoError(t, err)
+	decompressed, err := io.ReadAll(flate.NewReader(bytes.NewReader(compressed)))
+	require.NoError(t, err)
+
+	var request AuthnRequest
+	require.NoError(t, xml.Unmarshal(decompressed, &request))
+	return &request, parsed.Query().Get("RelayState")
+}
+
+// Response describes a response of the identity provider. Its fields may be changed to create invalid responses.
+type Response struct {
+	InResponseTo        string
+	Destination         string
+	Issuer              string
+	StatusCode          string
+	NameID              string
+	Recipient           string
+	Audience            string
+	NotBefore           time.Time
+	NotOnOrAfter        time.Time
+	SessionNotOnOrAfter time.Time // optional
+	Attributes          map[string][]string
+	SignResponse        bool
+	SignAssertion       bool
+}
+
+// NewResponse returns a valid response to the given request from the given service provider, with a signed assertion.
+func (idp *IdentityProvider) NewResponse(sp provider.SAMLServiceProvider, requestID string, nameID string) *Response {
+	now := time.Now().UTC()
+	return &Response{
+		InResponseTo:  requestID,
+		Destination:   sp.ACSURL,
+		Issuer:        idp.EntityID,
+		StatusCode:    "urn:oasis:names:tc:SAML:2.0:status:Success",
+		NameID:        nameID,
+		Recipient:     sp.ACSURL,
+		Audience:      sp.EntityID,
+		NotBefore:     now.Add(-time.Minute),
+		NotOnOrAfter:  now.Add(5 * time.Minute),
+		Attributes:    map[string][]string{},
+		SignAssertion: true,
+	}
+}
+
+// Encode returns the response in the form which is posted to the assertion consumer service of the service provider,
+// i.e. as the value of the SAMLResponse form parameter.
+func (idp *IdentityProvider) Encode(t *testing.T, r *Response) string {
+	t.Helper()
+
+	timeFormat := func(t time.Time) string { return t.UTC().Format(time.RFC3339) }
+	var session string
+	if !r.SessionNotOnOrAfter.IsZero() {
+		session = fmt.Sprintf(` SessionNotOnOrAfter="%s"`, timeFormat(r.SessionNotOnOrAfter))
+	}
+	attributeNames := make([]string, 0, len(r.Attributes))
+	for name := range r.Attributes {
+		attributeNames = append(attributeNames, name)
+	}
+	sort.Strings(attributeNames)
+	var attributes strings.Builder
+	for _, name := range attributeNames {
+		attributes.WriteString(fmt.Sprintf(`<saml:Attribute Name="%s">`, escape(name)))
+		for _, value := range r.Attributes[name] {
+			attributes.WriteString(fmt.Sprintf(`<saml:AttributeValue xsi:type="xs:string">%s</saml:AttributeValue>`, escape(value)))
+		}
+		attributes.WriteString(`</saml:Attribute>`)
+	}
+
+	document := fmt.Sprintf(`<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="response-%[1]s" Version="2.0" IssueInstant="%[2]s" Destination="%[3]s" InResponseTo="%[4]s">
+  <saml:Issuer>%[5]s</saml:Issuer>
+  <samlp:Status><samlp:StatusCode Value="%[6]s"/></samlp:Status>
+  <saml:Assertion xmlns:xs="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" ID="assertion-%[1]s" Version="2.0" IssueInstant="%[2]s">
+    <saml:Issuer>%[5]s</saml:Issuer>
+    <saml:Subject>
+      <saml:NameID Format="urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified">%[7]s</saml:NameID>
+      <saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer">
+        <saml:SubjectConfirmationData InResponseTo="%[4]s" Recipient="%[8]s" NotOnOrAfter="%[9]s"/>
+      </saml:SubjectConfirmation>
+    </saml:Subject>
+    <saml:Conditions NotBefore="%[10]s" NotOnOrAfter="%[9]s">
+      <saml:AudienceRestriction><saml:Audience>%[11]s</saml:Audience></saml:AudienceRestriction>
+    </saml:Conditions>
+    <saml:AuthnStatement AuthnInstant="%[2]s"%[12]s>
+      <saml:AuthnContext><saml:AuthnContextClassRef>urn:oasis:names:tc:SAML:2.0:ac:classes:PasswordProtectedTransport</saml:AuthnContextClassRef></saml:AuthnContext>
+    </saml:AuthnStatement>
+    <saml:AttributeStatement>%[13]s</saml:AttributeStatement>
+  </saml:Assertion>
+</samlp:Response>`,
+		randomID(t), timeFormat(time.Now()), escape(r.Destination), escape(r.InResponseTo), escape(r.Issuer),
+		escape(r.StatusCode), escape(r.NameID), escape(r.Recipient), timeFormat(r.NotOnOrAfter),
+		timeFormat(r.NotBefore), escape(r.Audience), session, attributes.String(),
+	)
+
+	doc := etree.NewDocument()
+	require.NoError(t, doc.ReadFromString(document))
+	root := doc.Root()
+	if r.SignAssertion {
+		assertion := root.SelectElement("Assertion")
+		namespaces, err := etreeutils.NSBuildParentContext(assertion)
+		require.NoError(t, err)
+		detached, err := etreeutils.NSDetatch(namespaces, assertion)
+		require.NoError(t, err)
+		index := assertion.Index()
+		root.RemoveChildAt(index)
+		root.InsertChildAt(index, idp.sign(t, detached))
+	}
+	if r.SignResponse {
+		doc.SetRoot(idp.sign(t, root))
+	}
+	doc.WriteSettings.CanonicalEndTags = true
+	encoded, err := doc.WriteToBytes()
+	require.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(append([]byte(xml.Header), encoded...))
+}
+
+// sign returns a copy of the element with an enveloped signature inserted after its Issuer, where the SAML schema
+// requires it to be.
+func (idp *IdentityProvider) sign(t *testing.T, element *etree.Element) *etree.Element {
+	t.Helper()
+
+	signingContext, err := dsig.NewSigningContext(idp.Key, [][]byte{idp.Cert.Raw})
+	require.NoError(t, err)
+	signingContext.Canonicalizer = dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+	signed := element.Copy()
+	signature, err := signingContext.ConstructSignature(signed, true)
+	require.NoError(t, err)
+	signed.InsertChildAt(signed.SelectElement("Issuer").Index()+1, signature)
+	return signed
+}
+
+func randomID(t *testing.T) string {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	require.NoError(t, err)
+	return fmt.Sprintf("%x", b)
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
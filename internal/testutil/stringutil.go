@@ -0,0 +1,13 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package testutil
+
+// AddPrefixToEach returns a new slice which contains each string from the given slice with the prefix prepended.
+func AddPrefixToEach(prefix string, addToEach []string) []string {
+	result := make([]string, len(addToEach))
+	for i, s := range addToEach {
+		result[i] = prefix + s
+	}
+	return result
+}
@@ -0,0 +1,293 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package upstreamgithub implements an abstraction of upstream GitHub provider interactions, using the OAuth 2.0
+// web application flow to log in users and the GitHub REST API to look up their identities and memberships.
+package upstreamgithub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"go.pinniped.dev/generated/latest/apis/supervisor/idp/v1alpha1"
+	oidcapi "go.pinniped.dev/generated/latest/apis/supervisor/oidc"
+	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/plog"
+)
+
+const (
+	// PublicGitHubHost is the host of the public GitHub service, which serves its API from a separate host.
+	PublicGitHubHost = "github.com"
+
+	publicGitHubAPIBaseURL = "https://api.github.com"
+
+	// apiVersion is the version of the GitHub REST API used by the Supervisor.
+	apiVersion = "2022-11-28"
+
+	// pageSize is the number of items requested per page from the paginated list endpoints of the GitHub REST API,
+	// which is the largest page size that GitHub allows.
+	pageSize = 100
+
+	// maxPages limits the number of pages read from a paginated list endpoint, to protect against a misbehaving server.
+	maxPages = 100
+
+	// maxResponseBytes is the largest response body which will be read from the GitHub REST API.
+	maxResponseBytes = 10 << 20
+)
+
+// Scopes are the OAuth scopes which are requested from GitHub during login. They allow reading the user's profile,
+// organization memberships, and team memberships.
+var Scopes = []string{"read:user", "read:org"} //nolint:gochecknoglobals // please treat this as a constant
+
+// Endpoints returns the OAuth 2.0 endpoints and the base URL of the REST API of the GitHub server at the given host.
+// GitHub Enterprise Server serves its REST API from the "/api/v3" path of its own host.
+func Endpoints(host string) (oauth2.Endpoint, string) {
+	endpoint := oauth2.Endpoint{
+		AuthURL:   fmt.Sprintf("https://%s/login/oauth/authorize", host),
+		TokenURL:  fmt.Sprintf("https://%s/login/oauth/access_token", host),
+		AuthStyle: oauth2.AuthStyleInParams,
+	}
+	if strings.EqualFold(host, PublicGitHubHost) {
+		return endpoint, publicGitHubAPIBaseURL
+	}
+	return endpoint, fmt.Sprintf("https://%s/api/v3", host)
+}
+
+// ProviderConfig holds the active configuration of an upstream GitHub identity provider.
+type ProviderConfig struct {
+	Name               string
+	ResourceUID        types.UID
+	Host               string
+	APIBaseURL         string
+	UsernameAttribute  v1alpha1.GitHubUsernameAttribute
+	GroupNameAttribute v1alpha1.GitHubGroupNameAttribute
+
+	// AllowedOrganizations are the logins of the organizations whose members may log in. When empty, all GitHub
+	// users may log in.
+	AllowedOrganizations []string
+
+	OAuth2Config *oauth2.Config
+	HTTPClient   *http.Client
+}
+
+var _ provider.UpstreamGitHubIdentityProviderI = (*ProviderConfig)(nil)
+
+func (p *ProviderConfig) GetName() string {
+	return p.Name
+}
+
+func (p *ProviderConfig) GetResourceUID() types.UID {
+	return p.ResourceUID
+}
+
+func (p *ProviderConfig) GetClientID() string {
+	return p.OAuth2Config.ClientID
+}
+
+func (p *ProviderConfig) GetAuthorizationURL() string {
+	return p.OAuth2Config.Endpoint.AuthURL
+}
+
+func (p *ProviderConfig) GetScopes() []string {
+	return p.OAuth2Config.Scopes
+}
+
+func (p *ProviderConfig) ExchangeAuthcode(ctx context.Context, authcode string, redirectURI string) (string, error) {
+	tok, err := p.OAuth2Config.Exchange(
+		context.WithValue(ctx, oauth2.HTTPClient, p.HTTPClient),
+		authcode,
+		oauth2.SetAuthURLParam("redirect_uri", redirectURI),
+	)
+	if err != nil {
+		return "", err
+	}
+	return tok.AccessToken, nil
+}
+
+type userResponse struct {
+	Login string `json:"login"`
+	ID    int64  `json:"id"`
+}
+
+type organizationResponse struct {
+	Login string `json:"login"`
+}
+
+type teamResponse struct {
+	Name         string               `json:"name"`
+	Slug         string               `json:"slug"`
+	Organization organizationResponse `json:"organization"`
+}
+
+func (p *ProviderConfig) GetUser(ctx context.Context, accessToken string) (*provider.GitHubUser, error) {
+	var user userResponse
+	if err := p.get(ctx, accessToken, "/user", &user); err != nil {
+		return nil, err
+	}
+	if user.Login == "" || user.ID == 0 {
+		return nil, fmt.Errorf("GitHub user response is missing the login or id of the user")
+	}
+	userID := strconv.FormatInt(user.ID, 10)
+
+	allowedOrganizations := sets.New[string]()
+	for _, org := range p.AllowedOrganizations {
+		allowedOrganizations.Insert(strings.ToLower(org))
+	}
+
+	if allowedOrganizations.Len() > 0 {
+		orgs, err := list[organizationResponse](ctx, p, accessToken, "/user/orgs")
+		if err != nil {
+			return nil, err
+		}
+		allowed := false
+		for _, org := range orgs {
+			if allowedOrganizations.Has(strings.ToLower(org.Login)) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			plog.Debug("GitHub user is not a member of any allowed organization",
+				"upstreamName", p.Name, "login", user.Login, "id", userID)
+			return nil, provider.ErrGitHubUserNotInAllowedOrganizations
+		}
+	}
+
+	teams, err := list[teamResponse](ctx, p, accessToken, "/user/teams")
+	if err != nil {
+		return nil, err
+	}
+	groups := []string{}
+	for _, team := range teams {
+		if allowedOrganizations.Len() > 0 && !allowedOrganizations.Has(strings.ToLower(team.Organization.Login)) {
+			continue
+		}
+		teamName := team.Slug
+		if p.GroupNameAttribute == v1alpha1.GitHubUseTeamNameForGroupName {
+			teamName = team.Name
+		}
+		groups = append(groups, team.Organization.Login+"/"+teamName)
+	}
+
+	var username string
+	switch p.UsernameAttribute {
+	case v1alpha1.GitHubUsernameID:
+		username = userID
+	case v1alpha1.GitHubUsernameLogin:
+		username = user.Login
+	default:
+		username = user.Login + ":" + userID
+	}
+
+	return &provider.GitHubUser{
+		Username: username,
+		Groups:   groups,
+		// The numeric ID of a user never changes, unlike their login, so it is used to build the subject.
+		DownstreamSubject: fmt.Sprintf("https://%s?%s=%s", p.Host, oidcapi.IDTokenClaimSubject, url.QueryEscape(userID)),
+	}, nil
+}
+
+// list reads the items of all pages of the paginated list endpoint at the given path.
+func list[T any](ctx context.Context, p *ProviderConfig, accessToken string, path string) ([]T, error) {
+	var all []T
+	nextURL := fmt.Sprintf("%s%s?per_page=%d", p.APIBaseURL, path, pageSize)
+	for page := 0; nextURL != ""; page++ {
+		if page == maxPages {
+			return nil, fmt.Errorf("too many pages in GitHub API response for %q", path)
+		}
+		var items []T
+		var err error
+		nextURL, err = p.do(ctx, accessToken, nextURL, &items)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, items...)
+	}
+	return all, nil
+}
+
+func (p *ProviderConfig) get(ctx context.Context, accessToken string, path string, result interface{}) error {
+	_, err := p.do(ctx, accessToken, p.APIBaseURL+path, result)
+	return err
+}
+
+// do performs a GET request to the given URL of the GitHub REST API and decodes the JSON response into result.
+// It returns the URL of the next page of results, if the response has one.
+func (p *ProviderConfig) do(ctx context.Context, accessToken string, requestURL string, result interface{}) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("X-GitHub-Api-Version", apiVersion)
+
+	resp, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error calling GitHub API: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected response status %q from GitHub API for %q", resp.Status, req.URL.Path)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return "", fmt.Errorf("error reading GitHub API response: %w", err)
+	}
+	if err := json.Unmarshal(body, result); err != nil {
+		return "", fmt.Errorf("error decoding GitHub API response for %q: %w", req.URL.Path, err)
+	}
+
+	next := nextPageURL(resp.Header.Get("Link"))
+	if next != "" && !p.isAPIURL(next) {
+		// The access token is sent with every request, so it must never be sent anywhere else than the GitHub API.
+		return "", fmt.Errorf("GitHub API response for %q has a next page link which is not on the GitHub API host", req.URL.Path)
+	}
+	return next, nil
+}
+
+// isAPIURL returns true when the URL has the same scheme and host as the APIBaseURL.
+func (p *ProviderConfig) isAPIURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	apiBaseURL, err := url.Parse(p.APIBaseURL)
+	if err != nil {
+		return false
+	}
+	return u.Scheme == apiBaseURL.Scheme && u.Host == apiBaseURL.Host && u.User == nil
+}
+
+// nextPageURL returns the URL with rel="next" from the value of a Link header, or empty string when there is none.
+// See https://docs.github.com/en/rest/using-the-rest-api/using-pagination-in-the-rest-api.
+func nextPageURL(linkHeader string) string {
+	for _, link := range strings.Split(linkHeader, ",") {
+		parts := strings.Split(link, ";")
+		if len(parts) < 2 {
+			continue
+		}
+		target := strings.TrimSpace(parts[0])
+		if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			continue
+		}
+		for _, param := range parts[1:] {
+			if strings.TrimSpace(param) == `rel="next"` {
+				return strings.TrimSuffix(strings.TrimPrefix(target, "<"), ">")
+			}
+		}
+	}
+	return ""
+}
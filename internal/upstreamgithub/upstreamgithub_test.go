@@ -0,0 +1,285 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package upstreamgithub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+
+	"go.pinniped.dev/generated/latest/apis/supervisor/idp/v1alpha1"
+	"go.pinniped.dev/internal/oidc/provider"
+)
+
+const (
+	testAccessToken = "some-access-token"
+	testAuthcode    = "some-authcode"
+	testRedirectURI = "https://issuer.example.com/callback"
+)
+
+type fakeTeam struct {
+	org, name, slug string
+}
+
+// fakeGitHub is a fake of the parts of the GitHub REST API and OAuth 2.0 endpoints used by the Supervisor,
+// which serves the REST API at "/api/v3", like GitHub Enterprise Server does.
+type fakeGitHub struct {
+	login      string
+	id         int64
+	orgs       []string
+	teams      []fakeTeam
+	statusCode int
+
+	// nextPageHost is the host of the next page links, when it should not be the host of the API.
+	nextPageHost string
+}
+
+func (f *fakeGitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/login/oauth/access_token" {
+		if r.Method != http.MethodPost || r.FormValue("code") != testAuthcode || r.FormValue("client_id") != "some-client-id" ||
+			r.FormValue("client_secret") != "some-client-secret" || r.FormValue("redirect_uri") != testRedirectURI {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = fmt.Fprint(w, `{"error":"bad_verification_code"}`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"access_token":%q,"token_type":"bearer","scope":"read:org,read:user"}`, testAccessToken)
+		return
+	}
+
+	if r.Header.Get("Authorization") != "Bearer "+testAccessToken || r.Header.Get("X-GitHub-Api-Version") != apiVersion {
+		http.Error(w, "bad credentials", http.StatusUnauthorized)
+		return
+	}
+	if f.statusCode != 0 {
+		http.Error(w, "fake error", f.statusCode)
+		return
+	}
+
+	var items []interface{}
+	switch r.URL.Path {
+	case "/api/v3/user":
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"login": f.login, "id": f.id})
+		return
+	case "/api/v3/user/orgs":
+		for _, org := range f.orgs {
+			items = append(items, map[string]interface{}{"login": org})
+		}
+	case "/api/v3/user/teams":
+		for _, team := range f.teams {
+			items = append(items, map[string]interface{}{
+				"name": team.name, "slug": team.slug, "organization": map[string]interface{}{"login": team.org},
+			})
+		}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	// Serve one item per page, to exercise pagination.
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page == 0 {
+		page = 1
+	}
+	if page < len(items) {
+		nextHost := r.Host
+		if f.nextPageHost != "" {
+			nextHost = f.nextPageHost
+		}
+		next := url.URL{Scheme: "https", Host: nextHost, Path: r.URL.Path, RawQuery: fmt.Sprintf("per_page=1&page=%d", page+1)}
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next", <https://example.com/first>; rel="first"`, next.String()))
+	}
+	pageItems := []interface{}{}
+	if page <= len(items) {
+		pageItems = items[page-1 : page]
+	}
+	_ = json.NewEncoder(w).Encode(pageItems)
+}
+
+func newTestProvider(t *testing.T, fake *fakeGitHub) *ProviderConfig {
+	t.Helper()
+	server := httptest.NewTLSServer(fake)
+	t.Cleanup(server.Close)
+
+	host := server.Listener.Addr().String()
+	endpoint, apiBaseURL := Endpoints(host)
+	return &ProviderConfig{
+		Name:       "some-github-idp",
+		Host:       host,
+		APIBaseURL: apiBaseURL,
+		OAuth2Config: &oauth2.Config{
+			ClientID:     "some-client-id",
+			ClientSecret: "some-client-secret",
+			Endpoint:     endpoint,
+			Scopes:       Scopes,
+		},
+		HTTPClient: server.Client(),
+	}
+}
+
+func TestEndpoints(t *testing.T) {
+	endpoint, apiBaseURL := Endpoints("github.com")
+	require.Equal(t, "https://github.com/login/oauth/authorize", endpoint.AuthURL)
+	require.Equal(t, "https://github.com/login/oauth/access_token", endpoint.TokenURL)
+	require.Equal(t, "https://api.github.com", apiBaseURL)
+
+	endpoint, apiBaseURL = Endpoints("github.example.com:8443")
+	require.Equal(t, "https://github.example.com:8443/login/oauth/authorize", endpoint.AuthURL)
+	require.Equal(t, "https://github.example.com:8443/login/oauth/access_token", endpoint.TokenURL)
+	require.Equal(t, "https://github.example.com:8443/api/v3", apiBaseURL)
+}
+
+func TestExchangeAuthcode(t *testing.T) {
+	p := newTestProvider(t, &fakeGitHub{})
+
+	accessToken, err := p.ExchangeAuthcode(context.Background(), testAuthcode, testRedirectURI)
+	require.NoError(t, err)
+	require.Equal(t, testAccessToken, accessToken)
+
+	_, err = p.ExchangeAuthcode(context.Background(), "wrong-authcode", testRedirectURI)
+	// GitHub responds to a bad authcode with an error in a successful response.
+	require.EqualError(t, err, "oauth2: server response missing access_token")
+}
+
+func TestGetUser(t *testing.T) {
+	happyFake := func() *fakeGitHub {
+		return &fakeGitHub{
+			login: "octocat",
+			id:    1234,
+			orgs:  []string{"Other-Org", "My-Org"},
+			teams: []fakeTeam{
+				{org: "My-Org", name: "Team One", slug: "team-one"},
+				{org: "Other-Org", name: "Team Two", slug: "team-two"},
+				{org: "My-Org", name: "Team Three", slug: "team-three"},
+			},
+		}
+	}
+
+	tests := []struct {
+		name                 string
+		fake                 *fakeGitHub
+		accessToken          string
+		usernameAttribute    v1alpha1.GitHubUsernameAttribute
+		groupNameAttribute   v1alpha1.GitHubGroupNameAttribute
+		allowedOrganizations []string
+		wantUsername         string
+		wantGroups           []string
+		wantErr              string
+		wantErrIs            error
+	}{
+		{
+			name:               "all users allowed, with default claims",
+			fake:               happyFake(),
+			usernameAttribute:  v1alpha1.GitHubUsernameLoginAndID,
+			groupNameAttribute: v1alpha1.GitHubUseTeamSlugForGroupName,
+			wantUsername:       "octocat:1234",
+			wantGroups:         []string{"My-Org/team-one", "Other-Org/team-two", "My-Org/team-three"},
+		},
+		{
+			name:               "username from id and groups from team names",
+			fake:               happyFake(),
+			usernameAttribute:  v1alpha1.GitHubUsernameID,
+			groupNameAttribute: v1alpha1.GitHubUseTeamNameForGroupName,
+			wantUsername:       "1234",
+			wantGroups:         []string{"My-Org/Team One", "Other-Org/Team Two", "My-Org/Team Three"},
+		},
+		{
+			name:                 "username from login, with allowed organizations compared case-insensitively",
+			fake:                 happyFake(),
+			usernameAttribute:    v1alpha1.GitHubUsernameLogin,
+			groupNameAttribute:   v1alpha1.GitHubUseTeamSlugForGroupName,
+			allowedOrganizations: []string{"my-org", "some-other-org"},
+			wantUsername:         "octocat",
+			wantGroups:           []string{"My-Org/team-one", "My-Org/team-three"},
+		},
+		{
+			name:                 "user without teams",
+			fake:                 &fakeGitHub{login: "octocat", id: 1234, orgs: []string{"My-Org"}},
+			usernameAttribute:    v1alpha1.GitHubUsernameLogin,
+			allowedOrganizations: []string{"My-Org"},
+			wantUsername:         "octocat",
+			wantGroups:           []string{},
+		},
+		{
+			name:                 "user not in any allowed organization",
+			fake:                 happyFake(),
+			allowedOrganizations: []string{"some-other-org"},
+			wantErrIs:            provider.ErrGitHubUserNotInAllowedOrganizations,
+		},
+		{
+			name:        "access token was revoked",
+			fake:        happyFake(),
+			accessToken: "revoked-access-token",
+			wantErr:     `unexpected response status "401 Unauthorized" from GitHub API for "/api/v3/user"`,
+		},
+		{
+			name: "error from the API",
+			fake: func() *fakeGitHub {
+				f := happyFake()
+				f.statusCode = http.StatusInternalServerError
+				return f
+			}(),
+			wantErr: `unexpected response status "500 Internal Server Error" from GitHub API for "/api/v3/user"`,
+		},
+		{
+			name: "next page link to another host",
+			fake: func() *fakeGitHub {
+				f := happyFake()
+				f.nextPageHost = "attacker.example.com"
+				return f
+			}(),
+			wantErr: `GitHub API response for "/api/v3/user/teams" has a next page link which is not on the GitHub API host`,
+		},
+		{
+			name:    "user response without an id",
+			fake:    &fakeGitHub{login: "octocat"},
+			wantErr: "GitHub user response is missing the login or id of the user",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProvider(t, tt.fake)
+			p.UsernameAttribute = tt.usernameAttribute
+			p.GroupNameAttribute = tt.groupNameAttribute
+			p.AllowedOrganizations = tt.allowedOrganizations
+
+			accessToken := testAccessToken
+			if tt.accessToken != "" {
+				accessToken = tt.accessToken
+			}
+
+			user, err := p.GetUser(context.Background(), accessToken)
+			switch {
+			case tt.wantErrIs != nil:
+				require.ErrorIs(t, err, tt.wantErrIs)
+				require.Nil(t, user)
+			case tt.wantErr != "":
+				require.EqualError(t, err, tt.wantErr)
+				require.Nil(t, user)
+			default:
+				require.NoError(t, err)
+				require.Equal(t, tt.wantUsername, user.Username)
+				require.Equal(t, tt.wantGroups, user.Groups)
+				require.Equal(t, "https://"+p.Host+"?sub=1234", user.DownstreamSubject)
+			}
+		})
+	}
+}
+
+func TestNextPageURL(t *testing.T) {
+	require.Equal(t, "https://api.github.com/user/teams?page=2",
+		nextPageURL(`<https://api.github.com/user/teams?page=2>; rel="next", <https://api.github.com/user/teams?page=5>; rel="last"`))
+	require.Equal(t, "https://api.github.com/user/teams?page=2",
+		nextPageURL(`<https://api.github.com/user/teams?page=1>; rel="prev", <https://api.github.com/user/teams?page=2>; rel="next"`))
+	require.Empty(t, nextPageURL(`<https://api.github.com/user/teams?page=1>; rel="prev"`))
+	require.Empty(t, nextPageURL(""))
+}
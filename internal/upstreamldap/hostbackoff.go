@@ -0,0 +1,94 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package upstreamldap
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// initialHostBackoff is how long a host is skipped after it first fails to accept a connection.
+	initialHostBackoff = 5 * time.Second
+
+	// maxHostBackoff is the longest that a host will be skipped after repeatedly failing to accept a connection.
+	maxHostBackoff = 5 * time.Minute
+)
+
+// hostBackoff remembers which hosts recently failed to accept a connection, so that dialing can prefer the
+// other hosts until the failed hosts have backed off. Each consecutive failure of a host doubles how long it is
+// skipped. It is safe for concurrent use.
+type hostBackoff struct {
+	mu    sync.Mutex
+	now   func() time.Time
+	hosts map[string]*hostBackoffState
+}
+
+type hostBackoffState struct {
+	failures   int
+	retryAfter time.Time
+}
+
+func newHostBackoff() *hostBackoff {
+	return &hostBackoff{now: time.Now, hosts: map[string]*hostBackoffState{}}
+}
+
+// order returns the hosts in the order that they should be dialed. Hosts which are not backing off keep their
+// configured order, and are followed by the hosts which are backing off, starting with the one which will be ready
+// to retry soonest. Hosts which are backing off are never dropped, so that dialing can still succeed when every
+// host has recently failed.
+func (b *hostBackoff) order(hosts []string) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	available := make([]string, 0, len(hosts))
+	backingOff := make([]string, 0)
+	for _, host := range hosts {
+		if state, ok := b.hosts[host]; ok && now.Before(state.retryAfter) {
+			backingOff = append(backingOff, host)
+			continue
+		}
+		available = append(available, host)
+	}
+
+	sort.SliceStable(backingOff, func(i, j int) bool {
+		return b.hosts[backingOff[i]].retryAfter.Before(b.hosts[backingOff[j]].retryAfter)
+	})
+
+	return append(available, backingOff...)
+}
+
+// failed records that the host failed to accept a connection, and returns how long it will be skipped.
+func (b *hostBackoff) failed(host string) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state, ok := b.hosts[host]
+	if !ok {
+		state = &hostBackoffState{}
+		b.hosts[host] = state
+	}
+	state.failures++
+
+	backoff := initialHostBackoff
+	for i := 1; i < state.failures && backoff < maxHostBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxHostBackoff {
+		backoff = maxHostBackoff
+	}
+
+	state.retryAfter = b.now().Add(backoff)
+	return backoff
+}
+
+// succeeded records that the host accepted a connection, which ends any back-off for that host.
+func (b *hostBackoff) succeeded(host string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.hosts, host)
+}
@@ -0,0 +1,99 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package upstreamldap
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	"go.pinniped.dev/internal/endpointaddr"
+	"go.pinniped.dev/internal/mocks/mockldapconn"
+)
+
+func TestHostBackoff(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	b := newHostBackoff()
+	b.now = func() time.Time { return now }
+
+	hosts := []string{"host1", "host2", "host3"}
+	require.Equal(t, hosts, b.order(hosts))
+
+	// Each consecutive failure doubles the back-off.
+	require.Equal(t, 5*time.Second, b.failed("host1"))
+	require.Equal(t, 10*time.Second, b.failed("host1"))
+	require.Equal(t, []string{"host2", "host3", "host1"}, b.order(hosts))
+
+	// Hosts which are backing off are tried last, starting with the one which will be ready to retry soonest.
+	require.Equal(t, 5*time.Second, b.failed("host2"))
+	require.Equal(t, []string{"host3", "host2", "host1"}, b.order(hosts))
+
+	// After backing off, a host is tried in its configured order again.
+	now = now.Add(5 * time.Second)
+	require.Equal(t, []string{"host2", "host3", "host1"}, b.order(hosts))
+	now = now.Add(5 * time.Second)
+	require.Equal(t, hosts, b.order(hosts))
+
+	// A success ends the back-off, so the next failure starts over.
+	b.succeeded("host1")
+	require.Equal(t, 5*time.Second, b.failed("host1"))
+
+	// The back-off is capped.
+	for i := 0; i < 20; i++ {
+		b.failed("host3")
+	}
+	require.Equal(t, 5*time.Minute, b.failed("host3"))
+}
+
+func TestDialFailsOverToTheNextHost(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	t.Cleanup(ctrl.Finish)
+
+	conn := mockldapconn.NewMockConn(ctrl)
+	conn.EXPECT().Close().Times(3)
+
+	host1Down := true
+	var dialedHosts []string
+	p := New(ProviderConfig{
+		Name:               "some-provider-name",
+		Host:               "ldap1.example.com:8443",
+		Hosts:              []string{"ldap1.example.com:8443", "ldap2.example.com:8443"},
+		ConnectionProtocol: TLS,
+		Dialer: LDAPDialerFunc(func(ctx context.Context, addr endpointaddr.HostPort) (Conn, error) {
+			dialedHosts = append(dialedHosts, addr.Endpoint())
+			if host1Down && addr.Host == "ldap1.example.com" {
+				return nil, errors.New("some dial error")
+			}
+			return conn, nil
+		}),
+	})
+	now := time.Now()
+	p.backoff.now = func() time.Time { return now }
+
+	// The first host fails, so the second host is used.
+	c, err := p.dial(context.Background())
+	require.NoError(t, err)
+	c.Close()
+	require.Equal(t, []string{"ldap1.example.com:8443", "ldap2.example.com:8443"}, dialedHosts)
+
+	// The first host is skipped while it is backing off, even though it has recovered.
+	dialedHosts = nil
+	host1Down = false
+	c, err = p.dial(context.Background())
+	require.NoError(t, err)
+	c.Close()
+	require.Equal(t, []string{"ldap2.example.com:8443"}, dialedHosts)
+
+	// Once it has backed off, the first host is preferred again.
+	dialedHosts = nil
+	now = now.Add(initialHostBackoff)
+	c, err = p.dial(context.Background())
+	require.NoError(t, err)
+	c.Close()
+	require.Equal(t, []string{"ldap1.example.com:8443"}, dialedHosts)
+}
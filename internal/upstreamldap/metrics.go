@@ -0,0 +1,102 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package upstreamldap
+
+import (
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+const (
+	ldapOperationBind   = "bind"
+	ldapOperationSearch = "search"
+
+	ldapOutcomeSuccess = "success"
+	ldapOutcomeFailure = "failure"
+
+	ldapConnectionStateIdle  = "idle"
+	ldapConnectionStateInUse = "in_use"
+)
+
+//nolint:gochecknoglobals // metrics are registered once per process
+var ldapOperationDuration = metrics.NewHistogramVec(&metrics.HistogramOpts{
+	Namespace:      "pinniped",
+	Subsystem:      "supervisor",
+	Name:           "ldap_operation_duration_seconds",
+	Help:           "Time taken by bind and search operations against upstream LDAP and Active Directory servers.",
+	Buckets:        metrics.ExponentialBuckets(0.001, 2, 14), // 1ms to about 8s
+	StabilityLevel: metrics.ALPHA,
+}, []string{"upstream_name", "operation", "outcome"})
+
+//nolint:gochecknoglobals // metrics are registered once per process
+var ldapConnectionPoolConnections = metrics.NewGaugeVec(&metrics.GaugeOpts{
+	Namespace:      "pinniped",
+	Subsystem:      "supervisor",
+	Name:           "ldap_connection_pool_connections",
+	Help:           "Number of open pooled connections to upstream LDAP and Active Directory servers, by state.",
+	StabilityLevel: metrics.ALPHA,
+}, []string{"upstream_name", "state"})
+
+//nolint:gochecknoglobals // metrics are registered once per process
+var ldapConnectionPoolWaitDuration = metrics.NewHistogramVec(&metrics.HistogramOpts{
+	Namespace:      "pinniped",
+	Subsystem:      "supervisor",
+	Name:           "ldap_connection_pool_wait_duration_seconds",
+	Help:           "Time spent waiting for a connection to upstream LDAP and Active Directory servers because the connection pool was saturated.",
+	Buckets:        metrics.ExponentialBuckets(0.001, 2, 14), // 1ms to about 8s
+	StabilityLevel: metrics.ALPHA,
+}, []string{"upstream_name"})
+
+//nolint:gochecknoinits
+func init() {
+	legacyregistry.MustRegister(ldapOperationDuration)
+	legacyregistry.MustRegister(ldapConnectionPoolConnections)
+	legacyregistry.MustRegister(ldapConnectionPoolWaitDuration)
+}
+
+// metricsConn wraps a Conn to record the latency of each bind and search operation.
+type metricsConn struct {
+	Conn
+	upstreamName string
+}
+
+var _ Conn = &metricsConn{}
+
+func (c *metricsConn) Bind(username, password string) error {
+	start := time.Now()
+	err := c.Conn.Bind(username, password)
+	c.observe(ldapOperationBind, start, err)
+	return err
+}
+
+func (c *metricsConn) Search(searchRequest *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	start := time.Now()
+	result, err := c.Conn.Search(searchRequest)
+	c.observe(ldapOperationSearch, start, err)
+	return result, err
+}
+
+func (c *metricsConn) SearchWithPaging(searchRequest *ldap.SearchRequest, pagingSize uint32) (*ldap.SearchResult, error) {
+	start := time.Now()
+	result, err := c.Conn.SearchWithPaging(searchRequest, pagingSize)
+	c.observe(ldapOperationSearch, start, err)
+	return result, err
+}
+
+// IsClosing reports whether the wrapped connection is closing, when the wrapped connection can tell.
+func (c *metricsConn) IsClosing() bool {
+	closer, ok := c.Conn.(interface{ IsClosing() bool })
+	return ok && closer.IsClosing()
+}
+
+func (c *metricsConn) observe(operation string, start time.Time, err error) {
+	outcome := ldapOutcomeSuccess
+	if err != nil {
+		outcome = ldapOutcomeFailure
+	}
+	ldapOperationDuration.WithLabelValues(c.upstreamName, operation, outcome).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,56 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package upstreamldap
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"k8s.io/component-base/metrics/testutil"
+
+	"go.pinniped.dev/internal/mocks/mockldapconn"
+)
+
+func TestMetricsConn(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	t.Cleanup(ctrl.Finish)
+
+	mockConn := mockldapconn.NewMockConn(ctrl)
+	searchRequest := &ldap.SearchRequest{BaseDN: "some-base-dn"}
+	searchResult := &ldap.SearchResult{}
+	mockConn.EXPECT().Bind("some-user", "some-password").Return(nil).Times(1)
+	mockConn.EXPECT().Bind("some-user", "wrong-password").Return(errors.New("some bind error")).Times(1)
+	mockConn.EXPECT().Search(searchRequest).Return(searchResult, nil).Times(1)
+	mockConn.EXPECT().SearchWithPaging(searchRequest, uint32(42)).Return(nil, errors.New("some search error")).Times(1)
+
+	// Use a unique upstream name so that other tests in this package cannot influence the observed metrics.
+	conn := &metricsConn{Conn: mockConn, upstreamName: "test-metrics-conn-upstream"}
+
+	require.NoError(t, conn.Bind("some-user", "some-password"))
+	require.EqualError(t, conn.Bind("some-user", "wrong-password"), "some bind error")
+	result, err := conn.Search(searchRequest)
+	require.NoError(t, err)
+	require.Same(t, searchResult, result)
+	result, err = conn.SearchWithPaging(searchRequest, 42)
+	require.EqualError(t, err, "some search error")
+	require.Nil(t, result)
+
+	for _, want := range []struct {
+		operation, outcome string
+	}{
+		{ldapOperationBind, ldapOutcomeSuccess},
+		{ldapOperationBind, ldapOutcomeFailure},
+		{ldapOperationSearch, ldapOutcomeSuccess},
+		{ldapOperationSearch, ldapOutcomeFailure},
+	} {
+		count, err := testutil.GetHistogramMetricCount(
+			ldapOperationDuration.WithLabelValues("test-metrics-conn-upstream", want.operation, want.outcome),
+		)
+		require.NoError(t, err)
+		require.Equal(t, uint64(1), count, "operation=%s outcome=%s", want.operation, want.outcome)
+	}
+}
@@ -0,0 +1,281 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package upstreamldap
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"go.pinniped.dev/internal/plog"
+)
+
+const (
+	// defaultMaxPooledConnections is the most connections that will be open at once to each upstream for
+	// authentications and refreshes. Callers wait for a connection to be released when all of them are in use.
+	defaultMaxPooledConnections = 10
+
+	// defaultPooledConnectionIdleTimeout is how long an unused connection is kept open before it is closed.
+	// This should be shorter than the idle timeouts of typical LDAP servers, e.g. 15 minutes for Active Directory.
+	defaultPooledConnectionIdleTimeout = 90 * time.Second
+
+	// defaultPooledConnectionHealthCheckInterval is how long a connection may be idle before it is bound again
+	// as the service account when it is taken from the pool, to make sure that it is still usable.
+	defaultPooledConnectionHealthCheckInterval = 30 * time.Second
+)
+
+// connPool is a bounded pool of connections which are bound as the service account. Connections which were
+// bound as another user, e.g. to check an end user's password, are bound again as the service account before
+// they are reused. Connections which have been idle for too long are closed, even when the pool is no longer
+// being used, so that a pool which was abandoned does not keep its connections open. It is safe for concurrent use.
+type connPool struct {
+	upstreamName string
+	bindUsername string
+	bindPassword string
+
+	dial                func(ctx context.Context) (Conn, error)
+	maxConns            int
+	idleTimeout         time.Duration
+	healthCheckInterval time.Duration
+	now                 func() time.Time
+
+	// slots holds one value for each connection which is in use.
+	slots chan struct{}
+
+	mu      sync.Mutex
+	idle    []*pooledConn // ordered from least to most recently used
+	waiting int
+	reaper  *time.Timer
+	closed  bool
+}
+
+func newConnPool(upstreamName, bindUsername, bindPassword string, dial func(ctx context.Context) (Conn, error)) *connPool {
+	return &connPool{
+		upstreamName:        upstreamName,
+		bindUsername:        bindUsername,
+		bindPassword:        bindPassword,
+		dial:                dial,
+		maxConns:            defaultMaxPooledConnections,
+		idleTimeout:         defaultPooledConnectionIdleTimeout,
+		healthCheckInterval: defaultPooledConnectionHealthCheckInterval,
+		now:                 time.Now,
+		slots:               make(chan struct{}, defaultMaxPooledConnections),
+	}
+}
+
+// get returns a connection from the pool, or dials a new connection when there are no idle connections.
+// Connections from the pool are already bound as the service account, while new connections are not bound
+// yet, which can be checked using boundAsServiceAccount. It waits for a connection to be released when the
+// pool is saturated. The connection must be returned to the pool using put.
+func (p *connPool) get(ctx context.Context) (*pooledConn, error) {
+	if err := p.acquireSlot(ctx); err != nil {
+		return nil, err
+	}
+
+	for {
+		conn := p.popIdle()
+		if conn == nil {
+			break
+		}
+		if err := p.checkHealth(conn); err != nil {
+			plog.DebugErr("closing unhealthy pooled LDAP connection", err, "upstreamName", p.upstreamName)
+			conn.Conn.Close()
+			ldapConnectionPoolConnections.WithLabelValues(p.upstreamName, ldapConnectionStateIdle).Dec()
+			continue
+		}
+		ldapConnectionPoolConnections.WithLabelValues(p.upstreamName, ldapConnectionStateIdle).Dec()
+		ldapConnectionPoolConnections.WithLabelValues(p.upstreamName, ldapConnectionStateInUse).Inc()
+		return conn, nil
+	}
+
+	conn, err := p.dial(ctx)
+	if err != nil {
+		<-p.slots
+		return nil, err
+	}
+	ldapConnectionPoolConnections.WithLabelValues(p.upstreamName, ldapConnectionStateInUse).Inc()
+	return &pooledConn{Conn: conn, pool: p}, nil
+}
+
+// put returns a connection to the pool, or closes it when it is no longer usable.
+func (p *connPool) put(conn *pooledConn) {
+	defer func() { <-p.slots }()
+	ldapConnectionPoolConnections.WithLabelValues(p.upstreamName, ldapConnectionStateInUse).Dec()
+
+	p.mu.Lock()
+	if conn.broken || p.closed {
+		p.mu.Unlock()
+		conn.Conn.Close()
+		return
+	}
+	conn.lastUsed = p.now()
+	p.idle = append(p.idle, conn)
+	if p.reaper == nil {
+		p.reaper = time.AfterFunc(p.idleTimeout, p.reap)
+	}
+	p.mu.Unlock()
+	ldapConnectionPoolConnections.WithLabelValues(p.upstreamName, ldapConnectionStateIdle).Inc()
+}
+
+// close closes the idle connections, and causes connections which are in use to be closed when they are returned.
+func (p *connPool) close() {
+	p.mu.Lock()
+	p.closed = true
+	idle := p.idle
+	p.idle = nil
+	if p.reaper != nil {
+		p.reaper.Stop()
+		p.reaper = nil
+	}
+	p.mu.Unlock()
+
+	p.closeIdle(idle)
+}
+
+func (p *connPool) acquireSlot(ctx context.Context) error {
+	select {
+	case p.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	p.mu.Lock()
+	p.waiting++
+	if p.waiting == 1 {
+		plog.Info("LDAP connection pool is saturated, waiting for a connection to be released",
+			"upstreamName", p.upstreamName, "maxConnections", p.maxConns)
+	}
+	p.mu.Unlock()
+
+	start := time.Now()
+	defer func() {
+		ldapConnectionPoolWaitDuration.WithLabelValues(p.upstreamName).Observe(time.Since(start).Seconds())
+		p.mu.Lock()
+		p.waiting--
+		p.mu.Unlock()
+	}()
+
+	select {
+	case p.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("error waiting for a connection from the saturated connection pool: %w", ctx.Err())
+	}
+}
+
+// popIdle removes and returns the most recently used idle connection which has not reached its idle timeout.
+// Connections which have reached their idle timeout are closed.
+func (p *connPool) popIdle() *pooledConn {
+	p.mu.Lock()
+	var expired []*pooledConn
+	var conn *pooledConn
+	now := p.now()
+	for len(p.idle) > 0 && conn == nil {
+		last := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+		if now.Sub(last.lastUsed) >= p.idleTimeout {
+			expired = append(expired, last)
+			continue
+		}
+		conn = last
+	}
+	p.mu.Unlock()
+
+	p.closeIdle(expired)
+	return conn
+}
+
+// checkHealth makes sure that an idle connection is still usable, binding it again as the service account
+// when it was bound as another user or when it has been idle for long enough to need a health check.
+func (p *connPool) checkHealth(conn *pooledConn) error {
+	if closer, ok := conn.Conn.(interface{ IsClosing() bool }); ok && closer.IsClosing() {
+		return fmt.Errorf("connection is closing")
+	}
+	if conn.boundAsServiceAccount && p.now().Sub(conn.lastUsed) < p.healthCheckInterval {
+		return nil
+	}
+	if err := conn.Conn.Bind(p.bindUsername, p.bindPassword); err != nil {
+		return fmt.Errorf(`error binding as %q: %w`, p.bindUsername, err)
+	}
+	conn.boundAsServiceAccount = true
+	return nil
+}
+
+// reap closes the idle connections which have reached their idle timeout, and schedules itself to run again
+// when the next idle connection will reach its idle timeout.
+func (p *connPool) reap() {
+	p.mu.Lock()
+	now := p.now()
+	var expired []*pooledConn
+	for len(p.idle) > 0 && now.Sub(p.idle[0].lastUsed) >= p.idleTimeout {
+		expired = append(expired, p.idle[0])
+		p.idle = p.idle[1:]
+	}
+	p.reaper = nil
+	if len(p.idle) > 0 && !p.closed {
+		p.reaper = time.AfterFunc(p.idle[0].lastUsed.Add(p.idleTimeout).Sub(now), p.reap)
+	}
+	p.mu.Unlock()
+
+	p.closeIdle(expired)
+}
+
+func (p *connPool) closeIdle(conns []*pooledConn) {
+	for _, conn := range conns {
+		conn.Conn.Close()
+		ldapConnectionPoolConnections.WithLabelValues(p.upstreamName, ldapConnectionStateIdle).Dec()
+	}
+}
+
+// pooledConn wraps a Conn which belongs to a connPool, keeping track of whether it is bound as the service
+// account and whether it is still usable.
+type pooledConn struct {
+	Conn
+	pool *connPool
+
+	boundAsServiceAccount bool
+	broken                bool
+	lastUsed              time.Time
+}
+
+var _ Conn = &pooledConn{}
+
+func (c *pooledConn) Bind(username, password string) error {
+	err := c.Conn.Bind(username, password)
+	isServiceAccount := username == c.pool.bindUsername && password == c.pool.bindPassword
+	c.boundAsServiceAccount = err == nil && isServiceAccount
+	if err != nil && (isServiceAccount || isNetworkError(err)) {
+		// There is no point in reusing a connection which cannot be bound as the service account.
+		c.broken = true
+	}
+	return err
+}
+
+func (c *pooledConn) Search(searchRequest *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	result, err := c.Conn.Search(searchRequest)
+	if isNetworkError(err) {
+		c.broken = true
+	}
+	return result, err
+}
+
+func (c *pooledConn) SearchWithPaging(searchRequest *ldap.SearchRequest, pagingSize uint32) (*ldap.SearchResult, error) {
+	result, err := c.Conn.SearchWithPaging(searchRequest, pagingSize)
+	if isNetworkError(err) {
+		c.broken = true
+	}
+	return result, err
+}
+
+// Close prevents the connection from being reused. The connection will be closed when it is returned to the pool.
+func (c *pooledConn) Close() {
+	c.broken = true
+}
+
+func isNetworkError(err error) bool {
+	return err != nil && ldap.IsErrorWithCode(err, ldap.ErrorNetwork)
+}
@@ -0,0 +1,281 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package upstreamldap
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"k8s.io/component-base/metrics/testutil"
+
+	"go.pinniped.dev/internal/mocks/mockldapconn"
+)
+
+func TestConnPool(t *testing.T) {
+	const (
+		bindUsername = "some-bind-username"
+		bindPassword = "some-bind-password"
+	)
+
+	searchRequest := &ldap.SearchRequest{BaseDN: "some-base-dn"}
+	networkErr := ldap.NewError(ldap.ErrorNetwork, errors.New("some network error"))
+
+	tests := []struct {
+		name string
+		run  func(t *testing.T, pool *connPool, clock *time.Time, newConn func() *mockldapconn.MockConn)
+	}{
+		{
+			name: "reuses a connection which is bound as the service account without binding again",
+			run: func(t *testing.T, pool *connPool, clock *time.Time, newConn func() *mockldapconn.MockConn) {
+				conn := newConn()
+				conn.EXPECT().Bind(bindUsername, bindPassword).Times(1)
+				conn.EXPECT().Search(searchRequest).Times(2)
+
+				for i := 0; i < 2; i++ {
+					pooled, err := pool.get(context.Background())
+					require.NoError(t, err)
+					require.Equal(t, i > 0, pooled.boundAsServiceAccount)
+					if !pooled.boundAsServiceAccount {
+						require.NoError(t, pooled.Bind(bindUsername, bindPassword))
+					}
+					_, err = pooled.Search(searchRequest)
+					require.NoError(t, err)
+					pool.put(pooled)
+					*clock = clock.Add(time.Second)
+				}
+
+				conn.EXPECT().Close().Times(1)
+			},
+		},
+		{
+			name: "binds as the service account again before reusing a connection which was bound as another user",
+			run: func(t *testing.T, pool *connPool, clock *time.Time, newConn func() *mockldapconn.MockConn) {
+				conn := newConn()
+				gomock.InOrder(
+					conn.EXPECT().Bind(bindUsername, bindPassword).Times(1),
+					conn.EXPECT().Bind("some-end-user", "some-end-user-password").Times(1),
+					conn.EXPECT().Bind(bindUsername, bindPassword).Times(1),
+				)
+
+				pooled, err := pool.get(context.Background())
+				require.NoError(t, err)
+				require.NoError(t, pooled.Bind(bindUsername, bindPassword))
+				require.NoError(t, pooled.Bind("some-end-user", "some-end-user-password"))
+				require.False(t, pooled.boundAsServiceAccount)
+				pool.put(pooled)
+
+				pooled, err = pool.get(context.Background())
+				require.NoError(t, err)
+				require.True(t, pooled.boundAsServiceAccount)
+				pool.put(pooled)
+
+				conn.EXPECT().Close().Times(1)
+			},
+		},
+		{
+			name: "health checks a connection which has been idle for a while, and dials a new connection when the health check fails",
+			run: func(t *testing.T, pool *connPool, clock *time.Time, newConn func() *mockldapconn.MockConn) {
+				conn1 := newConn()
+				conn1.EXPECT().Bind(bindUsername, bindPassword).Times(1)
+				conn1.EXPECT().Bind(bindUsername, bindPassword).Return(errors.New("some bind error")).Times(1)
+				conn1.EXPECT().Close().Times(1)
+				conn2 := newConn()
+
+				pooled, err := pool.get(context.Background())
+				require.NoError(t, err)
+				require.NoError(t, pooled.Bind(bindUsername, bindPassword))
+				pool.put(pooled)
+
+				*clock = clock.Add(pool.healthCheckInterval)
+
+				pooled, err = pool.get(context.Background())
+				require.NoError(t, err)
+				require.Same(t, conn2, pooled.Conn)
+				require.False(t, pooled.boundAsServiceAccount)
+				pool.put(pooled)
+
+				conn2.EXPECT().Close().Times(1)
+			},
+		},
+		{
+			name: "closes a connection which has reached its idle timeout instead of reusing it",
+			run: func(t *testing.T, pool *connPool, clock *time.Time, newConn func() *mockldapconn.MockConn) {
+				conn1 := newConn()
+				conn1.EXPECT().Close().Times(1)
+				conn2 := newConn()
+
+				pooled, err := pool.get(context.Background())
+				require.NoError(t, err)
+				pool.put(pooled)
+
+				*clock = clock.Add(pool.idleTimeout)
+
+				pooled, err = pool.get(context.Background())
+				require.NoError(t, err)
+				require.Same(t, conn2, pooled.Conn)
+				pool.put(pooled)
+
+				conn2.EXPECT().Close().Times(1)
+			},
+		},
+		{
+			name: "closes a connection instead of reusing it after a network error",
+			run: func(t *testing.T, pool *connPool, clock *time.Time, newConn func() *mockldapconn.MockConn) {
+				conn1 := newConn()
+				conn1.EXPECT().SearchWithPaging(searchRequest, uint32(42)).Return(nil, networkErr).Times(1)
+				conn1.EXPECT().Close().Times(1)
+				conn2 := newConn()
+
+				pooled, err := pool.get(context.Background())
+				require.NoError(t, err)
+				_, err = pooled.SearchWithPaging(searchRequest, 42)
+				require.ErrorIs(t, err, networkErr)
+				pool.put(pooled)
+
+				pooled, err = pool.get(context.Background())
+				require.NoError(t, err)
+				require.Same(t, conn2, pooled.Conn)
+				pool.put(pooled)
+
+				conn2.EXPECT().Close().Times(1)
+			},
+		},
+		{
+			name: "closes a connection instead of reusing it when it cannot be bound as the service account",
+			run: func(t *testing.T, pool *connPool, clock *time.Time, newConn func() *mockldapconn.MockConn) {
+				conn := newConn()
+				conn.EXPECT().Bind(bindUsername, bindPassword).Return(errors.New("some bind error")).Times(1)
+				conn.EXPECT().Close().Times(1)
+
+				pooled, err := pool.get(context.Background())
+				require.NoError(t, err)
+				require.EqualError(t, pooled.Bind(bindUsername, bindPassword), "some bind error")
+				pool.put(pooled)
+
+				require.Empty(t, pool.idle)
+			},
+		},
+		{
+			name: "waits for a connection to be released when the pool is saturated",
+			run: func(t *testing.T, pool *connPool, clock *time.Time, newConn func() *mockldapconn.MockConn) {
+				waitsBefore, err := testutil.GetHistogramMetricCount(ldapConnectionPoolWaitDuration.WithLabelValues(pool.upstreamName))
+				require.NoError(t, err)
+
+				conns := []*pooledConn{}
+				for i := 0; i < pool.maxConns; i++ {
+					newConn()
+					pooled, err := pool.get(context.Background())
+					require.NoError(t, err)
+					conns = append(conns, pooled)
+				}
+
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+				defer cancel()
+				_, err = pool.get(ctx)
+				require.EqualError(t, err, "error waiting for a connection from the saturated connection pool: context deadline exceeded")
+
+				got := make(chan *pooledConn)
+				go func() {
+					pooled, _ := pool.get(context.Background())
+					got <- pooled
+				}()
+				require.Eventually(t, func() bool {
+					pool.mu.Lock()
+					defer pool.mu.Unlock()
+					return pool.waiting == 1
+				}, time.Minute, time.Millisecond)
+
+				// The released connection was never bound as the service account, so it will be bound before it is reused.
+				conns[0].Conn.(*mockldapconn.MockConn).EXPECT().Bind(bindUsername, bindPassword).Times(1)
+				pool.put(conns[0])
+				require.Same(t, conns[0], <-got)
+				pool.put(conns[0])
+				for _, pooled := range conns[1:] {
+					pool.put(pooled)
+				}
+
+				// Both of the callers which found the pool saturated should have been counted.
+				waitsAfter, err := testutil.GetHistogramMetricCount(ldapConnectionPoolWaitDuration.WithLabelValues(pool.upstreamName))
+				require.NoError(t, err)
+				require.Equal(t, uint64(2), waitsAfter-waitsBefore)
+
+				for _, pooled := range conns {
+					pooled.Conn.(*mockldapconn.MockConn).EXPECT().Close().Times(1)
+				}
+			},
+		},
+		{
+			name: "closes connections which are returned after the pool was closed",
+			run: func(t *testing.T, pool *connPool, clock *time.Time, newConn func() *mockldapconn.MockConn) {
+				conn := newConn()
+
+				pooled, err := pool.get(context.Background())
+				require.NoError(t, err)
+
+				pool.close()
+				conn.EXPECT().Close().Times(1)
+				pool.put(pooled)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		tt := test
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			t.Cleanup(ctrl.Finish)
+
+			// Each call to newConn prepares a connection which will be returned by the next dial.
+			var undialed []*mockldapconn.MockConn
+			newConn := func() *mockldapconn.MockConn {
+				conn := mockldapconn.NewMockConn(ctrl)
+				undialed = append(undialed, conn)
+				return conn
+			}
+
+			clock := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+			pool := newConnPool("test-pool-"+tt.name, bindUsername, bindPassword, func(ctx context.Context) (Conn, error) {
+				require.NotEmpty(t, undialed, "unexpected dial")
+				conn := undialed[0]
+				undialed = undialed[1:]
+				return conn, nil
+			})
+			pool.now = func() time.Time { return clock }
+			pool.maxConns = 2
+			pool.slots = make(chan struct{}, pool.maxConns)
+
+			tt.run(t, pool, &clock, newConn)
+			require.Empty(t, undialed, "expected all connections to be dialed")
+
+			pool.close()
+		})
+	}
+}
+
+func TestConnPoolReapsIdleConnections(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	t.Cleanup(ctrl.Finish)
+
+	conn := mockldapconn.NewMockConn(ctrl)
+	var closed atomic.Bool
+	conn.EXPECT().Close().Do(func() { closed.Store(true) }).Times(1)
+
+	pool := newConnPool("test-pool-reaper", "some-bind-username", "some-bind-password", func(ctx context.Context) (Conn, error) {
+		return conn, nil
+	})
+	pool.idleTimeout = 10 * time.Millisecond
+
+	pooled, err := pool.get(context.Background())
+	require.NoError(t, err)
+	pool.put(pooled)
+
+	require.Eventually(t, closed.Load, time.Minute, time.Millisecond)
+	require.Empty(t, pool.idle)
+}
@@ -0,0 +1,97 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package upstreamldap
+
+import (
+	"bytes"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/utils/strings/slices"
+)
+
+// ProviderStateCache remembers the state of the connections to each upstream LDAP IDP, so that the state can be
+// shared by the Providers which are created for the same upstream. The controllers create new Providers whenever
+// they sync, so state which is kept by a Provider alone would be forgotten every time. It is safe for concurrent use.
+type ProviderStateCache struct {
+	mu     sync.Mutex
+	states map[types.UID]*providerState
+}
+
+type providerState struct {
+	backoff *hostBackoff
+
+	// pool is shared by the Providers for this upstream as long as their connection settings do not change.
+	pool       *connPool
+	poolConfig ProviderConfig
+}
+
+func NewProviderStateCache() *ProviderStateCache {
+	return &ProviderStateCache{states: map[types.UID]*providerState{}}
+}
+
+// New creates a Provider which shares its state with the other Providers which were created by this cache
+// for the same upstream, i.e. for the same ResourceUID. The pooled connections are only shared when the
+// connection settings of the upstream have not changed. Otherwise, the previous pool is closed.
+func (c *ProviderStateCache) New(config ProviderConfig) *Provider {
+	c.mu.Lock()
+	state, ok := c.states[config.ResourceUID]
+	if !ok {
+		state = &providerState{backoff: newHostBackoff()}
+		c.states[config.ResourceUID] = state
+	}
+
+	p := &Provider{c: config, backoff: state.backoff}
+	var replacedPool *connPool
+	if state.pool == nil || !sameConnectionSettings(state.poolConfig, config) {
+		replacedPool = state.pool
+		state.pool = p.newConnPool()
+		state.poolConfig = config
+	}
+	p.pool = state.pool
+	c.mu.Unlock()
+
+	if replacedPool != nil {
+		replacedPool.close()
+	}
+	return p
+}
+
+// Retain forgets the state of the upstreams which are not in the given list, e.g. because they were deleted,
+// closing their pooled connections.
+func (c *ProviderStateCache) Retain(resourceUIDs []types.UID) {
+	retained := sets.NewString()
+	for _, uid := range resourceUIDs {
+		retained.Insert(string(uid))
+	}
+
+	c.mu.Lock()
+	var removedPools []*connPool
+	for uid, state := range c.states {
+		if !retained.Has(string(uid)) {
+			if state.pool != nil {
+				removedPools = append(removedPools, state.pool)
+			}
+			delete(c.states, uid)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, pool := range removedPools {
+		pool.close()
+	}
+}
+
+// sameConnectionSettings returns whether the pooled connections which were dialed and bound using one config
+// can be used by a Provider with the other config.
+func sameConnectionSettings(a, b ProviderConfig) bool {
+	return a.Name == b.Name &&
+		a.Host == b.Host &&
+		slices.Equal(a.Hosts, b.Hosts) &&
+		a.ConnectionProtocol == b.ConnectionProtocol &&
+		bytes.Equal(a.CABundle, b.CABundle) &&
+		a.BindUsername == b.BindUsername &&
+		a.BindPassword == b.BindPassword
+}
@@ -0,0 +1,106 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package upstreamldap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/types"
+
+	"go.pinniped.dev/internal/endpointaddr"
+	"go.pinniped.dev/internal/mocks/mockldapconn"
+)
+
+func TestProviderStateCacheSharesHostBackoff(t *testing.T) {
+	cache := NewProviderStateCache()
+	t.Cleanup(func() { cache.Retain(nil) })
+
+	config1 := ProviderConfig{Name: "some-upstream", ResourceUID: "some-uid", Hosts: []string{"ldap1:389", "ldap2:389"}}
+	config2 := ProviderConfig{Name: "other-upstream", ResourceUID: "other-uid", Hosts: []string{"ldap1:389", "ldap2:389"}}
+
+	first := cache.New(config1)
+	first.backoff.failed("ldap1:389")
+
+	// A Provider for the same upstream which is created by a later sync should remember the failure.
+	second := cache.New(config1)
+	require.Same(t, first.backoff, second.backoff)
+	require.Equal(t, []string{"ldap2:389", "ldap1:389"}, second.backoff.order(config1.Hosts))
+
+	// A Provider for another upstream should not share the state.
+	other := cache.New(config2)
+	require.NotSame(t, first.backoff, other.backoff)
+	require.Equal(t, []string{"ldap1:389", "ldap2:389"}, other.backoff.order(config2.Hosts))
+
+	// The state of an upstream which is no longer retained should be forgotten.
+	cache.Retain([]types.UID{"other-uid"})
+	third := cache.New(config1)
+	require.NotSame(t, first.backoff, third.backoff)
+	require.Equal(t, []string{"ldap1:389", "ldap2:389"}, third.backoff.order(config1.Hosts))
+
+	fourth := cache.New(config2)
+	require.Same(t, other.backoff, fourth.backoff)
+}
+
+func TestProviderStateCacheSharesConnectionPool(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	t.Cleanup(ctrl.Finish)
+
+	conn1 := mockldapconn.NewMockConn(ctrl)
+	conn2 := mockldapconn.NewMockConn(ctrl)
+	undialed := []Conn{conn1, conn2}
+
+	config := ProviderConfig{
+		Name:               "some-upstream",
+		ResourceUID:        "some-uid",
+		Host:               "ldap.example.com:389",
+		ConnectionProtocol: StartTLS,
+		BindUsername:       "some-bind-username",
+		BindPassword:       "some-bind-password",
+		Dialer: LDAPDialerFunc(func(ctx context.Context, addr endpointaddr.HostPort) (Conn, error) {
+			require.NotEmpty(t, undialed, "unexpected dial")
+			conn := undialed[0]
+			undialed = undialed[1:]
+			return conn, nil
+		}),
+	}
+	cache := NewProviderStateCache()
+
+	// Leave an idle connection in the pool.
+	first := cache.New(config)
+	pooled, err := first.pool.get(context.Background())
+	require.NoError(t, err)
+	require.Same(t, conn1, pooled.Conn.(*metricsConn).Conn)
+	first.pool.put(pooled)
+
+	// A Provider for the same upstream which is created by a later sync should reuse the idle connection,
+	// even when settings which do not affect the connections have changed.
+	config.UserSearch.Base = "some-other-base"
+	second := cache.New(config)
+	require.Same(t, first.pool, second.pool)
+	conn1.EXPECT().Bind(config.BindUsername, config.BindPassword).Times(1) // health check of a connection which was never bound
+	pooled, err = second.pool.get(context.Background())
+	require.NoError(t, err)
+	require.Same(t, conn1, pooled.Conn.(*metricsConn).Conn)
+	second.pool.put(pooled)
+
+	// When the connection settings have changed, the previous pool should be closed and a new pool should be used.
+	conn1.EXPECT().Close().Times(1)
+	config.BindPassword = "some-new-bind-password"
+	third := cache.New(config)
+	require.NotSame(t, first.pool, third.pool)
+	require.True(t, first.pool.closed)
+	pooled, err = third.pool.get(context.Background())
+	require.NoError(t, err)
+	require.Same(t, conn2, pooled.Conn.(*metricsConn).Conn)
+	third.pool.put(pooled)
+
+	// When the upstream is no longer retained, its pool should be closed.
+	conn2.EXPECT().Close().Times(1)
+	cache.Retain([]types.UID{"other-uid"})
+	require.True(t, third.pool.closed)
+	require.Empty(t, undialed)
+}
@@ -1,4 +1,4 @@
-// Copyright 2021-2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2021-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 // Package upstreamldap implements an abstraction of upstream LDAP IDP interactions.
@@ -18,6 +18,7 @@ import (
 
 	"github.com/go-ldap/ldap/v3"
 	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apiserver/pkg/authentication/user"
 	"k8s.io/utils/strings/slices"
@@ -87,9 +88,15 @@ type ProviderConfig struct {
 	ResourceUID types.UID
 
 	// Host is the hostname or "hostname:port" of the LDAP server. When the port is not specified,
-	// the default LDAP port will be used.
+	// the default LDAP port will be used. Host also identifies this provider in the URL returned by GetURL,
+	// even when Hosts is not empty.
 	Host string
 
+	// Hosts is an ordered list of the hostnames or "hostname:port" of equivalent LDAP servers. When not empty,
+	// these hosts are dialed instead of Host, in order, failing over to the next host when a host cannot be dialed.
+	// Hosts which recently could not be dialed are tried last until they have backed off.
+	Hosts []string
+
 	// ConnectionProtocol determines how to establish the connection to the server. Either StartTLS or TLS.
 	ConnectionProtocol LDAPConnectionProtocol
 
@@ -160,7 +167,9 @@ type GroupSearchConfig struct {
 }
 
 type Provider struct {
-	c ProviderConfig
+	c       ProviderConfig
+	backoff *hostBackoff
+	pool    *connPool
 }
 
 var _ provider.UpstreamLDAPIdentityProviderI = &Provider{}
@@ -168,8 +177,23 @@ var _ authenticators.UserAuthenticator = &Provider{}
 
 // Create a Provider. The config is not a pointer to ensure that a copy of the config is created,
 // making the resulting Provider use an effectively read-only configuration.
+// Use a ProviderStateCache to create Providers which share their state with the previous Providers for the same upstream.
 func New(config ProviderConfig) *Provider {
-	return &Provider{c: config}
+	p := &Provider{c: config, backoff: newHostBackoff()}
+	p.pool = p.newConnPool()
+	return p
+}
+
+func (p *Provider) newConnPool() *connPool {
+	return newConnPool(p.c.Name, p.c.BindUsername, p.c.BindPassword, p.dial)
+}
+
+// Close closes the pooled connections of this Provider. Connections which are in use will be closed when they are
+// no longer in use. Pooled connections are also closed after they have been idle for a while, so a Provider which
+// is no longer used does not need to be closed. Providers which were created by a ProviderStateCache share their
+// pool, so they should not be closed. Their pool is closed by the ProviderStateCache when it is no longer needed.
+func (p *Provider) Close() {
+	p.pool.close()
 }
 
 // A reader for the config. Returns a copy of the config to keep the underlying config read-only.
@@ -182,15 +206,17 @@ func (p *Provider) PerformRefresh(ctx context.Context, storedRefreshAttributes p
 	defer t.LogIfLong(500 * time.Millisecond) // to help users debug slow LDAP searches
 	userDN := storedRefreshAttributes.DN
 
-	conn, err := p.dial(ctx)
+	conn, err := p.pool.get(ctx)
 	if err != nil {
-		return nil, fmt.Errorf(`error dialing host %q: %w`, p.c.Host, err)
+		return nil, err
 	}
-	defer conn.Close()
+	defer p.pool.put(conn)
 
-	err = conn.Bind(p.c.BindUsername, p.c.BindPassword)
-	if err != nil {
-		return nil, fmt.Errorf(`error binding as %q before user search: %w`, p.c.BindUsername, err)
+	if !conn.boundAsServiceAccount {
+		err = conn.Bind(p.c.BindUsername, p.c.BindPassword)
+		if err != nil {
+			return nil, fmt.Errorf(`error binding as %q before user search: %w`, p.c.BindUsername, err)
+		}
 	}
 
 	searchResult, err := p.performUserRefreshSearch(conn, userDN)
@@ -263,13 +289,49 @@ func (p *Provider) performUserRefreshSearch(conn Conn, userDN string) (*ldap.Sea
 	return searchResult, nil
 }
 
+// dial connects to the first host which accepts a connection, trying the hosts in the order given by the back-off.
 func (p *Provider) dial(ctx context.Context) (Conn, error) {
-	tlsAddr, err := endpointaddr.Parse(p.c.Host, defaultLDAPSPort)
+	hosts := p.hosts()
+	errs := make([]error, 0, len(hosts))
+	for _, host := range p.backoff.order(hosts) {
+		conn, err := p.dialHost(ctx, host)
+		if err == nil {
+			p.backoff.succeeded(host)
+			return &metricsConn{Conn: conn, upstreamName: p.GetName()}, nil
+		}
+		err = fmt.Errorf(`error dialing host %q: %w`, host, err)
+		errs = append(errs, err)
+		if len(hosts) == 1 {
+			break
+		}
+		backoff := p.backoff.failed(host)
+		plog.WarningErr("could not dial LDAP host, skipping it until it has backed off",
+			err, "upstreamName", p.GetName(), "host", host, "backoff", backoff.String())
+		if ctx.Err() != nil {
+			break // no point in trying the other hosts
+		}
+	}
+	if len(errs) == 1 {
+		return nil, errs[0]
+	}
+	return nil, fmt.Errorf("error dialing all hosts: %w", utilerrors.NewAggregate(errs))
+}
+
+// hosts returns the ordered list of hosts which may be dialed.
+func (p *Provider) hosts() []string {
+	if len(p.c.Hosts) == 0 {
+		return []string{p.c.Host}
+	}
+	return p.c.Hosts
+}
+
+func (p *Provider) dialHost(ctx context.Context, host string) (Conn, error) {
+	tlsAddr, err := endpointaddr.Parse(host, defaultLDAPSPort)
 	if err != nil {
 		return nil, ldap.NewError(ldap.ErrorNetwork, err)
 	}
 
-	startTLSAddr, err := endpointaddr.Parse(p.c.Host, defaultLDAPPort)
+	startTLSAddr, err := endpointaddr.Parse(host, defaultLDAPPort)
 	if err != nil {
 		return nil, ldap.NewError(ldap.ErrorNetwork, err)
 	}
@@ -379,7 +441,8 @@ func (p *Provider) GetURL() *url.URL {
 }
 
 // TestConnection provides a method for testing the connection and bind settings. It performs a dial and bind
-// and returns any errors that we encountered.
+// and returns any errors that we encountered. It does not use the connection pool, so that it always tests
+// a new connection.
 func (p *Provider) TestConnection(ctx context.Context) error {
 	err := p.validateConfig()
 	if err != nil {
@@ -388,7 +451,7 @@ func (p *Provider) TestConnection(ctx context.Context) error {
 
 	conn, err := p.dial(ctx)
 	if err != nil {
-		return fmt.Errorf(`error dialing host %q: %w`, p.c.Host, err)
+		return err
 	}
 	defer conn.Close()
 
@@ -436,17 +499,19 @@ func (p *Provider) authenticateUserImpl(ctx context.Context, username string, gr
 		return nil, false, nil
 	}
 
-	conn, err := p.dial(ctx)
+	conn, err := p.pool.get(ctx)
 	if err != nil {
 		p.traceAuthFailure(t, err)
-		return nil, false, fmt.Errorf(`error dialing host %q: %w`, p.c.Host, err)
+		return nil, false, err
 	}
-	defer conn.Close()
+	defer p.pool.put(conn)
 
-	err = conn.Bind(p.c.BindUsername, p.c.BindPassword)
-	if err != nil {
-		p.traceAuthFailure(t, err)
-		return nil, false, fmt.Errorf(`error binding as %q before user search: %w`, p.c.BindUsername, err)
+	if !conn.boundAsServiceAccount {
+		err = conn.Bind(p.c.BindUsername, p.c.BindPassword)
+		if err != nil {
+			p.traceAuthFailure(t, err)
+			return nil, false, fmt.Errorf(`error binding as %q before user search: %w`, p.c.BindUsername, err)
+		}
 	}
 
 	response, err := p.searchAndBindUser(conn, username, grantedScopes, bindFunc)
@@ -520,7 +585,7 @@ func (p *Provider) SearchForDefaultNamingContext(ctx context.Context) (string, e
 	conn, err := p.dial(ctx)
 	if err != nil {
 		p.traceSearchBaseDiscoveryFailure(t, err)
-		return "", fmt.Errorf(`error dialing host %q: %w`, p.c.Host, err)
+		return "", err
 	}
 	defer conn.Close()
 
@@ -1,4 +1,4 @@
-// Copyright 2021-2023 the Pinniped contributors. All Rights Reserved.
+// Copyright 2021-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package upstreamldap
@@ -1209,6 +1209,9 @@ func TestEndUserAuthentication(t *testing.T) {
 				require.Equal(t, tt.wantAuthResponse, authResponse)
 			}
 
+			// Close the pooled connection, so that DryRunAuthenticateUser() will dial a new connection.
+			ldapProvider.Close()
+
 			// DryRunAuthenticateUser() should have the same behavior as AuthenticateUser() except that it does not bind
 			// as the end user to confirm their password. Since it should behave the same, all of the same test cases
 			// apply, except for those which are specifically testing what happens when the end user bind fails.
@@ -1240,6 +1243,9 @@ func TestEndUserAuthentication(t *testing.T) {
 				require.True(t, authenticated)
 				require.Equal(t, tt.wantAuthResponse, authResponse)
 			}
+
+			// Close the pooled connection, which is expected by the mocks.
+			ldapProvider.Close()
 		})
 	}
 }
@@ -1827,6 +1833,9 @@ func TestUpstreamRefresh(t *testing.T) {
 			}
 			require.Equal(t, true, dialWasAttempted)
 			require.Equal(t, tt.wantGroups, groups)
+
+			// Close the pooled connection, which is expected by the mocks.
+			ldapProvider.Close()
 		})
 	}
 }
@@ -1849,12 +1858,14 @@ func TestTestConnection(t *testing.T) {
 	}
 
 	tests := []struct {
-		name           string
-		providerConfig *ProviderConfig
-		setupMocks     func(conn *mockldapconn.MockConn)
-		dialError      error
-		wantError      testutil.RequireErrorStringFunc
-		wantToSkipDial bool
+		name            string
+		providerConfig  *ProviderConfig
+		setupMocks      func(conn *mockldapconn.MockConn)
+		dialError       error
+		dialErrors      map[string]error
+		wantError       testutil.RequireErrorStringFunc
+		wantToSkipDial  bool
+		wantDialedHosts []string
 	}{
 		{
 			name:           "happy path",
@@ -1864,6 +1875,43 @@ func TestTestConnection(t *testing.T) {
 				conn.EXPECT().Close().Times(1)
 			},
 		},
+		{
+			name: "happy path with multiple hosts when the first host can be dialed",
+			providerConfig: providerConfig(func(p *ProviderConfig) {
+				p.Hosts = []string{"ldap1.example.com:8443", "ldap2.example.com:8443"}
+			}),
+			setupMocks: func(conn *mockldapconn.MockConn) {
+				conn.EXPECT().Bind(testBindUsername, testBindPassword).Times(1)
+				conn.EXPECT().Close().Times(1)
+			},
+			wantDialedHosts: []string{"ldap1.example.com:8443"},
+		},
+		{
+			name: "happy path with multiple hosts when the first host cannot be dialed",
+			providerConfig: providerConfig(func(p *ProviderConfig) {
+				p.Hosts = []string{"ldap1.example.com:8443", "ldap2.example.com:8443"}
+			}),
+			dialErrors: map[string]error{"ldap1.example.com:8443": errors.New("some dial error")},
+			setupMocks: func(conn *mockldapconn.MockConn) {
+				conn.EXPECT().Bind(testBindUsername, testBindPassword).Times(1)
+				conn.EXPECT().Close().Times(1)
+			},
+			wantDialedHosts: []string{"ldap1.example.com:8443", "ldap2.example.com:8443"},
+		},
+		{
+			name: "when none of multiple hosts can be dialed",
+			providerConfig: providerConfig(func(p *ProviderConfig) {
+				p.Hosts = []string{"ldap1.example.com:8443", "ldap2.example.com:8443"}
+			}),
+			dialErrors: map[string]error{
+				"ldap1.example.com:8443": errors.New("some dial error"),
+				"ldap2.example.com:8443": errors.New("some other dial error"),
+			},
+			wantDialedHosts: []string{"ldap1.example.com:8443", "ldap2.example.com:8443"},
+			wantError: testutil.WantExactErrorString(`error dialing all hosts: [` +
+				`error dialing host "ldap1.example.com:8443": some dial error, ` +
+				`error dialing host "ldap2.example.com:8443": some other dial error]`),
+		},
 		{
 			name:           "when dial fails",
 			providerConfig: providerConfig(nil),
@@ -1902,20 +1950,29 @@ func TestTestConnection(t *testing.T) {
 				tt.setupMocks(conn)
 			}
 
-			dialWasAttempted := false
+			var dialedHosts []string
 			tt.providerConfig.Dialer = LDAPDialerFunc(func(ctx context.Context, addr endpointaddr.HostPort) (Conn, error) {
-				dialWasAttempted = true
-				require.Equal(t, tt.providerConfig.Host, addr.Endpoint())
+				dialedHosts = append(dialedHosts, addr.Endpoint())
 				if tt.dialError != nil {
 					return nil, tt.dialError
 				}
+				if dialErr := tt.dialErrors[addr.Endpoint()]; dialErr != nil {
+					return nil, dialErr
+				}
 				return conn, nil
 			})
 
 			provider := New(*tt.providerConfig)
 			err := provider.TestConnection(context.Background())
 
-			require.Equal(t, !tt.wantToSkipDial, dialWasAttempted)
+			switch {
+			case tt.wantToSkipDial:
+				require.Empty(t, dialedHosts)
+			case tt.wantDialedHosts != nil:
+				require.Equal(t, tt.wantDialedHosts, dialedHosts)
+			default:
+				require.Equal(t, []string{tt.providerConfig.Host}, dialedHosts)
+			}
 
 			switch {
 			case tt.wantError != nil:
@@ -2109,18 +2166,20 @@ func TestRealTLSDialing(t *testing.T) {
 			}
 			if tt.wantError != nil {
 				require.Nil(t, conn)
-				testutil.RequireErrorStringFromErr(t, err, tt.wantError)
+				require.ErrorContains(t, err, fmt.Sprintf(`error dialing host %q: `, tt.host))
+				testutil.RequireErrorStringFromErr(t, errors.Unwrap(err), tt.wantError)
 			} else {
 				require.NoError(t, err)
 				require.NotNil(t, conn)
 
-				// Should be an instance of the real production LDAP client type.
+				// Should be an instance of the real production LDAP client type, wrapped to record metrics.
 				// Can't test its methods here because we are not dialed to a real LDAP server.
-				require.IsType(t, &ldap.Conn{}, conn)
+				require.IsType(t, &metricsConn{}, conn)
+				require.IsType(t, &ldap.Conn{}, conn.(*metricsConn).Conn)
 
 				// Indirectly checking that the Dialer method constructed the ldap.Conn with isTLS set to true,
 				// since this is always the correct behavior unless/until we want to support StartTLS.
-				err := conn.(*ldap.Conn).StartTLS(ptls.DefaultLDAP(nil))
+				err := conn.(*metricsConn).Conn.(*ldap.Conn).StartTLS(ptls.DefaultLDAP(nil))
 				require.EqualError(t, err, `LDAP Result Code 200 "Network Error": ldap: already encrypted`)
 			}
 		})
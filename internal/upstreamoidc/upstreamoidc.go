@@ -1,4 +1,4 @@
-// Copyright 2020-2023 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 // Package upstreamoidc implements an abstraction of upstream OIDC provider interactions.
@@ -45,6 +45,8 @@ type ProviderConfig struct {
 	AdditionalAuthcodeParams map[string]string
 	AdditionalClaimMappings  map[string]string
 	RevocationURL            *url.URL // will commonly be nil: many providers do not offer this
+	EndSessionURL            *url.URL // will be nil when the provider does not offer this
+	EndSessionOnLogout       bool
 	Provider                 interface {
 		Verifier(*coreosoidc.Config) *coreosoidc.IDTokenVerifier
 		Claims(v interface{}) error
@@ -62,6 +64,13 @@ func (p *ProviderConfig) GetRevocationURL() *url.URL {
 	return p.RevocationURL
 }
 
+func (p *ProviderConfig) GetEndSessionURL() *url.URL {
+	if !p.EndSessionOnLogout {
+		return nil
+	}
+	return p.EndSessionURL
+}
+
 func (p *ProviderConfig) HasUserInfoURL() bool {
 	providerJSON := &struct {
 		UserInfoURL string `json:"userinfo_endpoint"`
@@ -1,4 +1,4 @@
-// Copyright 2020-2023 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package upstreamoidc
@@ -59,6 +59,13 @@ func TestProviderConfig(t *testing.T) {
 		p.AllowPasswordGrant = false
 		require.False(t, p.AllowsPasswordGrant())
 
+		// The end session URL is only returned when ending the upstream session on logout is enabled.
+		require.Nil(t, p.GetEndSessionURL())
+		p.EndSessionURL = &url.URL{Scheme: "https", Host: "example.com", Path: "/logout"}
+		require.Nil(t, p.GetEndSessionURL())
+		p.EndSessionOnLogout = true
+		require.Equal(t, "https://example.com/logout", p.GetEndSessionURL().String())
+
 		require.True(t, p.HasUserInfoURL())
 		p.Provider = &mockProvider{
 			rawClaims: []byte(`{"some_other_endpoint": "https://example.com/blah"}`),
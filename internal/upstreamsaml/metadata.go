@@ -0,0 +1,144 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package upstreamsaml
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"go.pinniped.dev/internal/oidc/provider"
+)
+
+// IdentityProviderMetadata is the configuration of an upstream identity provider which is read from its metadata.
+type IdentityProviderMetadata struct {
+	EntityID            string
+	SSOURL              *url.URL
+	SigningCertificates []*x509.Certificate
+}
+
+type entityDescriptor struct {
+	XMLName           xml.Name
+	EntityID          string             `xml:"entityID,attr"`
+	IDPSSODescriptors []idpSSODescriptor `xml:"IDPSSODescriptor"`
+	EntityDescriptors []entityDescriptor `xml:"EntityDescriptor"` // only when the root is an EntitiesDescriptor
+}
+
+type idpSSODescriptor struct {
+	KeyDescriptors []struct {
+		Use          string   `xml:"use,attr"`
+		Certificates []string `xml:"KeyInfo>X509Data>X509Certificate"`
+	} `xml:"KeyDescriptor"`
+	SingleSignOnServices []struct {
+		Binding  string `xml:"Binding,attr"`
+		Location string `xml:"Location,attr"`
+	} `xml:"SingleSignOnService"`
+}
+
+// ParseIdentityProviderMetadata reads the entity ID, the location of the single sign-on service for the HTTP-Redirect
+// binding, and the signing certificates of an identity provider from its metadata. The metadata may either be an
+// EntityDescriptor, or an EntitiesDescriptor which contains exactly one identity provider.
+func ParseIdentityProviderMetadata(metadata []byte) (*IdentityProviderMetadata, error) {
+	var root entityDescriptor
+	if err := xml.Unmarshal(metadata, &root); err != nil {
+		return nil, fmt.Errorf("could not parse metadata: %w", err)
+	}
+
+	var idps []entityDescriptor
+	switch root.XMLName {
+	case xml.Name{Space: MetadataNamespace, Local: "EntityDescriptor"}:
+		idps = append(idps, root)
+	case xml.Name{Space: MetadataNamespace, Local: "EntitiesDescriptor"}:
+		for _, entity := range root.EntityDescriptors {
+			if len(entity.IDPSSODescriptors) != 0 {
+				idps = append(idps, entity)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("metadata contains an unexpected %s element", root.XMLName.Local)
+	}
+	if len(idps) != 1 || len(idps[0].IDPSSODescriptors) != 1 {
+		return nil, errors.New("metadata must describe exactly one identity provider")
+	}
+	entity := idps[0]
+	if entity.EntityID == "" {
+		return nil, errors.New("metadata has no entityID")
+	}
+	descriptor := entity.IDPSSODescriptors[0]
+
+	result := &IdentityProviderMetadata{EntityID: entity.EntityID}
+	for _, service := range descriptor.SingleSignOnServices {
+		if service.Binding != HTTPRedirectBinding {
+			continue
+		}
+		ssoURL, err := url.Parse(service.Location)
+		if err != nil {
+			return nil, fmt.Errorf("metadata has invalid single sign-on service location: %w", err)
+		}
+		if ssoURL.Scheme != "https" {
+			return nil, fmt.Errorf(`metadata has single sign-on service location %q which does not have "https" scheme`, service.Location)
+		}
+		result.SSOURL = ssoURL
+		break
+	}
+	if result.SSOURL == nil {
+		return nil, errors.New("metadata has no single sign-on service for the HTTP-Redirect binding")
+	}
+
+	for _, keyDescriptor := range descriptor.KeyDescriptors {
+		if keyDescriptor.Use != "" && keyDescriptor.Use != "signing" {
+			continue
+		}
+		for _, encoded := range keyDescriptor.Certificates {
+			der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(encoded), ""))
+			if err != nil {
+				return nil, fmt.Errorf("metadata has invalid signing certificate: %w", err)
+			}
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				return nil, fmt.Errorf("metadata has invalid signing certificate: %w", err)
+			}
+			result.SigningCertificates = append(result.SigningCertificates, cert)
+		}
+	}
+	if len(result.SigningCertificates) == 0 {
+		return nil, errors.New("metadata has no signing certificates")
+	}
+	return result, nil
+}
+
+type spEntityDescriptor struct {
+	XMLName         xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntityDescriptor"`
+	EntityID        string   `xml:"entityID,attr"`
+	SPSSODescriptor struct {
+		AuthnRequestsSigned        bool   `xml:"AuthnRequestsSigned,attr"`
+		WantAssertionsSigned       bool   `xml:"WantAssertionsSigned,attr"`
+		ProtocolSupportEnumeration string `xml:"protocolSupportEnumeration,attr"`
+		AssertionConsumerService   struct {
+			Binding  string `xml:"Binding,attr"`
+			Location string `xml:"Location,attr"`
+			Index    int    `xml:"index,attr"`
+		} `xml:"AssertionConsumerService"`
+	} `xml:"SPSSODescriptor"`
+}
+
+// ServiceProviderMetadata returns the metadata of the service provider, which should be registered with the
+// upstream identity providers.
+func ServiceProviderMetadata(sp provider.SAMLServiceProvider) ([]byte, error) {
+	var descriptor spEntityDescriptor
+	descriptor.EntityID = sp.EntityID
+	descriptor.SPSSODescriptor.WantAssertionsSigned = true
+	descriptor.SPSSODescriptor.ProtocolSupportEnumeration = ProtocolNamespace
+	descriptor.SPSSODescriptor.AssertionConsumerService.Binding = HTTPPostBinding
+	descriptor.SPSSODescriptor.AssertionConsumerService.Location = sp.ACSURL
+	metadata, err := xml.MarshalIndent(&descriptor, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), metadata...), nil
+}
@@ -0,0 +1,109 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package upstreamsaml
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/testutil/samltestutil"
+)
+
+func TestParseIdentityProviderMetadata(t *testing.T) {
+	idp := samltestutil.NewIdentityProvider(t, "https://idp.example.com/idp")
+
+	t.Run("EntityDescriptor", func(t *testing.T) {
+		metadata, err := ParseIdentityProviderMetadata([]byte(idp.Metadata()))
+		require.NoError(t, err)
+		require.Equal(t, "https://idp.example.com/idp", metadata.EntityID)
+		require.Equal(t, "https://idp.example.com/idp/sso", metadata.SSOURL.String())
+		require.Len(t, metadata.SigningCertificates, 1)
+		require.True(t, idp.Cert.Equal(metadata.SigningCertificates[0]))
+	})
+
+	t.Run("EntitiesDescriptor", func(t *testing.T) {
+		entity := strings.TrimPrefix(idp.Metadata(), `<?xml version="1.0"?>`)
+		metadata, err := ParseIdentityProviderMetadata([]byte(
+			`<EntitiesDescriptor xmlns="urn:oasis:names:tc:SAML:2.0:metadata">` +
+				`<EntityDescriptor entityID="https://sp.example.com"><SPSSODescriptor/></EntityDescriptor>` +
+				entity + `</EntitiesDescriptor>`,
+		))
+		require.NoError(t, err)
+		require.Equal(t, "https://idp.example.com/idp", metadata.EntityID)
+	})
+
+	tests := []struct {
+		name    string
+		edit    func(string) string
+		wantErr string
+	}{
+		{
+			name:    "not XML",
+			edit:    func(string) string { return "not xml" },
+			wantErr: "could not parse metadata: EOF",
+		},
+		{
+			name:    "unexpected root element",
+			edit:    func(string) string { return `<EntityDescriptor entityID="x"/>` },
+			wantErr: "metadata contains an unexpected EntityDescriptor element",
+		},
+		{
+			name:    "no identity provider",
+			edit:    func(s string) string { return strings.ReplaceAll(s, "IDPSSODescriptor", "SPSSODescriptor") },
+			wantErr: "metadata must describe exactly one identity provider",
+		},
+		{
+			name:    "no entityID",
+			edit:    func(s string) string { return strings.Replace(s, `entityID="https://idp.example.com/idp"`, "", 1) },
+			wantErr: "metadata has no entityID",
+		},
+		{
+			name:    "no HTTP-Redirect single sign-on service",
+			edit:    func(s string) string { return strings.ReplaceAll(s, "HTTP-Redirect", "SOAP") },
+			wantErr: "metadata has no single sign-on service for the HTTP-Redirect binding",
+		},
+		{
+			name:    "single sign-on service without TLS",
+			edit:    func(s string) string { return strings.ReplaceAll(s, `Location="https://`, `Location="http://`) },
+			wantErr: `metadata has single sign-on service location "http://idp.example.com/idp/sso" which does not have "https" scheme`,
+		},
+		{
+			name:    "only encryption certificates",
+			edit:    func(s string) string { return strings.Replace(s, `use="signing"`, `use="encryption"`, 1) },
+			wantErr: "metadata has no signing certificates",
+		},
+		{
+			name: "invalid certificate",
+			edit: func(s string) string {
+				return strings.Replace(s, "<ds:X509Certificate>", "<ds:X509Certificate>AAAA", 1)
+			},
+			wantErr: "metadata has invalid signing certificate: x509: malformed certificate",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			metadata, err := ParseIdentityProviderMetadata([]byte(tt.edit(idp.Metadata())))
+			require.EqualError(t, err, tt.wantErr)
+			require.Nil(t, metadata)
+		})
+	}
+}
+
+func TestServiceProviderMetadata(t *testing.T) {
+	metadata, err := ServiceProviderMetadata(provider.SAMLServiceProvider{
+		EntityID: "https://issuer.example.com/saml/metadata",
+		ACSURL:   "https://issuer.example.com/saml/acs",
+	})
+	require.NoError(t, err)
+	require.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<EntityDescriptor xmlns="urn:oasis:names:tc:SAML:2.0:metadata" entityID="https://issuer.example.com/saml/metadata">
+  <SPSSODescriptor AuthnRequestsSigned="false" WantAssertionsSigned="true" protocolSupportEnumeration="urn:oasis:names:tc:SAML:2.0:protocol">
+    <AssertionConsumerService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST" Location="https://issuer.example.com/saml/acs" index="0"></AssertionConsumerService>
+  </SPSSODescriptor>
+</EntityDescriptor>`, string(metadata))
+}
@@ -0,0 +1,472 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package upstreamsaml implements an abstraction of upstream SAML 2.0 identity provider interactions, where the
+// Supervisor acts as a service provider using the Web Browser SSO Profile.
+package upstreamsaml
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/russellhaering/goxmldsig/etreeutils"
+	"k8s.io/apimachinery/pkg/types"
+
+	"go.pinniped.dev/internal/oidc/provider"
+)
+
+const (
+	// ProtocolNamespace is the namespace of the elements of SAML 2.0 protocol messages.
+	ProtocolNamespace = "urn:oasis:names:tc:SAML:2.0:protocol"
+
+	// AssertionNamespace is the namespace of the elements of SAML 2.0 assertions.
+	AssertionNamespace = "urn:oasis:names:tc:SAML:2.0:assertion"
+
+	// MetadataNamespace is the namespace of the elements of SAML 2.0 metadata.
+	MetadataNamespace = "urn:oasis:names:tc:SAML:2.0:metadata"
+
+	// HTTPRedirectBinding and HTTPPostBinding are the SAML 2.0 bindings used by the Supervisor.
+	HTTPRedirectBinding = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	HTTPPostBinding     = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+
+	statusSuccess      = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	bearerConfirmation = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+
+	// maxClockSkew is how much the clocks of the Supervisor and the upstream provider are allowed to differ when
+	// checking the validity period of an assertion.
+	maxClockSkew = 2 * time.Minute
+)
+
+// ProviderConfig holds the active configuration of an upstream SAML identity provider.
+type ProviderConfig struct {
+	Name                string
+	ResourceUID         types.UID
+	EntityID            string
+	SSOURL              *url.URL
+	SigningCertificates []*x509.Certificate
+	NameIDFormat        string
+	UsernameAttribute   string
+	GroupsAttribute     string
+}
+
+var _ provider.UpstreamSAMLIdentityProviderI = (*ProviderConfig)(nil)
+
+func (p *ProviderConfig) GetName() string {
+	return p.Name
+}
+
+func (p *ProviderConfig) GetResourceUID() types.UID {
+	return p.ResourceUID
+}
+
+func (p *ProviderConfig) GetEntityID() string {
+	return p.EntityID
+}
+
+func (p *ProviderConfig) GetUsernameAttribute() string {
+	return p.UsernameAttribute
+}
+
+func (p *ProviderConfig) GetGroupsAttribute() string {
+	return p.GroupsAttribute
+}
+
+type authnRequest struct {
+	XMLName                     xml.Name     `xml:"urn:oasis:names:tc:SAML:2.0:protocol AuthnRequest"`
+	ID                          string       `xml:"ID,attr"`
+	Version                     string       `xml:"Version,attr"`
+	IssueInstant                string       `xml:"IssueInstant,attr"`
+	Destination                 string       `xml:"Destination,attr"`
+	AssertionConsumerServiceURL string       `xml:"AssertionConsumerServiceURL,attr"`
+	ProtocolBinding             string       `xml:"ProtocolBinding,attr"`
+	Issuer                      string       `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	NameIDPolicy                nameIDPolicy `xml:"urn:oasis:names:tc:SAML:2.0:protocol NameIDPolicy"`
+}
+
+type nameIDPolicy struct {
+	Format      string `xml:"Format,attr,omitempty"`
+	AllowCreate bool   `xml:"AllowCreate,attr"`
+}
+
+func (p *ProviderConfig) AuthnRequestURL(sp provider.SAMLServiceProvider, requestID string, relayState string) (*url.URL, error) {
+	request, err := xml.Marshal(&authnRequest{
+		ID:                          requestID,
+		Version:                     "2.0",
+		IssueInstant:                time.Now().UTC().Format(time.RFC3339),
+		Destination:                 p.SSOURL.String(),
+		AssertionConsumerServiceURL: sp.ACSURL,
+		ProtocolBinding:             HTTPPostBinding,
+		Issuer:                      sp.EntityID,
+		NameIDPolicy:                nameIDPolicy{Format: p.NameIDFormat, AllowCreate: true},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The HTTP-Redirect binding requires the message to be compressed using raw DEFLATE and then base64-encoded.
+	var compressed bytes.Buffer
+	writer, err := flate.NewWriter(&compressed, flate.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writer.Write(request); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	redirectURL := *p.SSOURL
+	query := redirectURL.Query()
+	query.Set("SAMLRequest", base64.StdEncoding.EncodeToString(compressed.Bytes()))
+	query.Set("RelayState", relayState)
+	redirectURL.RawQuery = query.Encode()
+	return &redirectURL, nil
+}
+
+type assertion struct {
+	XMLName      xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:assertion Assertion"`
+	ID           string   `xml:"ID,attr"`
+	Version      string   `xml:"Version,attr"`
+	Issuer       string   `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	NameID       string   `xml:"Subject>NameID"`
+	Confirmation []struct {
+		Method string `xml:"Method,attr"`
+		Data   struct {
+			Recipient    string `xml:"Recipient,attr"`
+			InResponseTo string `xml:"InResponseTo,attr"`
+			NotBefore    string `xml:"NotBefore,attr"`
+			NotOnOrAfter string `xml:"NotOnOrAfter,attr"`
+		} `xml:"SubjectConfirmationData"`
+	} `xml:"Subject>SubjectConfirmation"`
+	Conditions *struct {
+		NotBefore            string `xml:"NotBefore,attr"`
+		NotOnOrAfter         string `xml:"NotOnOrAfter,attr"`
+		AudienceRestrictions []struct {
+			Audiences []string `xml:"Audience"`
+		} `xml:"AudienceRestriction"`
+	} `xml:"Conditions"`
+	AuthnStatements []struct {
+		SessionNotOnOrAfter string `xml:"SessionNotOnOrAfter,attr"`
+	} `xml:"AuthnStatement"`
+	Attributes []struct {
+		Name   string   `xml:"Name,attr"`
+		Values []string `xml:"AttributeValue"`
+	} `xml:"AttributeStatement>Attribute"`
+}
+
+type response struct {
+	XMLName      xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:protocol Response"`
+	Version      string   `xml:"Version,attr"`
+	Destination  string   `xml:"Destination,attr"`
+	InResponseTo string   `xml:"InResponseTo,attr"`
+	Issuers      []string `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	Status       []struct {
+		StatusCode []struct {
+			Value      string `xml:"Value,attr"`
+			StatusCode []struct {
+				Value string `xml:"Value,attr"`
+			} `xml:"urn:oasis:names:tc:SAML:2.0:protocol StatusCode"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:protocol StatusCode"`
+		StatusMessage []string `xml:"urn:oasis:names:tc:SAML:2.0:protocol StatusMessage"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:protocol Status"`
+	EncryptedAssertions []struct{} `xml:"urn:oasis:names:tc:SAML:2.0:assertion EncryptedAssertion"`
+}
+
+func (p *ProviderConfig) ValidateResponse(sp provider.SAMLServiceProvider, samlResponse string, requestID string) (*provider.SAMLAssertion, error) {
+	decoded, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(samlResponse), ""))
+	if err != nil {
+		return nil, fmt.Errorf("could not decode SAMLResponse: %w", err)
+	}
+	root, err := parse(decoded)
+	if err != nil {
+		return nil, err
+	}
+	if root.NamespaceURI() != ProtocolNamespace || root.Tag != "Response" {
+		return nil, fmt.Errorf("SAMLResponse contains an unexpected %s element", root.Tag)
+	}
+
+	// The response and/or the assertion must be signed. Only the canonical form of the signed content is used
+	// from here on, so any content which is not covered by a signature is ignored.
+	validator := dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{Roots: p.SigningCertificates})
+	responseIsSigned := false
+	signedResponse, err := validator.Validate(root)
+	switch {
+	case err == nil:
+		responseIsSigned = true
+	case errors.Is(err, dsig.ErrMissingSignature):
+		signedResponse = root
+	default:
+		return nil, fmt.Errorf("invalid signature of response: %w", err)
+	}
+	canonicalResponse, err := canonicalize(signedResponse)
+	if err != nil {
+		return nil, err
+	}
+	if root, err = parse(canonicalResponse); err != nil {
+		return nil, err
+	}
+
+	var r response
+	if err := xml.Unmarshal(canonicalResponse, &r); err != nil {
+		return nil, fmt.Errorf("could not parse response: %w", err)
+	}
+	if err := p.validateResponseElement(&r, sp, requestID, responseIsSigned); err != nil {
+		return nil, err
+	}
+
+	if len(r.EncryptedAssertions) != 0 {
+		return nil, errors.New("encrypted assertions are not supported")
+	}
+	var assertionElements []*etree.Element
+	for _, child := range root.ChildElements() {
+		if child.NamespaceURI() == AssertionNamespace && child.Tag == "Assertion" {
+			assertionElements = append(assertionElements, child)
+		}
+	}
+	if len(assertionElements) != 1 {
+		return nil, fmt.Errorf("response must contain exactly one assertion, found %d", len(assertionElements))
+	}
+
+	// Detach the assertion from the response, keeping the namespaces which it inherited from the response,
+	// so that its own signature can be validated.
+	namespaces, err := etreeutils.NSBuildParentContext(assertionElements[0])
+	if err != nil {
+		return nil, fmt.Errorf("could not parse assertion: %w", err)
+	}
+	assertionElement, err := etreeutils.NSDetatch(namespaces, assertionElements[0])
+	if err != nil {
+		return nil, fmt.Errorf("could not parse assertion: %w", err)
+	}
+	signedAssertion, err := validator.Validate(assertionElement)
+	switch {
+	case err == nil:
+	case errors.Is(err, dsig.ErrMissingSignature) && responseIsSigned:
+		signedAssertion = assertionElement
+	case errors.Is(err, dsig.ErrMissingSignature):
+		return nil, errors.New("neither the response nor the assertion is signed")
+	default:
+		return nil, fmt.Errorf("invalid signature of assertion: %w", err)
+	}
+	canonicalAssertion, err := canonicalize(signedAssertion)
+	if err != nil {
+		return nil, err
+	}
+
+	var a assertion
+	if err := xml.Unmarshal(canonicalAssertion, &a); err != nil {
+		return nil, fmt.Errorf("could not parse assertion: %w", err)
+	}
+	return p.validateAssertion(&a, sp, requestID, time.Now())
+}
+
+// parse parses an XML document and returns its root element. Documents containing DTDs or other directives
+// are rejected, since they are never needed in SAML messages and only enable attacks such as entity expansion.
+func parse(data []byte) (*etree.Element, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not parse XML: %w", err)
+		}
+		if _, ok := token.(xml.Directive); ok {
+			return nil, errors.New("could not parse XML: DTDs and other directives are not allowed")
+		}
+	}
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return nil, fmt.Errorf("could not parse XML: %w", err)
+	}
+	root := doc.Root()
+	if root == nil {
+		return nil, errors.New("could not parse XML: document has no root element")
+	}
+	return root, nil
+}
+
+// canonicalize returns the exclusive canonical form of an element, which is also how signed elements are digested.
+func canonicalize(element *etree.Element) ([]byte, error) {
+	canonical, err := dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("").Canonicalize(element.Copy())
+	if err != nil {
+		return nil, fmt.Errorf("could not canonicalize XML: %w", err)
+	}
+	return canonical, nil
+}
+
+// validateResponseElement validates the attributes and the status of the Response element. A signed response must
+// name its Destination, as required by the SAML bindings specification (section 3.5.5.2).
+func (p *ProviderConfig) validateResponseElement(r *response, sp provider.SAMLServiceProvider, requestID string, signed bool) error {
+	if r.Version != "2.0" {
+		return fmt.Errorf("response has unsupported version %q", r.Version)
+	}
+	if r.Destination == "" && signed {
+		return errors.New("signed response has no destination")
+	}
+	if r.Destination != "" && r.Destination != sp.ACSURL {
+		return fmt.Errorf("response has unexpected destination %q", r.Destination)
+	}
+	if r.InResponseTo != requestID {
+		return fmt.Errorf("response is not a response to the expected request: InResponseTo is %q", r.InResponseTo)
+	}
+	for _, issuer := range r.Issuers {
+		if strings.TrimSpace(issuer) != p.EntityID {
+			return fmt.Errorf("response has unexpected issuer %q", issuer)
+		}
+	}
+
+	var statusCode, subStatusCode, statusMessage string
+	for _, status := range r.Status {
+		for _, code := range status.StatusCode {
+			statusCode = code.Value
+			for _, subCode := range code.StatusCode {
+				subStatusCode = subCode.Value
+			}
+		}
+		for _, message := range status.StatusMessage {
+			statusMessage = message
+		}
+	}
+	if statusCode != statusSuccess {
+		return fmt.Errorf("response has unsuccessful status %q (second-level status %q, message %q)", statusCode, subStatusCode, statusMessage)
+	}
+	return nil
+}
+
+// validateAssertion checks that the signed assertion was issued by the upstream provider for this service provider,
+// in response to the expected request, and that it is currently valid.
+func (p *ProviderConfig) validateAssertion(a *assertion, sp provider.SAMLServiceProvider, requestID string, now time.Time) (*provider.SAMLAssertion, error) {
+	if a.Version != "2.0" {
+		return nil, fmt.Errorf("assertion has unsupported version %q", a.Version)
+	}
+	if strings.TrimSpace(a.Issuer) != p.EntityID {
+		return nil, fmt.Errorf("assertion has unexpected issuer %q", a.Issuer)
+	}
+	if a.ID == "" {
+		return nil, errors.New("assertion has no ID")
+	}
+	nameID := strings.TrimSpace(a.NameID)
+	if nameID == "" {
+		return nil, errors.New("assertion has no NameID")
+	}
+
+	// The Web Browser SSO Profile requires a bearer subject confirmation which is bound to this request and this
+	// service provider.
+	confirmed := false
+	var notOnOrAfter time.Time
+	for _, confirmation := range a.Confirmation {
+		data := confirmation.Data
+		if confirmation.Method != bearerConfirmation || data.Recipient != sp.ACSURL || data.InResponseTo != requestID {
+			continue
+		}
+		if err := validateTimes(data.NotBefore, data.NotOnOrAfter, true, now); err != nil {
+			return nil, fmt.Errorf("assertion subject confirmation is not valid: %w", err)
+		}
+		// validateTimes already made sure that this can be parsed. The assertion is accepted until this time
+		// plus the allowed clock skew.
+		notOnOrAfter, _ = parseTime(data.NotOnOrAfter)
+		notOnOrAfter = notOnOrAfter.Add(maxClockSkew)
+		confirmed = true
+		break
+	}
+	if !confirmed {
+		return nil, errors.New("assertion has no bearer subject confirmation for this request and service provider")
+	}
+
+	if a.Conditions == nil {
+		return nil, errors.New("assertion has no conditions")
+	}
+	if err := validateTimes(a.Conditions.NotBefore, a.Conditions.NotOnOrAfter, false, now); err != nil {
+		return nil, fmt.Errorf("assertion conditions are not valid: %w", err)
+	}
+	if len(a.Conditions.AudienceRestrictions) == 0 {
+		return nil, errors.New("assertion has no audience restriction")
+	}
+	for _, restriction := range a.Conditions.AudienceRestrictions {
+		allowed := false
+		for _, audience := range restriction.Audiences {
+			if strings.TrimSpace(audience) == sp.EntityID {
+				allowed = true
+			}
+		}
+		if !allowed {
+			return nil, fmt.Errorf("assertion audience restriction does not allow this service provider (%q)", sp.EntityID)
+		}
+	}
+
+	if len(a.AuthnStatements) == 0 {
+		return nil, errors.New("assertion has no authentication statement")
+	}
+	result := &provider.SAMLAssertion{NameID: nameID, Attributes: map[string][]string{}, ID: a.ID, NotOnOrAfter: notOnOrAfter}
+	for _, statement := range a.AuthnStatements {
+		if statement.SessionNotOnOrAfter == "" {
+			continue
+		}
+		sessionNotOnOrAfter, err := parseTime(statement.SessionNotOnOrAfter)
+		if err != nil {
+			return nil, fmt.Errorf("assertion authentication statement is not valid: %w", err)
+		}
+		if !now.Before(sessionNotOnOrAfter) {
+			return nil, errors.New("assertion authentication statement is not valid: session has expired")
+		}
+		if result.SessionNotOnOrAfter == nil || sessionNotOnOrAfter.Before(*result.SessionNotOnOrAfter) {
+			result.SessionNotOnOrAfter = &sessionNotOnOrAfter
+		}
+	}
+
+	for _, attribute := range a.Attributes {
+		for _, value := range attribute.Values {
+			result.Attributes[attribute.Name] = append(result.Attributes[attribute.Name], strings.TrimSpace(value))
+		}
+	}
+	return result, nil
+}
+
+// validateTimes checks that now is within the validity period, allowing for some clock skew.
+func validateTimes(notBefore, notOnOrAfter string, requireNotOnOrAfter bool, now time.Time) error {
+	if notBefore != "" {
+		t, err := parseTime(notBefore)
+		if err != nil {
+			return err
+		}
+		if now.Add(maxClockSkew).Before(t) {
+			return fmt.Errorf("not valid before %s", notBefore)
+		}
+	}
+	if notOnOrAfter == "" {
+		if requireNotOnOrAfter {
+			return errors.New("missing NotOnOrAfter")
+		}
+		return nil
+	}
+	t, err := parseTime(notOnOrAfter)
+	if err != nil {
+		return err
+	}
+	if !now.Add(-maxClockSkew).Before(t) {
+		return fmt.Errorf("expired at %s", notOnOrAfter)
+	}
+	return nil
+}
+
+func parseTime(value string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(value))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q", value)
+	}
+	return t.UTC(), nil
+}
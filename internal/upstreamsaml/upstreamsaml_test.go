@@ -0,0 +1,268 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package upstreamsaml
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/testutil/samltestutil"
+)
+
+func TestAuthnRequestURL(t *testing.T) {
+	ssoURL, err := url.Parse("https://idp.example.com/sso?tenant=acme")
+	require.NoError(t, err)
+	p := &ProviderConfig{SSOURL: ssoURL, NameIDFormat: "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"}
+	sp := provider.SAMLServiceProvider{EntityID: "https://issuer.example.com/saml/metadata", ACSURL: "https://issuer.example.com/saml/acs"}
+
+	redirectURL, err := p.AuthnRequestURL(sp, "id-some-request", "some-relay-state")
+	require.NoError(t, err)
+	require.Equal(t, "idp.example.com", redirectURL.Host)
+	require.Equal(t, "/sso", redirectURL.Path)
+	require.Equal(t, "acme", redirectURL.Query().Get("tenant"))
+	require.Equal(t, "https://idp.example.com/sso?tenant=acme", ssoURL.String(), "should not modify the SSO URL")
+
+	request, relayState := samltestutil.ParseAuthnRequestURL(t, redirectURL.String())
+	require.Equal(t, "some-relay-state", relayState)
+	require.Equal(t, "id-some-request", request.ID)
+	require.Equal(t, "https://idp.example.com/sso?tenant=acme", request.Destination)
+	require.Equal(t, sp.ACSURL, request.AssertionConsumerServiceURL)
+	require.Equal(t, HTTPPostBinding, request.ProtocolBinding)
+	require.Equal(t, sp.EntityID, request.Issuer)
+	require.Equal(t, "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress", request.NameIDPolicy.Format)
+	require.True(t, request.NameIDPolicy.AllowCreate)
+}
+
+func TestValidateResponse(t *testing.T) {
+	const requestID = "id-some-request"
+	sp := provider.SAMLServiceProvider{EntityID: "https://issuer.example.com/saml/metadata", ACSURL: "https://issuer.example.com/saml/acs"}
+	idp := samltestutil.NewIdentityProvider(t, "https://idp.example.com")
+	otherIDP := samltestutil.NewIdentityProvider(t, "https://idp.example.com")
+	p := &ProviderConfig{EntityID: idp.EntityID, SigningCertificates: []*x509.Certificate{otherIDP.Cert, idp.Cert}}
+
+	sessionNotOnOrAfter := time.Now().Add(8 * time.Hour).UTC().Truncate(time.Second)
+
+	tests := []struct {
+		name          string
+		editResponse  func(r *samltestutil.Response)
+		signer        *samltestutil.IdentityProvider
+		editEncoded   func(t *testing.T, encoded string) string
+		wantAssertion *provider.SAMLAssertion
+		wantErr       string
+	}{
+		{
+			name: "signed assertion",
+			editResponse: func(r *samltestutil.Response) {
+				r.Attributes = map[string][]string{"groups": {"a", "b"}, "email": {"alice@example.com"}}
+			},
+			wantAssertion: &provider.SAMLAssertion{
+				NameID:     "alice",
+				Attributes: map[string][]string{"groups": {"a", "b"}, "email": {"alice@example.com"}},
+			},
+		},
+		{
+			name: "signed response with unsigned assertion and a session limit",
+			editResponse: func(r *samltestutil.Response) {
+				r.SignResponse = true
+				r.SignAssertion = false
+				r.SessionNotOnOrAfter = sessionNotOnOrAfter
+			},
+			wantAssertion: &provider.SAMLAssertion{
+				NameID:              "alice",
+				Attributes:          map[string][]string{},
+				SessionNotOnOrAfter: &sessionNotOnOrAfter,
+			},
+		},
+		{
+			name:          "signed response and signed assertion",
+			editResponse:  func(r *samltestutil.Response) { r.SignResponse = true },
+			wantAssertion: &provider.SAMLAssertion{NameID: "alice", Attributes: map[string][]string{}},
+		},
+		{
+			name:         "neither the response nor the assertion is signed",
+			editResponse: func(r *samltestutil.Response) { r.SignAssertion = false },
+			wantErr:      "neither the response nor the assertion is signed",
+		},
+		{
+			name:    "signed by an untrusted key",
+			signer:  samltestutil.NewIdentityProvider(t, "https://idp.example.com"),
+			wantErr: "invalid signature of assertion: Could not verify certificate against trusted certs",
+		},
+		{
+			name: "response signature is invalid",
+			editResponse: func(r *samltestutil.Response) {
+				r.SignResponse = true
+				r.SignAssertion = false
+			},
+			editEncoded: editDecoded(func(s string) string { return strings.Replace(s, ">alice<", ">mallory<", 1) }),
+			wantErr:     "invalid signature of response: Signature could not be verified",
+		},
+		{
+			name: "unsigned assertion was added next to a signed one",
+			editEncoded: editDecoded(func(s string) string {
+				start := strings.Index(s, "<saml:Assertion")
+				end := strings.Index(s, "</saml:Assertion>") + len("</saml:Assertion>")
+				return s[:end] + strings.Replace(s[start:end], ">alice<", ">mallory<", 1) + s[end:]
+			}),
+			wantErr: "response must contain exactly one assertion, found 2",
+		},
+		{
+			name: "signed assertion was moved into an extension and replaced by a modified copy",
+			editEncoded: editDecoded(func(s string) string {
+				start := strings.Index(s, "<saml:Assertion")
+				end := strings.Index(s, "</saml:Assertion>") + len("</saml:Assertion>")
+				return s[:start] + "<samlp:Extensions>" + s[start:end] + "</samlp:Extensions>" +
+					strings.Replace(s[start:end], ">alice<", ">mallory<", 1) + s[end:]
+			}),
+			wantErr: "invalid signature of assertion: Signature could not be verified",
+		},
+		{
+			name: "encrypted assertion",
+			editEncoded: editDecoded(func(s string) string {
+				return strings.Replace(s, "</samlp:Response>", `<saml:EncryptedAssertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion"></saml:EncryptedAssertion></samlp:Response>`, 1)
+			}),
+			wantErr: "encrypted assertions are not supported",
+		},
+		{
+			name:         "response to another request",
+			editResponse: func(r *samltestutil.Response) { r.InResponseTo = "id-other-request" },
+			wantErr:      `response is not a response to the expected request: InResponseTo is "id-other-request"`,
+		},
+		{
+			name:         "response for another service provider",
+			editResponse: func(r *samltestutil.Response) { r.Destination = "https://other.example.com/acs" },
+			wantErr:      `response has unexpected destination "https://other.example.com/acs"`,
+		},
+		{
+			name: "signed response without a destination",
+			editResponse: func(r *samltestutil.Response) {
+				r.SignResponse = true
+				r.Destination = ""
+			},
+			wantErr: "signed response has no destination",
+		},
+		{
+			name:          "unsigned response without a destination",
+			editResponse:  func(r *samltestutil.Response) { r.Destination = "" },
+			wantAssertion: &provider.SAMLAssertion{NameID: "alice", Attributes: map[string][]string{}},
+		},
+		{
+			name:         "response from another issuer",
+			editResponse: func(r *samltestutil.Response) { r.Issuer = "https://other-idp.example.com" },
+			wantErr:      `response has unexpected issuer "https://other-idp.example.com"`,
+		},
+		{
+			name:         "unsuccessful status",
+			editResponse: func(r *samltestutil.Response) { r.StatusCode = "urn:oasis:names:tc:SAML:2.0:status:Requester" },
+			wantErr:      `response has unsuccessful status "urn:oasis:names:tc:SAML:2.0:status:Requester" (second-level status "", message "")`,
+		},
+		{
+			name:         "assertion for another recipient",
+			editResponse: func(r *samltestutil.Response) { r.Recipient = "https://other.example.com/acs" },
+			wantErr:      "assertion has no bearer subject confirmation for this request and service provider",
+		},
+		{
+			name:         "assertion for another audience",
+			editResponse: func(r *samltestutil.Response) { r.Audience = "https://other.example.com/saml/metadata" },
+			wantErr:      `assertion audience restriction does not allow this service provider ("https://issuer.example.com/saml/metadata")`,
+		},
+		{
+			name: "expired assertion",
+			editResponse: func(r *samltestutil.Response) {
+				r.NotBefore = time.Now().Add(-time.Hour)
+				r.NotOnOrAfter = time.Now().Add(-10 * time.Minute)
+			},
+			wantErr: "assertion subject confirmation is not valid: expired at ",
+		},
+		{
+			name:         "assertion which is not valid yet",
+			editResponse: func(r *samltestutil.Response) { r.NotBefore = time.Now().Add(10 * time.Minute) },
+			wantErr:      "assertion conditions are not valid: not valid before ",
+		},
+		{
+			name:         "expired session",
+			editResponse: func(r *samltestutil.Response) { r.SessionNotOnOrAfter = time.Now().Add(-time.Minute) },
+			wantErr:      "assertion authentication statement is not valid: session has expired",
+		},
+		{
+			name:         "no NameID",
+			editResponse: func(r *samltestutil.Response) { r.NameID = "" },
+			wantErr:      "assertion has no NameID",
+		},
+		{
+			name:        "not base64",
+			editEncoded: func(t *testing.T, encoded string) string { return "!" },
+			wantErr:     "could not decode SAMLResponse: illegal base64 data at input byte 0",
+		},
+		{
+			name: "DTD",
+			editEncoded: editDecoded(func(s string) string {
+				return `<!DOCTYPE x [<!ENTITY e "x">]>` + s[strings.Index(s, "<samlp:Response"):]
+			}),
+			wantErr: "could not parse XML: DTDs and other directives are not allowed",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			signer := idp
+			if tt.signer != nil {
+				signer = tt.signer
+			}
+			response := signer.NewResponse(sp, requestID, "alice")
+			if tt.editResponse != nil {
+				tt.editResponse(response)
+			}
+			encoded := signer.Encode(t, response)
+			if tt.editEncoded != nil {
+				encoded = tt.editEncoded(t, encoded)
+			}
+
+			assertion, err := p.ValidateResponse(sp, encoded, requestID)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				require.Nil(t, assertion)
+				return
+			}
+			require.NoError(t, err)
+			// The assertion must be remembered until it expires, including the allowed clock skew.
+			require.True(t, strings.HasPrefix(assertion.ID, "assertion-"))
+			require.Equal(t, response.NotOnOrAfter.Truncate(time.Second).Add(maxClockSkew), assertion.NotOnOrAfter)
+			assertion.ID, assertion.NotOnOrAfter = "", time.Time{}
+			require.Equal(t, tt.wantAssertion, assertion)
+		})
+	}
+}
+
+func TestAssertionIssuerNamespace(t *testing.T) {
+	const doc = `<saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" Version="2.0">
+  <other:Issuer xmlns:other="urn:example:other">https://idp.example.com</other:Issuer>
+</saml:Assertion>`
+
+	var a assertion
+	require.NoError(t, xml.Unmarshal([]byte(doc), &a))
+	require.Empty(t, a.Issuer)
+
+	p := &ProviderConfig{EntityID: "https://idp.example.com"}
+	_, err := p.validateAssertion(&a, provider.SAMLServiceProvider{}, "", time.Now())
+	require.EqualError(t, err, `assertion has unexpected issuer ""`)
+}
+
+func editDecoded(edit func(string) string) func(t *testing.T, encoded string) string {
+	return func(t *testing.T, encoded string) string {
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		require.NoError(t, err)
+		return base64.StdEncoding.EncodeToString([]byte(edit(string(decoded))))
+	}
+}
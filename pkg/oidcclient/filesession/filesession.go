@@ -1,4 +1,4 @@
-// Copyright 2020-2021 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 // Package filesession implements a simple YAML file-based login.sessionCache.
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"time"
 
 	"github.com/gofrs/flock"
@@ -113,6 +114,25 @@ func (c *Cache) PutToken(key oidcclient.SessionCacheKey, token *oidctypes.Token)
 	})
 }
 
+// DeleteToken removes the cached data for the given parameters, if there is any. It does not return an error
+// but may silently fail to update the session cache.
+func (c *Cache) DeleteToken(key oidcclient.SessionCacheKey) {
+	// If the cache file does not exist, there is nothing to delete.
+	if _, err := os.Stat(c.path); errors.Is(err, os.ErrNotExist) {
+		return
+	}
+
+	c.withCache(func(cache *sessionCache) {
+		remaining := make([]sessionEntry, 0, len(cache.Sessions))
+		for _, s := range cache.Sessions {
+			if !reflect.DeepEqual(s.Key, key) {
+				remaining = append(remaining, s)
+			}
+		}
+		cache.Sessions = remaining
+	})
+}
+
 // withCache is an internal helper which locks, reads the cache, processes/mutates it with the provided function, then
 // saves it back to the file.
 func (c *Cache) withCache(transact func(*sessionCache)) {
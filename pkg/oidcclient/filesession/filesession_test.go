@@ -1,4 +1,4 @@
-// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package filesession
@@ -496,6 +496,110 @@ func TestPutToken(t *testing.T) {
 	}
 }
 
+func TestDeleteToken(t *testing.T) {
+	t.Parallel()
+	now := time.Now().Round(1 * time.Second)
+	key := oidcclient.SessionCacheKey{
+		Issuer:      "test-issuer",
+		ClientID:    "test-client-id",
+		Scopes:      []string{"email", "offline_access", "openid", "profile"},
+		RedirectURI: "http://localhost:0/callback",
+	}
+	otherKey := oidcclient.SessionCacheKey{
+		Issuer:      "other-test-issuer",
+		ClientID:    "test-client-id",
+		Scopes:      []string{"email", "offline_access", "openid", "profile"},
+		RedirectURI: "http://localhost:0/callback",
+	}
+	tokens := func(refreshToken string) oidctypes.Token {
+		return oidctypes.Token{
+			IDToken: &oidctypes.IDToken{
+				Token:  "test-id-token",
+				Expiry: metav1.NewTime(now.Add(1 * time.Hour)),
+			},
+			RefreshToken: &oidctypes.RefreshToken{
+				Token: refreshToken,
+			},
+		}
+	}
+
+	tests := []struct {
+		name         string
+		makeTestFile func(t *testing.T, tmp string)
+		wantErrors   []string
+		wantTestFile func(t *testing.T, tmp string)
+	}{
+		{
+			name: "file does not exist",
+			wantTestFile: func(t *testing.T, tmp string) {
+				require.NoFileExists(t, tmp)
+			},
+		},
+		{
+			name: "deletes only the matching entry",
+			makeTestFile: func(t *testing.T, tmp string) {
+				validCache := emptySessionCache()
+				validCache.insert(
+					sessionEntry{
+						Key:               key,
+						CreationTimestamp: metav1.NewTime(now.Add(-2 * time.Hour)),
+						LastUsedTimestamp: metav1.NewTime(now.Add(-1 * time.Hour)),
+						Tokens:            tokens("test-refresh-token"),
+					},
+					sessionEntry{
+						Key:               otherKey,
+						CreationTimestamp: metav1.NewTime(now.Add(-2 * time.Hour)),
+						LastUsedTimestamp: metav1.NewTime(now.Add(-1 * time.Hour)),
+						Tokens:            tokens("other-refresh-token"),
+					},
+				)
+				require.NoError(t, os.MkdirAll(filepath.Dir(tmp), 0700))
+				require.NoError(t, validCache.writeTo(tmp))
+			},
+			wantTestFile: func(t *testing.T, tmp string) {
+				cache, err := readSessionCache(tmp)
+				require.NoError(t, err)
+				require.Len(t, cache.Sessions, 1)
+				require.Equal(t, otherKey, cache.Sessions[0].Key)
+				require.Equal(t, "other-refresh-token", cache.Sessions[0].Tokens.RefreshToken.Token)
+			},
+		},
+		{
+			name: "invalid file",
+			makeTestFile: func(t *testing.T, tmp string) {
+				require.NoError(t, os.MkdirAll(filepath.Dir(tmp), 0700))
+				require.NoError(t, os.WriteFile(tmp, []byte("invalid yaml"), 0600))
+			},
+			wantErrors: []string{
+				"failed to read cache, resetting: invalid session file: error unmarshaling JSON: while decoding JSON: json: cannot unmarshal string into Go value of type filesession.sessionCache",
+			},
+			wantTestFile: func(t *testing.T, tmp string) {
+				cache, err := readSessionCache(tmp)
+				require.NoError(t, err)
+				require.Empty(t, cache.Sessions)
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			tmp := testutil.TempDir(t) + "/sessiondir/sessions.yaml"
+			if tt.makeTestFile != nil {
+				tt.makeTestFile(t, tmp)
+			}
+			// Initialize a cache with a reporter that collects errors
+			errors := errorCollector{t: t}
+			c := New(tmp, errors.collect())
+			c.DeleteToken(key)
+			errors.require(tt.wantErrors, "TEMPFILE", tmp, "TEMPDIR", filepath.Dir(tmp))
+			if tt.wantTestFile != nil {
+				tt.wantTestFile(t, tmp)
+			}
+		})
+	}
+}
+
 type errorCollector struct {
 	t   *testing.T
 	saw []error
@@ -1,4 +1,4 @@
-// Copyright 2020-2023 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 // Package oidcclient implements a CLI OIDC login flow.
@@ -6,6 +6,7 @@ package oidcclient
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -65,6 +66,11 @@ const (
 	defaultPasswordEnvVarName = "PINNIPED_PASSWORD" //nolint:gosec // this is not a credential
 
 	httpLocationHeaderName = "Location"
+
+	// defaultDeviceCodePollingInterval is how long to wait between requests to the token endpoint while using the device
+	// authorization grant, when the server did not say how long to wait. It is also how much longer to wait after the
+	// server says that the CLI is polling too quickly.
+	defaultDeviceCodePollingInterval = 5 * time.Second
 )
 
 // stdin returns the file descriptor for stdin as an int.
@@ -82,6 +88,7 @@ type handlerState struct {
 	upstreamIdentityProviderName string
 	upstreamIdentityProviderType string
 	cliToSendCredentials         bool
+	useDeviceAuthorizationGrant  bool
 
 	requestedAudience string
 
@@ -92,12 +99,13 @@ type handlerState struct {
 	callbackPath string
 
 	// Generated parameters of a login flow.
-	provider     *coreosoidc.Provider
-	oauth2Config *oauth2.Config
-	useFormPost  bool
-	state        state.State
-	nonce        nonce.Nonce
-	pkce         pkce.Code
+	provider                    *coreosoidc.Provider
+	oauth2Config                *oauth2.Config
+	useFormPost                 bool
+	deviceAuthorizationEndpoint string
+	state                       state.State
+	nonce                       nonce.Nonce
+	pkce                        pkce.Code
 
 	// External calls for things.
 	generateState   func() (state.State, error)
@@ -111,6 +119,7 @@ type handlerState struct {
 	validateIDToken func(ctx context.Context, provider *coreosoidc.Provider, audience string, token string) (*coreosoidc.IDToken, error)
 	promptForValue  func(ctx context.Context, promptLabel string) (string, error)
 	promptForSecret func(promptLabel string) (string, error)
+	sleep           func(ctx context.Context, d time.Duration) error
 
 	callbacks chan callbackResult
 }
@@ -245,6 +254,18 @@ func WithCLISendingCredentials() Option {
 	}
 }
 
+// WithDeviceAuthorizationGrant causes the login flow to use the OAuth 2.0 device authorization grant, as described in
+// https://datatracker.ietf.org/doc/html/rfc8628. Instead of opening a web browser and listening for a callback on
+// localhost, the CLI prints a link and a code, and the user may finish their login using a web browser on any device.
+// This is useful when the CLI is running on a host where the user cannot open a web browser, e.g. a host reached by SSH.
+// The issuer must advertise a device_authorization_endpoint in its OIDC discovery metadata.
+func WithDeviceAuthorizationGrant() Option {
+	return func(h *handlerState) error {
+		h.useDeviceAuthorizationGrant = true
+		return nil
+	}
+}
+
 // WithUpstreamIdentityProvider causes the specified name and type to be sent as custom query parameters to the
 // issuer's authorize endpoint. This is only intended to be used when the issuer is a Pinniped Supervisor, in which
 // case it provides a mechanism to choose among several upstream identity providers.
@@ -291,6 +312,7 @@ func Login(issuer string, clientID string, opts ...Option) (*oidctypes.Token, er
 		},
 		promptForValue:  promptForValue,
 		promptForSecret: promptForSecret,
+		sleep:           sleep,
 	}
 	for _, opt := range opts {
 		if err := opt(&h); err != nil {
@@ -343,15 +365,20 @@ func Login(issuer string, clientID string, opts ...Option) (*oidctypes.Token, er
 	return exchangedToken, nil
 }
 
-func (h *handlerState) baseLogin() (*oidctypes.Token, error) {
-	// Check the cache for a previous session issued with the same parameters.
+// sessionCacheKey returns the key of the session cache entry for the current parameters.
+func (h *handlerState) sessionCacheKey() SessionCacheKey {
 	sort.Strings(h.scopes)
-	cacheKey := SessionCacheKey{
+	return SessionCacheKey{
 		Issuer:      h.issuer,
 		ClientID:    h.clientID,
 		Scopes:      h.scopes,
 		RedirectURI: (&url.URL{Scheme: "http", Host: h.listenAddr, Path: h.callbackPath}).String(),
 	}
+}
+
+func (h *handlerState) baseLogin() (*oidctypes.Token, error) {
+	// Check the cache for a previous session issued with the same parameters.
+	cacheKey := h.sessionCacheKey()
 
 	// If the ID token is still valid for a bit, return it immediately and skip the rest of the flow.
 	cached := h.cache.GetToken(cacheKey)
@@ -398,6 +425,8 @@ func (h *handlerState) baseLogin() (*oidctypes.Token, error) {
 	var authFunc = h.webBrowserBasedAuth
 	if h.cliToSendCredentials {
 		authFunc = h.cliBasedAuth
+	} else if h.useDeviceAuthorizationGrant {
+		authFunc = h.deviceBasedAuth
 	}
 
 	// Perform the authorize request and authcode exchange to get back OIDC tokens.
@@ -644,6 +673,189 @@ func (h *handlerState) promptForWebLogin(ctx context.Context, authorizeURL strin
 	return wg.Wait
 }
 
+// Use the device authorization grant to get tokens. Ask the user to visit the verification URL using a web browser
+// on any device and to enter the user code there, then poll the token endpoint until the user has finished their
+// login. Return the tokens or an error.
+func (h *handlerState) deviceBasedAuth(_ *[]oauth2.AuthCodeOption) (*oidctypes.Token, error) {
+	if h.deviceAuthorizationEndpoint == "" {
+		return nil, fmt.Errorf("issuer %q does not support the device authorization grant", h.issuer)
+	}
+	if err := validateURLUsesHTTPS(h.deviceAuthorizationEndpoint, "discovered device authorization URL from issuer"); err != nil {
+		return nil, err
+	}
+
+	authorization, err := h.startDeviceAuthorization()
+	if err != nil {
+		return nil, err
+	}
+
+	_, _ = fmt.Fprintf(os.Stderr, "Log in by visiting this link using a web browser on any device:\n\n    %s\n\nand entering the code: %s\n\n",
+		authorization.VerificationURI, authorization.UserCode)
+	if authorization.VerificationURIComplete != "" {
+		_, _ = fmt.Fprintf(os.Stderr, "Or visit this link, which already includes the code:\n\n    %s\n\n", authorization.VerificationURIComplete)
+	}
+
+	// Poll the token endpoint at the interval which was requested by the server, as described in
+	// https://datatracker.ietf.org/doc/html/rfc8628#section-3.5.
+	interval := time.Duration(authorization.Interval) * time.Second
+	if interval <= 0 {
+		interval = defaultDeviceCodePollingInterval
+	}
+	for {
+		if err := h.sleep(h.ctx, interval); err != nil {
+			return nil, fmt.Errorf("timed out waiting for device authorization: %w", err)
+		}
+
+		token, errorCode, err := h.pollDeviceAccessToken(authorization.DeviceCode)
+		if err != nil {
+			return nil, err
+		}
+		switch errorCode {
+		case "":
+			return token, nil
+		case "authorization_pending":
+			continue
+		case "slow_down":
+			interval += defaultDeviceCodePollingInterval
+			continue
+		case "expired_token":
+			return nil, fmt.Errorf("login failed: the code expired before the login was finished")
+		default:
+			return nil, fmt.Errorf("login failed with code %q", errorCode)
+		}
+	}
+}
+
+type deviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+// oauth2ErrorResponse is the error response of an OAuth 2.0 endpoint, as described in
+// https://datatracker.ietf.org/doc/html/rfc6749#section-5.2.
+type oauth2ErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func (h *handlerState) startDeviceAuthorization() (*deviceAuthorizationResponse, error) {
+	form := url.Values{
+		"client_id": []string{h.clientID},
+		"scope":     []string{strings.Join(h.scopes, " ")},
+	}
+	if h.upstreamIdentityProviderName != "" {
+		form.Set(oidcapi.AuthorizeUpstreamIDPNameParamName, h.upstreamIdentityProviderName)
+		form.Set(oidcapi.AuthorizeUpstreamIDPTypeParamName, h.upstreamIdentityProviderType)
+	}
+
+	resp, err := h.postForm(h.deviceAuthorizationEndpoint, form)
+	if err != nil {
+		return nil, fmt.Errorf("device authorization request error: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		var errorResponse oauth2ErrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&errorResponse); err != nil || errorResponse.Error == "" {
+			return nil, fmt.Errorf("device authorization request failed with unexpected HTTP response status %d", resp.StatusCode)
+		}
+		if errorResponse.ErrorDescription == "" {
+			return nil, fmt.Errorf("device authorization request failed with code %q", errorResponse.Error)
+		}
+		return nil, fmt.Errorf("device authorization request failed with code %q: %s", errorResponse.Error, errorResponse.ErrorDescription)
+	}
+
+	var authorization deviceAuthorizationResponse
+	if err := json.NewDecoder(resp.Body).Decode(&authorization); err != nil {
+		return nil, fmt.Errorf("failed to decode device authorization response: %w", err)
+	}
+	if authorization.DeviceCode == "" || authorization.UserCode == "" || authorization.VerificationURI == "" {
+		return nil, fmt.Errorf("device authorization response is missing required fields")
+	}
+	return &authorization, nil
+}
+
+// pollDeviceAccessToken makes one request to the token endpoint using the device code. When the login is not
+// finished, it returns the error code from the server, which tells the CLI whether it should continue polling.
+func (h *handlerState) pollDeviceAccessToken(deviceCode string) (*oidctypes.Token, string, error) {
+	resp, err := h.postForm(h.oauth2Config.Endpoint.TokenURL, url.Values{
+		"client_id":   []string{h.clientID},
+		"grant_type":  []string{oidcapi.GrantTypeDeviceCode},
+		"device_code": []string{deviceCode},
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("device access token request error: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		var errorResponse oauth2ErrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&errorResponse); err != nil || errorResponse.Error == "" {
+			return nil, "", fmt.Errorf("device access token request failed with unexpected HTTP response status %d", resp.StatusCode)
+		}
+		return nil, errorResponse.Error, nil
+	}
+
+	var rawResponse map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&rawResponse); err != nil {
+		return nil, "", fmt.Errorf("failed to decode device access token response: %w", err)
+	}
+	tok := &oauth2.Token{}
+	tok.AccessToken, _ = rawResponse["access_token"].(string)
+	tok.TokenType, _ = rawResponse["token_type"].(string)
+	tok.RefreshToken, _ = rawResponse["refresh_token"].(string)
+	if expiresIn, ok := rawResponse["expires_in"].(float64); ok && expiresIn > 0 {
+		tok.Expiry = time.Now().Add(time.Duration(expiresIn) * time.Second)
+	}
+	tok = tok.WithExtra(rawResponse)
+
+	// The ID token's nonce was chosen by the server when it acted as the client of its own authorize endpoint on
+	// behalf of this CLI, so skip the nonce validation here (but not other validations).
+	token, err := h.getProvider(h.oauth2Config, h.provider, h.httpClient).ValidateTokenAndMergeWithUserInfo(h.ctx, tok, "", true, false)
+	if err != nil {
+		return nil, "", fmt.Errorf("error during device access token request: %w", err)
+	}
+	return token, "", nil
+}
+
+func (h *handlerState) postForm(endpoint string, form url.Values) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(h.ctx, httpRequestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("could not build request: %w", err)
+	}
+	req.Header.Set("content-type", "application/x-www-form-urlencoded")
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	// Read the whole body before the request's context is canceled.
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("could not read response: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// sleep waits for the given duration, or returns an error when the context is done first.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
 func promptForValue(ctx context.Context, promptLabel string) (string, error) {
 	if !term.IsTerminal(stdin()) {
 		return "", errors.New("stdin is not connected to a terminal")
@@ -737,12 +949,14 @@ func (h *handlerState) initOIDCDiscovery() error {
 
 	// Use response_mode=form_post if the provider supports it.
 	var discoveryClaims struct {
-		ResponseModesSupported []string `json:"response_modes_supported"`
+		ResponseModesSupported      []string `json:"response_modes_supported"`
+		DeviceAuthorizationEndpoint string   `json:"device_authorization_endpoint"`
 	}
 	if err := h.provider.Claims(&discoveryClaims); err != nil {
 		return fmt.Errorf("could not decode response_modes_supported in OIDC discovery from %q: %w", h.issuer, err)
 	}
 	h.useFormPost = slices.Contains(discoveryClaims.ResponseModesSupported, "form_post")
+	h.deviceAuthorizationEndpoint = discoveryClaims.DeviceAuthorizationEndpoint
 	return nil
 }
 
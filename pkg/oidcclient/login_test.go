@@ -1,4 +1,4 @@
-// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package oidcclient
@@ -1935,6 +1935,183 @@ func TestLogin(t *testing.T) { //nolint:gocyclo
 	}
 }
 
+func TestLoginWithDeviceAuthorizationGrant(t *testing.T) {
+	testToken := oidctypes.Token{
+		AccessToken:  &oidctypes.AccessToken{Token: "test-access-token", Expiry: metav1.NewTime(time.Now().Add(time.Minute))},
+		RefreshToken: &oidctypes.RefreshToken{Token: "test-refresh-token"},
+		IDToken:      &oidctypes.IDToken{Token: "test-id-token", Expiry: metav1.NewTime(time.Now().Add(2 * time.Minute))},
+	}
+
+	tests := []struct {
+		name                          string
+		withoutDeviceEndpoint         bool
+		deviceAuthorizationStatus     int
+		deviceAuthorizationResponse   string
+		tokenErrorCodes               []string
+		sleepErr                      error
+		wantDeviceAuthorizationParams url.Values
+		wantSleeps                    []time.Duration
+		wantErr                       string
+	}{
+		{
+			name:            "happy path",
+			tokenErrorCodes: []string{"authorization_pending", "slow_down", "authorization_pending"},
+			wantDeviceAuthorizationParams: url.Values{
+				"client_id":         {"test-client-id"},
+				"scope":             {"test-scope"},
+				"pinniped_idp_name": {"some-idp"},
+				"pinniped_idp_type": {"oidc"},
+			},
+			wantSleeps: []time.Duration{3 * time.Second, 3 * time.Second, 8 * time.Second, 8 * time.Second},
+		},
+		{
+			name:                        "server does not say how often to poll",
+			deviceAuthorizationResponse: `{"device_code":"test-device-code","user_code":"BCDF-GHJK","verification_uri":"https://example.com/device"}`,
+			wantSleeps:                  []time.Duration{5 * time.Second},
+		},
+		{
+			name:                  "issuer does not support the device authorization grant",
+			withoutDeviceEndpoint: true,
+			wantErr:               "does not support the device authorization grant",
+		},
+		{
+			name:                        "device authorization request fails",
+			deviceAuthorizationStatus:   http.StatusBadRequest,
+			deviceAuthorizationResponse: `{"error":"unauthorized_client","error_description":"some description"}`,
+			wantErr:                     `device authorization request failed with code "unauthorized_client": some description`,
+		},
+		{
+			name:                        "device authorization request fails without an OAuth 2.0 error",
+			deviceAuthorizationStatus:   http.StatusInternalServerError,
+			deviceAuthorizationResponse: `some error`,
+			wantErr:                     "device authorization request failed with unexpected HTTP response status 500",
+		},
+		{
+			name:                        "device authorization response is missing fields",
+			deviceAuthorizationResponse: `{"user_code":"BCDF-GHJK"}`,
+			wantErr:                     "device authorization response is missing required fields",
+		},
+		{
+			name:            "code expires",
+			tokenErrorCodes: []string{"authorization_pending", "expired_token"},
+			wantSleeps:      []time.Duration{3 * time.Second, 3 * time.Second},
+			wantErr:         "login failed: the code expired before the login was finished",
+		},
+		{
+			name:            "login fails",
+			tokenErrorCodes: []string{"access_denied"},
+			wantSleeps:      []time.Duration{3 * time.Second},
+			wantErr:         `login failed with code "access_denied"`,
+		},
+		{
+			name:       "times out while waiting",
+			sleepErr:   context.DeadlineExceeded,
+			wantSleeps: []time.Duration{3 * time.Second},
+			wantErr:    "timed out waiting for device authorization: context deadline exceeded",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var sawDeviceAuthorizationParams url.Values
+			tokenRequests := 0
+
+			mux := http.NewServeMux()
+			server := tlsserver.TLSTestServer(t, mux, nil)
+			mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+				deviceEndpoint := server.URL + "/device_authorization"
+				if tt.withoutDeviceEndpoint {
+					deviceEndpoint = ""
+				}
+				w.Header().Set("content-type", "application/json")
+				_ = json.NewEncoder(w).Encode(&struct {
+					Issuer         string `json:"issuer"`
+					AuthURL        string `json:"authorization_endpoint"`
+					TokenURL       string `json:"token_endpoint"`
+					JWKSURL        string `json:"jwks_uri"`
+					DeviceEndpoint string `json:"device_authorization_endpoint,omitempty"`
+				}{
+					Issuer:         server.URL,
+					AuthURL:        server.URL + "/authorize",
+					TokenURL:       server.URL + "/token",
+					JWKSURL:        server.URL + "/keys",
+					DeviceEndpoint: deviceEndpoint,
+				})
+			})
+			mux.HandleFunc("/device_authorization", func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, http.MethodPost, r.Method)
+				require.NoError(t, r.ParseForm())
+				sawDeviceAuthorizationParams = r.PostForm
+				if tt.deviceAuthorizationStatus != 0 {
+					w.WriteHeader(tt.deviceAuthorizationStatus)
+				}
+				response := tt.deviceAuthorizationResponse
+				if response == "" {
+					response = `{"device_code":"test-device-code","user_code":"BCDF-GHJK","verification_uri":"https://example.com/device",` +
+						`"verification_uri_complete":"https://example.com/device?user_code=BCDF-GHJK","expires_in":900,"interval":3}`
+				}
+				_, _ = w.Write([]byte(response))
+			})
+			mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, http.MethodPost, r.Method)
+				require.NoError(t, r.ParseForm())
+				require.Equal(t, url.Values{
+					"client_id":   {"test-client-id"},
+					"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+					"device_code": {"test-device-code"},
+				}, r.PostForm)
+				w.Header().Set("content-type", "application/json")
+				if tokenRequests < len(tt.tokenErrorCodes) {
+					w.WriteHeader(http.StatusBadRequest)
+					_, _ = fmt.Fprintf(w, `{"error":%q}`, tt.tokenErrorCodes[tokenRequests])
+					tokenRequests++
+					return
+				}
+				tokenRequests++
+				_, _ = w.Write([]byte(`{"access_token":"test-access-token","token_type":"bearer","expires_in":60,"refresh_token":"test-refresh-token","id_token":"test-id-token"}`))
+			})
+
+			var sawSleeps []time.Duration
+			tok, err := Login(server.URL, "test-client-id",
+				WithContext(context.Background()),
+				WithScopes([]string{"test-scope"}),
+				WithDeviceAuthorizationGrant(),
+				WithUpstreamIdentityProvider("some-idp", "oidc"),
+				WithClient(newClientForServer(server)),
+				func(h *handlerState) error {
+					h.sleep = func(_ context.Context, d time.Duration) error {
+						sawSleeps = append(sawSleeps, d)
+						return tt.sleepErr
+					}
+					h.listen = func(string, string) (net.Listener, error) {
+						t.Fatal("should not listen for a callback")
+						return nil, nil
+					}
+					h.getProvider = func(_ *oauth2.Config, _ *oidc.Provider, _ *http.Client) provider.UpstreamOIDCIdentityProviderI {
+						mock := mockUpstream(t)
+						mock.EXPECT().
+							ValidateTokenAndMergeWithUserInfo(gomock.Any(), HasAccessToken(testToken.AccessToken.Token), nonce.Nonce(""), true, false).
+							Return(&testToken, nil)
+						return mock
+					}
+					return nil
+				},
+			)
+			require.Equal(t, tt.wantSleeps, sawSleeps)
+			if tt.wantDeviceAuthorizationParams != nil {
+				require.Equal(t, tt.wantDeviceAuthorizationParams, sawDeviceAuthorizationParams)
+			}
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				require.Nil(t, tok)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, &testToken, tok)
+		})
+	}
+}
+
 func TestHandlePasteCallback(t *testing.T) {
 	const testRedirectURI = "http://127.0.0.1:12324/callback"
 
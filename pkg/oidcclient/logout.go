@@ -0,0 +1,127 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package oidcclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	coreosoidc "github.com/coreos/go-oidc/v3/oidc"
+	"github.com/go-logr/logr"
+
+	oidcapi "go.pinniped.dev/generated/latest/apis/supervisor/oidc"
+	"go.pinniped.dev/internal/net/phttp"
+	"go.pinniped.dev/internal/plog"
+)
+
+// DeletableSessionCache is a SessionCache which can also remove a session. Logout requires one.
+type DeletableSessionCache interface {
+	SessionCache
+	DeleteToken(SessionCacheKey)
+}
+
+// Logout ends a session which was previously started by Login with the same issuer, client ID, and options.
+//
+// The session is removed from the session cache, which must be a DeletableSessionCache. Then, if the issuer
+// advertises an RFC 7009 revocation endpoint in its discovery document, the cached refresh token is revoked so
+// that the session also ends on the issuer. The session is removed from the cache even when revocation fails.
+func Logout(issuer string, clientID string, opts ...Option) error {
+	h := handlerState{
+		issuer:       issuer,
+		clientID:     clientID,
+		listenAddr:   "localhost:0",
+		scopes:       []string{oidcapi.ScopeOfflineAccess, oidcapi.ScopeOpenID, oidcapi.ScopeEmail, oidcapi.ScopeProfile},
+		cache:        &nopCache{},
+		callbackPath: "/callback",
+		ctx:          context.Background(),
+		logger:       logr.Discard(), // discard logs unless a logger is specified
+		httpClient:   phttp.Default(nil),
+	}
+	for _, opt := range opts {
+		if err := opt(&h); err != nil {
+			return err
+		}
+	}
+
+	cache, ok := h.cache.(DeletableSessionCache)
+	if !ok {
+		return fmt.Errorf("session cache does not support deleting sessions")
+	}
+
+	// Copy the configured HTTP client to set a request timeout (the Go default client has no timeout configured).
+	httpClientWithTimeout := *h.httpClient
+	httpClientWithTimeout.Timeout = httpRequestTimeout
+	h.httpClient = &httpClientWithTimeout
+
+	ctx, cancel := context.WithTimeout(h.ctx, httpRequestTimeout)
+	defer cancel()
+	h.ctx = coreosoidc.ClientContext(ctx, h.httpClient)
+
+	cacheKey := h.sessionCacheKey()
+	cached := cache.GetToken(cacheKey)
+	if cached == nil {
+		h.logger.V(plog.KlogLevelDebug).Info("Pinniped: No cached session found, nothing to log out.")
+		return nil
+	}
+
+	// Always forget the session locally, even if the issuer cannot be reached.
+	cache.DeleteToken(cacheKey)
+	h.logger.V(plog.KlogLevelDebug).Info("Pinniped: Removed session from the session cache.")
+
+	if cached.RefreshToken == nil || cached.RefreshToken.Token == "" {
+		return nil
+	}
+	if err := h.revokeRefreshToken(cached.RefreshToken.Token); err != nil {
+		return fmt.Errorf("could not revoke refresh token: %w", err)
+	}
+	return nil
+}
+
+func (h *handlerState) revokeRefreshToken(refreshToken string) error {
+	if err := h.initOIDCDiscovery(); err != nil {
+		return err
+	}
+
+	var discoveryClaims struct {
+		RevocationEndpoint string `json:"revocation_endpoint"`
+	}
+	if err := h.provider.Claims(&discoveryClaims); err != nil {
+		return fmt.Errorf("could not decode revocation_endpoint in OIDC discovery from %q: %w", h.issuer, err)
+	}
+	if discoveryClaims.RevocationEndpoint == "" {
+		h.logger.V(plog.KlogLevelDebug).Info("Pinniped: Issuer does not advertise a revocation endpoint, skipping revocation.")
+		return nil
+	}
+	if err := validateURLUsesHTTPS(discoveryClaims.RevocationEndpoint, "discovered revocation URL from issuer"); err != nil {
+		return err
+	}
+
+	h.logger.V(plog.KlogLevelDebug).Info("Pinniped: Revoking refresh token", "revocationURL", discoveryClaims.RevocationEndpoint)
+	reqBody := strings.NewReader(url.Values{
+		"client_id":       []string{h.clientID},
+		"token":           []string{refreshToken},
+		"token_type_hint": []string{"refresh_token"},
+	}.Encode())
+	req, err := http.NewRequestWithContext(h.ctx, http.MethodPost, discoveryClaims.RevocationEndpoint, reqBody)
+	if err != nil {
+		return fmt.Errorf("could not build revocation request: %w", err)
+	}
+	req.Header.Set("content-type", "application/x-www-form-urlencoded")
+
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	// RFC 7009 says that the server responds with 200 both when the token was revoked and when the token was
+	// already invalid, so any other status is an error.
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected HTTP response status %d", resp.StatusCode)
+	}
+	return nil
+}
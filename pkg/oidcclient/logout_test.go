@@ -0,0 +1,202 @@
+// Copyright 2026 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package oidcclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"go.pinniped.dev/internal/testutil/tlsserver"
+	"go.pinniped.dev/pkg/oidcclient/oidctypes"
+)
+
+type mockDeletableSessionCache struct {
+	mockSessionCache
+	sawDeleteKeys []SessionCacheKey
+}
+
+func (m *mockDeletableSessionCache) DeleteToken(key SessionCacheKey) {
+	m.t.Logf("saw mock session cache DeleteToken() with client ID %s", key.ClientID)
+	m.sawDeleteKeys = append(m.sawDeleteKeys, key)
+}
+
+func TestLogout(t *testing.T) {
+	discoveryHandler := func(server *httptest.Server, revocationEndpoint string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("content-type", "application/json")
+			_ = json.NewEncoder(w).Encode(&struct {
+				Issuer             string `json:"issuer"`
+				AuthURL            string `json:"authorization_endpoint"`
+				TokenURL           string `json:"token_endpoint"`
+				JWKSURL            string `json:"jwks_uri"`
+				RevocationEndpoint string `json:"revocation_endpoint,omitempty"`
+			}{
+				Issuer:             server.URL,
+				AuthURL:            server.URL + "/authorize",
+				TokenURL:           server.URL + "/token",
+				JWKSURL:            server.URL + "/keys",
+				RevocationEndpoint: revocationEndpoint,
+			})
+		}
+	}
+
+	var sawRevocationForms []url.Values
+	revocationHandler := func(status int) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, http.MethodPost, r.Method)
+			require.NoError(t, r.ParseForm())
+			sawRevocationForms = append(sawRevocationForms, r.PostForm)
+			w.WriteHeader(status)
+		}
+	}
+
+	successMux := http.NewServeMux()
+	successServer := tlsserver.TLSTestServer(t, successMux, nil)
+	successMux.HandleFunc("/.well-known/openid-configuration", discoveryHandler(successServer, successServer.URL+"/revoke"))
+	successMux.HandleFunc("/revoke", revocationHandler(http.StatusOK))
+
+	failureMux := http.NewServeMux()
+	failureServer := tlsserver.TLSTestServer(t, failureMux, nil)
+	failureMux.HandleFunc("/.well-known/openid-configuration", discoveryHandler(failureServer, failureServer.URL+"/revoke"))
+	failureMux.HandleFunc("/revoke", revocationHandler(http.StatusUnauthorized))
+
+	noRevocationMux := http.NewServeMux()
+	noRevocationServer := tlsserver.TLSTestServer(t, noRevocationMux, nil)
+	noRevocationMux.HandleFunc("/.well-known/openid-configuration", discoveryHandler(noRevocationServer, ""))
+
+	insecureRevocationMux := http.NewServeMux()
+	insecureRevocationServer := tlsserver.TLSTestServer(t, insecureRevocationMux, nil)
+	insecureRevocationMux.HandleFunc("/.well-known/openid-configuration", discoveryHandler(insecureRevocationServer, "http://insecure-issuer.com/revoke"))
+
+	errorServer := tlsserver.TLSTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "some discovery error", http.StatusInternalServerError)
+	}), nil)
+
+	cachedToken := &oidctypes.Token{
+		IDToken:      &oidctypes.IDToken{Token: "test-id-token"},
+		RefreshToken: &oidctypes.RefreshToken{Token: "test-refresh-token"},
+	}
+
+	tests := []struct {
+		name               string
+		server             *httptest.Server
+		cache              func(t *testing.T) SessionCache
+		cachedToken        *oidctypes.Token
+		wantErr            string
+		wantDeleted        bool
+		wantRevocationForm url.Values
+	}{
+		{
+			name:    "session cache cannot delete",
+			server:  successServer,
+			cache:   func(t *testing.T) SessionCache { return &mockSessionCache{t: t} },
+			wantErr: "session cache does not support deleting sessions",
+		},
+		{
+			name:   "no cached session",
+			server: successServer,
+		},
+		{
+			name:        "cached session without a refresh token",
+			server:      successServer,
+			cachedToken: &oidctypes.Token{IDToken: &oidctypes.IDToken{Token: "test-id-token"}},
+			wantDeleted: true,
+		},
+		{
+			name:        "refresh token is revoked",
+			server:      successServer,
+			cachedToken: cachedToken,
+			wantDeleted: true,
+			wantRevocationForm: url.Values{
+				"client_id":       []string{"test-client-id"},
+				"token":           []string{"test-refresh-token"},
+				"token_type_hint": []string{"refresh_token"},
+			},
+		},
+		{
+			name:        "issuer has no revocation endpoint",
+			server:      noRevocationServer,
+			cachedToken: cachedToken,
+			wantDeleted: true,
+		},
+		{
+			name:        "revocation endpoint is not https",
+			server:      insecureRevocationServer,
+			cachedToken: cachedToken,
+			wantDeleted: true,
+			wantErr:     `could not revoke refresh token: discovered revocation URL from issuer must be an https URL, but had scheme "http" instead`,
+		},
+		{
+			name:        "revocation fails",
+			server:      failureServer,
+			cachedToken: cachedToken,
+			wantDeleted: true,
+			wantErr:     "could not revoke refresh token: unexpected HTTP response status 401",
+			wantRevocationForm: url.Values{
+				"client_id":       []string{"test-client-id"},
+				"token":           []string{"test-refresh-token"},
+				"token_type_hint": []string{"refresh_token"},
+			},
+		},
+		{
+			name:        "discovery fails",
+			server:      errorServer,
+			cachedToken: cachedToken,
+			wantDeleted: true,
+			wantErr:     fmt.Sprintf("could not revoke refresh token: could not perform OIDC discovery for %q: 500 Internal Server Error: some discovery error\n", errorServer.URL),
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			sawRevocationForms = nil
+
+			deletableCache := &mockDeletableSessionCache{mockSessionCache: mockSessionCache{t: t, getReturnsToken: tt.cachedToken}}
+			var cache SessionCache = deletableCache
+			if tt.cache != nil {
+				cache = tt.cache(t)
+			}
+
+			err := Logout(tt.server.URL, "test-client-id",
+				WithContext(context.Background()),
+				WithScopes([]string{"test-scope-2", "test-scope-1"}),
+				WithSessionCache(cache),
+				WithClient(newClientForServer(tt.server)),
+			)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			if tt.cache != nil {
+				return
+			}
+			wantKey := SessionCacheKey{
+				Issuer:      tt.server.URL,
+				ClientID:    "test-client-id",
+				Scopes:      []string{"test-scope-1", "test-scope-2"},
+				RedirectURI: "http://localhost:0/callback",
+			}
+			require.Equal(t, []SessionCacheKey{wantKey}, deletableCache.sawGetKeys)
+			if tt.wantDeleted {
+				require.Equal(t, []SessionCacheKey{wantKey}, deletableCache.sawDeleteKeys)
+			} else {
+				require.Empty(t, deletableCache.sawDeleteKeys)
+			}
+			if tt.wantRevocationForm != nil {
+				require.Equal(t, []url.Values{tt.wantRevocationForm}, sawRevocationForms)
+			} else {
+				require.Empty(t, sawRevocationForms)
+			}
+		})
+	}
+}
@@ -1,4 +1,4 @@
-// Copyright 2022-2023 the Pinniped contributors. All Rights Reserved.
+// Copyright 2022-2026 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package integration
@@ -153,7 +153,7 @@ func TestOIDCClientStaticValidation_Parallel(t *testing.T) {
 					},
 				},
 			},
-			wantErr: `OIDCClient.config.supervisor.pinniped.dev "client.oauth.pinniped.dev-hello" is invalid: spec.allowedRedirectURIs[1]: Invalid value: "oob": spec.allowedRedirectURIs[1] in body should match '^https://.+|^http://(127\.0\.0\.1|\[::1\])(:\d+)?/'`,
+			wantErr: `OIDCClient.config.supervisor.pinniped.dev "client.oauth.pinniped.dev-hello" is invalid: spec.allowedRedirectURIs[1]: Invalid value: "oob": spec.allowedRedirectURIs[1] in body should match '^https://.+|^http://(127\.0\.0\.1|\[::1\])(:\d+)?/|^[a-z][a-z0-9+-]*(\.[a-z0-9+-]+)+:/'`,
 		},
 		{
 			name: "bad grant type",
@@ -175,7 +175,7 @@ func TestOIDCClientStaticValidation_Parallel(t *testing.T) {
 					},
 				},
 			},
-			wantErr: `OIDCClient.config.supervisor.pinniped.dev "client.oauth.pinniped.dev-sky" is invalid: spec.allowedGrantTypes[2]: Unsupported value: "bird": supported values: "authorization_code", "refresh_token", "urn:ietf:params:oauth:grant-type:token-exchange"`,
+			wantErr: `OIDCClient.config.supervisor.pinniped.dev "client.oauth.pinniped.dev-sky" is invalid: spec.allowedGrantTypes[2]: Unsupported value: "bird": supported values: "authorization_code", "refresh_token", "urn:ietf:params:oauth:grant-type:token-exchange", "client_credentials"`,
 		},
 		{
 			name: "bad scope",
@@ -359,7 +359,7 @@ func TestOIDCClientStaticValidation_Parallel(t *testing.T) {
 				statusErr.ErrStatus.Message = errPrefix + strings.Join(out, ", ") + "]"
 				return want // leave the wanted error unchanged
 			},
-			wantErr: `OIDCClient.config.supervisor.pinniped.dev "zone" is invalid: [metadata.name: Invalid value: "zone": metadata.name in body should match '^client\.oauth\.pinniped\.dev-', spec.allowedGrantTypes[0]: Unsupported value: "the": supported values: "authorization_code", "refresh_token", "urn:ietf:params:oauth:grant-type:token-exchange", spec.allowedRedirectURIs[0]: Invalid value: "of": spec.allowedRedirectURIs[0] in body should match '^https://.+|^http://(127\.0\.0\.1|\[::1\])(:\d+)?/', spec.allowedScopes[0]: Unsupported value: "enders": supported values: "openid", "offline_access", "username", "groups", "pinniped:request-audience"]`,
+			wantErr: `OIDCClient.config.supervisor.pinniped.dev "zone" is invalid: [metadata.name: Invalid value: "zone": metadata.name in body should match '^client\.oauth\.pinniped\.dev-', spec.allowedGrantTypes[0]: Unsupported value: "the": supported values: "authorization_code", "refresh_token", "urn:ietf:params:oauth:grant-type:token-exchange", "client_credentials", spec.allowedRedirectURIs[0]: Invalid value: "of": spec.allowedRedirectURIs[0] in body should match '^https://.+|^http://(127\.0\.0\.1|\[::1\])(:\d+)?/|^[a-z][a-z0-9+-]*(\.[a-z0-9+-]+)+:/', spec.allowedScopes[0]: Unsupported value: "enders": supported values: "openid", "offline_access", "username", "groups", "pinniped:request-audience"]`,
 		},
 		{
 			name: "just the prefix is not valid",
@@ -549,6 +549,12 @@ func TestOIDCClientControllerValidations_Parallel(t *testing.T) {
 					Reason:  "MissingRequiredValue",
 					Message: `"authorization_code" must always be included in "allowedGrantTypes"`,
 				},
+				{
+					Type:    "AllowedRedirectURIsValid",
+					Status:  "True",
+					Reason:  "Success",
+					Message: `"allowedRedirectURIs" and "allowedPostLogoutRedirectURIs" are valid`,
+				},
 				{
 					Type:    "AllowedScopesValid",
 					Status:  "False",
@@ -561,6 +567,12 @@ func TestOIDCClientControllerValidations_Parallel(t *testing.T) {
 					Reason:  "NoClientSecretFound",
 					Message: `no client secret found (no Secret storage found)`,
 				},
+				{
+					Type:    "TokenEndpointAuthMethodValid",
+					Status:  "True",
+					Reason:  "Success",
+					Message: `"tokenEndpointAuthMethod" is valid`,
+				},
 			},
 		},
 		{
@@ -584,6 +596,12 @@ func TestOIDCClientControllerValidations_Parallel(t *testing.T) {
 					Reason:  "Success",
 					Message: `"allowedGrantTypes" is valid`,
 				},
+				{
+					Type:    "AllowedRedirectURIsValid",
+					Status:  "True",
+					Reason:  "Success",
+					Message: `"allowedRedirectURIs" and "allowedPostLogoutRedirectURIs" are valid`,
+				},
 				{
 					Type:    "AllowedScopesValid",
 					Status:  "True",
@@ -596,6 +614,12 @@ func TestOIDCClientControllerValidations_Parallel(t *testing.T) {
 					Reason:  "NoClientSecretFound",
 					Message: `no client secret found (empty list in storage)`,
 				},
+				{
+					Type:    "TokenEndpointAuthMethodValid",
+					Status:  "True",
+					Reason:  "Success",
+					Message: `"tokenEndpointAuthMethod" is valid`,
+				},
 			},
 		},
 		{
@@ -619,6 +643,12 @@ func TestOIDCClientControllerValidations_Parallel(t *testing.T) {
 					Reason:  "Success",
 					Message: `"allowedGrantTypes" is valid`,
 				},
+				{
+					Type:    "AllowedRedirectURIsValid",
+					Status:  "True",
+					Reason:  "Success",
+					Message: `"allowedRedirectURIs" and "allowedPostLogoutRedirectURIs" are valid`,
+				},
 				{
 					Type:    "AllowedScopesValid",
 					Status:  "True",
@@ -631,6 +661,59 @@ func TestOIDCClientControllerValidations_Parallel(t *testing.T) {
 					Reason:  "Success",
 					Message: `1 client secret(s) found`,
 				},
+				{
+					Type:    "TokenEndpointAuthMethodValid",
+					Status:  "True",
+					Reason:  "Success",
+					Message: `"tokenEndpointAuthMethod" is valid`,
+				},
+			},
+		},
+		{
+			name: "happy path example of a public client without any client secrets",
+			client: &supervisorconfigv1alpha1.OIDCClient{
+				ObjectMeta: metav1.ObjectMeta{
+					GenerateName: "client.oauth.pinniped.dev-",
+				},
+				Spec: supervisorconfigv1alpha1.OIDCClientSpec{
+					Public:              true,
+					AllowedRedirectURIs: []supervisorconfigv1alpha1.RedirectURI{"http://127.0.0.1/callback", "dev.pinniped.test.app:/callback"},
+					AllowedGrantTypes:   []supervisorconfigv1alpha1.GrantType{"authorization_code", "refresh_token"},
+					AllowedScopes:       []supervisorconfigv1alpha1.Scope{"openid", "offline_access", "username", "groups"},
+				},
+			},
+			wantPhase: "Ready",
+			wantConditions: []supervisorconfigv1alpha1.Condition{
+				{
+					Type:    "AllowedGrantTypesValid",
+					Status:  "True",
+					Reason:  "Success",
+					Message: `"allowedGrantTypes" is valid`,
+				},
+				{
+					Type:    "AllowedRedirectURIsValid",
+					Status:  "True",
+					Reason:  "Success",
+					Message: `"allowedRedirectURIs" and "allowedPostLogoutRedirectURIs" are valid`,
+				},
+				{
+					Type:    "AllowedScopesValid",
+					Status:  "True",
+					Reason:  "Success",
+					Message: `"allowedScopes" is valid`,
+				},
+				{
+					Type:    "NoClientSecretExists",
+					Status:  "True",
+					Reason:  "Success",
+					Message: `no client secret found, as required for public clients`,
+				},
+				{
+					Type:    "TokenEndpointAuthMethodValid",
+					Status:  "True",
+					Reason:  "Success",
+					Message: `"tokenEndpointAuthMethod" is valid`,
+				},
 			},
 		},
 		// Note: there are many more possible combinations of these settings, but they are covered by the controller's